@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// user is the signed-in user returned by login and /api/auth/me
+type user struct {
+	ID       string   `json:"id"`
+	Username string   `json:"username"`
+	IsAdmin  bool     `json:"is_admin"`
+	Groups   []string `json:"groups"`
+}
+
+func cmdLogin(c *client, args []string) error {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	username := flags.String("username", "", "username (prompted if empty)")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin")
+	flags.Parse(args)
+
+	in := bufio.NewReader(os.Stdin)
+	if *username == "" {
+		fmt.Fprint(os.Stderr, "Username: ")
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		*username = strings.TrimSpace(line)
+	}
+
+	var password string
+	switch {
+	case *passwordStdin:
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			return errors.New("no password on stdin")
+		}
+		password = strings.TrimRight(line, "\r\n")
+	case os.Getenv("FILESERV_PASSWORD") != "":
+		password = os.Getenv("FILESERV_PASSWORD")
+	default:
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := readSecret(in)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		password = line
+	}
+
+	var resp struct {
+		Token     string `json:"token"`
+		ExpiresAt int64  `json:"expires_at"`
+		User      user   `json:"user"`
+	}
+	c.token = ""
+	if err := c.do("POST", "/api/auth/login", map[string]string{
+		"username": *username,
+		"password": password,
+	}, &resp); err != nil {
+		return err
+	}
+
+	c.cfg.Server = c.server
+	c.cfg.Token = resp.Token
+	c.cfg.ExpiresAt = resp.ExpiresAt
+	c.cfg.Insecure = c.insecure
+	if err := saveConfig(c.cfg); err != nil {
+		return fmt.Errorf("signed in, but could not save the token: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Signed in to %s as %s until %s\n", c.server, resp.User.Username,
+		formatTime(time.Unix(resp.ExpiresAt, 0)))
+	return nil
+}
+
+// readSecret reads a line from the terminal without echoing it. stty is used so the command
+// needs no terminal library; when stdin is not a terminal the line is read as is.
+func readSecret(in *bufio.Reader) (string, error) {
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	if err := stty("-echo"); err == nil {
+		defer stty("echo")
+	}
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func cmdLogout(c *client, args []string) error {
+	if c.token != "" {
+		if err := c.do("POST", "/api/auth/logout", nil, nil); err != nil && !isStatus(err, 401) {
+			return err
+		}
+	}
+	if c.cfg.Token != "" && c.cfg.Token == c.token {
+		c.cfg.Token = ""
+		c.cfg.ExpiresAt = 0
+		if err := saveConfig(c.cfg); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Signed out")
+	return nil
+}
+
+func cmdWhoami(c *client, args []string) error {
+	var me user
+	if err := c.do("GET", "/api/auth/me", nil, &me); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(me)
+	}
+	role := "user"
+	if me.IsAdmin {
+		role = "admin"
+	}
+	fmt.Printf("%s (%s) on %s\n", me.Username, role, c.server)
+	return nil
+}
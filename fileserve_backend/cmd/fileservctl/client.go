@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// config is saved by login in the user's config directory
+type config struct {
+	Server    string `json:"server"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Insecure  bool   `json:"insecure,omitempty"`
+}
+
+// configDir returns the directory of the config file and upload state
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fileservctl"), nil
+}
+
+func loadConfig() config {
+	var cfg config
+	dir, err := configDir()
+	if err != nil {
+		return cfg
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "config.json")); err == nil {
+		json.Unmarshal(data, &cfg)
+	}
+	return cfg
+}
+
+func saveConfig(cfg config) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The file holds a session token, so only the user may read it
+	return os.WriteFile(filepath.Join(dir, "config.json"), data, 0600)
+}
+
+// apiError is an error response of the API
+type apiError struct {
+	Status    int
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+func (e *apiError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.RequestID != "" {
+		msg += ", request ID " + e.RequestID
+	}
+	return msg
+}
+
+// isStatus reports whether err is an API error with the given status
+func isStatus(err error, status int) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+// client calls the API of one server
+type client struct {
+	server   string
+	token    string
+	insecure bool
+	json     bool
+	http     *http.Client
+	cfg      config
+}
+
+// newClient creates a client from the flags, falling back to the environment and saved config
+func newClient(server, token string, insecure, jsonOutput bool) (*client, error) {
+	cfg := loadConfig()
+	if server == "" {
+		server = os.Getenv("FILESERV_URL")
+	}
+	if server == "" {
+		server = cfg.Server
+	}
+	if token == "" {
+		token = os.Getenv("FILESERV_TOKEN")
+	}
+	if token == "" && strings.TrimRight(server, "/") == strings.TrimRight(cfg.Server, "/") {
+		token = cfg.Token
+		insecure = insecure || cfg.Insecure
+	}
+	if server != "" {
+		u, err := url.Parse(server)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid server URL %q", server)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &client{
+		server:   strings.TrimRight(server, "/"),
+		token:    token,
+		insecure: insecure,
+		json:     jsonOutput,
+		http:     &http.Client{Transport: transport},
+		cfg:      cfg,
+	}, nil
+}
+
+// request sends a request to path, which starts with /api/, and returns the response of a
+// successful request. Error responses are returned as *apiError.
+func (c *client) request(method, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	if c.server == "" {
+		return nil, errors.New("no server configured: run fileservctl login -server URL or set FILESERV_URL")
+	}
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		apiErr := &apiError{Status: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, apiErr) != nil {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		if apiErr.Status == http.StatusUnauthorized && apiErr.Code != "INVALID_CREDENTIALS" {
+			apiErr.Message += "; run fileservctl login"
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// do sends in as JSON and decodes the response into out; either may be nil
+func (c *client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	header := http.Header{}
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.request(method, path, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// printJSON prints v indented, for -json output
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// escapePath escapes each segment of a slash-separated path for use in a URL
+func escapePath(p string) string {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// formatSize formats a byte count for tables
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatTime formats a time for tables
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
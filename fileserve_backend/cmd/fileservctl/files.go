@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// chunkRetries is the number of attempts for each chunk of an upload
+const chunkRetries = 3
+
+// zone is an entry of /api/zones/accessible
+type zone struct {
+	ZoneID    string `json:"zone_id"`
+	ZoneName  string `json:"zone_name"`
+	ZoneType  string `json:"zone_type"`
+	PoolName  string `json:"pool_name"`
+	CanUpload bool   `json:"can_upload"`
+	CanShare  bool   `json:"can_share"`
+}
+
+// fileInfo is an entry of a zone folder listing
+type fileInfo struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	IsDir   bool      `json:"is_dir"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func (c *client) zones() ([]zone, error) {
+	var zones []zone
+	err := c.do("GET", "/api/zones/accessible", nil, &zones)
+	return zones, err
+}
+
+// resolveZone returns the ID of the zone with the given ID or name
+func (c *client) resolveZone(arg string) (string, error) {
+	zones, err := c.zones()
+	if err != nil {
+		return "", err
+	}
+	for _, z := range zones {
+		if z.ZoneID == arg {
+			return z.ZoneID, nil
+		}
+	}
+	for _, z := range zones {
+		if strings.EqualFold(z.ZoneName, arg) {
+			return z.ZoneID, nil
+		}
+	}
+	return "", fmt.Errorf("zone %q not found", arg)
+}
+
+// splitZonePath splits a ZONE:PATH argument
+func splitZonePath(arg string) (zoneArg, p string) {
+	zoneArg, p, _ = strings.Cut(arg, ":")
+	return zoneArg, "/" + strings.Trim(p, "/")
+}
+
+func cmdZones(c *client, args []string) error {
+	zones, err := c.zones()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(zones)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tTYPE\tPOOL\tACCESS")
+	for _, z := range zones {
+		access := "read-only"
+		if z.CanUpload {
+			access = "read-write"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", z.ZoneID, z.ZoneName, z.ZoneType, z.PoolName, access)
+	}
+	return tw.Flush()
+}
+
+func cmdList(c *client, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: fileservctl ls ZONE [PATH]")
+	}
+	zoneID, err := c.resolveZone(args[0])
+	if err != nil {
+		return err
+	}
+	dir := "/"
+	if len(args) == 2 {
+		dir = args[1]
+	}
+
+	var files []fileInfo
+	if err := c.do("GET", "/api/zones/"+url.PathEscape(zoneID)+"/files?path="+url.QueryEscape(dir), nil, &files); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(files)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, f := range files {
+		size, name := formatSize(f.Size), f.Name
+		if f.IsDir {
+			size, name = "-", name+"/"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", formatTime(f.ModTime), size, name)
+	}
+	return tw.Flush()
+}
+
+// uploadState is saved while an upload is in progress so it can resume after interruption
+type uploadState struct {
+	SessionID   string `json:"session_id"`
+	Size        int64  `json:"size"`
+	ModTime     int64  `json:"mod_time"`
+	ChunkSize   int64  `json:"chunk_size"`
+	TotalChunks int    `json:"total_chunks"`
+}
+
+// uploadStatePath returns the state file of uploading a file to a zone folder
+func uploadStatePath(server, file, zoneID, dir string) (string, error) {
+	cfgDir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{server, file, zoneID, dir}, "\x00")))
+	return filepath.Join(cfgDir, "uploads", hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+func cmdUpload(c *client, args []string) error {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	chunkMB := flags.Int64("chunk-size", 0, "chunk size in MB (default: server default)")
+	parallel := flags.Int("parallel", 4, "number of chunks sent at the same time")
+	quiet := flags.Bool("q", false, "do not print progress")
+	flags.Parse(args)
+	if *parallel < 1 {
+		*parallel = 1
+	}
+	if flags.NArg() != 2 {
+		return errors.New("usage: fileservctl upload [-chunk-size MB] [-parallel N] FILE ZONE[:DIR]")
+	}
+
+	file, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", flags.Arg(0))
+	}
+	zoneArg, dir := splitZonePath(flags.Arg(1))
+	zoneID, err := c.resolveZone(zoneArg)
+	if err != nil {
+		return err
+	}
+
+	// Upload sessions need a positive size, so empty files go through the plain upload
+	if info.Size() == 0 {
+		return c.uploadSmall(file, zoneID, dir)
+	}
+
+	statePath, err := uploadStatePath(c.server, file, zoneID, dir)
+	if err != nil {
+		return err
+	}
+	state, missing := c.resumeUpload(statePath, info)
+	if state == nil {
+		var session struct {
+			SessionID   string `json:"session_id"`
+			ChunkSize   int64  `json:"chunk_size"`
+			TotalChunks int    `json:"total_chunks"`
+		}
+		if err := c.do("POST", "/api/upload/session", map[string]interface{}{
+			"filename":    filepath.Base(file),
+			"total_size":  info.Size(),
+			"target_path": dir,
+			"zone_id":     zoneID,
+			"chunk_size":  *chunkMB << 20,
+		}, &session); err != nil {
+			return err
+		}
+		state = &uploadState{
+			SessionID:   session.SessionID,
+			Size:        info.Size(),
+			ModTime:     info.ModTime().UnixNano(),
+			ChunkSize:   session.ChunkSize,
+			TotalChunks: session.TotalChunks,
+		}
+		missing = make([]int, session.TotalChunks)
+		for i := range missing {
+			missing[i] = i
+		}
+		if err := writeUploadState(statePath, state); err != nil {
+			return err
+		}
+	} else if !*quiet {
+		fmt.Fprintf(os.Stderr, "Resuming upload, %d of %d chunks left\n", len(missing), state.TotalChunks)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Chunks are sent by several workers; the server assembles them in any order
+	var (
+		mu       sync.Mutex
+		done     = state.TotalChunks - len(missing)
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	indexes := make(chan int)
+	for w := 0; w < *parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, state.ChunkSize)
+			for index := range indexes {
+				n, err := f.ReadAt(buf, int64(index)*state.ChunkSize)
+				if err == nil || err == io.EOF {
+					err = c.uploadChunk(state.SessionID, index, buf[:n])
+				}
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("chunk %d: %w (run the command again to resume)", index, err)
+				}
+				if err == nil {
+					done++
+					if !*quiet {
+						fmt.Fprintf(os.Stderr, "\r%s: %d/%d chunks", filepath.Base(file), done, state.TotalChunks)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, index := range missing {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	if !*quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	var result struct {
+		Path string `json:"path"`
+	}
+	if err := c.do("POST", "/api/upload/session/"+url.PathEscape(state.SessionID)+"/finalize", nil, &result); err != nil {
+		return err
+	}
+	os.Remove(statePath)
+	if c.json {
+		return printJSON(result)
+	}
+	fmt.Printf("Uploaded %s to %s:%s\n", flags.Arg(0), zoneArg, path.Join(dir, filepath.Base(file)))
+	return nil
+}
+
+// resumeUpload returns the saved state of an upload and its missing chunks, or nil if the
+// upload must start over because the file changed or the server no longer has the session
+func (c *client) resumeUpload(statePath string, info os.FileInfo) (*uploadState, []int) {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, nil
+	}
+	var state uploadState
+	if json.Unmarshal(data, &state) != nil || state.SessionID == "" || state.ChunkSize <= 0 ||
+		state.Size != info.Size() || state.ModTime != info.ModTime().UnixNano() {
+		os.Remove(statePath)
+		return nil, nil
+	}
+
+	var resp struct {
+		MissingChunks []int `json:"missing_chunks"`
+	}
+	if err := c.do("GET", "/api/upload/session/"+url.PathEscape(state.SessionID)+"/missing", nil, &resp); err != nil {
+		os.Remove(statePath)
+		return nil, nil
+	}
+	return &state, resp.MissingChunks
+}
+
+func writeUploadState(statePath string, state *uploadState) error {
+	if err := os.MkdirAll(filepath.Dir(statePath), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath, data, 0600)
+}
+
+// uploadChunk sends one chunk, retrying network and server errors
+func (c *client) uploadChunk(sessionID string, index int, data []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	chunkPath := "/api/upload/session/" + url.PathEscape(sessionID) + "/chunk/" + strconv.Itoa(index)
+
+	var err error
+	for attempt := 1; attempt <= chunkRetries; attempt++ {
+		var resp *http.Response
+		resp, err = c.request("POST", chunkPath, bytes.NewReader(data), header)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			return nil
+		}
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.Status < http.StatusInternalServerError {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+	return err
+}
+
+// uploadSmall uploads a file in a single multipart request
+func (c *client) uploadSmall(file, zoneID, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	mw.Close()
+
+	header := http.Header{}
+	header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := c.request("POST", "/api/zones/"+url.PathEscape(zoneID)+"/files/"+escapePath(dir), &body, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	fmt.Printf("Uploaded %s\n", filepath.Base(file))
+	return nil
+}
+
+func cmdDownload(c *client, args []string) error {
+	flags := flag.NewFlagSet("download", flag.ExitOnError)
+	quiet := flags.Bool("q", false, "do not print progress")
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		return errors.New("usage: fileservctl download ZONE:PATH [DEST]")
+	}
+
+	zoneArg, p := splitZonePath(flags.Arg(0))
+	if p == "/" {
+		return errors.New("a file path is required, e.g. Shared:reports/q1.pdf")
+	}
+	zoneID, err := c.resolveZone(zoneArg)
+	if err != nil {
+		return err
+	}
+	dest := path.Base(p)
+	if flags.NArg() == 2 {
+		dest = flags.Arg(1)
+		if info, err := os.Stat(dest); err == nil && info.IsDir() {
+			dest = filepath.Join(dest, path.Base(p))
+		}
+	}
+
+	// Data goes to DEST.part first; an existing part file is continued with a Range request
+	partPath := dest + ".part"
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.request("GET", "/api/zones/"+url.PathEscape(zoneID)+"/files/"+escapePath(p), nil, header)
+	if isStatus(err, http.StatusRequestedRangeNotSatisfiable) {
+		// The file shrank since the part file was written, so start over
+		os.Remove(partPath)
+		offset = 0
+		resp, err = c.request("GET", "/api/zones/"+url.PathEscape(zoneID)+"/files/"+escapePath(p), nil, nil)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resp.StatusCode == http.StatusPartialContent {
+		mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	} else {
+		offset = 0
+	}
+	out, err := os.OpenFile(partPath, mode, 0644)
+	if err != nil {
+		return err
+	}
+
+	total := offset + resp.ContentLength
+	var w io.Writer = out
+	if !*quiet && resp.ContentLength > 0 {
+		w = &progressWriter{w: out, name: path.Base(p), done: offset, total: total}
+	}
+	_, err = io.Copy(w, resp.Body)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if !*quiet && resp.ContentLength > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return fmt.Errorf("%w (run the command again to resume)", err)
+	}
+	if err := os.Rename(partPath, dest); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(map[string]interface{}{"path": dest, "size": total})
+	}
+	fmt.Printf("Downloaded %s to %s\n", flags.Arg(0), dest)
+	return nil
+}
+
+// progressWriter prints the progress of a download
+type progressWriter struct {
+	w           io.Writer
+	name        string
+	done, total int64
+	printed     time.Time
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done += int64(n)
+	if time.Since(p.printed) > 200*time.Millisecond || p.done == p.total {
+		fmt.Fprintf(os.Stderr, "\r%s: %s / %s", p.name, formatSize(p.done), formatSize(p.total))
+		p.printed = time.Now()
+	}
+	return n, err
+}
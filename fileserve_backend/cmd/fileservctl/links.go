@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// shareLink is a share link returned by /api/links
+type shareLink struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	TargetPath    string     `json:"target_path"`
+	TargetType    string     `json:"target_type"`
+	Token         string     `json:"token"`
+	Slug          string     `json:"slug,omitempty"`
+	Mode          string     `json:"mode"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	DownloadCount int        `json:"download_count"`
+	MaxDownloads  int        `json:"max_downloads"`
+	Enabled       bool       `json:"enabled"`
+}
+
+// url returns the public address of the link, as sent in share emails
+func (l *shareLink) url(server string) string {
+	token := l.Token
+	if l.Slug != "" {
+		token = l.Slug
+	}
+	return server + "/share?token=" + url.QueryEscape(token)
+}
+
+func cmdLink(c *client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: fileservctl link create|list|delete")
+	}
+	switch args[0] {
+	case "create":
+		return cmdLinkCreate(c, args[1:])
+	case "list":
+		return cmdLinkList(c, args[1:])
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("usage: fileservctl link delete ID")
+		}
+		if err := c.do("DELETE", "/api/links/"+url.PathEscape(args[1]), nil, nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Deleted share link %s\n", args[1])
+		return nil
+	}
+	return fmt.Errorf("unknown link command %q", args[0])
+}
+
+func cmdLinkCreate(c *client, args []string) error {
+	flags := flag.NewFlagSet("link create", flag.ExitOnError)
+	name := flags.String("name", "", "display name (default: file name)")
+	slug := flags.String("slug", "", "custom name used in the URL instead of the token")
+	password := flags.String("password", "", "password required to open the link")
+	expires := flags.Int("expires", 0, "hours until the link expires (default 7 days, -1 = never)")
+	maxDownloads := flags.Int("max-downloads", 0, "maximum number of downloads (0 = unlimited)")
+	mode := flags.String("mode", "standard", "standard, request (upload-only folder) or one_time")
+	upload := flags.Bool("upload", false, "allow uploads into a shared folder")
+	noPreview := flags.Bool("no-preview", false, "do not allow previews")
+	var emailTo stringList
+	flags.Var(&emailTo, "email", "send the link to this address (repeatable)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: fileservctl link create [flags] PATH")
+	}
+
+	var link shareLink
+	if err := c.do("POST", "/api/links", map[string]interface{}{
+		"target_path":    flags.Arg(0),
+		"name":           *name,
+		"slug":           *slug,
+		"password":       *password,
+		"expires_in":     *expires,
+		"max_downloads":  *maxDownloads,
+		"mode":           *mode,
+		"allow_download": true,
+		"allow_preview":  !*noPreview,
+		"allow_upload":   *upload,
+		"email_to":       []string(emailTo),
+	}, &link); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(link)
+	}
+	// Only the URL goes to stdout so scripts can capture it
+	fmt.Println(link.url(c.server))
+	return nil
+}
+
+func cmdLinkList(c *client, args []string) error {
+	var links []shareLink
+	if err := c.do("GET", "/api/links", nil, &links); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(links)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tPATH\tDOWNLOADS\tEXPIRES\tURL")
+	for i := range links {
+		l := &links[i]
+		expires := "never"
+		if l.ExpiresAt != nil {
+			expires = formatTime(*l.ExpiresAt)
+		}
+		downloads := fmt.Sprint(l.DownloadCount)
+		if l.MaxDownloads > 0 {
+			downloads += fmt.Sprintf("/%d", l.MaxDownloads)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", l.ID, l.Name, l.TargetPath, downloads, expires, l.url(c.server))
+	}
+	return tw.Flush()
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
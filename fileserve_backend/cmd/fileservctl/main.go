@@ -0,0 +1,79 @@
+// Command fileservctl is a command line client for the FileServ API, for scripts and cron jobs.
+//
+// The server and token come from the -server and -token flags, the FILESERV_URL and
+// FILESERV_TOKEN environment variables, or the config file written by "fileservctl login".
+// API tokens created in the web interface work as -token for unattended use.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: fileservctl [global flags] <command> [arguments]
+
+Commands:
+  login [-username NAME] [-password-stdin]      Sign in and save the session token
+  logout                                        Revoke the session and forget the token
+  whoami                                        Show the signed-in user
+  zones                                         List the zones you can access
+  ls ZONE [PATH]                                List a folder of a zone
+  upload [-parallel N] FILE ZONE[:DIR]          Upload a file; interrupted uploads resume
+  download ZONE:PATH [DEST]                     Download a file; interrupted downloads resume
+  link create [flags] PATH                      Create a share link
+  link list                                     List your share links
+  link delete ID                                Delete a share link
+  snapshot-policy list|get|create|update|delete|run [flags] [ID]
+                                                Manage ZFS snapshot policies (admin)
+
+ZONE is a zone ID or name. Run "fileservctl <command> -h" for the flags of a command.
+
+Global flags:
+`
+
+// commands maps command names to their implementations
+var commands = map[string]func(c *client, args []string) error{
+	"login":           cmdLogin,
+	"logout":          cmdLogout,
+	"whoami":          cmdWhoami,
+	"zones":           cmdZones,
+	"ls":              cmdList,
+	"upload":          cmdUpload,
+	"download":        cmdDownload,
+	"link":            cmdLink,
+	"snapshot-policy": cmdSnapshotPolicy,
+}
+
+func main() {
+	flags := flag.NewFlagSet("fileservctl", flag.ExitOnError)
+	server := flags.String("server", "", "server URL, e.g. https://files.example.com (default $FILESERV_URL or saved)")
+	token := flags.String("token", "", "session or API token (default $FILESERV_TOKEN or saved)")
+	insecure := flags.Bool("insecure", false, "skip TLS certificate verification (self-signed certificates)")
+	jsonOutput := flags.Bool("json", false, "print API responses as JSON")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	run, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "fileservctl: unknown command %q\n\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	c, err := newClient(*server, *token, *insecure, *jsonOutput)
+	if err == nil {
+		err = run(c, flags.Args()[1:])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fileservctl: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// snapshotPolicy is a ZFS snapshot policy returned by /api/zfs/snapshot-policies
+type snapshotPolicy struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Dataset       string     `json:"dataset"`
+	Enabled       bool       `json:"enabled"`
+	Schedule      string     `json:"schedule"`
+	Retention     int        `json:"retention"`
+	Prefix        string     `json:"prefix"`
+	Recursive     bool       `json:"recursive"`
+	LastRun       *time.Time `json:"last_run,omitempty"`
+	NextRun       *time.Time `json:"next_run,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	SnapshotCount int        `json:"snapshot_count"`
+}
+
+const snapshotPolicyUsage = "usage: fileservctl snapshot-policy list|get|create|update|delete|run [flags] [ID]"
+
+func cmdSnapshotPolicy(c *client, args []string) error {
+	if len(args) == 0 {
+		return errors.New(snapshotPolicyUsage)
+	}
+	sub, args := args[0], args[1:]
+
+	switch sub {
+	case "list":
+		var policies []snapshotPolicy
+		if err := c.do("GET", "/api/zfs/snapshot-policies", nil, &policies); err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(policies)
+		}
+		return printSnapshotPolicies(policies)
+
+	case "get":
+		if len(args) != 1 {
+			return errors.New("usage: fileservctl snapshot-policy get ID")
+		}
+		var policy snapshotPolicy
+		if err := c.do("GET", "/api/zfs/snapshot-policies/"+url.PathEscape(args[0]), nil, &policy); err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(policy)
+		}
+		return printSnapshotPolicies([]snapshotPolicy{policy})
+
+	case "create", "update":
+		flags := flag.NewFlagSet("snapshot-policy "+sub, flag.ExitOnError)
+		name := flags.String("name", "", "policy name")
+		dataset := flags.String("dataset", "", "ZFS dataset, e.g. tank/data")
+		schedule := flags.String("schedule", "", "hourly, daily, weekly or monthly (default daily)")
+		retention := flags.Int("retention", 0, "number of snapshots to keep (default 7)")
+		prefix := flags.String("prefix", "", "snapshot name prefix (default auto)")
+		recursive := flags.Bool("recursive", false, "snapshot child datasets too")
+		enabled := flags.Bool("enabled", true, "run the policy on its schedule")
+		flags.Parse(args)
+
+		// Only flags given on the command line are sent, so update leaves the rest unchanged
+		body := map[string]interface{}{}
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "name":
+				body["name"] = *name
+			case "dataset":
+				body["dataset"] = *dataset
+			case "schedule":
+				body["schedule"] = *schedule
+			case "retention":
+				body["retention"] = *retention
+			case "prefix":
+				body["prefix"] = *prefix
+			case "recursive":
+				body["recursive"] = *recursive
+			case "enabled":
+				body["enabled"] = *enabled
+			}
+		})
+
+		var policy snapshotPolicy
+		if sub == "create" {
+			if flags.NArg() != 0 || *name == "" || *dataset == "" {
+				return errors.New("usage: fileservctl snapshot-policy create -name NAME -dataset DATASET [flags]")
+			}
+			body["enabled"] = *enabled
+			if err := c.do("POST", "/api/zfs/snapshot-policies", body, &policy); err != nil {
+				return err
+			}
+		} else {
+			if flags.NArg() != 1 {
+				return errors.New("usage: fileservctl snapshot-policy update [flags] ID")
+			}
+			if len(body) == 0 {
+				return errors.New("nothing to update")
+			}
+			if err := c.do("PUT", "/api/zfs/snapshot-policies/"+url.PathEscape(flags.Arg(0)), body, &policy); err != nil {
+				return err
+			}
+		}
+		if c.json {
+			return printJSON(policy)
+		}
+		return printSnapshotPolicies([]snapshotPolicy{policy})
+
+	case "delete":
+		if len(args) != 1 {
+			return errors.New("usage: fileservctl snapshot-policy delete ID")
+		}
+		if err := c.do("DELETE", "/api/zfs/snapshot-policies/"+url.PathEscape(args[0]), nil, nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Deleted snapshot policy %s\n", args[0])
+		return nil
+
+	case "run":
+		if len(args) != 1 {
+			return errors.New("usage: fileservctl snapshot-policy run ID")
+		}
+		var resp struct {
+			Policy snapshotPolicy `json:"policy"`
+		}
+		if err := c.do("POST", "/api/zfs/snapshot-policies/"+url.PathEscape(args[0])+"/run", nil, &resp); err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(resp.Policy)
+		}
+		// The server records a failed run on the policy instead of returning an error
+		if resp.Policy.LastError != "" {
+			return fmt.Errorf("snapshot policy %s failed: %s", resp.Policy.Name, resp.Policy.LastError)
+		}
+		fmt.Fprintf(os.Stderr, "Ran snapshot policy %s, %d snapshots kept\n", resp.Policy.Name, resp.Policy.SnapshotCount)
+		return nil
+	}
+	return errors.New(snapshotPolicyUsage)
+}
+
+func printSnapshotPolicies(policies []snapshotPolicy) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tDATASET\tSCHEDULE\tKEEP\tSNAPSHOTS\tENABLED\tLAST RUN\tNEXT RUN")
+	for _, p := range policies {
+		lastRun, nextRun := "-", "-"
+		if p.LastRun != nil {
+			lastRun = formatTime(*p.LastRun)
+		}
+		if p.NextRun != nil {
+			nextRun = formatTime(*p.NextRun)
+		}
+		if p.LastError != "" {
+			lastRun += " (failed)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%t\t%s\t%s\n", p.ID, p.Name, p.Dataset, p.Schedule,
+			p.Retention, p.SnapshotCount, p.Enabled, lastRun, nextRun)
+	}
+	return tw.Flush()
+}
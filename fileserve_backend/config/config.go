@@ -1,6 +1,9 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -11,22 +14,63 @@ type Config struct {
 	Port        int
 	DataDir     string
 	StorageFile string
+	// DatabaseURL selects a Postgres database instead of the SQLite file in DataDir
+	DatabaseURL string
 	JWTSecret   string
 	TLSCert     string
 	TLSKey      string
 	UsePAM      bool
 	AdminGroups []string
+	// PreviewCacheMB is the disk space used by cached image previews
+	PreviewCacheMB int
+	// StreamCacheMB is the disk space used by cached video stream segments
+	StreamCacheMB int
+	// SlowQueryMS is how long a database query may take before it is logged, 0 to log none
+	SlowQueryMS int
+	// Listeners are the addresses the server accepts connections on, from LISTEN or PORT
+	Listeners []Listener
+	// Environment is production or development and selects defaults such as the CORS policy
+	Environment string
+	// ExternalURL is the address clients reach the server at through a reverse proxy, possibly
+	// on a subpath, such as https://example.com/files. Empty = derived from each request.
+	ExternalURL string
+	// TrustedProxies are the reverse proxies whose forwarding headers are believed on any listener
+	TrustedProxies []*net.IPNet
+	// UpdateURL is where the release manifests of the update channels are published
+	UpdateURL string
+	// UpdatePublicKey verifies the signatures of releases before they are installed
+	UpdatePublicKey ed25519.PublicKey
+	// ContainersEnabled turns on management of Docker or Podman containers
+	ContainersEnabled bool
+	// ContainerSocket is the Docker or Podman API socket; empty = the first one found
+	ContainerSocket string
 }
 
+// Environments
+const (
+	EnvProduction  = "production"
+	EnvDevelopment = "development"
+)
+
 func Load() *Config {
 	cfg := &Config{
 		Port:        getEnvInt("PORT", 8080),
 		DataDir:     getEnv("DATA_DIR", "./data"),
+		DatabaseURL: getEnv("DATABASE_URL", ""),
 		JWTSecret:   getEnv("JWT_SECRET", ""), // Empty = will be loaded from DB or generated
 		TLSCert:     getEnv("TLS_CERT", ""),
 		TLSKey:      getEnv("TLS_KEY", ""),
 		UsePAM:      getEnvBool("USE_PAM", true),
 		AdminGroups: getEnvList("ADMIN_GROUPS", []string{"sudo", "wheel", "admin", "root"}),
+
+		PreviewCacheMB: getEnvInt("PREVIEW_CACHE_MB", 512),
+		StreamCacheMB:  getEnvInt("STREAM_CACHE_MB", 2048),
+		SlowQueryMS:    getEnvInt("SLOW_QUERY_MS", 500),
+
+		Environment: strings.ToLower(getEnv("ENVIRONMENT", EnvProduction)),
+
+		ContainersEnabled: getEnvBool("CONTAINERS_ENABLED", false),
+		ContainerSocket:   getEnv("CONTAINER_SOCKET", ""),
 	}
 
 	// Ensure data directory exists
@@ -37,9 +81,53 @@ func Load() *Config {
 	// Storage file location
 	cfg.StorageFile = filepath.Join(cfg.DataDir, "storage.json")
 
+	if cfg.Environment != EnvProduction && cfg.Environment != EnvDevelopment {
+		panic("Invalid ENVIRONMENT: must be production or development")
+	}
+
+	// Reverse proxy in front of the server
+	var err error
+	if cfg.ExternalURL, err = parseExternalURL(getEnv("EXTERNAL_URL", "")); err != nil {
+		panic("Invalid EXTERNAL_URL: " + err.Error())
+	}
+	if cfg.TrustedProxies, err = parseTrustedProxies(getEnv("TRUSTED_PROXIES", "")); err != nil {
+		panic("Invalid TRUSTED_PROXIES: " + err.Error())
+	}
+
+	// Self-updates
+	if cfg.UpdateURL, err = parseUpdateURL(getEnv("UPDATE_URL", "")); err != nil {
+		panic("Invalid UPDATE_URL: " + err.Error())
+	}
+	if cfg.UpdatePublicKey, err = parseUpdatePublicKey(getEnv("UPDATE_PUBLIC_KEY", "")); err != nil {
+		panic("Invalid UPDATE_PUBLIC_KEY: " + err.Error())
+	}
+
+	// Listeners from LISTEN, or one on PORT serving HTTPS when a certificate is configured
+	listen := getEnv("LISTEN", "")
+	if listen == "" {
+		kind := ListenHTTP
+		if cfg.TLSCert != "" && cfg.TLSKey != "" {
+			kind = ListenHTTPS
+		}
+		listen = fmt.Sprintf("%s://:%d", kind, cfg.Port)
+	}
+	listeners, err := parseListeners(listen)
+	if err != nil {
+		panic("Invalid LISTEN: " + err.Error())
+	}
+	cfg.Listeners = listeners
+	if err := cfg.validateListeners(); err != nil {
+		panic("Invalid LISTEN: " + err.Error())
+	}
+
 	return cfg
 }
 
+// IsDevelopment reports whether the server runs in the development environment
+func (c *Config) IsDevelopment() bool {
+	return c.Environment == EnvDevelopment
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Listener kinds
+const (
+	ListenHTTP     = "http"     // Plain HTTP
+	ListenHTTPS    = "https"    // HTTPS with TLSCert and TLSKey
+	ListenRedirect = "redirect" // Plain HTTP redirecting every request to the HTTPS listener
+	ListenUnix     = "unix"     // Plain HTTP on a Unix socket, for a reverse proxy on the same host
+)
+
+// Listener is an address the server accepts connections on
+type Listener struct {
+	Kind    string
+	Address string // host:port, or the socket path of a Unix listener
+	// TrustProxy makes the server believe the X-Forwarded-For and X-Forwarded-Proto headers
+	// of requests on this listener. Set it only where all traffic comes through a proxy.
+	TrustProxy bool
+	// SocketMode is the file mode of a Unix socket
+	SocketMode os.FileMode
+}
+
+func (l Listener) String() string {
+	s := l.Kind + " " + l.Address
+	if l.TrustProxy {
+		s += " (behind proxy)"
+	}
+	return s
+}
+
+// parseListeners parses a comma-separated list of listeners such as
+//
+//	https://:8443,redirect://:80,unix:///run/fileserv/http.sock?proxy&mode=0660
+//
+// Any listener may take the proxy option; Unix listeners may set the socket mode.
+func parseListeners(value string) ([]Listener, error) {
+	var listeners []Listener
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listener %q: %v", spec, err)
+		}
+
+		l := Listener{Kind: u.Scheme, Address: u.Host, SocketMode: 0660}
+		switch l.Kind {
+		case ListenHTTP, ListenHTTPS, ListenRedirect:
+			if l.Address == "" {
+				return nil, fmt.Errorf("listener %q has no address", spec)
+			}
+		case ListenUnix:
+			l.Address = u.Path
+			if l.Address == "" {
+				return nil, fmt.Errorf("listener %q has no socket path", spec)
+			}
+		default:
+			return nil, fmt.Errorf("listener %q: kind must be http, https, redirect or unix", spec)
+		}
+
+		options := u.Query()
+		_, l.TrustProxy = options["proxy"]
+		if mode := options.Get("mode"); mode != "" {
+			if l.Kind != ListenUnix {
+				return nil, fmt.Errorf("listener %q: only Unix sockets have a mode", spec)
+			}
+			m, err := strconv.ParseUint(mode, 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("listener %q: invalid mode %q", spec, mode)
+			}
+			l.SocketMode = os.FileMode(m)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// HTTPSListener returns the HTTPS listener redirects point to, or nil when there is none
+func (c *Config) HTTPSListener() *Listener {
+	for i := range c.Listeners {
+		if c.Listeners[i].Kind == ListenHTTPS {
+			return &c.Listeners[i]
+		}
+	}
+	return nil
+}
+
+// validateListeners checks that HTTPS listeners have a certificate and redirects have a target
+func (c *Config) validateListeners() error {
+	if len(c.Listeners) == 0 {
+		return fmt.Errorf("no listeners configured")
+	}
+	hasTLS := c.TLSCert != "" && c.TLSKey != ""
+	for _, l := range c.Listeners {
+		switch l.Kind {
+		case ListenHTTPS:
+			if !hasTLS {
+				return fmt.Errorf("listener %s needs TLS_CERT and TLS_KEY", l)
+			}
+		case ListenRedirect:
+			if c.HTTPSListener() == nil {
+				return fmt.Errorf("listener %s needs an https listener to redirect to", l)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// parseUpdateURL checks that the release feed is an absolute https URL and returns it without
+// a trailing slash
+func parseUpdateURL(value string) (string, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "/")
+	if value == "" {
+		return "", nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("%q must be an absolute https URL", value)
+	}
+	return value, nil
+}
+
+// parseUpdatePublicKey decodes a base64 Ed25519 public key
+func parseUpdatePublicKey(value string) (ed25519.PublicKey, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("must be a base64 Ed25519 public key of %d bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// UpdatesEnabled reports whether self-updates are configured: releases are only installed when
+// they can be verified
+func (c *Config) UpdatesEnabled() bool {
+	return c.UpdateURL != "" && c.UpdatePublicKey != nil
+}
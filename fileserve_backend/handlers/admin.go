@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"fileserv/config"
+	"fileserv/internal/apierror"
 	"fileserv/models"
 	"fileserv/storage"
 
@@ -18,10 +19,21 @@ type Stats struct {
 	TotalPermissions int   `json:"total_permissions"`
 	TotalFiles       int   `json:"total_files"`
 	TotalSize        int64 `json:"total_size"`
+
+	// Today's dashboard statistics, as recorded in the daily history
+	IndexedFiles int64 `json:"indexed_files"`
+	UsedBytes    int64 `json:"used_bytes"`
+	ActiveUsers  int64 `json:"active_users_today"`
+	BytesServed  int64 `json:"bytes_served_today"`
 }
 
-func GetStats(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
+// GetStats returns a snapshot of the server. Today's daily statistics are recorded first so the
+// snapshot matches the history charts.
+func GetStats(store storage.DataStore, cfg *config.Config, recorder *StatsRecorder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		recorder.Record()
+		today := recorder.today()
+
 		users := store.ListUsers()
 		permissions := store.ListPermissions()
 
@@ -45,6 +57,10 @@ func GetStats(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 			TotalPermissions: len(permissions),
 			TotalFiles:       totalFiles,
 			TotalSize:        totalSize,
+			IndexedFiles:     today[models.StatFiles],
+			UsedBytes:        today[models.StatUsedBytes],
+			ActiveUsers:      today[models.StatActiveUsers],
+			BytesServed:      today[models.StatBytesServed],
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -72,23 +88,23 @@ func CreatePermission(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreatePermissionRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
 			return
 		}
 
 		if req.Path == "" || req.Type == "" {
-			http.Error(w, "Path and type are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Path and type are required", nil)
 			return
 		}
 
 		if req.Username == "" && req.Group == "" {
-			http.Error(w, "Either username or group is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Either username or group is required", nil)
 			return
 		}
 
 		perm, err := store.CreatePermission(req.Path, req.Type, req.Username, req.Group)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -102,12 +118,12 @@ func DeletePermission(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
-			http.Error(w, "Permission ID is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Permission ID is required", nil)
 			return
 		}
 
 		if err := store.DeletePermission(id); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -126,19 +142,19 @@ func UpdatePermission(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
-			http.Error(w, "Permission ID is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Permission ID is required", nil)
 			return
 		}
 
 		var req UpdatePermissionRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
 			return
 		}
 
 		perm, err := store.UpdatePermission(id, req.Path, req.Type, req.Username, req.Group)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
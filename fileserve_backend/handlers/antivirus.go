@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/clamav"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// errScannerUnavailable is returned when an upload is rejected because clamd cannot be reached
+var errScannerUnavailable = errors.New("virus scanner is unavailable, please try again later")
+
+// infectedError is returned when an uploaded file was quarantined
+type infectedError struct {
+	Signature string
+}
+
+func (e *infectedError) Error() string {
+	return "File rejected: malware detected (" + e.Signature + ")"
+}
+
+// GetAntivirusSettingsFromStore returns the upload scanning settings
+func GetAntivirusSettingsFromStore(store storage.DataStore) models.AntivirusSettings {
+	settings := models.AntivirusSettings{
+		ClamdAddress:  models.DefaultClamdAddress,
+		QuarantineDir: models.DefaultQuarantineDir,
+	}
+	if setting, err := store.GetSetting(models.SettingAVEnabled); err == nil && setting != nil {
+		settings.Enabled = setting.Value == "true"
+	}
+	if setting, err := store.GetSetting(models.SettingAVFailClosed); err == nil && setting != nil {
+		settings.FailClosed = setting.Value == "true"
+	}
+	if setting, err := store.GetSetting(models.SettingAVClamdAddress); err == nil && setting != nil && setting.Value != "" {
+		settings.ClamdAddress = setting.Value
+	}
+	if setting, err := store.GetSetting(models.SettingAVQuarantineDir); err == nil && setting != nil && setting.Value != "" {
+		settings.QuarantineDir = setting.Value
+	}
+	return settings
+}
+
+// scanUpload scans a newly written file when scanning is enabled. Infected files are moved to the
+// quarantine directory; if clamd cannot be reached the file is kept, or removed when failing closed.
+func scanUpload(store storage.DataStore, fullPath, uploaderID, uploaderName string) error {
+	settings := GetAntivirusSettingsFromStore(store)
+	if !settings.Enabled {
+		return nil
+	}
+
+	result, err := clamav.New(settings.ClamdAddress).ScanFile(fullPath)
+	if err != nil {
+		log.Printf("Antivirus: failed to scan %s: %v", fullPath, err)
+		if settings.FailClosed {
+			os.Remove(fullPath)
+			return errScannerUnavailable
+		}
+		return nil
+	}
+	if !result.Infected {
+		return nil
+	}
+
+	log.Printf("Antivirus: %s uploaded by %s is infected (%s)", fullPath, uploaderName, result.Signature)
+	item, err := quarantineFile(store, settings.QuarantineDir, fullPath, &models.QuarantineItem{
+		Signature:      result.Signature,
+		UploadedBy:     uploaderID,
+		UploadedByName: uploaderName,
+	})
+	if err != nil {
+		log.Printf("Antivirus: failed to quarantine %s, deleting it: %v", fullPath, err)
+		os.Remove(fullPath)
+	} else {
+		publishMalwareDetected(item)
+	}
+	return &infectedError{Signature: result.Signature}
+}
+
+// writeScanError reports a rejected upload to the client
+func writeScanError(w http.ResponseWriter, err error) {
+	var infected *infectedError
+	if errors.As(err, &infected) {
+		apierror.Write(w, http.StatusUnprocessableEntity, apierror.CodeUnprocessableEntity, err.Error(), nil)
+		return
+	}
+	apierror.Error(w, err.Error(), http.StatusServiceUnavailable)
+}
+
+// quarantineFile moves an infected file out of its zone and records where it came from
+func quarantineFile(store storage.DataStore, dir, fullPath string, item *models.QuarantineItem) (*models.QuarantineItem, error) {
+	zone, root := zoneForPath(store, fullPath)
+	if zone == nil {
+		return nil, errors.New("file is not inside a zone")
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	item.ZoneID = zone.ID
+	item.OriginalPath = usageRelPath(root, fullPath)
+	item.Name = info.Name()
+	item.Size = info.Size()
+	item, err = store.CreateQuarantineItem(item)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := moveFile(fullPath, filepath.Join(dir, item.ID)); err != nil {
+		store.DeleteQuarantineItem(item.ID)
+		return nil, err
+	}
+	os.Chmod(filepath.Join(dir, item.ID), 0600)
+	return item, nil
+}
+
+// moveFile renames a file, copying it when the destination is on another filesystem
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// GetAntivirusSettings returns the scanning settings and whether clamd is reachable (admin only)
+func GetAntivirusSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings := GetAntivirusSettingsFromStore(store)
+
+		status := map[string]interface{}{
+			"settings":        settings,
+			"clamd_available": false,
+		}
+		if err := clamav.New(settings.ClamdAddress).Ping(); err != nil {
+			status["error"] = err.Error()
+		} else {
+			status["clamd_available"] = true
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// UpdateAntivirusSettings saves the scanning settings (admin only)
+func UpdateAntivirusSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := GetAntivirusSettingsFromStore(store)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		req.ClamdAddress = strings.TrimSpace(req.ClamdAddress)
+		req.QuarantineDir = filepath.Clean(strings.TrimSpace(req.QuarantineDir))
+		if req.ClamdAddress == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "clamd address is required", nil)
+			return
+		}
+		if !filepath.IsAbs(req.QuarantineDir) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Quarantine directory must be an absolute path", nil)
+			return
+		}
+		if req.Enabled {
+			if err := os.MkdirAll(req.QuarantineDir, 0700); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot create quarantine directory: "+err.Error(), nil)
+				return
+			}
+		}
+
+		category := string(models.CategorySecurity)
+		store.SetSetting(models.SettingAVEnabled, strconv.FormatBool(req.Enabled), "bool", category)
+		store.SetSetting(models.SettingAVClamdAddress, req.ClamdAddress, "string", category)
+		store.SetSetting(models.SettingAVQuarantineDir, req.QuarantineDir, "string", category)
+		store.SetSetting(models.SettingAVFailClosed, strconv.FormatBool(req.FailClosed), "bool", category)
+
+		GetAntivirusSettings(store)(w, r)
+	}
+}
+
+// ListQuarantine returns all quarantined files (admin only)
+func ListQuarantine(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(store.ListQuarantineItems())
+	}
+}
+
+// DeleteQuarantineItem permanently deletes a quarantined file (admin only)
+func DeleteQuarantineItem(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item, err := store.GetQuarantineItem(chi.URLParam(r, "id"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeQuarantineItemNotFound, err.Error(), nil)
+			return
+		}
+
+		dir := GetAntivirusSettingsFromStore(store).QuarantineDir
+		if err := os.Remove(filepath.Join(dir, item.ID)); err != nil && !os.IsNotExist(err) {
+			apierror.Error(w, "Failed to delete file: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		store.DeleteQuarantineItem(item.ID)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RestoreQuarantineItem moves a quarantined file back to where it was uploaded, for false positives (admin only)
+func RestoreQuarantineItem(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item, err := store.GetQuarantineItem(chi.URLParam(r, "id"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeQuarantineItemNotFound, err.Error(), nil)
+			return
+		}
+
+		zone, err := store.GetShareZone(item.ZoneID)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, "Zone no longer exists", nil)
+			return
+		}
+		pool, err := store.GetStoragePool(zone.PoolID)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodePoolNotFound, "Pool not found", nil)
+			return
+		}
+
+		target := filepath.Join(pool.Path, zone.Path, filepath.FromSlash(item.OriginalPath))
+		if _, err := os.Lstat(target); err == nil {
+			apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "A file already exists at the original location", nil)
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			apierror.Error(w, "Failed to recreate parent folder: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		dir := GetAntivirusSettingsFromStore(store).QuarantineDir
+		if err := moveFile(filepath.Join(dir, item.ID), target); err != nil {
+			apierror.Error(w, "Failed to restore file: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		os.Chmod(target, 0644)
+
+		store.DeleteQuarantineItem(item.ID)
+		indexPath(store, target)
+		chargeZoneUsage(store, zone, pool, target, item.UploadedByName, item.Size)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "File restored successfully",
+			"path":    item.OriginalPath,
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/openapi"
+	"fileserv/middleware"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// swaggerUIVersion is the Swagger UI release loaded from the CDN when none is embedded. It
+// matches SWAGGER_UI_VERSION in the Makefile.
+const swaggerUIVersion = "5.17.14"
+
+// swaggerUICDN is where the page loads Swagger UI from when make swagger-ui was not run
+const swaggerUICDN = "https://unpkg.com/swagger-ui-dist@" + swaggerUIVersion + "/"
+
+// swaggerUIPage renders the OpenAPI document with Swagger UI loaded from the given base. Paths
+// are relative to /api/docs, so the page also works below a subpath.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>FileServ API</title>
+  <link rel="stylesheet" href="%[1]sswagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="%[1]sswagger-ui-bundle.js"></script>
+  <script src="docs/init.js"></script>
+</body>
+</html>
+`
+
+// swaggerUIPolicy only allows the docs page to load what the server itself serves, and
+// Swagger UI from the CDN when it is not embedded
+func swaggerUIPolicy(cdn string) string {
+	self := "'self'"
+	if cdn != "" {
+		self += " " + cdn
+	}
+	return "default-src 'self'; " +
+		"script-src " + self + "; " +
+		"style-src " + self + " 'unsafe-inline'; " +
+		"img-src " + self + " data:; " +
+		"connect-src 'self'; " +
+		"frame-ancestors 'none'"
+}
+
+// APIDocsHandler serves the OpenAPI document of the router and a Swagger UI page for it
+type APIDocsHandler struct {
+	routes chi.Routes
+
+	once sync.Once
+	doc  []byte
+	err  error
+}
+
+// NewAPIDocsHandler creates a new API docs handler. The document is generated on first
+// request, once all routes have been registered.
+func NewAPIDocsHandler(routes chi.Routes) *APIDocsHandler {
+	return &APIDocsHandler{routes: routes}
+}
+
+// GetOpenAPI returns the OpenAPI document describing the API
+func (h *APIDocsHandler) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	h.once.Do(func() {
+		doc, err := openapi.Generate(h.routes, openapi.Info{
+			Title:       "FileServ API",
+			Description: "File sharing and storage management API. Generated from the server's routes.",
+			Version:     "1.0",
+		}, "/api/", "/s/")
+		if err != nil {
+			h.err = err
+			return
+		}
+		h.doc, h.err = json.Marshal(doc)
+	})
+	if h.err != nil {
+		log.Printf("Failed to generate OpenAPI document: %v", h.err)
+		apierror.Error(w, "Failed to generate API document", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(h.doc)
+}
+
+// GetSwaggerUI returns the Swagger UI page. It uses the assets embedded in the binary, or the
+// pinned release from the CDN when the build has none.
+func (h *APIDocsHandler) GetSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	base, cdn := "docs/assets/", ""
+	if _, ok := openapi.SwaggerUI(); !ok {
+		base, cdn = swaggerUICDN, "https://unpkg.com"
+	}
+	w.Header().Set("Content-Security-Policy", swaggerUIPolicy(cdn))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, swaggerUIPage, base)
+}
+
+// GetSwaggerUIAsset returns a stylesheet or script of the embedded Swagger UI
+func (h *APIDocsHandler) GetSwaggerUIAsset(w http.ResponseWriter, r *http.Request) {
+	assets, ok := openapi.SwaggerUI()
+	if !ok {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Swagger UI is not bundled with this build", nil)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFileFS(w, r, assets, chi.URLParam(r, "*"))
+}
+
+// GetSwaggerUIInit returns the script that starts Swagger UI. The document is loaded from the
+// address clients reach the server at, so it is found behind a proxy on a subpath. Authorization
+// is not persisted, so tokens entered on the page are not kept in local storage.
+func (h *APIDocsHandler) GetSwaggerUIInit(w http.ResponseWriter, r *http.Request) {
+	specURL, _ := json.Marshal(middleware.BaseURL(r) + "/api/openapi.json")
+	w.Header().Set("Content-Type", "application/javascript")
+	fmt.Fprintf(w, `window.ui = SwaggerUIBundle({
+  url: %s,
+  dom_id: '#swagger-ui',
+  deepLinking: true,
+});
+`, specURL)
+}
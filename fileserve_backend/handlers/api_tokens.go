@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// APITokenHandler handles API token management and validation
+type APITokenHandler struct {
+	store storage.DataStore
+	cfg   *config.Config
+}
+
+// NewAPITokenHandler creates a new API token handler
+func NewAPITokenHandler(store storage.DataStore, cfg *config.Config) *APITokenHandler {
+	return &APITokenHandler{store: store, cfg: cfg}
+}
+
+// CreateAPITokenRequest is the request body for minting a token
+type CreateAPITokenRequest struct {
+	Name          string               `json:"name"`
+	Scope         models.APITokenScope `json:"scope"`
+	Zones         []string             `json:"zones"`           // Empty = all zones the user can access
+	ExpiresInDays int                  `json:"expires_in_days"` // 0 = never expires
+}
+
+// hashAPIToken returns the hex SHA-256 of a token as stored in the database
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateAPIToken resolves a bearer API token to a user context (implements middleware.TokenValidator)
+func (h *APITokenHandler) ValidateAPIToken(token string) (*middleware.UserContext, error) {
+	apiToken, err := h.store.GetAPITokenByHash(hashAPIToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if apiToken.IsExpired() {
+		return nil, errors.New("API token has expired")
+	}
+
+	// The owner is loaded on every request, so tokens stop working when the user is deleted
+	// and follow their current groups. A new account that reuses the username has a new ID.
+	owner, err := userContextByID(h.store, h.cfg, apiToken.UserID)
+	if err != nil {
+		return nil, errors.New("API token owner no longer exists")
+	}
+	if owner.IsGuest || owner.Username != apiToken.Username {
+		return nil, errors.New("API token owner no longer exists")
+	}
+
+	h.store.UpdateAPITokenLastUsed(apiToken.ID, time.Now())
+
+	// Tokens never carry admin rights, even when minted by an admin
+	return &middleware.UserContext{
+		UserID:     owner.UserID,
+		Username:   owner.Username,
+		IsAdmin:    false,
+		Groups:     owner.Groups,
+		TokenID:    apiToken.ID,
+		TokenScope: apiToken.Scope,
+		TokenZones: apiToken.Zones,
+	}, nil
+}
+
+// ListMyTokens returns the current user's API tokens
+func (h *APITokenHandler) ListMyTokens(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.ListAPITokensByUser(userCtx.UserID))
+}
+
+// ListAllTokens returns every API token (admin only)
+func (h *APITokenHandler) ListAllTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.ListAPITokens())
+}
+
+// CreateToken mints a new API token. The token value is only returned once.
+func (h *APITokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	if userCtx.IsAPIToken() {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "API tokens cannot be used to create tokens", nil)
+		return
+	}
+
+	if userCtx.IsGuest {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Guest accounts cannot create API tokens", nil)
+		return
+	}
+
+	if userCtx.IsImpersonated() {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "API tokens cannot be created while impersonating", nil)
+		return
+	}
+
+	var req CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	if req.Name == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Token name is required", nil)
+		return
+	}
+
+	if req.Scope == "" {
+		req.Scope = models.TokenScopeReadOnly
+	}
+	if !req.Scope.IsValid() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid scope (must be read_only, upload_only, or read_write)", nil)
+		return
+	}
+
+	if req.ExpiresInDays < 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "expires_in_days cannot be negative", nil)
+		return
+	}
+
+	// Zones must exist and be accessible to the user minting the token
+	user := userFromContext(userCtx)
+	for _, zoneID := range req.Zones {
+		zone, err := h.store.GetShareZone(zoneID)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Zone not found: "+zoneID, nil)
+			return
+		}
+		if !zone.UserHasZoneAccess(user) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied to zone: "+zone.Name, nil)
+			return
+		}
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		apierror.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	tokenValue := models.APITokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	apiToken := &models.APIToken{
+		UserID:      userCtx.UserID,
+		Username:    userCtx.Username,
+		Groups:      userCtx.Groups,
+		Name:        req.Name,
+		TokenHash:   hashAPIToken(tokenValue),
+		TokenPrefix: tokenValue[:len(models.APITokenPrefix)+6],
+		Scope:       req.Scope,
+		Zones:       req.Zones,
+	}
+	if req.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		apiToken.ExpiresAt = &expires
+	}
+
+	created, err := h.store.CreateAPIToken(apiToken)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":   tokenValue,
+		"details": created,
+		"message": "Store this token securely - it will not be shown again",
+	})
+}
+
+// DeleteToken revokes an API token (owner or admin)
+func (h *APITokenHandler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+
+	apiToken, err := h.store.GetAPIToken(id)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeTokenNotFound, "Token not found", nil)
+		return
+	}
+
+	if apiToken.UserID != userCtx.UserID && !userCtx.IsAdmin {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
+		return
+	}
+
+	if err := h.store.DeleteAPIToken(id); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,591 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	archiveListLimit = 10000 // Entries returned by a listing
+	// sevenZipTimeout bounds the time 7-Zip may take to list or unpack an archive
+	sevenZipTimeout = 30 * time.Minute
+)
+
+// archiveFormat returns the archive format of a file from its name, or "" if it is not an archive
+func archiveFormat(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"), strings.HasSuffix(name, ".tbz"):
+		return "tar.bz2"
+	case strings.HasSuffix(name, ".7z"):
+		return "7z"
+	}
+	return ""
+}
+
+// archiveBaseName strips the archive extension from a file name
+func archiveBaseName(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tar.bz2", ".tgz", ".tbz2", ".tbz", ".tar", ".zip", ".7z"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// cleanArchivePath turns an entry name into a relative slash-separated path that cannot leave the
+// extraction folder. It returns "" for entries without a usable name.
+func cleanArchivePath(name string) string {
+	clean := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	return strings.TrimPrefix(clean, "/")
+}
+
+// sevenZipBinary returns the 7-Zip executable found in PATH
+func sevenZipBinary() (string, error) {
+	for _, name := range []string{"7z", "7zz", "7za"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New("7z archives need 7-Zip (install p7zip or 7zip)")
+}
+
+// walkArchive calls fn for every entry of a zip or tar archive. open returns the content of a
+// file entry and is only valid during the call.
+func walkArchive(fullPath, format string, fn func(entry *models.ArchiveEntry, open func() (io.ReadCloser, error)) error) error {
+	if format == "zip" {
+		r, err := zip.OpenReader(fullPath)
+		if err != nil {
+			return fmt.Errorf("not a valid zip file: %v", err)
+		}
+		defer r.Close()
+
+		for _, f := range r.File {
+			entry := &models.ArchiveEntry{
+				Path:    cleanArchivePath(f.Name),
+				Size:    int64(f.UncompressedSize64),
+				ModTime: f.Modified,
+				IsDir:   f.FileInfo().IsDir(),
+			}
+			if entry.Path == "" || (!entry.IsDir && !f.Mode().IsRegular()) {
+				continue
+			}
+			if err := fn(entry, f.Open); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var src io.Reader = bufio.NewReader(file)
+	switch format {
+	case "tar.gz":
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return fmt.Errorf("not a valid gzip file: %v", err)
+		}
+		defer gz.Close()
+		src = gz
+	case "tar.bz2":
+		src = bzip2.NewReader(src)
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("not a valid tar file: %v", err)
+		}
+		// Links and devices are not extracted
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir {
+			continue
+		}
+		entry := &models.ArchiveEntry{
+			Path:    cleanArchivePath(hdr.Name),
+			Size:    hdr.Size,
+			ModTime: hdr.ModTime,
+			IsDir:   hdr.Typeflag == tar.TypeDir,
+		}
+		if entry.Path == "" {
+			continue
+		}
+		if err := fn(entry, func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }); err != nil {
+			return err
+		}
+	}
+}
+
+// listSevenZip lists a 7z archive with the 7-Zip command line tool
+func listSevenZip(fullPath string) ([]*models.ArchiveEntry, error) {
+	binary, err := sevenZipBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sevenZipTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, binary, "l", "-slt", "-ba", "-p", fullPath).Output()
+	if err != nil {
+		return nil, fmt.Errorf("not a valid 7z file: %v", err)
+	}
+
+	var entries []*models.ArchiveEntry
+	var current *models.ArchiveEntry
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), " = ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			current = &models.ArchiveEntry{Path: cleanArchivePath(value)}
+			if current.Path != "" {
+				entries = append(entries, current)
+			}
+		case "Size":
+			if current != nil {
+				current.Size, _ = strconv.ParseInt(value, 10, 64)
+			}
+		case "Modified":
+			if current != nil {
+				value, _, _ = strings.Cut(value, ".")
+				if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+					current.ModTime = t
+				}
+			}
+		case "Folder":
+			if current != nil && value == "+" {
+				current.IsDir = true
+			}
+		case "Attributes":
+			if current != nil && strings.HasPrefix(value, "D") {
+				current.IsDir = true
+			}
+		}
+	}
+	return entries, nil
+}
+
+// unpackSevenZip extracts a 7z archive into dir with the 7-Zip command line tool
+func unpackSevenZip(fullPath, dir string) error {
+	binary, err := sevenZipBinary()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sevenZipTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, binary, "x", "-y", "-p", "-o"+dir, fullPath).CombinedOutput()
+	if ctx.Err() != nil {
+		return errors.New("timed out extracting 7z archive")
+	}
+	if err != nil {
+		return fmt.Errorf("7-Zip failed: %v: %s", err, strings.TrimSpace(lastLines(output, 3)))
+	}
+	return nil
+}
+
+// lastLines returns the last n non-empty lines of command output
+func lastLines(output []byte, n int) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// listArchive returns the entries of an archive, up to archiveListLimit
+func listArchive(fullPath, format string) (*models.ArchiveListing, error) {
+	listing := &models.ArchiveListing{Format: format, Entries: []*models.ArchiveEntry{}}
+	add := func(entry *models.ArchiveEntry) {
+		if !entry.IsDir {
+			listing.TotalFiles++
+			listing.TotalSize += entry.Size
+		}
+		if len(listing.Entries) < archiveListLimit {
+			listing.Entries = append(listing.Entries, entry)
+		} else {
+			listing.Truncated = true
+		}
+	}
+
+	if format == "7z" {
+		entries, err := listSevenZip(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			add(entry)
+		}
+		return listing, nil
+	}
+
+	err := walkArchive(fullPath, format, func(entry *models.ArchiveEntry, _ func() (io.ReadCloser, error)) error {
+		add(entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+// ============================================================================
+// Extract and Archive Jobs
+// ============================================================================
+
+// prepareExtract checks an extract job request: one archive on a local pool and a target folder,
+// which defaults to one named after the archive next to it
+func (h *JobHandler) prepareExtract(w http.ResponseWriter, zone *models.ShareZone, pool *models.StoragePool, req *models.JobRequest, userCtx *middleware.UserContext) (*treeWriter, string, string, bool) {
+	if len(req.Paths) != 1 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Extract takes exactly one archive", nil)
+		return nil, "", "", false
+	}
+	archivePath, _, _, err := h.files.resolveZonePathWithPool(zone.ID, req.Paths[0], userFromContext(userCtx))
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return nil, "", "", false
+	}
+
+	format := archiveFormat(archivePath)
+	if format == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a supported archive (zip, tar, tar.gz, tar.bz2 or 7z)", nil)
+		return nil, "", "", false
+	}
+	if info, err := os.Stat(archivePath); err != nil || !info.Mode().IsRegular() {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		return nil, "", "", false
+	}
+	if format == "7z" {
+		if _, err := sevenZipBinary(); err != nil {
+			apierror.Error(w, err.Error(), http.StatusNotImplemented)
+			return nil, "", "", false
+		}
+	}
+
+	if req.Destination == "" {
+		req.Destination = path.Join(path.Dir(req.Paths[0]), archiveBaseName(path.Base(req.Paths[0])))
+	}
+	t, ok := h.writerFor(w, zone, pool, req.Destination, req.Collision, userCtx)
+	if !ok {
+		return nil, "", "", false
+	}
+	return t, archivePath, format, true
+}
+
+// runExtractJob writes every entry of an archive below the target folder. 7z archives are
+// unpacked into a staging folder by 7-Zip first and then moved in entry by entry.
+func runExtractJob(run *jobRun, t *treeWriter, archivePath, format string) error {
+	listing, err := listArchive(archivePath, format)
+	if err != nil {
+		return err
+	}
+	// Check the quota up front with the uncompressed size; each file is checked again as it is written
+	if err := checkZoneQuota(t.store, t.zone, t.pool, t.target, t.userCtx.Username, listing.TotalSize); err != nil {
+		return err
+	}
+	run.addTotals(listing.TotalFiles, listing.TotalSize)
+
+	if err := t.mkdirAll(t.target); err != nil {
+		return err
+	}
+	run.setResult(map[string]string{"destination": usageRelPath(t.root, t.target)})
+
+	if format != "7z" {
+		return walkArchive(archivePath, format, t.writeEntry)
+	}
+
+	staging, err := os.MkdirTemp(t.target, ".extract-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := unpackSevenZip(archivePath, staging); err != nil {
+		return err
+	}
+	return filepath.Walk(staging, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == staging {
+			return nil
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(staging, p)
+		entry := &models.ArchiveEntry{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		}
+		return t.writeEntry(entry, func() (io.ReadCloser, error) { return os.Open(p) })
+	})
+}
+
+// prepareArchive checks an archive job request and returns the path of the zip file to create.
+// The zip defaults to one named after the first item next to it; an existing file is replaced,
+// renamed around or reported following the collision policy.
+func (h *JobHandler) prepareArchive(w http.ResponseWriter, zone *models.ShareZone, pool *models.StoragePool, req *models.JobRequest, userCtx *middleware.UserContext) (string, bool) {
+	if req.Destination == "" {
+		name := "archive"
+		if len(req.Paths) == 1 && req.Paths[0] != "/" {
+			name = path.Base(req.Paths[0])
+		}
+		req.Destination = path.Join(path.Dir(req.Paths[0]), name+".zip")
+	}
+	if !strings.HasSuffix(strings.ToLower(req.Destination), ".zip") {
+		req.Destination += ".zip"
+	}
+
+	dest, _, _, err := h.files.resolveZonePathWithPool(zone.ID, req.Destination, userFromContext(userCtx))
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return "", false
+	}
+	if info, err := os.Stat(filepath.Dir(dest)); err != nil || !info.IsDir() {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFolderNotFound, "Destination folder not found", nil)
+		return "", false
+	}
+
+	if existing, err := os.Lstat(dest); err == nil {
+		switch {
+		case req.Collision == models.CollisionRename:
+			dest = availableFilename(filepath.Dir(dest), filepath.Base(dest))
+			req.Destination = path.Join(path.Dir(req.Destination), filepath.Base(dest))
+		case req.Collision == models.CollisionOverwrite && existing.Mode().IsRegular():
+		default:
+			apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "Destination already exists", nil)
+			return "", false
+		}
+	}
+	return dest, true
+}
+
+// runArchiveJob packs files and folders into a zip file. The zip is written to a temporary file
+// next to dest and only replaces it once complete.
+func (h *JobHandler) runArchiveJob(run *jobRun, zone *models.ShareZone, pool *models.StoragePool, paths []string, dest string, userCtx *middleware.UserContext) error {
+	user := userFromContext(userCtx)
+	root := filepath.Join(pool.Path, zone.Path)
+
+	var sources []string
+	var total int64
+	for _, p := range paths {
+		fullPath, _, _, err := h.files.resolveZonePathWithPool(zone.ID, p, user)
+		if err != nil {
+			run.addTotals(1, 0)
+			run.itemFailed(p, err)
+			continue
+		}
+		files, size := treeSize(root, fullPath)
+		run.addTotals(files, size)
+		total += size
+		sources = append(sources, fullPath)
+	}
+	if len(sources) == 0 {
+		return errors.New("nothing to archive")
+	}
+	// Compression only makes the zip smaller, so the total size is an upper bound
+	if err := checkZoneQuota(h.store, zone, pool, dest, userCtx.Username, total); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".archive-*.zip.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+	for _, src := range sources {
+		base := filepath.Base(src)
+		err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				run.itemFailed(usageRelPath(root, p), err)
+				return nil
+			}
+			if isReservedZonePath(root, p) {
+				return filepath.SkipDir
+			}
+			if p == tmp.Name() || p == dest || (!info.IsDir() && !info.Mode().IsRegular()) {
+				return nil
+			}
+			if err := run.check(); err != nil {
+				return err
+			}
+
+			rel, _ := filepath.Rel(src, p)
+			hdr, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			hdr.Name = filepath.ToSlash(filepath.Join(base, rel))
+			if info.IsDir() {
+				hdr.Name += "/"
+				_, err := zw.CreateHeader(hdr)
+				return err
+			}
+			hdr.Method = zip.Deflate
+
+			f, err := os.Open(p)
+			if err != nil {
+				run.itemFailed(usageRelPath(root, p), err)
+				return nil
+			}
+			defer f.Close()
+			entry, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(entry, run.reader(f)); err != nil {
+				return err
+			}
+			run.itemDone()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if err := checkFileLock(h.store, dest, userCtx.UserID, false); err != nil {
+		return err
+	}
+	replaced := pathUsage(h.store, zone, pool, dest)
+	version, err := saveFileVersion(h.store, dest, userCtx)
+	if err != nil {
+		log.Printf("Failed to save previous version of %s: %v", dest, err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		undoFileVersion(h.store, version, dest)
+		return err
+	}
+	os.Chmod(dest, 0644)
+	chownToUser(dest, userCtx.Username)
+	indexPath(h.store, dest)
+	chargeZoneUsage(h.store, zone, pool, dest, userCtx.Username, info.Size()-replaced)
+
+	run.setResult(map[string]interface{}{
+		"path": usageRelPath(root, dest),
+		"size": info.Size(),
+	})
+	return nil
+}
+
+// ============================================================================
+// HTTP Handlers
+// ============================================================================
+
+// ArchiveHandler lists the content of archives in zones. Extraction runs as a job.
+type ArchiveHandler struct {
+	store storage.DataStore
+	files *ZoneFileHandler
+}
+
+// NewArchiveHandler creates a new handler
+func NewArchiveHandler(store storage.DataStore) *ArchiveHandler {
+	return &ArchiveHandler{
+		store: store,
+		files: NewZoneFileHandler(store),
+	}
+}
+
+// ListArchiveContents lists the files and folders inside an archive without extracting it
+func (h *ArchiveHandler) ListArchiveContents(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	fullPath, _, pool, err := h.files.resolveZonePathWithPool(chi.URLParam(r, "zoneId"), chi.URLParam(r, "*"), userFromContext(userCtx))
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return
+	}
+	if pool.IsS3() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Archives cannot be opened on object storage pools", nil)
+		return
+	}
+
+	format := archiveFormat(fullPath)
+	if format == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a supported archive (zip, tar, tar.gz, tar.bz2 or 7z)", nil)
+		return
+	}
+	if info, err := os.Stat(fullPath); err != nil || !info.Mode().IsRegular() {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		return
+	}
+
+	listing, err := listArchive(fullPath, format)
+	if err != nil {
+		apierror.Write(w, http.StatusUnprocessableEntity, apierror.CodeUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listing)
+}
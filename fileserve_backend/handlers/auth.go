@@ -2,151 +2,138 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os/exec"
+	osuser "os/user"
 	"strings"
-	"sync"
 	"time"
-	"unicode"
 
 	"fileserv/config"
+	"fileserv/internal/apierror"
 	"fileserv/internal/auth"
+	"fileserv/internal/events"
 	"fileserv/middleware"
+	"fileserv/models"
 	"fileserv/storage"
 )
 
-// Rate limiting for login attempts
-type loginRateLimiter struct {
-	mu       sync.Mutex
-	attempts map[string][]time.Time
-	maxAttempts int
-	window      time.Duration
+// getClientIP extracts the client IP from request
+func getClientIP(r *http.Request) string {
+	return middleware.ClientIP(r)
 }
 
-var loginLimiter = &loginRateLimiter{
-	attempts:    make(map[string][]time.Time),
-	maxAttempts: 5,            // Max 5 attempts
-	window:      15 * time.Minute, // Per 15 minutes
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
-// isRateLimited checks if an IP is rate limited and records the attempt
-func (l *loginRateLimiter) isRateLimited(ip string) bool {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+type LoginResponse struct {
+	Token     string      `json:"token"`
+	ExpiresAt int64       `json:"expires_at"`
+	User      interface{} `json:"user"`
+}
 
-	now := time.Now()
-	cutoff := now.Add(-l.window)
+type UserResponse struct {
+	ID       string   `json:"id"`
+	Username string   `json:"username"`
+	IsAdmin  bool     `json:"is_admin"`
+	Groups   []string `json:"groups"`
+	IsGuest  bool     `json:"is_guest,omitempty"`
 
-	// Get existing attempts for this IP
-	attempts := l.attempts[ip]
+	// Set when the password has to be changed, e.g. because it passed the maximum age
+	MustChangePassword bool `json:"must_change_password,omitempty"`
+}
 
-	// Filter out old attempts
-	var recentAttempts []time.Time
-	for _, t := range attempts {
-		if t.After(cutoff) {
-			recentAttempts = append(recentAttempts, t)
-		}
+// guestUserContext returns the user context of a guest account, or an error if it has expired
+func guestUserContext(user *models.User) (*middleware.UserContext, error) {
+	if user.IsExpired() {
+		return nil, errors.New("guest account has expired")
 	}
+	return &middleware.UserContext{
+		UserID:     user.ID,
+		Username:   user.Username,
+		Groups:     []string{},
+		IsGuest:    true,
+		GuestZones: user.GuestZones,
+		ExpiresAt:  user.ExpiresAt,
+	}, nil
+}
 
-	// Check if rate limited
-	if len(recentAttempts) >= l.maxAttempts {
-		return true
+// authenticateUser verifies a username and password against PAM or the internal user store.
+// Guest accounts always live in the internal store.
+func authenticateUser(store storage.DataStore, cfg *config.Config, username, password string) (*middleware.UserContext, error) {
+	if user, err := store.GetUserByUsername(username); err == nil && user.IsGuest {
+		if !user.CheckPassword(password) {
+			return nil, errors.New("wrong password")
+		}
+		return guestUserContext(user)
 	}
 
-	// Record this attempt
-	recentAttempts = append(recentAttempts, now)
-	l.attempts[ip] = recentAttempts
-
-	return false
-}
-
-// clearAttempts clears attempts for an IP after successful login
-func (l *loginRateLimiter) clearAttempts(ip string) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	delete(l.attempts, ip)
-}
+	if cfg.UsePAM {
+		pamUser, err := auth.AuthenticatePAM(username, password)
+		if err != nil {
+			return nil, fmt.Errorf("PAM auth failed: %w", err)
+		}
 
-// getClientIP extracts the client IP from request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for reverse proxies)
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		// Take the first IP in the chain
-		parts := strings.Split(xff, ",")
-		return strings.TrimSpace(parts[0])
+		log.Printf("PAM auth successful for user %s (admin=%v, groups=%v)", pamUser.Username, pamUser.IsAdmin, pamUser.Groups)
+		return &middleware.UserContext{
+			UserID:   pamUser.UID,
+			Username: pamUser.Username,
+			IsAdmin:  pamUser.IsAdmin,
+			Groups:   pamUser.Groups,
+		}, nil
 	}
 
-	// Check X-Real-IP
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		return xri
+	user, err := store.GetUserByUsername(username)
+	if err != nil {
+		return nil, errors.New("unknown user")
 	}
-
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	// Remove port if present
-	if colonIdx := strings.LastIndex(ip, ":"); colonIdx != -1 {
-		ip = ip[:colonIdx]
+	if !user.CheckPassword(password) {
+		return nil, errors.New("wrong password")
 	}
-	return ip
-}
 
-// validatePasswordComplexity checks if password meets complexity requirements
-func validatePasswordComplexity(password string) error {
-	if len(password) < 8 {
-		return fmt.Errorf("password must be at least 8 characters")
-	}
+	return &middleware.UserContext{
+		UserID:   user.ID,
+		Username: user.Username,
+		IsAdmin:  user.IsAdmin,
+		Groups:   user.Groups,
+	}, nil
+}
 
-	var hasUpper, hasLower, hasDigit, hasSpecial bool
-
-	for _, c := range password {
-		switch {
-		case unicode.IsUpper(c):
-			hasUpper = true
-		case unicode.IsLower(c):
-			hasLower = true
-		case unicode.IsDigit(c):
-			hasDigit = true
-		case unicode.IsPunct(c) || unicode.IsSymbol(c):
-			hasSpecial = true
+// userContextByID resolves a user ID to the user context of an internal user or guest, or of
+// a system user (by UID) when logging in through PAM
+func userContextByID(store storage.DataStore, cfg *config.Config, userID string) (*middleware.UserContext, error) {
+	if user, err := store.GetUserByID(userID); err == nil {
+		if user.IsGuest {
+			return guestUserContext(user)
 		}
+		return &middleware.UserContext{
+			UserID:   user.ID,
+			Username: user.Username,
+			IsAdmin:  user.IsAdmin,
+			Groups:   user.Groups,
+		}, nil
+	} else if !cfg.UsePAM {
+		return nil, err
 	}
 
-	if !hasUpper {
-		return fmt.Errorf("password must contain at least one uppercase letter")
-	}
-	if !hasLower {
-		return fmt.Errorf("password must contain at least one lowercase letter")
+	sysUser, err := osuser.LookupId(userID)
+	if err != nil {
+		return nil, err
 	}
-	if !hasDigit {
-		return fmt.Errorf("password must contain at least one digit")
+	pamUser, err := auth.LookupSystemUser(sysUser.Username)
+	if err != nil {
+		return nil, err
 	}
-	if !hasSpecial {
-		return fmt.Errorf("password must contain at least one special character")
-	}
-
-	return nil
-}
-
-type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-}
-
-type LoginResponse struct {
-	Token     string      `json:"token"`
-	ExpiresAt int64       `json:"expires_at"`
-	User      interface{} `json:"user"`
-}
-
-type UserResponse struct {
-	ID       string   `json:"id"`
-	Username string   `json:"username"`
-	IsAdmin  bool     `json:"is_admin"`
-	Groups   []string `json:"groups"`
+	return &middleware.UserContext{
+		UserID:   pamUser.UID,
+		Username: pamUser.Username,
+		IsAdmin:  pamUser.IsAdmin,
+		Groups:   pamUser.Groups,
+	}, nil
 }
 
 func Login(store storage.DataStore, cfg *config.Config, jwtSecret string) http.HandlerFunc {
@@ -156,112 +143,117 @@ func Login(store storage.DataStore, cfg *config.Config, jwtSecret string) http.H
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Rate limiting check
 		clientIP := getClientIP(r)
-		if loginLimiter.isRateLimited(clientIP) {
-			log.Printf("Rate limited login attempt from IP %s", clientIP)
-			http.Error(w, "Too many login attempts. Please try again later.", http.StatusTooManyRequests)
-			return
-		}
 
 		var req LoginRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
 			return
 		}
 
-		var userID, username string
-		var isAdmin bool
-		var groups []string
-
-		if cfg.UsePAM {
-			// Use PAM authentication
-			pamUser, err := auth.AuthenticatePAM(req.Username, req.Password)
-			if err != nil {
-				log.Printf("PAM auth failed for user %s from IP %s: %v", req.Username, clientIP, err)
-				http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-				return
-			}
-
-			userID = pamUser.UID
-			username = pamUser.Username
-			isAdmin = pamUser.IsAdmin
-			groups = pamUser.Groups
-
-			log.Printf("PAM auth successful for user %s (admin=%v, groups=%v)", username, isAdmin, groups)
-		} else {
-			// Use internal user store
-			user, err := store.GetUserByUsername(req.Username)
-			if err != nil {
-				http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-				return
-			}
-
-			if !user.CheckPassword(req.Password) {
-				http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-				return
-			}
-
-			userID = user.ID
-			username = user.Username
-			isAdmin = user.IsAdmin
-			groups = user.Groups
+		// Brute-force protection (per client IP and per account); the attempt counts as failed
+		// until the credentials are verified
+		if wait := beginLoginAttempt(store, clientIP, req.Username); wait > 0 {
+			log.Printf("Rate limited login attempt for user %s from IP %s", req.Username, clientIP)
+			writeLockedOut(w, wait, "login")
+			return
 		}
 
-		// Generate JWT token
-		expiresAt := time.Now().Add(24 * time.Hour)
-		token, err := auth.GenerateToken(userID, username, isAdmin, groups, jwtSecret, 24*time.Hour)
+		account, err := authenticateUser(store, cfg, req.Username, req.Password)
 		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			log.Printf("Login failed for user %s from IP %s: %v", req.Username, clientIP, err)
+			recordSecurityEvent(store, &models.SecurityEvent{
+				Type:    models.SecurityEventAuthFailure,
+				Source:  "web",
+				Actor:   req.Username,
+				IP:      clientIP,
+				Message: "Login failed: " + err.Error(),
+			})
+			events.PublishToAdmins(events.TypeLoginFailed, map[string]interface{}{
+				"username": req.Username,
+				"ip":       clientIP,
+			})
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid credentials", nil)
 			return
 		}
 
-		// Store session
-		if err := store.CreateSession(userID, token, expiresAt); err != nil {
-			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		// Generate JWT token and store the session
+		session, err := startSession(store, r, account, jwtSecret)
+		if err != nil {
+			log.Printf("Login failed for user %s: cannot create session: %v", account.Username, err)
+			apierror.Error(w, "Failed to create session", http.StatusInternalServerError)
 			return
 		}
 
-		// Clear rate limit attempts on successful login
-		loginLimiter.clearAttempts(clientIP)
+		endLoginAttempt(store, clientIP, req.Username)
 
-		response := LoginResponse{
-			Token:     token,
-			ExpiresAt: expiresAt.Unix(),
-			User: UserResponse{
-				ID:       userID,
-				Username: username,
-				IsAdmin:  isAdmin,
-				Groups:   groups,
-			},
-		}
+		writeLoginResponse(w, r, store, session, account)
+	}
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+// writeLoginResponse responds with the token of a new session and the signed-in user
+func writeLoginResponse(w http.ResponseWriter, r *http.Request, store storage.DataStore, session *models.Session, account *middleware.UserContext) {
+	response := LoginResponse{
+		Token:     session.Token,
+		ExpiresAt: session.ExpiresAt.Unix(),
+		User: UserResponse{
+			ID:       account.UserID,
+			Username: account.Username,
+			IsAdmin:  account.IsAdmin,
+			Groups:   account.Groups,
+			IsGuest:  account.IsGuest,
+
+			MustChangePassword: passwordMustChange(store, account),
+		},
 	}
+	setSessionCookies(w, r, store, session.Token, session.ExpiresAt)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
-func Logout() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Token would be invalidated here if we were tracking sessions
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+// issueSessionToken generates a 24 hour token for a session. Guest sessions end with the account.
+func issueSessionToken(userCtx *middleware.UserContext, sessionID, jwtSecret string) (time.Time, string, error) {
+	expiresAt := time.Now().Add(24 * time.Hour)
+	if !userCtx.IsGuest {
+		token, err := auth.GenerateToken(sessionID, userCtx.UserID, userCtx.Username, userCtx.IsAdmin, userCtx.Groups, jwtSecret, 24*time.Hour)
+		return expiresAt, token, err
 	}
+
+	if userCtx.ExpiresAt != nil && userCtx.ExpiresAt.Before(expiresAt) {
+		expiresAt = *userCtx.ExpiresAt
+	}
+	token, err := auth.GenerateGuestToken(sessionID, userCtx.UserID, userCtx.Username, jwtSecret, time.Until(expiresAt))
+	return expiresAt, token, err
 }
 
-func RefreshToken(jwtSecret string) http.HandlerFunc {
+func RefreshToken(store storage.DataStore, jwtSecret string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userCtx := middleware.GetUserContext(r)
 		if userCtx == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+			return
+		}
+
+		// Impersonation tokens are short-lived on purpose
+		if userCtx.IsImpersonated() {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Impersonation tokens cannot be refreshed", nil)
+			return
+		}
+
+		if userCtx.SessionID == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Only session tokens can be refreshed", nil)
 			return
 		}
 
-		// Generate new token
-		expiresAt := time.Now().Add(24 * time.Hour)
-		token, err := auth.GenerateToken(userCtx.UserID, userCtx.Username, userCtx.IsAdmin, userCtx.Groups, jwtSecret, 24*time.Hour)
+		// Generate new token for the same session
+		expiresAt, token, err := issueSessionToken(userCtx, userCtx.SessionID, jwtSecret)
 		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		if err := store.RenewSession(userCtx.SessionID, token, expiresAt); err != nil {
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeSessionRevoked, "Session has been revoked", nil)
 			return
 		}
 
@@ -269,27 +261,43 @@ func RefreshToken(jwtSecret string) http.HandlerFunc {
 			Token:     token,
 			ExpiresAt: expiresAt.Unix(),
 		}
+		if _, err := r.Cookie(middleware.SessionCookieName); err == nil {
+			setSessionCookies(w, r, store, token, expiresAt)
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	}
 }
 
-func GetCurrentUser() http.HandlerFunc {
+func GetCurrentUser(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userCtx := middleware.GetUserContext(r)
 		if userCtx == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
+		resp := map[string]interface{}{
 			"id":       userCtx.UserID,
 			"username": userCtx.Username,
 			"is_admin": userCtx.IsAdmin,
 			"groups":   userCtx.Groups,
-		})
+		}
+		if userCtx.IsGuest {
+			resp["is_guest"] = true
+			resp["guest_zones"] = userCtx.GuestZones
+			resp["expires_at"] = userCtx.ExpiresAt
+		}
+		if userCtx.IsImpersonated() {
+			resp["impersonated_by"] = userCtx.ImpersonatedBy
+		}
+		if passwordMustChange(store, userCtx) {
+			resp["must_change_password"] = true
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
 	}
 }
 
@@ -299,28 +307,39 @@ type ChangePasswordRequest struct {
 }
 
 // ChangePassword allows the current user to change their own password
-func ChangePassword(cfg *config.Config) http.HandlerFunc {
+func ChangePassword(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userCtx := middleware.GetUserContext(r)
 		if userCtx == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+			return
+		}
+
+		// Guest passwords are set by whoever invited the guest
+		if userCtx.IsGuest {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Guest accounts cannot change their password", nil)
+			return
+		}
+		if userCtx.IsImpersonated() {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Passwords cannot be changed while impersonating", nil)
 			return
 		}
 
 		var req ChangePasswordRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.CurrentPassword == "" || req.NewPassword == "" {
-			http.Error(w, "Current password and new password are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Current password and new password are required", nil)
 			return
 		}
 
 		// Validate password complexity
-		if err := validatePasswordComplexity(req.NewPassword); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		policy := GetPasswordPolicyFromStore(store)
+		if err := validatePasswordComplexity(policy, req.NewPassword); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -328,13 +347,13 @@ func ChangePassword(cfg *config.Config) http.HandlerFunc {
 		// Newlines could inject additional user:password pairs into chpasswd
 		// Colons could modify the username:password format
 		if strings.ContainsAny(req.NewPassword, "\n\r:") {
-			http.Error(w, "Password cannot contain newlines or colons", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Password cannot contain newlines or colons", nil)
 			return
 		}
 
 		// Also validate the current password doesn't have injection characters
 		if strings.ContainsAny(req.CurrentPassword, "\n\r:") {
-			http.Error(w, "Invalid password format", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid password format", nil)
 			return
 		}
 
@@ -342,7 +361,13 @@ func ChangePassword(cfg *config.Config) http.HandlerFunc {
 		if cfg.UsePAM {
 			_, err := auth.AuthenticatePAM(userCtx.Username, req.CurrentPassword)
 			if err != nil {
-				http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Current password is incorrect", nil)
+				return
+			}
+
+			if policy.History > 0 && (req.NewPassword == req.CurrentPassword ||
+				passwordReused(store, policy, userCtx.Username, req.NewPassword, "")) {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Password was used recently, choose a different one", nil)
 				return
 			}
 
@@ -352,13 +377,30 @@ func ChangePassword(cfg *config.Config) http.HandlerFunc {
 			cmd.Stdin = strings.NewReader(fmt.Sprintf("%s:%s", userCtx.Username, req.NewPassword))
 			if output, err := cmd.CombinedOutput(); err != nil {
 				log.Printf("Failed to change password for %s: %v - %s", userCtx.Username, err, string(output))
-				http.Error(w, "Failed to change password", http.StatusInternalServerError)
+				apierror.Error(w, "Failed to change password", http.StatusInternalServerError)
 				return
 			}
+			recordPasswordChange(store, userCtx.Username, "", req.NewPassword)
 		} else {
-			// For non-PAM mode, this would need to update the internal user store
-			http.Error(w, "Password change not supported in non-PAM mode", http.StatusNotImplemented)
-			return
+			user, err := store.GetUserByID(userCtx.UserID)
+			if err != nil || !user.CheckPassword(req.CurrentPassword) {
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Current password is incorrect", nil)
+				return
+			}
+
+			if passwordReused(store, policy, user.Username, req.NewPassword, user.PasswordHash) {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Password was used recently, choose a different one", nil)
+				return
+			}
+
+			// Setting the password also clears MustChangePassword
+			updated, err := store.UpdateUser(user.ID, map[string]interface{}{"password": req.NewPassword})
+			if err != nil {
+				log.Printf("Failed to change password for %s: %v", userCtx.Username, err)
+				apierror.Error(w, "Failed to change password", http.StatusInternalServerError)
+				return
+			}
+			recordPasswordChange(store, updated.Username, updated.PasswordHash, "")
 		}
 
 		log.Printf("Password changed successfully for user %s", userCtx.Username)
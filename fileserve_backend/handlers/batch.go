@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"fileserv/internal/apierror"
+)
+
+// maxBatchQueries limits the number of queries in one batch request
+const maxBatchQueries = 20
+
+// BatchQuery is one named query of a batch request
+type BatchQuery struct {
+	// ID names the result; it defaults to the query name and must be unique within a batch
+	ID     string            `json:"id,omitempty"`
+	Query  string            `json:"query"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// BatchRequest is the body of a batch request
+type BatchRequest struct {
+	Queries []BatchQuery `json:"queries"`
+}
+
+// BatchResult is the response of one query: its data on success, its error envelope otherwise
+type BatchResult struct {
+	Status int             `json:"status"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// BatchHandler runs several read-only queries in one round-trip, so dashboards need a single
+// request instead of one per panel. Each query is served by the handler of its GET endpoint,
+// with the caller's context, so results match what the endpoints return.
+type BatchHandler struct {
+	queries map[string]http.Handler
+}
+
+// NewBatchHandler creates a new batch handler for the named query handlers
+func NewBatchHandler(queries map[string]http.Handler) *BatchHandler {
+	return &BatchHandler{queries: queries}
+}
+
+// ListQueries returns the names of the available queries
+func (h *BatchHandler) ListQueries(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(h.queries))
+	for name := range h.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"queries": names})
+}
+
+// Execute runs the queries of a batch request concurrently and returns their results by ID.
+// A failing query does not fail the batch; its result carries the status and error envelope.
+func (h *BatchHandler) Execute(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	if len(req.Queries) == 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "queries is required", nil)
+		return
+	}
+	if len(req.Queries) > maxBatchQueries {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("A batch may contain at most %d queries", maxBatchQueries), nil)
+		return
+	}
+
+	handlers := make(map[string]http.Handler, len(req.Queries))
+	params := make(map[string]map[string]string, len(req.Queries))
+	for _, q := range req.Queries {
+		id := strings.TrimSpace(q.ID)
+		if id == "" {
+			id = q.Query
+		}
+		handler, ok := h.queries[q.Query]
+		if !ok {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeUnknownQuery, "Unknown query: "+q.Query,
+				map[string]string{"query": q.Query})
+			return
+		}
+		if _, dup := handlers[id]; dup {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Duplicate query id: "+id, nil)
+			return
+		}
+		handlers[id] = handler
+		params[id] = q.Params
+	}
+
+	requestID := w.Header().Get(apierror.RequestIDHeader)
+	results := make(map[string]BatchResult, len(handlers))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for id, handler := range handlers {
+		wg.Add(1)
+		go func(id string, handler http.Handler) {
+			defer wg.Done()
+			result := runBatchQuery(r, handler, params[id], requestID)
+			mu.Lock()
+			results[id] = result
+			mu.Unlock()
+		}(id, handler)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+// runBatchQuery serves one query as a GET request with the batch request's context and headers
+func runBatchQuery(r *http.Request, handler http.Handler, params map[string]string, requestID string) BatchResult {
+	sub := r.Clone(r.Context())
+	sub.Method = http.MethodGet
+	sub.Body = http.NoBody
+	sub.ContentLength = 0
+	query := url.Values{}
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	sub.URL.RawQuery = query.Encode()
+
+	rec := &batchRecorder{header: http.Header{}, status: http.StatusOK}
+	// Error envelopes of the query carry the ID of the batch request
+	rec.header.Set(apierror.RequestIDHeader, requestID)
+	handler.ServeHTTP(rec, sub)
+
+	result := BatchResult{Status: rec.status}
+	body := bytes.TrimSpace(rec.body.Bytes())
+	if len(body) > 0 && !json.Valid(body) {
+		// Every query endpoint returns JSON, so anything else is a handler failure
+		body, _ = json.Marshal(apierror.Envelope{
+			Code:      apierror.CodeInvalidResponse,
+			Message:   "Query did not return JSON",
+			RequestID: requestID,
+		})
+		if result.Status < http.StatusBadRequest {
+			result.Status = http.StatusInternalServerError
+		}
+	}
+	if len(body) == 0 {
+		return result
+	}
+	if result.Status >= http.StatusBadRequest {
+		result.Error = body
+	} else {
+		result.Data = body
+	}
+	return result
+}
+
+// batchRecorder captures the response of a batch query
+type batchRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *batchRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *batchRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+}
+
+func (rec *batchRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.body.Write(b)
+}
@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"fileserv/internal/apierror"
 	"fileserv/internal/fileops"
 	"fileserv/middleware"
 	"fileserv/models"
@@ -38,6 +42,10 @@ type CreateUploadSessionRequest struct {
 	TargetPath string `json:"target_path"`
 	ZoneID     string `json:"zone_id,omitempty"`
 	ChunkSize  int64  `json:"chunk_size,omitempty"` // Optional, defaults to 5MB
+
+	// RelativePath places the file below TargetPath when a folder is uploaded, e.g.
+	// "photos/2024/a.jpg"; missing folders are created on finalize. Filename may be omitted.
+	RelativePath string `json:"relative_path,omitempty"`
 }
 
 // CreateUploadSessionResponse is the response for creating an upload session
@@ -54,28 +62,61 @@ type CreateUploadSessionResponse struct {
 func (h *ChunkedUploadHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+	if rejectUploadOnBattery(w) {
 		return
 	}
 
 	var req CreateUploadSessionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
+	if req.RelativePath != "" {
+		rel, err := cleanRelativePath(req.RelativePath)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		req.TargetPath = path.Join(req.TargetPath, path.Dir(rel))
+		req.Filename = path.Base(rel)
+	}
+
 	if req.Filename == "" {
-		http.Error(w, "Filename is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Filename is required", nil)
 		return
 	}
 
 	if req.TotalSize <= 0 {
-		http.Error(w, "Total size must be positive", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Total size must be positive", nil)
 		return
 	}
 
 	if req.TargetPath == "" {
-		http.Error(w, "Target path is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Target path is required", nil)
+		return
+	}
+
+	if limit := uploadLimit(h.store, nil, nil); limit > 0 && req.TotalSize > limit {
+		writeUploadTooLarge(w, limit)
+		return
+	}
+
+	// Chunks are read into memory and temp files whole, so their size is capped
+	maxChunk := GetUploadLimitsFromStore(h.store).MaxChunkSize
+	if req.ChunkSize <= 0 {
+		req.ChunkSize = fileops.DefaultChunkSize
+	}
+	if req.ChunkSize > maxChunk {
+		req.ChunkSize = maxChunk
+	}
+
+	// API tokens may only upload into zones
+	if userCtx.IsAPIToken() && req.ZoneID == "" {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Zone ID is required when using an API token", nil)
 		return
 	}
 
@@ -84,7 +125,7 @@ func (h *ChunkedUploadHandler) CreateSession(w http.ResponseWriter, r *http.Requ
 	if req.ZoneID != "" {
 		zone, err := h.store.GetShareZone(req.ZoneID)
 		if err != nil {
-			http.Error(w, "Zone not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, "Zone not found", nil)
 			return
 		}
 
@@ -96,30 +137,30 @@ func (h *ChunkedUploadHandler) CreateSession(w http.ResponseWriter, r *http.Requ
 			Groups:   userCtx.Groups,
 		}
 
-		if !zone.UserHasZoneAccess(user) {
-			http.Error(w, "Access denied to zone", http.StatusForbidden)
+		if !zone.UserHasZoneAccess(user) || !userCtx.CanAccessZone(zone.ID) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied to zone", nil)
 			return
 		}
 
 		if zone.ReadOnly {
-			http.Error(w, "Zone is read-only", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
 			return
 		}
 
 		pool, err := h.store.GetStoragePool(zone.PoolID)
 		if err != nil {
-			http.Error(w, "Pool not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodePoolNotFound, "Pool not found", nil)
 			return
 		}
 
 		if !pool.Enabled {
-			http.Error(w, "Pool is disabled", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Pool is disabled", nil)
 			return
 		}
 
-		// Check file size limit
-		if pool.MaxFileSize > 0 && req.TotalSize > pool.MaxFileSize {
-			http.Error(w, fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", pool.MaxFileSize), http.StatusRequestEntityTooLarge)
+		// Check file size limit of the zone and pool
+		if limit := uploadLimit(h.store, zone, pool); limit > 0 && req.TotalSize > limit {
+			writeUploadTooLarge(w, limit)
 			return
 		}
 
@@ -131,7 +172,7 @@ func (h *ChunkedUploadHandler) CreateSession(w http.ResponseWriter, r *http.Requ
 		}
 
 		if err := fileops.ValidateUpload(req.Filename, req.TotalSize, opts); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -151,7 +192,18 @@ func (h *ChunkedUploadHandler) CreateSession(w http.ResponseWriter, r *http.Requ
 
 		// Prevent path traversal
 		if !strings.HasPrefix(targetPath, basePath) {
-			http.Error(w, "Invalid path", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeInvalidPath, "Invalid path", nil)
+			return
+		}
+
+		// The zone trash and version store cannot be upload targets
+		if isReservedZonePath(filepath.Join(pool.Path, zone.Path), targetPath) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeInvalidPath, "Invalid path", nil)
+			return
+		}
+
+		if err := checkZoneQuota(h.store, zone, pool, filepath.Join(targetPath, req.Filename), userCtx.Username, req.TotalSize); err != nil {
+			apierror.Error(w, err.Error(), http.StatusInsufficientStorage)
 			return
 		}
 	}
@@ -160,13 +212,18 @@ func (h *ChunkedUploadHandler) CreateSession(w http.ResponseWriter, r *http.Requ
 	session, err := h.manager.CreateSession(
 		req.Filename,
 		req.TotalSize,
+		req.ZoneID,
 		targetPath,
 		userCtx.UserID,
 		userCtx.Username,
 		req.ChunkSize,
 	)
+	if errors.Is(err, fileops.ErrDraining) {
+		writeUploadDraining(w)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -188,7 +245,10 @@ func (h *ChunkedUploadHandler) CreateSession(w http.ResponseWriter, r *http.Requ
 func (h *ChunkedUploadHandler) UploadChunk(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+	if rejectUploadOnBattery(w) {
 		return
 	}
 
@@ -203,28 +263,39 @@ func (h *ChunkedUploadHandler) UploadChunk(w http.ResponseWriter, r *http.Reques
 		chunkIndexStr = r.Header.Get("X-Chunk-Index")
 	}
 	if chunkIndexStr == "" {
-		http.Error(w, "Chunk index is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Chunk index is required", nil)
 		return
 	}
 
 	chunkIndex, err := strconv.Atoi(chunkIndexStr)
 	if err != nil {
-		http.Error(w, "Invalid chunk index", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid chunk index", nil)
 		return
 	}
 
 	// Verify session ownership
 	session, err := h.manager.GetSession(sessionID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUploadSessionNotFound, err.Error(), nil)
 		return
 	}
 
 	if session.OwnerID != userCtx.UserID && !userCtx.IsAdmin {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
 		return
 	}
 
+	// Chunks are refused once the uploader or zone used up its monthly transfer cap
+	transfer := transferObjects(session.OwnerID, session.ZoneID, "")
+	if err := checkTransferCaps(h.store, transfer); err != nil {
+		writeTransferCapError(w, err)
+		return
+	}
+	defer meterUpload(r, transfer)()
+
+	// Bodies larger than a chunk are cut off rather than written to disk
+	limitRequestBody(w, r, session.ChunkSize)
+
 	// Handle multipart or raw body
 	var reader io.Reader
 
@@ -232,13 +303,17 @@ func (h *ChunkedUploadHandler) UploadChunk(w http.ResponseWriter, r *http.Reques
 	if contentType != "" && len(contentType) >= 19 && contentType[:19] == "multipart/form-data" {
 		// Parse as multipart
 		if err := r.ParseMultipartForm(int64(session.ChunkSize) + 1024*1024); err != nil {
-			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			if isBodyTooLarge(err) {
+				writeUploadTooLarge(w, session.ChunkSize)
+				return
+			}
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Failed to parse form", nil)
 			return
 		}
 
 		file, _, err := r.FormFile("chunk")
 		if err != nil {
-			http.Error(w, "Chunk file is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Chunk file is required", nil)
 			return
 		}
 		defer file.Close()
@@ -250,14 +325,22 @@ func (h *ChunkedUploadHandler) UploadChunk(w http.ResponseWriter, r *http.Reques
 
 	// Upload the chunk
 	if err := h.manager.UploadChunk(sessionID, chunkIndex, reader); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		if errors.Is(err, fileops.ErrDraining) {
+			writeUploadDraining(w)
+			return
+		}
+		if isBodyTooLarge(err) {
+			writeUploadTooLarge(w, session.ChunkSize)
+			return
+		}
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 		return
 	}
 
 	// Return progress
 	progress, err := h.manager.GetProgress(sessionID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -269,7 +352,7 @@ func (h *ChunkedUploadHandler) UploadChunk(w http.ResponseWriter, r *http.Reques
 func (h *ChunkedUploadHandler) GetProgress(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -278,18 +361,18 @@ func (h *ChunkedUploadHandler) GetProgress(w http.ResponseWriter, r *http.Reques
 	// Verify session ownership
 	session, err := h.manager.GetSession(sessionID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUploadSessionNotFound, err.Error(), nil)
 		return
 	}
 
 	if session.OwnerID != userCtx.UserID && !userCtx.IsAdmin {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
 		return
 	}
 
 	progress, err := h.manager.GetProgress(sessionID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -301,7 +384,7 @@ func (h *ChunkedUploadHandler) GetProgress(w http.ResponseWriter, r *http.Reques
 func (h *ChunkedUploadHandler) GetMissingChunks(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -310,18 +393,18 @@ func (h *ChunkedUploadHandler) GetMissingChunks(w http.ResponseWriter, r *http.R
 	// Verify session ownership
 	session, err := h.manager.GetSession(sessionID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUploadSessionNotFound, err.Error(), nil)
 		return
 	}
 
 	if session.OwnerID != userCtx.UserID && !userCtx.IsAdmin {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
 		return
 	}
 
 	missing, err := h.manager.GetMissingChunks(sessionID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -336,7 +419,7 @@ func (h *ChunkedUploadHandler) GetMissingChunks(w http.ResponseWriter, r *http.R
 func (h *ChunkedUploadHandler) Finalize(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -345,21 +428,85 @@ func (h *ChunkedUploadHandler) Finalize(w http.ResponseWriter, r *http.Request)
 	// Verify session ownership
 	session, err := h.manager.GetSession(sessionID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUploadSessionNotFound, err.Error(), nil)
 		return
 	}
 
 	if session.OwnerID != userCtx.UserID && !userCtx.IsAdmin {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
 		return
 	}
 
+	targetFile := filepath.Join(session.TargetPath, session.Filename)
+
+	// Uploads to object storage pools are streamed to the backend
+	if backend, key := backendForPath(h.store, targetFile); backend != nil {
+		written, err := h.manager.FinalizeToBackend(sessionID, backend, key)
+		if errors.Is(err, fileops.ErrDraining) {
+			writeUploadDraining(w)
+			return
+		}
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		publishUploadCompleted(h.store, session.OwnerID, targetFile, written)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Upload completed successfully",
+			"path":    targetFile,
+		})
+		return
+	}
+
+	if err := checkFileLock(h.store, targetFile, session.OwnerID, false); err != nil {
+		writeLockError(w, err)
+		return
+	}
+
+	// Check the quota again in case other uploads completed since the session was created
+	zone, pool := zoneForFile(h.store, targetFile)
+	var replaced int64
+	if zone != nil {
+		if err := checkZoneQuota(h.store, zone, pool, targetFile, session.OwnerUsername, session.TotalSize); err != nil {
+			apierror.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		}
+		replaced = pathUsage(h.store, zone, pool, targetFile)
+	}
+
+	// Keep the previous content as a version if this overwrites an existing file
+	var version *models.FileVersion
+	if complete, _ := h.manager.IsComplete(sessionID); complete {
+		if version, err = saveFileVersion(h.store, targetFile, userCtx); err != nil {
+			log.Printf("Failed to save previous version of %s: %v", targetFile, err)
+		}
+	}
+
 	finalPath, err := h.manager.Finalize(sessionID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		undoFileVersion(h.store, version, targetFile)
+		if errors.Is(err, fileops.ErrDraining) {
+			writeUploadDraining(w)
+			return
+		}
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 		return
 	}
 
+	if err := scanUpload(h.store, finalPath, session.OwnerID, session.OwnerUsername); err != nil {
+		undoFileVersion(h.store, version, finalPath)
+		writeScanError(w, err)
+		return
+	}
+
+	indexPath(h.store, finalPath)
+	if zone != nil {
+		chargeZoneUsage(h.store, zone, pool, finalPath, session.OwnerUsername, session.TotalSize-replaced)
+	}
+	publishUploadCompleted(h.store, session.OwnerID, finalPath, session.TotalSize)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Upload completed successfully",
@@ -371,7 +518,7 @@ func (h *ChunkedUploadHandler) Finalize(w http.ResponseWriter, r *http.Request)
 func (h *ChunkedUploadHandler) CancelSession(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -380,17 +527,17 @@ func (h *ChunkedUploadHandler) CancelSession(w http.ResponseWriter, r *http.Requ
 	// Verify session ownership
 	session, err := h.manager.GetSession(sessionID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUploadSessionNotFound, err.Error(), nil)
 		return
 	}
 
 	if session.OwnerID != userCtx.UserID && !userCtx.IsAdmin {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
 		return
 	}
 
 	if err := h.manager.DeleteSession(sessionID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -404,7 +551,7 @@ func (h *ChunkedUploadHandler) CancelSession(w http.ResponseWriter, r *http.Requ
 func (h *ChunkedUploadHandler) ListMySessions(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -413,3 +560,28 @@ func (h *ChunkedUploadHandler) ListMySessions(w http.ResponseWriter, r *http.Req
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(sessions)
 }
+
+// writeUploadDraining responds with 503 while the upload manager shuts down. The session is
+// kept, so the client retries the same request once the server is back.
+func writeUploadDraining(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "30")
+	apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeShuttingDown, fileops.ErrDraining.Error(), nil)
+}
+
+// cleanRelativePath validates a slash-separated path below an upload folder. Absolute paths
+// and ".." segments are rejected rather than cleaned, so a file cannot land elsewhere.
+func cleanRelativePath(p string) (string, error) {
+	if p == "" || strings.HasPrefix(p, "/") || strings.Contains(p, "\\") {
+		return "", errors.New("Invalid relative path")
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return "", errors.New("Invalid relative path")
+		}
+	}
+	clean := path.Clean(p)
+	if clean == "." {
+		return "", errors.New("Invalid relative path")
+	}
+	return clean, nil
+}
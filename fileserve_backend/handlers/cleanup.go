@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/fileops"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+const (
+	// expiredShareLinkGrace keeps expired links listed for a while so owners can extend them
+	expiredShareLinkGrace = 7 * 24 * time.Hour
+	// unusedPreviewAge is how long a cached preview may go unused before it is removed. Previews of
+	// changed or deleted files are never used again.
+	unusedPreviewAge = 30 * 24 * time.Hour
+	// minCleanupInterval is the shortest configurable cleanup interval
+	minCleanupInterval = 5
+)
+
+// ExpiryReaper periodically removes expired sessions, share links and upload sessions,
+// previews that are no longer used and logged events past their retention period
+type ExpiryReaper struct {
+	store    storage.DataStore
+	uploads  *fileops.ChunkedUploadManager
+	caches   []*PreviewCache
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	last     *models.CleanupStats
+	reset    chan struct{}
+}
+
+// NewExpiryReaper creates a new expiry reaper
+func NewExpiryReaper(store storage.DataStore, uploads *fileops.ChunkedUploadManager, previews *PreviewHandler, streams *StreamHandler) *ExpiryReaper {
+	return &ExpiryReaper{
+		store:    store,
+		uploads:  uploads,
+		caches:   []*PreviewCache{previews.cache, streams.cache},
+		stopChan: make(chan struct{}),
+		reset:    make(chan struct{}, 1),
+	}
+}
+
+// Start begins the expiry reaper background goroutine
+func (e *ExpiryReaper) Start() {
+	e.mu.Lock()
+	if e.running {
+		e.mu.Unlock()
+		return
+	}
+	e.running = true
+	e.stopChan = make(chan struct{})
+	e.mu.Unlock()
+
+	e.wg.Add(1)
+	go e.run()
+	log.Println("Expiry reaper started")
+}
+
+// Stop stops the expiry reaper
+func (e *ExpiryReaper) Stop() {
+	e.mu.Lock()
+	if !e.running {
+		e.mu.Unlock()
+		return
+	}
+	e.running = false
+	close(e.stopChan)
+	e.mu.Unlock()
+
+	e.wg.Wait()
+	log.Println("Expiry reaper stopped")
+}
+
+// run is the main reaper loop
+func (e *ExpiryReaper) run() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.interval())
+	defer ticker.Stop()
+
+	e.Cleanup()
+
+	for {
+		select {
+		case <-e.stopChan:
+			return
+		case <-ticker.C:
+			e.Cleanup()
+		case <-e.reset:
+			ticker.Reset(e.interval())
+		}
+	}
+}
+
+// Reload makes the reaper pick up a changed cleanup interval
+func (e *ExpiryReaper) Reload() {
+	select {
+	case e.reset <- struct{}{}:
+	default:
+	}
+}
+
+// interval returns how often the reaper runs
+func (e *ExpiryReaper) interval() time.Duration {
+	return time.Duration(GetCleanupIntervalFromStore(e.store)) * time.Minute
+}
+
+// Cleanup removes everything that has expired and returns what was removed
+func (e *ExpiryReaper) Cleanup() models.CleanupStats {
+	stats := models.CleanupStats{StartedAt: time.Now()}
+
+	var err error
+	if stats.Sessions, err = e.store.CleanExpiredSessions(); err != nil {
+		stats.Errors = append(stats.Errors, "sessions: "+err.Error())
+	}
+	if stats.ShareLinks, err = e.store.CleanExpiredShareLinks(time.Now().Add(-expiredShareLinkGrace)); err != nil {
+		stats.Errors = append(stats.Errors, "share links: "+err.Error())
+	}
+	stats.UploadSessions = e.uploads.CleanupExpired()
+	for _, cache := range e.caches {
+		n, size := cache.PruneUnused(time.Now().Add(-unusedPreviewAge))
+		stats.Previews += n
+		stats.PreviewBytes += size
+	}
+	if stats.Events, err = pruneEventLog(e.store); err != nil {
+		stats.Errors = append(stats.Errors, "event log: "+err.Error())
+	}
+	stats.Duration = time.Since(stats.StartedAt).Round(time.Millisecond).String()
+
+	for _, msg := range stats.Errors {
+		log.Printf("Expiry reaper: failed to clean up %s", msg)
+	}
+	if stats.Sessions+stats.ShareLinks+stats.UploadSessions+stats.Previews+stats.Events > 0 {
+		log.Printf("Expiry reaper: removed %d sessions, %d share links, %d upload sessions, %d previews (%d bytes) and %d logged events in %s",
+			stats.Sessions, stats.ShareLinks, stats.UploadSessions, stats.Previews, stats.PreviewBytes, stats.Events, stats.Duration)
+	}
+
+	e.mu.Lock()
+	e.last = &stats
+	e.mu.Unlock()
+	return stats
+}
+
+// LastRun returns the stats of the most recent cleanup, or nil before the first one
+func (e *ExpiryReaper) LastRun() *models.CleanupStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.last
+}
+
+// GetCleanupIntervalFromStore returns the cleanup interval in minutes
+func GetCleanupIntervalFromStore(store storage.DataStore) int {
+	if setting, err := store.GetSetting(models.SettingCleanupInterval); err == nil && setting != nil {
+		if v, err := strconv.Atoi(setting.Value); err == nil && v >= minCleanupInterval {
+			return v
+		}
+	}
+	return models.DefaultCleanupIntervalMinutes
+}
+
+// GetCleanupStatus returns the cleanup interval and the stats of the last run (admin only)
+func (e *ExpiryReaper) GetCleanupStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"interval_minutes": GetCleanupIntervalFromStore(e.store),
+		"last_run":         e.LastRun(),
+	})
+}
+
+// UpdateCleanupSettings sets the cleanup interval (admin only)
+func (e *ExpiryReaper) UpdateCleanupSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IntervalMinutes int `json:"interval_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	if req.IntervalMinutes < minCleanupInterval {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Interval must be at least "+strconv.Itoa(minCleanupInterval)+" minutes", nil)
+		return
+	}
+
+	e.store.SetSetting(models.SettingCleanupInterval, strconv.Itoa(req.IntervalMinutes), "int", string(models.CategoryGeneral))
+	e.Reload()
+
+	e.GetCleanupStatus(w, r)
+}
+
+// RunCleanup cleans up expired data now and returns what was removed (admin only)
+func (e *ExpiryReaper) RunCleanup(w http.ResponseWriter, r *http.Request) {
+	stats := e.Cleanup()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
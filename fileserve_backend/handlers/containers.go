@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/internal/docker"
+	"fileserv/internal/events"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// containerStopTimeout is how long a container may take to stop before it is killed
+	containerStopTimeout = 10 * time.Second
+	// containerMaxLogLines caps the log lines returned at once
+	containerMaxLogLines = 10000
+)
+
+// containerIDRegex matches container IDs and names
+var containerIDRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,127}$`)
+
+// containerActionDone describes the outcome of each container action
+var containerActionDone = map[string]string{
+	"start":   "started",
+	"stop":    "stopped",
+	"restart": "restarted",
+}
+
+// ContainerHandler manages Docker or Podman containers when CONTAINERS_ENABLED is set
+type ContainerHandler struct {
+	store   storage.DataStore
+	enabled bool
+	client  *docker.Client // nil without a socket
+}
+
+// NewContainerHandler creates a container handler for the configured or detected socket
+func NewContainerHandler(store storage.DataStore, cfg *config.Config) *ContainerHandler {
+	h := &ContainerHandler{store: store, enabled: cfg.ContainersEnabled}
+	if !h.enabled {
+		return h
+	}
+	socket := cfg.ContainerSocket
+	if socket == "" {
+		socket = docker.FindSocket()
+	}
+	if socket == "" {
+		log.Println("Containers: no Docker or Podman socket found")
+		return h
+	}
+	h.client = docker.New(socket)
+	return h
+}
+
+// ready writes an error and returns false when containers cannot be managed
+func (h *ContainerHandler) ready(w http.ResponseWriter) bool {
+	if !h.enabled {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFeatureDisabled, "Container management is not enabled", nil)
+		return false
+	}
+	if h.client == nil {
+		apierror.Error(w, "No Docker or Podman socket found", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// containerID reads the id URL parameter, writing an error if it is invalid
+func containerID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := chi.URLParam(r, "id")
+	if !containerIDRegex.MatchString(id) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid container ID", nil)
+		return "", false
+	}
+	return id, true
+}
+
+// containerError writes an error returned by the engine
+func containerError(w http.ResponseWriter, err error) {
+	if errors.Is(err, docker.ErrNotFound) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeContainerNotFound, "Container not found", nil)
+		return
+	}
+	apierror.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+// GetContainerRuntime returns whether containers are enabled and the engine they are managed through
+func (h *ContainerHandler) GetContainerRuntime(w http.ResponseWriter, r *http.Request) {
+	runtime := models.ContainerRuntime{Enabled: h.enabled}
+	if h.client != nil {
+		runtime.Socket = h.client.Socket
+		if version, err := h.client.Version(); err != nil {
+			runtime.Error = err.Error()
+		} else {
+			runtime.Available = true
+			runtime.Runtime = version.Runtime()
+			runtime.Version = version.Version
+			runtime.APIVersion = version.APIVersion
+		}
+	} else if h.enabled {
+		runtime.Error = "No Docker or Podman socket found"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runtime)
+}
+
+// ListContainers returns all containers, with the zones their mounts are in
+func (h *ContainerHandler) ListContainers(w http.ResponseWriter, r *http.Request) {
+	if !h.ready(w) {
+		return
+	}
+	list, err := h.client.List()
+	if err != nil {
+		containerError(w, err)
+		return
+	}
+
+	containers := make([]models.Container, 0, len(list))
+	for _, c := range list {
+		container := models.Container{
+			ID:      c.ID,
+			Image:   c.Image,
+			State:   c.State,
+			Status:  c.Status,
+			Created: time.Unix(c.Created, 0),
+			Ports:   []models.ContainerPort{},
+			Mounts:  []models.ContainerMount{},
+			Labels:  c.Labels,
+		}
+		if len(c.Names) > 0 {
+			container.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		for _, p := range c.Ports {
+			container.Ports = append(container.Ports, models.ContainerPort{
+				HostIP:        p.IP,
+				HostPort:      p.PublicPort,
+				ContainerPort: p.PrivatePort,
+				Protocol:      p.Type,
+			})
+		}
+		for _, m := range c.Mounts {
+			mount := models.ContainerMount{
+				Type:        m.Type,
+				Name:        m.Name,
+				Source:      m.Source,
+				Destination: m.Destination,
+				ReadOnly:    !m.RW,
+			}
+			if zone, root := zoneForPath(h.store, filepath.Clean(m.Source)); zone != nil {
+				rel, _ := filepath.Rel(root, filepath.Clean(m.Source))
+				mount.ZoneID = zone.ID
+				mount.ZoneName = zone.Name
+				mount.ZonePath = "/" + strings.TrimPrefix(filepath.ToSlash(rel), ".")
+			}
+			container.Mounts = append(container.Mounts, mount)
+		}
+		containers = append(containers, container)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(containers)
+}
+
+// ControlContainer starts, stops or restarts a container
+func (h *ContainerHandler) ControlContainer(w http.ResponseWriter, r *http.Request) {
+	if !h.ready(w) {
+		return
+	}
+	id, ok := containerID(w, r)
+	if !ok {
+		return
+	}
+
+	action := chi.URLParam(r, "action")
+	var err error
+	switch action {
+	case "start":
+		err = h.client.Start(id)
+	case "stop":
+		err = h.client.Stop(id, containerStopTimeout)
+	case "restart":
+		err = h.client.Restart(id, containerStopTimeout)
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid action", nil)
+		return
+	}
+	if err != nil {
+		containerError(w, err)
+		return
+	}
+
+	publishAction(r, &events.Event{
+		Type:       events.TypeContainerControlled,
+		AdminOnly:  true,
+		ObjectType: "container",
+		ObjectID:   id,
+		Data:       map[string]interface{}{"container": id, "action": action},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("Container %s %s", id, containerActionDone[action]),
+	})
+}
+
+// GetContainerLogs returns the last lines a container wrote, 100 by default
+func (h *ContainerHandler) GetContainerLogs(w http.ResponseWriter, r *http.Request) {
+	if !h.ready(w) {
+		return
+	}
+	id, ok := containerID(w, r)
+	if !ok {
+		return
+	}
+
+	lines := 100
+	if value := r.URL.Query().Get("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > containerMaxLogLines {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("lines must be between 1 and %d", containerMaxLogLines), nil)
+			return
+		}
+		lines = n
+	}
+
+	logs, err := h.client.Logs(id, lines)
+	if err != nil {
+		containerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logs)
+}
+
+// GetContainerStats returns the CPU, memory, network and disk usage of a running container
+func (h *ContainerHandler) GetContainerStats(w http.ResponseWriter, r *http.Request) {
+	if !h.ready(w) {
+		return
+	}
+	id, ok := containerID(w, r)
+	if !ok {
+		return
+	}
+
+	sample, err := h.client.Stats(id)
+	if err != nil {
+		containerError(w, err)
+		return
+	}
+
+	stats := models.ContainerStats{
+		CPUPercent:  sample.CPUPercent(),
+		MemoryUsage: sample.MemoryUsage(),
+		MemoryLimit: sample.MemoryStats.Limit,
+		PIDs:        sample.PidsStats.Current,
+	}
+	if stats.MemoryLimit > 0 {
+		stats.MemoryPercent = float64(stats.MemoryUsage) / float64(stats.MemoryLimit) * 100
+	}
+	for _, network := range sample.Networks {
+		stats.NetworkRx += network.RxBytes
+		stats.NetworkTx += network.TxBytes
+	}
+	stats.BlockRead, stats.BlockWrite = sample.BlockIO()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// maxContentText caps the text stored per document; the rest of a long document is not searchable
+	maxContentText = 1024 * 1024
+	// contentExtractTimeout bounds the time spent extracting the text of one document
+	contentExtractTimeout = 60 * time.Second
+)
+
+// contentIndexExtensions are the document types whose text can be indexed
+var contentIndexExtensions = map[string]bool{
+	"txt":  true,
+	"md":   true,
+	"pdf":  true,
+	"docx": true,
+}
+
+// extractDocumentText returns the text of a txt, md, pdf or docx file
+func extractDocumentText(fullPath, ext string) (string, error) {
+	var text string
+	var err error
+	switch ext {
+	case "txt", "md":
+		text, err = extractPlainText(fullPath)
+	case "pdf":
+		text, err = extractPDFText(fullPath)
+	case "docx":
+		text, err = extractDocxText(fullPath)
+	default:
+		return "", fmt.Errorf("unsupported document type %q", ext)
+	}
+	if err != nil {
+		return "", err
+	}
+	return cleanContentText(text), nil
+}
+
+// extractPlainText reads the start of a text file
+func extractPlainText(fullPath string) (string, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxContentText))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// extractPDFText converts a PDF to text with pdftotext from poppler-utils
+func extractPDFText(fullPath string) (string, error) {
+	if _, err := exec.LookPath("pdftotext"); err != nil {
+		return "", errors.New("pdftotext is not installed (install poppler-utils)")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), contentExtractTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "pdftotext", "-q", "-enc", "UTF-8", fullPath, "-").Output()
+	if ctx.Err() != nil {
+		return "", errors.New("timed out extracting text")
+	}
+	if err != nil {
+		return "", fmt.Errorf("pdftotext failed: %v", err)
+	}
+	return string(output), nil
+}
+
+// extractDocxText reads the text runs of the main document part of a Word file
+func extractDocxText(fullPath string) (string, error) {
+	r, err := zip.OpenReader(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("not a valid docx file: %v", err)
+	}
+	defer r.Close()
+
+	var document *zip.File
+	for _, f := range r.File {
+		if f.Name == "word/document.xml" {
+			document = f
+			break
+		}
+	}
+	if document == nil {
+		return "", errors.New("not a valid docx file: word/document.xml is missing")
+	}
+
+	rc, err := document.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	var text strings.Builder
+	inText := false
+	decoder := xml.NewDecoder(rc)
+	for text.Len() < maxContentText {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse docx: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+	return text.String(), nil
+}
+
+// cleanContentText makes extracted text safe to store and caps its size
+func cleanContentText(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	text = strings.ReplaceAll(text, "\x00", "")
+	if len(text) > maxContentText {
+		cut := maxContentText
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+	return text
+}
+
+// contentCurrent reports whether the indexed text of a document matches the file on disk
+func contentCurrent(c *models.FileContent, info os.FileInfo) bool {
+	return c.Size == info.Size() && c.ModTime.Unix() == info.ModTime().Unix()
+}
+
+// indexFileContent extracts and stores the text of a document unless it is already up to date.
+// Documents whose text cannot be extracted are recorded with the error so they are not retried
+// until they change.
+func indexFileContent(store storage.DataStore, cfg *models.ZoneContentIndexing, root, fullPath string, info os.FileInfo) {
+	if !info.Mode().IsRegular() {
+		return
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(info.Name()), "."))
+	if !contentIndexExtensions[ext] {
+		return
+	}
+
+	relPath := usageRelPath(root, fullPath)
+	if cfg.MaxFileSize > 0 && info.Size() > cfg.MaxFileSize {
+		// A document that grew past the limit should not keep matching on its old text
+		store.DeleteFileContentPath(cfg.ZoneID, relPath)
+		return
+	}
+	if c, err := store.GetFileContentInfo(cfg.ZoneID, relPath); err == nil && contentCurrent(c, info) {
+		return
+	}
+
+	content := &models.FileContent{
+		ZoneID:    cfg.ZoneID,
+		Path:      relPath,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		IndexedAt: time.Now(),
+	}
+	text, err := extractDocumentText(fullPath, ext)
+	if err != nil {
+		content.Error = err.Error()
+	} else {
+		content.Content = text
+	}
+	if err := store.UpsertFileContent(content); err != nil {
+		log.Printf("Content index: failed to store text of %s: %v", fullPath, err)
+	}
+}
+
+// updateFileContent indexes the text of a document that was just created or changed
+func updateFileContent(store storage.DataStore, zoneID, root, fullPath string, info os.FileInfo) {
+	cfg := store.GetZoneContentIndexing(zoneID)
+	if !cfg.Enabled {
+		return
+	}
+	indexFileContent(store, cfg, root, fullPath, info)
+}
+
+// GetZoneContentIndexing returns the content indexing settings of a zone with the size of its index
+func (h *SearchIndexHandler) GetZoneContentIndexing(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if _, err := h.store.GetShareZone(id); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"config": h.store.GetZoneContentIndexing(id),
+		"stats":  h.store.GetContentIndexStats(id),
+	})
+}
+
+// UpdateZoneContentIndexing turns document content indexing of a zone on or off. Turning it on
+// queues a reindex of the zone; turning it off drops the zone's extracted text.
+func (h *SearchIndexHandler) UpdateZoneContentIndexing(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	zone, err := h.store.GetShareZone(id)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+	if pool, err := h.store.GetStoragePool(zone.PoolID); err == nil && pool.IsS3() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Content indexing is not available on object storage pools", nil)
+		return
+	}
+
+	var req struct {
+		Enabled     *bool  `json:"enabled"`
+		MaxFileSize *int64 `json:"max_file_size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	cfg := h.store.GetZoneContentIndexing(id)
+	wasEnabled := cfg.Enabled
+	if req.Enabled != nil {
+		cfg.Enabled = *req.Enabled
+	}
+	if req.MaxFileSize != nil {
+		if *req.MaxFileSize < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "max_file_size cannot be negative", nil)
+			return
+		}
+		cfg.MaxFileSize = *req.MaxFileSize
+	}
+
+	if err := h.store.SetZoneContentIndexing(cfg); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !cfg.Enabled && wasEnabled {
+		if err := h.store.ClearFileContents(id); err != nil {
+			log.Printf("Content index: failed to clear zone %s: %v", zone.Name, err)
+		}
+	} else if cfg.Enabled {
+		h.indexer.Reindex(id)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"config": cfg,
+		"stats":  h.store.GetContentIndexStats(id),
+	})
+}
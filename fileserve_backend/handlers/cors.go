@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// maxCORSMaxAge is the longest preflight cache time browsers honour (Firefox; Chrome caps at 2 hours)
+const maxCORSMaxAge = 24 * 60 * 60
+
+// corsSettingKeys are the settings removed when the CORS policy is reset
+var corsSettingKeys = []string{
+	models.SettingCORSAllowedOrigins,
+	models.SettingCORSAllowedMethods,
+	models.SettingCORSAllowedHeaders,
+	models.SettingCORSAllowCredentials,
+	models.SettingCORSMaxAge,
+}
+
+// GetCORSSettingsFromStore returns the CORS settings, with the defaults of the environment for
+// settings that were never saved
+func GetCORSSettingsFromStore(store storage.DataStore, cfg *config.Config) models.CORSSettings {
+	settings := models.DefaultCORSSettings(cfg.IsDevelopment())
+	lists := []struct {
+		key   string
+		value *[]string
+	}{
+		{models.SettingCORSAllowedOrigins, &settings.AllowedOrigins},
+		{models.SettingCORSAllowedMethods, &settings.AllowedMethods},
+		{models.SettingCORSAllowedHeaders, &settings.AllowedHeaders},
+	}
+	for _, l := range lists {
+		if setting, err := store.GetSetting(l.key); err == nil && setting != nil {
+			var values []string
+			if err := json.Unmarshal([]byte(setting.Value), &values); err == nil && values != nil {
+				*l.value = values
+			}
+		}
+	}
+	if setting, err := store.GetSetting(models.SettingCORSAllowCredentials); err == nil && setting != nil {
+		settings.AllowCredentials = setting.Value == "true"
+	}
+	if setting, err := store.GetSetting(models.SettingCORSMaxAge); err == nil && setting != nil {
+		if n, err := strconv.Atoi(setting.Value); err == nil && n >= 0 {
+			settings.MaxAge = n
+		}
+	}
+	return settings
+}
+
+// CORSPolicy caches the CORS settings for the CORS middleware, which runs on every request
+// (implements middleware.CORSPolicy)
+type CORSPolicy struct {
+	store storage.DataStore
+	cfg   *config.Config
+
+	mu       sync.RWMutex
+	settings models.CORSSettings
+}
+
+// NewCORSPolicy creates a new CORS policy and loads the settings
+func NewCORSPolicy(store storage.DataStore, cfg *config.Config) *CORSPolicy {
+	return &CORSPolicy{
+		store:    store,
+		cfg:      cfg,
+		settings: GetCORSSettingsFromStore(store, cfg),
+	}
+}
+
+// CORSSettings returns the cached settings
+func (p *CORSPolicy) CORSSettings() models.CORSSettings {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.settings
+}
+
+// Reload reads the settings again after they were saved
+func (p *CORSPolicy) Reload() {
+	settings := GetCORSSettingsFromStore(p.store, p.cfg)
+	p.mu.Lock()
+	p.settings = settings
+	p.mu.Unlock()
+}
+
+// GetCORS returns the CORS settings and the environment whose defaults apply (admin only)
+func (p *CORSPolicy) GetCORS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"environment": p.cfg.Environment,
+		"settings":    p.CORSSettings(),
+		"defaults":    models.DefaultCORSSettings(p.cfg.IsDevelopment()),
+	})
+}
+
+// UpdateCORS saves the CORS settings; fields left out keep their value (admin only)
+func (p *CORSPolicy) UpdateCORS(w http.ResponseWriter, r *http.Request) {
+	req := GetCORSSettingsFromStore(p.store, p.cfg)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	var err error
+	if req.AllowedOrigins, err = normalizeCORSOrigins(req.AllowedOrigins); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	if req.AllowedMethods, err = normalizeCORSTokens("allowed_methods", req.AllowedMethods, strings.ToUpper); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	if req.AllowedHeaders, err = normalizeCORSTokens("allowed_headers", req.AllowedHeaders, strings.TrimSpace); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	if len(req.AllowedMethods) == 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "allowed_methods cannot be empty", nil)
+		return
+	}
+	if req.AllowCredentials {
+		for _, origin := range req.AllowedOrigins {
+			if origin == "*" {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "allow_credentials cannot be combined with the * origin", nil)
+				return
+			}
+		}
+	}
+	if req.MaxAge < 0 || req.MaxAge > maxCORSMaxAge {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "max_age must be between 0 and "+strconv.Itoa(maxCORSMaxAge)+" seconds", nil)
+		return
+	}
+
+	category := string(models.CategorySecurity)
+	origins, _ := json.Marshal(req.AllowedOrigins)
+	methods, _ := json.Marshal(req.AllowedMethods)
+	headers, _ := json.Marshal(req.AllowedHeaders)
+	p.store.SetSetting(models.SettingCORSAllowedOrigins, string(origins), "json", category)
+	p.store.SetSetting(models.SettingCORSAllowedMethods, string(methods), "json", category)
+	p.store.SetSetting(models.SettingCORSAllowedHeaders, string(headers), "json", category)
+	p.store.SetSetting(models.SettingCORSAllowCredentials, strconv.FormatBool(req.AllowCredentials), "bool", category)
+	p.store.SetSetting(models.SettingCORSMaxAge, strconv.Itoa(req.MaxAge), "int", category)
+	publishSettingsChanged(r, corsSettingKeys)
+	p.Reload()
+
+	p.GetCORS(w, r)
+}
+
+// ResetCORS removes the saved CORS settings, so the defaults of the environment apply (admin only)
+func (p *CORSPolicy) ResetCORS(w http.ResponseWriter, r *http.Request) {
+	for _, key := range corsSettingKeys {
+		if err := p.store.DeleteSetting(key); err != nil {
+			apierror.Error(w, "Failed to reset CORS settings", http.StatusInternalServerError)
+			return
+		}
+	}
+	publishSettingsChanged(r, corsSettingKeys)
+	p.Reload()
+
+	p.GetCORS(w, r)
+}
+
+// normalizeCORSOrigins checks that origins are * or scheme://host[:port], as browsers send them
+// in the Origin header, and drops duplicates
+func normalizeCORSOrigins(origins []string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, origin := range origins {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin != "*" {
+			u, err := url.Parse(origin)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+				u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+				return nil, fmt.Errorf("invalid origin %q: use scheme://host[:port] or *", origin)
+			}
+			origin = u.Scheme + "://" + strings.ToLower(u.Host)
+		}
+		if !seen[origin] {
+			seen[origin] = true
+			normalized = append(normalized, origin)
+		}
+	}
+	return normalized, nil
+}
+
+// normalizeCORSTokens checks that methods or header names are HTTP tokens and drops duplicates
+func normalizeCORSTokens(field string, values []string, normalize func(string) string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, value := range values {
+		value = normalize(strings.TrimSpace(value))
+		if !isHTTPToken(value) {
+			return nil, fmt.Errorf("%s: invalid name %q", field, value)
+		}
+		if !seen[value] {
+			seen[value] = true
+			normalized = append(normalized, value)
+		}
+	}
+	return normalized, nil
+}
+
+// isHTTPToken reports whether a string is a valid HTTP method or header name
+func isHTTPToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+const (
+	// statsRecordInterval is how often the daily statistics of the current day are updated
+	statsRecordInterval = 15 * time.Minute
+	// maxStatsHistoryDays is the longest period the statistics history endpoint returns
+	maxStatsHistoryDays = 365
+	// statsDayFormat is how days are keyed in the daily statistics
+	statsDayFormat = "2006-01-02"
+)
+
+// dailyStatMetrics are the metrics accepted by the statistics history endpoint
+var dailyStatMetrics = map[string]bool{
+	models.StatFiles:           true,
+	models.StatUsedBytes:       true,
+	models.StatActiveUsers:     true,
+	models.StatBytesServed:     true,
+	models.StatBytesUploaded:   true,
+	models.StatBytesDownloaded: true,
+}
+
+// StatsRecorder periodically records the daily statistics behind the admin dashboard charts:
+// files and storage used by the server, each pool and each zone, active users and bytes served.
+// It also stores the bytes transferred by users, zones and share links.
+type StatsRecorder struct {
+	store    storage.DataStore
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	served   int64 // Bytes served when bandwidth was last recorded
+}
+
+// NewStatsRecorder creates a new daily statistics recorder
+func NewStatsRecorder(store storage.DataStore) *StatsRecorder {
+	return &StatsRecorder{
+		store:    store,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the statistics recorder background goroutine
+func (s *StatsRecorder) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.stopChan = make(chan struct{})
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.run()
+	log.Println("Stats recorder started")
+}
+
+// Stop records the statistics a last time, so bytes served and transferred are not lost, and
+// stops the recorder
+func (s *StatsRecorder) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stopChan)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.Record()
+	log.Println("Stats recorder stopped")
+}
+
+// run is the main recorder loop
+func (s *StatsRecorder) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(statsRecordInterval)
+	defer ticker.Stop()
+
+	s.Record()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.Record()
+		}
+	}
+}
+
+// Record updates today's statistics. Bytes served and transferred since the last call are added
+// to the day, the other statistics replace what was recorded earlier in the day.
+func (s *StatsRecorder) Record() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	day := now.Format(statsDayFormat)
+	served := middleware.BytesServed()
+
+	stats := collectStorageStats(s.store, day)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if active, err := s.store.CountActiveUsers(midnight); err == nil {
+		stats = append(stats, &models.DailyStat{Day: day, Metric: models.StatActiveUsers, Value: int64(active), Merge: models.DailyStatMax})
+	} else {
+		log.Printf("Warning: Failed to count active users: %v", err)
+	}
+	stats = append(stats, &models.DailyStat{Day: day, Metric: models.StatBytesServed, Value: served - s.served, Merge: models.DailyStatAdd})
+
+	if err := s.store.RecordDailyStats(stats); err != nil {
+		log.Printf("Warning: Failed to record daily stats: %v", err)
+	} else {
+		s.served = served
+	}
+	if err := flushTransfers(s.store); err != nil {
+		log.Printf("Warning: Failed to record transfers: %v", err)
+	}
+}
+
+// collectStorageStats returns the indexed files and storage used by every zone, every pool and
+// the whole server. Zones on disabled or object storage pools are skipped.
+func collectStorageStats(store storage.DataStore, day string) []*models.DailyStat {
+	pools := make(map[string]*models.StoragePool)
+	for _, pool := range store.ListStoragePools() {
+		if pool.Enabled && !pool.IsS3() {
+			pools[pool.ID] = pool
+		}
+	}
+
+	stats := []*models.DailyStat{}
+	poolTotals := make(map[string]*models.UsageTotals)
+	var server models.UsageTotals
+	for _, zone := range store.ListShareZones() {
+		if pools[zone.PoolID] == nil {
+			continue
+		}
+		totals, err := store.SumDirUsage(zone.ID, "/")
+		if err != nil {
+			continue
+		}
+		stats = append(stats, storageStats(day, "zone", zone.ID, totals)...)
+
+		if poolTotals[zone.PoolID] == nil {
+			poolTotals[zone.PoolID] = &models.UsageTotals{}
+		}
+		poolTotals[zone.PoolID].Size += totals.Size
+		poolTotals[zone.PoolID].FileCount += totals.FileCount
+		server.Size += totals.Size
+		server.FileCount += totals.FileCount
+	}
+	for poolID, totals := range poolTotals {
+		stats = append(stats, storageStats(day, "pool", poolID, totals)...)
+	}
+	return append(stats, storageStats(day, "", "", &server)...)
+}
+
+// storageStats returns the files and used bytes statistics of the server, a pool or a zone
+func storageStats(day, objectType, objectID string, totals *models.UsageTotals) []*models.DailyStat {
+	return []*models.DailyStat{
+		{Day: day, Metric: models.StatFiles, ObjectType: objectType, ObjectID: objectID, Value: totals.FileCount},
+		{Day: day, Metric: models.StatUsedBytes, ObjectType: objectType, ObjectID: objectID, Value: totals.Size},
+	}
+}
+
+// today returns today's statistics of the whole server by metric
+func (s *StatsRecorder) today() map[string]int64 {
+	values := make(map[string]int64)
+	stats := s.store.ListDailyStats(models.DailyStatFilter{ObjectType: "server", Since: time.Now().Format(statsDayFormat)})
+	for _, stat := range stats {
+		values[stat.Metric] = stat.Value
+	}
+	return values
+}
+
+// GetStatsHistory returns the daily history of the dashboard statistics over a period (default
+// 30 days), optionally limited to one metric and to the server or one kind of object (admin only)
+func (s *StatsRecorder) GetStatsHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	days := 30
+	if value := query.Get("days"); value != "" {
+		var err error
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 || days > maxStatsHistoryDays {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Invalid days %q: use a number between 1 and %d", value, maxStatsHistoryDays), nil)
+			return
+		}
+	}
+	filter := models.DailyStatFilter{
+		Metric:     query.Get("metric"),
+		ObjectType: query.Get("object_type"),
+		ObjectID:   query.Get("object_id"),
+		Since:      time.Now().AddDate(0, 0, -(days - 1)).Format(statsDayFormat),
+	}
+	if filter.Metric != "" && !dailyStatMetrics[filter.Metric] {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Unknown metric", nil)
+		return
+	}
+	switch filter.ObjectType {
+	case "", "server", "pool", models.TransferObjectZone, models.TransferObjectUser, models.TransferObjectShareLink:
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Object type must be server, pool, zone, user or share_link", nil)
+		return
+	}
+
+	names := make(map[string]string)
+	for _, pool := range s.store.ListStoragePools() {
+		names["pool/"+pool.ID] = pool.Name
+	}
+	for _, zone := range s.store.ListShareZones() {
+		names["zone/"+zone.ID] = zone.Name
+	}
+	for _, user := range s.store.ListUsers() {
+		names["user/"+user.ID] = user.Username
+	}
+	for _, link := range s.store.ListShareLinks() {
+		names["share_link/"+link.ID] = link.Name
+	}
+
+	// Rows come ordered by series and then by day
+	series := []*models.DailyStatSeries{}
+	var current *models.DailyStatSeries
+	for _, stat := range s.store.ListDailyStats(filter) {
+		if current == nil || current.Metric != stat.Metric || current.ObjectType != stat.ObjectType || current.ObjectID != stat.ObjectID {
+			current = &models.DailyStatSeries{
+				Metric:     stat.Metric,
+				ObjectType: stat.ObjectType,
+				ObjectID:   stat.ObjectID,
+				Name:       names[stat.ObjectType+"/"+stat.ObjectID],
+				Points:     []models.DailyStatPoint{},
+			}
+			series = append(series, current)
+		}
+		current.Points = append(current.Points, models.DailyStatPoint{Day: stat.Day, Value: stat.Value})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days":   days,
+		"since":  filter.Since,
+		"series": series,
+	})
+}
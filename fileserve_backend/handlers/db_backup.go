@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+const (
+	// dbBackupPollInterval is how often the scheduler looks whether a backup is due
+	dbBackupPollInterval = 5 * time.Minute
+	// dbBackupPrefix starts the name of every backup file, so pruning leaves other files alone
+	dbBackupPrefix = "fileserv-"
+	// dbRestoreConfirmation must be sent with a restore request
+	dbRestoreConfirmation = "RESTORE"
+)
+
+// DatabaseBackupScheduler writes backups of the database into a storage pool on a schedule and
+// keeps the newest of them
+type DatabaseBackupScheduler struct {
+	store    storage.DataStore
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	busy     bool
+}
+
+// NewDatabaseBackupScheduler creates a new database backup scheduler
+func NewDatabaseBackupScheduler(store storage.DataStore) *DatabaseBackupScheduler {
+	return &DatabaseBackupScheduler{
+		store:    store,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the database backup scheduler background goroutine
+func (s *DatabaseBackupScheduler) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.stopChan = make(chan struct{})
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.run()
+	log.Println("Database backup scheduler started")
+}
+
+// Stop stops the database backup scheduler
+func (s *DatabaseBackupScheduler) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stopChan)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	log.Println("Database backup scheduler stopped")
+}
+
+// run is the main scheduler loop
+func (s *DatabaseBackupScheduler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(dbBackupPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if s.due() {
+				if _, err := s.Backup(); err != nil {
+					log.Printf("Database backup: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// lastRun returns when the last backup was attempted
+func (s *DatabaseBackupScheduler) lastRun() time.Time {
+	setting, err := s.store.GetSetting(models.SettingDBBackupLastRun)
+	if err != nil || setting == nil {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339, setting.Value)
+	return t
+}
+
+// due reports whether a scheduled backup should run
+func (s *DatabaseBackupScheduler) due() bool {
+	settings := GetDatabaseBackupSettingsFromStore(s.store)
+	if !settings.Enabled || settings.PoolID == "" {
+		return false
+	}
+	last := s.lastRun()
+	return last.IsZero() || !time.Now().Before(nextScheduledRun(settings.Schedule, last))
+}
+
+// Backup writes a backup into the configured directory and deletes the oldest backups beyond
+// the retention. The outcome is recorded in the settings.
+func (s *DatabaseBackupScheduler) Backup() (*models.DatabaseBackup, error) {
+	s.mu.Lock()
+	if s.busy {
+		s.mu.Unlock()
+		return nil, errors.New("a backup is already in progress")
+	}
+	s.busy = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.busy = false
+		s.mu.Unlock()
+	}()
+
+	started := time.Now()
+	backup, err := s.backup(started)
+
+	category := string(models.CategoryStorage)
+	s.store.SetSetting(models.SettingDBBackupLastRun, started.Format(time.RFC3339), "string", category)
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+	}
+	s.store.SetSetting(models.SettingDBBackupLastError, lastError, "string", category)
+	return backup, err
+}
+
+func (s *DatabaseBackupScheduler) backup(started time.Time) (*models.DatabaseBackup, error) {
+	settings := GetDatabaseBackupSettingsFromStore(s.store)
+	dir, err := databaseBackupDir(s.store, settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := dbBackupPrefix + started.Format("20060102-150405") + ".db"
+	dest := filepath.Join(dir, name)
+	if err := s.store.BackupDatabase(dest); err != nil {
+		return nil, err
+	}
+	os.Chmod(dest, 0600)
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Database backup: wrote %s (%d bytes)", dest, info.Size())
+
+	backups, _ := listDatabaseBackups(dir)
+	for i := settings.Retention; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(dir, backups[i].Name)); err != nil {
+			log.Printf("Database backup: failed to delete old backup %s: %v", backups[i].Name, err)
+		}
+	}
+
+	return &models.DatabaseBackup{Name: name, Size: info.Size(), CreatedAt: info.ModTime()}, nil
+}
+
+// GetDatabaseBackupSettingsFromStore returns the scheduled backup settings
+func GetDatabaseBackupSettingsFromStore(store storage.DataStore) models.DatabaseBackupSettings {
+	settings := models.DatabaseBackupSettings{
+		Path:      models.DefaultDBBackupPath,
+		Schedule:  string(models.ScheduleDaily),
+		Retention: models.DefaultDBBackupRetention,
+	}
+	if setting, err := store.GetSetting(models.SettingDBBackupEnabled); err == nil && setting != nil {
+		settings.Enabled = setting.Value == "true"
+	}
+	if setting, err := store.GetSetting(models.SettingDBBackupPoolID); err == nil && setting != nil {
+		settings.PoolID = setting.Value
+	}
+	if setting, err := store.GetSetting(models.SettingDBBackupPath); err == nil && setting != nil && setting.Value != "" {
+		settings.Path = setting.Value
+	}
+	if setting, err := store.GetSetting(models.SettingDBBackupSchedule); err == nil && setting != nil && setting.Value != "" {
+		settings.Schedule = setting.Value
+	}
+	if setting, err := store.GetSetting(models.SettingDBBackupRetention); err == nil && setting != nil {
+		if v, err := strconv.Atoi(setting.Value); err == nil && v > 0 {
+			settings.Retention = v
+		}
+	}
+	return settings
+}
+
+// databaseBackupDir returns the directory backups are written to, inside the configured pool
+func databaseBackupDir(store storage.DataStore, settings models.DatabaseBackupSettings) (string, error) {
+	if settings.PoolID == "" {
+		return "", errors.New("no backup pool is configured")
+	}
+	pool, err := store.GetStoragePool(settings.PoolID)
+	if err != nil {
+		return "", errors.New("backup pool not found")
+	}
+	if pool.IsS3() {
+		return "", errors.New("backups cannot be written to an S3 pool")
+	}
+	rel, err := cleanRelativePath(settings.Path)
+	if err != nil {
+		return "", errors.New("invalid backup path")
+	}
+	return filepath.Join(pool.Path, filepath.FromSlash(rel)), nil
+}
+
+// listDatabaseBackups returns the backups in dir, newest first
+func listDatabaseBackups(dir string) ([]models.DatabaseBackup, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.DatabaseBackup{}, nil
+		}
+		return nil, err
+	}
+
+	backups := []models.DatabaseBackup{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isDatabaseBackupName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, models.DatabaseBackup{Name: entry.Name(), Size: info.Size(), CreatedAt: info.ModTime()})
+	}
+	// Names embed the time of the backup, so they sort chronologically
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+// isDatabaseBackupName reports whether name is a file written by the backup scheduler
+func isDatabaseBackupName(name string) bool {
+	return strings.HasPrefix(name, dbBackupPrefix) && strings.HasSuffix(name, ".db") && filepath.Base(name) == name
+}
+
+// ============================================================================
+// HTTP Handlers
+// ============================================================================
+
+// DatabaseBackupHandler handles database backup and restore API requests
+type DatabaseBackupHandler struct {
+	store     storage.DataStore
+	scheduler *DatabaseBackupScheduler
+}
+
+// NewDatabaseBackupHandler creates a new database backup handler
+func NewDatabaseBackupHandler(store storage.DataStore, scheduler *DatabaseBackupScheduler) *DatabaseBackupHandler {
+	return &DatabaseBackupHandler{store: store, scheduler: scheduler}
+}
+
+// DownloadBackup streams a backup of the database taken while the server keeps running (admin only)
+func (h *DatabaseBackupHandler) DownloadBackup(w http.ResponseWriter, r *http.Request) {
+	tmp, err := os.CreateTemp("", "fileserv-backup-*.db")
+	if err != nil {
+		apierror.Error(w, "Failed to create backup: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := h.store.BackupDatabase(tmp.Name()); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		apierror.Error(w, "Failed to read backup: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	filename := dbBackupPrefix + time.Now().Format("20060102-150405") + ".db"
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	if info, err := f.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+	io.Copy(w, f)
+}
+
+// GetBackups returns the backup settings, the outcome of the last scheduled backup and the
+// backups in the backup directory (admin only)
+func (h *DatabaseBackupHandler) GetBackups(w http.ResponseWriter, r *http.Request) {
+	settings := GetDatabaseBackupSettingsFromStore(h.store)
+
+	status := map[string]interface{}{
+		"settings":        settings,
+		"backups":         []models.DatabaseBackup{},
+		"restore_pending": h.store.DatabaseRestorePending(),
+	}
+	if last := h.scheduler.lastRun(); !last.IsZero() {
+		status["last_run"] = last
+		if settings.Enabled {
+			status["next_run"] = nextScheduledRun(settings.Schedule, last)
+		}
+	}
+	if setting, err := h.store.GetSetting(models.SettingDBBackupLastError); err == nil && setting != nil && setting.Value != "" {
+		status["last_error"] = setting.Value
+	}
+	if dir, err := databaseBackupDir(h.store, settings); err == nil {
+		status["directory"] = dir
+		if backups, err := listDatabaseBackups(dir); err == nil {
+			status["backups"] = backups
+		} else {
+			status["error"] = err.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// UpdateBackupSettings saves the scheduled backup settings (admin only)
+func (h *DatabaseBackupHandler) UpdateBackupSettings(w http.ResponseWriter, r *http.Request) {
+	req := GetDatabaseBackupSettingsFromStore(h.store)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	req.Path = strings.Trim(strings.TrimSpace(req.Path), "/")
+	if req.Path == "" {
+		req.Path = models.DefaultDBBackupPath
+	}
+	switch models.SnapshotSchedule(req.Schedule) {
+	case models.ScheduleHourly, models.ScheduleDaily, models.ScheduleWeekly, models.ScheduleMonthly:
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Schedule must be hourly, daily, weekly or monthly", nil)
+		return
+	}
+	if req.Retention < 1 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Retention must be at least 1", nil)
+		return
+	}
+	if req.Enabled || req.PoolID != "" {
+		if _, err := databaseBackupDir(h.store, req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+	}
+
+	category := string(models.CategoryStorage)
+	h.store.SetSetting(models.SettingDBBackupEnabled, strconv.FormatBool(req.Enabled), "bool", category)
+	h.store.SetSetting(models.SettingDBBackupPoolID, req.PoolID, "string", category)
+	h.store.SetSetting(models.SettingDBBackupPath, req.Path, "string", category)
+	h.store.SetSetting(models.SettingDBBackupSchedule, req.Schedule, "string", category)
+	h.store.SetSetting(models.SettingDBBackupRetention, strconv.Itoa(req.Retention), "int", category)
+
+	h.GetBackups(w, r)
+}
+
+// RunBackup writes a backup into the backup directory now (admin only)
+func (h *DatabaseBackupHandler) RunBackup(w http.ResponseWriter, r *http.Request) {
+	backup, err := h.scheduler.Backup()
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(backup)
+}
+
+// RestoreBackup stages a backup to replace the database on the next restart (admin only). The
+// backup is either named from the backup directory in a JSON body, or uploaded as the "file"
+// field of a multipart form. Both must carry confirm=RESTORE.
+func (h *DatabaseBackupHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	var src, confirm, name string
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(multipartMemory); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid upload", nil)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+		confirm = r.FormValue("confirm")
+		if confirm != dbRestoreConfirmation {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, `Restoring replaces all data, send confirm="RESTORE" to proceed`, nil)
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "No backup file provided", nil)
+			return
+		}
+		defer file.Close()
+		name = header.Filename
+
+		tmp, err := os.CreateTemp("", "fileserv-restore-*.db")
+		if err != nil {
+			apierror.Error(w, "Failed to save upload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(tmp.Name())
+		_, err = io.Copy(tmp, file)
+		tmp.Close()
+		if err != nil {
+			apierror.Error(w, "Failed to save upload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		src = tmp.Name()
+	} else {
+		var req struct {
+			Name    string `json:"name"`
+			Confirm string `json:"confirm"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+		if req.Confirm != dbRestoreConfirmation {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, `Restoring replaces all data, send confirm="RESTORE" to proceed`, nil)
+			return
+		}
+		if !isDatabaseBackupName(req.Name) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid backup name", nil)
+			return
+		}
+		dir, err := databaseBackupDir(h.store, GetDatabaseBackupSettingsFromStore(h.store))
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		src = filepath.Join(dir, req.Name)
+		if _, err := os.Stat(src); err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeBackupNotFound, "Backup not found", nil)
+			return
+		}
+		name = req.Name
+	}
+
+	if err := h.store.StageDatabaseRestore(src); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	actor := ""
+	if userCtx := middleware.GetUserContext(r); userCtx != nil {
+		actor = userCtx.Username
+	}
+	log.Printf("Security: %s staged a database restore from %s", actor, name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          "Restore staged, restart the server to replace the database",
+		"restart_required": true,
+	})
+}
+
+// CancelRestore discards a staged restore (admin only)
+func (h *DatabaseBackupHandler) CancelRestore(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.CancelDatabaseRestore(); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// purgeDeletedObjects permanently deletes pools, zones, shares and share links deleted longer
+// ago than the soft-delete window
+func purgeDeletedObjects(store storage.DataStore) {
+	before := time.Now().AddDate(0, 0, -models.SoftDeleteRetentionDays)
+	if err := store.PurgeDeletedObjectsBefore(before); err != nil {
+		log.Printf("Warning: Failed to purge deleted objects: %v", err)
+	}
+}
+
+// deletedObjectActor returns the name of the admin making the request, for the log
+func deletedObjectActor(r *http.Request) string {
+	if userCtx := middleware.GetUserContext(r); userCtx != nil {
+		return userCtx.Username
+	}
+	return ""
+}
+
+// writeDeletedObjectError responds to an error restoring or purging an object
+func writeDeletedObjectError(w http.ResponseWriter, err error) {
+	switch msg := err.Error(); {
+	case msg == "deleted object not found" || msg == "unknown object type":
+		apierror.Write(w, http.StatusNotFound, apierror.CodeObjectNotFound, msg, nil)
+	case strings.HasPrefix(msg, "restore the") || strings.HasPrefix(msg, "cannot restore") || strings.HasPrefix(msg, "cannot purge"):
+		apierror.Write(w, http.StatusConflict, apierror.CodeConflict, msg, nil)
+	default:
+		apierror.Error(w, msg, http.StatusInternalServerError)
+	}
+}
+
+// writeNameConflict responds with 409 when creating or renaming an object failed because its
+// name is taken, by a live object or by a deleted one that has to be restored or purged first.
+// It reports whether err was such a conflict.
+func writeNameConflict(w http.ResponseWriter, err error) bool {
+	msg := err.Error()
+	if !strings.HasSuffix(msg, "already exists") && !strings.HasSuffix(msg, "restore or purge it first") {
+		return false
+	}
+	apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, msg, nil)
+	return true
+}
+
+// ListDeletedObjects returns the deleted pools, zones, shares and share links that can still be
+// restored (admin only)
+func ListDeletedObjects(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		objects := store.ListDeletedObjects()
+		if objectType := r.URL.Query().Get("type"); objectType != "" {
+			filtered := []*models.DeletedObject{}
+			for _, object := range objects {
+				if string(object.Type) == objectType {
+					filtered = append(filtered, object)
+				}
+			}
+			objects = filtered
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(objects)
+	}
+}
+
+// RestoreDeletedObject undoes the deletion of a pool, zone, share or share link and brings back
+// the network shares and quota of a restored zone (admin only)
+func RestoreDeletedObject(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		objectType := models.DeletedObjectType(chi.URLParam(r, "type"))
+		id := chi.URLParam(r, "id")
+
+		if err := store.RestoreDeletedObject(objectType, id); err != nil {
+			writeDeletedObjectError(w, err)
+			return
+		}
+		log.Printf("%s restored deleted %s %s", deletedObjectActor(r), objectType, id)
+		publishAction(r, &events.Event{Type: events.TypeObjectRestored, ObjectType: string(objectType), ObjectID: id, AdminOnly: true})
+
+		var restored interface{}
+		switch objectType {
+		case models.DeletedObjectPool:
+			if pool, err := store.GetStoragePool(id); err == nil {
+				restored = redactPool(pool)
+			}
+		case models.DeletedObjectZone:
+			if zone, err := store.GetShareZone(id); err == nil {
+				restoreZoneServices(store, zone)
+				restored = zone
+			}
+		case models.DeletedObjectShare:
+			restored, _ = store.GetShare(id)
+		case models.DeletedObjectShareLink:
+			restored, _ = store.GetShareLink(id)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(restored)
+	}
+}
+
+// restoreZoneServices reapplies what deleting a zone took down: its quota and its SMB and NFS shares
+func restoreZoneServices(store storage.DataStore, zone *models.ShareZone) {
+	if quota, err := store.GetZoneProjectQuota(zone.ID); err == nil && quota != nil {
+		if pool, err := store.GetStoragePool(zone.PoolID); err == nil {
+			if err := applyProjectQuota(quota, filepath.Join(pool.Path, zone.Path)); err != nil {
+				log.Printf("Warning: Failed to reapply quota of zone %s: %v", zone.Name, err)
+			}
+		}
+	}
+	if zone.SMBEnabled {
+		if err := SyncSMBConfig(store); err != nil {
+			log.Printf("Warning: Failed to restore SMB config for zone %s: %v", zone.Name, err)
+		}
+	}
+	if zone.NFSEnabled {
+		if err := SyncNFSConfig(store); err != nil {
+			log.Printf("Warning: Failed to restore NFS config for zone %s: %v", zone.Name, err)
+		}
+	}
+}
+
+// PurgeDeletedObject permanently deletes a deleted pool, zone, share or share link before its
+// soft-delete window ends (admin only)
+func PurgeDeletedObject(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		objectType := models.DeletedObjectType(chi.URLParam(r, "type"))
+		id := chi.URLParam(r, "id")
+
+		if err := store.PurgeDeletedObject(objectType, id); err != nil {
+			writeDeletedObjectError(w, err)
+			return
+		}
+		log.Printf("%s purged deleted %s %s", deletedObjectActor(r), objectType, id)
+		publishAction(r, &events.Event{Type: events.TypeObjectPurged, ObjectType: string(objectType), ObjectID: id, AdminOnly: true})
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,615 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+)
+
+// Wipe methods. Every method first removes all filesystem, RAID, LVM and partition table
+// signatures; the others then also destroy the data itself.
+const (
+	WipeMethodSignatures  = "signatures"   // wipefs only
+	WipeMethodZero        = "zero"         // Overwrite the whole device with zeros
+	WipeMethodDiscard     = "discard"      // TRIM/UNMAP every block (SSDs and thin devices)
+	WipeMethodSecureErase = "secure_erase" // NVMe format or ATA SECURITY ERASE UNIT (whole disks)
+)
+
+const (
+	// diskWipeTokenTTL is how long a confirmation token stays valid
+	diskWipeTokenTTL = 5 * time.Minute
+	// diskWipeChunkSize is the write size of the zero pass
+	diskWipeChunkSize = 4 * 1024 * 1024
+	// diskWipeProgressInterval is how often progress is streamed during long steps
+	diskWipeProgressInterval = 2 * time.Second
+	// ataErasePassword is the temporary password ATA secure erase requires; the erase clears it
+	ataErasePassword = "fileserv"
+)
+
+var (
+	hdparmEraseTimeRegex = regexp.MustCompile(`(\d+)min for (?:ENHANCED )?SECURITY ERASE UNIT`)
+	nvmeNamespaceRegex   = regexp.MustCompile(`^/dev/nvme\d+n\d+$`)
+)
+
+// DiskWipeCapabilities describes which wipe methods a device supports
+type DiskWipeCapabilities struct {
+	Device      string   `json:"device"`
+	Type        string   `json:"type"` // disk or part
+	Model       string   `json:"model,omitempty"`
+	Serial      string   `json:"serial,omitempty"`
+	Size        uint64   `json:"size"`
+	SizeHuman   string   `json:"size_human"`
+	Methods     []string `json:"methods"`
+	SecureErase string   `json:"secure_erase,omitempty"` // nvme or ata
+	Problem     string   `json:"problem,omitempty"`      // Why secure erase is not available
+	InUse       string   `json:"in_use,omitempty"`       // Why the device cannot be wiped right now
+
+	eraseMinutes  int
+	enhancedErase bool
+}
+
+// diskWipeToken is a confirmation token for one wipe of one device
+type diskWipeToken struct {
+	Device    string
+	Method    string
+	UserID    string
+	ExpiresAt time.Time
+}
+
+var (
+	diskWipeMu      sync.Mutex
+	diskWipeTokens  = make(map[string]*diskWipeToken)
+	diskWipesActive = make(map[string]bool)
+)
+
+// checkDeviceWipeable makes sure nothing uses a device or its partitions: no mounts or swap,
+// no holders such as active RAID arrays, LVM volumes or open LUKS mappings, and no imported ZFS pool.
+// Unlike checkZFSDeviceAvailable, old signatures are fine: removing them is the point of a wipe.
+func checkDeviceWipeable(device string) error {
+	output, err := exec.Command("lsblk", "-J", "-o", "NAME,PATH,TYPE,MOUNTPOINT", device).Output()
+	if err != nil {
+		return fmt.Errorf("device %s not found", device)
+	}
+
+	type blockDevice struct {
+		Name       string        `json:"name"`
+		Path       string        `json:"path"`
+		Type       string        `json:"type"`
+		MountPoint string        `json:"mountpoint"`
+		Children   []blockDevice `json:"children"`
+	}
+	var lsblkOutput struct {
+		BlockDevices []blockDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(output, &lsblkOutput); err != nil || len(lsblkOutput.BlockDevices) != 1 {
+		return fmt.Errorf("failed to read device info for %s", device)
+	}
+
+	dev := lsblkOutput.BlockDevices[0]
+	if dev.Type != "disk" && dev.Type != "part" {
+		return fmt.Errorf("%s is not a disk or partition", device)
+	}
+
+	paths := []string{device}
+	var check func(bd blockDevice) error
+	check = func(bd blockDevice) error {
+		if bd.MountPoint != "" {
+			return fmt.Errorf("/dev/%s is mounted at %s", bd.Name, bd.MountPoint)
+		}
+		for _, child := range bd.Children {
+			if child.Type != "part" {
+				return fmt.Errorf("/dev/%s is in use by %s /dev/%s", bd.Name, child.Type, child.Name)
+			}
+			paths = append(paths, child.Path)
+			if err := check(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := check(dev); err != nil {
+		return err
+	}
+
+	// ZFS vdevs have no holders, so look for the device in the imported pools
+	if output, err := exec.Command("sudo", "zpool", "status", "-P").Output(); err == nil {
+		for _, field := range strings.Fields(string(output)) {
+			for _, path := range paths {
+				if field == path {
+					return fmt.Errorf("%s belongs to an imported ZFS pool", path)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// detectWipeCapabilities reads a device's identity and works out the wipe methods it supports
+func detectWipeCapabilities(device string) (*DiskWipeCapabilities, error) {
+	output, err := exec.Command("lsblk", "-J", "-b", "-d", "-o", "TYPE,MODEL,SERIAL,SIZE,DISC-MAX", device).Output()
+	if err != nil {
+		return nil, fmt.Errorf("device %s not found", device)
+	}
+	var lsblkOutput struct {
+		BlockDevices []struct {
+			Type    string      `json:"type"`
+			Model   string      `json:"model"`
+			Serial  string      `json:"serial"`
+			Size    interface{} `json:"size"`     // Can be string or int
+			DiscMax interface{} `json:"disc-max"` // Can be string or int
+		} `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(output, &lsblkOutput); err != nil || len(lsblkOutput.BlockDevices) != 1 {
+		return nil, fmt.Errorf("failed to read device info for %s", device)
+	}
+	dev := lsblkOutput.BlockDevices[0]
+
+	caps := &DiskWipeCapabilities{
+		Device:  device,
+		Type:    dev.Type,
+		Model:   strings.TrimSpace(dev.Model),
+		Serial:  strings.TrimSpace(dev.Serial),
+		Methods: []string{WipeMethodSignatures, WipeMethodZero},
+	}
+	lsblkNumber := func(v interface{}) uint64 {
+		switch v := v.(type) {
+		case float64:
+			return uint64(v)
+		case string:
+			n, _ := strconv.ParseUint(v, 10, 64)
+			return n
+		}
+		return 0
+	}
+	caps.Size = lsblkNumber(dev.Size)
+	caps.SizeHuman = formatBytes(caps.Size)
+
+	if lsblkNumber(dev.DiscMax) > 0 && checkCommandExists("blkdiscard") {
+		caps.Methods = append(caps.Methods, WipeMethodDiscard)
+	}
+
+	switch {
+	case dev.Type != "disk":
+		caps.Problem = "secure erase works on whole disks only"
+	case nvmeNamespaceRegex.MatchString(device):
+		if !checkCommandExists("nvme") {
+			caps.Problem = "nvme-cli is not installed"
+			break
+		}
+		if output, err := exec.Command("nvme", "id-ctrl", device).CombinedOutput(); err != nil {
+			caps.Problem = "failed to identify the NVMe controller: " + commandError(output, err)
+			break
+		}
+		caps.SecureErase = "nvme"
+	default:
+		if !checkCommandExists("hdparm") {
+			caps.Problem = "hdparm is not installed"
+			break
+		}
+		output, err := exec.Command("hdparm", "-I", device).CombinedOutput()
+		if err != nil {
+			caps.Problem = "failed to identify the drive: " + commandError(output, err)
+			break
+		}
+		caps.Problem = parseATASecurity(string(output), caps)
+		if caps.Problem == "" {
+			caps.SecureErase = "ata"
+		}
+	}
+	if caps.SecureErase != "" {
+		caps.Methods = append(caps.Methods, WipeMethodSecureErase)
+	}
+
+	return caps, nil
+}
+
+// parseATASecurity reads the Security section of hdparm -I and returns why secure erase cannot
+// run, or an empty string when it can
+func parseATASecurity(output string, caps *DiskWipeCapabilities) string {
+	idx := strings.Index(output, "\nSecurity:")
+	if idx < 0 {
+		return "the drive does not support the ATA security feature set"
+	}
+	// The section runs until the next line that is not indented
+	lines := strings.Split(output[idx+len("\nSecurity:"):], "\n")
+	for i, line := range lines[1:] {
+		if line == "" || (line[0] != ' ' && line[0] != '\t') {
+			lines = lines[:i+1]
+			break
+		}
+	}
+	section := strings.Join(lines, "\n")
+
+	supported, frozen, enabled := false, true, false
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 1 && fields[0] == "supported":
+			supported = true
+		case len(fields) == 2 && fields[0] == "not" && fields[1] == "frozen":
+			frozen = false
+		case len(fields) == 1 && fields[0] == "enabled":
+			enabled = true
+		case strings.Contains(line, "supported: enhanced erase") && !strings.Contains(line, "not"):
+			caps.enhancedErase = true
+		}
+	}
+	// The normal erase time comes first, the enhanced one second
+	if matches := hdparmEraseTimeRegex.FindAllStringSubmatch(section, -1); matches != nil {
+		match := matches[0]
+		if caps.enhancedErase {
+			match = matches[len(matches)-1]
+		}
+		caps.eraseMinutes, _ = strconv.Atoi(match[1])
+	}
+
+	switch {
+	case !supported:
+		return "the drive does not support the ATA security feature set"
+	case frozen:
+		return "the drive's security is frozen by the BIOS; suspend and resume the system or hot-plug the drive to unfreeze it"
+	case enabled:
+		return "the drive already has a security password set"
+	}
+	return ""
+}
+
+// normalizeWipeDevice validates the device path of a wipe request
+func normalizeWipeDevice(device string) (string, error) {
+	if !strings.HasPrefix(device, "/dev/") {
+		device = "/dev/" + device
+	}
+	if err := validateDevicePath(device); err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(device, "/dev/md") || strings.HasPrefix(device, "/dev/mapper/") || strings.HasPrefix(device, "/dev/dm-") {
+		return "", fmt.Errorf("%s is a virtual device: wipe its member disks instead", device)
+	}
+	return device, nil
+}
+
+// GetDiskWipeCapabilities returns the wipe methods a device supports and whether it is in use
+func GetDiskWipeCapabilities() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, err := normalizeWipeDevice(r.URL.Query().Get("device"))
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		caps, err := detectWipeCapabilities(device)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeDeviceNotFound, err.Error(), nil)
+			return
+		}
+		if err := checkDeviceWipeable(device); err != nil {
+			caps.InUse = err.Error()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(caps)
+	}
+}
+
+// PrepareDiskWipe checks that a device can be wiped with a method and hands out a short-lived,
+// single-use confirmation token for it. The wipe itself needs the token and the device path
+// typed back as confirmation.
+func PrepareDiskWipe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Device string `json:"device"`
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		device, err := normalizeWipeDevice(req.Device)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if req.Method == "" {
+			req.Method = WipeMethodSignatures
+		}
+
+		caps, err := detectWipeCapabilities(device)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeDeviceNotFound, err.Error(), nil)
+			return
+		}
+		supported := false
+		for _, method := range caps.Methods {
+			if method == req.Method {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			message := fmt.Sprintf("Method %q is not available for %s. Available: %s", req.Method, device, strings.Join(caps.Methods, ", "))
+			if req.Method == WipeMethodSecureErase && caps.Problem != "" {
+				message = fmt.Sprintf("Secure erase is not available for %s: %s", device, caps.Problem)
+			}
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, message, nil)
+			return
+		}
+		if err := checkDeviceWipeable(device); err != nil {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, err.Error(), nil)
+			return
+		}
+
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			apierror.Error(w, "Failed to generate confirmation token", http.StatusInternalServerError)
+			return
+		}
+		token := hex.EncodeToString(buf)
+		userID := ""
+		if userCtx := middleware.GetUserContext(r); userCtx != nil {
+			userID = userCtx.UserID
+		}
+		expiresAt := time.Now().Add(diskWipeTokenTTL)
+
+		diskWipeMu.Lock()
+		for t, entry := range diskWipeTokens {
+			if time.Now().After(entry.ExpiresAt) {
+				delete(diskWipeTokens, t)
+			}
+		}
+		diskWipeTokens[token] = &diskWipeToken{Device: device, Method: req.Method, UserID: userID, ExpiresAt: expiresAt}
+		diskWipeMu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":        token,
+			"expires_at":   expiresAt,
+			"device":       device,
+			"method":       req.Method,
+			"model":        caps.Model,
+			"serial":       caps.Serial,
+			"size":         caps.Size,
+			"size_human":   caps.SizeHuman,
+			"confirmation": device,
+			"warning":      fmt.Sprintf("All data on %s (%s %s) will be destroyed", device, caps.SizeHuman, caps.Model),
+		})
+	}
+}
+
+// WipeDisk runs a wipe prepared with PrepareDiskWipe and streams its progress as server-sent
+// events. The token is used up once the confirmation matches, even when the wipe fails.
+func WipeDisk() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Token   string `json:"token"`
+			Confirm string `json:"confirm"` // The device path, typed back
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		userID := ""
+		if userCtx := middleware.GetUserContext(r); userCtx != nil {
+			userID = userCtx.UserID
+		}
+
+		diskWipeMu.Lock()
+		entry, ok := diskWipeTokens[req.Token]
+		if !ok || time.Now().After(entry.ExpiresAt) || entry.UserID != userID {
+			delete(diskWipeTokens, req.Token)
+			diskWipeMu.Unlock()
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Invalid or expired confirmation token", nil)
+			return
+		}
+		if req.Confirm != entry.Device {
+			diskWipeMu.Unlock()
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Confirmation does not match: type %s to wipe it", entry.Device), nil)
+			return
+		}
+		delete(diskWipeTokens, req.Token)
+		if diskWipesActive[entry.Device] {
+			diskWipeMu.Unlock()
+			apierror.Write(w, http.StatusConflict, apierror.CodeBusy, fmt.Sprintf("%s is already being wiped", entry.Device), nil)
+			return
+		}
+		diskWipesActive[entry.Device] = true
+		diskWipeMu.Unlock()
+		defer func() {
+			diskWipeMu.Lock()
+			delete(diskWipesActive, entry.Device)
+			diskWipeMu.Unlock()
+		}()
+
+		// Things may have changed since the token was issued
+		if err := checkDeviceWipeable(entry.Device); err != nil {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, err.Error(), nil)
+			return
+		}
+		caps, err := detectWipeCapabilities(entry.Device)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeDeviceNotFound, err.Error(), nil)
+			return
+		}
+
+		// Set headers for SSE
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		username := ""
+		if userCtx := middleware.GetUserContext(r); userCtx != nil {
+			username = userCtx.Username
+		}
+		log.Printf("Disk wipe: %s started %s wipe of %s (%s, serial %s)", username, entry.Method, entry.Device, caps.SizeHuman, caps.Serial)
+
+		if err := runDiskWipe(w, r, entry.Device, entry.Method, caps); err != nil {
+			log.Printf("Disk wipe: %s wipe of %s failed: %v", entry.Method, entry.Device, err)
+			sendSSE(w, StreamEvent{Type: "error", Message: err.Error()})
+			sendSSE(w, StreamEvent{Type: "complete", Success: false, Message: fmt.Sprintf("Wipe of %s failed", entry.Device)})
+			return
+		}
+
+		// Let the kernel forget the old partitions
+		exec.Command("partx", "-d", entry.Device).Run()
+		exec.Command("blockdev", "--rereadpt", entry.Device).Run()
+
+		log.Printf("Disk wipe: %s wipe of %s completed", entry.Method, entry.Device)
+		sendSSE(w, StreamEvent{Type: "complete", Success: true, Message: fmt.Sprintf("%s has been wiped", entry.Device)})
+	}
+}
+
+// runDiskWipe runs the steps of a wipe method
+func runDiskWipe(w http.ResponseWriter, r *http.Request, device, method string, caps *DiskWipeCapabilities) error {
+	// Partition signatures go first, while the partition table still points at them
+	if caps.Type == "disk" {
+		if table, err := readPartitionTable(device); err == nil {
+			for _, part := range table.Partitions {
+				if err := streamCommand(w, []string{"wipefs", "-a", part.Device}); err != nil {
+					return fmt.Errorf("wipefs failed on %s: %v", part.Device, err)
+				}
+			}
+		}
+	}
+	if err := streamCommand(w, []string{"wipefs", "-a", device}); err != nil {
+		return fmt.Errorf("wipefs failed: %v", err)
+	}
+
+	switch method {
+	case WipeMethodSignatures:
+		return nil
+	case WipeMethodZero:
+		return zeroDevice(w, r, device, caps.Size)
+	case WipeMethodDiscard:
+		return runWipeCommand(w, []string{"blkdiscard", "-v", device}, 0)
+	case WipeMethodSecureErase:
+		if caps.SecureErase == "nvme" {
+			// Secure erase setting 1 is a user data erase
+			return runWipeCommand(w, []string{"nvme", "format", device, "--ses=1", "--force"}, 0)
+		}
+
+		eraseFlag := "--security-erase"
+		if caps.enhancedErase {
+			eraseFlag = "--security-erase-enhanced"
+		}
+		if err := runWipeCommand(w, []string{"hdparm", "--user-master", "u", "--security-set-pass", ataErasePassword, device}, 0); err != nil {
+			return err
+		}
+		estimate := time.Duration(caps.eraseMinutes) * time.Minute
+		if err := runWipeCommand(w, []string{"hdparm", "--user-master", "u", eraseFlag, ataErasePassword, device}, estimate); err != nil {
+			// Do not leave the drive locked with our password
+			exec.Command("hdparm", "--user-master", "u", "--security-disable", ataErasePassword, device).Run()
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown wipe method %s", method)
+}
+
+// runWipeCommand runs a command that prints little or nothing while it works, streaming the
+// elapsed time (and progress against an estimate when there is one) until it exits
+func runWipeCommand(w http.ResponseWriter, cmdArgs []string, estimate time.Duration) error {
+	sendSSE(w, StreamEvent{Type: "output", Message: fmt.Sprintf("$ %s", strings.Join(cmdArgs, " "))})
+	if estimate > 0 {
+		sendSSE(w, StreamEvent{Type: "output", Message: fmt.Sprintf("The drive estimates %s for this step", estimate)})
+	}
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := exec.Command(cmdArgs[0], cmdArgs[1:]...).CombinedOutput()
+		done <- result{output, err}
+	}()
+
+	start := time.Now()
+	ticker := time.NewTicker(diskWipeProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case res := <-done:
+			for _, line := range strings.Split(strings.TrimSpace(string(res.output)), "\n") {
+				if line != "" {
+					sendSSE(w, StreamEvent{Type: "output", Message: line})
+				}
+			}
+			if res.err != nil {
+				return fmt.Errorf("%s failed: %s", cmdArgs[0], commandError(res.output, res.err))
+			}
+			return nil
+		case <-ticker.C:
+			elapsed := time.Since(start).Truncate(time.Second)
+			event := StreamEvent{Type: "progress", Message: fmt.Sprintf("%s running for %s", cmdArgs[0], elapsed)}
+			if estimate > 0 {
+				event.Progress = min(99, float64(elapsed)/float64(estimate)*100)
+			}
+			sendSSE(w, event)
+		}
+	}
+}
+
+// zeroDevice overwrites a whole device with zeros. It stops when the client goes away, since
+// nobody would see the result; the device is unusable either way after wipefs.
+func zeroDevice(w http.ResponseWriter, r *http.Request, device string, size uint64) error {
+	// O_EXCL on a block device fails when the kernel has it open, e.g. mounted or in an array
+	f, err := os.OpenFile(device, os.O_WRONLY|os.O_EXCL, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", device, err)
+	}
+	defer f.Close()
+
+	sendSSE(w, StreamEvent{Type: "output", Message: fmt.Sprintf("Writing zeros to %s (%s)", device, formatBytes(size))})
+
+	buf := make([]byte, diskWipeChunkSize)
+	start := time.Now()
+	lastReport := start
+	var written uint64
+	for written < size {
+		select {
+		case <-r.Context().Done():
+			return fmt.Errorf("wipe cancelled after %s: the client disconnected", formatBytes(written))
+		default:
+		}
+
+		chunk := buf
+		if remaining := size - written; remaining < uint64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		n, err := f.Write(chunk)
+		written += uint64(n)
+		if err != nil {
+			return fmt.Errorf("write failed at %s: %v", formatBytes(written), err)
+		}
+
+		if time.Since(lastReport) >= diskWipeProgressInterval {
+			lastReport = time.Now()
+			speed := uint64(float64(written) / time.Since(start).Seconds())
+			sendSSE(w, StreamEvent{
+				Type:     "progress",
+				Message:  fmt.Sprintf("%s of %s written (%s/s)", formatBytes(written), formatBytes(size), formatBytes(speed)),
+				Progress: float64(written) / float64(size) * 100,
+			})
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to flush %s: %v", device, err)
+	}
+	sendSSE(w, StreamEvent{Type: "progress", Message: fmt.Sprintf("%s written in %s", formatBytes(written), time.Since(start).Truncate(time.Second)), Progress: 100})
+	return nil
+}
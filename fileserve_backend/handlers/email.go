@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/mailer"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// defaultSMTPPort is the submission port used when none has been saved
+const defaultSMTPPort = 587
+
+// GetSMTPSettingsFromStore returns the outgoing email settings
+func GetSMTPSettingsFromStore(store storage.DataStore) models.SMTPSettings {
+	settings := models.SMTPSettings{
+		Port:     defaultSMTPPort,
+		Security: mailer.SecuritySTARTTLS,
+	}
+	stringSetting := func(key string, value *string) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil && setting.Value != "" {
+			*value = setting.Value
+		}
+	}
+	if setting, err := store.GetSetting(models.SettingSMTPEnabled); err == nil && setting != nil {
+		settings.Enabled = setting.Value == "true"
+	}
+	if setting, err := store.GetSetting(models.SettingSMTPPort); err == nil && setting != nil {
+		if port, err := strconv.Atoi(setting.Value); err == nil && port > 0 {
+			settings.Port = port
+		}
+	}
+	stringSetting(models.SettingSMTPHost, &settings.Host)
+	stringSetting(models.SettingSMTPUsername, &settings.Username)
+	stringSetting(models.SettingSMTPPassword, &settings.Password)
+	stringSetting(models.SettingSMTPFrom, &settings.From)
+	stringSetting(models.SettingSMTPSecurity, &settings.Security)
+	stringSetting(models.SettingPublicURL, &settings.PublicURL)
+	return settings
+}
+
+// mailerConfig converts the stored settings to the mailer configuration
+func mailerConfig(settings models.SMTPSettings) mailer.Config {
+	return mailer.Config{
+		Host:     settings.Host,
+		Port:     settings.Port,
+		Username: settings.Username,
+		Password: settings.Password,
+		From:     settings.From,
+		Security: settings.Security,
+	}
+}
+
+// smtpSettingsResponse hides the stored password from API responses
+type smtpSettingsResponse struct {
+	models.SMTPSettings
+	PasswordSet bool `json:"password_set"`
+}
+
+// GetSMTPSettings returns the outgoing email settings (admin only)
+func GetSMTPSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings := GetSMTPSettingsFromStore(store)
+		resp := smtpSettingsResponse{SMTPSettings: settings, PasswordSet: settings.Password != ""}
+		resp.Password = ""
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// UpdateSMTPSettings saves the outgoing email settings (admin only).
+// An empty password keeps the stored one.
+func UpdateSMTPSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := GetSMTPSettingsFromStore(store)
+		req := current
+		req.Password = ""
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+		if req.Password == "" {
+			req.Password = current.Password
+		}
+
+		req.Host = strings.TrimSpace(req.Host)
+		req.From = strings.TrimSpace(req.From)
+		req.PublicURL = strings.TrimRight(strings.TrimSpace(req.PublicURL), "/")
+
+		if req.Port < 1 || req.Port > 65535 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Port must be between 1 and 65535", nil)
+			return
+		}
+		switch req.Security {
+		case mailer.SecurityNone, mailer.SecuritySTARTTLS, mailer.SecurityTLS:
+		default:
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid security: must be none, starttls or tls", nil)
+			return
+		}
+		if req.Enabled {
+			if req.Host == "" {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "SMTP host is required", nil)
+				return
+			}
+			if err := mailer.ValidateAddress(req.From); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid sender address", nil)
+				return
+			}
+		}
+		if req.PublicURL != "" {
+			u, err := url.Parse(req.PublicURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Public URL must be an absolute http(s) URL", nil)
+				return
+			}
+		}
+
+		category := string(models.CategoryEmail)
+		store.SetSetting(models.SettingSMTPEnabled, strconv.FormatBool(req.Enabled), "bool", category)
+		store.SetSetting(models.SettingSMTPHost, req.Host, "string", category)
+		store.SetSetting(models.SettingSMTPPort, strconv.Itoa(req.Port), "int", category)
+		store.SetSetting(models.SettingSMTPUsername, req.Username, "string", category)
+		store.SetSetting(models.SettingSMTPPassword, req.Password, "string", category)
+		store.SetSetting(models.SettingSMTPFrom, req.From, "string", category)
+		store.SetSetting(models.SettingSMTPSecurity, req.Security, "string", category)
+		store.SetSetting(models.SettingPublicURL, req.PublicURL, "string", category)
+
+		GetSMTPSettings(store)(w, r)
+	}
+}
+
+// SendTestEmail sends a test message with the saved settings (admin only)
+func SendTestEmail(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			To string `json:"to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+		if err := mailer.ValidateAddress(req.To); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		settings := GetSMTPSettingsFromStore(store)
+		msg := &mailer.Message{
+			To:      []string{req.To},
+			Subject: "FileServ test email",
+			Body:    "This is a test message. Outgoing email is configured correctly.\n",
+		}
+		if err := mailer.Send(mailerConfig(settings), msg); err != nil {
+			apierror.Error(w, "Failed to send email: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Test email sent to " + req.To})
+	}
+}
+
+// sendEmailAsync sends a message in the background if email is enabled
+func sendEmailAsync(store storage.DataStore, msg *mailer.Message) {
+	settings := GetSMTPSettingsFromStore(store)
+	if !settings.Enabled {
+		return
+	}
+	go func() {
+		if err := mailer.Send(mailerConfig(settings), msg); err != nil {
+			log.Printf("Email: failed to send %q to %s: %v", msg.Subject, strings.Join(msg.To, ", "), err)
+		}
+	}()
+}
+
+// shareLinkURL returns the public page address of a share link. The public URL of the email
+// settings is preferred; otherwise the external address of the server is used.
+func shareLinkURL(store storage.DataStore, r *http.Request, token string) string {
+	base := GetSMTPSettingsFromStore(store).PublicURL
+	if base == "" {
+		base = middleware.BaseURL(r)
+	}
+	return base + "/share/?token=" + url.QueryEscape(token)
+}
+
+// withShareLinkURLs fills in the public page address of share links for a response
+func withShareLinkURLs(store storage.DataStore, r *http.Request, links ...*models.ShareLink) {
+	for _, link := range links {
+		key := link.Token
+		if link.Slug != "" {
+			key = link.Slug
+		}
+		link.URL = shareLinkURL(store, r, key)
+	}
+}
+
+// emailShareLink sends a share link to its recipients
+func emailShareLink(store storage.DataStore, r *http.Request, link *models.ShareLink, to []string, message string) error {
+	settings := GetSMTPSettingsFromStore(store)
+	if !settings.Enabled {
+		return errors.New("email is not configured")
+	}
+
+	sender := "Someone"
+	replyTo := ""
+	if userCtx := middleware.GetUserContext(r); userCtx != nil {
+		sender = userCtx.Username
+	}
+	if owner, err := store.GetUserByID(link.OwnerID); err == nil && owner.Email != "" {
+		replyTo = owner.Email
+	}
+
+	var subject string
+	var body strings.Builder
+	if link.IsFileRequest() {
+		subject = fmt.Sprintf("%s is requesting files from you", sender)
+		fmt.Fprintf(&body, "%s has asked you to upload files to \"%s\".\n\n", sender, link.Name)
+	} else {
+		subject = fmt.Sprintf("%s shared \"%s\" with you", sender, link.Name)
+		fmt.Fprintf(&body, "%s has shared \"%s\" with you.\n\n", sender, link.Name)
+	}
+	if message = strings.TrimSpace(message); message != "" {
+		fmt.Fprintf(&body, "%s\n\n", message)
+	}
+	withShareLinkURLs(store, r, link)
+	fmt.Fprintf(&body, "Open the link: %s\n", link.URL)
+	if link.PasswordHash != "" {
+		body.WriteString("\nThe link is password protected. Ask the sender for the password.\n")
+	}
+	if link.ExpiresAt != nil {
+		fmt.Fprintf(&body, "\nThe link expires on %s.\n", link.ExpiresAt.Format("January 2, 2006 15:04 MST"))
+	}
+
+	sendEmailAsync(store, &mailer.Message{
+		To:      to,
+		ReplyTo: replyTo,
+		Subject: subject,
+		Body:    body.String(),
+	})
+	return nil
+}
+
+// notifyShareOwner emails the owner of a share link. Owners without an email address
+// on their account (such as PAM users) only receive the live event.
+func notifyShareOwner(store storage.DataStore, link *models.ShareLink, subject, body string) {
+	owner, err := store.GetUserByID(link.OwnerID)
+	if err != nil || owner.Email == "" {
+		return
+	}
+	sendEmailAsync(store, &mailer.Message{
+		To:      []string{owner.Email},
+		Subject: subject,
+		Body:    body,
+	})
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// defaultEventLogLimit and maxEventLogLimit bound a page of the activity feed
+const (
+	defaultEventLogLimit = 50
+	maxEventLogLimit     = 500
+)
+
+// EventRecorder returns the recorder of the event bus, which writes published events to the
+// event log
+func EventRecorder(store storage.DataStore) func(e *events.Event) {
+	return func(e *events.Event) {
+		entry := &models.EventLogEntry{
+			ID:         e.ID,
+			Type:       e.Type,
+			Actor:      e.Actor,
+			ObjectType: e.ObjectType,
+			ObjectID:   e.ObjectID,
+			Recipients: e.UserIDs,
+			AdminOnly:  e.AdminOnly,
+			CreatedAt:  e.Time,
+		}
+		if e.UserID != "" {
+			entry.Recipients = []string{e.UserID}
+		}
+		if e.Data != nil {
+			payload, err := json.Marshal(e.Data)
+			if err != nil {
+				log.Printf("Event log: failed to encode %s event: %v", e.Type, err)
+			}
+			entry.Payload = payload
+		}
+		if err := store.AddEventLogEntry(entry); err != nil {
+			log.Printf("Event log: failed to record %s event: %v", e.Type, err)
+		}
+	}
+}
+
+// GetEventLogRetentionDaysFromStore returns how many days logged events are kept (0 = forever)
+func GetEventLogRetentionDaysFromStore(store storage.DataStore) int {
+	setting, err := store.GetSetting(models.SettingEventLogRetention)
+	if err != nil || setting == nil {
+		return models.DefaultEventLogRetentionDays
+	}
+	days, err := strconv.Atoi(setting.Value)
+	if err != nil || days < 0 {
+		return models.DefaultEventLogRetentionDays
+	}
+	return days
+}
+
+// pruneEventLog deletes logged events past the retention period and returns how many were deleted
+func pruneEventLog(store storage.DataStore) (int, error) {
+	days := GetEventLogRetentionDaysFromStore(store)
+	if days == 0 {
+		return 0, nil
+	}
+	return store.DeleteEventLogBefore(time.Now().AddDate(0, 0, -days))
+}
+
+// myActivityTypes are the events shown in the activity feed of a user
+var myActivityTypes = []string{
+	events.TypeUploadCompleted,
+	events.TypeFileDownloaded,
+	events.TypeShareLinkCreated,
+	events.TypeShareUploadReceived,
+}
+
+// parseEventLogFilter reads the type, since, until, limit and offset query parameters.
+// Times are RFC 3339.
+func parseEventLogFilter(r *http.Request) (models.EventLogFilter, error) {
+	q := r.URL.Query()
+	filter := models.EventLogFilter{
+		Type:  strings.TrimSpace(q.Get("type")),
+		Limit: defaultEventLogLimit,
+	}
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if s := q.Get(param.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s: use RFC 3339, e.g. 2024-01-02T15:04:05Z", param.name)
+			}
+			*param.value = t
+		}
+	}
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 {
+		filter.Limit = min(n, maxEventLogLimit)
+	}
+	if n, err := strconv.Atoi(q.Get("offset")); err == nil && n > 0 {
+		filter.Offset = n
+	}
+	return filter, nil
+}
+
+// writeEventLogPage responds with a page of logged events
+func writeEventLogPage(w http.ResponseWriter, list []*models.EventLogEntry, total int, filter models.EventLogFilter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": list,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+// ListActivity returns a page of the event log, newest first. Admins see every event and other
+// users the events that were addressed to them.
+func ListActivity(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCtx := middleware.GetUserContext(r)
+		if userCtx == nil {
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+			return
+		}
+
+		filter, err := parseEventLogFilter(r)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		q := r.URL.Query()
+		filter.Actor = strings.TrimSpace(q.Get("actor"))
+		filter.ObjectType = strings.TrimSpace(q.Get("object_type"))
+		filter.ObjectID = strings.TrimSpace(q.Get("object_id"))
+		if !userCtx.IsAdmin {
+			filter.VisibleTo = userCtx.UserID
+		}
+
+		list, total := store.WithContext(r.Context()).ListEventLog(filter)
+		writeEventLogPage(w, list, total, filter)
+	}
+}
+
+// ListMyActivity returns a page of the recent uploads and downloads of the current user, the
+// share links they created and the files received through them, newest first
+func ListMyActivity(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCtx := middleware.GetUserContext(r)
+		if userCtx == nil {
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+			return
+		}
+
+		filter, err := parseEventLogFilter(r)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		filter.Types = myActivityTypes
+		if filter.Type != "" {
+			if !slices.Contains(myActivityTypes, filter.Type) {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "invalid type: must be "+strings.Join(myActivityTypes, ", "), nil)
+				return
+			}
+			filter.Types = []string{filter.Type}
+			filter.Type = ""
+		}
+		filter.Recipient = userCtx.UserID
+
+		list, total := store.WithContext(r.Context()).ListEventLog(filter)
+		writeEventLogPage(w, list, total, filter)
+	}
+}
+
+// GetEventLogSettings returns the event log retention (admin only)
+func GetEventLogSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"retention_days": GetEventLogRetentionDaysFromStore(store),
+		})
+	}
+}
+
+// UpdateEventLogSettings sets how many days logged events are kept, 0 to keep them forever
+// (admin only)
+func UpdateEventLogSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RetentionDays *int `json:"retention_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+		if req.RetentionDays == nil || *req.RetentionDays < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Retention days must be 0 or more", nil)
+			return
+		}
+
+		if err := store.SetSetting(models.SettingEventLogRetention, strconv.Itoa(*req.RetentionDays), "int", string(models.CategoryGeneral)); err != nil {
+			apierror.Error(w, "Failed to save settings", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"retention_days": *req.RetentionDays,
+		})
+	}
+}
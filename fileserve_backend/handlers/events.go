@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// eventsHeartbeatInterval keeps idle event streams alive through proxies
+const eventsHeartbeatInterval = 30 * time.Second
+
+// StreamEvents pushes live events to the client as server-sent events.
+// Admins receive every event; other users only receive events addressed to them.
+func StreamEvents(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// The stream outlives the server write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	sub := events.Default.Subscribe()
+	defer sub.Close()
+
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if !e.VisibleTo(userCtx.UserID, userCtx.IsAdmin) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// publishAction publishes an event for an action of the user making the request, who is
+// recorded as its actor
+func publishAction(r *http.Request, e *events.Event) {
+	if userCtx := middleware.GetUserContext(r); userCtx != nil {
+		e.Actor = userCtx.Username
+	}
+	events.Publish(e)
+}
+
+// publishUploadCompleted notifies the uploader that a file finished uploading
+func publishUploadCompleted(store storage.DataStore, userID, fullPath string, size int64) {
+	data := map[string]interface{}{
+		"name": filepath.Base(fullPath),
+		"size": size,
+	}
+	if zone, root := zoneForPath(store, fullPath); zone != nil {
+		rel, _ := filepath.Rel(root, fullPath)
+		data["zone_id"] = zone.ID
+		data["zone_name"] = zone.Name
+		data["path"] = "/" + filepath.ToSlash(rel)
+	}
+	events.PublishToUser(userID, events.TypeUploadCompleted, data)
+}
+
+// publishFileDownloaded records that a user downloaded a file of a zone; relPath is relative
+// to the zone root, like the path of an upload
+func publishFileDownloaded(userID string, zone *models.ShareZone, relPath string) {
+	events.PublishToUser(userID, events.TypeFileDownloaded, map[string]interface{}{
+		"name":      path.Base(relPath),
+		"zone_id":   zone.ID,
+		"zone_name": zone.Name,
+		"path":      relPath,
+	})
+}
+
+// publishShareAccessed notifies the owner of a share link that it was viewed or downloaded
+func publishShareAccessed(r *http.Request, link *models.ShareLink, action string) {
+	events.PublishToUser(link.OwnerID, events.TypeShareAccessed, map[string]interface{}{
+		"link_id":     link.ID,
+		"name":        link.Name,
+		"target_name": link.TargetName,
+		"action":      action,
+		"ip":          getClientIP(r),
+	})
+}
+
+// publishShareUploadReceived notifies the owner of a share link that a file was uploaded to it
+func publishShareUploadReceived(r *http.Request, link *models.ShareLink, filename string, size int64) {
+	events.PublishToUser(link.OwnerID, events.TypeShareUploadReceived, map[string]interface{}{
+		"link_id":     link.ID,
+		"name":        link.Name,
+		"target_name": link.TargetName,
+		"filename":    filename,
+		"size":        size,
+		"ip":          getClientIP(r),
+	})
+}
+
+// publishMalwareDetected notifies admins that an upload was quarantined
+func publishMalwareDetected(item *models.QuarantineItem) {
+	events.PublishToAdmins(events.TypeMalwareDetected, map[string]interface{}{
+		"quarantine_id": item.ID,
+		"zone_id":       item.ZoneID,
+		"path":          item.OriginalPath,
+		"signature":     item.Signature,
+		"uploaded_by":   item.UploadedByName,
+	})
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/fileops"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Limits on user-defined file metadata
+const (
+	maxFileTags           = 32
+	maxFileTagLength      = 64
+	maxFileDescriptionLen = 4096
+)
+
+// normalizeFileTags trims, lowercases and de-duplicates tags, rejecting ones that cannot be stored
+func normalizeFileTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxFileTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxFileTagLength)
+		}
+		if strings.ContainsAny(tag, ",\n\r\t") {
+			return nil, fmt.Errorf("tag %q contains invalid characters", tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxFileTags {
+		return nil, fmt.Errorf("a file can have at most %d tags", maxFileTags)
+	}
+	return normalized, nil
+}
+
+// attachFileMetadata fills in the tags, description and star flag of the files listed in dir
+func attachFileMetadata(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool, dir string, files []fileops.FileInfo) {
+	if len(files) == 0 {
+		return
+	}
+	root := filepath.Join(pool.Path, zone.Path)
+	paths := make([]string, len(files))
+	for i := range files {
+		paths[i] = usageRelPath(root, filepath.Join(dir, files[i].Name))
+	}
+
+	metadata := store.GetFileMetadataForPaths(zone.ID, paths)
+	if len(metadata) == 0 {
+		return
+	}
+	for i := range files {
+		if meta, ok := metadata[paths[i]]; ok {
+			files[i].Tags = meta.Tags
+			files[i].Description = meta.Description
+			files[i].Starred = meta.Starred
+		}
+	}
+}
+
+// resolveMetadataPath resolves a zone path for the metadata endpoints and returns it along with
+// the zone root, so usageRelPath gives its key in the metadata tables
+func (h *ZoneFileHandler) resolveMetadataPath(w http.ResponseWriter, r *http.Request) (string, string, *models.ShareZone, bool) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return "", "", nil, false
+	}
+
+	fullPath, zone, pool, err := h.resolveZonePathWithPool(chi.URLParam(r, "zoneId"), chi.URLParam(r, "*"), userFromContext(userCtx))
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return "", "", nil, false
+	}
+	if pool.IsS3() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "File metadata is not available on object storage pools", nil)
+		return "", "", nil, false
+	}
+
+	root := filepath.Join(pool.Path, zone.Path)
+	if fullPath == root {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Metadata cannot be set on the zone root", nil)
+		return "", "", nil, false
+	}
+	return fullPath, root, zone, true
+}
+
+// GetZoneFileMetadata returns the tags, description and star flag of a file or folder
+func (h *ZoneFileHandler) GetZoneFileMetadata(w http.ResponseWriter, r *http.Request) {
+	fullPath, root, zone, ok := h.resolveMetadataPath(w, r)
+	if !ok {
+		return
+	}
+	relPath := usageRelPath(root, fullPath)
+	if _, err := os.Stat(fullPath); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		return
+	}
+
+	meta, err := h.store.GetFileMetadata(zone.ID, relPath)
+	if err != nil {
+		meta = &models.FileMetadata{ZoneID: zone.ID, Path: relPath, Tags: []string{}}
+	}
+	meta.Path = "/" + strings.TrimPrefix(chi.URLParam(r, "*"), "/")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meta)
+}
+
+// SetZoneFileMetadata updates the tags, description and star flag of a file or folder. Fields
+// left out of the request keep their current value.
+func (h *ZoneFileHandler) SetZoneFileMetadata(w http.ResponseWriter, r *http.Request) {
+	fullPath, root, zone, ok := h.resolveMetadataPath(w, r)
+	if !ok {
+		return
+	}
+	relPath := usageRelPath(root, fullPath)
+	if zone.ReadOnly {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
+		return
+	}
+	if _, err := os.Stat(fullPath); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		return
+	}
+
+	var req struct {
+		Tags        *[]string `json:"tags"`
+		Description *string   `json:"description"`
+		Starred     *bool     `json:"starred"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	meta, err := h.store.GetFileMetadata(zone.ID, relPath)
+	if err != nil {
+		meta = &models.FileMetadata{ZoneID: zone.ID, Path: relPath, Tags: []string{}}
+	}
+	if req.Tags != nil {
+		tags, err := normalizeFileTags(*req.Tags)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		meta.Tags = tags
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if len(description) > maxFileDescriptionLen {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("description is longer than %d characters", maxFileDescriptionLen), nil)
+			return
+		}
+		meta.Description = description
+	}
+	if req.Starred != nil {
+		meta.Starred = *req.Starred
+	}
+	meta.UpdatedBy = middleware.GetUserContext(r).Username
+
+	if err := h.store.SetFileMetadata(meta); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	meta.Path = "/" + strings.TrimPrefix(chi.URLParam(r, "*"), "/")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meta)
+}
+
+// QueryZoneFileMetadata lists the files in a zone with metadata, optionally filtered by tags
+// (comma separated, all must match), starred=true and a folder path
+func (h *ZoneFileHandler) QueryZoneFileMetadata(w http.ResponseWriter, r *http.Request) {
+	zone, scope, ok := h.zoneScope(w, r)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+
+	q := &models.FileMetadataQuery{
+		ZoneID:  zone.ID,
+		Starred: params.Get("starred") == "true",
+		Limit:   100,
+	}
+	if v := params.Get("tag"); v != "" {
+		tags, err := normalizeFileTags(strings.Split(v, ","))
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		q.Tags = tags
+	}
+	if v := params.Get("limit"); v != "" {
+		if l, err := strconv.Atoi(v); err == nil && l > 0 {
+			q.Limit = min(l, 1000)
+		}
+	}
+
+	prefix := strings.TrimSuffix(scope, "/")
+	q.PathPrefix = prefix + filepath.Clean("/"+params.Get("path"))
+
+	entries := h.store.QueryFileMetadata(q)
+	for _, meta := range entries {
+		meta.Path = strings.TrimPrefix(meta.Path, prefix)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// ListZoneFileTags returns the tags used in the part of a zone visible to the user with the
+// number of files carrying each
+func (h *ZoneFileHandler) ListZoneFileTags(w http.ResponseWriter, r *http.Request) {
+	zone, scope, ok := h.zoneScope(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.ListFileTags(zone.ID, scope))
+}
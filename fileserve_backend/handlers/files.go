@@ -9,6 +9,7 @@ import (
 	"strconv"
 
 	"fileserv/config"
+	"fileserv/internal/apierror"
 	"fileserv/internal/fileops"
 	"fileserv/middleware"
 	"fileserv/models"
@@ -20,10 +21,13 @@ import (
 // userFromContext creates a User object from the request context for permission checking
 func userFromContext(userCtx *middleware.UserContext) *models.User {
 	return &models.User{
-		ID:       userCtx.UserID,
-		Username: userCtx.Username,
-		IsAdmin:  userCtx.IsAdmin,
-		Groups:   userCtx.Groups,
+		ID:         userCtx.UserID,
+		Username:   userCtx.Username,
+		IsAdmin:    userCtx.IsAdmin,
+		Groups:     userCtx.Groups,
+		IsGuest:    userCtx.IsGuest,
+		GuestZones: userCtx.GuestZones,
+		ExpiresAt:  userCtx.ExpiresAt,
 	}
 }
 
@@ -31,7 +35,7 @@ func ListFiles(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userCtx := middleware.GetUserContext(r)
 		if userCtx == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 			return
 		}
 
@@ -46,13 +50,13 @@ func ListFiles(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 		// Check read permission
 		permissions := store.GetPermissions()
 		if !models.HasPermission(permissions, user, path, models.PermissionRead) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 			return
 		}
 
 		files, err := fileops.ListDirectory(cfg.DataDir, path)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -65,7 +69,7 @@ func GetFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userCtx := middleware.GetUserContext(r)
 		if userCtx == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 			return
 		}
 
@@ -80,14 +84,14 @@ func GetFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 		// Check read permission
 		permissions := store.GetPermissions()
 		if !models.HasPermission(permissions, user, path, models.PermissionRead) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 			return
 		}
 
 		// Check if it's a file or directory
 		info, err := fileops.GetFileInfo(cfg.DataDir, path)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, err.Error(), nil)
 			return
 		}
 
@@ -95,7 +99,7 @@ func GetFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 			// List directory
 			files, err := fileops.ListDirectory(cfg.DataDir, path)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 				return
 			}
 
@@ -107,7 +111,7 @@ func GetFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 		// Download file with Range support for resumable downloads
 		fullPath, err := fileops.ValidatePath(cfg.DataDir, path)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -121,9 +125,9 @@ func GetFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 
 		if err := fileops.ServeFileWithRange(w, r, fullPath, opts); err != nil {
 			if os.IsNotExist(err) {
-				http.Error(w, "File not found", http.StatusNotFound)
+				apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			}
 		}
 	}
@@ -133,13 +137,13 @@ func UploadFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userCtx := middleware.GetUserContext(r)
 		if userCtx == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 			return
 		}
 
 		path := chi.URLParam(r, "*")
 		if path == "" {
-			http.Error(w, "Path is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Path is required", nil)
 			return
 		}
 
@@ -149,27 +153,41 @@ func UploadFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 		// Check write permission
 		permissions := store.GetPermissions()
 		if !models.HasPermission(permissions, user, path, models.PermissionWrite) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 			return
 		}
 
-		// Parse multipart form
-		if err := r.ParseMultipartForm(32 << 20); err != nil { // 32 MB max
-			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		if rejectUploadOnBattery(w) {
+			return
+		}
+
+		// Parse multipart form, spooling large files to disk
+		limit := uploadLimit(store, nil, nil)
+		limitRequestBody(w, r, limit)
+		if err := r.ParseMultipartForm(multipartMemory); err != nil {
+			if isBodyTooLarge(err) {
+				writeUploadTooLarge(w, limit)
+				return
+			}
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Failed to parse form", nil)
 			return
 		}
 
 		file, header, err := r.FormFile("file")
 		if err != nil {
-			http.Error(w, "File is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "File is required", nil)
 			return
 		}
 		defer file.Close()
+		if limit > 0 && header.Size > limit {
+			writeUploadTooLarge(w, limit)
+			return
+		}
 
 		// Sanitize filename to prevent injection attacks
 		safeFilename := fileops.SanitizeFilename(header.Filename)
 		if safeFilename == "" {
-			http.Error(w, "Invalid filename", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid filename", nil)
 			return
 		}
 
@@ -181,14 +199,14 @@ func UploadFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 		}
 
 		if err := fileops.SaveFile(cfg.DataDir, filePath, file); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		// Set file ownership - use ValidatePath to get the safe full path
 		fullPath, err := fileops.ValidatePath(cfg.DataDir, filePath)
 		if err != nil {
-			http.Error(w, "Invalid path", http.StatusInternalServerError)
+			apierror.Error(w, "Invalid path", http.StatusInternalServerError)
 			return
 		}
 		if userCtx.Username != "" {
@@ -213,13 +231,13 @@ func DeleteFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userCtx := middleware.GetUserContext(r)
 		if userCtx == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 			return
 		}
 
 		path := chi.URLParam(r, "*")
 		if path == "" {
-			http.Error(w, "Path is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Path is required", nil)
 			return
 		}
 
@@ -229,12 +247,12 @@ func DeleteFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 		// Check delete permission
 		permissions := store.GetPermissions()
 		if !models.HasPermission(permissions, user, path, models.PermissionDelete) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 			return
 		}
 
 		if err := fileops.DeletePath(cfg.DataDir, path); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -246,13 +264,13 @@ func RenameFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userCtx := middleware.GetUserContext(r)
 		if userCtx == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 			return
 		}
 
 		oldPath := chi.URLParam(r, "*")
 		if oldPath == "" {
-			http.Error(w, "Path is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Path is required", nil)
 			return
 		}
 
@@ -260,12 +278,12 @@ func RenameFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 			NewPath string `json:"new_path"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
 			return
 		}
 
 		if req.NewPath == "" {
-			http.Error(w, "New path is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "New path is required", nil)
 			return
 		}
 
@@ -275,16 +293,16 @@ func RenameFile(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 		// Check write permission on both paths
 		permissions := store.GetPermissions()
 		if !models.HasPermission(permissions, user, oldPath, models.PermissionWrite) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 			return
 		}
 		if !models.HasPermission(permissions, user, req.NewPath, models.PermissionWrite) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 			return
 		}
 
 		if err := fileops.MovePath(cfg.DataDir, oldPath, req.NewPath); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -300,13 +318,13 @@ func CreateFolder(store storage.DataStore, cfg *config.Config) http.HandlerFunc
 	return func(w http.ResponseWriter, r *http.Request) {
 		userCtx := middleware.GetUserContext(r)
 		if userCtx == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 			return
 		}
 
 		path := chi.URLParam(r, "*")
 		if path == "" {
-			http.Error(w, "Path is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Path is required", nil)
 			return
 		}
 
@@ -316,12 +334,12 @@ func CreateFolder(store storage.DataStore, cfg *config.Config) http.HandlerFunc
 		// Check write permission
 		permissions := store.GetPermissions()
 		if !models.HasPermission(permissions, user, path, models.PermissionWrite) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 			return
 		}
 
 		if err := fileops.CreateDirectory(cfg.DataDir, path); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -0,0 +1,718 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// firewallMu serializes changes to the host firewall and to the record of the ports the server
+// opened
+var firewallMu sync.Mutex
+
+var (
+	// nftDportRegex matches the destination ports of an nftables rule, a port, a range or a set
+	nftDportRegex = regexp.MustCompile(`\b(tcp|udp) dport (\{[^}]*\}|[0-9-]+)`)
+	// nftHandleRegex matches the handle nft -a prints after each rule
+	nftHandleRegex = regexp.MustCompile(`# handle ([0-9]+)$`)
+)
+
+// firewallBackend opens and closes ports in the host firewall
+type firewallBackend interface {
+	name() string
+	// allowed returns the ports the firewall lets through in a zone
+	allowed(zone string) (firewallView, error)
+	open(zone, service string, p models.FirewallPort) error
+	close(zone, service string, p models.FirewallPort) error
+	// describe adds the zones or rules of the firewall to a status
+	describe(status *models.FirewallStatus)
+}
+
+// firewallView is what a firewall lets through
+type firewallView struct {
+	all   bool // Everything is accepted, e.g. by the policy of the chain
+	ports []models.FirewallPort
+}
+
+// allows reports whether the firewall lets a port through
+func (v firewallView) allows(p models.FirewallPort) bool {
+	if v.all {
+		return true
+	}
+	for _, open := range v.ports {
+		if open.Covers(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectFirewall returns the firewall of the host: firewalld when it runs, otherwise the
+// nftables inet filter table, or nil when neither is in use
+func detectFirewall() firewallBackend {
+	if state, err := firewallCmd("--state"); err == nil && state == "running" {
+		return firewalld{}
+	}
+	if _, err := nftCmd("list", "chain", "inet", "filter", "input"); err == nil {
+		return nftables{}
+	}
+	return nil
+}
+
+// parseFirewallPort parses a port such as 445/tcp or 60000-60100/tcp
+func parseFirewallPort(spec string) (models.FirewallPort, bool) {
+	ports, protocol, ok := strings.Cut(spec, "/")
+	if !ok || (protocol != "tcp" && protocol != "udp") {
+		return models.FirewallPort{}, false
+	}
+	return parsePortRange(ports, protocol)
+}
+
+// parsePortRange parses a port or a range of ports such as 60000-60100
+func parsePortRange(ports, protocol string) (models.FirewallPort, bool) {
+	start, end, isRange := strings.Cut(strings.TrimSpace(ports), "-")
+	p := models.FirewallPort{Protocol: protocol}
+	var err error
+	if p.Port, err = strconv.Atoi(start); err != nil {
+		return p, false
+	}
+	if isRange {
+		if p.EndPort, err = strconv.Atoi(end); err != nil {
+			return p, false
+		}
+	}
+	return p, true
+}
+
+// firewalld manages ports with firewall-cmd, in the runtime and the permanent configuration
+type firewalld struct{}
+
+// firewallCmd runs firewall-cmd and returns its output
+func firewallCmd(args ...string) (string, error) {
+	output, err := exec.Command("sudo", append([]string{"firewall-cmd"}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("firewall-cmd %s failed: %s", args[len(args)-1], commandError(output, err))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (firewalld) name() string { return models.FirewallFirewalld }
+
+func (firewalld) allowed(zone string) (firewallView, error) {
+	var view firewallView
+	if target, err := firewallCmd("--permanent", "--zone="+zone, "--get-target"); err == nil && target == "ACCEPT" {
+		view.all = true
+	}
+	ports, err := firewallCmd("--zone="+zone, "--list-ports")
+	if err != nil {
+		return view, err
+	}
+	for _, spec := range strings.Fields(ports) {
+		if p, ok := parseFirewallPort(spec); ok {
+			view.ports = append(view.ports, p)
+		}
+	}
+
+	// Services such as samba open their ports by name
+	services, err := firewallCmd("--zone="+zone, "--list-services")
+	if err != nil {
+		return view, err
+	}
+	for _, service := range strings.Fields(services) {
+		info, err := firewallCmd("--info-service=" + service)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(info, "\n") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(line), "ports:"); ok {
+				for _, spec := range strings.Fields(value) {
+					if p, ok := parseFirewallPort(spec); ok {
+						view.ports = append(view.ports, p)
+					}
+				}
+			}
+		}
+	}
+	return view, nil
+}
+
+func (firewalld) open(zone, service string, p models.FirewallPort) error {
+	if _, err := firewallCmd("--zone="+zone, "--add-port="+p.String()); err != nil {
+		return err
+	}
+	_, err := firewallCmd("--permanent", "--zone="+zone, "--add-port="+p.String())
+	return err
+}
+
+func (firewalld) close(zone, service string, p models.FirewallPort) error {
+	if _, err := firewallCmd("--zone="+zone, "--remove-port="+p.String()); err != nil {
+		return err
+	}
+	_, err := firewallCmd("--permanent", "--zone="+zone, "--remove-port="+p.String())
+	return err
+}
+
+func (firewalld) describe(status *models.FirewallStatus) {
+	defaultZone, _ := firewallCmd("--get-default-zone")
+	output, err := firewallCmd("--list-all-zones")
+	if err != nil {
+		status.Message = err.Error()
+		return
+	}
+
+	// Zones start with their name; their settings follow as indented "key: value" lines
+	var zone *models.FirewallZone
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			name, flags, _ := strings.Cut(line, " ")
+			status.Zones = append(status.Zones, models.FirewallZone{
+				Name:       name,
+				Active:     strings.Contains(flags, "active"),
+				Default:    name == defaultZone,
+				Interfaces: []string{},
+				Sources:    []string{},
+				Services:   []string{},
+				Ports:      []string{},
+			})
+			zone = &status.Zones[len(status.Zones)-1]
+			continue
+		}
+		if zone == nil {
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimSpace(line), ":")
+		values := strings.Fields(value)
+		switch key {
+		case "target":
+			zone.Target = strings.TrimSpace(value)
+		case "interfaces":
+			zone.Interfaces = values
+		case "sources":
+			zone.Sources = values
+		case "services":
+			zone.Services = values
+		case "ports":
+			zone.Ports = values
+		}
+	}
+}
+
+// nftables manages ports with rules in the input chain of the inet filter table, tagged with a
+// comment naming the service. The rules are not saved: the server opens the ports again when it
+// starts.
+type nftables struct{}
+
+// nftCmd runs nft and returns its output
+func nftCmd(args ...string) (string, error) {
+	output, err := exec.Command("sudo", append([]string{"nft"}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("nft %s failed: %s", args[0], commandError(output, err))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// nftRuleComment tags the rules opened for a service
+func nftRuleComment(service string) string {
+	return `"fileserv:` + service + `"`
+}
+
+func (nftables) name() string { return models.FirewallNftables }
+
+func (nftables) allowed(zone string) (firewallView, error) {
+	var view firewallView
+	output, err := nftCmd("list", "chain", "inet", "filter", "input")
+	if err != nil {
+		return view, err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "hook input") && strings.Contains(line, "policy accept") {
+			view.all = true
+		}
+		if !strings.Contains(line, " accept") {
+			continue
+		}
+		for _, match := range nftDportRegex.FindAllStringSubmatch(line, -1) {
+			for _, ports := range strings.Split(strings.Trim(match[2], "{} "), ",") {
+				if p, ok := parsePortRange(ports, match[1]); ok {
+					view.ports = append(view.ports, p)
+				}
+			}
+		}
+	}
+	return view, nil
+}
+
+// nftPorts returns a port or range as nft writes it
+func nftPorts(p models.FirewallPort) string {
+	if p.EndPort > p.Port {
+		return strconv.Itoa(p.Port) + "-" + strconv.Itoa(p.EndPort)
+	}
+	return strconv.Itoa(p.Port)
+}
+
+func (nftables) open(zone, service string, p models.FirewallPort) error {
+	_, err := nftCmd("insert", "rule", "inet", "filter", "input", p.Protocol, "dport", nftPorts(p), "accept", "comment", nftRuleComment(service))
+	return err
+}
+
+func (nftables) close(zone, service string, p models.FirewallPort) error {
+	output, err := nftCmd("-a", "list", "chain", "inet", "filter", "input")
+	if err != nil {
+		return err
+	}
+	rule := p.Protocol + " dport " + nftPorts(p) + " accept comment " + nftRuleComment(service)
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, rule) {
+			continue
+		}
+		if match := nftHandleRegex.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			if _, err := nftCmd("delete", "rule", "inet", "filter", "input", "handle", match[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (nftables) describe(status *models.FirewallStatus) {
+	output, err := nftCmd("list", "chain", "inet", "filter", "input")
+	if err != nil {
+		status.Message = err.Error()
+		return
+	}
+	status.Rules = []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" && line != "}" && !strings.HasSuffix(line, "{") {
+			status.Rules = append(status.Rules, line)
+		}
+	}
+}
+
+// firewallAutoManage reports whether ports are opened and closed along with the services
+func firewallAutoManage(store storage.DataStore) bool {
+	setting, err := store.GetSetting(models.SettingFirewallAutoManage)
+	return err == nil && setting != nil && setting.Value == "true"
+}
+
+// firewallZone returns the firewalld zone ports are opened in: the configured one, or else the
+// default zone
+func firewallZone(store storage.DataStore, backend firewallBackend) string {
+	if backend.name() != models.FirewallFirewalld {
+		return ""
+	}
+	if setting, err := store.GetSetting(models.SettingFirewallZone); err == nil && setting != nil && setting.Value != "" {
+		return setting.Value
+	}
+	zone, _ := firewallCmd("--get-default-zone")
+	return zone
+}
+
+// managedFirewallPorts returns the ports the server opened, by service
+func managedFirewallPorts(store storage.DataStore) map[string][]models.FirewallPort {
+	managed := make(map[string][]models.FirewallPort)
+	if setting, err := store.GetSetting(models.SettingFirewallManagedPorts); err == nil && setting != nil {
+		json.Unmarshal([]byte(setting.Value), &managed)
+	}
+	return managed
+}
+
+func saveManagedFirewallPorts(store storage.DataStore, managed map[string][]models.FirewallPort) {
+	data, _ := json.Marshal(managed)
+	store.SetSetting(models.SettingFirewallManagedPorts, string(data), "json", string(models.CategorySecurity))
+}
+
+// firewallServices returns the services of the server, the ports they listen on and whether
+// they are needed
+func firewallServices(store storage.DataStore, cfg *config.Config) []models.FirewallService {
+	web := models.FirewallService{Service: "http", DisplayName: "Web interface and API", Ports: []models.FirewallPort{}}
+	for _, l := range cfg.Listeners {
+		if l.Kind == config.ListenUnix {
+			continue
+		}
+		host, port, err := net.SplitHostPort(l.Address)
+		if err != nil {
+			continue
+		}
+		// Listeners only a local reverse proxy can reach need no open port
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			continue
+		}
+		if p, ok := parsePortRange(port, "tcp"); ok {
+			web.Ports = append(web.Ports, p)
+		}
+	}
+	web.Needed = len(web.Ports) > 0
+
+	smb := models.FirewallService{
+		Service:     "smb",
+		DisplayName: "SMB/CIFS",
+		Ports:       []models.FirewallPort{{Port: 445, Protocol: "tcp"}, {Port: 139, Protocol: "tcp"}},
+		Needed:      getSMBStatus().Running,
+	}
+	nfs := models.FirewallService{
+		Service:     "nfs",
+		DisplayName: "NFS",
+		Ports: []models.FirewallPort{
+			{Port: 2049, Protocol: "tcp"},
+			{Port: 111, Protocol: "tcp"}, {Port: 111, Protocol: "udp"}, // rpcbind, for NFSv3
+			{Port: 20048, Protocol: "tcp"}, {Port: 20048, Protocol: "udp"}, // mountd, for NFSv3
+		},
+		Needed: getNFSStatus().Running,
+	}
+
+	sftpSettings := GetSFTPSettingsFromStore(store)
+	sftp := models.FirewallService{
+		Service:     "sftp",
+		DisplayName: "SFTP",
+		Ports:       []models.FirewallPort{{Port: sftpSettings.Port, Protocol: "tcp"}},
+		Needed:      sftpSettings.Enabled,
+	}
+
+	ftpSettings := GetFTPSettingsFromStore(store)
+	ftp := models.FirewallService{
+		Service:     "ftp",
+		DisplayName: "FTP/FTPS",
+		Ports:       []models.FirewallPort{{Port: ftpSettings.Port, Protocol: "tcp"}},
+		Needed:      ftpSettings.Enabled,
+	}
+	if ftpSettings.PassivePortMin > 0 {
+		ftp.Ports = append(ftp.Ports, models.FirewallPort{Port: ftpSettings.PassivePortMin, EndPort: ftpSettings.PassivePortMax, Protocol: "tcp"})
+	}
+
+	return []models.FirewallService{web, smb, nfs, sftp, ftp}
+}
+
+// containsFirewallPort reports whether a list holds a port
+func containsFirewallPort(ports []models.FirewallPort, p models.FirewallPort) bool {
+	for _, port := range ports {
+		if port == p {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncFirewall opens the ports of the services the server needs and closes the ports it opened
+// for services that no longer need them, when automatic management is on. Ports opened by the
+// administrator are never closed.
+func SyncFirewall(store storage.DataStore, cfg *config.Config) error {
+	if !firewallAutoManage(store) {
+		return nil
+	}
+	backend := detectFirewall()
+	if backend == nil {
+		return nil
+	}
+
+	firewallMu.Lock()
+	defer firewallMu.Unlock()
+
+	zone := firewallZone(store, backend)
+	view, err := backend.allowed(zone)
+	if err != nil {
+		return err
+	}
+	services := firewallServices(store, cfg)
+	var needed []models.FirewallPort
+	for _, svc := range services {
+		if svc.Needed {
+			needed = append(needed, svc.Ports...)
+		}
+	}
+
+	managed := managedFirewallPorts(store)
+	var errs []string
+	for _, svc := range services {
+		keep := []models.FirewallPort{}
+		for _, p := range managed[svc.Service] {
+			// A port another service still needs stays open until it does not
+			if (svc.Needed && containsFirewallPort(svc.Ports, p)) || containsFirewallPort(needed, p) {
+				keep = append(keep, p)
+				continue
+			}
+			if err := backend.close(zone, svc.Service, p); err != nil {
+				errs = append(errs, err.Error())
+				keep = append(keep, p)
+				continue
+			}
+			log.Printf("Firewall: closed %s (%s)", p, svc.Service)
+		}
+		if svc.Needed {
+			for _, p := range svc.Ports {
+				if view.allows(p) {
+					continue
+				}
+				if err := backend.open(zone, svc.Service, p); err != nil {
+					errs = append(errs, err.Error())
+					continue
+				}
+				log.Printf("Firewall: opened %s (%s)", p, svc.Service)
+				view.ports = append(view.ports, p)
+				keep = append(keep, p)
+			}
+		}
+		managed[svc.Service] = keep
+	}
+	saveManagedFirewallPorts(store, managed)
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// syncFirewallAfterChange updates the firewall after a service was started, stopped or moved
+// to another port. Failures are logged; the service change itself succeeded.
+func syncFirewallAfterChange(store storage.DataStore, cfg *config.Config) {
+	if err := SyncFirewall(store, cfg); err != nil {
+		log.Printf("Warning: Failed to update the firewall: %v", err)
+	}
+}
+
+// firewallStatus describes the firewall and which ports of the services it lets through
+func firewallStatus(store storage.DataStore, cfg *config.Config) *models.FirewallStatus {
+	status := &models.FirewallStatus{
+		Backend:    models.FirewallNone,
+		AutoManage: firewallAutoManage(store),
+		Services:   firewallServices(store, cfg),
+	}
+	backend := detectFirewall()
+	var view firewallView
+	if backend == nil {
+		// Without a firewall every port is reachable
+		view.all = true
+		status.Message = "No firewall is active: firewalld is not running and nftables has no inet filter input chain"
+	} else {
+		firewallMu.Lock()
+		defer firewallMu.Unlock()
+
+		status.Backend = backend.name()
+		status.Zone = firewallZone(store, backend)
+		backend.describe(status)
+		var err error
+		if view, err = backend.allowed(status.Zone); err != nil {
+			status.Message = err.Error()
+		}
+	}
+
+	managed := managedFirewallPorts(store)
+	for i := range status.Services {
+		svc := &status.Services[i]
+		svc.Open = []models.FirewallPort{}
+		for _, p := range svc.Ports {
+			if view.allows(p) {
+				svc.Open = append(svc.Open, p)
+			}
+		}
+		svc.Managed = managed[svc.Service]
+		if svc.Managed == nil {
+			svc.Managed = []models.FirewallPort{}
+		}
+	}
+	return status
+}
+
+// GetFirewall returns the firewall zones or rules, and the ports the services of the server need
+// and whether they are open (admin only)
+func GetFirewall(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(firewallStatus(store, cfg))
+	}
+}
+
+// UpdateFirewallSettings turns automatic port management on or off and sets the firewalld zone
+// ports are opened in (admin only)
+func UpdateFirewallSettings(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			AutoManage *bool   `json:"auto_manage"`
+			Zone       *string `json:"zone"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if req.Zone != nil {
+			zone := strings.TrimSpace(*req.Zone)
+			backend := detectFirewall()
+			if zone != "" {
+				if backend == nil || backend.name() != models.FirewallFirewalld {
+					apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Zones need firewalld", nil)
+					return
+				}
+				if _, err := firewallCmd("--permanent", "--zone="+zone, "--get-target"); err != nil {
+					apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Unknown firewalld zone", nil)
+					return
+				}
+			}
+			if backend != nil && zone != firewallZone(store, backend) {
+				// Ports opened in the previous zone are closed before moving to the new one
+				firewallMu.Lock()
+				old := firewallZone(store, backend)
+				for service, ports := range managedFirewallPorts(store) {
+					for _, p := range ports {
+						if err := backend.close(old, service, p); err != nil {
+							log.Printf("Warning: Failed to close %s in zone %s: %v", p, old, err)
+						}
+					}
+				}
+				saveManagedFirewallPorts(store, map[string][]models.FirewallPort{})
+				firewallMu.Unlock()
+			}
+			store.SetSetting(models.SettingFirewallZone, zone, "string", string(models.CategorySecurity))
+		}
+		if req.AutoManage != nil {
+			store.SetSetting(models.SettingFirewallAutoManage, strconv.FormatBool(*req.AutoManage), "bool", string(models.CategorySecurity))
+		}
+
+		if err := SyncFirewall(store, cfg); err != nil {
+			apierror.Error(w, "Settings saved but the firewall could not be updated: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(firewallStatus(store, cfg))
+	}
+}
+
+// SyncFirewallPorts opens the ports the services need and closes those no longer needed now
+// (admin only)
+func SyncFirewallPorts(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !firewallAutoManage(store) {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Automatic firewall management is off", nil)
+			return
+		}
+		if err := SyncFirewall(store, cfg); err != nil {
+			apierror.Error(w, "Failed to update the firewall: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(firewallStatus(store, cfg))
+	}
+}
+
+// firewallRequest finds the firewall and the service of a request to open or close ports
+func firewallRequest(w http.ResponseWriter, r *http.Request, store storage.DataStore, cfg *config.Config) (firewallBackend, *models.FirewallService) {
+	backend := detectFirewall()
+	if backend == nil {
+		apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "No firewall is active", nil)
+		return nil, nil
+	}
+	name := chi.URLParam(r, "service")
+	for _, svc := range firewallServices(store, cfg) {
+		if svc.Service == name {
+			return backend, &svc
+		}
+	}
+	apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Unknown service: must be http, smb, nfs, sftp or ftp", nil)
+	return nil, nil
+}
+
+// OpenFirewallService opens the ports of a service (admin only)
+func OpenFirewallService(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		backend, svc := firewallRequest(w, r, store, cfg)
+		if svc == nil {
+			return
+		}
+		if len(svc.Ports) == 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "The service listens on no public port", nil)
+			return
+		}
+
+		firewallMu.Lock()
+		zone := firewallZone(store, backend)
+		view, err := backend.allowed(zone)
+		if err == nil {
+			managed := managedFirewallPorts(store)
+			for _, p := range svc.Ports {
+				if view.allows(p) {
+					continue
+				}
+				if err = backend.open(zone, svc.Service, p); err != nil {
+					break
+				}
+				managed[svc.Service] = append(managed[svc.Service], p)
+			}
+			saveManagedFirewallPorts(store, managed)
+		}
+		firewallMu.Unlock()
+		if err != nil {
+			apierror.Error(w, "Failed to open ports: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(firewallStatus(store, cfg))
+	}
+}
+
+// CloseFirewallService closes the ports of a service (admin only). Ports opened through a
+// firewalld service definition or by hand-written nftables rules stay open and are reported.
+func CloseFirewallService(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		backend, svc := firewallRequest(w, r, store, cfg)
+		if svc == nil {
+			return
+		}
+		if svc.Needed && firewallAutoManage(store) {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "The service is in use and its ports are managed automatically: stop the service or turn automatic management off first", nil)
+			return
+		}
+
+		firewallMu.Lock()
+		zone := firewallZone(store, backend)
+		var err error
+		for _, p := range svc.Ports {
+			if err = backend.close(zone, svc.Service, p); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			managed := managedFirewallPorts(store)
+			delete(managed, svc.Service)
+			saveManagedFirewallPorts(store, managed)
+		}
+		firewallMu.Unlock()
+		if err != nil {
+			apierror.Error(w, "Failed to close ports: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		status := firewallStatus(store, cfg)
+		for _, s := range status.Services {
+			if s.Service == svc.Service && len(s.Open) > 0 {
+				open := make([]string, len(s.Open))
+				for i, p := range s.Open {
+					open[i] = p.String()
+				}
+				status.Message = "Still open through other rules: " + strings.Join(open, ", ")
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
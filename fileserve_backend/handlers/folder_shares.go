@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	osuser "os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// sharedFolderPrefix marks a zone ID that addresses a folder shared with the user.
+// Recipients use the regular zone file endpoints with this ID, so every zone file
+// handler enforces the share's scope and permission.
+const sharedFolderPrefix = "shared-"
+
+// sharedFolderZoneID returns the zone ID recipients use to access a folder share
+func sharedFolderZoneID(shareID string) string {
+	return sharedFolderPrefix + shareID
+}
+
+// isSharedFolderID checks if a zone ID addresses a shared folder
+func isSharedFolderID(zoneID string) bool {
+	return strings.HasPrefix(zoneID, sharedFolderPrefix)
+}
+
+// deleteUserFolderShares removes the folder shares a user owns or was given, when the user is deleted
+func deleteUserFolderShares(store storage.DataStore, user *models.User) error {
+	for _, share := range store.ListFolderShares() {
+		received := share.RecipientType == models.RecipientUser && share.Recipient == user.Username
+		if share.OwnerID != user.ID && !received {
+			continue
+		}
+		if err := store.DeleteFolderShare(share.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSharedFolderRoot checks if a path is the shared folder itself, which recipients cannot delete or move
+func isSharedFolderRoot(zoneID, relativePath string) bool {
+	return isSharedFolderID(zoneID) && filepath.Clean("/"+relativePath) == "/"
+}
+
+// sharedFolderBase resolves a shared folder ID to the owner's zone and the folder's physical path.
+// The returned zone is a copy that is read-only unless the share grants write access.
+func (h *ZoneFileHandler) sharedFolderBase(zoneID string, user *models.User) (*models.ShareZone, *models.StoragePool, string, error) {
+	share, err := h.store.GetFolderShare(strings.TrimPrefix(zoneID, sharedFolderPrefix))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if !share.IsRecipient(user) {
+		return nil, nil, "", os.ErrPermission
+	}
+
+	zone, err := h.store.GetShareZone(share.ZoneID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if !zone.Enabled {
+		return nil, nil, "", os.ErrPermission
+	}
+
+	pool, err := h.store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if !pool.Enabled {
+		return nil, nil, "", os.ErrPermission
+	}
+
+	ownerBase := filepath.Join(pool.Path, zone.Path)
+	if zone.ZoneType == models.ZoneTypePersonal {
+		ownerBase = filepath.Join(ownerBase, share.OwnerName)
+	}
+	basePath := filepath.Join(ownerBase, filepath.Clean("/"+share.Path))
+
+	// The shared folder must still be inside the owner's part of the zone
+	if !pool.IsS3() {
+		resolvedOwner, err := filepath.EvalSymlinks(ownerBase)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		resolvedBase, err := filepath.EvalSymlinks(basePath)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if resolvedBase != resolvedOwner && !strings.HasPrefix(resolvedBase, resolvedOwner+string(filepath.Separator)) {
+			return nil, nil, "", os.ErrPermission
+		}
+	}
+
+	shared := *zone
+	shared.ReadOnly = zone.ReadOnly || !share.CanWrite()
+	shared.AutoProvision = false
+	return &shared, pool, basePath, nil
+}
+
+// FolderShareHandler manages folders shared between internal users
+type FolderShareHandler struct {
+	store storage.DataStore
+	files *ZoneFileHandler
+}
+
+// NewFolderShareHandler creates a new folder share handler
+func NewFolderShareHandler(store storage.DataStore) *FolderShareHandler {
+	return &FolderShareHandler{store: store, files: NewZoneFileHandler(store)}
+}
+
+// SharedFolderInfo describes a folder shared with the current user
+type SharedFolderInfo struct {
+	ShareID    string                       `json:"share_id"`
+	ZoneID     string                       `json:"zone_id"` // Use with the /zones/{zoneId} file endpoints
+	Name       string                       `json:"name"`
+	OwnerName  string                       `json:"owner_name"`
+	ZoneName   string                       `json:"zone_name"`
+	Permission models.FolderSharePermission `json:"permission"`
+	CanUpload  bool                         `json:"can_upload"`
+	SharedAt   time.Time                    `json:"shared_at"`
+}
+
+// ListMyFolderShares returns the folders the current user has shared
+func (h *FolderShareHandler) ListMyFolderShares(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	shares := h.store.ListFolderSharesByOwner(userCtx.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shares)
+}
+
+// CreateFolderShare shares a folder from one of the user's zones with another user or group
+func (h *FolderShareHandler) CreateFolderShare(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	if userCtx.IsGuest {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Guest accounts cannot share folders", nil)
+		return
+	}
+
+	var req struct {
+		ZoneID        string                       `json:"zone_id"`
+		Path          string                       `json:"path"`
+		RecipientType models.FolderShareRecipient  `json:"recipient_type"`
+		Recipient     string                       `json:"recipient"`
+		Permission    models.FolderSharePermission `json:"permission"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	req.Recipient = strings.TrimSpace(req.Recipient)
+	if req.Recipient == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Recipient is required", nil)
+		return
+	}
+	if req.Permission == "" {
+		req.Permission = models.FolderShareRead
+	}
+	if req.Permission != models.FolderShareRead && req.Permission != models.FolderShareReadWrite {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid permission: must be read or read_write", nil)
+		return
+	}
+
+	switch req.RecipientType {
+	case models.RecipientUser:
+		if req.Recipient == userCtx.Username {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot share a folder with yourself", nil)
+			return
+		}
+		if recipient, err := h.store.GetUserByUsername(req.Recipient); err != nil {
+			if _, err := osuser.Lookup(req.Recipient); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "User not found", nil)
+				return
+			}
+		} else if recipient.IsGuest {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Folders cannot be shared with guest accounts", nil)
+			return
+		}
+	case models.RecipientGroup:
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid recipient type: must be user or group", nil)
+		return
+	}
+
+	if isSharedFolderID(req.ZoneID) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Folders shared with you cannot be shared again", nil)
+		return
+	}
+	if !userCtx.CanAccessZone(req.ZoneID) {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		return
+	}
+
+	user := userFromContext(userCtx)
+	fullPath, zone, pool, err := h.files.resolveZonePathWithPool(req.ZoneID, req.Path, user)
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return
+	}
+
+	if !pool.IsS3() {
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFolderNotFound, "Folder not found", nil)
+			return
+		}
+		if !info.IsDir() {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Only folders can be shared", nil)
+			return
+		}
+	}
+
+	// Recipients never get more access than the zone allows
+	if zone.ReadOnly {
+		req.Permission = models.FolderShareRead
+	}
+
+	share, err := h.store.CreateFolderShare(&models.FolderShare{
+		OwnerID:       userCtx.UserID,
+		OwnerName:     userCtx.Username,
+		ZoneID:        zone.ID,
+		Path:          filepath.ToSlash(filepath.Clean("/" + req.Path)),
+		RecipientType: req.RecipientType,
+		Recipient:     req.Recipient,
+		Permission:    req.Permission,
+	})
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(share)
+}
+
+// DeleteFolderShare stops sharing a folder (owner or admin)
+func (h *FolderShareHandler) DeleteFolderShare(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	share, err := h.store.GetFolderShare(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFolderShareNotFound, err.Error(), nil)
+		return
+	}
+	if share.OwnerID != userCtx.UserID && !userCtx.IsAdmin {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
+		return
+	}
+
+	if err := h.store.DeleteFolderShare(share.ID); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Folder share deleted"})
+}
+
+// ListSharedWithMe returns the folders other users have shared with the current user
+func (h *FolderShareHandler) ListSharedWithMe(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	user := userFromContext(userCtx)
+	folders := []SharedFolderInfo{}
+	for _, share := range h.store.ListFolderShares() {
+		if !share.IsRecipient(user) {
+			continue
+		}
+		zoneID := sharedFolderZoneID(share.ID)
+		if !userCtx.CanAccessZone(zoneID) {
+			continue
+		}
+		// Skip shares whose folder or zone is no longer available
+		zone, _, _, err := h.files.sharedFolderBase(zoneID, user)
+		if err != nil {
+			continue
+		}
+
+		name := filepath.Base(share.Path)
+		if share.Path == "/" {
+			name = zone.Name
+		}
+		folders = append(folders, SharedFolderInfo{
+			ShareID:    share.ID,
+			ZoneID:     zoneID,
+			Name:       name,
+			OwnerName:  share.OwnerName,
+			ZoneName:   zone.Name,
+			Permission: share.Permission,
+			CanUpload:  !zone.ReadOnly,
+			SharedAt:   share.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folders)
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	osuser "os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Filesystem quota methods
+const (
+	fsQuotaZFS  = "zfs_userquota"
+	fsQuotaUser = "user_quota"
+)
+
+// fsQuotaTarget is the filesystem that enforces user quotas for a directory
+type fsQuotaTarget struct {
+	Method     string
+	Filesystem string // ZFS dataset or mount point
+	Device     string
+}
+
+// mountForPath returns the mount holding path, i.e. the one with the longest matching mount path
+func mountForPath(mounts []models.MountPoint, path string) *models.MountPoint {
+	var mount *models.MountPoint
+	for i := range mounts {
+		m := &mounts[i]
+		if path == m.MountPath || strings.HasPrefix(path, strings.TrimSuffix(m.MountPath, "/")+"/") {
+			if mount == nil || len(m.MountPath) > len(mount.MountPath) {
+				mount = m
+			}
+		}
+	}
+	return mount
+}
+
+// findFSQuotaTarget finds the filesystem holding path and checks that it can enforce user
+// quotas: ZFS always can, ext4 and XFS need user quotas turned on
+func findFSQuotaTarget(mounts []models.MountPoint, path string) (*fsQuotaTarget, error) {
+	mount := mountForPath(mounts, path)
+	if mount == nil {
+		return nil, fmt.Errorf("no filesystem found for %s", path)
+	}
+
+	switch mount.FSType {
+	case "zfs":
+		return &fsQuotaTarget{Method: fsQuotaZFS, Filesystem: mount.Device, Device: mount.Device}, nil
+	case "ext2", "ext3", "ext4", "xfs":
+		enabled := false
+		for _, opt := range strings.Split(mount.Options, ",") {
+			if opt == "usrquota" || opt == "uquota" || opt == "quota" || strings.HasPrefix(opt, "usrjquota=") {
+				enabled = true
+			}
+		}
+		if !enabled {
+			output, _ := execCommand("quotaon", "-p", mount.MountPath)
+			enabled = strings.Contains(output, "user quota on")
+		}
+		if !enabled {
+			return nil, fmt.Errorf("user quotas are not enabled on %s", mount.MountPath)
+		}
+		return &fsQuotaTarget{Method: fsQuotaUser, Filesystem: mount.MountPath, Device: mount.Device}, nil
+	}
+	return nil, fmt.Errorf("%s filesystems do not support user quotas", mount.FSType)
+}
+
+// readFilesystemUserQuota returns a user's usage and limit on a quota target
+func readFilesystemUserQuota(target *fsQuotaTarget, username string) (used, limit int64, err error) {
+	if target.Method == fsQuotaZFS {
+		output, err := exec.Command("sudo", "zfs", "get", "-Hp", "-o", "value", "userused@"+username+",userquota@"+username, target.Filesystem).CombinedOutput()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read ZFS user quota: %s", commandError(output, err))
+		}
+		values := strings.Fields(string(output))
+		if len(values) != 2 {
+			return 0, 0, fmt.Errorf("unexpected zfs output: %s", strings.TrimSpace(string(output)))
+		}
+		// Unset values are reported as "-" or "none"
+		used, _ = strconv.ParseInt(values[0], 10, 64)
+		limit, _ = strconv.ParseInt(values[1], 10, 64)
+		return used, limit, nil
+	}
+
+	output, err := execCommand("quota", "-u", "-v", "-w", username)
+	if err != nil && output == "" {
+		return 0, 0, fmt.Errorf("failed to read user quota: %v", err)
+	}
+	for _, q := range parseQuotaOutput(output, "user", username) {
+		if q.Filesystem == target.Device || q.Filesystem == target.Filesystem {
+			return int64(q.BlockUsed), int64(q.BlockHard), nil
+		}
+	}
+	return 0, 0, nil
+}
+
+// setFilesystemUserQuota sets a user's hard limit on a quota target (0 removes it)
+func setFilesystemUserQuota(target *fsQuotaTarget, username string, limit int64) error {
+	var cmd *exec.Cmd
+	if target.Method == fsQuotaZFS {
+		value := "none"
+		if limit > 0 {
+			value = strconv.FormatInt(limit, 10)
+		}
+		cmd = exec.Command("sudo", "zfs", "set", fmt.Sprintf("userquota@%s=%s", username, value), target.Filesystem)
+	} else {
+		// setquota takes 1K blocks: soft and inode limits stay unset
+		cmd = exec.Command("setquota", "-u", username, "0", strconv.FormatInt((limit+1023)/1024, 10), "0", "0", target.Filesystem)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set quota: %s", commandError(output, err))
+	}
+	return nil
+}
+
+// filesystemQuotaLimit returns the limit a user gets on a quota target. Filesystem quotas count
+// everything the user owns on the filesystem, so when several zones share one, the user gets
+// the largest of their quotas.
+func filesystemQuotaLimit(store storage.DataStore, mounts []models.MountPoint, target *fsQuotaTarget) int64 {
+	var limit int64
+	pools := make(map[string]*models.StoragePool)
+	for _, zone := range store.ListShareZones() {
+		pool, ok := pools[zone.PoolID]
+		if !ok {
+			pool, _ = store.GetStoragePool(zone.PoolID)
+			pools[zone.PoolID] = pool
+		}
+		if pool == nil || pool.IsS3() {
+			continue
+		}
+		quota := zoneUserQuota(zone, pool)
+		if quota <= limit {
+			continue
+		}
+		if t, err := findFSQuotaTarget(mounts, filepath.Join(pool.Path, zone.Path)); err == nil && t.Filesystem == target.Filesystem {
+			limit = quota
+		}
+	}
+	return limit
+}
+
+// zoneFilesystemQuota reports, and with apply sets, the filesystem limit backing a user's quota
+// in a zone. It returns nil for zones without a per-user quota and for object storage pools.
+func zoneFilesystemQuota(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool, username string, apply bool) *models.ZoneFilesystemQuota {
+	if pool.IsS3() || zoneUserQuota(zone, pool) <= 0 {
+		return nil
+	}
+
+	status := &models.ZoneFilesystemQuota{}
+	if _, err := osuser.Lookup(username); err != nil {
+		status.Error = fmt.Sprintf("%s is not a system user", username)
+		return status
+	}
+	mounts, err := getMountPoints()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	target, err := findFSQuotaTarget(mounts, filepath.Join(pool.Path, zone.Path))
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Method = target.Method
+	status.Filesystem = target.Filesystem
+
+	want := filesystemQuotaLimit(store, mounts, target)
+	used, limit, err := readFilesystemUserQuota(target, username)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	if apply && limit != want {
+		if err := setFilesystemUserQuota(target, username, want); err != nil {
+			status.Error = err.Error()
+		} else {
+			limit = want
+		}
+	}
+
+	status.UsedBytes = used
+	status.Limit = limit
+	// Block quotas round up to whole kilobytes
+	status.Applied = limit >= want && limit-want < 1024
+	return status
+}
+
+// zoneQuotaAccounts returns the users with a quota account in a zone: the user directories of
+// a personal zone, or the users with charged usage in other zones
+func zoneQuotaAccounts(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool) []string {
+	seen := make(map[string]bool)
+	if zone.ZoneType == models.ZoneTypePersonal && !pool.IsS3() {
+		entries, _ := os.ReadDir(filepath.Join(pool.Path, zone.Path))
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				seen[entry.Name()] = true
+			}
+		}
+	}
+	for _, usage := range store.ListZoneUserUsage(zone.ID) {
+		seen[usage.Username] = true
+	}
+
+	accounts := make([]string, 0, len(seen))
+	for account := range seen {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// GetZoneUserQuotas returns the quota, usage and filesystem limit of every user in a zone
+func (h *ZoneHandler) GetZoneUserQuotas(w http.ResponseWriter, r *http.Request) {
+	zone, err := h.store.GetShareZone(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+	pool, err := h.store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		apierror.Error(w, "Pool not found", http.StatusInternalServerError)
+		return
+	}
+
+	root := filepath.Join(pool.Path, zone.Path)
+	quota := zoneUserQuota(zone, pool)
+	infos := []models.ZoneQuotaInfo{}
+	for _, account := range zoneQuotaAccounts(h.store, zone, pool) {
+		info := models.ZoneQuotaInfo{
+			ZoneID:    zone.ID,
+			Username:  account,
+			Quota:     quota,
+			Available: -1,
+			Enforced:  !pool.IsS3(),
+		}
+		if info.Enforced {
+			info.UsedBytes = zoneQuotaUsage(h.store, zone, root, account)
+		}
+		if info.Quota > 0 {
+			info.Available = max(info.Quota-info.UsedBytes, 0)
+		}
+		info.Filesystem = zoneFilesystemQuota(h.store, zone, pool, account, false)
+		infos = append(infos, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
+
+// ApplyZoneQuotas sets the filesystem limits of every user in a zone to match the zone's
+// per-user quota, e.g. after the quota was changed
+func (h *ZoneHandler) ApplyZoneQuotas(w http.ResponseWriter, r *http.Request) {
+	zone, err := h.store.GetShareZone(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+	pool, err := h.store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		apierror.Error(w, "Pool not found", http.StatusInternalServerError)
+		return
+	}
+	if pool.IsS3() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Quotas are not enforced on object storage pools", nil)
+		return
+	}
+	if zoneUserQuota(zone, pool) <= 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Zone has no per-user quota", nil)
+		return
+	}
+
+	results := make(map[string]*models.ZoneFilesystemQuota)
+	for _, account := range zoneQuotaAccounts(h.store, zone, pool) {
+		results[account] = zoneFilesystemQuota(h.store, zone, pool, account, true)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
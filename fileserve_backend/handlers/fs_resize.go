@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+)
+
+// fsResizeMinGrowth is the smallest growth worth a resize; smaller differences are alignment
+// slack between the filesystem and the device
+const fsResizeMinGrowth = 1024 * 1024
+
+var (
+	ext4BlockCountRegex = regexp.MustCompile(`(?m)^Block count:\s+(\d+)`)
+	ext4BlockSizeRegex  = regexp.MustCompile(`(?m)^Block size:\s+(\d+)`)
+	xfsDataRegex        = regexp.MustCompile(`(?m)^data\s+=\s+bsize=(\d+)\s+blocks=(\d+)`)
+	btrfsDevidRegex     = regexp.MustCompile(`devid\s+(\d+)\s+size\s+(\d+)\s+used\s+\d+\s+path\s+(\S+)`)
+)
+
+// FilesystemResizePlan describes how a filesystem is grown to fill its device
+type FilesystemResizePlan struct {
+	Device           string   `json:"device"`
+	FSType           string   `json:"fstype"`
+	MountPoint       string   `json:"mountpoint,omitempty"`
+	Mode             string   `json:"mode"` // online (mounted) or offline
+	CurrentSize      uint64   `json:"current_size"`
+	CurrentSizeHuman string   `json:"current_size_human"`
+	DeviceSize       uint64   `json:"device_size"`
+	DeviceSizeHuman  string   `json:"device_size_human"`
+	GrowBy           uint64   `json:"grow_by"`
+	GrowByHuman      string   `json:"grow_by_human"`
+	Commands         []string `json:"commands"` // Commands the resize runs, in order
+	DryRun           bool     `json:"dry_run"`
+
+	steps [][]string
+}
+
+// planFilesystemGrow inspects a device and its filesystem and works out the resize steps
+func planFilesystemGrow(device string) (*FilesystemResizePlan, error) {
+	output, err := exec.Command("lsblk", "-J", "-b", "-d", "-o", "PATH,FSTYPE,SIZE,MOUNTPOINT", device).Output()
+	if err != nil {
+		return nil, fmt.Errorf("device %s not found", device)
+	}
+	var lsblkOutput struct {
+		BlockDevices []struct {
+			FSType     string      `json:"fstype"`
+			Size       interface{} `json:"size"` // Can be string or int
+			MountPoint string      `json:"mountpoint"`
+		} `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(output, &lsblkOutput); err != nil || len(lsblkOutput.BlockDevices) != 1 {
+		return nil, fmt.Errorf("failed to read device info for %s", device)
+	}
+	dev := lsblkOutput.BlockDevices[0]
+
+	plan := &FilesystemResizePlan{
+		Device:     device,
+		FSType:     dev.FSType,
+		MountPoint: dev.MountPoint,
+		Mode:       "offline",
+	}
+	switch v := dev.Size.(type) {
+	case float64:
+		plan.DeviceSize = uint64(v)
+	case string:
+		plan.DeviceSize, _ = strconv.ParseUint(v, 10, 64)
+	}
+	if plan.MountPoint != "" {
+		plan.Mode = "online"
+	}
+
+	switch plan.FSType {
+	case "ext2", "ext3", "ext4":
+		output, err := exec.Command("dumpe2fs", "-h", device).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read filesystem: %s", commandError(output, err))
+		}
+		blocks := ext4BlockCountRegex.FindStringSubmatch(string(output))
+		blockSize := ext4BlockSizeRegex.FindStringSubmatch(string(output))
+		if blocks == nil || blockSize == nil {
+			return nil, fmt.Errorf("failed to read the size of the filesystem on %s", device)
+		}
+		count, _ := strconv.ParseUint(blocks[1], 10, 64)
+		size, _ := strconv.ParseUint(blockSize[1], 10, 64)
+		plan.CurrentSize = count * size
+		if plan.Mode == "offline" {
+			// resize2fs refuses to grow an unmounted filesystem that was not just checked
+			plan.steps = append(plan.steps, []string{"e2fsck", "-f", "-p", device})
+		}
+		plan.steps = append(plan.steps, []string{"resize2fs", device})
+
+	case "xfs":
+		if plan.Mode == "offline" {
+			return nil, fmt.Errorf("XFS can only be grown while mounted: mount %s first", device)
+		}
+		output, err := exec.Command("xfs_info", plan.MountPoint).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read filesystem: %s", commandError(output, err))
+		}
+		match := xfsDataRegex.FindStringSubmatch(string(output))
+		if match == nil {
+			return nil, fmt.Errorf("failed to read the size of the filesystem on %s", device)
+		}
+		blockSize, _ := strconv.ParseUint(match[1], 10, 64)
+		blocks, _ := strconv.ParseUint(match[2], 10, 64)
+		plan.CurrentSize = blocks * blockSize
+		plan.steps = append(plan.steps, []string{"xfs_growfs", plan.MountPoint})
+
+	case "btrfs":
+		if plan.Mode == "offline" {
+			return nil, fmt.Errorf("btrfs can only be grown while mounted: mount %s first", device)
+		}
+		output, err := exec.Command("btrfs", "filesystem", "show", "--raw", plan.MountPoint).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read filesystem: %s", commandError(output, err))
+		}
+		devid := ""
+		for _, match := range btrfsDevidRegex.FindAllStringSubmatch(string(output), -1) {
+			if match[3] == device {
+				devid = match[1]
+				plan.CurrentSize, _ = strconv.ParseUint(match[2], 10, 64)
+				break
+			}
+		}
+		if devid == "" {
+			return nil, fmt.Errorf("%s is not listed as a device of the btrfs filesystem at %s", device, plan.MountPoint)
+		}
+		plan.steps = append(plan.steps, []string{"btrfs", "filesystem", "resize", devid + ":max", plan.MountPoint})
+
+	case "":
+		return nil, fmt.Errorf("%s has no filesystem", device)
+	default:
+		return nil, fmt.Errorf("growing %s filesystems is not supported. Supported: ext4, xfs, btrfs", plan.FSType)
+	}
+
+	if plan.DeviceSize > plan.CurrentSize {
+		plan.GrowBy = plan.DeviceSize - plan.CurrentSize
+	}
+	plan.CurrentSizeHuman = formatBytes(plan.CurrentSize)
+	plan.DeviceSizeHuman = formatBytes(plan.DeviceSize)
+	plan.GrowByHuman = formatBytes(plan.GrowBy)
+	for _, step := range plan.steps {
+		plan.Commands = append(plan.Commands, strings.Join(step, " "))
+	}
+	return plan, nil
+}
+
+// growFilesystem runs the resize steps of a plan
+func growFilesystem(plan *FilesystemResizePlan) error {
+	for _, step := range plan.steps {
+		output, err := exec.Command(step[0], step[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s failed: %s", step[0], commandError(output, err))
+		}
+	}
+	return nil
+}
+
+// GrowFilesystem grows an ext4, xfs or btrfs filesystem to fill its partition or logical
+// volume after that was expanded. With dry_run it only reports the sizes and the commands.
+func GrowFilesystem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Device string `json:"device"`
+			DryRun bool   `json:"dry_run"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateDevicePath(req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if !strings.HasPrefix(req.Device, "/dev/") {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Device must be a /dev path", nil)
+			return
+		}
+
+		plan, err := planFilesystemGrow(req.Device)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		plan.DryRun = req.DryRun
+
+		if !req.DryRun {
+			if plan.GrowBy < fsResizeMinGrowth {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("The filesystem on %s already fills the device (%s)", req.Device, plan.DeviceSizeHuman), nil)
+				return
+			}
+			if err := growFilesystem(plan); err != nil {
+				apierror.Error(w, "Failed to grow filesystem: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(plan)
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/internal/ftpd"
+	"fileserv/internal/vfs"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// FTPService runs the optional FTP/FTPS server for legacy devices such as scanners.
+// Logins and the zone layout are the same as for SFTP.
+type FTPService struct {
+	store storage.DataStore
+	cfg   *config.Config
+
+	mu         sync.Mutex
+	server     *ftpd.Server
+	applied    models.FTPSettings // Settings of the last start
+	tlsEnabled bool
+	lastError  string
+}
+
+// NewFTPService creates a new FTP service
+func NewFTPService(store storage.DataStore, cfg *config.Config) *FTPService {
+	return &FTPService{store: store, cfg: cfg}
+}
+
+// GetFTPSettingsFromStore returns the FTP server settings
+func GetFTPSettingsFromStore(store storage.DataStore) models.FTPSettings {
+	settings := models.FTPSettings{
+		Port:           models.DefaultFTPPort,
+		PassivePortMin: models.DefaultFTPPassivePortMin,
+		PassivePortMax: models.DefaultFTPPassivePortMax,
+	}
+	intSetting := func(key string, value *int) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil {
+			if v, err := strconv.Atoi(setting.Value); err == nil && v > 0 {
+				*value = v
+			}
+		}
+	}
+	if setting, err := store.GetSetting(models.SettingFTPEnabled); err == nil && setting != nil {
+		settings.Enabled = setting.Value == "true"
+	}
+	if setting, err := store.GetSetting(models.SettingFTPRequireTLS); err == nil && setting != nil {
+		settings.RequireTLS = setting.Value == "true"
+	}
+	if setting, err := store.GetSetting(models.SettingFTPPublicHost); err == nil && setting != nil {
+		settings.PublicHost = setting.Value
+	}
+	intSetting(models.SettingFTPPort, &settings.Port)
+	intSetting(models.SettingFTPPassivePortMin, &settings.PassivePortMin)
+	intSetting(models.SettingFTPPassivePortMax, &settings.PassivePortMax)
+	return settings
+}
+
+// Start starts the FTP server if it is enabled in the settings
+func (s *FTPService) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start()
+}
+
+// Stop stops the FTP server and disconnects all clients
+func (s *FTPService) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+}
+
+// Reload restarts the FTP server with the current settings
+func (s *FTPService) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restart()
+}
+
+// ReloadIfChanged restarts the FTP server only when its settings differ from those it was
+// started with, so connected clients are not dropped for nothing
+func (s *FTPService) ReloadIfChanged() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if GetFTPSettingsFromStore(s.store) != s.applied {
+		return s.restart()
+	}
+	if s.lastError != "" {
+		return errors.New(s.lastError)
+	}
+	return nil
+}
+
+func (s *FTPService) restart() error {
+	s.stop()
+	s.start()
+	if s.lastError != "" {
+		return errors.New(s.lastError)
+	}
+	return nil
+}
+
+func (s *FTPService) start() {
+	s.lastError = ""
+	settings := GetFTPSettingsFromStore(s.store)
+	s.applied = settings
+	if !settings.Enabled {
+		return
+	}
+
+	serverConfig := ftpd.Config{
+		RequireTLS:     settings.RequireTLS,
+		PassivePortMin: settings.PassivePortMin,
+		PassivePortMax: settings.PassivePortMax,
+		PublicHost:     settings.PublicHost,
+	}
+
+	// FTPS uses the web server's certificate
+	s.tlsEnabled = false
+	if s.cfg.TLSCert != "" && s.cfg.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(s.cfg.TLSCert, s.cfg.TLSKey)
+		if err != nil {
+			log.Printf("FTP: cannot load TLS certificate, FTPS disabled: %v", err)
+		} else {
+			serverConfig.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+			s.tlsEnabled = true
+		}
+	}
+	if settings.RequireTLS && serverConfig.TLS == nil {
+		s.lastError = "TLS is required but no TLS certificate is configured"
+		log.Printf("FTP: %s", s.lastError)
+		return
+	}
+
+	server := ftpd.NewServer(serverConfig, s.authenticate)
+	if err := server.Listen(fmt.Sprintf(":%d", settings.Port)); err != nil {
+		s.lastError = fmt.Sprintf("failed to listen on port %d: %v", settings.Port, err)
+		log.Printf("FTP: %s", s.lastError)
+		return
+	}
+
+	s.server = server
+	log.Printf("FTP server listening on port %d (passive ports %d-%d, TLS %v)",
+		settings.Port, settings.PassivePortMin, settings.PassivePortMax, s.tlsEnabled)
+}
+
+func (s *FTPService) stop() {
+	if s.server == nil {
+		return
+	}
+	s.server.Close()
+	s.server = nil
+	log.Println("FTP server stopped")
+}
+
+// authenticate checks a login with the same brute-force protection as the web login
+func (s *FTPService) authenticate(username, password, remoteIP string) (vfs.FileSystem, error) {
+	userCtx, err := authenticateProtocolLogin(s.store, s.cfg, "FTP", username, password, remoteIP)
+	if err != nil {
+		return nil, err
+	}
+	return newZoneFS(s.store, userCtx), nil
+}
+
+// GetSettings returns the FTP settings and server status (admin only)
+func (s *FTPService) GetSettings(w http.ResponseWriter, r *http.Request) {
+	settings := GetFTPSettingsFromStore(s.store)
+
+	s.mu.Lock()
+	status := map[string]interface{}{
+		"settings":    settings,
+		"running":     s.server != nil,
+		"tls_enabled": s.tlsEnabled,
+		"error":       s.lastError,
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// UpdateSettings saves the FTP settings and restarts the server (admin only)
+func (s *FTPService) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	req := GetFTPSettingsFromStore(s.store)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	validPort := func(port int) bool { return port >= 1 && port <= 65535 }
+	if !validPort(req.Port) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Port must be between 1 and 65535", nil)
+		return
+	}
+	if req.Port == s.cfg.Port || req.Port == GetSFTPSettingsFromStore(s.store).Port {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Port is already used by another service", nil)
+		return
+	}
+	if !validPort(req.PassivePortMin) || !validPort(req.PassivePortMax) || req.PassivePortMin > req.PassivePortMax {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid passive port range", nil)
+		return
+	}
+	if req.Port >= req.PassivePortMin && req.Port <= req.PassivePortMax {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Passive port range must not include the control port", nil)
+		return
+	}
+	req.PublicHost = strings.TrimSpace(req.PublicHost)
+
+	category := string(models.CategoryAccess)
+	s.store.SetSetting(models.SettingFTPEnabled, strconv.FormatBool(req.Enabled), "bool", category)
+	s.store.SetSetting(models.SettingFTPPort, strconv.Itoa(req.Port), "int", category)
+	s.store.SetSetting(models.SettingFTPPassivePortMin, strconv.Itoa(req.PassivePortMin), "int", category)
+	s.store.SetSetting(models.SettingFTPPassivePortMax, strconv.Itoa(req.PassivePortMax), "int", category)
+	s.store.SetSetting(models.SettingFTPRequireTLS, strconv.FormatBool(req.RequireTLS), "bool", category)
+	s.store.SetSetting(models.SettingFTPPublicHost, req.PublicHost, "string", category)
+
+	err := s.Reload()
+	syncFirewallAfterChange(s.store, s.cfg)
+	if err != nil {
+		apierror.Error(w, "Settings saved but the FTP server failed to start: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.GetSettings(w, r)
+}
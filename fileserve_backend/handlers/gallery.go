@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/exif"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// galleryImageExtensions are the image types shown in the photo gallery
+var galleryImageExtensions = map[string]bool{
+	"jpg":  true,
+	"jpeg": true,
+	"png":  true,
+	"gif":  true,
+	"tif":  true,
+	"tiff": true,
+}
+
+// readImageMetadata returns the EXIF details of an image, falling back to the decoded image
+// header for the dimensions
+func readImageMetadata(fullPath string) *models.ImageMetadata {
+	m := &models.ImageMetadata{}
+
+	data, err := exif.DecodeFile(fullPath)
+	if err == nil {
+		m.DateTaken = data.DateTaken
+		m.CameraMake = data.Make
+		m.CameraModel = data.Model
+		m.Lens = data.Lens
+		m.Width = data.Width
+		m.Height = data.Height
+		m.Orientation = data.Orientation
+		m.ExposureTime = data.ExposureTime
+		m.FNumber = data.FNumber
+		m.ISO = data.ISO
+		m.FocalLength = data.FocalLength
+		m.Latitude = data.Latitude
+		m.Longitude = data.Longitude
+		m.Altitude = data.Altitude
+	} else if !errors.Is(err, exif.ErrNoExif) {
+		log.Printf("Gallery: failed to read EXIF of %s: %v", fullPath, err)
+	}
+
+	if m.Width == 0 || m.Height == 0 {
+		if f, err := os.Open(fullPath); err == nil {
+			if cfg, _, err := image.DecodeConfig(f); err == nil {
+				m.Width, m.Height = cfg.Width, cfg.Height
+			}
+			f.Close()
+		}
+	}
+	return m
+}
+
+// updateImageMetadata records the EXIF details of an image unless they are already up to date
+func updateImageMetadata(store storage.DataStore, zoneID, root, fullPath string, info os.FileInfo) {
+	if !info.Mode().IsRegular() {
+		return
+	}
+	if !galleryImageExtensions[strings.ToLower(strings.TrimPrefix(filepath.Ext(info.Name()), "."))] {
+		return
+	}
+
+	relPath := usageRelPath(root, fullPath)
+	if m, err := store.GetImageMetadata(zoneID, relPath); err == nil &&
+		m.Size == info.Size() && m.ModTime.Unix() == info.ModTime().Unix() {
+		return
+	}
+
+	m := readImageMetadata(fullPath)
+	m.ZoneID = zoneID
+	m.Path = relPath
+	m.Size = info.Size()
+	m.ModTime = info.ModTime()
+	m.IndexedAt = time.Now()
+	if err := store.UpsertImageMetadata(m); err != nil {
+		log.Printf("Gallery: failed to store details of %s: %v", fullPath, err)
+	}
+}
+
+// ListZoneGallery returns the images of a zone newest first, by date taken (or modification time
+// for images without one), optionally limited to a folder and a from/to date range
+func (h *ZoneFileHandler) ListZoneGallery(w http.ResponseWriter, r *http.Request) {
+	zone, scope, ok := h.zoneScope(w, r)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+
+	prefix := strings.TrimSuffix(scope, "/")
+	q := &models.GalleryQuery{
+		ZoneID:     zone.ID,
+		PathPrefix: prefix + filepath.Clean("/"+params.Get("path")),
+		Limit:      100,
+	}
+	if v := params.Get("from"); v != "" {
+		t, err := parseSearchTime(v)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid from (use RFC3339 or YYYY-MM-DD)", nil)
+			return
+		}
+		q.From = &t
+	}
+	if v := params.Get("to"); v != "" {
+		t, err := parseSearchTime(v)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid to (use RFC3339 or YYYY-MM-DD)", nil)
+			return
+		}
+		q.To = &t
+	}
+	if v := params.Get("limit"); v != "" {
+		if l, err := strconv.Atoi(v); err == nil && l > 0 {
+			q.Limit = min(l, 1000)
+		}
+	}
+	if v := params.Get("offset"); v != "" {
+		if o, err := strconv.Atoi(v); err == nil && o >= 0 {
+			q.Offset = o
+		}
+	}
+
+	images, total, err := h.store.ListGalleryImages(q)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, m := range images {
+		m.Path = strings.TrimPrefix(m.Path, prefix)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.GalleryResult{
+		Images:  images,
+		Total:   total,
+		Limit:   q.Limit,
+		Offset:  q.Offset,
+		HasMore: q.Offset+len(images) < total,
+	})
+}
+
+// GetZoneGalleryTimeline returns the number of images per year, month (default) or day
+func (h *ZoneFileHandler) GetZoneGalleryTimeline(w http.ResponseWriter, r *http.Request) {
+	zone, scope, ok := h.zoneScope(w, r)
+	if !ok {
+		return
+	}
+
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		group = "month"
+	}
+	if group != "year" && group != "month" && group != "day" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid group (must be year, month or day)", nil)
+		return
+	}
+
+	prefix := strings.TrimSuffix(scope, "/")
+	buckets, err := h.store.WithContext(r.Context()).GalleryTimeline(zone.ID, prefix+filepath.Clean("/"+r.URL.Query().Get("path")), group)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, b := range buckets {
+		b.Cover = strings.TrimPrefix(b.Cover, prefix)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buckets)
+}
+
+// GetZoneImageExif returns the EXIF details of an image, reading them if they are not yet known
+func (h *ZoneFileHandler) GetZoneImageExif(w http.ResponseWriter, r *http.Request) {
+	fullPath, root, zone, ok := h.resolveMetadataPath(w, r)
+	if !ok {
+		return
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		return
+	}
+	if info.IsDir() || !galleryImageExtensions[strings.ToLower(strings.TrimPrefix(filepath.Ext(info.Name()), "."))] {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a supported image", nil)
+		return
+	}
+
+	updateImageMetadata(h.store, zone.ID, root, fullPath, info)
+	m, err := h.store.GetImageMetadata(zone.ID, usageRelPath(root, fullPath))
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	m.Path = "/" + strings.TrimPrefix(chi.URLParam(r, "*"), "/")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
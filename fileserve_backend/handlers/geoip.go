@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/geoip"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// errGeoIPNotConfigured is returned when country restrictions are used without a GeoIP database
+var errGeoIPNotConfigured = errors.New("GeoIP database is not configured")
+
+// geoIPCache keeps the loaded GeoIP database, reloading it when the path or the file changes
+var geoIPCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	db      *geoip.Database
+	err     error
+}
+
+// GetGeoIPSettingsFromStore returns the GeoIP settings
+func GetGeoIPSettingsFromStore(store storage.DataStore) models.GeoIPSettings {
+	var settings models.GeoIPSettings
+	if setting, err := store.GetSetting(models.SettingGeoIPDatabase); err == nil && setting != nil {
+		settings.DatabasePath = setting.Value
+	}
+	return settings
+}
+
+// loadGeoIPDatabase returns the configured GeoIP database
+func loadGeoIPDatabase(store storage.DataStore) (*geoip.Database, error) {
+	path := GetGeoIPSettingsFromStore(store).DatabasePath
+	if path == "" {
+		return nil, errGeoIPNotConfigured
+	}
+	return openGeoIPDatabase(path)
+}
+
+// openGeoIPDatabase loads a GeoIP database file, reusing the cached one while the file is unchanged
+func openGeoIPDatabase(path string) (*geoip.Database, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	geoIPCache.Lock()
+	defer geoIPCache.Unlock()
+	if geoIPCache.path == path && geoIPCache.modTime.Equal(info.ModTime()) {
+		return geoIPCache.db, geoIPCache.err
+	}
+
+	db, err := geoip.Open(path)
+	geoIPCache.path = path
+	geoIPCache.modTime = info.ModTime()
+	geoIPCache.db = db
+	geoIPCache.err = err
+	return db, err
+}
+
+// clientCountry returns the country of a client IP, or "" if it is unknown
+func clientCountry(db *geoip.Database, ip string) string {
+	addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+	if err != nil {
+		return ""
+	}
+	return db.Country(addr)
+}
+
+// geoIPResponse reports whether the configured database could be loaded
+type geoIPResponse struct {
+	models.GeoIPSettings
+	Loaded bool   `json:"loaded"`
+	Ranges int    `json:"ranges"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GetGeoIPSettings returns the GeoIP settings and the state of the database (admin only)
+func GetGeoIPSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := geoIPResponse{GeoIPSettings: GetGeoIPSettingsFromStore(store)}
+		if resp.DatabasePath != "" {
+			db, err := openGeoIPDatabase(resp.DatabasePath)
+			if err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Loaded = true
+				resp.Ranges = db.Len()
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// UpdateGeoIPSettings sets the GeoIP database path (admin only). The database must load.
+func UpdateGeoIPSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.GeoIPSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		req.DatabasePath = strings.TrimSpace(req.DatabasePath)
+		if req.DatabasePath != "" {
+			if _, err := openGeoIPDatabase(req.DatabasePath); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot load GeoIP database: "+err.Error(), nil)
+				return
+			}
+		}
+
+		store.SetSetting(models.SettingGeoIPDatabase, req.DatabasePath, "string", string(models.CategorySecurity))
+
+		GetGeoIPSettings(store)(w, r)
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	osuser "os/user"
+	"strings"
+	"time"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxGuestLifetime bounds how far in the future a guest account may expire
+const maxGuestLifetime = 365 * 24 * time.Hour
+
+// GuestHandler manages guest accounts: temporary logins limited to a few zones, created by
+// admins or by the owners of those zones for external collaborators
+type GuestHandler struct {
+	store storage.DataStore
+	cfg   *config.Config
+}
+
+// NewGuestHandler creates a new guest handler
+func NewGuestHandler(store storage.DataStore, cfg *config.Config) *GuestHandler {
+	return &GuestHandler{store: store, cfg: cfg}
+}
+
+// CreateGuestRequest is the request body for inviting a guest
+type CreateGuestRequest struct {
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	Email     string    `json:"email"`
+	Zones     []string  `json:"zones"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UpdateGuestRequest is the request body for changing a guest account
+type UpdateGuestRequest struct {
+	Password  *string    `json:"password,omitempty"`
+	Email     *string    `json:"email,omitempty"`
+	Zones     *[]string  `json:"zones,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ValidateGuest resolves a guest session to a user context (implements middleware.GuestValidator)
+func (h *GuestHandler) ValidateGuest(userID string) (*middleware.UserContext, error) {
+	user, err := h.store.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsGuest {
+		return nil, errors.New("not a guest account")
+	}
+	return guestUserContext(user)
+}
+
+// inviter returns the user managing guests, rejecting guests and API tokens
+func (h *GuestHandler) inviter(w http.ResponseWriter, r *http.Request) *middleware.UserContext {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return nil
+	}
+	if userCtx.IsGuest || userCtx.IsAPIToken() {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		return nil
+	}
+	return userCtx
+}
+
+// checkZones verifies that the inviter may grant guests access to every zone
+func (h *GuestHandler) checkZones(userCtx *middleware.UserContext, zoneIDs []string) (int, string, error) {
+	if len(zoneIDs) == 0 {
+		return http.StatusBadRequest, apierror.CodeFieldRequired, errors.New("At least one zone is required")
+	}
+
+	user := userFromContext(userCtx)
+	for _, zoneID := range zoneIDs {
+		zone, err := h.store.GetShareZone(zoneID)
+		if err != nil {
+			return http.StatusBadRequest, apierror.CodeZoneNotFound, errors.New("Zone not found: " + zoneID)
+		}
+		if !userCtx.IsAdmin && !zone.IsOwner(user) {
+			return http.StatusForbidden, apierror.CodeForbidden, errors.New("Only admins and owners of a zone can invite guests to it: " + zone.Name)
+		}
+	}
+	return 0, "", nil
+}
+
+// checkGuestExpiry verifies that a guest expiry is in the future and within maxGuestLifetime
+func checkGuestExpiry(expiresAt time.Time) error {
+	if expiresAt.IsZero() {
+		return errors.New("expires_at is required")
+	}
+	if !expiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	if expiresAt.After(time.Now().Add(maxGuestLifetime)) {
+		return errors.New("Guest accounts cannot last more than a year")
+	}
+	return nil
+}
+
+// managedGuest loads a guest the current user may manage (admins manage every guest,
+// others the guests they invited)
+func (h *GuestHandler) managedGuest(w http.ResponseWriter, userCtx *middleware.UserContext, id string) *models.User {
+	guest, err := h.store.GetUserByID(id)
+	if err != nil || !guest.IsGuest {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeGuestNotFound, "Guest not found", nil)
+		return nil
+	}
+	if !userCtx.IsAdmin && guest.InvitedBy != userCtx.Username {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeGuestNotFound, "Guest not found", nil)
+		return nil
+	}
+	return guest
+}
+
+// ListGuests returns the guests the current user manages
+func (h *GuestHandler) ListGuests(w http.ResponseWriter, r *http.Request) {
+	userCtx := h.inviter(w, r)
+	if userCtx == nil {
+		return
+	}
+
+	guests := []models.SafeUser{}
+	for _, user := range h.store.ListUsers() {
+		if !user.IsGuest || (!userCtx.IsAdmin && user.InvitedBy != userCtx.Username) {
+			continue
+		}
+		guests = append(guests, user.Safe())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(guests)
+}
+
+// CreateGuest invites a guest to one or more zones until an expiry date
+func (h *GuestHandler) CreateGuest(w http.ResponseWriter, r *http.Request) {
+	userCtx := h.inviter(w, r)
+	if userCtx == nil {
+		return
+	}
+
+	var req CreateGuestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || req.Password == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username and password are required", nil)
+		return
+	}
+	if err := validatePasswordComplexity(GetPasswordPolicyFromStore(h.store), req.Password); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	if err := checkGuestExpiry(req.ExpiresAt); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	if status, code, err := h.checkZones(userCtx, req.Zones); err != nil {
+		apierror.Write(w, status, code, err.Error(), nil)
+		return
+	}
+
+	// A guest must not shadow a system account when users log in through PAM
+	if h.cfg.UsePAM {
+		if _, err := osuser.Lookup(req.Username); err == nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeAlreadyExists, "username already exists", nil)
+			return
+		}
+	}
+
+	guest, err := h.store.CreateGuestUser(req.Username, req.Password, req.Email, userCtx.Username, req.Zones, req.ExpiresAt)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	log.Printf("Guest %s invited by %s to %d zone(s) until %s", guest.Username, userCtx.Username, len(req.Zones), req.ExpiresAt.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(guest.Safe())
+}
+
+// UpdateGuest changes a guest's password, email, zones or expiry
+func (h *GuestHandler) UpdateGuest(w http.ResponseWriter, r *http.Request) {
+	userCtx := h.inviter(w, r)
+	if userCtx == nil {
+		return
+	}
+	guest := h.managedGuest(w, userCtx, chi.URLParam(r, "id"))
+	if guest == nil {
+		return
+	}
+
+	var req UpdateGuestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Password != nil {
+		if err := validatePasswordComplexity(GetPasswordPolicyFromStore(h.store), *req.Password); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		updates["password"] = *req.Password
+	}
+	if req.Email != nil {
+		updates["email"] = *req.Email
+	}
+	if req.Zones != nil {
+		if status, code, err := h.checkZones(userCtx, *req.Zones); err != nil {
+			apierror.Write(w, status, code, err.Error(), nil)
+			return
+		}
+		updates["guest_zones"] = *req.Zones
+	}
+	if req.ExpiresAt != nil {
+		if err := checkGuestExpiry(*req.ExpiresAt); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		updates["expires_at"] = *req.ExpiresAt
+	}
+
+	updated, err := h.store.UpdateUser(guest.ID, updates)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated.Safe())
+}
+
+// DeleteGuest removes a guest account, ending its sessions and the folder shares it was given
+func (h *GuestHandler) DeleteGuest(w http.ResponseWriter, r *http.Request) {
+	userCtx := h.inviter(w, r)
+	if userCtx == nil {
+		return
+	}
+	guest := h.managedGuest(w, userCtx, chi.URLParam(r, "id"))
+	if guest == nil {
+		return
+	}
+
+	err := h.store.WithTx(func(tx storage.DataStore) error {
+		if err := deleteUserFolderShares(tx, guest); err != nil {
+			return err
+		}
+		return tx.DeleteUser(guest.ID)
+	})
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Guest %s removed by %s", guest.Username, userCtx.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/middleware"
+	"fileserv/models"
+)
+
+// defaultHomeLimit and maxHomeLimit bound the recent and starred lists
+const (
+	defaultHomeLimit = 50
+	maxHomeLimit     = 200
+)
+
+// homeZone is a zone on the home screen of a user, with the part of it the user sees
+type homeZone struct {
+	zone  *models.ShareZone
+	root  string // Zone root on disk
+	scope string // Visible part, relative to the root ("/" or "/alice" in a personal zone)
+}
+
+// homeZones returns the zones a user can access, by ID. Zones on object storage are left out
+// as they have no file metadata.
+func (h *ZoneFileHandler) homeZones(userCtx *middleware.UserContext) map[string]*homeZone {
+	user := userFromContext(userCtx)
+	pools := make(map[string]*models.StoragePool)
+	for _, pool := range h.store.ListStoragePools() {
+		pools[pool.ID] = pool
+	}
+
+	zones := make(map[string]*homeZone)
+	for _, zone := range h.store.ListShareZones() {
+		if !zone.UserHasZoneAccess(user) || !userCtx.CanAccessZone(zone.ID) {
+			continue
+		}
+		pool, ok := pools[zone.PoolID]
+		if !ok || !pool.Enabled || pool.IsS3() {
+			continue
+		}
+		hz := &homeZone{zone: zone, root: filepath.Join(pool.Path, zone.Path), scope: "/"}
+		if zone.ZoneType == models.ZoneTypePersonal {
+			hz.scope = "/" + user.Username
+		}
+		zones[zone.ID] = hz
+	}
+	return zones
+}
+
+// file returns the home screen entry of a path relative to the zone root, or nil when the user
+// cannot see it or it no longer exists
+func (hz *homeZone) file(relPath string) *models.HomeFile {
+	prefix := strings.TrimSuffix(hz.scope, "/")
+	if prefix != "" && relPath != prefix && !strings.HasPrefix(relPath, prefix+"/") {
+		return nil
+	}
+	info, err := os.Stat(filepath.Join(hz.root, filepath.FromSlash(relPath)))
+	if err != nil {
+		return nil
+	}
+	return &models.HomeFile{
+		ZoneID:   hz.zone.ID,
+		ZoneName: hz.zone.Name,
+		Path:     "/" + strings.TrimPrefix(strings.TrimPrefix(relPath, prefix), "/"),
+		Name:     info.Name(),
+		IsDir:    info.IsDir(),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+	}
+}
+
+// homeLimit reads the limit query parameter
+func homeLimit(r *http.Request) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		return min(n, maxHomeLimit)
+	}
+	return defaultHomeLimit
+}
+
+// ListRecentFiles returns the files the current user recently uploaded or downloaded and the
+// files recently modified in their zones, most recent first
+func (h *ZoneFileHandler) ListRecentFiles(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+	limit := homeLimit(r)
+	store := h.store.WithContext(r.Context())
+	zones := h.homeZones(userCtx)
+
+	type key struct{ zoneID, path string }
+	recent := make(map[key]*models.HomeFile)
+	add := func(hz *homeZone, relPath, activity string, at time.Time) {
+		k := key{hz.zone.ID, relPath}
+		if f, ok := recent[k]; ok {
+			if at.After(f.Time) {
+				f.Time, f.Activity = at, activity
+			}
+			return
+		}
+		if f := hz.file(relPath); f != nil {
+			f.Time, f.Activity = at, activity
+			recent[k] = f
+		}
+	}
+
+	// Files the user uploaded or downloaded
+	logged, _ := store.ListEventLog(models.EventLogFilter{
+		Types:     []string{events.TypeUploadCompleted, events.TypeFileDownloaded},
+		Recipient: userCtx.UserID,
+		Limit:     limit * 2,
+	})
+	for _, entry := range logged {
+		var payload struct {
+			ZoneID string `json:"zone_id"`
+			Path   string `json:"path"`
+		}
+		if json.Unmarshal(entry.Payload, &payload) != nil {
+			continue
+		}
+		hz, ok := zones[payload.ZoneID]
+		if !ok {
+			continue
+		}
+		activity := "downloaded"
+		if entry.Type == events.TypeUploadCompleted {
+			activity = "uploaded"
+		}
+		add(hz, payload.Path, activity, entry.CreatedAt)
+	}
+
+	// Files modified in the zones of the user, from the search index
+	for _, hz := range zones {
+		entries, _, err := store.SearchFileIndex(&models.FileSearchQuery{
+			ZoneID:     hz.zone.ID,
+			PathPrefix: hz.scope,
+			Type:       "file",
+			SortBy:     "modified",
+			SortDesc:   true,
+			Limit:      limit,
+		})
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			add(hz, entry.Path, "modified", entry.ModTime)
+		}
+	}
+
+	files := make([]*models.HomeFile, 0, len(recent))
+	for _, f := range recent {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Time.After(files[j].Time) })
+	if len(files) > limit {
+		files = files[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// ListStarredFiles returns the starred files and folders in the zones of the current user,
+// most recently starred first
+func (h *ZoneFileHandler) ListStarredFiles(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+	limit := homeLimit(r)
+	store := h.store.WithContext(r.Context())
+
+	files := []*models.HomeFile{}
+	for _, hz := range h.homeZones(userCtx) {
+		for _, meta := range store.QueryFileMetadata(&models.FileMetadataQuery{
+			ZoneID:     hz.zone.ID,
+			PathPrefix: hz.scope,
+			Starred:    true,
+			Limit:      limit,
+		}) {
+			if f := hz.file(meta.Path); f != nil {
+				f.Time = meta.UpdatedAt
+				files = append(files, f)
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Time.After(files[j].Time) })
+	if len(files) > limit {
+		files = files[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/internal/auth"
+	"fileserv/internal/events"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// impersonationTokenDuration is how long an admin may act as another user with one token
+const impersonationTokenDuration = 30 * time.Minute
+
+// ImpersonateUser issues a short-lived token acting as another user, so admins can reproduce
+// permission problems without the user's password (admin only). Admins cannot be impersonated.
+func ImpersonateUser(store storage.DataStore, cfg *config.Config, jwtSecret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin := middleware.GetUserContext(r)
+		if admin == nil {
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+			return
+		}
+		if admin.IsAPIToken() || admin.IsImpersonated() {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Impersonation requires an admin login session", nil)
+			return
+		}
+
+		target, err := userContextByID(store, cfg, chi.URLParam(r, "userId"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", nil)
+			return
+		}
+		if target.IsAdmin {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Admins cannot be impersonated", nil)
+			return
+		}
+
+		expiresAt := time.Now().Add(impersonationTokenDuration)
+		if target.ExpiresAt != nil && target.ExpiresAt.Before(expiresAt) {
+			expiresAt = *target.ExpiresAt
+		}
+		session := newSession(r, target, expiresAt)
+		session.ImpersonatedBy = admin.Username
+		token, err := auth.GenerateImpersonationToken(session.ID, target.UserID, target.Username, target.Groups, target.IsGuest,
+			admin.Username, jwtSecret, time.Until(expiresAt))
+		if err != nil {
+			apierror.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		session.Token = token
+		if err := store.CreateSession(session); err != nil {
+			apierror.Error(w, "Failed to create session", http.StatusInternalServerError)
+			return
+		}
+
+		clientIP := getClientIP(r)
+		log.Printf("Impersonation: admin %s started acting as %s from IP %s until %s",
+			admin.Username, target.Username, clientIP, expiresAt.Format(time.RFC3339))
+		recordSecurityEvent(store, &models.SecurityEvent{
+			Type:    models.SecurityEventPrivilegeEscalation,
+			Source:  "admin",
+			Actor:   admin.Username,
+			Target:  target.Username,
+			IP:      clientIP,
+			Message: fmt.Sprintf("Started impersonating %s until %s", target.Username, expiresAt.Format(time.RFC3339)),
+		})
+		events.PublishToAdmins(events.TypeImpersonation, map[string]interface{}{
+			"admin":      admin.Username,
+			"username":   target.Username,
+			"ip":         clientIP,
+			"expires_at": expiresAt,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":           token,
+			"expires_at":      expiresAt.Unix(),
+			"impersonated_by": admin.Username,
+			"user": UserResponse{
+				ID:       target.UserID,
+				Username: target.Username,
+				IsAdmin:  false,
+				Groups:   target.Groups,
+				IsGuest:  target.IsGuest,
+			},
+		})
+	}
+}
+
+// recordImpersonationEnded records that an impersonation session was signed out or revoked
+// before it expired. Sessions of other users are ignored.
+func recordImpersonationEnded(store storage.DataStore, session *models.Session) {
+	if session.ImpersonatedBy == "" || session.IsExpired() {
+		return
+	}
+	log.Printf("Impersonation: admin %s stopped acting as %s", session.ImpersonatedBy, session.Username)
+	recordSecurityEvent(store, &models.SecurityEvent{
+		Type:    models.SecurityEventPrivilegeEscalation,
+		Source:  "admin",
+		Actor:   session.ImpersonatedBy,
+		Target:  session.Username,
+		IP:      session.IP,
+		Message: "Stopped impersonating " + session.Username,
+	})
+}
@@ -11,13 +11,16 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+
+	"fileserv/internal/apierror"
 )
 
 // StreamEvent represents a server-sent event
 type StreamEvent struct {
-	Type    string `json:"type"`    // "output", "error", "complete"
-	Message string `json:"message"`
-	Success bool   `json:"success,omitempty"`
+	Type     string  `json:"type"` // "output", "error", "progress", "complete"
+	Message  string  `json:"message"`
+	Success  bool    `json:"success,omitempty"`
+	Progress float64 `json:"progress,omitempty"` // Percent done, on progress events
 }
 
 // sendSSE sends a server-sent event
@@ -124,7 +127,7 @@ func InstallSharingServiceStream() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		service := r.URL.Query().Get("service")
 		if service != "smb" && service != "nfs" {
-			http.Error(w, "Invalid service. Use 'smb' or 'nfs'", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid service. Use 'smb' or 'nfs'", nil)
 			return
 		}
 
@@ -0,0 +1,576 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// integrityCheckInterval is how often every zone file is re-read and verified
+	integrityCheckInterval = 7 * 24 * time.Hour
+	// integrityPollInterval is how often the checker looks whether a verification run is due
+	integrityPollInterval = 1 * time.Hour
+	// zfsSuperMagic is the statfs type of ZFS, which checksums and repairs data itself
+	zfsSuperMagic = 0x2fc12fc1
+)
+
+// errFileChanged is returned when a file is modified while it is being hashed
+var errFileChanged = errors.New("file changed while hashing")
+
+// IntegrityChecker periodically re-reads zone files and compares them with the checksums
+// recorded when they were written, to detect silent corruption on filesystems without
+// their own data checksums
+type IntegrityChecker struct {
+	store    storage.DataStore
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	status   models.IntegrityStatus
+	trigger  chan struct{}
+}
+
+// NewIntegrityChecker creates a new integrity checker
+func NewIntegrityChecker(store storage.DataStore) *IntegrityChecker {
+	return &IntegrityChecker{
+		store:    store,
+		stopChan: make(chan struct{}),
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Start begins the integrity checker background goroutine
+func (ic *IntegrityChecker) Start() {
+	ic.mu.Lock()
+	if ic.running {
+		ic.mu.Unlock()
+		return
+	}
+	ic.running = true
+	ic.stopChan = make(chan struct{})
+	ic.mu.Unlock()
+
+	ic.wg.Add(1)
+	go ic.run()
+	log.Println("Integrity checker started")
+}
+
+// Stop stops the integrity checker
+func (ic *IntegrityChecker) Stop() {
+	ic.mu.Lock()
+	if !ic.running {
+		ic.mu.Unlock()
+		return
+	}
+	ic.running = false
+	close(ic.stopChan)
+	ic.mu.Unlock()
+
+	ic.wg.Wait()
+	log.Println("Integrity checker stopped")
+}
+
+// run is the main integrity checker loop
+func (ic *IntegrityChecker) run() {
+	defer ic.wg.Done()
+
+	ticker := time.NewTicker(integrityPollInterval)
+	defer ticker.Stop()
+
+	if ic.due() {
+		ic.verifyAllZones()
+	}
+
+	for {
+		select {
+		case <-ic.stopChan:
+			return
+		case <-ticker.C:
+			if ic.due() {
+				ic.verifyAllZones()
+			}
+		case <-ic.trigger:
+			ic.verifyAllZones()
+		}
+	}
+}
+
+// Verify queues a verification run of all zones
+func (ic *IntegrityChecker) Verify() bool {
+	ic.mu.Lock()
+	busy := ic.status.Running
+	ic.mu.Unlock()
+	if busy {
+		return false
+	}
+
+	select {
+	case ic.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// lastRun returns when the last complete verification run started
+func (ic *IntegrityChecker) lastRun() time.Time {
+	setting, err := ic.store.GetSetting(models.SettingIntegrityLastRun)
+	if err != nil || setting == nil {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339, setting.Value)
+	return t
+}
+
+// due reports whether a scheduled verification run should start
+func (ic *IntegrityChecker) due() bool {
+	return time.Since(ic.lastRun()) >= integrityCheckInterval
+}
+
+// verifyAllZones verifies every enabled zone on local storage
+func (ic *IntegrityChecker) verifyAllZones() {
+	ic.mu.Lock()
+	if ic.status.Running {
+		ic.mu.Unlock()
+		return
+	}
+	ic.status.Running = true
+	ic.mu.Unlock()
+
+	started := time.Now()
+	var verified, hashed int
+	var skipped []string
+	var lastErr error
+	stopped := false
+
+	for _, zone := range ic.store.ListShareZones() {
+		select {
+		case <-ic.stopChan:
+			stopped = true
+		default:
+		}
+		if stopped {
+			break
+		}
+		if !zone.Enabled {
+			continue
+		}
+		pool, err := ic.store.GetStoragePool(zone.PoolID)
+		if err != nil || !pool.Enabled || pool.IsS3() {
+			continue
+		}
+
+		root := filepath.Join(pool.Path, zone.Path)
+		if isZFSPath(root) {
+			skipped = append(skipped, zone.Name)
+			continue
+		}
+
+		v, h, err := verifyZoneChecksums(ic.store, zone, root, ic.stopChan)
+		verified += v
+		hashed += h
+		if err != nil {
+			lastErr = fmt.Errorf("zone %s: %w", zone.Name, err)
+			log.Printf("Integrity checker: failed to verify zone %s: %v", zone.Name, err)
+		}
+	}
+
+	if !stopped {
+		ic.store.SetSetting(models.SettingIntegrityLastRun, started.Format(time.RFC3339), "string", string(models.CategoryStorage))
+		log.Printf("Integrity checker: verified %d files, hashed %d new or modified files in %s",
+			verified, hashed, time.Since(started).Round(time.Second))
+	}
+
+	ic.mu.Lock()
+	ic.status.Running = false
+	if !stopped {
+		ic.status.FilesVerified = verified
+		ic.status.FilesHashed = hashed
+		ic.status.SkippedZones = skipped
+		ic.status.LastError = ""
+		if lastErr != nil {
+			ic.status.LastError = lastErr.Error()
+		}
+	}
+	ic.mu.Unlock()
+}
+
+// GetStatus returns the state of the integrity checker
+func (ic *IntegrityChecker) GetStatus() models.IntegrityStatus {
+	ic.mu.Lock()
+	status := ic.status
+	ic.mu.Unlock()
+
+	if last := ic.lastRun(); !last.IsZero() {
+		next := last.Add(integrityCheckInterval)
+		status.LastRun = &last
+		status.NextRun = &next
+	}
+	status.Mismatches = len(ic.store.ListFileChecksumMismatches())
+	return status
+}
+
+// verifyZoneChecksums walks a zone, verifying files whose checksum is current and hashing
+// new or modified files, then drops checksums of files that no longer exist
+func verifyZoneChecksums(store storage.DataStore, zone *models.ShareZone, root string, stop <-chan struct{}) (verified, hashed int, err error) {
+	scanStart := time.Now().Truncate(time.Second)
+	stopped := false
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Skip inaccessible files/directories
+			return nil
+		}
+		select {
+		case <-stop:
+			stopped = true
+			return filepath.SkipAll
+		default:
+		}
+		if info.IsDir() {
+			if isReservedZonePath(root, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath := usageRelPath(root, path)
+		c, err := store.GetFileChecksum(zone.ID, relPath)
+		if err != nil || !checksumCurrent(c, info) {
+			if recordFileChecksum(store, zone.ID, relPath, path) == nil {
+				hashed++
+			}
+			return nil
+		}
+		if verifyFileChecksum(store, zone, c, path) == nil {
+			verified++
+		}
+		return nil
+	})
+	if err != nil || stopped {
+		return verified, hashed, err
+	}
+
+	return verified, hashed, store.PruneFileChecksums(zone.ID, scanStart)
+}
+
+// checksumCurrent reports whether a recorded checksum belongs to the current version of a file.
+// Files changed since they were hashed have a different size or modification time.
+func checksumCurrent(c *models.FileChecksum, info os.FileInfo) bool {
+	return c.Size == info.Size() && c.ModTime.Equal(info.ModTime())
+}
+
+// verifyFileChecksum re-reads a file and flags it when its content no longer matches its checksum
+func verifyFileChecksum(store storage.DataStore, zone *models.ShareZone, c *models.FileChecksum, fullPath string) error {
+	sum, info, err := hashFile(fullPath)
+	if err != nil {
+		return err
+	}
+	if !checksumCurrent(c, info) {
+		// Rewritten since the walk saw it
+		return recordFileChecksum(store, zone.ID, c.Path, fullPath)
+	}
+
+	now := time.Now()
+	c.VerifiedAt = now
+	if sum == c.SHA256 {
+		c.Status = models.ChecksumStatusOK
+		c.ActualSHA256 = ""
+		c.DetectedAt = nil
+		return store.UpsertFileChecksum(c)
+	}
+
+	newlyDetected := c.Status != models.ChecksumStatusMismatch || c.ActualSHA256 != sum
+	c.Status = models.ChecksumStatusMismatch
+	c.ActualSHA256 = sum
+	if newlyDetected {
+		c.DetectedAt = &now
+	}
+	if err := store.UpsertFileChecksum(c); err != nil {
+		return err
+	}
+
+	if newlyDetected {
+		log.Printf("Integrity checker: %s in zone %s does not match its checksum (expected %s, got %s)",
+			c.Path, zone.Name, c.SHA256, sum)
+		events.PublishToAdmins(events.TypeStorageAlert, checksumMismatchAlert(zone.Name, c))
+	}
+	return nil
+}
+
+// checksumMismatchAlert describes a file that failed verification as a storage alert
+func checksumMismatchAlert(zoneName string, c *models.FileChecksum) models.StorageAlert {
+	alert := models.StorageAlert{
+		Level:     "critical",
+		Type:      "checksum_mismatch",
+		Message:   fmt.Sprintf("File %s in zone %s failed integrity verification", c.Path, zoneName),
+		Resource:  zoneName + ":" + c.Path,
+		Timestamp: time.Now(),
+	}
+	if c.DetectedAt != nil {
+		alert.Timestamp = *c.DetectedAt
+	}
+	return alert
+}
+
+// integrityAlerts returns a storage alert for every file currently failing verification
+func integrityAlerts(store storage.DataStore) []models.StorageAlert {
+	zoneNames := make(map[string]string)
+	for _, zone := range store.ListShareZones() {
+		zoneNames[zone.ID] = zone.Name
+	}
+
+	alerts := []models.StorageAlert{}
+	for _, c := range store.ListFileChecksumMismatches() {
+		alerts = append(alerts, checksumMismatchAlert(zoneNames[c.ZoneID], c))
+	}
+	return alerts
+}
+
+// recordFileChecksum hashes a file and stores the result as its known-good checksum
+func recordFileChecksum(store storage.DataStore, zoneID, relPath, fullPath string) error {
+	sum, info, err := hashFile(fullPath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return store.UpsertFileChecksum(&models.FileChecksum{
+		ZoneID:     zoneID,
+		Path:       relPath,
+		SHA256:     sum,
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		ComputedAt: now,
+		VerifiedAt: now,
+		Status:     models.ChecksumStatusOK,
+	})
+}
+
+// updateFileChecksum records the checksum of a file written through the server, unless the
+// recorded one is still current (e.g. after a rename). Folders are picked up by the next
+// verification run.
+func updateFileChecksum(store storage.DataStore, zoneID, root, fullPath string, info os.FileInfo) {
+	if !info.Mode().IsRegular() || isZFSPath(fullPath) {
+		return
+	}
+	relPath := usageRelPath(root, fullPath)
+	if c, err := store.GetFileChecksum(zoneID, relPath); err == nil && checksumCurrent(c, info) {
+		return
+	}
+	if err := recordFileChecksum(store, zoneID, relPath, fullPath); err != nil && !errors.Is(err, errFileChanged) {
+		log.Printf("Integrity: failed to hash %s: %v", fullPath, err)
+	}
+}
+
+// hashFile returns the SHA-256 of a file along with the file info it belongs to
+func hashFile(fullPath string) (string, os.FileInfo, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	before, err := f.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", nil, err
+	}
+	after, err := f.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	if !checksumCurrent(&models.FileChecksum{Size: before.Size(), ModTime: before.ModTime()}, after) {
+		return "", nil, errFileChanged
+	}
+	return hex.EncodeToString(h.Sum(nil)), after, nil
+}
+
+// isZFSPath reports whether a path is on ZFS, where the filesystem detects and repairs bit rot itself
+func isZFSPath(path string) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return false
+	}
+	return uint32(stat.Type) == zfsSuperMagic
+}
+
+// IntegrityHandler handles the admin integrity endpoints
+type IntegrityHandler struct {
+	store   storage.DataStore
+	checker *IntegrityChecker
+}
+
+// NewIntegrityHandler creates a new integrity handler
+func NewIntegrityHandler(store storage.DataStore, checker *IntegrityChecker) *IntegrityHandler {
+	return &IntegrityHandler{store: store, checker: checker}
+}
+
+// GetIntegrityReport returns the checker status and every file that failed verification
+func (h *IntegrityHandler) GetIntegrityReport(w http.ResponseWriter, r *http.Request) {
+	report := models.IntegrityReport{
+		Status:     h.checker.GetStatus(),
+		Mismatches: h.store.ListFileChecksumMismatches(),
+	}
+	for _, c := range report.Mismatches {
+		if zone, err := h.store.GetShareZone(c.ZoneID); err == nil {
+			c.ZoneName = zone.Name
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// RunIntegrityCheck starts a verification run of all zones
+func (h *IntegrityHandler) RunIntegrityCheck(w http.ResponseWriter, r *http.Request) {
+	if !h.checker.Verify() {
+		apierror.Write(w, http.StatusConflict, apierror.CodeBusy, "A verification run is already in progress", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Verification started",
+	})
+}
+
+// AcceptChecksum records the current content of a flagged file as correct, e.g. after it was
+// restored from a backup or the change is known to be intended
+func (h *IntegrityHandler) AcceptChecksum(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ZoneID string `json:"zone_id"`
+		Path   string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	c, err := h.store.GetFileChecksum(req.ZoneID, req.Path)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeChecksumNotFound, err.Error(), nil)
+		return
+	}
+	zone, err := h.store.GetShareZone(c.ZoneID)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, "Zone not found", nil)
+		return
+	}
+	pool, err := h.store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodePoolNotFound, "Pool not found", nil)
+		return
+	}
+
+	fullPath := filepath.Join(pool.Path, zone.Path, filepath.FromSlash(c.Path))
+	if err := recordFileChecksum(h.store, zone.ID, c.Path, fullPath); err != nil {
+		if os.IsNotExist(err) {
+			h.store.DeleteFileChecksumPath(zone.ID, c.Path)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File no longer exists", nil)
+			return
+		}
+		apierror.Error(w, "Failed to hash file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c, _ = h.store.GetFileChecksum(zone.ID, c.Path)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// GetZoneChecksums returns an SHA256SUMS manifest of a file or folder from the recorded checksums,
+// so a transfer can be verified with `sha256sum -c`. Files changed since they were hashed are left
+// out until the integrity checker hashes them again.
+func (h *ZoneFileHandler) GetZoneChecksums(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	fullPath, zone, pool, err := h.resolveZonePathWithPool(chi.URLParam(r, "zoneId"), r.URL.Query().Get("path"), userFromContext(userCtx))
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return
+	}
+	if pool.IsS3() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Checksums are not recorded on object storage pools", nil)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		return
+	}
+
+	// Manifest paths are relative to the requested folder, or the file name for a single file
+	root := filepath.Join(pool.Path, zone.Path)
+	base := fullPath
+	if !info.IsDir() {
+		base = filepath.Dir(fullPath)
+	}
+
+	var manifest strings.Builder
+	for _, c := range h.store.WithContext(r.Context()).ListFileChecksums(zone.ID, usageRelPath(root, fullPath)) {
+		filePath := filepath.Join(root, filepath.FromSlash(c.Path))
+		fi, err := os.Stat(filePath)
+		if err != nil || !checksumCurrent(c, fi) {
+			continue
+		}
+		rel, err := filepath.Rel(base, filePath)
+		if err != nil {
+			continue
+		}
+		manifest.WriteString(checksumManifestLine(c.SHA256, filepath.ToSlash(rel)))
+	}
+	if manifest.Len() == 0 {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeChecksumNotFound, "No checksums have been recorded for this path yet", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"SHA256SUMS\"")
+	io.WriteString(w, manifest.String())
+}
+
+// checksumManifestLine formats a line the way sha256sum does, escaping names that contain
+// a backslash or newline and marking them with a leading backslash
+func checksumManifestLine(sum, name string) string {
+	if strings.ContainsAny(name, "\\\n") {
+		name = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(name)
+		return "\\" + sum + "  " + name + "\n"
+	}
+	return sum + "  " + name + "\n"
+}
@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+)
+
+const (
+	// ioStatsSampleInterval is how often /proc/diskstats is sampled
+	ioStatsSampleInterval = 5 * time.Second
+	// ioStatsFineSamples keeps one hour of samples at the sample interval
+	ioStatsFineSamples = 720
+	// ioStatsCoarseEvery keeps every 12th sample (one a minute) for the longer history
+	ioStatsCoarseEvery = 12
+	// ioStatsCoarseSamples keeps 24 hours of one-minute samples
+	ioStatsCoarseSamples = 1440
+	// ioStatsMaxWindow is the longest window the history covers
+	ioStatsMaxWindow = 24 * time.Hour
+	// processIOMaxInterval caps how long the per-process view measures
+	processIOMaxInterval = 5 * time.Second
+)
+
+// ioStatsSample is the diskstats counters of all devices at one point in time
+type ioStatsSample struct {
+	Time  time.Time
+	Stats map[string]models.IOStats
+}
+
+// ioStatsRing is a fixed-size ring buffer of samples
+type ioStatsRing struct {
+	samples []ioStatsSample
+	next    int
+	count   int
+}
+
+func newIOStatsRing(size int) *ioStatsRing {
+	return &ioStatsRing{samples: make([]ioStatsSample, size)}
+}
+
+// add stores a sample, overwriting the oldest one when the ring is full
+func (r *ioStatsRing) add(sample ioStatsSample) {
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % len(r.samples)
+	if r.count < len(r.samples) {
+		r.count++
+	}
+}
+
+// since returns the samples from the last one at or before t onwards, oldest first, so the
+// first interval of the window is covered too
+func (r *ioStatsRing) since(t time.Time) []ioStatsSample {
+	var result []ioStatsSample
+	for i := 0; i < r.count; i++ {
+		sample := r.samples[(r.next-r.count+i+len(r.samples))%len(r.samples)]
+		if !sample.Time.After(t) {
+			result = result[:0]
+		}
+		result = append(result, sample)
+	}
+	return result
+}
+
+// IOStatsCollector samples /proc/diskstats in the background and keeps a rolling history in
+// memory, so I/O rates can be shown over a window instead of raw counters since boot
+type IOStatsCollector struct {
+	mu       sync.RWMutex
+	fine     *ioStatsRing
+	coarse   *ioStatsRing
+	samples  int
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	running  bool
+}
+
+// NewIOStatsCollector creates a new I/O statistics collector
+func NewIOStatsCollector() *IOStatsCollector {
+	return &IOStatsCollector{
+		fine:     newIOStatsRing(ioStatsFineSamples),
+		coarse:   newIOStatsRing(ioStatsCoarseSamples),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins sampling in the background
+func (c *IOStatsCollector) Start() {
+	c.mu.Lock()
+	if c.running {
+		c.mu.Unlock()
+		return
+	}
+	c.running = true
+	c.stopChan = make(chan struct{})
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go c.run()
+	log.Println("I/O statistics collector started")
+}
+
+// Stop stops sampling
+func (c *IOStatsCollector) Stop() {
+	c.mu.Lock()
+	if !c.running {
+		c.mu.Unlock()
+		return
+	}
+	c.running = false
+	close(c.stopChan)
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	log.Println("I/O statistics collector stopped")
+}
+
+// run is the main sampling loop
+func (c *IOStatsCollector) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(ioStatsSampleInterval)
+	defer ticker.Stop()
+
+	c.sample()
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			c.sample()
+		}
+	}
+}
+
+// sample reads the current counters into the history
+func (c *IOStatsCollector) sample() {
+	stats, err := getIOStats()
+	if err != nil {
+		return
+	}
+	sample := ioStatsSample{Time: time.Now(), Stats: make(map[string]models.IOStats, len(stats))}
+	for _, s := range stats {
+		sample.Stats[s.Device] = s
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fine.add(sample)
+	if c.samples%ioStatsCoarseEvery == 0 {
+		c.coarse.add(sample)
+	}
+	c.samples++
+}
+
+// window returns the samples covering a window, from the fine history when it reaches back far enough
+func (c *IOStatsCollector) window(window time.Duration) []ioStatsSample {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	from := time.Now().Add(-window)
+	if window <= ioStatsFineSamples*ioStatsSampleInterval {
+		return c.fine.since(from)
+	}
+	return c.coarse.since(from)
+}
+
+// ioRatesBetween computes the rates of a device between two samples. It returns false when
+// the counters went backwards, which happens when a device is removed and added again.
+func ioRatesBetween(prev, cur models.IOStats, elapsed time.Duration, at time.Time) (models.IORates, bool) {
+	if elapsed <= 0 || cur.ReadOps < prev.ReadOps || cur.WriteOps < prev.WriteOps ||
+		cur.ReadBytes < prev.ReadBytes || cur.WriteBytes < prev.WriteBytes || cur.IOTime < prev.IOTime {
+		return models.IORates{}, false
+	}
+
+	seconds := elapsed.Seconds()
+	readOps := cur.ReadOps - prev.ReadOps
+	writeOps := cur.WriteOps - prev.WriteOps
+	rates := models.IORates{
+		Device:           cur.Device,
+		Time:             at,
+		ReadIOPS:         float64(readOps) / seconds,
+		WriteIOPS:        float64(writeOps) / seconds,
+		ReadBytesPerSec:  float64(cur.ReadBytes-prev.ReadBytes) / seconds,
+		WriteBytesPerSec: float64(cur.WriteBytes-prev.WriteBytes) / seconds,
+		Utilization:      min(100, float64(cur.IOTime-prev.IOTime)/float64(elapsed.Milliseconds())*100),
+	}
+	if ops := readOps + writeOps; ops > 0 && cur.ReadTime >= prev.ReadTime && cur.WriteTime >= prev.WriteTime {
+		rates.AvgWaitMs = float64(cur.ReadTime-prev.ReadTime+cur.WriteTime-prev.WriteTime) / float64(ops)
+	}
+	rates.ReadHuman = formatBytes(uint64(rates.ReadBytesPerSec)) + "/s"
+	rates.WriteHuman = formatBytes(uint64(rates.WriteBytesPerSec)) + "/s"
+	return rates, true
+}
+
+// parseIOStatsWindow parses a window such as 5m or 1h
+func parseIOStatsWindow(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window < ioStatsSampleInterval || window > ioStatsMaxWindow {
+		return 0, fmt.Errorf("invalid window %q: use a duration between %s and %s, e.g. 15m", value, ioStatsSampleInterval, ioStatsMaxWindow)
+	}
+	return window, nil
+}
+
+// GetIORates returns the average I/O rates of every device over a window (default 1m)
+func GetIORates(collector *IOStatsCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window, err := parseIOStatsWindow(r.URL.Query().Get("window"), time.Minute)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		samples := collector.window(window)
+		if len(samples) < 2 {
+			// Not enough history yet: measure over one sample interval instead
+			first, err := getIOStats()
+			if err != nil {
+				apierror.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			start := time.Now()
+			time.Sleep(time.Second)
+			second, err := getIOStats()
+			if err != nil {
+				apierror.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			samples = []ioStatsSample{{Time: start, Stats: map[string]models.IOStats{}}, {Time: time.Now(), Stats: map[string]models.IOStats{}}}
+			for _, s := range first {
+				samples[0].Stats[s.Device] = s
+			}
+			for _, s := range second {
+				samples[1].Stats[s.Device] = s
+			}
+		}
+
+		first, last := samples[0], samples[len(samples)-1]
+		rates := []models.IORates{}
+		for device, cur := range last.Stats {
+			prev, ok := first.Stats[device]
+			if !ok {
+				continue
+			}
+			if rate, ok := ioRatesBetween(prev, cur, last.Time.Sub(first.Time), last.Time); ok {
+				rates = append(rates, rate)
+			}
+		}
+		sort.Slice(rates, func(i, j int) bool { return rates[i].Device < rates[j].Device })
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rates)
+	}
+}
+
+// GetIOStatsHistory returns the I/O rate time series of every device, or of one with ?device=,
+// over a window (default 1h). Windows up to an hour have a point every 5 seconds, longer ones
+// a point a minute.
+func GetIOStatsHistory(collector *IOStatsCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window, err := parseIOStatsWindow(r.URL.Query().Get("window"), time.Hour)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		device := strings.TrimPrefix(r.URL.Query().Get("device"), "/dev/")
+
+		samples := collector.window(window)
+		series := make(map[string]*models.IORateSeries)
+		for i := 1; i < len(samples); i++ {
+			prev, cur := samples[i-1], samples[i]
+			for name, stats := range cur.Stats {
+				if device != "" && name != device {
+					continue
+				}
+				prevStats, ok := prev.Stats[name]
+				if !ok {
+					continue
+				}
+				rate, ok := ioRatesBetween(prevStats, stats, cur.Time.Sub(prev.Time), cur.Time)
+				if !ok {
+					continue
+				}
+				if series[name] == nil {
+					series[name] = &models.IORateSeries{Device: name}
+				}
+				series[name].Points = append(series[name].Points, rate)
+			}
+		}
+
+		result := []models.IORateSeries{}
+		for _, s := range series {
+			result = append(result, *s)
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Device < result[j].Device })
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// processIOCounters is the storage I/O a process has done since it started
+type processIOCounters struct {
+	Name       string
+	UID        string
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+// readProcessIO reads the I/O counters of every process from /proc/<pid>/io. Processes that
+// exit or are not readable are skipped.
+func readProcessIO() map[int]processIOCounters {
+	result := make(map[int]processIOCounters)
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "io"))
+		if err != nil {
+			continue
+		}
+
+		var counters processIOCounters
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), ": ")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "read_bytes":
+				counters.ReadBytes, _ = strconv.ParseUint(value, 10, 64)
+			case "write_bytes":
+				counters.WriteBytes, _ = strconv.ParseUint(value, 10, 64)
+			}
+		}
+
+		if comm, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+			counters.Name = strings.TrimSpace(string(comm))
+		}
+		if status, err := os.ReadFile(filepath.Join(dir, "status")); err == nil {
+			for _, line := range strings.Split(string(status), "\n") {
+				if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "Uid:" {
+					counters.UID = fields[1]
+					break
+				}
+			}
+		}
+		result[pid] = counters
+	}
+	return result
+}
+
+// GetProcessIO returns the disk read and write rate of each process, measured over ?interval=
+// seconds (default 1), busiest first like iotop. Idle processes are left out unless all=true.
+func GetProcessIO() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		interval := time.Second
+		if v := r.URL.Query().Get("interval"); v != "" {
+			seconds, err := strconv.ParseFloat(v, 64)
+			interval = time.Duration(seconds * float64(time.Second))
+			if err != nil || interval < 100*time.Millisecond || interval > processIOMaxInterval {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("interval must be between 0.1 and %d seconds", int(processIOMaxInterval.Seconds())), nil)
+				return
+			}
+		}
+		limit := 20
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+			limit = l
+		}
+		all := r.URL.Query().Get("all") == "true"
+
+		before := readProcessIO()
+		start := time.Now()
+		select {
+		case <-time.After(interval):
+		case <-r.Context().Done():
+			return
+		}
+		after := readProcessIO()
+		seconds := time.Since(start).Seconds()
+
+		users := make(map[string]string)
+		processes := []models.ProcessIO{}
+		for pid, cur := range after {
+			prev, ok := before[pid]
+			if !ok || cur.ReadBytes < prev.ReadBytes || cur.WriteBytes < prev.WriteBytes {
+				continue
+			}
+			p := models.ProcessIO{
+				PID:              pid,
+				Name:             cur.Name,
+				ReadBytesPerSec:  float64(cur.ReadBytes-prev.ReadBytes) / seconds,
+				WriteBytesPerSec: float64(cur.WriteBytes-prev.WriteBytes) / seconds,
+			}
+			if !all && p.ReadBytesPerSec == 0 && p.WriteBytesPerSec == 0 {
+				continue
+			}
+			p.ReadHuman = formatBytes(uint64(p.ReadBytesPerSec)) + "/s"
+			p.WriteHuman = formatBytes(uint64(p.WriteBytesPerSec)) + "/s"
+
+			name, ok := users[cur.UID]
+			if !ok {
+				name = cur.UID
+				if u, err := user.LookupId(cur.UID); err == nil {
+					name = u.Username
+				}
+				users[cur.UID] = name
+			}
+			p.User = name
+
+			if cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+				p.Command = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+				if len(p.Command) > 200 {
+					p.Command = p.Command[:200]
+				}
+			}
+			processes = append(processes, p)
+		}
+
+		sort.Slice(processes, func(i, j int) bool {
+			return processes[i].ReadBytesPerSec+processes[i].WriteBytesPerSec > processes[j].ReadBytesPerSec+processes[j].WriteBytesPerSec
+		})
+		if len(processes) > limit {
+			processes = processes[:limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(processes)
+	}
+}
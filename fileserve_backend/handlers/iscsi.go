@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// iscsiConfigMu serializes changes to the LIO configuration. targetcli keeps its state in
+// configfs and saveconfig writes all of it, so concurrent edits would interleave.
+var iscsiConfigMu sync.Mutex
+
+var (
+	iscsiTargetNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{0,63}$`)
+	iscsiIQNRegex        = regexp.MustCompile(`^iqn\.[0-9]{4}-[0-9]{2}\.[a-z0-9][a-z0-9.-]*(:[A-Za-z0-9.:_-]+)?$`)
+	iscsiInitiatorRegex  = regexp.MustCompile(`^(iqn\.[0-9]{4}-[0-9]{2}\.[a-z0-9][a-z0-9.-]*(:[A-Za-z0-9.:_-]+)?|eui\.[0-9A-Fa-f]{16}|naa\.[0-9A-Fa-f]{16,32})$`)
+	iscsiCHAPUserRegex   = regexp.MustCompile(`^[A-Za-z0-9._@:-]{1,64}$`)
+)
+
+// iscsiCHAPPasswordValid checks the CHAP secret. Most initiators require 12-16 characters, and
+// the secret is passed to targetcli as a single argument, so whitespace and quotes are refused.
+func iscsiCHAPPasswordValid(password string) bool {
+	if len(password) < 12 || len(password) > 16 {
+		return false
+	}
+	for _, c := range password {
+		if c <= ' ' || c > '~' || c == '"' || c == '\'' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// ISCSITargetRequest is the request to create or update an iSCSI target
+type ISCSITargetRequest struct {
+	Name         *string            `json:"name,omitempty"`
+	IQN          *string            `json:"iqn,omitempty"`
+	LUNs         *[]models.ISCSILUN `json:"luns,omitempty"`
+	Initiators   *[]string          `json:"initiators,omitempty"`
+	CHAPUser     *string            `json:"chap_user,omitempty"`
+	CHAPPassword *string            `json:"chap_password,omitempty"` // Empty keeps the stored password
+	Enabled      *bool              `json:"enabled,omitempty"`
+}
+
+// targetcli runs a single targetcli command. The arguments are left out of the error since
+// they may contain the CHAP secret.
+func targetcli(args ...string) error {
+	cmd := exec.Command("sudo", append([]string{"targetcli"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("targetcli %s failed: %s", args[0], commandError(output, err))
+	}
+	return nil
+}
+
+// iscsiBackstoreName returns the LIO block backstore name used for a zvol
+func iscsiBackstoreName(zvol string) string {
+	return "fileserv-" + strings.NewReplacer("/", "-", ":", "-").Replace(zvol)
+}
+
+// iscsiDefaultIQN builds a target IQN from the hostname and the target name
+func iscsiDefaultIQN(name string) string {
+	hostname, _ := os.Hostname()
+	host := strings.Trim(regexp.MustCompile(`[^a-z0-9.-]+`).ReplaceAllString(strings.ToLower(hostname), "-"), ".-")
+	if host == "" {
+		host = "fileserv"
+	}
+	return "iqn.2003-01.org.linux-iscsi." + host + ":" + name
+}
+
+// iscsiTargetActive reports whether the target is configured in the kernel
+func iscsiTargetActive(iqn string) bool {
+	_, err := os.Stat(filepath.Join("/sys/kernel/config/target/iscsi", iqn))
+	return err == nil
+}
+
+// applyISCSITarget configures the target in LIO and saves the configuration. Anything created
+// is removed again when a step fails.
+func applyISCSITarget(target *models.ISCSITarget) error {
+	if err := createISCSITarget(target); err != nil {
+		removeISCSITarget(target)
+		targetcli("saveconfig")
+		return err
+	}
+	return targetcli("saveconfig")
+}
+
+func createISCSITarget(target *models.ISCSITarget) error {
+	for _, lun := range target.LUNs {
+		if err := targetcli("/backstores/block", "create", "name="+iscsiBackstoreName(lun.Zvol), "dev=/dev/zvol/"+lun.Zvol); err != nil {
+			return err
+		}
+	}
+
+	if err := targetcli("/iscsi", "create", target.IQN); err != nil {
+		return err
+	}
+
+	tpg := "/iscsi/" + target.IQN + "/tpg1"
+	for _, lun := range target.LUNs {
+		if err := targetcli(tpg+"/luns", "create", "/backstores/block/"+iscsiBackstoreName(lun.Zvol), "lun="+strconv.Itoa(lun.LUN)); err != nil {
+			return err
+		}
+	}
+
+	authentication := "0"
+	if target.CHAPUser != "" {
+		authentication = "1"
+	}
+
+	if len(target.Initiators) == 0 {
+		// Any initiator may log in, so CHAP is what guards the target
+		if err := targetcli(tpg, "set", "attribute", "authentication=1", "generate_node_acls=1",
+			"demo_mode_write_protect=0", "cache_dynamic_acls=1"); err != nil {
+			return err
+		}
+		return targetcli(tpg, "set", "auth", "userid="+target.CHAPUser, "password="+target.CHAPPassword)
+	}
+
+	if err := targetcli(tpg, "set", "attribute", "authentication="+authentication, "generate_node_acls=0"); err != nil {
+		return err
+	}
+	for _, initiator := range target.Initiators {
+		if err := targetcli(tpg+"/acls", "create", initiator); err != nil {
+			return err
+		}
+		if target.CHAPUser != "" {
+			if err := targetcli(tpg+"/acls/"+initiator, "set", "auth", "userid="+target.CHAPUser, "password="+target.CHAPPassword); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeISCSITarget removes the target and its backstores from LIO. Errors are ignored so a
+// partially configured target is cleaned up as far as possible.
+func removeISCSITarget(target *models.ISCSITarget) {
+	targetcli("/iscsi", "delete", target.IQN)
+	for _, lun := range target.LUNs {
+		targetcli("/backstores/block", "delete", iscsiBackstoreName(lun.Zvol))
+	}
+}
+
+// validateISCSITarget checks a target against the zvols on the system and the other targets
+func validateISCSITarget(store storage.DataStore, target *models.ISCSITarget) error {
+	if !iscsiTargetNameRegex.MatchString(target.Name) {
+		return fmt.Errorf("name must be lowercase letters, digits, dots and hyphens")
+	}
+	if !iscsiIQNRegex.MatchString(target.IQN) {
+		return fmt.Errorf("invalid IQN: %s", target.IQN)
+	}
+	if len(target.LUNs) == 0 {
+		return fmt.Errorf("at least one LUN is required")
+	}
+
+	exported := make(map[string]string)
+	for _, other := range store.ListISCSITargets() {
+		if other.ID == target.ID {
+			continue
+		}
+		for _, lun := range other.LUNs {
+			exported[lun.Zvol] = other.Name
+		}
+	}
+
+	luns := make(map[int]bool)
+	zvols := make(map[string]bool)
+	for _, lun := range target.LUNs {
+		if lun.LUN < 0 || lun.LUN > 255 {
+			return fmt.Errorf("LUN must be between 0 and 255")
+		}
+		if luns[lun.LUN] {
+			return fmt.Errorf("LUN %d is used more than once", lun.LUN)
+		}
+		luns[lun.LUN] = true
+
+		if err := validateZvolName(lun.Zvol); err != nil {
+			return err
+		}
+		if zvols[lun.Zvol] {
+			return fmt.Errorf("volume '%s' is used more than once", lun.Zvol)
+		}
+		zvols[lun.Zvol] = true
+		if name, ok := exported[lun.Zvol]; ok {
+			return fmt.Errorf("volume '%s' is already exported by target '%s'", lun.Zvol, name)
+		}
+		if !zvolExists(lun.Zvol) {
+			return fmt.Errorf("volume '%s' not found", lun.Zvol)
+		}
+	}
+
+	for _, initiator := range target.Initiators {
+		if !iscsiInitiatorRegex.MatchString(initiator) {
+			return fmt.Errorf("invalid initiator name: %s", initiator)
+		}
+	}
+
+	if target.CHAPUser != "" {
+		if !iscsiCHAPUserRegex.MatchString(target.CHAPUser) {
+			return fmt.Errorf("invalid CHAP user name")
+		}
+		if !iscsiCHAPPasswordValid(target.CHAPPassword) {
+			return fmt.Errorf("CHAP password must be 12-16 printable characters without spaces, quotes or backslashes")
+		}
+	}
+	if len(target.Initiators) == 0 && target.CHAPUser == "" {
+		return fmt.Errorf("restrict the target to initiators or set CHAP credentials")
+	}
+
+	return nil
+}
+
+// ListISCSITargets returns all iSCSI targets
+func ListISCSITargets(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targets := store.ListISCSITargets()
+		for _, target := range targets {
+			target.Active = iscsiTargetActive(target.IQN)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(targets)
+	}
+}
+
+// GetISCSITarget returns a specific iSCSI target by ID
+func GetISCSITarget(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target, err := store.GetISCSITarget(chi.URLParam(r, "id"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeISCSITargetNotFound, err.Error(), nil)
+			return
+		}
+		target.Active = iscsiTargetActive(target.IQN)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(target)
+	}
+}
+
+// CreateISCSITarget creates an iSCSI target and configures it in LIO when enabled
+func CreateISCSITarget(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ISCSITargetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request: "+err.Error(), nil)
+			return
+		}
+
+		target := &models.ISCSITarget{LUNs: []models.ISCSILUN{}, Initiators: []string{}}
+		updateISCSITargetFields(target, &req)
+		if target.IQN == "" {
+			target.IQN = iscsiDefaultIQN(target.Name)
+		}
+
+		iscsiConfigMu.Lock()
+		defer iscsiConfigMu.Unlock()
+
+		if err := validateISCSITarget(store, target); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		for _, other := range store.ListISCSITargets() {
+			if other.Name == target.Name || other.IQN == target.IQN {
+				apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "iSCSI target name or IQN already exists", nil)
+				return
+			}
+		}
+
+		if target.Enabled {
+			if err := applyISCSITarget(target); err != nil {
+				apierror.Error(w, "Failed to configure iSCSI target: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		created, err := store.CreateISCSITarget(target)
+		if err != nil {
+			if target.Enabled {
+				removeISCSITarget(target)
+				targetcli("saveconfig")
+			}
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		created.Active = iscsiTargetActive(created.IQN)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	}
+}
+
+// UpdateISCSITarget updates an iSCSI target and reconfigures it in LIO
+func UpdateISCSITarget(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ISCSITargetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request: "+err.Error(), nil)
+			return
+		}
+
+		iscsiConfigMu.Lock()
+		defer iscsiConfigMu.Unlock()
+
+		existing, err := store.GetISCSITarget(chi.URLParam(r, "id"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeISCSITargetNotFound, err.Error(), nil)
+			return
+		}
+
+		updated := *existing
+		updateISCSITargetFields(&updated, &req)
+
+		if err := validateISCSITarget(store, &updated); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		for _, other := range store.ListISCSITargets() {
+			if other.ID != updated.ID && (other.Name == updated.Name || other.IQN == updated.IQN) {
+				apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "iSCSI target name or IQN already exists", nil)
+				return
+			}
+		}
+
+		// LIO has no in-place edit for most of the target, so it is rebuilt from scratch
+		if existing.Enabled || iscsiTargetActive(existing.IQN) {
+			removeISCSITarget(existing)
+		}
+		if updated.Enabled {
+			if err := applyISCSITarget(&updated); err != nil {
+				if existing.Enabled {
+					applyISCSITarget(existing)
+				}
+				apierror.Error(w, "Failed to configure iSCSI target: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			targetcli("saveconfig")
+		}
+
+		saved, err := store.UpdateISCSITarget(&updated)
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		saved.Active = iscsiTargetActive(saved.IQN)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(saved)
+	}
+}
+
+// DeleteISCSITarget removes an iSCSI target from LIO and deletes it
+func DeleteISCSITarget(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		iscsiConfigMu.Lock()
+		defer iscsiConfigMu.Unlock()
+
+		target, err := store.GetISCSITarget(chi.URLParam(r, "id"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeISCSITargetNotFound, err.Error(), nil)
+			return
+		}
+
+		removeISCSITarget(target)
+		if err := targetcli("saveconfig"); err != nil && iscsiTargetActive(target.IQN) {
+			apierror.Error(w, "Failed to remove iSCSI target: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := store.DeleteISCSITarget(target.ID); err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// updateISCSITargetFields copies the fields set in the request onto the target
+func updateISCSITargetFields(target *models.ISCSITarget, req *ISCSITargetRequest) {
+	if req.Name != nil {
+		target.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.IQN != nil {
+		target.IQN = strings.TrimSpace(*req.IQN)
+	}
+	if req.LUNs != nil {
+		target.LUNs = append([]models.ISCSILUN{}, *req.LUNs...)
+		sort.Slice(target.LUNs, func(i, j int) bool { return target.LUNs[i].LUN < target.LUNs[j].LUN })
+	}
+	if req.Initiators != nil {
+		target.Initiators = []string{}
+		for _, initiator := range *req.Initiators {
+			if initiator = strings.TrimSpace(initiator); initiator != "" {
+				target.Initiators = append(target.Initiators, initiator)
+			}
+		}
+	}
+	if req.CHAPUser != nil {
+		target.CHAPUser = strings.TrimSpace(*req.CHAPUser)
+		if target.CHAPUser == "" {
+			target.CHAPPassword = ""
+		}
+	}
+	if req.CHAPPassword != nil && *req.CHAPPassword != "" && target.CHAPUser != "" {
+		target.CHAPPassword = *req.CHAPPassword
+	}
+	if req.Enabled != nil {
+		target.Enabled = *req.Enabled
+	}
+}
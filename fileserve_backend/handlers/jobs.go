@@ -0,0 +1,975 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/internal/fileops"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxConcurrentJobs is the number of jobs running at once; later jobs wait in the queue
+	maxConcurrentJobs = 4
+	// jobProgressInterval is the minimum time between progress saves and events of a job
+	jobProgressInterval = time.Second
+	// jobRetention is how long finished jobs are kept in the history
+	jobRetention        = 30 * 24 * time.Hour
+	defaultJobListLimit = 100
+	maxJobListLimit     = 1000
+	// maxChecksumResults caps the checksums listed in the result of a checksum job
+	maxChecksumResults = 1000
+)
+
+// errJobCancelled is returned by job steps once the job has been cancelled
+var errJobCancelled = errors.New("job cancelled")
+
+// jobFunc does the work of a job, reporting progress through the run
+type jobFunc func(run *jobRun) error
+
+// ============================================================================
+// Job Manager
+// ============================================================================
+
+// JobManager runs background jobs, persisting their progress so the history survives restarts
+type JobManager struct {
+	store    storage.DataStore
+	slots    chan struct{} // Limits the number of jobs running at once
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	runs     map[string]*jobRun // Queued and running jobs
+}
+
+// NewJobManager creates a new job manager
+func NewJobManager(store storage.DataStore) *JobManager {
+	return &JobManager{
+		store:    store,
+		slots:    make(chan struct{}, maxConcurrentJobs),
+		stopChan: make(chan struct{}),
+		runs:     make(map[string]*jobRun),
+	}
+}
+
+// Start fails the jobs interrupted by the previous shutdown and begins pruning the history
+func (m *JobManager) Start() {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = true
+	m.stopChan = make(chan struct{})
+	m.mu.Unlock()
+
+	if n, err := m.store.FailInterruptedJobs("interrupted by a server restart"); err != nil {
+		log.Printf("Jobs: failed to mark interrupted jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Jobs: marked %d interrupted job(s) as failed", n)
+	}
+
+	m.wg.Add(1)
+	go m.prune()
+	log.Println("Job manager started")
+}
+
+// Stop cancels the jobs in progress and waits for them to stop
+func (m *JobManager) Stop() {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = false
+	close(m.stopChan)
+	for _, run := range m.runs {
+		run.cancel()
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	log.Println("Job manager stopped")
+}
+
+// prune removes old finished jobs from the history every hour
+func (m *JobManager) prune() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if err := m.store.PruneJobs(time.Now().Add(-jobRetention)); err != nil {
+			log.Printf("Jobs: failed to prune history: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+// Submit records a job and queues it to run fn in the background
+func (m *JobManager) Submit(job *models.Job, fn jobFunc) error {
+	job.ID = uuid.New().String()
+	job.Status = models.JobStatusQueued
+	job.Errors = []models.JobError{}
+	job.CreatedAt = time.Now()
+	if err := m.store.CreateJob(job); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &jobRun{
+		manager: m,
+		job:     job,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	m.mu.Lock()
+	m.runs[job.ID] = run
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.execute(run, fn)
+	return nil
+}
+
+// execute waits for a free slot, runs the job and records how it ended
+func (m *JobManager) execute(run *jobRun, fn jobFunc) {
+	defer m.wg.Done()
+	defer func() {
+		m.mu.Lock()
+		delete(m.runs, run.job.ID)
+		m.mu.Unlock()
+		run.cancel()
+	}()
+
+	var err error
+	select {
+	case m.slots <- struct{}{}:
+		run.update(func(job *models.Job) {
+			now := time.Now()
+			job.Status = models.JobStatusRunning
+			job.StartedAt = &now
+		})
+		run.save(true)
+		err = fn(run)
+		<-m.slots
+	case <-run.ctx.Done():
+		err = errJobCancelled
+	}
+
+	eventType := events.TypeJobCompleted
+	run.update(func(job *models.Job) {
+		now := time.Now()
+		job.FinishedAt = &now
+		switch {
+		case err == nil:
+			job.Status = models.JobStatusCompleted
+		case errors.Is(err, errJobCancelled) || run.ctx.Err() != nil:
+			job.Status = models.JobStatusCancelled
+			eventType = events.TypeJobCancelled
+		default:
+			job.Status = models.JobStatusFailed
+			job.Error = err.Error()
+			eventType = events.TypeJobFailed
+		}
+	})
+	job := run.save(true)
+	if eventType == events.TypeJobFailed {
+		log.Printf("Jobs: %s job %s failed: %v", job.Type, job.ID, err)
+	}
+	events.PublishToUser(job.UserID, eventType, job)
+}
+
+// Cancel stops a queued or running job. It returns false if the job is not in progress.
+func (m *JobManager) Cancel(id string) bool {
+	m.mu.Lock()
+	run, ok := m.runs[id]
+	m.mu.Unlock()
+	if ok {
+		run.cancel()
+	}
+	return ok
+}
+
+// Get returns a job, with live progress while it is in progress
+func (m *JobManager) Get(id string) (*models.Job, error) {
+	m.mu.Lock()
+	run, ok := m.runs[id]
+	m.mu.Unlock()
+	if ok {
+		job := run.snapshot()
+		return &job, nil
+	}
+	return m.store.GetJob(id)
+}
+
+// live replaces jobs in progress with their current state, which is saved only periodically
+func (m *JobManager) live(jobs []*models.Job) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, job := range jobs {
+		if run, ok := m.runs[job.ID]; ok {
+			snapshot := run.snapshot()
+			jobs[i] = &snapshot
+		}
+	}
+}
+
+// ============================================================================
+// Job Runs
+// ============================================================================
+
+// jobRun is a job in progress
+type jobRun struct {
+	manager  *JobManager
+	ctx      context.Context
+	cancel   context.CancelFunc
+	mu       sync.Mutex // Guards job and lastSave
+	job      *models.Job
+	lastSave time.Time
+}
+
+// check returns errJobCancelled once the job has been cancelled
+func (r *jobRun) check() error {
+	if r.ctx.Err() != nil {
+		return errJobCancelled
+	}
+	return nil
+}
+
+// update changes the job and recomputes its progress
+func (r *jobRun) update(fn func(job *models.Job)) {
+	r.mu.Lock()
+	fn(r.job)
+	job := r.job
+	switch {
+	case job.Status == models.JobStatusCompleted:
+		job.Progress = 100
+	case job.TotalBytes > 0:
+		job.Progress = float64(job.DoneBytes) / float64(job.TotalBytes) * 100
+	case job.TotalItems > 0:
+		job.Progress = float64(job.DoneItems+job.FailedItems+job.SkippedItems) / float64(job.TotalItems) * 100
+	}
+	job.Progress = min(job.Progress, 100)
+	r.mu.Unlock()
+}
+
+// snapshot returns a copy of the job
+func (r *jobRun) snapshot() models.Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := *r.job
+	job.Errors = append([]models.JobError{}, r.job.Errors...)
+	return job
+}
+
+// save persists the job and publishes a progress event, at most once per jobProgressInterval
+// unless forced. It returns the saved state.
+func (r *jobRun) save(force bool) models.Job {
+	r.mu.Lock()
+	if !force && time.Since(r.lastSave) < jobProgressInterval {
+		r.mu.Unlock()
+		return models.Job{}
+	}
+	r.lastSave = time.Now()
+	r.mu.Unlock()
+
+	job := r.snapshot()
+	if err := r.manager.store.UpdateJob(&job); err != nil {
+		log.Printf("Jobs: failed to save job %s: %v", job.ID, err)
+	}
+	if !job.Finished() {
+		events.PublishToUser(job.UserID, events.TypeJobProgress, job)
+	}
+	return job
+}
+
+// addTotals grows the amount of work the job has to do
+func (r *jobRun) addTotals(items int, bytes int64) {
+	r.update(func(job *models.Job) {
+		job.TotalItems += items
+		job.TotalBytes += bytes
+	})
+}
+
+// itemDone counts an item handled successfully
+func (r *jobRun) itemDone() {
+	r.update(func(job *models.Job) { job.DoneItems++ })
+	r.save(false)
+}
+
+// itemSkipped counts an item left alone, e.g. because it already exists at the destination
+func (r *jobRun) itemSkipped() {
+	r.update(func(job *models.Job) { job.SkippedItems++ })
+	r.save(false)
+}
+
+// itemFailed counts an item that could not be handled and records why
+func (r *jobRun) itemFailed(itemPath string, err error) {
+	r.update(func(job *models.Job) {
+		job.FailedItems++
+		if len(job.Errors) < models.MaxJobErrors {
+			job.Errors = append(job.Errors, models.JobError{Path: itemPath, Error: err.Error()})
+		}
+	})
+	r.save(false)
+}
+
+// setResult records the type-specific outcome of the job
+func (r *jobRun) setResult(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	r.update(func(job *models.Job) { job.Result = data })
+}
+
+// reader wraps src so reads count towards the job's bytes and stop once it is cancelled
+func (r *jobRun) reader(src io.Reader) io.Reader {
+	return &jobReader{src: src, run: r}
+}
+
+// jobReader counts the bytes read for a job
+type jobReader struct {
+	src io.Reader
+	run *jobRun
+}
+
+func (jr *jobReader) Read(p []byte) (int, error) {
+	if err := jr.run.check(); err != nil {
+		return 0, err
+	}
+	n, err := jr.src.Read(p)
+	if n > 0 {
+		jr.run.update(func(job *models.Job) { job.DoneBytes += int64(n) })
+		jr.run.save(false)
+	}
+	return n, err
+}
+
+// ============================================================================
+// Tree Writer
+// ============================================================================
+
+// treeWriter writes files into a folder of a local zone the way uploads do: quota, versions,
+// ownership, search index and usage ledger. Copy and extract jobs feed it one entry at a time.
+type treeWriter struct {
+	store     storage.DataStore
+	run       *jobRun
+	zone      *models.ShareZone
+	pool      *models.StoragePool
+	root      string // Zone root
+	target    string // Folder entries are written below
+	collision string
+	userCtx   *middleware.UserContext
+}
+
+// writeEntry writes one entry below the target folder following the collision policy. Only
+// cancellation stops the job; entries that cannot be written are counted as failed.
+func (t *treeWriter) writeEntry(entry *models.ArchiveEntry, open func() (io.ReadCloser, error)) error {
+	if err := t.run.check(); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(t.target, filepath.FromSlash(entry.Path))
+	if isReservedZonePath(t.root, dest) {
+		if !entry.IsDir {
+			t.run.itemSkipped()
+		}
+		return nil
+	}
+
+	if entry.IsDir {
+		if info, err := os.Stat(dest); err == nil && info.IsDir() {
+			return nil
+		}
+		if err := t.mkdirAll(dest); err != nil {
+			t.run.itemFailed(entry.Path, err)
+		}
+		return nil
+	}
+
+	opts := &fileops.TransferOptions{
+		MaxFileSize:  t.pool.MaxFileSize,
+		AllowedTypes: t.pool.AllowedTypes,
+		DeniedTypes:  t.pool.DeniedTypes,
+	}
+	if err := fileops.ValidateUpload(filepath.Base(dest), entry.Size, opts); err != nil {
+		t.run.itemFailed(entry.Path, err)
+		t.run.update(func(job *models.Job) { job.DoneBytes += entry.Size })
+		return nil
+	}
+
+	existing, err := os.Lstat(dest)
+	if err == nil {
+		switch {
+		case t.collision == models.CollisionRename:
+			dest = availableFilename(filepath.Dir(dest), filepath.Base(dest))
+		case t.collision == models.CollisionOverwrite && existing.Mode().IsRegular():
+		default:
+			t.run.update(func(job *models.Job) { job.DoneBytes += entry.Size })
+			t.run.itemSkipped()
+			return nil
+		}
+	}
+
+	if err := t.writeFile(dest, entry, open); err != nil {
+		if errors.Is(err, errJobCancelled) {
+			return err
+		}
+		log.Printf("Jobs: failed to write %s: %v", dest, err)
+		t.run.itemFailed(entry.Path, err)
+		return nil
+	}
+	t.run.itemDone()
+	return nil
+}
+
+// mkdirAll creates a folder and its missing parents, owned by the user
+func (t *treeWriter) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; d != t.root && d != filepath.Dir(d); d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		chownToUser(missing[i], t.userCtx.Username)
+		indexPath(t.store, missing[i])
+	}
+	return nil
+}
+
+// writeFile writes the content of an entry to dest, replacing any existing file
+func (t *treeWriter) writeFile(dest string, entry *models.ArchiveEntry, open func() (io.ReadCloser, error)) error {
+	if err := checkFileLock(t.store, dest, t.userCtx.UserID, false); err != nil {
+		return err
+	}
+	if err := t.mkdirAll(filepath.Dir(dest)); err != nil {
+		return err
+	}
+	if err := checkZoneQuota(t.store, t.zone, t.pool, dest, t.userCtx.Username, entry.Size); err != nil {
+		return err
+	}
+	replaced := pathUsage(t.store, t.zone, t.pool, dest)
+
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	version, err := saveFileVersion(t.store, dest, t.userCtx)
+	if err != nil {
+		log.Printf("Failed to save previous version of %s: %v", dest, err)
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		undoFileVersion(t.store, version, dest)
+		return err
+	}
+
+	// Archives can understate their content; never write more than the declared size
+	written, err := io.Copy(out, t.run.reader(io.LimitReader(rc, entry.Size+1)))
+	if err == nil && written > entry.Size {
+		err = errors.New("entry is larger than its declared size")
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dest)
+		undoFileVersion(t.store, version, dest)
+		return err
+	}
+
+	if !entry.ModTime.IsZero() {
+		os.Chtimes(dest, time.Now(), entry.ModTime)
+	}
+	chownToUser(dest, t.userCtx.Username)
+	indexPath(t.store, dest)
+	chargeZoneUsage(t.store, t.zone, t.pool, dest, t.userCtx.Username, written-replaced)
+	return nil
+}
+
+// ============================================================================
+// Job Types
+// ============================================================================
+
+// runDeleteJob moves files and folders to the zone trash, or removes them on object storage
+func (h *JobHandler) runDeleteJob(run *jobRun, zone *models.ShareZone, paths []string, userCtx *middleware.UserContext) error {
+	run.addTotals(len(paths), 0)
+	user := userFromContext(userCtx)
+
+	for _, p := range paths {
+		if err := run.check(); err != nil {
+			return err
+		}
+		if isSharedFolderRoot(zone.ID, p) {
+			run.itemFailed(p, errors.New("cannot delete the shared folder"))
+			continue
+		}
+
+		fullPath, _, pool, err := h.files.resolveZonePathWithPool(zone.ID, p, user)
+		if err != nil {
+			run.itemFailed(p, err)
+			continue
+		}
+		if pool.IsS3() {
+			err = removeBackendPath(pool, fullPath)
+		} else if err = checkFileLock(h.store, fullPath, userCtx.UserID, true); err == nil {
+			_, err = moveToTrash(h.store, zone, pool, fullPath, userCtx)
+		}
+		if err != nil {
+			run.itemFailed(p, err)
+			continue
+		}
+
+		unindexPath(h.store, fullPath)
+		run.itemDone()
+	}
+	return nil
+}
+
+// runCopyJob copies files and folders into the destination folder. Folders are merged with
+// existing ones; the collision policy applies to each file.
+func (h *JobHandler) runCopyJob(run *jobRun, t *treeWriter, paths []string) error {
+	user := userFromContext(t.userCtx)
+
+	type source struct {
+		rel, fullPath string
+	}
+	var sources []source
+	for _, p := range paths {
+		fullPath, _, _, err := h.files.resolveZonePathWithPool(t.zone.ID, p, user)
+		if err != nil {
+			run.addTotals(1, 0)
+			run.itemFailed(p, err)
+			continue
+		}
+		if t.target == fullPath || strings.HasPrefix(t.target, fullPath+string(filepath.Separator)) {
+			run.addTotals(1, 0)
+			run.itemFailed(p, errors.New("cannot copy a folder into itself"))
+			continue
+		}
+		files, size := treeSize(t.root, fullPath)
+		run.addTotals(files, size)
+		sources = append(sources, source{rel: p, fullPath: fullPath})
+	}
+
+	for _, src := range sources {
+		base := filepath.Base(src.fullPath)
+		err := filepath.Walk(src.fullPath, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				if p == src.fullPath {
+					run.itemFailed(src.rel, err)
+				}
+				return nil
+			}
+			if isReservedZonePath(t.root, p) {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, _ := filepath.Rel(src.fullPath, p)
+			entry := &models.ArchiveEntry{
+				Path:    filepath.ToSlash(filepath.Join(base, rel)),
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+				IsDir:   info.IsDir(),
+			}
+			return t.writeEntry(entry, func() (io.ReadCloser, error) { return os.Open(p) })
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	run.setResult(map[string]string{"destination": usageRelPath(t.root, t.target)})
+	return nil
+}
+
+// runChecksumJob hashes every file below the given paths and records the checksums as known-good
+func (h *JobHandler) runChecksumJob(run *jobRun, zone *models.ShareZone, pool *models.StoragePool, paths []string, userCtx *middleware.UserContext) error {
+	user := userFromContext(userCtx)
+	root := filepath.Join(pool.Path, zone.Path)
+
+	var roots []string
+	for _, p := range paths {
+		fullPath, _, _, err := h.files.resolveZonePathWithPool(zone.ID, p, user)
+		if err != nil {
+			run.addTotals(1, 0)
+			run.itemFailed(p, err)
+			continue
+		}
+		files, _ := treeSize(root, fullPath)
+		run.addTotals(files, 0)
+		roots = append(roots, fullPath)
+	}
+
+	results := []models.FileChecksum{}
+	for _, dir := range roots {
+		err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if isReservedZonePath(root, p) {
+				return filepath.SkipDir
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			if err := run.check(); err != nil {
+				return err
+			}
+
+			rel := usageRelPath(root, p)
+			if err := recordFileChecksum(h.store, zone.ID, rel, p); err != nil {
+				run.itemFailed(rel, err)
+				return nil
+			}
+			if len(results) < maxChecksumResults {
+				if c, err := h.store.GetFileChecksum(zone.ID, rel); err == nil {
+					results = append(results, *c)
+				}
+			}
+			run.itemDone()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	run.setResult(map[string]interface{}{
+		"checksums": results,
+		"truncated": run.snapshot().DoneItems > len(results),
+	})
+	return nil
+}
+
+// treeSize returns the number of regular files below fullPath and their total size, leaving out
+// the zone trash and version store
+func treeSize(root, fullPath string) (int, int64) {
+	var files int
+	var size int64
+	filepath.Walk(fullPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if isReservedZonePath(root, p) {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() {
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	return files, size
+}
+
+// ============================================================================
+// HTTP Handlers
+// ============================================================================
+
+// JobHandler starts background jobs and reports their progress
+type JobHandler struct {
+	store storage.DataStore
+	files *ZoneFileHandler
+	jobs  *JobManager
+}
+
+// NewJobHandler creates a new handler
+func NewJobHandler(store storage.DataStore, jobs *JobManager) *JobHandler {
+	return &JobHandler{
+		store: store,
+		files: NewZoneFileHandler(store),
+		jobs:  jobs,
+	}
+}
+
+// ListJobs returns the job history of the user, newest first. Admins can pass all=true to see
+// every user's jobs. Optional filters: status, type and limit.
+func (h *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	query := models.JobQuery{
+		UserID: userCtx.UserID,
+		Status: r.URL.Query().Get("status"),
+		Type:   r.URL.Query().Get("type"),
+		Limit:  defaultJobListLimit,
+	}
+	if userCtx.IsAdmin && r.URL.Query().Get("all") == "true" {
+		query.UserID = ""
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxJobListLimit {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Invalid limit (must be 1 to %d)", maxJobListLimit), nil)
+			return
+		}
+		query.Limit = n
+	}
+
+	jobs := h.store.ListJobs(query)
+	h.jobs.live(jobs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// CreateJob starts a delete, copy, archive, extract or checksum job and returns it right away.
+// Progress is reported with job.* events and the job endpoints.
+func (h *JobHandler) CreateJob(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	var req models.JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	if len(req.Paths) == 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "No paths provided", nil)
+		return
+	}
+	for i, p := range req.Paths {
+		req.Paths[i] = path.Clean("/" + p)
+	}
+	if req.Destination != "" {
+		req.Destination = path.Clean("/" + req.Destination)
+	}
+	if req.Collision == "" {
+		req.Collision = models.CollisionSkip
+	}
+	if req.Collision != models.CollisionSkip && req.Collision != models.CollisionOverwrite && req.Collision != models.CollisionRename {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid collision policy (must be skip, overwrite or rename)", nil)
+		return
+	}
+
+	_, zone, pool, err := h.files.resolveZonePathWithPool(req.ZoneID, "/", userFromContext(userCtx))
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, "Zone not found", nil)
+		}
+		return
+	}
+	if zone.ReadOnly && req.Type != models.JobTypeChecksum {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
+		return
+	}
+	if pool.IsS3() && req.Type != models.JobTypeDelete {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "This operation is not available on object storage pools", nil)
+		return
+	}
+
+	items := fmt.Sprintf("%d items", len(req.Paths))
+	if len(req.Paths) == 1 {
+		items = req.Paths[0]
+	}
+
+	var fn jobFunc
+	var description string
+	switch req.Type {
+	case models.JobTypeDelete:
+		description = "Delete " + items
+		fn = func(run *jobRun) error { return h.runDeleteJob(run, zone, req.Paths, userCtx) }
+
+	case models.JobTypeCopy:
+		t, ok := h.writerFor(w, zone, pool, req.Destination, req.Collision, userCtx)
+		if !ok {
+			return
+		}
+		if info, err := os.Stat(t.target); err != nil || !info.IsDir() {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFolderNotFound, "Destination folder not found", nil)
+			return
+		}
+		description = fmt.Sprintf("Copy %s to %s", items, req.Destination)
+		fn = func(run *jobRun) error {
+			t.run = run
+			return h.runCopyJob(run, t, req.Paths)
+		}
+
+	case models.JobTypeArchive:
+		dest, ok := h.prepareArchive(w, zone, pool, &req, userCtx)
+		if !ok {
+			return
+		}
+		description = fmt.Sprintf("Archive %s to %s", items, req.Destination)
+		fn = func(run *jobRun) error { return h.runArchiveJob(run, zone, pool, req.Paths, dest, userCtx) }
+
+	case models.JobTypeExtract:
+		t, archivePath, format, ok := h.prepareExtract(w, zone, pool, &req, userCtx)
+		if !ok {
+			return
+		}
+		description = fmt.Sprintf("Extract %s to %s", req.Paths[0], req.Destination)
+		fn = func(run *jobRun) error {
+			t.run = run
+			return runExtractJob(run, t, archivePath, format)
+		}
+
+	case models.JobTypeChecksum:
+		description = "Checksum " + items
+		fn = func(run *jobRun) error { return h.runChecksumJob(run, zone, pool, req.Paths, userCtx) }
+
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid job type (must be delete, copy, archive, extract or checksum)", nil)
+		return
+	}
+
+	params, _ := json.Marshal(req)
+	job := &models.Job{
+		Type:        req.Type,
+		UserID:      userCtx.UserID,
+		Username:    userCtx.Username,
+		ZoneID:      zone.ID,
+		Description: description,
+		Params:      params,
+	}
+	if err := h.jobs.Submit(job, fn); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := h.jobs.Get(job.ID)
+	if err != nil {
+		resp = job
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writerFor resolves the destination folder of a copy or extraction
+func (h *JobHandler) writerFor(w http.ResponseWriter, zone *models.ShareZone, pool *models.StoragePool, destination, collision string, userCtx *middleware.UserContext) (*treeWriter, bool) {
+	if destination == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Destination is required", nil)
+		return nil, false
+	}
+	target, _, _, err := h.files.resolveZonePathWithPool(zone.ID, destination, userFromContext(userCtx))
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return nil, false
+	}
+	if info, err := os.Stat(target); err == nil && !info.IsDir() {
+		apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Destination is a file", nil)
+		return nil, false
+	}
+
+	return &treeWriter{
+		store:     h.store,
+		zone:      zone,
+		pool:      pool,
+		root:      filepath.Join(pool.Path, zone.Path),
+		target:    target,
+		collision: collision,
+		userCtx:   userCtx,
+	}, true
+}
+
+// authorizedJob returns the job named in the URL if the user may see it
+func (h *JobHandler) authorizedJob(w http.ResponseWriter, r *http.Request) (*models.Job, *middleware.UserContext, bool) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return nil, nil, false
+	}
+
+	job, err := h.jobs.Get(chi.URLParam(r, "id"))
+	if err != nil || (job.UserID != userCtx.UserID && !userCtx.IsAdmin) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeJobNotFound, "Job not found", nil)
+		return nil, nil, false
+	}
+	return job, userCtx, true
+}
+
+// GetJob returns a job with its current progress
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, _, ok := h.authorizedJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// CancelJob stops a queued or running job. Work already done is kept.
+func (h *JobHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, _, ok := h.authorizedJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Finished() || !h.jobs.Cancel(job.ID) {
+		apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Job has already finished", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Job cancellation requested",
+	})
+}
+
+// DeleteJob removes a finished job from the history
+func (h *JobHandler) DeleteJob(w http.ResponseWriter, r *http.Request) {
+	job, _, ok := h.authorizedJob(w, r)
+	if !ok {
+		return
+	}
+	if !job.Finished() {
+		apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Job is still running; cancel it first", nil)
+		return
+	}
+	if err := h.store.DeleteJob(job.ID); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
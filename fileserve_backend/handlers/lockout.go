@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// lockoutKey builds the storage key for a lockout counter
+func lockoutKey(scope models.LockoutScope, subject string) string {
+	return string(scope) + ":" + subject
+}
+
+// GetLockoutPolicyFromStore returns the brute-force protection settings
+func GetLockoutPolicyFromStore(store storage.DataStore) models.LockoutPolicy {
+	intSetting := func(key string, def int) int {
+		setting, err := store.GetSetting(key)
+		if err != nil || setting == nil {
+			return def
+		}
+		v, err := strconv.Atoi(setting.Value)
+		if err != nil || v <= 0 {
+			return def
+		}
+		return v
+	}
+
+	return models.LockoutPolicy{
+		MaxAttempts:  intSetting(models.SettingLockoutMaxAttempts, models.DefaultLockoutMaxAttempts),
+		Window:       time.Duration(intSetting(models.SettingLockoutWindow, models.DefaultLockoutWindowMins)) * time.Minute,
+		BaseDuration: time.Duration(intSetting(models.SettingLockoutBase, models.DefaultLockoutBaseMins)) * time.Minute,
+		MaxDuration:  time.Duration(intSetting(models.SettingLockoutMax, models.DefaultLockoutMaxMins)) * time.Minute,
+	}
+}
+
+// checkLockout returns how long the caller must wait if any of the given counters is locked
+func checkLockout(store storage.DataStore, keys ...string) time.Duration {
+	var wait time.Duration
+	for _, key := range keys {
+		l, err := store.GetLockout(key)
+		if err != nil || !l.IsLocked() {
+			continue
+		}
+		if remaining := time.Until(*l.LockedUntil); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait
+}
+
+// lockoutMu serializes updates of lockout counters, so concurrent attempts are all counted
+var lockoutMu sync.Mutex
+
+// beginLoginAttempt counts a password login as failed before its credentials are checked, so
+// parallel attempts cannot all get past the limit. It returns how long the caller must wait
+// instead when the client IP or the account is locked.
+func beginLoginAttempt(store storage.DataStore, clientIP, username string) time.Duration {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	ipKey := lockoutKey(models.LockoutScopeLoginIP, clientIP)
+	accountKey := lockoutKey(models.LockoutScopeLoginAccount, strings.ToLower(username))
+	if wait := checkLockout(store, ipKey, accountKey); wait > 0 {
+		return wait
+	}
+	countAuthFailure(store, models.LockoutScopeLoginIP, clientIP)
+	if username != "" {
+		countAuthFailure(store, models.LockoutScopeLoginAccount, strings.ToLower(username))
+	}
+	return 0
+}
+
+// endLoginAttempt takes a successful login back from the client IP counter and resets the
+// counter of the account. The IP counter is left to expire, so signing in to one account does
+// not wipe out failed guesses at others from the same address.
+func endLoginAttempt(store storage.DataStore, clientIP, username string) {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	uncountAuthFailure(store, lockoutKey(models.LockoutScopeLoginIP, clientIP))
+	store.DeleteLockout(lockoutKey(models.LockoutScopeLoginAccount, strings.ToLower(username)))
+}
+
+// uncountAuthFailure takes back an attempt counted by countAuthFailure, unlocking the counter
+// when it drops below the attempt limit. Callers hold lockoutMu.
+func uncountAuthFailure(store storage.DataStore, key string) {
+	l, err := store.GetLockout(key)
+	if err != nil {
+		return
+	}
+	l.Failures--
+	if l.Failures <= 0 {
+		store.DeleteLockout(key)
+		return
+	}
+	if l.Failures < GetLockoutPolicyFromStore(store).MaxAttempts {
+		l.LockedUntil = nil
+	}
+	if err := store.SaveLockout(l); err != nil {
+		log.Printf("Lockout: failed to save %s: %v", key, err)
+	}
+}
+
+// recordAuthFailure counts a failed attempt and locks the subject out with exponential backoff
+// once the policy's attempt limit is reached within the window
+func recordAuthFailure(store storage.DataStore, scope models.LockoutScope, subject string) {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+	countAuthFailure(store, scope, subject)
+}
+
+// countAuthFailure is recordAuthFailure for callers holding lockoutMu
+func countAuthFailure(store storage.DataStore, scope models.LockoutScope, subject string) {
+	policy := GetLockoutPolicyFromStore(store)
+	now := time.Now()
+	key := lockoutKey(scope, subject)
+
+	l, err := store.GetLockout(key)
+	if err != nil {
+		l = &models.Lockout{Key: key, Scope: scope, Subject: subject}
+	} else if !l.IsLocked() && now.Sub(l.LastFailure) > policy.Window {
+		// Previous failures have aged out
+		l.Failures = 0
+		l.LockedUntil = nil
+	}
+
+	l.Failures++
+	l.LastFailure = now
+
+	if l.Failures >= policy.MaxAttempts {
+		// Double the lockout for every failure past the limit
+		exp := l.Failures - policy.MaxAttempts
+		if exp > 30 {
+			exp = 30
+		}
+		d := time.Duration(float64(policy.BaseDuration) * math.Pow(2, float64(exp)))
+		if d > policy.MaxDuration || d <= 0 {
+			d = policy.MaxDuration
+		}
+		until := now.Add(d)
+		l.LockedUntil = &until
+		log.Printf("Lockout: %s locked for %s after %d failed attempts", key, d, l.Failures)
+	}
+
+	if err := store.SaveLockout(l); err != nil {
+		log.Printf("Lockout: failed to save %s: %v", key, err)
+	}
+
+	store.CleanStaleLockouts(now.Add(-policy.Window))
+}
+
+// clearAuthFailures resets counters after a successful authentication
+func clearAuthFailures(store storage.DataStore, keys ...string) {
+	for _, key := range keys {
+		store.DeleteLockout(key)
+	}
+}
+
+// writeLockedOut responds with 429 and a Retry-After header
+func writeLockedOut(w http.ResponseWriter, wait time.Duration, what string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	apierror.Write(w, http.StatusTooManyRequests, apierror.CodeRateLimited, fmt.Sprintf("Too many failed %s attempts. Try again in %s.", what, formatRetryWait(wait)), nil)
+}
+
+// formatRetryWait renders a lockout duration for error messages
+func formatRetryWait(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d seconds", int(math.Ceil(d.Seconds())))
+	}
+	return fmt.Sprintf("%d minutes", int(math.Ceil(d.Minutes())))
+}
+
+// ListLockouts returns all tracked lockout counters (admin only)
+func ListLockouts(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy := GetLockoutPolicyFromStore(store)
+		store.CleanStaleLockouts(time.Now().Add(-policy.Window))
+
+		lockouts := store.ListLockouts()
+		if r.URL.Query().Get("locked") == "true" {
+			active := []*models.Lockout{}
+			for _, l := range lockouts {
+				if l.IsLocked() {
+					active = append(active, l)
+				}
+			}
+			lockouts = active
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"lockouts": lockouts,
+			"policy": map[string]interface{}{
+				"max_attempts":   policy.MaxAttempts,
+				"window_minutes": int(policy.Window.Minutes()),
+				"base_minutes":   int(policy.BaseDuration.Minutes()),
+				"max_minutes":    int(policy.MaxDuration.Minutes()),
+			},
+		})
+	}
+}
+
+// ClearLockout removes one lockout counter by key, or all counters (admin only)
+func ClearLockout(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Key string `json:"key"`
+			All bool   `json:"all"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if req.All {
+			if err := store.ClearLockouts(); err != nil {
+				apierror.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "All lockouts cleared"})
+			return
+		}
+
+		req.Key = strings.TrimSpace(req.Key)
+		if req.Key == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Key is required", nil)
+			return
+		}
+
+		if err := store.DeleteLockout(req.Key); err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeLockoutNotFound, err.Error(), nil)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Lockout cleared"})
+	}
+}
@@ -0,0 +1,543 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/fileops"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// lockTokenPrefix is the URI scheme of lock tokens (RFC 4918)
+const lockTokenPrefix = "opaquelocktoken:"
+
+// fileLockMu serializes lock acquisition so two clients cannot both pass the conflict check
+var fileLockMu sync.Mutex
+
+// lockedError is returned when a change is refused because another user holds a lock
+type lockedError struct {
+	lock *models.FileLock
+}
+
+func (e *lockedError) Error() string {
+	return fmt.Sprintf("%s is locked by %s until %s", path.Base(e.lock.Path), e.lock.Username,
+		e.lock.ExpiresAt.Format(time.RFC3339))
+}
+
+// checkFileLock reports whether a user may change fullPath. A lock held by another user on the
+// path, or on a folder above it with depth infinity, refuses the change unless the user holds a
+// covering (shared) lock too. With recursive, as for deleting or moving a folder, locks held by
+// others anywhere below the path refuse it as well.
+func checkFileLock(store storage.DataStore, fullPath, userID string, recursive bool) error {
+	zone, root := zoneForPath(store, fullPath)
+	if zone == nil {
+		return nil
+	}
+	locks := store.ListFileLocks(zone.ID)
+	if len(locks) == 0 {
+		return nil
+	}
+
+	rel := usageRelPath(root, fullPath)
+	var blocking *models.FileLock
+	held := false
+	for _, lock := range locks {
+		switch {
+		case lock.Covers(rel):
+			if lock.UserID == userID {
+				held = true
+			} else if blocking == nil {
+				blocking = lock
+			}
+		case recursive && lock.UserID != userID && (rel == "/" || strings.HasPrefix(lock.Path, rel+"/")):
+			return &lockedError{lock: lock}
+		}
+	}
+	if blocking != nil && !held {
+		return &lockedError{lock: blocking}
+	}
+	return nil
+}
+
+// writeLockError writes a 423 response for a lockedError, or a 500 for other errors
+func writeLockError(w http.ResponseWriter, err error) {
+	var locked *lockedError
+	if errors.As(err, &locked) {
+		apierror.Write(w, http.StatusLocked, apierror.CodeLocked, err.Error(), nil)
+		return
+	}
+	apierror.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// attachFileLocks marks the files listed in dir that are covered by an active lock
+func attachFileLocks(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool, dir string, files []fileops.FileInfo) {
+	if len(files) == 0 {
+		return
+	}
+	locks := store.ListFileLocks(zone.ID)
+	if len(locks) == 0 {
+		return
+	}
+	root := filepath.Join(pool.Path, zone.Path)
+	for i := range files {
+		rel := usageRelPath(root, filepath.Join(dir, files[i].Name))
+		for _, lock := range locks {
+			if lock.Covers(rel) {
+				files[i].Lock = &fileops.LockInfo{
+					Username:  lock.Username,
+					Scope:     lock.Scope,
+					Owner:     lock.Owner,
+					ExpiresAt: lock.ExpiresAt,
+				}
+				break
+			}
+		}
+	}
+}
+
+// normalizeLockToken accepts a token with or without its URI scheme and angle brackets
+func normalizeLockToken(token string) string {
+	token = strings.Trim(strings.TrimSpace(token), "<>")
+	if token == "" || strings.HasPrefix(token, lockTokenPrefix) {
+		return token
+	}
+	return lockTokenPrefix + token
+}
+
+// ============================================================================
+// HTTP Handlers
+// ============================================================================
+
+// LockHandler manages advisory file locks through the web API and WebDAV LOCK/UNLOCK requests
+type LockHandler struct {
+	store storage.DataStore
+	files *ZoneFileHandler
+}
+
+// NewLockHandler creates a new handler
+func NewLockHandler(store storage.DataStore) *LockHandler {
+	return &LockHandler{
+		store: store,
+		files: NewZoneFileHandler(store),
+	}
+}
+
+// lockTarget is a resolved path to lock
+type lockTarget struct {
+	zone  *models.ShareZone
+	rel   string // Path relative to the zone root
+	scope string // Part of the zone visible to the user ("/" or "/alice" in a personal zone)
+}
+
+// resolveLockTarget resolves the zone path of a lock request. The path must exist or be a new
+// file in an existing folder, so clients can reserve a name before creating it.
+func (h *LockHandler) resolveLockTarget(w http.ResponseWriter, r *http.Request, userCtx *middleware.UserContext) (*lockTarget, bool) {
+	user := userFromContext(userCtx)
+	fullPath, zone, pool, err := h.files.resolveZonePathWithPool(chi.URLParam(r, "zoneId"), chi.URLParam(r, "*"), user)
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return nil, false
+	}
+	if pool.IsS3() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "File locks are not available on object storage pools", nil)
+		return nil, false
+	}
+	if zone.ReadOnly {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
+		return nil, false
+	}
+
+	root := filepath.Join(pool.Path, zone.Path)
+	if fullPath == root {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "The zone root cannot be locked", nil)
+		return nil, false
+	}
+	if _, err := os.Stat(fullPath); err != nil {
+		if info, err := os.Stat(filepath.Dir(fullPath)); err != nil || !info.IsDir() {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+			return nil, false
+		}
+	}
+
+	scope := "/"
+	if zone.ZoneType == models.ZoneTypePersonal {
+		scope = "/" + user.Username
+	}
+	return &lockTarget{zone: zone, rel: usageRelPath(root, fullPath), scope: scope}, true
+}
+
+// acquire creates a lock unless it conflicts with an active one. An exclusive lock conflicts
+// with every lock on an overlapping path; shared locks only conflict with exclusive ones.
+func (h *LockHandler) acquire(t *lockTarget, req *models.FileLockRequest, userCtx *middleware.UserContext) (*models.FileLock, error) {
+	now := time.Now()
+	lock := &models.FileLock{
+		Token:     lockTokenPrefix + uuid.New().String(),
+		ZoneID:    t.zone.ID,
+		Path:      t.rel,
+		UserID:    userCtx.UserID,
+		Username:  userCtx.Username,
+		Scope:     req.Scope,
+		Depth:     req.Depth,
+		Owner:     req.Owner,
+		Timeout:   req.Timeout,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(req.Timeout) * time.Second),
+	}
+
+	fileLockMu.Lock()
+	defer fileLockMu.Unlock()
+
+	h.store.PruneFileLocks(now)
+	for _, existing := range h.store.ListFileLocks(t.zone.ID) {
+		if !existing.Covers(lock.Path) && !lock.Covers(existing.Path) {
+			continue
+		}
+		if lock.Scope == models.LockScopeExclusive || existing.Scope == models.LockScopeExclusive {
+			return nil, &lockedError{lock: existing}
+		}
+	}
+	if err := h.store.CreateFileLock(lock); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// normalizeLockRequest fills in defaults and validates a lock request
+func normalizeLockRequest(req *models.FileLockRequest) error {
+	switch req.Scope {
+	case "":
+		req.Scope = models.LockScopeExclusive
+	case models.LockScopeExclusive, models.LockScopeShared:
+	default:
+		return errors.New("scope must be exclusive or shared")
+	}
+	switch req.Depth {
+	case "":
+		req.Depth = models.LockDepthZero
+	case models.LockDepthZero, models.LockDepthInfinity:
+	default:
+		return errors.New("depth must be 0 or infinity")
+	}
+	if req.Timeout <= 0 {
+		req.Timeout = int(models.DefaultLockTimeout / time.Second)
+	}
+	req.Timeout = min(req.Timeout, int(models.MaxLockTimeout/time.Second))
+	req.Owner = strings.TrimSpace(req.Owner)
+	if len(req.Owner) > 256 {
+		return errors.New("owner is longer than 256 characters")
+	}
+	return nil
+}
+
+// presentLock returns a copy of a lock with its path relative to the part of the zone the user
+// sees. Tokens are only shown to the lock holder.
+func presentLock(lock *models.FileLock, scope string, userCtx *middleware.UserContext) *models.FileLock {
+	shown := *lock
+	if prefix := strings.TrimSuffix(scope, "/"); prefix != "" {
+		shown.Path = strings.TrimPrefix(shown.Path, prefix)
+	}
+	if lock.UserID != userCtx.UserID {
+		shown.Token = ""
+	}
+	return &shown
+}
+
+// ListZoneLocks lists the active locks in the part of a zone visible to the user, optionally
+// below a folder given by path
+func (h *LockHandler) ListZoneLocks(w http.ResponseWriter, r *http.Request) {
+	zone, scope, ok := h.files.zoneScope(w, r)
+	if !ok {
+		return
+	}
+	userCtx := middleware.GetUserContext(r)
+
+	prefix := strings.TrimSuffix(scope, "/") + filepath.Clean("/"+r.URL.Query().Get("path"))
+	locks := []*models.FileLock{}
+	for _, lock := range h.store.ListFileLocks(zone.ID) {
+		if prefix != "/" && lock.Path != prefix && !strings.HasPrefix(lock.Path, prefix+"/") {
+			continue
+		}
+		locks = append(locks, presentLock(lock, scope, userCtx))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(locks)
+}
+
+// LockZoneFile locks a file or folder
+func (h *LockHandler) LockZoneFile(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	var req models.FileLockRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+	}
+	if err := normalizeLockRequest(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	t, ok := h.resolveLockTarget(w, r, userCtx)
+	if !ok {
+		return
+	}
+	lock, err := h.acquire(t, &req, userCtx)
+	if err != nil {
+		writeLockError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(presentLock(lock, t.scope, userCtx))
+}
+
+// ListLocks lists the active locks of every zone (admin only)
+func (h *LockHandler) ListLocks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.ListFileLocks(""))
+}
+
+// RefreshLock extends a lock held by the user by its timeout, or by a new one given in the body
+func (h *LockHandler) RefreshLock(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	lock, err := h.store.GetFileLock(normalizeLockToken(chi.URLParam(r, "token")))
+	if err != nil || lock.UserID != userCtx.UserID {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeLockNotFound, "Lock not found", nil)
+		return
+	}
+
+	var req struct {
+		Timeout int `json:"timeout"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+	}
+	if req.Timeout > 0 {
+		lock.Timeout = min(req.Timeout, int(models.MaxLockTimeout/time.Second))
+	}
+	lock.ExpiresAt = time.Now().Add(time.Duration(lock.Timeout) * time.Second)
+	if err := h.store.RefreshFileLock(lock.Token, lock.Timeout, lock.ExpiresAt); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeLockNotFound, "Lock not found", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lock)
+}
+
+// ReleaseLock removes a lock. Admins can release other users' locks.
+func (h *LockHandler) ReleaseLock(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	lock, err := h.store.GetFileLock(normalizeLockToken(chi.URLParam(r, "token")))
+	if err != nil || (lock.UserID != userCtx.UserID && !userCtx.IsAdmin) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeLockNotFound, "Lock not found", nil)
+		return
+	}
+	if err := h.store.DeleteFileLock(lock.Token); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeLockNotFound, "Lock not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ============================================================================
+// WebDAV LOCK and UNLOCK
+// ============================================================================
+
+// davLockInfo is the body of a WebDAV LOCK request
+type davLockInfo struct {
+	XMLName   xml.Name  `xml:"DAV: lockinfo"`
+	Exclusive *struct{} `xml:"DAV: lockscope>exclusive"`
+	Shared    *struct{} `xml:"DAV: lockscope>shared"`
+	Owner     struct {
+		Href string `xml:"DAV: href"`
+		Text string `xml:",chardata"`
+	} `xml:"DAV: owner"`
+}
+
+// parseDAVTimeout reads the first usable value of a Timeout header ("Second-600, Infinite")
+func parseDAVTimeout(header string) int {
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimSpace(value)
+		if strings.EqualFold(value, "Infinite") {
+			return int(models.MaxLockTimeout / time.Second)
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(value, "Second-")); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// ifHeaderToken returns the first lock token of a WebDAV If header
+func ifHeaderToken(header string) string {
+	start := strings.Index(header, "<"+lockTokenPrefix)
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(header[start:], ">")
+	if end < 0 {
+		return ""
+	}
+	return header[start+1 : start+end]
+}
+
+// writeLockDiscovery writes the lockdiscovery property of a lock in reply to a LOCK request
+func writeLockDiscovery(w http.ResponseWriter, r *http.Request, lock *models.FileLock, status int) {
+	timeout := "Second-" + strconv.Itoa(lock.Timeout)
+	owner := ""
+	if lock.Owner != "" {
+		owner = "<D:owner><D:href>" + html.EscapeString(lock.Owner) + "</D:href></D:owner>"
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Lock-Token", "<"+lock.Token+">")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+
+		`<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>`+
+		`<D:locktype><D:write/></D:locktype><D:lockscope><D:%s/></D:lockscope><D:depth>%s</D:depth>%s`+
+		`<D:timeout>%s</D:timeout><D:locktoken><D:href>%s</D:href></D:locktoken>`+
+		`<D:lockroot><D:href>%s</D:href></D:lockroot></D:activelock></D:lockdiscovery></D:prop>`,
+		lock.Scope, lock.Depth, owner, timeout, html.EscapeString(lock.Token), html.EscapeString(r.URL.EscapedPath()))
+}
+
+// LockWebDAV handles a WebDAV LOCK request on a zone file. A request with a lockinfo body creates
+// a lock; an empty body with the lock token in the If header refreshes it. The locks are the same
+// as those of the web API, so WebDAV clients and browsers see each other's locks.
+func (h *LockHandler) LockWebDAV(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+	timeout := parseDAVTimeout(r.Header.Get("Timeout"))
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	// Refresh
+	if len(strings.TrimSpace(string(body))) == 0 {
+		lock, err := h.store.GetFileLock(ifHeaderToken(r.Header.Get("If")))
+		if err != nil || lock.UserID != userCtx.UserID {
+			apierror.Write(w, http.StatusPreconditionFailed, apierror.CodePreconditionFailed, "Lock not found", nil)
+			return
+		}
+		if timeout > 0 {
+			lock.Timeout = min(timeout, int(models.MaxLockTimeout/time.Second))
+		}
+		lock.ExpiresAt = time.Now().Add(time.Duration(lock.Timeout) * time.Second)
+		if err := h.store.RefreshFileLock(lock.Token, lock.Timeout, lock.ExpiresAt); err != nil {
+			apierror.Write(w, http.StatusPreconditionFailed, apierror.CodePreconditionFailed, "Lock not found", nil)
+			return
+		}
+		writeLockDiscovery(w, r, lock, http.StatusOK)
+		return
+	}
+
+	var info davLockInfo
+	if err := xml.Unmarshal(body, &info); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid lockinfo", nil)
+		return
+	}
+	req := models.FileLockRequest{
+		Scope:   models.LockScopeExclusive,
+		Depth:   models.LockDepthInfinity,
+		Owner:   strings.TrimSpace(info.Owner.Href),
+		Timeout: timeout,
+	}
+	if info.Shared != nil {
+		req.Scope = models.LockScopeShared
+	}
+	if req.Owner == "" {
+		req.Owner = strings.TrimSpace(info.Owner.Text)
+	}
+	if depth := r.Header.Get("Depth"); depth == "0" {
+		req.Depth = models.LockDepthZero
+	} else if depth != "" && !strings.EqualFold(depth, "infinity") {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Depth must be 0 or infinity", nil)
+		return
+	}
+	if err := normalizeLockRequest(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	t, ok := h.resolveLockTarget(w, r, userCtx)
+	if !ok {
+		return
+	}
+	lock, err := h.acquire(t, &req, userCtx)
+	if err != nil {
+		writeLockError(w, err)
+		return
+	}
+	writeLockDiscovery(w, r, lock, http.StatusOK)
+}
+
+// UnlockWebDAV handles a WebDAV UNLOCK request; the token is taken from the Lock-Token header
+func (h *LockHandler) UnlockWebDAV(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	token := normalizeLockToken(r.Header.Get("Lock-Token"))
+	if token == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Lock-Token header is required", nil)
+		return
+	}
+	lock, err := h.store.GetFileLock(token)
+	if err != nil || lock.ZoneID != chi.URLParam(r, "zoneId") || (lock.UserID != userCtx.UserID && !userCtx.IsAdmin) {
+		apierror.Write(w, http.StatusConflict, apierror.CodeLockNotFound, "Lock not found", nil)
+		return
+	}
+	h.store.DeleteFileLock(lock.Token)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/sysconf"
+	"fileserv/models"
+)
+
+const (
+	crypttabPath = "/etc/crypttab"
+
+	// luksKeyDir is where systemd-cryptsetup looks for <name>.key keyfiles
+	luksKeyDir = "/etc/cryptsetup-keys.d"
+
+	luksKeyFileSize = 4096
+)
+
+// crypttabMu serializes edits to /etc/crypttab and the keyfile directory
+var crypttabMu sync.Mutex
+
+// luksMapperNameRegex validates a device-mapper name for an unlocked container
+var luksMapperNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// validateLUKSDevice checks that device is a /dev path
+func validateLUKSDevice(device string) error {
+	if err := validateDevicePath(device); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(device, "/dev/") {
+		return fmt.Errorf("device must be a /dev path")
+	}
+	return nil
+}
+
+// validateLUKSPassphrase checks the passphrase length. It is passed to cryptsetup on stdin,
+// never on the command line.
+func validateLUKSPassphrase(passphrase string) error {
+	if len(passphrase) < 8 {
+		return fmt.Errorf("passphrase must be at least 8 characters")
+	}
+	if len(passphrase) > 512 {
+		return fmt.Errorf("passphrase too long (max 512 characters)")
+	}
+	return nil
+}
+
+// cryptsetup runs cryptsetup with the key material on stdin
+func cryptsetup(stdin string, args ...string) error {
+	cmd := exec.Command("cryptsetup", args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s", commandError(output, err))
+	}
+	return nil
+}
+
+// luksUUID returns the UUID of a LUKS container, failing when device is not one
+func luksUUID(device string) (string, error) {
+	output, err := exec.Command("cryptsetup", "luksUUID", device).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s is not a LUKS device", device)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// crypttabEntry is a line of /etc/crypttab: <name> <device> <keyfile> <options>
+type crypttabEntry struct {
+	Name    string
+	Device  string
+	KeyFile string
+}
+
+// readCrypttab returns the lines of /etc/crypttab and the entries parsed from them
+func readCrypttab() ([]string, []crypttabEntry, error) {
+	data, err := os.ReadFile(crypttabPath)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	var entries []crypttabEntry
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		entry := crypttabEntry{Name: fields[0], Device: fields[1]}
+		if len(fields) > 2 && fields[2] != "none" && fields[2] != "-" {
+			entry.KeyFile = fields[2]
+		}
+		entries = append(entries, entry)
+	}
+	return lines, entries, nil
+}
+
+// crypttabEntryFor finds the crypttab entry of a container by UUID or device path
+func crypttabEntryFor(entries []crypttabEntry, uuid, device string) (crypttabEntry, bool) {
+	for _, entry := range entries {
+		if entry.Device == "UUID="+uuid || entry.Device == device {
+			return entry, true
+		}
+	}
+	return crypttabEntry{}, false
+}
+
+// writeCrypttab replaces the entries for the container (and any entry using name) with entry,
+// or just removes them when entry is nil
+func writeCrypttab(uuid, device, name string, entry *crypttabEntry) error {
+	lines, _, err := readCrypttab()
+	if err != nil {
+		return err
+	}
+
+	var newLines []string
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") &&
+			(fields[1] == "UUID="+uuid || fields[1] == device || (name != "" && fields[0] == name)) {
+			continue
+		}
+		newLines = append(newLines, line)
+	}
+	if entry != nil {
+		newLines = append(newLines, fmt.Sprintf("%s %s %s luks", entry.Name, entry.Device, entry.KeyFile))
+	}
+
+	content := strings.Join(newLines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	return sysconf.WriteFile(crypttabPath, []byte(content), 0600)
+}
+
+// getLUKSDevices lists the LUKS containers on the system and their unlocked mappers
+func getLUKSDevices() ([]models.LUKSDevice, error) {
+	output, err := exec.Command("lsblk", "-J", "-b", "-o", "NAME,PATH,SIZE,TYPE,FSTYPE,UUID,MOUNTPOINT").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block devices: %v", err)
+	}
+
+	type blockDevice struct {
+		Name       string        `json:"name"`
+		Path       string        `json:"path"`
+		Size       interface{}   `json:"size"` // Can be string or int
+		Type       string        `json:"type"`
+		FSType     string        `json:"fstype"`
+		UUID       string        `json:"uuid"`
+		MountPoint string        `json:"mountpoint"`
+		Children   []blockDevice `json:"children"`
+	}
+	var lsblkOutput struct {
+		BlockDevices []blockDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(output, &lsblkOutput); err != nil {
+		return nil, fmt.Errorf("failed to parse lsblk output: %v", err)
+	}
+
+	_, entries, _ := readCrypttab()
+
+	devices := []models.LUKSDevice{}
+	seen := make(map[string]bool)
+	var walk func(devs []blockDevice)
+	walk = func(devs []blockDevice) {
+		for _, dev := range devs {
+			if dev.FSType == "crypto_LUKS" && !seen[dev.Path] {
+				seen[dev.Path] = true
+
+				var size uint64
+				switch v := dev.Size.(type) {
+				case float64:
+					size = uint64(v)
+				case string:
+					size, _ = parseSize(v)
+				}
+
+				luks := models.LUKSDevice{
+					Device:    dev.Path,
+					UUID:      dev.UUID,
+					Size:      size,
+					SizeHuman: formatBytes(size),
+				}
+				for _, child := range dev.Children {
+					if child.Type == "crypt" {
+						luks.Open = true
+						luks.MapperName = child.Name
+						luks.MapperPath = child.Path
+						luks.FSType = child.FSType
+						luks.FSUUID = child.UUID
+						luks.MountPoint = child.MountPoint
+						break
+					}
+				}
+				if entry, ok := crypttabEntryFor(entries, dev.UUID, dev.Path); ok {
+					if luks.MapperName == "" {
+						luks.MapperName = entry.Name
+					}
+					luks.AutoUnlock = entry.KeyFile != ""
+					luks.KeyFile = entry.KeyFile
+				}
+				devices = append(devices, luks)
+			}
+			walk(dev.Children)
+		}
+	}
+	walk(lsblkOutput.BlockDevices)
+
+	return devices, nil
+}
+
+// ListLUKSDevices lists LUKS encrypted containers
+func ListLUKSDevices() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		devices, err := getLUKSDevices()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(devices)
+	}
+}
+
+// FormatLUKSDevice initializes an unused device as a LUKS2 container
+func FormatLUKSDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Device     string `json:"device"`
+			Passphrase string `json:"passphrase"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateLUKSDevice(req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateLUKSPassphrase(req.Passphrase); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		// Same rule as for pools and arrays: only blank, unused devices are formatted
+		if err := checkZFSDeviceAvailable(req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		if err := cryptsetup(req.Passphrase, "luksFormat", "--type", "luks2", "--batch-mode", "--key-file=-", req.Device); err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to format device: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		uuid, _ := luksUUID(req.Device)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Device '%s' formatted as LUKS", req.Device),
+			"uuid":    uuid,
+		})
+	}
+}
+
+// OpenLUKSDevice unlocks a LUKS container with a passphrase, or with its stored keyfile when
+// no passphrase is given
+func OpenLUKSDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Device     string `json:"device"`
+			Name       string `json:"name"` // Mapper name, unlocked as /dev/mapper/<name>
+			Passphrase string `json:"passphrase"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateLUKSDevice(req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		uuid, err := luksUUID(req.Device)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		keyFile := "-"
+		if req.Passphrase == "" {
+			_, entries, _ := readCrypttab()
+			entry, ok := crypttabEntryFor(entries, uuid, req.Device)
+			if !ok || entry.KeyFile == "" {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Passphrase required: no keyfile is stored for this device", nil)
+				return
+			}
+			keyFile = entry.KeyFile
+			if req.Name == "" {
+				req.Name = entry.Name
+			}
+		}
+
+		if !luksMapperNameRegex.MatchString(req.Name) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid name: use letters, digits, underscore, period and hyphen", nil)
+			return
+		}
+		if _, err := os.Stat(filepath.Join("/dev/mapper", req.Name)); err == nil {
+			apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, fmt.Sprintf("/dev/mapper/%s already exists", req.Name), nil)
+			return
+		}
+
+		if err := cryptsetup(req.Passphrase, "open", "--type", "luks", "--key-file="+keyFile, req.Device, req.Name); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Failed to unlock device: %s", err.Error()), nil)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Device '%s' unlocked", req.Device),
+			"path":    "/dev/mapper/" + req.Name,
+		})
+	}
+}
+
+// CloseLUKSDevice locks an unlocked container that is not mounted
+func CloseLUKSDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if !luksMapperNameRegex.MatchString(req.Name) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid name", nil)
+			return
+		}
+
+		devices, err := getLUKSDevices()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		found := false
+		for _, dev := range devices {
+			if dev.Open && dev.MapperName == req.Name {
+				if dev.MountPoint != "" {
+					apierror.Write(w, http.StatusBadRequest, apierror.CodeDeviceMounted, fmt.Sprintf("/dev/mapper/%s is mounted at %s", req.Name, dev.MountPoint), nil)
+					return
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeDeviceNotFound, fmt.Sprintf("No unlocked LUKS device named '%s'", req.Name), nil)
+			return
+		}
+
+		if err := cryptsetup("", "close", req.Name); err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to lock device: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Device '%s' locked", req.Name),
+		})
+	}
+}
+
+// EnableLUKSAutoUnlock adds a generated keyfile to a container and a crypttab entry so it is
+// unlocked at boot
+func EnableLUKSAutoUnlock() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Device     string `json:"device"`
+			Name       string `json:"name"`       // Mapper name used at boot
+			Passphrase string `json:"passphrase"` // Existing passphrase, authorizes the new key
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateLUKSDevice(req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if !luksMapperNameRegex.MatchString(req.Name) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid name: use letters, digits, underscore, period and hyphen", nil)
+			return
+		}
+		if req.Passphrase == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Passphrase required", nil)
+			return
+		}
+		uuid, err := luksUUID(req.Device)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		crypttabMu.Lock()
+		defer crypttabMu.Unlock()
+
+		_, entries, err := readCrypttab()
+		if err != nil {
+			apierror.Error(w, "Failed to read crypttab: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if entry, ok := crypttabEntryFor(entries, uuid, req.Device); ok && entry.KeyFile != "" {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Automatic unlock is already enabled for this device", nil)
+			return
+		}
+		for _, entry := range entries {
+			if entry.Name == req.Name && entry.Device != "UUID="+uuid && entry.Device != req.Device {
+				apierror.Write(w, http.StatusConflict, apierror.CodeConflict, fmt.Sprintf("crypttab already uses the name '%s' for %s", req.Name, entry.Device), nil)
+				return
+			}
+		}
+
+		keyFile := filepath.Join(luksKeyDir, req.Name+".key")
+		if _, err := os.Stat(keyFile); err == nil {
+			apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, fmt.Sprintf("Keyfile %s already exists", keyFile), nil)
+			return
+		}
+
+		key := make([]byte, luksKeyFileSize)
+		if _, err := rand.Read(key); err != nil {
+			apierror.Error(w, "Failed to generate keyfile: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := os.MkdirAll(luksKeyDir, 0700); err != nil {
+			apierror.Error(w, "Failed to create keyfile directory: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := os.WriteFile(keyFile, key, 0400); err != nil {
+			apierror.Error(w, "Failed to write keyfile: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := cryptsetup(req.Passphrase, "luksAddKey", "--batch-mode", "--key-file=-", req.Device, keyFile); err != nil {
+			os.Remove(keyFile)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Failed to add keyfile to device: %s", err.Error()), nil)
+			return
+		}
+
+		entry := &crypttabEntry{Name: req.Name, Device: "UUID=" + uuid, KeyFile: keyFile}
+		if err := writeCrypttab(uuid, req.Device, req.Name, entry); err != nil {
+			cryptsetup("", "luksRemoveKey", "--batch-mode", req.Device, keyFile)
+			os.Remove(keyFile)
+			apierror.Error(w, "Failed to update crypttab: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message":  fmt.Sprintf("Device '%s' will be unlocked at boot as /dev/mapper/%s", req.Device, req.Name),
+			"key_file": keyFile,
+		})
+	}
+}
+
+// DisableLUKSAutoUnlock removes the stored keyfile from a container and its crypttab entry.
+// The container's passphrases are left alone.
+func DisableLUKSAutoUnlock() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Device string `json:"device"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateLUKSDevice(req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		uuid, err := luksUUID(req.Device)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		crypttabMu.Lock()
+		defer crypttabMu.Unlock()
+
+		_, entries, err := readCrypttab()
+		if err != nil {
+			apierror.Error(w, "Failed to read crypttab: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entry, ok := crypttabEntryFor(entries, uuid, req.Device)
+		if !ok {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Automatic unlock is not enabled for this device", nil)
+			return
+		}
+
+		// Only keyfiles this server generated are removed from the container
+		if entry.KeyFile != "" && filepath.Dir(entry.KeyFile) == luksKeyDir {
+			if _, err := os.Stat(entry.KeyFile); err == nil {
+				if err := cryptsetup("", "luksRemoveKey", "--batch-mode", req.Device, entry.KeyFile); err != nil {
+					apierror.Error(w, fmt.Sprintf("Failed to remove keyfile from device: %s", err.Error()), http.StatusInternalServerError)
+					return
+				}
+				os.Remove(entry.KeyFile)
+			}
+		}
+
+		if err := writeCrypttab(uuid, req.Device, "", nil); err != nil {
+			apierror.Error(w, "Failed to update crypttab: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Automatic unlock disabled for '%s'", req.Device),
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+)
+
+// lvmDeviceExtentRegex strips the extent offset lvs appends to device names, e.g. /dev/sdb(0)
+var lvmDeviceExtentRegex = regexp.MustCompile(`\(\d+\)$`)
+
+// lvmPVInfo is what pvs reports about one device
+type lvmPVInfo struct {
+	VGName string
+	Size   uint64
+	Used   uint64
+}
+
+// getLVMPVInfo returns the physical volume on a device, or false when the device is not a PV
+func getLVMPVInfo(device string) (*lvmPVInfo, bool) {
+	output, err := exec.Command("pvs", "--reportformat", "json", "--units", "b", "-o", "pv_name,vg_name,pv_size,pv_used", device).Output()
+	if err != nil {
+		return nil, false
+	}
+	var pvsOutput struct {
+		Report []struct {
+			PV []struct {
+				VGName string `json:"vg_name"`
+				PVSize string `json:"pv_size"`
+				PVUsed string `json:"pv_used"`
+			} `json:"pv"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal(output, &pvsOutput); err != nil || len(pvsOutput.Report) == 0 || len(pvsOutput.Report[0].PV) != 1 {
+		return nil, false
+	}
+	pv := pvsOutput.Report[0].PV[0]
+	info := &lvmPVInfo{VGName: pv.VGName}
+	info.Size, _ = parseSize(pv.PVSize)
+	info.Used, _ = parseSize(pv.PVUsed)
+	return info, true
+}
+
+// getPVMoves returns the pvmove operations in progress
+func getPVMoves() ([]models.PVMoveStatus, error) {
+	moves := []models.PVMoveStatus{}
+	if !checkCommandExists("lvs") {
+		return moves, nil
+	}
+
+	output, err := execCommand("lvs", "-a", "--reportformat", "json", "-o", "vg_name,lv_name,lv_attr,copy_percent,devices")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logical volumes: %v", err)
+	}
+	var lvsOutput struct {
+		Report []struct {
+			LV []struct {
+				VGName      string `json:"vg_name"`
+				LVName      string `json:"lv_name"`
+				LVAttr      string `json:"lv_attr"`
+				CopyPercent string `json:"copy_percent"`
+				Devices     string `json:"devices"`
+			} `json:"lv"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal([]byte(output), &lvsOutput); err != nil {
+		return nil, err
+	}
+
+	for _, report := range lvsOutput.Report {
+		for _, lv := range report.LV {
+			// pvmove volumes have the 'p' volume type attribute
+			if !strings.HasPrefix(lv.LVAttr, "p") {
+				continue
+			}
+			move := models.PVMoveStatus{
+				VGName: lv.VGName,
+				Name:   strings.Trim(lv.LVName, "[]"),
+			}
+			move.Percent, _ = strconv.ParseFloat(lv.CopyPercent, 64)
+			devices := strings.Split(lv.Devices, ",")
+			if len(devices) > 0 {
+				move.Source = lvmDeviceExtentRegex.ReplaceAllString(devices[0], "")
+			}
+			if len(devices) > 1 {
+				move.Destination = lvmDeviceExtentRegex.ReplaceAllString(devices[1], "")
+			}
+			moves = append(moves, move)
+		}
+	}
+	return moves, nil
+}
+
+// ExtendVolumeGroup adds devices to a volume group. Blank devices are initialized as physical
+// volumes first; devices that already are unassigned physical volumes are added as they are.
+func ExtendVolumeGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.CreateVolumeGroupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateLVMName(req.Name, "volume group"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if len(req.Devices) == 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "At least one device is required", nil)
+			return
+		}
+
+		var create []string
+		for _, dev := range req.Devices {
+			if err := validateDevicePath(dev); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Invalid device %s: %v", dev, err), nil)
+				return
+			}
+			if pv, ok := getLVMPVInfo(dev); ok {
+				if pv.VGName != "" {
+					apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("%s already belongs to volume group %s", dev, pv.VGName), nil)
+					return
+				}
+				continue
+			}
+			if err := checkZFSDeviceAvailable(dev); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			create = append(create, dev)
+		}
+
+		for _, dev := range create {
+			output, err := exec.Command("pvcreate", dev).CombinedOutput()
+			if err != nil {
+				apierror.Error(w, fmt.Sprintf("Failed to create PV on %s: %s", dev, string(output)), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		args := append([]string{req.Name}, req.Devices...)
+		output, err := exec.Command("vgextend", args...).CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to extend VG: %s", string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf("Added %s to volume group %s", strings.Join(req.Devices, ", "), req.Name)})
+	}
+}
+
+// ReduceVolumeGroup removes an empty physical volume from a volume group, optionally wiping
+// its PV label. Data on the PV has to be moved off with pvmove first.
+func ReduceVolumeGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name     string `json:"name"`
+			Device   string `json:"device"`
+			RemovePV bool   `json:"remove_pv"` // Also remove the PV label so the disk is blank
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateLVMName(req.Name, "volume group"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateDevicePath(req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		pv, ok := getLVMPVInfo(req.Device)
+		if !ok || pv.VGName != req.Name {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("%s is not a physical volume of %s", req.Device, req.Name), nil)
+			return
+		}
+		if pv.Used > 0 {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, fmt.Sprintf("%s still holds %s of data: move it off with pvmove first", req.Device, formatBytes(pv.Used)), nil)
+			return
+		}
+
+		output, err := exec.Command("vgreduce", req.Name, req.Device).CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to reduce VG: %s", string(output)), http.StatusInternalServerError)
+			return
+		}
+		if req.RemovePV {
+			output, err := exec.Command("pvremove", "-y", req.Device).CombinedOutput()
+			if err != nil {
+				apierror.Error(w, fmt.Sprintf("Removed from VG but pvremove failed: %s", string(output)), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf("Removed %s from volume group %s", req.Device, req.Name)})
+	}
+}
+
+// StartPVMove moves the data off a physical volume in the background, to a given PV of the
+// same volume group or to wherever the group has free space. Progress is read with GetPVMoves.
+func StartPVMove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Source      string `json:"source"`
+			Destination string `json:"destination,omitempty"`
+			LV          string `json:"lv,omitempty"` // Only move the extents of this logical volume
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateDevicePath(req.Source); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		source, ok := getLVMPVInfo(req.Source)
+		if !ok || source.VGName == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("%s is not a physical volume in a volume group", req.Source), nil)
+			return
+		}
+		if source.Used == 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("%s holds no data", req.Source), nil)
+			return
+		}
+
+		moves, err := getPVMoves()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, move := range moves {
+			if move.VGName == source.VGName {
+				apierror.Write(w, http.StatusConflict, apierror.CodeBusy, fmt.Sprintf("A pvmove is already running in %s (%s, %.1f%%)", move.VGName, move.Source, move.Percent), nil)
+				return
+			}
+		}
+
+		args := []string{"-b"}
+		if req.LV != "" {
+			if err := validateLVMName(req.LV, "logical volume"); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			args = append(args, "-n", req.LV)
+		}
+		args = append(args, req.Source)
+
+		if req.Destination != "" {
+			if err := validateDevicePath(req.Destination); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			if req.Destination == req.Source {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Destination must differ from the source", nil)
+				return
+			}
+			dest, ok := getLVMPVInfo(req.Destination)
+			if !ok || dest.VGName != source.VGName {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("%s is not a physical volume of %s: add it with vgextend first", req.Destination, source.VGName), nil)
+				return
+			}
+			if free := dest.Size - dest.Used; req.LV == "" && free < source.Used {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("%s has %s free, %s needs %s", req.Destination, formatBytes(free), req.Source, formatBytes(source.Used)), nil)
+				return
+			}
+			args = append(args, req.Destination)
+		} else if req.LV == "" {
+			var free uint64
+			pvs, _ := getPhysicalVolumes(source.VGName)
+			for _, pv := range pvs {
+				if pv.Path != req.Source {
+					free += pv.Free
+				}
+			}
+			if free < source.Used {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("The other physical volumes of %s have %s free, %s needs %s: add a disk with vgextend first", source.VGName, formatBytes(free), req.Source, formatBytes(source.Used)), nil)
+				return
+			}
+		}
+
+		output, err := exec.Command("pvmove", args...).CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to start pvmove: %s", string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Moving %s of data off %s", formatBytes(source.Used), req.Source),
+			"vg_name": source.VGName,
+		})
+	}
+}
+
+// GetPVMoves returns the progress of running pvmove operations
+func GetPVMoves() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		moves, err := getPVMoves()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(moves)
+	}
+}
+
+// AbortPVMove stops all running pvmove operations. Segments already moved stay on the
+// destination; the rest stays on the source.
+func AbortPVMove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		output, err := exec.Command("pvmove", "--abort").CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to abort pvmove: %s", string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "pvmove aborted"})
+	}
+}
@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+)
+
+// lvmLogicalVolume looks up a logical volume by volume group and name
+func lvmLogicalVolume(vgName, lvName string) (*models.LogicalVolume, error) {
+	lvs, err := getLogicalVolumes(vgName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logical volumes: %v", err)
+	}
+	for i := range lvs {
+		if lvs[i].Name == lvName {
+			return &lvs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("logical volume %s/%s not found", vgName, lvName)
+}
+
+// isLVMSnapshot reports whether a logical volume is a snapshot: classic snapshots have
+// the 's' volume type attribute, thin snapshots are thin volumes with an origin
+func isLVMSnapshot(lv models.LogicalVolume) bool {
+	return lv.Origin != "" && (strings.HasPrefix(lv.Attributes, "s") || lv.SegType == "thin")
+}
+
+// getThinPools returns the thin pools with their thin volumes
+func getThinPools() ([]models.ThinPool, error) {
+	lvs, err := getLogicalVolumes("")
+	if err != nil {
+		return nil, err
+	}
+
+	pools := []models.ThinPool{}
+	for _, lv := range lvs {
+		if lv.SegType != "thin-pool" {
+			continue
+		}
+		pool := models.ThinPool{
+			Name:            lv.Name,
+			VGName:          lv.VGName,
+			Size:            lv.Size,
+			SizeHuman:       lv.SizeHuman,
+			DataPercent:     lv.DataPercent,
+			MetadataPercent: lv.MetadataPercent,
+			Volumes:         []models.LogicalVolume{},
+		}
+		for _, thin := range lvs {
+			if thin.VGName == lv.VGName && thin.PoolLV == lv.Name && thin.SegType == "thin" {
+				pool.Volumes = append(pool.Volumes, thin)
+				pool.VirtualSize += thin.Size
+			}
+		}
+		pool.VirtualSizeHuman = formatBytes(pool.VirtualSize)
+		if pool.Size > 0 {
+			pool.Overcommit = float64(pool.VirtualSize) / float64(pool.Size)
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// lvmAlerts raises alerts for thin pools running out of data or metadata space, which stops
+// writes to every thin volume in them, and for classic snapshots close to full, which become
+// invalid once their copy-on-write space runs out
+func lvmAlerts(settings models.AlertSettings) []models.StorageAlert {
+	alerts := []models.StorageAlert{}
+	if !checkCommandExists("lvs") {
+		return alerts
+	}
+	lvs, err := getLogicalVolumes("")
+	if err != nil {
+		return alerts
+	}
+
+	level := func(percent float64) string {
+		if percent > settings.SpaceCriticalPercent {
+			return "critical"
+		} else if percent > settings.SpaceWarningPercent {
+			return "warning"
+		}
+		return ""
+	}
+
+	for _, lv := range lvs {
+		name := lv.VGName + "/" + lv.Name
+		switch {
+		case lv.SegType == "thin-pool":
+			if l := level(lv.DataPercent); l != "" {
+				alerts = append(alerts, models.StorageAlert{
+					Level:     l,
+					Type:      "thin_pool_data",
+					Message:   fmt.Sprintf("Thin pool %s data space is %.1f%% full", name, lv.DataPercent),
+					Resource:  name,
+					Timestamp: time.Now(),
+				})
+			}
+			if l := level(lv.MetadataPercent); l != "" {
+				alerts = append(alerts, models.StorageAlert{
+					Level:     l,
+					Type:      "thin_pool_metadata",
+					Message:   fmt.Sprintf("Thin pool %s metadata space is %.1f%% full", name, lv.MetadataPercent),
+					Resource:  name,
+					Timestamp: time.Now(),
+				})
+			}
+		case strings.HasPrefix(lv.Attributes, "s"):
+			if l := level(lv.SnapPercent); l != "" {
+				alerts = append(alerts, models.StorageAlert{
+					Level:     l,
+					Type:      "lvm_snapshot_full",
+					Message:   fmt.Sprintf("Snapshot %s of %s is %.1f%% full", name, lv.Origin, lv.SnapPercent),
+					Resource:  name,
+					Timestamp: time.Now(),
+				})
+			}
+		}
+	}
+	return alerts
+}
+
+// GetThinPools returns the thin pools with their usage and thin volumes
+func GetThinPools() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pools, err := getThinPools()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pools)
+	}
+}
+
+// CreateThinPool creates an LVM thin pool in a volume group
+func CreateThinPool() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.CreateThinPoolRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateLVMName(req.Name, "thin pool"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateLVMName(req.VGName, "volume group"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateLVMSize(req.Size); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		args := []string{"--type", "thin-pool", "-n", req.Name}
+		if strings.Contains(req.Size, "%") {
+			args = append(args, "-l", req.Size)
+		} else {
+			args = append(args, "-L", req.Size)
+		}
+		if req.MetadataSize != "" {
+			if err := validateLVMSize(req.MetadataSize); err != nil || strings.Contains(req.MetadataSize, "%") {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid metadata_size: use a number with an optional unit (K, M, G)", nil)
+				return
+			}
+			args = append(args, "--poolmetadatasize", req.MetadataSize)
+		}
+		if req.ChunkSize != "" {
+			if err := validateLVMSize(req.ChunkSize); err != nil || strings.Contains(req.ChunkSize, "%") {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid chunk_size: use a number with an optional unit, e.g. 64K", nil)
+				return
+			}
+			args = append(args, "--chunksize", req.ChunkSize)
+		}
+		args = append(args, req.VGName)
+
+		output, err := exec.Command("lvcreate", args...).CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to create thin pool: %s", string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Thin pool created successfully",
+			"pool":    req.VGName + "/" + req.Name,
+		})
+	}
+}
+
+// CreateThinVolume creates a thin logical volume in a thin pool. Its virtual size may exceed
+// the space left in the pool; blocks are only allocated when written.
+func CreateThinVolume() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.CreateThinVolumeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateLVMName(req.Name, "logical volume"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateLVMName(req.VGName, "volume group"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateLVMName(req.Pool, "thin pool"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateLVMSize(req.VirtualSize); err != nil || strings.Contains(req.VirtualSize, "%") {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid virtual_size: use a number with an optional unit (K, M, G, T)", nil)
+			return
+		}
+		if req.FSType != "" {
+			if err := validateFSType(req.FSType); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+		}
+
+		pool, err := lvmLogicalVolume(req.VGName, req.Pool)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeLogicalVolumeNotFound, err.Error(), nil)
+			return
+		}
+		if pool.SegType != "thin-pool" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("%s/%s is not a thin pool", req.VGName, req.Pool), nil)
+			return
+		}
+
+		output, err := exec.Command("lvcreate", "--type", "thin", "-V", req.VirtualSize, "--thinpool", req.Pool, "-n", req.Name, req.VGName).CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to create thin volume: %s", string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		lvPath := filepath.Join("/dev", req.VGName, req.Name)
+		if req.FSType != "" {
+			output, err := exec.Command("mkfs", "-t", req.FSType, lvPath).CombinedOutput()
+			if err != nil {
+				apierror.Error(w, fmt.Sprintf("Thin volume created but format failed: %s", string(output)), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Thin volume created successfully",
+			"path":    lvPath,
+		})
+	}
+}
+
+// ListLVMSnapshots returns the classic and thin snapshots of all logical volumes
+func ListLVMSnapshots() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lvs, err := getLogicalVolumes(r.URL.Query().Get("vg"))
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		snapshots := []models.LogicalVolume{}
+		for _, lv := range lvs {
+			if isLVMSnapshot(lv) {
+				snapshots = append(snapshots, lv)
+			}
+		}
+		sort.Slice(snapshots, func(i, j int) bool {
+			if snapshots[i].VGName != snapshots[j].VGName {
+				return snapshots[i].VGName < snapshots[j].VGName
+			}
+			return snapshots[i].Name < snapshots[j].Name
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshots)
+	}
+}
+
+// CreateLVMSnapshot snapshots a logical volume. Thin volumes get a thin snapshot that shares
+// the pool's space; other volumes need a size for the snapshot's copy-on-write space.
+func CreateLVMSnapshot() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.CreateLVMSnapshotRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateLVMName(req.Name, "snapshot"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateLVMName(req.VGName, "volume group"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateLVMName(req.Origin, "logical volume"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		origin, err := lvmLogicalVolume(req.VGName, req.Origin)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeLogicalVolumeNotFound, err.Error(), nil)
+			return
+		}
+
+		args := []string{"-s", "-n", req.Name}
+		if origin.SegType == "thin" {
+			// Thin snapshots skip activation by default; activate them like any other volume
+			args = append(args, "-kn")
+		} else {
+			if req.Size == "" {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "size is required to snapshot a volume that is not thin", nil)
+				return
+			}
+			if err := validateLVMSize(req.Size); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			if strings.Contains(req.Size, "%") {
+				args = append(args, "-l", req.Size)
+			} else {
+				args = append(args, "-L", req.Size)
+			}
+		}
+		args = append(args, req.VGName+"/"+req.Origin)
+
+		output, err := exec.Command("lvcreate", args...).CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to create snapshot: %s", string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Snapshot created successfully",
+			"path":    filepath.Join("/dev", req.VGName, req.Name),
+		})
+	}
+}
+
+// MergeLVMSnapshot rolls a logical volume back to a snapshot by merging the snapshot into its
+// origin. The snapshot is removed afterwards. While the origin is in use, LVM postpones the
+// merge until the origin is next activated.
+func MergeLVMSnapshot() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			VGName string `json:"vg_name"`
+			Name   string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateLVMName(req.VGName, "volume group"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateLVMName(req.Name, "snapshot"); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		snapshot, err := lvmLogicalVolume(req.VGName, req.Name)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeLogicalVolumeNotFound, err.Error(), nil)
+			return
+		}
+		if !isLVMSnapshot(*snapshot) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("%s/%s is not a snapshot", req.VGName, req.Name), nil)
+			return
+		}
+
+		output, err := exec.Command("lvconvert", "-y", "--merge", req.VGName+"/"+req.Name).CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to merge snapshot: %s", string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		status := "merged"
+		message := fmt.Sprintf("Snapshot %s merged into %s", req.Name, snapshot.Origin)
+		if strings.Contains(string(output), "Delaying merging") || strings.Contains(string(output), "merge on next activation") {
+			status = "pending"
+			message = fmt.Sprintf("%s is in use: the merge of %s runs the next time it is activated (unmount it and deactivate/activate it, or reboot)", snapshot.Origin, req.Name)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": message,
+			"status":  status,
+			"origin":  snapshot.Origin,
+		})
+	}
+}
@@ -0,0 +1,589 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maintenanceHistoryLimit = 100              // History entries kept per schedule
+	maintenancePollInterval = 30 * time.Second // How often a running scrub or check is polled for completion
+)
+
+var (
+	raidArrayNameRegex   = regexp.MustCompile(`^md[a-zA-Z0-9_]+$`)
+	scrubResultRegex     = regexp.MustCompile(`scrub repaired (\S+) in .* with (\d+) errors`)
+	zpoolDataErrorsRegex = regexp.MustCompile(`^(\d+) data errors`)
+)
+
+// MaintenanceScheduler runs ZFS scrubs and RAID consistency checks on their schedule
+type MaintenanceScheduler struct {
+	store    storage.DataStore
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	active   map[string]bool // Schedules with a scrub or check in progress
+}
+
+// NewMaintenanceScheduler creates a new maintenance scheduler
+func NewMaintenanceScheduler(store storage.DataStore) *MaintenanceScheduler {
+	return &MaintenanceScheduler{
+		store:    store,
+		stopChan: make(chan struct{}),
+		active:   make(map[string]bool),
+	}
+}
+
+// Start begins the maintenance scheduler background goroutine
+func (s *MaintenanceScheduler) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.stopChan = make(chan struct{})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.mu.Unlock()
+
+	// The scrub or check itself carries on in the kernel, but its result was never recorded
+	s.store.FailInterruptedMaintenanceRuns("server restarted before the result was recorded")
+
+	s.wg.Add(1)
+	go s.run()
+	log.Println("Maintenance scheduler started")
+}
+
+// Stop stops the scheduler. Scrubs and checks in progress keep running but are recorded as failed.
+func (s *MaintenanceScheduler) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stopChan)
+	s.cancel()
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	log.Println("Maintenance scheduler stopped")
+}
+
+// IsRunning reports whether a schedule has a scrub or check in progress
+func (s *MaintenanceScheduler) IsRunning(scheduleID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active[scheduleID]
+}
+
+// run is the main scheduler loop
+func (s *MaintenanceScheduler) run() {
+	defer s.wg.Done()
+
+	// Check every minute for schedules that need to run
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	s.checkAndRunSchedules()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.checkAndRunSchedules()
+		}
+	}
+}
+
+// checkAndRunSchedules starts the enabled schedules that are due
+func (s *MaintenanceScheduler) checkAndRunSchedules() {
+	now := time.Now()
+
+	for _, schedule := range s.store.ListMaintenanceSchedules() {
+		if !schedule.Enabled {
+			continue
+		}
+
+		// Initialize NextRun if not set
+		if schedule.NextRun == nil {
+			s.store.UpdateMaintenanceSchedule(schedule.ID, map[string]interface{}{
+				"next_run": nextScheduledRun(schedule.Schedule, now),
+			})
+			continue
+		}
+
+		if !now.Before(*schedule.NextRun) {
+			s.startSchedule(schedule)
+		}
+	}
+}
+
+// startSchedule runs a schedule in the background unless it is already running
+func (s *MaintenanceScheduler) startSchedule(schedule *models.MaintenanceSchedule) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running || s.active[schedule.ID] {
+		return false
+	}
+	s.active[schedule.ID] = true
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.active, schedule.ID)
+			s.mu.Unlock()
+		}()
+		s.runSchedule(schedule)
+	}()
+	return true
+}
+
+// runSchedule scrubs or checks the target once, records the result and raises an alert when errors were found
+func (s *MaintenanceScheduler) runSchedule(schedule *models.MaintenanceSchedule) {
+	log.Printf("Running %s of %s", maintenanceTypeName(schedule.Type), schedule.Target)
+
+	now := time.Now()
+	run, err := s.store.CreateMaintenanceRun(&models.MaintenanceRun{
+		ScheduleID: schedule.ID,
+		Type:       schedule.Type,
+		Target:     schedule.Target,
+		Status:     models.MaintenanceStatusRunning,
+		StartedAt:  now,
+	})
+	if err != nil {
+		log.Printf("Maintenance of %s: failed to record run: %v", schedule.Target, err)
+		return
+	}
+
+	switch schedule.Type {
+	case models.MaintenanceTypeScrub:
+		err = s.scrubPool(schedule.Target, run)
+	case models.MaintenanceTypeRAIDCheck:
+		err = s.checkRAIDArray(schedule.Target, run)
+	default:
+		err = fmt.Errorf("unknown maintenance type: %s", schedule.Type)
+	}
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	switch {
+	case err != nil:
+		run.Status = models.MaintenanceStatusFailed
+		run.Error = err.Error()
+		log.Printf("%s of %s failed: %v", maintenanceTypeName(schedule.Type), schedule.Target, err)
+	case run.ErrorsFound > 0:
+		run.Status = models.MaintenanceStatusErrors
+		log.Printf("%s of %s found %d errors: %s", maintenanceTypeName(schedule.Type), schedule.Target, run.ErrorsFound, run.Summary)
+	default:
+		run.Status = models.MaintenanceStatusSuccess
+		log.Printf("%s of %s completed: %s", maintenanceTypeName(schedule.Type), schedule.Target, run.Summary)
+	}
+
+	s.store.UpdateMaintenanceRun(run)
+	s.store.PruneMaintenanceRuns(schedule.ID, maintenanceHistoryLimit)
+	s.store.UpdateMaintenanceScheduleRun(schedule.ID, now, nextScheduledRun(schedule.Schedule, now), run.Status, run.Error)
+
+	eventData := map[string]interface{}{
+		"schedule_id":  schedule.ID,
+		"type":         schedule.Type,
+		"target":       schedule.Target,
+		"status":       run.Status,
+		"errors_found": run.ErrorsFound,
+		"summary":      run.Summary,
+	}
+	if err != nil {
+		eventData["error"] = run.Error
+		events.PublishToAdmins(events.TypeMaintenanceFailed, eventData)
+		return
+	}
+	events.PublishToAdmins(events.TypeMaintenanceCompleted, eventData)
+	if run.ErrorsFound > 0 {
+		events.PublishToAdmins(events.TypeStorageAlert, maintenanceErrorAlert(schedule.Type, schedule.Target, run.ErrorsFound, finishedAt))
+	}
+}
+
+// scrubPool scrubs a ZFS pool and waits for the scrub to finish
+func (s *MaintenanceScheduler) scrubPool(pool string, run *models.MaintenanceRun) error {
+	status, err := zpoolStatus(pool)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(status.Scan, "in progress") {
+		return errors.New("a scrub or resilver is already in progress")
+	}
+
+	if output, err := exec.CommandContext(s.ctx, "sudo", "zpool", "scrub", pool).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start scrub: %s", commandError(output, err))
+	}
+
+	for {
+		status, err = zpoolStatus(pool)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(status.Scan, "in progress") {
+			break
+		}
+		select {
+		case <-s.ctx.Done():
+			return errors.New("server stopped before the scrub finished")
+		case <-time.After(maintenancePollInterval):
+		}
+	}
+
+	run.Summary = status.Scan
+	match := scrubResultRegex.FindStringSubmatch(status.Scan)
+	if match == nil {
+		return fmt.Errorf("scrub did not complete: %s", status.Scan)
+	}
+	run.ErrorsFound, _ = strconv.ParseInt(match[2], 10, 64)
+
+	// Permanent errors in files are reported separately from the scrub counter
+	if m := zpoolDataErrorsRegex.FindStringSubmatch(status.Errors); m != nil {
+		if n, _ := strconv.ParseInt(m[1], 10, 64); n > run.ErrorsFound {
+			run.ErrorsFound = n
+		}
+		run.Summary += "; " + status.Errors
+	}
+	return nil
+}
+
+// checkRAIDArray runs a consistency check on a software RAID array and waits for it to finish
+func (s *MaintenanceScheduler) checkRAIDArray(name string, run *models.MaintenanceRun) error {
+	mdDir := filepath.Join("/sys/block", name, "md")
+
+	action, err := readSysfsValue(filepath.Join(mdDir, "sync_action"))
+	if err != nil {
+		return fmt.Errorf("RAID array %s not found", name)
+	}
+	if action != "idle" {
+		return fmt.Errorf("array is busy (%s)", action)
+	}
+
+	if output, err := exec.CommandContext(s.ctx, "mdadm", "--action=check", "/dev/"+name).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start check: %s", commandError(output, err))
+	}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return errors.New("server stopped before the check finished")
+		case <-time.After(maintenancePollInterval):
+		}
+
+		action, err = readSysfsValue(filepath.Join(mdDir, "sync_action"))
+		if err != nil {
+			return fmt.Errorf("RAID array %s disappeared during the check", name)
+		}
+		if action == "idle" {
+			break
+		}
+	}
+
+	value, err := readSysfsValue(filepath.Join(mdDir, "mismatch_cnt"))
+	if err != nil {
+		return fmt.Errorf("failed to read check result: %w", err)
+	}
+	run.ErrorsFound, _ = strconv.ParseInt(value, 10, 64)
+	run.Summary = fmt.Sprintf("check completed with %d mismatched sectors", run.ErrorsFound)
+	return nil
+}
+
+// zpoolStatus returns the parsed status of a pool
+func zpoolStatus(pool string) (ZFSPoolStatus, error) {
+	output, err := exec.Command("zpool", "status", pool).CombinedOutput()
+	if err != nil {
+		return ZFSPoolStatus{}, fmt.Errorf("failed to get pool status: %s", commandError(output, err))
+	}
+	status := parseZpoolStatus(string(output))
+	status.Name = pool
+	return status, nil
+}
+
+// readSysfsValue reads a single value from a sysfs attribute
+func readSysfsValue(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// maintenanceTypeName returns a readable name for a maintenance type
+func maintenanceTypeName(maintenanceType string) string {
+	if maintenanceType == models.MaintenanceTypeRAIDCheck {
+		return "RAID check"
+	}
+	return "Scrub"
+}
+
+// maintenanceErrorAlert describes a scrub or check that found errors as a storage alert
+func maintenanceErrorAlert(maintenanceType, target string, errorsFound int64, at time.Time) models.StorageAlert {
+	alert := models.StorageAlert{
+		Level:     "critical",
+		Type:      "scrub_errors",
+		Message:   fmt.Sprintf("Scrub of ZFS pool %s found %d errors", target, errorsFound),
+		Resource:  target,
+		Timestamp: at,
+	}
+	if maintenanceType == models.MaintenanceTypeRAIDCheck {
+		alert.Type = "raid_mismatch"
+		alert.Message = fmt.Sprintf("Consistency check of RAID array %s found %d mismatched sectors", target, errorsFound)
+		alert.Resource = "/dev/" + target
+	}
+	return alert
+}
+
+// maintenanceAlerts returns a storage alert for every target whose last scrub or check found errors
+func maintenanceAlerts(store storage.DataStore) []models.StorageAlert {
+	alerts := []models.StorageAlert{}
+	for _, schedule := range store.ListMaintenanceSchedules() {
+		if schedule.LastStatus != models.MaintenanceStatusErrors || schedule.LastRun == nil {
+			continue
+		}
+		runs := store.ListMaintenanceRuns(schedule.ID, 1)
+		if len(runs) == 0 {
+			continue
+		}
+		alerts = append(alerts, maintenanceErrorAlert(schedule.Type, schedule.Target, runs[0].ErrorsFound, *schedule.LastRun))
+	}
+	return alerts
+}
+
+// validateMaintenanceSchedule checks the settings of a schedule before it is saved
+func validateMaintenanceSchedule(schedule *models.MaintenanceSchedule) error {
+	validSchedules := map[string]bool{
+		"hourly": true, "daily": true, "weekly": true, "monthly": true,
+	}
+	if !validSchedules[schedule.Schedule] {
+		return errors.New("invalid schedule. Must be: hourly, daily, weekly, or monthly")
+	}
+
+	switch schedule.Type {
+	case models.MaintenanceTypeScrub:
+		if err := validateZFSPoolName(schedule.Target); err != nil {
+			return err
+		}
+		if output, err := exec.Command("zpool", "list", "-H", schedule.Target).CombinedOutput(); err != nil {
+			return fmt.Errorf("pool '%s' not found: %s", schedule.Target, commandError(output, err))
+		}
+	case models.MaintenanceTypeRAIDCheck:
+		if !raidArrayNameRegex.MatchString(schedule.Target) {
+			return errors.New("invalid RAID array name")
+		}
+		if _, err := os.Stat(filepath.Join("/sys/block", schedule.Target, "md")); err != nil {
+			return fmt.Errorf("RAID array %s not found", schedule.Target)
+		}
+	default:
+		return errors.New("invalid type. Must be: scrub or raid_check")
+	}
+	return nil
+}
+
+// ============================================================================
+// HTTP Handlers
+// ============================================================================
+
+// MaintenanceHandler handles maintenance schedule API requests
+type MaintenanceHandler struct {
+	store     storage.DataStore
+	scheduler *MaintenanceScheduler
+}
+
+// NewMaintenanceHandler creates a new handler
+func NewMaintenanceHandler(store storage.DataStore, scheduler *MaintenanceScheduler) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		store:     store,
+		scheduler: scheduler,
+	}
+}
+
+// ListSchedules returns all maintenance schedules
+func (h *MaintenanceHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules := h.store.ListMaintenanceSchedules()
+	for _, schedule := range schedules {
+		schedule.Running = h.scheduler.IsRunning(schedule.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedules)
+}
+
+// GetSchedule returns a single maintenance schedule
+func (h *MaintenanceHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := h.store.GetMaintenanceSchedule(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeScheduleNotFound, err.Error(), nil)
+		return
+	}
+	schedule.Running = h.scheduler.IsRunning(schedule.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// CreateSchedule creates a scrub schedule for a pool or a check schedule for a RAID array
+func (h *MaintenanceHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule models.MaintenanceSchedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	if schedule.Schedule == "" {
+		// Scrubs and checks read every block of the pool or array, so they rarely run more often
+		schedule.Schedule = "monthly"
+	}
+	schedule.Target = strings.TrimPrefix(schedule.Target, "/dev/")
+
+	if err := validateMaintenanceSchedule(&schedule); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	nextRun := nextScheduledRun(schedule.Schedule, time.Now())
+	schedule.NextRun = &nextRun
+	schedule.LastRun = nil
+	schedule.LastStatus = ""
+	schedule.LastError = ""
+
+	created, err := h.store.CreateMaintenanceSchedule(&schedule)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, err.Error(), nil)
+			return
+		}
+		apierror.Error(w, fmt.Sprintf("Failed to create maintenance schedule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// UpdateSchedule changes the schedule of a scrub or check or enables/disables it
+func (h *MaintenanceHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := h.store.GetMaintenanceSchedule(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeScheduleNotFound, err.Error(), nil)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	var updates map[string]interface{}
+	if err := json.Unmarshal(body, &updates); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	delete(updates, "next_run")
+
+	if sched, ok := updates["schedule"].(string); ok {
+		merged := *schedule
+		merged.Schedule = sched
+		if err := validateMaintenanceSchedule(&merged); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		updates["next_run"] = nextScheduledRun(sched, time.Now())
+	}
+
+	updated, err := h.store.UpdateMaintenanceSchedule(schedule.ID, updates)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updated.Running = h.scheduler.IsRunning(updated.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteSchedule deletes a maintenance schedule and its history
+func (h *MaintenanceHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if h.scheduler.IsRunning(id) {
+		apierror.Write(w, http.StatusConflict, apierror.CodeBusy, "A scrub or check is in progress for this schedule", nil)
+		return
+	}
+
+	if err := h.store.DeleteMaintenanceSchedule(id); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeScheduleNotFound, err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Maintenance schedule deleted successfully",
+	})
+}
+
+// RunSchedule starts a scrub or check immediately
+func (h *MaintenanceHandler) RunSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := h.store.GetMaintenanceSchedule(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeScheduleNotFound, err.Error(), nil)
+		return
+	}
+
+	if !h.scheduler.startSchedule(schedule) {
+		apierror.Write(w, http.StatusConflict, apierror.CodeBusy, "A scrub or check is already in progress for this schedule", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("%s of %s started", maintenanceTypeName(schedule.Type), schedule.Target),
+	})
+}
+
+// GetScheduleHistory returns the recent runs of a schedule, newest first
+func (h *MaintenanceHandler) GetScheduleHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := h.store.GetMaintenanceSchedule(id); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeScheduleNotFound, err.Error(), nil)
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= maintenanceHistoryLimit {
+		limit = l
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.ListMaintenanceRuns(id, limit))
+}
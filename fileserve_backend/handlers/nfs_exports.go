@@ -0,0 +1,566 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/sysconf"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// nfsHostPattern matches hostnames, wildcards, IPv4/IPv6 addresses and networks, and @netgroups
+var nfsHostPattern = regexp.MustCompile(`^(\*|@?[A-Za-z0-9_.*?:\[\]-]+(/[0-9.]+)?)$`)
+
+// nfsFlagOptions are the exports(5) options without a value
+var nfsFlagOptions = map[string]bool{
+	"rw": true, "ro": true, "sync": true, "async": true, "secure": true, "insecure": true,
+	"wdelay": true, "no_wdelay": true, "hide": true, "nohide": true, "crossmnt": true,
+	"subtree_check": true, "no_subtree_check": true, "secure_locks": true, "insecure_locks": true,
+	"auth_nlm": true, "no_auth_nlm": true, "root_squash": true, "no_root_squash": true,
+	"all_squash": true, "no_all_squash": true, "acl": true, "no_acl": true,
+	"pnfs": true, "no_pnfs": true, "security_label": true, "mp": true,
+}
+
+// nfsValueOptions are the exports(5) options that take a value, with the accepted values
+var nfsValueOptions = map[string]*regexp.Regexp{
+	"anonuid":    regexp.MustCompile(`^[0-9]+$`),
+	"anongid":    regexp.MustCompile(`^[0-9]+$`),
+	"fsid":       regexp.MustCompile(`^(root|[0-9]+|[0-9a-fA-F-]{36})$`),
+	"sec":        regexp.MustCompile(`^(sys|krb5|krb5i|krb5p)(:(sys|krb5|krb5i|krb5p))*$`),
+	"mp":         regexp.MustCompile(`^/[^\s,()"]*$`),
+	"mountpoint": regexp.MustCompile(`^/[^\s,()"]*$`),
+}
+
+// nfsOptionOpposite returns the option that cancels an exports(5) option, if any
+func nfsOptionOpposite(option string) string {
+	switch option {
+	case "rw":
+		return "ro"
+	case "ro":
+		return "rw"
+	case "sync":
+		return "async"
+	case "async":
+		return "sync"
+	case "secure":
+		return "insecure"
+	case "insecure":
+		return "secure"
+	case "hide":
+		return "nohide"
+	case "nohide":
+		return "hide"
+	case "secure_locks":
+		return "insecure_locks"
+	case "insecure_locks":
+		return "secure_locks"
+	}
+	if strings.HasPrefix(option, "no_") {
+		return strings.TrimPrefix(option, "no_")
+	}
+	if nfsFlagOptions["no_"+option] {
+		return "no_" + option
+	}
+	return ""
+}
+
+// validateNFSExport checks an export before it is written so a bad request cannot break the exports file
+func validateNFSExport(entry *models.NFSExportEntry) error {
+	if entry.Path == "" || !filepath.IsAbs(entry.Path) || filepath.Clean(entry.Path) != entry.Path {
+		return errors.New("path must be a clean absolute path")
+	}
+	if strings.ContainsAny(entry.Path, " \t\r\n\"#()\\,") {
+		return errors.New("path must not contain whitespace, quotes or the characters #(),\\")
+	}
+	if len(entry.Clients) == 0 {
+		return errors.New("at least one client is required")
+	}
+
+	seen := make(map[string]bool)
+	for _, client := range entry.Clients {
+		if !nfsHostPattern.MatchString(client.Host) {
+			return fmt.Errorf("invalid client %q", client.Host)
+		}
+		if seen[client.Host] {
+			return fmt.Errorf("client %q is listed twice", client.Host)
+		}
+		seen[client.Host] = true
+
+		for _, option := range client.Options {
+			key, value, hasValue := strings.Cut(option, "=")
+			switch key {
+			case "rw", "ro", "root_squash", "no_root_squash":
+				return fmt.Errorf("use read_only and root_squash instead of the %q option", option)
+			}
+			if pattern, ok := nfsValueOptions[key]; ok && hasValue {
+				if !pattern.MatchString(value) {
+					return fmt.Errorf("invalid value for option %q", key)
+				}
+				continue
+			}
+			if !hasValue && nfsFlagOptions[key] {
+				continue
+			}
+			return fmt.Errorf("unsupported export option %q", option)
+		}
+	}
+	return nil
+}
+
+// formatNFSExportLine renders an export as an exports(5) line
+func formatNFSExportLine(entry *models.NFSExportEntry) string {
+	specs := make([]string, 0, len(entry.Clients))
+	for _, client := range entry.Clients {
+		options := []string{"rw"}
+		if client.ReadOnly {
+			options = []string{"ro"}
+		}
+		if client.RootSquash {
+			options = append(options, "root_squash")
+		} else {
+			options = append(options, "no_root_squash")
+		}
+		options = mergeNFSOptions(options, client.Options)
+		specs = append(specs, fmt.Sprintf("%s(%s)", client.Host, strings.Join(options, ",")))
+	}
+	return entry.Path + " " + strings.Join(specs, " ")
+}
+
+// exportsBlock is one logical entry of an exports file, which may span several physical lines
+type exportsBlock struct {
+	lines []string
+	entry *models.NFSExportEntry // nil for comments and blank lines
+}
+
+// parseExportsFile splits an exports file into blocks, keeping comments so it can be written back unchanged
+func parseExportsFile(content string) []exportsBlock {
+	var blocks []exportsBlock
+	var pending []string
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		pending = append(pending, line)
+		if strings.HasSuffix(line, "\\") {
+			continue
+		}
+
+		joined := strings.Join(pending, "\n")
+		joined = strings.ReplaceAll(joined, "\\\n", " ")
+		blocks = append(blocks, exportsBlock{lines: pending, entry: parseExportsLine(joined)})
+		pending = nil
+	}
+	if len(pending) > 0 {
+		blocks = append(blocks, exportsBlock{lines: pending})
+	}
+	return blocks
+}
+
+// parseExportsLine parses a single exports(5) entry, returning nil for comments and blank lines
+func parseExportsLine(line string) *models.NFSExportEntry {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+
+	var path string
+	var fields []string
+	if strings.HasPrefix(line, `"`) {
+		// Quoted paths may contain spaces
+		end := strings.Index(line[1:], `"`)
+		if end < 0 {
+			return nil
+		}
+		path, fields = line[1:end+1], strings.Fields(line[end+2:])
+	} else {
+		fields = strings.Fields(line)
+		path, fields = fields[0], fields[1:]
+	}
+
+	entry := &models.NFSExportEntry{Path: path, Clients: []models.NFSExportClient{}, Source: models.NFSExportSourceFile}
+	var defaults []string
+	for _, field := range fields {
+		// A leading "-options" field sets the defaults for the clients after it
+		if strings.HasPrefix(field, "-") {
+			defaults = strings.Split(strings.TrimPrefix(field, "-"), ",")
+			continue
+		}
+
+		host, options := field, defaults
+		if i := strings.Index(field, "("); i >= 0 {
+			host = field[:i]
+			options = mergeNFSOptions(append([]string{}, defaults...), strings.Split(strings.Trim(field[i:], "()"), ","))
+		}
+		if host == "" {
+			host = "*"
+		}
+		entry.Clients = append(entry.Clients, parseNFSClient(host, options))
+	}
+	if len(entry.Clients) == 0 {
+		// exports(5): no client means everyone with the default options
+		entry.Clients = append(entry.Clients, parseNFSClient("*", defaults))
+	}
+	return entry
+}
+
+// parseNFSClient converts an option list into a client, using the exports(5) defaults of ro and root_squash
+func parseNFSClient(host string, options []string) models.NFSExportClient {
+	client := models.NFSExportClient{Host: host, ReadOnly: true, RootSquash: true}
+	for _, option := range options {
+		switch option = strings.TrimSpace(option); option {
+		case "":
+		case "rw":
+			client.ReadOnly = false
+		case "ro":
+			client.ReadOnly = true
+		case "root_squash":
+			client.RootSquash = true
+		case "no_root_squash":
+			client.RootSquash = false
+		default:
+			client.Options = append(client.Options, option)
+		}
+	}
+	return client
+}
+
+// renderExportsFile joins the blocks of an exports file back together
+func renderExportsFile(blocks []exportsBlock) string {
+	var lines []string
+	for _, block := range blocks {
+		lines = append(lines, block.lines...)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// readExportsFile returns the blocks of /etc/exports (empty if it does not exist)
+func readExportsFile() ([]exportsBlock, error) {
+	content, err := os.ReadFile(nfsExportsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseExportsFile(string(content)), nil
+}
+
+// writeExportsFile replaces /etc/exports and re-exports, restoring the previous file if exportfs rejects it
+func writeExportsFile(blocks []exportsBlock) error {
+	if err := sysconf.WriteFile(nfsExportsPath, []byte(renderExportsFile(blocks)), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", nfsExportsPath, err)
+	}
+	if err := reloadNFS(); err != nil {
+		sysconf.Restore(nfsExportsPath)
+		reloadNFS()
+		return fmt.Errorf("exportfs rejected the exports: %w", err)
+	}
+	return nil
+}
+
+// findExportBlock returns the index of the block exporting path, or -1
+func findExportBlock(blocks []exportsBlock, path string) int {
+	for i, block := range blocks {
+		if block.entry != nil && block.entry.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// zoneNFSExports returns the exports generated from zones with NFS enabled
+func zoneNFSExports(store storage.DataStore) []models.NFSExportEntry {
+	pools := make(map[string]*models.StoragePool)
+	for _, pool := range store.ListStoragePools() {
+		pools[pool.ID] = pool
+	}
+
+	exports := []models.NFSExportEntry{}
+	for _, zone := range store.ListShareZones() {
+		if !zone.NFSEnabled || zone.NFSOptions == nil || !zone.Enabled {
+			continue
+		}
+		pool, ok := pools[zone.PoolID]
+		if !ok || !pool.Enabled || pool.IsS3() {
+			continue
+		}
+		exports = append(exports, models.NFSExportEntry{
+			Path:     zoneExportPath(zone, filepath.Join(pool.Path, zone.Path)),
+			Clients:  zoneNFSClients(zone),
+			Source:   models.NFSExportSourceZone,
+			ZoneID:   zone.ID,
+			ZoneName: zone.Name,
+		})
+	}
+	return exports
+}
+
+// zoneExportForPath returns the zone whose NFS export is path, or nil
+func zoneExportForPath(store storage.DataStore, path string) *models.ShareZone {
+	for _, export := range zoneNFSExports(store) {
+		if export.Path == path {
+			zone, _ := store.GetShareZone(export.ZoneID)
+			return zone
+		}
+	}
+	return nil
+}
+
+// listNFSExports returns the exports from /etc/exports followed by those generated from zones
+func listNFSExports(store storage.DataStore) ([]models.NFSExportEntry, error) {
+	blocks, err := readExportsFile()
+	if err != nil {
+		return nil, err
+	}
+
+	exports := []models.NFSExportEntry{}
+	for _, block := range blocks {
+		if block.entry != nil {
+			exports = append(exports, *block.entry)
+		}
+	}
+	return append(exports, zoneNFSExports(store)...), nil
+}
+
+// setZoneNFSExport exports a zone to the given clients (or stops exporting it when clients is nil)
+// and regenerates the zone exports
+func setZoneNFSExport(store storage.DataStore, zone *models.ShareZone, clients []models.NFSExportClient) (*models.ShareZone, error) {
+	pool, err := store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		return nil, errors.New("storage pool not found")
+	}
+	if pool.IsS3() {
+		return nil, errors.New("NFS sharing is not available for S3 pools")
+	}
+
+	opts := models.DefaultZoneNFSOptions()
+	if zone.NFSOptions != nil {
+		copied := *zone.NFSOptions
+		opts = &copied
+	}
+	enabled := clients != nil
+	if enabled {
+		opts.Clients = clients
+		opts.AllowedHosts = make([]string, len(clients))
+		for i, client := range clients {
+			opts.AllowedHosts[i] = client.Host
+		}
+	}
+
+	updated, err := store.UpdateShareZoneNFS(zone.ID, enabled, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := ApplySingleZoneNFS(store, updated, filepath.Join(pool.Path, updated.Path)); err != nil {
+		// Put the zone back so the store matches what is exported
+		store.UpdateShareZoneNFS(zone.ID, zone.NFSEnabled, zone.NFSOptions)
+		SyncNFSConfig(store)
+		return nil, err
+	}
+	return updated, nil
+}
+
+// writeNFSExportError reports a failed export change to the client
+func writeNFSExportError(w http.ResponseWriter, err error) {
+	apierror.Error(w, "Failed to apply NFS exports: "+err.Error(), http.StatusInternalServerError)
+}
+
+// CreateNFSExport adds an export. With zone_id the zone is exported over NFS (its path is used);
+// otherwise the entry is added to /etc/exports.
+func CreateNFSExport(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var entry models.NFSExportEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if entry.ZoneID != "" {
+			zone, err := store.GetShareZone(entry.ZoneID)
+			if err != nil {
+				apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, "Zone not found", nil)
+				return
+			}
+			if zone.NFSEnabled {
+				apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Zone is already exported over NFS", nil)
+				return
+			}
+			pool, err := store.GetStoragePool(zone.PoolID)
+			if err != nil {
+				apierror.Write(w, http.StatusNotFound, apierror.CodePoolNotFound, "Storage pool not found", nil)
+				return
+			}
+			entry.Path = zoneExportPath(zone, filepath.Join(pool.Path, zone.Path))
+			if err := validateNFSExport(&entry); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+
+			updated, err := setZoneNFSExport(store, zone, entry.Clients)
+			if err != nil {
+				writeNFSExportError(w, err)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(zoneNFSEntry(store, updated))
+			return
+		}
+
+		if err := validateNFSExport(&entry); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if info, err := os.Stat(entry.Path); err != nil || !info.IsDir() {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Path must be an existing directory", nil)
+			return
+		}
+		if zone := zoneExportForPath(store, entry.Path); zone != nil {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, fmt.Sprintf("Path is already exported by zone %s", zone.Name), nil)
+			return
+		}
+
+		nfsConfigMu.Lock()
+		defer nfsConfigMu.Unlock()
+
+		blocks, err := readExportsFile()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if findExportBlock(blocks, entry.Path) >= 0 {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Path is already exported", nil)
+			return
+		}
+
+		entry.Source = models.NFSExportSourceFile
+		blocks = append(blocks, exportsBlock{lines: []string{formatNFSExportLine(&entry)}, entry: &entry})
+		if err := writeExportsFile(blocks); err != nil {
+			writeNFSExportError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+// UpdateNFSExport replaces the clients of the export of ?path=. Exports of zones update the zone.
+func UpdateNFSExport(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		if path == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "path is required", nil)
+			return
+		}
+
+		var entry models.NFSExportEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+		entry.Path = path
+		if err := validateNFSExport(&entry); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		if zone := zoneExportForPath(store, path); zone != nil {
+			updated, err := setZoneNFSExport(store, zone, entry.Clients)
+			if err != nil {
+				writeNFSExportError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(zoneNFSEntry(store, updated))
+			return
+		}
+
+		nfsConfigMu.Lock()
+		defer nfsConfigMu.Unlock()
+
+		blocks, err := readExportsFile()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		i := findExportBlock(blocks, path)
+		if i < 0 {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeExportNotFound, "Export not found", nil)
+			return
+		}
+
+		entry.ZoneID = ""
+		entry.Source = models.NFSExportSourceFile
+		blocks[i] = exportsBlock{lines: []string{formatNFSExportLine(&entry)}, entry: &entry}
+		if err := writeExportsFile(blocks); err != nil {
+			writeNFSExportError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+// DeleteNFSExport removes the export of ?path=. Exports of zones disable NFS on the zone.
+func DeleteNFSExport(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		if path == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "path is required", nil)
+			return
+		}
+
+		if zone := zoneExportForPath(store, path); zone != nil {
+			if _, err := setZoneNFSExport(store, zone, nil); err != nil {
+				writeNFSExportError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		nfsConfigMu.Lock()
+		defer nfsConfigMu.Unlock()
+
+		blocks, err := readExportsFile()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		i := findExportBlock(blocks, path)
+		if i < 0 {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeExportNotFound, "Export not found", nil)
+			return
+		}
+
+		blocks = append(blocks[:i], blocks[i+1:]...)
+		if err := writeExportsFile(blocks); err != nil {
+			writeNFSExportError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// zoneNFSEntry returns the export generated for a zone
+func zoneNFSEntry(store storage.DataStore, zone *models.ShareZone) *models.NFSExportEntry {
+	for _, export := range zoneNFSExports(store) {
+		if export.ZoneID == zone.ID {
+			return &export
+		}
+	}
+	return nil
+}
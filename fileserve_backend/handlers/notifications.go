@@ -0,0 +1,567 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/internal/mailer"
+	"fileserv/internal/notify"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultLargeUploadMB = 1024
+
+	// failedLoginNotifyInterval limits failed login notifications to one per client IP in
+	// this window, so a brute-force run does not flood the channels
+	failedLoginNotifyInterval = 15 * time.Minute
+)
+
+// Notifier routes events from the event bus to the notification channels subscribed to them
+type Notifier struct {
+	store    storage.DataStore
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+
+	failedLogins map[string]time.Time // Client IP -> last failed login notification
+}
+
+// NewNotifier creates a new notifier
+func NewNotifier(store storage.DataStore) *Notifier {
+	return &Notifier{
+		store:        store,
+		stopChan:     make(chan struct{}),
+		failedLogins: make(map[string]time.Time),
+	}
+}
+
+// Start subscribes to the event bus and begins routing events
+func (n *Notifier) Start() {
+	n.mu.Lock()
+	if n.running {
+		n.mu.Unlock()
+		return
+	}
+	n.running = true
+	n.stopChan = make(chan struct{})
+	n.mu.Unlock()
+
+	sub := events.Default.Subscribe()
+	n.wg.Add(1)
+	go n.run(sub)
+	log.Println("Notifier started")
+}
+
+// Stop stops routing events
+func (n *Notifier) Stop() {
+	n.mu.Lock()
+	if !n.running {
+		n.mu.Unlock()
+		return
+	}
+	n.running = false
+	close(n.stopChan)
+	n.mu.Unlock()
+
+	n.wg.Wait()
+	log.Println("Notifier stopped")
+}
+
+// run is the main notifier loop
+func (n *Notifier) run(sub *events.Subscription) {
+	defer n.wg.Done()
+	defer sub.Close()
+
+	for {
+		select {
+		case <-n.stopChan:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if event, msg := n.notificationFor(e); msg != nil {
+				dispatchNotification(n.store, event, msg)
+			}
+		}
+	}
+}
+
+// notificationFor turns a bus event into a notification, or returns nil when the event is
+// not routed or does not meet its threshold
+func (n *Notifier) notificationFor(e *events.Event) (string, *notify.Message) {
+	switch e.Type {
+	case events.TypeStorageAlertRaised, events.TypeStorageAlertResolved:
+		record, ok := e.Data.(models.StorageAlertRecord)
+		if !ok {
+			return "", nil
+		}
+		settings := GetAlertSettingsFromStore(n.store)
+		if alertLevelRank[record.Level] < alertLevelRank[settings.NotifyMinLevel] {
+			return "", nil
+		}
+		resolved := e.Type == events.TypeStorageAlertResolved
+		title, body := storageAlertNotice(&record, resolved)
+		level := record.Level
+		if resolved {
+			level = notify.LevelInfo
+		}
+		return models.NotifyEventStorageAlert, &notify.Message{
+			Event: models.NotifyEventStorageAlert,
+			Title: title,
+			Body:  body,
+			Level: level,
+			Time:  e.Time,
+			Data: map[string]interface{}{
+				"alert":    record,
+				"resolved": resolved,
+			},
+		}
+
+	case events.TypeSnapshotFailed:
+		data, _ := e.Data.(map[string]interface{})
+		return models.NotifyEventSnapshotFailed, &notify.Message{
+			Event: models.NotifyEventSnapshotFailed,
+			Title: fmt.Sprintf("Snapshot policy %v failed", data["policy_name"]),
+			Body:  fmt.Sprintf("Dataset: %v\nSnapshot: %v\nError: %v\n", data["dataset"], data["snapshot"], data["error"]),
+			Level: notify.LevelCritical,
+			Time:  e.Time,
+			Data:  data,
+		}
+
+	case events.TypeLoginFailed:
+		data, _ := e.Data.(map[string]interface{})
+		ip, _ := data["ip"].(string)
+		n.mu.Lock()
+		last, seen := n.failedLogins[ip]
+		throttled := seen && e.Time.Sub(last) < failedLoginNotifyInterval
+		if !throttled {
+			n.failedLogins[ip] = e.Time
+			for key, t := range n.failedLogins {
+				if e.Time.Sub(t) >= failedLoginNotifyInterval {
+					delete(n.failedLogins, key)
+				}
+			}
+		}
+		n.mu.Unlock()
+		if throttled {
+			return "", nil
+		}
+		return models.NotifyEventFailedLogin, &notify.Message{
+			Event: models.NotifyEventFailedLogin,
+			Title: fmt.Sprintf("Failed login for %q from %s", data["username"], ip),
+			Body: fmt.Sprintf("A login attempt for user %q from %s was rejected. Further failures from this address are not reported for %s.\n",
+				data["username"], ip, failedLoginNotifyInterval),
+			Level: notify.LevelWarning,
+			Time:  e.Time,
+			Data:  data,
+		}
+
+	case events.TypeSecurityEvent:
+		// Authentication failures are reported through TypeLoginFailed with throttling
+		record, ok := e.Data.(models.SecurityEvent)
+		if !ok {
+			return "", nil
+		}
+		var event, title string
+		switch record.Type {
+		case models.SecurityEventPrivilegeEscalation:
+			event, title = models.NotifyEventPrivilegeEscalation, fmt.Sprintf("Admin rights granted to %s", record.Target)
+		case models.SecurityEventPowerControl:
+			event, title = models.NotifyEventPowerControl, fmt.Sprintf("System %s requested by %s", record.Target, record.Actor)
+		default:
+			return "", nil
+		}
+		return event, &notify.Message{
+			Event: event,
+			Title: title,
+			Body:  fmt.Sprintf("%s.\nBy: %s\nFrom: %s\n", record.Message, record.Actor, record.IP),
+			Level: notify.LevelWarning,
+			Time:  e.Time,
+			Data: map[string]interface{}{
+				"event": record,
+			},
+		}
+
+	case events.TypeUPSPowerEvent:
+		data, _ := e.Data.(map[string]interface{})
+		message, _ := data["message"].(string)
+		level, _ := data["level"].(string)
+		return models.NotifyEventUPSPower, &notify.Message{
+			Event: models.NotifyEventUPSPower,
+			Title: message,
+			Body:  fmt.Sprintf("%s.\nUPS status: %v\n", message, data["status"]),
+			Level: level,
+			Time:  e.Time,
+			Data:  data,
+		}
+
+	case events.TypeUploadCompleted, events.TypeShareUploadReceived:
+		data, _ := e.Data.(map[string]interface{})
+		size, _ := data["size"].(int64)
+		threshold := int64(GetNotificationSettingsFromStore(n.store).LargeUploadMB) * 1024 * 1024
+		if size < threshold {
+			return "", nil
+		}
+		name, _ := data["name"].(string)
+		uploader := e.UserID
+		if user, err := n.store.GetUserByID(e.UserID); err == nil {
+			uploader = user.Username
+		}
+		body := fmt.Sprintf("%s (%s) was uploaded by %s.\n", name, formatBytes(uint64(size)), uploader)
+		if e.Type == events.TypeShareUploadReceived {
+			name, _ = data["filename"].(string)
+			body = fmt.Sprintf("%s (%s) was uploaded to share link %v from %v.\n", name, formatBytes(uint64(size)), data["name"], data["ip"])
+		}
+		return models.NotifyEventLargeUpload, &notify.Message{
+			Event: models.NotifyEventLargeUpload,
+			Title: fmt.Sprintf("Large upload: %s", name),
+			Body:  body,
+			Level: notify.LevelInfo,
+			Time:  e.Time,
+			Data:  data,
+		}
+	}
+	return "", nil
+}
+
+// dispatchNotification sends a message to every enabled channel subscribed to event. Delivery
+// happens in the background and its outcome is recorded on the channel.
+func dispatchNotification(store storage.DataStore, event string, msg *notify.Message) {
+	for _, channel := range store.ListNotificationChannels() {
+		if !channel.Enabled || !channel.Subscribed(event) {
+			continue
+		}
+		go func(channel *models.NotificationChannel) {
+			if err := deliverNotification(store, channel, msg); err != nil {
+				log.Printf("Notifications: delivery to channel %s failed: %v", channel.Name, err)
+			}
+		}(channel)
+	}
+}
+
+// deliverNotification sends a message to a channel and records the result
+func deliverNotification(store storage.DataStore, channel *models.NotificationChannel, msg *notify.Message) error {
+	var err error
+	if channel.Type == models.ChannelTypeEmail {
+		settings := GetSMTPSettingsFromStore(store)
+		if !settings.Enabled {
+			err = errors.New("outgoing email is not enabled")
+		} else {
+			err = mailer.Send(mailerConfig(settings), &mailer.Message{
+				To:      channel.EmailRecipients,
+				Subject: msg.Title,
+				Body:    msg.Body,
+			})
+		}
+	} else {
+		err = notify.Send(notify.Target{Service: channel.Type, URL: channel.URL, Token: channel.Token}, msg)
+	}
+
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+	}
+	store.UpdateNotificationChannelStatus(channel.ID, time.Now(), lastError)
+	return err
+}
+
+// GetNotificationSettingsFromStore returns the notification routing settings
+func GetNotificationSettingsFromStore(store storage.DataStore) models.NotificationSettings {
+	settings := models.NotificationSettings{
+		LargeUploadMB: defaultLargeUploadMB,
+		Events:        models.NotifyEvents,
+	}
+	if setting, err := store.GetSetting(models.SettingNotifyLargeUploadMB); err == nil && setting != nil {
+		if v, err := strconv.Atoi(setting.Value); err == nil && v > 0 {
+			settings.LargeUploadMB = v
+		}
+	}
+	return settings
+}
+
+// GetNotificationSettings returns the notification routing settings
+func GetNotificationSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GetNotificationSettingsFromStore(store))
+	}
+}
+
+// UpdateNotificationSettings saves the notification routing settings
+func UpdateNotificationSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := GetNotificationSettingsFromStore(store)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if req.LargeUploadMB <= 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "large_upload_mb must be greater than 0", nil)
+			return
+		}
+
+		store.SetSetting(models.SettingNotifyLargeUploadMB, strconv.Itoa(req.LargeUploadMB), "int", string(models.CategoryGeneral))
+
+		GetNotificationSettings(store)(w, r)
+	}
+}
+
+// NotificationChannelRequest holds the fields of a create or update request. Fields left out
+// of an update keep their current value.
+type NotificationChannelRequest struct {
+	Name            *string   `json:"name,omitempty"`
+	Type            *string   `json:"type,omitempty"`
+	URL             *string   `json:"url,omitempty"`
+	Token           *string   `json:"token,omitempty"` // Empty keeps the stored token
+	ClearToken      bool      `json:"clear_token,omitempty"`
+	EmailRecipients *[]string `json:"email_recipients,omitempty"`
+	Events          *[]string `json:"events,omitempty"`
+	Enabled         *bool     `json:"enabled,omitempty"`
+}
+
+// notificationChannelResponse hides the stored token from API responses
+type notificationChannelResponse struct {
+	*models.NotificationChannel
+	TokenSet bool `json:"token_set"`
+}
+
+func newNotificationChannelResponse(channel *models.NotificationChannel) notificationChannelResponse {
+	return notificationChannelResponse{NotificationChannel: channel, TokenSet: channel.Token != ""}
+}
+
+// updateNotificationChannelFields applies the fields present in req to channel
+func updateNotificationChannelFields(channel *models.NotificationChannel, req *NotificationChannelRequest) {
+	if req.Name != nil {
+		channel.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Type != nil {
+		channel.Type = strings.ToLower(strings.TrimSpace(*req.Type))
+	}
+	if req.URL != nil {
+		channel.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.Token != nil && *req.Token != "" {
+		channel.Token = *req.Token
+	}
+	if req.ClearToken {
+		channel.Token = ""
+	}
+	if req.EmailRecipients != nil {
+		channel.EmailRecipients = []string{}
+		for _, to := range *req.EmailRecipients {
+			if to = strings.TrimSpace(to); to != "" {
+				channel.EmailRecipients = append(channel.EmailRecipients, to)
+			}
+		}
+	}
+	if req.Events != nil {
+		channel.Events = []string{}
+		seen := make(map[string]bool)
+		for _, event := range *req.Events {
+			if event = strings.TrimSpace(event); event != "" && !seen[event] {
+				seen[event] = true
+				channel.Events = append(channel.Events, event)
+			}
+		}
+	}
+	if req.Enabled != nil {
+		channel.Enabled = *req.Enabled
+	}
+}
+
+// validateNotificationChannel checks a channel's type, destination and events. Settings that
+// do not apply to the channel type are cleared.
+func validateNotificationChannel(channel *models.NotificationChannel) error {
+	if channel.Name == "" || len(channel.Name) > 64 {
+		return errors.New("name is required (max 64 characters)")
+	}
+
+	switch channel.Type {
+	case models.ChannelTypeEmail:
+		if len(channel.EmailRecipients) == 0 {
+			return errors.New("email channels need at least one recipient")
+		}
+		for _, to := range channel.EmailRecipients {
+			if err := mailer.ValidateAddress(to); err != nil {
+				return err
+			}
+		}
+		channel.URL = ""
+		channel.Token = ""
+	case models.ChannelTypeWebhook, models.ChannelTypeSlack, models.ChannelTypeDiscord, models.ChannelTypeNtfy:
+		if err := notify.ValidateURL(channel.URL); err != nil {
+			return err
+		}
+		channel.EmailRecipients = []string{}
+		if channel.Type == models.ChannelTypeSlack || channel.Type == models.ChannelTypeDiscord {
+			// The webhook URL itself is the credential
+			channel.Token = ""
+		}
+	default:
+		return errors.New("invalid type: must be webhook, slack, discord, ntfy or email")
+	}
+
+	for _, event := range channel.Events {
+		valid := false
+		for _, known := range models.NotifyEvents {
+			if event == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unknown event '%s'. Events: %s", event, strings.Join(models.NotifyEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// ListNotificationChannels returns all notification channels
+func ListNotificationChannels(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channels := []notificationChannelResponse{}
+		for _, channel := range store.ListNotificationChannels() {
+			channels = append(channels, newNotificationChannelResponse(channel))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(channels)
+	}
+}
+
+// GetNotificationChannel returns a single notification channel
+func GetNotificationChannel(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channel, err := store.GetNotificationChannel(chi.URLParam(r, "id"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeChannelNotFound, err.Error(), nil)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newNotificationChannelResponse(channel))
+	}
+}
+
+// CreateNotificationChannel adds a notification channel
+func CreateNotificationChannel(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req NotificationChannelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request: "+err.Error(), nil)
+			return
+		}
+
+		channel := &models.NotificationChannel{EmailRecipients: []string{}, Events: []string{}, Enabled: true}
+		updateNotificationChannelFields(channel, &req)
+		if err := validateNotificationChannel(channel); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		created, err := store.CreateNotificationChannel(channel)
+		if err != nil {
+			if strings.Contains(err.Error(), "already exists") {
+				apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, err.Error(), nil)
+				return
+			}
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newNotificationChannelResponse(created))
+	}
+}
+
+// UpdateNotificationChannel changes a notification channel
+func UpdateNotificationChannel(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channel, err := store.GetNotificationChannel(chi.URLParam(r, "id"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeChannelNotFound, err.Error(), nil)
+			return
+		}
+
+		var req NotificationChannelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request: "+err.Error(), nil)
+			return
+		}
+
+		updateNotificationChannelFields(channel, &req)
+		if err := validateNotificationChannel(channel); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		updated, err := store.UpdateNotificationChannel(channel)
+		if err != nil {
+			if strings.Contains(err.Error(), "already exists") {
+				apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, err.Error(), nil)
+				return
+			}
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newNotificationChannelResponse(updated))
+	}
+}
+
+// DeleteNotificationChannel removes a notification channel
+func DeleteNotificationChannel(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := store.DeleteNotificationChannel(chi.URLParam(r, "id")); err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeChannelNotFound, err.Error(), nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// TestNotificationChannel sends a test message to a channel, whether or not it is enabled,
+// and reports the delivery error if there is one
+func TestNotificationChannel(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channel, err := store.GetNotificationChannel(chi.URLParam(r, "id"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeChannelNotFound, err.Error(), nil)
+			return
+		}
+
+		msg := &notify.Message{
+			Event: "test",
+			Title: "FileServ test notification",
+			Body:  fmt.Sprintf("This is a test message for notification channel %q. It is configured correctly.\n", channel.Name),
+			Level: notify.LevelInfo,
+			Time:  time.Now(),
+		}
+		if err := deliverNotification(store, channel, msg); err != nil {
+			apierror.Error(w, "Failed to send notification: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf("Test notification sent to '%s'", channel.Name)})
+	}
+}
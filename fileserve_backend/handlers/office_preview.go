@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// officeConvertTimeout bounds the time spent converting one document
+const officeConvertTimeout = 2 * time.Minute
+
+// officePreviewExtensions are the document types rendered to PDF for previews
+var officePreviewExtensions = map[string]bool{
+	"doc": true, "docx": true, "odt": true, "rtf": true,
+	"xls": true, "xlsx": true, "ods": true,
+	"ppt": true, "pptx": true, "odp": true,
+}
+
+// GetOfficePreviewSettingsFromStore returns the office document preview settings
+func GetOfficePreviewSettingsFromStore(store storage.DataStore) models.OfficePreviewSettings {
+	settings := models.OfficePreviewSettings{
+		MaxSizeMB: models.DefaultOfficePreviewMaxSizeMB,
+	}
+	if setting, err := store.GetSetting(models.SettingOfficePreviewEnabled); err == nil && setting != nil {
+		settings.Enabled = setting.Value == "true"
+	}
+	if setting, err := store.GetSetting(models.SettingOfficePreviewGotenberg); err == nil && setting != nil {
+		settings.GotenbergURL = setting.Value
+	}
+	if setting, err := store.GetSetting(models.SettingOfficePreviewMaxSizeMB); err == nil && setting != nil {
+		if n, err := strconv.Atoi(setting.Value); err == nil && n > 0 {
+			settings.MaxSizeMB = n
+		}
+	}
+	return settings
+}
+
+// libreOfficeBinary returns the LibreOffice executable found in PATH
+func libreOfficeBinary() (string, error) {
+	for _, name := range []string{"soffice", "libreoffice"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("LibreOffice is not installed (install libreoffice or configure a Gotenberg URL)")
+}
+
+// convertWithLibreOffice renders a document to PDF with a headless LibreOffice. Each conversion
+// uses its own profile directory so conversions can run side by side.
+func convertWithLibreOffice(fullPath string) ([]byte, error) {
+	binary, err := libreOfficeBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	workDir, err := os.MkdirTemp("", "fileserv-office-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), officeConvertTimeout)
+	defer cancel()
+
+	profile := (&url.URL{Scheme: "file", Path: filepath.Join(workDir, "profile")}).String()
+	output, err := exec.CommandContext(ctx, binary, "-env:UserInstallation="+profile,
+		"--headless", "--norestore", "--convert-to", "pdf", "--outdir", workDir, fullPath).CombinedOutput()
+	if ctx.Err() != nil {
+		return nil, errors.New("timed out converting document")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LibreOffice failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	name := strings.TrimSuffix(filepath.Base(fullPath), filepath.Ext(fullPath)) + ".pdf"
+	pdf, err := os.ReadFile(filepath.Join(workDir, name))
+	if err != nil {
+		return nil, errors.New("LibreOffice did not produce a PDF")
+	}
+	return pdf, nil
+}
+
+// convertWithGotenberg renders a document to PDF with the LibreOffice route of a Gotenberg instance
+func convertWithGotenberg(baseURL, fullPath string) ([]byte, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("files", filepath.Base(fullPath))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, err
+	}
+	form.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), officeConvertTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/forms/libreoffice/convert", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Gotenberg request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("Gotenberg returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// checkOfficeConverter reports whether the configured converter can be used
+func checkOfficeConverter(settings models.OfficePreviewSettings) error {
+	if settings.GotenbergURL == "" {
+		_, err := libreOfficeBinary()
+		return err
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(settings.GotenbergURL, "/") + "/health")
+	if err != nil {
+		return fmt.Errorf("Gotenberg is not reachable: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Gotenberg health check returned %s", resp.Status)
+	}
+	return nil
+}
+
+// serveOfficePreview renders a document to PDF with the configured converter, caching the result
+// until the document changes
+func (h *PreviewHandler) serveOfficePreview(w http.ResponseWriter, r *http.Request, fullPath string, pool *models.StoragePool) {
+	settings := GetOfficePreviewSettingsFromStore(h.store)
+	if !settings.Enabled {
+		apierror.Error(w, "Document previews are not enabled", http.StatusNotImplemented)
+		return
+	}
+	maxSize := int64(settings.MaxSizeMB) * 1024 * 1024
+
+	// The converters work on local files; object storage documents are copied to a temp file
+	source := fullPath
+	var key string
+	if pool.IsS3() {
+		b, ok := zoneBackend(w, pool)
+		if !ok {
+			return
+		}
+		p := backendPath(pool, fullPath)
+		info, err := b.Stat(p)
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		if info.IsDir {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a supported document", nil)
+			return
+		}
+		if info.Size > maxSize {
+			apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, fmt.Sprintf("Document is larger than the %d MB preview limit", settings.MaxSizeMB), nil)
+			return
+		}
+		key = officePreviewKey(fullPath, info.Size, info.ModTime)
+		if path, ok := h.cache.Get(key); ok {
+			servePreview(w, r, path)
+			return
+		}
+
+		rc, err := b.Open(p, 0, -1)
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		tmp, err := os.CreateTemp("", "fileserv-office-*"+filepath.Ext(fullPath))
+		if err != nil {
+			rc.Close()
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(tmp.Name())
+		_, err = io.Copy(tmp, io.LimitReader(rc, maxSize))
+		rc.Close()
+		tmp.Close()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		source = tmp.Name()
+	} else {
+		info, err := os.Stat(fullPath)
+		if err != nil || !info.Mode().IsRegular() {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+			return
+		}
+		if info.Size() > maxSize {
+			apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, fmt.Sprintf("Document is larger than the %d MB preview limit", settings.MaxSizeMB), nil)
+			return
+		}
+		key = officePreviewKey(fullPath, info.Size(), info.ModTime())
+		if path, ok := h.cache.Get(key); ok {
+			servePreview(w, r, path)
+			return
+		}
+	}
+
+	h.conversions <- struct{}{}
+	var pdf []byte
+	var err error
+	if settings.GotenbergURL != "" {
+		pdf, err = convertWithGotenberg(settings.GotenbergURL, source)
+	} else {
+		pdf, err = convertWithLibreOffice(source)
+	}
+	<-h.conversions
+	if err != nil {
+		log.Printf("Preview: failed to convert %s: %v", fullPath, err)
+		apierror.Write(w, http.StatusUnprocessableEntity, apierror.CodeUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	path, err := h.cache.Put(key, "pdf", pdf)
+	if err != nil {
+		log.Printf("Preview cache: failed to store preview of %s: %v", fullPath, err)
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		http.ServeContent(w, r, "preview.pdf", time.Now(), bytes.NewReader(pdf))
+		return
+	}
+	servePreview(w, r, path)
+}
+
+// officePreviewKey identifies the PDF rendering of one version of a document
+func officePreviewKey(fullPath string, size int64, modTime time.Time) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("office\x00%s\x00%d\x00%d", fullPath, size, modTime.UnixNano())))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetOfficePreviewSettings returns the document preview settings and whether the converter is
+// available (admin only)
+func GetOfficePreviewSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings := GetOfficePreviewSettingsFromStore(store)
+
+		status := map[string]interface{}{
+			"settings":            settings,
+			"converter_available": false,
+		}
+		if err := checkOfficeConverter(settings); err != nil {
+			status["error"] = err.Error()
+		} else {
+			status["converter_available"] = true
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// UpdateOfficePreviewSettings saves the document preview settings (admin only)
+func UpdateOfficePreviewSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := GetOfficePreviewSettingsFromStore(store)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		req.GotenbergURL = strings.TrimSpace(req.GotenbergURL)
+		if req.GotenbergURL != "" {
+			u, err := url.Parse(req.GotenbergURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Gotenberg URL must be an http or https URL", nil)
+				return
+			}
+		}
+		if req.MaxSizeMB < 1 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "max_size_mb must be at least 1", nil)
+			return
+		}
+
+		category := string(models.CategoryStorage)
+		store.SetSetting(models.SettingOfficePreviewEnabled, strconv.FormatBool(req.Enabled), "bool", category)
+		store.SetSetting(models.SettingOfficePreviewGotenberg, req.GotenbergURL, "string", category)
+		store.SetSetting(models.SettingOfficePreviewMaxSizeMB, strconv.Itoa(req.MaxSizeMB), "int", category)
+
+		GetOfficePreviewSettings(store)(w, r)
+	}
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+)
+
+var (
+	partitionDeviceRegex     = regexp.MustCompile(`^(/dev/[a-z]+)(\d+)$`)
+	nvmePartitionDeviceRegex = regexp.MustCompile(`^(/dev/nvme\d+n\d+)p(\d+)$`)
+	partitionTypeGUIDRegex   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	partitionTypeMBRRegex    = regexp.MustCompile(`^[0-9a-fA-F]{1,2}$`)
+)
+
+// gptPartitionTypes maps partition type names to GPT type GUIDs
+var gptPartitionTypes = map[string]string{
+	"esp":   "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+	"bios":  "21686148-6449-6E6F-744E-656564454649",
+	"linux": "0FC63DAF-8483-4772-8E79-3D69D8477DE4",
+	"lvm":   "E6D6D379-F507-44C2-A23C-238F2A3DF928",
+	"raid":  "A19D880F-05FC-4D3B-A006-743F0F84911E",
+	"swap":  "0657FD6D-A4AB-43C4-84E5-0933C84B4F4F",
+	"zfs":   "6A898CC3-1DD2-11B2-99A6-080020736631",
+}
+
+// mbrPartitionTypes maps partition type names to MBR type codes
+var mbrPartitionTypes = map[string]string{
+	"esp":   "ef",
+	"linux": "83",
+	"lvm":   "8e",
+	"raid":  "fd",
+	"swap":  "82",
+}
+
+// partitionTypeName returns the name of a known partition type GUID or code
+func partitionTypeName(label, partType string) string {
+	types := gptPartitionTypes
+	if label == "dos" {
+		types = mbrPartitionTypes
+	}
+	for name, t := range types {
+		if strings.EqualFold(t, partType) {
+			return name
+		}
+	}
+	return ""
+}
+
+// splitPartitionDevice splits a partition path into its disk and partition number,
+// e.g. /dev/sda1 -> /dev/sda, 1 and /dev/nvme0n1p2 -> /dev/nvme0n1, 2
+func splitPartitionDevice(device string) (string, int, error) {
+	matches := partitionDeviceRegex.FindStringSubmatch(device)
+	if matches == nil {
+		matches = nvmePartitionDeviceRegex.FindStringSubmatch(device)
+	}
+	if matches == nil {
+		return "", 0, fmt.Errorf("cannot parse partition device path %s", device)
+	}
+	number, _ := strconv.Atoi(matches[2])
+	return matches[1], number, nil
+}
+
+// readPartitionTable reads a disk's partition table with sfdisk
+func readPartitionTable(disk string) (*models.PartitionTable, error) {
+	output, err := exec.Command("sfdisk", "--json", disk).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partition table: %s", commandError(output, err))
+	}
+
+	var sfdiskOutput struct {
+		PartitionTable struct {
+			Label      string `json:"label"`
+			ID         string `json:"id"`
+			FirstLBA   uint64 `json:"firstlba"`
+			LastLBA    uint64 `json:"lastlba"`
+			SectorSize uint64 `json:"sectorsize"`
+			Partitions []struct {
+				Node     string `json:"node"`
+				Start    uint64 `json:"start"`
+				Size     uint64 `json:"size"`
+				Type     string `json:"type"`
+				UUID     string `json:"uuid"`
+				Name     string `json:"name"`
+				Bootable bool   `json:"bootable"`
+			} `json:"partitions"`
+		} `json:"partitiontable"`
+	}
+	if err := json.Unmarshal(output, &sfdiskOutput); err != nil {
+		return nil, fmt.Errorf("failed to parse sfdisk output: %v", err)
+	}
+	pt := sfdiskOutput.PartitionTable
+
+	table := &models.PartitionTable{
+		Disk:       disk,
+		Label:      pt.Label,
+		ID:         pt.ID,
+		SectorSize: pt.SectorSize,
+		FirstLBA:   pt.FirstLBA,
+		LastLBA:    pt.LastLBA,
+		Partitions: []models.PartitionTableEntry{},
+	}
+	if table.SectorSize == 0 {
+		table.SectorSize = 512
+	}
+	if table.LastLBA == 0 {
+		// Older sfdisk leaves out lastlba for MBR disks
+		if size, err := blockDeviceSize(disk); err == nil {
+			table.LastLBA = size/table.SectorSize - 1
+		}
+	}
+
+	for _, p := range pt.Partitions {
+		_, number, _ := splitPartitionDevice(p.Node)
+		table.Partitions = append(table.Partitions, models.PartitionTableEntry{
+			Number:    number,
+			Device:    p.Node,
+			Start:     p.Start,
+			End:       p.Start + p.Size - 1,
+			Size:      p.Size * table.SectorSize,
+			SizeHuman: formatBytes(p.Size * table.SectorSize),
+			Type:      p.Type,
+			TypeName:  partitionTypeName(pt.Label, p.Type),
+			UUID:      p.UUID,
+			Name:      p.Name,
+			Bootable:  p.Bootable,
+		})
+	}
+
+	// A partition can grow up to the start of the next one on the disk
+	byStart := make([]*models.PartitionTableEntry, len(table.Partitions))
+	for i := range table.Partitions {
+		byStart[i] = &table.Partitions[i]
+	}
+	sort.Slice(byStart, func(i, j int) bool { return byStart[i].Start < byStart[j].Start })
+	for i, p := range byStart {
+		p.MaxEnd = table.LastLBA
+		if i+1 < len(byStart) {
+			p.MaxEnd = byStart[i+1].Start - 1
+		}
+	}
+
+	return table, nil
+}
+
+// partitionEntry finds a partition in a table by number
+func partitionEntry(table *models.PartitionTable, number int) (*models.PartitionTableEntry, bool) {
+	for i := range table.Partitions {
+		if table.Partitions[i].Number == number {
+			return &table.Partitions[i], true
+		}
+	}
+	return nil, false
+}
+
+// isDeviceMounted reports whether a device is mounted
+func isDeviceMounted(device string) bool {
+	mounts, _ := getMountPoints()
+	for _, m := range mounts {
+		if m.Device == device {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPartitionTable returns the structured partition table of a disk
+func GetPartitionTable() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		disk := r.URL.Query().Get("disk")
+		if err := validateDevicePath(disk); err != nil || !strings.HasPrefix(disk, "/dev/") {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid disk path", nil)
+			return
+		}
+
+		table, err := readPartitionTable(disk)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(table)
+	}
+}
+
+// ResizePartition moves the end sector of a partition. Growing is always allowed up to the
+// next partition; shrinking cuts off whatever the filesystem keeps there, so it needs force
+// and an unmounted partition. The filesystem itself is resized separately.
+func ResizePartition() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Device    string `json:"device"`
+			EndSector uint64 `json:"end_sector"` // New last sector; ignored with max
+			Max       bool   `json:"max"`        // Grow to the next partition or the end of the disk
+			Force     bool   `json:"force"`      // Confirms shrinking
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		disk, number, err := splitPartitionDevice(req.Device)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		table, err := readPartitionTable(disk)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		part, ok := partitionEntry(table, number)
+		if !ok {
+			apierror.Write(w, http.StatusNotFound, apierror.CodePartitionNotFound, fmt.Sprintf("Partition %d not found on %s", number, disk), nil)
+			return
+		}
+
+		end := req.EndSector
+		if req.Max {
+			end = part.MaxEnd
+		}
+		if end <= part.Start {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("end_sector must be after the partition start (%d)", part.Start), nil)
+			return
+		}
+		if end > part.MaxEnd {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("end_sector %d overlaps the next partition or passes the end of the disk (max %d)", end, part.MaxEnd), nil)
+			return
+		}
+		if end == part.End {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Partition already ends at that sector", nil)
+			return
+		}
+		if end < part.End {
+			if !req.Force {
+				apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Shrinking a partition destroys data past the new end unless the filesystem was shrunk first. Set force to continue", nil)
+				return
+			}
+			if isDeviceMounted(req.Device) {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeDeviceMounted, "Partition is currently mounted", nil)
+				return
+			}
+		}
+
+		// With -N, empty fields keep their current value: only the size changes
+		sectors := end - part.Start + 1
+		cmd := exec.Command("sfdisk", "--no-reread", "-N", strconv.Itoa(number), disk)
+		cmd.Stdin = strings.NewReader(fmt.Sprintf(",%d\n", sectors))
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to resize partition: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		// Tell the kernel about the new size; partx works while the partition is in use
+		exec.Command("partx", "-u", disk).Run()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":    fmt.Sprintf("Partition %s now ends at sector %d", req.Device, end),
+			"start":      part.Start,
+			"end":        end,
+			"size":       sectors * table.SectorSize,
+			"size_human": formatBytes(sectors * table.SectorSize),
+		})
+	}
+}
+
+// SetPartitionType sets the type of a partition, by name (esp, lvm, raid, linux, swap, ...)
+// or as a raw GPT type GUID or MBR type code
+func SetPartitionType() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Device string `json:"device"`
+			Type   string `json:"type"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		disk, number, err := splitPartitionDevice(req.Device)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		table, err := readPartitionTable(disk)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if _, ok := partitionEntry(table, number); !ok {
+			apierror.Write(w, http.StatusNotFound, apierror.CodePartitionNotFound, fmt.Sprintf("Partition %d not found on %s", number, disk), nil)
+			return
+		}
+
+		types, typeRegex := gptPartitionTypes, partitionTypeGUIDRegex
+		if table.Label == "dos" {
+			types, typeRegex = mbrPartitionTypes, partitionTypeMBRRegex
+		}
+		partType, ok := types[strings.ToLower(req.Type)]
+		if !ok {
+			if !typeRegex.MatchString(req.Type) {
+				names := make([]string, 0, len(types))
+				for name := range types {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Invalid type for a %s disk: use %s or a raw type", table.Label, strings.Join(names, ", ")), nil)
+				return
+			}
+			partType = req.Type
+		}
+
+		output, err := exec.Command("sfdisk", "--no-reread", "--part-type", disk, strconv.Itoa(number), partType).CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to set partition type: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+		exec.Command("partx", "-u", disk).Run()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message":   fmt.Sprintf("Partition %s type set to %s", req.Device, partType),
+			"type":      partType,
+			"type_name": partitionTypeName(table.Label, partType),
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/internal/webauthn"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// passkeyCeremonyTimeout is how long a passkey registration or sign-in may take
+const passkeyCeremonyTimeout = 5 * time.Minute
+
+// maxPasskeyCeremonies bounds the pending ceremonies, since sign-ins can be started without an account
+const maxPasskeyCeremonies = 1000
+
+// maxPasskeyNameLength bounds the name users give a passkey
+const maxPasskeyNameLength = 64
+
+// passkeyCeremony is a started registration or sign-in waiting for the authenticator's response
+type passkeyCeremony struct {
+	challenge string
+	rp        webauthn.RelyingParty
+	userID    string // Registering user, empty for sign-ins
+	expires   time.Time
+}
+
+// PasskeyHandler registers passkeys (WebAuthn credentials) and signs users in with them.
+// Password login remains available to every account.
+type PasskeyHandler struct {
+	store     storage.DataStore
+	cfg       *config.Config
+	jwtSecret string
+
+	mu         sync.Mutex
+	ceremonies map[string]*passkeyCeremony
+}
+
+// NewPasskeyHandler creates a new passkey handler
+func NewPasskeyHandler(store storage.DataStore, cfg *config.Config, jwtSecret string) *PasskeyHandler {
+	return &PasskeyHandler{
+		store:      store,
+		cfg:        cfg,
+		jwtSecret:  jwtSecret,
+		ceremonies: make(map[string]*passkeyCeremony),
+	}
+}
+
+// passkeyCredential is the credential returned by navigator.credentials.create() or get(),
+// with binary fields encoded as base64url
+type passkeyCredential struct {
+	ID       string `json:"id"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject,omitempty"`
+		AuthenticatorData string `json:"authenticatorData,omitempty"`
+		Signature         string `json:"signature,omitempty"`
+	} `json:"response"`
+}
+
+// relyingParty derives the WebAuthn relying party from the origin the browser is on
+func relyingParty(r *http.Request) (webauthn.RelyingParty, error) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = middleware.BaseURL(r)
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Hostname() == "" {
+		return webauthn.RelyingParty{}, errors.New("cannot determine the site origin")
+	}
+	if net.ParseIP(u.Hostname()) != nil {
+		return webauthn.RelyingParty{}, errors.New("passkeys require the server to be accessed by host name, not IP address")
+	}
+	return webauthn.RelyingParty{ID: u.Hostname(), Origin: u.Scheme + "://" + u.Host}, nil
+}
+
+// begin starts a ceremony and returns its ID and challenge
+func (h *PasskeyHandler) begin(rp webauthn.RelyingParty, userID string) (string, string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id, c := range h.ceremonies {
+		if now.After(c.expires) {
+			delete(h.ceremonies, id)
+		}
+	}
+	if len(h.ceremonies) >= maxPasskeyCeremonies {
+		return "", "", errors.New("too many pending passkey requests, try again later")
+	}
+
+	id := uuid.New().String()
+	h.ceremonies[id] = &passkeyCeremony{
+		challenge: challenge,
+		rp:        rp,
+		userID:    userID,
+		expires:   now.Add(passkeyCeremonyTimeout),
+	}
+	return id, challenge, nil
+}
+
+// take ends a ceremony, returning nil if it is unknown or has expired
+func (h *PasskeyHandler) take(id string) *passkeyCeremony {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.ceremonies[id]
+	if !ok {
+		return nil
+	}
+	delete(h.ceremonies, id)
+	if time.Now().After(c.expires) {
+		return nil
+	}
+	return c
+}
+
+// ListPasskeys returns the current user's passkeys
+func (h *PasskeyHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.ListPasskeysByUser(userCtx.UserID))
+}
+
+// BeginRegistration returns the options for navigator.credentials.create() to add a passkey
+func (h *PasskeyHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+	if userCtx.IsGuest || userCtx.IsAPIToken() || userCtx.IsImpersonated() {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Passkeys can only be added from your own login session", nil)
+		return
+	}
+
+	rp, err := relyingParty(r)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	ceremonyID, challenge, err := h.begin(rp, userCtx.UserID)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	params := []map[string]interface{}{}
+	for _, alg := range webauthn.SupportedAlgorithms {
+		params = append(params, map[string]interface{}{"type": "public-key", "alg": alg})
+	}
+	exclude := []map[string]interface{}{}
+	for _, passkey := range h.store.ListPasskeysByUser(userCtx.UserID) {
+		exclude = append(exclude, map[string]interface{}{"type": "public-key", "id": passkey.CredentialID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ceremony_id": ceremonyID,
+		"options": map[string]interface{}{
+			"challenge": challenge,
+			"rp":        map[string]string{"id": rp.ID, "name": "FileServ"},
+			"user": map[string]string{
+				"id":          base64.RawURLEncoding.EncodeToString([]byte(userCtx.UserID)),
+				"name":        userCtx.Username,
+				"displayName": userCtx.Username,
+			},
+			"pubKeyCredParams":   params,
+			"excludeCredentials": exclude,
+			"authenticatorSelection": map[string]interface{}{
+				"residentKey":        "required",
+				"requireResidentKey": true,
+				"userVerification":   "required",
+			},
+			"attestation": "none",
+			"timeout":     passkeyCeremonyTimeout.Milliseconds(),
+		},
+	})
+}
+
+// FinishRegistration verifies the authenticator's response and stores the new passkey
+func (h *PasskeyHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	var req struct {
+		CeremonyID string            `json:"ceremony_id"`
+		Name       string            `json:"name"`
+		Credential passkeyCredential `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	ceremony := h.take(req.CeremonyID)
+	if ceremony == nil || ceremony.userID != userCtx.UserID {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Passkey registration has expired, please try again", nil)
+		return
+	}
+
+	clientData, err1 := webauthn.DecodeBase64(req.Credential.Response.ClientDataJSON)
+	attestation, err2 := webauthn.DecodeBase64(req.Credential.Response.AttestationObject)
+	if err1 != nil || err2 != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid credential encoding", nil)
+		return
+	}
+	cred, err := ceremony.rp.VerifyRegistration(ceremony.challenge, clientData, attestation)
+	if err != nil {
+		log.Printf("Passkey registration failed for user %s: %v", userCtx.Username, err)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Passkey could not be verified: "+err.Error(), nil)
+		return
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(cred.ID)
+	if _, err := h.store.GetPasskeyByCredentialID(credentialID); err == nil {
+		apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "This passkey is already registered", nil)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = describeDevice(r.UserAgent())
+	}
+	if len(name) > maxPasskeyNameLength {
+		name = name[:maxPasskeyNameLength]
+	}
+
+	passkey := &models.Passkey{
+		ID:           uuid.New().String(),
+		UserID:       userCtx.UserID,
+		Username:     userCtx.Username,
+		Name:         name,
+		CredentialID: credentialID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		CreatedAt:    time.Now(),
+	}
+	if err := h.store.CreatePasskey(passkey); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Passkey %q added for user %s", passkey.Name, userCtx.Username)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(passkey)
+}
+
+// DeletePasskey removes one of the current user's passkeys
+func (h *PasskeyHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	passkey, err := h.store.GetPasskey(chi.URLParam(r, "id"))
+	if err != nil || passkey.UserID != userCtx.UserID {
+		apierror.Write(w, http.StatusNotFound, apierror.CodePasskeyNotFound, "Passkey not found", nil)
+		return
+	}
+	if err := h.store.DeletePasskey(passkey.ID); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Passkey %q removed for user %s", passkey.Name, userCtx.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BeginLogin returns the options for navigator.credentials.get() to sign in with a passkey.
+// Passkeys are discoverable, so the user picks their account in the browser.
+func (h *PasskeyHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	rp, err := relyingParty(r)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	ceremonyID, challenge, err := h.begin(rp, "")
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ceremony_id": ceremonyID,
+		"options": map[string]interface{}{
+			"challenge":        challenge,
+			"rpId":             rp.ID,
+			"allowCredentials": []interface{}{},
+			"userVerification": "required",
+			"timeout":          passkeyCeremonyTimeout.Milliseconds(),
+		},
+	})
+}
+
+// FinishLogin verifies a passkey sign-in and starts a session like a password login
+func (h *PasskeyHandler) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	clientIP := getClientIP(r)
+
+	var req struct {
+		CeremonyID string            `json:"ceremony_id"`
+		Credential passkeyCredential `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
+		return
+	}
+
+	ipKey := lockoutKey(models.LockoutScopeLoginIP, clientIP)
+	if wait := checkLockout(h.store, ipKey); wait > 0 {
+		log.Printf("Rate limited passkey login from IP %s", clientIP)
+		writeLockedOut(w, wait, "login")
+		return
+	}
+	fail := func(username string, err error) {
+		log.Printf("Passkey login failed for user %q from IP %s: %v", username, clientIP, err)
+		recordAuthFailure(h.store, models.LockoutScopeLoginIP, clientIP)
+		recordSecurityEvent(h.store, &models.SecurityEvent{
+			Type:    models.SecurityEventAuthFailure,
+			Source:  "passkey",
+			Actor:   username,
+			IP:      clientIP,
+			Message: "Passkey login failed: " + err.Error(),
+		})
+		events.PublishToAdmins(events.TypeLoginFailed, map[string]interface{}{
+			"username": username,
+			"ip":       clientIP,
+			"method":   "passkey",
+		})
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid credentials", nil)
+	}
+
+	ceremony := h.take(req.CeremonyID)
+	if ceremony == nil || ceremony.userID != "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Passkey sign-in has expired, please try again", nil)
+		return
+	}
+
+	rawID, err := webauthn.DecodeBase64(req.Credential.ID)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid credential encoding", nil)
+		return
+	}
+	passkey, err := h.store.GetPasskeyByCredentialID(base64.RawURLEncoding.EncodeToString(rawID))
+	if err != nil {
+		fail("", errors.New("unknown passkey"))
+		return
+	}
+
+	clientData, err1 := webauthn.DecodeBase64(req.Credential.Response.ClientDataJSON)
+	authData, err2 := webauthn.DecodeBase64(req.Credential.Response.AuthenticatorData)
+	signature, err3 := webauthn.DecodeBase64(req.Credential.Response.Signature)
+	if err1 != nil || err2 != nil || err3 != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid credential encoding", nil)
+		return
+	}
+	cred := webauthn.Credential{ID: rawID, PublicKey: passkey.PublicKey, SignCount: passkey.SignCount}
+	signCount, err := ceremony.rp.VerifyAssertion(ceremony.challenge, cred, clientData, authData, signature)
+	if err != nil {
+		fail(passkey.Username, err)
+		return
+	}
+
+	// The account must still exist under the same name (system UIDs can be reused)
+	account, err := userContextByID(h.store, h.cfg, passkey.UserID)
+	if err != nil || account.Username != passkey.Username {
+		if err == nil {
+			err = errors.New("account was renamed or replaced")
+		}
+		fail(passkey.Username, err)
+		return
+	}
+
+	session, err := startSession(h.store, r, account, h.jwtSecret)
+	if err != nil {
+		log.Printf("Passkey login failed for user %s: cannot create session: %v", account.Username, err)
+		apierror.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	if err := h.store.UpdatePasskeyUsage(passkey.ID, signCount, time.Now()); err != nil {
+		log.Printf("Failed to record use of passkey %s: %v", passkey.ID, err)
+	}
+	// Only the account is reset; the IP counter is left to expire, as for password logins
+	clearAuthFailures(h.store, lockoutKey(models.LockoutScopeLoginAccount, strings.ToLower(account.Username)))
+
+	writeLoginResponse(w, r, h.store, session, account)
+}
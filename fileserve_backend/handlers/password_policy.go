@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordHistory bounds the number of previous passwords kept per user
+const maxPasswordHistory = 24
+
+// GetPasswordPolicyFromStore returns the password policy
+func GetPasswordPolicyFromStore(store storage.DataStore) models.PasswordPolicy {
+	policy := models.PasswordPolicy{
+		MinLength:  models.DefaultPasswordMinLength,
+		MinClasses: models.DefaultPasswordMinClasses,
+	}
+	intSetting := func(key string, value *int) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil {
+			if n, err := strconv.Atoi(setting.Value); err == nil && n >= 0 {
+				*value = n
+			}
+		}
+	}
+	intSetting(models.SettingPasswordMinLength, &policy.MinLength)
+	intSetting(models.SettingPasswordMinClasses, &policy.MinClasses)
+	intSetting(models.SettingPasswordHistory, &policy.History)
+	intSetting(models.SettingPasswordMaxAge, &policy.MaxAgeDays)
+	return policy
+}
+
+// validatePasswordComplexity checks if a new password meets the length and character class
+// requirements of the password policy
+func validatePasswordComplexity(policy models.PasswordPolicy, password string) error {
+	if len(password) < policy.MinLength {
+		return fmt.Errorf("password must be at least %d characters", policy.MinLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			hasSpecial = true
+		}
+	}
+
+	var missing []string
+	classes := 0
+	for _, class := range []struct {
+		present bool
+		name    string
+	}{
+		{hasUpper, "uppercase letters"},
+		{hasLower, "lowercase letters"},
+		{hasDigit, "digits"},
+		{hasSpecial, "special characters"},
+	} {
+		if class.present {
+			classes++
+		} else {
+			missing = append(missing, class.name)
+		}
+	}
+
+	if classes < policy.MinClasses {
+		if policy.MinClasses >= 4 {
+			return fmt.Errorf("password must also contain %s", strings.Join(missing, ", "))
+		}
+		return fmt.Errorf("password must contain at least %d of: uppercase letters, lowercase letters, digits, special characters", policy.MinClasses)
+	}
+
+	return nil
+}
+
+// passwordReused reports whether a password is the current one (currentHash, if known) or one of
+// the recent passwords the policy forbids reusing
+func passwordReused(store storage.DataStore, policy models.PasswordPolicy, username, password, currentHash string) bool {
+	if policy.History <= 0 {
+		return false
+	}
+
+	hashes := []string{}
+	if currentHash != "" {
+		hashes = append(hashes, currentHash)
+	}
+	for i, entry := range store.ListPasswordHistory(username) {
+		if i >= policy.History {
+			break
+		}
+		hashes = append(hashes, entry.PasswordHash)
+	}
+
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// recordPasswordChange adds a new password hash to the user's history, which also dates the
+// password for the maximum age check. An empty hash is computed from password.
+func recordPasswordChange(store storage.DataStore, username, hash, password string) {
+	if hash == "" {
+		h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Printf("Password history: failed to hash password of %s: %v", username, err)
+			return
+		}
+		hash = string(h)
+	}
+
+	keep := GetPasswordPolicyFromStore(store).History
+	entry := &models.PasswordHistoryEntry{Username: username, PasswordHash: hash, ChangedAt: time.Now()}
+	if err := store.AddPasswordHistory(entry, keep); err != nil {
+		log.Printf("Password history: failed to record password change of %s: %v", username, err)
+	}
+}
+
+// passwordExpired reports whether a password last changed at changedAt (or at the newest history
+// entry) has passed the policy's maximum age. A zero changedAt without history never expires.
+func passwordExpired(store storage.DataStore, policy models.PasswordPolicy, username string, changedAt time.Time) bool {
+	if policy.MaxAgeDays <= 0 {
+		return false
+	}
+	if history := store.ListPasswordHistory(username); len(history) > 0 {
+		changedAt = history[0].ChangedAt
+	}
+	if changedAt.IsZero() {
+		return false
+	}
+	return time.Since(changedAt) > time.Duration(policy.MaxAgeDays)*24*time.Hour
+}
+
+// passwordMustChange reports whether a user has to change their password. Internal users whose
+// password has passed the maximum age are flagged with MustChangePassword; system users are only
+// checked when their password was last changed through the server.
+func passwordMustChange(store storage.DataStore, userCtx *middleware.UserContext) bool {
+	if userCtx.IsGuest || userCtx.IsAPIToken() {
+		return false
+	}
+	policy := GetPasswordPolicyFromStore(store)
+
+	user, err := store.GetUserByID(userCtx.UserID)
+	if err != nil {
+		return passwordExpired(store, policy, userCtx.Username, time.Time{})
+	}
+	if user.MustChangePassword {
+		return true
+	}
+	if !passwordExpired(store, policy, user.Username, user.CreatedAt) {
+		return false
+	}
+
+	log.Printf("Password of user %s has expired, requiring a change", user.Username)
+	if _, err := store.UpdateUser(user.ID, map[string]interface{}{"must_change_password": true}); err != nil {
+		log.Printf("Failed to flag expired password of %s: %v", user.Username, err)
+	}
+	return true
+}
+
+// GetPasswordPolicy returns the password policy (admin only)
+func GetPasswordPolicy(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GetPasswordPolicyFromStore(store))
+	}
+}
+
+// UpdatePasswordPolicy saves the password policy (admin only)
+func UpdatePasswordPolicy(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := GetPasswordPolicyFromStore(store)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if req.MinLength < 1 || req.MinLength > 128 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "min_length must be between 1 and 128", nil)
+			return
+		}
+		if req.MinClasses < 0 || req.MinClasses > 4 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "min_classes must be between 0 and 4", nil)
+			return
+		}
+		if req.History < 0 || req.History > maxPasswordHistory {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("history must be between 0 and %d", maxPasswordHistory), nil)
+			return
+		}
+		if req.MaxAgeDays < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "max_age_days cannot be negative", nil)
+			return
+		}
+
+		category := string(models.CategorySecurity)
+		store.SetSetting(models.SettingPasswordMinLength, strconv.Itoa(req.MinLength), "int", category)
+		store.SetSetting(models.SettingPasswordMinClasses, strconv.Itoa(req.MinClasses), "int", category)
+		store.SetSetting(models.SettingPasswordHistory, strconv.Itoa(req.History), "int", category)
+		store.SetSetting(models.SettingPasswordMaxAge, strconv.Itoa(req.MaxAgeDays), "int", category)
+
+		GetPasswordPolicy(store)(w, r)
+	}
+}
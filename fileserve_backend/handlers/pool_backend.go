@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/fileops"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// S3 pools have no local directory. Their Path is a virtual root ("/s3/<bucket>[/<prefix>]") that is
+// only used to resolve zone paths; everything below it is translated to object keys by the backend.
+
+// s3PoolPath returns the virtual root path of an S3 pool
+func s3PoolPath(cfg *models.S3PoolConfig) string {
+	return path.Join("/s3", cfg.Bucket, cfg.Prefix)
+}
+
+// newS3PoolBackend creates the backend for an S3 pool configuration
+func newS3PoolBackend(cfg *models.S3PoolConfig) (*fileops.S3Backend, error) {
+	if cfg == nil {
+		return nil, errors.New("S3 configuration is required")
+	}
+	client, err := fileops.NewS3Client(cfg.Endpoint, cfg.Region, cfg.Bucket, cfg.AccessKey, cfg.SecretKey, cfg.PathStyle)
+	if err != nil {
+		return nil, err
+	}
+	return fileops.NewS3Backend(client, cfg.Prefix), nil
+}
+
+// validateS3PoolConfig checks required fields and that the bucket is reachable
+func validateS3PoolConfig(cfg *models.S3PoolConfig) error {
+	if cfg == nil {
+		return errors.New("S3 configuration is required")
+	}
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return errors.New("S3 endpoint and bucket are required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return errors.New("S3 access key and secret key are required")
+	}
+
+	backend, err := newS3PoolBackend(cfg)
+	if err != nil {
+		return err
+	}
+	if err := backend.Check(); err != nil {
+		return fmt.Errorf("cannot access bucket: %w", err)
+	}
+	return nil
+}
+
+// poolBackend returns the storage backend of a pool, or nil for pools on the local filesystem
+func poolBackend(pool *models.StoragePool) (fileops.Backend, error) {
+	if !pool.IsS3() {
+		return nil, nil
+	}
+	return newS3PoolBackend(pool.S3)
+}
+
+// backendPath converts a resolved zone path into a path relative to the pool root
+func backendPath(pool *models.StoragePool, fullPath string) string {
+	rel, err := filepath.Rel(pool.Path, fullPath)
+	if err != nil || rel == "." {
+		return "/"
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+// backendForPath returns the backend and pool-relative path for a resolved path on a non-local pool
+func backendForPath(store storage.DataStore, fullPath string) (fileops.Backend, string) {
+	zone, _ := zoneForPath(store, fullPath)
+	if zone == nil {
+		return nil, ""
+	}
+	pool, err := store.GetStoragePool(zone.PoolID)
+	if err != nil || !pool.IsS3() {
+		return nil, ""
+	}
+	backend, err := poolBackend(pool)
+	if err != nil {
+		return nil, ""
+	}
+	return backend, backendPath(pool, fullPath)
+}
+
+// redactPool returns a copy of the pool that is safe to send to clients
+func redactPool(pool *models.StoragePool) *models.StoragePool {
+	if pool == nil || pool.S3 == nil {
+		return pool
+	}
+	redacted := *pool
+	s3 := *pool.S3
+	s3.SecretKey = ""
+	redacted.S3 = &s3
+	return &redacted
+}
+
+// zoneBackend returns the backend of a non-local pool, writing an error response if it cannot be created
+func zoneBackend(w http.ResponseWriter, pool *models.StoragePool) (fileops.Backend, bool) {
+	backend, err := poolBackend(pool)
+	if err != nil {
+		apierror.Error(w, "Storage backend unavailable: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return backend, true
+}
+
+// writeBackendError maps backend errors to HTTP responses
+func writeBackendError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+	case errors.Is(err, os.ErrExist):
+		apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "Destination already exists", nil)
+	case errors.Is(err, os.ErrPermission):
+		apierror.Error(w, "Storage backend denied access", http.StatusBadGateway)
+	default:
+		apierror.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
+
+// removeBackendPath permanently deletes a resolved path on a non-local pool
+func removeBackendPath(pool *models.StoragePool, fullPath string) error {
+	backend, err := poolBackend(pool)
+	if err != nil {
+		return err
+	}
+	return backend.Remove(backendPath(pool, fullPath))
+}
+
+// listBackendFiles lists a folder of a zone on a non-local pool
+func (h *ZoneFileHandler) listBackendFiles(w http.ResponseWriter, b fileops.Backend, pool *models.StoragePool, fullPath, relativePath string, opts fileops.ListOptions, foldersOnly bool) {
+	result, err := fileops.ListBackendDirectory(b, backendPath(pool, fullPath), relativePath, opts)
+	if errors.Is(err, fileops.ErrInvalidCursor) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeBackendError(w, err)
+		return
+	}
+	if err != nil {
+		result = &fileops.ListResult{Files: []fileops.FileInfo{}, Limit: opts.Limit, Offset: opts.Offset}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if (opts.Limit > 0 || opts.Cursor != "") && !foldersOnly {
+		json.NewEncoder(w).Encode(result)
+	} else {
+		json.NewEncoder(w).Encode(result.Files)
+	}
+}
+
+// uploadBackendFile stores an uploaded file on a non-local pool
+func (h *ZoneFileHandler) uploadBackendFile(w http.ResponseWriter, userCtx *middleware.UserContext, b fileops.Backend, pool *models.StoragePool, fullPath, targetPath, filename string, file io.Reader) {
+	// Same target rules as local uploads: existing or missing paths are folders, existing files are overwritten
+	finalPath := fullPath
+	actualPath := targetPath
+	info, err := b.Stat(backendPath(pool, fullPath))
+	if (err == nil && info.IsDir) || errors.Is(err, os.ErrNotExist) {
+		finalPath = path.Join(fullPath, filename)
+		actualPath = path.Join("/", targetPath, filename)
+	} else if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	if pool.MaxFileSize > 0 {
+		file = io.LimitReader(file, pool.MaxFileSize+1)
+	}
+
+	written, err := b.Write(backendPath(pool, finalPath), file, "")
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	if pool.MaxFileSize > 0 && written > pool.MaxFileSize {
+		b.Remove(backendPath(pool, finalPath))
+		apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodeUploadTooLarge, fmt.Sprintf("File size %d exceeds maximum allowed %d bytes", written, pool.MaxFileSize), nil)
+		return
+	}
+
+	publishUploadCompleted(h.store, userCtx.UserID, finalPath, written)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "File uploaded successfully",
+		"path":    actualPath,
+		"size":    written,
+	})
+}
+
+// moveBackendPaths implements bulk move on a non-local pool
+func (h *ZoneFileHandler) moveBackendPaths(b fileops.Backend, zoneID string, user *models.User, pool *models.StoragePool, destFullPath string, req BulkMoveRequest) BulkMoveResponse {
+	resp := BulkMoveResponse{
+		Moved:  []BulkMoveResult{},
+		Failed: []BulkErrorDetail{},
+	}
+
+	for _, p := range req.Paths {
+		fullOldPath, _, err := h.resolveZonePath(zoneID, p, user)
+		if err != nil {
+			resp.Failed = append(resp.Failed, BulkErrorDetail{Path: p, Error: err.Error()})
+			continue
+		}
+
+		filename := filepath.Base(fullOldPath)
+		fullNewPath := filepath.Join(destFullPath, filename)
+
+		if err := b.Rename(backendPath(pool, fullOldPath), backendPath(pool, fullNewPath)); err != nil {
+			msg := err.Error()
+			if errors.Is(err, os.ErrExist) {
+				msg = "destination already exists"
+			}
+			resp.Failed = append(resp.Failed, BulkErrorDetail{Path: p, Error: msg})
+			continue
+		}
+
+		resp.Moved = append(resp.Moved, BulkMoveResult{
+			OldPath: p,
+			NewPath: filepath.Join(req.Destination, filename),
+		})
+	}
+	return resp
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -10,6 +11,8 @@ import (
 	"strconv"
 	"syscall"
 
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
 	"fileserv/models"
 	"fileserv/storage"
 
@@ -29,8 +32,9 @@ func (h *PoolHandler) GetStoragePools(w http.ResponseWriter, r *http.Request) {
 	pools := h.store.ListStoragePools()
 
 	// Update space info for each pool
-	for _, pool := range pools {
+	for i, pool := range pools {
 		h.updatePoolSpace(pool)
+		pools[i] = redactPool(pool)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -43,48 +47,64 @@ func (h *PoolHandler) GetStoragePool(w http.ResponseWriter, r *http.Request) {
 
 	pool, err := h.store.GetStoragePool(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodePoolNotFound, err.Error(), nil)
 		return
 	}
 
 	h.updatePoolSpace(pool)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(pool)
+	json.NewEncoder(w).Encode(redactPool(pool))
 }
 
 // CreateStoragePool creates a new storage pool
 func (h *PoolHandler) CreateStoragePool(w http.ResponseWriter, r *http.Request) {
 	var pool models.StoragePool
 	if err := json.NewDecoder(r.Body).Decode(&pool); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
 	// Validate required fields
 	if pool.Name == "" {
-		http.Error(w, "Pool name is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Pool name is required", nil)
 		return
 	}
 
-	if pool.Path == "" {
-		http.Error(w, "Pool path is required", http.StatusBadRequest)
-		return
-	}
+	switch pool.Backend {
+	case "", models.PoolBackendLocal:
+		pool.Backend = models.PoolBackendLocal
+		pool.S3 = nil
 
-	// Verify path exists and is a directory
-	info, err := os.Stat(pool.Path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			http.Error(w, "Path does not exist", http.StatusBadRequest)
+		if pool.Path == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Pool path is required", nil)
 			return
 		}
-		http.Error(w, "Cannot access path: "+err.Error(), http.StatusBadRequest)
-		return
-	}
 
-	if !info.IsDir() {
-		http.Error(w, "Path must be a directory", http.StatusBadRequest)
+		// Verify path exists and is a directory
+		info, err := os.Stat(pool.Path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Path does not exist", nil)
+				return
+			}
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot access path: "+err.Error(), nil)
+			return
+		}
+
+		if !info.IsDir() {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Path must be a directory", nil)
+			return
+		}
+	case models.PoolBackendS3:
+		if err := validateS3PoolConfig(pool.S3); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		// The path of an S3 pool is virtual and only used to resolve zone paths
+		pool.Path = s3PoolPath(pool.S3)
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid backend (must be local or s3)", nil)
 		return
 	}
 
@@ -98,7 +118,9 @@ func (h *PoolHandler) CreateStoragePool(w http.ResponseWriter, r *http.Request)
 
 	created, err := h.store.CreateStoragePool(&pool)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+		if !writeNameConflict(w, err) {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, err.Error(), nil)
+		}
 		return
 	}
 
@@ -106,7 +128,7 @@ func (h *PoolHandler) CreateStoragePool(w http.ResponseWriter, r *http.Request)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(created)
+	json.NewEncoder(w).Encode(redactPool(created))
 }
 
 // UpdateStoragePool updates an existing storage pool
@@ -115,38 +137,81 @@ func (h *PoolHandler) UpdateStoragePool(w http.ResponseWriter, r *http.Request)
 
 	var updates map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	existing, err := h.store.GetStoragePool(id)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodePoolNotFound, err.Error(), nil)
+		return
+	}
+
+	// The backend of a pool cannot change once zones may hold data on it
+	if backend, ok := updates["backend"].(string); ok && backend != existing.Backend {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Pool backend cannot be changed", nil)
 		return
 	}
 
+	if existing.IsS3() {
+		// The virtual path follows the S3 configuration
+		delete(updates, "path")
+
+		if raw, ok := updates["s3"]; ok {
+			data, _ := json.Marshal(raw)
+			cfg := &models.S3PoolConfig{}
+			if err := json.Unmarshal(data, cfg); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid S3 configuration", nil)
+				return
+			}
+			// Keep the stored secret unless a new one is provided
+			if cfg.SecretKey == "" && existing.S3 != nil {
+				cfg.SecretKey = existing.S3.SecretKey
+			}
+			if existing.S3 != nil && (cfg.Bucket != existing.S3.Bucket || cfg.Prefix != existing.S3.Prefix) {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "S3 bucket and prefix cannot be changed", nil)
+				return
+			}
+			if err := validateS3PoolConfig(cfg); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			updates["s3"] = cfg
+		}
+	} else {
+		delete(updates, "s3")
+	}
+
 	// If path is being updated, verify it exists
 	if path, ok := updates["path"].(string); ok && path != "" {
 		info, err := os.Stat(path)
 		if err != nil {
 			if os.IsNotExist(err) {
-				http.Error(w, "Path does not exist", http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Path does not exist", nil)
 				return
 			}
-			http.Error(w, "Cannot access path: "+err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot access path: "+err.Error(), nil)
 			return
 		}
 
 		if !info.IsDir() {
-			http.Error(w, "Path must be a directory", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Path must be a directory", nil)
 			return
 		}
 	}
 
 	updated, err := h.store.UpdateStoragePool(id, updates)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		if !writeNameConflict(w, err) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodePoolNotFound, err.Error(), nil)
+		}
 		return
 	}
 
 	h.updatePoolSpace(updated)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updated)
+	json.NewEncoder(w).Encode(redactPool(updated))
 }
 
 // DeleteStoragePool deletes a storage pool
@@ -155,9 +220,9 @@ func (h *PoolHandler) DeleteStoragePool(w http.ResponseWriter, r *http.Request)
 
 	if err := h.store.DeleteStoragePool(id); err != nil {
 		if err.Error() == "storage pool not found" {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodePoolNotFound, err.Error(), nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusConflict)
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, err.Error(), nil)
 		}
 		return
 	}
@@ -172,7 +237,7 @@ func (h *PoolHandler) GetPoolUsage(w http.ResponseWriter, r *http.Request) {
 
 	pool, err := h.store.GetStoragePool(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodePoolNotFound, err.Error(), nil)
 		return
 	}
 
@@ -200,7 +265,7 @@ func (h *PoolHandler) GetPoolUsage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	usage := map[string]interface{}{
-		"pool":          pool,
+		"pool":          redactPool(pool),
 		"zone_count":    len(zones),
 		"share_count":   shareCount,
 		"usage_percent": usagePercent,
@@ -213,6 +278,11 @@ func (h *PoolHandler) GetPoolUsage(w http.ResponseWriter, r *http.Request) {
 
 // updatePoolSpace updates the space information for a pool
 func (h *PoolHandler) updatePoolSpace(pool *models.StoragePool) {
+	// Object storage has no fixed capacity
+	if pool.IsS3() {
+		return
+	}
+
 	var stat syscall.Statfs_t
 	if err := syscall.Statfs(pool.Path, &stat); err == nil {
 		pool.TotalSpace = int64(stat.Blocks) * int64(stat.Bsize)
@@ -227,7 +297,7 @@ func (h *PoolHandler) GetPoolZones(w http.ResponseWriter, r *http.Request) {
 
 	// Verify pool exists
 	if _, err := h.store.GetStoragePool(id); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodePoolNotFound, err.Error(), nil)
 		return
 	}
 
@@ -275,7 +345,7 @@ func (h *ZoneHandler) GetShareZone(w http.ResponseWriter, r *http.Request) {
 
 	zone, err := h.store.GetShareZone(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		return
 	}
 
@@ -287,23 +357,28 @@ func (h *ZoneHandler) GetShareZone(w http.ResponseWriter, r *http.Request) {
 func (h *ZoneHandler) CreateShareZone(w http.ResponseWriter, r *http.Request) {
 	var zone models.ShareZone
 	if err := json.NewDecoder(r.Body).Decode(&zone); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
 	// Validate required fields
 	if zone.Name == "" {
-		http.Error(w, "Zone name is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Zone name is required", nil)
 		return
 	}
 
 	if zone.PoolID == "" {
-		http.Error(w, "Pool ID is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Pool ID is required", nil)
 		return
 	}
 
 	if zone.Path == "" {
-		http.Error(w, "Zone path is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Zone path is required", nil)
+		return
+	}
+
+	if zone.MaxUploadSize < 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Max upload size cannot be negative", nil)
 		return
 	}
 
@@ -315,16 +390,15 @@ func (h *ZoneHandler) CreateShareZone(w http.ResponseWriter, r *http.Request) {
 	// Get the pool to construct full path
 	pool, err := h.store.GetStoragePool(zone.PoolID)
 	if err != nil {
-		http.Error(w, "Storage pool not found", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Storage pool not found", nil)
 		return
 	}
 
-	// Construct and verify full path
+	// Construct full path
 	fullPath := filepath.Join(pool.Path, zone.Path)
 
-	// Create the directory if it doesn't exist
-	if err := os.MkdirAll(fullPath, 0755); err != nil {
-		http.Error(w, "Cannot create zone directory: "+err.Error(), http.StatusInternalServerError)
+	if pool.IsS3() && (zone.SMBEnabled || zone.NFSEnabled) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "SMB and NFS sharing are not available for S3 pools", nil)
 		return
 	}
 
@@ -335,16 +409,43 @@ func (h *ZoneHandler) CreateShareZone(w http.ResponseWriter, r *http.Request) {
 	if zone.AllowedGroups == nil {
 		zone.AllowedGroups = []string{}
 	}
+	if zone.Owners == nil {
+		zone.Owners = []string{}
+	}
 
-	created, err := h.store.CreateShareZone(&zone)
+	// The zone is only kept when its directory could be created
+	var created *models.ShareZone
+	status := http.StatusConflict
+	err = h.store.WithTx(func(tx storage.DataStore) error {
+		var err error
+		if created, err = tx.CreateShareZone(&zone); err != nil {
+			return err
+		}
+		status = http.StatusInternalServerError
+		return provisionZoneDir(pool, fullPath)
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+		if writeNameConflict(w, err) {
+			return
+		}
+		if status == http.StatusConflict {
+			apierror.Write(w, status, apierror.CodeConflict, err.Error(), nil)
+		} else {
+			apierror.Error(w, err.Error(), status)
+		}
 		return
 	}
+	publishAction(r, &events.Event{
+		Type:       events.TypeZoneCreated,
+		ObjectType: "zone",
+		ObjectID:   created.ID,
+		AdminOnly:  true,
+		Data:       map[string]interface{}{"name": created.Name, "pool_id": created.PoolID, "path": created.Path},
+	})
 
 	// Apply SMB configuration if enabled
-	if created.SMBEnabled && created.SMBOptions != nil {
-		if err := ApplySingleZoneSMB(created, fullPath); err != nil {
+	if created.SMBEnabled {
+		if err := ApplySingleZoneSMB(h.store, created, fullPath); err != nil {
 			// Log error but don't fail the request - zone is created
 			log.Printf("Warning: Failed to apply SMB config for zone %s: %v", created.Name, err)
 		}
@@ -352,7 +453,7 @@ func (h *ZoneHandler) CreateShareZone(w http.ResponseWriter, r *http.Request) {
 
 	// Apply NFS configuration if enabled
 	if created.NFSEnabled && created.NFSOptions != nil {
-		if err := ApplySingleZoneNFS(created, fullPath); err != nil {
+		if err := ApplySingleZoneNFS(h.store, created, fullPath); err != nil {
 			log.Printf("Warning: Failed to apply NFS config for zone %s: %v", created.Name, err)
 		}
 	}
@@ -362,19 +463,44 @@ func (h *ZoneHandler) CreateShareZone(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(created)
 }
 
+// provisionZoneDir creates the directory of a new zone if it doesn't exist
+func provisionZoneDir(pool *models.StoragePool, fullPath string) error {
+	if pool.IsS3() {
+		backend, err := poolBackend(pool)
+		if err == nil {
+			err = backend.Mkdir(backendPath(pool, fullPath))
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot create zone folder: %w", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(fullPath, 0755); err != nil {
+		return fmt.Errorf("Cannot create zone directory: %w", err)
+	}
+	return nil
+}
+
 // UpdateShareZone updates an existing share zone
 func (h *ZoneHandler) UpdateShareZone(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
 	var updates map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	if maxUploadSize, ok := updates["max_upload_size"].(float64); ok && maxUploadSize < 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Max upload size cannot be negative", nil)
 		return
 	}
 
 	updated, err := h.store.UpdateShareZone(id, updates)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		if !writeNameConflict(w, err) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
 		return
 	}
 
@@ -383,28 +509,14 @@ func (h *ZoneHandler) UpdateShareZone(w http.ResponseWriter, r *http.Request) {
 	if err == nil {
 		fullPath := filepath.Join(pool.Path, updated.Path)
 
-		// Re-apply SMB configuration
-		if updated.SMBEnabled && updated.SMBOptions != nil {
-			if err := ApplySingleZoneSMB(updated, fullPath); err != nil {
-				log.Printf("Warning: Failed to apply SMB config for zone %s: %v", updated.Name, err)
-			}
-		} else {
-			// SMB was disabled, remove the share
-			if err := RemoveZoneSMB(updated); err != nil {
-				log.Printf("Warning: Failed to remove SMB config for zone %s: %v", updated.Name, err)
-			}
+		// Regenerate the SMB shares (drops the share if SMB was disabled)
+		if err := ApplySingleZoneSMB(h.store, updated, fullPath); err != nil {
+			log.Printf("Warning: Failed to apply SMB config for zone %s: %v", updated.Name, err)
 		}
 
-		// Re-apply NFS configuration
-		if updated.NFSEnabled && updated.NFSOptions != nil {
-			if err := ApplySingleZoneNFS(updated, fullPath); err != nil {
-				log.Printf("Warning: Failed to apply NFS config for zone %s: %v", updated.Name, err)
-			}
-		} else {
-			// NFS was disabled, remove the export
-			if err := RemoveZoneNFS(updated); err != nil {
-				log.Printf("Warning: Failed to remove NFS config for zone %s: %v", updated.Name, err)
-			}
+		// Regenerate the NFS exports (drops the export if NFS was disabled)
+		if err := ApplySingleZoneNFS(h.store, updated, fullPath); err != nil {
+			log.Printf("Warning: Failed to apply NFS config for zone %s: %v", updated.Name, err)
 		}
 	}
 
@@ -419,32 +531,47 @@ func (h *ZoneHandler) DeleteShareZone(w http.ResponseWriter, r *http.Request) {
 	// Get zone before deleting to clean up SMB/NFS
 	zone, err := h.store.GetShareZone(id)
 	if err != nil {
-		http.Error(w, "share zone not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, "share zone not found", nil)
+		return
+	}
+
+	// The zone is kept for restore, so its quota record stays and only the limit is lifted
+	projectQuota, _ := h.store.GetZoneProjectQuota(id)
+
+	if err := h.store.DeleteShareZone(id); err != nil {
+		if err.Error() == "share zone not found" {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		} else {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, err.Error(), nil)
+		}
 		return
 	}
 
-	// Remove SMB configuration
+	if projectQuota != nil {
+		releaseZoneProjectQuota(h.store, zone, projectQuota)
+	}
+
+	// Remove the SMB share
 	if zone.SMBEnabled {
-		if err := RemoveZoneSMB(zone); err != nil {
+		if err := SyncSMBConfig(h.store); err != nil {
 			log.Printf("Warning: Failed to remove SMB config for zone %s: %v", zone.Name, err)
 		}
 	}
 
-	// Remove NFS configuration
+	// Remove the NFS export
 	if zone.NFSEnabled {
-		if err := RemoveZoneNFS(zone); err != nil {
+		if err := SyncNFSConfig(h.store); err != nil {
 			log.Printf("Warning: Failed to remove NFS config for zone %s: %v", zone.Name, err)
 		}
 	}
 
-	if err := h.store.DeleteShareZone(id); err != nil {
-		if err.Error() == "share zone not found" {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusConflict)
-		}
-		return
-	}
+	publishAction(r, &events.Event{
+		Type:       events.TypeZoneDeleted,
+		ObjectType: "zone",
+		ObjectID:   zone.ID,
+		AdminOnly:  true,
+		Data:       map[string]interface{}{"name": zone.Name, "pool_id": zone.PoolID, "path": zone.Path},
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Share zone deleted"})
@@ -456,13 +583,13 @@ func (h *ZoneHandler) GetZoneUsage(w http.ResponseWriter, r *http.Request) {
 
 	zone, err := h.store.GetShareZone(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		return
 	}
 
 	pool, err := h.store.GetStoragePool(zone.PoolID)
 	if err != nil {
-		http.Error(w, "Pool not found", http.StatusInternalServerError)
+		apierror.Error(w, "Pool not found", http.StatusInternalServerError)
 		return
 	}
 
@@ -473,18 +600,27 @@ func (h *ZoneHandler) GetZoneUsage(w http.ResponseWriter, r *http.Request) {
 	var fileCount int
 	var dirCount int
 
-	filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-		if info.IsDir() {
-			dirCount++
-		} else {
-			fileCount++
-			totalSize += info.Size()
+	if pool.IsS3() {
+		if backend, err := poolBackend(pool); err == nil {
+			size, files, dirs, err := backend.Usage(backendPath(pool, fullPath))
+			if err == nil {
+				totalSize, fileCount, dirCount = size, int(files), int(dirs)+1
+			}
 		}
-		return nil
-	})
+	} else {
+		filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				dirCount++
+			} else {
+				fileCount++
+				totalSize += info.Size()
+			}
+			return nil
+		})
+	}
 
 	// Get share count
 	shares := h.store.ListShares()
@@ -497,7 +633,7 @@ func (h *ZoneHandler) GetZoneUsage(w http.ResponseWriter, r *http.Request) {
 
 	usage := map[string]interface{}{
 		"zone":        zone,
-		"pool":        pool,
+		"pool":        redactPool(pool),
 		"full_path":   fullPath,
 		"total_size":  totalSize,
 		"file_count":  fileCount,
@@ -517,31 +653,47 @@ func (h *ZoneHandler) ProvisionUserDirectory(w http.ResponseWriter, r *http.Requ
 		Username string `json:"username"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
 	if req.Username == "" {
-		http.Error(w, "Username is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username is required", nil)
 		return
 	}
 
 	zone, err := h.store.GetShareZone(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		return
 	}
 
 	pool, err := h.store.GetStoragePool(zone.PoolID)
 	if err != nil {
-		http.Error(w, "Pool not found", http.StatusInternalServerError)
+		apierror.Error(w, "Pool not found", http.StatusInternalServerError)
 		return
 	}
 
 	// Create user directory
 	userPath := filepath.Join(pool.Path, zone.Path, req.Username)
+	if pool.IsS3() {
+		backend, err := poolBackend(pool)
+		if err == nil {
+			err = backend.Mkdir(backendPath(pool, userPath))
+		}
+		if err != nil {
+			apierror.Error(w, "Cannot create user directory: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "User directory created",
+			"path":    userPath,
+		})
+		return
+	}
 	if err := os.MkdirAll(userPath, 0755); err != nil {
-		http.Error(w, "Cannot create user directory: "+err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, "Cannot create user directory: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -552,9 +704,15 @@ func (h *ZoneHandler) ProvisionUserDirectory(w http.ResponseWriter, r *http.Requ
 		os.Chown(userPath, uid, gid)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	// Back the zone's per-user quota with a filesystem limit
+	response := map[string]interface{}{
 		"message": "User directory created",
 		"path":    userPath,
-	})
+	}
+	if quota := zoneFilesystemQuota(h.store, zone, pool, req.Username, true); quota != nil {
+		response["quota"] = quota
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
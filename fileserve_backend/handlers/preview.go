@@ -0,0 +1,640 @@
+package handlers
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/exif"
+	"fileserv/middleware"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxPreviewDimension     = 4096
+	defaultPreviewDimension = 1024
+	defaultPreviewQuality   = 80
+	// maxPreviewPixels rejects images whose decoded size would use too much memory
+	maxPreviewPixels = 50_000_000
+	// maxPreviewSourceSize caps the size of originals read from object storage into memory
+	maxPreviewSourceSize = 64 * 1024 * 1024
+)
+
+// previewImageExtensions are the image types that can be resized for previews
+var previewImageExtensions = map[string]bool{
+	"jpg":  true,
+	"jpeg": true,
+	"png":  true,
+	"gif":  true,
+}
+
+// errPreviewTooLarge is returned for images too large to resize
+var errPreviewTooLarge = errors.New("image is too large to preview")
+
+// ============================================================================
+// Preview Cache
+// ============================================================================
+
+// PreviewCache keeps rendered previews (resized images, transcoded video segments) on disk,
+// evicting the least recently used ones once the cache grows past its size limit
+type PreviewCache struct {
+	dir      string
+	maxBytes int64
+	mu       sync.Mutex
+	order    *list.List // Most recently used first
+	entries  map[string]*list.Element
+	size     int64
+}
+
+// previewCacheEntry is one cached preview file
+type previewCacheEntry struct {
+	key  string
+	path string
+	size int64
+}
+
+// NewPreviewCache creates a preview cache in dir, picking up previews cached by earlier runs
+func NewPreviewCache(dir string, maxBytes int64) (*PreviewCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &PreviewCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+	c.load()
+	return c, nil
+}
+
+// load rebuilds the LRU order from the files in the cache directory, using their modification
+// time as the last access time
+func (c *PreviewCache) load() {
+	type cached struct {
+		entry   *previewCacheEntry
+		modTime time.Time
+	}
+	var files []cached
+
+	filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		name := info.Name()
+		// Leftovers of interrupted writes
+		if strings.HasPrefix(name, ".tmp-") {
+			os.Remove(path)
+			return nil
+		}
+		files = append(files, cached{
+			entry:   &previewCacheEntry{key: strings.TrimSuffix(name, filepath.Ext(name)), path: path, size: info.Size()},
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		c.entries[f.entry.key] = c.order.PushBack(f.entry)
+		c.size += f.entry.size
+	}
+	c.evict()
+}
+
+// Get returns the path of a cached preview and marks it as recently used
+func (c *PreviewCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*previewCacheEntry)
+	// Keep the access order across restarts
+	now := time.Now()
+	if err := os.Chtimes(entry.path, now, now); err != nil {
+		c.remove(elem)
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return entry.path, true
+}
+
+// Put stores a rendered preview and returns its path
+func (c *PreviewCache) Put(key, ext string, data []byte) (string, error) {
+	dir := filepath.Join(c.dir, key[:2])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	path := filepath.Join(dir, key+"."+ext)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.size -= elem.Value.(*previewCacheEntry).size
+		c.order.Remove(elem)
+	}
+	entry := &previewCacheEntry{key: key, path: path, size: int64(len(data))}
+	c.entries[key] = c.order.PushFront(entry)
+	c.size += entry.size
+	c.evict()
+	return path, nil
+}
+
+// Stats returns the number of cached previews and their total size
+func (c *PreviewCache) Stats() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries), c.size
+}
+
+// PruneUnused removes previews not used since before, such as those of files that were changed
+// or deleted, and returns how many were removed and their total size
+func (c *PreviewCache) PruneUnused(before time.Time) (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed, freed := 0, int64(0)
+	// Least recently used first; the access time is kept in the modification time
+	for elem := c.order.Back(); elem != nil; {
+		entry := elem.Value.(*previewCacheEntry)
+		info, err := os.Stat(entry.path)
+		if err == nil && !info.ModTime().Before(before) {
+			break
+		}
+		prev := elem.Prev()
+		removed++
+		freed += entry.size
+		c.remove(elem)
+		elem = prev
+	}
+	return removed, freed
+}
+
+// Clear removes every cached preview
+func (c *PreviewCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+// evict removes the least recently used previews until the cache fits its limit. The most
+// recent preview is always kept so it can be served. Callers must hold mu.
+func (c *PreviewCache) evict() {
+	for c.size > c.maxBytes && c.order.Len() > 1 {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove deletes a cached preview. Callers must hold mu.
+func (c *PreviewCache) remove(elem *list.Element) {
+	entry := elem.Value.(*previewCacheEntry)
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Preview cache: failed to remove %s: %v", entry.path, err)
+	}
+	c.order.Remove(elem)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+// ============================================================================
+// Resizing
+// ============================================================================
+
+// previewSize returns the size of an image scaled down to fit within maxW x maxH (0 leaves a
+// side unconstrained). Images are never scaled up.
+func previewSize(width, height, maxW, maxH int) (int, int) {
+	scale := 1.0
+	if maxW > 0 && width > maxW {
+		scale = float64(maxW) / float64(width)
+	}
+	if maxH > 0 && height > maxH {
+		scale = min(scale, float64(maxH)/float64(height))
+	}
+	return max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))
+}
+
+// toRGBA converts an image to RGBA with its origin at 0,0
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && b.Min == (image.Point{}) {
+		return rgba
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// downscale shrinks an image to width x height by averaging the source pixels covered by each
+// destination pixel
+func downscale(src *image.RGBA, width, height int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw == width && sh == height {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// Source column range of each destination column
+	xs := make([]int, width+1)
+	for x := 0; x <= width; x++ {
+		xs[x] = x * sw / width
+	}
+
+	sums := make([]uint64, width*4)
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		clear(sums)
+		for sy := y0; sy < y1; sy++ {
+			row := src.Pix[sy*src.Stride : sy*src.Stride+sw*4]
+			for x := 0; x < width; x++ {
+				x0, x1 := xs[x], max(xs[x+1], xs[x]+1)
+				s := sums[x*4 : x*4+4]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					s[0] += uint64(p[0])
+					s[1] += uint64(p[1])
+					s[2] += uint64(p[2])
+					s[3] += uint64(p[3])
+				}
+			}
+		}
+		out := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			n := uint64((y1 - y0) * (max(xs[x+1], xs[x]+1) - xs[x]))
+			for i := 0; i < 4; i++ {
+				out[x*4+i] = uint8((sums[x*4+i] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// orient rotates and flips an image according to its EXIF orientation so it displays upright
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := 0; dy < dh; dy++ {
+		for dx := 0; dx < dw; dx++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = w-1-dx, dy
+			case 3: // Rotated 180°
+				sx, sy = w-1-dx, h-1-dy
+			case 4: // Mirrored vertically
+				sx, sy = dx, h-1-dy
+			case 5: // Transposed
+				sx, sy = dy, dx
+			case 6: // Rotated 90° clockwise
+				sx, sy = dy, h-1-dx
+			case 7: // Transversed
+				sx, sy = w-1-dy, h-1-dx
+			case 8: // Rotated 90° counter-clockwise
+				sx, sy = w-1-dy, dx
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[sy*src.Stride+sx*4:sy*src.Stride+sx*4+4])
+		}
+	}
+	return dst
+}
+
+// renderPreview decodes an image, scales it to fit within maxW x maxH and encodes it as JPEG, or
+// as PNG for PNG and GIF images with transparency. It returns the encoded image and its extension.
+func renderPreview(src io.ReaderAt, size int64, maxW, maxH, quality int) ([]byte, string, error) {
+	cfg, format, err := image.DecodeConfig(io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return nil, "", fmt.Errorf("unsupported image: %v", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPreviewPixels {
+		return nil, "", errPreviewTooLarge
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		if data, err := exif.Decode(src); err == nil && data.Orientation > 0 {
+			orientation = data.Orientation
+		}
+	}
+
+	img, _, err := image.Decode(io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %v", err)
+	}
+	rgba := toRGBA(img)
+
+	// Scale first so the rotation works on the smaller image
+	width, height := rgba.Rect.Dx(), rgba.Rect.Dy()
+	if orientation >= 5 {
+		// Stored sideways: fit the displayed size, then swap back
+		dw, dh := previewSize(height, width, maxW, maxH)
+		width, height = dh, dw
+	} else {
+		width, height = previewSize(width, height, maxW, maxH)
+	}
+	result := orient(downscale(rgba, width, height), orientation)
+
+	var buf bytes.Buffer
+	if format != "jpeg" && !result.Opaque() {
+		if err := png.Encode(&buf, result); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "png", nil
+	}
+	if err := jpeg.Encode(&buf, result, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "jpg", nil
+}
+
+// ============================================================================
+// HTTP Handlers
+// ============================================================================
+
+// PreviewHandler serves resized images for previews and thumbnails
+type PreviewHandler struct {
+	store       storage.DataStore
+	files       *ZoneFileHandler
+	cache       *PreviewCache
+	renders     chan struct{} // Limits the number of images decoded at once
+	conversions chan struct{} // Limits the number of documents converted at once
+}
+
+// NewPreviewHandler creates a new handler caching up to maxBytes of previews in cacheDir
+func NewPreviewHandler(store storage.DataStore, cacheDir string, maxBytes int64) (*PreviewHandler, error) {
+	cache, err := NewPreviewCache(cacheDir, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &PreviewHandler{
+		store:       store,
+		files:       NewZoneFileHandler(store),
+		cache:       cache,
+		renders:     make(chan struct{}, min(runtime.NumCPU(), 4)),
+		conversions: make(chan struct{}, 2),
+	}, nil
+}
+
+// parsePreviewParam reads an optional integer query parameter within [1, limit]
+func parsePreviewParam(r *http.Request, name string, limit int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > limit {
+		return 0, fmt.Errorf("invalid %s (must be between 1 and %d)", name, limit)
+	}
+	return n, nil
+}
+
+// parsePreviewOptions reads the width, height and quality query parameters of a preview request
+// and fills in the defaults
+func parsePreviewOptions(r *http.Request) (maxW, maxH, quality int, err error) {
+	if maxW, err = parsePreviewParam(r, "width", maxPreviewDimension); err != nil {
+		return 0, 0, 0, err
+	}
+	if maxH, err = parsePreviewParam(r, "height", maxPreviewDimension); err != nil {
+		return 0, 0, 0, err
+	}
+	if quality, err = parsePreviewParam(r, "quality", 100); err != nil {
+		return 0, 0, 0, err
+	}
+	if maxW == 0 && maxH == 0 {
+		maxW, maxH = defaultPreviewDimension, defaultPreviewDimension
+	}
+	if quality == 0 {
+		quality = defaultPreviewQuality
+	}
+	return maxW, maxH, quality, nil
+}
+
+// GetZonePreview returns an image scaled down to fit within the width and height query
+// parameters (1024x1024 when neither is given), re-encoded with the given JPEG quality (default 80).
+// Office documents are rendered to PDF instead. Rendered previews are cached on disk until the
+// original changes.
+func (h *PreviewHandler) GetZonePreview(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	maxW, maxH, quality, err := parsePreviewOptions(r)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	filePath := chi.URLParam(r, "*")
+	fullPath, _, pool, err := h.files.resolveZonePathWithPool(chi.URLParam(r, "zoneId"), filePath, userFromContext(userCtx))
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fullPath), "."))
+	if officePreviewExtensions[ext] {
+		h.serveOfficePreview(w, r, fullPath, pool)
+		return
+	}
+	if !previewImageExtensions[ext] {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a supported image", nil)
+		return
+	}
+
+	if !pool.IsS3() {
+		h.serveLocalPreview(w, r, fullPath, maxW, maxH, quality)
+		return
+	}
+
+	// Object storage originals are read into memory
+	b, ok := zoneBackend(w, pool)
+	if !ok {
+		return
+	}
+	p := backendPath(pool, fullPath)
+	info, err := b.Stat(p)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	if info.IsDir {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a supported image", nil)
+		return
+	}
+	if info.Size > maxPreviewSourceSize {
+		apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, errPreviewTooLarge.Error(), nil)
+		return
+	}
+	key := previewCacheKey(fullPath, info.Size, info.ModTime, maxW, maxH, quality)
+	if path, ok := h.cache.Get(key); ok {
+		servePreview(w, r, path)
+		return
+	}
+
+	rc, err := b.Open(p, 0, -1)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, maxPreviewSourceSize))
+	rc.Close()
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	h.renderAndServe(w, r, fullPath, key, bytes.NewReader(data), int64(len(data)), maxW, maxH, quality)
+}
+
+// serveLocalPreview serves the preview of an image on local disk, rendering it on a cache miss
+func (h *PreviewHandler) serveLocalPreview(w http.ResponseWriter, r *http.Request, fullPath string, maxW, maxH, quality int) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a supported image", nil)
+		return
+	}
+
+	key := previewCacheKey(fullPath, info.Size(), info.ModTime(), maxW, maxH, quality)
+	if path, ok := h.cache.Get(key); ok {
+		servePreview(w, r, path)
+		return
+	}
+	h.renderAndServe(w, r, fullPath, key, f, info.Size(), maxW, maxH, quality)
+}
+
+// renderAndServe renders a preview, stores it in the cache under key and serves it
+func (h *PreviewHandler) renderAndServe(w http.ResponseWriter, r *http.Request, fullPath, key string, src io.ReaderAt, size int64, maxW, maxH, quality int) {
+	h.renders <- struct{}{}
+	data, ext, err := renderPreview(src, size, maxW, maxH, quality)
+	<-h.renders
+	if err != nil {
+		if errors.Is(err, errPreviewTooLarge) {
+			apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, err.Error(), nil)
+		} else {
+			apierror.Write(w, http.StatusUnprocessableEntity, apierror.CodeUnprocessableEntity, err.Error(), nil)
+		}
+		return
+	}
+
+	path, err := h.cache.Put(key, ext, data)
+	if err != nil {
+		log.Printf("Preview cache: failed to store preview of %s: %v", fullPath, err)
+		w.Header().Set("ETag", `"`+key+`"`)
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		http.ServeContent(w, r, "preview."+ext, time.Now(), bytes.NewReader(data))
+		return
+	}
+	servePreview(w, r, path)
+}
+
+// previewCacheKey identifies a preview of one version of a file at one size and quality
+func previewCacheKey(fullPath string, size int64, modTime time.Time, maxW, maxH, quality int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d\x00%dx%d\x00q%d", fullPath, size, modTime.UnixNano(), maxW, maxH, quality)))
+	return hex.EncodeToString(sum[:])
+}
+
+// servePreview sends a cached preview, answering conditional requests from its ETag
+func servePreview(w http.ResponseWriter, r *http.Request, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		apierror.Error(w, "Preview not available", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		apierror.Error(w, "Preview not available", http.StatusInternalServerError)
+		return
+	}
+
+	name := filepath.Base(path)
+	w.Header().Set("ETag", `"`+strings.TrimSuffix(name, filepath.Ext(name))+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// GetCacheStats returns the number and total size of cached previews
+func (h *PreviewHandler) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	count, size := h.cache.Stats()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"previews":  count,
+		"size":      size,
+		"max_bytes": h.cache.maxBytes,
+	})
+}
+
+// ClearCache removes all cached previews
+func (h *PreviewHandler) ClearCache(w http.ResponseWriter, r *http.Request) {
+	h.cache.Clear()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Preview cache cleared",
+	})
+}
@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// processMaxOpenFiles caps the open files listed in a process detail
+	processMaxOpenFiles = 1000
+	// processMaxThreads caps the threads listed in a process detail
+	processMaxThreads = 1000
+	// clockTicks is USER_HZ, the unit of the times in /proc/<pid>/stat
+	clockTicks = 100
+	// cgroupRoot is where the cgroup v2 hierarchy is mounted
+	cgroupRoot = "/sys/fs/cgroup"
+)
+
+// processEnvironment lists the environment variables shown in a process detail. Anything else
+// may hold credentials, so it is left out.
+var processEnvironment = map[string]bool{
+	"PATH": true, "HOME": true, "USER": true, "LOGNAME": true, "SHELL": true,
+	"LANG": true, "LC_ALL": true, "TZ": true, "PWD": true, "TERM": true,
+	"INVOCATION_ID": true, "JOURNAL_STREAM": true, "SYSTEMD_EXEC_PID": true,
+	"RUNTIME_DIRECTORY": true, "STATE_DIRECTORY": true, "LOGS_DIRECTORY": true,
+}
+
+// GetProcessTree returns all processes arranged by parent
+func GetProcessTree() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		output, err := execCommand("ps", "-eo", "pid=,ppid=,user:32=,pcpu=,pmem=,vsz=,rss=,stat=,start_time=,ni=,nlwp=,args=")
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		nodes := make(map[int]*models.ProcessNode)
+		var order []*models.ProcessNode
+		scanner := bufio.NewScanner(strings.NewReader(output))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 12 {
+				continue
+			}
+
+			pid, _ := strconv.Atoi(fields[0])
+			ppid, _ := strconv.Atoi(fields[1])
+			cpu, _ := strconv.ParseFloat(fields[3], 64)
+			memory, _ := strconv.ParseFloat(fields[4], 64)
+			vsz, _ := strconv.ParseUint(fields[5], 10, 64)
+			rss, _ := strconv.ParseUint(fields[6], 10, 64)
+			nice, _ := strconv.Atoi(fields[9]) // "-" for realtime processes
+			threads, _ := strconv.Atoi(fields[10])
+
+			node := &models.ProcessNode{
+				Process: models.Process{
+					PID:     pid,
+					User:    fields[2],
+					CPU:     cpu,
+					Memory:  memory,
+					VSZ:     vsz * 1024, // Convert KB to bytes
+					RSS:     rss * 1024,
+					State:   fields[7],
+					Started: fields[8],
+					Command: strings.Join(fields[11:], " "),
+				},
+				PPID:    ppid,
+				Nice:    nice,
+				Threads: threads,
+			}
+			nodes[pid] = node
+			order = append(order, node)
+		}
+
+		roots := []*models.ProcessNode{}
+		for _, node := range order {
+			if parent, ok := nodes[node.PPID]; ok && node.PPID != node.PID {
+				parent.Children = append(parent.Children, node)
+			} else {
+				roots = append(roots, node)
+			}
+		}
+		for _, node := range order {
+			sort.Slice(node.Children, func(i, j int) bool { return node.Children[i].PID < node.Children[j].PID })
+		}
+		sort.Slice(roots, func(i, j int) bool { return roots[i].PID < roots[j].PID })
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(roots)
+	}
+}
+
+// GetProcessDetail returns the open files, threads, cgroup and environment of a process
+func GetProcessDetail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, ok := processPID(w, r)
+		if !ok {
+			return
+		}
+
+		detail, err := readProcessDetail(pid)
+		if err != nil {
+			processError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(detail)
+	}
+}
+
+// ReniceProcess sets the nice value of all threads of a process
+func ReniceProcess() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, ok := processPID(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Nice *int `json:"nice"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+		if req.Nice == nil || *req.Nice < -20 || *req.Nice > 19 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "nice must be between -20 and 19", nil)
+			return
+		}
+
+		// The priority is per thread on Linux, so every thread is changed, as renice -p does not
+		tasks, err := filepath.Glob(fmt.Sprintf("/proc/%d/task/[0-9]*", pid))
+		if err != nil || len(tasks) == 0 {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeProcessNotFound, "Process not found", nil)
+			return
+		}
+		for _, task := range tasks {
+			tid, err := strconv.Atoi(filepath.Base(task))
+			if err != nil {
+				continue
+			}
+			if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, *req.Nice); err != nil && err != syscall.ESRCH {
+				apierror.Error(w, fmt.Sprintf("Failed to renice process: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		detail, err := readProcessDetail(pid)
+		if err != nil {
+			processError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(detail)
+	}
+}
+
+// LimitProcess sets the CPU and IO limits of the systemd unit a process runs in. The limits
+// apply to every process of the unit and last until it is restarted or the system reboots.
+func LimitProcess() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, ok := processPID(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			CPUPercent *float64 `json:"cpu_percent"` // 0 removes the limit
+			Device     string   `json:"device"`      // Block device of the IO limits, such as /dev/sda
+			ReadBPS    *uint64  `json:"read_bps"`    // 0 removes the limit
+			WriteBPS   *uint64  `json:"write_bps"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		var properties []string
+		if req.CPUPercent != nil {
+			maxPercent := float64(runtime.NumCPU() * 100)
+			if *req.CPUPercent < 0 || *req.CPUPercent > maxPercent {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("cpu_percent must be between 0 and %g", maxPercent), nil)
+				return
+			}
+			if *req.CPUPercent == 0 {
+				properties = append(properties, "CPUQuota=")
+			} else {
+				properties = append(properties, "CPUQuota="+strconv.FormatFloat(*req.CPUPercent, 'f', -1, 64)+"%")
+			}
+		}
+		if req.ReadBPS != nil || req.WriteBPS != nil {
+			if err := validateBlockDevice(req.Device); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			if req.ReadBPS != nil {
+				properties = append(properties, "IOReadBandwidthMax="+req.Device+" "+bandwidthLimit(*req.ReadBPS))
+			}
+			if req.WriteBPS != nil {
+				properties = append(properties, "IOWriteBandwidthMax="+req.Device+" "+bandwidthLimit(*req.WriteBPS))
+			}
+		}
+		if len(properties) == 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "No limits given", nil)
+			return
+		}
+
+		detail, err := readProcessDetail(pid)
+		if err != nil {
+			processError(w, err)
+			return
+		}
+		if detail.Unit == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Process does not run in a systemd service or scope", nil)
+			return
+		}
+
+		args := append([]string{"set-property", "--runtime", detail.Unit}, properties...)
+		if output, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to limit %s: %s", detail.Unit, strings.TrimSpace(string(output))), http.StatusInternalServerError)
+			return
+		}
+
+		detail.Limits = readCgroupLimits(detail.Cgroup)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(detail)
+	}
+}
+
+// processPID reads the pid URL parameter, writing an error if it is invalid
+func processPID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	pid, err := strconv.Atoi(chi.URLParam(r, "pid"))
+	if err != nil || pid <= 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid PID", nil)
+		return 0, false
+	}
+	return pid, true
+}
+
+// processError writes the error of reading a process
+func processError(w http.ResponseWriter, err error) {
+	if errors.Is(err, os.ErrNotExist) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeProcessNotFound, "Process not found", nil)
+		return
+	}
+	apierror.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// validateBlockDevice checks that device is a block device under /dev
+func validateBlockDevice(device string) error {
+	if device == "" {
+		return fmt.Errorf("device is required for IO limits")
+	}
+	if !strings.HasPrefix(device, "/dev/") || filepath.Clean(device) != device || strings.ContainsAny(device, " \t\n") {
+		return fmt.Errorf("invalid device: %s", device)
+	}
+	info, err := os.Stat(device)
+	if err != nil || info.Mode()&os.ModeDevice == 0 || info.Mode()&os.ModeCharDevice != 0 {
+		return fmt.Errorf("not a block device: %s", device)
+	}
+	return nil
+}
+
+// bandwidthLimit formats a bandwidth for systemd, where 0 is no limit
+func bandwidthLimit(bps uint64) string {
+	if bps == 0 {
+		return "infinity"
+	}
+	return strconv.FormatUint(bps, 10)
+}
+
+// readProcessDetail reads the detail of a process from /proc. It returns an error wrapping
+// os.ErrNotExist if the process does not exist.
+func readProcessDetail(pid int) (*models.ProcessDetail, error) {
+	dir := fmt.Sprintf("/proc/%d", pid)
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &models.ProcessDetail{
+		PID:         pid,
+		Environment: map[string]string{},
+		Threads:     []models.ProcessThread{},
+		OpenFiles:   []models.ProcessFile{},
+		Children:    []int{},
+	}
+
+	// pid (comm) state ppid ...; comm may contain spaces and parentheses
+	name, fields, ok := parseProcStat(string(stat))
+	if !ok || len(fields) < 22 {
+		return nil, fmt.Errorf("unexpected format of %s/stat", dir)
+	}
+	detail.Name = name
+	detail.State = fields[0]
+	detail.PPID, _ = strconv.Atoi(fields[1])
+	detail.Nice, _ = strconv.Atoi(fields[16])
+	detail.VSZ, _ = strconv.ParseUint(fields[20], 10, 64)
+	if pages, err := strconv.ParseUint(fields[21], 10, 64); err == nil {
+		detail.RSS = pages * uint64(os.Getpagesize())
+	}
+	if ticks, err := strconv.ParseInt(fields[19], 10, 64); err == nil {
+		if boot := bootTime(); !boot.IsZero() {
+			started := boot.Add(time.Duration(ticks) * time.Second / clockTicks)
+			detail.StartedAt = &started
+		}
+	}
+
+	if status, err := os.ReadFile(filepath.Join(dir, "status")); err == nil {
+		for _, line := range strings.Split(string(status), "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "Uid:" {
+				detail.User = fields[1]
+				if u, err := user.LookupId(fields[1]); err == nil {
+					detail.User = u.Username
+				}
+				break
+			}
+		}
+	}
+
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		detail.Args = strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00")
+		detail.Command = strings.Join(detail.Args, " ")
+	} else {
+		// Kernel threads have no command line
+		detail.Args = []string{}
+		detail.Command = "[" + name + "]"
+	}
+
+	detail.Exe, _ = os.Readlink(filepath.Join(dir, "exe"))
+	detail.Cwd, _ = os.Readlink(filepath.Join(dir, "cwd"))
+
+	if environ, err := os.ReadFile(filepath.Join(dir, "environ")); err == nil {
+		for _, variable := range strings.Split(string(environ), "\x00") {
+			if key, value, ok := strings.Cut(variable, "="); ok && processEnvironment[key] {
+				detail.Environment[key] = value
+			}
+		}
+	}
+
+	if cgroup, err := os.ReadFile(filepath.Join(dir, "cgroup")); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(cgroup)), "\n") {
+			// The cgroup v2 hierarchy is 0::/path
+			if path, ok := strings.CutPrefix(line, "0::"); ok {
+				detail.Cgroup = path
+				if unit := filepath.Base(path); strings.HasSuffix(unit, ".service") || strings.HasSuffix(unit, ".scope") {
+					detail.Unit = unit
+				}
+			}
+		}
+	}
+	detail.Limits = readCgroupLimits(detail.Cgroup)
+
+	tasks, _ := filepath.Glob(filepath.Join(dir, "task", "[0-9]*"))
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(filepath.Base(task))
+		if err != nil {
+			continue
+		}
+		if children, err := os.ReadFile(filepath.Join(task, "children")); err == nil {
+			for _, child := range strings.Fields(string(children)) {
+				if childPID, err := strconv.Atoi(child); err == nil {
+					detail.Children = append(detail.Children, childPID)
+				}
+			}
+		}
+		if len(detail.Threads) >= processMaxThreads {
+			continue
+		}
+		if stat, err := os.ReadFile(filepath.Join(task, "stat")); err == nil {
+			if name, fields, ok := parseProcStat(string(stat)); ok && len(fields) > 0 {
+				detail.Threads = append(detail.Threads, models.ProcessThread{TID: tid, Name: name, State: fields[0]})
+			}
+		}
+	}
+	sort.Slice(detail.Threads, func(i, j int) bool { return detail.Threads[i].TID < detail.Threads[j].TID })
+	sort.Ints(detail.Children)
+
+	if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		detail.OpenFileCount = len(fds)
+		for _, fd := range fds {
+			if len(detail.OpenFiles) >= processMaxOpenFiles {
+				break
+			}
+			num, err := strconv.Atoi(fd.Name())
+			if err != nil {
+				continue
+			}
+			target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil {
+				continue
+			}
+			detail.OpenFiles = append(detail.OpenFiles, models.ProcessFile{FD: num, Type: fileDescriptorType(target), Target: target})
+		}
+		sort.Slice(detail.OpenFiles, func(i, j int) bool { return detail.OpenFiles[i].FD < detail.OpenFiles[j].FD })
+	}
+
+	return detail, nil
+}
+
+// parseProcStat splits a /proc/<pid>/stat line into the command name and the fields after it,
+// starting with the state
+func parseProcStat(stat string) (string, []string, bool) {
+	start := strings.IndexByte(stat, '(')
+	end := strings.LastIndexByte(stat, ')')
+	if start < 0 || end < start {
+		return "", nil, false
+	}
+	return stat[start+1 : end], strings.Fields(stat[end+1:]), true
+}
+
+// fileDescriptorType classifies the link target of a /proc/<pid>/fd entry
+func fileDescriptorType(target string) string {
+	switch {
+	case strings.HasPrefix(target, "socket:"):
+		return "socket"
+	case strings.HasPrefix(target, "pipe:"):
+		return "pipe"
+	case strings.HasPrefix(target, "anon_inode:"):
+		return "anon"
+	case strings.HasPrefix(target, "/dev/"):
+		return "device"
+	}
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		return "directory"
+	}
+	return "file"
+}
+
+// bootTime returns when the system booted, from /proc/stat
+func bootTime() time.Time {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			if seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+				return time.Unix(seconds, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// readCgroupLimits reads the CPU and IO limits of a cgroup v2 path
+func readCgroupLimits(cgroup string) models.CgroupLimits {
+	limits := models.CgroupLimits{IO: []models.CgroupIOLimit{}}
+	if cgroup == "" {
+		return limits
+	}
+	dir := filepath.Join(cgroupRoot, cgroup)
+
+	// cpu.max is "<quota> <period>", or "max <period>" without a limit
+	if data, err := os.ReadFile(filepath.Join(dir, "cpu.max")); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) == 2 {
+			quota, err1 := strconv.ParseFloat(fields[0], 64)
+			period, err2 := strconv.ParseFloat(fields[1], 64)
+			if err1 == nil && err2 == nil && period > 0 {
+				limits.CPUPercent = quota / period * 100
+			}
+		}
+	}
+
+	// io.max has a line per device: "8:0 rbps=1048576 wbps=max riops=max wiops=max"
+	if data, err := os.ReadFile(filepath.Join(dir, "io.max")); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			limit := models.CgroupIOLimit{Device: fields[0]}
+			if link, err := os.Readlink(filepath.Join("/sys/dev/block", fields[0])); err == nil {
+				limit.Device = "/dev/" + filepath.Base(link)
+			}
+			for _, field := range fields[1:] {
+				key, value, _ := strings.Cut(field, "=")
+				bps, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					continue // max
+				}
+				switch key {
+				case "rbps":
+					limit.ReadBPS = bps
+				case "wbps":
+					limit.WriteBPS = bps
+				}
+			}
+			if limit.ReadBPS > 0 || limit.WriteBPS > 0 {
+				limits.IO = append(limits.IO, limit)
+			}
+		}
+	}
+
+	return limits
+}
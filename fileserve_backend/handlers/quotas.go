@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"fileserv/internal/apierror"
 	"fileserv/models"
 )
 
@@ -26,7 +27,7 @@ func GetQuotas() http.HandlerFunc {
 
 		quotas, err := getQuotas(quotaType, filesystem)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -186,7 +187,7 @@ func GetUserQuota() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		username := r.URL.Query().Get("username")
 		if username == "" {
-			http.Error(w, "Username required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username required", nil)
 			return
 		}
 
@@ -209,7 +210,7 @@ func GetGroupQuota() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		groupname := r.URL.Query().Get("groupname")
 		if groupname == "" {
-			http.Error(w, "Group name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Group name required", nil)
 			return
 		}
 
@@ -305,12 +306,12 @@ func SetQuota() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.QuotaConfig
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Target == "" || req.Filesystem == "" {
-			http.Error(w, "Target and filesystem are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Target and filesystem are required", nil)
 			return
 		}
 
@@ -342,7 +343,7 @@ func SetQuota() http.HandlerFunc {
 		cmd := exec.Command("setquota", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to set quota: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to set quota: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -359,7 +360,7 @@ func RemoveQuota() http.HandlerFunc {
 		filesystem := r.URL.Query().Get("filesystem")
 
 		if target == "" || filesystem == "" {
-			http.Error(w, "Target and filesystem are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Target and filesystem are required", nil)
 			return
 		}
 
@@ -377,7 +378,7 @@ func RemoveQuota() http.HandlerFunc {
 		cmd := exec.Command("setquota", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to remove quota: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to remove quota: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -396,12 +397,12 @@ func EnableQuotas() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Filesystem == "" {
-			http.Error(w, "Filesystem is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Filesystem is required", nil)
 			return
 		}
 
@@ -428,7 +429,7 @@ func EnableQuotas() http.HandlerFunc {
 		cmd = exec.Command("quotaon", args...)
 		output, err = cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to enable quotas: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to enable quotas: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -442,14 +443,14 @@ func DisableQuotas() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		filesystem := r.URL.Query().Get("filesystem")
 		if filesystem == "" {
-			http.Error(w, "Filesystem is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Filesystem is required", nil)
 			return
 		}
 
 		cmd := exec.Command("quotaoff", "-ug", filesystem)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to disable quotas: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to disable quotas: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -473,7 +474,7 @@ func GetQuotaStatus() http.HandlerFunc {
 		// Get all mounted filesystems that could support quotas
 		mounts, err := getMountPoints()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -552,7 +553,7 @@ func GetUserStorageUsage() http.HandlerFunc {
 		// Get system users
 		output, err := execCommand("getent", "passwd")
 		if err != nil {
-			http.Error(w, "Failed to get users", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to get users", http.StatusInternalServerError)
 			return
 		}
 
@@ -619,20 +620,20 @@ func GetSpecificUserStorage() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		username := r.URL.Query().Get("username")
 		if username == "" {
-			http.Error(w, "Username required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username required", nil)
 			return
 		}
 
 		// Validate user exists
 		output, err := execCommand("getent", "passwd", username)
 		if err != nil || strings.TrimSpace(output) == "" {
-			http.Error(w, "User not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", nil)
 			return
 		}
 
 		fields := strings.Split(strings.TrimSpace(output), ":")
 		if len(fields) < 7 {
-			http.Error(w, "Invalid user data", http.StatusInternalServerError)
+			apierror.Error(w, "Invalid user data", http.StatusInternalServerError)
 			return
 		}
 
@@ -676,55 +677,6 @@ func GetSpecificUserStorage() http.HandlerFunc {
 	}
 }
 
-// ScanFilesystemUsage performs a detailed filesystem scan
-func ScanFilesystemUsage() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Query().Get("path")
-		if path == "" {
-			path = "/"
-		}
-
-		depth := r.URL.Query().Get("depth")
-		if depth == "" {
-			depth = "2"
-		}
-
-		type DirUsage struct {
-			Path      string `json:"path"`
-			Size      uint64 `json:"size"`
-			SizeHuman string `json:"size_human"`
-		}
-
-		// Use du to get directory sizes
-		output, err := execCommand("du", "-b", "--max-depth="+depth, path)
-		if err != nil {
-			http.Error(w, "Failed to scan filesystem", http.StatusInternalServerError)
-			return
-		}
-
-		var dirs []DirUsage
-		scanner := bufio.NewScanner(strings.NewReader(output))
-		for scanner.Scan() {
-			fields := strings.Fields(scanner.Text())
-			if len(fields) < 2 {
-				continue
-			}
-
-			size, _ := strconv.ParseUint(fields[0], 10, 64)
-			dirPath := strings.Join(fields[1:], " ")
-
-			dirs = append(dirs, DirUsage{
-				Path:      dirPath,
-				Size:      size,
-				SizeHuman: formatBytes(size),
-			})
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(dirs)
-	}
-}
-
 // FindLargeFiles finds the largest files in a filesystem
 func FindLargeFiles() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -806,7 +758,7 @@ func CheckFilesystemHealth() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		device := r.URL.Query().Get("device")
 		if device == "" {
-			http.Error(w, "Device required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Device required", nil)
 			return
 		}
 
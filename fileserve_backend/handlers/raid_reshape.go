@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+)
+
+// mdstatProgressRegex matches the progress line of an array in /proc/mdstat:
+// [==>......]  reshape = 12.5% (131072/1047552) finish=2.3min speed=6553K/sec
+var mdstatProgressRegex = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*([0-9.]+)%.*finish=(\S+)\s+speed=(\S+)`)
+
+// raidLevelChanges lists the level changes offered, from the current level to the new one.
+// mdadm supports more, but these keep the array's data redundant throughout.
+var raidLevelChanges = map[string][]string{
+	"raid1": {"raid5"}, // Two-device mirror only
+	"raid5": {"raid1", "raid6"},
+	"raid6": {"raid5"},
+}
+
+// raidGrowLevels lists the levels whose device count can be increased
+var raidGrowLevels = map[string]bool{"raid1": true, "raid4": true, "raid5": true, "raid6": true, "raid10": true}
+
+// mdstatProgress is a resync, recovery or reshape in progress
+type mdstatProgress struct {
+	Action  string
+	Percent float64
+	Finish  string
+	Speed   string
+}
+
+// RAIDReshapeStatus reports the background operation running on an array
+type RAIDReshapeStatus struct {
+	Array       string  `json:"array"`
+	Level       string  `json:"level"`
+	RaidDevices int     `json:"raid_devices"`
+	Action      string  `json:"action"` // idle, reshape, resync, recover, check, repair, frozen
+	InProgress  bool    `json:"in_progress"`
+	Percent     float64 `json:"percent,omitempty"`
+	Finish      string  `json:"finish,omitempty"` // Estimated time left, e.g. 12.3min
+	Speed       string  `json:"speed,omitempty"`
+}
+
+// parseMDStatProgress parses a progress line of /proc/mdstat
+func parseMDStatProgress(line string) (mdstatProgress, bool) {
+	match := mdstatProgressRegex.FindStringSubmatch(line)
+	if match == nil {
+		return mdstatProgress{}, false
+	}
+	percent, _ := strconv.ParseFloat(match[2], 64)
+	return mdstatProgress{Action: match[1], Percent: percent, Finish: match[3], Speed: match[4]}, true
+}
+
+// raidArrayPath validates an array name ("md0" or "/dev/md0") and returns its name and path
+func raidArrayPath(array string) (string, string, error) {
+	name := strings.TrimPrefix(array, "/dev/")
+	if !raidArrayNameRegex.MatchString(name) {
+		return "", "", fmt.Errorf("invalid array name")
+	}
+	return name, "/dev/" + name, nil
+}
+
+// raidSyncAction returns the array's current background action from sysfs, or "" when unknown
+func raidSyncAction(name string) string {
+	action, _ := readSysfsValue(filepath.Join("/sys/block", name, "md", "sync_action"))
+	return action
+}
+
+// raidDetail returns the level and member count of an array from mdadm --detail
+func raidDetail(path string) (string, int, error) {
+	output, err := exec.Command("mdadm", "--detail", path).CombinedOutput()
+	if err != nil {
+		return "", 0, fmt.Errorf("RAID array %s not found: %s", path, commandError(output, err))
+	}
+	var level string
+	var raidDevices int
+	if match := regexp.MustCompile(`Raid Level : (\S+)`).FindStringSubmatch(string(output)); len(match) > 1 {
+		level = match[1]
+	}
+	if match := regexp.MustCompile(`Raid Devices : (\d+)`).FindStringSubmatch(string(output)); len(match) > 1 {
+		raidDevices, _ = strconv.Atoi(match[1])
+	}
+	if level == "" || raidDevices == 0 {
+		return "", 0, fmt.Errorf("failed to read RAID details for %s", path)
+	}
+	return level, raidDevices, nil
+}
+
+// raidSpareCount returns the number of spares an array currently holds
+func raidSpareCount(name string) int {
+	raids, _ := getRAIDArrays()
+	for _, raid := range raids {
+		if raid.Name == name {
+			spares := 0
+			for _, member := range raid.Members {
+				if member.Role == "spare" {
+					spares++
+				}
+			}
+			return spares
+		}
+	}
+	return 0
+}
+
+// checkRAIDIdle fails when the array is already running a resync, recovery or reshape
+func checkRAIDIdle(name string) error {
+	if action := raidSyncAction(name); action != "" && action != "idle" {
+		return fmt.Errorf("array %s is busy (%s); wait for it to finish", name, action)
+	}
+	return nil
+}
+
+// addRAIDSpares validates unused devices and adds them to an array as spares
+func addRAIDSpares(path string, devices []string) ([]string, error) {
+	var added []string
+	for _, device := range devices {
+		if !strings.HasPrefix(device, "/dev/") {
+			device = "/dev/" + device
+		}
+		if err := validateDevicePath(device); err != nil {
+			return nil, err
+		}
+		if err := checkZFSDeviceAvailable(device); err != nil {
+			return nil, err
+		}
+		added = append(added, device)
+	}
+	if len(added) == 0 {
+		return added, nil
+	}
+
+	args := append([]string{"--add", path}, added...)
+	if output, err := exec.Command("mdadm", args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to add devices: %s", commandError(output, err))
+	}
+	return added, nil
+}
+
+// validateRAIDBackupFile checks the optional critical-section backup file path used by
+// reshapes that cannot be done in place
+func validateRAIDBackupFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) || strings.Contains(path, "..") || strings.HasPrefix(path, "/dev/") {
+		return fmt.Errorf("backup file must be an absolute path to a regular file outside the array")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup file %s already exists", path)
+	}
+	return nil
+}
+
+// GrowRAIDArray adds devices to an array and reshapes it to use them as active members
+func GrowRAIDArray() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Array       string   `json:"array"`
+			Devices     []string `json:"devices"`      // New devices, added as spares before the reshape
+			RaidDevices int      `json:"raid_devices"` // New member count; default current + len(devices)
+			BackupFile  string   `json:"backup_file"`  // Optional, for reshapes that need one
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		name, path, err := raidArrayPath(req.Array)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateRAIDBackupFile(req.BackupFile); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		level, current, err := raidDetail(path)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeRAIDArrayNotFound, err.Error(), nil)
+			return
+		}
+		if !raidGrowLevels[level] {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Growing a %s array is not supported", level), nil)
+			return
+		}
+		if err := checkRAIDIdle(name); err != nil {
+			apierror.Write(w, http.StatusConflict, apierror.CodeBusy, err.Error(), nil)
+			return
+		}
+
+		target := req.RaidDevices
+		if target == 0 {
+			target = current + len(req.Devices)
+		}
+		if target <= current {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("raid_devices must be greater than the current %d", current), nil)
+			return
+		}
+		if spares := raidSpareCount(name) + len(req.Devices); target-current > spares {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Growing to %d devices needs %d spare devices, only %d available", target, target-current, spares), nil)
+			return
+		}
+
+		added, err := addRAIDSpares(path, req.Devices)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		args := []string{"--grow", path, "--raid-devices=" + strconv.Itoa(target)}
+		if req.BackupFile != "" {
+			args = append(args, "--backup-file="+req.BackupFile)
+		}
+		output, err := exec.Command("mdadm", args...).CombinedOutput()
+		if err != nil {
+			message := fmt.Sprintf("Failed to grow RAID array: %s - %s", err.Error(), string(output))
+			if len(added) > 0 {
+				message += fmt.Sprintf(" (%s remain in the array as spares)", strings.Join(added, ", "))
+			}
+			apierror.Error(w, message, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":      fmt.Sprintf("Reshaping %s to %d devices. Grow the filesystem once the reshape completes.", path, target),
+			"added":        added,
+			"raid_devices": target,
+		})
+	}
+}
+
+// ChangeRAIDLevel converts an array to another RAID level. raid5 to raid6 uses a spare (or the
+// given device) for the second parity; raid6 to raid5 frees one device as a spare.
+func ChangeRAIDLevel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Array      string `json:"array"`
+			Level      string `json:"level"`
+			Device     string `json:"device"`      // Optional new device for raid5 -> raid6
+			BackupFile string `json:"backup_file"` // Optional, for reshapes that need one
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		name, path, err := raidArrayPath(req.Array)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateRAIDBackupFile(req.BackupFile); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		newLevel := strings.ToLower(req.Level)
+		if !strings.HasPrefix(newLevel, "raid") {
+			newLevel = "raid" + newLevel
+		}
+
+		level, current, err := raidDetail(path)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeRAIDArrayNotFound, err.Error(), nil)
+			return
+		}
+		allowed := false
+		for _, to := range raidLevelChanges[level] {
+			if to == newLevel {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			supported := raidLevelChanges[level]
+			if len(supported) == 0 {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Changing the level of a %s array is not supported", level), nil)
+				return
+			}
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("A %s array can be changed to: %s", level, strings.Join(supported, ", ")), nil)
+			return
+		}
+		if err := checkRAIDIdle(name); err != nil {
+			apierror.Write(w, http.StatusConflict, apierror.CodeBusy, err.Error(), nil)
+			return
+		}
+
+		target := current
+		switch {
+		case level == "raid1" || newLevel == "raid1":
+			// mdadm converts between raid1 and raid5 only with exactly two devices
+			if current != 2 {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Converting between raid1 and raid5 requires a 2-device array, %s has %d", path, current), nil)
+				return
+			}
+		case newLevel == "raid6":
+			target = current + 1
+			spares := raidSpareCount(name)
+			if req.Device != "" {
+				spares++
+			}
+			if spares == 0 {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Converting to raid6 needs a spare device: add one or pass device", nil)
+				return
+			}
+		case level == "raid6":
+			target = current - 1
+		}
+
+		var added []string
+		if req.Device != "" {
+			if added, err = addRAIDSpares(path, []string{req.Device}); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+		}
+
+		args := []string{"--grow", path, "--level=" + strings.TrimPrefix(newLevel, "raid")}
+		if target != current {
+			args = append(args, "--raid-devices="+strconv.Itoa(target))
+		}
+		if req.BackupFile != "" {
+			args = append(args, "--backup-file="+req.BackupFile)
+		}
+		output, err := exec.Command("mdadm", args...).CombinedOutput()
+		if err != nil {
+			message := fmt.Sprintf("Failed to change RAID level: %s - %s", err.Error(), string(output))
+			if len(added) > 0 {
+				message += fmt.Sprintf(" (%s remains in the array as a spare)", added[0])
+			}
+			apierror.Error(w, message, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":      fmt.Sprintf("Converting %s from %s to %s", path, level, newLevel),
+			"level":        newLevel,
+			"raid_devices": target,
+		})
+	}
+}
+
+// GetRAIDReshapeStatus reports the reshape, resync or recovery running on an array and its
+// progress
+func GetRAIDReshapeStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, path, err := raidArrayPath(r.URL.Query().Get("name"))
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		level, raidDevices, err := raidDetail(path)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeRAIDArrayNotFound, err.Error(), nil)
+			return
+		}
+
+		status := RAIDReshapeStatus{
+			Array:       path,
+			Level:       level,
+			RaidDevices: raidDevices,
+			Action:      raidSyncAction(name),
+		}
+
+		if data, err := os.ReadFile("/proc/mdstat"); err == nil {
+			inArray := false
+			scanner := bufio.NewScanner(strings.NewReader(string(data)))
+			for scanner.Scan() {
+				line := scanner.Text()
+				if strings.HasPrefix(line, "md") {
+					inArray = strings.HasPrefix(line, name+" ")
+					continue
+				}
+				if !inArray {
+					continue
+				}
+				if progress, ok := parseMDStatProgress(line); ok {
+					status.InProgress = true
+					status.Percent = progress.Percent
+					status.Finish = progress.Finish
+					status.Speed = progress.Speed
+					if status.Action == "" || status.Action == "idle" {
+						status.Action = progress.Action
+					}
+				}
+			}
+		}
+		if status.Action == "" {
+			status.Action = "idle"
+		}
+		if status.Action != "idle" {
+			status.InProgress = true
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// raidSpareWithStatus fills in whether a pooled spare can still be used
+func raidSpareWithStatus(spare *models.RAIDSpare) *models.RAIDSpare {
+	spare.SizeHuman = formatBytes(spare.Size)
+	spare.Available = true
+	spare.Problem = ""
+	if err := checkZFSDeviceAvailable(spare.Device); err != nil {
+		spare.Available = false
+		spare.Problem = err.Error()
+	}
+	return spare
+}
+
+// assignPoolSpares adds a device from the spare pool to every degraded array that has no
+// spare of its own. Spares that are gone, in use or too small are skipped.
+func (m *StorageMonitor) assignPoolSpares(arrays []models.RAIDArray) {
+	for _, array := range arrays {
+		if array.State != "degraded" {
+			continue
+		}
+		hasSpare := false
+		for _, member := range array.Members {
+			if member.Role == "spare" {
+				hasSpare = true
+				break
+			}
+		}
+		if hasSpare {
+			// md rebuilds onto the array's own spare
+			continue
+		}
+
+		for _, spare := range m.store.ListRAIDSpares() {
+			if err := checkZFSDeviceAvailable(spare.Device); err != nil {
+				continue
+			}
+			output, err := exec.Command("mdadm", "--add", array.Path, spare.Device).CombinedOutput()
+			if err != nil {
+				log.Printf("Spare pool: failed to add %s to %s: %s", spare.Device, array.Path, commandError(output, err))
+				continue
+			}
+			if err := m.store.DeleteRAIDSpare(spare.ID); err != nil {
+				log.Printf("Spare pool: failed to remove %s from the pool: %v", spare.Device, err)
+			}
+
+			log.Printf("Spare pool: added %s to degraded array %s", spare.Device, array.Path)
+			events.PublishToAdmins(events.TypeRAIDSpareAssigned, map[string]interface{}{
+				"name":   array.Name,
+				"level":  array.Level,
+				"device": spare.Device,
+			})
+			break
+		}
+	}
+}
+
+// ListRAIDSpares returns the devices in the global hot-spare pool
+func ListRAIDSpares(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		spares := store.ListRAIDSpares()
+		for _, spare := range spares {
+			raidSpareWithStatus(spare)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(spares)
+	}
+}
+
+// AddRAIDSpare registers an unused device in the global hot-spare pool
+func AddRAIDSpare(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Device string `json:"device"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		device := req.Device
+		if !strings.HasPrefix(device, "/dev/") {
+			device = "/dev/" + device
+		}
+		if err := validateDevicePath(device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := checkZFSDeviceAvailable(device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		size, err := blockDeviceSize(device)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		spare, err := store.CreateRAIDSpare(&models.RAIDSpare{Device: device, Size: size})
+		if err != nil {
+			if strings.Contains(err.Error(), "already") {
+				apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, err.Error(), nil)
+				return
+			}
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(raidSpareWithStatus(spare))
+	}
+}
+
+// RemoveRAIDSpare takes a device out of the global hot-spare pool
+func RemoveRAIDSpare(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := store.DeleteRAIDSpare(chi.URLParam(r, "id")); err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeSpareNotFound, err.Error(), nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SetRAIDBitmap adds or removes an array's internal write-intent bitmap. The bitmap limits the
+// resync after an unclean shutdown or a re-added member to the regions that changed.
+func SetRAIDBitmap() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Array   string `json:"array"`
+			Enabled bool   `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		name, path, err := raidArrayPath(req.Array)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		level, _, err := raidDetail(path)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeRAIDArrayNotFound, err.Error(), nil)
+			return
+		}
+		if level == "raid0" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "raid0 arrays have no redundancy and cannot use a bitmap", nil)
+			return
+		}
+		if err := checkRAIDIdle(name); err != nil {
+			apierror.Write(w, http.StatusConflict, apierror.CodeBusy, err.Error(), nil)
+			return
+		}
+
+		bitmap := "none"
+		if req.Enabled {
+			bitmap = "internal"
+		}
+		output, err := exec.Command("mdadm", "--grow", path, "--bitmap="+bitmap).CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to set bitmap: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		message := fmt.Sprintf("Internal bitmap enabled on %s", path)
+		if !req.Enabled {
+			message = fmt.Sprintf("Bitmap removed from %s", path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": message,
+			"bitmap":  bitmap,
+		})
+	}
+}
@@ -0,0 +1,766 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	replicationHistoryLimit = 100 // History entries kept per job
+	replicationSSHTimeout   = 15  // Seconds to wait for the SSH connection to the target
+)
+
+var (
+	replicationHostRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.\-:]*$`)
+	replicationUserRegex = regexp.MustCompile(`^[a-z_][a-z0-9_.\-]*$`)
+)
+
+// ReplicationManager runs ZFS replication jobs on their schedule
+type ReplicationManager struct {
+	store    storage.DataStore
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	active   map[string]bool // Jobs with a transfer in progress
+}
+
+// NewReplicationManager creates a new replication manager
+func NewReplicationManager(store storage.DataStore) *ReplicationManager {
+	return &ReplicationManager{
+		store:    store,
+		stopChan: make(chan struct{}),
+		active:   make(map[string]bool),
+	}
+}
+
+// Start begins the replication scheduler background goroutine
+func (m *ReplicationManager) Start() {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = true
+	m.stopChan = make(chan struct{})
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.mu.Unlock()
+
+	// Transfers cut off by a restart are picked up again through the resume token
+	m.store.FailInterruptedReplicationRuns("interrupted by a server restart")
+
+	m.wg.Add(1)
+	go m.run()
+	log.Println("Replication manager started")
+}
+
+// Stop stops the scheduler and aborts running transfers; they resume on the next run
+func (m *ReplicationManager) Stop() {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = false
+	close(m.stopChan)
+	m.cancel()
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	log.Println("Replication manager stopped")
+}
+
+// IsRunning reports whether a job has a transfer in progress
+func (m *ReplicationManager) IsRunning(jobID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active[jobID]
+}
+
+// run is the main scheduler loop
+func (m *ReplicationManager) run() {
+	defer m.wg.Done()
+
+	// Check every minute for jobs that need to run
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	m.checkAndRunJobs()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.checkAndRunJobs()
+		}
+	}
+}
+
+// checkAndRunJobs starts the enabled jobs that are due
+func (m *ReplicationManager) checkAndRunJobs() {
+	now := time.Now()
+
+	for _, job := range m.store.ListReplicationJobs() {
+		if !job.Enabled {
+			continue
+		}
+
+		// Initialize NextRun if not set
+		if job.NextRun == nil {
+			m.store.UpdateReplicationJob(job.ID, map[string]interface{}{
+				"next_run": nextScheduledRun(job.Schedule, now),
+			})
+			continue
+		}
+
+		if !now.Before(*job.NextRun) {
+			m.startJob(job)
+		}
+	}
+}
+
+// startJob runs a job in the background unless it is already running
+func (m *ReplicationManager) startJob(job *models.ReplicationJob) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.running || m.active[job.ID] {
+		return false
+	}
+	m.active[job.ID] = true
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() {
+			m.mu.Lock()
+			delete(m.active, job.ID)
+			m.mu.Unlock()
+		}()
+		m.runJob(job)
+	}()
+	return true
+}
+
+// runJob replicates a job once and records the result
+func (m *ReplicationManager) runJob(job *models.ReplicationJob) {
+	log.Printf("Running replication job: %s (%s -> %s)", job.Name, job.SourceDataset, replicationDestination(job))
+
+	now := time.Now()
+	run, err := m.store.CreateReplicationRun(&models.ReplicationRun{
+		JobID:     job.ID,
+		Status:    models.ReplicationStatusRunning,
+		StartedAt: now,
+	})
+	if err != nil {
+		log.Printf("Replication job %s: failed to record run: %v", job.Name, err)
+		return
+	}
+
+	err = m.replicate(job, run)
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = models.ReplicationStatusSuccess
+	lastSnapshot := job.LastSnapshot
+	if err != nil {
+		run.Status = models.ReplicationStatusFailed
+		run.Error = err.Error()
+		log.Printf("Replication job %s failed: %v", job.Name, err)
+	} else {
+		lastSnapshot = run.Snapshot
+		log.Printf("Replication job %s completed: %s (%d bytes)", job.Name, run.Snapshot, run.BytesSent)
+	}
+
+	m.store.UpdateReplicationRun(run)
+	m.store.PruneReplicationRuns(job.ID, replicationHistoryLimit)
+	m.store.UpdateReplicationJobRun(job.ID, now, nextScheduledRun(job.Schedule, now), run.Status, lastSnapshot, run.Error)
+
+	eventData := map[string]interface{}{
+		"job_id":     job.ID,
+		"job_name":   job.Name,
+		"source":     job.SourceDataset,
+		"target":     replicationDestination(job),
+		"snapshot":   run.Snapshot,
+		"bytes_sent": run.BytesSent,
+	}
+	if err != nil {
+		eventData["error"] = run.Error
+		events.PublishToAdmins(events.TypeReplicationFailed, eventData)
+	} else {
+		events.PublishToAdmins(events.TypeReplicationCompleted, eventData)
+	}
+}
+
+// replicate snapshots the source and sends everything the target is missing
+func (m *ReplicationManager) replicate(job *models.ReplicationJob, run *models.ReplicationRun) error {
+	// Finish an interrupted transfer first; the target refuses other streams until it is done
+	// or aborted. Recursive replication streams cannot be resumed.
+	if !job.Recursive {
+		token, err := m.resumeToken(job)
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			run.Resumed = true
+			sent, err := m.transfer(job, []string{"send", "-t", token}, replicationReceiveArgs(job))
+			run.BytesSent += sent
+			if err != nil {
+				return fmt.Errorf("failed to resume interrupted transfer: %w", err)
+			}
+		}
+	}
+
+	snapshot := job.GetSnapshotName()
+	args := []string{"zfs", "snapshot"}
+	if job.Recursive {
+		args = append(args, "-r")
+	}
+	args = append(args, job.SourceDataset+"@"+snapshot)
+	if output, err := exec.CommandContext(m.ctx, "sudo", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create snapshot: %s", commandError(output, err))
+	}
+	run.Snapshot = snapshot
+
+	base, err := m.lastCommonSnapshot(job, snapshot)
+	if err != nil {
+		return err
+	}
+	run.BaseSnapshot = base
+	m.store.UpdateReplicationRun(run)
+
+	sendArgs := []string{"send"}
+	if job.Recursive {
+		sendArgs = append(sendArgs, "-R")
+	}
+	if base != "" {
+		sendArgs = append(sendArgs, "-i", "@"+base)
+	}
+	sendArgs = append(sendArgs, job.SourceDataset+"@"+snapshot)
+
+	sent, err := m.transfer(job, sendArgs, replicationReceiveArgs(job))
+	run.BytesSent += sent
+	if err != nil {
+		return err
+	}
+
+	m.pruneSnapshots(job)
+	return nil
+}
+
+// transfer pipes zfs send on this host into zfs receive on the target and returns the bytes sent
+func (m *ReplicationManager) transfer(job *models.ReplicationJob, sendArgs, receiveArgs []string) (int64, error) {
+	send := exec.CommandContext(m.ctx, "sudo", append([]string{"zfs"}, sendArgs...)...)
+	receive := replicationTargetCommand(m.ctx, job, receiveArgs...)
+
+	var sendErr, receiveErr bytes.Buffer
+	send.Stderr = &sendErr
+	receive.Stderr = &receiveErr
+
+	stream, err := send.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	counter := &countingReader{r: stream}
+	receive.Stdin = counter
+
+	if err := send.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start zfs send: %w", err)
+	}
+	if err := receive.Start(); err != nil {
+		stream.Close()
+		send.Wait()
+		return 0, fmt.Errorf("failed to start zfs receive: %w", err)
+	}
+
+	receiveWaitErr := receive.Wait()
+	// Closing the pipe stops zfs send if the receiving side gave up early
+	stream.Close()
+	sendWaitErr := send.Wait()
+
+	if receiveWaitErr != nil {
+		return counter.n, fmt.Errorf("zfs receive failed: %s", commandError(receiveErr.Bytes(), receiveWaitErr))
+	}
+	if sendWaitErr != nil {
+		return counter.n, fmt.Errorf("zfs send failed: %s", commandError(sendErr.Bytes(), sendWaitErr))
+	}
+	return counter.n, nil
+}
+
+// resumeToken returns the token of an interrupted receive on the target, if any
+func (m *ReplicationManager) resumeToken(job *models.ReplicationJob) (string, error) {
+	output, err := replicationTargetCommand(m.ctx, job, "get", "-H", "-o", "value", "receive_resume_token", job.TargetDataset).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "does not exist") {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to query target: %s", commandError(output, err))
+	}
+
+	token := strings.TrimSpace(string(output))
+	if token == "-" {
+		return "", nil
+	}
+	return token, nil
+}
+
+// lastCommonSnapshot returns the newest source snapshot that also exists on the target, the base
+// of an incremental send. An empty result means the target has to receive a full stream.
+func (m *ReplicationManager) lastCommonSnapshot(job *models.ReplicationJob, current string) (string, error) {
+	targetSnapshots, err := m.listSnapshots(job, true)
+	if err != nil {
+		return "", err
+	}
+	if len(targetSnapshots) == 0 {
+		return "", nil
+	}
+
+	onTarget := make(map[string]bool, len(targetSnapshots))
+	for _, name := range targetSnapshots {
+		onTarget[name] = true
+	}
+
+	sourceSnapshots, err := m.listSnapshots(job, false)
+	if err != nil {
+		return "", err
+	}
+	for i := len(sourceSnapshots) - 1; i >= 0; i-- {
+		if sourceSnapshots[i] != current && onTarget[sourceSnapshots[i]] {
+			return sourceSnapshots[i], nil
+		}
+	}
+
+	return "", fmt.Errorf("target dataset %s has no snapshot in common with %s; destroy or rename it to start a full replication",
+		job.TargetDataset, job.SourceDataset)
+}
+
+// listSnapshots returns the snapshot names (without the dataset) of the source or target dataset, oldest first
+func (m *ReplicationManager) listSnapshots(job *models.ReplicationJob, target bool) ([]string, error) {
+	args := []string{"list", "-H", "-t", "snapshot", "-o", "name", "-s", "createtxg", "-d", "1"}
+
+	var cmd *exec.Cmd
+	if target {
+		cmd = replicationTargetCommand(m.ctx, job, append(args, job.TargetDataset)...)
+	} else {
+		cmd = exec.CommandContext(m.ctx, "zfs", append(args, job.SourceDataset)...)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if target && strings.Contains(string(output), "does not exist") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list snapshots: %s", commandError(output, err))
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if _, name, ok := strings.Cut(strings.TrimSpace(line), "@"); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// pruneSnapshots destroys replication snapshots beyond the retention limit on both sides.
+// The newest snapshot is always kept because the next incremental send starts from it.
+func (m *ReplicationManager) pruneSnapshots(job *models.ReplicationJob) {
+	keep := job.Retention
+	if keep < 1 {
+		keep = 1
+	}
+
+	for _, target := range []bool{false, true} {
+		names, err := m.listSnapshots(job, target)
+		if err != nil {
+			log.Printf("Replication job %s: failed to list snapshots for pruning: %v", job.Name, err)
+			continue
+		}
+
+		var owned []string
+		for _, name := range names {
+			if strings.HasPrefix(name, job.GetSnapshotPrefix()) {
+				owned = append(owned, name)
+			}
+		}
+
+		for i := 0; i < len(owned)-keep; i++ {
+			args := []string{"destroy"}
+			if job.Recursive {
+				args = append(args, "-r")
+			}
+
+			var cmd *exec.Cmd
+			if target {
+				cmd = replicationTargetCommand(m.ctx, job, append(args, job.TargetDataset+"@"+owned[i])...)
+			} else {
+				cmd = exec.CommandContext(m.ctx, "sudo", append([]string{"zfs"}, append(args, job.SourceDataset+"@"+owned[i])...)...)
+			}
+			if output, err := cmd.CombinedOutput(); err != nil {
+				log.Printf("Replication job %s: failed to delete snapshot %s: %s", job.Name, owned[i], commandError(output, err))
+			}
+		}
+	}
+}
+
+// replicationReceiveArgs returns the zfs receive arguments for a job. The target is rolled back to
+// its last snapshot (-F) and not mounted (-u); -s keeps partial state so an interrupted stream can resume.
+func replicationReceiveArgs(job *models.ReplicationJob) []string {
+	args := []string{"receive", "-u", "-F"}
+	if !job.Recursive {
+		args = append(args, "-s")
+	}
+	return append(args, job.TargetDataset)
+}
+
+// replicationTargetCommand builds a zfs command for the target, run over SSH for remote targets.
+// Arguments are dataset names and flags validated when the job was saved, so they are safe to
+// pass through the remote shell.
+func replicationTargetCommand(ctx context.Context, job *models.ReplicationJob, args ...string) *exec.Cmd {
+	if job.TargetHost == "" {
+		return exec.CommandContext(ctx, "sudo", append([]string{"zfs"}, args...)...)
+	}
+
+	sshArgs := []string{
+		"-p", strconv.Itoa(job.TargetPort),
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", fmt.Sprintf("ConnectTimeout=%d", replicationSSHTimeout),
+		"-o", "ServerAliveInterval=30",
+	}
+	if job.SSHKeyPath != "" {
+		sshArgs = append(sshArgs, "-i", job.SSHKeyPath)
+	}
+	sshArgs = append(sshArgs, job.TargetUser+"@"+job.TargetHost, "zfs "+strings.Join(args, " "))
+	return exec.CommandContext(ctx, "ssh", sshArgs...)
+}
+
+// replicationDestination describes where a job replicates to
+func replicationDestination(job *models.ReplicationJob) string {
+	if job.TargetHost == "" {
+		return job.TargetDataset
+	}
+	return job.TargetHost + ":" + job.TargetDataset
+}
+
+// commandError returns the output of a failed command, or the error when it printed nothing
+func commandError(output []byte, err error) string {
+	if msg := strings.TrimSpace(string(output)); msg != "" {
+		return msg
+	}
+	return err.Error()
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// validateReplicationJob checks the settings of a job before it is saved
+func validateReplicationJob(job *models.ReplicationJob) error {
+	if strings.TrimSpace(job.Name) == "" {
+		return errors.New("job name is required")
+	}
+	if err := validateZFSDatasetName(job.SourceDataset); err != nil {
+		return fmt.Errorf("source dataset: %w", err)
+	}
+	if err := validateZFSDatasetName(job.TargetDataset); err != nil {
+		return fmt.Errorf("target dataset: %w", err)
+	}
+
+	validSchedules := map[string]bool{
+		"hourly": true, "daily": true, "weekly": true, "monthly": true,
+	}
+	if !validSchedules[job.Schedule] {
+		return errors.New("invalid schedule. Must be: hourly, daily, weekly, or monthly")
+	}
+	if job.Retention < 1 {
+		return errors.New("retention must be at least 1")
+	}
+
+	if job.TargetHost == "" {
+		if job.TargetDataset == job.SourceDataset || strings.HasPrefix(job.TargetDataset, job.SourceDataset+"/") {
+			return errors.New("target dataset cannot be the source dataset or inside it")
+		}
+		return nil
+	}
+
+	if !replicationHostRegex.MatchString(job.TargetHost) {
+		return errors.New("invalid target host")
+	}
+	if job.TargetPort < 1 || job.TargetPort > 65535 {
+		return errors.New("invalid target port")
+	}
+	if !replicationUserRegex.MatchString(job.TargetUser) {
+		return errors.New("invalid target user")
+	}
+	if job.SSHKeyPath != "" {
+		if !filepath.IsAbs(job.SSHKeyPath) {
+			return errors.New("SSH key path must be absolute")
+		}
+		if _, err := os.Stat(job.SSHKeyPath); err != nil {
+			return fmt.Errorf("SSH key not found: %s", job.SSHKeyPath)
+		}
+	}
+	return nil
+}
+
+// ============================================================================
+// HTTP Handlers
+// ============================================================================
+
+// ReplicationHandler handles replication job API requests
+type ReplicationHandler struct {
+	store   storage.DataStore
+	manager *ReplicationManager
+}
+
+// NewReplicationHandler creates a new handler
+func NewReplicationHandler(store storage.DataStore, manager *ReplicationManager) *ReplicationHandler {
+	return &ReplicationHandler{
+		store:   store,
+		manager: manager,
+	}
+}
+
+// ListJobs returns all replication jobs
+func (h *ReplicationHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	jobs := h.store.ListReplicationJobs()
+	for _, job := range jobs {
+		job.Running = h.manager.IsRunning(job.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// GetJob returns a single replication job
+func (h *ReplicationHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.GetReplicationJob(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeReplicationJobNotFound, err.Error(), nil)
+		return
+	}
+	job.Running = h.manager.IsRunning(job.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// CreateJob creates a new replication job
+func (h *ReplicationHandler) CreateJob(w http.ResponseWriter, r *http.Request) {
+	var job models.ReplicationJob
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	if job.Schedule == "" {
+		job.Schedule = "daily"
+	}
+	if job.Retention == 0 {
+		job.Retention = 3
+	}
+	if job.TargetHost != "" {
+		if job.TargetPort == 0 {
+			job.TargetPort = 22
+		}
+		if job.TargetUser == "" {
+			job.TargetUser = "root"
+		}
+	}
+
+	if err := validateReplicationJob(&job); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	// Verify source dataset exists
+	if output, err := exec.Command("zfs", "list", "-H", job.SourceDataset).CombinedOutput(); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Dataset '%s' not found: %s", job.SourceDataset, string(output)), nil)
+		return
+	}
+
+	nextRun := nextScheduledRun(job.Schedule, time.Now())
+	job.NextRun = &nextRun
+	job.LastRun = nil
+	job.LastStatus = ""
+	job.LastError = ""
+	job.LastSnapshot = ""
+
+	created, err := h.store.CreateReplicationJob(&job)
+	if err != nil {
+		apierror.Error(w, fmt.Sprintf("Failed to create replication job: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// UpdateJob updates a replication job
+func (h *ReplicationHandler) UpdateJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.GetReplicationJob(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeReplicationJobNotFound, err.Error(), nil)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	var updates map[string]interface{}
+	if err := json.Unmarshal(body, &updates); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	delete(updates, "next_run")
+
+	// Validate the job as it will look after the update
+	merged := *job
+	if err := json.Unmarshal(body, &merged); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	if merged.TargetHost != "" && merged.TargetUser == "" {
+		merged.TargetUser = "root"
+		updates["target_user"] = "root"
+	}
+	if err := validateReplicationJob(&merged); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	if dataset, ok := updates["source_dataset"].(string); ok {
+		if output, err := exec.Command("zfs", "list", "-H", dataset).CombinedOutput(); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Dataset '%s' not found: %s", dataset, string(output)), nil)
+			return
+		}
+	}
+	if _, ok := updates["schedule"].(string); ok {
+		updates["next_run"] = nextScheduledRun(merged.Schedule, time.Now())
+	}
+
+	updated, err := h.store.UpdateReplicationJob(job.ID, updates)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updated.Running = h.manager.IsRunning(updated.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteJob deletes a replication job and its history. Snapshots on either side are kept.
+func (h *ReplicationHandler) DeleteJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if h.manager.IsRunning(id) {
+		apierror.Write(w, http.StatusConflict, apierror.CodeBusy, "Replication job is running", nil)
+		return
+	}
+
+	if err := h.store.DeleteReplicationJob(id); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeReplicationJobNotFound, err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Replication job deleted successfully",
+	})
+}
+
+// RunJob starts a replication job immediately
+func (h *ReplicationHandler) RunJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.GetReplicationJob(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeReplicationJobNotFound, err.Error(), nil)
+		return
+	}
+
+	if !h.manager.startJob(job) {
+		apierror.Write(w, http.StatusConflict, apierror.CodeBusy, "Replication job is already running", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Replication started",
+	})
+}
+
+// GetJobStatus returns the state of a job and its most recent run
+func (h *ReplicationHandler) GetJobStatus(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.GetReplicationJob(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeReplicationJobNotFound, err.Error(), nil)
+		return
+	}
+	job.Running = h.manager.IsRunning(job.ID)
+
+	var latest *models.ReplicationRun
+	if runs := h.store.ListReplicationRuns(job.ID, 1); len(runs) > 0 {
+		latest = runs[0]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job":        job,
+		"running":    job.Running,
+		"latest_run": latest,
+	})
+}
+
+// GetJobHistory returns the recent runs of a job, newest first
+func (h *ReplicationHandler) GetJobHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := h.store.GetReplicationJob(id); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeReplicationJobNotFound, err.Error(), nil)
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= replicationHistoryLimit {
+		limit = l
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.ListReplicationRuns(id, limit))
+}
@@ -0,0 +1,623 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	retentionLogLimit     = 5000 // Log entries kept per policy
+	retentionPreviewLimit = 1000 // Files listed in a preview
+	retentionBatchSize    = 200  // Log entries written per transaction during a run
+)
+
+// errRetentionStopped is returned when a run is interrupted by the scheduler stopping
+var errRetentionStopped = errors.New("server stopped before the run finished")
+
+// RetentionScheduler runs retention policies on their schedule
+type RetentionScheduler struct {
+	store    storage.DataStore
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	active   map[string]bool // Policies with a run in progress
+}
+
+// NewRetentionScheduler creates a new retention scheduler
+func NewRetentionScheduler(store storage.DataStore) *RetentionScheduler {
+	return &RetentionScheduler{
+		store:    store,
+		stopChan: make(chan struct{}),
+		active:   make(map[string]bool),
+	}
+}
+
+// Start begins the retention scheduler background goroutine
+func (s *RetentionScheduler) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.stopChan = make(chan struct{})
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.run()
+	log.Println("Retention scheduler started")
+}
+
+// Stop stops the scheduler and waits for runs in progress to stop
+func (s *RetentionScheduler) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stopChan)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	log.Println("Retention scheduler stopped")
+}
+
+// IsRunning reports whether a policy has a run in progress
+func (s *RetentionScheduler) IsRunning(policyID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active[policyID]
+}
+
+// run is the main scheduler loop
+func (s *RetentionScheduler) run() {
+	defer s.wg.Done()
+
+	// Check every minute for policies that need to run
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	s.checkAndRunPolicies()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.checkAndRunPolicies()
+		}
+	}
+}
+
+// checkAndRunPolicies starts the enabled policies that are due
+func (s *RetentionScheduler) checkAndRunPolicies() {
+	now := time.Now()
+
+	for _, policy := range s.store.ListRetentionPolicies() {
+		if !policy.Enabled {
+			continue
+		}
+
+		// Initialize NextRun if not set
+		if policy.NextRun == nil {
+			nextRun := nextScheduledRun(policy.Schedule, now)
+			policy.NextRun = &nextRun
+			s.store.UpdateRetentionPolicy(policy)
+			continue
+		}
+
+		if !now.Before(*policy.NextRun) {
+			s.startPolicy(policy)
+		}
+	}
+}
+
+// startPolicy runs a policy in the background unless it is already running
+func (s *RetentionScheduler) startPolicy(policy *models.RetentionPolicy) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running || s.active[policy.ID] {
+		return false
+	}
+	s.active[policy.ID] = true
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.active, policy.ID)
+			s.mu.Unlock()
+		}()
+		s.runPolicy(policy)
+	}()
+	return true
+}
+
+// runPolicy applies a policy once and records the result
+func (s *RetentionScheduler) runPolicy(policy *models.RetentionPolicy) {
+	now := time.Now()
+	handled, failed, err := applyRetentionPolicy(s.store, policy, s.stopChan)
+
+	status := models.RetentionStatusSuccess
+	lastError := ""
+	switch {
+	case err != nil:
+		status = models.RetentionStatusFailed
+		lastError = err.Error()
+		log.Printf("Retention policy %s failed: %v", policy.Name, err)
+	case failed > 0:
+		status = models.RetentionStatusErrors
+		lastError = fmt.Sprintf("%d files could not be handled", failed)
+		log.Printf("Retention policy %s: %d files handled, %d failed", policy.Name, handled, failed)
+	default:
+		log.Printf("Retention policy %s: %d files handled", policy.Name, handled)
+	}
+
+	s.store.PruneRetentionActions(policy.ID, retentionLogLimit)
+	s.store.UpdateRetentionPolicyRun(policy.ID, now, nextScheduledRun(policy.Schedule, now), status, lastError)
+}
+
+// retentionZoneDir returns the absolute directory of a path within a local zone
+func retentionZoneDir(store storage.DataStore, zoneID, path string) (string, string, error) {
+	zone, err := store.GetShareZone(zoneID)
+	if err != nil {
+		return "", "", err
+	}
+	pool, err := store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		return "", "", errors.New("pool not found")
+	}
+	if pool.IsS3() {
+		return "", "", fmt.Errorf("zone %s is on an object storage pool", zone.Name)
+	}
+
+	root := filepath.Join(pool.Path, zone.Path)
+	dir := filepath.Join(root, filepath.Clean("/"+path))
+	if isReservedZonePath(root, dir) {
+		return "", "", errors.New("the zone trash and version store cannot be used")
+	}
+	return root, dir, nil
+}
+
+// walkRetentionCandidates calls fn for every regular file under the policy directory that
+// matches the policy pattern and was last modified before cutoff
+func walkRetentionCandidates(store storage.DataStore, policy *models.RetentionPolicy, cutoff time.Time, stop <-chan struct{}, fn func(fullPath, relPath string, info os.FileInfo)) error {
+	root, dir, err := retentionZoneDir(store, policy.ZoneID, policy.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+
+	stopped := false
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Skip inaccessible files/directories
+			return nil
+		}
+		if stop != nil {
+			select {
+			case <-stop:
+				stopped = true
+				return filepath.SkipAll
+			default:
+			}
+		}
+		if info.IsDir() {
+			if isReservedZonePath(root, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		if policy.Pattern != "" {
+			if ok, _ := filepath.Match(policy.Pattern, info.Name()); !ok {
+				return nil
+			}
+		}
+		fn(path, usageRelPath(root, path), info)
+		return nil
+	})
+	if stopped {
+		return errRetentionStopped
+	}
+	return err
+}
+
+// retentionCutoff returns the modification time before which files match a policy
+func retentionCutoff(policy *models.RetentionPolicy, now time.Time) time.Time {
+	return now.AddDate(0, 0, -policy.MaxAgeDays)
+}
+
+// previewRetentionPolicy lists the files a policy would act on without touching them
+func previewRetentionPolicy(store storage.DataStore, policy *models.RetentionPolicy) (*models.RetentionPreview, error) {
+	preview := &models.RetentionPreview{
+		PolicyID: policy.ID,
+		Action:   policy.Action,
+		Cutoff:   retentionCutoff(policy, time.Now()),
+		Files:    []*models.RetentionCandidate{},
+	}
+
+	err := walkRetentionCandidates(store, policy, preview.Cutoff, nil, func(fullPath, relPath string, info os.FileInfo) {
+		preview.TotalFiles++
+		preview.TotalSize += info.Size()
+		if len(preview.Files) < retentionPreviewLimit {
+			preview.Files = append(preview.Files, &models.RetentionCandidate{
+				Path:    relPath,
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+			})
+		} else {
+			preview.Truncated = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// archiveFile moves a file into the archive directory, keeping its permissions and modification time
+func archiveFile(fullPath, dest string, info os.FileInfo) error {
+	if _, err := os.Lstat(dest); err == nil {
+		return errors.New("a file with the same name already exists in the archive")
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := moveFile(fullPath, dest); err != nil {
+		return err
+	}
+	// A copy across filesystems gets a new mode and modification time
+	os.Chmod(dest, info.Mode().Perm())
+	os.Chtimes(dest, time.Now(), info.ModTime())
+	return nil
+}
+
+// applyRetentionPolicy deletes or archives every matching file and logs each action. It returns
+// the number of files handled and the number that failed.
+func applyRetentionPolicy(store storage.DataStore, policy *models.RetentionPolicy, stop <-chan struct{}) (handled, failed int, err error) {
+	_, sourceDir, err := retentionZoneDir(store, policy.ZoneID, policy.Path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var archiveRoot, archiveDir string
+	if policy.Action == models.RetentionActionArchive {
+		if archiveRoot, archiveDir, err = retentionZoneDir(store, policy.ArchiveZoneID, policy.ArchivePath); err != nil {
+			return 0, 0, fmt.Errorf("archive zone: %w", err)
+		}
+	}
+
+	batch := make([]*models.RetentionAction, 0, retentionBatchSize)
+	flush := func() {
+		if err := store.AddRetentionActions(batch); err != nil {
+			log.Printf("Retention policy %s: failed to log actions: %v", policy.Name, err)
+		}
+		batch = batch[:0]
+	}
+
+	err = walkRetentionCandidates(store, policy, retentionCutoff(policy, time.Now()), stop, func(fullPath, relPath string, info os.FileInfo) {
+		action := &models.RetentionAction{
+			PolicyID:    policy.ID,
+			ZoneID:      policy.ZoneID,
+			Path:        relPath,
+			Action:      policy.Action,
+			Size:        info.Size(),
+			ModTime:     info.ModTime(),
+			PerformedAt: time.Now(),
+		}
+
+		var actionErr error
+		if policy.Action == models.RetentionActionArchive {
+			rel, _ := filepath.Rel(sourceDir, fullPath)
+			dest := filepath.Join(archiveDir, rel)
+			action.Destination = usageRelPath(archiveRoot, dest)
+			if actionErr = archiveFile(fullPath, dest, info); actionErr == nil {
+				indexPath(store, dest)
+			}
+		} else {
+			actionErr = os.Remove(fullPath)
+		}
+
+		if actionErr != nil {
+			action.Error = actionErr.Error()
+			failed++
+		} else {
+			unindexPath(store, fullPath)
+			handled++
+		}
+
+		batch = append(batch, action)
+		if len(batch) >= retentionBatchSize {
+			flush()
+		}
+	})
+	flush()
+	return handled, failed, err
+}
+
+// validateRetentionPolicy checks the settings of a policy before it is saved
+func validateRetentionPolicy(store storage.DataStore, policy *models.RetentionPolicy) error {
+	validSchedules := map[string]bool{
+		"hourly": true, "daily": true, "weekly": true, "monthly": true,
+	}
+	if !validSchedules[policy.Schedule] {
+		return errors.New("invalid schedule. Must be: hourly, daily, weekly, or monthly")
+	}
+	if strings.TrimSpace(policy.Name) == "" {
+		return errors.New("name is required")
+	}
+	if policy.MaxAgeDays < 1 {
+		return errors.New("max_age_days must be at least 1")
+	}
+	if policy.Pattern != "" {
+		if _, err := filepath.Match(policy.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+	}
+
+	policy.Path = filepath.ToSlash(filepath.Clean("/" + policy.Path))
+	_, sourceDir, err := retentionZoneDir(store, policy.ZoneID, policy.Path)
+	if err != nil {
+		return err
+	}
+
+	switch policy.Action {
+	case models.RetentionActionDelete:
+		policy.ArchiveZoneID = ""
+		policy.ArchivePath = ""
+	case models.RetentionActionArchive:
+		policy.ArchivePath = filepath.ToSlash(filepath.Clean("/" + policy.ArchivePath))
+		_, archiveDir, err := retentionZoneDir(store, policy.ArchiveZoneID, policy.ArchivePath)
+		if err != nil {
+			return fmt.Errorf("archive zone: %w", err)
+		}
+		// Archived files keep their age, so an archive inside the source would be archived again
+		if archiveDir == sourceDir || strings.HasPrefix(archiveDir, sourceDir+string(filepath.Separator)) {
+			return errors.New("the archive directory cannot be inside the directory the policy cleans up")
+		}
+	default:
+		return errors.New("invalid action. Must be: delete or archive")
+	}
+	return nil
+}
+
+// ============================================================================
+// HTTP Handlers
+// ============================================================================
+
+// RetentionHandler handles retention policy API requests
+type RetentionHandler struct {
+	store     storage.DataStore
+	scheduler *RetentionScheduler
+}
+
+// NewRetentionHandler creates a new handler
+func NewRetentionHandler(store storage.DataStore, scheduler *RetentionScheduler) *RetentionHandler {
+	return &RetentionHandler{
+		store:     store,
+		scheduler: scheduler,
+	}
+}
+
+// ListPolicies returns all retention policies
+func (h *RetentionHandler) ListPolicies(w http.ResponseWriter, r *http.Request) {
+	policies := h.store.ListRetentionPolicies()
+	for _, policy := range policies {
+		policy.Running = h.scheduler.IsRunning(policy.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policies)
+}
+
+// GetPolicy returns a single retention policy
+func (h *RetentionHandler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.store.GetRetentionPolicy(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeRetentionPolicyNotFound, err.Error(), nil)
+		return
+	}
+	policy.Running = h.scheduler.IsRunning(policy.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// CreatePolicy creates a retention policy for a zone directory
+func (h *RetentionHandler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.RetentionPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	if policy.Schedule == "" {
+		policy.Schedule = "daily"
+	}
+	if err := validateRetentionPolicy(h.store, &policy); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	nextRun := nextScheduledRun(policy.Schedule, time.Now())
+	policy.NextRun = &nextRun
+	policy.LastRun = nil
+	policy.LastStatus = ""
+	policy.LastError = ""
+
+	created, err := h.store.CreateRetentionPolicy(&policy)
+	if err != nil {
+		apierror.Error(w, fmt.Sprintf("Failed to create retention policy: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// UpdatePolicy changes the settings of a retention policy
+func (h *RetentionHandler) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.store.GetRetentionPolicy(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeRetentionPolicyNotFound, err.Error(), nil)
+		return
+	}
+
+	// Fields missing from the body keep their current values
+	updated := *policy
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	updated.ID = policy.ID
+	updated.ZoneID = policy.ZoneID
+	updated.LastRun = policy.LastRun
+	updated.LastStatus = policy.LastStatus
+	updated.LastError = policy.LastError
+	updated.CreatedAt = policy.CreatedAt
+
+	if err := validateRetentionPolicy(h.store, &updated); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	if updated.Schedule != policy.Schedule {
+		nextRun := nextScheduledRun(updated.Schedule, time.Now())
+		updated.NextRun = &nextRun
+	} else {
+		updated.NextRun = policy.NextRun
+	}
+
+	if err := h.store.UpdateRetentionPolicy(&updated); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updated.Running = h.scheduler.IsRunning(updated.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeletePolicy deletes a retention policy and its log
+func (h *RetentionHandler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if h.scheduler.IsRunning(id) {
+		apierror.Write(w, http.StatusConflict, apierror.CodeBusy, "The policy is running", nil)
+		return
+	}
+
+	if err := h.store.DeleteRetentionPolicy(id); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeRetentionPolicyNotFound, err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Retention policy deleted successfully",
+	})
+}
+
+// RunPolicy applies a retention policy immediately
+func (h *RetentionHandler) RunPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.store.GetRetentionPolicy(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeRetentionPolicyNotFound, err.Error(), nil)
+		return
+	}
+
+	if !h.scheduler.startPolicy(policy) {
+		apierror.Write(w, http.StatusConflict, apierror.CodeBusy, "The policy is already running", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("Retention policy %s started", policy.Name),
+	})
+}
+
+// PreviewPolicy lists the files a retention policy would delete or archive if it ran now
+func (h *RetentionHandler) PreviewPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.store.GetRetentionPolicy(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeRetentionPolicyNotFound, err.Error(), nil)
+		return
+	}
+
+	preview, err := previewRetentionPolicy(h.store, policy)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// PreviewNewPolicy lists the files a policy would act on before it is created
+func (h *RetentionHandler) PreviewNewPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.RetentionPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	if policy.Schedule == "" {
+		policy.Schedule = "daily"
+	}
+	if err := validateRetentionPolicy(h.store, &policy); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	preview, err := previewRetentionPolicy(h.store, &policy)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// GetPolicyLog returns the files recently deleted or archived by a policy, newest first
+func (h *RetentionHandler) GetPolicyLog(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := h.store.GetRetentionPolicy(id); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeRetentionPolicyNotFound, err.Error(), nil)
+		return
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= retentionLogLimit {
+		limit = l
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.ListRetentionActions(id, limit))
+}
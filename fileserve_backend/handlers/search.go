@@ -0,0 +1,597 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// indexBatchSize is the number of entries written to the index per transaction
+	indexBatchSize = 500
+	// indexInterval is how often the indexer rescans every zone
+	indexInterval = 1 * time.Hour
+)
+
+// FileIndexer maintains the search index for all enabled zones in the background
+type FileIndexer struct {
+	store    storage.DataStore
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	status   map[string]*models.ZoneIndexStatus
+	trigger  chan string
+}
+
+// NewFileIndexer creates a new file indexer
+func NewFileIndexer(store storage.DataStore) *FileIndexer {
+	return &FileIndexer{
+		store:    store,
+		stopChan: make(chan struct{}),
+		status:   make(map[string]*models.ZoneIndexStatus),
+		trigger:  make(chan string, 16),
+	}
+}
+
+// Start begins the indexer background goroutine
+func (fi *FileIndexer) Start() {
+	fi.mu.Lock()
+	if fi.running {
+		fi.mu.Unlock()
+		return
+	}
+	fi.running = true
+	fi.stopChan = make(chan struct{})
+	fi.mu.Unlock()
+
+	fi.wg.Add(1)
+	go fi.run()
+	log.Println("File indexer started")
+}
+
+// Stop stops the indexer
+func (fi *FileIndexer) Stop() {
+	fi.mu.Lock()
+	if !fi.running {
+		fi.mu.Unlock()
+		return
+	}
+	fi.running = false
+	close(fi.stopChan)
+	fi.mu.Unlock()
+
+	fi.wg.Wait()
+	log.Println("File indexer stopped")
+}
+
+// run is the main indexer loop
+func (fi *FileIndexer) run() {
+	defer fi.wg.Done()
+
+	ticker := time.NewTicker(indexInterval)
+	defer ticker.Stop()
+
+	// Initial scan
+	fi.indexAllZones()
+
+	for {
+		select {
+		case <-fi.stopChan:
+			return
+		case <-ticker.C:
+			fi.indexAllZones()
+		case zoneID := <-fi.trigger:
+			if zoneID == "" {
+				fi.indexAllZones()
+				continue
+			}
+			if zone, err := fi.store.GetShareZone(zoneID); err == nil {
+				fi.IndexZone(zone)
+			}
+		}
+	}
+}
+
+// Reindex queues a full rescan of one zone, or of all zones when zoneID is empty
+func (fi *FileIndexer) Reindex(zoneID string) bool {
+	select {
+	case fi.trigger <- zoneID:
+		return true
+	default:
+		return false
+	}
+}
+
+// indexAllZones rescans every enabled zone
+func (fi *FileIndexer) indexAllZones() {
+	for _, zone := range fi.store.ListShareZones() {
+		select {
+		case <-fi.stopChan:
+			return
+		default:
+		}
+		if !zone.Enabled {
+			continue
+		}
+		fi.IndexZone(zone)
+	}
+}
+
+// IndexZone walks a zone and refreshes its index entries, removing entries for files that no longer exist
+func (fi *FileIndexer) IndexZone(zone *models.ShareZone) {
+	pool, err := fi.store.GetStoragePool(zone.PoolID)
+	if err != nil || !pool.Enabled {
+		return
+	}
+
+	fi.mu.Lock()
+	st, ok := fi.status[zone.ID]
+	if !ok {
+		st = &models.ZoneIndexStatus{ZoneID: zone.ID}
+		fi.status[zone.ID] = st
+	}
+	if st.Indexing {
+		fi.mu.Unlock()
+		return
+	}
+	st.ZoneName = zone.Name
+	st.Indexing = true
+	fi.mu.Unlock()
+
+	root := filepath.Join(pool.Path, zone.Path)
+	scanStart := time.Now().Truncate(time.Second)
+
+	err = indexTree(fi.store, zone.ID, root, root, fi.stopChan)
+	if err == nil {
+		err = fi.store.PruneFileIndex(zone.ID, "/", scanStart)
+	}
+	if err == nil && !pool.IsS3() {
+		extractTree(fi.store, zone.ID, root, root, fi.stopChan)
+		err = fi.store.PruneFileContents(zone.ID)
+		if err == nil {
+			err = fi.store.PruneImageMetadata(zone.ID)
+		}
+	}
+
+	fi.mu.Lock()
+	st.Indexing = false
+	if err != nil {
+		st.LastError = err.Error()
+		log.Printf("File indexer: failed to index zone %s: %v", zone.Name, err)
+	} else {
+		now := time.Now()
+		st.LastIndexed = &now
+		st.LastError = ""
+	}
+	fi.mu.Unlock()
+}
+
+// GetStatus returns the index status of every zone
+func (fi *FileIndexer) GetStatus() []models.ZoneIndexStatus {
+	zones := fi.store.ListShareZones()
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	statuses := make([]models.ZoneIndexStatus, 0, len(zones))
+	for _, zone := range zones {
+		st := models.ZoneIndexStatus{ZoneID: zone.ID}
+		if s, ok := fi.status[zone.ID]; ok {
+			st = *s
+		}
+		st.ZoneName = zone.Name
+		st.Entries = fi.store.CountFileIndexEntries(zone.ID)
+		if fi.store.GetZoneContentIndexing(zone.ID).Enabled {
+			st.Content = fi.store.GetContentIndexStats(zone.ID)
+			st.Content.Enabled = true
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// indexTree walks dir and upserts every entry beneath it (dir itself is included unless it is the zone root)
+func indexTree(store storage.DataStore, zoneID, root, dir string, stop <-chan struct{}) error {
+	now := time.Now()
+	batch := make([]*models.FileIndexEntry, 0, indexBatchSize)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Skip inaccessible files/directories
+			return nil
+		}
+		if stop != nil {
+			select {
+			case <-stop:
+				return filepath.SkipAll
+			default:
+			}
+		}
+		if path == root {
+			return nil
+		}
+		if info.IsDir() && isReservedZonePath(root, path) {
+			return filepath.SkipDir
+		}
+
+		batch = append(batch, newFileIndexEntry(zoneID, root, path, info, now))
+		if len(batch) >= indexBatchSize {
+			if err := store.UpsertFileIndexEntries(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return store.UpsertFileIndexEntries(batch)
+}
+
+// extractTree refreshes the document text and image details of every file beneath dir
+func extractTree(store storage.DataStore, zoneID, root, dir string, stop <-chan struct{}) {
+	content := store.GetZoneContentIndexing(zoneID)
+
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if stop != nil {
+			select {
+			case <-stop:
+				return filepath.SkipAll
+			default:
+			}
+		}
+		if info.IsDir() {
+			if path != root && isReservedZonePath(root, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if content.Enabled {
+			indexFileContent(store, content, root, path, info)
+		}
+		updateImageMetadata(store, zoneID, root, path, info)
+		return nil
+	})
+}
+
+// newFileIndexEntry builds an index entry for a file located under a zone root
+func newFileIndexEntry(zoneID, root, path string, info os.FileInfo, now time.Time) *models.FileIndexEntry {
+	rel, _ := filepath.Rel(root, path)
+	entry := &models.FileIndexEntry{
+		ZoneID:    zoneID,
+		Path:      "/" + filepath.ToSlash(rel),
+		Name:      info.Name(),
+		Size:      info.Size(),
+		IsDir:     info.IsDir(),
+		ModTime:   info.ModTime(),
+		IndexedAt: now,
+	}
+	if !info.IsDir() {
+		entry.Extension = strings.ToLower(strings.TrimPrefix(filepath.Ext(info.Name()), "."))
+	} else {
+		entry.Size = 0
+	}
+	return entry
+}
+
+// zoneForPath finds the zone whose root contains the given absolute path (longest match wins)
+func zoneForPath(store storage.DataStore, fullPath string) (*models.ShareZone, string) {
+	pools := make(map[string]*models.StoragePool)
+	for _, pool := range store.ListStoragePools() {
+		pools[pool.ID] = pool
+	}
+
+	var match *models.ShareZone
+	var matchRoot string
+	for _, zone := range store.ListShareZones() {
+		pool, ok := pools[zone.PoolID]
+		if !ok {
+			continue
+		}
+		root := filepath.Join(pool.Path, zone.Path)
+		if fullPath != root && !strings.HasPrefix(fullPath, root+string(filepath.Separator)) {
+			continue
+		}
+		if len(root) > len(matchRoot) {
+			match = zone
+			matchRoot = root
+		}
+	}
+	return match, matchRoot
+}
+
+// indexPath updates the search index, directory usage and file checksum after a file or folder was created or changed on disk
+func indexPath(store storage.DataStore, fullPath string) {
+	zone, root := zoneForPath(store, fullPath)
+	if zone == nil || fullPath == root {
+		return
+	}
+
+	refreshUsage(store, zone, root, fullPath)
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	entries := []*models.FileIndexEntry{newFileIndexEntry(zone.ID, root, fullPath, info, now)}
+
+	// Make sure any newly created parent folders are searchable too
+	for dir := filepath.Dir(fullPath); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if dirInfo, err := os.Stat(dir); err == nil {
+			entries = append(entries, newFileIndexEntry(zone.ID, root, dir, dirInfo, now))
+		}
+	}
+
+	if err := store.UpsertFileIndexEntries(entries); err != nil {
+		return
+	}
+
+	if info.IsDir() {
+		indexTree(store, zone.ID, root, fullPath, nil)
+	} else {
+		updateFileChecksum(store, zone.ID, root, fullPath, info)
+		updateFileContent(store, zone.ID, root, fullPath, info)
+		updateImageMetadata(store, zone.ID, root, fullPath, info)
+	}
+}
+
+// moveFileRecords carries the checksums, metadata, extracted text and image details of a renamed
+// file or folder over to its new path, so they survive the unindexPath of the old path
+func moveFileRecords(store storage.DataStore, oldPath, newPath string) {
+	zone, root := zoneForPath(store, oldPath)
+	if zone == nil {
+		return
+	}
+	newZone, newRoot := zoneForPath(store, newPath)
+	if newZone == nil || newZone.ID != zone.ID {
+		return
+	}
+	oldRel, newRel := usageRelPath(root, oldPath), usageRelPath(newRoot, newPath)
+	store.RenameFileChecksumPath(zone.ID, oldRel, newRel)
+	store.RenameFileMetadataPath(zone.ID, oldRel, newRel)
+	store.RenameFileContentPath(zone.ID, oldRel, newRel)
+	store.RenameImageMetadataPath(zone.ID, oldRel, newRel)
+}
+
+// unindexPath removes a deleted or moved file or folder (and its contents) from the search index,
+// directory usage, file checksums, file metadata, the content index and the photo gallery, and
+// releases the locks on it
+func unindexPath(store storage.DataStore, fullPath string) {
+	zone, root := zoneForPath(store, fullPath)
+	if zone == nil || fullPath == root {
+		return
+	}
+
+	refreshUsage(store, zone, root, fullPath)
+
+	rel, _ := filepath.Rel(root, fullPath)
+	store.DeleteFileIndexPath(zone.ID, "/"+filepath.ToSlash(rel))
+	store.DeleteFileChecksumPath(zone.ID, "/"+filepath.ToSlash(rel))
+	store.DeleteFileMetadataPath(zone.ID, "/"+filepath.ToSlash(rel))
+	store.DeleteFileContentPath(zone.ID, "/"+filepath.ToSlash(rel))
+	store.DeleteImageMetadataPath(zone.ID, "/"+filepath.ToSlash(rel))
+	store.DeleteFileLockPath(zone.ID, "/"+filepath.ToSlash(rel))
+}
+
+// SearchZoneFiles searches a zone using the file index
+func (h *ZoneFileHandler) SearchZoneFiles(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	zoneID := chi.URLParam(r, "zoneId")
+	if isSharedFolderID(zoneID) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Search is not available for shared folders", nil)
+		return
+	}
+	user := userFromContext(userCtx)
+	params := r.URL.Query()
+
+	// Resolve the zone root to enforce access checks
+	_, zone, err := h.resolveZonePath(zoneID, "/", user)
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return
+	}
+
+	q := &models.FileSearchQuery{
+		ZoneID:   zone.ID,
+		Text:     params.Get("q"),
+		Type:     params.Get("type"),
+		SortBy:   params.Get("sort_by"),
+		SortDesc: params.Get("sort_desc") == "true",
+		Limit:    100,
+	}
+
+	if q.Type != "" && q.Type != "file" && q.Type != "folder" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid type (must be file or folder)", nil)
+		return
+	}
+	if q.SortBy == "" && q.Text != "" {
+		q.SortBy = "relevance"
+	}
+
+	if ext := params.Get("ext"); ext != "" {
+		for _, e := range strings.Split(ext, ",") {
+			e = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(e), "."))
+			if e != "" {
+				q.Extensions = append(q.Extensions, e)
+			}
+		}
+	}
+
+	if v := params.Get("min_size"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid min_size", nil)
+			return
+		}
+		q.MinSize = n
+	}
+	if v := params.Get("max_size"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid max_size", nil)
+			return
+		}
+		q.MaxSize = n
+	}
+
+	if v := params.Get("modified_after"); v != "" {
+		t, err := parseSearchTime(v)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid modified_after (use RFC3339 or YYYY-MM-DD)", nil)
+			return
+		}
+		q.ModifiedAfter = &t
+	}
+	if v := params.Get("modified_before"); v != "" {
+		t, err := parseSearchTime(v)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid modified_before (use RFC3339 or YYYY-MM-DD)", nil)
+			return
+		}
+		q.ModifiedBefore = &t
+	}
+
+	if v := params.Get("tag"); v != "" {
+		tags, err := normalizeFileTags(strings.Split(v, ","))
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		q.Tags = tags
+	}
+	q.Starred = params.Get("starred") == "true"
+
+	// Zones with content indexing also match document text unless content=false
+	q.Content = params.Get("content") != "false" && h.store.GetZoneContentIndexing(zone.ID).Enabled
+
+	if v := params.Get("limit"); v != "" {
+		if l, err := strconv.Atoi(v); err == nil && l > 0 {
+			q.Limit = l
+		}
+	}
+	if q.Limit > 1000 {
+		q.Limit = 1000
+	}
+	if v := params.Get("offset"); v != "" {
+		if o, err := strconv.Atoi(v); err == nil && o >= 0 {
+			q.Offset = o
+		}
+	}
+
+	// Index paths are relative to the zone root; personal zones are scoped to the user's folder
+	userPrefix := ""
+	if zone.ZoneType == models.ZoneTypePersonal {
+		userPrefix = "/" + user.Username
+	}
+	searchPath := filepath.Clean("/" + params.Get("path"))
+	if searchPath == "/" {
+		searchPath = ""
+	}
+	q.PathPrefix = userPrefix + searchPath
+
+	entries, total, err := h.store.WithContext(r.Context()).SearchFileIndex(q)
+	if err != nil {
+		apierror.Error(w, "Search failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, e := range entries {
+		e.Path = strings.TrimPrefix(e.Path, userPrefix)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.FileSearchResult{
+		Files:   entries,
+		Total:   total,
+		Limit:   q.Limit,
+		Offset:  q.Offset,
+		HasMore: q.Offset+len(entries) < total,
+	})
+}
+
+// parseSearchTime accepts either an RFC3339 timestamp or a plain date
+func parseSearchTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, time.Local)
+}
+
+// SearchIndexHandler exposes admin controls for the file indexer
+type SearchIndexHandler struct {
+	store   storage.DataStore
+	indexer *FileIndexer
+}
+
+// NewSearchIndexHandler creates a new search index handler
+func NewSearchIndexHandler(store storage.DataStore, indexer *FileIndexer) *SearchIndexHandler {
+	return &SearchIndexHandler{store: store, indexer: indexer}
+}
+
+// GetIndexStatus returns the index status of every zone
+func (h *SearchIndexHandler) GetIndexStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.indexer.GetStatus())
+}
+
+// Reindex queues a rescan of one zone (zone_id) or all zones
+func (h *SearchIndexHandler) Reindex(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ZoneID string `json:"zone_id"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
+			return
+		}
+	}
+
+	if req.ZoneID != "" {
+		if _, err := h.store.GetShareZone(req.ZoneID); err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, "Zone not found", nil)
+			return
+		}
+	}
+
+	if !h.indexer.Reindex(req.ZoneID) {
+		apierror.Error(w, "Indexer is busy, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Reindex queued",
+	})
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/auth"
+	"fileserv/internal/events"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+const (
+	// defaultSecurityEventLimit and maxSecurityEventLimit bound a page of security events
+	defaultSecurityEventLimit = 100
+	maxSecurityEventLimit     = 1000
+
+	// maxSecurityEventExport bounds the events written by one export
+	maxSecurityEventExport = 100000
+
+	// securityEventPruneInterval limits how often events past the retention period are deleted
+	securityEventPruneInterval = time.Hour
+)
+
+// securityEventPrune remembers when old security events were last deleted
+var securityEventPrune struct {
+	sync.Mutex
+	last time.Time
+}
+
+// recordSecurityEvent stores a security event and publishes it to admins, which also routes
+// privilege escalations and power control to the notification channels
+func recordSecurityEvent(store storage.DataStore, event *models.SecurityEvent) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if err := store.AddSecurityEvent(event); err != nil {
+		log.Printf("Security events: failed to record %s event: %v", event.Type, err)
+	}
+	events.PublishToAdmins(events.TypeSecurityEvent, *event)
+
+	securityEventPrune.Lock()
+	prune := time.Since(securityEventPrune.last) >= securityEventPruneInterval
+	if prune {
+		securityEventPrune.last = time.Now()
+	}
+	securityEventPrune.Unlock()
+	if prune {
+		before := time.Now().AddDate(0, 0, -models.SecurityEventRetentionDays)
+		if err := store.DeleteSecurityEventsBefore(before); err != nil {
+			log.Printf("Security events: failed to delete old events: %v", err)
+		}
+	}
+}
+
+// recordPrivilegeEscalation records admin rights granted to target by the user making the request
+func recordPrivilegeEscalation(store storage.DataStore, r *http.Request, target, message string) {
+	actor := ""
+	if userCtx := middleware.GetUserContext(r); userCtx != nil {
+		actor = userCtx.Username
+	}
+	log.Printf("Security: %s (by %s)", message, actor)
+	recordSecurityEvent(store, &models.SecurityEvent{
+		Type:    models.SecurityEventPrivilegeEscalation,
+		Source:  "admin",
+		Actor:   actor,
+		Target:  target,
+		IP:      getClientIP(r),
+		Message: message,
+	})
+}
+
+// grantedAdminGroups returns the admin groups in after that are not in before
+func grantedAdminGroups(before, after []string) []string {
+	granted := []string{}
+	for _, group := range auth.GetAdminGroups() {
+		if slices.Contains(after, group) && !slices.Contains(before, group) {
+			granted = append(granted, group)
+		}
+	}
+	return granted
+}
+
+// csvCell keeps spreadsheets from evaluating a value (such as an attempted username) as a formula
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// parseSecurityEventFilter reads the type, actor, ip, since and until query parameters.
+// Times are RFC 3339.
+func parseSecurityEventFilter(r *http.Request) (models.SecurityEventFilter, error) {
+	q := r.URL.Query()
+	filter := models.SecurityEventFilter{
+		Type:  models.SecurityEventType(q.Get("type")),
+		Actor: strings.TrimSpace(q.Get("actor")),
+		IP:    strings.TrimSpace(q.Get("ip")),
+	}
+	if filter.Type != "" && !slices.Contains(models.SecurityEventTypes, filter.Type) {
+		return filter, fmt.Errorf("invalid type: must be auth_failure, privilege_escalation or power_control")
+	}
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if s := q.Get(param.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s: use RFC 3339, e.g. 2024-01-02T15:04:05Z", param.name)
+			}
+			*param.value = t
+		}
+	}
+	return filter, nil
+}
+
+// ListSecurityEvents returns a page of the security event log, newest first (admin only)
+func ListSecurityEvents(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseSecurityEventFilter(r)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		filter.Limit = defaultSecurityEventLimit
+		if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+			filter.Limit = min(n, maxSecurityEventLimit)
+		}
+		if n, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && n > 0 {
+			filter.Offset = n
+		}
+
+		list, total := store.WithContext(r.Context()).ListSecurityEvents(filter)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"events": list,
+			"total":  total,
+			"limit":  filter.Limit,
+			"offset": filter.Offset,
+		})
+	}
+}
+
+// ExportSecurityEvents downloads the matching security events as CSV, or as JSON with
+// format=json (admin only)
+func ExportSecurityEvents(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseSecurityEventFilter(r)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		if format != "csv" && format != "json" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid format: must be csv or json", nil)
+			return
+		}
+
+		filter.Limit = maxSecurityEventExport
+		list, _ := store.WithContext(r.Context()).ListSecurityEvents(filter)
+		filename := fmt.Sprintf("security-events-%s.%s", time.Now().Format("20060102-150405"), format)
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "time", "type", "source", "actor", "target", "ip", "message"})
+		for _, event := range list {
+			cw.Write([]string{
+				strconv.FormatInt(event.ID, 10),
+				event.CreatedAt.UTC().Format(time.RFC3339),
+				string(event.Type),
+				event.Source,
+				csvCell(event.Actor),
+				csvCell(event.Target),
+				event.IP,
+				csvCell(event.Message),
+			})
+		}
+		cw.Flush()
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// maxHSTSMaxAge is two years, the longest max-age browsers' preload lists ask for
+const maxHSTSMaxAge = 2 * 365 * 24 * 60 * 60
+
+// validReferrerPolicies are the values of the Referrer-Policy header
+var validReferrerPolicies = map[string]bool{
+	"":                                true,
+	"no-referrer":                     true,
+	"no-referrer-when-downgrade":      true,
+	"origin":                          true,
+	"origin-when-cross-origin":        true,
+	"same-origin":                     true,
+	"strict-origin":                   true,
+	"strict-origin-when-cross-origin": true,
+	"unsafe-url":                      true,
+}
+
+// GetSecurityHeaderSettingsFromStore returns the security header settings, with defaults for
+// settings that were never saved
+func GetSecurityHeaderSettingsFromStore(store storage.DataStore) models.SecurityHeaderSettings {
+	settings := models.SecurityHeaderSettings{
+		ContentSecurityPolicy: models.DefaultContentSecurityPolicy,
+		ReferrerPolicy:        models.DefaultReferrerPolicy,
+		FrameOptions:          models.DefaultFrameOptions,
+	}
+	// Saved empty strings turn a header off, so only missing settings fall back to the default
+	if setting, err := store.GetSetting(models.SettingContentSecurityPolicy); err == nil && setting != nil {
+		settings.ContentSecurityPolicy = setting.Value
+	}
+	if setting, err := store.GetSetting(models.SettingReferrerPolicy); err == nil && setting != nil {
+		settings.ReferrerPolicy = setting.Value
+	}
+	if setting, err := store.GetSetting(models.SettingFrameOptions); err == nil && setting != nil {
+		settings.FrameOptions = setting.Value
+	}
+	if setting, err := store.GetSetting(models.SettingHSTSMaxAge); err == nil && setting != nil {
+		if n, err := strconv.Atoi(setting.Value); err == nil && n >= 0 {
+			settings.HSTSMaxAge = n
+		}
+	}
+	if setting, err := store.GetSetting(models.SettingHSTSSubdomains); err == nil && setting != nil {
+		settings.HSTSIncludeSubdomains = setting.Value == "true"
+	}
+	if setting, err := store.GetSetting(models.SettingCookieSessions); err == nil && setting != nil {
+		settings.CookieSessions = setting.Value == "true"
+	}
+	return settings
+}
+
+// SecurityHeaderPolicy caches the security header settings for the header middleware, which
+// runs on every request (implements middleware.HeaderPolicy)
+type SecurityHeaderPolicy struct {
+	store storage.DataStore
+
+	mu       sync.RWMutex
+	settings models.SecurityHeaderSettings
+}
+
+// NewSecurityHeaderPolicy creates a new security header policy and loads the settings
+func NewSecurityHeaderPolicy(store storage.DataStore) *SecurityHeaderPolicy {
+	return &SecurityHeaderPolicy{
+		store:    store,
+		settings: GetSecurityHeaderSettingsFromStore(store),
+	}
+}
+
+// SecurityHeaderSettings returns the cached settings
+func (p *SecurityHeaderPolicy) SecurityHeaderSettings() models.SecurityHeaderSettings {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.settings
+}
+
+// Reload reads the settings again after they were saved
+func (p *SecurityHeaderPolicy) Reload() {
+	settings := GetSecurityHeaderSettingsFromStore(p.store)
+	p.mu.Lock()
+	p.settings = settings
+	p.mu.Unlock()
+}
+
+// GetSecurityHeaders returns the security header settings (admin only)
+func (p *SecurityHeaderPolicy) GetSecurityHeaders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.SecurityHeaderSettings())
+}
+
+// UpdateSecurityHeaders saves the security header settings (admin only)
+func (p *SecurityHeaderPolicy) UpdateSecurityHeaders(w http.ResponseWriter, r *http.Request) {
+	req := GetSecurityHeaderSettingsFromStore(p.store)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	req.ContentSecurityPolicy = strings.TrimSpace(req.ContentSecurityPolicy)
+	req.ReferrerPolicy = strings.ToLower(strings.TrimSpace(req.ReferrerPolicy))
+	req.FrameOptions = strings.ToUpper(strings.TrimSpace(req.FrameOptions))
+
+	if strings.ContainsAny(req.ContentSecurityPolicy, "\r\n") {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "content_security_policy must be a single line", nil)
+		return
+	}
+	if !validReferrerPolicies[req.ReferrerPolicy] {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid referrer_policy", nil)
+		return
+	}
+	if req.FrameOptions != "" && req.FrameOptions != "DENY" && req.FrameOptions != "SAMEORIGIN" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "frame_options must be DENY, SAMEORIGIN or empty", nil)
+		return
+	}
+	if req.HSTSMaxAge < 0 || req.HSTSMaxAge > maxHSTSMaxAge {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "hsts_max_age must be between 0 and "+strconv.Itoa(maxHSTSMaxAge)+" seconds", nil)
+		return
+	}
+
+	category := string(models.CategorySecurity)
+	p.store.SetSetting(models.SettingContentSecurityPolicy, req.ContentSecurityPolicy, "string", category)
+	p.store.SetSetting(models.SettingReferrerPolicy, req.ReferrerPolicy, "string", category)
+	p.store.SetSetting(models.SettingFrameOptions, req.FrameOptions, "string", category)
+	p.store.SetSetting(models.SettingHSTSMaxAge, strconv.Itoa(req.HSTSMaxAge), "int", category)
+	p.store.SetSetting(models.SettingHSTSSubdomains, strconv.FormatBool(req.HSTSIncludeSubdomains), "bool", category)
+	p.store.SetSetting(models.SettingCookieSessions, strconv.FormatBool(req.CookieSessions), "bool", category)
+	p.Reload()
+
+	p.GetSecurityHeaders(w, r)
+}
+
+// setSessionCookies stores a session token in an HttpOnly cookie, along with the CSRF token
+// scripts must echo on state-changing requests, when cookie sessions are enabled
+func setSessionCookies(w http.ResponseWriter, r *http.Request, store storage.DataStore, token string, expiresAt time.Time) {
+	if !GetSecurityHeaderSettingsFromStore(store).CookieSessions {
+		return
+	}
+
+	csrf := make([]byte, 32)
+	rand.Read(csrf)
+	secure := middleware.IsHTTPS(r)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.CSRFCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(csrf),
+		Path:     "/",
+		Expires:  expiresAt,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearSessionCookies removes the session and CSRF cookies on logout
+func clearSessionCookies(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{middleware.SessionCookieName, middleware.CSRFCookieName} {
+		if _, err := r.Cookie(name); err != nil {
+			continue
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:    name,
+			Value:   "",
+			Path:    "/",
+			Expires: time.Unix(0, 0),
+			MaxAge:  -1,
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// journalCursorRegex matches journal cursors such as s=...;i=...;b=...;m=...;t=...;x=...
+var journalCursorRegex = regexp.MustCompile(`^[a-z]=[0-9a-f]+(;[a-z]=[0-9a-f]+)*$`)
+
+// serviceLogEvent is a journal entry sent on a followed log stream. Type is output, or error for
+// entries of priority err and above, as for the terminal output of installs.
+type serviceLogEvent struct {
+	Type string `json:"type"`
+	journalEntry
+}
+
+// GetServiceLogs returns the journal of a systemd service. With follow=true the entries are
+// streamed as server-sent events as they are written, until the client disconnects.
+func GetServiceLogs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(chi.URLParam(r, "name"), ".service")
+		lines := r.URL.Query().Get("lines")
+		priority := r.URL.Query().Get("priority")
+
+		if err := validateServiceName(name); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateJournalLines(lines); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := validateJournalPriority(priority); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		if lines == "" {
+			lines = "100"
+		}
+
+		args := []string{"--no-pager", "-u", name + ".service", "-o", "json"}
+		if priority != "" {
+			args = append(args, "-p", priority)
+		}
+
+		if r.URL.Query().Get("follow") == "true" {
+			followJournal(w, r, args, lines)
+			return
+		}
+
+		output, err := execCommand("journalctl", append(args, "-n", lines)...)
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		entries := []journalEntry{}
+		scanner := bufio.NewScanner(strings.NewReader(output))
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if entry, ok := parseJournalEntry(scanner.Bytes()); ok {
+				entries = append(entries, entry)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// followJournal streams journalctl -f as server-sent events. Each event carries the journal
+// cursor as its id, so a client that reconnects with Last-Event-ID resumes after the last entry
+// it received instead of getting the last lines again.
+func followJournal(w http.ResponseWriter, r *http.Request, args []string, lines string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if cursor := r.Header.Get("Last-Event-ID"); journalCursorRegex.MatchString(cursor) {
+		args = append(args, "--after-cursor", cursor)
+	} else {
+		args = append(args, "-n", lines)
+	}
+	args = append(args, "-f")
+
+	// journalctl is stopped when the client disconnects or the stream fails
+	ctx, cancel := context.WithCancel(r.Context())
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		apierror.Error(w, fmt.Sprintf("Failed to run journalctl: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer cancel()
+
+	// The reader reaps journalctl once its output ends, so stderr is complete when entries closes
+	entries := make(chan journalEntry)
+	go func() {
+		defer close(entries)
+		defer cmd.Wait()
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			entry, ok := parseJournalEntry(scanner.Bytes())
+			if !ok {
+				continue
+			}
+			select {
+			case entries <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// The stream outlives the server write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case entry, ok := <-entries:
+			if !ok {
+				// journalctl only exits on its own when it fails
+				message := strings.TrimSpace(stderr.String())
+				if message == "" {
+					message = "journalctl exited"
+				}
+				sendSSE(w, StreamEvent{Type: "complete", Message: message})
+				return
+			}
+			event := serviceLogEvent{Type: "output", journalEntry: entry}
+			if entry.Priority <= 3 {
+				event.Type = "error"
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: log\ndata: %s\n\n", entry.Cursor, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -9,6 +9,11 @@ import (
 	"os/exec"
 	"regexp"
 	"strings"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
 )
 
 // SharingServiceStatus represents the status of a sharing protocol service
@@ -269,13 +274,13 @@ func InstallSharingService() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		pm := detectPackageManager()
 		if pm == "" {
-			http.Error(w, "No supported package manager found", http.StatusInternalServerError)
+			apierror.Error(w, "No supported package manager found", http.StatusInternalServerError)
 			return
 		}
 
@@ -290,7 +295,7 @@ func InstallSharingService() http.HandlerFunc {
 				packages = []string{"nfs-utils"}
 			}
 		default:
-			http.Error(w, "Invalid service type. Use 'smb' or 'nfs'", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid service type. Use 'smb' or 'nfs'", nil)
 			return
 		}
 
@@ -312,7 +317,7 @@ func InstallSharingService() http.HandlerFunc {
 		cmd := exec.Command("sudo", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to install package: %s\n%s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to install package: %s\n%s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -323,8 +328,9 @@ func InstallSharingService() http.HandlerFunc {
 	}
 }
 
-// ControlSharingService starts/stops/enables a sharing service
-func ControlSharingService() http.HandlerFunc {
+// ControlSharingService starts/stops/enables a sharing service and opens or closes its firewall
+// ports along with it
+func ControlSharingService(store storage.DataStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
 			Service string `json:"service"` // smb or nfs
@@ -332,7 +338,7 @@ func ControlSharingService() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
@@ -345,7 +351,7 @@ func ControlSharingService() http.HandlerFunc {
 			"disable": true,
 		}
 		if !validActions[req.Action] {
-			http.Error(w, "Invalid action", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid action", nil)
 			return
 		}
 
@@ -362,7 +368,7 @@ func ControlSharingService() http.HandlerFunc {
 		case "nfs":
 			services = []string{"nfs-server"}
 		default:
-			http.Error(w, "Invalid service type", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid service type", nil)
 			return
 		}
 
@@ -371,7 +377,7 @@ func ControlSharingService() http.HandlerFunc {
 			cmd := exec.Command("sudo", "systemctl", req.Action, svc)
 			output, err := cmd.CombinedOutput()
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Failed to %s %s: %s", req.Action, svc, string(output)), http.StatusInternalServerError)
+				apierror.Error(w, fmt.Sprintf("Failed to %s %s: %s", req.Action, svc, string(output)), http.StatusInternalServerError)
 				return
 			}
 		}
@@ -382,6 +388,7 @@ func ControlSharingService() http.HandlerFunc {
 				exec.Command("sudo", "systemctl", "start", svc).Run()
 			}
 		}
+		syncFirewallAfterChange(store, cfg)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
@@ -401,10 +408,10 @@ func GetSMBConfig() http.HandlerFunc {
 		content, err := os.ReadFile("/etc/samba/smb.conf")
 		if err != nil {
 			if os.IsNotExist(err) {
-				http.Error(w, "SMB not configured", http.StatusNotFound)
+				apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "SMB not configured", nil)
 				return
 			}
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -415,26 +422,58 @@ func GetSMBConfig() http.HandlerFunc {
 	}
 }
 
-// GetNFSExports returns the current NFS exports
-func GetNFSExports() http.HandlerFunc {
+// PreviewSMBConfig returns the share sections that would be generated from the zones, without applying them
+func PreviewSMBConfig(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pools := make(map[string]*models.StoragePool)
+		for _, pool := range store.ListStoragePools() {
+			pools[pool.ID] = pool
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"path":   fileservSharesFile,
+			"config": RenderSMBConfig(store.ListShareZones(), pools),
+		})
+	}
+}
+
+// RegenerateSMBConfig rewrites the Samba shares from the zones, validates them with testparm and reloads smbd
+func RegenerateSMBConfig(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := SyncSMBConfig(store); err != nil {
+			apierror.Error(w, "Failed to apply SMB configuration: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "SMB configuration applied",
+			"path":    fileservSharesFile,
+		})
+	}
+}
+
+// GetNFSExports returns the current NFS exports, both as the raw /etc/exports content
+// and as parsed entries including the exports generated from zones
+func GetNFSExports(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		content, err := os.ReadFile("/etc/exports")
+		if err != nil && !os.IsNotExist(err) {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		entries, err := listNFSExports(store)
 		if err != nil {
-			if os.IsNotExist(err) {
-				// Return empty exports
-				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(map[string]string{
-					"exports": "",
-				})
-				return
-			}
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
+		json.NewEncoder(w).Encode(map[string]interface{}{
 			"exports": string(content),
+			"entries": entries,
 		})
 	}
 }
@@ -888,25 +927,25 @@ func SetSambaPassword() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Username == "" || req.Password == "" {
-			http.Error(w, "Username and password are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username and password are required", nil)
 			return
 		}
 
 		// Check if smbpasswd is available
 		smbpasswdPath, err := exec.LookPath("smbpasswd")
 		if err != nil || smbpasswdPath == "" {
-			http.Error(w, "smbpasswd command not available (Samba not installed)", http.StatusServiceUnavailable)
+			apierror.Error(w, "smbpasswd command not available (Samba not installed)", http.StatusServiceUnavailable)
 			return
 		}
 
 		// Use the helper from sharing_config.go
 		if err := SetSambaUserPassword(req.Username, req.Password); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to set Samba password: %v", err), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to set Samba password: %v", err), http.StatusInternalServerError)
 			return
 		}
 
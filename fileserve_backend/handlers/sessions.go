@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// sessionTouchInterval limits how often the last-seen time of a session is written
+const sessionTouchInterval = time.Minute
+
+// SessionHandler lists and revokes signed-in sessions, and keeps the denylist of revoked
+// sessions in memory so the auth middleware can reject their tokens without a query
+type SessionHandler struct {
+	store storage.DataStore
+
+	mu      sync.Mutex
+	revoked map[string]time.Time // Revoked session ID -> expiry of its token
+	touched map[string]time.Time // Session ID -> last time its last-seen time was written
+}
+
+// NewSessionHandler creates a new session handler and loads the denylist
+func NewSessionHandler(store storage.DataStore) *SessionHandler {
+	return &SessionHandler{
+		store:   store,
+		revoked: store.ListRevokedSessions(),
+		touched: make(map[string]time.Time),
+	}
+}
+
+// sessionResponse marks the session making the request
+type sessionResponse struct {
+	*models.Session
+	Current bool `json:"current"`
+}
+
+// describeDevice returns a short browser and OS description of a user agent
+func describeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	browser := ""
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		browser = "curl"
+	}
+
+	os := ""
+	switch {
+	case strings.Contains(ua, "android"):
+		os = "Android"
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		os = "iOS"
+	case strings.Contains(ua, "windows"):
+		os = "Windows"
+	case strings.Contains(ua, "mac os"):
+		os = "macOS"
+	case strings.Contains(ua, "linux"):
+		os = "Linux"
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	return "Unknown device"
+}
+
+// newSession describes a new session of a user signing in with the request
+func newSession(r *http.Request, userCtx *middleware.UserContext, expiresAt time.Time) *models.Session {
+	now := time.Now()
+	return &models.Session{
+		ID:        uuid.New().String(),
+		UserID:    userCtx.UserID,
+		Username:  userCtx.Username,
+		IP:        getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Device:    describeDevice(r.UserAgent()),
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+		LastSeen:  now,
+	}
+}
+
+// startSession issues a token for a new session and stores the session
+func startSession(store storage.DataStore, r *http.Request, userCtx *middleware.UserContext, jwtSecret string) (*models.Session, error) {
+	session := newSession(r, userCtx, time.Time{})
+	expiresAt, token, err := issueSessionToken(userCtx, session.ID, jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	session.Token = token
+	session.ExpiresAt = expiresAt
+
+	if err := store.CreateSession(session); err != nil {
+		return nil, err
+	}
+
+	// Expired sessions and denylist entries are pruned as new sessions start
+	if _, err := store.CleanExpiredSessions(); err != nil {
+		log.Printf("Sessions: failed to clean expired sessions: %v", err)
+	}
+	return session, nil
+}
+
+// ValidateSession rejects revoked sessions and records when a session was last used
+// (implements middleware.SessionValidator)
+func (h *SessionHandler) ValidateSession(sessionID string, r *http.Request) error {
+	if sessionID == "" {
+		return errors.New("token is not bound to a session")
+	}
+
+	now := time.Now()
+	h.mu.Lock()
+	_, revoked := h.revoked[sessionID]
+	touch := !revoked && now.Sub(h.touched[sessionID]) >= sessionTouchInterval
+	if touch {
+		h.touched[sessionID] = now
+	}
+	h.mu.Unlock()
+
+	if revoked {
+		return errors.New("session has been revoked")
+	}
+	if touch {
+		h.store.TouchSession(sessionID, getClientIP(r), now)
+	}
+	return nil
+}
+
+// revoke signs a session out and denylists its token
+func (h *SessionHandler) revoke(session *models.Session) error {
+	if err := h.store.RevokeSession(session); err != nil {
+		return err
+	}
+	h.denylist(session)
+	recordImpersonationEnded(h.store, session)
+	return nil
+}
+
+// denylist rejects the token of a session already revoked in the store
+func (h *SessionHandler) denylist(session *models.Session) {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.revoked[session.ID] = session.ExpiresAt
+	delete(h.touched, session.ID)
+	for id, expiresAt := range h.revoked {
+		if now.After(expiresAt) {
+			delete(h.revoked, id)
+		}
+	}
+	for id, touched := range h.touched {
+		if now.Sub(touched) > 24*time.Hour {
+			delete(h.touched, id)
+		}
+	}
+}
+
+// revokeAll signs out every session of a user except keepID, returning how many were revoked
+func (h *SessionHandler) revokeAll(userID, keepID string) (int, error) {
+	revoked := 0
+	for _, session := range h.store.ListSessionsByUser(userID) {
+		if session.ID == keepID {
+			continue
+		}
+		if err := h.revoke(session); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// writeSessions responds with a user's sessions, marking the current one
+func (h *SessionHandler) writeSessions(w http.ResponseWriter, userID, currentID string) {
+	sessions := h.store.ListSessionsByUser(userID)
+	resp := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		resp[i] = sessionResponse{Session: session, Current: session.ID == currentID}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Logout signs out the current session
+func (h *SessionHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx != nil && userCtx.SessionID != "" {
+		if session, err := h.store.GetSession(userCtx.SessionID); err == nil {
+			if err := h.revoke(session); err != nil {
+				log.Printf("Sessions: failed to revoke session of %s on logout: %v", userCtx.Username, err)
+			}
+		}
+	}
+	clearSessionCookies(w, r)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
+
+// ListMySessions returns the current user's sessions
+func (h *SessionHandler) ListMySessions(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	h.writeSessions(w, userCtx.UserID, userCtx.SessionID)
+}
+
+// RevokeMySession signs out one of the current user's sessions
+func (h *SessionHandler) RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	session, err := h.store.GetSession(chi.URLParam(r, "id"))
+	if err != nil || session.UserID != userCtx.UserID {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeSessionNotFound, "Session not found", nil)
+		return
+	}
+
+	if err := h.revoke(session); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessions signs out every session of the current user except the one making the request
+func (h *SessionHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	revoked, err := h.revokeAll(userCtx.UserID, userCtx.SessionID)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"revoked": revoked})
+}
+
+// ListUserSessions returns the sessions of any user (admin only)
+func (h *SessionHandler) ListUserSessions(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	h.writeSessions(w, chi.URLParam(r, "userId"), userCtx.SessionID)
+}
+
+// RevokeUserSessions signs out every session of a user (admin only)
+func (h *SessionHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	userID := chi.URLParam(r, "userId")
+	revoked, err := h.revokeAll(userID, "")
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Sessions: admin %s revoked %d session(s) of user %s", userCtx.Username, revoked, userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"revoked": revoked})
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/storage"
+)
+
+// settingsWatchInterval is how often the settings table is checked for changes made outside
+// this server, such as by another server sharing the database or by editing it directly
+const settingsWatchInterval = 30 * time.Second
+
+// settingsReloader applies changed settings to a running component
+type settingsReloader struct {
+	name     string
+	reload   func() error
+	prefixes []string
+}
+
+// SettingsWatcher watches the settings table and reloads the components that keep settings in
+// memory when they change. Most settings, such as SMTP, notification channels and login limits,
+// are read on every use and apply without a reload.
+type SettingsWatcher struct {
+	store     storage.DataStore
+	reloaders []settingsReloader
+	snapshot  map[string]string
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	running   bool
+}
+
+// SettingsReloadResult is the outcome of reloading one component
+type SettingsReloadResult struct {
+	Component string `json:"component"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NewSettingsWatcher creates a new settings watcher
+func NewSettingsWatcher(store storage.DataStore) *SettingsWatcher {
+	return &SettingsWatcher{
+		store:    store,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Register adds a component to reload when a setting whose key starts with one of the prefixes
+// changes
+func (s *SettingsWatcher) Register(name string, reload func() error, prefixes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reloaders = append(s.reloaders, settingsReloader{name: name, reload: reload, prefixes: prefixes})
+}
+
+// Start begins the settings watcher background goroutine
+func (s *SettingsWatcher) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.stopChan = make(chan struct{})
+	s.snapshot = s.readSettings()
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.run()
+	log.Println("Settings watcher started")
+}
+
+// Stop stops the settings watcher
+func (s *SettingsWatcher) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stopChan)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	log.Println("Settings watcher stopped")
+}
+
+// run is the main watcher loop
+func (s *SettingsWatcher) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(settingsWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+// readSettings returns the value of every setting by key
+func (s *SettingsWatcher) readSettings() map[string]string {
+	values := make(map[string]string)
+	for _, setting := range s.store.GetAllSettings() {
+		values[setting.Key] = setting.Value
+	}
+	return values
+}
+
+// check reloads the components whose settings changed since the last check
+func (s *SettingsWatcher) check() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.readSettings()
+	var changed []string
+	for key, value := range current {
+		if old, ok := s.snapshot[key]; !ok || old != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range s.snapshot {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	s.snapshot = current
+	if len(changed) == 0 {
+		return
+	}
+
+	for _, r := range s.reloaders {
+		if !r.matches(changed) {
+			continue
+		}
+		if err := r.reload(); err != nil {
+			log.Printf("Warning: Failed to reload %s settings: %v", r.name, err)
+		} else {
+			log.Printf("Reloaded %s settings", r.name)
+		}
+	}
+}
+
+// matches reports whether any of the changed keys belongs to the component
+func (r settingsReloader) matches(keys []string) bool {
+	for _, key := range keys {
+		for _, prefix := range r.prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReloadSettings reloads every registered component with the current settings (admin only).
+// Servers whose settings did not change keep running, so transfers in progress are not dropped.
+func (s *SettingsWatcher) ReloadSettings(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := []SettingsReloadResult{}
+	failed := 0
+	for _, reloader := range s.reloaders {
+		result := SettingsReloadResult{Component: reloader.name}
+		if err := reloader.reload(); err != nil {
+			result.Error = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Component < results[j].Component })
+	s.snapshot = s.readSettings()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reloaded": len(results) - failed,
+		"failed":   failed,
+		"results":  results,
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"time"
 
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
 	"fileserv/models"
 	"fileserv/storage"
 )
@@ -41,13 +43,13 @@ func (h *SetupHandler) GetSetupStatus(w http.ResponseWriter, r *http.Request) {
 func (h *SetupHandler) CompleteSetup(w http.ResponseWriter, r *http.Request) {
 	// Check if setup is already complete
 	if h.store.IsSetupComplete() {
-		http.Error(w, "Setup already completed", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Setup already completed", nil)
 		return
 	}
 
 	var req models.SetupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
@@ -65,47 +67,37 @@ func (h *SetupHandler) CompleteSetup(w http.ResponseWriter, r *http.Request) {
 	// Generate secure JWT secret
 	jwtSecret, err := generateSecureSecret(32)
 	if err != nil {
-		http.Error(w, "Failed to generate JWT secret", http.StatusInternalServerError)
+		apierror.Error(w, "Failed to generate JWT secret", http.StatusInternalServerError)
 		return
 	}
 
-	// Save settings
+	// Save settings, all or none so a failed setup can be run again
 	now := time.Now().Format(time.RFC3339)
-
-	if err := h.store.SetSetting(models.SettingServerName, req.ServerName, "string", string(models.CategoryGeneral)); err != nil {
-		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
-		return
-	}
-
-	if err := h.store.SetSetting(models.SettingJWTSecret, jwtSecret, "string", string(models.CategorySecurity)); err != nil {
-		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
-		return
-	}
-
-	if err := h.store.SetSetting(models.SettingSessionExpiry, strconv.Itoa(req.SessionExpiry), "int", string(models.CategorySecurity)); err != nil {
-		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
-		return
-	}
-
-	if err := h.store.SetSetting(models.SettingUsePAM, strconv.FormatBool(req.UsePAM), "bool", string(models.CategoryAuth)); err != nil {
-		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
-		return
-	}
-
 	adminGroupsJSON, _ := json.Marshal(req.AdminGroups)
-	if err := h.store.SetSetting(models.SettingAdminGroups, string(adminGroupsJSON), "json", string(models.CategoryAuth)); err != nil {
-		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
-		return
-	}
-
-	if err := h.store.SetSetting(models.SettingCreatedAt, now, "string", string(models.CategoryGeneral)); err != nil {
-		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
-		return
-	}
-
-	// Mark setup as complete
-	if err := h.store.SetSetting(models.SettingSetupComplete, "true", "bool", string(models.CategoryGeneral)); err != nil {
-		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+	settings := []struct {
+		key, value, valueType string
+		category              models.SettingsCategory
+	}{
+		{models.SettingServerName, req.ServerName, "string", models.CategoryGeneral},
+		{models.SettingJWTSecret, jwtSecret, "string", models.CategorySecurity},
+		{models.SettingSessionExpiry, strconv.Itoa(req.SessionExpiry), "int", models.CategorySecurity},
+		{models.SettingUsePAM, strconv.FormatBool(req.UsePAM), "bool", models.CategoryAuth},
+		{models.SettingAdminGroups, string(adminGroupsJSON), "json", models.CategoryAuth},
+		{models.SettingCreatedAt, now, "string", models.CategoryGeneral},
+		// Mark setup as complete
+		{models.SettingSetupComplete, "true", "bool", models.CategoryGeneral},
+	}
+
+	err = h.store.WithTx(func(tx storage.DataStore) error {
+		for _, setting := range settings {
+			if err := tx.SetSetting(setting.key, setting.value, setting.valueType, string(setting.category)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		apierror.Error(w, "Failed to save settings", http.StatusInternalServerError)
 		return
 	}
 
@@ -116,6 +108,15 @@ func (h *SetupHandler) CompleteSetup(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// publishSettingsChanged records which settings an admin changed; values are left out as some are secret
+func publishSettingsChanged(r *http.Request, keys []string) {
+	publishAction(r, &events.Event{
+		Type:      events.TypeSettingsChanged,
+		AdminOnly: true,
+		Data:      map[string]interface{}{"keys": keys},
+	})
+}
+
 // generateSecureSecret generates a cryptographically secure random string
 func generateSecureSecret(length int) (string, error) {
 	bytes := make([]byte, length)
@@ -141,8 +142,8 @@ func (h *SettingsHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
 	// Filter out sensitive settings
 	filtered := make([]models.Setting, 0, len(settings))
 	for _, s := range settings {
-		if s.Key == models.SettingJWTSecret {
-			// Don't expose JWT secret, just show it exists
+		if s.Key == models.SettingJWTSecret || s.Key == models.SettingShareCaptchaSecret {
+			// Don't expose secrets, just show they exist
 			s.Value = "********"
 		}
 		filtered = append(filtered, s)
@@ -156,7 +157,7 @@ func (h *SettingsHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
 func (h *SettingsHandler) GetSettingsByCategory(w http.ResponseWriter, r *http.Request) {
 	category := r.URL.Query().Get("category")
 	if category == "" {
-		http.Error(w, "Category required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Category required", nil)
 		return
 	}
 
@@ -164,7 +165,7 @@ func (h *SettingsHandler) GetSettingsByCategory(w http.ResponseWriter, r *http.R
 
 	// Filter sensitive
 	for i, s := range settings {
-		if s.Key == models.SettingJWTSecret {
+		if s.Key == models.SettingJWTSecret || s.Key == models.SettingShareCaptchaSecret {
 			settings[i].Value = "********"
 		}
 	}
@@ -183,7 +184,7 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
@@ -191,7 +192,7 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request)
 	protectedKeys := []string{models.SettingSetupComplete, models.SettingCreatedAt}
 	for _, k := range protectedKeys {
 		if req.Key == k {
-			http.Error(w, "Cannot modify protected setting", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Cannot modify protected setting", nil)
 			return
 		}
 	}
@@ -200,16 +201,17 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request)
 	if req.Key == models.SettingJWTSecret {
 		newSecret, err := generateSecureSecret(32)
 		if err != nil {
-			http.Error(w, "Failed to generate new secret", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to generate new secret", http.StatusInternalServerError)
 			return
 		}
 		req.Value = newSecret
 	}
 
 	if err := h.store.SetSetting(req.Key, req.Value, req.Type, req.Category); err != nil {
-		http.Error(w, "Failed to update setting", http.StatusInternalServerError)
+		apierror.Error(w, "Failed to update setting", http.StatusInternalServerError)
 		return
 	}
+	publishSettingsChanged(r, []string{req.Key})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -221,33 +223,79 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request)
 // UpdateSettings updates multiple settings at once
 func (h *SettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		ServerName    string   `json:"server_name"`
-		AdminGroups   []string `json:"admin_groups"`
-		UsePAM        bool     `json:"use_pam"`
-		SessionExpiry int      `json:"session_expiry_hours"`
+		ServerName     string   `json:"server_name"`
+		AdminGroups    []string `json:"admin_groups"`
+		UsePAM         bool     `json:"use_pam"`
+		SessionExpiry  int      `json:"session_expiry_hours"`
+		TrashRetention *int     `json:"trash_retention_days"` // 0 = keep forever
+
+		// Brute-force protection
+		LockoutMaxAttempts *int `json:"lockout_max_attempts"`
+		LockoutWindow      *int `json:"lockout_window_minutes"`
+		LockoutBase        *int `json:"lockout_base_minutes"`
+		LockoutMax         *int `json:"lockout_max_minutes"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	if req.TrashRetention != nil && *req.TrashRetention < 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Trash retention cannot be negative", nil)
 		return
 	}
 
+	lockoutSettings := []struct {
+		key   string
+		value *int
+	}{
+		{models.SettingLockoutMaxAttempts, req.LockoutMaxAttempts},
+		{models.SettingLockoutWindow, req.LockoutWindow},
+		{models.SettingLockoutBase, req.LockoutBase},
+		{models.SettingLockoutMax, req.LockoutMax},
+	}
+	for _, s := range lockoutSettings {
+		if s.value != nil && *s.value <= 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, s.key+" must be positive", nil)
+			return
+		}
+	}
+
 	// Update each setting
+	changed := []string{}
+	set := func(key, value, valueType, category string) {
+		h.store.SetSetting(key, value, valueType, category)
+		changed = append(changed, key)
+	}
+
 	if req.ServerName != "" {
-		h.store.SetSetting(models.SettingServerName, req.ServerName, "string", string(models.CategoryGeneral))
+		set(models.SettingServerName, req.ServerName, "string", string(models.CategoryGeneral))
 	}
 
 	if len(req.AdminGroups) > 0 {
 		adminGroupsJSON, _ := json.Marshal(req.AdminGroups)
-		h.store.SetSetting(models.SettingAdminGroups, string(adminGroupsJSON), "json", string(models.CategoryAuth))
+		set(models.SettingAdminGroups, string(adminGroupsJSON), "json", string(models.CategoryAuth))
 	}
 
-	h.store.SetSetting(models.SettingUsePAM, strconv.FormatBool(req.UsePAM), "bool", string(models.CategoryAuth))
+	set(models.SettingUsePAM, strconv.FormatBool(req.UsePAM), "bool", string(models.CategoryAuth))
 
 	if req.SessionExpiry > 0 {
-		h.store.SetSetting(models.SettingSessionExpiry, strconv.Itoa(req.SessionExpiry), "int", string(models.CategorySecurity))
+		set(models.SettingSessionExpiry, strconv.Itoa(req.SessionExpiry), "int", string(models.CategorySecurity))
 	}
 
+	if req.TrashRetention != nil {
+		set(models.SettingTrashRetention, strconv.Itoa(*req.TrashRetention), "int", string(models.CategoryStorage))
+	}
+
+	for _, s := range lockoutSettings {
+		if s.value != nil {
+			set(s.key, strconv.Itoa(*s.value), "int", string(models.CategorySecurity))
+		}
+	}
+
+	publishSettingsChanged(r, changed)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -259,12 +307,12 @@ func (h *SettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request)
 func (h *SettingsHandler) RegenerateJWTSecret(w http.ResponseWriter, r *http.Request) {
 	newSecret, err := generateSecureSecret(32)
 	if err != nil {
-		http.Error(w, "Failed to generate new secret", http.StatusInternalServerError)
+		apierror.Error(w, "Failed to generate new secret", http.StatusInternalServerError)
 		return
 	}
 
 	if err := h.store.SetSetting(models.SettingJWTSecret, newSecret, "string", string(models.CategorySecurity)); err != nil {
-		http.Error(w, "Failed to save new secret", http.StatusInternalServerError)
+		apierror.Error(w, "Failed to save new secret", http.StatusInternalServerError)
 		return
 	}
 
@@ -307,3 +355,16 @@ func GetUsePAMFromStore(store storage.DataStore) bool {
 	}
 	return setting.Value == "true"
 }
+
+// GetTrashRetentionDaysFromStore returns how many days trashed items are kept (0 = forever)
+func GetTrashRetentionDaysFromStore(store storage.DataStore) int {
+	setting, err := store.GetSetting(models.SettingTrashRetention)
+	if err != nil || setting == nil {
+		return models.DefaultTrashRetentionDays
+	}
+	days, err := strconv.Atoi(setting.Value)
+	if err != nil {
+		return models.DefaultTrashRetentionDays
+	}
+	return days
+}
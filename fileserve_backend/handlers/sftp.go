@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/internal/sftpd"
+	"fileserv/internal/vfs"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// sftpHostKeyFile is the host key file name inside the data directory
+const sftpHostKeyFile = "sftp_host_ed25519_key"
+
+// SFTPService runs the embedded SFTP server. Users log in with the same credentials as the
+// web interface and see each zone they can access as a top-level folder.
+type SFTPService struct {
+	store storage.DataStore
+	cfg   *config.Config
+
+	mu          sync.Mutex
+	server      *sftpd.Server
+	applied     models.SFTPSettings // Settings of the last start
+	port        int
+	fingerprint string
+	lastError   string
+}
+
+// NewSFTPService creates a new SFTP service
+func NewSFTPService(store storage.DataStore, cfg *config.Config) *SFTPService {
+	return &SFTPService{store: store, cfg: cfg}
+}
+
+// GetSFTPSettingsFromStore returns the SFTP server settings
+func GetSFTPSettingsFromStore(store storage.DataStore) models.SFTPSettings {
+	settings := models.SFTPSettings{Port: models.DefaultSFTPPort}
+	if setting, err := store.GetSetting(models.SettingSFTPEnabled); err == nil && setting != nil {
+		settings.Enabled = setting.Value == "true"
+	}
+	if setting, err := store.GetSetting(models.SettingSFTPPort); err == nil && setting != nil {
+		if port, err := strconv.Atoi(setting.Value); err == nil && port > 0 {
+			settings.Port = port
+		}
+	}
+	return settings
+}
+
+// Start starts the SFTP server if it is enabled in the settings
+func (s *SFTPService) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start()
+}
+
+// Stop stops the SFTP server and disconnects all clients
+func (s *SFTPService) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+}
+
+// Reload restarts the SFTP server with the current settings
+func (s *SFTPService) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restart()
+}
+
+// ReloadIfChanged restarts the SFTP server only when its settings differ from those it was
+// started with, so connected clients are not dropped for nothing
+func (s *SFTPService) ReloadIfChanged() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if GetSFTPSettingsFromStore(s.store) != s.applied {
+		return s.restart()
+	}
+	if s.lastError != "" {
+		return errors.New(s.lastError)
+	}
+	return nil
+}
+
+func (s *SFTPService) restart() error {
+	s.stop()
+	s.start()
+	if s.lastError != "" {
+		return errors.New(s.lastError)
+	}
+	return nil
+}
+
+func (s *SFTPService) start() {
+	s.lastError = ""
+	settings := GetSFTPSettingsFromStore(s.store)
+	s.applied = settings
+	if !settings.Enabled {
+		return
+	}
+
+	hostKey, err := sftpd.LoadOrCreateHostKey(filepath.Join(s.cfg.DataDir, sftpHostKeyFile))
+	if err != nil {
+		s.lastError = fmt.Sprintf("failed to load host key: %v", err)
+		log.Printf("SFTP: %s", s.lastError)
+		return
+	}
+
+	server := sftpd.NewServer(hostKey, s.authenticate)
+	if err := server.Listen(fmt.Sprintf(":%d", settings.Port)); err != nil {
+		s.lastError = fmt.Sprintf("failed to listen on port %d: %v", settings.Port, err)
+		log.Printf("SFTP: %s", s.lastError)
+		return
+	}
+
+	s.server = server
+	s.port = settings.Port
+	s.fingerprint = sftpd.Fingerprint(hostKey)
+	log.Printf("SFTP server listening on port %d (host key %s)", s.port, s.fingerprint)
+}
+
+func (s *SFTPService) stop() {
+	if s.server == nil {
+		return
+	}
+	s.server.Close()
+	s.server = nil
+	log.Println("SFTP server stopped")
+}
+
+// authenticate checks a password login with the same brute-force protection as the web login
+func (s *SFTPService) authenticate(username, password, remoteIP string) (vfs.FileSystem, error) {
+	userCtx, err := authenticateProtocolLogin(s.store, s.cfg, "SFTP", username, password, remoteIP)
+	if err != nil {
+		return nil, err
+	}
+	return newZoneFS(s.store, userCtx), nil
+}
+
+// GetSettings returns the SFTP settings and server status (admin only)
+func (s *SFTPService) GetSettings(w http.ResponseWriter, r *http.Request) {
+	settings := GetSFTPSettingsFromStore(s.store)
+
+	s.mu.Lock()
+	status := map[string]interface{}{
+		"enabled":          settings.Enabled,
+		"port":             settings.Port,
+		"running":          s.server != nil,
+		"host_fingerprint": s.fingerprint,
+		"error":            s.lastError,
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// UpdateSettings saves the SFTP settings and restarts the server (admin only)
+func (s *SFTPService) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	var req models.SFTPSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	if req.Port == 0 {
+		req.Port = models.DefaultSFTPPort
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Port must be between 1 and 65535", nil)
+		return
+	}
+	if req.Port == s.cfg.Port {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Port is already used by the web server", nil)
+		return
+	}
+
+	s.store.SetSetting(models.SettingSFTPEnabled, strconv.FormatBool(req.Enabled), "bool", string(models.CategoryAccess))
+	s.store.SetSetting(models.SettingSFTPPort, strconv.Itoa(req.Port), "int", string(models.CategoryAccess))
+
+	err := s.Reload()
+	syncFirewallAfterChange(s.store, s.cfg)
+	if err != nil {
+		apierror.Error(w, "Settings saved but the SFTP server failed to start: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.GetSettings(w, r)
+}
+
+// authenticateProtocolLogin verifies credentials for a file transfer protocol login,
+// sharing the lockout counters of the web login
+func authenticateProtocolLogin(store storage.DataStore, cfg *config.Config, protocol, username, password, clientIP string) (*middleware.UserContext, error) {
+	if wait := beginLoginAttempt(store, clientIP, username); wait > 0 {
+		log.Printf("%s: rate limited login attempt for user %s from IP %s", protocol, username, clientIP)
+		return nil, fmt.Errorf("too many failed login attempts, try again in %s", formatRetryWait(wait))
+	}
+
+	userCtx, err := authenticateUser(store, cfg, username, password)
+	if err != nil {
+		log.Printf("%s: login failed for user %s from IP %s: %v", protocol, username, clientIP, err)
+		recordSecurityEvent(store, &models.SecurityEvent{
+			Type:    models.SecurityEventAuthFailure,
+			Source:  strings.ToLower(protocol),
+			Actor:   username,
+			IP:      clientIP,
+			Message: protocol + " login failed: " + err.Error(),
+		})
+		return nil, errors.New("invalid credentials")
+	}
+
+	endLoginAttempt(store, clientIP, username)
+	log.Printf("%s: user %s logged in from %s", protocol, userCtx.Username, clientIP)
+	return userCtx, nil
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// captchaVerifyTimeout bounds the time spent asking a captcha provider to verify a response
+const captchaVerifyTimeout = 10 * time.Second
+
+// captchaVerifyURLs are the siteverify endpoints of the supported captcha providers. Both take
+// the secret, the client's response and its IP as a form and answer with {"success": bool}.
+var captchaVerifyURLs = map[string]string{
+	models.CaptchaProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	models.CaptchaProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// errCaptchaRequired is returned when a password attempt needs a solved captcha
+var errCaptchaRequired = errors.New("captcha required")
+
+// GetShareProtectionSettingsFromStore returns the share link brute-force protection settings
+func GetShareProtectionSettingsFromStore(store storage.DataStore) models.ShareProtectionSettings {
+	settings := models.ShareProtectionSettings{
+		DelayAfter:      models.DefaultShareDelayAfter,
+		MaxDelaySeconds: models.DefaultShareMaxDelaySecs,
+		CaptchaAfter:    models.DefaultShareCaptchaAfter,
+	}
+	intSetting := func(key string, value *int) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil {
+			if n, err := strconv.Atoi(setting.Value); err == nil && n > 0 {
+				*value = n
+			}
+		}
+	}
+	stringSetting := func(key string, value *string) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil {
+			*value = setting.Value
+		}
+	}
+	intSetting(models.SettingShareDelayAfter, &settings.DelayAfter)
+	intSetting(models.SettingShareMaxDelay, &settings.MaxDelaySeconds)
+	intSetting(models.SettingShareCaptchaAfter, &settings.CaptchaAfter)
+	stringSetting(models.SettingShareCaptchaProvider, &settings.CaptchaProvider)
+	stringSetting(models.SettingShareCaptchaSiteKey, &settings.CaptchaSiteKey)
+	stringSetting(models.SettingShareCaptchaSecret, &settings.CaptchaSecret)
+	return settings
+}
+
+// shareFailures returns the failed password attempts counted for a share link within the
+// lockout window
+func shareFailures(store storage.DataStore, linkID string) int {
+	l, err := store.GetLockout(lockoutKey(models.LockoutScopeShareToken, linkID))
+	if err != nil {
+		return 0
+	}
+	if !l.IsLocked() && time.Since(l.LastFailure) > GetLockoutPolicyFromStore(store).Window {
+		return 0
+	}
+	return l.Failures
+}
+
+// shareAttemptDelay returns how long the next attempt on a share must wait after failures
+// failed ones: nothing below the DelayAfter setting, then 1 second doubling up to MaxDelaySeconds
+func shareAttemptDelay(settings models.ShareProtectionSettings, failures int) time.Duration {
+	if failures < settings.DelayAfter {
+		return 0
+	}
+	exp := min(failures-settings.DelayAfter, 30)
+	delay := time.Duration(math.Pow(2, float64(exp))) * time.Second
+	return min(delay, time.Duration(settings.MaxDelaySeconds)*time.Second)
+}
+
+// beginShareAttempt counts a password attempt on a share link as failed before the password is
+// checked, so parallel guesses cannot all get past the delay and the captcha threshold. It
+// returns how long the caller must wait instead, or the failures counted before this attempt.
+func beginShareAttempt(store storage.DataStore, linkID, clientIP string, settings models.ShareProtectionSettings) (time.Duration, int) {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	ipKey := lockoutKey(models.LockoutScopeShareIP, linkID+":"+clientIP)
+	tokenKey := lockoutKey(models.LockoutScopeShareToken, linkID)
+	if wait := checkLockout(store, ipKey, tokenKey); wait > 0 {
+		return wait, 0
+	}
+	failures := shareFailures(store, linkID)
+	countAuthFailure(store, models.LockoutScopeShareIP, linkID+":"+clientIP)
+	countShareFailure(store, linkID, settings)
+	return 0, failures
+}
+
+// endShareAttempt resets the counters of a share link after the right password was given
+func endShareAttempt(store storage.DataStore, linkID, clientIP string) {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+	clearAuthFailures(store, lockoutKey(models.LockoutScopeShareIP, linkID+":"+clientIP),
+		lockoutKey(models.LockoutScopeShareToken, linkID))
+}
+
+// cancelShareAttempt takes back an attempt that was refused before its password was checked
+func cancelShareAttempt(store storage.DataStore, linkID, clientIP string, settings models.ShareProtectionSettings) {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	uncountAuthFailure(store, lockoutKey(models.LockoutScopeShareIP, linkID+":"+clientIP))
+	key := lockoutKey(models.LockoutScopeShareToken, linkID)
+	l, err := store.GetLockout(key)
+	if err != nil {
+		return
+	}
+	l.Failures--
+	if l.Failures <= 0 {
+		store.DeleteLockout(key)
+		return
+	}
+	if shareAttemptDelay(settings, l.Failures) == 0 {
+		l.LockedUntil = nil
+	}
+	if err := store.SaveLockout(l); err != nil {
+		log.Printf("Lockout: failed to save %s: %v", key, err)
+	}
+}
+
+// countShareFailure counts a failed password attempt on a share link from any client. Unlike
+// the per-IP lockout, the share is never locked; attempts are spaced out instead so the owner's
+// recipients can still get in while someone guesses from many addresses. Callers hold lockoutMu.
+func countShareFailure(store storage.DataStore, linkID string, settings models.ShareProtectionSettings) {
+	now := time.Now()
+	key := lockoutKey(models.LockoutScopeShareToken, linkID)
+
+	l, err := store.GetLockout(key)
+	if err != nil {
+		l = &models.Lockout{Key: key, Scope: models.LockoutScopeShareToken, Subject: linkID}
+	} else if !l.IsLocked() && now.Sub(l.LastFailure) > GetLockoutPolicyFromStore(store).Window {
+		l.Failures = 0
+		l.LockedUntil = nil
+	}
+
+	l.Failures++
+	l.LastFailure = now
+	l.LockedUntil = nil
+	if delay := shareAttemptDelay(settings, l.Failures); delay > 0 {
+		until := now.Add(delay)
+		l.LockedUntil = &until
+	}
+	if l.Failures == settings.DelayAfter {
+		log.Printf("Share link %s: %d failed password attempts, slowing down further attempts", linkID, l.Failures)
+	}
+
+	if err := store.SaveLockout(l); err != nil {
+		log.Printf("Lockout: failed to save %s: %v", key, err)
+	}
+}
+
+// shareCaptchaRequired reports whether password attempts on a share link need a captcha
+func shareCaptchaRequired(settings models.ShareProtectionSettings, failures int) bool {
+	return settings.CaptchaEnabled() && failures >= settings.CaptchaAfter
+}
+
+// verifyCaptcha asks the configured provider whether a captcha response is valid
+func verifyCaptcha(settings models.ShareProtectionSettings, response, remoteIP string) error {
+	if response == "" {
+		return errCaptchaRequired
+	}
+	verifyURL, ok := captchaVerifyURLs[settings.CaptchaProvider]
+	if !ok {
+		return fmt.Errorf("unknown captcha provider %q", settings.CaptchaProvider)
+	}
+
+	form := url.Values{
+		"secret":   {settings.CaptchaSecret},
+		"response": {response},
+		"remoteip": {remoteIP},
+	}
+	if settings.CaptchaProvider == models.CaptchaProviderHCaptcha {
+		form.Set("sitekey", settings.CaptchaSiteKey)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), captchaVerifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha verification failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha verification failed: %s", resp.Status)
+	}
+	if !result.Success {
+		return fmt.Errorf("captcha was not solved: %s", strings.Join(result.ErrorCodes, ", "))
+	}
+	return nil
+}
+
+// shareProtectionResponse hides the stored captcha secret from API responses
+type shareProtectionResponse struct {
+	models.ShareProtectionSettings
+	CaptchaSecretSet bool `json:"captcha_secret_set"`
+}
+
+// GetShareProtectionSettings returns the share link brute-force protection settings (admin only)
+func GetShareProtectionSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings := GetShareProtectionSettingsFromStore(store)
+		resp := shareProtectionResponse{ShareProtectionSettings: settings, CaptchaSecretSet: settings.CaptchaSecret != ""}
+		resp.CaptchaSecret = ""
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// UpdateShareProtectionSettings saves the share link brute-force protection settings (admin only).
+// An empty captcha secret keeps the stored one.
+func UpdateShareProtectionSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := GetShareProtectionSettingsFromStore(store)
+		req := current
+		req.CaptchaSecret = ""
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+		if req.CaptchaSecret == "" {
+			req.CaptchaSecret = current.CaptchaSecret
+		}
+
+		req.CaptchaSiteKey = strings.TrimSpace(req.CaptchaSiteKey)
+		req.CaptchaSecret = strings.TrimSpace(req.CaptchaSecret)
+		if req.DelayAfter < 1 || req.MaxDelaySeconds < 1 || req.CaptchaAfter < 1 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "delay_after, max_delay_seconds and captcha_after must be positive", nil)
+			return
+		}
+		if req.CaptchaProvider != models.CaptchaProviderNone {
+			if _, ok := captchaVerifyURLs[req.CaptchaProvider]; !ok {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid captcha_provider: must be hcaptcha, turnstile or empty", nil)
+				return
+			}
+			if req.CaptchaSiteKey == "" || req.CaptchaSecret == "" {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "A captcha site key and secret are required", nil)
+				return
+			}
+		}
+
+		category := string(models.CategorySecurity)
+		store.SetSetting(models.SettingShareDelayAfter, strconv.Itoa(req.DelayAfter), "int", category)
+		store.SetSetting(models.SettingShareMaxDelay, strconv.Itoa(req.MaxDelaySeconds), "int", category)
+		store.SetSetting(models.SettingShareCaptchaAfter, strconv.Itoa(req.CaptchaAfter), "int", category)
+		store.SetSetting(models.SettingShareCaptchaProvider, req.CaptchaProvider, "string", category)
+		store.SetSetting(models.SettingShareCaptchaSiteKey, req.CaptchaSiteKey, "string", category)
+		store.SetSetting(models.SettingShareCaptchaSecret, req.CaptchaSecret, "string", category)
+
+		GetShareProtectionSettings(store)(w, r)
+	}
+}
@@ -8,15 +8,26 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
+	"math"
 	"net/http"
+	"net/netip"
 	"os"
 	osuser "os/user"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
 	"fileserv/internal/fileops"
+	"fileserv/internal/mailer"
+	"fileserv/middleware"
 	"fileserv/models"
 	"fileserv/storage"
 
@@ -120,12 +131,123 @@ func generateToken() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
+// shareSlugPattern matches custom share link slugs: lowercase letters, digits and inner hyphens
+var shareSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}[a-z0-9]$`)
+
+// reservedShareSlugs cannot be used as slugs because they name routes or pages, or would be
+// confusing in a public URL
+var reservedShareSlugs = map[string]bool{
+	"api": true, "admin": true, "s": true, "share": true, "shares": true, "link": true, "links": true,
+	"login": true, "logout": true, "setup": true, "settings": true, "verify": true, "list": true,
+	"download": true, "preview": true, "thumbnail": true, "upload": true, "static": true, "assets": true,
+	"public": true, "new": true, "edit": true, "help": true, "about": true, "www": true, "root": true,
+	"system": true, "null": true, "undefined": true,
+}
+
+// validateShareSlug normalizes a custom slug and checks that it is well-formed, not reserved
+// and not used by another link, either as its slug or its token. linkID is the link being
+// changed, or empty for a new link.
+func validateShareSlug(store storage.DataStore, slug, linkID string) (string, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if !shareSlugPattern.MatchString(slug) {
+		return "", errors.New("slug must be 3-64 lowercase letters, digits or hyphens, starting and ending with a letter or digit")
+	}
+	if reservedShareSlugs[slug] {
+		return "", fmt.Errorf("slug %q is reserved", slug)
+	}
+	if other, err := store.GetShareLinkBySlug(slug); err == nil && other.ID != linkID {
+		return "", fmt.Errorf("slug %q is already in use", slug)
+	}
+	if other, err := store.GetShareLinkByToken(slug); err == nil && other.ID != linkID {
+		return "", fmt.Errorf("slug %q is already in use", slug)
+	}
+	return slug, nil
+}
+
+// normalizeExtensions lowercases extensions and adds the leading dot
+func normalizeExtensions(exts []string) []string {
+	normalized := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" || ext == "." {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		normalized = append(normalized, ext)
+	}
+	return normalized
+}
+
+// normalizeCIDRs validates networks and single addresses, returning them in CIDR notation
+func normalizeCIDRs(cidrs []string) ([]string, error) {
+	normalized := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid network %q", cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		normalized = append(normalized, prefix.Masked().String())
+	}
+	return normalized, nil
+}
+
+// normalizeCountries validates and uppercases ISO 3166 alpha-2 country codes
+func normalizeCountries(countries []string) ([]string, error) {
+	normalized := make([]string, 0, len(countries))
+	for _, country := range countries {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if country == "" {
+			continue
+		}
+		if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+			return nil, fmt.Errorf("invalid country code %q", country)
+		}
+		normalized = append(normalized, country)
+	}
+	return normalized, nil
+}
+
+// splitShareSelection checks that selected paths are distinct entries of one folder and returns
+// the folder and the entry names
+func splitShareSelection(paths []string) (string, []string, error) {
+	var parent string
+	names := make([]string, 0, len(paths))
+	for i, p := range paths {
+		p = filepath.Clean("/" + p)
+		if p == "/" {
+			return "", nil, errors.New("cannot select the root folder")
+		}
+		dir, name := filepath.Dir(p), filepath.Base(p)
+		if i == 0 {
+			parent = dir
+		} else if dir != parent {
+			return "", nil, errors.New("all selected items must be in the same folder")
+		}
+		if slices.Contains(names, name) {
+			return "", nil, fmt.Errorf("%q is selected more than once", name)
+		}
+		names = append(names, name)
+	}
+	return parent, names, nil
+}
+
 // GetMyShareLinks returns all share links owned by the current user
 func (h *ShareLinkHandler) GetMyShareLinks(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 
 	links := h.store.ListShareLinksByOwner(userID)
 
+	withShareLinkURLs(h.store, r, links...)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(links)
 }
@@ -134,6 +256,7 @@ func (h *ShareLinkHandler) GetMyShareLinks(w http.ResponseWriter, r *http.Reques
 func (h *ShareLinkHandler) GetAllShareLinks(w http.ResponseWriter, r *http.Request) {
 	links := h.store.ListShareLinks()
 
+	withShareLinkURLs(h.store, r, links...)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(links)
 }
@@ -146,26 +269,33 @@ func (h *ShareLinkHandler) GetShareLink(w http.ResponseWriter, r *http.Request)
 
 	link, err := h.store.GetShareLink(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareLinkNotFound, err.Error(), nil)
 		return
 	}
 
 	// Check ownership (admins can view any link)
 	if !isAdmin && link.OwnerID != userID {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
 		return
 	}
 
+	withShareLinkURLs(h.store, r, link)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(link)
 }
 
 // CreateShareLink creates a new share link
 func (h *ShareLinkHandler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	if userCtx := middleware.GetUserContext(r); userCtx != nil && userCtx.IsGuest {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Guest accounts cannot create share links", nil)
+		return
+	}
 	userID := r.Context().Value("user_id").(string)
 
 	var req struct {
-		TargetPath    string  `json:"target_path"`
+		TargetPath    string   `json:"target_path"`
+		TargetPaths   []string `json:"target_paths"` // Several entries of one folder, instead of target_path
+		Slug          string  `json:"slug"` // Optional custom name used in the URL instead of the token
 		Name          string  `json:"name"`
 		Description   string  `json:"description"`
 		Password      string  `json:"password"`
@@ -178,22 +308,119 @@ func (h *ShareLinkHandler) CreateShareLink(w http.ResponseWriter, r *http.Reques
 		AllowListing  bool    `json:"allow_listing"`
 		ShowOwner     bool    `json:"show_owner"`
 		CustomMessage string  `json:"custom_message"`
+
+		// File request options
+		Mode              string   `json:"mode"`
+		MaxFileSize       int64    `json:"max_file_size"`
+		AllowedExtensions []string `json:"allowed_extensions"`
+		NotifyOnUpload    bool     `json:"notify_on_upload"`
+
+		// One-time link options
+		BurnAfterIPs int  `json:"burn_after_ips"`
+		DeleteOnBurn bool `json:"delete_on_burn"`
+
+		// Network restrictions
+		AllowedCIDRs     []string `json:"allowed_cidrs"`
+		AllowedCountries []string `json:"allowed_countries"`
+		BlockedCountries []string `json:"blocked_countries"`
+
+		// Notifications
+		NotifyOnDownload bool     `json:"notify_on_download"`
+		EmailTo          []string `json:"email_to"`      // Recipients to send the link to
+		EmailMessage     string   `json:"email_message"` // Optional note included in the email
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
+	// A selection is shared as its parent folder, limited to the selected entries
+	var items []string
+	if len(req.TargetPaths) > 0 {
+		if req.TargetPath != "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Use either target_path or target_paths", nil)
+			return
+		}
+		parent, names, err := splitShareSelection(req.TargetPaths)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		req.TargetPath = parent
+		items = names
+	}
+
 	if req.TargetPath == "" {
-		http.Error(w, "Target path is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Target path is required", nil)
 		return
 	}
 
+	if req.Mode == "" {
+		req.Mode = models.ShareLinkModeStandard
+	}
+	switch req.Mode {
+	case models.ShareLinkModeStandard, models.ShareLinkModeRequest, models.ShareLinkModeOneTime:
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid mode: must be standard, request or one_time", nil)
+		return
+	}
+	if req.BurnAfterIPs < 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "burn_after_ips cannot be negative", nil)
+		return
+	}
+	if req.MaxFileSize < 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Max file size cannot be negative", nil)
+		return
+	}
+	if req.Slug != "" {
+		slug, err := validateShareSlug(h.store, req.Slug, "")
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		req.Slug = slug
+	}
+
+	allowedCIDRs, err := normalizeCIDRs(req.AllowedCIDRs)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	allowedCountries, err := normalizeCountries(req.AllowedCountries)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	blockedCountries, err := normalizeCountries(req.BlockedCountries)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	if len(allowedCountries) > 0 || len(blockedCountries) > 0 {
+		if _, err := loadGeoIPDatabase(h.store); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Country restrictions are unavailable: "+err.Error(), nil)
+			return
+		}
+	}
+
+	if len(req.EmailTo) > 0 {
+		if !GetSMTPSettingsFromStore(h.store).Enabled {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Email is not configured", nil)
+			return
+		}
+		for _, to := range req.EmailTo {
+			if err := mailer.ValidateAddress(to); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+		}
+	}
+
 	// Validate path securely with symlink resolution
 	fullPath, err := validateSharePath(h.dataDir, req.TargetPath, "")
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid path", nil)
 		return
 	}
 
@@ -201,31 +428,58 @@ func (h *ShareLinkHandler) CreateShareLink(w http.ResponseWriter, r *http.Reques
 	info, err := os.Stat(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			http.Error(w, "File or folder not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File or folder not found", nil)
 			return
 		}
-		http.Error(w, "Cannot access path", http.StatusInternalServerError)
+		apierror.Error(w, "Cannot access path", http.StatusInternalServerError)
 		return
 	}
 
 	// Determine target type
 	targetType := "file"
+	targetName := filepath.Base(req.TargetPath)
 	if info.IsDir() {
 		targetType = "folder"
 	}
+	if items != nil {
+		for _, name := range items {
+			itemPath, err := validateSharePath(h.dataDir, req.TargetPath, name)
+			if err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid path", nil)
+				return
+			}
+			if _, err := os.Stat(itemPath); err != nil {
+				apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, fmt.Sprintf("%q not found", name), nil)
+				return
+			}
+		}
+		targetType = "selection"
+		targetName = fmt.Sprintf("%d items", len(items))
+	}
+
+	if req.Mode == models.ShareLinkModeRequest && targetType != "folder" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "File requests must target a folder", nil)
+		return
+	}
+	if req.DeleteOnBurn && (req.Mode != models.ShareLinkModeOneTime || targetType != "file") {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "delete_on_burn is only available for one-time links to a file", nil)
+		return
+	}
 
 	// Generate token
 	token := generateToken()
 
 	// Create the link
-	link := models.NewShareLink(userID, req.TargetPath, targetType, filepath.Base(req.TargetPath), token)
+	link := models.NewShareLink(userID, req.TargetPath, targetType, targetName, token)
+	link.Items = items
 
 	// Apply custom settings
 	if req.Name != "" {
 		link.Name = req.Name
 	} else {
-		link.Name = filepath.Base(req.TargetPath)
+		link.Name = targetName
 	}
+	link.Slug = req.Slug
 	link.Description = req.Description
 	link.CustomMessage = req.CustomMessage
 	link.ShowOwner = req.ShowOwner
@@ -234,7 +488,32 @@ func (h *ShareLinkHandler) CreateShareLink(w http.ResponseWriter, r *http.Reques
 	link.AllowDownload = req.AllowDownload
 	link.AllowPreview = req.AllowPreview
 	link.AllowUpload = req.AllowUpload && targetType == "folder"
-	link.AllowListing = req.AllowListing || targetType == "folder"
+	link.AllowListing = req.AllowListing || targetType != "file"
+	link.Mode = req.Mode
+	link.MaxFileSize = req.MaxFileSize
+	link.AllowedExtensions = normalizeExtensions(req.AllowedExtensions)
+	link.NotifyOnUpload = req.NotifyOnUpload
+	link.NotifyOnDownload = req.NotifyOnDownload
+	link.AllowedCIDRs = allowedCIDRs
+	link.AllowedCountries = allowedCountries
+	link.BlockedCountries = blockedCountries
+
+	// File requests only accept uploads; existing contents stay hidden
+	if link.IsFileRequest() {
+		link.AllowUpload = true
+		link.AllowDownload = false
+		link.AllowPreview = false
+		link.AllowListing = false
+	}
+
+	// One-time links can only be downloaded; a preview would show the contents without burning
+	if link.IsOneTime() {
+		link.AllowDownload = true
+		link.AllowPreview = false
+		link.AllowUpload = false
+		link.BurnAfterIPs = req.BurnAfterIPs
+		link.DeleteOnBurn = req.DeleteOnBurn
+	}
 
 	// Set expiration
 	if req.ExpiresIn > 0 {
@@ -251,7 +530,7 @@ func (h *ShareLinkHandler) CreateShareLink(w http.ResponseWriter, r *http.Reques
 	if req.Password != "" {
 		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
-			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to hash password", http.StatusInternalServerError)
 			return
 		}
 		link.PasswordHash = string(hash)
@@ -259,10 +538,26 @@ func (h *ShareLinkHandler) CreateShareLink(w http.ResponseWriter, r *http.Reques
 
 	created, err := h.store.CreateShareLink(link)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if !writeNameConflict(w, err) {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
+	if len(req.EmailTo) > 0 {
+		if err := emailShareLink(h.store, r, created, req.EmailTo, req.EmailMessage); err != nil {
+			log.Printf("Share link %s: cannot send email: %v", created.ID, err)
+		}
+	}
+	publishAction(r, &events.Event{
+		Type:       events.TypeShareLinkCreated,
+		ObjectType: "share_link",
+		ObjectID:   created.ID,
+		UserID:     created.OwnerID,
+		Data:       map[string]interface{}{"name": created.Name, "target_name": created.TargetName},
+	})
+
+	withShareLinkURLs(h.store, r, created)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(created)
@@ -276,19 +571,19 @@ func (h *ShareLinkHandler) UpdateShareLink(w http.ResponseWriter, r *http.Reques
 
 	link, err := h.store.GetShareLink(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareLinkNotFound, err.Error(), nil)
 		return
 	}
 
 	// Check ownership
 	if !isAdmin && link.OwnerID != userID {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
 		return
 	}
 
 	var updates map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
@@ -296,19 +591,140 @@ func (h *ShareLinkHandler) UpdateShareLink(w http.ResponseWriter, r *http.Reques
 	if password, ok := updates["password"].(string); ok && password != "" {
 		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 		if err != nil {
-			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to hash password", http.StatusInternalServerError)
 			return
 		}
 		updates["password_hash"] = string(hash)
 		delete(updates, "password")
 	}
 
+	if exts, ok := updates["allowed_extensions"].([]interface{}); ok {
+		list := make([]string, 0, len(exts))
+		for _, ext := range exts {
+			if str, ok := ext.(string); ok {
+				list = append(list, str)
+			}
+		}
+		updates["allowed_extensions"] = normalizeExtensions(list)
+	}
+	for _, key := range []string{"allowed_cidrs", "allowed_countries", "blocked_countries"} {
+		values, ok := updates[key].([]interface{})
+		if !ok {
+			continue
+		}
+		list := make([]string, 0, len(values))
+		for _, value := range values {
+			if str, ok := value.(string); ok {
+				list = append(list, str)
+			}
+		}
+		normalize := normalizeCountries
+		if key == "allowed_cidrs" {
+			normalize = normalizeCIDRs
+		}
+		normalized, err := normalize(list)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if len(normalized) > 0 && key != "allowed_cidrs" {
+			if _, err := loadGeoIPDatabase(h.store); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Country restrictions are unavailable: "+err.Error(), nil)
+				return
+			}
+		}
+		updates[key] = normalized
+	}
+	if maxFileSize, ok := updates["max_file_size"].(float64); ok && maxFileSize < 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Max file size cannot be negative", nil)
+		return
+	}
+	// An empty slug removes it; the link is then only reachable by its token
+	if slug, ok := updates["slug"].(string); ok && slug != "" {
+		slug, err := validateShareSlug(h.store, slug, link.ID)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		updates["slug"] = slug
+	}
+
+	// File requests never expose the folder contents
+	if link.IsFileRequest() {
+		delete(updates, "allow_download")
+		delete(updates, "allow_preview")
+		delete(updates, "allow_listing")
+		delete(updates, "allow_upload")
+	}
+
+	// Selections are always listed and never take uploads
+	if link.IsSelection() {
+		delete(updates, "allow_listing")
+		delete(updates, "allow_upload")
+	}
+
+	// One-time links are download-only, and only they burn
+	if link.IsOneTime() {
+		delete(updates, "allow_download")
+		delete(updates, "allow_preview")
+		delete(updates, "allow_upload")
+		if burnAfterIPs, ok := updates["burn_after_ips"].(float64); ok && burnAfterIPs < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "burn_after_ips cannot be negative", nil)
+			return
+		}
+		if deleteOnBurn, ok := updates["delete_on_burn"].(bool); ok && deleteOnBurn && link.TargetType != "file" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "delete_on_burn is only available for one-time links to a file", nil)
+			return
+		}
+	} else {
+		delete(updates, "burn_after_ips")
+		delete(updates, "delete_on_burn")
+	}
+
 	updated, err := h.store.UpdateShareLink(id, updates)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if !writeNameConflict(w, err) {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	withShareLinkURLs(h.store, r, updated)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// RotateShareLinkToken replaces the token of a share link, so URLs using the old token stop
+// working while the link keeps its settings, counters and slug
+func (h *ShareLinkHandler) RotateShareLinkToken(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userID := r.Context().Value("user_id").(string)
+	isAdmin := r.Context().Value("is_admin").(bool)
+
+	link, err := h.store.GetShareLink(id)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareLinkNotFound, err.Error(), nil)
+		return
+	}
+
+	// Check ownership
+	if !isAdmin && link.OwnerID != userID {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
+		return
+	}
+
+	if err := h.store.SetShareLinkToken(id, generateToken()); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := h.store.GetShareLink(id)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	withShareLinkURLs(h.store, r, updated)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updated)
 }
@@ -321,20 +737,27 @@ func (h *ShareLinkHandler) DeleteShareLink(w http.ResponseWriter, r *http.Reques
 
 	link, err := h.store.GetShareLink(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareLinkNotFound, err.Error(), nil)
 		return
 	}
 
 	// Check ownership
 	if !isAdmin && link.OwnerID != userID {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
 		return
 	}
 
 	if err := h.store.DeleteShareLink(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	publishAction(r, &events.Event{
+		Type:       events.TypeShareLinkDeleted,
+		ObjectType: "share_link",
+		ObjectID:   link.ID,
+		UserID:     link.OwnerID,
+		Data:       map[string]interface{}{"name": link.Name, "target_name": link.TargetName},
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Share link deleted"})
@@ -345,49 +768,113 @@ func (h *ShareLinkHandler) DeleteShareLink(w http.ResponseWriter, r *http.Reques
 // ============================================================================
 
 type PublicHandler struct {
-	store   storage.DataStore
-	dataDir string
+	store    storage.DataStore
+	dataDir  string
+	previews *PreviewHandler
 }
 
-func NewPublicHandler(store storage.DataStore, dataDir string) *PublicHandler {
-	return &PublicHandler{store: store, dataDir: dataDir}
+func NewPublicHandler(store storage.DataStore, dataDir string, previews *PreviewHandler) *PublicHandler {
+	return &PublicHandler{store: store, dataDir: dataDir, previews: previews}
+}
+
+// findShareLink looks up a public share link by its token or, failing that, its custom slug
+func (h *PublicHandler) findShareLink(key string) (*models.ShareLink, error) {
+	if link, err := h.store.GetShareLinkByToken(key); err == nil {
+		return link, nil
+	}
+	return h.store.GetShareLinkBySlug(strings.ToLower(key))
+}
+
+// EnforceNetworkRestrictions rejects clients outside a link's allowed networks and countries
+// before any public share handler runs. Unknown links are left to the handlers.
+func (h *PublicHandler) EnforceNetworkRestrictions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		link, err := h.findShareLink(chi.URLParam(r, "token"))
+		if err != nil || !link.HasNetworkRestrictions() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !h.clientAllowed(link, getClientIP(r)) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "This share link is not available from your location", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientAllowed checks a client IP against a link's network restrictions. Country restrictions
+// fail closed when the GeoIP database cannot be loaded.
+func (h *PublicHandler) clientAllowed(link *models.ShareLink, ip string) bool {
+	if len(link.AllowedCIDRs) > 0 {
+		addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		allowed := false
+		for _, cidr := range link.AllowedCIDRs {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if len(link.AllowedCountries) == 0 && len(link.BlockedCountries) == 0 {
+		return true
+	}
+	db, err := loadGeoIPDatabase(h.store)
+	if err != nil {
+		log.Printf("Share link %s: cannot check country restrictions: %v", link.ID, err)
+		return false
+	}
+	country := clientCountry(db, ip)
+	if slices.Contains(link.BlockedCountries, country) {
+		return false
+	}
+	return len(link.AllowedCountries) == 0 || slices.Contains(link.AllowedCountries, country)
 }
 
 // GetPublicShare returns public share info
 func (h *PublicHandler) GetPublicShare(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 
-	link, err := h.store.GetShareLinkByToken(token)
+	link, err := h.findShareLink(token)
 	if err != nil {
-		http.Error(w, "Share not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, "Share not found", nil)
 		return
 	}
 
 	// Check if accessible
 	if !link.IsAccessible() {
 		if link.IsExpired() {
-			http.Error(w, "This share link has expired", http.StatusGone)
+			apierror.Write(w, http.StatusGone, apierror.CodeGone, "This share link has expired", nil)
 		} else if link.IsViewLimitReached() {
-			http.Error(w, "This share link has reached its view limit", http.StatusGone)
+			apierror.Write(w, http.StatusGone, apierror.CodeGone, "This share link has reached its view limit", nil)
 		} else {
-			http.Error(w, "This share link is not available", http.StatusGone)
+			apierror.Write(w, http.StatusGone, apierror.CodeGone, "This share link is not available", nil)
 		}
 		return
 	}
 
 	// Increment view count
 	h.store.IncrementShareLinkView(link.ID)
+	publishShareAccessed(r, link, "view")
 
 	// Get file info with secure path validation
 	fullPath, err := validateSharePath(h.dataDir, link.TargetPath, "")
 	if err != nil {
-		http.Error(w, "Share target not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "Share target not found", nil)
 		return
 	}
 
 	info, err := os.Stat(fullPath)
 	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
 		return
 	}
 
@@ -415,9 +902,21 @@ func (h *PublicHandler) GetPublicShare(w http.ResponseWriter, r *http.Request) {
 		AllowUpload:      link.AllowUpload,
 		AllowListing:     link.AllowListing,
 		RequiresPassword: link.PasswordHash != "",
+		Mode:             link.Mode,
+		MaxFileSize:      link.MaxFileSize,
 		ExpiresAt:        link.ExpiresAt,
 		CreatedAt:        link.CreatedAt,
 	}
+	if link.AllowUpload {
+		publicInfo.AllowedExtensions = link.AllowedExtensions
+	}
+	if link.PasswordHash != "" {
+		settings := GetShareProtectionSettingsFromStore(h.store)
+		if shareCaptchaRequired(settings, shareFailures(h.store, link.ID)) {
+			publicInfo.CaptchaProvider = settings.CaptchaProvider
+			publicInfo.CaptchaSiteKey = settings.CaptchaSiteKey
+		}
+	}
 
 	if !info.IsDir() {
 		publicInfo.Size = info.Size()
@@ -427,21 +926,24 @@ func (h *PublicHandler) GetPublicShare(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(publicInfo)
 }
 
-// VerifySharePassword verifies the password for a protected share
+// VerifySharePassword checks a share link password. Failures are limited per client IP with
+// lockouts and per share with growing delays between attempts; past the configured number of
+// failures on the share, a solved captcha must be sent along as captcha_token.
 func (h *PublicHandler) VerifySharePassword(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 
 	var req struct {
-		Password string `json:"password"`
+		Password     string `json:"password"`
+		CaptchaToken string `json:"captcha_token"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
-	link, err := h.store.GetShareLinkByToken(token)
+	link, err := h.findShareLink(token)
 	if err != nil {
-		http.Error(w, "Share not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, "Share not found", nil)
 		return
 	}
 
@@ -452,182 +954,514 @@ func (h *PublicHandler) VerifySharePassword(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Brute-force protection (per client IP and share, and per share from any IP). The attempt
+	// counts as failed until the password turns out to be right.
+	clientIP := getClientIP(r)
+	settings := GetShareProtectionSettingsFromStore(h.store)
+	wait, failures := beginShareAttempt(h.store, link.ID, clientIP, settings)
+	if wait > 0 {
+		writeLockedOut(w, wait, "password")
+		return
+	}
+
+	if shareCaptchaRequired(settings, failures) {
+		if err := verifyCaptcha(settings, req.CaptchaToken, clientIP); err != nil {
+			cancelShareAttempt(h.store, link.ID, clientIP, settings)
+			writeCaptchaRequired(w, settings, err)
+			return
+		}
+	}
+
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(req.Password))
 	if err != nil {
+		failures++
+		recordSecurityEvent(h.store, &models.SecurityEvent{
+			Type:    models.SecurityEventAuthFailure,
+			Source:  "share",
+			Target:  link.Name,
+			IP:      clientIP,
+			Message: fmt.Sprintf("Wrong password for share link %q (%d failed attempts)", link.Name, failures),
+		})
+
+		resp := map[string]interface{}{"valid": false}
+		if delay := shareAttemptDelay(settings, failures); delay > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			resp["retry_after"] = int(math.Ceil(delay.Seconds()))
+		}
+		if shareCaptchaRequired(settings, failures) {
+			resp["captcha_required"] = true
+			resp["captcha_provider"] = settings.CaptchaProvider
+			resp["captcha_site_key"] = settings.CaptchaSiteKey
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]bool{"valid": false})
+		json.NewEncoder(w).Encode(resp)
 		return
 	}
 
+	endShareAttempt(h.store, link.ID, clientIP)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"valid": true})
 }
 
-// ListPublicShare lists contents of a shared folder
+// writeCaptchaRequired refuses a password attempt that lacks a solved captcha, telling the client
+// which captcha to show
+func writeCaptchaRequired(w http.ResponseWriter, settings models.ShareProtectionSettings, err error) {
+	if !errors.Is(err, errCaptchaRequired) {
+		log.Printf("Share captcha: %v", err)
+	}
+	apierror.Write(w, http.StatusForbidden, apierror.CodeCaptchaRequired, "Please complete the captcha", map[string]interface{}{
+		"captcha_required": true,
+		"captcha_provider": settings.CaptchaProvider,
+		"captcha_site_key": settings.CaptchaSiteKey,
+	})
+}
+
+// ListPublicShare lists contents of a shared folder. sort_by is name (default), size, modified
+// or type, with sort_desc=true to reverse it. With limit (and offset or the next_cursor of the
+// previous page) the response is a page with breadcrumbs from the share root; without, the plain
+// list of files.
 func (h *PublicHandler) ListPublicShare(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 	subPath := r.URL.Query().Get("path")
 
-	link, err := h.store.GetShareLinkByToken(token)
+	link, err := h.findShareLink(token)
 	if err != nil {
-		http.Error(w, "Share not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, "Share not found", nil)
 		return
 	}
 
 	if !link.IsAccessible() {
-		http.Error(w, "Share not available", http.StatusGone)
+		apierror.Write(w, http.StatusGone, apierror.CodeShareUnavailable, "Share not available", nil)
+		return
+	}
+
+	if !link.AllowListing || link.IsFileRequest() {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Listing not allowed", nil)
 		return
 	}
 
-	if !link.AllowListing {
-		http.Error(w, "Listing not allowed", http.StatusForbidden)
+	opts := fileops.ListOptions{}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil && l > 0 {
+			opts.Limit = l
+		}
+	}
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		if o, err := strconv.Atoi(offset); err == nil && o >= 0 {
+			opts.Offset = o
+		}
+	}
+	opts.Cursor = r.URL.Query().Get("cursor")
+	opts.SortBy = r.URL.Query().Get("sort_by")
+	opts.SortDesc = r.URL.Query().Get("sort_desc") == "true"
+	switch opts.SortBy {
+	case "", "name", "size", "modified", "mtime", "type":
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid sort_by (must be name, size, modified or type)", nil)
 		return
 	}
 
+	// The root of a selection lists just the selected entries
+	relPath := strings.Trim(filepath.ToSlash(filepath.Clean("/"+subPath)), "/")
+	if link.IsSelection() {
+		if relPath == "" {
+			opts.Include = link.Items
+		} else if !link.SelectionAllows(relPath) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodePathNotFound, "Path not found", nil)
+			return
+		}
+	}
+
 	// Validate path securely with symlink resolution
 	targetPath, err := validateSharePath(h.dataDir, link.TargetPath, subPath)
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid path", nil)
 		return
 	}
 
 	info, err := os.Stat(targetPath)
 	if err != nil {
-		http.Error(w, "Path not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodePathNotFound, "Path not found", nil)
 		return
 	}
 
 	if !info.IsDir() {
-		http.Error(w, "Not a directory", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a directory", nil)
 		return
 	}
 
-	entries, err := os.ReadDir(targetPath)
+	result, err := fileops.ListDirectoryRawPaginated(targetPath, opts, relPath)
 	if err != nil {
-		http.Error(w, "Cannot read directory", http.StatusInternalServerError)
-		return
-	}
-
-	files := make([]models.PublicFileInfo, 0, len(entries))
-	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		relPath := subPath
-		if relPath != "" {
-			relPath = filepath.Join(relPath, entry.Name())
+		if errors.Is(err, fileops.ErrInvalidCursor) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 		} else {
-			relPath = entry.Name()
+			apierror.Error(w, "Cannot read directory", http.StatusInternalServerError)
 		}
+		return
+	}
 
-		files = append(files, models.PublicFileInfo{
-			Name:    entry.Name(),
-			Path:    relPath,
-			Size:    info.Size(),
-			IsDir:   entry.IsDir(),
-			ModTime: info.ModTime(),
-		})
+	files := make([]models.PublicFileInfo, 0, len(result.Files))
+	for _, f := range result.Files {
+		files = append(files, publicFileInfo(link, &f))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(files)
+	if opts.Limit == 0 && opts.Cursor == "" {
+		json.NewEncoder(w).Encode(files)
+		return
+	}
+	json.NewEncoder(w).Encode(models.PublicShareListing{
+		Path:        relPath,
+		Breadcrumbs: publicBreadcrumbs(link, relPath),
+		Files:       files,
+		Total:       result.Total,
+		Limit:       result.Limit,
+		Offset:      result.Offset,
+		HasMore:     result.HasMore,
+		NextCursor:  result.NextCursor,
+	})
+}
+
+// publicFileInfo converts a listed file to the fields shown to public share visitors
+func publicFileInfo(link *models.ShareLink, f *fileops.FileInfo) models.PublicFileInfo {
+	info := models.PublicFileInfo{
+		Name:      f.Name,
+		Path:      f.Path,
+		Size:      f.Size,
+		IsDir:     f.IsDir,
+		ModTime:   f.ModTime,
+		Extension: f.Extension,
+		MimeType:  f.MimeType,
+	}
+	if link.AllowPreview && !f.IsDir {
+		_, info.Previewable = publicPreviewTypes["."+f.Extension]
+		info.Thumbnail = previewImageExtensions[f.Extension]
+	}
+	return info
 }
 
-// DownloadPublicShare downloads a file or folder from a public share
+// publicBreadcrumbs lists the folders from the share root down to relPath
+func publicBreadcrumbs(link *models.ShareLink, relPath string) []models.PublicBreadcrumb {
+	name := link.TargetName
+	if name == "" {
+		name = link.Name
+	}
+	crumbs := []models.PublicBreadcrumb{{Name: name, Path: ""}}
+	if relPath == "" {
+		return crumbs
+	}
+	parts := strings.Split(relPath, "/")
+	for i, part := range parts {
+		crumbs = append(crumbs, models.PublicBreadcrumb{Name: part, Path: strings.Join(parts[:i+1], "/")})
+	}
+	return crumbs
+}
+
+// DownloadPublicShare downloads a file or folder from a public share. Folders are sent as a zip
+// archive, so leaving out path downloads the whole share in one request. Repeated files
+// parameters download just those entries of the folder at path as one zip archive.
 func (h *PublicHandler) DownloadPublicShare(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 	subPath := r.URL.Query().Get("path")
+	selected := r.URL.Query()["files"]
 
-	link, err := h.store.GetShareLinkByToken(token)
+	link, err := h.findShareLink(token)
 	if err != nil {
-		http.Error(w, "Share not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, "Share not found", nil)
 		return
 	}
 
 	if !link.IsAccessible() {
-		http.Error(w, "Share not available", http.StatusGone)
+		apierror.Write(w, http.StatusGone, apierror.CodeShareUnavailable, "Share not available", nil)
 		return
 	}
 
 	if !link.CanDownload() {
-		http.Error(w, "Downloads not allowed or limit reached", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Downloads not allowed or limit reached", nil)
 		return
 	}
 
+	// Downloads are refused once the link, its owner or its zone used up the monthly transfer cap
+	transfer := h.linkTransferObjects(link)
+	if err := checkTransferCaps(h.store, transfer); err != nil {
+		writeTransferCapError(w, err)
+		return
+	}
+	w, meter := meterDownload(w, transfer)
+	defer meter()
+
+	// The root of a selection downloads exactly the selected entries
+	zipName := ""
+	if link.IsSelection() {
+		if strings.Trim(filepath.ToSlash(filepath.Clean("/"+subPath)), "/") == "" {
+			if len(selected) == 0 {
+				selected = link.Items
+			}
+			for _, name := range selected {
+				if !slices.Contains(link.Items, name) {
+					apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+					return
+				}
+			}
+			zipName = strings.ReplaceAll(link.Name, "\"", "")
+		} else if !link.SelectionAllows(subPath) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+			return
+		}
+	}
+
 	// Validate path securely with symlink resolution
 	targetPath, err := validateSharePath(h.dataDir, link.TargetPath, subPath)
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid path", nil)
 		return
 	}
 
 	info, err := os.Stat(targetPath)
 	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
 		return
 	}
 
+	// Resolve the selected entries before anything is counted or sent
+	var entries []string
+	if len(selected) > 0 {
+		if !info.IsDir() {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a directory", nil)
+			return
+		}
+		for _, name := range selected {
+			if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid file name", nil)
+				return
+			}
+			entryPath, err := validateSharePath(h.dataDir, link.TargetPath, filepath.Join(subPath, name))
+			if err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid path", nil)
+				return
+			}
+			if _, err := os.Stat(entryPath); err != nil {
+				apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+				return
+			}
+			entries = append(entries, entryPath)
+		}
+	}
+
+	// One-time links are claimed before anything is sent, so parallel downloads cannot all get
+	// the file before the link burns
+	burned := false
+	if link.IsOneTime() && r.Method == http.MethodGet {
+		var ok bool
+		if ok, burned = h.claimOneTimeDownload(r, link); !ok {
+			apierror.Write(w, http.StatusGone, apierror.CodeShareUnavailable, "Share not available", nil)
+			return
+		}
+	}
+
 	// Increment download count
 	h.store.IncrementShareLinkDownload(link.ID)
+	publishShareAccessed(r, link, "download")
+	if link.NotifyOnDownload {
+		what := fmt.Sprintf("\"%s\"", filepath.Base(targetPath))
+		if len(entries) > 0 {
+			what = fmt.Sprintf("%d items from \"%s\"", len(entries), filepath.Base(targetPath))
+		}
+		notifyShareOwner(h.store, link, fmt.Sprintf("Your share link \"%s\" was downloaded", link.Name),
+			fmt.Sprintf("%s was downloaded through your share link \"%s\" from %s at %s.\n",
+				what, link.Name, getClientIP(r), time.Now().Format(time.RFC1123)))
+	}
 
 	if info.IsDir() {
 		// Create zip archive
 		w.Header().Set("Content-Type", "application/zip")
-		w.Header().Set("Content-Disposition", "attachment; filename=\""+filepath.Base(targetPath)+".zip\"")
+		if zipName == "" {
+			zipName = filepath.Base(targetPath)
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+zipName+".zip\"")
 
 		zipWriter := zip.NewWriter(w)
-		defer zipWriter.Close()
-
-		filepath.Walk(targetPath, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
 
-			// Get relative path
-			relPath, err := filepath.Rel(targetPath, path)
-			if err != nil {
-				return err
-			}
-
-			if info.IsDir() {
-				if relPath != "." {
-					_, err := zipWriter.Create(relPath + "/")
-					return err
-				}
-				return nil
-			}
-
-			writer, err := zipWriter.Create(relPath)
-			if err != nil {
-				return err
-			}
-
-			file, err := os.Open(path)
-			if err != nil {
-				return err
+		if len(entries) == 0 {
+			err = writeShareZip(zipWriter, targetPath, "")
+		}
+		for _, entryPath := range entries {
+			if err = writeShareZip(zipWriter, entryPath, filepath.Base(entryPath)); err != nil {
+				break
 			}
-			defer file.Close()
-
-			_, err = io.Copy(writer, file)
-			return err
-		})
+		}
+		if err == nil {
+			err = zipWriter.Close()
+		}
+		if err != nil {
+			log.Printf("Public share %s: zip download of %s failed: %v", link.ID, targetPath, err)
+			return
+		}
 	} else {
-		// Single file download with Range support for resumable downloads
+		// Single file download with Range support for resumable downloads. One-time links
+		// always send the whole file, since a range would not use up the link.
 		opts := &fileops.TransferOptions{
 			ForceDownload: true,
 			Filename:      filepath.Base(targetPath),
+			WholeFile:     link.IsOneTime(),
 		}
 		if err := fileops.ServeFileWithRange(w, r, targetPath, opts); err != nil {
 			if os.IsNotExist(err) {
-				http.Error(w, "File not found", http.StatusNotFound)
+				apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+			} else if burned {
+				log.Printf("Share link %s: download failed after the link burned, keeping %s: %v", link.ID, targetPath, err)
 			} else {
-				http.Error(w, "Cannot serve file", http.StatusInternalServerError)
+				apierror.Error(w, "Cannot serve file", http.StatusInternalServerError)
 			}
+			return
 		}
+		if burned {
+			h.deleteBurnedFile(link)
+		}
+	}
+}
+
+// shareBurnMu serializes the download bookkeeping of one-time links
+var shareBurnMu sync.Mutex
+
+// claimOneTimeDownload counts a download of a one-time link before it is served and burns the
+// link once enough client IPs have downloaded it. It returns false when the link burned before
+// this download, and whether this download burned it.
+func (h *PublicHandler) claimOneTimeDownload(r *http.Request, link *models.ShareLink) (ok, burned bool) {
+	shareBurnMu.Lock()
+	defer shareBurnMu.Unlock()
+
+	// Another download may have burned the link since it was looked up
+	current, err := h.store.GetShareLink(link.ID)
+	if err != nil || current.BurnedAt != nil {
+		return false, false
+	}
+
+	ip := getClientIP(r)
+	ips := current.DownloadIPs
+	if !slices.Contains(ips, ip) {
+		ips = append(ips, ip)
+		if err := h.store.SetShareLinkDownloadIPs(link.ID, ips); err != nil {
+			log.Printf("Share link %s: failed to record download: %v", link.ID, err)
+		}
+	}
+	if len(ips) < max(current.BurnAfterIPs, 1) {
+		return true, false
+	}
+
+	// Burning only matches a link that has not burned, so a single download gets to burn it
+	if err := h.store.BurnShareLink(link.ID); err != nil {
+		log.Printf("Share link %s: failed to burn: %v", link.ID, err)
+		return false, false
+	}
+	log.Printf("Share link %s burned after downloads from %d client(s)", link.ID, len(ips))
+	publishShareAccessed(r, current, "burned")
+	return true, true
+}
+
+// deleteBurnedFile deletes the shared file of a one-time link that burned if the owner asked
+// for that
+func (h *PublicHandler) deleteBurnedFile(link *models.ShareLink) {
+	if !link.DeleteOnBurn || link.TargetType != "file" {
+		return
+	}
+	fullPath, err := validateSharePath(h.dataDir, link.TargetPath, "")
+	if err != nil {
+		return
+	}
+	if err := checkFileLock(h.store, fullPath, link.OwnerID, false); err != nil {
+		log.Printf("Share link %s: not deleting %s: %v", link.ID, fullPath, err)
+		return
 	}
+	if err := os.Remove(fullPath); err != nil {
+		log.Printf("Share link %s: failed to delete %s: %v", link.ID, fullPath, err)
+		return
+	}
+	unindexPath(h.store, fullPath)
+	log.Printf("Share link %s: deleted %s after the link burned", link.ID, fullPath)
+}
+
+// writeShareZip adds a file, or a folder and everything below it, to a zip archive under name
+// ("" puts the contents of a folder at the top level). Only regular files and folders are added,
+// so symlinks cannot pull files from outside the share into the archive.
+func writeShareZip(zipWriter *zip.Writer, fullPath, name string) error {
+	return filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(fullPath, p)
+		if err != nil {
+			return err
+		}
+		entryName := filepath.ToSlash(filepath.Join(name, rel))
+
+		if d.IsDir() {
+			if entryName != "." {
+				_, err := zipWriter.Create(entryName + "/")
+				return err
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = entryName
+		header.Method = zip.Deflate
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(writer, file)
+		return err
+	})
+}
+
+// publicPreviewTypes are the content types public share previews are served with, by extension.
+// Other files are sent as application/octet-stream.
+var publicPreviewTypes = map[string]string{
+	".txt":  "text/plain",
+	".md":   "text/plain",
+	".json": "text/plain",
+	".xml":  "text/plain",
+	".yaml": "text/plain",
+	".yml":  "text/plain",
+	".log":  "text/plain",
+	".csv":  "text/plain",
+	".html": "text/html",
+	".htm":  "text/html",
+	".css":  "text/css",
+	".js":   "text/javascript",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+	".pdf":  "application/pdf",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
 }
 
 // PreviewPublicFile returns file content for preview
@@ -635,75 +1469,49 @@ func (h *PublicHandler) PreviewPublicFile(w http.ResponseWriter, r *http.Request
 	token := chi.URLParam(r, "token")
 	subPath := r.URL.Query().Get("path")
 
-	link, err := h.store.GetShareLinkByToken(token)
+	link, err := h.findShareLink(token)
 	if err != nil {
-		http.Error(w, "Share not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, "Share not found", nil)
 		return
 	}
 
 	if !link.IsAccessible() {
-		http.Error(w, "Share not available", http.StatusGone)
+		apierror.Write(w, http.StatusGone, apierror.CodeShareUnavailable, "Share not available", nil)
 		return
 	}
 
-	if !link.AllowPreview {
-		http.Error(w, "Preview not allowed", http.StatusForbidden)
+	if !link.AllowPreview || link.IsFileRequest() {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Preview not allowed", nil)
+		return
+	}
+
+	if !link.SelectionAllows(subPath) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
 		return
 	}
 
 	// Validate path securely with symlink resolution
 	targetPath, err := validateSharePath(h.dataDir, link.TargetPath, subPath)
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid path", nil)
 		return
 	}
 
 	info, err := os.Stat(targetPath)
 	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
 		return
 	}
 
 	if info.IsDir() {
-		http.Error(w, "Cannot preview directory", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot preview directory", nil)
 		return
 	}
 
 	// Detect content type
-	ext := strings.ToLower(filepath.Ext(targetPath))
-	contentType := "application/octet-stream"
-
-	switch ext {
-	case ".txt", ".md", ".json", ".xml", ".yaml", ".yml", ".log", ".csv":
-		contentType = "text/plain"
-	case ".html", ".htm":
-		contentType = "text/html"
-	case ".css":
-		contentType = "text/css"
-	case ".js":
-		contentType = "text/javascript"
-	case ".jpg", ".jpeg":
-		contentType = "image/jpeg"
-	case ".png":
-		contentType = "image/png"
-	case ".gif":
-		contentType = "image/gif"
-	case ".webp":
-		contentType = "image/webp"
-	case ".svg":
-		contentType = "image/svg+xml"
-	case ".pdf":
-		contentType = "application/pdf"
-	case ".mp4":
-		contentType = "video/mp4"
-	case ".webm":
-		contentType = "video/webm"
-	case ".mp3":
-		contentType = "audio/mpeg"
-	case ".wav":
-		contentType = "audio/wav"
-	case ".ogg":
-		contentType = "audio/ogg"
+	contentType, ok := publicPreviewTypes[strings.ToLower(filepath.Ext(targetPath))]
+	if !ok {
+		contentType = "application/octet-stream"
 	}
 
 	// Use Range support for media seeking (video/audio)
@@ -714,83 +1522,183 @@ func (h *PublicHandler) PreviewPublicFile(w http.ResponseWriter, r *http.Request
 	}
 	if err := fileops.ServeFileWithRange(w, r, targetPath, opts); err != nil {
 		if os.IsNotExist(err) {
-			http.Error(w, "File not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
 		} else {
-			http.Error(w, "Cannot serve file", http.StatusInternalServerError)
+			apierror.Error(w, "Cannot serve file", http.StatusInternalServerError)
 		}
 	}
 }
 
+// ThumbnailPublicFile returns a scaled-down image of a shared file for galleries, sized by the
+// width, height and quality query parameters like zone previews and cached the same way
+func (h *PublicHandler) ThumbnailPublicFile(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	subPath := r.URL.Query().Get("path")
+
+	link, err := h.findShareLink(token)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, "Share not found", nil)
+		return
+	}
+
+	if !link.IsAccessible() {
+		apierror.Write(w, http.StatusGone, apierror.CodeShareUnavailable, "Share not available", nil)
+		return
+	}
+
+	if !link.AllowPreview || link.IsFileRequest() {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Preview not allowed", nil)
+		return
+	}
+
+	if !link.SelectionAllows(subPath) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		return
+	}
+
+	maxW, maxH, quality, err := parsePreviewOptions(r)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	// Validate path securely with symlink resolution
+	targetPath, err := validateSharePath(h.dataDir, link.TargetPath, subPath)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid path", nil)
+		return
+	}
+
+	if !previewImageExtensions[strings.ToLower(strings.TrimPrefix(filepath.Ext(targetPath), "."))] {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a supported image", nil)
+		return
+	}
+	h.previews.serveLocalPreview(w, r, targetPath, maxW, maxH, quality)
+}
+
 // UploadToPublicShare uploads a file to a shared folder
 func (h *PublicHandler) UploadToPublicShare(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 
-	link, err := h.store.GetShareLinkByToken(token)
+	link, err := h.findShareLink(token)
 	if err != nil {
-		http.Error(w, "Share not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, "Share not found", nil)
 		return
 	}
 
 	if !link.IsAccessible() {
-		http.Error(w, "Share not available", http.StatusGone)
+		apierror.Write(w, http.StatusGone, apierror.CodeShareUnavailable, "Share not available", nil)
 		return
 	}
 
 	if !link.AllowUpload {
-		http.Error(w, "Upload not allowed", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Upload not allowed", nil)
 		return
 	}
 
 	if link.TargetType != "folder" {
-		http.Error(w, "Can only upload to folders", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Can only upload to folders", nil)
+		return
+	}
+
+	if rejectUploadOnBattery(w) {
+		return
+	}
+
+	// Uploads are refused once the link, its owner or its zone used up the monthly transfer cap
+	transfer := h.linkTransferObjects(link)
+	if err := checkTransferCaps(h.store, transfer); err != nil {
+		writeTransferCapError(w, err)
 		return
 	}
+	defer meterUpload(r, transfer)()
 
-	// Parse multipart form (32MB max)
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+	// Parse multipart form, rejecting files beyond the global or link upload limit
+	limit := uploadLimit(h.store, nil, nil)
+	if link.MaxFileSize > 0 && (limit == 0 || link.MaxFileSize < limit) {
+		limit = link.MaxFileSize
+	}
+	limitRequestBody(w, r, limit)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		if isBodyTooLarge(err) {
+			writeUploadTooLarge(w, limit)
+			return
+		}
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Failed to parse form", nil)
 		return
 	}
 
 	subPath := r.FormValue("path")
 	file, header, err := r.FormFile("file")
 	if err != nil {
-		http.Error(w, "No file provided", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "No file provided", nil)
 		return
 	}
 	defer file.Close()
+	if limit > 0 && header.Size > limit {
+		writeUploadTooLarge(w, limit)
+		return
+	}
+
+	// File requests always drop into the chosen folder itself
+	if link.IsFileRequest() {
+		subPath = ""
+	}
 
 	// Validate path securely with symlink resolution
 	targetDir, err := validateSharePath(h.dataDir, link.TargetPath, subPath)
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid path", nil)
 		return
 	}
 
 	// Create directory if needed
 	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		http.Error(w, "Cannot create directory", http.StatusInternalServerError)
+		apierror.Error(w, "Cannot create directory", http.StatusInternalServerError)
 		return
 	}
 
 	// Sanitize the filename to prevent injection attacks
 	safeFilename := fileops.SanitizeFilename(header.Filename)
 	if safeFilename == "" {
-		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid filename", nil)
 		return
 	}
 
-	// Save file
+	// Enforce the link's upload restrictions
+	opts := &fileops.TransferOptions{
+		MaxFileSize: link.MaxFileSize,
+		AllowedExts: link.AllowedExtensions,
+	}
+	if err := fileops.ValidateUpload(safeFilename, header.Size, opts); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	// Save file. Uploaders of a file request cannot see the folder, so they never replace existing files.
 	targetPath := filepath.Join(targetDir, safeFilename)
-	dst, err := os.Create(targetPath)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if link.IsFileRequest() {
+		targetPath = availableFilename(targetDir, safeFilename)
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	dst, err := os.OpenFile(targetPath, flags, 0644)
 	if err != nil {
-		http.Error(w, "Cannot create file", http.StatusInternalServerError)
+		apierror.Error(w, "Cannot create file", http.StatusInternalServerError)
 		return
 	}
 	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+	written, err := io.Copy(dst, file)
+	if err != nil {
+		apierror.Error(w, "Failed to save file", http.StatusInternalServerError)
+		return
+	}
+	dst.Close()
+	safeFilename = filepath.Base(targetPath)
+
+	if err := scanUpload(h.store, targetPath, "", "share link: "+link.Name); err != nil {
+		writeScanError(w, err)
 		return
 	}
 
@@ -808,9 +1716,30 @@ func (h *PublicHandler) UploadToPublicShare(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
+	if link.NotifyOnUpload {
+		publishShareUploadReceived(r, link, safeFilename, written)
+		notifyShareOwner(h.store, link, fmt.Sprintf("New file received on \"%s\"", link.Name),
+			fmt.Sprintf("\"%s\" (%d bytes) was uploaded to your share link \"%s\" from %s at %s.\n",
+				safeFilename, written, link.Name, getClientIP(r), time.Now().Format(time.RFC1123)))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"message":  "File uploaded successfully",
 		"filename": safeFilename,
 	})
 }
+
+// availableFilename returns a path in dir for name that does not exist yet,
+// appending " (1)", " (2)", ... before the extension when needed
+func availableFilename(dir, name string) string {
+	candidate := filepath.Join(dir, name)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext))
+	}
+}
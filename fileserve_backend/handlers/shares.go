@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"fileserv/internal/apierror"
 	"fileserv/models"
 	"fileserv/storage"
 
@@ -79,13 +80,13 @@ func GetShare(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
-			http.Error(w, "Share ID is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Share ID is required", nil)
 			return
 		}
 
 		share, err := store.GetShare(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, err.Error(), nil)
 			return
 		}
 
@@ -99,45 +100,45 @@ func CreateShare(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateShareRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request: "+err.Error(), nil)
 			return
 		}
 
 		// Validate required fields
 		if req.Name == "" {
-			http.Error(w, "Share name is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Share name is required", nil)
 			return
 		}
 
 		if req.Path == "" {
-			http.Error(w, "Share path is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Share path is required", nil)
 			return
 		}
 
 		if req.Protocol != "smb" && req.Protocol != "nfs" {
-			http.Error(w, "Protocol must be 'smb' or 'nfs'", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Protocol must be 'smb' or 'nfs'", nil)
 			return
 		}
 
 		// Validate path exists and is accessible
 		absPath, err := filepath.Abs(req.Path)
 		if err != nil {
-			http.Error(w, "Invalid path: "+err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid path: "+err.Error(), nil)
 			return
 		}
 
 		info, err := os.Stat(absPath)
 		if err != nil {
 			if os.IsNotExist(err) {
-				http.Error(w, "Path does not exist", http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Path does not exist", nil)
 				return
 			}
-			http.Error(w, "Cannot access path: "+err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot access path: "+err.Error(), nil)
 			return
 		}
 
 		if !info.IsDir() {
-			http.Error(w, "Path must be a directory", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Path must be a directory", nil)
 			return
 		}
 
@@ -199,7 +200,9 @@ func CreateShare(store storage.DataStore) http.HandlerFunc {
 
 		created, err := store.CreateShare(share)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			if !writeNameConflict(w, err) {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			}
 			return
 		}
 
@@ -214,20 +217,20 @@ func UpdateShare(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
-			http.Error(w, "Share ID is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Share ID is required", nil)
 			return
 		}
 
 		var req UpdateShareRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request: "+err.Error(), nil)
 			return
 		}
 
 		// Get existing share
 		share, err := store.GetShare(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, err.Error(), nil)
 			return
 		}
 
@@ -239,16 +242,16 @@ func UpdateShare(store storage.DataStore) http.HandlerFunc {
 			// Validate new path
 			absPath, err := filepath.Abs(*req.Path)
 			if err != nil {
-				http.Error(w, "Invalid path: "+err.Error(), http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid path: "+err.Error(), nil)
 				return
 			}
 			info, err := os.Stat(absPath)
 			if err != nil {
-				http.Error(w, "Cannot access path: "+err.Error(), http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot access path: "+err.Error(), nil)
 				return
 			}
 			if !info.IsDir() {
-				http.Error(w, "Path must be a directory", http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Path must be a directory", nil)
 				return
 			}
 			share.Path = absPath
@@ -312,7 +315,9 @@ func UpdateShare(store storage.DataStore) http.HandlerFunc {
 
 		updated, err := store.UpdateShare(id, updates)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			if !writeNameConflict(w, err) {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			}
 			return
 		}
 
@@ -350,12 +355,12 @@ func DeleteShare(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
-			http.Error(w, "Share ID is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Share ID is required", nil)
 			return
 		}
 
 		if err := store.DeleteShare(id); err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, err.Error(), nil)
 			return
 		}
 
@@ -368,7 +373,7 @@ func AddShareAccess(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
-			http.Error(w, "Share ID is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Share ID is required", nil)
 			return
 		}
 
@@ -379,18 +384,18 @@ func AddShareAccess(store storage.DataStore) http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request: "+err.Error(), nil)
 			return
 		}
 
 		if req.Username == "" && req.GroupName == "" {
-			http.Error(w, "Username or group_name is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username or group_name is required", nil)
 			return
 		}
 
 		share, err := store.GetShare(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, err.Error(), nil)
 			return
 		}
 
@@ -443,7 +448,7 @@ func AddShareAccess(store storage.DataStore) http.HandlerFunc {
 
 		updated, err := store.UpdateShare(id, updates)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -457,7 +462,7 @@ func RemoveShareAccess(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
-			http.Error(w, "Share ID is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Share ID is required", nil)
 			return
 		}
 
@@ -467,18 +472,18 @@ func RemoveShareAccess(store storage.DataStore) http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request: "+err.Error(), nil)
 			return
 		}
 
 		if req.Username == "" && req.GroupName == "" {
-			http.Error(w, "Username or group_name is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username or group_name is required", nil)
 			return
 		}
 
 		share, err := store.GetShare(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeShareNotFound, err.Error(), nil)
 			return
 		}
 
@@ -524,7 +529,7 @@ func RemoveShareAccess(store storage.DataStore) http.HandlerFunc {
 
 		updated, err := store.UpdateShare(id, updates)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
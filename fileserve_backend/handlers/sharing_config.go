@@ -1,14 +1,16 @@
 package handlers
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 
+	"fileserv/internal/sysconf"
 	"fileserv/models"
+	"fileserv/storage"
 )
 
 const (
@@ -20,28 +22,19 @@ const (
 
 // GenerateSMBShareConfig generates a Samba share configuration for a zone
 func GenerateSMBShareConfig(zone *models.ShareZone, fullPath string) string {
-	if zone.SMBOptions == nil {
-		return ""
-	}
-
-	opts := zone.SMBOptions
-	shareName := opts.ShareName
-	if shareName == "" {
-		shareName = zone.Name
+	opts := &models.ZoneSMBOptions{}
+	if zone.SMBOptions != nil {
+		opts = zone.SMBOptions
 	}
 
-	// Sanitize share name (no special characters)
-	shareName = strings.ReplaceAll(shareName, " ", "_")
-	shareName = strings.ReplaceAll(shareName, "/", "_")
-
 	var config strings.Builder
-	config.WriteString(fmt.Sprintf("\n[%s]\n", shareName))
-	config.WriteString(fmt.Sprintf("   path = %s\n", fullPath))
+	config.WriteString(fmt.Sprintf("\n[%s]\n", smbShareName(zone)))
+	config.WriteString(fmt.Sprintf("   path = %s\n", smbConfValue(fullPath)))
 
 	if opts.Comment != "" {
-		config.WriteString(fmt.Sprintf("   comment = %s\n", opts.Comment))
+		config.WriteString(fmt.Sprintf("   comment = %s\n", smbConfValue(opts.Comment)))
 	} else {
-		config.WriteString(fmt.Sprintf("   comment = %s\n", zone.Description))
+		config.WriteString(fmt.Sprintf("   comment = %s\n", smbConfValue(zone.Description)))
 	}
 
 	// Browsability
@@ -70,40 +63,40 @@ func GenerateSMBShareConfig(zone *models.ShareZone, fullPath string) string {
 	// Valid users - combine zone allowed users/groups with SMB-specific settings
 	validUsers := buildValidUsersList(zone, opts)
 	if validUsers != "" {
-		config.WriteString(fmt.Sprintf("   valid users = %s\n", validUsers))
+		config.WriteString(fmt.Sprintf("   valid users = %s\n", smbConfValue(validUsers)))
 	}
 
 	// Invalid users
 	if opts.InvalidUsers != "" {
-		config.WriteString(fmt.Sprintf("   invalid users = %s\n", opts.InvalidUsers))
+		config.WriteString(fmt.Sprintf("   invalid users = %s\n", smbConfValue(opts.InvalidUsers)))
 	}
 
 	// Write list
 	if opts.WriteList != "" {
-		config.WriteString(fmt.Sprintf("   write list = %s\n", opts.WriteList))
+		config.WriteString(fmt.Sprintf("   write list = %s\n", smbConfValue(opts.WriteList)))
 	}
 
 	// Read list
 	if opts.ReadList != "" {
-		config.WriteString(fmt.Sprintf("   read list = %s\n", opts.ReadList))
+		config.WriteString(fmt.Sprintf("   read list = %s\n", smbConfValue(opts.ReadList)))
 	}
 
 	// Force user/group
 	if opts.ForceUser != "" {
-		config.WriteString(fmt.Sprintf("   force user = %s\n", opts.ForceUser))
+		config.WriteString(fmt.Sprintf("   force user = %s\n", smbConfValue(opts.ForceUser)))
 	}
 	if opts.ForceGroup != "" {
-		config.WriteString(fmt.Sprintf("   force group = %s\n", opts.ForceGroup))
+		config.WriteString(fmt.Sprintf("   force group = %s\n", smbConfValue(opts.ForceGroup)))
 	}
 
 	// File masks - use sensible defaults for Windows compatibility if not set
-	createMask := opts.CreateMask
+	createMask := smbConfValue(opts.CreateMask)
 	if createMask == "" {
 		createMask = "0664" // rw-rw-r-- default for files
 	}
 	config.WriteString(fmt.Sprintf("   create mask = %s\n", createMask))
 
-	directoryMask := opts.DirectoryMask
+	directoryMask := smbConfValue(opts.DirectoryMask)
 	if directoryMask == "" {
 		directoryMask = "0775" // rwxrwxr-x default for directories
 	}
@@ -120,12 +113,45 @@ func GenerateSMBShareConfig(zone *models.ShareZone, fullPath string) string {
 
 	// Veto files
 	if opts.VetoFiles != "" {
-		config.WriteString(fmt.Sprintf("   veto files = %s\n", opts.VetoFiles))
+		config.WriteString(fmt.Sprintf("   veto files = %s\n", smbConfValue(opts.VetoFiles)))
+	}
+
+	// Time Machine target - vfs_fruit provides the Apple SMB extensions macOS requires,
+	// durable handles let backups survive short network drops
+	if opts.TimeMachine {
+		config.WriteString("   vfs objects = catia fruit streams_xattr\n")
+		config.WriteString("   fruit:time machine = yes\n")
+		if maxSize := smbConfValue(opts.TimeMachineMaxSize); maxSize != "" {
+			config.WriteString(fmt.Sprintf("   fruit:time machine max size = %s\n", maxSize))
+		}
+		config.WriteString("   fruit:metadata = stream\n")
+		config.WriteString("   fruit:posix_rename = yes\n")
+		config.WriteString("   ea support = yes\n")
+		config.WriteString("   durable handles = yes\n")
+		config.WriteString("   kernel oplocks = no\n")
+		config.WriteString("   kernel share modes = no\n")
+		config.WriteString("   posix locking = no\n")
 	}
 
 	return config.String()
 }
 
+// smbShareName returns the section name of a zone's SMB share
+func smbShareName(zone *models.ShareZone) string {
+	shareName := zone.Name
+	if zone.SMBOptions != nil && zone.SMBOptions.ShareName != "" {
+		shareName = zone.SMBOptions.ShareName
+	}
+
+	// Sanitize share name (no special characters)
+	return strings.NewReplacer(" ", "_", "/", "_", "[", "_", "]", "_").Replace(smbConfValue(shareName))
+}
+
+// smbConfValue removes line breaks from a value so it cannot start a new parameter or section
+func smbConfValue(value string) string {
+	return strings.TrimSpace(strings.NewReplacer("\r", " ", "\n", " ").Replace(value))
+}
+
 // buildValidUsersList builds the valid users directive from zone settings
 func buildValidUsersList(zone *models.ShareZone, opts *models.ZoneSMBOptions) string {
 	var parts []string
@@ -159,109 +185,188 @@ func GenerateNFSExportConfig(zone *models.ShareZone, fullPath string) string {
 	}
 
 	opts := zone.NFSOptions
-	exportPath := fullPath
-	if opts.ExportPath != "" {
-		exportPath = opts.ExportPath
-	}
+	exportPath := zoneExportPath(zone, fullPath)
 
-	// Build options string
-	var optionsList []string
+	// Build export lines for each allowed client
+	var exports strings.Builder
+	for _, client := range zoneNFSClients(zone) {
+		optionsList := []string{"rw"}
+		if client.ReadOnly {
+			optionsList = []string{"ro"}
+		}
 
-	if !zone.ReadOnly {
-		optionsList = append(optionsList, "rw")
-	} else {
-		optionsList = append(optionsList, "ro")
-	}
+		if opts.Sync {
+			optionsList = append(optionsList, "sync")
+		} else {
+			optionsList = append(optionsList, "async")
+		}
 
-	if opts.Sync {
-		optionsList = append(optionsList, "sync")
-	} else {
-		optionsList = append(optionsList, "async")
-	}
+		if client.RootSquash {
+			optionsList = append(optionsList, "root_squash")
+		} else {
+			optionsList = append(optionsList, "no_root_squash")
+		}
 
-	if opts.RootSquash {
-		optionsList = append(optionsList, "root_squash")
-	} else {
-		optionsList = append(optionsList, "no_root_squash")
-	}
+		if opts.AllSquash {
+			optionsList = append(optionsList, "all_squash")
+		}
 
-	if opts.AllSquash {
-		optionsList = append(optionsList, "all_squash")
-	}
+		if opts.NoSubtreeCheck {
+			optionsList = append(optionsList, "no_subtree_check")
+		} else {
+			optionsList = append(optionsList, "subtree_check")
+		}
 
-	if opts.NoSubtreeCheck {
-		optionsList = append(optionsList, "no_subtree_check")
-	} else {
-		optionsList = append(optionsList, "subtree_check")
-	}
+		if opts.Secure {
+			optionsList = append(optionsList, "secure")
+		} else {
+			optionsList = append(optionsList, "insecure")
+		}
 
-	if opts.Secure {
-		optionsList = append(optionsList, "secure")
-	} else {
-		optionsList = append(optionsList, "insecure")
-	}
+		if opts.AnonUID > 0 {
+			optionsList = append(optionsList, fmt.Sprintf("anonuid=%d", opts.AnonUID))
+		}
+		if opts.AnonGID > 0 {
+			optionsList = append(optionsList, fmt.Sprintf("anongid=%d", opts.AnonGID))
+		}
+		if opts.FSId != "" {
+			optionsList = append(optionsList, fmt.Sprintf("fsid=%s", opts.FSId))
+		}
 
-	if opts.AnonUID > 0 {
-		optionsList = append(optionsList, fmt.Sprintf("anonuid=%d", opts.AnonUID))
-	}
-	if opts.AnonGID > 0 {
-		optionsList = append(optionsList, fmt.Sprintf("anongid=%d", opts.AnonGID))
+		// Client-specific options override the zone-wide ones
+		optionsList = mergeNFSOptions(optionsList, client.Options)
+
+		exports.WriteString(fmt.Sprintf("%s %s(%s)\n", exportPath, client.Host, strings.Join(optionsList, ",")))
 	}
-	if opts.FSId != "" {
-		optionsList = append(optionsList, fmt.Sprintf("fsid=%s", opts.FSId))
+
+	return exports.String()
+}
+
+// zoneExportPath returns the directory exported for a zone
+func zoneExportPath(zone *models.ShareZone, fullPath string) string {
+	if zone.NFSOptions != nil && zone.NFSOptions.ExportPath != "" {
+		return zone.NFSOptions.ExportPath
 	}
+	return fullPath
+}
 
-	optionsStr := strings.Join(optionsList, ",")
+// zoneNFSClients returns the clients a zone is exported to. Zones without per-client
+// settings export to every allowed host with the zone-wide options.
+func zoneNFSClients(zone *models.ShareZone) []models.NFSExportClient {
+	opts := zone.NFSOptions
+	if len(opts.Clients) > 0 {
+		clients := make([]models.NFSExportClient, len(opts.Clients))
+		for i, client := range opts.Clients {
+			client.ReadOnly = client.ReadOnly || zone.ReadOnly
+			clients[i] = client
+		}
+		return clients
+	}
 
-	// Build export lines for each allowed host
-	var exports strings.Builder
 	hosts := opts.AllowedHosts
 	if len(hosts) == 0 {
 		hosts = []string{"*"}
 	}
-
+	clients := make([]models.NFSExportClient, 0, len(hosts))
 	for _, host := range hosts {
-		exports.WriteString(fmt.Sprintf("%s %s(%s)\n", exportPath, host, optionsStr))
+		clients = append(clients, models.NFSExportClient{
+			Host:       host,
+			ReadOnly:   zone.ReadOnly,
+			RootSquash: opts.RootSquash,
+		})
 	}
+	return clients
+}
 
-	return exports.String()
+// mergeNFSOptions appends extra export options, replacing base options they contradict
+// (e.g. "async" replaces "sync", "anonuid=0" replaces "anonuid=65534")
+func mergeNFSOptions(base, extra []string) []string {
+	for _, option := range extra {
+		key, _, _ := strings.Cut(option, "=")
+		merged := base[:0]
+		for _, existing := range base {
+			existingKey, _, _ := strings.Cut(existing, "=")
+			if existingKey == key || nfsOptionOpposite(existingKey) == key {
+				continue
+			}
+			merged = append(merged, existing)
+		}
+		base = append(merged, option)
+	}
+	return base
 }
 
-// ApplySMBConfig writes all zone SMB configurations to the Samba config
-func ApplySMBConfig(zones []*models.ShareZone, pools map[string]*models.StoragePool) error {
+// smbConfigMu serializes regeneration of the Samba share configuration
+var smbConfigMu sync.Mutex
+
+// RenderSMBConfig generates the share sections for every zone shared over SMB
+func RenderSMBConfig(zones []*models.ShareZone, pools map[string]*models.StoragePool) string {
 	var config strings.Builder
 	config.WriteString("# FileServ managed shares - DO NOT EDIT MANUALLY\n")
 	config.WriteString("# This file is auto-generated by FileServ\n\n")
 
 	for _, zone := range zones {
-		if !zone.SMBEnabled || zone.SMBOptions == nil {
+		if !zone.SMBEnabled || !zone.Enabled {
 			continue
 		}
 
 		pool, ok := pools[zone.PoolID]
-		if !ok || !pool.Enabled {
+		if !ok || !pool.Enabled || pool.IsS3() {
 			continue
 		}
 
 		fullPath := filepath.Join(pool.Path, zone.Path)
-		shareConfig := GenerateSMBShareConfig(zone, fullPath)
-		if shareConfig != "" {
-			config.WriteString(shareConfig)
-		}
+		config.WriteString(GenerateSMBShareConfig(zone, fullPath))
 	}
 
+	return config.String()
+}
+
+// ApplySMBConfig writes all zone SMB configurations to the Samba config. The previous
+// configuration is restored if testparm rejects the result, so smbd is only reloaded
+// with a configuration that loads.
+func ApplySMBConfig(zones []*models.ShareZone, pools map[string]*models.StoragePool) error {
 	// Write to fileserv-shares.conf
-	if err := os.WriteFile(fileservSharesFile, []byte(config.String()), 0644); err != nil {
+	if err := sysconf.WriteFile(fileservSharesFile, []byte(RenderSMBConfig(zones, pools)), 0644); err != nil {
 		return fmt.Errorf("failed to write SMB config: %w", err)
 	}
 
 	// Ensure the include directive is in smb.conf
 	if err := ensureSMBInclude(); err != nil {
+		sysconf.Restore(fileservSharesFile)
 		return fmt.Errorf("failed to update smb.conf include: %w", err)
 	}
 
+	// Validate the result before Samba picks it up
+	if _, err := exec.LookPath("testparm"); err == nil {
+		if output, err := TestSambaConfig(); err != nil {
+			sysconf.Restore(fileservSharesFile)
+			return fmt.Errorf("testparm rejected the generated configuration: %s", strings.TrimSpace(output))
+		}
+	}
+
 	// Reload Samba configuration
-	return reloadSamba()
+	if err := reloadSamba(); err != nil {
+		return err
+	}
+
+	// Advertise Time Machine shares to macOS clients
+	if err := writeTimeMachineService(zones, pools); err != nil {
+		return fmt.Errorf("failed to update Time Machine advertisement: %w", err)
+	}
+	return nil
+}
+
+// SyncSMBConfig regenerates the Samba shares of all zones from the store
+func SyncSMBConfig(store storage.DataStore) error {
+	smbConfigMu.Lock()
+	defer smbConfigMu.Unlock()
+
+	pools := make(map[string]*models.StoragePool)
+	for _, pool := range store.ListStoragePools() {
+		pools[pool.ID] = pool
+	}
+	return ApplySMBConfig(store.ListShareZones(), pools)
 }
 
 // ensureSMBInclude adds the include directive to smb.conf if not present
@@ -273,7 +378,7 @@ func ensureSMBInclude() error {
 		if os.IsNotExist(err) {
 			// Create minimal smb.conf if it doesn't exist
 			minimalConf := fmt.Sprintf("[global]\n   workgroup = WORKGROUP\n   server string = FileServ\n   security = user\n   map to guest = bad user\n\n%s\n", includeDirective)
-			return os.WriteFile(smbConfPath, []byte(minimalConf), 0644)
+			return sysconf.WriteFile(smbConfPath, []byte(minimalConf), 0644)
 		}
 		return err
 	}
@@ -314,7 +419,7 @@ func ensureSMBInclude() error {
 		newLines = append(newLines, "", includeDirective)
 	}
 
-	return os.WriteFile(smbConfPath, []byte(strings.Join(newLines, "\n")), 0644)
+	return sysconf.WriteFile(smbConfPath, []byte(strings.Join(newLines, "\n")), 0644)
 }
 
 // reloadSamba reloads the Samba configuration
@@ -336,47 +441,64 @@ func reloadSamba() error {
 	return cmd.Run()
 }
 
-// ApplyNFSConfig writes all zone NFS exports
-func ApplyNFSConfig(zones []*models.ShareZone, pools map[string]*models.StoragePool) error {
+// nfsConfigMu serializes changes to the NFS exports files
+var nfsConfigMu sync.Mutex
+
+// RenderNFSExports generates the export lines for every zone shared over NFS
+func RenderNFSExports(zones []*models.ShareZone, pools map[string]*models.StoragePool) string {
 	var exports strings.Builder
 	exports.WriteString("# FileServ managed exports - DO NOT EDIT MANUALLY\n")
 	exports.WriteString("# This file is auto-generated by FileServ\n\n")
 
 	for _, zone := range zones {
-		if !zone.NFSEnabled || zone.NFSOptions == nil {
+		if !zone.NFSEnabled || zone.NFSOptions == nil || !zone.Enabled {
 			continue
 		}
 
 		pool, ok := pools[zone.PoolID]
-		if !ok || !pool.Enabled {
+		if !ok || !pool.Enabled || pool.IsS3() {
 			continue
 		}
 
 		fullPath := filepath.Join(pool.Path, zone.Path)
-		exportConfig := GenerateNFSExportConfig(zone, fullPath)
-		if exportConfig != "" {
-			exports.WriteString(exportConfig)
-		}
+		exports.WriteString(GenerateNFSExportConfig(zone, fullPath))
 	}
 
-	// Ensure exports.d directory exists
-	exportsDir := filepath.Dir(fileservExportsFile)
-	if err := os.MkdirAll(exportsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create exports.d directory: %w", err)
-	}
+	return exports.String()
+}
 
+// ApplyNFSConfig writes all zone NFS exports. The previous exports are restored if exportfs rejects the result.
+func ApplyNFSConfig(zones []*models.ShareZone, pools map[string]*models.StoragePool) error {
 	// Write to fileserv.exports
-	if err := os.WriteFile(fileservExportsFile, []byte(exports.String()), 0644); err != nil {
+	if err := sysconf.WriteFile(fileservExportsFile, []byte(RenderNFSExports(zones, pools)), 0644); err != nil {
 		return fmt.Errorf("failed to write NFS exports: %w", err)
 	}
 
 	// Ensure /etc/exports includes exports.d
 	if err := ensureNFSInclude(); err != nil {
+		sysconf.Restore(fileservExportsFile)
 		return fmt.Errorf("failed to update /etc/exports: %w", err)
 	}
 
 	// Re-export all filesystems
-	return reloadNFS()
+	if err := reloadNFS(); err != nil {
+		sysconf.Restore(fileservExportsFile)
+		reloadNFS()
+		return fmt.Errorf("exportfs rejected the generated exports: %w", err)
+	}
+	return nil
+}
+
+// SyncNFSConfig regenerates the NFS exports of all zones from the store
+func SyncNFSConfig(store storage.DataStore) error {
+	nfsConfigMu.Lock()
+	defer nfsConfigMu.Unlock()
+
+	pools := make(map[string]*models.StoragePool)
+	for _, pool := range store.ListStoragePools() {
+		pools[pool.ID] = pool
+	}
+	return ApplyNFSConfig(store.ListShareZones(), pools)
 }
 
 // ensureNFSInclude ensures /etc/exports includes exports.d files
@@ -385,7 +507,7 @@ func ensureNFSInclude() error {
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Create with include
-			return os.WriteFile(nfsExportsPath, []byte("# See exports.d for additional exports\n"), 0644)
+			return sysconf.WriteFile(nfsExportsPath, []byte("# See exports.d for additional exports\n"), 0644)
 		}
 		return err
 	}
@@ -397,199 +519,55 @@ func ensureNFSInclude() error {
 
 	// Append a comment about exports.d
 	newContent := string(content) + "\n# Additional exports are in /etc/exports.d/\n"
-	return os.WriteFile(nfsExportsPath, []byte(newContent), 0644)
+	return sysconf.WriteFile(nfsExportsPath, []byte(newContent), 0644)
 }
 
 // reloadNFS re-exports all NFS filesystems
 func reloadNFS() error {
 	// exportfs -ra re-exports all entries
-	cmd := exec.Command("sudo", "exportfs", "-ra")
-	return cmd.Run()
-}
-
-// ApplySingleZoneSMB adds/updates a single zone's SMB share
-func ApplySingleZoneSMB(zone *models.ShareZone, fullPath string) error {
-	if !zone.SMBEnabled || zone.SMBOptions == nil {
-		// If SMB is disabled, remove the share
-		return RemoveZoneSMB(zone)
-	}
-
-	// Ensure the directory exists
-	if err := EnsureDirectoryExists(fullPath); err != nil {
-		return fmt.Errorf("failed to ensure directory exists: %w", err)
-	}
-
-	// Set directory ownership based on zone settings
-	if err := SetDirectoryOwnership(fullPath, zone); err != nil {
-		// Log but don't fail - the share might still work
-		fmt.Printf("Warning: failed to set directory ownership for %s: %v\n", fullPath, err)
-	}
-
-	// Read existing shares file
-	content, err := os.ReadFile(fileservSharesFile)
-	if err != nil && !os.IsNotExist(err) {
-		return err
-	}
-
-	shareName := zone.SMBOptions.ShareName
-	if shareName == "" {
-		shareName = zone.Name
-	}
-	shareName = strings.ReplaceAll(shareName, " ", "_")
-	shareName = strings.ReplaceAll(shareName, "/", "_")
-
-	// Remove existing share for this zone
-	newContent := removeShareSection(string(content), shareName)
-
-	// Add the new share config
-	shareConfig := GenerateSMBShareConfig(zone, fullPath)
-	newContent += shareConfig
-
-	// Write back
-	if err := os.WriteFile(fileservSharesFile, []byte(newContent), 0644); err != nil {
-		return err
-	}
-
-	// Ensure include and reload
-	if err := ensureSMBInclude(); err != nil {
-		return err
-	}
-
-	return reloadSamba()
-}
-
-// RemoveZoneSMB removes a zone's SMB share
-func RemoveZoneSMB(zone *models.ShareZone) error {
-	content, err := os.ReadFile(fileservSharesFile)
+	output, err := exec.Command("sudo", "exportfs", "-ra").CombinedOutput()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // Nothing to remove
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s: %w", msg, err)
 		}
 		return err
 	}
-
-	shareName := zone.Name
-	if zone.SMBOptions != nil && zone.SMBOptions.ShareName != "" {
-		shareName = zone.SMBOptions.ShareName
-	}
-	shareName = strings.ReplaceAll(shareName, " ", "_")
-	shareName = strings.ReplaceAll(shareName, "/", "_")
-
-	newContent := removeShareSection(string(content), shareName)
-
-	if err := os.WriteFile(fileservSharesFile, []byte(newContent), 0644); err != nil {
-		return err
-	}
-
-	return reloadSamba()
+	return nil
 }
 
-// removeShareSection removes a [sharename] section from smb.conf format
-func removeShareSection(content, shareName string) string {
-	lines := strings.Split(content, "\n")
-	var result []string
-	inTargetSection := false
-	sectionHeader := fmt.Sprintf("[%s]", shareName)
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		if strings.EqualFold(trimmed, sectionHeader) {
-			inTargetSection = true
-			continue
+// ApplySingleZoneSMB prepares the directory of a zone shared over SMB and regenerates the Samba shares
+func ApplySingleZoneSMB(store storage.DataStore, zone *models.ShareZone, fullPath string) error {
+	if zone.SMBEnabled {
+		// Ensure the directory exists
+		if err := EnsureDirectoryExists(fullPath); err != nil {
+			return fmt.Errorf("failed to ensure directory exists: %w", err)
 		}
 
-		if inTargetSection && strings.HasPrefix(trimmed, "[") {
-			// We've hit a new section, stop skipping
-			inTargetSection = false
-		}
-
-		if !inTargetSection {
-			result = append(result, line)
+		// Set directory ownership based on zone settings
+		if err := SetDirectoryOwnership(fullPath, zone); err != nil {
+			// Log but don't fail - the share might still work
+			fmt.Printf("Warning: failed to set directory ownership for %s: %v\n", fullPath, err)
 		}
 	}
 
-	return strings.Join(result, "\n")
+	return SyncSMBConfig(store)
 }
 
-// ApplySingleZoneNFS adds/updates a single zone's NFS export
-func ApplySingleZoneNFS(zone *models.ShareZone, fullPath string) error {
-	if !zone.NFSEnabled || zone.NFSOptions == nil {
-		return RemoveZoneNFS(zone)
-	}
-
-	// Ensure the directory exists
-	if err := EnsureDirectoryExists(fullPath); err != nil {
-		return fmt.Errorf("failed to ensure directory exists: %w", err)
-	}
-
-	// Set directory ownership based on zone settings (also applies to NFS)
-	if err := SetDirectoryOwnership(fullPath, zone); err != nil {
-		fmt.Printf("Warning: failed to set directory ownership for %s: %v\n", fullPath, err)
-	}
-
-	// Read existing exports
-	content, err := os.ReadFile(fileservExportsFile)
-	if err != nil && !os.IsNotExist(err) {
-		return err
-	}
-
-	// Remove existing exports for this path
-	newContent := removeNFSExport(string(content), fullPath)
-
-	// Add new export
-	exportConfig := GenerateNFSExportConfig(zone, fullPath)
-	newContent += exportConfig
-
-	// Write back
-	if err := os.WriteFile(fileservExportsFile, []byte(newContent), 0644); err != nil {
-		return err
-	}
-
-	if err := ensureNFSInclude(); err != nil {
-		return err
-	}
-
-	return reloadNFS()
-}
-
-// RemoveZoneNFS removes a zone's NFS export
-func RemoveZoneNFS(zone *models.ShareZone) error {
-	content, err := os.ReadFile(fileservExportsFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+// ApplySingleZoneNFS prepares the directory of a zone exported over NFS and regenerates the zone exports
+func ApplySingleZoneNFS(store storage.DataStore, zone *models.ShareZone, fullPath string) error {
+	if zone.NFSEnabled {
+		// Ensure the directory exists
+		if err := EnsureDirectoryExists(fullPath); err != nil {
+			return fmt.Errorf("failed to ensure directory exists: %w", err)
 		}
-		return err
-	}
-
-	// We need the full path to remove the export
-	// Since we don't have it here, we'll need to match by zone path pattern
-	// For now, this is a simplified version
-	newContent := string(content) // TODO: implement proper removal
-
-	if err := os.WriteFile(fileservExportsFile, []byte(newContent), 0644); err != nil {
-		return err
-	}
-
-	return reloadNFS()
-}
 
-// removeNFSExport removes export lines for a given path
-func removeNFSExport(content, path string) string {
-	var result []string
-	scanner := bufio.NewScanner(strings.NewReader(content))
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		// Skip lines that start with this path
-		if !strings.HasPrefix(strings.TrimSpace(line), path+" ") &&
-			!strings.HasPrefix(strings.TrimSpace(line), path+"\t") {
-			result = append(result, line)
+		// Set directory ownership based on zone settings (also applies to NFS)
+		if err := SetDirectoryOwnership(fullPath, zone); err != nil {
+			fmt.Printf("Warning: failed to set directory ownership for %s: %v\n", fullPath, err)
 		}
 	}
 
-	return strings.Join(result, "\n")
+	return SyncNFSConfig(store)
 }
 
 // TestSambaConfig runs testparm to validate Samba configuration
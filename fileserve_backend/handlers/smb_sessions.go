@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"fileserv/internal/apierror"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// smbSessionExitTimeout is how long to wait for a session process to exit after asking it to shut down
+const smbSessionExitTimeout = 5 * time.Second
+
+// smbSessionProcesses returns the smbd child processes currently serving client sessions, keyed by PID.
+// Only these PIDs may be terminated so the request can never signal the main smbd daemon or an unrelated process.
+func smbSessionProcesses() (map[int]SMBConnection, error) {
+	if _, err := exec.LookPath("smbstatus"); err != nil {
+		return nil, errors.New("smbstatus command not available (Samba not installed)")
+	}
+
+	output, err := exec.Command("smbstatus", "-p", "--json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("smbstatus failed: %w", err)
+	}
+
+	var sessionsData struct {
+		Sessions map[string]struct {
+			ServerID struct {
+				PID string `json:"pid"`
+			} `json:"server_id"`
+			Username      string `json:"username"`
+			RemoteMachine string `json:"remote_machine"`
+			Hostname      string `json:"hostname"`
+		} `json:"sessions"`
+	}
+	if err := json.Unmarshal(output, &sessionsData); err != nil {
+		return nil, fmt.Errorf("failed to parse smbstatus output: %w", err)
+	}
+
+	sessions := make(map[int]SMBConnection)
+	for _, sess := range sessionsData.Sessions {
+		pid, err := strconv.Atoi(sess.ServerID.PID)
+		if err != nil || pid <= 1 {
+			continue
+		}
+		sessions[pid] = SMBConnection{
+			PID:       pid,
+			Username:  sess.Username,
+			Machine:   sess.Hostname,
+			IPAddress: sess.RemoteMachine,
+		}
+	}
+	return sessions, nil
+}
+
+// smbOpenFileHolders returns the PIDs of the sessions holding a file open, identified by its share path and name
+func smbOpenFileHolders(sharePath, name string) ([]int, error) {
+	output, err := exec.Command("smbstatus", "-L", "--json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("smbstatus failed: %w", err)
+	}
+
+	var locksData struct {
+		OpenFiles map[string]struct {
+			ServicePath string `json:"service_path"`
+			Filename    string `json:"filename"`
+			Opens       map[string]struct {
+				ServerID struct {
+					PID string `json:"pid"`
+				} `json:"server_id"`
+			} `json:"opens"`
+		} `json:"open_files"`
+	}
+	if err := json.Unmarshal(output, &locksData); err != nil {
+		return nil, fmt.Errorf("failed to parse smbstatus output: %w", err)
+	}
+
+	seen := make(map[int]bool)
+	var pids []int
+	for _, file := range locksData.OpenFiles {
+		if file.ServicePath != sharePath || file.Filename != name {
+			continue
+		}
+		for _, open := range file.Opens {
+			pid, err := strconv.Atoi(open.ServerID.PID)
+			if err != nil || seen[pid] {
+				continue
+			}
+			seen[pid] = true
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// terminateSMBSession disconnects the client served by an smbd session process. The process is asked to
+// shut down through smbcontrol so Samba can clean up its locks; if it is still alive afterwards it is killed.
+func terminateSMBSession(pid int) error {
+	if _, err := exec.LookPath("smbcontrol"); err == nil {
+		exec.Command("smbcontrol", strconv.Itoa(pid), "shutdown").Run()
+		if waitForProcessExit(pid, smbSessionExitTimeout) {
+			return nil
+		}
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+		return err
+	}
+	if waitForProcessExit(pid, smbSessionExitTimeout) {
+		return nil
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
+
+// waitForProcessExit polls until the process is gone or the timeout expires
+func waitForProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); os.IsNotExist(err) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// validSMBShareName reports whether name can be passed to smbcontrol close-share
+func validSMBShareName(name string) bool {
+	if name == "" || name == "*" || len(name) > 80 {
+		return false
+	}
+	for _, c := range name {
+		if unicode.IsControl(c) {
+			return false
+		}
+	}
+	return !strings.ContainsAny(name, `\/[]:|<>+=;,?"`)
+}
+
+// CloseSMBSession disconnects a client by terminating the smbd process serving its session
+func CloseSMBSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, err := strconv.Atoi(chi.URLParam(r, "pid"))
+		if err != nil || pid <= 1 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid session PID", nil)
+			return
+		}
+
+		sessions, err := smbSessionProcesses()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		session, ok := sessions[pid]
+		if !ok {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "No SMB session with this PID", nil)
+			return
+		}
+
+		if err := terminateSMBSession(pid); err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to close session: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": fmt.Sprintf("Closed SMB session of %s from %s", session.Username, session.IPAddress),
+			"pid":     pid,
+		})
+	}
+}
+
+// CloseSMBShare disconnects every client connected to a share
+func CloseSMBShare() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		share := chi.URLParam(r, "share")
+		if !validSMBShareName(share) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid share name", nil)
+			return
+		}
+
+		if _, err := exec.LookPath("smbcontrol"); err != nil {
+			apierror.Error(w, "smbcontrol command not available (Samba not installed)", http.StatusServiceUnavailable)
+			return
+		}
+
+		output, err := exec.Command("smbcontrol", "smbd", "close-share", share).CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to close share: %s", strings.TrimSpace(string(output))), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Disconnected all clients from share %s", share),
+		})
+	}
+}
+
+// CloseSMBOpenFile releases a file held open or locked by SMB clients. Samba cannot revoke a single open
+// handle, so the sessions holding the file are terminated; their clients reconnect without the lock.
+func CloseSMBOpenFile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			SharePath string `json:"share_path"`
+			Name      string `json:"name"`
+			PID       int    `json:"pid,omitempty"` // Only terminate this session when several hold the file
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+		if req.SharePath == "" || req.Name == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "share_path and name are required", nil)
+			return
+		}
+
+		sessions, err := smbSessionProcesses()
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		holders, err := smbOpenFileHolders(req.SharePath, req.Name)
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		closed := []int{}
+		for _, pid := range holders {
+			if req.PID != 0 && pid != req.PID {
+				continue
+			}
+			if _, ok := sessions[pid]; !ok {
+				continue
+			}
+			if err := terminateSMBSession(pid); err != nil {
+				apierror.Error(w, fmt.Sprintf("Failed to close session %d: %v", pid, err), http.StatusInternalServerError)
+				return
+			}
+			closed = append(closed, pid)
+		}
+
+		if len(closed) == 0 {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "File is not open by any SMB session", nil)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":         fmt.Sprintf("Closed %d session(s) holding %s", len(closed), req.Name),
+			"sessions_closed": closed,
+		})
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"sync"
 	"time"
 
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
 	"fileserv/models"
 	"fileserv/storage"
 
@@ -137,6 +139,19 @@ func (s *SnapshotScheduler) runPolicy(policy *models.SnapshotPolicy) {
 		}
 	}
 
+	eventData := map[string]interface{}{
+		"policy_id":   policy.ID,
+		"policy_name": policy.Name,
+		"dataset":     policy.Dataset,
+		"snapshot":    fullName,
+	}
+	if lastError != "" {
+		eventData["error"] = lastError
+		events.PublishToAdmins(events.TypeSnapshotFailed, eventData)
+	} else {
+		events.PublishToAdmins(events.TypeSnapshotCompleted, eventData)
+	}
+
 	// Calculate next run time
 	nextRun := s.calculateNextRun(policy.Schedule, now)
 
@@ -205,6 +220,11 @@ func (s *SnapshotScheduler) pruneSnapshots(policy *models.SnapshotPolicy) {
 
 // calculateNextRun calculates the next run time based on schedule
 func (s *SnapshotScheduler) calculateNextRun(schedule string, from time.Time) time.Time {
+	return nextScheduledRun(schedule, from)
+}
+
+// nextScheduledRun returns when a job on an hourly, daily, weekly or monthly schedule runs next
+func nextScheduledRun(schedule string, from time.Time) time.Time {
 	switch models.SnapshotSchedule(schedule) {
 	case models.ScheduleHourly:
 		// Next hour at :00
@@ -269,7 +289,7 @@ func (h *SnapshotPolicyHandler) GetPolicy(w http.ResponseWriter, r *http.Request
 
 	policy, err := h.store.GetSnapshotPolicy(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeSnapshotPolicyNotFound, err.Error(), nil)
 		return
 	}
 
@@ -292,17 +312,17 @@ func (h *SnapshotPolicyHandler) CreatePolicy(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
 	// Validate required fields
 	if req.Name == "" {
-		http.Error(w, "Policy name is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Policy name is required", nil)
 		return
 	}
 	if req.Dataset == "" {
-		http.Error(w, "Dataset is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Dataset is required", nil)
 		return
 	}
 	if req.Schedule == "" {
@@ -320,14 +340,14 @@ func (h *SnapshotPolicyHandler) CreatePolicy(w http.ResponseWriter, r *http.Requ
 		"hourly": true, "daily": true, "weekly": true, "monthly": true,
 	}
 	if !validSchedules[req.Schedule] {
-		http.Error(w, "Invalid schedule. Must be: hourly, daily, weekly, or monthly", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid schedule. Must be: hourly, daily, weekly, or monthly", nil)
 		return
 	}
 
 	// Verify dataset exists
 	output, err := exec.Command("zfs", "list", "-H", req.Dataset).CombinedOutput()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Dataset '%s' not found: %s", req.Dataset, string(output)), http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Dataset '%s' not found: %s", req.Dataset, string(output)), nil)
 		return
 	}
 
@@ -348,7 +368,7 @@ func (h *SnapshotPolicyHandler) CreatePolicy(w http.ResponseWriter, r *http.Requ
 
 	created, err := h.store.CreateSnapshotPolicy(policy)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create policy: %v", err), http.StatusInternalServerError)
+		apierror.Error(w, fmt.Sprintf("Failed to create policy: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -363,7 +383,7 @@ func (h *SnapshotPolicyHandler) UpdatePolicy(w http.ResponseWriter, r *http.Requ
 
 	var updates map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 		return
 	}
 
@@ -373,7 +393,7 @@ func (h *SnapshotPolicyHandler) UpdatePolicy(w http.ResponseWriter, r *http.Requ
 			"hourly": true, "daily": true, "weekly": true, "monthly": true,
 		}
 		if !validSchedules[schedule] {
-			http.Error(w, "Invalid schedule", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid schedule", nil)
 			return
 		}
 	}
@@ -382,14 +402,14 @@ func (h *SnapshotPolicyHandler) UpdatePolicy(w http.ResponseWriter, r *http.Requ
 	if dataset, ok := updates["dataset"].(string); ok {
 		output, err := exec.Command("zfs", "list", "-H", dataset).CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Dataset '%s' not found: %s", dataset, string(output)), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Dataset '%s' not found: %s", dataset, string(output)), nil)
 			return
 		}
 	}
 
 	updated, err := h.store.UpdateSnapshotPolicy(id, updates)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -402,7 +422,7 @@ func (h *SnapshotPolicyHandler) DeletePolicy(w http.ResponseWriter, r *http.Requ
 	id := chi.URLParam(r, "id")
 
 	if err := h.store.DeleteSnapshotPolicy(id); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeSnapshotPolicyNotFound, err.Error(), nil)
 		return
 	}
 
@@ -418,7 +438,7 @@ func (h *SnapshotPolicyHandler) RunPolicy(w http.ResponseWriter, r *http.Request
 
 	policy, err := h.store.GetSnapshotPolicy(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeSnapshotPolicyNotFound, err.Error(), nil)
 		return
 	}
 
@@ -442,7 +462,7 @@ func (h *SnapshotPolicyHandler) GetPolicySnapshots(w http.ResponseWriter, r *htt
 
 	policy, err := h.store.GetSnapshotPolicy(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeSnapshotPolicyNotFound, err.Error(), nil)
 		return
 	}
 
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"path"
 	"strings"
+
+	"fileserv/internal/apierror"
 )
 
 func ServeStatic(staticFS fs.FS) http.HandlerFunc {
@@ -28,7 +30,7 @@ func ServeStatic(staticFS fs.FS) http.HandlerFunc {
 				serveFile(w, r, staticFS, urlPath)
 				return
 			}
-			http.Error(w, "File not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
 			return
 		}
 
@@ -48,7 +50,7 @@ func ServeStatic(staticFS fs.FS) http.HandlerFunc {
 func serveFile(w http.ResponseWriter, r *http.Request, staticFS fs.FS, filePath string) {
 	file, err := staticFS.Open(filePath)
 	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
 		return
 	}
 	defer file.Close()
@@ -56,7 +58,7 @@ func serveFile(w http.ResponseWriter, r *http.Request, staticFS fs.FS, filePath
 	// Get file info for content type detection
 	stat, err := file.Stat()
 	if err != nil {
-		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		apierror.Error(w, "Error reading file", http.StatusInternalServerError)
 		return
 	}
 
@@ -13,7 +13,9 @@ import (
 	"strings"
 	"time"
 
+	"fileserv/internal/apierror"
 	"fileserv/models"
+	"fileserv/storage"
 )
 
 // Allowed mount options whitelist for security
@@ -269,7 +271,7 @@ func checkCommandExists(name string) bool {
 }
 
 // GetStorageOverview returns high-level storage information
-func GetStorageOverview() http.HandlerFunc {
+func GetStorageOverview(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		overview := models.StorageOverview{
 			Alerts:     []models.StorageAlert{},
@@ -283,37 +285,12 @@ func GetStorageOverview() http.HandlerFunc {
 		// Calculate totals from mount points
 		for _, mount := range mounts {
 			// Skip pseudo filesystems
-			if strings.HasPrefix(mount.FSType, "tmp") ||
-			   mount.FSType == "devtmpfs" ||
-			   mount.FSType == "overlay" ||
-			   strings.HasPrefix(mount.MountPath, "/sys") ||
-			   strings.HasPrefix(mount.MountPath, "/proc") ||
-			   strings.HasPrefix(mount.MountPath, "/run") ||
-			   strings.HasPrefix(mount.MountPath, "/dev") {
+			if isPseudoMount(mount) {
 				continue
 			}
 			overview.TotalCapacity += mount.Total
 			overview.TotalUsed += mount.Used
 			overview.TotalFree += mount.Available
-
-			// Check for space alerts
-			if mount.UsedPercent > 90 {
-				overview.Alerts = append(overview.Alerts, models.StorageAlert{
-					Level:     "critical",
-					Type:      "space_low",
-					Message:   fmt.Sprintf("Filesystem %s is %.1f%% full", mount.MountPath, mount.UsedPercent),
-					Resource:  mount.MountPath,
-					Timestamp: time.Now(),
-				})
-			} else if mount.UsedPercent > 80 {
-				overview.Alerts = append(overview.Alerts, models.StorageAlert{
-					Level:     "warning",
-					Type:      "space_low",
-					Message:   fmt.Sprintf("Filesystem %s is %.1f%% full", mount.MountPath, mount.UsedPercent),
-					Resource:  mount.MountPath,
-					Timestamp: time.Now(),
-				})
-			}
 		}
 
 		if overview.TotalCapacity > 0 {
@@ -335,13 +312,6 @@ func GetStorageOverview() http.HandlerFunc {
 			}
 			if disk.SMART != nil && !disk.SMART.Healthy {
 				health.Health = "critical"
-				overview.Alerts = append(overview.Alerts, models.StorageAlert{
-					Level:     "critical",
-					Type:      "disk_health",
-					Message:   fmt.Sprintf("Disk %s SMART status: %s", disk.Name, disk.SMART.OverallStatus),
-					Resource:  disk.Path,
-					Timestamp: time.Now(),
-				})
 			}
 			overview.DiskHealth = append(overview.DiskHealth, health)
 		}
@@ -352,36 +322,14 @@ func GetStorageOverview() http.HandlerFunc {
 		}
 
 		// Count RAID arrays
-		if raids, err := getRAIDArrays(); err == nil {
-			overview.RAIDArrays = len(raids)
-			for _, raid := range raids {
-				if raid.State == "degraded" {
-					overview.Alerts = append(overview.Alerts, models.StorageAlert{
-						Level:     "critical",
-						Type:      "raid_degraded",
-						Message:   fmt.Sprintf("RAID array %s is degraded", raid.Name),
-						Resource:  raid.Path,
-						Timestamp: time.Now(),
-					})
-				}
-			}
-		}
+		raids, _ := getRAIDArrays()
+		overview.RAIDArrays = len(raids)
 
 		// Count ZFS pools
-		if pools, err := getZFSPools(); err == nil {
-			overview.ZFSPools = len(pools)
-			for _, pool := range pools {
-				if pool.Health != "ONLINE" {
-					overview.Alerts = append(overview.Alerts, models.StorageAlert{
-						Level:     "critical",
-						Type:      "zfs_degraded",
-						Message:   fmt.Sprintf("ZFS pool %s health: %s", pool.Name, pool.Health),
-						Resource:  pool.Name,
-						Timestamp: time.Now(),
-					})
-				}
-			}
-		}
+		pools, _ := getZFSPools()
+		overview.ZFSPools = len(pools)
+
+		overview.Alerts = storageAlerts(store, mounts, disks, raids, pools)
 
 		// Check if quotas are enabled
 		overview.QuotasEnabled = checkQuotasEnabled()
@@ -391,12 +339,99 @@ func GetStorageOverview() http.HandlerFunc {
 	}
 }
 
+// isPseudoMount reports whether a mount is a virtual filesystem that holds no user data
+func isPseudoMount(mount models.MountPoint) bool {
+	return strings.HasPrefix(mount.FSType, "tmp") ||
+		mount.FSType == "devtmpfs" ||
+		mount.FSType == "overlay" ||
+		strings.HasPrefix(mount.MountPath, "/sys") ||
+		strings.HasPrefix(mount.MountPath, "/proc") ||
+		strings.HasPrefix(mount.MountPath, "/run") ||
+		strings.HasPrefix(mount.MountPath, "/dev")
+}
+
+// storageAlerts evaluates the state of filesystems, disks, RAID arrays and ZFS pools, along
+// with integrity and maintenance results, into alerts
+func storageAlerts(store storage.DataStore, mounts []models.MountPoint, disks []models.DiskInfo, raids []models.RAIDArray, pools []models.ZFSPool) []models.StorageAlert {
+	settings := GetAlertSettingsFromStore(store)
+	alerts := []models.StorageAlert{}
+
+	// Check for space alerts
+	for _, mount := range mounts {
+		if isPseudoMount(mount) {
+			continue
+		}
+		level := ""
+		if mount.UsedPercent > settings.SpaceCriticalPercent {
+			level = "critical"
+		} else if mount.UsedPercent > settings.SpaceWarningPercent {
+			level = "warning"
+		}
+		if level != "" {
+			alerts = append(alerts, models.StorageAlert{
+				Level:     level,
+				Type:      "space_low",
+				Message:   fmt.Sprintf("Filesystem %s is %.1f%% full", mount.MountPath, mount.UsedPercent),
+				Resource:  mount.MountPath,
+				Timestamp: time.Now(),
+			})
+		}
+	}
+
+	for _, disk := range disks {
+		if disk.SMART != nil && !disk.SMART.Healthy {
+			alerts = append(alerts, models.StorageAlert{
+				Level:     "critical",
+				Type:      "disk_health",
+				Message:   fmt.Sprintf("Disk %s SMART status: %s", disk.Name, disk.SMART.OverallStatus),
+				Resource:  disk.Path,
+				Timestamp: time.Now(),
+			})
+		}
+	}
+
+	for _, raid := range raids {
+		if raid.State == "degraded" {
+			alerts = append(alerts, models.StorageAlert{
+				Level:     "critical",
+				Type:      "raid_degraded",
+				Message:   fmt.Sprintf("RAID array %s is degraded", raid.Name),
+				Resource:  raid.Path,
+				Timestamp: time.Now(),
+			})
+		}
+	}
+
+	for _, pool := range pools {
+		if pool.Health != "ONLINE" {
+			alerts = append(alerts, models.StorageAlert{
+				Level:     "critical",
+				Type:      "zfs_degraded",
+				Message:   fmt.Sprintf("ZFS pool %s health: %s", pool.Name, pool.Health),
+				Resource:  pool.Name,
+				Timestamp: time.Now(),
+			})
+		}
+	}
+
+	// Thin pools and snapshots running out of space
+	alerts = append(alerts, lvmAlerts(settings)...)
+
+	// Files that failed integrity verification
+	alerts = append(alerts, integrityAlerts(store)...)
+
+	// Scrubs and RAID checks that found errors
+	alerts = append(alerts, maintenanceAlerts(store)...)
+
+	return alerts
+}
+
 // GetDisks returns all disk devices
 func GetDisks() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		disks, err := getDisks()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -582,7 +617,7 @@ func GetMountPoints() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		mounts, err := getMountPoints()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -667,7 +702,7 @@ func GetVolumeGroups() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vgs, err := getVolumeGroups()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -802,7 +837,7 @@ func getLogicalVolumes(vgName string) ([]models.LogicalVolume, error) {
 	}
 
 	args := []string{"--reportformat", "json", "--units", "b",
-		"-o", "lv_name,lv_path,vg_name,lv_size,lv_attr,pool_lv,data_percent,origin,snap_percent"}
+		"-o", "lv_name,lv_path,vg_name,lv_size,lv_attr,pool_lv,data_percent,origin,snap_percent,segtype,metadata_percent"}
 	if vgName != "" {
 		args = append(args, "-S", fmt.Sprintf("vg_name=%s", vgName))
 	}
@@ -824,6 +859,8 @@ func getLogicalVolumes(vgName string) ([]models.LogicalVolume, error) {
 				DataPercent string `json:"data_percent"`
 				Origin      string `json:"origin"`
 				SnapPercent string `json:"snap_percent"`
+				SegType     string `json:"segtype"`
+				MetaPercent string `json:"metadata_percent"`
 			} `json:"lv"`
 		} `json:"report"`
 	}
@@ -838,18 +875,21 @@ func getLogicalVolumes(vgName string) ([]models.LogicalVolume, error) {
 			size, _ := parseSize(lv.LVSize)
 			dataPercent, _ := strconv.ParseFloat(lv.DataPercent, 64)
 			snapPercent, _ := strconv.ParseFloat(lv.SnapPercent, 64)
+			metaPercent, _ := strconv.ParseFloat(lv.MetaPercent, 64)
 
 			lvs = append(lvs, models.LogicalVolume{
-				Name:        lv.LVName,
-				Path:        lv.LVPath,
-				VGName:      lv.VGName,
-				Size:        size,
-				SizeHuman:   formatBytes(size),
-				Attributes:  lv.LVAttr,
-				PoolLV:      lv.PoolLV,
-				DataPercent: dataPercent,
-				Origin:      lv.Origin,
-				SnapPercent: snapPercent,
+				Name:            lv.LVName,
+				Path:            lv.LVPath,
+				VGName:          lv.VGName,
+				Size:            size,
+				SizeHuman:       formatBytes(size),
+				Attributes:      lv.LVAttr,
+				PoolLV:          lv.PoolLV,
+				DataPercent:     dataPercent,
+				Origin:          lv.Origin,
+				SnapPercent:     snapPercent,
+				SegType:         lv.SegType,
+				MetadataPercent: metaPercent,
 			})
 		}
 	}
@@ -862,7 +902,7 @@ func GetRAIDArrays() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		raids, err := getRAIDArrays()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -947,6 +987,15 @@ func getRAIDArrays() ([]models.RAIDArray, error) {
 				raids[len(raids)-1] = *currentRaid
 			}
 		}
+
+		// Match progress line: [==>......]  reshape = 12.5% (131072/1047552) finish=2.3min speed=6553K/sec
+		if currentRaid != nil {
+			if progress, ok := parseMDStatProgress(line); ok {
+				currentRaid.SyncPercent = progress.Percent
+				currentRaid.SyncSpeed = progress.Speed
+				raids[len(raids)-1] = *currentRaid
+			}
+		}
 	}
 
 	// Get more detailed info using mdadm
@@ -974,6 +1023,14 @@ func getRAIDArrays() ([]models.RAIDArray, error) {
 			if match := regexp.MustCompile(`Failed Devices : (\d+)`).FindStringSubmatch(output); len(match) > 1 {
 				raids[i].FailedDevs, _ = strconv.Atoi(match[1])
 			}
+			// Parse write-intent bitmap
+			raids[i].Bitmap = "none"
+			if match := regexp.MustCompile(`Intent Bitmap : (\S+)`).FindStringSubmatch(output); len(match) > 1 {
+				raids[i].Bitmap = match[1]
+				if match[1] == "Internal" {
+					raids[i].Bitmap = "internal"
+				}
+			}
 			// Check if degraded
 			if strings.Contains(output, "State : degraded") || strings.Contains(output, "State : clean, degraded") {
 				raids[i].State = "degraded"
@@ -983,6 +1040,12 @@ func getRAIDArrays() ([]models.RAIDArray, error) {
 				raids[i].State = "rebuilding"
 				raids[i].SyncPercent, _ = strconv.ParseFloat(match[1], 64)
 			}
+			if match := regexp.MustCompile(`Reshape Status : (\d+)% complete`).FindStringSubmatch(output); len(match) > 1 {
+				raids[i].State = "reshaping"
+				if raids[i].SyncPercent == 0 {
+					raids[i].SyncPercent, _ = strconv.ParseFloat(match[1], 64)
+				}
+			}
 		}
 	}
 
@@ -994,7 +1057,7 @@ func GetRAIDStatus() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		name := r.URL.Query().Get("name")
 		if name == "" {
-			http.Error(w, "RAID array name is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "RAID array name is required", nil)
 			return
 		}
 
@@ -1005,7 +1068,7 @@ func GetRAIDStatus() http.HandlerFunc {
 
 		output, err := exec.Command("mdadm", "--detail", name).CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get RAID status: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to get RAID status: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -1035,7 +1098,7 @@ func GetAvailableDevicesForRAID() http.HandlerFunc {
 		// Get all block devices using lsblk
 		output, err := exec.Command("lsblk", "-J", "-b", "-o", "NAME,SIZE,TYPE,MODEL,MOUNTPOINT,FSTYPE").Output()
 		if err != nil {
-			http.Error(w, "Failed to list devices", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to list devices", http.StatusInternalServerError)
 			return
 		}
 
@@ -1058,7 +1121,7 @@ func GetAvailableDevicesForRAID() http.HandlerFunc {
 		}
 
 		if err := json.Unmarshal(output, &lsblkOutput); err != nil {
-			http.Error(w, "Failed to parse device list", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to parse device list", http.StatusInternalServerError)
 			return
 		}
 
@@ -1149,21 +1212,21 @@ func CreateRAIDArray() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.CreateRAIDRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		// Validate request
 		if req.Name == "" {
-			http.Error(w, "Array name is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Array name is required", nil)
 			return
 		}
 		if req.Level == "" {
-			http.Error(w, "RAID level is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "RAID level is required", nil)
 			return
 		}
 		if len(req.Devices) < 2 {
-			http.Error(w, "At least 2 devices are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "At least 2 devices are required", nil)
 			return
 		}
 
@@ -1176,7 +1239,7 @@ func CreateRAIDArray() http.HandlerFunc {
 			"raid10": true, "10": true,
 		}
 		if !validLevels[strings.ToLower(req.Level)] {
-			http.Error(w, "Invalid RAID level. Supported: raid0, raid1, raid5, raid6, raid10", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid RAID level. Supported: raid0, raid1, raid5, raid6, raid10", nil)
 			return
 		}
 
@@ -1195,7 +1258,7 @@ func CreateRAIDArray() http.HandlerFunc {
 			"10": 4,
 		}
 		if min, ok := minDevices[level]; ok && len(req.Devices) < min {
-			http.Error(w, fmt.Sprintf("RAID%s requires at least %d devices", level, min), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("RAID%s requires at least %d devices", level, min), nil)
 			return
 		}
 
@@ -1233,7 +1296,7 @@ func CreateRAIDArray() http.HandlerFunc {
 		// Run mdadm
 		output, err := exec.Command("mdadm", args...).CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create RAID array: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create RAID array: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -1266,12 +1329,12 @@ func StopRAIDArray() http.HandlerFunc {
 			Name string `json:"name"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Name == "" {
-			http.Error(w, "Array name is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Array name is required", nil)
 			return
 		}
 
@@ -1283,7 +1346,7 @@ func StopRAIDArray() http.HandlerFunc {
 		// Stop the array
 		output, err := exec.Command("mdadm", "--stop", name).CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to stop RAID array: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to stop RAID array: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -1301,7 +1364,7 @@ func RemoveRAIDArray() http.HandlerFunc {
 		force := r.URL.Query().Get("force") == "true"
 
 		if name == "" {
-			http.Error(w, "Array name is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Array name is required", nil)
 			return
 		}
 
@@ -1312,7 +1375,7 @@ func RemoveRAIDArray() http.HandlerFunc {
 		// Get array members before stopping
 		raids, err := getRAIDArrays()
 		if err != nil {
-			http.Error(w, "Failed to get RAID info", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to get RAID info", http.StatusInternalServerError)
 			return
 		}
 
@@ -1325,14 +1388,14 @@ func RemoveRAIDArray() http.HandlerFunc {
 		}
 
 		if targetRaid == nil && !force {
-			http.Error(w, "RAID array not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeRAIDArrayNotFound, "RAID array not found", nil)
 			return
 		}
 
 		// Stop the array first
 		stopOutput, err := exec.Command("mdadm", "--stop", name).CombinedOutput()
 		if err != nil && !force {
-			http.Error(w, fmt.Sprintf("Failed to stop RAID array: %s - %s", err.Error(), string(stopOutput)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to stop RAID array: %s - %s", err.Error(), string(stopOutput)), http.StatusInternalServerError)
 			return
 		}
 
@@ -1359,12 +1422,12 @@ func AddRAIDDevice() http.HandlerFunc {
 			Spare  bool   `json:"spare"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Array == "" || req.Device == "" {
-			http.Error(w, "Array and device are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Array and device are required", nil)
 			return
 		}
 
@@ -1382,7 +1445,7 @@ func AddRAIDDevice() http.HandlerFunc {
 		args := []string{"--add", array, device}
 		output, err := exec.Command("mdadm", args...).CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to add device: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to add device: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -1401,12 +1464,12 @@ func RemoveRAIDDevice() http.HandlerFunc {
 			Device string `json:"device"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Array == "" || req.Device == "" {
-			http.Error(w, "Array and device are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Array and device are required", nil)
 			return
 		}
 
@@ -1426,7 +1489,7 @@ func RemoveRAIDDevice() http.HandlerFunc {
 		// Remove device from array
 		output, err := exec.Command("mdadm", "--remove", array, device).CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to remove device: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to remove device: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -1445,12 +1508,12 @@ func MarkRAIDDeviceFaulty() http.HandlerFunc {
 			Device string `json:"device"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Array == "" || req.Device == "" {
-			http.Error(w, "Array and device are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Array and device are required", nil)
 			return
 		}
 
@@ -1466,7 +1529,7 @@ func MarkRAIDDeviceFaulty() http.HandlerFunc {
 
 		output, err := exec.Command("mdadm", "--fail", array, device).CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to mark device as faulty: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to mark device as faulty: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -1482,7 +1545,7 @@ func GetZFSPools() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		pools, err := getZFSPools()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -1666,7 +1729,7 @@ func GetFstab() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		entries, err := getFstabEntries()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -1732,7 +1795,7 @@ func GetIOStats() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		stats, err := getIOStats()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -1795,32 +1858,32 @@ func Mount() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.MountRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		// Validate device path
 		if err := validateDevicePath(req.Device); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate mount point
 		if err := validateMountPoint(req.MountPoint); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate filesystem type
 		if err := validateFSType(req.FSType); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate and sanitize mount options
 		validatedOptions, err := validateMountOptions(req.Options)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 		req.Options = validatedOptions
@@ -1829,7 +1892,7 @@ func Mount() http.HandlerFunc {
 		if _, err := os.Stat(req.MountPoint); os.IsNotExist(err) {
 			// Try to create it
 			if err := os.MkdirAll(req.MountPoint, 0755); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to create mount point: %v", err), http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Failed to create mount point: %v", err), nil)
 				return
 			}
 		}
@@ -1847,7 +1910,7 @@ func Mount() http.HandlerFunc {
 		cmd := exec.Command("mount", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Mount failed: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Mount failed: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -1855,7 +1918,7 @@ func Mount() http.HandlerFunc {
 		if req.Persistent {
 			if err := addToFstab(req); err != nil {
 				// Mount succeeded but fstab failed - log warning
-				http.Error(w, fmt.Sprintf("Mount succeeded but failed to add to fstab: %v", err), http.StatusInternalServerError)
+				apierror.Error(w, fmt.Sprintf("Mount succeeded but failed to add to fstab: %v", err), http.StatusInternalServerError)
 				return
 			}
 		}
@@ -1906,20 +1969,20 @@ func Unmount() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		mountPoint := r.URL.Query().Get("path")
 		if mountPoint == "" {
-			http.Error(w, "Mount point required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Mount point required", nil)
 			return
 		}
 
 		// Validate mount point path
 		if err := validateMountPoint(mountPoint); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Verify it's actually a mount point
 		mounts, err := getMountPoints()
 		if err != nil {
-			http.Error(w, "Failed to check mount points", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to check mount points", http.StatusInternalServerError)
 			return
 		}
 
@@ -1932,7 +1995,7 @@ func Unmount() http.HandlerFunc {
 		}
 
 		if !isMounted {
-			http.Error(w, "Path is not a mount point", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Path is not a mount point", nil)
 			return
 		}
 
@@ -1947,7 +2010,7 @@ func Unmount() http.HandlerFunc {
 		cmd := exec.Command("umount", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Unmount failed: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Unmount failed: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -1961,13 +2024,13 @@ func FormatPartition() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.FormatRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		// Safety check - ensure device path is valid
 		if !strings.HasPrefix(req.Device, "/dev/") {
-			http.Error(w, "Invalid device path", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid device path", nil)
 			return
 		}
 
@@ -1975,7 +2038,7 @@ func FormatPartition() http.HandlerFunc {
 		mounts, _ := getMountPoints()
 		for _, m := range mounts {
 			if m.Device == req.Device {
-				http.Error(w, "Device is currently mounted", http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeDeviceMounted, "Device is currently mounted", nil)
 				return
 			}
 		}
@@ -2014,13 +2077,13 @@ func FormatPartition() http.HandlerFunc {
 			args = append(args, req.Device)
 			cmd = exec.Command("mkfs.btrfs", args...)
 		default:
-			http.Error(w, "Unsupported filesystem type", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Unsupported filesystem type", nil)
 			return
 		}
 
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Format failed: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Format failed: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -2034,13 +2097,13 @@ func CreatePartition() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.CreatePartitionRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		// Validate disk path
 		if !strings.HasPrefix(req.Disk, "/dev/") {
-			http.Error(w, "Invalid disk path", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid disk path", nil)
 			return
 		}
 
@@ -2049,7 +2112,7 @@ func CreatePartition() http.HandlerFunc {
 		cmd := exec.Command("parted", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create partition: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create partition: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -2069,19 +2132,19 @@ func CreatePartitionTable() http.HandlerFunc {
 			TableType string `json:"table_type"` // "gpt" or "msdos"
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		// Validate disk path
 		if !strings.HasPrefix(req.Disk, "/dev/") {
-			http.Error(w, "Invalid disk path", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid disk path", nil)
 			return
 		}
 
 		// Validate table type
 		if req.TableType != "gpt" && req.TableType != "msdos" {
-			http.Error(w, "Invalid table type. Use 'gpt' or 'msdos'", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid table type. Use 'gpt' or 'msdos'", nil)
 			return
 		}
 
@@ -2089,7 +2152,9 @@ func CreatePartitionTable() http.HandlerFunc {
 		mounts, _ := getMountPoints()
 		for _, m := range mounts {
 			if strings.HasPrefix(m.Device, req.Disk) {
-				http.Error(w, fmt.Sprintf("Disk has mounted partition: %s at %s", m.Device, m.MountPath), http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeDeviceMounted,
+					fmt.Sprintf("Disk has mounted partition: %s at %s", m.Device, m.MountPath),
+					map[string]string{"device": m.Device, "mount_path": m.MountPath})
 				return
 			}
 		}
@@ -2098,7 +2163,7 @@ func CreatePartitionTable() http.HandlerFunc {
 		cmd := exec.Command("parted", "-s", req.Disk, "mklabel", req.TableType)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create partition table: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create partition table: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -2119,13 +2184,13 @@ func DeletePartition() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		device := r.URL.Query().Get("device")
 		if device == "" {
-			http.Error(w, "Device path required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Device path required", nil)
 			return
 		}
 
 		// Validate device path
 		if !strings.HasPrefix(device, "/dev/") {
-			http.Error(w, "Invalid device path", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid device path", nil)
 			return
 		}
 
@@ -2133,32 +2198,23 @@ func DeletePartition() http.HandlerFunc {
 		mounts, _ := getMountPoints()
 		for _, m := range mounts {
 			if m.Device == device {
-				http.Error(w, "Partition is currently mounted", http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeDeviceMounted, "Partition is currently mounted", nil)
 				return
 			}
 		}
 
 		// Extract disk and partition number
 		// e.g., /dev/sda1 -> disk=/dev/sda, partnum=1
-		re := regexp.MustCompile(`^(/dev/[a-z]+)(\d+)$`)
-		matches := re.FindStringSubmatch(device)
-		if len(matches) != 3 {
-			// Try nvme format: /dev/nvme0n1p1
-			re = regexp.MustCompile(`^(/dev/nvme\d+n\d+)p(\d+)$`)
-			matches = re.FindStringSubmatch(device)
-			if len(matches) != 3 {
-				http.Error(w, "Cannot parse device path", http.StatusBadRequest)
-				return
-			}
+		disk, partNum, err := splitPartitionDevice(device)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot parse device path", nil)
+			return
 		}
 
-		disk := matches[1]
-		partNum := matches[2]
-
-		cmd := exec.Command("parted", "-s", disk, "rm", partNum)
+		cmd := exec.Command("parted", "-s", disk, "rm", strconv.Itoa(partNum))
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to delete partition: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to delete partition: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -2174,25 +2230,25 @@ func CreateVolumeGroup() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.CreateVolumeGroupRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if len(req.Devices) == 0 {
-			http.Error(w, "At least one device is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "At least one device is required", nil)
 			return
 		}
 
 		// Validate VG name
 		if err := validateLVMName(req.Name, "volume group"); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate device paths
 		for _, dev := range req.Devices {
 			if err := validateDevicePath(dev); err != nil {
-				http.Error(w, fmt.Sprintf("Invalid device %s: %v", dev, err), http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Invalid device %s: %v", dev, err), nil)
 				return
 			}
 		}
@@ -2202,7 +2258,7 @@ func CreateVolumeGroup() http.HandlerFunc {
 			cmd := exec.Command("pvcreate", "-f", dev)
 			output, err := cmd.CombinedOutput()
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Failed to create PV on %s: %s", dev, string(output)), http.StatusInternalServerError)
+				apierror.Error(w, fmt.Sprintf("Failed to create PV on %s: %s", dev, string(output)), http.StatusInternalServerError)
 				return
 			}
 		}
@@ -2212,7 +2268,7 @@ func CreateVolumeGroup() http.HandlerFunc {
 		cmd := exec.Command("vgcreate", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create VG: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create VG: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -2226,32 +2282,32 @@ func CreateLogicalVolume() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.CreateLogicalVolumeRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		// Validate LV name
 		if err := validateLVMName(req.Name, "logical volume"); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate VG name
 		if err := validateLVMName(req.VGName, "volume group"); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate size
 		if err := validateLVMSize(req.Size); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate filesystem type if specified
 		if req.FSType != "" {
 			if err := validateFSType(req.FSType); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 				return
 			}
 		}
@@ -2259,7 +2315,7 @@ func CreateLogicalVolume() http.HandlerFunc {
 		// Validate snapshot name if specified
 		if req.Snapshot != "" {
 			if err := validateLVMName(req.Snapshot, "snapshot"); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 				return
 			}
 		}
@@ -2267,7 +2323,7 @@ func CreateLogicalVolume() http.HandlerFunc {
 		// Validate mount point if specified
 		if req.Mount != "" {
 			if err := validateMountPoint(req.Mount); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 				return
 			}
 		}
@@ -2290,7 +2346,7 @@ func CreateLogicalVolume() http.HandlerFunc {
 		cmd := exec.Command("lvcreate", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create LV: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create LV: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -2300,7 +2356,7 @@ func CreateLogicalVolume() http.HandlerFunc {
 			cmd := exec.Command("mkfs", "-t", req.FSType, lvPath)
 			output, err := cmd.CombinedOutput()
 			if err != nil {
-				http.Error(w, fmt.Sprintf("LV created but format failed: %s", string(output)), http.StatusInternalServerError)
+				apierror.Error(w, fmt.Sprintf("LV created but format failed: %s", string(output)), http.StatusInternalServerError)
 				return
 			}
 		}
@@ -2311,7 +2367,7 @@ func CreateLogicalVolume() http.HandlerFunc {
 			cmd := exec.Command("mount", lvPath, req.Mount)
 			output, err := cmd.CombinedOutput()
 			if err != nil {
-				http.Error(w, fmt.Sprintf("LV created and formatted but mount failed: %s", string(output)), http.StatusInternalServerError)
+				apierror.Error(w, fmt.Sprintf("LV created and formatted but mount failed: %s", string(output)), http.StatusInternalServerError)
 				return
 			}
 		}
@@ -2332,7 +2388,7 @@ func DeleteVolumeGroup() http.HandlerFunc {
 
 		// Validate VG name
 		if err := validateLVMName(name, "volume group"); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -2345,7 +2401,7 @@ func DeleteVolumeGroup() http.HandlerFunc {
 		cmd := exec.Command("vgremove", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to delete VG: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to delete VG: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -2363,13 +2419,13 @@ func DeleteLogicalVolume() http.HandlerFunc {
 
 		// Validate VG name
 		if err := validateLVMName(vg, "volume group"); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate LV name
 		if err := validateLVMName(lv, "logical volume"); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -2379,7 +2435,7 @@ func DeleteLogicalVolume() http.HandlerFunc {
 		mounts, _ := getMountPoints()
 		for _, m := range mounts {
 			if m.Device == lvPath {
-				http.Error(w, "Logical volume is currently mounted", http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeDeviceMounted, "Logical volume is currently mounted", nil)
 				return
 			}
 		}
@@ -2393,7 +2449,7 @@ func DeleteLogicalVolume() http.HandlerFunc {
 		cmd := exec.Command("lvremove", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to delete LV: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to delete LV: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -2407,22 +2463,22 @@ func ResizeLogicalVolume() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.ResizeRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		// Validate device path (should be /dev/vg/lv)
 		if req.Device == "" {
-			http.Error(w, "Device path is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Device path is required", nil)
 			return
 		}
 		if !strings.HasPrefix(req.Device, "/dev/") {
-			http.Error(w, "Invalid device path: must start with /dev/", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid device path: must start with /dev/", nil)
 			return
 		}
 		// Check for path traversal
 		if strings.Contains(req.Device, "..") {
-			http.Error(w, "Invalid device path: path traversal not allowed", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid device path: path traversal not allowed", nil)
 			return
 		}
 
@@ -2432,7 +2488,7 @@ func ResizeLogicalVolume() http.HandlerFunc {
 			sizeToValidate = sizeToValidate[1:]
 		}
 		if err := validateLVMSize(sizeToValidate); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -2444,7 +2500,7 @@ func ResizeLogicalVolume() http.HandlerFunc {
 				// Shrink - need to resize FS first
 				if req.ResizeFS {
 					// This is dangerous, would need unmount first
-					http.Error(w, "Shrinking with filesystem resize requires manual intervention", http.StatusBadRequest)
+					apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Shrinking with filesystem resize requires manual intervention", nil)
 					return
 				}
 				cmd = exec.Command("lvreduce", "-y", "-L", req.Size, req.Device)
@@ -2468,7 +2524,7 @@ func ResizeLogicalVolume() http.HandlerFunc {
 
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Resize failed: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Resize failed: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -2532,7 +2588,7 @@ func BrowseDirectories() http.HandlerFunc {
 
 		// Security: Restrict browsing to allowed paths
 		if !isPathAllowedForBrowsing(basePath) {
-			http.Error(w, "Access to this path is restricted", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access to this path is restricted", nil)
 			return
 		}
 
@@ -2543,11 +2599,11 @@ func BrowseDirectories() http.HandlerFunc {
 			basePath = filepath.Dir(basePath)
 			info, err = os.Stat(basePath)
 			if err != nil {
-				http.Error(w, "Path not found", http.StatusNotFound)
+				apierror.Write(w, http.StatusNotFound, apierror.CodePathNotFound, "Path not found", nil)
 				return
 			}
 		} else if err != nil {
-			http.Error(w, fmt.Sprintf("Error accessing path: %v", err), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Error accessing path: %v", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -2559,7 +2615,7 @@ func BrowseDirectories() http.HandlerFunc {
 		// Read directory contents
 		entries, err := os.ReadDir(basePath)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error reading directory: %v", err), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Error reading directory: %v", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -2647,7 +2703,7 @@ func GetAvailableDevices() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		disks, err := getDisks()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -2677,9 +2733,21 @@ func GetAvailableDevices() http.HandlerFunc {
 
 		var available []AvailableDevice
 
+		// Unlocked LUKS containers are offered through their mapper instead
+		luksDevices, _ := getLUKSDevices()
+		luksMappers := make(map[string]bool)
+		for _, luks := range luksDevices {
+			if luks.Open {
+				luksMappers[luks.MapperPath] = true
+			}
+		}
+
 		for _, disk := range disks {
 			// Check partitions
 			for _, part := range disk.Partitions {
+				if luksMappers[part.Path] {
+					continue
+				}
 				isMounted := mountedDevices[part.Path] || part.MountPoint != ""
 				available = append(available, AvailableDevice{
 					Name:        part.Name,
@@ -2722,6 +2790,25 @@ func GetAvailableDevices() http.HandlerFunc {
 			}
 		}
 
+		for _, luks := range luksDevices {
+			if !luks.Open {
+				continue
+			}
+			available = append(available, AvailableDevice{
+				Name:        luks.MapperName,
+				Path:        luks.MapperPath,
+				Size:        luks.Size,
+				SizeHuman:   luks.SizeHuman,
+				Type:        "crypt",
+				FSType:      luks.FSType,
+				UUID:        luks.FSUUID,
+				IsMounted:   mountedDevices[luks.MapperPath] || luks.MountPoint != "",
+				MountPoint:  luks.MountPoint,
+				ParentDisk:  luks.Device,
+				IsWholeDisk: false,
+			})
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(available)
 	}
@@ -2734,31 +2821,31 @@ func CreateMountPoint() http.HandlerFunc {
 			Path string `json:"path"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Path == "" {
-			http.Error(w, "Path is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Path is required", nil)
 			return
 		}
 
 		// Validate path is absolute
 		if !strings.HasPrefix(req.Path, "/") {
-			http.Error(w, "Path must be absolute", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Path must be absolute", nil)
 			return
 		}
 
 		// Ensure parent directory exists
 		parentDir := filepath.Dir(req.Path)
 		if _, err := os.Stat(parentDir); os.IsNotExist(err) {
-			http.Error(w, "Parent directory does not exist", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Parent directory does not exist", nil)
 			return
 		}
 
 		// Create the mount point directory
 		if err := os.MkdirAll(req.Path, 0755); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create directory: %v", err), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create directory: %v", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -2782,13 +2869,13 @@ func SetupStorageDevice() http.HandlerFunc {
 			Force      bool   `json:"force"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		// Validate inputs
 		if req.Device == "" || req.MountPoint == "" {
-			http.Error(w, "Device and mount_point are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Device and mount_point are required", nil)
 			return
 		}
 		if req.FSType == "" {
@@ -2797,7 +2884,7 @@ func SetupStorageDevice() http.HandlerFunc {
 
 		// Safety check - ensure device path is valid
 		if !strings.HasPrefix(req.Device, "/dev/") {
-			http.Error(w, "Invalid device path", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid device path", nil)
 			return
 		}
 
@@ -2805,14 +2892,14 @@ func SetupStorageDevice() http.HandlerFunc {
 		mounts, _ := getMountPoints()
 		for _, m := range mounts {
 			if m.Device == req.Device {
-				http.Error(w, "Device is currently mounted", http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeDeviceMounted, "Device is currently mounted", nil)
 				return
 			}
 		}
 
 		// Step 1: Create mount point directory
 		if err := os.MkdirAll(req.MountPoint, 0755); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create mount point: %v", err), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create mount point: %v", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -2850,13 +2937,13 @@ func SetupStorageDevice() http.HandlerFunc {
 			args = append(args, req.Device)
 			formatCmd = exec.Command("mkfs.btrfs", args...)
 		default:
-			http.Error(w, "Unsupported filesystem type. Supported: ext4, xfs, btrfs", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Unsupported filesystem type. Supported: ext4, xfs, btrfs", nil)
 			return
 		}
 
 		output, err := formatCmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Format failed: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Format failed: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -2864,7 +2951,7 @@ func SetupStorageDevice() http.HandlerFunc {
 		mountCmd := exec.Command("mount", "-t", req.FSType, req.Device, req.MountPoint)
 		output, err = mountCmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Mount failed: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Mount failed: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/internal/mailer"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// storageAlertInterval is how often the full alert evaluation runs. It reads SMART data
+	// of every disk, so it runs less often than the RAID and pool state checks.
+	storageAlertInterval = 5 * time.Minute
+	// storageAlertRetention is how long resolved alerts are kept
+	storageAlertRetention = 30 * 24 * time.Hour
+	// webhookTimeout bounds delivery of a single webhook notification
+	webhookTimeout = 10 * time.Second
+
+	defaultSpaceWarningPercent  = 80.0
+	defaultSpaceCriticalPercent = 90.0
+)
+
+// alertLevelRank orders alert levels by severity
+var alertLevelRank = map[string]int{"info": 0, "warning": 1, "critical": 2}
+
+// GetAlertSettingsFromStore returns the storage alert thresholds and notification settings
+func GetAlertSettingsFromStore(store storage.DataStore) models.AlertSettings {
+	settings := models.AlertSettings{
+		SpaceWarningPercent:  defaultSpaceWarningPercent,
+		SpaceCriticalPercent: defaultSpaceCriticalPercent,
+		NotifyMinLevel:       "warning",
+		EmailRecipients:      []string{},
+	}
+	floatSetting := func(key string, value *float64) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil {
+			if f, err := strconv.ParseFloat(setting.Value, 64); err == nil && f > 0 {
+				*value = f
+			}
+		}
+	}
+	floatSetting(models.SettingAlertSpaceWarning, &settings.SpaceWarningPercent)
+	floatSetting(models.SettingAlertSpaceCritical, &settings.SpaceCriticalPercent)
+	if setting, err := store.GetSetting(models.SettingAlertNotifyMinLevel); err == nil && setting != nil && setting.Value != "" {
+		settings.NotifyMinLevel = setting.Value
+	}
+	if setting, err := store.GetSetting(models.SettingAlertEmailRecipients); err == nil && setting != nil && setting.Value != "" {
+		json.Unmarshal([]byte(setting.Value), &settings.EmailRecipients)
+	}
+	if setting, err := store.GetSetting(models.SettingAlertWebhookURL); err == nil && setting != nil {
+		settings.WebhookURL = setting.Value
+	}
+	return settings
+}
+
+// collectStorageAlerts gathers the current storage state and evaluates it into alerts
+func collectStorageAlerts(store storage.DataStore) []models.StorageAlert {
+	mounts, _ := getMountPoints()
+	disks, _ := getDisks()
+	raids, _ := getRAIDArrays()
+	pools, _ := getZFSPools()
+	return storageAlerts(store, mounts, disks, raids, pools)
+}
+
+// storageAlertKey identifies the condition behind an alert across evaluations
+func storageAlertKey(alert models.StorageAlert) string {
+	return alert.Type + ":" + alert.Resource
+}
+
+// evaluateAlerts raises an alert for every new condition, updates the ones still present and
+// resolves the ones that cleared. Notifications go out when an alert is raised, escalates to
+// a higher level or resolves.
+func (m *StorageMonitor) evaluateAlerts() {
+	current := make(map[string]models.StorageAlert)
+	for _, alert := range collectStorageAlerts(m.store) {
+		key := storageAlertKey(alert)
+		if existing, ok := current[key]; ok && alertLevelRank[existing.Level] >= alertLevelRank[alert.Level] {
+			continue
+		}
+		current[key] = alert
+	}
+
+	now := time.Now()
+	open := make(map[string]*models.StorageAlertRecord)
+	for _, record := range m.store.ListStorageAlerts("open", 10000) {
+		open[record.Key] = record
+	}
+
+	for key, alert := range current {
+		record, ok := open[key]
+		if !ok {
+			record = &models.StorageAlertRecord{
+				Key:       key,
+				Level:     alert.Level,
+				Type:      alert.Type,
+				Message:   alert.Message,
+				Resource:  alert.Resource,
+				Status:    models.AlertStatusActive,
+				FirstSeen: now,
+				LastSeen:  now,
+			}
+			created, err := m.store.CreateStorageAlert(record)
+			if err != nil {
+				log.Printf("Storage alerts: failed to save alert %s: %v", key, err)
+				continue
+			}
+			log.Printf("Storage alert raised: %s", alert.Message)
+			m.notifyAlert(created, false)
+			continue
+		}
+
+		escalated := alertLevelRank[alert.Level] > alertLevelRank[record.Level]
+		record.Level = alert.Level
+		record.Message = alert.Message
+		record.LastSeen = now
+		if escalated {
+			// An acknowledged alert that got worse needs attention again
+			record.Status = models.AlertStatusActive
+			record.AcknowledgedAt = nil
+			record.AcknowledgedBy = ""
+		}
+		if err := m.store.UpdateStorageAlert(record); err != nil {
+			log.Printf("Storage alerts: failed to update alert %s: %v", key, err)
+			continue
+		}
+		if escalated {
+			log.Printf("Storage alert escalated: %s", alert.Message)
+			m.notifyAlert(record, false)
+		}
+	}
+
+	for key, record := range open {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		record.Status = models.AlertStatusResolved
+		record.ResolvedAt = &now
+		if err := m.store.UpdateStorageAlert(record); err != nil {
+			log.Printf("Storage alerts: failed to resolve alert %s: %v", key, err)
+			continue
+		}
+		log.Printf("Storage alert resolved: %s", record.Message)
+		if record.NotifiedAt != nil {
+			m.notifyAlert(record, true)
+		}
+	}
+
+	m.store.PruneResolvedStorageAlerts(now.Add(-storageAlertRetention))
+}
+
+// notifyAlert publishes an alert to connected admins and dispatches the configured email and
+// webhook notifications when the alert is at or above the notification level
+func (m *StorageMonitor) notifyAlert(record *models.StorageAlertRecord, resolved bool) {
+	eventType := events.TypeStorageAlertRaised
+	if resolved {
+		eventType = events.TypeStorageAlertResolved
+	}
+	events.PublishToAdmins(eventType, *record)
+
+	settings := GetAlertSettingsFromStore(m.store)
+	if alertLevelRank[record.Level] < alertLevelRank[settings.NotifyMinLevel] {
+		return
+	}
+	if len(settings.EmailRecipients) == 0 && settings.WebhookURL == "" {
+		return
+	}
+
+	subject, body := storageAlertNotice(record, resolved)
+
+	if !resolved {
+		now := time.Now()
+		record.NotifiedAt = &now
+		m.store.UpdateStorageAlert(record)
+	}
+
+	if len(settings.EmailRecipients) > 0 {
+		sendEmailAsync(m.store, &mailer.Message{
+			To:      settings.EmailRecipients,
+			Subject: subject,
+			Body:    body,
+		})
+	}
+	if settings.WebhookURL != "" {
+		alert := *record
+		go func(webhookURL string) {
+			if err := postAlertWebhook(webhookURL, eventType, &alert); err != nil {
+				log.Printf("Storage alerts: webhook delivery failed: %v", err)
+			}
+		}(settings.WebhookURL)
+	}
+}
+
+// storageAlertNotice returns the subject and body of a notification about an alert
+func storageAlertNotice(record *models.StorageAlertRecord, resolved bool) (string, string) {
+	if resolved {
+		return "[RESOLVED] " + record.Message,
+			fmt.Sprintf("The following storage alert has cleared:\n\n%s\n\nType: %s\nResource: %s\nResolved: %s\n",
+				record.Message, record.Type, record.Resource, record.ResolvedAt.Format(time.RFC1123))
+	}
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(record.Level), record.Message),
+		fmt.Sprintf("%s\n\nType: %s\nResource: %s\nFirst seen: %s\n",
+			record.Message, record.Type, record.Resource, record.FirstSeen.Format(time.RFC1123))
+}
+
+// postAlertWebhook sends an alert as a JSON POST
+func postAlertWebhook(webhookURL, eventType string, record *models.StorageAlertRecord) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"event": eventType,
+		"alert": record,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ListStorageAlerts returns persisted storage alerts. status may be open (default), active,
+// acknowledged, resolved or all.
+func ListStorageAlerts(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "":
+			status = "open"
+		case "all":
+			status = ""
+		case "open", models.AlertStatusActive, models.AlertStatusAcknowledged, models.AlertStatusResolved:
+		default:
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid status: must be open, active, acknowledged, resolved or all", nil)
+			return
+		}
+
+		limit := 100
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 1000 {
+			limit = l
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(store.ListStorageAlerts(status, limit))
+	}
+}
+
+// AcknowledgeStorageAlert marks an open alert as seen so it stops counting as new
+func AcknowledgeStorageAlert(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alert, err := store.GetStorageAlert(chi.URLParam(r, "id"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeAlertNotFound, err.Error(), nil)
+			return
+		}
+		if alert.Status == models.AlertStatusResolved {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Alert is already resolved", nil)
+			return
+		}
+
+		now := time.Now()
+		alert.Status = models.AlertStatusAcknowledged
+		alert.AcknowledgedAt = &now
+		if userCtx := middleware.GetUserContext(r); userCtx != nil {
+			alert.AcknowledgedBy = userCtx.Username
+		}
+		if err := store.UpdateStorageAlert(alert); err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alert)
+	}
+}
+
+// ResolveStorageAlert closes an alert by hand. If its condition is still present the next
+// evaluation raises a new alert.
+func ResolveStorageAlert(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alert, err := store.GetStorageAlert(chi.URLParam(r, "id"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeAlertNotFound, err.Error(), nil)
+			return
+		}
+		if alert.Status == models.AlertStatusResolved {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Alert is already resolved", nil)
+			return
+		}
+
+		now := time.Now()
+		alert.Status = models.AlertStatusResolved
+		alert.ResolvedAt = &now
+		if err := store.UpdateStorageAlert(alert); err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alert)
+	}
+}
+
+// GetAlertSettings returns the storage alert thresholds and notification settings
+func GetAlertSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GetAlertSettingsFromStore(store))
+	}
+}
+
+// UpdateAlertSettings saves the storage alert thresholds and notification settings
+func UpdateAlertSettings(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := GetAlertSettingsFromStore(store)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if req.SpaceWarningPercent <= 0 || req.SpaceCriticalPercent > 100 || req.SpaceWarningPercent >= req.SpaceCriticalPercent {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Thresholds must satisfy 0 < warning < critical <= 100", nil)
+			return
+		}
+		if req.NotifyMinLevel != "warning" && req.NotifyMinLevel != "critical" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid notify_min_level: must be warning or critical", nil)
+			return
+		}
+		recipients := []string{}
+		for _, to := range req.EmailRecipients {
+			if to = strings.TrimSpace(to); to == "" {
+				continue
+			}
+			if err := mailer.ValidateAddress(to); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			recipients = append(recipients, to)
+		}
+		req.WebhookURL = strings.TrimSpace(req.WebhookURL)
+		if req.WebhookURL != "" {
+			u, err := url.Parse(req.WebhookURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Webhook URL must be an absolute http(s) URL", nil)
+				return
+			}
+		}
+
+		recipientsJSON, _ := json.Marshal(recipients)
+		category := string(models.CategoryStorage)
+		store.SetSetting(models.SettingAlertSpaceWarning, strconv.FormatFloat(req.SpaceWarningPercent, 'f', -1, 64), "string", category)
+		store.SetSetting(models.SettingAlertSpaceCritical, strconv.FormatFloat(req.SpaceCriticalPercent, 'f', -1, 64), "string", category)
+		store.SetSetting(models.SettingAlertNotifyMinLevel, req.NotifyMinLevel, "string", category)
+		store.SetSetting(models.SettingAlertEmailRecipients, string(recipientsJSON), "json", category)
+		store.SetSetting(models.SettingAlertWebhookURL, req.WebhookURL, "string", category)
+
+		GetAlertSettings(store)(w, r)
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+	"syscall"
+	"time"
+
+	"fileserv/internal/events"
+	"fileserv/storage"
+)
+
+const (
+	// storageMonitorInterval is how often RAID state and pool usage are checked
+	storageMonitorInterval = 1 * time.Minute
+	// Pool usage thresholds (percent) that raise storage alerts
+	poolUsageWarning  = 90.0
+	poolUsageCritical = 95.0
+)
+
+// StorageMonitor watches RAID arrays and storage pools and publishes events when their state changes
+type StorageMonitor struct {
+	store      storage.DataStore
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	running    bool
+	raidStates map[string]string
+	poolLevels map[string]string
+
+	lastAlertCheck time.Time
+}
+
+// NewStorageMonitor creates a new storage monitor
+func NewStorageMonitor(store storage.DataStore) *StorageMonitor {
+	return &StorageMonitor{
+		store:      store,
+		stopChan:   make(chan struct{}),
+		raidStates: make(map[string]string),
+		poolLevels: make(map[string]string),
+	}
+}
+
+// Start begins the storage monitor background goroutine
+func (m *StorageMonitor) Start() {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = true
+	m.stopChan = make(chan struct{})
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.run()
+	log.Println("Storage monitor started")
+}
+
+// Stop stops the storage monitor
+func (m *StorageMonitor) Stop() {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = false
+	close(m.stopChan)
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	log.Println("Storage monitor stopped")
+}
+
+// run is the main monitor loop
+func (m *StorageMonitor) run() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(storageMonitorInterval)
+	defer ticker.Stop()
+
+	// Initial check records the baseline state
+	m.check()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+// check compares current RAID and pool state with the last observed state, and periodically
+// re-evaluates the persisted storage alerts
+func (m *StorageMonitor) check() {
+	m.checkRAID()
+	m.checkPools()
+
+	if time.Since(m.lastAlertCheck) >= storageAlertInterval {
+		m.lastAlertCheck = time.Now()
+		m.evaluateAlerts()
+	}
+}
+
+// checkRAID publishes an event for every array whose state changed or that disappeared, and
+// hands pooled spares to degraded arrays
+func (m *StorageMonitor) checkRAID() {
+	arrays, err := getRAIDArrays()
+	if err != nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, array := range arrays {
+		seen[array.Name] = true
+		previous, known := m.raidStates[array.Name]
+		m.raidStates[array.Name] = array.State
+		if !known || previous == array.State {
+			continue
+		}
+
+		log.Printf("RAID array %s changed state: %s -> %s", array.Name, previous, array.State)
+		events.PublishToAdmins(events.TypeRAIDStateChanged, map[string]interface{}{
+			"name":           array.Name,
+			"level":          array.Level,
+			"previous_state": previous,
+			"state":          array.State,
+			"failed_devices": array.FailedDevs,
+			"sync_percent":   array.SyncPercent,
+		})
+	}
+
+	for name, previous := range m.raidStates {
+		if seen[name] {
+			continue
+		}
+		delete(m.raidStates, name)
+		log.Printf("RAID array %s is no longer present", name)
+		events.PublishToAdmins(events.TypeRAIDStateChanged, map[string]interface{}{
+			"name":           name,
+			"previous_state": previous,
+			"state":          "missing",
+		})
+	}
+	m.assignPoolSpares(arrays)
+}
+
+// checkPools publishes a storage alert when a pool crosses a usage threshold or becomes unavailable
+func (m *StorageMonitor) checkPools() {
+	for _, pool := range m.store.ListStoragePools() {
+		if !pool.Enabled || pool.IsS3() {
+			delete(m.poolLevels, pool.ID)
+			continue
+		}
+
+		level := "ok"
+		var usagePercent float64
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(pool.Path, &stat); err != nil {
+			level = "unavailable"
+		} else if total := stat.Blocks * uint64(stat.Bsize); total > 0 {
+			used := total - stat.Bavail*uint64(stat.Bsize)
+			usagePercent = float64(used) / float64(total) * 100
+			switch {
+			case usagePercent >= poolUsageCritical:
+				level = "critical"
+			case usagePercent >= poolUsageWarning:
+				level = "warning"
+			}
+		}
+
+		previous, known := m.poolLevels[pool.ID]
+		m.poolLevels[pool.ID] = level
+		if previous == level || (!known && level == "ok") {
+			continue
+		}
+
+		events.PublishToAdmins(events.TypeStorageAlert, map[string]interface{}{
+			"pool_id":        pool.ID,
+			"pool_name":      pool.Name,
+			"path":           pool.Path,
+			"level":          level,
+			"previous_level": previous,
+			"usage_percent":  usagePercent,
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// streamSegmentDuration is the length in seconds of each HLS segment
+	streamSegmentDuration = 6
+	defaultStreamHeight   = 720
+	// streamTranscodeTimeout bounds the time spent transcoding one segment
+	streamTranscodeTimeout = 2 * time.Minute
+	// maxStreamDurations caps the number of probed video durations kept in memory
+	maxStreamDurations = 1000
+)
+
+// streamVideoExtensions are the video types that can be transcoded for streaming
+var streamVideoExtensions = map[string]bool{
+	"mp4": true, "m4v": true, "mov": true, "mkv": true, "webm": true, "avi": true,
+	"wmv": true, "flv": true, "mpg": true, "mpeg": true, "ts": true, "3gp": true,
+}
+
+// streamHeights are the output resolutions a client can ask for
+var streamHeights = map[int]bool{360: true, 480: true, 720: true, 1080: true}
+
+// errFFmpegMissing is returned when ffmpeg is not installed
+var errFFmpegMissing = errors.New("video transcoding is not available (install ffmpeg)")
+
+// streamSegment is a segment being transcoded; concurrent requests for it wait on done
+type streamSegment struct {
+	done chan struct{}
+	path string
+	err  error
+}
+
+// StreamHandler transcodes videos to HLS on demand. Each segment is transcoded separately when
+// first requested, so players can seek anywhere without waiting for the whole video.
+type StreamHandler struct {
+	store      storage.DataStore
+	files      *ZoneFileHandler
+	cache      *PreviewCache
+	transcodes chan struct{} // Limits the number of ffmpeg processes
+	mu         sync.Mutex
+	inFlight   map[string]*streamSegment
+	durations  map[string]float64 // Probed durations by video version
+}
+
+// NewStreamHandler creates a new handler caching up to maxBytes of segments in cacheDir
+func NewStreamHandler(store storage.DataStore, cacheDir string, maxBytes int64) (*StreamHandler, error) {
+	cache, err := NewPreviewCache(cacheDir, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamHandler{
+		store:      store,
+		files:      NewZoneFileHandler(store),
+		cache:      cache,
+		transcodes: make(chan struct{}, 2),
+		inFlight:   make(map[string]*streamSegment),
+		durations:  make(map[string]float64),
+	}, nil
+}
+
+// streamVersionKey identifies one version of a video file
+func streamVersionKey(fullPath string, info os.FileInfo) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d", fullPath, info.Size(), info.ModTime().UnixNano())))
+	return hex.EncodeToString(sum[:])
+}
+
+// probeDuration returns the length of a video in seconds
+func (h *StreamHandler) probeDuration(fullPath, version string) (float64, error) {
+	h.mu.Lock()
+	d, ok := h.durations[version]
+	h.mu.Unlock()
+	if ok {
+		return d, nil
+	}
+
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		return 0, errFFmpegMissing
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "ffprobe", "-v", "error",
+		"-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", fullPath).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read video: %v", err)
+	}
+	d, err = strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil || d <= 0 {
+		return 0, errors.New("failed to read video duration")
+	}
+
+	h.mu.Lock()
+	if len(h.durations) >= maxStreamDurations {
+		h.durations = make(map[string]float64)
+	}
+	h.durations[version] = d
+	h.mu.Unlock()
+	return d, nil
+}
+
+// transcodeSegment runs ffmpeg to produce one MPEG-TS segment starting at start seconds
+func transcodeSegment(fullPath string, start, duration float64, height int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), streamTranscodeTimeout)
+	defer cancel()
+
+	ss := strconv.FormatFloat(start, 'f', 3, 64)
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error", "-nostdin",
+		"-ss", ss, "-i", fullPath, "-t", strconv.FormatFloat(duration, 'f', 3, 64),
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", height),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-force_key_frames", "expr:gte(t,0)",
+		"-c:a", "aac", "-ac", "2", "-b:a", "128k",
+		"-output_ts_offset", ss, "-muxdelay", "0",
+		"-f", "mpegts", "pipe:1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, errors.New("timed out transcoding video")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// segment returns the cached path of a segment, transcoding it if needed. Requests for a segment
+// that is already being transcoded wait for that run instead of starting another.
+func (h *StreamHandler) segment(fullPath, key string, start, duration float64, height int) (string, error) {
+	if path, ok := h.cache.Get(key); ok {
+		return path, nil
+	}
+
+	h.mu.Lock()
+	if seg, ok := h.inFlight[key]; ok {
+		h.mu.Unlock()
+		<-seg.done
+		return seg.path, seg.err
+	}
+	seg := &streamSegment{done: make(chan struct{})}
+	h.inFlight[key] = seg
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.inFlight, key)
+		h.mu.Unlock()
+		close(seg.done)
+	}()
+
+	h.transcodes <- struct{}{}
+	data, err := transcodeSegment(fullPath, start, duration, height)
+	<-h.transcodes
+	if err != nil {
+		seg.err = err
+		return "", err
+	}
+	seg.path, seg.err = h.cache.Put(key, "ts", data)
+	return seg.path, seg.err
+}
+
+// StreamZoneVideo serves a video as HLS. Without a segment parameter it returns the playlist,
+// which lists every segment up front so players can seek; ?segment=N returns one MPEG-TS segment.
+// The optional height parameter (360, 480, 720 or 1080) sets the output resolution.
+func (h *StreamHandler) StreamZoneVideo(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	height := defaultStreamHeight
+	if v := r.URL.Query().Get("height"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || !streamHeights[n] {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid height (must be 360, 480, 720 or 1080)", nil)
+			return
+		}
+		height = n
+	}
+
+	fullPath, _, pool, err := h.files.resolveZonePathWithPool(chi.URLParam(r, "zoneId"), chi.URLParam(r, "*"), userFromContext(userCtx))
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return
+	}
+	if pool.IsS3() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Video streaming is not available on object storage pools", nil)
+		return
+	}
+	if !streamVideoExtensions[strings.ToLower(strings.TrimPrefix(filepath.Ext(fullPath), "."))] {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Not a supported video", nil)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil || !info.Mode().IsRegular() {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		return
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		apierror.Error(w, errFFmpegMissing.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	version := streamVersionKey(fullPath, info)
+	total, err := h.probeDuration(fullPath, version)
+	if err != nil {
+		if errors.Is(err, errFFmpegMissing) {
+			apierror.Error(w, err.Error(), http.StatusNotImplemented)
+		} else {
+			apierror.Write(w, http.StatusUnprocessableEntity, apierror.CodeUnprocessableEntity, err.Error(), nil)
+		}
+		return
+	}
+	count := int(math.Ceil(total / streamSegmentDuration))
+
+	v := r.URL.Query().Get("segment")
+	if v == "" {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte(streamPlaylist(total, count, height)))
+		return
+	}
+
+	index, err := strconv.Atoi(v)
+	if err != nil || index < 0 || index >= count {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid segment", nil)
+		return
+	}
+	start := float64(index * streamSegmentDuration)
+	duration := min(float64(streamSegmentDuration), total-start)
+
+	path, err := h.segment(fullPath, fmt.Sprintf("%s%d-%d", version[:32], height, index), start, duration, height)
+	if err != nil {
+		log.Printf("Stream: failed to transcode segment %d of %s: %v", index, fullPath, err)
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		apierror.Error(w, "Segment not available", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
+
+// streamPlaylist builds the VOD playlist of a video. Segment URIs are relative to the playlist,
+// so they only replace its query string.
+func streamPlaylist(total float64, count, height int) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n", streamSegmentDuration)
+	for i := 0; i < count; i++ {
+		duration := min(float64(streamSegmentDuration), total-float64(i*streamSegmentDuration))
+		params := url.Values{}
+		params.Set("height", strconv.Itoa(height))
+		params.Set("segment", strconv.Itoa(i))
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n?%s\n", duration, params.Encode())
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+// GetCacheStats returns the number and total size of cached segments
+func (h *StreamHandler) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	count, size := h.cache.Stats()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"segments":  count,
+		"size":      size,
+		"max_bytes": h.cache.maxBytes,
+	})
+}
+
+// ClearCache removes all cached segments
+func (h *StreamHandler) ClearCache(w http.ResponseWriter, r *http.Request) {
+	h.cache.Clear()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Stream cache cleared",
+	})
+}
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/internal/syslog"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+const (
+	// syslogQueueSize is the number of messages held while the server cannot be reached
+	syslogQueueSize = 1000
+	// syslogRetryInterval is how long a message that could not be sent waits to be sent again
+	syslogRetryInterval = 5 * time.Second
+	// syslogAuditSDID identifies the structured data of audit messages; 32473 is the enterprise
+	// number reserved for documentation (RFC 5612)
+	syslogAuditSDID = "audit@32473"
+)
+
+// syslogSettingKeys are the settings saved by UpdateSyslog
+var syslogSettingKeys = []string{
+	models.SettingSyslogEnabled,
+	models.SettingSyslogProtocol,
+	models.SettingSyslogHost,
+	models.SettingSyslogPort,
+	models.SettingSyslogFacility,
+	models.SettingSyslogAppName,
+	models.SettingSyslogAppLogs,
+	models.SettingSyslogAuditLogs,
+	models.SettingSyslogTLSCA,
+}
+
+// logTimestamp matches the date and time the log package puts before each line
+var logTimestamp = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(\.\d+)? `)
+
+// logErrorWords marks server log lines sent with error severity
+var logErrorWords = regexp.MustCompile(`(?i)\b(error|failed|fatal|panic)\b`)
+
+// GetSyslogSettingsFromStore returns the syslog forwarding settings, with defaults for those never saved
+func GetSyslogSettingsFromStore(store storage.DataStore) models.SyslogSettings {
+	settings := models.DefaultSyslogSettings()
+	boolSetting := func(key string, value *bool) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil {
+			*value = setting.Value == "true"
+		}
+	}
+	stringSetting := func(key string, value *string) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil && setting.Value != "" {
+			*value = setting.Value
+		}
+	}
+	boolSetting(models.SettingSyslogEnabled, &settings.Enabled)
+	stringSetting(models.SettingSyslogProtocol, &settings.Protocol)
+	stringSetting(models.SettingSyslogHost, &settings.Host)
+	if setting, err := store.GetSetting(models.SettingSyslogPort); err == nil && setting != nil {
+		if n, err := strconv.Atoi(setting.Value); err == nil && n >= 0 {
+			settings.Port = n
+		}
+	}
+	stringSetting(models.SettingSyslogFacility, &settings.Facility)
+	stringSetting(models.SettingSyslogAppName, &settings.AppName)
+	boolSetting(models.SettingSyslogAppLogs, &settings.AppLogs)
+	boolSetting(models.SettingSyslogAuditLogs, &settings.AuditLogs)
+	stringSetting(models.SettingSyslogTLSCA, &settings.TLSCA)
+	return settings
+}
+
+// newSyslogClient creates a client for the configured server
+func newSyslogClient(settings models.SyslogSettings) (*syslog.Client, error) {
+	port := settings.Port
+	if port == 0 {
+		port = syslog.DefaultPort
+		if settings.Protocol == syslog.TLS {
+			port = syslog.DefaultTLSPort
+		}
+	}
+	facility, ok := syslog.Facilities[settings.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown facility: %s", settings.Facility)
+	}
+
+	client := syslog.New(settings.Protocol, net.JoinHostPort(settings.Host, strconv.Itoa(port)), facility, settings.AppName)
+	if settings.Protocol == syslog.TLS {
+		client.TLSConfig = &tls.Config{ServerName: settings.Host, MinVersion: tls.VersionTLS12}
+		if strings.TrimSpace(settings.TLSCA) != "" {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM([]byte(settings.TLSCA)) {
+				return nil, fmt.Errorf("tls_ca does not hold a PEM certificate")
+			}
+			client.TLSConfig.RootCAs = pool
+		}
+	}
+	return client, nil
+}
+
+// SyslogForwarder sends the server log and the audit events to a remote syslog server. Messages
+// are queued, so a slow or unreachable server never holds up logging.
+type SyslogForwarder struct {
+	store    storage.DataStore
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	status   models.SyslogStatus
+	reset    chan struct{}
+	queue    chan syslog.Message
+
+	appLogs   atomic.Bool
+	auditLogs atomic.Bool
+	dropped   atomic.Uint64
+}
+
+// NewSyslogForwarder creates a new syslog forwarder
+func NewSyslogForwarder(store storage.DataStore) *SyslogForwarder {
+	return &SyslogForwarder{
+		store:    store,
+		stopChan: make(chan struct{}),
+		reset:    make(chan struct{}, 1),
+		queue:    make(chan syslog.Message, syslogQueueSize),
+	}
+}
+
+// Start subscribes to the event bus and begins forwarding
+func (f *SyslogForwarder) Start() {
+	f.mu.Lock()
+	if f.running {
+		f.mu.Unlock()
+		return
+	}
+	f.running = true
+	f.stopChan = make(chan struct{})
+	f.mu.Unlock()
+
+	f.applySettings(GetSyslogSettingsFromStore(f.store))
+
+	sub := events.Default.Subscribe()
+	f.wg.Add(2)
+	go f.collect(sub)
+	go f.run()
+	log.Println("Syslog forwarder started")
+}
+
+// Stop stops forwarding; messages still queued are dropped
+func (f *SyslogForwarder) Stop() {
+	f.mu.Lock()
+	if !f.running {
+		f.mu.Unlock()
+		return
+	}
+	f.running = false
+	close(f.stopChan)
+	f.mu.Unlock()
+
+	f.wg.Wait()
+	log.Println("Syslog forwarder stopped")
+}
+
+// Reload makes the forwarder connect again with changed settings
+func (f *SyslogForwarder) Reload() {
+	f.applySettings(GetSyslogSettingsFromStore(f.store))
+	select {
+	case f.reset <- struct{}{}:
+	default:
+	}
+}
+
+// applySettings sets which logs are queued
+func (f *SyslogForwarder) applySettings(settings models.SyslogSettings) {
+	f.appLogs.Store(settings.Enabled && settings.AppLogs)
+	f.auditLogs.Store(settings.Enabled && settings.AuditLogs)
+}
+
+// Write queues lines of the server log. It is set as an output of the log package, so it must
+// not log itself.
+func (f *SyslogForwarder) Write(p []byte) (int, error) {
+	if !f.appLogs.Load() {
+		return len(p), nil
+	}
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		text := logTimestamp.ReplaceAllString(string(line), "")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		severity := syslog.Info
+		if logErrorWords.MatchString(text) {
+			severity = syslog.Error
+		}
+		f.enqueue(syslog.Message{Time: time.Now(), Severity: severity, MsgID: "app", Text: text})
+	}
+	return len(p), nil
+}
+
+// enqueue adds a message to the queue, dropping it when the queue is full
+func (f *SyslogForwarder) enqueue(m syslog.Message) {
+	select {
+	case f.queue <- m:
+	default:
+		f.dropped.Add(1)
+	}
+}
+
+// collect queues the events written to the event log, which skips transient ones
+func (f *SyslogForwarder) collect(sub *events.Subscription) {
+	defer f.wg.Done()
+	defer sub.Close()
+
+	for {
+		select {
+		case <-f.stopChan:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if f.auditLogs.Load() && !events.Transient(e.Type) {
+				if m, ok := auditMessage(e); ok {
+					f.enqueue(m)
+				}
+			}
+		}
+	}
+}
+
+// run sends the queued messages, holding a message until it is sent or the settings change
+func (f *SyslogForwarder) run() {
+	defer f.wg.Done()
+
+	var client *syslog.Client
+	connect := func() {
+		if client != nil {
+			client.Close()
+			client = nil
+		}
+		settings := GetSyslogSettingsFromStore(f.store)
+		f.setStatus(func(s *models.SyslogStatus) {
+			s.Enabled = settings.Enabled
+			s.Connected = false
+		})
+		if !settings.Enabled {
+			return
+		}
+		c, err := newSyslogClient(settings)
+		if err != nil {
+			f.setError(err)
+			return
+		}
+		client = c
+	}
+	connect()
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-f.stopChan:
+			return
+		case <-f.reset:
+			connect()
+		case m := <-f.queue:
+			// The message is held until it is sent, forwarding is turned off or the forwarder stops
+			for client != nil && !f.send(client, m) {
+				select {
+				case <-f.stopChan:
+					return
+				case <-f.reset:
+					connect()
+				case <-time.After(syslogRetryInterval):
+				}
+			}
+		}
+	}
+}
+
+// send sends a message and records the outcome in the status
+func (f *SyslogForwarder) send(client *syslog.Client, m syslog.Message) bool {
+	if err := client.Send(m); err != nil {
+		f.setError(err)
+		return false
+	}
+	now := time.Now()
+	f.setStatus(func(s *models.SyslogStatus) {
+		s.Connected = true
+		s.Sent++
+		s.LastSent = &now
+	})
+	return true
+}
+
+// setError records a failure to reach the server, logging it when the server was reachable
+func (f *SyslogForwarder) setError(err error) {
+	now := time.Now()
+	wasConnected := false
+	f.setStatus(func(s *models.SyslogStatus) {
+		wasConnected = s.Connected || s.LastError == ""
+		s.Connected = false
+		s.LastError = err.Error()
+		s.LastErrorAt = &now
+	})
+	if wasConnected {
+		log.Printf("Syslog: %v", err)
+	}
+}
+
+// setStatus updates the status under the lock
+func (f *SyslogForwarder) setStatus(update func(s *models.SyslogStatus)) {
+	f.mu.Lock()
+	update(&f.status)
+	f.mu.Unlock()
+}
+
+// Status returns how forwarding is doing
+func (f *SyslogForwarder) Status() models.SyslogStatus {
+	f.mu.Lock()
+	status := f.status
+	f.mu.Unlock()
+	status.Dropped = f.dropped.Load()
+	status.Queued = len(f.queue)
+	return status
+}
+
+// auditMessage turns an event of the event log into a syslog message: the event as JSON, with
+// who did what to which object as structured data
+func auditMessage(e *events.Event) (syslog.Message, bool) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return syslog.Message{}, false
+	}
+	return syslog.Message{
+		Time:     e.Time,
+		Severity: auditSeverity(e.Type),
+		MsgID:    e.Type,
+		SDID:     syslogAuditSDID,
+		Params: map[string]string{
+			"id":          e.ID,
+			"type":        e.Type,
+			"actor":       e.Actor,
+			"object_type": e.ObjectType,
+			"object_id":   e.ObjectID,
+		},
+		Text: string(data),
+	}, true
+}
+
+// auditSeverity returns the severity of an event type: warning for failures and security
+// events, notice for everything else
+func auditSeverity(eventType string) int {
+	switch eventType {
+	case events.TypeSecurityEvent, events.TypeLoginFailed, events.TypeMalwareDetected,
+		events.TypeStorageAlertRaised, events.TypeUPSPowerEvent, events.TypeImpersonation:
+		return syslog.Warning
+	}
+	if strings.HasSuffix(eventType, ".failed") {
+		return syslog.Warning
+	}
+	return syslog.Notice
+}
+
+// GetSyslog returns the syslog forwarding settings and status (admin only)
+func (f *SyslogForwarder) GetSyslog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"settings": GetSyslogSettingsFromStore(f.store),
+		"status":   f.Status(),
+	})
+}
+
+// UpdateSyslog saves the syslog forwarding settings; fields left out keep their value (admin only)
+func (f *SyslogForwarder) UpdateSyslog(w http.ResponseWriter, r *http.Request) {
+	req := GetSyslogSettingsFromStore(f.store)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	req.Host = strings.TrimSpace(req.Host)
+	req.AppName = strings.TrimSpace(req.AppName)
+	req.Protocol = strings.ToLower(strings.TrimSpace(req.Protocol))
+	req.Facility = strings.ToLower(strings.TrimSpace(req.Facility))
+	if req.Protocol != syslog.UDP && req.Protocol != syslog.TCP && req.Protocol != syslog.TLS {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Protocol must be udp, tcp or tls", nil)
+		return
+	}
+	if req.Enabled && req.Host == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Host is required", nil)
+		return
+	}
+	if req.Port < 0 || req.Port > 65535 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Port must be between 1 and 65535, or 0 for the default", nil)
+		return
+	}
+	if _, ok := syslog.Facilities[req.Facility]; !ok {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Unknown facility", nil)
+		return
+	}
+	if req.AppName == "" || len(req.AppName) > 48 || strings.ContainsAny(req.AppName, " \t") {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "app_name must be 1 to 48 characters without spaces", nil)
+		return
+	}
+	if _, err := newSyslogClient(req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	category := string(models.CategoryGeneral)
+	f.store.SetSetting(models.SettingSyslogEnabled, strconv.FormatBool(req.Enabled), "bool", category)
+	f.store.SetSetting(models.SettingSyslogProtocol, req.Protocol, "string", category)
+	f.store.SetSetting(models.SettingSyslogHost, req.Host, "string", category)
+	f.store.SetSetting(models.SettingSyslogPort, strconv.Itoa(req.Port), "int", category)
+	f.store.SetSetting(models.SettingSyslogFacility, req.Facility, "string", category)
+	f.store.SetSetting(models.SettingSyslogAppName, req.AppName, "string", category)
+	f.store.SetSetting(models.SettingSyslogAppLogs, strconv.FormatBool(req.AppLogs), "bool", category)
+	f.store.SetSetting(models.SettingSyslogAuditLogs, strconv.FormatBool(req.AuditLogs), "bool", category)
+	f.store.SetSetting(models.SettingSyslogTLSCA, req.TLSCA, "string", category)
+	publishSettingsChanged(r, syslogSettingKeys)
+	f.Reload()
+
+	f.GetSyslog(w, r)
+}
+
+// TestSyslog sends a test message to the configured server right away, reporting whether it
+// could be sent (admin only)
+func (f *SyslogForwarder) TestSyslog(w http.ResponseWriter, r *http.Request) {
+	settings := GetSyslogSettingsFromStore(f.store)
+	if settings.Host == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "No syslog server configured", nil)
+		return
+	}
+	client, err := newSyslogClient(settings)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	defer client.Close()
+
+	actor := "an admin"
+	if userCtx := middleware.GetUserContext(r); userCtx != nil {
+		actor = userCtx.Username
+	}
+	err = client.Send(syslog.Message{
+		Time:     time.Now(),
+		Severity: syslog.Notice,
+		MsgID:    "test",
+		Text:     fmt.Sprintf("Test message from FileServ, sent by %s", actor),
+	})
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Test message sent"})
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
@@ -13,7 +14,10 @@ import (
 	"strings"
 	"time"
 
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
 	"fileserv/models"
+	"fileserv/storage"
 )
 
 // Service name validation regex - only alphanumeric, dashes, underscores, and @
@@ -345,7 +349,7 @@ func GetServices() http.HandlerFunc {
 			// Get all loaded services
 			output, err := execCommand("systemctl", "list-units", "--type=service", "--all", "--no-pager", "--plain", "--no-legend")
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierror.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
@@ -439,7 +443,7 @@ func ControlService() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
@@ -454,20 +458,20 @@ func ControlService() http.HandlerFunc {
 		}
 
 		if !validActions[req.Action] {
-			http.Error(w, "Invalid action", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid action", nil)
 			return
 		}
 
 		// Validate service name using comprehensive validation
 		if err := validateServiceName(req.Service); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		cmd := exec.Command("systemctl", req.Action, req.Service+".service")
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to %s service: %s", req.Action, string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to %s service: %s", req.Action, string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -483,7 +487,7 @@ func GetNetworkInterfaces() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		interfaces, err := getNetworkInterfaces()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -610,7 +614,7 @@ func GetProcesses() http.HandlerFunc {
 		}
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -665,12 +669,12 @@ func KillProcess() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.PID <= 0 {
-			http.Error(w, "Invalid PID", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid PID", nil)
 			return
 		}
 
@@ -686,14 +690,14 @@ func KillProcess() http.HandlerFunc {
 		}
 
 		if !validSignals[signal] {
-			http.Error(w, "Invalid signal", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid signal", nil)
 			return
 		}
 
 		cmd := exec.Command("kill", "-"+signal, strconv.Itoa(req.PID))
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to kill process: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to kill process: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -702,6 +706,54 @@ func KillProcess() http.HandlerFunc {
 	}
 }
 
+// journalEntry is a journal entry as returned by the log endpoints
+type journalEntry struct {
+	Timestamp string `json:"timestamp"`
+	Priority  int    `json:"priority"`
+	Unit      string `json:"unit"`
+	Message   string `json:"message"`
+	Hostname  string `json:"hostname"`
+	Cursor    string `json:"-"` // Position in the journal, to resume after the entry
+}
+
+// parseJournalEntry reads a line of journalctl -o json output
+func parseJournalEntry(line []byte) (journalEntry, bool) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return journalEntry{}, false
+	}
+
+	entry := journalEntry{}
+
+	if ts, ok := raw["__REALTIME_TIMESTAMP"].(string); ok {
+		usec, _ := strconv.ParseInt(ts, 10, 64)
+		t := time.Unix(0, usec*1000)
+		entry.Timestamp = t.Format(time.RFC3339)
+	}
+
+	if pri, ok := raw["PRIORITY"].(string); ok {
+		entry.Priority, _ = strconv.Atoi(pri)
+	}
+
+	if unit, ok := raw["_SYSTEMD_UNIT"].(string); ok {
+		entry.Unit = unit
+	}
+
+	if msg, ok := raw["MESSAGE"].(string); ok {
+		entry.Message = msg
+	}
+
+	if host, ok := raw["_HOSTNAME"].(string); ok {
+		entry.Hostname = host
+	}
+
+	if cursor, ok := raw["__CURSOR"].(string); ok {
+		entry.Cursor = cursor
+	}
+
+	return entry, true
+}
+
 // GetSystemLogs returns system logs
 func GetSystemLogs() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -711,19 +763,19 @@ func GetSystemLogs() http.HandlerFunc {
 
 		// Validate unit parameter
 		if err := validateJournalUnit(unit); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate lines parameter
 		if err := validateJournalLines(lines); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate priority parameter
 		if err := validateJournalPriority(priority); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -746,52 +798,17 @@ func GetSystemLogs() http.HandlerFunc {
 
 		output, err := execCommand("journalctl", args...)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		// Parse journal entries
-		type LogEntry struct {
-			Timestamp   string `json:"timestamp"`
-			Priority    int    `json:"priority"`
-			Unit        string `json:"unit"`
-			Message     string `json:"message"`
-			Hostname    string `json:"hostname"`
-		}
-
-		var entries []LogEntry
+		var entries []journalEntry
 		scanner := bufio.NewScanner(strings.NewReader(output))
 		for scanner.Scan() {
-			var raw map[string]interface{}
-			if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
-				continue
-			}
-
-			entry := LogEntry{}
-
-			if ts, ok := raw["__REALTIME_TIMESTAMP"].(string); ok {
-				usec, _ := strconv.ParseInt(ts, 10, 64)
-				t := time.Unix(0, usec*1000)
-				entry.Timestamp = t.Format(time.RFC3339)
-			}
-
-			if pri, ok := raw["PRIORITY"].(string); ok {
-				entry.Priority, _ = strconv.Atoi(pri)
-			}
-
-			if unit, ok := raw["_SYSTEMD_UNIT"].(string); ok {
-				entry.Unit = unit
-			}
-
-			if msg, ok := raw["MESSAGE"].(string); ok {
-				entry.Message = msg
-			}
-
-			if host, ok := raw["_HOSTNAME"].(string); ok {
-				entry.Hostname = host
+			if entry, ok := parseJournalEntry(scanner.Bytes()); ok {
+				entries = append(entries, entry)
 			}
-
-			entries = append(entries, entry)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -807,13 +824,13 @@ func GetDMESGLogs() http.HandlerFunc {
 
 		// Validate level parameter
 		if err := validateDmesgLevel(level); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
 		// Validate facility parameter
 		if err := validateDmesgFacility(facility); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -828,7 +845,7 @@ func GetDMESGLogs() http.HandlerFunc {
 
 		output, err := execCommand("dmesg", args...)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -857,15 +874,16 @@ func GetDMESGLogs() http.HandlerFunc {
 	}
 }
 
-// PowerControl handles system power operations
-func PowerControl() http.HandlerFunc {
+// PowerControl handles system power operations. Every request is recorded as a security event
+// before the command runs, since the server may not get to record it afterwards.
+func PowerControl(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
 			Action string `json:"action"` // reboot, poweroff, suspend, hibernate
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
@@ -880,13 +898,27 @@ func PowerControl() http.HandlerFunc {
 		case "hibernate":
 			cmd = exec.Command("systemctl", "hibernate")
 		default:
-			http.Error(w, "Invalid action", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid action", nil)
 			return
 		}
 
+		actor := ""
+		if userCtx := middleware.GetUserContext(r); userCtx != nil {
+			actor = userCtx.Username
+		}
+		log.Printf("Security: %s requested system %s", actor, req.Action)
+		recordSecurityEvent(store, &models.SecurityEvent{
+			Type:    models.SecurityEventPowerControl,
+			Source:  "system",
+			Actor:   actor,
+			Target:  req.Action,
+			IP:      getClientIP(r),
+			Message: fmt.Sprintf("System %s requested by %s", req.Action, actor),
+		})
+
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to %s: %s", req.Action, string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to %s: %s", req.Action, string(output)), http.StatusInternalServerError)
 			return
 		}
 
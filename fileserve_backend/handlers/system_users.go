@@ -12,6 +12,9 @@ import (
 	"strconv"
 	"strings"
 
+	"fileserv/internal/apierror"
+	"fileserv/storage"
+
 	"github.com/go-chi/chi/v5"
 )
 
@@ -89,7 +92,7 @@ func ListSystemUsers() http.HandlerFunc {
 
 		users, err := getSystemUsers(includeSystem)
 		if err != nil {
-			http.Error(w, "Failed to list system users: "+err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, "Failed to list system users: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -103,7 +106,7 @@ func ListSystemGroups() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		groups, err := getSystemGroups()
 		if err != nil {
-			http.Error(w, "Failed to list system groups: "+err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, "Failed to list system groups: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -117,19 +120,19 @@ func GetSystemUser() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		username := chi.URLParam(r, "username")
 		if username == "" {
-			http.Error(w, "Username required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username required", nil)
 			return
 		}
 
 		u, err := user.Lookup(username)
 		if err != nil {
-			http.Error(w, "User not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", nil)
 			return
 		}
 
 		sysUser, err := userToSystemUser(u)
 		if err != nil {
-			http.Error(w, "Failed to get user details: "+err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, "Failed to get user details: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -139,29 +142,33 @@ func GetSystemUser() http.HandlerFunc {
 }
 
 // CreateSystemUser creates a new system user
-func CreateSystemUser() http.HandlerFunc {
+func CreateSystemUser(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateSystemUserRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		// Validate username
 		if !validUsername(req.Username) {
-			http.Error(w, "Invalid username. Must be lowercase, start with letter or underscore, max 32 chars", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid username. Must be lowercase, start with letter or underscore, max 32 chars", nil)
 			return
 		}
 
 		// Check if user already exists
 		if _, err := user.Lookup(req.Username); err == nil {
-			http.Error(w, "User already exists", http.StatusConflict)
+			apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "User already exists", nil)
 			return
 		}
 
 		// Validate password
 		if len(req.Password) < 1 {
-			http.Error(w, "Password is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Password is required", nil)
+			return
+		}
+		if err := validatePasswordComplexity(GetPasswordPolicyFromStore(store), req.Password); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -175,7 +182,7 @@ func CreateSystemUser() http.HandlerFunc {
 		if req.Shell != "" {
 			// Validate shell exists
 			if _, err := os.Stat(req.Shell); err != nil {
-				http.Error(w, "Invalid shell: "+req.Shell, http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid shell: "+req.Shell, nil)
 				return
 			}
 			args = append(args, "-s", req.Shell)
@@ -189,7 +196,7 @@ func CreateSystemUser() http.HandlerFunc {
 			// Validate groups exist
 			for _, g := range req.Groups {
 				if _, err := user.LookupGroup(g); err != nil {
-					http.Error(w, fmt.Sprintf("Group '%s' does not exist", g), http.StatusBadRequest)
+					apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Group '%s' does not exist", g), nil)
 					return
 				}
 			}
@@ -201,7 +208,7 @@ func CreateSystemUser() http.HandlerFunc {
 		// Create user
 		cmd := exec.Command("useradd", args...)
 		if output, err := cmd.CombinedOutput(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create user: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create user: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -211,14 +218,19 @@ func CreateSystemUser() http.HandlerFunc {
 		if output, err := cmd.CombinedOutput(); err != nil {
 			// Try to clean up the user we just created
 			exec.Command("userdel", "-r", req.Username).Run()
-			http.Error(w, fmt.Sprintf("Failed to set password: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to set password: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
+		recordPasswordChange(store, req.Username, "", req.Password)
+		if granted := grantedAdminGroups(nil, req.Groups); len(granted) > 0 {
+			recordPrivilegeEscalation(store, r, req.Username, fmt.Sprintf("System user %s was created in admin groups %s",
+				req.Username, strings.Join(granted, ", ")))
+		}
 
 		// Return the created user
 		u, err := user.Lookup(req.Username)
 		if err != nil {
-			http.Error(w, "User created but failed to retrieve details", http.StatusInternalServerError)
+			apierror.Error(w, "User created but failed to retrieve details", http.StatusInternalServerError)
 			return
 		}
 
@@ -230,29 +242,29 @@ func CreateSystemUser() http.HandlerFunc {
 }
 
 // UpdateSystemUser updates an existing system user
-func UpdateSystemUser() http.HandlerFunc {
+func UpdateSystemUser(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		username := chi.URLParam(r, "username")
 		if username == "" {
-			http.Error(w, "Username required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username required", nil)
 			return
 		}
 
 		// Check user exists
 		if _, err := user.Lookup(username); err != nil {
-			http.Error(w, "User not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", nil)
 			return
 		}
 
 		// Prevent modifying root
 		if username == "root" {
-			http.Error(w, "Cannot modify root user", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Cannot modify root user", nil)
 			return
 		}
 
 		var req UpdateSystemUserRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
@@ -266,7 +278,7 @@ func UpdateSystemUser() http.HandlerFunc {
 		if req.Shell != "" {
 			// Validate shell exists
 			if _, err := os.Stat(req.Shell); err != nil {
-				http.Error(w, "Invalid shell: "+req.Shell, http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid shell: "+req.Shell, nil)
 				return
 			}
 			args = append(args, "-s", req.Shell)
@@ -280,7 +292,7 @@ func UpdateSystemUser() http.HandlerFunc {
 			// Validate groups exist
 			for _, g := range req.Groups {
 				if _, err := user.LookupGroup(g); err != nil {
-					http.Error(w, fmt.Sprintf("Group '%s' does not exist", g), http.StatusBadRequest)
+					apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Group '%s' does not exist", g), nil)
 					return
 				}
 			}
@@ -297,12 +309,17 @@ func UpdateSystemUser() http.HandlerFunc {
 
 		// Run usermod if we have changes
 		if len(args) > 0 {
+			previousGroups, _ := getUserGroups(username)
 			args = append(args, username)
 			cmd := exec.Command("usermod", args...)
 			if output, err := cmd.CombinedOutput(); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to update user: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+				apierror.Error(w, fmt.Sprintf("Failed to update user: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 				return
 			}
+			if granted := grantedAdminGroups(previousGroups, req.Groups); len(granted) > 0 {
+				recordPrivilegeEscalation(store, r, username, fmt.Sprintf("System user %s was added to admin groups %s",
+					username, strings.Join(granted, ", ")))
+			}
 		}
 
 		// Update password if provided
@@ -310,7 +327,7 @@ func UpdateSystemUser() http.HandlerFunc {
 			cmd := exec.Command("chpasswd")
 			cmd.Stdin = strings.NewReader(fmt.Sprintf("%s:%s", username, req.Password))
 			if output, err := cmd.CombinedOutput(); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to update password: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+				apierror.Error(w, fmt.Sprintf("Failed to update password: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 				return
 			}
 		}
@@ -318,7 +335,7 @@ func UpdateSystemUser() http.HandlerFunc {
 		// Return the updated user
 		u, err := user.Lookup(username)
 		if err != nil {
-			http.Error(w, "User updated but failed to retrieve details", http.StatusInternalServerError)
+			apierror.Error(w, "User updated but failed to retrieve details", http.StatusInternalServerError)
 			return
 		}
 
@@ -333,19 +350,19 @@ func DeleteSystemUser() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		username := chi.URLParam(r, "username")
 		if username == "" {
-			http.Error(w, "Username required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username required", nil)
 			return
 		}
 
 		// Check user exists
 		if _, err := user.Lookup(username); err != nil {
-			http.Error(w, "User not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", nil)
 			return
 		}
 
 		// Prevent deleting root or the current process user
 		if username == "root" {
-			http.Error(w, "Cannot delete root user", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Cannot delete root user", nil)
 			return
 		}
 
@@ -361,7 +378,7 @@ func DeleteSystemUser() http.HandlerFunc {
 
 		cmd := exec.Command("userdel", args...)
 		if output, err := cmd.CombinedOutput(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to delete user: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to delete user: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -500,13 +517,13 @@ func GetSystemGroup() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		groupName := chi.URLParam(r, "groupname")
 		if groupName == "" {
-			http.Error(w, "Group name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Group name required", nil)
 			return
 		}
 
 		g, err := user.LookupGroup(groupName)
 		if err != nil {
-			http.Error(w, "Group not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeGroupNotFound, "Group not found", nil)
 			return
 		}
 
@@ -529,19 +546,19 @@ func CreateSystemGroup() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateSystemGroupRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		// Validate group name
 		if !validGroupName(req.Name) {
-			http.Error(w, "Invalid group name. Must be lowercase, start with letter or underscore, max 32 chars", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid group name. Must be lowercase, start with letter or underscore, max 32 chars", nil)
 			return
 		}
 
 		// Check if group already exists
 		if _, err := user.LookupGroup(req.Name); err == nil {
-			http.Error(w, "Group already exists", http.StatusConflict)
+			apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "Group already exists", nil)
 			return
 		}
 
@@ -554,14 +571,14 @@ func CreateSystemGroup() http.HandlerFunc {
 
 		cmd := exec.Command("groupadd", args...)
 		if output, err := cmd.CombinedOutput(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create group: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create group: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
 		// Return the created group
 		g, err := user.LookupGroup(req.Name)
 		if err != nil {
-			http.Error(w, "Group created but failed to retrieve details", http.StatusInternalServerError)
+			apierror.Error(w, "Group created but failed to retrieve details", http.StatusInternalServerError)
 			return
 		}
 
@@ -581,13 +598,13 @@ func UpdateSystemGroup() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		groupName := chi.URLParam(r, "groupname")
 		if groupName == "" {
-			http.Error(w, "Group name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Group name required", nil)
 			return
 		}
 
 		// Check group exists
 		if _, err := user.LookupGroup(groupName); err != nil {
-			http.Error(w, "Group not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeGroupNotFound, "Group not found", nil)
 			return
 		}
 
@@ -595,45 +612,45 @@ func UpdateSystemGroup() http.HandlerFunc {
 		criticalGroups := []string{"root", "wheel", "sudo", "adm", "bin", "daemon", "sys", "nobody"}
 		for _, cg := range criticalGroups {
 			if groupName == cg {
-				http.Error(w, "Cannot modify system group: "+groupName, http.StatusForbidden)
+				apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Cannot modify system group: "+groupName, nil)
 				return
 			}
 		}
 
 		var req UpdateSystemGroupRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.NewName == "" {
-			http.Error(w, "New name is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "New name is required", nil)
 			return
 		}
 
 		// Validate new group name
 		if !validGroupName(req.NewName) {
-			http.Error(w, "Invalid new group name. Must be lowercase, start with letter or underscore, max 32 chars", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid new group name. Must be lowercase, start with letter or underscore, max 32 chars", nil)
 			return
 		}
 
 		// Check if new name already exists
 		if _, err := user.LookupGroup(req.NewName); err == nil {
-			http.Error(w, "A group with the new name already exists", http.StatusConflict)
+			apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "A group with the new name already exists", nil)
 			return
 		}
 
 		// Rename group using groupmod
 		cmd := exec.Command("groupmod", "-n", req.NewName, groupName)
 		if output, err := cmd.CombinedOutput(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to rename group: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to rename group: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
 		// Return the updated group
 		g, err := user.LookupGroup(req.NewName)
 		if err != nil {
-			http.Error(w, "Group renamed but failed to retrieve details", http.StatusInternalServerError)
+			apierror.Error(w, "Group renamed but failed to retrieve details", http.StatusInternalServerError)
 			return
 		}
 
@@ -654,13 +671,13 @@ func DeleteSystemGroup() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		groupName := chi.URLParam(r, "groupname")
 		if groupName == "" {
-			http.Error(w, "Group name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Group name required", nil)
 			return
 		}
 
 		// Check group exists
 		if _, err := user.LookupGroup(groupName); err != nil {
-			http.Error(w, "Group not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeGroupNotFound, "Group not found", nil)
 			return
 		}
 
@@ -668,14 +685,14 @@ func DeleteSystemGroup() http.HandlerFunc {
 		criticalGroups := []string{"root", "wheel", "sudo", "adm", "bin", "daemon", "sys", "nobody", "users"}
 		for _, cg := range criticalGroups {
 			if groupName == cg {
-				http.Error(w, "Cannot delete system group: "+groupName, http.StatusForbidden)
+				apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Cannot delete system group: "+groupName, nil)
 				return
 			}
 		}
 
 		cmd := exec.Command("groupdel", groupName)
 		if output, err := cmd.CombinedOutput(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to delete group: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to delete group: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -684,43 +701,48 @@ func DeleteSystemGroup() http.HandlerFunc {
 }
 
 // AddGroupMember adds a user to a group
-func AddGroupMember() http.HandlerFunc {
+func AddGroupMember(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		groupName := chi.URLParam(r, "groupname")
 		if groupName == "" {
-			http.Error(w, "Group name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Group name required", nil)
 			return
 		}
 
 		// Check group exists
 		if _, err := user.LookupGroup(groupName); err != nil {
-			http.Error(w, "Group not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeGroupNotFound, "Group not found", nil)
 			return
 		}
 
 		var req GroupMemberRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Username == "" {
-			http.Error(w, "Username is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username is required", nil)
 			return
 		}
 
 		// Check user exists
 		if _, err := user.Lookup(req.Username); err != nil {
-			http.Error(w, "User not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", nil)
 			return
 		}
 
 		// Add user to group using gpasswd
+		previousGroups, _ := getUserGroups(req.Username)
 		cmd := exec.Command("gpasswd", "-a", req.Username, groupName)
 		if output, err := cmd.CombinedOutput(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to add user to group: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to add user to group: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
+		if len(grantedAdminGroups(previousGroups, []string{groupName})) > 0 {
+			recordPrivilegeEscalation(store, r, req.Username, fmt.Sprintf("System user %s was added to admin group %s",
+				req.Username, groupName))
+		}
 
 		// Return updated group
 		g, _ := user.LookupGroup(groupName)
@@ -741,37 +763,37 @@ func RemoveGroupMember() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		groupName := chi.URLParam(r, "groupname")
 		if groupName == "" {
-			http.Error(w, "Group name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Group name required", nil)
 			return
 		}
 
 		// Check group exists
 		if _, err := user.LookupGroup(groupName); err != nil {
-			http.Error(w, "Group not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeGroupNotFound, "Group not found", nil)
 			return
 		}
 
 		var req GroupMemberRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Username == "" {
-			http.Error(w, "Username is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username is required", nil)
 			return
 		}
 
 		// Check user exists
 		if _, err := user.Lookup(req.Username); err != nil {
-			http.Error(w, "User not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", nil)
 			return
 		}
 
 		// Remove user from group using gpasswd
 		cmd := exec.Command("gpasswd", "-d", req.Username, groupName)
 		if output, err := cmd.CombinedOutput(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to remove user from group: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to remove user from group: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
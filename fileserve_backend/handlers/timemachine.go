@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/sysconf"
+	"fileserv/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	avahiServicesDir       = "/etc/avahi/services"
+	timeMachineServiceFile = "/etc/avahi/services/fileserv-timemachine.service"
+	timeMachineDeviceModel = "TimeCapsule8,119"
+	timeMachineDiskFlags   = "0x82" // Share supports Time Machine and is SMB
+	timeMachineSystemFlags = "0x100"
+)
+
+// timeMachineMaxSizePattern matches a Samba size value such as "500G" or "2T"
+var timeMachineMaxSizePattern = regexp.MustCompile(`^[1-9][0-9]*[KMGTP]?$`)
+
+// timeMachineShareNames returns the SMB share names of the zones offered as Time Machine targets
+func timeMachineShareNames(zones []*models.ShareZone, pools map[string]*models.StoragePool) []string {
+	var names []string
+	for _, zone := range zones {
+		if !zone.SMBEnabled || !zone.Enabled || zone.SMBOptions == nil || !zone.SMBOptions.TimeMachine {
+			continue
+		}
+		pool, ok := pools[zone.PoolID]
+		if !ok || !pool.Enabled || pool.IsS3() {
+			continue
+		}
+		names = append(names, smbShareName(zone))
+	}
+	return names
+}
+
+// renderTimeMachineService generates the avahi service group advertising the SMB server and its
+// Time Machine shares (_adisk) so they show up as backup destinations on macOS
+func renderTimeMachineService(shares []string) string {
+	escape := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	var config strings.Builder
+	config.WriteString("<?xml version=\"1.0\" standalone='no'?>\n")
+	config.WriteString("<!DOCTYPE service-group SYSTEM \"avahi-service.dtd\">\n")
+	config.WriteString("<!-- FileServ managed Time Machine advertisement - DO NOT EDIT MANUALLY -->\n")
+	config.WriteString("<service-group>\n")
+	config.WriteString("  <name replace-wildcards=\"yes\">%h</name>\n")
+	config.WriteString("  <service>\n    <type>_smb._tcp</type>\n    <port>445</port>\n  </service>\n")
+	config.WriteString("  <service>\n    <type>_device-info._tcp</type>\n    <port>9</port>\n")
+	config.WriteString(fmt.Sprintf("    <txt-record>model=%s</txt-record>\n  </service>\n", timeMachineDeviceModel))
+	config.WriteString("  <service>\n    <type>_adisk._tcp</type>\n    <port>9</port>\n")
+	config.WriteString(fmt.Sprintf("    <txt-record>sys=waMa=0,adVF=%s</txt-record>\n", timeMachineSystemFlags))
+	for i, share := range shares {
+		config.WriteString(fmt.Sprintf("    <txt-record>dk%d=adVN=%s,adVF=%s</txt-record>\n", i, escape(share), timeMachineDiskFlags))
+	}
+	config.WriteString("  </service>\n</service-group>\n")
+	return config.String()
+}
+
+// writeTimeMachineService updates the avahi service file for the Time Machine shares, removing it
+// when no zone is a Time Machine target. Nothing is done when avahi is not installed.
+func writeTimeMachineService(zones []*models.ShareZone, pools map[string]*models.StoragePool) error {
+	if info, err := os.Stat(avahiServicesDir); err != nil || !info.IsDir() {
+		return nil
+	}
+
+	shares := timeMachineShareNames(zones, pools)
+	if len(shares) == 0 {
+		if err := os.Remove(timeMachineServiceFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		os.Remove(sysconf.BackupPath(timeMachineServiceFile))
+		return nil
+	}
+
+	// avahi-daemon watches the services directory and picks up the change itself
+	return sysconf.WriteFile(timeMachineServiceFile, []byte(renderTimeMachineService(shares)), 0644)
+}
+
+// GetZoneTimeMachine returns the Time Machine settings of a zone
+func (h *ZoneHandler) GetZoneTimeMachine(w http.ResponseWriter, r *http.Request) {
+	zone, err := h.store.GetShareZone(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+
+	opts := &models.ZoneSMBOptions{}
+	if zone.SMBOptions != nil {
+		opts = zone.SMBOptions
+	}
+
+	_, statErr := os.Stat(timeMachineServiceFile)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":    zone.SMBEnabled && opts.TimeMachine,
+		"max_size":   opts.TimeMachineMaxSize,
+		"share_name": smbShareName(zone),
+		"advertised": statErr == nil,
+	})
+}
+
+// UpdateZoneTimeMachine turns a zone into a Time Machine target for macOS clients or back into a
+// regular share. Enabling it also shares the zone over SMB.
+func (h *ZoneHandler) UpdateZoneTimeMachine(w http.ResponseWriter, r *http.Request) {
+	zone, err := h.store.GetShareZone(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+
+	var req struct {
+		Enabled *bool   `json:"enabled"`
+		MaxSize *string `json:"max_size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	pool, err := h.store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Storage pool not found", nil)
+		return
+	}
+	if pool.IsS3() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "SMB sharing is not available for S3 pools", nil)
+		return
+	}
+
+	opts := &models.ZoneSMBOptions{}
+	if zone.SMBOptions != nil {
+		copied := *zone.SMBOptions
+		opts = &copied
+	}
+	enabled := zone.SMBEnabled
+
+	if req.MaxSize != nil {
+		maxSize := strings.ToUpper(strings.TrimSpace(*req.MaxSize))
+		if maxSize != "" && !timeMachineMaxSizePattern.MatchString(maxSize) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "max_size must be a size such as 500G or 2T", nil)
+			return
+		}
+		opts.TimeMachineMaxSize = maxSize
+	}
+	if req.Enabled != nil {
+		opts.TimeMachine = *req.Enabled
+		if opts.TimeMachine {
+			if zone.ReadOnly {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "A read-only zone cannot be a Time Machine target", nil)
+				return
+			}
+			enabled = true
+		}
+	}
+	// The share name is part of the _adisk TXT record, which uses ',' and '=' as separators
+	if opts.TimeMachine && strings.ContainsAny(smbShareName(zone), ",=") {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Time Machine share names cannot contain ',' or '='", nil)
+		return
+	}
+
+	updated, err := h.store.UpdateShareZoneSMB(zone.ID, enabled, opts)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := ApplySingleZoneSMB(h.store, updated, filepath.Join(pool.Path, updated.Path)); err != nil {
+		// Put the zone back so the store matches what Samba serves
+		h.store.UpdateShareZoneSMB(zone.ID, zone.SMBEnabled, zone.SMBOptions)
+		SyncSMBConfig(h.store)
+		apierror.Error(w, "Failed to apply SMB configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// transferMonthFormat is how months are given to the transfer report
+const transferMonthFormat = "2006-01"
+
+// transferObject is a user, zone or share link that transfers are accounted to
+type transferObject struct {
+	Type string
+	ID   string
+}
+
+// transferKey identifies a pending transfer count
+type transferKey struct {
+	day    string
+	metric string
+	object transferObject
+}
+
+// Transfers are counted in memory and added to the daily statistics by the stats recorder
+var (
+	transferMu       sync.Mutex
+	pendingTransfers = make(map[transferKey]int64)
+)
+
+// transferObjects returns the objects a transfer is accounted to, skipping empty IDs
+func transferObjects(userID, zoneID, linkID string) []transferObject {
+	objects := []transferObject{}
+	if userID != "" {
+		objects = append(objects, transferObject{models.TransferObjectUser, userID})
+	}
+	if zoneID != "" {
+		objects = append(objects, transferObject{models.TransferObjectZone, zoneID})
+	}
+	if linkID != "" {
+		objects = append(objects, transferObject{models.TransferObjectShareLink, linkID})
+	}
+	return objects
+}
+
+// meterTransfer counts bytes uploaded or downloaded against every object of a transfer
+func meterTransfer(metric string, n int64, objects []transferObject) {
+	if n <= 0 {
+		return
+	}
+	day := time.Now().Format(statsDayFormat)
+
+	transferMu.Lock()
+	defer transferMu.Unlock()
+	for _, object := range objects {
+		pendingTransfers[transferKey{day, metric, object}] += n
+	}
+}
+
+// flushTransfers adds the pending transfer counts to the daily statistics. Counts that cannot
+// be stored are kept for the next flush.
+func flushTransfers(store storage.DataStore) error {
+	transferMu.Lock()
+	pending := pendingTransfers
+	pendingTransfers = make(map[transferKey]int64)
+	transferMu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	stats := make([]*models.DailyStat, 0, len(pending))
+	for key, n := range pending {
+		stats = append(stats, &models.DailyStat{
+			Day:        key.day,
+			Metric:     key.metric,
+			ObjectType: key.object.Type,
+			ObjectID:   key.object.ID,
+			Value:      n,
+			Merge:      models.DailyStatAdd,
+		})
+	}
+	if err := store.RecordDailyStats(stats); err != nil {
+		transferMu.Lock()
+		for key, n := range pending {
+			pendingTransfers[key] += n
+		}
+		transferMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// linkTransferObjects returns the objects a transfer through a share link is accounted to: the
+// link, its owner and the zone it points into
+func (h *PublicHandler) linkTransferObjects(link *models.ShareLink) []transferObject {
+	zoneID := ""
+	if zone, _ := zoneForPath(h.store, filepath.Join(h.dataDir, filepath.Clean("/"+link.TargetPath))); zone != nil {
+		zoneID = zone.ID
+	}
+	return transferObjects(link.OwnerID, zoneID, link.ID)
+}
+
+// monthStart returns the first moment of the month of a time
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// monthTransfer returns the bytes an object uploaded and downloaded in the month starting at
+// start, including transfers not yet flushed
+func monthTransfer(store storage.DataStore, object transferObject, start time.Time) (uploaded, downloaded int64) {
+	since := start.Format(statsDayFormat)
+	until := start.AddDate(0, 1, -1).Format(statsDayFormat)
+	filter := models.DailyStatFilter{ObjectType: object.Type, ObjectID: object.ID, Since: since, Until: until}
+	for _, stat := range store.ListDailyStats(filter) {
+		switch stat.Metric {
+		case models.StatBytesUploaded:
+			uploaded += stat.Value
+		case models.StatBytesDownloaded:
+			downloaded += stat.Value
+		}
+	}
+
+	transferMu.Lock()
+	defer transferMu.Unlock()
+	for key, n := range pendingTransfers {
+		if key.object != object || key.day < since || key.day > until {
+			continue
+		}
+		switch key.metric {
+		case models.StatBytesUploaded:
+			uploaded += n
+		case models.StatBytesDownloaded:
+			downloaded += n
+		}
+	}
+	return uploaded, downloaded
+}
+
+// transferCapError is returned when an object used up its monthly transfer cap
+type transferCapError struct {
+	cap *models.TransferCap
+}
+
+func (e *transferCapError) Error() string {
+	return fmt.Sprintf("Monthly transfer cap of %s reached for this %s",
+		formatBytes(uint64(e.cap.MonthlyBytes)), strings.ReplaceAll(e.cap.ObjectType, "_", " "))
+}
+
+// checkTransferCaps refuses a transfer when any of its objects has used up its monthly cap.
+// The transfer itself is not limited, so the last one of a month may go over.
+func checkTransferCaps(store storage.DataStore, objects []transferObject) error {
+	start := monthStart(time.Now())
+	for _, object := range objects {
+		c, err := store.GetTransferCap(object.Type, object.ID)
+		if err != nil || c.MonthlyBytes <= 0 {
+			continue
+		}
+		uploaded, downloaded := monthTransfer(store, object, start)
+		if uploaded+downloaded >= c.MonthlyBytes {
+			return &transferCapError{cap: c}
+		}
+	}
+	return nil
+}
+
+// writeTransferCapError responds to a transfer refused by a cap, telling clients to retry when
+// the next month starts
+func writeTransferCapError(w http.ResponseWriter, err error) {
+	next := monthStart(time.Now()).AddDate(0, 1, 0)
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(next).Seconds())+1))
+	apierror.Write(w, http.StatusTooManyRequests, apierror.CodeTransferCapReached, err.Error(), nil)
+}
+
+// meteredBody counts the bytes read from a request body
+type meteredBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// meterUpload counts the request body of an upload as it is read. The returned function
+// accounts what was read to the objects; call it once the body has been consumed.
+func meterUpload(r *http.Request, objects []transferObject) func() {
+	body := &meteredBody{ReadCloser: r.Body}
+	r.Body = body
+	return func() {
+		meterTransfer(models.StatBytesUploaded, body.n, objects)
+	}
+}
+
+// meteredWriter counts the bytes written to a response
+type meteredWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (mw *meteredWriter) Write(b []byte) (int, error) {
+	n, err := mw.ResponseWriter.Write(b)
+	mw.n += int64(n)
+	return n, err
+}
+
+// Flush lets streamed downloads flush through the meter
+func (mw *meteredWriter) Flush() {
+	if f, ok := mw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (mw *meteredWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// meterDownload wraps a response writer to count the bytes sent. The returned function
+// accounts what was sent to the objects; call it once the response has been written.
+func meterDownload(w http.ResponseWriter, objects []transferObject) (http.ResponseWriter, func()) {
+	mw := &meteredWriter{ResponseWriter: w}
+	return mw, func() {
+		meterTransfer(models.StatBytesDownloaded, mw.n, objects)
+	}
+}
+
+// transferObjectName returns the display name of a user, zone or share link, and false when it
+// does not exist
+func transferObjectName(store storage.DataStore, object transferObject) (string, bool) {
+	switch object.Type {
+	case models.TransferObjectUser:
+		if user, err := store.GetUserByID(object.ID); err == nil {
+			return user.Username, true
+		}
+	case models.TransferObjectZone:
+		if zone, err := store.GetShareZone(object.ID); err == nil {
+			return zone.Name, true
+		}
+	case models.TransferObjectShareLink:
+		if link, err := store.GetShareLink(object.ID); err == nil {
+			return link.Name, true
+		}
+	}
+	return "", false
+}
+
+// validTransferObjectType reports whether transfers are accounted to objects of a type
+func validTransferObjectType(objectType string) bool {
+	switch objectType {
+	case models.TransferObjectUser, models.TransferObjectZone, models.TransferObjectShareLink:
+		return true
+	}
+	return false
+}
+
+// transferUsage returns what an object transferred in a month along with its cap
+func transferUsage(store storage.DataStore, object transferObject, start time.Time) *models.TransferUsage {
+	usage := &models.TransferUsage{
+		ObjectType: object.Type,
+		ObjectID:   object.ID,
+		Month:      start.Format(transferMonthFormat),
+	}
+	usage.Name, _ = transferObjectName(store, object)
+	usage.BytesUploaded, usage.BytesDownloaded = monthTransfer(store, object, start)
+	if c, err := store.GetTransferCap(object.Type, object.ID); err == nil {
+		usage.CapBytes = c.MonthlyBytes
+	}
+	return usage
+}
+
+// parseTransferMonth parses a month given as YYYY-MM, defaulting to the current month
+func parseTransferMonth(value string) (time.Time, error) {
+	if value == "" {
+		return monthStart(time.Now()), nil
+	}
+	month, err := time.ParseInLocation(transferMonthFormat, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q: use YYYY-MM", value)
+	}
+	return month, nil
+}
+
+// GetTransferReport returns what every user, zone and share link transferred in a month (default
+// the current one), busiest first, optionally limited to one object type (admin only)
+func GetTransferReport(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start, err := parseTransferMonth(r.URL.Query().Get("month"))
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		objectType := r.URL.Query().Get("object_type")
+		if objectType != "" && !validTransferObjectType(objectType) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Object type must be user, zone or share_link", nil)
+			return
+		}
+
+		// Objects that transferred something, plus capped ones that did not
+		objects := make(map[transferObject]bool)
+		filter := models.DailyStatFilter{
+			ObjectType: objectType,
+			Since:      start.Format(statsDayFormat),
+			Until:      start.AddDate(0, 1, -1).Format(statsDayFormat),
+		}
+		for _, metric := range []string{models.StatBytesUploaded, models.StatBytesDownloaded} {
+			filter.Metric = metric
+			for _, stat := range store.ListDailyStats(filter) {
+				objects[transferObject{stat.ObjectType, stat.ObjectID}] = true
+			}
+		}
+		transferMu.Lock()
+		for key := range pendingTransfers {
+			if objectType == "" || key.object.Type == objectType {
+				objects[key.object] = true
+			}
+		}
+		transferMu.Unlock()
+		for _, c := range store.ListTransferCaps() {
+			if objectType == "" || c.ObjectType == objectType {
+				objects[transferObject{c.ObjectType, c.ObjectID}] = true
+			}
+		}
+
+		report := []*models.TransferUsage{}
+		for object := range objects {
+			usage := transferUsage(store, object, start)
+			if usage.BytesUploaded+usage.BytesDownloaded > 0 || usage.CapBytes > 0 {
+				report = append(report, usage)
+			}
+		}
+		sort.Slice(report, func(i, j int) bool {
+			a := report[i].BytesUploaded + report[i].BytesDownloaded
+			b := report[j].BytesUploaded + report[j].BytesDownloaded
+			if a != b {
+				return a > b
+			}
+			return report[i].ObjectType+report[i].ObjectID < report[j].ObjectType+report[j].ObjectID
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"month": start.Format(transferMonthFormat),
+			"usage": report,
+		})
+	}
+}
+
+// GetMyTransfer returns what the current user transferred this month and their cap
+func GetMyTransfer(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCtx := middleware.GetUserContext(r)
+		if userCtx == nil {
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+			return
+		}
+
+		usage := transferUsage(store, transferObject{models.TransferObjectUser, userCtx.UserID}, monthStart(time.Now()))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(usage)
+	}
+}
+
+// ListTransferCaps returns all monthly transfer caps (admin only)
+func ListTransferCaps(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(store.ListTransferCaps())
+	}
+}
+
+// SetTransferCap sets the monthly transfer cap of a user, zone or share link (admin only)
+func SetTransferCap(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		objectType := chi.URLParam(r, "type")
+		objectID := chi.URLParam(r, "id")
+		if !validTransferObjectType(objectType) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Object type must be user, zone or share_link", nil)
+			return
+		}
+		if _, ok := transferObjectName(store, transferObject{objectType, objectID}); !ok {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeObjectNotFound, "Object not found", nil)
+			return
+		}
+
+		var req struct {
+			MonthlyBytes int64 `json:"monthly_bytes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+		if req.MonthlyBytes <= 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Monthly bytes must be positive", nil)
+			return
+		}
+
+		c := &models.TransferCap{ObjectType: objectType, ObjectID: objectID, MonthlyBytes: req.MonthlyBytes}
+		if err := store.SetTransferCap(c); err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Transfer cap of %s %s set to %d bytes a month", objectType, objectID, req.MonthlyBytes)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+	}
+}
+
+// DeleteTransferCap removes the monthly transfer cap of a user, zone or share link (admin only)
+func DeleteTransferCap(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		objectType := chi.URLParam(r, "type")
+		objectID := chi.URLParam(r, "id")
+		if _, err := store.GetTransferCap(objectType, objectID); err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeTransferCapNotFound, "Transfer cap not found", nil)
+			return
+		}
+		if err := store.DeleteTransferCap(objectType, objectID); err != nil {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/fileops"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// zoneTrashDir returns the trash directory for a zone
+func zoneTrashDir(pool *models.StoragePool, zone *models.ShareZone) string {
+	return filepath.Join(pool.Path, zone.Path, models.TrashDirName)
+}
+
+// reservedZoneDirs are hidden directories at each zone root managed by the server
+var reservedZoneDirs = []string{models.TrashDirName, models.VersionsDirName}
+
+// isReservedZoneDir reports whether name is one of the server-managed zone root directories
+func isReservedZoneDir(name string) bool {
+	for _, dir := range reservedZoneDirs {
+		if name == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// isReservedZonePath reports whether fullPath points into a server-managed directory of the zone rooted at zoneRoot
+func isReservedZonePath(zoneRoot, fullPath string) bool {
+	for _, name := range reservedZoneDirs {
+		dir := filepath.Join(zoneRoot, name)
+		if fullPath == dir || strings.HasPrefix(fullPath, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hideReservedDirs removes the server-managed directories from a zone root listing
+func hideReservedDirs(files []fileops.FileInfo) []fileops.FileInfo {
+	filtered := make([]fileops.FileInfo, 0, len(files))
+	for _, f := range files {
+		if f.IsDir && isReservedZoneDir(f.Name) {
+			continue
+		}
+		filtered = append(filtered, f)
+	}
+	return filtered
+}
+
+// moveToTrash moves a file or folder into the zone trash and records it
+func moveToTrash(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool, fullPath string, userCtx *middleware.UserContext) (*models.TrashItem, error) {
+	zoneRoot := filepath.Join(pool.Path, zone.Path)
+	rel, err := filepath.Rel(zoneRoot, fullPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("cannot delete the zone root")
+	}
+
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	size := info.Size()
+	if info.IsDir() {
+		size = 0
+		filepath.Walk(fullPath, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() {
+				size += fi.Size()
+			}
+			return nil
+		})
+	}
+
+	trashDir := zoneTrashDir(pool, zone)
+	if err := os.MkdirAll(trashDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create trash directory: %w", err)
+	}
+
+	item, err := store.CreateTrashItem(&models.TrashItem{
+		ZoneID:        zone.ID,
+		OriginalPath:  "/" + filepath.ToSlash(rel),
+		Name:          info.Name(),
+		IsDir:         info.IsDir(),
+		Size:          size,
+		DeletedBy:     userCtx.UserID,
+		DeletedByName: userCtx.Username,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(fullPath, filepath.Join(trashDir, item.ID)); err != nil {
+		store.DeleteTrashItem(item.ID)
+		return nil, err
+	}
+
+	chargeZoneUsage(store, zone, pool, fullPath, userCtx.Username, -size)
+	return item, nil
+}
+
+// purgeTrashItem permanently deletes a trashed item from disk and the database
+func purgeTrashItem(store storage.DataStore, item *models.TrashItem) error {
+	if zone, err := store.GetShareZone(item.ZoneID); err == nil {
+		if pool, err := store.GetStoragePool(zone.PoolID); err == nil {
+			if err := os.RemoveAll(filepath.Join(zoneTrashDir(pool, zone), item.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	return store.DeleteTrashItem(item.ID)
+}
+
+// trashItemVisible reports whether a user may see a trashed item, and returns the path to show them
+func trashItemVisible(zone *models.ShareZone, item *models.TrashItem, user *models.User) (string, bool) {
+	if zone.ZoneType != models.ZoneTypePersonal {
+		return item.OriginalPath, true
+	}
+
+	// Personal zones: only items from the user's own folder
+	prefix := "/" + user.Username
+	if !strings.HasPrefix(item.OriginalPath, prefix+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(item.OriginalPath, prefix), true
+}
+
+// getZoneTrashItem loads a trash item and verifies it belongs to the zone and is visible to the user
+func (h *ZoneFileHandler) getZoneTrashItem(w http.ResponseWriter, r *http.Request) (*models.TrashItem, *models.ShareZone, *models.StoragePool, string, bool) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return nil, nil, nil, "", false
+	}
+
+	zoneID := chi.URLParam(r, "zoneId")
+	if isSharedFolderID(zoneID) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Trash is not available for shared folders", nil)
+		return nil, nil, nil, "", false
+	}
+	user := userFromContext(userCtx)
+
+	_, zone, pool, err := h.resolveZonePathWithPool(zoneID, "/", user)
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return nil, nil, nil, "", false
+	}
+
+	if zone.ReadOnly {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
+		return nil, nil, nil, "", false
+	}
+
+	item, err := h.store.GetTrashItem(chi.URLParam(r, "id"))
+	if err != nil || item.ZoneID != zone.ID {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeTrashItemNotFound, "Trash item not found", nil)
+		return nil, nil, nil, "", false
+	}
+
+	displayPath, ok := trashItemVisible(zone, item, user)
+	if !ok {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeTrashItemNotFound, "Trash item not found", nil)
+		return nil, nil, nil, "", false
+	}
+
+	return item, zone, pool, displayPath, true
+}
+
+// ListZoneTrash lists trashed items in a zone
+func (h *ZoneFileHandler) ListZoneTrash(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	zoneID := chi.URLParam(r, "zoneId")
+	if isSharedFolderID(zoneID) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Trash is not available for shared folders", nil)
+		return
+	}
+	user := userFromContext(userCtx)
+
+	_, zone, err := h.resolveZonePath(zoneID, "/", user)
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return
+	}
+
+	items := []*models.TrashItem{}
+	for _, item := range h.store.ListTrashItems(zone.ID) {
+		displayPath, ok := trashItemVisible(zone, item, user)
+		if !ok {
+			continue
+		}
+		visible := *item
+		visible.OriginalPath = displayPath
+		items = append(items, &visible)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":          items,
+		"retention_days": GetTrashRetentionDaysFromStore(h.store),
+	})
+}
+
+// RestoreZoneTrashItem moves a trashed item back to its original location
+func (h *ZoneFileHandler) RestoreZoneTrashItem(w http.ResponseWriter, r *http.Request) {
+	item, zone, pool, displayPath, ok := h.getZoneTrashItem(w, r)
+	if !ok {
+		return
+	}
+
+	zoneRoot := filepath.Join(pool.Path, zone.Path)
+	target := filepath.Join(zoneRoot, filepath.FromSlash(item.OriginalPath))
+
+	if _, err := os.Lstat(target); err == nil {
+		apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "An item already exists at the original location", nil)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		apierror.Error(w, "Failed to recreate parent folder: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := os.Rename(filepath.Join(zoneTrashDir(pool, zone), item.ID), target); err != nil {
+		apierror.Error(w, "Failed to restore item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.store.DeleteTrashItem(item.ID)
+	indexPath(h.store, target)
+	chargeZoneUsage(h.store, zone, pool, target, item.DeletedByName, item.Size)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Item restored successfully",
+		"path":    displayPath,
+	})
+}
+
+// PurgeZoneTrashItem permanently deletes a single trashed item
+func (h *ZoneFileHandler) PurgeZoneTrashItem(w http.ResponseWriter, r *http.Request) {
+	item, _, _, _, ok := h.getZoneTrashItem(w, r)
+	if !ok {
+		return
+	}
+
+	if err := purgeTrashItem(h.store, item); err != nil {
+		apierror.Error(w, "Failed to purge item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// EmptyZoneTrash permanently deletes every trashed item the user can see in a zone
+func (h *ZoneFileHandler) EmptyZoneTrash(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	zoneID := chi.URLParam(r, "zoneId")
+	if isSharedFolderID(zoneID) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Trash is not available for shared folders", nil)
+		return
+	}
+	user := userFromContext(userCtx)
+
+	_, zone, err := h.resolveZonePath(zoneID, "/", user)
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return
+	}
+
+	if zone.ReadOnly {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
+		return
+	}
+
+	purged := 0
+	var failed []BulkErrorDetail
+	for _, item := range h.store.ListTrashItems(zone.ID) {
+		displayPath, ok := trashItemVisible(zone, item, user)
+		if !ok {
+			continue
+		}
+		if err := purgeTrashItem(h.store, item); err != nil {
+			failed = append(failed, BulkErrorDetail{Path: displayPath, Error: err.Error()})
+			continue
+		}
+		purged++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Purged %d items", purged),
+		"purged":  purged,
+		"failed":  failed,
+	})
+}
+
+// TrashCleaner purges trashed items older than the configured retention period, and deleted
+// pools, zones, shares and share links past their soft-delete window
+type TrashCleaner struct {
+	store    storage.DataStore
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+}
+
+// NewTrashCleaner creates a new trash cleaner
+func NewTrashCleaner(store storage.DataStore) *TrashCleaner {
+	return &TrashCleaner{
+		store:    store,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the trash cleaner background goroutine
+func (c *TrashCleaner) Start() {
+	c.mu.Lock()
+	if c.running {
+		c.mu.Unlock()
+		return
+	}
+	c.running = true
+	c.stopChan = make(chan struct{})
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go c.run()
+	log.Println("Trash cleaner started")
+}
+
+// Stop stops the trash cleaner
+func (c *TrashCleaner) Stop() {
+	c.mu.Lock()
+	if !c.running {
+		c.mu.Unlock()
+		return
+	}
+	c.running = false
+	close(c.stopChan)
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	log.Println("Trash cleaner stopped")
+}
+
+// run is the main cleaner loop
+func (c *TrashCleaner) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	// Initial cleanup
+	c.purgeExpired()
+	purgeDeletedObjects(c.store)
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			c.purgeExpired()
+			purgeDeletedObjects(c.store)
+		}
+	}
+}
+
+// purgeExpired removes items that have been in the trash longer than the retention period
+func (c *TrashCleaner) purgeExpired() {
+	days := GetTrashRetentionDaysFromStore(c.store)
+	if days <= 0 {
+		return // Keep trashed items forever
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	for _, item := range c.store.ListExpiredTrashItems(cutoff) {
+		if err := purgeTrashItem(c.store, item); err != nil {
+			log.Printf("Trash cleaner: failed to purge %s: %v", item.OriginalPath, err)
+		}
+	}
+}
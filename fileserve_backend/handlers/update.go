@@ -0,0 +1,593 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+const (
+	// updateManifestLimit and updateBinaryLimit cap the size of downloads from the release feed
+	updateManifestLimit = 1 << 20
+	updateBinaryLimit   = 512 << 20
+	// updateDownloadTimeout is how long downloading a release may take
+	updateDownloadTimeout = 10 * time.Minute
+	// updateRestartDelay lets the response reach the client before systemd stops the server
+	updateRestartDelay = time.Second
+)
+
+// Updater installs signed releases of the server binary from the release feed and rolls back
+// to the binary it replaced
+type Updater struct {
+	store     storage.DataStore
+	cfg       *config.Config
+	version   string
+	buildDate string
+
+	mu         sync.Mutex
+	inProgress bool
+	latest     *models.UpdateRelease
+	lastCheck  *time.Time
+	lastError  string
+}
+
+// NewUpdater creates an updater for the running version
+func NewUpdater(store storage.DataStore, cfg *config.Config, version, buildDate string) *Updater {
+	return &Updater{store: store, cfg: cfg, version: version, buildDate: buildDate}
+}
+
+// updatePlatform is the manifest key of the binaries for this system
+func updatePlatform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// updateSignedMessage is what the release signature covers. Naming the channel, version and
+// platform keeps a signed binary from being offered as another release or on another channel.
+func updateSignedMessage(channel, version, platform, sum string) []byte {
+	return []byte(fmt.Sprintf("fileserv %s %s %s %s", channel, version, platform, strings.ToLower(sum)))
+}
+
+// parseReleaseVersion splits a version such as 1.4.2, v1.5.0-beta.2 or 20260301 into its
+// numbers and pre-release label
+func parseReleaseVersion(version string) ([]int, string, bool) {
+	version, _, _ = strings.Cut(strings.TrimPrefix(version, "v"), "+")
+	version, pre, _ := strings.Cut(version, "-")
+	var numbers []int
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, "", false
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, pre, true
+}
+
+// comparePreRelease orders pre-release labels as semantic versioning does: field by field,
+// numbers below words, and a label with more fields after one it starts with
+func comparePreRelease(a, b string) int {
+	af, bf := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(af) && i < len(bf); i++ {
+		an, aErr := strconv.Atoi(af[i])
+		bn, bErr := strconv.Atoi(bf[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return an - bn
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(af[i], bf[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(af) - len(bf)
+}
+
+// newerVersion reports whether release is a later version than current. A build without a
+// release version, such as dev, is older than every release.
+func newerVersion(release, current string) bool {
+	r, rPre, ok := parseReleaseVersion(release)
+	if !ok {
+		return false
+	}
+	c, cPre, ok := parseReleaseVersion(current)
+	if !ok {
+		return true
+	}
+	for i := 0; i < max(len(r), len(c)); i++ {
+		var rn, cn int
+		if i < len(r) {
+			rn = r[i]
+		}
+		if i < len(c) {
+			cn = c[i]
+		}
+		if rn != cn {
+			return rn > cn
+		}
+	}
+	// A release comes after its pre-releases
+	switch {
+	case rPre == cPre:
+		return false
+	case rPre == "":
+		return true
+	case cPre == "":
+		return false
+	}
+	return comparePreRelease(rPre, cPre) > 0
+}
+
+// GetUpdateChannelFromStore returns the release channel, stable unless beta was chosen
+func GetUpdateChannelFromStore(store storage.DataStore) string {
+	if setting, err := store.GetSetting(models.SettingUpdateChannel); err == nil && setting != nil && setting.Value == models.UpdateChannelBeta {
+		return models.UpdateChannelBeta
+	}
+	return models.UpdateChannelStable
+}
+
+// status describes the running version and the last check of the channel
+func (u *Updater) status() models.UpdateStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	status := models.UpdateStatus{
+		CurrentVersion: u.version,
+		BuildDate:      u.buildDate,
+		Platform:       updatePlatform(),
+		Channel:        GetUpdateChannelFromStore(u.store),
+		Configured:     u.cfg.UpdatesEnabled(),
+		Latest:         u.latest,
+		LastCheck:      u.lastCheck,
+		LastError:      u.lastError,
+		InProgress:     u.inProgress,
+	}
+	if u.latest != nil {
+		_, hasBinary := u.latest.Binaries[status.Platform]
+		status.Available = hasBinary && newerVersion(u.latest.Version, u.version)
+	}
+	if exe, err := executablePath(); err == nil {
+		if _, err := os.Stat(exe + ".previous"); err == nil {
+			if setting, err := u.store.GetSetting(models.SettingUpdatePreviousVersion); err == nil && setting != nil {
+				status.PreviousVersion = setting.Value
+			} else {
+				status.PreviousVersion = "unknown"
+			}
+		}
+	}
+	return status
+}
+
+// manifestURL returns the address of the manifest of a channel
+func (u *Updater) manifestURL(channel string) string {
+	return u.cfg.UpdateURL + "/" + channel + ".json"
+}
+
+// fetchManifest downloads the release manifest of the channel
+func (u *Updater) fetchManifest(ctx context.Context, channel string) (*models.UpdateRelease, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.manifestURL(channel), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the %s manifest: %w", channel, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the %s manifest: %s", channel, resp.Status)
+	}
+
+	var release models.UpdateRelease
+	if err := json.NewDecoder(io.LimitReader(resp.Body, updateManifestLimit)).Decode(&release); err != nil {
+		return nil, fmt.Errorf("invalid %s manifest: %w", channel, err)
+	}
+	if _, _, ok := parseReleaseVersion(release.Version); !ok {
+		return nil, fmt.Errorf("invalid %s manifest: bad version %q", channel, release.Version)
+	}
+	return &release, nil
+}
+
+// check fetches the manifest of the channel and records the outcome
+func (u *Updater) check(ctx context.Context) (*models.UpdateRelease, error) {
+	channel := GetUpdateChannelFromStore(u.store)
+	release, err := u.fetchManifest(ctx, channel)
+
+	now := time.Now()
+	u.mu.Lock()
+	u.lastCheck = &now
+	if err != nil {
+		u.lastError = err.Error()
+	} else {
+		u.latest = release
+		u.lastError = ""
+	}
+	u.mu.Unlock()
+	return release, err
+}
+
+// download fetches the binary of a release next to the running one, so it can be renamed into
+// place, and verifies its checksum and signature. The caller removes the file.
+func (u *Updater) download(ctx context.Context, release *models.UpdateRelease, dir string) (string, error) {
+	platform := updatePlatform()
+	binary, ok := release.Binaries[platform]
+	if !ok {
+		return "", fmt.Errorf("release %s has no binary for %s", release.Version, platform)
+	}
+	signature, err := base64.StdEncoding.DecodeString(binary.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return "", fmt.Errorf("release %s has an invalid signature", release.Version)
+	}
+
+	channel := GetUpdateChannelFromStore(u.store)
+	base, _ := url.Parse(u.manifestURL(channel))
+	ref, err := url.Parse(binary.URL)
+	if err != nil || binary.URL == "" {
+		return "", fmt.Errorf("release %s has an invalid binary URL", release.Version)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base.ResolveReference(ref).String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download release %s: %w", release.Version, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download release %s: %s", release.Version, resp.Status)
+	}
+
+	f, err := os.CreateTemp(dir, ".fileserv-update-*")
+	if err != nil {
+		return "", fmt.Errorf("cannot write next to the binary: %w", err)
+	}
+	path := f.Name()
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(resp.Body, updateBinaryLimit+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > updateBinaryLimit {
+		err = fmt.Errorf("release %s is larger than %d MB", release.Version, updateBinaryLimit>>20)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to download release %s: %w", release.Version, err)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(sum, binary.SHA256) {
+		os.Remove(path)
+		return "", fmt.Errorf("checksum mismatch for release %s", release.Version)
+	}
+	if !ed25519.Verify(u.cfg.UpdatePublicKey, updateSignedMessage(channel, release.Version, platform, sum), signature) {
+		os.Remove(path)
+		return "", fmt.Errorf("signature verification failed for release %s", release.Version)
+	}
+
+	if err := os.Chmod(path, 0755); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// checkBinaryVersion runs a binary with --version and checks that it reports the expected version
+func checkBinaryVersion(path, version string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("the new binary does not run: %w", err)
+	}
+	for _, field := range strings.Fields(string(output)) {
+		if field == version {
+			return nil
+		}
+	}
+	return fmt.Errorf("the new binary reports version %q instead of %s", strings.TrimSpace(string(output)), version)
+}
+
+// executablePath returns the path of the running binary, with symlinks resolved so the binary
+// itself is replaced
+func executablePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// swapBinary renames replacement over the binary at exe. The binary it replaces is kept as
+// exe.previous. Both steps are renames, so exe always holds a complete binary.
+func swapBinary(exe, replacement string) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	os.Chmod(replacement, info.Mode().Perm())
+
+	kept := exe + ".previous.tmp"
+	os.Remove(kept)
+	if err := os.Link(exe, kept); err != nil {
+		return fmt.Errorf("cannot keep the current binary: %w", err)
+	}
+	if err := os.Rename(replacement, exe); err != nil {
+		os.Remove(kept)
+		return fmt.Errorf("cannot replace the binary: %w", err)
+	}
+	if err := os.Rename(kept, exe+".previous"); err != nil {
+		return fmt.Errorf("cannot keep the current binary: %w", err)
+	}
+	return nil
+}
+
+// systemdUnit returns the systemd service the server runs in, or "" when it was not started by
+// systemd
+func systemdUnit() string {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		// hierarchy-ID:controllers:path, such as 0::/system.slice/fileserv.service
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) == 3 {
+			if unit := filepath.Base(parts[2]); strings.HasSuffix(unit, ".service") {
+				return unit
+			}
+		}
+	}
+	return ""
+}
+
+// restartService asks systemd to restart the server once the response was sent. It returns a message
+// for the admin.
+func restartService() string {
+	unit := systemdUnit()
+	if unit == "" {
+		return "Not running under systemd: restart the server to run the new binary"
+	}
+	go func() {
+		time.Sleep(updateRestartDelay)
+		if output, err := exec.Command("systemctl", "--no-block", "restart", unit).CombinedOutput(); err != nil {
+			log.Printf("Update: failed to restart %s: %v: %s", unit, err, strings.TrimSpace(string(output)))
+		}
+	}()
+	return "Restarting " + unit
+}
+
+// begin marks an update or rollback as running, and returns false when one already is
+func (u *Updater) begin() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.inProgress {
+		return false
+	}
+	u.inProgress = true
+	return true
+}
+
+// end clears the running update, recording its error
+func (u *Updater) end(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.inProgress = false
+	if err != nil {
+		u.lastError = err.Error()
+	}
+}
+
+// publishUpdate records a version change in the activity log
+func publishUpdate(r *http.Request, action, from, to string) {
+	publishAction(r, &events.Event{
+		Type:      events.TypeSystemUpdated,
+		AdminOnly: true,
+		Data:      map[string]interface{}{"action": action, "from": from, "to": to},
+	})
+}
+
+// GetUpdateStatus returns the running version, the channel and the release last seen on it
+// (admin only)
+func (u *Updater) GetUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u.status())
+}
+
+// UpdateUpdateSettings changes the release channel (admin only)
+func (u *Updater) UpdateUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	if req.Channel != models.UpdateChannelStable && req.Channel != models.UpdateChannelBeta {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid channel: must be stable or beta", nil)
+		return
+	}
+
+	if req.Channel != GetUpdateChannelFromStore(u.store) {
+		u.store.SetSetting(models.SettingUpdateChannel, req.Channel, "string", string(models.CategoryGeneral))
+		publishSettingsChanged(r, []string{models.SettingUpdateChannel})
+		// The release seen on the old channel no longer applies
+		u.mu.Lock()
+		u.latest, u.lastCheck, u.lastError = nil, nil, ""
+		u.mu.Unlock()
+	}
+
+	u.GetUpdateStatus(w, r)
+}
+
+// CheckForUpdate fetches the manifest of the channel (admin only)
+func (u *Updater) CheckForUpdate(w http.ResponseWriter, r *http.Request) {
+	if !u.cfg.UpdatesEnabled() {
+		apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Updates are not configured: set UPDATE_URL and UPDATE_PUBLIC_KEY", nil)
+		return
+	}
+	if _, err := u.check(r.Context()); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	u.GetUpdateStatus(w, r)
+}
+
+// ApplyUpdate downloads the release of the channel, verifies its signature, swaps it in for the
+// running binary and restarts the server (admin only)
+func (u *Updater) ApplyUpdate(w http.ResponseWriter, r *http.Request) {
+	if !u.cfg.UpdatesEnabled() {
+		apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Updates are not configured: set UPDATE_URL and UPDATE_PUBLIC_KEY", nil)
+		return
+	}
+	if !u.begin() {
+		apierror.Write(w, http.StatusConflict, apierror.CodeBusy, "An update is already in progress", nil)
+		return
+	}
+	release, message, err := u.apply(r)
+	u.end(err)
+	if err != nil {
+		var conflict *updateConflict
+		if errors.As(err, &conflict) {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, err.Error(), nil)
+		} else {
+			apierror.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+
+	log.Printf("Update: installed %s, replacing %s", release.Version, u.version)
+	publishUpdate(r, "update", u.version, release.Version)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"version": release.Version,
+		"message": message,
+	})
+}
+
+// updateConflict is an update refused because of the state of the server rather than a failure
+type updateConflict struct{ msg string }
+
+func (e *updateConflict) Error() string { return e.msg }
+
+// apply installs the release of the channel and schedules the restart
+func (u *Updater) apply(r *http.Request) (*models.UpdateRelease, string, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), updateDownloadTimeout)
+	defer cancel()
+
+	// The manifest is fetched again so the release installed is the one published now
+	release, err := u.check(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if release.Version == u.version {
+		return nil, "", &updateConflict{"Already running version " + release.Version}
+	}
+	if !newerVersion(release.Version, u.version) {
+		return nil, "", &updateConflict{fmt.Sprintf("Release %s is not newer than the running version %s", release.Version, u.version)}
+	}
+
+	exe, err := executablePath()
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot find the running binary: %w", err)
+	}
+	path, err := u.download(ctx, release, filepath.Dir(exe))
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.Remove(path)
+
+	if err := checkBinaryVersion(path, release.Version); err != nil {
+		return nil, "", err
+	}
+	if err := swapBinary(exe, path); err != nil {
+		return nil, "", err
+	}
+	u.store.SetSetting(models.SettingUpdatePreviousVersion, u.version, "string", string(models.CategoryGeneral))
+	return release, restartService(), nil
+}
+
+// RollbackUpdate swaps the binary the last update replaced back in and restarts the server
+// (admin only)
+func (u *Updater) RollbackUpdate(w http.ResponseWriter, r *http.Request) {
+	if !u.begin() {
+		apierror.Write(w, http.StatusConflict, apierror.CodeBusy, "An update is already in progress", nil)
+		return
+	}
+	previous := u.status().PreviousVersion
+	message, err := u.rollback()
+	u.end(err)
+	if err != nil {
+		if os.IsNotExist(err) {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "No previous version to roll back to", nil)
+		} else {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("Update: rolled back from %s to %s", u.version, previous)
+	publishUpdate(r, "rollback", u.version, previous)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"version": previous,
+		"message": message,
+	})
+}
+
+// rollback swaps the previous binary in; the running one becomes the previous, so the rollback
+// can be undone the same way
+func (u *Updater) rollback() (string, error) {
+	exe, err := executablePath()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the running binary: %w", err)
+	}
+	if _, err := os.Stat(exe + ".previous"); err != nil {
+		return "", err
+	}
+
+	replacement := exe + ".rollback"
+	os.Remove(replacement)
+	if err := os.Link(exe+".previous", replacement); err != nil {
+		return "", fmt.Errorf("cannot restore the previous binary: %w", err)
+	}
+	if err := swapBinary(exe, replacement); err != nil {
+		os.Remove(replacement)
+		return "", err
+	}
+	u.store.SetSetting(models.SettingUpdatePreviousVersion, u.version, "string", string(models.CategoryGeneral))
+	return restartService(), nil
+}
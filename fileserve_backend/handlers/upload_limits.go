@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// uploadFormOverhead is allowed on top of the file size for multipart boundaries and form fields
+const uploadFormOverhead = 1 << 20
+
+// multipartMemory is the part of a multipart upload kept in memory, the rest is spooled to disk
+const multipartMemory = 32 << 20
+
+// GetUploadLimitsFromStore returns the global upload limits
+func GetUploadLimitsFromStore(store storage.DataStore) models.UploadLimits {
+	limits := models.UploadLimits{
+		MaxUploadSize: models.DefaultMaxUploadSize,
+		MaxChunkSize:  models.DefaultMaxChunkSize,
+	}
+	if setting, err := store.GetSetting(models.SettingMaxUploadSize); err == nil && setting != nil {
+		if n, err := strconv.ParseInt(setting.Value, 10, 64); err == nil && n >= 0 {
+			limits.MaxUploadSize = n
+		}
+	}
+	if setting, err := store.GetSetting(models.SettingMaxChunkSize); err == nil && setting != nil {
+		if n, err := strconv.ParseInt(setting.Value, 10, 64); err == nil && n > 0 {
+			limits.MaxChunkSize = n
+		}
+	}
+	return limits
+}
+
+// uploadLimit returns the largest file that may be uploaded: the lowest of the global limit and
+// the limits of the zone and pool, which may be nil. 0 means unlimited.
+func uploadLimit(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool) int64 {
+	limit := GetUploadLimitsFromStore(store).MaxUploadSize
+	lower := func(n int64) {
+		if n > 0 && (limit == 0 || n < limit) {
+			limit = n
+		}
+	}
+	if zone != nil {
+		lower(zone.MaxUploadSize)
+	}
+	if pool != nil {
+		lower(pool.MaxFileSize)
+	}
+	return limit
+}
+
+// limitRequestBody stops reading the request body after limit bytes plus form overhead, so
+// oversized uploads fail instead of filling memory or disk
+func limitRequestBody(w http.ResponseWriter, r *http.Request, limit int64) {
+	if limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit+uploadFormOverhead)
+	}
+}
+
+// isBodyTooLarge reports whether err comes from reading past the limit of limitRequestBody
+func isBodyTooLarge(err error) bool {
+	var maxBytes *http.MaxBytesError
+	return errors.As(err, &maxBytes)
+}
+
+// writeUploadTooLarge responds with 413 and the limit that was exceeded
+func writeUploadTooLarge(w http.ResponseWriter, limit int64) {
+	apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodeUploadTooLarge,
+		fmt.Sprintf("Upload exceeds the maximum allowed size of %d bytes", limit),
+		map[string]int64{"max_size": limit})
+}
+
+// GetUploadLimits returns the global upload limits (admin only)
+func GetUploadLimits(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GetUploadLimitsFromStore(store))
+	}
+}
+
+// UpdateUploadLimits saves the global upload limits (admin only)
+func UpdateUploadLimits(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := GetUploadLimitsFromStore(store)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if req.MaxUploadSize < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "max_upload_size cannot be negative", nil)
+			return
+		}
+		if req.MaxChunkSize < 1<<20 || req.MaxChunkSize > 1<<30 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "max_chunk_size must be between 1 MB and 1 GB", nil)
+			return
+		}
+
+		category := string(models.CategoryGeneral)
+		store.SetSetting(models.SettingMaxUploadSize, strconv.FormatInt(req.MaxUploadSize, 10), "int", category)
+		store.SetSetting(models.SettingMaxChunkSize, strconv.FormatInt(req.MaxChunkSize, 10), "int", category)
+
+		GetUploadLimits(store)(w, r)
+	}
+}
@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/internal/notify"
+	"fileserv/internal/nut"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// upsShutdownDelay gives notifications of a shutdown time to be delivered before the system
+// powers off
+const upsShutdownDelay = 5 * time.Second
+
+// upsSettingKeys are the settings saved by UpdateUPS
+var upsSettingKeys = []string{
+	models.SettingUPSEnabled,
+	models.SettingUPSHost,
+	models.SettingUPSPort,
+	models.SettingUPSName,
+	models.SettingUPSPollSeconds,
+	models.SettingUPSStopUploadsCharge,
+	models.SettingUPSShutdownCharge,
+	models.SettingUPSShutdownRuntime,
+	models.SettingUPSShutdownOnLowBattery,
+}
+
+// uploadsStoppedOnBattery is set while the UPS battery is below the upload threshold
+var uploadsStoppedOnBattery atomic.Bool
+
+// rejectUploadOnBattery responds with 503 and returns true while uploads are stopped on
+// battery power, so clients retry once utility power is back
+func rejectUploadOnBattery(w http.ResponseWriter) bool {
+	if !uploadsStoppedOnBattery.Load() {
+		return false
+	}
+	w.Header().Set("Retry-After", "300")
+	apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeOnBattery, "Uploads are paused while the server runs on battery power", nil)
+	return true
+}
+
+// GetUPSSettingsFromStore returns the UPS settings, with defaults for settings never saved
+func GetUPSSettingsFromStore(store storage.DataStore) models.UPSSettings {
+	settings := models.DefaultUPSSettings()
+	boolSetting := func(key string, value *bool) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil {
+			*value = setting.Value == "true"
+		}
+	}
+	intSetting := func(key string, value *int) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil {
+			if n, err := strconv.Atoi(setting.Value); err == nil && n >= 0 {
+				*value = n
+			}
+		}
+	}
+	stringSetting := func(key string, value *string) {
+		if setting, err := store.GetSetting(key); err == nil && setting != nil && setting.Value != "" {
+			*value = setting.Value
+		}
+	}
+	boolSetting(models.SettingUPSEnabled, &settings.Enabled)
+	stringSetting(models.SettingUPSHost, &settings.Host)
+	intSetting(models.SettingUPSPort, &settings.Port)
+	stringSetting(models.SettingUPSName, &settings.Name)
+	intSetting(models.SettingUPSPollSeconds, &settings.PollSeconds)
+	intSetting(models.SettingUPSStopUploadsCharge, &settings.StopUploadsCharge)
+	intSetting(models.SettingUPSShutdownCharge, &settings.ShutdownCharge)
+	intSetting(models.SettingUPSShutdownRuntime, &settings.ShutdownRuntime)
+	boolSetting(models.SettingUPSShutdownOnLowBattery, &settings.ShutdownOnLowBattery)
+	if settings.PollSeconds < 1 {
+		settings.PollSeconds = models.DefaultUPSSettings().PollSeconds
+	}
+	return settings
+}
+
+// upsAddress returns the host:port of the upsd server
+func upsAddress(settings models.UPSSettings) string {
+	return net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port))
+}
+
+// UPSMonitor polls a UPS through NUT, publishes power events and stops uploads or powers off the
+// system when the battery runs low
+type UPSMonitor struct {
+	store    storage.DataStore
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	status   models.UPSStatus
+	reset    chan struct{}
+}
+
+// NewUPSMonitor creates a new UPS monitor
+func NewUPSMonitor(store storage.DataStore) *UPSMonitor {
+	return &UPSMonitor{
+		store:    store,
+		stopChan: make(chan struct{}),
+		reset:    make(chan struct{}, 1),
+	}
+}
+
+// Start begins the UPS monitor background goroutine
+func (m *UPSMonitor) Start() {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = true
+	m.stopChan = make(chan struct{})
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.run()
+	log.Println("UPS monitor started")
+}
+
+// Stop stops the UPS monitor
+func (m *UPSMonitor) Stop() {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = false
+	close(m.stopChan)
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	log.Println("UPS monitor stopped")
+}
+
+// run is the main monitor loop
+func (m *UPSMonitor) run() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.interval())
+	defer ticker.Stop()
+
+	m.check()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.check()
+		case <-m.reset:
+			ticker.Reset(m.interval())
+			m.check()
+		}
+	}
+}
+
+// Reload makes the monitor read the UPS at once with changed settings
+func (m *UPSMonitor) Reload() {
+	select {
+	case m.reset <- struct{}{}:
+	default:
+	}
+}
+
+// interval returns how often the UPS is read
+func (m *UPSMonitor) interval() time.Duration {
+	return time.Duration(GetUPSSettingsFromStore(m.store).PollSeconds) * time.Second
+}
+
+// Status returns the last reading of the UPS
+func (m *UPSMonitor) Status() models.UPSStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// check reads the UPS, publishes an event for every change of power state and takes the
+// actions whose thresholds were reached
+func (m *UPSMonitor) check() {
+	settings := GetUPSSettingsFromStore(m.store)
+	prev := m.Status()
+
+	if !settings.Enabled {
+		uploadsStoppedOnBattery.Store(false)
+		m.setStatus(models.UPSStatus{})
+		return
+	}
+
+	now := time.Now()
+	vars, err := nut.New(upsAddress(settings)).Vars(settings.Name)
+	if err != nil {
+		// The last reading stands: a UPS that stopped answering may still be on battery
+		status := prev
+		status.Enabled = true
+		status.Connected = false
+		status.Error = err.Error()
+		status.LastPoll = &now
+		if prev.Connected {
+			m.publish(settings, status, models.UPSEventCommLost, notify.LevelWarning,
+				fmt.Sprintf("Lost contact with UPS %s: %v", settings.Name, err))
+		}
+		m.setStatus(status)
+		return
+	}
+
+	status := parseUPSStatus(vars)
+	status.Enabled = true
+	status.Connected = true
+	status.LastPoll = &now
+	status.ShutdownStarted = prev.ShutdownStarted
+
+	if prev.Enabled && !prev.Connected && prev.Error != "" {
+		m.publish(settings, status, models.UPSEventCommRestored, notify.LevelInfo,
+			fmt.Sprintf("Contact with UPS %s restored", settings.Name))
+	}
+	if status.OnBattery && !prev.OnBattery {
+		m.publish(settings, status, models.UPSEventOnBattery, notify.LevelWarning,
+			fmt.Sprintf("UPS %s is on battery power", settings.Name))
+	} else if !status.OnBattery && prev.OnBattery {
+		m.publish(settings, status, models.UPSEventOnLine, notify.LevelInfo,
+			fmt.Sprintf("Utility power restored on UPS %s", settings.Name))
+	}
+	if status.LowBattery && !prev.LowBattery {
+		m.publish(settings, status, models.UPSEventLowBattery, notify.LevelCritical,
+			fmt.Sprintf("UPS %s reports a low battery", settings.Name))
+	}
+
+	// Uploads stay stopped once a shutdown started, so no upload is cut off half-written
+	status.UploadsStopped = status.ShutdownStarted || (status.OnBattery &&
+		(status.LowBattery || belowThreshold(status.BatteryCharge, settings.StopUploadsCharge)))
+	uploadsStoppedOnBattery.Store(status.UploadsStopped)
+	if status.UploadsStopped && !prev.UploadsStopped {
+		m.publish(settings, status, models.UPSEventUploadsStopped, notify.LevelWarning,
+			fmt.Sprintf("Uploads stopped: UPS %s battery at %s", settings.Name, formatUPSCharge(status.BatteryCharge)))
+	} else if !status.UploadsStopped && prev.UploadsStopped {
+		m.publish(settings, status, models.UPSEventUploadsResumed, notify.LevelInfo,
+			fmt.Sprintf("Uploads resumed: UPS %s battery at %s", settings.Name, formatUPSCharge(status.BatteryCharge)))
+	}
+
+	if reason := shutdownReason(settings, status); reason != "" && !status.ShutdownStarted {
+		status.ShutdownStarted = true
+		status.UploadsStopped = true
+		uploadsStoppedOnBattery.Store(true)
+		m.setStatus(status)
+		m.shutdown(settings, status, reason)
+		return
+	}
+	m.setStatus(status)
+}
+
+// setStatus records the last reading
+func (m *UPSMonitor) setStatus(status models.UPSStatus) {
+	m.mu.Lock()
+	m.status = status
+	m.mu.Unlock()
+}
+
+// shutdown powers off the system. systemd stops the server first, which finishes the requests
+// in progress, so the shutdown is clean.
+func (m *UPSMonitor) shutdown(settings models.UPSSettings, status models.UPSStatus, reason string) {
+	message := fmt.Sprintf("Shutting down: %s", reason)
+	log.Printf("UPS: %s", message)
+	m.publish(settings, status, models.UPSEventShutdown, notify.LevelCritical, message)
+	recordSecurityEvent(m.store, &models.SecurityEvent{
+		Type:    models.SecurityEventPowerControl,
+		Source:  "ups",
+		Actor:   "ups",
+		Target:  "poweroff",
+		Message: fmt.Sprintf("System poweroff requested by UPS %s: %s", settings.Name, reason),
+	})
+
+	select {
+	case <-time.After(upsShutdownDelay):
+	case <-m.stopChan:
+		return
+	}
+	if output, err := exec.Command("systemctl", "poweroff").CombinedOutput(); err != nil {
+		log.Printf("UPS: poweroff failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+}
+
+// publish sends a UPS power event to admins; the notifier routes it to notification channels
+func (m *UPSMonitor) publish(settings models.UPSSettings, status models.UPSStatus, event, level, message string) {
+	log.Printf("UPS: %s", message)
+	events.PublishToAdmins(events.TypeUPSPowerEvent, map[string]interface{}{
+		"event":           event,
+		"level":           level,
+		"message":         message,
+		"ups":             settings.Name,
+		"status":          status.Status,
+		"battery_charge":  status.BatteryCharge,
+		"battery_runtime": status.BatteryRuntime,
+	})
+}
+
+// shutdownReason returns why the system must power off, or "" while on line power or above the
+// shutdown thresholds
+func shutdownReason(settings models.UPSSettings, status models.UPSStatus) string {
+	if !status.OnBattery {
+		return ""
+	}
+	switch {
+	case settings.ShutdownOnLowBattery && status.LowBattery:
+		return fmt.Sprintf("UPS %s reports a low battery", settings.Name)
+	case belowThreshold(status.BatteryCharge, settings.ShutdownCharge):
+		return fmt.Sprintf("UPS %s battery at %s", settings.Name, formatUPSCharge(status.BatteryCharge))
+	case settings.ShutdownRuntime > 0 && status.BatteryRuntime != nil && *status.BatteryRuntime <= settings.ShutdownRuntime:
+		return fmt.Sprintf("UPS %s has %ds of runtime left", settings.Name, *status.BatteryRuntime)
+	}
+	return ""
+}
+
+// belowThreshold reports whether the battery charge is known and at or below a threshold;
+// a threshold of 0 never applies
+func belowThreshold(charge *float64, threshold int) bool {
+	return threshold > 0 && charge != nil && *charge <= float64(threshold)
+}
+
+// formatUPSCharge formats a battery charge for messages
+func formatUPSCharge(charge *float64) string {
+	if charge == nil {
+		return "unknown charge"
+	}
+	return fmt.Sprintf("%.0f%%", *charge)
+}
+
+// parseUPSStatus reads the power state and battery from NUT variables
+func parseUPSStatus(vars map[string]string) models.UPSStatus {
+	status := models.UPSStatus{
+		Status:    vars["ups.status"],
+		Variables: vars,
+	}
+	for _, flag := range strings.Fields(status.Status) {
+		switch flag {
+		case "OB":
+			status.OnBattery = true
+		case "LB":
+			status.LowBattery = true
+		}
+	}
+
+	model := strings.TrimSpace(vars["device.mfr"] + " " + vars["device.model"])
+	if model == "" {
+		model = strings.TrimSpace(vars["ups.mfr"] + " " + vars["ups.model"])
+	}
+	status.Model = model
+
+	float := func(key string) *float64 {
+		if f, err := strconv.ParseFloat(vars[key], 64); err == nil {
+			return &f
+		}
+		return nil
+	}
+	status.BatteryCharge = float("battery.charge")
+	status.Load = float("ups.load")
+	status.InputVoltage = float("input.voltage")
+	if runtime := float("battery.runtime"); runtime != nil {
+		seconds := int(math.Round(*runtime))
+		status.BatteryRuntime = &seconds
+	}
+	return status
+}
+
+// GetUPS returns the UPS settings and its last reading (admin only)
+func (m *UPSMonitor) GetUPS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"settings": GetUPSSettingsFromStore(m.store),
+		"status":   m.Status(),
+	})
+}
+
+// UpdateUPS saves the UPS settings; fields left out keep their value (admin only)
+func (m *UPSMonitor) UpdateUPS(w http.ResponseWriter, r *http.Request) {
+	req := GetUPSSettingsFromStore(m.store)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	req.Host = strings.TrimSpace(req.Host)
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Enabled && req.Host == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Host is required", nil)
+		return
+	}
+	if req.Enabled && (req.Name == "" || strings.ContainsAny(req.Name, " \t\"")) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid UPS name", nil)
+		return
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Port must be between 1 and 65535", nil)
+		return
+	}
+	if req.PollSeconds < 1 || req.PollSeconds > 300 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "poll_seconds must be between 1 and 300", nil)
+		return
+	}
+	if req.StopUploadsCharge < 0 || req.StopUploadsCharge > 100 || req.ShutdownCharge < 0 || req.ShutdownCharge > 100 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Battery thresholds must be between 0 and 100 percent", nil)
+		return
+	}
+	if req.ShutdownRuntime < 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "shutdown_runtime cannot be negative", nil)
+		return
+	}
+
+	category := string(models.CategoryGeneral)
+	m.store.SetSetting(models.SettingUPSEnabled, strconv.FormatBool(req.Enabled), "bool", category)
+	m.store.SetSetting(models.SettingUPSHost, req.Host, "string", category)
+	m.store.SetSetting(models.SettingUPSPort, strconv.Itoa(req.Port), "int", category)
+	m.store.SetSetting(models.SettingUPSName, req.Name, "string", category)
+	m.store.SetSetting(models.SettingUPSPollSeconds, strconv.Itoa(req.PollSeconds), "int", category)
+	m.store.SetSetting(models.SettingUPSStopUploadsCharge, strconv.Itoa(req.StopUploadsCharge), "int", category)
+	m.store.SetSetting(models.SettingUPSShutdownCharge, strconv.Itoa(req.ShutdownCharge), "int", category)
+	m.store.SetSetting(models.SettingUPSShutdownRuntime, strconv.Itoa(req.ShutdownRuntime), "int", category)
+	m.store.SetSetting(models.SettingUPSShutdownOnLowBattery, strconv.FormatBool(req.ShutdownOnLowBattery), "bool", category)
+	publishSettingsChanged(r, upsSettingKeys)
+	m.Reload()
+
+	m.GetUPS(w, r)
+}
+
+// ListUPSDevices returns the devices served by an upsd server, by default the configured one,
+// to pick the UPS name from (admin only)
+func (m *UPSMonitor) ListUPSDevices(w http.ResponseWriter, r *http.Request) {
+	settings := GetUPSSettingsFromStore(m.store)
+	if host := r.URL.Query().Get("host"); host != "" {
+		settings.Host = host
+	}
+	if port := r.URL.Query().Get("port"); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid port", nil)
+			return
+		}
+		settings.Port = n
+	}
+
+	devices, err := nut.New(upsAddress(settings)).List()
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(devices)
+}
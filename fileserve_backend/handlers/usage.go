@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// usageScanInterval is how often the usage tracker rescans every zone. Uploads and deletes
+// keep the totals current in between, so the rescan only corrects changes made outside the server.
+const usageScanInterval = 6 * time.Hour
+
+// usageHistoryRetention is how long usage samples are kept for trend reports
+const usageHistoryRetention = 180 * 24 * time.Hour
+
+// UsageTracker maintains per-directory usage for all enabled zones in the background
+// so that zone stats can be served without walking the tree
+type UsageTracker struct {
+	store    storage.DataStore
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	scanning map[string]bool
+	trigger  chan struct{}
+	status   models.UsageScanStatus
+}
+
+// NewUsageTracker creates a new usage tracker
+func NewUsageTracker(store storage.DataStore) *UsageTracker {
+	return &UsageTracker{
+		store:    store,
+		stopChan: make(chan struct{}),
+		scanning: make(map[string]bool),
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Start begins the usage tracker background goroutine
+func (ut *UsageTracker) Start() {
+	ut.mu.Lock()
+	if ut.running {
+		ut.mu.Unlock()
+		return
+	}
+	ut.running = true
+	ut.stopChan = make(chan struct{})
+	ut.mu.Unlock()
+
+	ut.wg.Add(1)
+	go ut.run()
+	log.Println("Usage tracker started")
+}
+
+// Stop stops the usage tracker
+func (ut *UsageTracker) Stop() {
+	ut.mu.Lock()
+	if !ut.running {
+		ut.mu.Unlock()
+		return
+	}
+	ut.running = false
+	close(ut.stopChan)
+	ut.mu.Unlock()
+
+	ut.wg.Wait()
+	log.Println("Usage tracker stopped")
+}
+
+// run is the main usage tracker loop
+func (ut *UsageTracker) run() {
+	defer ut.wg.Done()
+
+	ticker := time.NewTicker(usageScanInterval)
+	defer ticker.Stop()
+
+	// Initial scan
+	ut.scanAllZones()
+
+	for {
+		select {
+		case <-ut.stopChan:
+			return
+		case <-ticker.C:
+			ut.scanAllZones()
+		case <-ut.trigger:
+			ut.scanAllZones()
+		}
+	}
+}
+
+// ScanNow starts a scan of all zones ahead of schedule. It returns false if a scan is already running.
+func (ut *UsageTracker) ScanNow() bool {
+	ut.mu.Lock()
+	busy := ut.status.Running
+	ut.mu.Unlock()
+	if busy {
+		return false
+	}
+
+	select {
+	case ut.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetStatus returns whether a scan is running and when the last one finished
+func (ut *UsageTracker) GetStatus() models.UsageScanStatus {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	return ut.status
+}
+
+// scanAllZones rescans every enabled zone and records each zone's usage in the usage history
+func (ut *UsageTracker) scanAllZones() {
+	ut.mu.Lock()
+	ut.status.Running = true
+	ut.mu.Unlock()
+
+	defer func() {
+		ut.mu.Lock()
+		ut.status.Running = false
+		ut.mu.Unlock()
+	}()
+
+	for _, zone := range ut.store.ListShareZones() {
+		select {
+		case <-ut.stopChan:
+			return
+		default:
+		}
+		if !zone.Enabled {
+			continue
+		}
+		ut.ScanZone(zone)
+
+		select {
+		case <-ut.stopChan:
+			// The scan was cut short, so its totals are incomplete
+			return
+		default:
+		}
+		if err := recordZoneUsage(ut.store, zone, time.Now()); err != nil {
+			log.Printf("Usage tracker: failed to record usage of zone %s: %v", zone.Name, err)
+		}
+	}
+
+	if err := ut.store.PruneUsageSamples(time.Now().Add(-usageHistoryRetention)); err != nil {
+		log.Printf("Usage tracker: failed to prune usage history: %v", err)
+	}
+
+	now := time.Now()
+	ut.mu.Lock()
+	ut.status.LastScan = &now
+	ut.mu.Unlock()
+}
+
+// ScanZone walks a zone and refreshes its usage rows, removing rows for directories that no longer exist
+func (ut *UsageTracker) ScanZone(zone *models.ShareZone) {
+	pool, err := ut.store.GetStoragePool(zone.PoolID)
+	if err != nil || !pool.Enabled || pool.IsS3() {
+		return
+	}
+
+	ut.mu.Lock()
+	if ut.scanning[zone.ID] {
+		ut.mu.Unlock()
+		return
+	}
+	ut.scanning[zone.ID] = true
+	ut.mu.Unlock()
+
+	root := filepath.Join(pool.Path, zone.Path)
+	if err := scanUsageTree(ut.store, zone.ID, root, root, ut.stopChan); err != nil {
+		log.Printf("Usage tracker: failed to scan zone %s: %v", zone.Name, err)
+	}
+
+	ut.mu.Lock()
+	delete(ut.scanning, zone.ID)
+	ut.mu.Unlock()
+}
+
+// usageRelPath returns the path of a directory relative to the zone root
+func usageRelPath(root, dir string) string {
+	rel, _ := filepath.Rel(root, dir)
+	return filepath.ToSlash(filepath.Clean("/" + rel))
+}
+
+// scanUsageDir reads the entries directly inside dir and returns its usage along with its subdirectories
+func scanUsageDir(zoneID, root, dir string, now time.Time) (*models.DirUsage, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usage := &models.DirUsage{ZoneID: zoneID, Path: usageRelPath(root, dir), ScannedAt: now}
+	var subdirs []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			// Skip the zone trash and version store
+			if isReservedZonePath(root, path) {
+				continue
+			}
+			usage.DirCount++
+			subdirs = append(subdirs, path)
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Skip files removed while scanning
+			continue
+		}
+		usage.FileCount++
+		usage.Size += info.Size()
+	}
+	return usage, subdirs, nil
+}
+
+// scanUsageTree walks dir and records the usage of it and every directory beneath it,
+// then removes rows under dir that the walk did not see. The row for dir is written last,
+// so a recorded zone root means the whole zone has been counted.
+func scanUsageTree(store storage.DataStore, zoneID, root, dir string, stop <-chan struct{}) error {
+	scanStart := time.Now().Truncate(time.Second)
+	batch := make([]*models.DirUsage, 0, indexBatchSize)
+	var top *models.DirUsage
+
+	pending := []string{dir}
+	for len(pending) > 0 {
+		if stop != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+		}
+
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		usage, subdirs, err := scanUsageDir(zoneID, root, current, scanStart)
+		if err != nil {
+			if current == dir {
+				return err
+			}
+			// Skip inaccessible directories
+			continue
+		}
+		pending = append(pending, subdirs...)
+
+		if current == dir {
+			top = usage
+			continue
+		}
+		batch = append(batch, usage)
+		if len(batch) >= indexBatchSize {
+			if err := store.UpsertDirUsage(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := store.UpsertDirUsage(append(batch, top)); err != nil {
+		return err
+	}
+	return store.PruneDirUsage(zoneID, usageRelPath(root, dir), scanStart)
+}
+
+// zoneUsageScanned reports whether the usage tracker has completed a scan of the zone
+func zoneUsageScanned(store storage.DataStore, zoneID string) bool {
+	_, err := store.GetDirUsage(zoneID, "/")
+	return err == nil
+}
+
+// dirUsageTotals returns the recursive usage of dir from the usage tracker, counting it first
+// when refresh is set or when the tracker has not counted it yet
+func dirUsageTotals(store storage.DataStore, zoneID, root, dir string, refresh bool) (*models.UsageTotals, error) {
+	relPath := usageRelPath(root, dir)
+	if _, err := store.GetDirUsage(zoneID, relPath); err != nil || refresh || !zoneUsageScanned(store, zoneID) {
+		scanUsageTree(store, zoneID, root, dir, nil)
+	}
+	return store.SumDirUsage(zoneID, relPath)
+}
+
+// refreshUsage updates the usage rows after a file or folder was created, changed or removed on disk.
+// The parent directory is rescanned, along with any parent folders created for the change.
+func refreshUsage(store storage.DataStore, zone *models.ShareZone, root, fullPath string) {
+	if !zoneUsageScanned(store, zone.ID) {
+		// The first full scan will pick up the change
+		return
+	}
+
+	now := time.Now()
+	if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+		scanUsageTree(store, zone.ID, root, fullPath, nil)
+	} else {
+		store.DeleteDirUsagePath(zone.ID, usageRelPath(root, fullPath))
+	}
+
+	for dir := filepath.Dir(fullPath); ; dir = filepath.Dir(dir) {
+		_, err := store.GetDirUsage(zone.ID, usageRelPath(root, dir))
+		tracked := err == nil
+		if usage, _, err := scanUsageDir(zone.ID, root, dir, now); err == nil {
+			store.UpsertDirUsage([]*models.DirUsage{usage})
+		}
+		// A directory that was already tracked is already counted by its parent
+		if tracked || dir == root || len(dir) < len(root) {
+			break
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// usageTrendPeriods are the periods, in days, reported by the usage trend endpoint
+var usageTrendPeriods = []int{7, 30, 90}
+
+// recordZoneUsage stores the current usage of a zone and of every user with a quota account
+// in it as one sample each. Zones that have not been scanned are skipped.
+func recordZoneUsage(store storage.DataStore, zone *models.ShareZone, now time.Time) error {
+	pool, err := store.GetStoragePool(zone.PoolID)
+	if err != nil || !pool.Enabled || pool.IsS3() {
+		return nil
+	}
+	totals, err := store.SumDirUsage(zone.ID, "/")
+	if err != nil {
+		return nil
+	}
+
+	now = now.Truncate(time.Second)
+	root := filepath.Join(pool.Path, zone.Path)
+	samples := []*models.UsageSample{{ZoneID: zone.ID, UsedBytes: totals.Size, RecordedAt: now}}
+	for _, account := range zoneQuotaAccounts(store, zone, pool) {
+		samples = append(samples, &models.UsageSample{
+			ZoneID:     zone.ID,
+			Username:   account,
+			UsedBytes:  zoneQuotaUsage(store, zone, root, account),
+			RecordedAt: now,
+		})
+	}
+	return store.RecordUsageSamples(samples)
+}
+
+// usageTrend compares a sample with the usage recorded the given number of days earlier. When
+// the history does not reach back that far, the oldest sample in the period is used instead.
+func usageTrend(store storage.DataStore, current *models.UsageSample, days int) *models.UsageTrend {
+	trend := &models.UsageTrend{
+		ZoneID:        current.ZoneID,
+		Username:      current.Username,
+		Days:          days,
+		CurrentBytes:  current.UsedBytes,
+		PreviousBytes: current.UsedBytes,
+		Since:         current.RecordedAt,
+		RecordedAt:    current.RecordedAt,
+	}
+
+	cutoff := current.RecordedAt.AddDate(0, 0, -days)
+	previous, err := store.GetUsageSampleBefore(current.ZoneID, current.Username, cutoff)
+	if err != nil {
+		if samples := store.ListUsageSamples(current.ZoneID, current.Username, cutoff); len(samples) > 0 {
+			previous = samples[0]
+		}
+	}
+	if previous != nil {
+		trend.PreviousBytes = previous.UsedBytes
+		trend.Since = previous.RecordedAt
+	}
+
+	trend.GrowthBytes = trend.CurrentBytes - trend.PreviousBytes
+	if trend.PreviousBytes > 0 {
+		trend.GrowthPercent = float64(trend.GrowthBytes) / float64(trend.PreviousBytes) * 100
+	}
+	return trend
+}
+
+// latestUsageTrends returns the growth over a period of every user and zone seen in the most
+// recent scan of their zone, optionally limited to one zone
+func latestUsageTrends(store storage.DataStore, zoneID string, days int) []*models.UsageTrend {
+	latest := store.ListLatestUsageSamples()
+
+	// Users no longer found in a zone keep an old latest sample; only report the last scan
+	lastScan := make(map[string]time.Time)
+	for _, sample := range latest {
+		if sample.Username == "" {
+			lastScan[sample.ZoneID] = sample.RecordedAt
+		}
+	}
+
+	zoneNames := make(map[string]string)
+	for _, zone := range store.ListShareZones() {
+		zoneNames[zone.ID] = zone.Name
+	}
+
+	trends := []*models.UsageTrend{}
+	for _, sample := range latest {
+		if zoneID != "" && sample.ZoneID != zoneID {
+			continue
+		}
+		if !sample.RecordedAt.Equal(lastScan[sample.ZoneID]) {
+			continue
+		}
+		trend := usageTrend(store, sample, days)
+		trend.ZoneName = zoneNames[sample.ZoneID]
+		trends = append(trends, trend)
+	}
+	return trends
+}
+
+// parseUsageDays parses a period in days for usage reports
+func parseUsageDays(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	maxDays := int(usageHistoryRetention / (24 * time.Hour))
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 || days > maxDays {
+		return 0, fmt.Errorf("invalid days %q: use a number between 1 and %d", value, maxDays)
+	}
+	return days, nil
+}
+
+// UsageHandler serves the usage history recorded by the usage tracker
+type UsageHandler struct {
+	store   storage.DataStore
+	tracker *UsageTracker
+}
+
+// NewUsageHandler creates a new usage handler
+func NewUsageHandler(store storage.DataStore, tracker *UsageTracker) *UsageHandler {
+	return &UsageHandler{store: store, tracker: tracker}
+}
+
+// GetUsageReport returns the latest usage of every zone and user with their growth over a
+// period (default 7 days)
+func (h *UsageHandler) GetUsageReport(w http.ResponseWriter, r *http.Request) {
+	days, err := parseUsageDays(r.URL.Query().Get("days"), 7)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	report := models.UsageReport{
+		Status: h.tracker.GetStatus(),
+		Usage:  latestUsageTrends(h.store, r.URL.Query().Get("zone_id"), days),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// RunUsageScan starts a usage scan of all zones ahead of schedule
+func (h *UsageHandler) RunUsageScan(w http.ResponseWriter, r *http.Request) {
+	if !h.tracker.ScanNow() {
+		apierror.Write(w, http.StatusConflict, apierror.CodeBusy, "A usage scan is already in progress", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Usage scan started",
+	})
+}
+
+// GetUsageTrends returns the growth of a user in a zone, or of the whole zone when no user is
+// given, over 7, 30 and 90 days along with the samples of the last 90 days
+func (h *UsageHandler) GetUsageTrends(w http.ResponseWriter, r *http.Request) {
+	zoneID := r.URL.Query().Get("zone_id")
+	username := r.URL.Query().Get("username")
+
+	zone, err := h.store.GetShareZone(zoneID)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, "Zone not found", nil)
+		return
+	}
+
+	longest := usageTrendPeriods[len(usageTrendPeriods)-1]
+	samples := h.store.ListUsageSamples(zoneID, username, time.Now().AddDate(0, 0, -longest))
+	trends := []*models.UsageTrend{}
+	if len(samples) > 0 {
+		for _, days := range usageTrendPeriods {
+			trend := usageTrend(h.store, samples[len(samples)-1], days)
+			trend.ZoneName = zone.Name
+			trends = append(trends, trend)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"zone_id":   zone.ID,
+		"zone_name": zone.Name,
+		"username":  username,
+		"trends":    trends,
+		"samples":   samples,
+	})
+}
+
+// GetTopUsageGrowers returns the users whose usage grew the most over a period (default 30 days)
+func (h *UsageHandler) GetTopUsageGrowers(w http.ResponseWriter, r *http.Request) {
+	days, err := parseUsageDays(r.URL.Query().Get("days"), 30)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+	limit := 10
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid limit", nil)
+			return
+		}
+	}
+
+	growers := []*models.UsageTrend{}
+	for _, trend := range latestUsageTrends(h.store, r.URL.Query().Get("zone_id"), days) {
+		if trend.Username != "" && trend.GrowthBytes > 0 {
+			growers = append(growers, trend)
+		}
+	}
+	sort.Slice(growers, func(i, j int) bool {
+		return growers[i].GrowthBytes > growers[j].GrowthBytes
+	})
+	if len(growers) > limit {
+		growers = growers[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(growers)
+}
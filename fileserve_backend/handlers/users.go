@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
+	"fileserv/internal/apierror"
+	"fileserv/internal/events"
+	"fileserv/models"
 	"fileserv/storage"
 
 	"github.com/go-chi/chi/v5"
@@ -44,12 +48,17 @@ func CreateUser(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateUserRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
 			return
 		}
 
 		if req.Username == "" || req.Password == "" {
-			http.Error(w, "Username and password are required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Username and password are required", nil)
+			return
+		}
+
+		if err := validatePasswordComplexity(GetPasswordPolicyFromStore(store), req.Password); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
@@ -59,9 +68,20 @@ func CreateUser(store storage.DataStore) http.HandlerFunc {
 
 		user, err := store.CreateUser(req.Username, req.Password, req.Email, req.IsAdmin, req.Groups)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
+		recordPasswordChange(store, user.Username, user.PasswordHash, "")
+		if user.IsAdmin {
+			recordPrivilegeEscalation(store, r, user.Username, fmt.Sprintf("Admin user %s was created", user.Username))
+		}
+		publishAction(r, &events.Event{
+			Type:       events.TypeUserCreated,
+			ObjectType: "user",
+			ObjectID:   user.ID,
+			AdminOnly:  true,
+			Data:       map[string]interface{}{"username": user.Username, "is_admin": user.IsAdmin},
+		})
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -73,13 +93,13 @@ func UpdateUser(store storage.DataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
-			http.Error(w, "User ID is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "User ID is required", nil)
 			return
 		}
 
 		var req UpdateUserRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
 			return
 		}
 
@@ -89,12 +109,24 @@ func UpdateUser(store storage.DataStore) http.HandlerFunc {
 			updates["username"] = *req.Username
 		}
 		if req.Password != nil {
+			if err := validatePasswordComplexity(GetPasswordPolicyFromStore(store), *req.Password); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
 			updates["password"] = *req.Password
 		}
 		if req.Email != nil {
 			updates["email"] = *req.Email
 		}
+		wasAdmin := false
 		if req.IsAdmin != nil {
+			existing, err := store.GetUserByID(id)
+			// Guests are managed through /guests and never become admins
+			if err == nil && existing.IsGuest && *req.IsAdmin {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Guest accounts cannot be admins", nil)
+				return
+			}
+			wasAdmin = err == nil && existing.IsAdmin
 			updates["is_admin"] = *req.IsAdmin
 		}
 		if req.Groups != nil {
@@ -106,27 +138,75 @@ func UpdateUser(store storage.DataStore) http.HandlerFunc {
 
 		user, err := store.UpdateUser(id, updates)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
+		if req.Password != nil {
+			recordPasswordChange(store, user.Username, user.PasswordHash, "")
+		}
+		if user.IsAdmin && req.IsAdmin != nil && !wasAdmin {
+			recordPrivilegeEscalation(store, r, user.Username, fmt.Sprintf("User %s was made an admin", user.Username))
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(user.Safe())
 	}
 }
 
-func DeleteUser(store storage.DataStore) http.HandlerFunc {
+// DeleteUser deletes a user, signing out their sessions and removing their share links, API tokens
+// and the folder shares they own or receive
+func DeleteUser(store storage.DataStore, sessions *SessionHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
-			http.Error(w, "User ID is required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "User ID is required", nil)
+			return
+		}
+
+		user, err := store.GetUserByID(id)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
-		if err := store.DeleteUser(id); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		var revoked []*models.Session
+		err = store.WithTx(func(tx storage.DataStore) error {
+			revoked = tx.ListSessionsByUser(id)
+			for _, session := range revoked {
+				if err := tx.RevokeSession(session); err != nil {
+					return err
+				}
+			}
+			for _, link := range tx.ListShareLinksByOwner(id) {
+				if err := tx.DeleteShareLink(link.ID); err != nil {
+					return err
+				}
+			}
+			for _, token := range tx.ListAPITokensByUser(id) {
+				if err := tx.DeleteAPIToken(token.ID); err != nil {
+					return err
+				}
+			}
+			if err := deleteUserFolderShares(tx, user); err != nil {
+				return err
+			}
+			return tx.DeleteUser(id)
+		})
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
+		for _, session := range revoked {
+			sessions.denylist(session)
+			recordImpersonationEnded(store, session)
+		}
+		publishAction(r, &events.Event{
+			Type:       events.TypeUserDeleted,
+			ObjectType: "user",
+			ObjectID:   id,
+			AdminOnly:  true,
+			Data:       map[string]interface{}{"username": user.Username},
+		})
 
 		w.WriteHeader(http.StatusNoContent)
 	}
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/fileops"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// saveFileVersion moves an existing file into the zone version store before it is overwritten.
+// Returns nil without error if the file does not exist or versioning is disabled for its zone.
+func saveFileVersion(store storage.DataStore, fullPath string, userCtx *middleware.UserContext) (*models.FileVersion, error) {
+	info, err := os.Lstat(fullPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	zone, root := zoneForPath(store, fullPath)
+	if zone == nil || fullPath == root {
+		return nil, nil
+	}
+
+	cfg := store.GetZoneVersioning(zone.ID)
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	versionsDir := filepath.Join(root, models.VersionsDirName)
+	if err := os.MkdirAll(versionsDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create versions directory: %w", err)
+	}
+
+	rel, _ := filepath.Rel(root, fullPath)
+	version, err := store.CreateFileVersion(&models.FileVersion{
+		ZoneID:        zone.ID,
+		Path:          "/" + filepath.ToSlash(rel),
+		Size:          info.Size(),
+		ModTime:       info.ModTime(),
+		CreatedBy:     userCtx.UserID,
+		CreatedByName: userCtx.Username,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(fullPath, filepath.Join(versionsDir, version.ID)); err != nil {
+		store.DeleteFileVersion(version.ID)
+		return nil, err
+	}
+
+	pruneFileVersions(store, cfg, root, version.Path)
+	return version, nil
+}
+
+// undoFileVersion puts a just-saved version back in place after a failed overwrite
+func undoFileVersion(store storage.DataStore, version *models.FileVersion, fullPath string) {
+	if version == nil {
+		return
+	}
+	zone, root := zoneForPath(store, fullPath)
+	if zone == nil {
+		return
+	}
+	os.Remove(fullPath)
+	if err := os.Rename(filepath.Join(root, models.VersionsDirName, version.ID), fullPath); err == nil {
+		store.DeleteFileVersion(version.ID)
+	}
+}
+
+// deleteFileVersion removes a stored version from disk and the database
+func deleteFileVersion(store storage.DataStore, root string, version *models.FileVersion) error {
+	if err := os.Remove(filepath.Join(root, models.VersionsDirName, version.ID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return store.DeleteFileVersion(version.ID)
+}
+
+// pruneFileVersions enforces the per-file version count and the per-zone version storage limit
+func pruneFileVersions(store storage.DataStore, cfg *models.ZoneVersioning, root, path string) {
+	if cfg.MaxVersions > 0 && path != "" {
+		versions := store.ListFileVersions(cfg.ZoneID, path)
+		for i := cfg.MaxVersions; i < len(versions); i++ {
+			if err := deleteFileVersion(store, root, versions[i]); err != nil {
+				log.Printf("Failed to prune version %s of %s: %v", versions[i].ID, path, err)
+			}
+		}
+	}
+
+	if cfg.MaxStorage > 0 {
+		versions := store.ListZoneFileVersions(cfg.ZoneID)
+		var total int64
+		for _, v := range versions {
+			total += v.Size
+		}
+		for _, v := range versions {
+			if total <= cfg.MaxStorage {
+				break
+			}
+			if err := deleteFileVersion(store, root, v); err != nil {
+				log.Printf("Failed to prune version %s of %s: %v", v.ID, v.Path, err)
+				continue
+			}
+			total -= v.Size
+		}
+	}
+}
+
+// parseVersionsPath splits "<file>/versions[/<id>[/restore]]" into its parts
+func parseVersionsPath(p string) (filePath, versionID, action string, ok bool) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i := len(parts) - 1; i >= 1 && i >= len(parts)-3; i-- {
+		if parts[i] != "versions" {
+			continue
+		}
+		rest := parts[i+1:]
+		switch {
+		case len(rest) == 0:
+		case len(rest) == 1:
+			versionID = rest[0]
+		case len(rest) == 2 && rest[1] == "restore":
+			versionID, action = rest[0], "restore"
+		default:
+			continue
+		}
+		return "/" + strings.Join(parts[:i], "/"), versionID, action, true
+	}
+	return "", "", "", false
+}
+
+// routeFileVersions serves version requests nested under a file path.
+// A path is only treated as a version request when the part before "/versions" is an existing file,
+// so real folders or files named "versions" keep working. Returns true if the request was handled.
+func (h *ZoneFileHandler) routeFileVersions(w http.ResponseWriter, r *http.Request, userCtx *middleware.UserContext, filePath string, restore bool) bool {
+	base, versionID, action, ok := parseVersionsPath(filePath)
+	if !ok || (action == "restore") != restore {
+		return false
+	}
+
+	zoneID := chi.URLParam(r, "zoneId")
+	user := userFromContext(userCtx)
+
+	fullPath, zone, pool, err := h.resolveZonePathWithPool(zoneID, base, user)
+	if err != nil {
+		return false
+	}
+	if info, err := os.Stat(fullPath); err != nil || info.IsDir() {
+		return false
+	}
+
+	root := filepath.Join(pool.Path, zone.Path)
+	rel, _ := filepath.Rel(root, fullPath)
+	recordPath := "/" + filepath.ToSlash(rel)
+
+	switch {
+	case restore:
+		h.restoreFileVersion(w, zone, root, fullPath, recordPath, versionID, userCtx)
+	case versionID != "":
+		h.downloadFileVersion(w, r, zone, root, fullPath, recordPath, versionID)
+	default:
+		versions := h.store.ListFileVersions(zone.ID, recordPath)
+		for _, v := range versions {
+			v.Path = base
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"path":     base,
+			"versions": versions,
+		})
+	}
+	return true
+}
+
+// getPathVersion loads a version and checks it belongs to the given file
+func (h *ZoneFileHandler) getPathVersion(w http.ResponseWriter, zone *models.ShareZone, recordPath, versionID string) (*models.FileVersion, bool) {
+	version, err := h.store.GetFileVersion(versionID)
+	if err != nil || version.ZoneID != zone.ID || version.Path != recordPath {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeVersionNotFound, "Version not found", nil)
+		return nil, false
+	}
+	return version, true
+}
+
+// downloadFileVersion streams the content of a previous version
+func (h *ZoneFileHandler) downloadFileVersion(w http.ResponseWriter, r *http.Request, zone *models.ShareZone, root, fullPath, recordPath, versionID string) {
+	version, ok := h.getPathVersion(w, zone, recordPath, versionID)
+	if !ok {
+		return
+	}
+
+	opts := &fileops.TransferOptions{
+		ForceDownload: true,
+		Filename:      filepath.Base(fullPath),
+	}
+	if err := fileops.ServeFileWithRange(w, r, filepath.Join(root, models.VersionsDirName, version.ID), opts); err != nil {
+		if os.IsNotExist(err) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeVersionNotFound, "Version content not found", nil)
+		} else {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// restoreFileVersion replaces the current file with a previous version, keeping the current content as a new version
+func (h *ZoneFileHandler) restoreFileVersion(w http.ResponseWriter, zone *models.ShareZone, root, fullPath, recordPath, versionID string, userCtx *middleware.UserContext) {
+	if zone.ReadOnly {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
+		return
+	}
+
+	version, ok := h.getPathVersion(w, zone, recordPath, versionID)
+	if !ok {
+		return
+	}
+
+	// Take the version out of the store first so pruning cannot remove it
+	versionFile := filepath.Join(root, models.VersionsDirName, version.ID)
+	restoring := versionFile + ".restoring"
+	if err := os.Rename(versionFile, restoring); err != nil {
+		apierror.Error(w, "Failed to restore version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.store.DeleteFileVersion(version.ID)
+
+	if _, err := saveFileVersion(h.store, fullPath, userCtx); err != nil {
+		log.Printf("Failed to keep current content of %s as a version: %v", recordPath, err)
+	}
+
+	if err := os.Rename(restoring, fullPath); err != nil {
+		apierror.Error(w, "Failed to restore version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	os.Chtimes(fullPath, version.ModTime, version.ModTime)
+	indexPath(h.store, fullPath)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Version restored successfully",
+		"size":    version.Size,
+	})
+}
+
+// GetZoneVersioning returns the versioning configuration of a zone
+func (h *ZoneHandler) GetZoneVersioning(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if _, err := h.store.GetShareZone(id); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+
+	var used int64
+	versions := h.store.ListZoneFileVersions(id)
+	for _, v := range versions {
+		used += v.Size
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"config":        h.store.GetZoneVersioning(id),
+		"version_count": len(versions),
+		"used_storage":  used,
+	})
+}
+
+// UpdateZoneVersioning updates the versioning configuration of a zone
+func (h *ZoneHandler) UpdateZoneVersioning(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	zone, err := h.store.GetShareZone(id)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+
+	var req struct {
+		Enabled     *bool  `json:"enabled"`
+		MaxVersions *int   `json:"max_versions"`
+		MaxStorage  *int64 `json:"max_storage"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+
+	cfg := h.store.GetZoneVersioning(id)
+	if req.Enabled != nil {
+		cfg.Enabled = *req.Enabled
+	}
+	if req.MaxVersions != nil {
+		if *req.MaxVersions < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "max_versions cannot be negative", nil)
+			return
+		}
+		cfg.MaxVersions = *req.MaxVersions
+	}
+	if req.MaxStorage != nil {
+		if *req.MaxStorage < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "max_storage cannot be negative", nil)
+			return
+		}
+		cfg.MaxStorage = *req.MaxStorage
+	}
+
+	if err := h.store.SetZoneVersioning(cfg); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Apply the new limits to versions already stored
+	if pool, err := h.store.GetStoragePool(zone.PoolID); err == nil {
+		root := filepath.Join(pool.Path, zone.Path)
+		if cfg.MaxVersions > 0 {
+			seen := make(map[string]bool)
+			for _, v := range h.store.ListZoneFileVersions(id) {
+				if !seen[v.Path] {
+					seen[v.Path] = true
+					pruneFileVersions(h.store, &models.ZoneVersioning{ZoneID: id, MaxVersions: cfg.MaxVersions}, root, v.Path)
+				}
+			}
+		}
+		pruneFileVersions(h.store, &models.ZoneVersioning{ZoneID: id, MaxStorage: cfg.MaxStorage}, root, "")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
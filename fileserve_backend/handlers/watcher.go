@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"fileserv/internal/events"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+const (
+	// watchDebounce is how long a path must stay quiet before its change is processed, so a file
+	// being written is indexed once when the writer is done
+	watchDebounce = 2 * time.Second
+	// watchResyncInterval is how often the watched zones are matched against the configured zones
+	watchResyncInterval = 1 * time.Minute
+	// maxChangesPerEvent caps the changes listed in one files.changed event
+	maxChangesPerEvent = 200
+	// watchMask selects the inotify events that matter for the index and usage
+	watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+		syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+)
+
+// watchedDir is a directory with an inotify watch
+type watchedDir struct {
+	path string
+	root string // Root of the zone the directory belongs to
+}
+
+// ZoneWatcher watches the directories of local zones with inotify and keeps the search index,
+// directory usage, checksums and metadata current when files are changed outside the server
+// (SMB, NFS, shell). Changes are pushed to clients as files.changed events. Previews need no
+// invalidation because they are cached by file size and modification time.
+type ZoneWatcher struct {
+	store    storage.DataStore
+	indexer  *FileIndexer
+	usage    *UsageTracker
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  bool
+	inotify  *os.File
+	fd       int
+	watches  map[int]*watchedDir // By watch descriptor
+	dirs     map[string]int      // Watch descriptors by directory
+	zones    map[string]string   // Watched zone roots by zone ID
+	pending  map[string]*pendingChange
+	status   models.WatcherStatus
+}
+
+// pendingChange is a changed path waiting for watchDebounce to pass
+type pendingChange struct {
+	op   string
+	seen time.Time
+}
+
+// NewZoneWatcher creates a new zone watcher. The indexer and usage tracker are asked for a full
+// rescan when the kernel drops events.
+func NewZoneWatcher(store storage.DataStore, indexer *FileIndexer, usage *UsageTracker) *ZoneWatcher {
+	return &ZoneWatcher{
+		store:    store,
+		indexer:  indexer,
+		usage:    usage,
+		stopChan: make(chan struct{}),
+		watches:  make(map[int]*watchedDir),
+		dirs:     make(map[string]int),
+		zones:    make(map[string]string),
+		pending:  make(map[string]*pendingChange),
+	}
+}
+
+// Start begins watching zones. Without inotify the watcher stays off and the periodic rescans
+// of the indexer and usage tracker pick up external changes instead.
+func (zw *ZoneWatcher) Start() {
+	zw.mu.Lock()
+	if zw.running {
+		zw.mu.Unlock()
+		return
+	}
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		zw.status.Error = err.Error()
+		zw.mu.Unlock()
+		log.Printf("File watcher unavailable: %v", err)
+		return
+	}
+	// A non-blocking descriptor goes through the runtime poller, so closing the file ends a pending read
+	zw.fd = fd
+	zw.inotify = os.NewFile(uintptr(fd), "inotify")
+	zw.running = true
+	zw.stopChan = make(chan struct{})
+	zw.status = models.WatcherStatus{Running: true}
+	zw.mu.Unlock()
+
+	zw.wg.Add(2)
+	go zw.read()
+	go zw.run()
+	log.Println("File watcher started")
+}
+
+// Stop stops watching zones
+func (zw *ZoneWatcher) Stop() {
+	zw.mu.Lock()
+	if !zw.running {
+		zw.mu.Unlock()
+		return
+	}
+	zw.running = false
+	close(zw.stopChan)
+	zw.inotify.Close()
+	zw.mu.Unlock()
+
+	zw.wg.Wait()
+
+	zw.mu.Lock()
+	zw.watches = make(map[int]*watchedDir)
+	zw.dirs = make(map[string]int)
+	zw.zones = make(map[string]string)
+	zw.pending = make(map[string]*pendingChange)
+	zw.status.Running = false
+	zw.mu.Unlock()
+	log.Println("File watcher stopped")
+}
+
+// GetStatus returns the state of the watcher
+func (zw *ZoneWatcher) GetStatus() models.WatcherStatus {
+	zw.mu.Lock()
+	defer zw.mu.Unlock()
+	status := zw.status
+	status.Zones = len(zw.zones)
+	status.Watches = len(zw.watches)
+	return status
+}
+
+// run syncs the watched zones and processes changes once they settle
+func (zw *ZoneWatcher) run() {
+	defer zw.wg.Done()
+
+	flush := time.NewTicker(watchDebounce / 2)
+	defer flush.Stop()
+	resync := time.NewTicker(watchResyncInterval)
+	defer resync.Stop()
+
+	zw.syncZones()
+
+	for {
+		select {
+		case <-zw.stopChan:
+			return
+		case <-flush.C:
+			zw.flush()
+		case <-resync.C:
+			zw.syncZones()
+		}
+	}
+}
+
+// syncZones starts watching enabled local zones that are not watched yet and stops watching
+// zones that were removed, disabled or moved
+func (zw *ZoneWatcher) syncZones() {
+	wanted := make(map[string]string)
+	for _, zone := range zw.store.ListShareZones() {
+		if !zone.Enabled {
+			continue
+		}
+		pool, err := zw.store.GetStoragePool(zone.PoolID)
+		if err != nil || !pool.Enabled || pool.IsS3() {
+			continue
+		}
+		wanted[zone.ID] = filepath.Join(pool.Path, zone.Path)
+	}
+
+	zw.mu.Lock()
+	var removed []string
+	for id, root := range zw.zones {
+		if wanted[id] != root {
+			removed = append(removed, root)
+			delete(zw.zones, id)
+		}
+	}
+	for _, root := range removed {
+		zw.unwatchTree(root)
+	}
+	// Zones nested in a removed zone lost their watches too and are watched again below
+	for id, root := range zw.zones {
+		for _, r := range removed {
+			if root == r || strings.HasPrefix(root, r+string(filepath.Separator)) {
+				delete(zw.zones, id)
+				break
+			}
+		}
+	}
+	var added []string
+	for id, root := range wanted {
+		if _, ok := zw.zones[id]; !ok {
+			added = append(added, root)
+			zw.zones[id] = root
+		}
+	}
+	zw.mu.Unlock()
+
+	for _, root := range added {
+		zw.watchTree(root, root)
+	}
+}
+
+// watchTree adds a watch to dir and every folder below it, skipping the server-managed folders
+func (zw *ZoneWatcher) watchTree(root, dir string) {
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		select {
+		case <-zw.stopChan:
+			return filepath.SkipAll
+		default:
+		}
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if isReservedZonePath(root, p) {
+			return filepath.SkipDir
+		}
+		if err := zw.watch(root, p); err != nil {
+			if errors.Is(err, syscall.ENOSPC) {
+				return filepath.SkipAll
+			}
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// watch adds an inotify watch to one directory
+func (zw *ZoneWatcher) watch(root, dir string) error {
+	zw.mu.Lock()
+	defer zw.mu.Unlock()
+	if !zw.running {
+		return os.ErrClosed
+	}
+
+	wd, err := syscall.InotifyAddWatch(zw.fd, dir, watchMask)
+	if err != nil {
+		if errors.Is(err, syscall.ENOSPC) && !zw.status.LimitReached {
+			zw.status.LimitReached = true
+			log.Printf("File watcher: inotify watch limit reached at %s (raise fs.inotify.max_user_watches); "+
+				"changes in unwatched folders are picked up by the periodic rescans", dir)
+		}
+		return err
+	}
+	zw.watches[wd] = &watchedDir{path: dir, root: root}
+	zw.dirs[dir] = wd
+	return nil
+}
+
+// unwatchTree removes the watches of dir and every folder below it. The caller holds zw.mu.
+func (zw *ZoneWatcher) unwatchTree(dir string) {
+	for p, wd := range zw.dirs {
+		if p == dir || strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			syscall.InotifyRmWatch(zw.fd, uint32(wd))
+			delete(zw.dirs, p)
+			delete(zw.watches, wd)
+		}
+	}
+}
+
+// read decodes inotify events until the watcher is stopped
+func (zw *ZoneWatcher) read() {
+	defer zw.wg.Done()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := zw.inotify.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Printf("File watcher: read failed: %v", err)
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			wd := int(int32(binary.NativeEndian.Uint32(buf[offset:])))
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			start := offset + syscall.SizeofInotifyEvent
+			if start+nameLen > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[start:start+nameLen]), "\x00")
+			offset = start + nameLen
+
+			zw.handle(wd, mask, name)
+		}
+	}
+}
+
+// handle records one inotify event
+func (zw *ZoneWatcher) handle(wd int, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		zw.mu.Lock()
+		zw.status.Overflows++
+		zw.mu.Unlock()
+		log.Println("File watcher: event queue overflowed, rescanning all zones")
+		zw.indexer.Reindex("")
+		zw.usage.ScanNow()
+		return
+	}
+
+	zw.mu.Lock()
+	dir, ok := zw.watches[wd]
+	if !ok {
+		zw.mu.Unlock()
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		// The directory was deleted or unmounted; its parent reports the deletion
+		delete(zw.watches, wd)
+		if zw.dirs[dir.path] == wd {
+			delete(zw.dirs, dir.path)
+		}
+		zw.mu.Unlock()
+		return
+	}
+	if name == "" {
+		zw.mu.Unlock()
+		return
+	}
+
+	p := filepath.Join(dir.path, name)
+	if isReservedZonePath(dir.root, p) {
+		zw.mu.Unlock()
+		return
+	}
+
+	op := models.FileChangeModified
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		op = models.FileChangeCreated
+	case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		op = models.FileChangeDeleted
+		if mask&syscall.IN_ISDIR != 0 {
+			zw.unwatchTree(p)
+		}
+	}
+	if change, ok := zw.pending[p]; ok && change.op == models.FileChangeCreated && op == models.FileChangeModified {
+		change.seen = time.Now()
+	} else {
+		zw.pending[p] = &pendingChange{op: op, seen: time.Now()}
+	}
+	zw.mu.Unlock()
+
+	// New folders are watched right away so files written into them are not missed; anything
+	// created before the watch is in place is covered by indexing the folder as a whole
+	if op == models.FileChangeCreated && mask&syscall.IN_ISDIR != 0 {
+		zw.watchTree(dir.root, p)
+	}
+}
+
+// flush processes the changes that have settled: the index, usage, checksums and metadata are
+// updated and clients with access to the zone are notified
+func (zw *ZoneWatcher) flush() {
+	now := time.Now()
+	zw.mu.Lock()
+	settled := make(map[string]string)
+	for p, change := range zw.pending {
+		if now.Sub(change.seen) >= watchDebounce {
+			settled[p] = change.op
+			delete(zw.pending, p)
+		}
+	}
+	zw.mu.Unlock()
+	if len(settled) == 0 {
+		return
+	}
+
+	paths := make([]string, 0, len(settled))
+	for p := range settled {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	type zoneChanges struct {
+		zone    *models.ShareZone
+		root    string
+		changes []models.FileChange
+	}
+	byZone := make(map[string]*zoneChanges)
+	var last time.Time
+
+	for _, p := range paths {
+		// A folder that changed as a whole covers everything below it
+		covered := false
+		for dir := filepath.Dir(p); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if _, ok := settled[dir]; ok {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+
+		zone, root := zoneForPath(zw.store, p)
+		if zone == nil {
+			continue
+		}
+
+		op := settled[p]
+		if _, err := os.Lstat(p); err == nil {
+			if op == models.FileChangeDeleted {
+				op = models.FileChangeCreated
+			}
+			indexPath(zw.store, p)
+		} else {
+			op = models.FileChangeDeleted
+			unindexPath(zw.store, p)
+		}
+		last = time.Now()
+
+		zc, ok := byZone[zone.ID]
+		if !ok {
+			zc = &zoneChanges{zone: zone, root: root}
+			byZone[zone.ID] = zc
+		}
+		zc.changes = append(zc.changes, models.FileChange{Path: usageRelPath(root, p), Op: op})
+	}
+
+	zw.mu.Lock()
+	for _, zc := range byZone {
+		zw.status.Changes += int64(len(zc.changes))
+	}
+	if !last.IsZero() {
+		zw.status.LastChange = &last
+	}
+	zw.mu.Unlock()
+
+	if len(byZone) == 0 {
+		return
+	}
+	users := zw.store.ListUsers()
+	for _, zc := range byZone {
+		publishFileChanges(zc.zone, zc.changes, users)
+	}
+}
+
+// publishFileChanges sends files.changed events to the users who can see the changed paths. In
+// personal zones each user only hears about their own folder, with paths relative to it.
+func publishFileChanges(zone *models.ShareZone, changes []models.FileChange, users []*models.User) {
+	if zone.ZoneType != models.ZoneTypePersonal {
+		var recipients []string
+		for _, user := range users {
+			if !user.IsAdmin && zone.UserHasZoneAccess(user) {
+				recipients = append(recipients, user.ID)
+			}
+		}
+		publishFileChangeBatch(zone.ID, recipients, changes)
+		return
+	}
+
+	byUsername := make(map[string]*models.User)
+	for _, user := range users {
+		byUsername[user.Username] = user
+	}
+	owners := make(map[string][]models.FileChange)
+	var unowned []models.FileChange
+	for _, change := range changes {
+		username, rest, _ := strings.Cut(strings.TrimPrefix(change.Path, "/"), "/")
+		if user, ok := byUsername[username]; ok && zone.UserHasZoneAccess(user) {
+			owners[user.ID] = append(owners[user.ID], models.FileChange{Path: "/" + rest, Op: change.Op})
+		} else {
+			unowned = append(unowned, change)
+		}
+	}
+	for userID, userChanges := range owners {
+		publishFileChangeBatch(zone.ID, []string{userID}, userChanges)
+	}
+	if len(unowned) > 0 {
+		publishFileChangeBatch(zone.ID, nil, unowned)
+	}
+}
+
+// publishFileChangeBatch sends one files.changed event, truncating long change lists. Clients
+// should reload the affected folders, or the whole zone when the list is truncated.
+func publishFileChangeBatch(zoneID string, userIDs []string, changes []models.FileChange) {
+	truncated := len(changes) > maxChangesPerEvent
+	if truncated {
+		changes = changes[:maxChangesPerEvent]
+	}
+	events.PublishToUsers(userIDs, events.TypeFilesChanged, map[string]interface{}{
+		"zone_id":   zoneID,
+		"changes":   changes,
+		"truncated": truncated,
+	})
+}
+
+// GetWatcherStatus returns the state of the zone file watcher (admin only)
+func GetWatcherStatus(watcher *ZoneWatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(watcher.GetStatus())
+	}
+}
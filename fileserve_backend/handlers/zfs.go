@@ -9,6 +9,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	"fileserv/internal/apierror"
 )
 
 // ZFSStatus represents overall ZFS status
@@ -90,39 +92,6 @@ type ZFSSnapshot struct {
 // Must start with alphanumeric
 var zfsDatasetNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.\-:/]*$`)
 
-// zfsAllowedProperties is a whitelist of safe ZFS properties that can be set
-var zfsAllowedProperties = map[string]bool{
-	// Common dataset properties
-	"compression":    true,
-	"atime":          true,
-	"relatime":       true,
-	"quota":          true,
-	"refquota":       true,
-	"reservation":    true,
-	"refreservation": true,
-	"recordsize":     true,
-	"mountpoint":     true,
-	"readonly":       true,
-	"sync":           true,
-	"dedup":          true,
-	"checksum":       true,
-	"copies":         true,
-	"primarycache":   true,
-	"secondarycache": true,
-	"logbias":        true,
-	"snapdir":        true,
-	"aclinherit":     true,
-	"acltype":        true,
-	"xattr":          true,
-	"dnodesize":      true,
-	"special_small_blocks": true,
-	"canmount":       true,
-	// Limit properties - exclude dangerous ones like 'exec', 'setuid', 'devices'
-}
-
-// zfsPropertyValueRegex validates property values - no shell metacharacters
-var zfsPropertyValueRegex = regexp.MustCompile(`^[a-zA-Z0-9_.\-/:=]+$`)
-
 // validateZFSDatasetName checks if a ZFS dataset/pool name is valid and safe
 func validateZFSDatasetName(name string) error {
 	if name == "" {
@@ -141,41 +110,6 @@ func validateZFSDatasetName(name string) error {
 	return nil
 }
 
-// validateZFSProperty checks if a property name is in the whitelist
-func validateZFSProperty(property string) error {
-	if property == "" {
-		return fmt.Errorf("property name cannot be empty")
-	}
-	if !zfsAllowedProperties[property] {
-		return fmt.Errorf("property '%s' is not allowed. Allowed properties: compression, quota, mountpoint, readonly, sync, atime, recordsize, etc.", property)
-	}
-	return nil
-}
-
-// validateZFSPropertyValue checks if a property value is safe
-func validateZFSPropertyValue(value string) error {
-	// Allow empty values (some properties can be unset)
-	if value == "" {
-		return nil
-	}
-	if len(value) > 1024 {
-		return fmt.Errorf("property value too long (max 1024 characters)")
-	}
-	// For mountpoints, allow full paths
-	if strings.HasPrefix(value, "/") {
-		// Validate as a path - no shell metacharacters
-		if strings.ContainsAny(value, ";|&$`\"'\\<>(){}[]!#*?") {
-			return fmt.Errorf("invalid property value: contains shell metacharacters")
-		}
-		return nil
-	}
-	// For other values, use strict regex
-	if !zfsPropertyValueRegex.MatchString(value) && value != "on" && value != "off" && value != "none" && value != "inherit" {
-		return fmt.Errorf("invalid property value: contains invalid characters")
-	}
-	return nil
-}
-
 // GetZFSStatus returns ZFS installation and status
 func GetZFSStatus() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -269,7 +203,7 @@ func LoadZFSModule() http.HandlerFunc {
 		cmd := exec.Command("sudo", "modprobe", "zfs")
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to load ZFS module: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to load ZFS module: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -325,13 +259,13 @@ func GetZFSPoolStatus() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		poolName := r.URL.Query().Get("pool")
 		if poolName == "" {
-			http.Error(w, "Pool name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Pool name required", nil)
 			return
 		}
 
 		output, err := exec.Command("zpool", "status", poolName).CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get pool status: %s", string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to get pool status: %s", string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -400,18 +334,18 @@ func CreateZFSPool() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Name == "" || len(req.Devices) == 0 {
-			http.Error(w, "Pool name and at least one device required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Pool name and at least one device required", nil)
 			return
 		}
 
 		// Validate pool name
 		if !regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`).MatchString(req.Name) {
-			http.Error(w, "Invalid pool name. Must start with letter and contain only alphanumeric, underscore, hyphen", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid pool name. Must start with letter and contain only alphanumeric, underscore, hyphen", nil)
 			return
 		}
 
@@ -441,7 +375,7 @@ func CreateZFSPool() http.HandlerFunc {
 		cmd := exec.Command("sudo", append([]string{"zpool"}, args...)...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create pool: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create pool: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -461,12 +395,12 @@ func DestroyZFSPool() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Name == "" {
-			http.Error(w, "Pool name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Pool name required", nil)
 			return
 		}
 
@@ -479,7 +413,7 @@ func DestroyZFSPool() http.HandlerFunc {
 		cmd := exec.Command("sudo", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to destroy pool: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to destroy pool: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -553,12 +487,12 @@ func CreateZFSDataset() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Name == "" {
-			http.Error(w, "Dataset name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Dataset name required", nil)
 			return
 		}
 
@@ -567,7 +501,7 @@ func CreateZFSDataset() http.HandlerFunc {
 		// For volumes
 		if req.Type == "volume" {
 			if req.VolumeSize == "" {
-				http.Error(w, "Volume size required for volume type", http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Volume size required for volume type", nil)
 				return
 			}
 			args = append(args, "-V", req.VolumeSize)
@@ -601,7 +535,7 @@ func CreateZFSDataset() http.HandlerFunc {
 		cmd := exec.Command("sudo", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create dataset: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create dataset: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -622,12 +556,12 @@ func DestroyZFSDataset() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Name == "" {
-			http.Error(w, "Dataset name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Dataset name required", nil)
 			return
 		}
 
@@ -643,7 +577,7 @@ func DestroyZFSDataset() http.HandlerFunc {
 		cmd := exec.Command("sudo", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to destroy dataset: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to destroy dataset: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -654,59 +588,6 @@ func DestroyZFSDataset() http.HandlerFunc {
 	}
 }
 
-// SetZFSProperty sets a property on a dataset
-func SetZFSProperty() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			Dataset  string `json:"dataset"`
-			Property string `json:"property"`
-			Value    string `json:"value"`
-		}
-
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-
-		if req.Dataset == "" || req.Property == "" {
-			http.Error(w, "Dataset and property required", http.StatusBadRequest)
-			return
-		}
-
-		// Validate dataset name to prevent command injection
-		if err := validateZFSDatasetName(req.Dataset); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		// Validate property against whitelist
-		if err := validateZFSProperty(req.Property); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		// Validate property value
-		if err := validateZFSPropertyValue(req.Value); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		// Use separate arguments to prevent injection (no string concatenation)
-		cmd := exec.Command("sudo", "zfs", "set", fmt.Sprintf("%s=%s", req.Property, req.Value), req.Dataset)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to set property: %s", err.Error()), http.StatusInternalServerError)
-			return
-		}
-		_ = output // Suppress unused variable warning
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": fmt.Sprintf("Property '%s' set to '%s' on '%s'", req.Property, req.Value, req.Dataset),
-		})
-	}
-}
-
 // ListZFSSnapshots lists snapshots
 func ListZFSSnapshots() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -717,7 +598,7 @@ func ListZFSSnapshots() http.HandlerFunc {
 		if datasetFilter != "" {
 			// Validate dataset filter to prevent command injection
 			if err := validateZFSDatasetName(datasetFilter); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 				return
 			}
 			args = append(args, "-r", datasetFilter)
@@ -763,12 +644,12 @@ func CreateZFSSnapshot() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Dataset == "" || req.Name == "" {
-			http.Error(w, "Dataset and snapshot name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Dataset and snapshot name required", nil)
 			return
 		}
 
@@ -782,7 +663,7 @@ func CreateZFSSnapshot() http.HandlerFunc {
 		cmd := exec.Command("sudo", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create snapshot: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to create snapshot: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -803,12 +684,12 @@ func DeleteZFSSnapshot() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Name == "" {
-			http.Error(w, "Snapshot name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Snapshot name required", nil)
 			return
 		}
 
@@ -821,7 +702,7 @@ func DeleteZFSSnapshot() http.HandlerFunc {
 		cmd := exec.Command("sudo", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to delete snapshot: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to delete snapshot: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -843,12 +724,12 @@ func RollbackZFSSnapshot() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Name == "" {
-			http.Error(w, "Snapshot name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Snapshot name required", nil)
 			return
 		}
 
@@ -866,7 +747,7 @@ func RollbackZFSSnapshot() http.HandlerFunc {
 		cmd := exec.Command("sudo", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to rollback: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to rollback: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -886,12 +767,12 @@ func ScrubZFSPool() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Pool == "" {
-			http.Error(w, "Pool name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Pool name required", nil)
 			return
 		}
 
@@ -908,7 +789,7 @@ func ScrubZFSPool() http.HandlerFunc {
 		cmd := exec.Command("sudo", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to %s scrub: %s - %s", req.Action, err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to %s scrub: %s - %s", req.Action, err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -936,7 +817,7 @@ func GetAvailableDisksForZFS() http.HandlerFunc {
 		// Use lsblk to get disk info
 		output, err := exec.Command("lsblk", "-J", "-b", "-o", "NAME,SIZE,MODEL,TYPE,MOUNTPOINT,FSTYPE").CombinedOutput()
 		if err != nil {
-			http.Error(w, "Failed to list disks", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to list disks", http.StatusInternalServerError)
 			return
 		}
 
@@ -952,7 +833,7 @@ func GetAvailableDisksForZFS() http.HandlerFunc {
 		}
 
 		if err := json.Unmarshal(output, &lsblkOutput); err != nil {
-			http.Error(w, "Failed to parse disk info", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to parse disk info", http.StatusInternalServerError)
 			return
 		}
 
@@ -1012,7 +893,7 @@ func ImportZFSPool() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
@@ -1030,7 +911,7 @@ func ImportZFSPool() http.HandlerFunc {
 		cmd := exec.Command("sudo", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to import pool: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to import pool: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -1050,12 +931,12 @@ func ExportZFSPool() http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
 			return
 		}
 
 		if req.Pool == "" {
-			http.Error(w, "Pool name required", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Pool name required", nil)
 			return
 		}
 
@@ -1068,7 +949,7 @@ func ExportZFSPool() http.HandlerFunc {
 		cmd := exec.Command("sudo", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to export pool: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			apierror.Error(w, fmt.Sprintf("Failed to export pool: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
 			return
 		}
 
@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"fileserv/internal/apierror"
+)
+
+// zfsDevicePathRegex validates a disk given to zpool. /dev/disk/by-id names may contain '.', ':' and '+'
+var zfsDevicePathRegex = regexp.MustCompile(`^/dev/[a-zA-Z0-9][a-zA-Z0-9/_.:+-]*$`)
+
+// zfsVDevNameRegex validates a device already in a pool as zpool status shows it:
+// a short name (sdb), a full path or the GUID of a missing device
+var zfsVDevNameRegex = regexp.MustCompile(`^[a-zA-Z0-9/][a-zA-Z0-9/_.:+-]*$`)
+
+// zfsVDevGroupPrefixes are the names zpool status uses for vdev groups and sections rather than disks
+var zfsVDevGroupPrefixes = []string{"mirror-", "raidz", "draid", "spare-", "replacing-", "logs", "cache", "spares", "special", "dedup"}
+
+// validateZFSPoolName checks if a pool name is valid and safe
+func validateZFSPoolName(name string) error {
+	if err := validateZFSDatasetName(name); err != nil {
+		return err
+	}
+	if strings.ContainsAny(name, "/:") {
+		return fmt.Errorf("invalid pool name: %s", name)
+	}
+	return nil
+}
+
+// normalizeZFSDevicePath turns a short device name into its /dev path and validates it
+func normalizeZFSDevicePath(device string) (string, error) {
+	if device == "" {
+		return "", fmt.Errorf("device path is required")
+	}
+	if !strings.HasPrefix(device, "/dev/") {
+		device = "/dev/" + device
+	}
+	if !zfsDevicePathRegex.MatchString(device) || strings.Contains(device, "..") {
+		return "", fmt.Errorf("invalid device path: %s", device)
+	}
+	return device, nil
+}
+
+// checkZFSDeviceAvailable makes sure a device can be given to a pool: it must be a disk or partition that is not
+// mounted, holds no filesystem, RAID or ZFS label and has no partitions in use, like the RAID device list requires
+func checkZFSDeviceAvailable(device string) error {
+	output, err := exec.Command("lsblk", "-J", "-b", "-o", "NAME,TYPE,MOUNTPOINT,FSTYPE", device).Output()
+	if err != nil {
+		return fmt.Errorf("device %s not found", device)
+	}
+
+	type blockDevice struct {
+		Name       string        `json:"name"`
+		Type       string        `json:"type"`
+		MountPoint string        `json:"mountpoint"`
+		FSType     string        `json:"fstype"`
+		Children   []blockDevice `json:"children"`
+	}
+	var lsblkOutput struct {
+		BlockDevices []blockDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(output, &lsblkOutput); err != nil || len(lsblkOutput.BlockDevices) != 1 {
+		return fmt.Errorf("failed to read device info for %s", device)
+	}
+
+	dev := lsblkOutput.BlockDevices[0]
+	if dev.Type != "disk" && dev.Type != "part" {
+		return fmt.Errorf("%s is not a disk or partition", device)
+	}
+	if dev.MountPoint != "" {
+		return fmt.Errorf("%s is mounted at %s", device, dev.MountPoint)
+	}
+	switch dev.FSType {
+	case "":
+	case "zfs_member":
+		return fmt.Errorf("%s already belongs to a ZFS pool", device)
+	case "linux_raid_member":
+		return fmt.Errorf("%s is a member of a RAID array", device)
+	default:
+		return fmt.Errorf("%s contains a %s filesystem", device, dev.FSType)
+	}
+	for _, child := range dev.Children {
+		if child.MountPoint != "" || child.FSType != "" {
+			return fmt.Errorf("%s has partition /dev/%s in use", device, child.Name)
+		}
+	}
+	return nil
+}
+
+// zfsPoolLeafDevices returns the disks of a pool, both under their short names and their full paths
+func zfsPoolLeafDevices(pool string) (map[string]bool, error) {
+	devices := make(map[string]bool)
+	for _, args := range [][]string{{"status", pool}, {"status", "-P", pool}} {
+		output, err := exec.Command("zpool", args...).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pool status: %s", strings.TrimSpace(string(output)))
+		}
+	configLoop:
+		for _, vdev := range parseZpoolStatus(string(output)).Config {
+			if vdev.Name == pool {
+				continue
+			}
+			for _, prefix := range zfsVDevGroupPrefixes {
+				if strings.HasPrefix(vdev.Name, prefix) {
+					continue configLoop
+				}
+			}
+			devices[vdev.Name] = true
+		}
+	}
+	return devices, nil
+}
+
+// validateZFSPoolDevice checks that device is a disk of pool
+func validateZFSPoolDevice(pool, device string) error {
+	if err := validateZFSPoolName(pool); err != nil {
+		return err
+	}
+	if device == "" {
+		return fmt.Errorf("device is required")
+	}
+	if !zfsVDevNameRegex.MatchString(device) || strings.Contains(device, "..") {
+		return fmt.Errorf("invalid device name: %s", device)
+	}
+
+	devices, err := zfsPoolLeafDevices(pool)
+	if err != nil {
+		return err
+	}
+	if !devices[device] {
+		return fmt.Errorf("device %s is not part of pool '%s'", device, pool)
+	}
+	return nil
+}
+
+// AttachZFSDevice attaches a new disk to an existing one, turning a single disk into a mirror
+// or adding another side to a mirror
+func AttachZFSDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Pool      string `json:"pool"`
+			Device    string `json:"device"`     // Disk already in the pool
+			NewDevice string `json:"new_device"` // Disk to mirror it onto
+			Force     bool   `json:"force"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateZFSPoolDevice(req.Pool, req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		newDevice, err := normalizeZFSDevicePath(req.NewDevice)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if err := checkZFSDeviceAvailable(newDevice); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		args := []string{"zpool", "attach"}
+		if req.Force {
+			args = append(args, "-f")
+		}
+		args = append(args, req.Pool, req.Device, newDevice)
+
+		cmd := exec.Command("sudo", args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to attach device: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Device %s attached to %s in pool '%s', resilver started", newDevice, req.Device, req.Pool),
+		})
+	}
+}
+
+// DetachZFSDevice removes a disk from a mirror
+func DetachZFSDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Pool   string `json:"pool"`
+			Device string `json:"device"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateZFSPoolDevice(req.Pool, req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		cmd := exec.Command("sudo", "zpool", "detach", req.Pool, req.Device)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to detach device: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Device %s detached from pool '%s'", req.Device, req.Pool),
+		})
+	}
+}
+
+// ReplaceZFSDevice replaces a failing disk with a new one. Without a new device the disk is
+// replaced in place, after it has been swapped for a new disk in the same slot.
+func ReplaceZFSDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Pool      string `json:"pool"`
+			Device    string `json:"device"`
+			NewDevice string `json:"new_device"`
+			Force     bool   `json:"force"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateZFSPoolDevice(req.Pool, req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		args := []string{"zpool", "replace"}
+		if req.Force {
+			args = append(args, "-f")
+		}
+		args = append(args, req.Pool, req.Device)
+
+		if req.NewDevice != "" {
+			newDevice, err := normalizeZFSDevicePath(req.NewDevice)
+			if err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			if err := checkZFSDeviceAvailable(newDevice); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			args = append(args, newDevice)
+		}
+
+		cmd := exec.Command("sudo", args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to replace device: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Replacing device %s in pool '%s', resilver started", req.Device, req.Pool),
+		})
+	}
+}
+
+// OfflineZFSDevice takes a disk offline, e.g. before pulling it from the system
+func OfflineZFSDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Pool      string `json:"pool"`
+			Device    string `json:"device"`
+			Temporary bool   `json:"temporary"` // Bring the disk back online on the next reboot
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateZFSPoolDevice(req.Pool, req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		args := []string{"zpool", "offline"}
+		if req.Temporary {
+			args = append(args, "-t")
+		}
+		args = append(args, req.Pool, req.Device)
+
+		cmd := exec.Command("sudo", args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to take device offline: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Device %s in pool '%s' is offline", req.Device, req.Pool),
+		})
+	}
+}
+
+// OnlineZFSDevice brings a disk back online
+func OnlineZFSDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Pool   string `json:"pool"`
+			Device string `json:"device"`
+			Expand bool   `json:"expand"` // Grow the vdev to use all space of a larger replacement disk
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateZFSPoolDevice(req.Pool, req.Device); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		args := []string{"zpool", "online"}
+		if req.Expand {
+			args = append(args, "-e")
+		}
+		args = append(args, req.Pool, req.Device)
+
+		cmd := exec.Command("sudo", args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to bring device online: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Device %s in pool '%s' is online", req.Device, req.Pool),
+		})
+	}
+}
+
+// AddZFSCacheOrLogDevice adds cache (L2ARC) or log (SLOG) devices to an existing pool
+func AddZFSCacheOrLogDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Pool    string   `json:"pool"`
+			Type    string   `json:"type"` // cache, log
+			Devices []string `json:"devices"`
+			Mirror  bool     `json:"mirror"` // Mirror the log devices
+			Force   bool     `json:"force"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateZFSPoolName(req.Pool); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if req.Type != "cache" && req.Type != "log" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Device type must be cache or log", nil)
+			return
+		}
+		if len(req.Devices) == 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "At least one device required", nil)
+			return
+		}
+		if req.Mirror {
+			if req.Type != "log" {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cache devices cannot be mirrored", nil)
+				return
+			}
+			if len(req.Devices) < 2 {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "A mirrored log requires at least 2 devices", nil)
+				return
+			}
+		}
+
+		seen := make(map[string]bool)
+		var devices []string
+		for _, d := range req.Devices {
+			device, err := normalizeZFSDevicePath(d)
+			if err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			if seen[device] {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Device %s listed more than once", device), nil)
+				return
+			}
+			seen[device] = true
+			if err := checkZFSDeviceAvailable(device); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			devices = append(devices, device)
+		}
+
+		args := []string{"zpool", "add"}
+		if req.Force {
+			args = append(args, "-f")
+		}
+		args = append(args, req.Pool, req.Type)
+		if req.Mirror {
+			args = append(args, "mirror")
+		}
+		args = append(args, devices...)
+
+		cmd := exec.Command("sudo", args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to add %s device: %s - %s", req.Type, err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Added %d %s device(s) to pool '%s'", len(devices), req.Type, req.Pool),
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+)
+
+// zfsDiffMaxEntries caps the number of changes returned for a single diff
+const zfsDiffMaxEntries = 10000
+
+// ZFSDiffEntry is a single change reported by zfs diff
+type ZFSDiffEntry struct {
+	Change   string    `json:"change"` // created, modified, deleted or renamed
+	Type     string    `json:"type"`   // file, directory, symlink, etc.
+	Path     string    `json:"path"`
+	NewPath  string    `json:"new_path,omitempty"` // Set for renames
+	Modified time.Time `json:"modified"`
+}
+
+// ZFSDiffResult is the list of changes between a snapshot and a later snapshot or the live dataset
+type ZFSDiffResult struct {
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Changes   []ZFSDiffEntry `json:"changes"`
+	Created   int            `json:"created"`
+	Modified  int            `json:"modified"`
+	Deleted   int            `json:"deleted"`
+	Renamed   int            `json:"renamed"`
+	Truncated bool           `json:"truncated"` // More than zfsDiffMaxEntries changes
+}
+
+var zfsDiffChanges = map[string]string{
+	"+": "created",
+	"M": "modified",
+	"-": "deleted",
+	"R": "renamed",
+}
+
+var zfsDiffTypes = map[string]string{
+	"F": "file",
+	"/": "directory",
+	"@": "symlink",
+	"B": "block_device",
+	"C": "char_device",
+	"|": "pipe",
+	"=": "socket",
+	">": "door",
+	"P": "event_port",
+}
+
+// unescapeZFSDiffPath decodes the \0ooo octal escapes zfs diff uses for whitespace and
+// non-printable characters in paths
+func unescapeZFSDiffPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+5 <= len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+5], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 4
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// parseZFSDiffLine parses a line of `zfs diff -H -F -t` output:
+// <timestamp> <change> <type> <path> [<new path>]
+func parseZFSDiffLine(line string) (ZFSDiffEntry, bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 4 {
+		return ZFSDiffEntry{}, false
+	}
+	change, ok := zfsDiffChanges[fields[1]]
+	if !ok {
+		return ZFSDiffEntry{}, false
+	}
+
+	entry := ZFSDiffEntry{
+		Change: change,
+		Type:   zfsDiffTypes[fields[2]],
+		Path:   unescapeZFSDiffPath(fields[3]),
+	}
+	if entry.Type == "" {
+		entry.Type = "other"
+	}
+	if len(fields) > 4 {
+		entry.NewPath = unescapeZFSDiffPath(fields[4])
+	}
+	if sec, nsec, found := strings.Cut(fields[0], "."); found {
+		s, _ := strconv.ParseInt(sec, 10, 64)
+		ns, _ := strconv.ParseInt((nsec + "000000000")[:9], 10, 64)
+		entry.Modified = time.Unix(s, ns)
+	}
+	return entry, true
+}
+
+// DiffZFSSnapshots lists the paths created, modified, deleted or renamed between a snapshot
+// and a later snapshot of the same dataset, or the dataset's current state when to is empty
+func DiffZFSSnapshots() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from := r.URL.Query().Get("from")
+		to := r.URL.Query().Get("to")
+
+		dataset, snapshot, found := strings.Cut(from, "@")
+		if !found {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "from must be a snapshot (dataset@snapshot)", nil)
+			return
+		}
+		if err := validateZFSDatasetName(dataset); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if !zfsSnapshotNameRegex.MatchString(snapshot) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid snapshot name", nil)
+			return
+		}
+
+		// to is a later snapshot of the same dataset, or the dataset itself for the live state
+		if to == "" {
+			to = dataset
+		}
+		toDataset, toSnapshot, toIsSnapshot := strings.Cut(to, "@")
+		if toDataset != dataset {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "from and to must belong to the same dataset", nil)
+			return
+		}
+		if toIsSnapshot && (!zfsSnapshotNameRegex.MatchString(toSnapshot) || toSnapshot == snapshot) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "to must be a different snapshot of the same dataset", nil)
+			return
+		}
+
+		cmd := exec.Command("sudo", "zfs", "diff", "-H", "-F", "-t", from, to)
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			apierror.Error(w, "Failed to diff snapshots: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		if err := cmd.Start(); err != nil {
+			apierror.Error(w, "Failed to diff snapshots: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result := ZFSDiffResult{From: from, To: to, Changes: []ZFSDiffEntry{}}
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			entry, ok := parseZFSDiffLine(scanner.Text())
+			if !ok {
+				continue
+			}
+			switch entry.Change {
+			case "created":
+				result.Created++
+			case "modified":
+				result.Modified++
+			case "deleted":
+				result.Deleted++
+			case "renamed":
+				result.Renamed++
+			}
+			if len(result.Changes) < zfsDiffMaxEntries {
+				result.Changes = append(result.Changes, entry)
+			} else {
+				result.Truncated = true
+			}
+		}
+
+		if err := cmd.Wait(); err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to diff snapshots: %s - %s", err.Error(), stderr.String()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+)
+
+// ZFSProperty is an editable dataset property and where its value comes from
+type ZFSProperty struct {
+	Property      string   `json:"property"`
+	Value         string   `json:"value"`
+	Source        string   `json:"source"`                   // local, inherited, default or received
+	InheritedFrom string   `json:"inherited_from,omitempty"` // Dataset the value is inherited from
+	Values        []string `json:"values,omitempty"`         // Allowed values, empty for sizes
+}
+
+// zfsPropertySpec describes how a property is validated
+type zfsPropertySpec struct {
+	values    []string                 // Allowed values; nil when validate is used
+	validate  func(value string) error // Validates free-form values such as sizes
+	dangerous map[string]string        // Values that need force, with the reason
+}
+
+// zfsPropertyQuotaRegex validates a quota such as "500G" or "1.5T"
+var zfsPropertyQuotaRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[KMGTP]?$`)
+
+// zfsPropertyNames lists the editable properties in display order
+var zfsPropertyNames = []string{"compression", "atime", "recordsize", "quota", "refquota", "sync", "dedup"}
+
+var zfsPropertySpecs = map[string]zfsPropertySpec{
+	"compression": {
+		values: []string{"on", "off", "lz4", "zstd", "zstd-fast", "gzip", "lzjb", "zle",
+			"gzip-1", "gzip-2", "gzip-3", "gzip-4", "gzip-5", "gzip-6", "gzip-7", "gzip-8", "gzip-9",
+			"zstd-1", "zstd-2", "zstd-3", "zstd-4", "zstd-5", "zstd-6", "zstd-7", "zstd-8", "zstd-9",
+			"zstd-10", "zstd-11", "zstd-12", "zstd-13", "zstd-14", "zstd-15", "zstd-16", "zstd-17", "zstd-18", "zstd-19"},
+	},
+	"atime": {
+		values: []string{"on", "off"},
+	},
+	"recordsize": {
+		values: []string{"512", "1K", "2K", "4K", "8K", "16K", "32K", "64K", "128K", "256K", "512K", "1M"},
+	},
+	"quota": {
+		validate: validateZFSQuota,
+	},
+	"refquota": {
+		validate: validateZFSQuota,
+	},
+	"sync": {
+		values: []string{"standard", "always", "disabled"},
+		dangerous: map[string]string{
+			"disabled": "sync=disabled acknowledges synchronous writes before they reach disk; a crash or power loss loses them",
+		},
+	},
+	"dedup": {
+		values: []string{"off", "on", "verify", "sha256", "sha512", "skein"},
+		dangerous: map[string]string{
+			"on":     "deduplication keeps a table for every block in RAM and cannot be undone for data already written",
+			"verify": "deduplication keeps a table for every block in RAM and cannot be undone for data already written",
+			"sha256": "deduplication keeps a table for every block in RAM and cannot be undone for data already written",
+			"sha512": "deduplication keeps a table for every block in RAM and cannot be undone for data already written",
+			"skein":  "deduplication keeps a table for every block in RAM and cannot be undone for data already written",
+		},
+	},
+}
+
+// validateZFSQuota accepts "none" or a size with an optional unit
+func validateZFSQuota(value string) error {
+	if value == "none" || zfsPropertyQuotaRegex.MatchString(strings.ToUpper(value)) {
+		return nil
+	}
+	return fmt.Errorf("invalid quota: use 'none' or a size such as 500G")
+}
+
+// validateZFSPropertySetting checks a property and value against the whitelist. A value of
+// "inherit" clears the local setting. The returned warning is non-empty for dangerous values.
+func validateZFSPropertySetting(property, value string) (normalized string, warning string, err error) {
+	spec, ok := zfsPropertySpecs[property]
+	if !ok {
+		return "", "", fmt.Errorf("property '%s' is not editable. Editable properties: %s", property, strings.Join(zfsPropertyNames, ", "))
+	}
+	if value == "inherit" {
+		return value, "", nil
+	}
+
+	if spec.validate != nil {
+		if err := spec.validate(value); err != nil {
+			return "", "", err
+		}
+		if value != "none" {
+			value = strings.ToUpper(value)
+		}
+		return value, "", nil
+	}
+
+	for _, allowed := range spec.values {
+		if strings.EqualFold(value, allowed) {
+			return allowed, spec.dangerous[allowed], nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid value for %s: must be one of %s", property, strings.Join(spec.values, ", "))
+}
+
+// getZFSProperties returns the editable properties of a dataset. Properties that do not apply
+// to the dataset type (e.g., recordsize on a volume) are left out.
+func getZFSProperties(dataset string, names []string) ([]ZFSProperty, error) {
+	output, err := exec.Command("zfs", "get", "-H", "-o", "property,value,source", strings.Join(names, ","), dataset).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s", commandError(output, err))
+	}
+
+	properties := []ZFSProperty{}
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 3 || fields[2] == "-" {
+			continue
+		}
+		property := ZFSProperty{
+			Property: fields[0],
+			Value:    fields[1],
+			Source:   fields[2],
+			Values:   zfsPropertySpecs[fields[0]].values,
+		}
+		if from, ok := strings.CutPrefix(fields[2], "inherited from "); ok {
+			property.Source = "inherited"
+			property.InheritedFrom = from
+		}
+		properties = append(properties, property)
+	}
+	return properties, nil
+}
+
+// GetZFSProperties returns the editable properties of a dataset with their source
+func GetZFSProperties() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dataset := r.URL.Query().Get("dataset")
+		if err := validateZFSDatasetName(dataset); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		properties, err := getZFSProperties(dataset, zfsPropertyNames)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeDatasetNotFound, fmt.Sprintf("Failed to get properties: %s", err.Error()), nil)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(properties)
+	}
+}
+
+// SetZFSProperty sets or inherits an editable property of a dataset
+func SetZFSProperty() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Dataset  string `json:"dataset"`
+			Property string `json:"property"`
+			Value    string `json:"value"` // "inherit" clears the local setting
+			Force    bool   `json:"force"` // Confirms a dangerous value
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if req.Dataset == "" || req.Property == "" || req.Value == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Dataset, property and value required", nil)
+			return
+		}
+
+		// Validate dataset name to prevent command injection
+		if err := validateZFSDatasetName(req.Dataset); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		value, warning, err := validateZFSPropertySetting(req.Property, req.Value)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if warning != "" && !req.Force {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, fmt.Sprintf("%s. Set force to apply it anyway", warning), nil)
+			return
+		}
+
+		// A quota below what the dataset already holds blocks all further writes
+		if (req.Property == "quota" || req.Property == "refquota") && value != "none" && value != "inherit" {
+			usedProperty := "used"
+			if req.Property == "refquota" {
+				usedProperty = "referenced"
+			}
+			quota, err := parseSize(value)
+			if err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			output, err := exec.Command("zfs", "get", "-H", "-p", "-o", "value", usedProperty, req.Dataset).CombinedOutput()
+			if err != nil {
+				apierror.Write(w, http.StatusNotFound, apierror.CodeDatasetNotFound, fmt.Sprintf("Dataset '%s' not found: %s", req.Dataset, commandError(output, err)), nil)
+				return
+			}
+			used, _ := strconv.ParseUint(strings.TrimSpace(string(output)), 10, 64)
+			if quota < used {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("%s of %s is below the %s already in use", req.Property, value, formatBytes(used)), nil)
+				return
+			}
+		}
+
+		var cmd *exec.Cmd
+		if value == "inherit" {
+			cmd = exec.Command("sudo", "zfs", "inherit", req.Property, req.Dataset)
+		} else {
+			// Use separate arguments to prevent injection (no string concatenation)
+			cmd = exec.Command("sudo", "zfs", "set", req.Property+"="+value, req.Dataset)
+		}
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to set property: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		message := fmt.Sprintf("Property '%s' set to '%s' on '%s'", req.Property, value, req.Dataset)
+		if value == "inherit" {
+			message = fmt.Sprintf("Property '%s' on '%s' now inherits its value", req.Property, req.Dataset)
+		}
+		response := map[string]interface{}{"message": message}
+		if properties, err := getZFSProperties(req.Dataset, []string{req.Property}); err == nil && len(properties) > 0 {
+			response["property"] = properties[0]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+)
+
+// zfsVDevMinDevices is the smallest number of disks accepted for each redundant vdev type
+var zfsVDevMinDevices = map[string]int{
+	"mirror": 2,
+	"raidz1": 3,
+	"raidz2": 4,
+	"raidz3": 5,
+}
+
+// zfsVDevSizeTolerance is how much (percent) the disks of a new vdev may differ in size before a warning is given
+const zfsVDevSizeTolerance = 5
+
+// zpoolVDev is a top-level data vdev of a pool
+type zpoolVDev struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`  // disk, mirror, raidz1, raidz2, raidz3, draid
+	Width int    `json:"width"` // Number of disks
+}
+
+// VDevPlan describes what adding a vdev to a pool will do
+type VDevPlan struct {
+	Pool          string      `json:"pool"`
+	VDevType      string      `json:"vdev_type"` // disk, mirror, raidz1, raidz2, raidz3
+	Devices       []string    `json:"devices"`
+	DeviceSizes   []uint64    `json:"device_sizes"`
+	ExistingVDevs []zpoolVDev `json:"existing_vdevs"`
+	CurrentSize   uint64      `json:"current_size"` // Pool size as zpool list reports it
+	CurrentFree   uint64      `json:"current_free"`
+	AddedSize     uint64      `json:"added_size"`     // Raw space the vdev adds, counted like zpool list does
+	AddedUsable   uint64      `json:"added_usable"`   // Space the vdev adds for data after mirroring or parity
+	ProjectedSize uint64      `json:"projected_size"` // Pool size after the vdev is added
+	ProjectedFree uint64      `json:"projected_free"`
+	Warnings      []string    `json:"warnings"`
+	Layout        string      `json:"layout,omitempty"` // Pool layout as printed by zpool add -n
+	Applied       bool        `json:"applied"`
+}
+
+// normalizeVDevType maps the vdev types accepted by zpool to the names used in zpool status
+func normalizeVDevType(vdevType string) (string, error) {
+	switch strings.ToLower(vdevType) {
+	case "", "disk", "stripe":
+		return "disk", nil
+	case "mirror":
+		return "mirror", nil
+	case "raidz", "raidz1":
+		return "raidz1", nil
+	case "raidz2":
+		return "raidz2", nil
+	case "raidz3":
+		return "raidz3", nil
+	}
+	return "", fmt.Errorf("invalid vdev type. Must be: disk, mirror, raidz1, raidz2, or raidz3")
+}
+
+// vdevParity returns how many disks of a vdev can fail without losing data
+func vdevParity(vdevType string, width int) int {
+	switch vdevType {
+	case "mirror":
+		return width - 1
+	case "raidz1":
+		return 1
+	case "raidz2":
+		return 2
+	case "raidz3":
+		return 3
+	}
+	return 0
+}
+
+// zpoolDataVDevs returns the top-level data vdevs of a pool; log, cache, spare and special
+// vdevs are left out
+func zpoolDataVDevs(pool string) ([]zpoolVDev, error) {
+	output, err := exec.Command("zpool", "status", pool).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pool status: %s", commandError(output, err))
+	}
+
+	var vdevs []zpoolVDev
+	inConfig := false
+	poolIndent := -1
+	inData := true
+	for _, line := range strings.Split(string(output), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "config:") {
+			inConfig = true
+			continue
+		}
+		if !inConfig || trimmed == "" || strings.HasPrefix(trimmed, "NAME") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "errors:") {
+			break
+		}
+
+		indent := len(strings.Replace(line, "\t", "        ", -1)) - len(strings.TrimLeft(line, " \t"))
+		name := strings.Fields(trimmed)[0]
+		if poolIndent < 0 {
+			if name == pool {
+				poolIndent = indent
+			}
+			continue
+		}
+
+		switch {
+		case indent <= poolIndent:
+			// Section header: logs, cache, spares, special, dedup
+			inData = false
+		case !inData:
+		case indent == poolIndent+2:
+			vdev := zpoolVDev{Name: name, Type: "disk", Width: 1}
+			if i := strings.LastIndex(name, "-"); i > 0 {
+				switch prefix := name[:i]; {
+				case prefix == "mirror":
+					vdev.Type, vdev.Width = "mirror", 0
+				case prefix == "raidz" || prefix == "raidz1":
+					vdev.Type, vdev.Width = "raidz1", 0
+				case prefix == "raidz2" || prefix == "raidz3":
+					vdev.Type, vdev.Width = prefix, 0
+				case strings.HasPrefix(prefix, "draid"):
+					vdev.Type, vdev.Width = "draid", 0
+				}
+			}
+			vdevs = append(vdevs, vdev)
+		case len(vdevs) > 0 && vdevs[len(vdevs)-1].Type != "disk":
+			// Disks of the vdev; replacing/spare groups inside it are not counted separately
+			if indent == poolIndent+4 {
+				vdevs[len(vdevs)-1].Width++
+			}
+		}
+	}
+
+	if poolIndent < 0 {
+		return nil, fmt.Errorf("pool '%s' not found in status output", pool)
+	}
+	return vdevs, nil
+}
+
+// blockDeviceSize returns the size of a block device in bytes
+func blockDeviceSize(device string) (uint64, error) {
+	output, err := exec.Command("lsblk", "-b", "-n", "-d", "-o", "SIZE", device).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size of %s", device)
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(output)), 10, 64)
+}
+
+// planVDevAdd checks a new vdev against the pool and works out the capacity it adds
+func planVDevAdd(plan *VDevPlan) error {
+	output, err := exec.Command("zpool", "list", "-H", "-p", "-o", "size,free", plan.Pool).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pool '%s' not found: %s", plan.Pool, commandError(output, err))
+	}
+	if fields := strings.Fields(string(output)); len(fields) >= 2 {
+		plan.CurrentSize, _ = strconv.ParseUint(fields[0], 10, 64)
+		plan.CurrentFree, _ = strconv.ParseUint(fields[1], 10, 64)
+	}
+
+	plan.ExistingVDevs, err = zpoolDataVDevs(plan.Pool)
+	if err != nil {
+		return err
+	}
+
+	var smallest, largest, total uint64
+	for _, device := range plan.Devices {
+		size, err := blockDeviceSize(device)
+		if err != nil {
+			return err
+		}
+		plan.DeviceSizes = append(plan.DeviceSizes, size)
+		total += size
+		if smallest == 0 || size < smallest {
+			smallest = size
+		}
+		if size > largest {
+			largest = size
+		}
+	}
+
+	// zpool list counts mirrors once but raidz including parity
+	n := uint64(len(plan.Devices))
+	switch plan.VDevType {
+	case "disk":
+		plan.AddedSize = total
+		plan.AddedUsable = total
+	case "mirror":
+		plan.AddedSize = smallest
+		plan.AddedUsable = smallest
+	default:
+		parity := uint64(vdevParity(plan.VDevType, len(plan.Devices)))
+		plan.AddedSize = smallest * n
+		plan.AddedUsable = smallest * (n - parity)
+	}
+	plan.ProjectedSize = plan.CurrentSize + plan.AddedSize
+	plan.ProjectedFree = plan.CurrentFree + plan.AddedSize
+
+	if plan.VDevType != "disk" && largest > 0 && (largest-smallest)*100/largest > zfsVDevSizeTolerance {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+			"Disks differ in size (%s to %s); only %s of each disk will be used",
+			formatBytes(smallest), formatBytes(largest), formatBytes(smallest)))
+	}
+
+	newParity := vdevParity(plan.VDevType, len(plan.Devices))
+	for _, vdev := range plan.ExistingVDevs {
+		if vdev.Type != plan.VDevType {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+				"Replication level does not match: pool has %s vdev %s, new vdev is %s", vdev.Type, vdev.Name, plan.VDevType))
+			break
+		}
+	}
+	for _, vdev := range plan.ExistingVDevs {
+		if vdev.Type == plan.VDevType && plan.VDevType != "disk" && vdev.Width != len(plan.Devices) {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+				"Vdev width does not match: %s has %d disks, new vdev has %d", vdev.Name, vdev.Width, len(plan.Devices)))
+			break
+		}
+	}
+	for _, vdev := range plan.ExistingVDevs {
+		if vdevParity(vdev.Type, vdev.Width) > newParity {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+				"New vdev tolerates %d disk failure(s) but %s tolerates %d; losing the new vdev loses the whole pool",
+				newParity, vdev.Name, vdevParity(vdev.Type, vdev.Width)))
+			break
+		}
+	}
+	return nil
+}
+
+// AddZFSVDev adds a new data vdev to an existing pool to grow it. With dry_run the plan is
+// validated with zpool add -n and returned without changing the pool. A vdev that raises
+// warnings (mismatched redundancy or disk sizes) is only added with force.
+func AddZFSVDev() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Pool     string   `json:"pool"`
+			VDevType string   `json:"vdev_type"` // disk, mirror, raidz1, raidz2, raidz3
+			Devices  []string `json:"devices"`
+			DryRun   bool     `json:"dry_run"`
+			Force    bool     `json:"force"` // Add the vdev despite warnings
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateZFSPoolName(req.Pool); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		vdevType, err := normalizeVDevType(req.VDevType)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if len(req.Devices) == 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "At least one device required", nil)
+			return
+		}
+		if min, ok := zfsVDevMinDevices[vdevType]; ok && len(req.Devices) < min {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("A %s vdev requires at least %d devices", vdevType, min), nil)
+			return
+		}
+
+		plan := &VDevPlan{
+			Pool:     req.Pool,
+			VDevType: vdevType,
+			Warnings: []string{},
+		}
+		seen := make(map[string]bool)
+		for _, d := range req.Devices {
+			device, err := normalizeZFSDevicePath(d)
+			if err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			if seen[device] {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Device %s listed more than once", device), nil)
+				return
+			}
+			seen[device] = true
+			if err := checkZFSDeviceAvailable(device); err != nil {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+				return
+			}
+			plan.Devices = append(plan.Devices, device)
+		}
+
+		if err := planVDevAdd(plan); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		vdevArgs := []string{req.Pool}
+		if vdevType != "disk" {
+			vdevArgs = append(vdevArgs, vdevType)
+		}
+		vdevArgs = append(vdevArgs, plan.Devices...)
+
+		// zpool refuses a mismatched replication level without -f; the plan already warns about it
+		output, err := exec.Command("sudo", append([]string{"zpool", "add", "-n", "-f"}, vdevArgs...)...).CombinedOutput()
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Pool '%s' cannot use these devices: %s", req.Pool, commandError(output, err)), nil)
+			return
+		}
+		plan.Layout = strings.TrimSpace(string(output))
+
+		if !req.DryRun {
+			if len(plan.Warnings) > 0 && !req.Force {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(plan)
+				return
+			}
+
+			args := []string{"zpool", "add"}
+			if req.Force {
+				args = append(args, "-f")
+			}
+			args = append(args, vdevArgs...)
+			output, err := exec.Command("sudo", args...).CombinedOutput()
+			if err != nil {
+				apierror.Error(w, fmt.Sprintf("Failed to add vdev: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+				return
+			}
+			plan.Applied = true
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(plan)
+	}
+}
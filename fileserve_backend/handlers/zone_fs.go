@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	osuser "os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/fileops"
+	"fileserv/internal/vfs"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// zoneFS presents the zones a user can access as top-level folders to the file transfer
+// protocols. Access checks, read-only zones, upload restrictions, trash and versioning
+// behave exactly like the web API.
+type zoneFS struct {
+	store   storage.DataStore
+	files   *ZoneFileHandler
+	userCtx *middleware.UserContext
+	user    *models.User
+}
+
+// newZoneFS creates the file system for an authenticated user
+func newZoneFS(store storage.DataStore, userCtx *middleware.UserContext) *zoneFS {
+	return &zoneFS{
+		store:   store,
+		files:   NewZoneFileHandler(store),
+		userCtx: userCtx,
+		user:    userFromContext(userCtx),
+	}
+}
+
+// zoneEntry is a resolved path inside a zone
+type zoneEntry struct {
+	zone     *models.ShareZone
+	pool     *models.StoragePool
+	fullPath string
+	rel      string // Path within the zone, "/" for the zone's top-level folder
+}
+
+// zoneDirName returns the top-level folder name of a zone
+func zoneDirName(zone *models.ShareZone) string {
+	return strings.ReplaceAll(zone.Name, "/", "_")
+}
+
+// zones returns the user's zones by folder name. Zones on object storage pools are not exposed.
+func (z *zoneFS) zones() map[string]*models.ShareZone {
+	pools := make(map[string]*models.StoragePool)
+	for _, pool := range z.store.ListStoragePools() {
+		pools[pool.ID] = pool
+	}
+
+	zones := make(map[string]*models.ShareZone)
+	for _, zone := range z.store.ListShareZones() {
+		pool, ok := pools[zone.PoolID]
+		if !ok || !pool.Enabled || pool.IsS3() || !zone.UserHasZoneAccess(z.user) {
+			continue
+		}
+		zones[zoneDirName(zone)] = zone
+	}
+	return zones
+}
+
+// resolve maps a virtual path to a zone path. It returns nil for the root folder.
+func (z *zoneFS) resolve(p string) (*zoneEntry, error) {
+	clean := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if clean == "" {
+		return nil, nil
+	}
+
+	name, rel, _ := strings.Cut(clean, "/")
+	zone, ok := z.zones()[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	// Personal directories must exist before paths below them can be resolved
+	if zone.AutoProvision && zone.ZoneType == models.ZoneTypePersonal {
+		if pool, err := z.store.GetStoragePool(zone.PoolID); err == nil {
+			provisionUserDir(filepath.Join(pool.Path, zone.Path, z.user.Username), z.user.Username)
+		}
+	}
+
+	fullPath, zone, pool, err := z.files.resolveZonePathWithPool(zone.ID, rel, z.user)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, os.ErrPermission
+		}
+		return nil, fmt.Errorf("%v: %w", err, os.ErrNotExist)
+	}
+
+	return &zoneEntry{zone: zone, pool: pool, fullPath: fullPath, rel: "/" + rel}, nil
+}
+
+// resolveWritable resolves a path that is about to be created, changed or removed
+func (z *zoneFS) resolveWritable(p string) (*zoneEntry, error) {
+	entry, err := z.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	// The root and the zone folders themselves are fixed
+	if entry == nil || entry.rel == "/" || entry.zone.ReadOnly {
+		return nil, os.ErrPermission
+	}
+	if name := path.Base(entry.rel); fileops.SanitizeFilename(name) != name {
+		return nil, fmt.Errorf("invalid filename %q", name)
+	}
+	return entry, nil
+}
+
+// checkLock refuses changes to paths locked by other users, through the web API or WebDAV
+func (z *zoneFS) checkLock(fullPath string, recursive bool) error {
+	if err := checkFileLock(z.store, fullPath, z.userCtx.UserID, recursive); err != nil {
+		return fmt.Errorf("%v: %w", err, os.ErrPermission)
+	}
+	return nil
+}
+
+func (z *zoneFS) Stat(p string) (os.FileInfo, error) {
+	entry, err := z.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return &vfs.FileInfo{FileName: "/", FileMode: os.ModeDir | 0755, FileModTime: time.Now()}, nil
+	}
+	return os.Stat(entry.fullPath)
+}
+
+func (z *zoneFS) ReadDir(p string) ([]os.FileInfo, error) {
+	entry, err := z.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		var infos []os.FileInfo
+		for name, zone := range z.zones() {
+			info := &vfs.FileInfo{FileName: name, FileMode: os.ModeDir | 0755, FileModTime: zone.UpdatedAt}
+			if zone.ReadOnly {
+				info.FileMode = os.ModeDir | 0555
+			}
+			infos = append(infos, info)
+		}
+		return infos, nil
+	}
+
+	dirEntries, err := os.ReadDir(entry.fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	zoneRoot := filepath.Join(entry.pool.Path, entry.zone.Path)
+	infos := make([]os.FileInfo, 0, len(dirEntries))
+	for _, d := range dirEntries {
+		if entry.fullPath == zoneRoot && d.IsDir() && isReservedZoneDir(d.Name()) {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (z *zoneFS) OpenFile(p string, flag int) (vfs.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		entry, err := z.resolve(p)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return nil, errors.New("is a directory")
+		}
+		return os.Open(entry.fullPath)
+	}
+
+	entry, err := z.resolveWritable(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := z.checkLock(entry.fullPath, false); err != nil {
+		return nil, err
+	}
+
+	opts := &fileops.TransferOptions{
+		AllowedTypes: entry.pool.AllowedTypes,
+		DeniedTypes:  entry.pool.DeniedTypes,
+	}
+	if err := fileops.ValidateUpload(path.Base(entry.rel), 0, opts); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, os.ErrPermission)
+	}
+
+	// Transfer caps, upload limit and quota apply like in the web API. Appends and resumed
+	// uploads start from the current size; the rest is checked as the file grows.
+	var size int64
+	if info, err := os.Stat(entry.fullPath); err == nil && flag&os.O_TRUNC == 0 {
+		size = info.Size()
+	}
+	upload, err := beginZoneUpload(z.store, entry.zone, entry.pool, entry.fullPath, z.userCtx, size)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, os.ErrPermission)
+	}
+
+	// Keep the previous content as a version if the file is being replaced
+	var version *models.FileVersion
+	if flag&os.O_TRUNC != 0 {
+		version, err = saveFileVersion(z.store, entry.fullPath, z.userCtx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(entry.fullPath, flag, 0644)
+	if err != nil {
+		undoFileVersion(z.store, version, entry.fullPath)
+		return nil, err
+	}
+	return &zoneFile{File: f, fs: z, upload: upload, version: version}, nil
+}
+
+func (z *zoneFS) Mkdir(p string) error {
+	entry, err := z.resolveWritable(p)
+	if err != nil {
+		return err
+	}
+	if err := z.checkLock(entry.fullPath, false); err != nil {
+		return err
+	}
+	if err := os.Mkdir(entry.fullPath, 0755); err != nil {
+		return err
+	}
+	chownToUser(entry.fullPath, z.user.Username)
+	indexPath(z.store, entry.fullPath)
+	return nil
+}
+
+func (z *zoneFS) Remove(p string) error {
+	entry, err := z.resolveWritable(p)
+	if err != nil {
+		return err
+	}
+	if err := z.checkLock(entry.fullPath, true); err != nil {
+		return err
+	}
+	if _, err := moveToTrash(z.store, entry.zone, entry.pool, entry.fullPath, z.userCtx); err != nil {
+		return err
+	}
+	unindexPath(z.store, entry.fullPath)
+	return nil
+}
+
+func (z *zoneFS) Rename(oldPath, newPath string) error {
+	from, err := z.resolveWritable(oldPath)
+	if err != nil {
+		return err
+	}
+	to, err := z.resolveWritable(newPath)
+	if err != nil {
+		return err
+	}
+	if from.zone.ID != to.zone.ID {
+		return errors.New("cannot move between zones")
+	}
+	if _, err := os.Lstat(to.fullPath); err == nil {
+		return os.ErrExist
+	}
+	if err := z.checkLock(from.fullPath, true); err != nil {
+		return err
+	}
+	if err := z.checkLock(to.fullPath, false); err != nil {
+		return err
+	}
+	if err := os.Rename(from.fullPath, to.fullPath); err != nil {
+		return err
+	}
+	moveFileRecords(z.store, from.fullPath, to.fullPath)
+	unindexPath(z.store, from.fullPath)
+	indexPath(z.store, to.fullPath)
+	return nil
+}
+
+// zoneFile is a file opened for writing through a zoneFS
+type zoneFile struct {
+	*os.File
+	fs      *zoneFS
+	upload  *zoneUpload
+	version *models.FileVersion
+	written int64
+}
+
+// WriteAt enforces the upload limit and the user's quota
+func (f *zoneFile) WriteAt(b []byte, off int64) (int, error) {
+	if err := f.upload.checkSize(off + int64(len(b))); err != nil {
+		return 0, err
+	}
+	n, err := f.File.WriteAt(b, off)
+	f.written += int64(n)
+	return n, err
+}
+
+// Close finishes the upload like the web API does: ownership, virus scan, search index, quota,
+// transfer accounting and event
+func (f *zoneFile) Close() error {
+	info, statErr := f.File.Stat()
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	meterTransfer(models.StatBytesUploaded, f.written, transferObjects(f.upload.userID, f.upload.zone.ID, ""))
+	if statErr != nil {
+		return statErr
+	}
+
+	chownToUser(f.upload.fullPath, f.fs.user.Username)
+	if err := f.upload.finish(info.Size()); err != nil {
+		undoFileVersion(f.fs.store, f.version, f.upload.fullPath)
+		return err
+	}
+	return nil
+}
+
+// chownToUser gives a system user ownership of a file or folder they created
+func chownToUser(p, username string) {
+	if username == "" {
+		return
+	}
+	if u, err := osuser.Lookup(username); err == nil {
+		uid, _ := strconv.Atoi(u.Uid)
+		gid, _ := strconv.Atoi(u.Gid)
+		os.Chown(p, uid, gid)
+	}
+}
+
+// provisionUserDir creates a personal zone directory owned by its user
+func provisionUserDir(p, username string) error {
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(p, 0755); err != nil {
+		return err
+	}
+	chownToUser(p, username)
+	return nil
+}
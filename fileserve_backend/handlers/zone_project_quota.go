@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// XFS project IDs handed out to zones start here, well above IDs usually kept in /etc/projid
+const xfsProjectIDBase = 10000
+
+// findProjectQuotaTarget checks that the filesystem holding a zone can cap the zone's directory
+// tree: on ZFS the zone must be its own dataset, on XFS project quotas must be turned on
+func findProjectQuotaTarget(mounts []models.MountPoint, root string) (method, target string, err error) {
+	mount := mountForPath(mounts, root)
+	if mount == nil {
+		return "", "", fmt.Errorf("no filesystem found for %s", root)
+	}
+
+	switch mount.FSType {
+	case "zfs":
+		if filepath.Clean(mount.MountPath) != filepath.Clean(root) {
+			return "", "", fmt.Errorf("%s is not the mountpoint of its own ZFS dataset", root)
+		}
+		return models.ProjectQuotaZFS, mount.Device, nil
+	case "xfs":
+		if err := checkXFSQuotaPath(root); err != nil {
+			return "", "", err
+		}
+		for _, opt := range strings.Split(mount.Options, ",") {
+			if opt == "prjquota" || opt == "pquota" || opt == "pqnoenforce" {
+				return models.ProjectQuotaXFS, mount.MountPath, nil
+			}
+		}
+		return "", "", fmt.Errorf("project quotas are not enabled on %s (mount with prjquota)", mount.MountPath)
+	}
+	return "", "", fmt.Errorf("%s filesystems do not support zone quotas, use ZFS or XFS", mount.FSType)
+}
+
+// nextXFSProjectID returns a project ID not used by another zone or listed in /etc/projid
+func nextXFSProjectID(store storage.DataStore) int {
+	used := make(map[int]bool)
+	for _, q := range store.ListZoneProjectQuotas() {
+		used[q.ProjectID] = true
+	}
+	if f, err := os.Open("/etc/projid"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			parts := strings.Split(scanner.Text(), ":")
+			if len(parts) == 2 {
+				if id, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil {
+					used[id] = true
+				}
+			}
+		}
+		f.Close()
+	}
+
+	id := xfsProjectIDBase
+	for used[id] {
+		id++
+	}
+	return id
+}
+
+// checkXFSQuotaPath refuses directories that cannot be passed to an xfs_quota command. The
+// command is a single argument that xfs_quota splits on whitespace, and not every version
+// understands quotes, so paths with blanks, quotes, backslashes or control characters are
+// rejected rather than escaped.
+func checkXFSQuotaPath(p string) error {
+	for _, r := range p {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == '"' || r == '\'' || r == '\\' {
+			return fmt.Errorf("%q cannot be given to xfs_quota, rename the zone directory to use a zone quota", p)
+		}
+	}
+	return nil
+}
+
+// xfsQuotaCommand runs an xfs_quota expert command against a mount point
+func xfsQuotaCommand(mountPath, command string) (string, error) {
+	output, err := exec.Command("xfs_quota", "-x", "-c", command, mountPath).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("xfs_quota failed: %s", commandError(output, err))
+	}
+	return string(output), nil
+}
+
+// applyProjectQuota sets a zone's limit on its filesystem
+func applyProjectQuota(quota *models.ZoneProjectQuota, root string) error {
+	if quota.Method == models.ProjectQuotaZFS {
+		output, err := exec.Command("sudo", "zfs", "set", "refquota="+strconv.FormatInt(quota.Limit, 10), quota.Target).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to set refquota: %s", commandError(output, err))
+		}
+		return nil
+	}
+
+	// Tag the directory tree with the project ID, then limit the project
+	if err := checkXFSQuotaPath(root); err != nil {
+		return err
+	}
+	if _, err := xfsQuotaCommand(quota.Target, fmt.Sprintf("project -s -p %s %d", root, quota.ProjectID)); err != nil {
+		return err
+	}
+	_, err := xfsQuotaCommand(quota.Target, fmt.Sprintf("limit -p bhard=%d %d", quota.Limit, quota.ProjectID))
+	return err
+}
+
+// removeProjectQuota lifts a zone's limit from its filesystem
+func removeProjectQuota(quota *models.ZoneProjectQuota, root string) error {
+	if quota.Method == models.ProjectQuotaZFS {
+		output, err := exec.Command("sudo", "zfs", "set", "refquota=none", quota.Target).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to clear refquota: %s", commandError(output, err))
+		}
+		return nil
+	}
+
+	if _, err := xfsQuotaCommand(quota.Target, fmt.Sprintf("limit -p bhard=0 %d", quota.ProjectID)); err != nil {
+		return err
+	}
+	// The directory may already be gone when the zone is being deleted
+	if _, err := os.Stat(root); err == nil && checkXFSQuotaPath(root) == nil {
+		if _, err := xfsQuotaCommand(quota.Target, fmt.Sprintf("project -C -p %s %d", root, quota.ProjectID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readProjectQuota returns a zone's usage and the limit currently set on its filesystem
+func readProjectQuota(quota *models.ZoneProjectQuota) (used, limit int64, err error) {
+	if quota.Method == models.ProjectQuotaZFS {
+		output, err := exec.Command("sudo", "zfs", "get", "-Hp", "-o", "value", "referenced,refquota", quota.Target).CombinedOutput()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read refquota: %s", commandError(output, err))
+		}
+		values := strings.Fields(string(output))
+		if len(values) != 2 {
+			return 0, 0, fmt.Errorf("unexpected zfs output: %s", strings.TrimSpace(string(output)))
+		}
+		used, _ = strconv.ParseInt(values[0], 10, 64)
+		limit, _ = strconv.ParseInt(values[1], 10, 64)
+		return used, limit, nil
+	}
+
+	// Report lines look like "#10000  2048  0  1048576  00 [--------]", in 1K blocks
+	output, err := xfsQuotaCommand(quota.Target, "report -p -b -n -N")
+	if err != nil {
+		return 0, 0, err
+	}
+	id := "#" + strconv.Itoa(quota.ProjectID)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && fields[0] == id {
+			used, _ = strconv.ParseInt(fields[1], 10, 64)
+			limit, _ = strconv.ParseInt(fields[3], 10, 64)
+			return used * 1024, limit * 1024, nil
+		}
+	}
+	return 0, 0, nil
+}
+
+// projectQuotaStatus reports a zone's limit together with what the filesystem enforces
+func projectQuotaStatus(quota *models.ZoneProjectQuota) map[string]interface{} {
+	status := map[string]interface{}{
+		"quota": quota,
+	}
+	if quota == nil {
+		return status
+	}
+
+	used, limit, err := readProjectQuota(quota)
+	if err != nil {
+		status["error"] = err.Error()
+		return status
+	}
+	status["used_bytes"] = used
+	status["filesystem_limit"] = limit
+	// XFS limits round up to whole kilobytes
+	status["applied"] = limit >= quota.Limit && limit-quota.Limit < 1024
+	return status
+}
+
+// releaseZoneProjectQuota removes the limit of a deleted zone from its filesystem
+func releaseZoneProjectQuota(store storage.DataStore, zone *models.ShareZone, quota *models.ZoneProjectQuota) {
+	pool, err := store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		return
+	}
+	if err := removeProjectQuota(quota, filepath.Join(pool.Path, zone.Path)); err != nil {
+		log.Printf("Warning: Failed to remove quota of zone %s: %v", zone.Name, err)
+	}
+}
+
+// GetZoneProjectQuota returns a zone's overall limit and its current usage
+func (h *ZoneHandler) GetZoneProjectQuota(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if _, err := h.store.GetShareZone(id); err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+
+	quota, _ := h.store.GetZoneProjectQuota(id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projectQuotaStatus(quota))
+}
+
+// SetZoneProjectQuota caps the total size of a zone using a ZFS refquota or an XFS project quota
+func (h *ZoneHandler) SetZoneProjectQuota(w http.ResponseWriter, r *http.Request) {
+	zone, err := h.store.GetShareZone(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+	pool, err := h.store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		apierror.Error(w, "Pool not found", http.StatusInternalServerError)
+		return
+	}
+	if pool.IsS3() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Zone quotas are not supported on object storage pools", nil)
+		return
+	}
+
+	var req struct {
+		Limit int64 `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	if req.Limit <= 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "limit must be positive", nil)
+		return
+	}
+
+	root := filepath.Join(pool.Path, zone.Path)
+	mounts, err := getMountPoints()
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	method, target, err := findProjectQuotaTarget(mounts, root)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	quota := &models.ZoneProjectQuota{ZoneID: zone.ID, Limit: req.Limit, Method: method, Target: target}
+	if existing, err := h.store.GetZoneProjectQuota(zone.ID); err == nil {
+		if existing.Method == method && existing.Target == target {
+			quota.ProjectID = existing.ProjectID
+		} else if err := removeProjectQuota(existing, root); err != nil {
+			log.Printf("Warning: Failed to remove old quota of zone %s: %v", zone.Name, err)
+		}
+	}
+	if method == models.ProjectQuotaXFS && quota.ProjectID == 0 {
+		quota.ProjectID = nextXFSProjectID(h.store)
+	}
+
+	if err := applyProjectQuota(quota, root); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.store.SetZoneProjectQuota(quota); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projectQuotaStatus(quota))
+}
+
+// DeleteZoneProjectQuota removes a zone's overall limit
+func (h *ZoneHandler) DeleteZoneProjectQuota(w http.ResponseWriter, r *http.Request) {
+	zone, err := h.store.GetShareZone(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		return
+	}
+	quota, err := h.store.GetZoneProjectQuota(zone.ID)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeQuotaNotFound, err.Error(), nil)
+		return
+	}
+	pool, err := h.store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		apierror.Error(w, "Pool not found", http.StatusInternalServerError)
+		return
+	}
+
+	if err := removeProjectQuota(quota, filepath.Join(pool.Path, zone.Path)); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.store.DeleteZoneProjectQuota(zone.ID); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Zone quota removed"})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// errQuotaExceeded is returned when an upload would take a user over their zone quota
+var errQuotaExceeded = errors.New("upload would exceed your storage quota")
+
+// zoneUserQuota returns the per-user quota of a zone in bytes (0 = unlimited)
+func zoneUserQuota(zone *models.ShareZone, pool *models.StoragePool) int64 {
+	if zone.MaxQuotaPerUser > 0 {
+		return zone.MaxQuotaPerUser
+	}
+	return pool.DefaultUserQuota
+}
+
+// quotaAccount returns the user charged for writes to fullPath. In personal zones this is the
+// owner of the directory, which differs from the uploader in folders shared with other users.
+func quotaAccount(zone *models.ShareZone, root, fullPath, username string) string {
+	if zone.ZoneType != models.ZoneTypePersonal {
+		return username
+	}
+	rel := strings.TrimPrefix(usageRelPath(root, fullPath), "/")
+	if owner, _, _ := strings.Cut(rel, "/"); owner != "" {
+		return owner
+	}
+	return username
+}
+
+// zoneQuotaUsage returns the space an account is charged for in a zone. Personal zones charge the
+// size of the user's directory as counted by the usage tracker; other zones keep a per-user ledger
+// of the bytes each user has written.
+func zoneQuotaUsage(store storage.DataStore, zone *models.ShareZone, root, account string) int64 {
+	if zone.ZoneType == models.ZoneTypePersonal {
+		totals, err := dirUsageTotals(store, zone.ID, root, filepath.Join(root, account), false)
+		if err != nil {
+			return 0
+		}
+		store.SetZoneUserUsage(zone.ID, account, totals.Size)
+		return totals.Size
+	}
+	if usage, err := store.GetZoneUserUsage(zone.ID, account); err == nil {
+		return usage.UsedBytes
+	}
+	return 0
+}
+
+// zoneQuotaRoom returns how many bytes the file at fullPath may hold before the charged user goes
+// over their quota, or -1 when there is no quota. Quotas are not enforced on object storage pools.
+func zoneQuotaRoom(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool, fullPath, username string) int64 {
+	quota := zoneUserQuota(zone, pool)
+	if quota <= 0 || pool.IsS3() {
+		return -1
+	}
+
+	root := filepath.Join(pool.Path, zone.Path)
+	used := zoneQuotaUsage(store, zone, root, quotaAccount(zone, root, fullPath, username))
+
+	// Overwriting a file frees its current size
+	if info, err := os.Stat(fullPath); err == nil && !info.IsDir() {
+		used -= info.Size()
+	}
+	return quota - used
+}
+
+// quotaExceeded returns the error for an upload that does not fit in the room left in a quota
+func quotaExceeded(zone *models.ShareZone, pool *models.StoragePool, room int64) error {
+	quota := zoneUserQuota(zone, pool)
+	return fmt.Errorf("%w (%d of %d bytes used)", errQuotaExceeded, max(quota-room, 0), quota)
+}
+
+// checkZoneQuota returns errQuotaExceeded if writing size bytes to the file at fullPath would take
+// the charged user over their quota
+func checkZoneQuota(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool, fullPath, username string, size int64) error {
+	if room := zoneQuotaRoom(store, zone, pool, fullPath, username); room >= 0 && size > room {
+		return quotaExceeded(zone, pool, room)
+	}
+	return nil
+}
+
+// chargeZoneUsage updates the ledger of a user after delta bytes were written to (or, when negative,
+// removed from) fullPath. Personal zones are counted from the user's directory instead.
+func chargeZoneUsage(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool, fullPath, username string, delta int64) {
+	if pool.IsS3() || zone.ZoneType == models.ZoneTypePersonal || delta == 0 {
+		return
+	}
+	root := filepath.Join(pool.Path, zone.Path)
+	store.AddZoneUserUsage(zone.ID, quotaAccount(zone, root, fullPath, username), delta)
+}
+
+// zoneForFile returns the zone and pool containing an absolute path, or nil if it is outside all zones
+func zoneForFile(store storage.DataStore, fullPath string) (*models.ShareZone, *models.StoragePool) {
+	zone, _ := zoneForPath(store, fullPath)
+	if zone == nil {
+		return nil, nil
+	}
+	pool, err := store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		return nil, nil
+	}
+	return zone, pool
+}
+
+// pathUsage returns the size of a file, or the total size of a folder and its contents
+func pathUsage(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool, fullPath string) int64 {
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return 0
+	}
+	if !info.IsDir() {
+		return info.Size()
+	}
+	totals, err := dirUsageTotals(store, zone.ID, filepath.Join(pool.Path, zone.Path), fullPath, false)
+	if err != nil {
+		return 0
+	}
+	return totals.Size
+}
+
+// GetZoneQuota returns the current user's quota and usage in a zone.
+// Admins may pass username to see another user's usage.
+func (h *ZoneFileHandler) GetZoneQuota(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	zoneID := chi.URLParam(r, "zoneId")
+	user := userFromContext(userCtx)
+
+	fullPath, zone, pool, err := h.resolveZonePathWithPool(zoneID, "/", user)
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return
+	}
+
+	root := filepath.Join(pool.Path, zone.Path)
+	account := quotaAccount(zone, root, fullPath, userCtx.Username)
+	if username := r.URL.Query().Get("username"); username != "" && username != account {
+		if !userCtx.IsAdmin {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Access denied", nil)
+			return
+		}
+		account = username
+	}
+
+	info := models.ZoneQuotaInfo{
+		ZoneID:    zone.ID,
+		Username:  account,
+		Quota:     zoneUserQuota(zone, pool),
+		Available: -1,
+		Enforced:  !pool.IsS3(),
+	}
+	if info.Enforced {
+		info.UsedBytes = zoneQuotaUsage(h.store, zone, root, account)
+	}
+	if info.Quota > 0 {
+		info.Available = max(info.Quota-info.UsedBytes, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
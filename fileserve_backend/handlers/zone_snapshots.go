@@ -0,0 +1,498 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+	"fileserv/internal/fileops"
+	"fileserv/middleware"
+	"fileserv/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// zfsSnapshotNameRegex validates the part of a snapshot name after the '@'
+var zfsSnapshotNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.:\-]+$`)
+
+// errNotZFS is returned for zones whose folder is not on a ZFS dataset
+var errNotZFS = errors.New("zone is not stored on a ZFS dataset")
+
+// ZoneSnapshot is a snapshot of the dataset backing a zone
+type ZoneSnapshot struct {
+	Name      string    `json:"name"`
+	Dataset   string    `json:"dataset"`
+	CreatedAt time.Time `json:"created_at"`
+	Used      int64     `json:"used"`
+}
+
+// zoneSnapshotSource locates the snapshots of the folder a user sees for a zone
+type zoneSnapshotSource struct {
+	zone       *models.ShareZone
+	pool       *models.StoragePool
+	basePath   string // Live folder the user's zone paths are relative to
+	dataset    string // Dataset containing basePath
+	mountpoint string // Mountpoint of the dataset
+}
+
+// zfsDatasetForPath returns the mounted ZFS filesystem that contains path
+func zfsDatasetForPath(path string) (string, string, error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	output, err := exec.Command("zfs", "list", "-H", "-o", "name,mountpoint", "-t", "filesystem").Output()
+	if err != nil {
+		return "", "", errNotZFS
+	}
+
+	var dataset, mountpoint string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "/") {
+			continue
+		}
+		mp := filepath.Clean(fields[1])
+		if (path == mp || strings.HasPrefix(path, strings.TrimSuffix(mp, "/")+"/")) && len(mp) > len(mountpoint) {
+			dataset, mountpoint = fields[0], mp
+		}
+	}
+	if dataset == "" {
+		return "", "", errNotZFS
+	}
+	return dataset, mountpoint, nil
+}
+
+// listZoneSnapshots returns the snapshots of a dataset, newest first
+func listZoneSnapshots(dataset string) ([]ZoneSnapshot, error) {
+	output, err := exec.Command("zfs", "list", "-H", "-p", "-t", "snapshot", "-o", "name,creation,used",
+		"-s", "creation", "-d", "1", dataset).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	snapshots := []ZoneSnapshot{}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		_, name, ok := strings.Cut(fields[0], "@")
+		if !ok {
+			continue
+		}
+		created, _ := strconv.ParseInt(fields[1], 10, 64)
+		used, _ := strconv.ParseInt(fields[2], 10, 64)
+		snapshots = append(snapshots, ZoneSnapshot{
+			Name:      name,
+			Dataset:   dataset,
+			CreatedAt: time.Unix(created, 0),
+			Used:      used,
+		})
+	}
+
+	// Newest first
+	for i, j := 0, len(snapshots)-1; i < j; i, j = i+1, j-1 {
+		snapshots[i], snapshots[j] = snapshots[j], snapshots[i]
+	}
+	return snapshots, nil
+}
+
+// getZoneSnapshotSource resolves the zone of the request and the dataset backing it, writing an error response on failure
+func (h *ZoneFileHandler) getZoneSnapshotSource(w http.ResponseWriter, r *http.Request) (*zoneSnapshotSource, *models.User, bool) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return nil, nil, false
+	}
+
+	zoneID := chi.URLParam(r, "zoneId")
+	if isSharedFolderID(zoneID) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Snapshots are not available for shared folders", nil)
+		return nil, nil, false
+	}
+	user := userFromContext(userCtx)
+
+	zone, pool, basePath, err := h.zoneBasePath(zoneID, user)
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return nil, nil, false
+	}
+	if pool.IsS3() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, errNotZFS.Error(), nil)
+		return nil, nil, false
+	}
+
+	dataset, mountpoint, err := zfsDatasetForPath(filepath.Join(pool.Path, zone.Path))
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return nil, nil, false
+	}
+
+	return &zoneSnapshotSource{
+		zone:       zone,
+		pool:       pool,
+		basePath:   basePath,
+		dataset:    dataset,
+		mountpoint: mountpoint,
+	}, user, true
+}
+
+// snapshotPath maps a zone-relative path to its location inside a snapshot. The snapshot must
+// exist and the result must stay inside the user's folder of the snapshot.
+func (s *zoneSnapshotSource) snapshotPath(snapshot, relativePath string) (string, error) {
+	if !zfsSnapshotNameRegex.MatchString(snapshot) {
+		return "", errors.New("invalid snapshot name")
+	}
+	snapshots, err := listZoneSnapshots(s.dataset)
+	if err != nil {
+		return "", err
+	}
+	found := false
+	for _, snap := range snapshots {
+		if snap.Name == snapshot {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", os.ErrNotExist
+	}
+
+	resolvedBase := s.basePath
+	if resolved, err := filepath.EvalSymlinks(s.basePath); err == nil {
+		resolvedBase = resolved
+	}
+	rel, err := filepath.Rel(s.mountpoint, resolvedBase)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", os.ErrPermission
+	}
+
+	snapBase := filepath.Join(s.mountpoint, ".zfs", "snapshot", snapshot, rel)
+	fullPath := filepath.Join(snapBase, filepath.Clean("/"+relativePath))
+
+	// The trash and version store are not part of the browsable zone contents
+	zoneRel := mustRel(s.mountpoint, filepath.Join(s.pool.Path, s.zone.Path))
+	if isReservedZonePath(filepath.Join(s.mountpoint, ".zfs", "snapshot", snapshot, zoneRel), fullPath) {
+		return "", os.ErrPermission
+	}
+
+	// Symlinks inside the snapshot must not lead out of it
+	if resolved, err := filepath.EvalSymlinks(fullPath); err == nil {
+		if resolved != snapBase && !strings.HasPrefix(resolved, snapBase+string(filepath.Separator)) {
+			return "", os.ErrPermission
+		}
+	}
+	return fullPath, nil
+}
+
+// mustRel returns target relative to base, resolving symlinks in target first
+func mustRel(base, target string) string {
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return "."
+	}
+	return rel
+}
+
+// writeSnapshotPathError reports a failed snapshot path lookup
+func writeSnapshotPathError(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsPermission(err):
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+	case os.IsNotExist(err):
+		apierror.Write(w, http.StatusNotFound, apierror.CodePathNotFound, "Snapshot or path not found", nil)
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+	}
+}
+
+// ListZoneSnapshots lists the snapshots of the dataset backing a zone
+func (h *ZoneFileHandler) ListZoneSnapshots(w http.ResponseWriter, r *http.Request) {
+	src, _, ok := h.getZoneSnapshotSource(w, r)
+	if !ok {
+		return
+	}
+
+	snapshots, err := listZoneSnapshots(src.dataset)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dataset":   src.dataset,
+		"snapshots": snapshots,
+	})
+}
+
+// ListZoneSnapshotFiles lists a directory of a zone as it was when a snapshot was taken
+func (h *ZoneFileHandler) ListZoneSnapshotFiles(w http.ResponseWriter, r *http.Request) {
+	src, _, ok := h.getZoneSnapshotSource(w, r)
+	if !ok {
+		return
+	}
+
+	relativePath := filepath.Clean("/" + r.URL.Query().Get("path"))
+
+	fullPath, err := src.snapshotPath(chi.URLParam(r, "snapshot"), relativePath)
+	if err != nil {
+		writeSnapshotPathError(w, err)
+		return
+	}
+
+	files, err := fileops.ListDirectoryRaw(fullPath, relativePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Path not found in snapshot", nil)
+			return
+		}
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	if src.zone.ZoneType != models.ZoneTypePersonal && filepath.Clean("/"+relativePath) == "/" {
+		files = hideReservedDirs(files)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// DownloadZoneSnapshotFile downloads a file from a snapshot of a zone
+func (h *ZoneFileHandler) DownloadZoneSnapshotFile(w http.ResponseWriter, r *http.Request) {
+	src, _, ok := h.getZoneSnapshotSource(w, r)
+	if !ok {
+		return
+	}
+
+	relativePath := r.URL.Query().Get("path")
+	fullPath, err := src.snapshotPath(chi.URLParam(r, "snapshot"), relativePath)
+	if err != nil {
+		writeSnapshotPathError(w, err)
+		return
+	}
+
+	opts := &fileops.TransferOptions{
+		ForceDownload: r.URL.Query().Get("download") == "true" || r.URL.Query().Get("dl") == "1",
+		Filename:      filepath.Base(fullPath),
+	}
+	if err := fileops.ServeFileWithRange(w, r, fullPath, opts); err != nil {
+		if os.IsNotExist(err) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		} else {
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// RestoreZoneSnapshotPath copies a file or folder from a snapshot back into the live zone. An item
+// already at the destination is only replaced when overwrite is set, and is moved to the trash first.
+func (h *ZoneFileHandler) RestoreZoneSnapshotPath(w http.ResponseWriter, r *http.Request) {
+	src, user, ok := h.getZoneSnapshotSource(w, r)
+	if !ok {
+		return
+	}
+	userCtx := middleware.GetUserContext(r)
+
+	if src.zone.ReadOnly {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
+		return
+	}
+
+	var req struct {
+		Path      string `json:"path"`      // Path of the item in the snapshot
+		Target    string `json:"target"`    // Where to restore it (default: the same path)
+		Overwrite bool   `json:"overwrite"` // Replace an existing item at the target
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	if filepath.Clean("/"+req.Path) == "/" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Restoring the whole zone is not supported; roll back the snapshot instead", nil)
+		return
+	}
+	if req.Target == "" {
+		req.Target = req.Path
+	}
+
+	snapPath, err := src.snapshotPath(chi.URLParam(r, "snapshot"), req.Path)
+	if err != nil {
+		writeSnapshotPathError(w, err)
+		return
+	}
+	info, err := os.Lstat(snapPath)
+	if err != nil {
+		writeSnapshotPathError(w, err)
+		return
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Only files and folders can be restored", nil)
+		return
+	}
+
+	target, _, _, err := h.resolveZonePathWithPool(src.zone.ID, req.Target, user)
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		}
+		return
+	}
+	if target == src.basePath {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot restore over the zone root", nil)
+		return
+	}
+
+	size := info.Size()
+	if info.IsDir() {
+		size = 0
+		filepath.Walk(snapPath, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				size += fi.Size()
+			}
+			return nil
+		})
+	}
+	if _, err := os.Lstat(target); err == nil && !req.Overwrite {
+		apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "An item already exists at the target location", nil)
+		return
+	}
+	if err := checkZoneQuota(h.store, src.zone, src.pool, target, userCtx.Username, size); err != nil {
+		apierror.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+
+	// Copy next to the destination first so a failed copy leaves the live data untouched
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		apierror.Error(w, "Failed to create parent folder: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	staging := filepath.Join(filepath.Dir(target), ".restore-"+uuid.New().String())
+	skipped, err := copySnapshotTree(snapPath, staging)
+	if err != nil {
+		os.RemoveAll(staging)
+		apierror.Error(w, "Failed to restore item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		if !req.Overwrite {
+			os.RemoveAll(staging)
+			apierror.Write(w, http.StatusConflict, apierror.CodeAlreadyExists, "An item already exists at the target location", nil)
+			return
+		}
+		if _, err := moveToTrash(h.store, src.zone, src.pool, target, userCtx); err != nil {
+			os.RemoveAll(staging)
+			apierror.Error(w, "Failed to move the existing item to the trash: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := os.Rename(staging, target); err != nil {
+		os.RemoveAll(staging)
+		apierror.Error(w, "Failed to restore item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	indexPath(h.store, target)
+	chargeZoneUsage(h.store, src.zone, src.pool, target, userCtx.Username, size)
+
+	restoredPath := "/" + filepath.ToSlash(mustRel(src.basePath, target))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Item restored successfully",
+		"path":    restoredPath,
+		"size":    size,
+		"skipped": skipped,
+	})
+}
+
+// copySnapshotTree copies a file or directory out of a snapshot, keeping modes and modification
+// times. Symlinks and special files are not restored; their count is returned.
+func copySnapshotTree(src, dst string) (int, error) {
+	skipped := 0
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(target, info.Mode().Perm()|0700); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if err := copySnapshotFile(path, target, info); err != nil {
+				return err
+			}
+		default:
+			skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		return skipped, err
+	}
+
+	// Directory times change while their contents are written, so they are set afterwards
+	filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			if rel, err := filepath.Rel(src, path); err == nil {
+				target := filepath.Join(dst, rel)
+				os.Chmod(target, info.Mode().Perm())
+				os.Chtimes(target, info.ModTime(), info.ModTime())
+			}
+		}
+		return nil
+	})
+	return skipped, nil
+}
+
+// copySnapshotFile copies a single regular file, keeping its mode and modification time
+func copySnapshotFile(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
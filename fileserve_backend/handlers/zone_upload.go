@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+	"fileserv/models"
+	"fileserv/storage"
+)
+
+// uploadTooLargeError is returned when an upload is larger than the upload limit of its zone
+type uploadTooLargeError struct {
+	limit int64
+}
+
+func (e *uploadTooLargeError) Error() string {
+	return fmt.Sprintf("upload exceeds the maximum allowed size of %d bytes", e.limit)
+}
+
+// zoneUpload is a file being written to a zone, through the web API or a file transfer protocol.
+// Both check and finish it the same way, so limits, quotas and scanning apply to every upload.
+type zoneUpload struct {
+	store    storage.DataStore
+	zone     *models.ShareZone
+	pool     *models.StoragePool
+	fullPath string
+	userID   string
+	username string
+	limit    int64 // Largest file allowed, 0 = unlimited
+	room     int64 // Bytes left in the quota of the charged user, -1 = no quota
+	replaced int64 // Size of the content being overwritten
+}
+
+// beginZoneUpload checks an upload of size bytes to fullPath against the monthly transfer caps,
+// the upload limit of the zone and the quota of the user it is charged to. Pass 0 when the size
+// is not known yet and check it with checkSize as the file grows.
+func beginZoneUpload(store storage.DataStore, zone *models.ShareZone, pool *models.StoragePool, fullPath string, userCtx *middleware.UserContext, size int64) (*zoneUpload, error) {
+	if err := checkTransferCaps(store, transferObjects(userCtx.UserID, zone.ID, "")); err != nil {
+		return nil, err
+	}
+
+	u := &zoneUpload{
+		store:    store,
+		zone:     zone,
+		pool:     pool,
+		fullPath: fullPath,
+		userID:   userCtx.UserID,
+		username: userCtx.Username,
+		limit:    uploadLimit(store, zone, pool),
+		room:     zoneQuotaRoom(store, zone, pool, fullPath, userCtx.Username),
+	}
+	if !pool.IsS3() {
+		u.replaced = pathUsage(store, zone, pool, fullPath)
+	}
+
+	if err := u.checkSize(size); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// checkSize returns an error if the uploaded file may not be size bytes large
+func (u *zoneUpload) checkSize(size int64) error {
+	if u.limit > 0 && size > u.limit {
+		return &uploadTooLargeError{limit: u.limit}
+	}
+	if u.room >= 0 && size > u.room {
+		return quotaExceeded(u.zone, u.pool, u.room)
+	}
+	return nil
+}
+
+// finish scans the written file and records it like every upload: search index, quota ledger
+// and event. Infected files are quarantined and an error is returned.
+func (u *zoneUpload) finish(written int64) error {
+	if err := scanUpload(u.store, u.fullPath, u.userID, u.username); err != nil {
+		return err
+	}
+	indexPath(u.store, u.fullPath)
+	chargeZoneUsage(u.store, u.zone, u.pool, u.fullPath, u.username, written-u.replaced)
+	publishUploadCompleted(u.store, u.userID, u.fullPath, written)
+	return nil
+}
+
+// writeUploadError responds to an upload refused by beginZoneUpload or checkSize
+func writeUploadError(w http.ResponseWriter, err error) {
+	var capErr *transferCapError
+	var tooLarge *uploadTooLargeError
+	switch {
+	case errors.As(err, &capErr):
+		writeTransferCapError(w, err)
+	case errors.As(err, &tooLarge):
+		writeUploadTooLarge(w, tooLarge.limit)
+	case errors.Is(err, errQuotaExceeded):
+		apierror.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -8,10 +8,13 @@ import (
 	"net/http"
 	"os"
 	osuser "os/user"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"fileserv/internal/apierror"
 	"fileserv/internal/fileops"
 	"fileserv/middleware"
 	"fileserv/models"
@@ -34,7 +37,7 @@ func NewZoneFileHandler(store storage.DataStore) *ZoneFileHandler {
 func (h *ZoneFileHandler) GetUserZones(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -50,7 +53,7 @@ func (h *ZoneFileHandler) GetUserZones(w http.ResponseWriter, r *http.Request) {
 
 	var accessibleZones []models.UserZoneInfo
 	for _, zone := range zones {
-		if !zone.UserHasZoneAccess(user) {
+		if !zone.UserHasZoneAccess(user) || !userCtx.CanAccessZone(zone.ID) {
 			continue
 		}
 
@@ -69,17 +72,11 @@ func (h *ZoneFileHandler) GetUserZones(w http.ResponseWriter, r *http.Request) {
 			fullPath = filepath.Join(fullPath, user.Username)
 
 			// Auto-provision user directory if needed
-			if zone.AutoProvision {
-				if err := os.MkdirAll(fullPath, 0755); err != nil {
+			if zone.AutoProvision && !pool.IsS3() {
+				if err := provisionUserDir(fullPath, user.Username); err != nil {
 					// Log error but continue
 					continue
 				}
-				// Set ownership of the auto-provisioned directory
-				if u, err := osuser.Lookup(user.Username); err == nil {
-					uid, _ := strconv.Atoi(u.Uid)
-					gid, _ := strconv.Atoi(u.Gid)
-					os.Chown(fullPath, uid, gid)
-				}
 			}
 		}
 
@@ -93,7 +90,8 @@ func (h *ZoneFileHandler) GetUserZones(w http.ResponseWriter, r *http.Request) {
 			UserPath:    userPath,
 			Description: zone.Description,
 			CanUpload:   !zone.ReadOnly,
-			CanShare:    zone.AllowWebShares,
+			CanShare:    zone.AllowWebShares && !user.IsGuest,
+			CanInvite:   user.IsAdmin || zone.IsOwner(user),
 		}
 		accessibleZones = append(accessibleZones, info)
 	}
@@ -106,32 +104,11 @@ func (h *ZoneFileHandler) GetUserZones(w http.ResponseWriter, r *http.Request) {
 // Also returns the pool for file size/type validation
 // This function includes symlink resolution to prevent path traversal attacks
 func (h *ZoneFileHandler) resolveZonePathWithPool(zoneID, relativePath string, user *models.User) (string, *models.ShareZone, *models.StoragePool, error) {
-	zone, err := h.store.GetShareZone(zoneID)
+	zone, pool, basePath, err := h.zoneBasePath(zoneID, user)
 	if err != nil {
 		return "", nil, nil, err
 	}
 
-	if !zone.UserHasZoneAccess(user) {
-		return "", nil, nil, os.ErrPermission
-	}
-
-	pool, err := h.store.GetStoragePool(zone.PoolID)
-	if err != nil {
-		return "", nil, nil, err
-	}
-
-	if !pool.Enabled {
-		return "", nil, nil, os.ErrPermission
-	}
-
-	// Build base path
-	basePath := filepath.Join(pool.Path, zone.Path)
-
-	// For personal zones, add username
-	if zone.ZoneType == models.ZoneTypePersonal {
-		basePath = filepath.Join(basePath, user.Username)
-	}
-
 	// Clean and validate the relative path
 	cleanPath := filepath.Clean("/" + relativePath)
 	if cleanPath == "/" {
@@ -145,6 +122,16 @@ func (h *ZoneFileHandler) resolveZonePathWithPool(zoneID, relativePath string, u
 		return "", nil, nil, os.ErrPermission
 	}
 
+	// The zone trash and version store are only reachable through their own endpoints
+	if isReservedZonePath(filepath.Join(pool.Path, zone.Path), fullPath) {
+		return "", nil, nil, os.ErrPermission
+	}
+
+	// Object storage has no symlinks, so the lexical checks above are sufficient
+	if pool.IsS3() {
+		return fullPath, zone, pool, nil
+	}
+
 	// Resolve symlinks in the base path to get canonical form
 	resolvedBase, err := filepath.EvalSymlinks(basePath)
 	if err != nil {
@@ -191,17 +178,77 @@ func (h *ZoneFileHandler) resolveZonePathWithPool(zoneID, relativePath string, u
 	return fullPath, zone, pool, nil
 }
 
+// zoneBasePath returns the zone, its pool and the folder the user's zone paths are relative to.
+// Zone IDs of folders shared with the user resolve to the shared folder.
+func (h *ZoneFileHandler) zoneBasePath(zoneID string, user *models.User) (*models.ShareZone, *models.StoragePool, string, error) {
+	if isSharedFolderID(zoneID) {
+		return h.sharedFolderBase(zoneID, user)
+	}
+
+	zone, err := h.store.GetShareZone(zoneID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if !zone.UserHasZoneAccess(user) {
+		return nil, nil, "", os.ErrPermission
+	}
+
+	pool, err := h.store.GetStoragePool(zone.PoolID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if !pool.Enabled {
+		return nil, nil, "", os.ErrPermission
+	}
+
+	// Build base path
+	basePath := filepath.Join(pool.Path, zone.Path)
+
+	// For personal zones, add username
+	if zone.ZoneType == models.ZoneTypePersonal {
+		basePath = filepath.Join(basePath, user.Username)
+	}
+
+	return zone, pool, basePath, nil
+}
+
+// zoneScope resolves the zone of a request and the part of it visible to the user, as a path
+// relative to the zone root ("/" for the whole zone, "/alice" in a personal zone)
+func (h *ZoneFileHandler) zoneScope(w http.ResponseWriter, r *http.Request) (*models.ShareZone, string, bool) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return nil, "", false
+	}
+
+	zone, pool, basePath, err := h.zoneBasePath(chi.URLParam(r, "zoneId"), userFromContext(userCtx))
+	if err != nil {
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return nil, "", false
+	}
+	return zone, usageRelPath(filepath.Join(pool.Path, zone.Path), basePath), true
+}
+
 // resolveZonePath validates and resolves a zone-relative path to a physical path (legacy)
 func (h *ZoneFileHandler) resolveZonePath(zoneID, relativePath string, user *models.User) (string, *models.ShareZone, error) {
 	fullPath, zone, _, err := h.resolveZonePathWithPool(zoneID, relativePath, user)
 	return fullPath, zone, err
 }
 
-// ListZoneFiles lists files in a zone directory with pagination support
+// ListZoneFiles lists files in a zone directory. Pagination uses limit with either offset or the
+// next_cursor of the previous page, which stays correct while entries are added or removed.
+// sort_by is name (default), size, modified (or mtime), type or owner; fast=true skips stat()
+// and user metadata to list huge directories quickly (name and type sorting only).
 func (h *ZoneFileHandler) ListZoneFiles(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -213,18 +260,18 @@ func (h *ZoneFileHandler) ListZoneFiles(w http.ResponseWriter, r *http.Request)
 
 	user := userFromContext(userCtx)
 
-	fullPath, zone, err := h.resolveZonePath(zoneID, relativePath, user)
+	fullPath, zone, pool, err := h.resolveZonePathWithPool(zoneID, relativePath, user)
 	if err != nil {
 		if os.IsPermission(err) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		}
 		return
 	}
 
 	// Auto-provision if needed
-	if zone.AutoProvision && zone.ZoneType == models.ZoneTypePersonal {
+	if zone.AutoProvision && zone.ZoneType == models.ZoneTypePersonal && !pool.IsS3() {
 		os.MkdirAll(fullPath, 0755)
 	}
 
@@ -240,15 +287,36 @@ func (h *ZoneFileHandler) ListZoneFiles(w http.ResponseWriter, r *http.Request)
 			opts.Offset = o
 		}
 	}
+	opts.Cursor = r.URL.Query().Get("cursor")
 	opts.SortBy = r.URL.Query().Get("sort_by")
 	opts.SortDesc = r.URL.Query().Get("sort_desc") == "true"
 	opts.FilterType = r.URL.Query().Get("type")
+	opts.Fast = r.URL.Query().Get("fast") == "true"
+	switch opts.SortBy {
+	case "", "name", "size", "modified", "mtime", "type", "owner":
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid sort_by (must be name, size, modified, mtime, type or owner)", nil)
+		return
+	}
+	// The zone trash and version store are hidden at the zone root
+	if zone.ZoneType != models.ZoneTypePersonal && filepath.Clean("/"+relativePath) == "/" {
+		opts.Exclude = reservedZoneDirs
+	}
+	paginated := opts.Limit > 0 || opts.Cursor != ""
+
+	// Pools on object storage are listed through their backend
+	if pool.IsS3() {
+		if b, ok := zoneBackend(w, pool); ok {
+			h.listBackendFiles(w, b, pool, fullPath, relativePath, opts, false)
+		}
+		return
+	}
 
 	// DEBUG: Log the listing path
 	log.Printf("LIST DEBUG: fullPath=%s, relativePath=%s, limit=%d", fullPath, relativePath, opts.Limit)
 
 	// Check if pagination is requested
-	if opts.Limit > 0 {
+	if paginated {
 		// Use paginated listing - fullPath is already resolved, use Direct version
 		result, err := fileops.ListDirectoryPaginatedDirect(fullPath, relativePath, opts)
 		if err != nil {
@@ -265,16 +333,21 @@ func (h *ZoneFileHandler) ListZoneFiles(w http.ResponseWriter, r *http.Request)
 				})
 				return
 			}
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
+		if !opts.Fast {
+			attachFileMetadata(h.store, zone, pool, fullPath, result.Files)
+		}
+		attachFileLocks(h.store, zone, pool, fullPath, result.Files)
+
 		log.Printf("LIST DEBUG: found %d files, total=%d", len(result.Files), result.Total)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(result)
 	} else {
 		// Use non-paginated listing for backwards compatibility
-		files, err := fileops.ListDirectoryRaw(fullPath, relativePath)
+		result, err := fileops.ListDirectoryRawPaginated(fullPath, opts, relativePath)
 		if err != nil {
 			if os.IsNotExist(err) {
 				// Return empty list for non-existent directories
@@ -282,12 +355,17 @@ func (h *ZoneFileHandler) ListZoneFiles(w http.ResponseWriter, r *http.Request)
 				json.NewEncoder(w).Encode([]interface{}{})
 				return
 			}
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 			return
 		}
 
+		if !opts.Fast {
+			attachFileMetadata(h.store, zone, pool, fullPath, result.Files)
+		}
+		attachFileLocks(h.store, zone, pool, fullPath, result.Files)
+
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(files)
+		json.NewEncoder(w).Encode(result.Files)
 	}
 }
 
@@ -295,40 +373,70 @@ func (h *ZoneFileHandler) ListZoneFiles(w http.ResponseWriter, r *http.Request)
 func (h *ZoneFileHandler) DownloadZoneFile(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
 	zoneID := chi.URLParam(r, "zoneId")
 	filePath := chi.URLParam(r, "*")
 
+	// GET <file>/versions[/<id>] lists or downloads previous versions
+	if h.routeFileVersions(w, r, userCtx, filePath, false) {
+		return
+	}
+
 	user := userFromContext(userCtx)
 
-	fullPath, _, err := h.resolveZonePath(zoneID, filePath, user)
+	fullPath, zone, pool, err := h.resolveZonePathWithPool(zoneID, filePath, user)
 	if err != nil {
 		if os.IsPermission(err) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		}
 		return
 	}
 
+	// Downloads are refused once the user or zone used up its monthly transfer cap
+	transfer := transferObjects(userCtx.UserID, zone.ID, "")
+	if err := checkTransferCaps(h.store, transfer); err != nil {
+		writeTransferCapError(w, err)
+		return
+	}
+	w, meter := meterDownload(w, transfer)
+	defer meter()
+
 	// Check if download or inline (preview)
 	forceDownload := r.URL.Query().Get("download") == "true" || r.URL.Query().Get("dl") == "1"
 
+	// Downloads are recorded once, not for every range a client resumes with
+	recordDownload := forceDownload && r.Header.Get("Range") == ""
+
 	// Use the new transfer utility with Range support
 	opts := &fileops.TransferOptions{
 		ForceDownload: forceDownload,
 		Filename:      filepath.Base(filePath),
 	}
 
+	if pool.IsS3() {
+		if b, ok := zoneBackend(w, pool); ok {
+			if err := fileops.ServeBackendFile(w, r, b, backendPath(pool, fullPath), opts); err != nil {
+				writeBackendError(w, err)
+			} else if recordDownload {
+				publishFileDownloaded(userCtx.UserID, zone, usageRelPath(filepath.Join(pool.Path, zone.Path), fullPath))
+			}
+		}
+		return
+	}
+
 	if err := fileops.ServeFileWithRange(w, r, fullPath, opts); err != nil {
 		if os.IsNotExist(err) {
-			http.Error(w, "File not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		}
+	} else if recordDownload {
+		publishFileDownloaded(userCtx.UserID, zone, usageRelPath(filepath.Join(pool.Path, zone.Path), fullPath))
 	}
 }
 
@@ -336,7 +444,7 @@ func (h *ZoneFileHandler) DownloadZoneFile(w http.ResponseWriter, r *http.Reques
 func (h *ZoneFileHandler) UploadZoneFile(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -346,49 +454,54 @@ func (h *ZoneFileHandler) UploadZoneFile(w http.ResponseWriter, r *http.Request)
 		targetPath = "/"
 	}
 
+	// POST <file>/versions/<id>/restore restores a previous version
+	if h.routeFileVersions(w, r, userCtx, targetPath, true) {
+		return
+	}
+	if rejectUploadOnBattery(w) {
+		return
+	}
+
 	user := userFromContext(userCtx)
 
 	fullPath, zone, pool, err := h.resolveZonePathWithPool(zoneID, targetPath, user)
 	if err != nil {
 		if os.IsPermission(err) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		}
 		return
 	}
 
 	// Check if zone is read-only
 	if zone.ReadOnly {
-		http.Error(w, "Zone is read-only", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
 		return
 	}
 
+	defer meterUpload(r, transferObjects(userCtx.UserID, zone.ID, ""))()
+
 	// Auto-provision if needed
-	if zone.AutoProvision && zone.ZoneType == models.ZoneTypePersonal {
+	if zone.AutoProvision && zone.ZoneType == models.ZoneTypePersonal && !pool.IsS3() {
 		os.MkdirAll(filepath.Dir(fullPath), 0755)
 	}
 
-	// Determine max file size from pool config
-	maxSize := pool.MaxFileSize
-	if maxSize == 0 {
-		maxSize = 10 * 1024 * 1024 * 1024 // Default 10GB if not set
-	}
-
-	// Parse multipart form with appropriate limit
-	// Allow up to max file size + 10MB for form overhead
-	formLimit := maxSize + 10*1024*1024
-	if formLimit > 32<<30 { // Cap at 32GB for memory safety
-		formLimit = 32 << 30
-	}
-	if err := r.ParseMultipartForm(formLimit); err != nil {
-		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+	// Reject bodies beyond the upload limit of the zone; large files are spooled to disk
+	limit := uploadLimit(h.store, zone, pool)
+	limitRequestBody(w, r, limit)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		if isBodyTooLarge(err) {
+			writeUploadTooLarge(w, limit)
+			return
+		}
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Failed to parse form: "+err.Error(), nil)
 		return
 	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
-		http.Error(w, "File is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "File is required", nil)
 		return
 	}
 	defer file.Close()
@@ -401,14 +514,25 @@ func (h *ZoneFileHandler) UploadZoneFile(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := fileops.ValidateUpload(header.Filename, header.Size, opts); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 		return
 	}
 
 	// Sanitize filename to prevent injection attacks
 	safeFilename := fileops.SanitizeFilename(header.Filename)
 	if safeFilename == "" {
-		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid filename", nil)
+		return
+	}
+
+	if pool.IsS3() {
+		if _, err := beginZoneUpload(h.store, zone, pool, fullPath, userCtx, header.Size); err != nil {
+			writeUploadError(w, err)
+			return
+		}
+		if b, ok := zoneBackend(w, pool); ok {
+			h.uploadBackendFile(w, userCtx, b, pool, fullPath, targetPath, safeFilename, file)
+		}
 		return
 	}
 
@@ -418,18 +542,38 @@ func (h *ZoneFileHandler) UploadZoneFile(w http.ResponseWriter, r *http.Request)
 	if err == nil && info.IsDir() {
 		finalPath = filepath.Join(fullPath, safeFilename)
 	} else if os.IsNotExist(err) {
-		// Target doesn't exist - treat it as a directory
-		os.MkdirAll(fullPath, 0755)
+		// Target doesn't exist - treat it as a directory, owned by the uploader
+		// like folders created through the API
+		fileops.MkdirAllWithOwnership(fullPath, userCtx.Username)
 		finalPath = filepath.Join(fullPath, safeFilename)
 	}
 
 	// DEBUG: Log the paths
 	log.Printf("UPLOAD DEBUG: targetPath=%s, fullPath=%s, finalPath=%s, filename=%s", targetPath, fullPath, finalPath, safeFilename)
 
+	if err := checkFileLock(h.store, finalPath, userCtx.UserID, false); err != nil {
+		writeLockError(w, err)
+		return
+	}
+	// Uploads are refused once the user or zone used up its monthly transfer cap, or when the
+	// file is over the upload limit or does not fit in the user's quota
+	upload, err := beginZoneUpload(h.store, zone, pool, finalPath, userCtx, header.Size)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	// Keep the previous content as a version if this overwrites an existing file
+	version, err := saveFileVersion(h.store, finalPath, userCtx)
+	if err != nil {
+		log.Printf("Failed to save previous version of %s: %v", finalPath, err)
+	}
+
 	// Save file
 	outFile, err := os.Create(finalPath)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		undoFileVersion(h.store, version, finalPath)
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer outFile.Close()
@@ -438,14 +582,16 @@ func (h *ZoneFileHandler) UploadZoneFile(w http.ResponseWriter, r *http.Request)
 	written, err := io.Copy(outFile, file)
 	if err != nil {
 		os.Remove(finalPath) // Clean up partial file
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		undoFileVersion(h.store, version, finalPath)
+		apierror.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Verify size matches what was declared
 	if pool.MaxFileSize > 0 && written > pool.MaxFileSize {
 		os.Remove(finalPath) // Clean up oversized file
-		http.Error(w, fmt.Sprintf("File size %d exceeds maximum allowed %d bytes", written, pool.MaxFileSize), http.StatusRequestEntityTooLarge)
+		undoFileVersion(h.store, version, finalPath)
+		apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodeUploadTooLarge, fmt.Sprintf("File size %d exceeds maximum allowed %d bytes", written, pool.MaxFileSize), nil)
 		return
 	}
 
@@ -459,6 +605,12 @@ func (h *ZoneFileHandler) UploadZoneFile(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	if err := upload.finish(written); err != nil {
+		undoFileVersion(h.store, version, finalPath)
+		writeScanError(w, err)
+		return
+	}
+
 	// Calculate the actual relative path of the uploaded file
 	// targetPath is what was requested, but file may have been saved inside it
 	actualPath := targetPath
@@ -484,40 +636,68 @@ func (h *ZoneFileHandler) UploadZoneFile(w http.ResponseWriter, r *http.Request)
 func (h *ZoneFileHandler) DeleteZoneFile(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
 	zoneID := chi.URLParam(r, "zoneId")
 	filePath := chi.URLParam(r, "*")
 	if filePath == "" {
-		http.Error(w, "Path is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Path is required", nil)
+		return
+	}
+	if isSharedFolderRoot(zoneID, filePath) {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Cannot delete the shared folder", nil)
 		return
 	}
 
 	user := userFromContext(userCtx)
 
-	fullPath, zone, err := h.resolveZonePath(zoneID, filePath, user)
+	fullPath, zone, pool, err := h.resolveZonePathWithPool(zoneID, filePath, user)
 	if err != nil {
 		if os.IsPermission(err) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		}
 		return
 	}
 
 	// Check if zone is read-only
 	if zone.ReadOnly {
-		http.Error(w, "Zone is read-only", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
 		return
 	}
 
-	if err := os.RemoveAll(fullPath); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// Object storage pools have no trash; deletes are permanent
+	if pool.IsS3() {
+		if b, ok := zoneBackend(w, pool); ok {
+			if err := b.Remove(backendPath(pool, fullPath)); err != nil {
+				writeBackendError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
 		return
 	}
 
+	if err := checkFileLock(h.store, fullPath, userCtx.UserID, true); err != nil {
+		writeLockError(w, err)
+		return
+	}
+
+	// Move to the zone trash instead of removing permanently
+	if _, err := moveToTrash(h.store, zone, pool, fullPath, userCtx); err != nil {
+		if os.IsNotExist(err) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeFileNotFound, "File not found", nil)
+		} else {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		}
+		return
+	}
+
+	unindexPath(h.store, fullPath)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -525,14 +705,18 @@ func (h *ZoneFileHandler) DeleteZoneFile(w http.ResponseWriter, r *http.Request)
 func (h *ZoneFileHandler) RenameZoneFile(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
 	zoneID := chi.URLParam(r, "zoneId")
 	oldPath := chi.URLParam(r, "*")
 	if oldPath == "" {
-		http.Error(w, "Path is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Path is required", nil)
+		return
+	}
+	if isSharedFolderRoot(zoneID, oldPath) {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Cannot rename the shared folder", nil)
 		return
 	}
 
@@ -540,43 +724,65 @@ func (h *ZoneFileHandler) RenameZoneFile(w http.ResponseWriter, r *http.Request)
 		NewPath string `json:"new_path"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
 		return
 	}
 
 	user := userFromContext(userCtx)
 
-	fullOldPath, zone, err := h.resolveZonePath(zoneID, oldPath, user)
+	fullOldPath, zone, pool, err := h.resolveZonePathWithPool(zoneID, oldPath, user)
 	if err != nil {
 		if os.IsPermission(err) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		}
 		return
 	}
 
 	// Check if zone is read-only
 	if zone.ReadOnly {
-		http.Error(w, "Zone is read-only", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
 		return
 	}
 
 	fullNewPath, _, err := h.resolveZonePath(zoneID, req.NewPath, user)
 	if err != nil {
 		if os.IsPermission(err) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		}
 		return
 	}
 
-	if err := os.Rename(fullOldPath, fullNewPath); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := checkFileLock(h.store, fullOldPath, userCtx.UserID, true); err != nil {
+		writeLockError(w, err)
+		return
+	}
+	if err := checkFileLock(h.store, fullNewPath, userCtx.UserID, false); err != nil {
+		writeLockError(w, err)
 		return
 	}
 
+	if pool.IsS3() {
+		b, ok := zoneBackend(w, pool)
+		if !ok {
+			return
+		}
+		if err := b.Rename(backendPath(pool, fullOldPath), backendPath(pool, fullNewPath)); err != nil {
+			writeBackendError(w, err)
+			return
+		}
+	} else if err := os.Rename(fullOldPath, fullNewPath); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	moveFileRecords(h.store, fullOldPath, fullNewPath)
+	unindexPath(h.store, fullOldPath)
+	indexPath(h.store, fullNewPath)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "File renamed successfully",
@@ -588,64 +794,65 @@ func (h *ZoneFileHandler) RenameZoneFile(w http.ResponseWriter, r *http.Request)
 func (h *ZoneFileHandler) CreateZoneFolder(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
 	zoneID := chi.URLParam(r, "zoneId")
 	folderPath := chi.URLParam(r, "*")
 	if folderPath == "" {
-		http.Error(w, "Path is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Path is required", nil)
 		return
 	}
 
 	user := userFromContext(userCtx)
 
-	fullPath, zone, err := h.resolveZonePath(zoneID, folderPath, user)
+	fullPath, zone, pool, err := h.resolveZonePathWithPool(zoneID, folderPath, user)
 	if err != nil {
 		if os.IsPermission(err) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		}
 		return
 	}
 
 	// Check if zone is read-only
 	if zone.ReadOnly {
-		http.Error(w, "Zone is read-only", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
 		return
 	}
 
-	// Find the first directory that needs to be created so we can set ownership
-	var dirsToCreate []string
-	checkPath := fullPath
-	for {
-		if _, err := os.Stat(checkPath); err == nil {
-			break // This directory exists
+	if pool.IsS3() {
+		b, ok := zoneBackend(w, pool)
+		if !ok {
+			return
 		}
-		dirsToCreate = append([]string{checkPath}, dirsToCreate...)
-		parent := filepath.Dir(checkPath)
-		if parent == checkPath {
-			break
+		if err := b.Mkdir(backendPath(pool, fullPath)); err != nil {
+			writeBackendError(w, err)
+			return
 		}
-		checkPath = parent
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Folder created successfully",
+			"path":    folderPath,
+		})
+		return
 	}
 
-	if err := os.MkdirAll(fullPath, 0755); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := checkFileLock(h.store, fullPath, userCtx.UserID, false); err != nil {
+		writeLockError(w, err)
 		return
 	}
 
-	// Set ownership on all newly created directories
-	for _, dir := range dirsToCreate {
-		if u, err := osuser.Lookup(userCtx.Username); err == nil {
-			uid, _ := strconv.Atoi(u.Uid)
-			gid, _ := strconv.Atoi(u.Gid)
-			os.Chown(dir, uid, gid)
-		}
+	if err := fileops.MkdirAllWithOwnership(fullPath, userCtx.Username); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+		return
 	}
 
+	indexPath(h.store, fullPath)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -654,6 +861,99 @@ func (h *ZoneFileHandler) CreateZoneFolder(w http.ResponseWriter, r *http.Reques
 	})
 }
 
+// CreateZoneFoldersRequest is the request body for creating the folders of an uploaded folder
+type CreateZoneFoldersRequest struct {
+	Path        string   `json:"path"`        // Folder the hierarchy is created in
+	Directories []string `json:"directories"` // Paths relative to Path, e.g. "photos/2024"; may be empty folders
+}
+
+// CreateZoneFolders creates a folder hierarchy in one request, so a folder dropped in the
+// web interface keeps its structure, including folders without files
+func (h *ZoneFileHandler) CreateZoneFolders(w http.ResponseWriter, r *http.Request) {
+	userCtx := middleware.GetUserContext(r)
+	if userCtx == nil {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	zoneID := chi.URLParam(r, "zoneId")
+
+	var req CreateZoneFoldersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+		return
+	}
+	if len(req.Directories) == 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Directories are required", nil)
+		return
+	}
+
+	// Validate every path before creating anything
+	user := userFromContext(userCtx)
+	fullPaths := make([]string, 0, len(req.Directories))
+	var zone *models.ShareZone
+	var pool *models.StoragePool
+	for _, dir := range req.Directories {
+		rel, err := cleanRelativePath(dir)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		fullPath, z, p, err := h.resolveZonePathWithPool(zoneID, path.Join("/", req.Path, rel), user)
+		if err != nil {
+			if os.IsPermission(err) {
+				apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+			} else {
+				apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+			}
+			return
+		}
+		fullPaths = append(fullPaths, fullPath)
+		zone, pool = z, p
+	}
+
+	if zone.ReadOnly {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
+		return
+	}
+
+	var b fileops.Backend
+	if pool.IsS3() {
+		var ok bool
+		if b, ok = zoneBackend(w, pool); !ok {
+			return
+		}
+	}
+
+	for i, fullPath := range fullPaths {
+		if b != nil {
+			err := b.Mkdir(backendPath(pool, fullPath))
+			if err != nil {
+				writeBackendError(w, err)
+				return
+			}
+			continue
+		}
+
+		if err := checkFileLock(h.store, fullPath, userCtx.UserID, false); err != nil {
+			writeLockError(w, err)
+			return
+		}
+		if err := fileops.MkdirAllWithOwnership(fullPath, userCtx.Username); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("%s: %v", req.Directories[i], err), nil)
+			return
+		}
+		indexPath(h.store, fullPath)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Folders created successfully",
+		"created": len(fullPaths),
+	})
+}
+
 // BulkDeleteRequest is the request body for bulk delete operations
 type BulkDeleteRequest struct {
 	Paths []string `json:"paths"`
@@ -675,7 +975,7 @@ type BulkErrorDetail struct {
 func (h *ZoneFileHandler) BulkDeleteZoneFiles(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -683,26 +983,30 @@ func (h *ZoneFileHandler) BulkDeleteZoneFiles(w http.ResponseWriter, r *http.Req
 
 	var req BulkDeleteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
 		return
 	}
 
 	if len(req.Paths) == 0 {
-		http.Error(w, "No paths provided", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "No paths provided", nil)
 		return
 	}
 
 	user := userFromContext(userCtx)
 
-	// Get zone once to check read-only status
-	zone, err := h.store.GetShareZone(zoneID)
+	// Get zone once to check access and read-only status
+	_, zone, _, err := h.resolveZonePathWithPool(zoneID, "/", user)
 	if err != nil {
-		http.Error(w, "Zone not found", http.StatusNotFound)
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, "Zone not found", nil)
+		}
 		return
 	}
 
 	if zone.ReadOnly {
-		http.Error(w, "Zone is read-only", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
 		return
 	}
 
@@ -712,7 +1016,15 @@ func (h *ZoneFileHandler) BulkDeleteZoneFiles(w http.ResponseWriter, r *http.Req
 	}
 
 	for _, path := range req.Paths {
-		fullPath, _, err := h.resolveZonePath(zoneID, path, user)
+		if isSharedFolderRoot(zoneID, path) {
+			resp.Failed = append(resp.Failed, BulkErrorDetail{
+				Path:  path,
+				Error: "cannot delete the shared folder",
+			})
+			continue
+		}
+
+		fullPath, _, pool, err := h.resolveZonePathWithPool(zoneID, path, user)
 		if err != nil {
 			resp.Failed = append(resp.Failed, BulkErrorDetail{
 				Path:  path,
@@ -721,7 +1033,12 @@ func (h *ZoneFileHandler) BulkDeleteZoneFiles(w http.ResponseWriter, r *http.Req
 			continue
 		}
 
-		if err := os.RemoveAll(fullPath); err != nil {
+		if pool.IsS3() {
+			err = removeBackendPath(pool, fullPath)
+		} else if err = checkFileLock(h.store, fullPath, userCtx.UserID, true); err == nil {
+			_, err = moveToTrash(h.store, zone, pool, fullPath, userCtx)
+		}
+		if err != nil {
 			resp.Failed = append(resp.Failed, BulkErrorDetail{
 				Path:  path,
 				Error: err.Error(),
@@ -729,6 +1046,8 @@ func (h *ZoneFileHandler) BulkDeleteZoneFiles(w http.ResponseWriter, r *http.Req
 			continue
 		}
 
+		unindexPath(h.store, fullPath)
+
 		resp.Deleted = append(resp.Deleted, path)
 	}
 
@@ -763,7 +1082,7 @@ type BulkMoveResult struct {
 func (h *ZoneFileHandler) BulkMoveZoneFiles(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -771,38 +1090,63 @@ func (h *ZoneFileHandler) BulkMoveZoneFiles(w http.ResponseWriter, r *http.Reque
 
 	var req BulkMoveRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request", nil)
 		return
 	}
 
 	if len(req.Paths) == 0 {
-		http.Error(w, "No paths provided", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "No paths provided", nil)
 		return
 	}
 
 	if req.Destination == "" {
-		http.Error(w, "Destination is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeFieldRequired, "Destination is required", nil)
 		return
 	}
 
 	user := userFromContext(userCtx)
 
-	// Get zone once to check read-only status
-	zone, err := h.store.GetShareZone(zoneID)
+	// Get zone once to check access and read-only status
+	_, zone, _, err := h.resolveZonePathWithPool(zoneID, "/", user)
 	if err != nil {
-		http.Error(w, "Zone not found", http.StatusNotFound)
+		if os.IsPermission(err) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
+		} else {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, "Zone not found", nil)
+		}
 		return
 	}
 
 	if zone.ReadOnly {
-		http.Error(w, "Zone is read-only", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, apierror.CodeZoneReadOnly, "Zone is read-only", nil)
 		return
 	}
 
 	// Resolve destination directory
-	destFullPath, _, err := h.resolveZonePath(zoneID, req.Destination, user)
+	destFullPath, _, pool, err := h.resolveZonePathWithPool(zoneID, req.Destination, user)
 	if err != nil {
-		http.Error(w, "Invalid destination: "+err.Error(), http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidPath, "Invalid destination: "+err.Error(), nil)
+		return
+	}
+
+	// Object storage has no real folders, so the destination needs no preparation
+	if pool.IsS3() {
+		b, ok := zoneBackend(w, pool)
+		if !ok {
+			return
+		}
+		if info, err := b.Stat(backendPath(pool, destFullPath)); err == nil && !info.IsDir {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Destination must be a directory", nil)
+			return
+		}
+		resp := h.moveBackendPaths(b, zoneID, user, pool, destFullPath, req)
+		w.Header().Set("Content-Type", "application/json")
+		if len(resp.Failed) > 0 && len(resp.Moved) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+		} else if len(resp.Failed) > 0 {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		json.NewEncoder(w).Encode(resp)
 		return
 	}
 
@@ -812,15 +1156,15 @@ func (h *ZoneFileHandler) BulkMoveZoneFiles(w http.ResponseWriter, r *http.Reque
 		if os.IsNotExist(err) {
 			// Create destination directory
 			if err := os.MkdirAll(destFullPath, 0755); err != nil {
-				http.Error(w, "Failed to create destination: "+err.Error(), http.StatusInternalServerError)
+				apierror.Error(w, "Failed to create destination: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
 		} else {
-			http.Error(w, "Failed to access destination: "+err.Error(), http.StatusInternalServerError)
+			apierror.Error(w, "Failed to access destination: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 	} else if !destInfo.IsDir() {
-		http.Error(w, "Destination must be a directory", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Destination must be a directory", nil)
 		return
 	}
 
@@ -830,6 +1174,14 @@ func (h *ZoneFileHandler) BulkMoveZoneFiles(w http.ResponseWriter, r *http.Reque
 	}
 
 	for _, path := range req.Paths {
+		if isSharedFolderRoot(zoneID, path) {
+			resp.Failed = append(resp.Failed, BulkErrorDetail{
+				Path:  path,
+				Error: "cannot move the shared folder",
+			})
+			continue
+		}
+
 		fullOldPath, _, err := h.resolveZonePath(zoneID, path, user)
 		if err != nil {
 			resp.Failed = append(resp.Failed, BulkErrorDetail{
@@ -853,6 +1205,14 @@ func (h *ZoneFileHandler) BulkMoveZoneFiles(w http.ResponseWriter, r *http.Reque
 			continue
 		}
 
+		if err := checkFileLock(h.store, fullOldPath, userCtx.UserID, true); err != nil {
+			resp.Failed = append(resp.Failed, BulkErrorDetail{
+				Path:  path,
+				Error: err.Error(),
+			})
+			continue
+		}
+
 		if err := os.Rename(fullOldPath, fullNewPath); err != nil {
 			resp.Failed = append(resp.Failed, BulkErrorDetail{
 				Path:  path,
@@ -861,6 +1221,10 @@ func (h *ZoneFileHandler) BulkMoveZoneFiles(w http.ResponseWriter, r *http.Reque
 			continue
 		}
 
+		moveFileRecords(h.store, fullOldPath, fullNewPath)
+		unindexPath(h.store, fullOldPath)
+		indexPath(h.store, fullNewPath)
+
 		resp.Moved = append(resp.Moved, BulkMoveResult{
 			OldPath: path,
 			NewPath: newRelPath,
@@ -880,7 +1244,7 @@ func (h *ZoneFileHandler) BulkMoveZoneFiles(w http.ResponseWriter, r *http.Reque
 func (h *ZoneFileHandler) GetZoneFolders(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -892,12 +1256,19 @@ func (h *ZoneFileHandler) GetZoneFolders(w http.ResponseWriter, r *http.Request)
 
 	user := userFromContext(userCtx)
 
-	fullPath, zone, err := h.resolveZonePath(zoneID, relativePath, user)
+	fullPath, zone, pool, err := h.resolveZonePathWithPool(zoneID, relativePath, user)
 	if err != nil {
 		if os.IsPermission(err) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
+		}
+		return
+	}
+
+	if pool.IsS3() {
+		if b, ok := zoneBackend(w, pool); ok {
+			h.listBackendFiles(w, b, pool, fullPath, relativePath, fileops.ListOptions{FilterType: "folder"}, true)
 		}
 		return
 	}
@@ -915,10 +1286,14 @@ func (h *ZoneFileHandler) GetZoneFolders(w http.ResponseWriter, r *http.Request)
 			json.NewEncoder(w).Encode([]interface{}{})
 			return
 		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
 		return
 	}
 
+	if zone.ZoneType != models.ZoneTypePersonal && filepath.Clean("/"+relativePath) == "/" {
+		files = hideReservedDirs(files)
+	}
+
 	// Filter to only directories
 	folders := []fileops.FileInfo{}
 	for _, f := range files {
@@ -933,18 +1308,20 @@ func (h *ZoneFileHandler) GetZoneFolders(w http.ResponseWriter, r *http.Request)
 
 // ZoneStatsResponse contains recursive statistics for a zone
 type ZoneStatsResponse struct {
-	ZoneID    string `json:"zone_id"`
-	ZoneName  string `json:"zone_name"`
-	TotalSize int64  `json:"total_size"`
-	FileCount int64  `json:"file_count"`
-	DirCount  int64  `json:"dir_count"`
+	ZoneID    string     `json:"zone_id"`
+	ZoneName  string     `json:"zone_name"`
+	TotalSize int64      `json:"total_size"`
+	FileCount int64      `json:"file_count"`
+	DirCount  int64      `json:"dir_count"`
+	ScannedAt *time.Time `json:"scanned_at,omitempty"` // When the usage was last counted (cached stats only)
 }
 
-// GetZoneStats returns recursive file statistics for a zone
+// GetZoneStats returns recursive file statistics for a zone.
+// Stats come from the usage tracker; pass refresh=true to recount the zone first.
 func (h *ZoneFileHandler) GetZoneStats(w http.ResponseWriter, r *http.Request) {
 	userCtx := middleware.GetUserContext(r)
 	if userCtx == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -952,22 +1329,57 @@ func (h *ZoneFileHandler) GetZoneStats(w http.ResponseWriter, r *http.Request) {
 	user := userFromContext(userCtx)
 
 	// Resolve zone path at root level
-	fullPath, zone, err := h.resolveZonePath(zoneID, "/", user)
+	fullPath, zone, pool, err := h.resolveZonePathWithPool(zoneID, "/", user)
 	if err != nil {
 		if os.IsPermission(err) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden", nil)
 		} else {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeZoneNotFound, err.Error(), nil)
 		}
 		return
 	}
 
+	if pool.IsS3() {
+		b, ok := zoneBackend(w, pool)
+		if !ok {
+			return
+		}
+		size, files, dirs, err := b.Usage(backendPath(pool, fullPath))
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ZoneStatsResponse{
+			ZoneID:    zone.ID,
+			ZoneName:  zone.Name,
+			TotalSize: size,
+			FileCount: files,
+			DirCount:  dirs,
+		})
+		return
+	}
+
 	// Auto-provision if needed
 	if zone.AutoProvision && zone.ZoneType == models.ZoneTypePersonal {
 		os.MkdirAll(fullPath, 0755)
 	}
 
-	// Walk the directory tree and count files/sizes
+	refresh := r.URL.Query().Get("refresh") == "true"
+	if totals, err := dirUsageTotals(h.store, zone.ID, filepath.Join(pool.Path, zone.Path), fullPath, refresh); err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ZoneStatsResponse{
+			ZoneID:    zone.ID,
+			ZoneName:  zone.Name,
+			TotalSize: totals.Size,
+			FileCount: totals.FileCount,
+			DirCount:  totals.DirCount,
+			ScannedAt: &totals.ScannedAt,
+		})
+		return
+	}
+
+	// Usage tracking is unavailable (JSON store): walk the directory tree and count files/sizes
 	var totalSize int64
 	var fileCount int64
 	var dirCount int64
@@ -978,6 +1390,10 @@ func (h *ZoneFileHandler) GetZoneStats(w http.ResponseWriter, r *http.Request) {
 			return nil
 		}
 		if info.IsDir() {
+			// Skip the zone trash and version store
+			if isReservedZoneDir(info.Name()) && filepath.Dir(path) == fullPath && zone.ZoneType != models.ZoneTypePersonal {
+				return filepath.SkipDir
+			}
 			// Don't count the root directory itself
 			if path != fullPath {
 				dirCount++
@@ -990,7 +1406,7 @@ func (h *ZoneFileHandler) GetZoneStats(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil {
-		http.Error(w, "Failed to calculate stats: "+err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, "Failed to calculate stats: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/storage"
+)
+
+// ZFSVolume represents a ZFS volume (zvol), a block device backed by a pool
+type ZFSVolume struct {
+	Name        string `json:"name"`
+	Size        int64  `json:"size"` // volsize
+	Used        int64  `json:"used"`
+	Referenced  int64  `json:"referenced"`
+	BlockSize   int64  `json:"block_size"` // volblocksize
+	Compression string `json:"compression"`
+	Sparse      bool   `json:"sparse"` // No space is reserved for the volume
+	Device      string `json:"device"`
+	ISCSITarget string `json:"iscsi_target,omitempty"` // Name of the iSCSI target exporting the volume
+}
+
+var (
+	// zvolSizeRegex validates a volume size such as "100G" or "1.5T"
+	zvolSizeRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[KMGTP]?$`)
+
+	zvolBlockSizes   = map[string]bool{"4K": true, "8K": true, "16K": true, "32K": true, "64K": true, "128K": true}
+	zvolCompressions = map[string]bool{"on": true, "off": true, "lz4": true, "zstd": true, "gzip": true, "lzjb": true, "zle": true}
+)
+
+// validateZvolName checks that name is a valid dataset name below a pool
+func validateZvolName(name string) error {
+	if err := validateZFSDatasetName(name); err != nil {
+		return err
+	}
+	if !strings.Contains(name, "/") || strings.ContainsAny(name, "@#") {
+		return fmt.Errorf("volume name must be <pool>/<name>")
+	}
+	return nil
+}
+
+// zvolExists reports whether name is an existing ZFS volume
+func zvolExists(name string) bool {
+	output, err := exec.Command("zfs", "list", "-H", "-o", "name", "-t", "volume", name).Output()
+	return err == nil && strings.TrimSpace(string(output)) == name
+}
+
+// zvolTargets maps each exported volume to the name of the iSCSI target exporting it
+func zvolTargets(store storage.DataStore) map[string]string {
+	targets := make(map[string]string)
+	for _, target := range store.ListISCSITargets() {
+		for _, lun := range target.LUNs {
+			targets[lun.Zvol] = target.Name
+		}
+	}
+	return targets
+}
+
+// ListZFSVolumes lists all ZFS volumes
+func ListZFSVolumes(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		volumes := []ZFSVolume{}
+
+		output, err := exec.Command("zfs", "list", "-H", "-p", "-t", "volume", "-o",
+			"name,volsize,used,referenced,volblocksize,compression,refreservation").CombinedOutput()
+		if err != nil {
+			// No volumes or zfs not available
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(volumes)
+			return
+		}
+
+		exported := zvolTargets(store)
+		scanner := bufio.NewScanner(strings.NewReader(string(output)))
+		for scanner.Scan() {
+			fields := strings.Split(scanner.Text(), "\t")
+			if len(fields) < 7 {
+				continue
+			}
+			volume := ZFSVolume{
+				Name:        fields[0],
+				Compression: fields[5],
+				Sparse:      fields[6] == "none" || fields[6] == "0",
+				Device:      "/dev/zvol/" + fields[0],
+				ISCSITarget: exported[fields[0]],
+			}
+			volume.Size, _ = strconv.ParseInt(fields[1], 10, 64)
+			volume.Used, _ = strconv.ParseInt(fields[2], 10, 64)
+			volume.Referenced, _ = strconv.ParseInt(fields[3], 10, 64)
+			volume.BlockSize, _ = strconv.ParseInt(fields[4], 10, 64)
+			volumes = append(volumes, volume)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(volumes)
+	}
+}
+
+// CreateZFSVolume creates a ZFS volume
+func CreateZFSVolume() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name        string `json:"name"`
+			Size        string `json:"size"`       // e.g., "100G"
+			BlockSize   string `json:"block_size"` // 4K-128K, fixed at creation
+			Sparse      bool   `json:"sparse"`     // Thin provisioned: no space is reserved
+			Compression string `json:"compression"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateZvolName(req.Name); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		size := strings.ToUpper(strings.TrimSpace(req.Size))
+		if !zvolSizeRegex.MatchString(size) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid size: use a number with optional unit (K, M, G, T, P)", nil)
+			return
+		}
+		blockSize := strings.ToUpper(req.BlockSize)
+		if blockSize != "" && !zvolBlockSizes[blockSize] {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid block size: must be 4K, 8K, 16K, 32K, 64K or 128K", nil)
+			return
+		}
+		if req.Compression != "" && !zvolCompressions[req.Compression] {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid compression: must be on, off, lz4, zstd, gzip, lzjb or zle", nil)
+			return
+		}
+
+		args := []string{"zfs", "create"}
+		if req.Sparse {
+			args = append(args, "-s")
+		}
+		args = append(args, "-V", size)
+		if blockSize != "" {
+			args = append(args, "-b", blockSize)
+		}
+		if req.Compression != "" {
+			args = append(args, "-o", "compression="+req.Compression)
+		}
+		args = append(args, req.Name)
+
+		cmd := exec.Command("sudo", args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to create volume: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Volume '%s' created successfully", req.Name),
+			"device":  "/dev/zvol/" + req.Name,
+		})
+	}
+}
+
+// ResizeZFSVolume grows a ZFS volume. Shrinking is refused because it cuts off the end of the
+// block device and whatever filesystem the client keeps on it.
+func ResizeZFSVolume() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+			Size string `json:"size"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateZvolName(req.Name); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		size := strings.ToUpper(strings.TrimSpace(req.Size))
+		if !zvolSizeRegex.MatchString(size) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid size: use a number with optional unit (K, M, G, T, P)", nil)
+			return
+		}
+		newSize, err := parseSize(size)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		output, err := exec.Command("zfs", "get", "-H", "-p", "-o", "value", "volsize", req.Name).CombinedOutput()
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeVolumeNotFound, fmt.Sprintf("Volume '%s' not found: %s", req.Name, commandError(output, err)), nil)
+			return
+		}
+		currentSize, _ := strconv.ParseUint(strings.TrimSpace(string(output)), 10, 64)
+		if newSize < currentSize {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, fmt.Sprintf("Volume is %s; shrinking a volume is not supported", formatBytes(currentSize)), nil)
+			return
+		}
+
+		cmd := exec.Command("sudo", "zfs", "set", "volsize="+size, req.Name)
+		output, err = cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to resize volume: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Volume '%s' resized to %s", req.Name, size),
+		})
+	}
+}
+
+// DestroyZFSVolume destroys a ZFS volume that is not exported over iSCSI
+func DestroyZFSVolume(store storage.DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name      string `json:"name"`
+			Recursive bool   `json:"recursive"` // Also destroy its snapshots
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "Invalid request body", nil)
+			return
+		}
+
+		if err := validateZvolName(req.Name); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+			return
+		}
+		if !zvolExists(req.Name) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeVolumeNotFound, fmt.Sprintf("Volume '%s' not found", req.Name), nil)
+			return
+		}
+		if target, ok := zvolTargets(store)[req.Name]; ok {
+			apierror.Write(w, http.StatusConflict, apierror.CodeConflict, fmt.Sprintf("Volume is exported by iSCSI target '%s'", target), nil)
+			return
+		}
+
+		args := []string{"zfs", "destroy"}
+		if req.Recursive {
+			args = append(args, "-r")
+		}
+		args = append(args, req.Name)
+
+		cmd := exec.Command("sudo", args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			apierror.Error(w, fmt.Sprintf("Failed to destroy volume: %s - %s", err.Error(), string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Volume '%s' destroyed", req.Name),
+		})
+	}
+}
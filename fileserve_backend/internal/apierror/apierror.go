@@ -0,0 +1,187 @@
+// Package apierror writes error responses as a JSON envelope:
+//
+//	{"code": "ZONE_NOT_FOUND", "message": "Zone not found", "details": {...}, "request_id": "..."}
+//
+// Clients branch on code, which is stable, and show message, which may change. Client errors
+// (4xx) are written with Write and one of the Code constants, so rewording a message never
+// changes its code. Error is a drop-in replacement for http.Error meant for server errors: it
+// derives the code from the message and status, and gives client errors the code of their status.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RequestIDHeader carries the ID of a request, set on responses by middleware.RequestID
+const RequestIDHeader = "X-Request-ID"
+
+// Codes of statuses, for client errors no more specific code describes
+const (
+	CodeBadRequest          = "BAD_REQUEST"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeForbidden           = "FORBIDDEN"
+	CodeNotFound            = "NOT_FOUND"
+	CodeMethodNotAllowed    = "METHOD_NOT_ALLOWED"
+	CodeConflict            = "CONFLICT"
+	CodeGone                = "GONE"
+	CodePreconditionFailed  = "PRECONDITION_FAILED"
+	CodePayloadTooLarge     = "PAYLOAD_TOO_LARGE"
+	CodeRangeNotSatisfiable = "RANGE_NOT_SATISFIABLE"
+	CodeUnprocessableEntity = "UNPROCESSABLE_ENTITY"
+	CodeLocked              = "LOCKED"
+	CodeRateLimited         = "RATE_LIMITED"
+	CodeInternalError       = "INTERNAL_ERROR"
+)
+
+// Codes of resources that do not exist
+const (
+	CodeAlertNotFound           = "ALERT_NOT_FOUND"
+	CodeBackupNotFound          = "BACKUP_NOT_FOUND"
+	CodeChannelNotFound         = "CHANNEL_NOT_FOUND"
+	CodeChecksumNotFound        = "CHECKSUM_NOT_FOUND"
+	CodeContainerNotFound       = "CONTAINER_NOT_FOUND"
+	CodeDatasetNotFound         = "DATASET_NOT_FOUND"
+	CodeDeviceNotFound          = "DEVICE_NOT_FOUND"
+	CodeExportNotFound          = "EXPORT_NOT_FOUND"
+	CodeFileNotFound            = "FILE_NOT_FOUND"
+	CodeFolderNotFound          = "FOLDER_NOT_FOUND"
+	CodeFolderShareNotFound     = "FOLDER_SHARE_NOT_FOUND"
+	CodeGroupNotFound           = "GROUP_NOT_FOUND"
+	CodeGuestNotFound           = "GUEST_NOT_FOUND"
+	CodeISCSITargetNotFound     = "ISCSI_TARGET_NOT_FOUND"
+	CodeJobNotFound             = "JOB_NOT_FOUND"
+	CodeLockNotFound            = "LOCK_NOT_FOUND"
+	CodeLockoutNotFound         = "LOCKOUT_NOT_FOUND"
+	CodeLogicalVolumeNotFound   = "LOGICAL_VOLUME_NOT_FOUND"
+	CodeObjectNotFound          = "OBJECT_NOT_FOUND"
+	CodePartitionNotFound       = "PARTITION_NOT_FOUND"
+	CodePasskeyNotFound         = "PASSKEY_NOT_FOUND"
+	CodePathNotFound            = "PATH_NOT_FOUND"
+	CodePoolNotFound            = "POOL_NOT_FOUND"
+	CodeProcessNotFound         = "PROCESS_NOT_FOUND"
+	CodeQuarantineItemNotFound  = "QUARANTINE_ITEM_NOT_FOUND"
+	CodeQuotaNotFound           = "QUOTA_NOT_FOUND"
+	CodeRAIDArrayNotFound       = "RAID_ARRAY_NOT_FOUND"
+	CodeReplicationJobNotFound  = "REPLICATION_JOB_NOT_FOUND"
+	CodeRetentionPolicyNotFound = "RETENTION_POLICY_NOT_FOUND"
+	CodeScheduleNotFound        = "SCHEDULE_NOT_FOUND"
+	CodeSessionNotFound         = "SESSION_NOT_FOUND"
+	CodeShareLinkNotFound       = "SHARE_LINK_NOT_FOUND"
+	CodeShareNotFound           = "SHARE_NOT_FOUND"
+	CodeSnapshotPolicyNotFound  = "SNAPSHOT_POLICY_NOT_FOUND"
+	CodeSpareNotFound           = "SPARE_NOT_FOUND"
+	CodeTokenNotFound           = "TOKEN_NOT_FOUND"
+	CodeTransferCapNotFound     = "TRANSFER_CAP_NOT_FOUND"
+	CodeTrashItemNotFound       = "TRASH_ITEM_NOT_FOUND"
+	CodeUploadSessionNotFound   = "UPLOAD_SESSION_NOT_FOUND"
+	CodeUserNotFound            = "USER_NOT_FOUND"
+	CodeVersionNotFound         = "VERSION_NOT_FOUND"
+	CodeVolumeNotFound          = "VOLUME_NOT_FOUND"
+	CodeZoneNotFound            = "ZONE_NOT_FOUND"
+)
+
+// Other codes
+const (
+	CodeInvalidRequestBody = "INVALID_REQUEST_BODY"
+	CodeInvalidPath        = "INVALID_PATH"
+	CodeInvalidToken       = "INVALID_TOKEN"
+	CodeInvalidCredentials = "INVALID_CREDENTIALS"
+	CodeSessionRevoked     = "SESSION_REVOKED"
+	CodeZoneReadOnly       = "ZONE_READ_ONLY"
+	CodeShareUnavailable   = "SHARE_UNAVAILABLE"
+	CodeFieldRequired      = "FIELD_REQUIRED"
+	CodeAlreadyExists      = "ALREADY_EXISTS"
+	CodeBusy               = "BUSY"
+	CodeDeviceMounted      = "DEVICE_MOUNTED"
+	CodeUploadTooLarge     = "UPLOAD_TOO_LARGE"
+	CodeCSRFFailed         = "CSRF_FAILED"
+	CodeCaptchaRequired    = "CAPTCHA_REQUIRED"
+	CodeUnknownQuery       = "UNKNOWN_QUERY"
+	CodeInvalidResponse    = "INVALID_RESPONSE"
+	CodeShuttingDown       = "SHUTTING_DOWN"
+	CodeTransferCapReached = "TRANSFER_CAP_REACHED"
+	CodeOnBattery          = "ON_BATTERY"
+	CodeFeatureDisabled    = "FEATURE_DISABLED"
+)
+
+// statusCodes are the codes of responses no message rule matches
+var statusCodes = map[int]string{
+	http.StatusBadRequest:                   CodeBadRequest,
+	http.StatusUnauthorized:                 CodeUnauthorized,
+	http.StatusForbidden:                    CodeForbidden,
+	http.StatusNotFound:                     CodeNotFound,
+	http.StatusMethodNotAllowed:             CodeMethodNotAllowed,
+	http.StatusConflict:                     CodeConflict,
+	http.StatusGone:                         CodeGone,
+	http.StatusPreconditionFailed:           CodePreconditionFailed,
+	http.StatusRequestEntityTooLarge:        CodePayloadTooLarge,
+	http.StatusRequestedRangeNotSatisfiable: CodeRangeNotSatisfiable,
+	http.StatusUnprocessableEntity:          CodeUnprocessableEntity,
+	http.StatusLocked:                       CodeLocked,
+	http.StatusTooManyRequests:              CodeRateLimited,
+	http.StatusInternalServerError:          CodeInternalError,
+	http.StatusNotImplemented:               "NOT_IMPLEMENTED",
+	http.StatusBadGateway:                   "BAD_GATEWAY",
+	http.StatusServiceUnavailable:           "UNAVAILABLE",
+	http.StatusGatewayTimeout:               "TIMEOUT",
+	http.StatusInsufficientStorage:          "INSUFFICIENT_STORAGE",
+}
+
+// Message rules of server errors, checked in order
+var (
+	mountedPattern = regexp.MustCompile(`(?i)\b(?:is currently mounted|has mounted|is mounted at)\b`)
+	existsPattern  = regexp.MustCompile(`(?i)\balready exists\b`)
+	busyPattern    = regexp.MustCompile(`(?i)\b(?:already running|is running|in progress|is busy)\b`)
+	nonWordPattern = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+// Envelope is the body of an error response
+type Envelope struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// CodeFor derives the code of an error response from its status and, for server errors, its
+// message. Client errors get the code of their status.
+func CodeFor(message string, status int) string {
+	if status >= http.StatusInternalServerError {
+		switch {
+		case mountedPattern.MatchString(message):
+			return CodeDeviceMounted
+		case existsPattern.MatchString(message):
+			return CodeAlreadyExists
+		case busyPattern.MatchString(message):
+			return CodeBusy
+		}
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ToUpper(strings.Trim(nonWordPattern.ReplaceAllString(http.StatusText(status), "_"), "_"))
+}
+
+// Write responds with an error envelope
+func Write(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Envelope{
+		Code:      code,
+		Message:   strings.TrimSpace(message),
+		Details:   details,
+		RequestID: h.Get(RequestIDHeader),
+	})
+}
+
+// Error responds with an error envelope, deriving the code from the message and status.
+// It takes the same arguments as http.Error. Use Write for client errors.
+func Error(w http.ResponseWriter, message string, status int) {
+	Write(w, status, CodeFor(strings.TrimSpace(message), status), message, nil)
+}
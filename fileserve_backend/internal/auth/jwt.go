@@ -12,16 +12,61 @@ type Claims struct {
 	Username string   `json:"username"`
 	IsAdmin  bool     `json:"is_admin"`
 	Groups   []string `json:"groups"`
+	Guest    bool     `json:"guest,omitempty"`
+
+	// Username of the admin acting as this user, for impersonation tokens
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID, username string, isAdmin bool, groups []string, secret string, duration time.Duration) (string, error) {
+// GenerateToken issues a session token. The session ID becomes the token ID, which the auth
+// middleware checks against the denylist of revoked sessions.
+func GenerateToken(sessionID, userID, username string, isAdmin bool, groups []string, secret string, duration time.Duration) (string, error) {
 	claims := Claims{
 		UserID:   userID,
 		Username: username,
 		IsAdmin:  isAdmin,
 		Groups:   groups,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// GenerateGuestToken issues a token for a guest account. Guest tokens carry no admin rights or
+// groups; the guest's zones and expiry are looked up on every request.
+func GenerateGuestToken(sessionID, userID, username, secret string, duration time.Duration) (string, error) {
+	claims := Claims{
+		UserID:   userID,
+		Username: username,
+		Guest:    true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// GenerateImpersonationToken issues a token that lets an admin act as another user. The
+// impersonating admin is recorded in the token so requests made with it can be audited.
+func GenerateImpersonationToken(sessionID, userID, username string, groups []string, guest bool, impersonatedBy, secret string, duration time.Duration) (string, error) {
+	claims := Claims{
+		UserID:         userID,
+		Username:       username,
+		Groups:         groups,
+		Guest:          guest,
+		ImpersonatedBy: impersonatedBy,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
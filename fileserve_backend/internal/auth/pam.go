@@ -63,6 +63,11 @@ func AuthenticatePAM(username, password string) (*PAMUser, error) {
 		return nil, fmt.Errorf("account validation failed: %w", err)
 	}
 
+	return LookupSystemUser(username)
+}
+
+// LookupSystemUser returns a system user with its groups, without authenticating it
+func LookupSystemUser(username string) (*PAMUser, error) {
 	// Get user information from the system
 	sysUser, err := user.Lookup(username)
 	if err != nil {
@@ -0,0 +1,167 @@
+// Package clamav scans files with a clamd daemon using the INSTREAM protocol.
+package clamav
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// chunkSize is the size of each INSTREAM chunk sent to clamd
+const chunkSize = 64 * 1024
+
+// Result is the outcome of a scan
+type Result struct {
+	Infected  bool
+	Signature string // Name of the detected malware
+}
+
+// Client talks to clamd over TCP ("host:port" or "tcp://host:port")
+// or a Unix socket ("unix:/path" or "/path")
+type Client struct {
+	Address string
+	Timeout time.Duration
+}
+
+// New creates a client for the given clamd address
+func New(address string) *Client {
+	return &Client{Address: address, Timeout: 2 * time.Minute}
+}
+
+func (c *Client) dial() (net.Conn, error) {
+	network, addr := "tcp", c.Address
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+	case strings.HasPrefix(addr, "/"):
+		network = "unix"
+	default:
+		addr = strings.TrimPrefix(addr, "tcp://")
+	}
+
+	conn, err := net.DialTimeout(network, addr, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to clamd at %s: %w", c.Address, err)
+	}
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	return conn, nil
+}
+
+// command sends a null-terminated command and returns the reply without its terminator
+func (c *Client) command(conn net.Conn, cmd string) (string, error) {
+	if _, err := conn.Write([]byte("z" + cmd + "\x00")); err != nil {
+		return "", err
+	}
+	return readReply(conn)
+}
+
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// Ping checks that clamd is reachable
+func (c *Client) Ping() error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reply, err := c.command(conn, "PING")
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply: %s", reply)
+	}
+	return nil
+}
+
+// Scan streams r to clamd and reports whether it contains malware
+func (c *Client) Scan(r io.Reader) (*Result, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return nil, c.streamError(conn, err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return nil, c.streamError(conn, err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	// A zero-length chunk ends the stream
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return nil, c.streamError(conn, err)
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return nil, err
+	}
+	return parseReply(reply)
+}
+
+// streamError prefers the reason clamd gave for closing the stream (such as the size limit)
+func (c *Client) streamError(conn net.Conn, err error) error {
+	if reply, readErr := readReply(conn); readErr == nil && reply != "" {
+		return fmt.Errorf("clamd: %s", reply)
+	}
+	return err
+}
+
+// ScanFile scans a file on disk
+func (c *Client) ScanFile(path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return c.Scan(f)
+}
+
+// parseReply interprets an INSTREAM reply such as "stream: OK" or "stream: Eicar-Signature FOUND"
+func parseReply(reply string) (*Result, error) {
+	status := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case status == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	case strings.HasSuffix(status, " ERROR"):
+		return nil, fmt.Errorf("clamd: %s", strings.TrimSuffix(status, " ERROR"))
+	default:
+		return nil, fmt.Errorf("unexpected clamd reply: %s", reply)
+	}
+}
@@ -0,0 +1,340 @@
+// Package docker manages containers through the Docker Engine API on a Unix socket. Podman serves
+// the same API on its socket, so both runtimes are supported.
+package docker
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sockets are where the Docker and Podman sockets are usually found
+var Sockets = []string{
+	"/var/run/docker.sock",
+	"/run/podman/podman.sock",
+}
+
+// ErrNotFound is returned for containers that do not exist
+var ErrNotFound = errors.New("container not found")
+
+// Container is a container as listed by the engine
+type Container struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	State   string            `json:"State"`  // created, running, paused, restarting, exited or dead
+	Status  string            `json:"Status"` // Such as "Up 2 hours"
+	Created int64             `json:"Created"`
+	Ports   []Port            `json:"Ports"`
+	Mounts  []Mount           `json:"Mounts"`
+	Labels  map[string]string `json:"Labels"`
+}
+
+// Port is a port published by a container
+type Port struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+// Mount is a volume or bind mount of a container
+type Mount struct {
+	Type        string `json:"Type"` // bind or volume
+	Name        string `json:"Name"` // Volume name
+	Source      string `json:"Source"`
+	Destination string `json:"Destination"`
+	RW          bool   `json:"RW"`
+}
+
+// Version describes the engine
+type Version struct {
+	Version    string `json:"Version"`
+	APIVersion string `json:"ApiVersion"`
+	Components []struct {
+		Name string `json:"Name"`
+	} `json:"Components"`
+}
+
+// Runtime returns docker or podman
+func (v *Version) Runtime() string {
+	for _, component := range v.Components {
+		if strings.Contains(strings.ToLower(component.Name), "podman") {
+			return "podman"
+		}
+	}
+	return "docker"
+}
+
+// Stats is a sample of the resource usage of a container
+type Stats struct {
+	CPUStats    cpuStats `json:"cpu_stats"`
+	PreCPUStats cpuStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+type cpuStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  int    `json:"online_cpus"`
+}
+
+// CPUPercent returns the CPU used between the two samples, where 100 is one CPU
+func (s *Stats) CPUPercent() float64 {
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	cpus := s.CPUStats.OnlineCPUs
+	if cpus == 0 {
+		cpus = len(s.CPUStats.CPUUsage.PercpuUsage)
+	}
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	return cpuDelta / systemDelta * float64(cpus) * 100
+}
+
+// MemoryUsage returns the memory used without the page cache, as docker stats shows it
+func (s *Stats) MemoryUsage() uint64 {
+	cache := s.MemoryStats.Stats["inactive_file"] // cgroup v2
+	if cache == 0 {
+		cache = s.MemoryStats.Stats["total_inactive_file"] // cgroup v1
+	}
+	if cache > s.MemoryStats.Usage {
+		return s.MemoryStats.Usage
+	}
+	return s.MemoryStats.Usage - cache
+}
+
+// BlockIO returns the bytes read from and written to block devices
+func (s *Stats) BlockIO() (read, write uint64) {
+	for _, entry := range s.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			read += entry.Value
+		case "write":
+			write += entry.Value
+		}
+	}
+	return read, write
+}
+
+// LogLine is a line written by a container
+type LogLine struct {
+	Stream string `json:"stream"` // stdout or stderr
+	Text   string `json:"text"`
+}
+
+// Client talks to the engine on a Unix socket
+type Client struct {
+	Socket string
+	http   *http.Client
+}
+
+// New creates a client for the engine listening on socket
+func New(socket string) *Client {
+	return &Client{
+		Socket: socket,
+		http: &http.Client{
+			Timeout: 60 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// FindSocket returns the first Docker or Podman socket that exists, or an empty string
+func FindSocket() string {
+	for _, socket := range Sockets {
+		if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return socket
+		}
+	}
+	return ""
+}
+
+// do sends a request to the engine and returns the response if its status is below 400
+func (c *Client) do(method, path string, query url.Values) (*http.Response, error) {
+	u := "http://engine" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach the container engine at %s: %w", c.Socket, err)
+	}
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	var body struct {
+		Message string `json:"message"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+	if body.Message == "" {
+		body.Message = resp.Status
+	}
+	return nil, fmt.Errorf("container engine: %s", body.Message)
+}
+
+// get decodes the JSON reply of a GET request into v
+func (c *Client) get(path string, query url.Values, v interface{}) error {
+	resp, err := c.do(http.MethodGet, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Version returns the engine version
+func (c *Client) Version() (*Version, error) {
+	var v Version
+	if err := c.get("/version", nil, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// List returns all containers, including stopped ones
+func (c *Client) List() ([]Container, error) {
+	var containers []Container
+	if err := c.get("/containers/json", url.Values{"all": {"1"}}, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// Start starts a container; starting a running container is not an error
+func (c *Client) Start(id string) error {
+	return c.action(id, "start", nil)
+}
+
+// Stop stops a container, killing it if it has not stopped after timeout
+func (c *Client) Stop(id string, timeout time.Duration) error {
+	return c.action(id, "stop", url.Values{"t": {strconv.Itoa(int(timeout.Seconds()))}})
+}
+
+// Restart stops and starts a container
+func (c *Client) Restart(id string, timeout time.Duration) error {
+	return c.action(id, "restart", url.Values{"t": {strconv.Itoa(int(timeout.Seconds()))}})
+}
+
+// action posts an action to a container
+func (c *Client) action(id, action string, query url.Values) error {
+	resp, err := c.do(http.MethodPost, "/containers/"+url.PathEscape(id)+"/"+action, query)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Stats returns a sample of the resource usage of a container
+func (c *Client) Stats(id string) (*Stats, error) {
+	var stats Stats
+	if err := c.get("/containers/"+url.PathEscape(id)+"/stats", url.Values{"stream": {"false"}}, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Logs returns the last lines a container wrote to stdout and stderr, with their timestamps
+func (c *Client) Logs(id string, lines int) ([]LogLine, error) {
+	// Without a TTY both streams are multiplexed in frames; with one the log is plain text
+	var inspect struct {
+		Config struct {
+			Tty bool `json:"Tty"`
+		} `json:"Config"`
+	}
+	if err := c.get("/containers/"+url.PathEscape(id)+"/json", nil, &inspect); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs", url.Values{
+		"stdout":     {"1"},
+		"stderr":     {"1"},
+		"timestamps": {"1"},
+		"tail":       {strconv.Itoa(lines)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := []LogLine{}
+	if inspect.Config.Tty {
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			result = append(result, LogLine{Stream: "stdout", Text: scanner.Text()})
+		}
+		return result, scanner.Err()
+	}
+
+	// Each frame is a header of the stream (1 stdout, 2 stderr), three zero bytes and the
+	// big-endian size, followed by the data
+	reader := bufio.NewReader(resp.Body)
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return result, nil
+			}
+			return result, err
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return result, err
+		}
+		stream := "stdout"
+		if header[0] == 2 {
+			stream = "stderr"
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			result = append(result, LogLine{Stream: stream, Text: line})
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package events
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types pushed to connected clients
+const (
+	TypeUploadCompleted      = "upload.completed"
+	TypeFileDownloaded       = "file.downloaded"
+	TypeShareAccessed        = "share.accessed"
+	TypeShareUploadReceived  = "share.upload_received"
+	TypeSnapshotCompleted    = "snapshot.completed"
+	TypeSnapshotFailed       = "snapshot.failed"
+	TypeReplicationCompleted = "replication.completed"
+	TypeReplicationFailed    = "replication.failed"
+	TypeMaintenanceCompleted = "maintenance.completed"
+	TypeMaintenanceFailed    = "maintenance.failed"
+	TypeRAIDStateChanged     = "raid.state_changed"
+	TypeRAIDSpareAssigned    = "raid.spare_assigned"
+	TypeStorageAlert         = "storage.alert"
+	TypeStorageAlertRaised   = "storage.alert_raised"
+	TypeStorageAlertResolved = "storage.alert_resolved"
+	TypeMalwareDetected      = "malware.detected"
+	TypeUPSPowerEvent        = "ups.power_event"
+	TypeLoginFailed          = "auth.login_failed"
+	TypeImpersonation        = "auth.impersonation"
+	TypeSecurityEvent        = "security.event"
+	TypeJobProgress          = "job.progress"
+	TypeJobCompleted         = "job.completed"
+	TypeJobFailed            = "job.failed"
+	TypeJobCancelled         = "job.cancelled"
+	TypeFilesChanged         = "files.changed"
+	TypeUserCreated          = "user.created"
+	TypeUserDeleted          = "user.deleted"
+	TypeZoneCreated          = "zone.created"
+	TypeZoneDeleted          = "zone.deleted"
+	TypeShareLinkCreated     = "share_link.created"
+	TypeShareLinkDeleted     = "share_link.deleted"
+	TypeSettingsChanged      = "settings.changed"
+	TypeSystemUpdated        = "system.updated"
+	TypeContainerControlled  = "container.controlled"
+	TypeObjectRestored       = "deleted.restored"
+	TypeObjectPurged         = "deleted.purged"
+)
+
+// transientTypes are progress updates that are only pushed to clients, not recorded
+var transientTypes = map[string]bool{
+	TypeJobProgress:  true,
+	TypeFilesChanged: true,
+}
+
+// Transient reports whether events of a type are progress updates that are not recorded
+func Transient(eventType string) bool {
+	return transientTypes[eventType]
+}
+
+// subscriberBuffer is the number of events queued per subscriber before new events are dropped
+const subscriberBuffer = 64
+
+// Event is a single notification published on the bus
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Time       time.Time   `json:"time"`
+	Data       interface{} `json:"data,omitempty"`
+	Actor      string      `json:"actor,omitempty"`       // User who acted, empty for system events
+	ObjectType string      `json:"object_type,omitempty"` // Kind of object acted on: user, zone, share_link, ...
+	ObjectID   string      `json:"object_id,omitempty"`
+	UserID     string      `json:"-"` // Recipient; empty = every user allowed by AdminOnly
+	UserIDs    []string    `json:"-"` // Recipients, when the event is meant for several users
+	AdminOnly  bool        `json:"-"`
+}
+
+// VisibleTo reports whether the event should be delivered to the given user
+func (e *Event) VisibleTo(userID string, isAdmin bool) bool {
+	if isAdmin {
+		return true
+	}
+	if e.AdminOnly {
+		return false
+	}
+	if len(e.UserIDs) > 0 {
+		return slices.Contains(e.UserIDs, userID)
+	}
+	return e.UserID == "" || e.UserID == userID
+}
+
+// Subscription receives events from a bus until it is closed
+type Subscription struct {
+	C   <-chan *Event
+	ch  chan *Event
+	bus *Bus
+}
+
+// Close unsubscribes from the bus
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// Bus fans out published events to all subscribers
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	record func(e *Event)
+}
+
+// SetRecorder sets a function called with every published event, except transient ones,
+// before it is sent to subscribers
+func (b *Bus) SetRecorder(record func(e *Event)) {
+	b.mu.Lock()
+	b.record = record
+	b.mu.Unlock()
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a new subscriber
+func (b *Bus) Subscribe() *Subscription {
+	ch := make(chan *Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, bus: b}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+func (b *Bus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+	b.mu.Unlock()
+}
+
+// Publish sends an event to every subscriber. Slow subscribers miss events rather than block the publisher.
+func (b *Bus) Publish(e *Event) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	record := b.record
+	b.mu.RUnlock()
+	if record != nil && !transientTypes[e.Type] {
+		record(e)
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribers returns the number of connected subscribers
+func (b *Bus) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// Default is the process-wide event bus
+var Default = NewBus()
+
+// Publish sends an event on the default bus
+func Publish(e *Event) {
+	Default.Publish(e)
+}
+
+// PublishToUser sends an event on the default bus that only the given user (and admins) will receive
+func PublishToUser(userID, eventType string, data interface{}) {
+	Default.Publish(&Event{Type: eventType, UserID: userID, Data: data})
+}
+
+// PublishToAdmins sends an event on the default bus that only admins will receive
+func PublishToAdmins(eventType string, data interface{}) {
+	Default.Publish(&Event{Type: eventType, AdminOnly: true, Data: data})
+}
+
+// PublishToUsers sends an event on the default bus that only the given users (and admins) will
+// receive. Without users the event only goes to admins.
+func PublishToUsers(userIDs []string, eventType string, data interface{}) {
+	Default.Publish(&Event{Type: eventType, UserIDs: userIDs, AdminOnly: len(userIDs) == 0, Data: data})
+}
@@ -0,0 +1,384 @@
+// Package exif reads the EXIF fields of JPEG and TIFF images used by the photo gallery:
+// capture date, camera, exposure settings and GPS position.
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNoExif is returned for images without EXIF data and for unsupported formats
+var ErrNoExif = errors.New("no EXIF data")
+
+// Tags read from the image IFD, the EXIF sub-IFD and the GPS sub-IFD
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagISO              = 0x8827
+	tagDateTimeOriginal = 0x9003
+	tagOffsetTimeOrig   = 0x9011
+	tagFocalLength      = 0x920A
+	tagPixelXDimension  = 0xA002
+	tagPixelYDimension  = 0xA003
+	tagLensModel        = 0xA434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// maxIFDEntries guards against corrupt directories claiming huge entry counts
+const maxIFDEntries = 1000
+
+// Data holds the EXIF fields of an image. Fields missing from the image are left zero or nil.
+type Data struct {
+	DateTaken    *time.Time // In UTC when the camera did not record a time zone
+	Make         string
+	Model        string
+	Lens         string
+	Orientation  int
+	Width        int
+	Height       int
+	ExposureTime string // e.g. "1/250"
+	FNumber      float64
+	ISO          int
+	FocalLength  float64 // Millimeters
+	Latitude     *float64
+	Longitude    *float64
+	Altitude     *float64 // Meters above sea level
+}
+
+// DecodeFile reads the EXIF data of a JPEG or TIFF file
+func DecodeFile(path string) (*Data, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Decode(f)
+}
+
+// Decode reads the EXIF data of a JPEG or TIFF image
+func Decode(r io.ReaderAt) (*Data, error) {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return nil, ErrNoExif
+	}
+
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		payload, err := findJPEGExif(bufio.NewReader(io.NewSectionReader(r, 2, math.MaxInt64-2)))
+		if err != nil {
+			return nil, err
+		}
+		return decodeTIFF(bytes.NewReader(payload))
+	case string(magic[:]) == "II*\x00" || string(magic[:]) == "MM\x00*":
+		return decodeTIFF(r)
+	}
+	return nil, ErrNoExif
+}
+
+// findJPEGExif returns the TIFF payload of the APP1 Exif segment, reading from just after SOI
+func findJPEGExif(r *bufio.Reader) ([]byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrNoExif
+		}
+		if b != 0xFF {
+			return nil, ErrNoExif
+		}
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xFF {
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return nil, ErrNoExif
+		}
+
+		// Start of scan or end of image: no metadata follows
+		if marker == 0xDA || marker == 0xD9 {
+			return nil, ErrNoExif
+		}
+		// Markers without a length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil, ErrNoExif
+		}
+		size := int(length) - 2
+
+		if marker != 0xE1 {
+			if _, err := r.Discard(size); err != nil {
+				return nil, ErrNoExif
+			}
+			continue
+		}
+
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, ErrNoExif
+		}
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+// tiffReader reads IFD entries from a TIFF structure
+type tiffReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+	seen  map[int64]bool
+}
+
+// ifdEntry is one directory entry; valueAt is where its value starts
+type ifdEntry struct {
+	typ     uint16
+	count   uint32
+	valueAt int64
+}
+
+// typeSizes are the sizes in bytes of the TIFF field types
+var typeSizes = map[uint16]int64{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+func decodeTIFF(r io.ReaderAt) (*Data, error) {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, ErrNoExif
+	}
+
+	t := &tiffReader{r: r, seen: make(map[int64]bool)}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, ErrNoExif
+	}
+	if t.order.Uint16(header[2:4]) != 42 {
+		return nil, ErrNoExif
+	}
+
+	ifd0, err := t.readIFD(int64(t.order.Uint32(header[4:8])))
+	if err != nil {
+		return nil, err
+	}
+
+	data := &Data{
+		Make:        t.ascii(ifd0[tagMake]),
+		Model:       t.ascii(ifd0[tagModel]),
+		Orientation: int(t.uint(ifd0[tagOrientation])),
+	}
+	dateTime := t.ascii(ifd0[tagDateTime])
+
+	if e, ok := ifd0[tagExifIFD]; ok {
+		if sub, err := t.readIFD(int64(t.uint(e))); err == nil {
+			if v := t.ascii(sub[tagDateTimeOriginal]); v != "" {
+				dateTime = v
+			}
+			data.DateTaken = parseDateTime(dateTime, t.ascii(sub[tagOffsetTimeOrig]))
+			data.Lens = t.ascii(sub[tagLensModel])
+			data.ISO = int(t.uint(sub[tagISO]))
+			data.Width = int(t.uint(sub[tagPixelXDimension]))
+			data.Height = int(t.uint(sub[tagPixelYDimension]))
+			data.FNumber = round(t.rational(sub[tagFNumber], 0), 1)
+			data.FocalLength = round(t.rational(sub[tagFocalLength], 0), 1)
+			data.ExposureTime = t.exposure(sub[tagExposureTime])
+		}
+	}
+	if data.DateTaken == nil {
+		data.DateTaken = parseDateTime(dateTime, "")
+	}
+
+	if e, ok := ifd0[tagGPSIFD]; ok {
+		if gps, err := t.readIFD(int64(t.uint(e))); err == nil {
+			data.Latitude = t.coordinate(gps[tagGPSLatitude], t.ascii(gps[tagGPSLatitudeRef]), "S")
+			data.Longitude = t.coordinate(gps[tagGPSLongitude], t.ascii(gps[tagGPSLongitudeRef]), "W")
+			if e, ok := gps[tagGPSAltitude]; ok {
+				alt := round(t.rational(e, 0), 1)
+				if ref, ok := gps[tagGPSAltitudeRef]; ok && t.uint(ref) == 1 {
+					alt = -alt
+				}
+				data.Altitude = &alt
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// readIFD reads the entries of the directory at offset, keyed by tag
+func (t *tiffReader) readIFD(offset int64) (map[uint16]ifdEntry, error) {
+	if offset <= 0 || t.seen[offset] {
+		return nil, ErrNoExif
+	}
+	t.seen[offset] = true
+
+	var countBuf [2]byte
+	if _, err := t.r.ReadAt(countBuf[:], offset); err != nil {
+		return nil, ErrNoExif
+	}
+	count := int(t.order.Uint16(countBuf[:]))
+	if count > maxIFDEntries {
+		return nil, fmt.Errorf("corrupt EXIF directory with %d entries", count)
+	}
+
+	buf := make([]byte, count*12)
+	if _, err := t.r.ReadAt(buf, offset+2); err != nil {
+		return nil, ErrNoExif
+	}
+
+	entries := make(map[uint16]ifdEntry, count)
+	for i := 0; i < count; i++ {
+		raw := buf[i*12 : (i+1)*12]
+		e := ifdEntry{
+			typ:     t.order.Uint16(raw[2:4]),
+			count:   t.order.Uint32(raw[4:8]),
+			valueAt: offset + 2 + int64(i*12) + 8,
+		}
+		size, ok := typeSizes[e.typ]
+		if !ok {
+			continue
+		}
+		// Values larger than four bytes are stored elsewhere
+		if size*int64(e.count) > 4 {
+			e.valueAt = int64(t.order.Uint32(raw[8:12]))
+		}
+		entries[t.order.Uint16(raw[0:2])] = e
+	}
+	return entries, nil
+}
+
+// ascii returns a string value without trailing NULs and padding
+func (t *tiffReader) ascii(e ifdEntry) string {
+	if e.typ != 2 || e.count == 0 || e.count > 4096 {
+		return ""
+	}
+	buf := make([]byte, e.count)
+	if _, err := t.r.ReadAt(buf, e.valueAt); err != nil {
+		return ""
+	}
+	if i := bytes.IndexByte(buf, 0); i >= 0 {
+		buf = buf[:i]
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// uint returns the first value of a BYTE, SHORT or LONG entry
+func (t *tiffReader) uint(e ifdEntry) uint32 {
+	if e.count == 0 {
+		return 0
+	}
+	switch e.typ {
+	case 1, 7:
+		var b [1]byte
+		if _, err := t.r.ReadAt(b[:], e.valueAt); err == nil {
+			return uint32(b[0])
+		}
+	case 3:
+		var b [2]byte
+		if _, err := t.r.ReadAt(b[:], e.valueAt); err == nil {
+			return uint32(t.order.Uint16(b[:]))
+		}
+	case 4:
+		var b [4]byte
+		if _, err := t.r.ReadAt(b[:], e.valueAt); err == nil {
+			return t.order.Uint32(b[:])
+		}
+	}
+	return 0
+}
+
+// rationalParts returns the numerator and denominator of the i-th RATIONAL or SRATIONAL value
+func (t *tiffReader) rationalParts(e ifdEntry, i int) (float64, float64, bool) {
+	if (e.typ != 5 && e.typ != 10) || uint32(i) >= e.count {
+		return 0, 0, false
+	}
+	var b [8]byte
+	if _, err := t.r.ReadAt(b[:], e.valueAt+int64(i)*8); err != nil {
+		return 0, 0, false
+	}
+	if e.typ == 10 {
+		return float64(int32(t.order.Uint32(b[0:4]))), float64(int32(t.order.Uint32(b[4:8]))), true
+	}
+	return float64(t.order.Uint32(b[0:4])), float64(t.order.Uint32(b[4:8])), true
+}
+
+// rational returns the i-th RATIONAL value as a float
+func (t *tiffReader) rational(e ifdEntry, i int) float64 {
+	num, den, ok := t.rationalParts(e, i)
+	if !ok || den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+// exposure formats an exposure time the way cameras show it ("1/250", "2")
+func (t *tiffReader) exposure(e ifdEntry) string {
+	num, den, ok := t.rationalParts(e, 0)
+	if !ok || num == 0 || den == 0 {
+		return ""
+	}
+	if num >= den {
+		return fmt.Sprintf("%g", round(num/den, 1))
+	}
+	return fmt.Sprintf("1/%g", math.Round(den/num))
+}
+
+// coordinate converts degrees, minutes and seconds to signed decimal degrees
+func (t *tiffReader) coordinate(e ifdEntry, ref, negative string) *float64 {
+	if e.count < 3 {
+		return nil
+	}
+	value := t.rational(e, 0) + t.rational(e, 1)/60 + t.rational(e, 2)/3600
+	if strings.EqualFold(ref, negative) {
+		value = -value
+	}
+	value = round(value, 6)
+	return &value
+}
+
+// parseDateTime parses an EXIF date ("2006:01:02 15:04:05") with an optional offset ("+02:00")
+func parseDateTime(value, offset string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	if offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", value+offset); err == nil {
+			return &t
+		}
+	}
+	t, err := time.Parse("2006:01:02 15:04:05", value)
+	if err != nil || t.Year() < 1900 {
+		return nil
+	}
+	return &t
+}
+
+func round(value float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(value*p) / p
+}
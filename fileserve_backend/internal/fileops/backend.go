@@ -0,0 +1,385 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileserv/internal/apierror"
+)
+
+// ========================================================================
+// Storage Backends - object storage behind non-local pools
+// ========================================================================
+
+// Backend abstracts the storage behind a pool. Paths are slash-separated and relative to the pool root.
+type Backend interface {
+	// Stat returns information about a file or folder
+	Stat(p string) (*FileInfo, error)
+	// List returns the direct children of a folder
+	List(p string) ([]FileInfo, error)
+	// Open reads length bytes of a file starting at offset (length < 0 reads to the end)
+	Open(p string, offset, length int64) (io.ReadCloser, error)
+	// Write stores the content of r as a file, replacing any existing file
+	Write(p string, r io.Reader, contentType string) (int64, error)
+	// Mkdir creates a folder (and implicitly its parents)
+	Mkdir(p string) error
+	// Remove deletes a file or a folder with all of its contents
+	Remove(p string) error
+	// Rename moves a file or folder
+	Rename(oldPath, newPath string) error
+	// Usage returns the total size, file count and folder count below a folder
+	Usage(p string) (size int64, files int64, dirs int64, err error)
+}
+
+// S3Backend stores pool data as objects in an S3 bucket. Folders are key prefixes;
+// empty folders are kept as zero-byte "<name>/" marker objects.
+type S3Backend struct {
+	client *S3Client
+	prefix string
+}
+
+// NewS3Backend creates a backend rooted at prefix within the client's bucket
+func NewS3Backend(client *S3Client, prefix string) *S3Backend {
+	return &S3Backend{client: client, prefix: strings.Trim(prefix, "/")}
+}
+
+// key maps a pool-relative path to an object key (without trailing slash)
+func (b *S3Backend) key(p string) string {
+	clean := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if b.prefix == "" {
+		return clean
+	}
+	if clean == "" {
+		return b.prefix
+	}
+	return b.prefix + "/" + clean
+}
+
+// dirPrefix returns the key prefix of everything inside a folder
+func (b *S3Backend) dirPrefix(p string) string {
+	if k := b.key(p); k != "" {
+		return k + "/"
+	}
+	return ""
+}
+
+// Check verifies the bucket is reachable with the configured credentials
+func (b *S3Backend) Check() error {
+	_, err := b.client.HasPrefix(b.dirPrefix("/"))
+	return err
+}
+
+func (b *S3Backend) Stat(p string) (*FileInfo, error) {
+	name := path.Base(path.Clean("/" + p))
+	if b.key(p) == b.prefix {
+		return newS3DirInfo(name, p), nil
+	}
+
+	obj, err := b.client.HeadObject(b.key(p))
+	if err == nil {
+		return newS3FileInfo(name, p, obj.Size, obj.LastModified), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	exists, err := b.client.HasPrefix(b.dirPrefix(p))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, os.ErrNotExist
+	}
+	return newS3DirInfo(name, p), nil
+}
+
+func (b *S3Backend) List(p string) ([]FileInfo, error) {
+	prefix := b.dirPrefix(p)
+	objects, prefixes, err := b.client.ListObjects(prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(objects) == 0 && len(prefixes) == 0 && b.key(p) != b.prefix {
+		return nil, os.ErrNotExist
+	}
+
+	files := make([]FileInfo, 0, len(objects)+len(prefixes))
+	for _, dir := range prefixes {
+		name := strings.TrimSuffix(strings.TrimPrefix(dir, prefix), "/")
+		if name == "" {
+			continue
+		}
+		files = append(files, *newS3DirInfo(name, path.Join("/", p, name)))
+	}
+	for _, obj := range objects {
+		name := strings.TrimPrefix(obj.Key, prefix)
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue // Folder marker
+		}
+		files = append(files, *newS3FileInfo(name, path.Join("/", p, name), obj.Size, obj.LastModified))
+	}
+	return files, nil
+}
+
+func (b *S3Backend) Open(p string, offset, length int64) (io.ReadCloser, error) {
+	rangeHeader := ""
+	if offset > 0 || length >= 0 {
+		end := ""
+		if length >= 0 {
+			end = strconv.FormatInt(offset+length-1, 10)
+		}
+		rangeHeader = fmt.Sprintf("bytes=%d-%s", offset, end)
+	}
+
+	resp, err := b.client.GetObject(b.key(p), rangeHeader)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *S3Backend) Write(p string, r io.Reader, contentType string) (int64, error) {
+	if contentType == "" {
+		contentType = getMimeType(path.Base(p))
+	}
+	return b.client.Upload(b.key(p), r, contentType)
+}
+
+func (b *S3Backend) Mkdir(p string) error {
+	return b.client.PutObject(b.dirPrefix(p), nil, "")
+}
+
+func (b *S3Backend) Remove(p string) error {
+	if b.key(p) == b.prefix {
+		return errors.New("cannot remove the pool root")
+	}
+
+	found := false
+	if _, err := b.client.HeadObject(b.key(p)); err == nil {
+		found = true
+		if err := b.client.DeleteObject(b.key(p)); err != nil {
+			return err
+		}
+	}
+
+	objects, _, err := b.client.ListObjects(b.dirPrefix(p), "")
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		found = true
+		if err := b.client.DeleteObject(obj.Key); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// Rename copies every affected object to its new key and then deletes the originals
+func (b *S3Backend) Rename(oldPath, newPath string) error {
+	oldKey, newKey := b.key(oldPath), b.key(newPath)
+	if oldKey == b.prefix || newKey == b.prefix {
+		return errors.New("cannot rename the pool root")
+	}
+	if oldKey == newKey {
+		return nil
+	}
+	if strings.HasPrefix(newKey+"/", oldKey+"/") {
+		return errors.New("cannot move a folder into itself")
+	}
+
+	if _, err := b.Stat(newPath); err == nil {
+		return os.ErrExist
+	}
+
+	if _, err := b.client.HeadObject(oldKey); err == nil {
+		if err := b.client.CopyObject(oldKey, newKey); err != nil {
+			return err
+		}
+		return b.client.DeleteObject(oldKey)
+	}
+
+	objects, _, err := b.client.ListObjects(oldKey+"/", "")
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return os.ErrNotExist
+	}
+	for _, obj := range objects {
+		target := newKey + "/" + strings.TrimPrefix(obj.Key, oldKey+"/")
+		if err := b.client.CopyObject(obj.Key, target); err != nil {
+			return err
+		}
+	}
+	for _, obj := range objects {
+		if err := b.client.DeleteObject(obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *S3Backend) Usage(p string) (int64, int64, int64, error) {
+	prefix := b.dirPrefix(p)
+	objects, _, err := b.client.ListObjects(prefix, "")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var size, files int64
+	dirs := make(map[string]bool)
+	for _, obj := range objects {
+		rel := strings.TrimPrefix(obj.Key, prefix)
+		if strings.HasSuffix(rel, "/") {
+			rel = strings.TrimSuffix(rel, "/")
+		} else {
+			files++
+			size += obj.Size
+			rel = path.Dir(rel)
+		}
+		for ; rel != "." && rel != "" && !dirs[rel]; rel = path.Dir(rel) {
+			dirs[rel] = true
+		}
+	}
+	return size, files, int64(len(dirs)), nil
+}
+
+func newS3DirInfo(name, p string) *FileInfo {
+	return &FileInfo{
+		Name:  name,
+		Path:  path.Clean("/" + p),
+		IsDir: true,
+		Mode:  "drwxr-xr-x",
+	}
+}
+
+func newS3FileInfo(name, p string, size int64, modTime time.Time) *FileInfo {
+	return &FileInfo{
+		Name:      name,
+		Path:      path.Clean("/" + p),
+		Size:      size,
+		ModTime:   modTime,
+		Mode:      "-rw-r--r--",
+		MimeType:  getMimeType(name),
+		Extension: strings.TrimPrefix(strings.ToLower(path.Ext(name)), "."),
+	}
+}
+
+// ListBackendDirectory lists a backend folder with the same filtering, sorting and pagination
+// as local listings. relativePath is the path shown to the client.
+func ListBackendDirectory(b Backend, p, relativePath string, opts ListOptions) (*ListResult, error) {
+	entries, err := b.List(p)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]FileInfo, 0, len(entries))
+	for _, f := range entries {
+		if opts.FilterType == "file" && f.IsDir {
+			continue
+		}
+		if opts.FilterType == "folder" && !f.IsDir {
+			continue
+		}
+		if slices.Contains(opts.Exclude, f.Name) {
+			continue
+		}
+		f.Path = path.Join("/", relativePath, f.Name)
+		files = append(files, f)
+	}
+
+	sortFiles(files, opts.SortBy, opts.SortDesc)
+	return pageFiles(files, opts.SortBy, opts)
+}
+
+// ServeBackendFile serves a backend file with single-range support (multi-range requests get the whole file)
+func ServeBackendFile(w http.ResponseWriter, r *http.Request, b Backend, p string, opts *TransferOptions) error {
+	info, err := b.Stat(p)
+	if err != nil {
+		return err
+	}
+	if info.IsDir {
+		return fmt.Errorf("cannot serve directory")
+	}
+
+	contentType := info.MimeType
+	if opts != nil && opts.ContentType != "" {
+		contentType = opts.ContentType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	filename := info.Name
+	if opts != nil && opts.Filename != "" {
+		filename = opts.Filename
+	}
+
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime.Unix(), info.Size)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", etag)
+
+	disposition := "inline"
+	if opts != nil && opts.ForceDownload {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, filename))
+
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == etag || match == "*") {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	offset, length := int64(0), int64(-1)
+	status := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		ranges, err := parseRangeHeader(rangeHeader, info.Size)
+		if err == nil && len(ranges) == 0 {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+			apierror.Write(w, http.StatusRequestedRangeNotSatisfiable, apierror.CodeRangeNotSatisfiable, "Range Not Satisfiable", nil)
+			return nil
+		}
+		if err == nil && len(ranges) == 1 {
+			offset = ranges[0].start
+			length = ranges[0].end - ranges[0].start + 1
+			status = http.StatusPartialContent
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", ranges[0].start, ranges[0].end, info.Size))
+		}
+	}
+
+	if info.Size == 0 {
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	body, err := b.Open(p, offset, length)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if length < 0 {
+		length = info.Size
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(status)
+	_, err = io.Copy(w, body)
+	return err
+}
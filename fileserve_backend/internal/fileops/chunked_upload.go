@@ -1,23 +1,34 @@
 package fileops
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/user"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"sync"
 	"time"
+
+	"fileserv/models"
 )
 
 // ChunkSize is the recommended chunk size for uploads (5MB)
 const DefaultChunkSize = 5 * 1024 * 1024
 
+// sessionDataFile is the file in a session's temp directory that chunks are written into at
+// their offset, so chunks may arrive concurrently and in any order
+const sessionDataFile = "data"
+
+// ErrDraining is returned for new sessions, chunks and finalizations while the manager
+// shuts down; the client should retry after the server restarts
+var ErrDraining = errors.New("server is shutting down, retry the upload shortly")
+
 // UploadSession represents an in-progress chunked upload
 type UploadSession struct {
 	ID             string            `json:"id"`
@@ -26,6 +37,7 @@ type UploadSession struct {
 	ChunkSize      int64             `json:"chunk_size"`
 	TotalChunks    int               `json:"total_chunks"`
 	UploadedChunks map[int]bool      `json:"uploaded_chunks"`
+	ZoneID         string            `json:"zone_id,omitempty"`
 	TargetPath     string            `json:"target_path"`
 	TempDir        string            `json:"temp_dir"`
 	CreatedAt      time.Time         `json:"created_at"`
@@ -34,9 +46,16 @@ type UploadSession struct {
 	OwnerID        string            `json:"owner_id"`
 	OwnerUsername  string            `json:"owner_username"` // System username for chown
 	Metadata       map[string]string `json:"metadata,omitempty"`
+	finalizing     bool              // Set while the file is assembled; chunks and other finalizations are refused
+	writes         sync.WaitGroup    // Chunk writes in progress, which finalization waits for
 	mu             sync.RWMutex
 }
 
+// dataPath returns the path of the file the chunks are written into
+func (s *UploadSession) dataPath() string {
+	return filepath.Join(s.TempDir, sessionDataFile)
+}
+
 // UploadProgress represents the current progress of an upload
 type UploadProgress struct {
 	SessionID      string  `json:"session_id"`
@@ -51,17 +70,28 @@ type UploadProgress struct {
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
+// SessionStore persists upload sessions so they survive restarts; storage.DataStore implements it
+type SessionStore interface {
+	SaveUploadSession(session *models.UploadSession) error
+	ListUploadSessions() []*models.UploadSession
+	DeleteUploadSession(id string) error
+	PruneUploadSessions(before time.Time) error
+}
+
 // ChunkedUploadManager manages chunked upload sessions
 type ChunkedUploadManager struct {
-	sessions     map[string]*UploadSession
-	baseTempDir  string
-	sessionTTL   time.Duration
-	mu           sync.RWMutex
-	cleanupDone  chan struct{}
+	sessions    map[string]*UploadSession
+	store       SessionStore
+	baseTempDir string
+	sessionTTL  time.Duration
+	mu          sync.RWMutex
+	draining    bool           // Set by Drain; new work is refused
+	inflight    sync.WaitGroup // Chunk writes and finalizations in progress
 }
 
-// NewChunkedUploadManager creates a new chunked upload manager
-func NewChunkedUploadManager(baseTempDir string) (*ChunkedUploadManager, error) {
+// NewChunkedUploadManager creates a new chunked upload manager. Sessions are kept in store
+// and restored from it, together with their chunk files in baseTempDir, on startup.
+func NewChunkedUploadManager(baseTempDir string, store SessionStore) (*ChunkedUploadManager, error) {
 	tempDir := filepath.Join(baseTempDir, "chunked_uploads")
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create temp directory: %w", err)
@@ -69,31 +99,79 @@ func NewChunkedUploadManager(baseTempDir string) (*ChunkedUploadManager, error)
 
 	m := &ChunkedUploadManager{
 		sessions:    make(map[string]*UploadSession),
+		store:       store,
 		baseTempDir: tempDir,
 		sessionTTL:  24 * time.Hour, // Sessions expire after 24 hours
-		cleanupDone: make(chan struct{}),
 	}
 
-	// Restore existing sessions from disk
+	// Restore existing sessions and remove the leftovers of expired ones
 	m.restoreSessions()
 
-	// Start cleanup goroutine
-	go m.cleanupLoop()
-
 	return m, nil
 }
 
-// Close stops the manager and cleans up resources
-func (m *ChunkedUploadManager) Close() {
-	close(m.cleanupDone)
+// begin registers a chunk write or finalization, failing once the manager is draining.
+// Callers must call m.inflight.Done when it returns nil.
+func (m *ChunkedUploadManager) begin() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.draining {
+		return ErrDraining
+	}
+	m.inflight.Add(1)
+	return nil
+}
+
+// Drain stops accepting new sessions and chunks, waits for in-flight chunk writes and
+// finalizations to finish and saves every session so uploads resume after a restart.
+// Sessions are saved even when ctx expires first; the error then reports the timeout.
+func (m *ChunkedUploadManager) Drain(ctx context.Context) error {
+	m.mu.Lock()
+	m.draining = true
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("chunk writes still in progress: %w", ctx.Err())
+	}
+
+	m.mu.RLock()
+	sessions := make([]*UploadSession, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.mu.RUnlock()
+
+	for _, session := range sessions {
+		if serr := m.persist(session); serr != nil && err == nil {
+			err = fmt.Errorf("failed to save upload session %s: %w", session.ID, serr)
+		}
+	}
+	return err
 }
 
-// CreateSession creates a new upload session
-func (m *ChunkedUploadManager) CreateSession(filename string, totalSize int64, targetPath string, ownerID string, ownerUsername string, chunkSize int64) (*UploadSession, error) {
+// CreateSession creates a new upload session. zoneID is recorded for the session's owner and
+// cleanup; targetPath is the resolved directory the file is assembled into.
+func (m *ChunkedUploadManager) CreateSession(filename string, totalSize int64, zoneID, targetPath string, ownerID string, ownerUsername string, chunkSize int64) (*UploadSession, error) {
 	if chunkSize <= 0 {
 		chunkSize = DefaultChunkSize
 	}
 
+	m.mu.RLock()
+	draining := m.draining
+	m.mu.RUnlock()
+	if draining {
+		return nil, ErrDraining
+	}
+
 	// Generate session ID
 	idBytes := make([]byte, 16)
 	if _, err := rand.Read(idBytes); err != nil {
@@ -113,6 +191,12 @@ func (m *ChunkedUploadManager) CreateSession(filename string, totalSize int64, t
 		return nil, fmt.Errorf("failed to create session temp directory: %w", err)
 	}
 
+	// The data file starts sparse at its final size; chunks fill it in at their offsets
+	if err := createSparseFile(filepath.Join(sessionTempDir, sessionDataFile), totalSize); err != nil {
+		os.RemoveAll(sessionTempDir)
+		return nil, fmt.Errorf("failed to create upload data file: %w", err)
+	}
+
 	now := time.Now()
 	session := &UploadSession{
 		ID:             sessionID,
@@ -121,6 +205,7 @@ func (m *ChunkedUploadManager) CreateSession(filename string, totalSize int64, t
 		ChunkSize:      chunkSize,
 		TotalChunks:    totalChunks,
 		UploadedChunks: make(map[int]bool),
+		ZoneID:         zoneID,
 		TargetPath:     targetPath,
 		TempDir:        sessionTempDir,
 		CreatedAt:      now,
@@ -131,13 +216,15 @@ func (m *ChunkedUploadManager) CreateSession(filename string, totalSize int64, t
 		Metadata:       make(map[string]string),
 	}
 
+	if err := m.persist(session); err != nil {
+		os.RemoveAll(sessionTempDir)
+		return nil, fmt.Errorf("failed to save upload session: %w", err)
+	}
+
 	m.mu.Lock()
 	m.sessions[sessionID] = session
 	m.mu.Unlock()
 
-	// Save session to disk for persistence
-	session.save()
-
 	return session, nil
 }
 
@@ -206,6 +293,11 @@ func (m *ChunkedUploadManager) UploadChunkWithOwner(sessionID string, chunkIndex
 
 // uploadChunkInternal is the internal implementation for chunk upload
 func (m *ChunkedUploadManager) uploadChunkInternal(sessionID string, chunkIndex int, data io.Reader) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.inflight.Done()
+
 	session, err := m.GetSession(sessionID)
 	if err != nil {
 		return err
@@ -215,38 +307,57 @@ func (m *ChunkedUploadManager) uploadChunkInternal(sessionID string, chunkIndex
 		return fmt.Errorf("invalid chunk index: %d (total chunks: %d)", chunkIndex, session.TotalChunks)
 	}
 
-	// Write chunk to temp file
-	chunkPath := filepath.Join(session.TempDir, fmt.Sprintf("chunk_%d", chunkIndex))
-	chunkFile, err := os.Create(chunkPath)
-	if err != nil {
-		return fmt.Errorf("failed to create chunk file: %w", err)
-	}
-	defer chunkFile.Close()
-
-	written, err := io.Copy(chunkFile, data)
-	if err != nil {
-		os.Remove(chunkPath)
-		return fmt.Errorf("failed to write chunk: %w", err)
+	// The write is counted under the lock that finalizing is set under, so finalization either
+	// refuses the chunk here or waits for it to be written
+	session.mu.Lock()
+	if session.finalizing {
+		session.mu.Unlock()
+		return fmt.Errorf("upload is being finalized")
 	}
+	session.writes.Add(1)
+	session.mu.Unlock()
+	defer session.writes.Done()
 
 	// Validate chunk size (last chunk may be smaller)
+	offset := int64(chunkIndex) * session.ChunkSize
 	expectedSize := session.ChunkSize
 	if chunkIndex == session.TotalChunks-1 {
-		expectedSize = session.TotalSize - (int64(chunkIndex) * session.ChunkSize)
+		expectedSize = session.TotalSize - offset
+	}
+
+	// Write the chunk at its offset of the data file. Other chunks are written concurrently to
+	// their own ranges; a failed or short write leaves the chunk unmarked, to be sent again.
+	dataFile, err := os.OpenFile(session.dataPath(), os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open upload data file: %w", err)
+	}
+	defer dataFile.Close()
+
+	written, err := io.Copy(io.NewOffsetWriter(dataFile, offset), io.LimitReader(data, expectedSize))
+	if err != nil {
+		return fmt.Errorf("failed to write chunk: %w", err)
 	}
 
 	if written != expectedSize {
-		os.Remove(chunkPath)
 		return fmt.Errorf("chunk size mismatch: expected %d, got %d", expectedSize, written)
 	}
 
+	// Data beyond the expected size would belong to the next chunk, so it is not written
+	if n, err := io.ReadFull(data, make([]byte, 1)); n > 0 {
+		return fmt.Errorf("chunk size mismatch: expected %d, got more", expectedSize)
+	} else if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to write chunk: %w", err)
+	}
+
 	// Mark chunk as uploaded
 	session.mu.Lock()
 	session.UploadedChunks[chunkIndex] = true
 	session.UpdatedAt = time.Now()
 	session.mu.Unlock()
 
-	session.save()
+	if err := m.persist(session); err != nil {
+		return fmt.Errorf("failed to save upload session: %w", err)
+	}
 
 	return nil
 }
@@ -319,73 +430,40 @@ func (m *ChunkedUploadManager) FinalizeWithOwner(sessionID string, ownerID strin
 
 // finalizeInternal is the internal implementation for finalization
 func (m *ChunkedUploadManager) finalizeInternal(sessionID string) (string, error) {
-	session, err := m.GetSession(sessionID)
-	if err != nil {
+	if err := m.begin(); err != nil {
 		return "", err
 	}
+	defer m.inflight.Done()
 
-	complete, err := m.IsComplete(sessionID)
+	session, err := m.GetSession(sessionID)
 	if err != nil {
 		return "", err
 	}
-	if !complete {
-		return "", fmt.Errorf("upload not complete")
+
+	if err := session.startFinalize(); err != nil {
+		return "", err
 	}
+	defer session.endFinalize()
 
 	// TargetPath is the directory, combine with filename for final path
 	finalPath := filepath.Join(session.TargetPath, session.Filename)
 
-	// Ensure target directory exists and set proper ownership
+	// Ensure the target directory exists; folder uploads may need several new levels, and
+	// the user owns every directory created for them
 	targetDir := filepath.Dir(finalPath)
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
+	if err := MkdirAllWithOwnership(targetDir, session.OwnerUsername); err != nil {
 		return "", fmt.Errorf("failed to create target directory: %w", err)
 	}
 
-	// Set directory ownership if we have a username
-	if session.OwnerUsername != "" {
-		if u, err := user.Lookup(session.OwnerUsername); err == nil {
-			uid, _ := strconv.Atoi(u.Uid)
-			gid, _ := strconv.Atoi(u.Gid)
-			// Chown the target directory (session.TargetPath) to ensure user owns it
-			os.Chown(session.TargetPath, uid, gid)
-		}
-	}
-
-	// Create final file
-	finalFile, err := os.Create(finalPath)
-	if err != nil {
+	// Move the assembled data file into place, copying it when the temp directory is on
+	// another filesystem
+	if err := moveFile(session.dataPath(), finalPath); err != nil {
+		os.Remove(finalPath)
 		return "", fmt.Errorf("failed to create final file: %w", err)
 	}
-	defer finalFile.Close()
-
-	// Get sorted chunk indices
-	indices := make([]int, 0, session.TotalChunks)
-	for i := range session.UploadedChunks {
-		indices = append(indices, i)
-	}
-	sort.Ints(indices)
-
-	// Assemble chunks
-	for _, i := range indices {
-		chunkPath := filepath.Join(session.TempDir, fmt.Sprintf("chunk_%d", i))
-		chunkFile, err := os.Open(chunkPath)
-		if err != nil {
-			finalFile.Close()
-			os.Remove(finalPath)
-			return "", fmt.Errorf("failed to open chunk %d: %w", i, err)
-		}
-
-		if _, err := io.Copy(finalFile, chunkFile); err != nil {
-			chunkFile.Close()
-			finalFile.Close()
-			os.Remove(finalPath)
-			return "", fmt.Errorf("failed to write chunk %d: %w", i, err)
-		}
-		chunkFile.Close()
-	}
 
 	// Verify final file size
-	stat, err := finalFile.Stat()
+	stat, err := os.Stat(finalPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to stat final file: %w", err)
 	}
@@ -424,6 +502,112 @@ func (m *ChunkedUploadManager) finalizeInternal(sessionID string) (string, error
 	return finalPath, nil
 }
 
+// FinalizeToBackend assembles all chunks and streams them to p on a storage backend.
+// Used for pools that are not on the local filesystem.
+func (m *ChunkedUploadManager) FinalizeToBackend(sessionID string, b Backend, p string) (int64, error) {
+	if err := m.begin(); err != nil {
+		return 0, err
+	}
+	defer m.inflight.Done()
+
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := session.startFinalize(); err != nil {
+		return 0, err
+	}
+	defer session.endFinalize()
+
+	dataFile, err := os.Open(session.dataPath())
+	if err != nil {
+		return 0, fmt.Errorf("failed to open upload data file: %w", err)
+	}
+	defer dataFile.Close()
+
+	written, err := b.Write(p, dataFile, "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	if written != session.TotalSize {
+		b.Remove(p)
+		return 0, fmt.Errorf("final file size mismatch: expected %d, got %d", session.TotalSize, written)
+	}
+
+	// Clean up session
+	m.DeleteSession(sessionID)
+
+	return written, nil
+}
+
+// startFinalize checks that every chunk arrived and marks the session as finalizing, so
+// concurrent finalize requests and late chunk retries cannot interleave with assembly. Chunk
+// retries that were already being written when the mark was set are waited for.
+func (s *UploadSession) startFinalize() error {
+	s.mu.Lock()
+	if len(s.UploadedChunks) != s.TotalChunks {
+		s.mu.Unlock()
+		return fmt.Errorf("upload not complete")
+	}
+	if s.finalizing {
+		s.mu.Unlock()
+		return fmt.Errorf("upload is already being finalized")
+	}
+	s.finalizing = true
+	s.mu.Unlock()
+
+	s.writes.Wait()
+	return nil
+}
+
+// endFinalize clears the finalizing mark, so a failed finalization can be retried
+func (s *UploadSession) endFinalize() {
+	s.mu.Lock()
+	s.finalizing = false
+	s.mu.Unlock()
+}
+
+// createSparseFile creates a file of the given size without allocating its blocks
+func createSparseFile(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// moveFile renames src to dst, falling back to a copy across filesystems
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
 // DeleteSession removes a session and its temporary files
 func (m *ChunkedUploadManager) DeleteSession(sessionID string) error {
 	m.mu.Lock()
@@ -442,7 +626,7 @@ func (m *ChunkedUploadManager) DeleteSession(sessionID string) error {
 		os.RemoveAll(session.TempDir)
 	}
 
-	return nil
+	return m.store.DeleteUploadSession(sessionID)
 }
 
 // GetMissingChunks returns the indices of chunks that haven't been uploaded yet
@@ -500,82 +684,174 @@ func (m *ChunkedUploadManager) ListUserSessions(ownerID string) []*UploadProgres
 	return sessions
 }
 
-// save persists session metadata to disk
-func (s *UploadSession) save() error {
+// persist saves the session to the store
+func (m *ChunkedUploadManager) persist(s *UploadSession) error {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	metaPath := filepath.Join(s.TempDir, "session.json")
-	data, err := json.Marshal(s)
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(metaPath, data, 0644)
+	record := &models.UploadSession{
+		ID:            s.ID,
+		Filename:      s.Filename,
+		TotalSize:     s.TotalSize,
+		ChunkSize:     s.ChunkSize,
+		TotalChunks:   s.TotalChunks,
+		ZoneID:        s.ZoneID,
+		TargetPath:    s.TargetPath,
+		TempDir:       s.TempDir,
+		OwnerID:       s.OwnerID,
+		OwnerUsername: s.OwnerUsername,
+		CreatedAt:     s.CreatedAt,
+		UpdatedAt:     s.UpdatedAt,
+		ExpiresAt:     s.ExpiresAt,
+	}
+	for i := range s.UploadedChunks {
+		record.SetChunk(i)
+	}
+	s.mu.RUnlock()
+
+	return m.store.SaveUploadSession(record)
 }
 
-// restoreSessions restores sessions from disk after restart
+// restoreSessions loads the sessions in the store after a restart. Chunks whose file is
+// missing are uploaded again, and temp directories without a live session are removed.
 func (m *ChunkedUploadManager) restoreSessions() {
+	now := time.Now()
+	for _, record := range m.store.ListUploadSessions() {
+		// Expired sessions are pruned below and their temp directories removed as orphans
+		if now.After(record.ExpiresAt) {
+			continue
+		}
+		if info, err := os.Stat(record.TempDir); err != nil || !info.IsDir() || filepath.Dir(record.TempDir) != m.baseTempDir {
+			m.store.DeleteUploadSession(record.ID)
+			continue
+		}
+
+		session := &UploadSession{
+			ID:             record.ID,
+			Filename:       record.Filename,
+			TotalSize:      record.TotalSize,
+			ChunkSize:      record.ChunkSize,
+			TotalChunks:    record.TotalChunks,
+			UploadedChunks: make(map[int]bool),
+			ZoneID:         record.ZoneID,
+			TargetPath:     record.TargetPath,
+			TempDir:        record.TempDir,
+			CreatedAt:      record.CreatedAt,
+			UpdatedAt:      record.UpdatedAt,
+			ExpiresAt:      record.ExpiresAt,
+			OwnerID:        record.OwnerID,
+			OwnerUsername:  record.OwnerUsername,
+			Metadata:       make(map[string]string),
+		}
+		for i := 0; i < record.TotalChunks; i++ {
+			if record.HasChunk(i) {
+				session.UploadedChunks[i] = true
+			}
+		}
+		if err := migrateChunkFiles(session); err != nil {
+			os.RemoveAll(record.TempDir)
+			m.store.DeleteUploadSession(record.ID)
+			continue
+		}
+		m.sessions[session.ID] = session
+	}
+	m.store.PruneUploadSessions(now)
+
 	entries, err := os.ReadDir(m.baseTempDir)
 	if err != nil {
 		return
 	}
-
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		if _, ok := m.sessions[entry.Name()]; ok {
 			continue
 		}
-
-		metaPath := filepath.Join(m.baseTempDir, entry.Name(), "session.json")
-		data, err := os.ReadFile(metaPath)
-		if err != nil {
+		dir := filepath.Join(m.baseTempDir, entry.Name())
+		if session := m.importLegacySession(dir); session != nil {
+			m.sessions[session.ID] = session
 			continue
 		}
+		os.RemoveAll(dir)
+	}
+}
 
-		var session UploadSession
-		if err := json.Unmarshal(data, &session); err != nil {
-			continue
-		}
+// importLegacySession moves a session saved as session.json by older versions into the store
+func (m *ChunkedUploadManager) importLegacySession(dir string) *UploadSession {
+	metaPath := filepath.Join(dir, "session.json")
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil
+	}
 
-		// Skip expired sessions
-		if time.Now().After(session.ExpiresAt) {
-			os.RemoveAll(filepath.Join(m.baseTempDir, entry.Name()))
-			continue
-		}
+	var session UploadSession
+	if err := json.Unmarshal(data, &session); err != nil || session.ID != filepath.Base(dir) {
+		return nil
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil
+	}
+	if session.UploadedChunks == nil {
+		session.UploadedChunks = make(map[int]bool)
+	}
+	session.TempDir = dir
+	if err := migrateChunkFiles(&session); err != nil {
+		return nil
+	}
 
-		m.mu.Lock()
-		m.sessions[session.ID] = &session
-		m.mu.Unlock()
+	if err := m.persist(&session); err != nil {
+		return nil
 	}
+	os.Remove(metaPath)
+	return &session
 }
 
-// cleanupLoop periodically cleans up expired sessions
-func (m *ChunkedUploadManager) cleanupLoop() {
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
+// migrateChunkFiles writes the chunk_N files of sessions created by older versions into the
+// data file. Received chunks whose file is gone are marked missing, to be uploaded again.
+func migrateChunkFiles(session *UploadSession) error {
+	dataPath := session.dataPath()
+	if _, err := os.Stat(dataPath); err == nil {
+		return nil
+	}
+	if err := createSparseFile(dataPath, session.TotalSize); err != nil {
+		return err
+	}
 
-	for {
-		select {
-		case <-ticker.C:
-			m.cleanupExpired()
-		case <-m.cleanupDone:
-			return
+	dataFile, err := os.OpenFile(dataPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer dataFile.Close()
+
+	for i := range session.UploadedChunks {
+		chunkPath := filepath.Join(session.TempDir, fmt.Sprintf("chunk_%d", i))
+		chunk, err := os.Open(chunkPath)
+		if err != nil {
+			delete(session.UploadedChunks, i)
+			continue
+		}
+		_, err = io.Copy(io.NewOffsetWriter(dataFile, int64(i)*session.ChunkSize), chunk)
+		chunk.Close()
+		if err != nil {
+			return err
 		}
+		os.Remove(chunkPath)
 	}
+	return nil
 }
 
-// cleanupExpired removes all expired sessions
-func (m *ChunkedUploadManager) cleanupExpired() {
+// CleanupExpired removes all expired sessions with their chunks and returns how many were removed
+func (m *ChunkedUploadManager) CleanupExpired() int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	now := time.Now()
+	removed := 0
 	for id, session := range m.sessions {
 		if now.After(session.ExpiresAt) {
 			if session.TempDir != "" {
 				os.RemoveAll(session.TempDir)
 			}
 			delete(m.sessions, id)
+			removed++
 		}
 	}
+	m.store.PruneUploadSessions(now)
+	return removed
 }
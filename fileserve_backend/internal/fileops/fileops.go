@@ -1,6 +1,9 @@
 package fileops
 
 import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -8,10 +11,12 @@ import (
 	"os"
 	osuser "os/user"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -26,6 +31,8 @@ var (
 	cacheExpiry  time.Time
 	cacheMutex   sync.RWMutex
 	cacheTTL     = 5 * time.Minute // Refresh cache every 5 minutes
+
+	cacheRefreshing atomic.Bool // A background refresh is running
 )
 
 // InitOwnershipCache pre-populates the UID/GID cache from /etc/passwd and /etc/group
@@ -34,14 +41,12 @@ func InitOwnershipCache() {
 	refreshCache()
 }
 
-// refreshCache reloads all users and groups into the cache
+// refreshCache reloads all users and groups into the cache. Lookups keep using the cache while
+// it is reloaded.
 func refreshCache() {
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
-
 	// Clear existing cache
-	uidCache = sync.Map{}
-	gidCache = sync.Map{}
+	uidCache.Clear()
+	gidCache.Clear()
 
 	// Load all users
 	// Note: This reads /etc/passwd which is fast
@@ -94,19 +99,30 @@ func refreshCache() {
 		}
 	}
 
+	cacheMutex.Lock()
 	cacheExpiry = time.Now().Add(cacheTTL)
+	cacheMutex.Unlock()
 }
 
-// lookupUsername returns cached username for UID, or fetches and caches it
-func lookupUsername(uid uint32) string {
-	// Check if cache needs refresh
+// refreshCacheIfExpired starts a background refresh once the cache has expired, unless one is
+// already running
+func refreshCacheIfExpired() {
 	cacheMutex.RLock()
 	expired := time.Now().After(cacheExpiry)
 	cacheMutex.RUnlock()
 
-	if expired {
-		go refreshCache() // Refresh in background, don't block
+	if expired && cacheRefreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer cacheRefreshing.Store(false)
+			refreshCache()
+		}()
 	}
+}
+
+// lookupUsername returns cached username for UID, or fetches and caches it
+func lookupUsername(uid uint32) string {
+	// Check if cache needs refresh (in background, don't block)
+	refreshCacheIfExpired()
 
 	// Try cache first
 	if name, ok := uidCache.Load(uid); ok {
@@ -127,14 +143,8 @@ func lookupUsername(uid uint32) string {
 
 // lookupGroupname returns cached group name for GID, or fetches and caches it
 func lookupGroupname(gid uint32) string {
-	// Check if cache needs refresh
-	cacheMutex.RLock()
-	expired := time.Now().After(cacheExpiry)
-	cacheMutex.RUnlock()
-
-	if expired {
-		go refreshCache() // Refresh in background, don't block
-	}
+	// Check if cache needs refresh (in background, don't block)
+	refreshCacheIfExpired()
 
 	// Try cache first
 	if name, ok := gidCache.Load(gid); ok {
@@ -170,15 +180,35 @@ type FileInfo struct {
 	GID       uint32    `json:"gid"`
 	MimeType  string    `json:"mime_type,omitempty"`
 	Extension string    `json:"extension,omitempty"`
+
+	// User-defined metadata, filled in by zone listings
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Starred     bool     `json:"starred,omitempty"`
+
+	// Active advisory lock on the file, filled in by zone listings
+	Lock *LockInfo `json:"lock,omitempty"`
+}
+
+// LockInfo describes who holds a lock on a listed file
+type LockInfo struct {
+	Username  string    `json:"username"`
+	Scope     string    `json:"scope"` // exclusive or shared
+	Owner     string    `json:"owner,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // ListOptions configures directory listing behavior
 type ListOptions struct {
-	Limit      int    // Max items to return (0 = unlimited)
-	Offset     int    // Items to skip
-	SortBy     string // "name", "size", "modified", "type"
-	SortDesc   bool   // Sort descending
-	FilterType string // "file", "folder", or "" for all
+	Limit      int      // Max items to return (0 = unlimited)
+	Offset     int      // Items to skip
+	Cursor     string   // Resume after the entry a previous page's NextCursor points to (overrides Offset)
+	SortBy     string   // "name", "size", "modified" (or "mtime"), "type", "owner"
+	SortDesc   bool     // Sort descending
+	FilterType string   // "file", "folder", or "" for all
+	Fast       bool     // Skip stat(): no size, times, mode or owner; only name and type sorting
+	Exclude    []string // Names left out of the listing and its total
+	Include    []string // When set, only these names are listed
 }
 
 // ListResult contains paginated file listing results
@@ -188,6 +218,7 @@ type ListResult struct {
 	Limit      int        `json:"limit"`
 	Offset     int        `json:"offset"`
 	HasMore    bool       `json:"has_more"`
+	NextCursor string     `json:"next_cursor,omitempty"` // Pass as Cursor to get the next page
 }
 
 // ========================================================================
@@ -441,6 +472,16 @@ func IsPathWithinBase(basePath, checkPath string) bool {
 // Directory Listing (with pagination support)
 // ========================================================================
 
+const (
+	// parallelStatThreshold is the number of entries from which stat() calls are spread over
+	// parallelStatWorkers goroutines
+	parallelStatThreshold = 256
+	parallelStatWorkers   = 16
+)
+
+// ErrInvalidCursor is returned for a listing cursor that was not produced by a listing
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 // ListDirectory lists files and directories in a path (legacy, no pagination)
 func ListDirectory(basePath, requestedPath string) ([]FileInfo, error) {
 	result, err := ListDirectoryPaginated(basePath, requestedPath, ListOptions{})
@@ -468,6 +509,12 @@ func ListDirectoryPaginatedDirect(fullPath, relativePath string, opts ListOption
 
 // listDirectoryPaginatedInternal is the internal implementation
 func listDirectoryPaginatedInternal(fullPath, relativePath string, opts ListOptions) (*ListResult, error) {
+	return listEntries(fullPath, func(name string) string { return filepath.Join(relativePath, name) }, opts)
+}
+
+// listEntries lists a directory with filtering, sorting and pagination. entryPath builds the
+// path reported for each entry.
+func listEntries(fullPath string, entryPath func(name string) string, opts ListOptions) (*ListResult, error) {
 	// Check if path exists
 	stat, err := os.Stat(fullPath)
 	if err != nil {
@@ -483,185 +530,231 @@ func listDirectoryPaginatedInternal(fullPath, relativePath string, opts ListOpti
 		return nil, err
 	}
 
-	// OPTIMIZATION: For name-sorted listings (the default), we can sort DirEntry
-	// objects by name without calling stat(), then only stat the paginated slice.
-	// This reduces stat() calls from O(n) to O(page_size) for large directories.
-	sortByName := opts.SortBy == "" || opts.SortBy == "name"
+	sortBy := opts.SortBy
+	if sortBy == "mtime" {
+		sortBy = "modified"
+	}
+	// OPTIMIZATION: Name and type come from the directory entries themselves, so listings sorted
+	// by them only stat() the returned page. This keeps directories with 100k+ entries fast.
+	statAll := sortBy == "size" || sortBy == "modified" || sortBy == "owner"
+	if statAll && opts.Fast {
+		return nil, errors.New("fast listings can only be sorted by name or type")
+	}
 
 	// Apply type filter first (doesn't need stat)
-	if opts.FilterType != "" {
-		filtered := make([]os.DirEntry, 0, len(entries))
-		for _, entry := range entries {
-			if opts.FilterType == "file" && entry.IsDir() {
-				continue
-			}
-			if opts.FilterType == "folder" && !entry.IsDir() {
-				continue
-			}
-			filtered = append(filtered, entry)
+	files := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if opts.FilterType == "file" && entry.IsDir() {
+			continue
 		}
-		entries = filtered
-	}
-
-	total := len(entries)
-
-	// Fast path: name sorting with pagination - only stat what we return
-	if sortByName && opts.Limit > 0 {
-		// Sort DirEntry by name (folders first, then alphabetical)
-		sort.Slice(entries, func(i, j int) bool {
-			if entries[i].IsDir() != entries[j].IsDir() {
-				return entries[i].IsDir()
-			}
-			less := strings.ToLower(entries[i].Name()) < strings.ToLower(entries[j].Name())
-			if opts.SortDesc {
-				return !less
-			}
-			return less
-		})
-
-		// Apply pagination to entries BEFORE stat
-		if opts.Offset > 0 {
-			if opts.Offset >= len(entries) {
-				entries = []os.DirEntry{}
-			} else {
-				entries = entries[opts.Offset:]
-			}
+		if opts.FilterType == "folder" && !entry.IsDir() {
+			continue
 		}
-		if len(entries) > opts.Limit {
-			entries = entries[:opts.Limit]
+		if slices.Contains(opts.Exclude, entry.Name()) {
+			continue
+		}
+		if opts.Include != nil && !slices.Contains(opts.Include, entry.Name()) {
+			continue
 		}
 
-		// Now only stat the paginated slice
-		files := make([]FileInfo, 0, len(entries))
-		for _, entry := range entries {
-			info, err := entry.Info()
-			if err != nil {
-				continue
-			}
-
-			entryPath := filepath.Join(relativePath, entry.Name())
-			owner, group, uid, gid := getFileOwnership(info)
+		f := FileInfo{
+			Name:  entry.Name(),
+			Path:  entryPath(entry.Name()),
+			IsDir: entry.IsDir(),
+		}
+		if !entry.IsDir() {
+			f.Extension = strings.TrimPrefix(strings.ToLower(filepath.Ext(entry.Name())), ".")
+			f.MimeType = getMimeType(entry.Name())
+		}
+		files = append(files, f)
+	}
 
-			ext := ""
-			mimeType := ""
-			if !entry.IsDir() {
-				ext = strings.TrimPrefix(strings.ToLower(filepath.Ext(entry.Name())), ".")
-				mimeType = getMimeType(entry.Name())
-			}
+	if statAll {
+		files = statFiles(fullPath, files)
+	}
+	total := len(files)
 
-			files = append(files, FileInfo{
-				Name:      entry.Name(),
-				Path:      entryPath,
-				Size:      info.Size(),
-				IsDir:     entry.IsDir(),
-				ModTime:   info.ModTime(),
-				Mode:      info.Mode().String(),
-				Owner:     owner,
-				Group:     group,
-				UID:       uid,
-				GID:       gid,
-				MimeType:  mimeType,
-				Extension: ext,
-			})
-		}
+	sortFiles(files, sortBy, opts.SortDesc)
+	result, err := pageFiles(files, sortBy, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.Total = total
 
-		return &ListResult{
-			Files:   files,
-			Total:   total,
-			Limit:   opts.Limit,
-			Offset:  opts.Offset,
-			HasMore: opts.Offset+len(files) < total,
-		}, nil
+	if !statAll && !opts.Fast {
+		result.Files = statFiles(fullPath, result.Files)
 	}
+	return result, nil
+}
 
-	// Slow path: need to stat all files for sorting by size/modified/type/owner
-	// Build file info list
-	files := make([]FileInfo, 0, len(entries))
-	for _, entry := range entries {
-		info, err := entry.Info()
+// statFiles fills in the size, times, mode and ownership of directory entries. Large
+// directories are stat()ed by several goroutines, which matters most on network filesystems.
+// Entries that disappeared since the directory was read are dropped.
+func statFiles(dir string, files []FileInfo) []FileInfo {
+	ok := make([]bool, len(files))
+	fill := func(i int) {
+		info, err := os.Lstat(filepath.Join(dir, files[i].Name))
 		if err != nil {
-			continue
+			return
 		}
+		f := &files[i]
+		f.Size = info.Size()
+		f.ModTime = info.ModTime()
+		f.Mode = info.Mode().String()
+		f.Owner, f.Group, f.UID, f.GID = getFileOwnership(info)
+		ok[i] = true
+	}
 
-		entryPath := filepath.Join(relativePath, entry.Name())
-		owner, group, uid, gid := getFileOwnership(info)
+	if len(files) < parallelStatThreshold {
+		for i := range files {
+			fill(i)
+		}
+	} else {
+		var next atomic.Int64
+		var wg sync.WaitGroup
+		for w := 0; w < parallelStatWorkers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					i := int(next.Add(1)) - 1
+					if i >= len(files) {
+						return
+					}
+					fill(i)
+				}
+			}()
+		}
+		wg.Wait()
+	}
 
-		ext := ""
-		mimeType := ""
-		if !entry.IsDir() {
-			ext = strings.TrimPrefix(strings.ToLower(filepath.Ext(entry.Name())), ".")
-			mimeType = getMimeType(entry.Name())
+	kept := files[:0]
+	for i := range files {
+		if ok[i] {
+			kept = append(kept, files[i])
 		}
+	}
+	return kept
+}
 
-		files = append(files, FileInfo{
-			Name:      entry.Name(),
-			Path:      entryPath,
-			Size:      info.Size(),
-			IsDir:     entry.IsDir(),
-			ModTime:   info.ModTime(),
-			Mode:      info.Mode().String(),
-			Owner:     owner,
-			Group:     group,
-			UID:       uid,
-			GID:       gid,
-			MimeType:  mimeType,
-			Extension: ext,
+// pageFiles returns the page of sorted files selected by the cursor, or by the offset when there
+// is none. Total is the number of files given.
+func pageFiles(files []FileInfo, sortBy string, opts ListOptions) (*ListResult, error) {
+	offset := opts.Offset
+	if opts.Cursor != "" {
+		after, err := decodeListCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		// Resume after the last entry of the previous page, wherever it is now
+		offset = sort.Search(len(files), func(i int) bool {
+			return compareFiles(&files[i], after, sortBy, opts.SortDesc) > 0
 		})
 	}
 
-	// Sort files
-	sortFiles(files, opts.SortBy, opts.SortDesc)
+	page := files
+	if offset >= len(page) {
+		page = []FileInfo{}
+	} else {
+		page = page[offset:]
+	}
+	if opts.Limit > 0 && len(page) > opts.Limit {
+		page = page[:opts.Limit]
+	}
 
-	// Apply pagination
-	if opts.Offset > 0 {
-		if opts.Offset >= len(files) {
-			files = []FileInfo{}
-		} else {
-			files = files[opts.Offset:]
-		}
+	result := &ListResult{
+		Files:   page,
+		Total:   len(files),
+		Limit:   opts.Limit,
+		Offset:  offset,
+		HasMore: offset+len(page) < len(files),
+	}
+	if result.HasMore && len(page) > 0 {
+		result.NextCursor = encodeListCursor(&page[len(page)-1])
 	}
+	return result, nil
+}
+
+// listCursor is the position of an entry in a sorted listing
+type listCursor struct {
+	Name    string `json:"n"`
+	IsDir   bool   `json:"d,omitempty"`
+	Size    int64  `json:"s,omitempty"`
+	ModTime int64  `json:"m,omitempty"` // Unix nanoseconds
+	Owner   string `json:"o,omitempty"`
+}
 
-	if opts.Limit > 0 && len(files) > opts.Limit {
-		files = files[:opts.Limit]
+// encodeListCursor returns an opaque cursor pointing after f
+func encodeListCursor(f *FileInfo) string {
+	c := listCursor{Name: f.Name, IsDir: f.IsDir, Size: f.Size, Owner: f.Owner}
+	if !f.ModTime.IsZero() {
+		c.ModTime = f.ModTime.UnixNano()
 	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
 
-	return &ListResult{
-		Files:   files,
-		Total:   total,
-		Limit:   opts.Limit,
-		Offset:  opts.Offset,
-		HasMore: opts.Offset+len(files) < total,
-	}, nil
+// decodeListCursor turns a cursor back into the sort fields of the entry it points after
+func decodeListCursor(cursor string) (*FileInfo, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	f := &FileInfo{Name: c.Name, IsDir: c.IsDir, Size: c.Size, Owner: c.Owner}
+	if c.ModTime != 0 {
+		f.ModTime = time.Unix(0, c.ModTime)
+	}
+	if !c.IsDir {
+		f.Extension = strings.TrimPrefix(strings.ToLower(filepath.Ext(c.Name)), ".")
+	}
+	return f, nil
 }
 
 // sortFiles sorts the file list based on the specified field
 func sortFiles(files []FileInfo, sortBy string, desc bool) {
-	// Default: folders first, then by name
 	sort.Slice(files, func(i, j int) bool {
-		// Folders always come first
-		if files[i].IsDir != files[j].IsDir {
-			return files[i].IsDir
-		}
+		return compareFiles(&files[i], &files[j], sortBy, desc) < 0
+	})
+}
 
-		var less bool
-		switch sortBy {
-		case "size":
-			less = files[i].Size < files[j].Size
-		case "modified":
-			less = files[i].ModTime.Before(files[j].ModTime)
-		case "type":
-			less = files[i].Extension < files[j].Extension
-		case "owner":
-			less = files[i].Owner < files[j].Owner
-		default: // "name" or empty
-			less = strings.ToLower(files[i].Name) < strings.ToLower(files[j].Name)
+// compareFiles orders two files: folders first, then by the sort field, then by name so that
+// every listing has a single stable order for cursors to point into
+func compareFiles(a, b *FileInfo, sortBy string, desc bool) int {
+	// Folders always come first
+	if a.IsDir != b.IsDir {
+		if a.IsDir {
+			return -1
 		}
+		return 1
+	}
 
-		if desc {
-			return !less
-		}
-		return less
-	})
+	var c int
+	switch sortBy {
+	case "size":
+		c = cmp.Compare(a.Size, b.Size)
+	case "modified", "mtime":
+		c = a.ModTime.Compare(b.ModTime)
+	case "type":
+		c = strings.Compare(a.Extension, b.Extension)
+	case "owner":
+		c = strings.Compare(a.Owner, b.Owner)
+	}
+	if c == 0 {
+		c = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	}
+	if c == 0 {
+		c = strings.Compare(a.Name, b.Name)
+	}
+
+	if desc {
+		return -c
+	}
+	return c
 }
 
 // ========================================================================
@@ -714,6 +807,12 @@ func CreateDirectoryWithOwnership(basePath, requestedPath, username string) erro
 		return err
 	}
 
+	return MkdirAllWithOwnership(fullPath, username)
+}
+
+// MkdirAllWithOwnership creates a directory and any missing parents, giving the new
+// directories to the specified user. fullPath must already be validated.
+func MkdirAllWithOwnership(fullPath, username string) error {
 	// Find the first directory that needs to be created
 	// so we can set ownership on all new directories
 	var dirsToCreate []string
@@ -843,21 +942,6 @@ func ListDirectoryRaw(fullPath string, relativePath ...string) ([]FileInfo, erro
 
 // ListDirectoryRawPaginated lists files with pagination in an absolute path
 func ListDirectoryRawPaginated(fullPath string, opts ListOptions, relativePath ...string) (*ListResult, error) {
-	// Check if path exists
-	stat, err := os.Stat(fullPath)
-	if err != nil {
-		return nil, err
-	}
-
-	if !stat.IsDir() {
-		return nil, errors.New("path is not a directory")
-	}
-
-	entries, err := os.ReadDir(fullPath)
-	if err != nil {
-		return nil, err
-	}
-
 	// Determine path prefix
 	prefix := ""
 	if len(relativePath) > 0 && relativePath[0] != "" && relativePath[0] != "/" {
@@ -867,150 +951,7 @@ func ListDirectoryRawPaginated(fullPath string, opts ListOptions, relativePath .
 		}
 	}
 
-	// OPTIMIZATION: Same as listDirectoryPaginatedInternal - defer stat() for name sorting
-	sortByName := opts.SortBy == "" || opts.SortBy == "name"
-
-	// Apply type filter first (doesn't need stat)
-	if opts.FilterType != "" {
-		filtered := make([]os.DirEntry, 0, len(entries))
-		for _, entry := range entries {
-			if opts.FilterType == "file" && entry.IsDir() {
-				continue
-			}
-			if opts.FilterType == "folder" && !entry.IsDir() {
-				continue
-			}
-			filtered = append(filtered, entry)
-		}
-		entries = filtered
-	}
-
-	total := len(entries)
-
-	// Fast path: name sorting with pagination - only stat what we return
-	if sortByName && opts.Limit > 0 {
-		// Sort DirEntry by name (folders first, then alphabetical)
-		sort.Slice(entries, func(i, j int) bool {
-			if entries[i].IsDir() != entries[j].IsDir() {
-				return entries[i].IsDir()
-			}
-			less := strings.ToLower(entries[i].Name()) < strings.ToLower(entries[j].Name())
-			if opts.SortDesc {
-				return !less
-			}
-			return less
-		})
-
-		// Apply pagination to entries BEFORE stat
-		if opts.Offset > 0 {
-			if opts.Offset >= len(entries) {
-				entries = []os.DirEntry{}
-			} else {
-				entries = entries[opts.Offset:]
-			}
-		}
-		if len(entries) > opts.Limit {
-			entries = entries[:opts.Limit]
-		}
-
-		// Now only stat the paginated slice
-		files := make([]FileInfo, 0, len(entries))
-		for _, entry := range entries {
-			info, err := entry.Info()
-			if err != nil {
-				continue
-			}
-
-			owner, group, uid, gid := getFileOwnership(info)
-
-			ext := ""
-			mimeType := ""
-			if !entry.IsDir() {
-				ext = strings.TrimPrefix(strings.ToLower(filepath.Ext(entry.Name())), ".")
-				mimeType = getMimeType(entry.Name())
-			}
-
-			files = append(files, FileInfo{
-				Name:      entry.Name(),
-				Path:      prefix + entry.Name(),
-				Size:      info.Size(),
-				IsDir:     entry.IsDir(),
-				ModTime:   info.ModTime(),
-				Mode:      info.Mode().String(),
-				Owner:     owner,
-				Group:     group,
-				UID:       uid,
-				GID:       gid,
-				MimeType:  mimeType,
-				Extension: ext,
-			})
-		}
-
-		return &ListResult{
-			Files:   files,
-			Total:   total,
-			Limit:   opts.Limit,
-			Offset:  opts.Offset,
-			HasMore: opts.Offset+len(files) < total,
-		}, nil
-	}
-
-	// Slow path: need to stat all files for sorting by size/modified/type/owner
-	files := make([]FileInfo, 0, len(entries))
-	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		owner, group, uid, gid := getFileOwnership(info)
-
-		ext := ""
-		mimeType := ""
-		if !entry.IsDir() {
-			ext = strings.TrimPrefix(strings.ToLower(filepath.Ext(entry.Name())), ".")
-			mimeType = getMimeType(entry.Name())
-		}
-
-		files = append(files, FileInfo{
-			Name:      entry.Name(),
-			Path:      prefix + entry.Name(),
-			Size:      info.Size(),
-			IsDir:     entry.IsDir(),
-			ModTime:   info.ModTime(),
-			Mode:      info.Mode().String(),
-			Owner:     owner,
-			Group:     group,
-			UID:       uid,
-			GID:       gid,
-			MimeType:  mimeType,
-			Extension: ext,
-		})
-	}
-
-	// Sort files
-	sortFiles(files, opts.SortBy, opts.SortDesc)
-
-	// Apply pagination
-	if opts.Offset > 0 {
-		if opts.Offset >= len(files) {
-			files = []FileInfo{}
-		} else {
-			files = files[opts.Offset:]
-		}
-	}
-
-	if opts.Limit > 0 && len(files) > opts.Limit {
-		files = files[:opts.Limit]
-	}
-
-	return &ListResult{
-		Files:   files,
-		Total:   total,
-		Limit:   opts.Limit,
-		Offset:  opts.Offset,
-		HasMore: opts.Offset+len(files) < total,
-	}, nil
+	return listEntries(fullPath, func(name string) string { return prefix + name }, opts)
 }
 
 // ========================================================================
@@ -0,0 +1,517 @@
+package fileops
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ========================================================================
+// S3 Client - minimal S3 API client (AWS Signature V4) for object pools
+// ========================================================================
+
+const (
+	// S3PartSize is the size of each multipart upload part; objects up to this size use a single PUT
+	S3PartSize = 16 * 1024 * 1024
+	// s3MaxParts is the S3 limit on parts per multipart upload
+	s3MaxParts = 10000
+	// emptyPayloadHash is the SHA-256 of an empty body
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Client talks to a single bucket of an S3-compatible service
+type S3Client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	http      *http.Client
+}
+
+// S3Object describes an object returned by HEAD or LIST
+type S3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	ContentType  string
+}
+
+// S3Error is an error response returned by the S3 service
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+// Is maps missing objects to os.ErrNotExist and denied requests to os.ErrPermission
+func (e *S3Error) Is(target error) bool {
+	switch target {
+	case os.ErrNotExist:
+		return e.StatusCode == http.StatusNotFound
+	case os.ErrPermission:
+		return e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// NewS3Client creates a client for the given endpoint and bucket
+func NewS3Client(endpoint, region, bucket, accessKey, secretKey string, pathStyle bool) (*S3Client, error) {
+	if endpoint == "" || bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %s", endpoint)
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3Client{
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		pathStyle: pathStyle,
+		http:      &http.Client{},
+	}, nil
+}
+
+// HeadObject returns the metadata of an object
+func (c *S3Client) HeadObject(key string) (*S3Object, error) {
+	resp, err := c.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	obj := &S3Object{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	obj.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return obj, nil
+}
+
+// GetObject opens an object for reading. rangeHeader is passed through as the HTTP Range header when set.
+func (c *S3Client) GetObject(key, rangeHeader string) (*http.Response, error) {
+	headers := http.Header{}
+	if rangeHeader != "" {
+		headers.Set("Range", rangeHeader)
+	}
+	return c.do(http.MethodGet, key, nil, headers, nil)
+}
+
+// PutObject uploads an object in a single request
+func (c *S3Client) PutObject(key string, data []byte, contentType string) error {
+	headers := http.Header{}
+	if contentType != "" {
+		headers.Set("Content-Type", contentType)
+	}
+	resp, err := c.do(http.MethodPut, key, nil, headers, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Upload streams r to an object, switching to a multipart upload when the data exceeds one part
+func (c *S3Client) Upload(key string, r io.Reader, contentType string) (int64, error) {
+	buf := make([]byte, S3PartSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return int64(n), c.PutObject(key, buf[:n], contentType)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	uploadID, err := c.createMultipartUpload(key, contentType)
+	if err != nil {
+		return 0, err
+	}
+
+	var parts []s3CompletedPart
+	var total int64
+	for partNumber := 1; n > 0; partNumber++ {
+		if partNumber > s3MaxParts {
+			c.abortMultipartUpload(key, uploadID)
+			return 0, fmt.Errorf("object exceeds %d parts", s3MaxParts)
+		}
+
+		etag, err := c.uploadPart(key, uploadID, partNumber, buf[:n])
+		if err != nil {
+			c.abortMultipartUpload(key, uploadID)
+			return 0, err
+		}
+		parts = append(parts, s3CompletedPart{PartNumber: partNumber, ETag: etag})
+		total += int64(n)
+
+		n, err = io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			c.abortMultipartUpload(key, uploadID)
+			return 0, err
+		}
+	}
+
+	if err := c.completeMultipartUpload(key, uploadID, parts); err != nil {
+		c.abortMultipartUpload(key, uploadID)
+		return 0, err
+	}
+	return total, nil
+}
+
+// DeleteObject removes an object (missing objects are not an error)
+func (c *S3Client) DeleteObject(key string) error {
+	resp, err := c.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// CopyObject copies an object within the bucket
+func (c *S3Client) CopyObject(srcKey, dstKey string) error {
+	headers := http.Header{}
+	headers.Set("X-Amz-Copy-Source", "/"+c.bucket+"/"+s3EscapePath(srcKey))
+	resp, err := c.do(http.MethodPut, dstKey, nil, headers, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Copy can fail after a 200 status; the error is then reported in the body
+	body, _ := io.ReadAll(resp.Body)
+	if bytes.Contains(body, []byte("<Error>")) {
+		s3Err := &S3Error{StatusCode: http.StatusInternalServerError}
+		xml.Unmarshal(body, s3Err)
+		return s3Err
+	}
+	return nil
+}
+
+// ListObjects lists every object under prefix. With a delimiter, keys below the next delimiter are
+// grouped and returned as common prefixes instead.
+func (c *S3Client) ListObjects(prefix, delimiter string) ([]S3Object, []string, error) {
+	var objects []S3Object
+	var prefixes []string
+	token := ""
+	for {
+		page, err := c.listObjectsPage(prefix, delimiter, token, 1000)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, o := range page.Contents {
+			objects = append(objects, S3Object{
+				Key:          o.Key,
+				Size:         o.Size,
+				LastModified: o.LastModified,
+				ETag:         strings.Trim(o.ETag, `"`),
+			})
+		}
+		for _, p := range page.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, prefixes, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// HasPrefix reports whether at least one object exists under prefix
+func (c *S3Client) HasPrefix(prefix string) (bool, error) {
+	page, err := c.listObjectsPage(prefix, "", "", 1)
+	if err != nil {
+		return false, err
+	}
+	return len(page.Contents) > 0, nil
+}
+
+// s3ListResult is the ListObjectsV2 response body
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+func (c *S3Client) listObjectsPage(prefix, delimiter, token string, maxKeys int) (*s3ListResult, error) {
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("max-keys", strconv.Itoa(maxKeys))
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+
+	resp, err := c.do(http.MethodGet, "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result s3ListResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("s3: invalid list response: %w", err)
+	}
+	return &result, nil
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *S3Client) createMultipartUpload(key, contentType string) (string, error) {
+	headers := http.Header{}
+	if contentType != "" {
+		headers.Set("Content-Type", contentType)
+	}
+	resp, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, headers, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return "", errors.New("s3: failed to start multipart upload")
+	}
+	return result.UploadID, nil
+}
+
+func (c *S3Client) uploadPart(key, uploadID string, partNumber int, data []byte) (string, error) {
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(partNumber))
+	query.Set("uploadId", uploadID)
+	resp, err := c.do(http.MethodPut, key, query, nil, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+func (c *S3Client) completeMultipartUpload(key, uploadID string, parts []s3CompletedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Like copy, completion errors can arrive with a 200 status
+	data, _ := io.ReadAll(resp.Body)
+	if bytes.Contains(data, []byte("<Error>")) {
+		s3Err := &S3Error{StatusCode: http.StatusInternalServerError}
+		xml.Unmarshal(data, s3Err)
+		return s3Err
+	}
+	return nil
+}
+
+func (c *S3Client) abortMultipartUpload(key, uploadID string) {
+	if resp, err := c.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// do signs and sends a request, returning an *S3Error for non-2xx responses
+func (c *S3Client) do(method, key string, query url.Values, headers http.Header, body []byte) (*http.Response, error) {
+	u := *c.endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if c.pathStyle {
+		u.Path = basePath + "/" + c.bucket + "/" + key
+	} else {
+		u.Host = c.bucket + "." + u.Host
+		u.Path = basePath + "/" + key
+	}
+	u.RawPath = ""
+	u.RawQuery = s3CanonicalQuery(query)
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	// Use our own escaping so the request path matches the signed canonical URI
+	req.URL.Opaque = "//" + u.Host + s3EscapePath(u.Path)
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	req.ContentLength = int64(len(body))
+
+	c.sign(req, body)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		s3Err := &S3Error{StatusCode: resp.StatusCode}
+		if data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024)); len(data) > 0 {
+			xml.Unmarshal(data, s3Err)
+		}
+		return nil, s3Err
+	}
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to the request
+func (c *S3Client) sign(req *http.Request, body []byte) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Sign the host and all x-amz-* headers
+	signed := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") {
+			signed[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(signed))
+	for k := range signed {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + signed[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything except the unreserved characters, as required by SigV4
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || (keepSlash && ch == '/') {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(p string) string {
+	return s3Escape(p, true)
+}
+
+// s3CanonicalQuery encodes query parameters sorted by key, as required by SigV4
+func s3CanonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -10,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"fileserv/internal/apierror"
 )
 
 // TransferOptions configures file transfer behavior
@@ -18,6 +20,7 @@ type TransferOptions struct {
 	ForceDownload bool   // Set Content-Disposition: attachment
 	Filename      string // Override filename in Content-Disposition
 	ContentType   string // Override auto-detected content type
+	WholeFile     bool   // Ignore Range headers and always send the whole file
 
 	// Upload validation
 	MaxFileSize   int64    // Maximum allowed file size (0 = unlimited)
@@ -61,7 +64,11 @@ func ServeFileWithRange(w http.ResponseWriter, r *http.Request, filePath string,
 
 	// Set common headers
 	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Accept-Ranges", "bytes")
+	if opts != nil && opts.WholeFile {
+		w.Header().Set("Accept-Ranges", "none")
+	} else {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
 	w.Header().Set("Last-Modified", stat.ModTime().UTC().Format(http.TimeFormat))
 	w.Header().Set("ETag", generateETag(stat))
 
@@ -80,6 +87,9 @@ func ServeFileWithRange(w http.ResponseWriter, r *http.Request, filePath string,
 
 	// Parse Range header
 	rangeHeader := r.Header.Get("Range")
+	if opts != nil && opts.WholeFile {
+		rangeHeader = ""
+	}
 	if rangeHeader == "" {
 		// No range requested - serve entire file
 		w.Header().Set("Content-Length", strconv.FormatInt(stat.Size(), 10))
@@ -101,7 +111,7 @@ func ServeFileWithRange(w http.ResponseWriter, r *http.Request, filePath string,
 	if len(ranges) == 0 {
 		// Range not satisfiable
 		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", stat.Size()))
-		http.Error(w, "Range Not Satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		apierror.Write(w, http.StatusRequestedRangeNotSatisfiable, apierror.CodeRangeNotSatisfiable, "Range Not Satisfiable", nil)
 		return nil
 	}
 
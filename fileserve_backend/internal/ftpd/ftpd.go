@@ -0,0 +1,836 @@
+// Package ftpd implements a small FTP server (RFC 959 with the RFC 2228/4217 explicit TLS,
+// RFC 2428 extended passive mode and RFC 3659 size/mtime extensions) on top of a virtual file system.
+package ftpd
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileserv/internal/vfs"
+)
+
+// AuthFunc verifies a login and returns the file system for the session
+type AuthFunc func(username, password, remoteIP string) (vfs.FileSystem, error)
+
+// Config configures an FTP server
+type Config struct {
+	// TLS enables explicit FTPS (AUTH TLS) when set
+	TLS *tls.Config
+	// RequireTLS refuses logins on connections that have not been upgraded to TLS
+	RequireTLS bool
+	// PassivePortMin and PassivePortMax bound the ports used for passive data connections
+	PassivePortMin int
+	PassivePortMax int
+	// PublicHost is the address announced in PASV replies (defaults to the control connection's local address)
+	PublicHost string
+}
+
+const (
+	// idleTimeout disconnects control connections without activity
+	idleTimeout = 5 * time.Minute
+	// dataTimeout bounds how long the server waits for a data connection
+	dataTimeout = 30 * time.Second
+	// maxLoginAttempts is the number of failed PASS commands before the connection is closed
+	maxLoginAttempts = 3
+)
+
+// Server accepts FTP control connections
+type Server struct {
+	config   Config
+	auth     AuthFunc
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+	nextPort  int
+	usedPorts map[int]bool
+}
+
+// NewServer creates an FTP server
+func NewServer(config Config, auth AuthFunc) *Server {
+	return &Server{
+		config:    config,
+		auth:      auth,
+		conns:     make(map[net.Conn]struct{}),
+		usedPorts: make(map[int]bool),
+	}
+}
+
+// Listen starts accepting connections on addr
+func (s *Server) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Printf("FTP: accept failed: %v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serveConn(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Close stops the listener and disconnects all clients
+func (s *Server) Close() error {
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// listenPassive opens a listener on the next free port of the passive range
+func (s *Server) listenPassive(host string) (net.Listener, int, error) {
+	min, max := s.config.PassivePortMin, s.config.PassivePortMax
+	if min <= 0 || max < min {
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+		if err != nil {
+			return nil, 0, err
+		}
+		return listener, listener.Addr().(*net.TCPAddr).Port, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := max - min + 1
+	for i := 0; i < count; i++ {
+		port := min + (s.nextPort+i)%count
+		if s.usedPorts[port] {
+			continue
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			continue
+		}
+		s.nextPort = (s.nextPort + i + 1) % count
+		s.usedPorts[port] = true
+		return listener, port, nil
+	}
+	return nil, 0, errors.New("no free passive port")
+}
+
+func (s *Server) releasePassive(port int) {
+	s.mu.Lock()
+	delete(s.usedPorts, port)
+	s.mu.Unlock()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	c := &session{server: s, conn: conn, cwd: "/"}
+	c.setConn(conn)
+	defer func() {
+		c.closeData()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		c.conn.Close()
+	}()
+
+	c.reply(220, "FileServ FTP server ready")
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd, arg, _ := strings.Cut(line, " ")
+		if quit := c.handle(strings.ToUpper(cmd), arg); quit {
+			return
+		}
+	}
+}
+
+// session is one FTP control connection
+type session struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	tls        bool
+	protected  bool // PROT P: data connections use TLS
+	username   string
+	fs         vfs.FileSystem
+	failures   int
+	cwd        string
+	restOffset int64
+	renameFrom string
+
+	passive     net.Listener
+	passivePort int
+	activeAddr  string
+}
+
+func (c *session) setConn(conn net.Conn) {
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	c.writer = bufio.NewWriter(conn)
+}
+
+func (c *session) reply(code int, msg string) {
+	fmt.Fprintf(c.writer, "%d %s\r\n", code, msg)
+	c.writer.Flush()
+}
+
+func (c *session) replyLines(code int, lines []string) {
+	fmt.Fprintf(c.writer, "%d-%s\r\n", code, lines[0])
+	for _, line := range lines[1 : len(lines)-1] {
+		fmt.Fprintf(c.writer, " %s\r\n", line)
+	}
+	fmt.Fprintf(c.writer, "%d %s\r\n", code, lines[len(lines)-1])
+	c.writer.Flush()
+}
+
+func (c *session) remoteIP() string {
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	return host
+}
+
+// resolve makes a client path absolute relative to the working directory
+func (c *session) resolve(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(c.cwd, p)
+	}
+	return path.Clean("/" + p)
+}
+
+// handle runs one command and reports whether the connection should be closed
+func (c *session) handle(cmd, arg string) bool {
+	// Commands allowed before login
+	switch cmd {
+	case "QUIT":
+		c.reply(221, "Goodbye")
+		return true
+	case "NOOP":
+		c.reply(200, "OK")
+		return false
+	case "SYST":
+		c.reply(215, "UNIX Type: L8")
+		return false
+	case "FEAT":
+		features := []string{"Features:", "EPSV", "PASV", "SIZE", "MDTM", "REST STREAM", "UTF8", "MLSD"}
+		if c.server.config.TLS != nil {
+			features = append(features, "AUTH TLS", "PBSZ", "PROT")
+		}
+		c.replyLines(211, append(features, "End"))
+		return false
+	case "OPTS":
+		if strings.EqualFold(arg, "UTF8 ON") {
+			c.reply(200, "UTF8 mode enabled")
+		} else {
+			c.reply(501, "Option not supported")
+		}
+		return false
+	case "AUTH":
+		c.cmdAuth(arg)
+		return false
+	case "PBSZ":
+		if !c.tls {
+			c.reply(503, "PBSZ requires AUTH TLS")
+		} else {
+			c.reply(200, "PBSZ=0")
+		}
+		return false
+	case "PROT":
+		c.cmdProt(arg)
+		return false
+	case "USER":
+		if c.server.config.RequireTLS && !c.tls {
+			c.reply(530, "TLS is required, use AUTH TLS")
+			return false
+		}
+		c.username = arg
+		c.fs = nil
+		c.reply(331, "Password required")
+		return false
+	case "PASS":
+		return c.cmdPass(arg)
+	}
+
+	if c.fs == nil {
+		c.reply(530, "Not logged in")
+		return false
+	}
+
+	switch cmd {
+	case "PWD", "XPWD":
+		c.reply(257, fmt.Sprintf("%q is the current directory", c.cwd))
+	case "CWD", "XCWD":
+		c.cmdCwd(c.resolve(arg))
+	case "CDUP", "XCUP":
+		c.cmdCwd(path.Dir(c.cwd))
+	case "TYPE":
+		// Files are always transferred unmodified; ASCII mode is accepted for old clients
+		switch strings.ToUpper(strings.TrimSpace(arg)) {
+		case "I", "L 8":
+			c.reply(200, "Type set to I")
+		case "A", "A N":
+			c.reply(200, "Type set to A")
+		default:
+			c.reply(504, "Type not supported")
+		}
+	case "MODE":
+		if strings.EqualFold(arg, "S") {
+			c.reply(200, "Mode set to S")
+		} else {
+			c.reply(504, "Mode not supported")
+		}
+	case "STRU":
+		if strings.EqualFold(arg, "F") {
+			c.reply(200, "Structure set to F")
+		} else {
+			c.reply(504, "Structure not supported")
+		}
+	case "PASV":
+		c.cmdPasv(false)
+	case "EPSV":
+		c.cmdPasv(true)
+	case "PORT":
+		c.cmdPort(arg)
+	case "EPRT":
+		c.cmdEprt(arg)
+	case "LIST", "NLST", "MLSD":
+		c.cmdList(cmd, arg)
+	case "MLST":
+		c.cmdMlst(arg)
+	case "RETR":
+		c.cmdRetr(c.resolve(arg))
+	case "STOR":
+		c.cmdStor(c.resolve(arg), false)
+	case "APPE":
+		c.cmdStor(c.resolve(arg), true)
+	case "REST":
+		offset, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || offset < 0 {
+			c.reply(501, "Invalid offset")
+			return false
+		}
+		c.restOffset = offset
+		c.reply(350, fmt.Sprintf("Restarting at %d", offset))
+	case "SIZE":
+		info, err := c.fs.Stat(c.resolve(arg))
+		if err != nil || info.IsDir() {
+			c.reply(550, "Could not get file size")
+			return false
+		}
+		c.reply(213, strconv.FormatInt(info.Size(), 10))
+	case "MDTM":
+		info, err := c.fs.Stat(c.resolve(arg))
+		if err != nil {
+			c.reply(550, "Could not get modification time")
+			return false
+		}
+		c.reply(213, info.ModTime().UTC().Format("20060102150405"))
+	case "DELE":
+		c.cmdRemove(c.resolve(arg), false)
+	case "RMD", "XRMD":
+		c.cmdRemove(c.resolve(arg), true)
+	case "MKD", "XMKD":
+		p := c.resolve(arg)
+		if err := c.fs.Mkdir(p); err != nil {
+			c.replyError(err)
+			return false
+		}
+		c.reply(257, fmt.Sprintf("%q created", p))
+	case "RNFR":
+		p := c.resolve(arg)
+		if _, err := c.fs.Stat(p); err != nil {
+			c.replyError(err)
+			return false
+		}
+		c.renameFrom = p
+		c.reply(350, "Ready for RNTO")
+	case "RNTO":
+		if c.renameFrom == "" {
+			c.reply(503, "RNFR required first")
+			return false
+		}
+		from := c.renameFrom
+		c.renameFrom = ""
+		if err := c.fs.Rename(from, c.resolve(arg)); err != nil {
+			c.replyError(err)
+			return false
+		}
+		c.reply(250, "Rename successful")
+	case "ALLO":
+		c.reply(202, "No storage allocation necessary")
+	case "ABOR":
+		c.closeData()
+		c.reply(226, "Abort successful")
+	default:
+		c.reply(502, "Command not implemented")
+	}
+	return false
+}
+
+func (c *session) cmdAuth(arg string) {
+	mech := strings.ToUpper(arg)
+	if c.server.config.TLS == nil || (mech != "TLS" && mech != "SSL" && mech != "TLS-C") {
+		c.reply(504, "AUTH not supported")
+		return
+	}
+	if c.tls {
+		c.reply(503, "Already using TLS")
+		return
+	}
+	c.reply(234, "AUTH TLS successful")
+
+	tlsConn := tls.Server(c.conn, c.server.config.TLS)
+	tlsConn.SetDeadline(time.Now().Add(dataTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		c.conn.Close()
+		return
+	}
+	tlsConn.SetDeadline(time.Time{})
+	c.setConn(tlsConn)
+	c.tls = true
+}
+
+func (c *session) cmdProt(arg string) {
+	if !c.tls {
+		c.reply(503, "PROT requires AUTH TLS")
+		return
+	}
+	switch strings.ToUpper(arg) {
+	case "P":
+		c.protected = true
+		c.reply(200, "Data connections will be protected")
+	case "C":
+		if c.server.config.RequireTLS {
+			c.reply(534, "Data connections must be protected")
+			return
+		}
+		c.protected = false
+		c.reply(200, "Data connections will not be protected")
+	default:
+		c.reply(504, "PROT level not supported")
+	}
+}
+
+func (c *session) cmdPass(password string) bool {
+	if c.username == "" {
+		c.reply(503, "Send USER first")
+		return false
+	}
+
+	fs, err := c.server.auth(c.username, password, c.remoteIP())
+	if err != nil {
+		c.failures++
+		c.reply(530, "Login incorrect")
+		return c.failures >= maxLoginAttempts
+	}
+
+	c.fs = fs
+	c.cwd = "/"
+	c.reply(230, "Login successful")
+	return false
+}
+
+func (c *session) cmdCwd(p string) {
+	info, err := c.fs.Stat(p)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if !info.IsDir() {
+		c.reply(550, "Not a directory")
+		return
+	}
+	c.cwd = p
+	c.reply(250, "Directory changed to "+p)
+}
+
+func (c *session) cmdRemove(p string, dir bool) {
+	info, err := c.fs.Stat(p)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if info.IsDir() != dir {
+		if dir {
+			c.reply(550, "Not a directory")
+		} else {
+			c.reply(550, "Is a directory")
+		}
+		return
+	}
+	if err := c.fs.Remove(p); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.reply(250, "Deleted")
+}
+
+// replyError maps file system errors to FTP replies
+func (c *session) replyError(err error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		c.reply(550, "No such file or directory")
+	case errors.Is(err, os.ErrPermission):
+		c.reply(550, "Permission denied")
+	case errors.Is(err, os.ErrExist):
+		c.reply(550, "File exists")
+	default:
+		c.reply(550, err.Error())
+	}
+}
+
+// ========================================================================
+// Data connections
+// ========================================================================
+
+func (c *session) closeData() {
+	if c.passive != nil {
+		c.passive.Close()
+		c.server.releasePassive(c.passivePort)
+		c.passive = nil
+	}
+	c.activeAddr = ""
+}
+
+func (c *session) cmdPasv(extended bool) {
+	c.closeData()
+
+	localHost, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+	listener, port, err := c.server.listenPassive(localHost)
+	if err != nil {
+		c.reply(425, "Cannot open passive connection")
+		return
+	}
+	c.passive = listener
+	c.passivePort = port
+
+	if extended {
+		c.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+		return
+	}
+
+	host := c.server.config.PublicHost
+	if host == "" {
+		host = localHost
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		if addrs, err := net.LookupIP(host); err == nil && len(addrs) > 0 {
+			ip = addrs[0]
+		}
+	}
+	ip4 := ip.To4()
+	if ip4 == nil {
+		c.closeData()
+		c.reply(425, "PASV requires IPv4, use EPSV")
+		return
+	}
+	c.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip4[0], ip4[1], ip4[2], ip4[3], port>>8, port&0xff))
+}
+
+func (c *session) cmdPort(arg string) {
+	parts := strings.Split(arg, ",")
+	if len(parts) != 6 {
+		c.reply(501, "Invalid PORT argument")
+		return
+	}
+	nums := make([]int, 6)
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 || n > 255 {
+			c.reply(501, "Invalid PORT argument")
+			return
+		}
+		nums[i] = n
+	}
+	host := fmt.Sprintf("%d.%d.%d.%d", nums[0], nums[1], nums[2], nums[3])
+	c.setActive(host, nums[4]<<8|nums[5])
+}
+
+func (c *session) cmdEprt(arg string) {
+	if len(arg) < 2 {
+		c.reply(501, "Invalid EPRT argument")
+		return
+	}
+	parts := strings.Split(arg[1:], arg[:1])
+	if len(parts) < 3 {
+		c.reply(501, "Invalid EPRT argument")
+		return
+	}
+	port, err := strconv.Atoi(parts[2])
+	if err != nil {
+		c.reply(501, "Invalid EPRT argument")
+		return
+	}
+	c.setActive(parts[1], port)
+}
+
+// setActive records the client address for an active mode data connection.
+// Only the client's own address is accepted to prevent FTP bounce attacks.
+func (c *session) setActive(host string, port int) {
+	c.closeData()
+	if ip := net.ParseIP(host); ip == nil || !ip.Equal(net.ParseIP(c.remoteIP())) || port < 1024 || port > 65535 {
+		c.reply(501, "Active connections are only allowed to your own address")
+		return
+	}
+	c.activeAddr = net.JoinHostPort(host, strconv.Itoa(port))
+	c.reply(200, "PORT command successful")
+}
+
+// openData opens the data connection prepared by PASV/EPSV or PORT/EPRT
+func (c *session) openData() (net.Conn, error) {
+	var conn net.Conn
+	switch {
+	case c.passive != nil:
+		listener := c.passive
+		port := c.passivePort
+		c.passive = nil
+		defer func() {
+			listener.Close()
+			c.server.releasePassive(port)
+		}()
+
+		if tl, ok := listener.(*net.TCPListener); ok {
+			tl.SetDeadline(time.Now().Add(dataTimeout))
+		}
+		for {
+			accepted, err := listener.Accept()
+			if err != nil {
+				return nil, err
+			}
+			// Only the logged in client may connect to its passive port
+			host, _, _ := net.SplitHostPort(accepted.RemoteAddr().String())
+			if host != c.remoteIP() {
+				accepted.Close()
+				continue
+			}
+			conn = accepted
+			break
+		}
+	case c.activeAddr != "":
+		addr := c.activeAddr
+		c.activeAddr = ""
+		dialed, err := net.DialTimeout("tcp", addr, dataTimeout)
+		if err != nil {
+			return nil, err
+		}
+		conn = dialed
+	default:
+		return nil, errors.New("use PASV or PORT first")
+	}
+
+	if c.protected {
+		tlsConn := tls.Server(conn, c.server.config.TLS)
+		tlsConn.SetDeadline(time.Now().Add(dataTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+// transfer runs fn on a new data connection and sends the matching replies
+func (c *session) transfer(fn func(conn net.Conn) error) {
+	if c.server.config.RequireTLS && !c.protected {
+		c.closeData()
+		c.reply(521, "Data connections must be protected, use PROT P")
+		return
+	}
+
+	c.reply(150, "Opening data connection")
+	conn, err := c.openData()
+	if err != nil {
+		c.reply(425, "Cannot open data connection")
+		return
+	}
+
+	err = fn(conn)
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		c.reply(451, "Transfer failed: "+err.Error())
+		return
+	}
+	c.reply(226, "Transfer complete")
+}
+
+func (c *session) cmdList(cmd, arg string) {
+	// Ignore ls style options sent by many clients ("LIST -la")
+	for strings.HasPrefix(arg, "-") {
+		_, arg, _ = strings.Cut(arg, " ")
+	}
+	p := c.resolve(arg)
+
+	info, err := c.fs.Stat(p)
+	if err != nil {
+		c.closeData()
+		c.replyError(err)
+		return
+	}
+
+	var entries []os.FileInfo
+	if info.IsDir() {
+		entries, err = c.fs.ReadDir(p)
+		if err != nil {
+			c.closeData()
+			c.replyError(err)
+			return
+		}
+	} else if cmd == "MLSD" {
+		c.closeData()
+		c.reply(501, "Not a directory")
+		return
+	} else {
+		entries = []os.FileInfo{info}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	c.transfer(func(conn net.Conn) error {
+		w := bufio.NewWriter(conn)
+		for _, e := range entries {
+			switch cmd {
+			case "NLST":
+				fmt.Fprintf(w, "%s\r\n", e.Name())
+			case "MLSD":
+				fmt.Fprintf(w, "%s %s\r\n", mlsxFacts(e), e.Name())
+			default:
+				fmt.Fprintf(w, "%s\r\n", listLine(e))
+			}
+		}
+		return w.Flush()
+	})
+}
+
+func (c *session) cmdMlst(arg string) {
+	p := c.resolve(arg)
+	info, err := c.fs.Stat(p)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.replyLines(250, []string{"Listing " + p, mlsxFacts(info) + " " + p, "End"})
+}
+
+func (c *session) cmdRetr(p string) {
+	offset := c.restOffset
+	c.restOffset = 0
+
+	info, err := c.fs.Stat(p)
+	if err == nil && info.IsDir() {
+		err = errors.New("is a directory")
+	}
+	var f vfs.File
+	if err == nil {
+		f, err = c.fs.OpenFile(p, os.O_RDONLY)
+	}
+	if err != nil {
+		c.closeData()
+		c.replyError(err)
+		return
+	}
+	defer f.Close()
+
+	c.transfer(func(conn net.Conn) error {
+		_, err := io.Copy(conn, io.NewSectionReader(f, offset, math.MaxInt64-offset))
+		return err
+	})
+}
+
+func (c *session) cmdStor(p string, appendMode bool) {
+	offset := c.restOffset
+	c.restOffset = 0
+
+	flag := os.O_WRONLY | os.O_CREATE
+	if appendMode {
+		offset = 0
+		if info, err := c.fs.Stat(p); err == nil {
+			offset = info.Size()
+		}
+	} else if offset == 0 {
+		flag |= os.O_TRUNC
+	}
+
+	f, err := c.fs.OpenFile(p, flag)
+	if err != nil {
+		c.closeData()
+		c.replyError(err)
+		return
+	}
+
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	c.transfer(func(conn net.Conn) error {
+		_, err := io.Copy(io.NewOffsetWriter(f, offset), conn)
+		closeErr := f.Close()
+		f = nil
+		if err == nil {
+			err = closeErr
+		}
+		return err
+	})
+}
+
+// listLine formats an entry like "ls -l", which is what most clients parse
+func listLine(info os.FileInfo) string {
+	modTime := info.ModTime()
+	timeStr := modTime.Format("Jan _2 15:04")
+	if time.Since(modTime) > 180*24*time.Hour {
+		timeStr = modTime.Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s 1 ftp ftp %12d %s %s", info.Mode().String(), info.Size(), timeStr, info.Name())
+}
+
+// mlsxFacts formats the machine readable facts of an entry (RFC 3659)
+func mlsxFacts(info os.FileInfo) string {
+	kind := "file"
+	if info.IsDir() {
+		kind = "dir"
+	}
+	return fmt.Sprintf("type=%s;size=%d;modify=%s;", kind, info.Size(), info.ModTime().UTC().Format("20060102150405"))
+}
@@ -0,0 +1,169 @@
+// Package geoip maps IP addresses to countries using a CSV database of address ranges.
+//
+// Each line holds either a network and a country ("1.0.0.0/24,AU") or the first address, the
+// last address and a country ("1.0.0.0,1.0.0.255,AU"). Addresses may be written as decimal
+// integers, as in the IP2Location LITE databases; the DB-IP lite country CSV works as is.
+// Extra columns after the country are ignored.
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ipRange is a range of addresses located in one country
+type ipRange struct {
+	first   netip.Addr
+	last    netip.Addr
+	country string
+}
+
+// Database is a loaded GeoIP database. It is read-only and safe for concurrent use.
+type Database struct {
+	ranges []ipRange // Sorted by first address
+}
+
+// Open loads a database file
+func Open(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read loads a database from r
+func Read(r io.Reader) (*Database, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.ReuseRecord = true
+
+	db := &Database{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rng, err := parseRecord(record)
+		if err != nil {
+			// Tolerate a header line
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rng.country == "" || rng.country == "-" || rng.country == "ZZ" {
+			continue // Unassigned or reserved addresses
+		}
+		db.ranges = append(db.ranges, rng)
+	}
+
+	if len(db.ranges) == 0 {
+		return nil, errors.New("no address ranges found")
+	}
+	slices.SortFunc(db.ranges, func(a, b ipRange) int { return a.first.Compare(b.first) })
+	return db, nil
+}
+
+// parseRecord parses a "network,country" or "first,last,country" line
+func parseRecord(record []string) (ipRange, error) {
+	var rng ipRange
+	if len(record) < 2 {
+		return rng, errors.New("expected a network or an address range and a country")
+	}
+
+	if prefix, err := netip.ParsePrefix(strings.TrimSpace(record[0])); err == nil {
+		prefix = prefix.Masked()
+		rng.first = prefix.Addr()
+		rng.last = lastAddr(prefix)
+		rng.country = strings.ToUpper(strings.TrimSpace(record[1]))
+		return rng, nil
+	}
+
+	if len(record) < 3 {
+		return rng, errors.New("expected a network or an address range and a country")
+	}
+	first, err := parseAddr(record[0])
+	if err != nil {
+		return rng, err
+	}
+	last, err := parseAddr(record[1])
+	if err != nil {
+		return rng, err
+	}
+	if first.Is4() != last.Is4() || last.Less(first) {
+		return rng, fmt.Errorf("invalid range %s-%s", first, last)
+	}
+	rng.first, rng.last = first, last
+	rng.country = strings.ToUpper(strings.TrimSpace(record[2]))
+	return rng, nil
+}
+
+// parseAddr parses an address written as text or as a decimal integer
+func parseAddr(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), nil
+	}
+
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", s)
+	}
+	if n.BitLen() <= 32 {
+		var b [4]byte
+		n.FillBytes(b[:])
+		return netip.AddrFrom4(b), nil
+	}
+	var b [16]byte
+	n.FillBytes(b[:])
+	return netip.AddrFrom16(b).Unmap(), nil
+}
+
+// lastAddr returns the last address of a masked prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Country returns the ISO 3166 code of the country of addr, or "" if it is not in the database
+func (db *Database) Country(addr netip.Addr) string {
+	addr = addr.Unmap()
+	// Find the last range starting at or before addr
+	i, found := slices.BinarySearchFunc(db.ranges, addr, func(r ipRange, a netip.Addr) int {
+		return r.first.Compare(a)
+	})
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return ""
+	}
+	rng := db.ranges[i]
+	if rng.first.Is4() != addr.Is4() || rng.last.Less(addr) {
+		return ""
+	}
+	return rng.country
+}
+
+// Len returns the number of address ranges in the database
+func (db *Database) Len() int {
+	return len(db.ranges)
+}
@@ -0,0 +1,148 @@
+// Package notify delivers notifications to chat and push services over HTTP.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Services a notification can be delivered to
+const (
+	ServiceWebhook = "webhook" // Generic JSON POST
+	ServiceSlack   = "slack"   // Slack incoming webhook
+	ServiceDiscord = "discord" // Discord webhook
+	ServiceNtfy    = "ntfy"    // ntfy topic
+)
+
+// Levels used to pick the ntfy priority and tags
+const (
+	LevelInfo     = "info"
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+// requestTimeout bounds delivery of a single notification
+const requestTimeout = 10 * time.Second
+
+// discordMaxContent is the longest message Discord accepts
+const discordMaxContent = 2000
+
+var client = &http.Client{Timeout: requestTimeout}
+
+// Target is where a notification is delivered
+type Target struct {
+	Service string
+	URL     string
+	Token   string // Sent as a bearer token to webhook and ntfy targets
+}
+
+// Message is a single notification
+type Message struct {
+	Event string                 `json:"event"`
+	Title string                 `json:"title"`
+	Body  string                 `json:"body"`
+	Level string                 `json:"level"`
+	Time  time.Time              `json:"time"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+}
+
+// ValidateURL checks that s is an absolute http(s) URL
+func ValidateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("URL must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// Send delivers a message to a target
+func Send(target Target, msg *Message) error {
+	if err := ValidateURL(target.URL); err != nil {
+		return err
+	}
+
+	var req *http.Request
+	var err error
+	switch target.Service {
+	case ServiceWebhook:
+		req, err = jsonRequest(target.URL, msg)
+	case ServiceSlack:
+		req, err = jsonRequest(target.URL, map[string]string{
+			"text": fmt.Sprintf("*%s*\n%s", msg.Title, msg.Body),
+		})
+	case ServiceDiscord:
+		content := fmt.Sprintf("**%s**\n%s", msg.Title, msg.Body)
+		if len(content) > discordMaxContent {
+			content = content[:discordMaxContent-3] + "..."
+		}
+		req, err = jsonRequest(target.URL, map[string]string{"content": content})
+	case ServiceNtfy:
+		req, err = ntfyRequest(target.URL, msg)
+	default:
+		return fmt.Errorf("unknown notification service %q", target.Service)
+	}
+	if err != nil {
+		return err
+	}
+	if target.Token != "" && (target.Service == ServiceWebhook || target.Service == ServiceNtfy) {
+		req.Header.Set("Authorization", "Bearer "+target.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if text := strings.TrimSpace(string(body)); text != "" {
+			return fmt.Errorf("%s returned %s: %s", target.Service, resp.Status, text)
+		}
+		return fmt.Errorf("%s returned %s", target.Service, resp.Status)
+	}
+	return nil
+}
+
+// jsonRequest builds a POST with payload as the JSON body
+func jsonRequest(target string, payload interface{}) (*http.Request, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// ntfyRequest builds a publish request for an ntfy topic URL. The body is the message text;
+// title, priority and tags go in headers.
+func ntfyRequest(target string, msg *Message) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(msg.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Title", msg.Title)
+	switch msg.Level {
+	case LevelCritical:
+		req.Header.Set("Priority", "urgent")
+		req.Header.Set("Tags", "rotating_light")
+	case LevelWarning:
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "warning")
+	default:
+		req.Header.Set("Priority", "default")
+		req.Header.Set("Tags", "information_source")
+	}
+	return req, nil
+}
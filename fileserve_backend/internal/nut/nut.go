@@ -0,0 +1,165 @@
+// Package nut reads UPS variables from a Network UPS Tools server (upsd) using its text protocol.
+package nut
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the port upsd listens on
+const DefaultPort = 3493
+
+// UPS is a device served by upsd
+type UPS struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Client talks to upsd over TCP ("host:port")
+type Client struct {
+	Address string
+	Timeout time.Duration
+}
+
+// New creates a client for the given upsd address
+func New(address string) *Client {
+	return &Client{Address: address, Timeout: 10 * time.Second}
+}
+
+// query sends a LIST command and returns the fields of the lines between BEGIN and END
+func (c *Client) query(cmd string) ([][]string, error) {
+	conn, err := net.DialTimeout("tcp", c.Address, c.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to upsd at %s: %w", c.Address, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+
+	if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+		return nil, err
+	}
+	// Say goodbye so upsd closes the connection; the reply is not needed
+	defer conn.Write([]byte("LOGOUT\n"))
+
+	reader := bufio.NewReader(conn)
+	var lines [][]string
+	begun := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upsd reply: %w", err)
+		}
+		fields, err := splitFields(strings.TrimRight(line, "\r\n"))
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case fields[0] == "ERR":
+			return nil, replyError(fields)
+		case fields[0] == "BEGIN":
+			begun = true
+		case fields[0] == "END":
+			return lines, nil
+		case begun:
+			lines = append(lines, fields)
+		default:
+			return nil, fmt.Errorf("unexpected upsd reply: %s", line)
+		}
+	}
+}
+
+// replyError turns an "ERR <code>" reply into an error
+func replyError(fields []string) error {
+	if len(fields) < 2 {
+		return errors.New("upsd: unknown error")
+	}
+	switch fields[1] {
+	case "UNKNOWN-UPS":
+		return errors.New("upsd: unknown UPS")
+	case "ACCESS-DENIED":
+		return errors.New("upsd: access denied")
+	case "DATA-STALE":
+		return errors.New("upsd: the UPS driver is not reporting (stale data)")
+	case "DRIVER-NOT-CONNECTED":
+		return errors.New("upsd: the UPS driver is not running")
+	}
+	return fmt.Errorf("upsd: %s", strings.Join(fields[1:], " "))
+}
+
+// List returns the devices upsd serves
+func (c *Client) List() ([]UPS, error) {
+	lines, err := c.query("LIST UPS")
+	if err != nil {
+		return nil, err
+	}
+	devices := []UPS{}
+	for _, fields := range lines {
+		// UPS <name> "<description>"
+		if len(fields) >= 3 && fields[0] == "UPS" {
+			devices = append(devices, UPS{Name: fields[1], Description: fields[2]})
+		}
+	}
+	return devices, nil
+}
+
+// Vars returns the variables of a UPS, such as ups.status and battery.charge
+func (c *Client) Vars(ups string) (map[string]string, error) {
+	if ups == "" || strings.ContainsAny(ups, " \t\r\n\"") {
+		return nil, fmt.Errorf("invalid UPS name %q", ups)
+	}
+	lines, err := c.query("LIST VAR " + ups)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string)
+	for _, fields := range lines {
+		// VAR <ups> <name> "<value>"
+		if len(fields) >= 4 && fields[0] == "VAR" {
+			vars[fields[2]] = fields[3]
+		}
+	}
+	return vars, nil
+}
+
+// splitFields splits a reply line into words; double-quoted words may contain spaces and
+// backslash-escaped quotes and backslashes
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var word strings.Builder
+	inWord, quoted, escaped := false, false, false
+	for _, ch := range line {
+		switch {
+		case escaped:
+			word.WriteRune(ch)
+			escaped = false
+		case quoted && ch == '\\':
+			escaped = true
+		case ch == '"':
+			quoted = !quoted
+			inWord = true
+		case !quoted && (ch == ' ' || ch == '\t'):
+			if inWord {
+				fields = append(fields, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in upsd reply: %s", line)
+	}
+	if inWord {
+		fields = append(fields, word.String())
+	}
+	return fields, nil
+}
@@ -0,0 +1,295 @@
+// Package openapi builds an OpenAPI 3 document from the routes registered on a chi router.
+//
+// The document is generated from the router itself, so every route in main.go is described
+// without a separate list to keep in sync. Operations are named after their handlers
+// ("ListShareZones" becomes "List share zones"), tagged by the first path segment below /api
+// (or below /api/admin), and marked as requiring authentication or an admin account from the
+// middleware they run behind. Request and response bodies are not described.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string                 `json:"openapi"`
+	Info       Info                   `json:"info"`
+	Servers    []Server               `json:"servers,omitempty"`
+	Tags       []Tag                  `json:"tags,omitempty"`
+	Paths      map[string]PathItem    `json:"paths"`
+	Components map[string]interface{} `json:"components,omitempty"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a base URL of the API
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Tag groups operations
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// PathItem maps lower-case HTTP methods to operations
+type PathItem map[string]*Operation
+
+// Operation is one method of a path
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path parameter
+type Parameter struct {
+	Name        string            `json:"name"`
+	In          string            `json:"in"`
+	Required    bool              `json:"required"`
+	Description string            `json:"description,omitempty"`
+	Schema      map[string]string `json:"schema"`
+}
+
+// RequestBody is the body of a request
+type RequestBody struct {
+	Content map[string]interface{} `json:"content"`
+}
+
+// Response is a response of an operation
+type Response struct {
+	Description string `json:"description"`
+}
+
+// Middleware recognised by name, see middlewareName
+const (
+	authMiddleware  = "fileserv/middleware.Auth"
+	adminMiddleware = "fileserv/middleware.RequireAdmin"
+)
+
+// paramPattern matches chi path parameters, with an optional regular expression
+var paramPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// operationIDSeparators are the characters of a path replaced in operation IDs
+var operationIDSeparators = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// methods are the HTTP methods OpenAPI can describe; WebDAV methods such as LOCK are left out
+var methods = map[string]bool{
+	http.MethodGet: true, http.MethodPut: true, http.MethodPost: true, http.MethodDelete: true,
+	http.MethodOptions: true, http.MethodHead: true, http.MethodPatch: true, http.MethodTrace: true,
+}
+
+// funcName returns the full name of the function behind a handler or middleware
+func funcName(fn interface{}) string {
+	if h, ok := fn.(http.HandlerFunc); ok {
+		fn = (func(http.ResponseWriter, *http.Request))(h)
+	}
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return v.Type().String()
+	}
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
+}
+
+// middlewareName returns the name of a middleware, without the suffix of the closure a
+// constructor such as middleware.Auth(...) returns
+func middlewareName(mw func(http.Handler) http.Handler) string {
+	parts := strings.Split(funcName(mw), ".")
+	for len(parts) > 1 && closureSuffix.MatchString(parts[len(parts)-1]) {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, ".")
+}
+
+// closureSuffix matches the name the compiler gives closures, "func1" or just "1"
+var closureSuffix = regexp.MustCompile(`^(func)?[0-9]+$`)
+
+// handlerName returns the name of the handler method or constructor, e.g. "ListShareZones"
+// for "fileserv/handlers.(*ZoneHandler).ListShareZones-fm" and "Login" for
+// "fileserv/handlers.Login.func1"
+func handlerName(h http.Handler) string {
+	name := funcName(h)
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimSuffix(name, "-fm")
+	parts := strings.Split(name, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		part := parts[i]
+		if part == "" || part[0] == '(' || closureSuffix.MatchString(part) {
+			continue
+		}
+		return part
+	}
+	return name
+}
+
+// summarize turns a handler name into a sentence: "ListShareZones" becomes "List share zones"
+// and "GetZFSPools" becomes "Get ZFS pools"
+func summarize(name string) string {
+	runes := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i < len(runes) {
+			prev, cur := runes[i-1], runes[i]
+			next := rune(0)
+			if i+1 < len(runes) {
+				next = runes[i+1]
+			}
+			lowerToUpper := unicode.IsLower(prev) && unicode.IsUpper(cur)
+			acronymEnd := unicode.IsUpper(prev) && unicode.IsUpper(cur) && unicode.IsLower(next)
+			if !lowerToUpper && !acronymEnd {
+				continue
+			}
+		}
+		word := string(runes[start:i])
+		if start > 0 && !isAcronym(word) {
+			word = strings.ToLower(word)
+		}
+		words = append(words, word)
+		start = i
+	}
+	return strings.Join(words, " ")
+}
+
+// isAcronym reports whether a word is all upper case, like "ZFS" or "SMB"
+func isAcronym(word string) bool {
+	return len(word) > 1 && strings.ToUpper(word) == word
+}
+
+// tagFor groups a route by its first path segment below /api or /api/admin
+func tagFor(route string) string {
+	if strings.HasPrefix(route, "/s/") {
+		return "public shares"
+	}
+	segments := strings.Split(strings.TrimPrefix(route, "/api/"), "/")
+	if segments[0] == "admin" && len(segments) > 1 && !strings.HasPrefix(segments[1], "{") {
+		return segments[1]
+	}
+	return strings.TrimSuffix(segments[0], ".json")
+}
+
+// Generate describes the routes of a router below the given prefixes, e.g. "/api/"
+func Generate(routes chi.Routes, info Info, prefixes ...string) (*Document, error) {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   make(map[string]PathItem),
+		Components: map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Session token from /api/auth/login, or an API token",
+				},
+			},
+		},
+	}
+	tags := make(map[string]bool)
+
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		matched := false
+		for _, prefix := range prefixes {
+			matched = matched || strings.HasPrefix(route, prefix)
+		}
+		if !matched || !methods[method] {
+			return nil
+		}
+
+		// chi reports the trailing wildcard of a route as "*", OpenAPI needs a named parameter
+		path := strings.TrimSuffix(route, "/")
+		var params []Parameter
+		path = paramPattern.ReplaceAllStringFunc(path, func(m string) string {
+			name := paramPattern.FindStringSubmatch(m)[1]
+			params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: map[string]string{"type": "string"}})
+			return "{" + name + "}"
+		})
+		if strings.HasSuffix(path, "*") {
+			path = strings.TrimSuffix(path, "*") + "{path}"
+			params = append(params, Parameter{
+				Name:        "path",
+				In:          "path",
+				Required:    true,
+				Description: "Slash-separated path, may be empty",
+				Schema:      map[string]string{"type": "string"},
+			})
+		}
+		if path == "" {
+			path = "/"
+		}
+
+		name := handlerName(handler)
+		tag := tagFor(route)
+		tags[tag] = true
+		op := &Operation{
+			OperationID: strings.ToLower(method) + "_" + strings.Trim(operationIDSeparators.ReplaceAllString(path, "_"), "_"),
+			Summary:     summarize(name),
+			Tags:        []string{tag},
+			Parameters:  params,
+			Responses: map[string]Response{
+				"200":     {Description: "Success"},
+				"default": {Description: "Error, as JSON with code, message, details and request_id"},
+			},
+		}
+
+		for _, mw := range middlewares {
+			switch middlewareName(mw) {
+			case authMiddleware:
+				op.Security = []map[string][]string{{"bearerAuth": {}}}
+				op.Responses["401"] = Response{Description: "Not signed in"}
+			case adminMiddleware:
+				op.Description = "Requires an admin account."
+				op.Responses["403"] = Response{Description: "Not an admin"}
+			}
+		}
+
+		switch method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			op.RequestBody = &RequestBody{Content: map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]string{"type": "object"}},
+			}}
+		}
+
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = make(PathItem)
+			doc.Paths[path] = item
+		}
+		item[strings.ToLower(method)] = op
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc.Tags = append(doc.Tags, Tag{Name: name})
+	}
+	return doc, nil
+}
@@ -0,0 +1,25 @@
+package openapi
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// swaggerUI holds the Swagger UI release downloaded by make swagger-ui
+//
+//go:embed swaggerui
+var swaggerUI embed.FS
+
+// SwaggerUI returns the embedded Swagger UI assets, or false when they were not bundled
+func SwaggerUI() (fs.FS, bool) {
+	assets, err := fs.Sub(swaggerUI, "swaggerui")
+	if err != nil {
+		return nil, false
+	}
+	for _, name := range []string{"swagger-ui.css", "swagger-ui-bundle.js"} {
+		if _, err := fs.Stat(assets, name); err != nil {
+			return nil, false
+		}
+	}
+	return assets, true
+}
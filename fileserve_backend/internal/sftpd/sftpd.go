@@ -0,0 +1,640 @@
+// Package sftpd implements the server side of the SFTP protocol (version 3) on top of
+// a virtual file system. The SSH transport is handled by ssh.go.
+package sftpd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+
+	"fileserv/internal/vfs"
+)
+
+// Packet types (draft-ietf-secsh-filexfer-02)
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpLstat    = 7
+	fxpFstat    = 8
+	fxpSetstat  = 9
+	fxpFsetstat = 10
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpRealpath = 16
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpReadlink = 19
+	fxpSymlink  = 20
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+	fxpExtended = 200
+)
+
+// Status codes
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxBadMessage       = 5
+	fxOpUnsupported    = 8
+)
+
+// Open flags
+const (
+	fxfRead  = 0x01
+	fxfWrite = 0x02
+	fxfCreat = 0x08
+	fxfTrunc = 0x10
+	fxfExcl  = 0x20
+)
+
+// Attribute flags
+const (
+	attrSize        = 0x01
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+)
+
+const (
+	protocolVersion = 3
+	// maxPacketSize bounds incoming packets; clients write at most 32-256KB per request
+	maxPacketSize = 1 << 20
+	// maxReadSize bounds the data returned by a single read request
+	maxReadSize = 256 * 1024
+	// readDirBatch is the number of entries returned per readdir response
+	readDirBatch = 100
+)
+
+var errBadMessage = errors.New("malformed packet")
+
+// handle is an open file or directory listing
+type handle struct {
+	path    string
+	file    vfs.File
+	entries []os.FileInfo
+	read    bool // directory listing has been started
+}
+
+// server serves one SFTP session
+type server struct {
+	rw      io.ReadWriter
+	fs      vfs.FileSystem
+	mu      sync.Mutex
+	handles map[string]*handle
+	nextID  uint64
+}
+
+// Serve runs an SFTP session over rw until the client disconnects
+func Serve(rw io.ReadWriter, fs vfs.FileSystem) error {
+	s := &server{rw: rw, fs: fs, handles: make(map[string]*handle)}
+	defer s.closeAll()
+
+	for {
+		packet, err := s.readPacket()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := s.handle(packet); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) readPacket() ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(s.rw, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(lenBuf[:])
+	if length == 0 || length > maxPacketSize {
+		return nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(s.rw, packet); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+func (s *server) writePacket(b *buffer) error {
+	data := b.bytes()
+	out := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(out, uint32(len(data)))
+	copy(out[4:], data)
+	_, err := s.rw.Write(out)
+	return err
+}
+
+func (s *server) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, h := range s.handles {
+		if h.file != nil {
+			h.file.Close()
+		}
+		delete(s.handles, id)
+	}
+}
+
+// handle dispatches one request packet
+func (s *server) handle(packet []byte) error {
+	r := &reader{data: packet[1:]}
+	kind := packet[0]
+
+	if kind == fxpInit {
+		b := newBuffer(fxpVersion)
+		b.uint32(protocolVersion)
+		return s.writePacket(b)
+	}
+
+	id, err := r.uint32()
+	if err != nil {
+		return err
+	}
+
+	var resp *buffer
+	switch kind {
+	case fxpOpen:
+		resp = s.open(id, r)
+	case fxpClose:
+		resp = s.close(id, r)
+	case fxpRead:
+		resp = s.read(id, r)
+	case fxpWrite:
+		resp = s.write(id, r)
+	case fxpLstat, fxpStat:
+		resp = s.stat(id, r)
+	case fxpFstat:
+		resp = s.fstat(id, r)
+	case fxpSetstat, fxpFsetstat:
+		// Ownership, permissions and times are managed by the server
+		resp = statusPacket(id, fxOK, "")
+	case fxpOpendir:
+		resp = s.opendir(id, r)
+	case fxpReaddir:
+		resp = s.readdir(id, r)
+	case fxpRemove, fxpRmdir:
+		resp = s.remove(id, r, kind == fxpRmdir)
+	case fxpMkdir:
+		resp = s.mkdir(id, r)
+	case fxpRealpath:
+		resp = s.realpath(id, r)
+	case fxpRename:
+		resp = s.rename(id, r)
+	case fxpExtended:
+		resp = s.extended(id, r)
+	case fxpReadlink, fxpSymlink:
+		resp = statusPacket(id, fxOpUnsupported, "symbolic links are not supported")
+	default:
+		resp = statusPacket(id, fxOpUnsupported, "unsupported request")
+	}
+	return s.writePacket(resp)
+}
+
+func (s *server) addHandle(h *handle) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := strconv.FormatUint(s.nextID, 10)
+	s.handles[id] = h
+	return id
+}
+
+func (s *server) getHandle(r *reader) (string, *handle, bool) {
+	id, err := r.string()
+	if err != nil {
+		return "", nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.handles[id]
+	return id, h, ok
+}
+
+func (s *server) open(id uint32, r *reader) *buffer {
+	p, err := r.path()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	pflags, err := r.uint32()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+
+	// Append mode is not mapped: clients send explicit offsets with every write
+	flag := 0
+	switch {
+	case pflags&fxfRead != 0 && pflags&fxfWrite != 0:
+		flag = os.O_RDWR
+	case pflags&fxfWrite != 0:
+		flag = os.O_WRONLY
+	default:
+		flag = os.O_RDONLY
+	}
+	if pflags&fxfCreat != 0 {
+		flag |= os.O_CREATE
+	}
+	if pflags&fxfTrunc != 0 {
+		flag |= os.O_TRUNC
+	}
+	if pflags&fxfExcl != 0 {
+		flag |= os.O_EXCL
+	}
+
+	f, err := s.fs.OpenFile(p, flag)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+	return handlePacket(id, s.addHandle(&handle{path: p, file: f}))
+}
+
+func (s *server) close(id uint32, r *reader) *buffer {
+	hid, h, ok := s.getHandle(r)
+	if !ok {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+	s.mu.Lock()
+	delete(s.handles, hid)
+	s.mu.Unlock()
+
+	if h.file != nil {
+		if err := h.file.Close(); err != nil {
+			return errorStatus(id, err)
+		}
+	}
+	return statusPacket(id, fxOK, "")
+}
+
+func (s *server) read(id uint32, r *reader) *buffer {
+	_, h, ok := s.getHandle(r)
+	if !ok || h.file == nil {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+	offset, err := r.uint64()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	length, err := r.uint32()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	if length > maxReadSize {
+		length = maxReadSize
+	}
+
+	data := make([]byte, length)
+	n, err := h.file.ReadAt(data, int64(offset))
+	if n == 0 {
+		if err == nil || errors.Is(err, io.EOF) {
+			return statusPacket(id, fxEOF, "EOF")
+		}
+		return errorStatus(id, err)
+	}
+
+	b := newBuffer(fxpData)
+	b.uint32(id)
+	b.bytesField(data[:n])
+	return b
+}
+
+func (s *server) write(id uint32, r *reader) *buffer {
+	_, h, ok := s.getHandle(r)
+	if !ok || h.file == nil {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+	offset, err := r.uint64()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	data, err := r.bytesField()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+
+	if _, err := h.file.WriteAt(data, int64(offset)); err != nil {
+		return errorStatus(id, err)
+	}
+	return statusPacket(id, fxOK, "")
+}
+
+func (s *server) stat(id uint32, r *reader) *buffer {
+	p, err := r.path()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	info, err := s.fs.Stat(p)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+	return attrsPacket(id, info)
+}
+
+func (s *server) fstat(id uint32, r *reader) *buffer {
+	_, h, ok := s.getHandle(r)
+	if !ok {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+	if fi, ok := h.file.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if info, err := fi.Stat(); err == nil {
+			return attrsPacket(id, info)
+		}
+	}
+	info, err := s.fs.Stat(h.path)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+	return attrsPacket(id, info)
+}
+
+func (s *server) opendir(id uint32, r *reader) *buffer {
+	p, err := r.path()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	info, err := s.fs.Stat(p)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+	if !info.IsDir() {
+		return statusPacket(id, fxFailure, "not a directory")
+	}
+	entries, err := s.fs.ReadDir(p)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+	return handlePacket(id, s.addHandle(&handle{path: p, entries: entries}))
+}
+
+func (s *server) readdir(id uint32, r *reader) *buffer {
+	_, h, ok := s.getHandle(r)
+	if !ok || h.file != nil {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+
+	s.mu.Lock()
+	if len(h.entries) == 0 && h.read {
+		s.mu.Unlock()
+		return statusPacket(id, fxEOF, "EOF")
+	}
+	h.read = true
+	batch := h.entries
+	if len(batch) > readDirBatch {
+		batch = batch[:readDirBatch]
+	}
+	h.entries = h.entries[len(batch):]
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return statusPacket(id, fxEOF, "EOF")
+	}
+
+	b := newBuffer(fxpName)
+	b.uint32(id)
+	b.uint32(uint32(len(batch)))
+	for _, info := range batch {
+		b.string(info.Name())
+		b.string(longName(info))
+		b.attrs(info)
+	}
+	return b
+}
+
+func (s *server) remove(id uint32, r *reader, dir bool) *buffer {
+	p, err := r.path()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	info, err := s.fs.Stat(p)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+	if info.IsDir() != dir {
+		if dir {
+			return statusPacket(id, fxFailure, "not a directory")
+		}
+		return statusPacket(id, fxFailure, "is a directory")
+	}
+	if err := s.fs.Remove(p); err != nil {
+		return errorStatus(id, err)
+	}
+	return statusPacket(id, fxOK, "")
+}
+
+func (s *server) mkdir(id uint32, r *reader) *buffer {
+	p, err := r.path()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	if err := s.fs.Mkdir(p); err != nil {
+		return errorStatus(id, err)
+	}
+	return statusPacket(id, fxOK, "")
+}
+
+func (s *server) realpath(id uint32, r *reader) *buffer {
+	p, err := r.path()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	b := newBuffer(fxpName)
+	b.uint32(id)
+	b.uint32(1)
+	b.string(p)
+	b.string(p)
+	b.uint32(0) // No attributes
+	return b
+}
+
+func (s *server) rename(id uint32, r *reader) *buffer {
+	oldPath, err := r.path()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	newPath, err := r.path()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	if err := s.fs.Rename(oldPath, newPath); err != nil {
+		return errorStatus(id, err)
+	}
+	return statusPacket(id, fxOK, "")
+}
+
+func (s *server) extended(id uint32, r *reader) *buffer {
+	name, err := r.string()
+	if err != nil {
+		return statusPacket(id, fxBadMessage, err.Error())
+	}
+	if name == "posix-rename@openssh.com" {
+		return s.rename(id, r)
+	}
+	return statusPacket(id, fxOpUnsupported, "unsupported extension "+name)
+}
+
+// errorStatus maps filesystem errors to SFTP status codes
+func errorStatus(id uint32, err error) *buffer {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return statusPacket(id, fxNoSuchFile, "no such file")
+	case errors.Is(err, os.ErrPermission):
+		return statusPacket(id, fxPermissionDenied, "permission denied")
+	case errors.Is(err, errBadMessage):
+		return statusPacket(id, fxBadMessage, err.Error())
+	default:
+		return statusPacket(id, fxFailure, err.Error())
+	}
+}
+
+func statusPacket(id uint32, code uint32, msg string) *buffer {
+	b := newBuffer(fxpStatus)
+	b.uint32(id)
+	b.uint32(code)
+	b.string(msg)
+	b.string("")
+	return b
+}
+
+func handlePacket(id uint32, handleID string) *buffer {
+	b := newBuffer(fxpHandle)
+	b.uint32(id)
+	b.string(handleID)
+	return b
+}
+
+func attrsPacket(id uint32, info os.FileInfo) *buffer {
+	b := newBuffer(fxpAttrs)
+	b.uint32(id)
+	b.attrs(info)
+	return b
+}
+
+// longName formats an entry like "ls -l" for clients that display it verbatim
+func longName(info os.FileInfo) string {
+	return fmt.Sprintf("%s 1 %-8s %-8s %12d %s %s",
+		info.Mode().String(), "fileserv", "fileserv", info.Size(),
+		info.ModTime().Format("Jan _2 15:04"), info.Name())
+}
+
+// ========================================================================
+// Wire encoding
+// ========================================================================
+
+type buffer struct {
+	data []byte
+}
+
+func newBuffer(kind byte) *buffer {
+	return &buffer{data: []byte{kind}}
+}
+
+func (b *buffer) bytes() []byte { return b.data }
+
+func (b *buffer) uint32(v uint32) {
+	b.data = binary.BigEndian.AppendUint32(b.data, v)
+}
+
+func (b *buffer) uint64(v uint64) {
+	b.data = binary.BigEndian.AppendUint64(b.data, v)
+}
+
+func (b *buffer) string(v string) {
+	b.uint32(uint32(len(v)))
+	b.data = append(b.data, v...)
+}
+
+func (b *buffer) bytesField(v []byte) {
+	b.uint32(uint32(len(v)))
+	b.data = append(b.data, v...)
+}
+
+func (b *buffer) attrs(info os.FileInfo) {
+	b.uint32(attrSize | attrPermissions | attrACModTime)
+	b.uint64(uint64(info.Size()))
+	b.uint32(fileModeBits(info.Mode()))
+	mtime := uint32(info.ModTime().Unix())
+	b.uint32(mtime) // atime
+	b.uint32(mtime)
+}
+
+// fileModeBits converts a Go file mode to POSIX st_mode bits
+func fileModeBits(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		bits |= 0040000
+	case mode&os.ModeSymlink != 0:
+		bits |= 0120000
+	default:
+		bits |= 0100000
+	}
+	return bits
+}
+
+type reader struct {
+	data []byte
+}
+
+func (r *reader) uint32() (uint32, error) {
+	if len(r.data) < 4 {
+		return 0, errBadMessage
+	}
+	v := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return v, nil
+}
+
+func (r *reader) uint64() (uint64, error) {
+	if len(r.data) < 8 {
+		return 0, errBadMessage
+	}
+	v := binary.BigEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return v, nil
+}
+
+func (r *reader) bytesField() ([]byte, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(r.data)) < n {
+		return nil, errBadMessage
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v, nil
+}
+
+func (r *reader) string() (string, error) {
+	v, err := r.bytesField()
+	return string(v), err
+}
+
+// path reads a path and cleans it into an absolute path (relative paths start at the root)
+func (r *reader) path() (string, error) {
+	p, err := r.string()
+	if err != nil {
+		return "", err
+	}
+	return path.Clean("/" + p), nil
+}
@@ -0,0 +1,197 @@
+package sftpd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"fileserv/internal/vfs"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AuthFunc verifies a password login and returns the file system for the session
+type AuthFunc func(username, password, remoteIP string) (vfs.FileSystem, error)
+
+// Server accepts SSH connections and serves the "sftp" subsystem. Shell, exec and
+// forwarding requests are refused.
+type Server struct {
+	hostKey  ssh.Signer
+	auth     AuthFunc
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// NewServer creates an SFTP server using the given host key
+func NewServer(hostKey ssh.Signer, auth AuthFunc) *Server {
+	return &Server{
+		hostKey: hostKey,
+		auth:    auth,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen starts accepting connections on addr
+func (s *Server) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Printf("SFTP: accept failed: %v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serveConn(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Close stops the listener and disconnects all clients
+func (s *Server) Close() error {
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	// The config is per connection so the password callback can hand the session's file system over
+	var fs vfs.FileSystem
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			host, _, _ := net.SplitHostPort(meta.RemoteAddr().String())
+			userFS, err := s.auth(meta.User(), string(password), host)
+			if err != nil {
+				return nil, err
+			}
+			fs = userFS
+			return &ssh.Permissions{}, nil
+		},
+		MaxAuthTries:  3,
+		ServerVersion: "SSH-2.0-fileserv",
+	}
+	config.AddHostKey(s.hostKey)
+
+	// Unauthenticated clients get a bounded amount of time for the handshake
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	defer sshConn.Close()
+
+	if fs == nil {
+		return
+	}
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(channel, requests, fs, sshConn.User())
+	}
+}
+
+func (s *Server) serveSession(channel ssh.Channel, requests <-chan *ssh.Request, fs vfs.FileSystem, username string) {
+	defer channel.Close()
+
+	for req := range requests {
+		ok := req.Type == "subsystem" && len(req.Payload) >= 4 && string(req.Payload[4:]) == "sftp"
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+		if !ok {
+			continue
+		}
+
+		go ssh.DiscardRequests(requests)
+		if err := Serve(channel, fs); err != nil {
+			log.Printf("SFTP: session for %s ended: %v", username, err)
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+		return
+	}
+}
+
+// LoadOrCreateHostKey reads a PEM encoded host key, generating an ed25519 key if the file does not exist
+func LoadOrCreateHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ssh.ParsePrivateKey(data)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save host key: %w", err)
+	}
+	log.Printf("SFTP: generated new host key at %s", path)
+	return ssh.ParsePrivateKey(data)
+}
+
+// Fingerprint returns the SHA256 fingerprint of a host key as shown by ssh clients
+func Fingerprint(key ssh.Signer) string {
+	return ssh.FingerprintSHA256(key.PublicKey())
+}
@@ -0,0 +1,94 @@
+// Package sysconf replaces system configuration files safely: new content is written to a
+// temporary file and renamed into place, and the previous version is kept as a backup so a
+// configuration rejected by its service can be rolled back.
+package sysconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// BackupSuffix is appended to a file name to form the name of its backup
+const BackupSuffix = ".fileserv.bak"
+
+// BackupPath returns where the previous version of a file is kept
+func BackupPath(path string) string {
+	return path + BackupSuffix
+}
+
+// WriteFile atomically replaces the content of path. The current file, if any, is copied to
+// BackupPath first; when there is no current file any stale backup is removed so that Restore
+// removes the new file again.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	current, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if info, statErr := os.Stat(path); statErr == nil {
+			perm = info.Mode().Perm()
+		}
+		if err := writeAtomic(BackupPath(path), current, perm); err != nil {
+			return err
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if err := os.Remove(BackupPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	default:
+		return err
+	}
+
+	return writeAtomic(path, data, perm)
+}
+
+// Restore puts back the version of path saved by the last WriteFile, removing path if it did not exist before
+func Restore(path string) error {
+	backup, err := os.ReadFile(BackupPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(BackupPath(path)); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return writeAtomic(path, backup, perm)
+}
+
+// writeAtomic writes data to a temporary file next to path, syncs it and renames it over path
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
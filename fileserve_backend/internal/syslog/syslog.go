@@ -0,0 +1,220 @@
+// Package syslog sends RFC 5424 messages to a remote syslog server over UDP, TCP or TLS.
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default ports of the transports
+const (
+	DefaultPort    = 514
+	DefaultTLSPort = 6514
+)
+
+// Transports
+const (
+	UDP = "udp"
+	TCP = "tcp"
+	TLS = "tls"
+)
+
+// Severities, from RFC 5424
+const (
+	Emergency = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Info
+	Debug
+)
+
+// maxMessageSize caps the text of a message, so a UDP datagram stays well below the maximum
+const maxMessageSize = 8 * 1024
+
+// Facilities by name
+var Facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Message is a single syslog message
+type Message struct {
+	Time     time.Time
+	Severity int
+	MsgID    string            // Kind of message, such as an event type; empty for none
+	SDID     string            // ID of the structured data element, such as audit@32473
+	Params   map[string]string // Parameters of the structured data element
+	Text     string
+}
+
+// Client sends messages to a syslog server. Stream connections are opened on the first message
+// and opened again after a write fails.
+type Client struct {
+	Network   string // udp, tcp or tls
+	Address   string // host:port
+	Facility  int
+	Hostname  string
+	AppName   string
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// New creates a client for the given transport and address
+func New(network, address string, facility int, appName string) *Client {
+	hostname, _ := os.Hostname()
+	return &Client{
+		Network:  network,
+		Address:  address,
+		Facility: facility,
+		Hostname: hostname,
+		AppName:  appName,
+		Timeout:  5 * time.Second,
+	}
+}
+
+// Send writes a message to the server
+func (c *Client) Send(m Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.format(m)
+	if c.Network != UDP {
+		// Octet counting framing (RFC 5425 and RFC 6587)
+		data = append([]byte(strconv.Itoa(len(data))+" "), data...)
+	}
+
+	// A stream the server closed is only noticed on the next write, so that write is retried
+	// once on a new connection
+	for attempt := 0; ; attempt++ {
+		if c.conn == nil {
+			if err := c.dial(); err != nil {
+				return err
+			}
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+		_, err := c.conn.Write(data)
+		if err == nil {
+			return nil
+		}
+		c.conn.Close()
+		c.conn = nil
+		if attempt > 0 || c.Network == UDP {
+			return fmt.Errorf("failed to send to %s: %w", c.Address, err)
+		}
+	}
+}
+
+// Close closes the connection to the server
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// dial connects to the server
+func (c *Client) dial() error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	switch c.Network {
+	case UDP, TCP:
+		conn, err = dialer.Dial(c.Network, c.Address)
+	case TLS:
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.Address, c.TLSConfig)
+	default:
+		return fmt.Errorf("unknown transport: %s", c.Network)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot connect to syslog server at %s: %w", c.Address, err)
+	}
+	c.conn = conn
+	return nil
+}
+
+// format renders a message as <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+func (c *Client) format(m Message) []byte {
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	text := m.Text
+	if len(text) > maxMessageSize {
+		text = text[:maxMessageSize]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s ",
+		c.Facility*8+m.Severity,
+		m.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(c.Hostname, 255),
+		headerField(c.AppName, 48),
+		os.Getpid(),
+		headerField(m.MsgID, 32),
+	)
+	b.WriteString(structuredData(m.SDID, m.Params))
+	if text != "" {
+		b.WriteByte(' ')
+		b.WriteString(text)
+	}
+	return []byte(b.String())
+}
+
+// headerField returns a header value of printable ASCII without spaces, or - when empty
+func headerField(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if len(value) > max {
+		value = value[:max]
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// structuredData renders a structured data element, or - without one
+func structuredData(id string, params map[string]string) string {
+	if id == "" {
+		return "-"
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	var b strings.Builder
+	b.WriteString("[" + headerField(id, 32))
+	for _, name := range names {
+		if params[name] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ` %s="%s"`, headerField(strings.NewReplacer("=", "", "]", "", `"`, "").Replace(name), 32), escaper.Replace(params[name]))
+	}
+	b.WriteString("]")
+	return b.String()
+}
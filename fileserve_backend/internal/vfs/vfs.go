@@ -0,0 +1,46 @@
+// Package vfs defines the virtual file system served by the file transfer protocols (SFTP, FTP).
+package vfs
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// FileSystem is the view of files a protocol session works on. Paths are absolute and slash-separated.
+type FileSystem interface {
+	// Stat returns information about a file or folder
+	Stat(p string) (os.FileInfo, error)
+	// ReadDir returns the entries of a folder
+	ReadDir(p string) ([]os.FileInfo, error)
+	// OpenFile opens a file with os.O_* flags
+	OpenFile(p string, flag int) (File, error)
+	// Mkdir creates a folder
+	Mkdir(p string) error
+	// Remove deletes a file or folder
+	Remove(p string) error
+	// Rename moves a file or folder; it fails if newPath exists
+	Rename(oldPath, newPath string) error
+}
+
+// File is an open file handle
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+}
+
+// FileInfo is a simple os.FileInfo for virtual entries
+type FileInfo struct {
+	FileName    string
+	FileSize    int64
+	FileMode    os.FileMode
+	FileModTime time.Time
+}
+
+func (fi *FileInfo) Name() string       { return fi.FileName }
+func (fi *FileInfo) Size() int64        { return fi.FileSize }
+func (fi *FileInfo) Mode() os.FileMode  { return fi.FileMode }
+func (fi *FileInfo) ModTime() time.Time { return fi.FileModTime }
+func (fi *FileInfo) IsDir() bool        { return fi.FileMode.IsDir() }
+func (fi *FileInfo) Sys() interface{}   { return nil }
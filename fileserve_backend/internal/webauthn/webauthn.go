@@ -0,0 +1,288 @@
+// Package webauthn verifies WebAuthn (passkey) registrations and sign-ins for one relying party.
+//
+// Attestation statements are not verified: any authenticator the browser accepts can register,
+// as with the "none" attestation conveyance that passkey providers use. Registration and sign-in
+// both require user verification (PIN or biometrics), so a passkey alone is a complete sign-in.
+// Supported key types are ES256, RS256 and Ed25519.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// COSE algorithm identifiers
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// SupportedAlgorithms lists the accepted key algorithms, most preferred first
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// RelyingParty identifies the site credentials are scoped to
+type RelyingParty struct {
+	ID     string // Host name credentials are bound to, e.g. "nas.example.com"
+	Origin string // Origin the browser reports, e.g. "https://nas.example.com:8443"
+}
+
+// Credential is a verified public key credential
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+// clientData is the JSON the browser signs along with the authenticator data
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// authenticatorData is the parsed binary authenticator data
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// NewChallenge returns a random base64url challenge
+func NewChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeBase64 decodes base64url as sent by browsers, with or without padding
+func DecodeBase64(s string) ([]byte, error) {
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
+
+// verifyClientData checks the ceremony type, challenge and origin of the client data
+func (rp RelyingParty) verifyClientData(raw []byte, ceremony, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("invalid client data: %v", err)
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("unexpected ceremony type %q", cd.Type)
+	}
+	if cd.Challenge != challenge {
+		return errors.New("challenge does not match")
+	}
+	if cd.Origin != rp.Origin {
+		return fmt.Errorf("origin %q does not match %q", cd.Origin, rp.Origin)
+	}
+	return nil
+}
+
+// parseAuthenticatorData parses authenticator data and checks the RP ID hash and flags
+func (rp RelyingParty) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+	ad := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return nil, errors.New("credential belongs to a different relying party")
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return nil, errors.New("user was not present")
+	}
+	if ad.flags&flagUserVerified == 0 {
+		return nil, errors.New("user was not verified")
+	}
+
+	if ad.flags&flagAttestedCredData != 0 {
+		rest := data[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18])) // After the 16 byte AAGUID
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, errors.New("attested credential data too short")
+		}
+		ad.credentialID = rest[:idLen]
+		_, n, err := decodeCBOR(rest[idLen:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %v", err)
+		}
+		ad.publicKey = rest[idLen : idLen+n]
+	}
+	return ad, nil
+}
+
+// VerifyRegistration verifies the response of navigator.credentials.create() for challenge and
+// returns the new credential
+func (rp RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	obj, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %v", err)
+	}
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid attestation object")
+	}
+	authData, ok := m["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authenticator data")
+	}
+
+	ad, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, errors.New("authenticator data has no credential")
+	}
+	if _, err := parsePublicKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        bytes.Clone(ad.credentialID),
+		PublicKey: bytes.Clone(ad.publicKey),
+		SignCount: ad.signCount,
+	}, nil
+}
+
+// VerifyAssertion verifies the response of navigator.credentials.get() for challenge against a
+// registered credential and returns the authenticator's new signature counter
+func (rp RelyingParty) VerifyAssertion(challenge string, cred Credential, clientDataJSON, authenticatorDataRaw, signature []byte) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	ad, err := rp.parseAuthenticatorData(authenticatorDataRaw)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(bytes.Clone(authenticatorDataRaw), clientDataHash[:]...)
+	if err := key.verify(signed, signature); err != nil {
+		return 0, err
+	}
+
+	// A counter that does not increase means the authenticator may have been cloned.
+	// Synced passkeys always report 0.
+	if ad.signCount != 0 || cred.SignCount != 0 {
+		if ad.signCount <= cred.SignCount {
+			return 0, errors.New("signature counter did not increase, the authenticator may be cloned")
+		}
+	}
+	return ad.signCount, nil
+}
+
+// publicKey is a parsed COSE_Key
+type publicKey struct {
+	key crypto.PublicKey
+}
+
+// parsePublicKey parses a COSE_Key of a supported algorithm
+func parsePublicKey(data []byte) (*publicKey, error) {
+	v, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid public key")
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	param := func(label int64) []byte {
+		b, _ := m[label].([]byte)
+		return b
+	}
+
+	switch {
+	case kty == 2 && alg == AlgES256: // EC2, P-256
+		x, y := param(-2), param(-3)
+		if crv, _ := m[int64(-1)].(int64); crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid ES256 public key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if _, err := key.ECDH(); err != nil {
+			return nil, errors.New("ES256 public key is not on the curve")
+		}
+		return &publicKey{key: key}, nil
+	case kty == 1 && alg == AlgEdDSA: // OKP, Ed25519
+		x := param(-2)
+		if crv, _ := m[int64(-1)].(int64); crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return &publicKey{key: ed25519.PublicKey(x)}, nil
+	case kty == 3 && alg == AlgRS256:
+		n, e := param(-1), param(-2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RS256 public key")
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return &publicKey{key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %d with algorithm %d", kty, alg)
+}
+
+// verify checks a signature over data
+func (k *publicKey) verify(data, signature []byte) error {
+	ok := false
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		hash := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(key, hash[:], signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil
+	}
+	if !ok {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
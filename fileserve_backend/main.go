@@ -6,17 +6,20 @@ import (
 	"embed"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
 	"fileserv/config"
 	"fileserv/handlers"
+	"fileserv/internal/events"
 	"fileserv/internal/fileops"
 	"fileserv/middleware"
 	"fileserv/storage"
@@ -36,40 +39,92 @@ func generateSecureSecret() (string, error) {
 //go:embed static/*
 var staticFiles embed.FS
 
+// Version and BuildDate are set at build time with -ldflags (see bundle.sh)
+var (
+	Version   = "dev"
+	BuildDate = ""
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "--version" {
+		if BuildDate != "" {
+			fmt.Printf("fileserv %s (built %s)\n", Version, BuildDate)
+		} else {
+			fmt.Printf("fileserv %s\n", Version)
+		}
+		return
+	}
+
 	// Load configuration
 	cfg := config.Load()
 
-	// Initialize SQLite storage
-	dbPath := cfg.StorageFile
-	if strings.HasSuffix(dbPath, ".json") {
-		dbPath = strings.TrimSuffix(dbPath, ".json") + ".db"
+	// Initialize storage: SQLite by default, Postgres when a database URL is configured
+	var store interface {
+		storage.DataStore
+		SetSlowQueryThreshold(d time.Duration)
+		Close() error
 	}
-	store, err := storage.NewSQLiteStore(dbPath)
-	if err != nil {
-		log.Fatalf("Failed to initialize storage: %v", err)
+	if cfg.DatabaseURL != "" {
+		pgStore, err := storage.NewPostgresStore(cfg.DatabaseURL)
+		if err != nil {
+			log.Fatalf("Failed to initialize storage: %v", err)
+		}
+		store = pgStore
+	} else {
+		dbPath := cfg.StorageFile
+		if strings.HasSuffix(dbPath, ".json") {
+			dbPath = strings.TrimSuffix(dbPath, ".json") + ".db"
+		}
+		sqliteStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to initialize storage: %v", err)
+		}
+		store = sqliteStore
 	}
 	defer store.Close()
+	store.SetSlowQueryThreshold(time.Duration(cfg.SlowQueryMS) * time.Millisecond)
+
+	// Events published on the bus are written to the event log
+	events.Default.SetRecorder(handlers.EventRecorder(store))
+
+	// Workers scanning zones and the database query through a store bound to this context, which
+	// is cancelled on shutdown so a long query does not hold up stopping them
+	scanCtx, stopScans := context.WithCancel(context.Background())
+	defer stopScans()
+	scanStore := store.WithContext(scanCtx)
 
 	// Initialize ownership cache for file listings
 	fileops.InitOwnershipCache()
 
 	// Initialize chunked upload manager
-	chunkedUploadManager, err := fileops.NewChunkedUploadManager(cfg.DataDir)
+	chunkedUploadManager, err := fileops.NewChunkedUploadManager(cfg.DataDir, store)
 	if err != nil {
 		log.Fatalf("Failed to initialize chunked upload manager: %v", err)
 	}
-	defer chunkedUploadManager.Close()
 
 	// Initialize handlers
 	poolHandler := handlers.NewPoolHandler(store)
 	zoneHandler := handlers.NewZoneHandler(store)
 	shareLinkHandler := handlers.NewShareLinkHandler(store, cfg.DataDir)
-	publicHandler := handlers.NewPublicHandler(store, cfg.DataDir)
 	zoneFileHandler := handlers.NewZoneFileHandler(store)
 	chunkedUploadHandler := handlers.NewChunkedUploadHandler(store, chunkedUploadManager)
 	setupHandler := handlers.NewSetupHandler(store)
 	settingsHandler := handlers.NewSettingsHandler(store)
+	apiTokenHandler := handlers.NewAPITokenHandler(store, cfg)
+	guestHandler := handlers.NewGuestHandler(store, cfg)
+	sessionHandler := handlers.NewSessionHandler(store)
+	folderShareHandler := handlers.NewFolderShareHandler(store)
+	archiveHandler := handlers.NewArchiveHandler(store)
+	lockHandler := handlers.NewLockHandler(store)
+	previewHandler, err := handlers.NewPreviewHandler(store, filepath.Join(cfg.DataDir, "previews"), int64(cfg.PreviewCacheMB)*1024*1024)
+	if err != nil {
+		log.Fatalf("Failed to initialize preview cache: %v", err)
+	}
+	publicHandler := handlers.NewPublicHandler(store, cfg.DataDir, previewHandler)
+	streamHandler, err := handlers.NewStreamHandler(store, filepath.Join(cfg.DataDir, "streams"), int64(cfg.StreamCacheMB)*1024*1024)
+	if err != nil {
+		log.Fatalf("Failed to initialize stream cache: %v", err)
+	}
 
 	// Initialize snapshot scheduler
 	snapshotScheduler := handlers.NewSnapshotScheduler(store)
@@ -77,6 +132,117 @@ func main() {
 	defer snapshotScheduler.Stop()
 	snapshotPolicyHandler := handlers.NewSnapshotPolicyHandler(store, snapshotScheduler)
 
+	// Initialize replication manager (scheduled zfs send/receive jobs)
+	replicationManager := handlers.NewReplicationManager(store)
+	replicationManager.Start()
+	defer replicationManager.Stop()
+	replicationHandler := handlers.NewReplicationHandler(store, replicationManager)
+
+	// Initialize maintenance scheduler (periodic ZFS scrubs and RAID checks)
+	maintenanceScheduler := handlers.NewMaintenanceScheduler(store)
+	maintenanceScheduler.Start()
+	defer maintenanceScheduler.Stop()
+	maintenanceHandler := handlers.NewMaintenanceHandler(store, maintenanceScheduler)
+
+	// Initialize retention scheduler (deletes or archives old files in zones)
+	retentionScheduler := handlers.NewRetentionScheduler(scanStore)
+	retentionScheduler.Start()
+	defer retentionScheduler.Stop()
+	retentionHandler := handlers.NewRetentionHandler(store, retentionScheduler)
+
+	// Initialize file search indexer
+	fileIndexer := handlers.NewFileIndexer(scanStore)
+	fileIndexer.Start()
+	defer fileIndexer.Stop()
+	searchIndexHandler := handlers.NewSearchIndexHandler(store, fileIndexer)
+
+	// Initialize usage tracker (cached zone stats)
+	usageTracker := handlers.NewUsageTracker(scanStore)
+	usageTracker.Start()
+	defer usageTracker.Stop()
+	usageHandler := handlers.NewUsageHandler(store, usageTracker)
+
+	// Initialize zone watcher (picks up changes made outside the server, e.g. over SMB)
+	zoneWatcher := handlers.NewZoneWatcher(scanStore, fileIndexer, usageTracker)
+	zoneWatcher.Start()
+	defer zoneWatcher.Stop()
+
+	// Initialize integrity checker (verifies file checksums to detect bit rot)
+	integrityChecker := handlers.NewIntegrityChecker(scanStore)
+	integrityChecker.Start()
+	defer integrityChecker.Stop()
+	integrityHandler := handlers.NewIntegrityHandler(store, integrityChecker)
+
+	// Initialize database backup scheduler (scheduled backups into a storage pool)
+	dbBackupScheduler := handlers.NewDatabaseBackupScheduler(store)
+	dbBackupScheduler.Start()
+	defer dbBackupScheduler.Stop()
+	dbBackupHandler := handlers.NewDatabaseBackupHandler(store, dbBackupScheduler)
+
+	// Initialize job manager (background bulk delete, copy, archive, extract and checksum)
+	jobManager := handlers.NewJobManager(store)
+	jobManager.Start()
+	defer jobManager.Stop()
+	jobHandler := handlers.NewJobHandler(store, jobManager)
+
+	// Initialize trash cleaner (purges trashed items and deleted objects past their retention period)
+	trashCleaner := handlers.NewTrashCleaner(store)
+	trashCleaner.Start()
+	defer trashCleaner.Stop()
+
+	// Initialize expiry reaper (removes expired sessions, share links, uploads, unused previews and old logged events)
+	expiryReaper := handlers.NewExpiryReaper(store, chunkedUploadManager, previewHandler, streamHandler)
+	expiryReaper.Start()
+	defer expiryReaper.Stop()
+
+	// Initialize stats recorder (records the daily statistics behind the admin dashboard charts)
+	statsRecorder := handlers.NewStatsRecorder(store)
+	statsRecorder.Start()
+	defer statsRecorder.Stop()
+
+	// Initialize notifier (routes events to the configured notification channels)
+	notifier := handlers.NewNotifier(store)
+	notifier.Start()
+	defer notifier.Stop()
+
+	// Initialize syslog forwarder (sends the server log and audit events to a remote syslog server)
+	syslogForwarder := handlers.NewSyslogForwarder(store)
+	syslogForwarder.Start()
+	defer syslogForwarder.Stop()
+	log.SetOutput(io.MultiWriter(os.Stderr, syslogForwarder))
+
+	// Initialize storage monitor (publishes RAID and pool usage events)
+	storageMonitor := handlers.NewStorageMonitor(store)
+	storageMonitor.Start()
+	defer storageMonitor.Stop()
+
+	// Initialize UPS monitor (reads the UPS through NUT and acts on battery power)
+	upsMonitor := handlers.NewUPSMonitor(store)
+	upsMonitor.Start()
+	defer upsMonitor.Stop()
+
+	// Initialize I/O statistics collector (rolling diskstats history for rate graphs)
+	ioStatsCollector := handlers.NewIOStatsCollector()
+	ioStatsCollector.Start()
+	defer ioStatsCollector.Stop()
+
+	// Initialize SFTP server (runs only when enabled in settings)
+	sftpService := handlers.NewSFTPService(store, cfg)
+	sftpService.Start()
+	defer sftpService.Stop()
+
+	// Initialize FTP server (runs only when enabled in settings)
+	ftpService := handlers.NewFTPService(store, cfg)
+	ftpService.Start()
+	defer ftpService.Stop()
+
+	// Open the firewall ports of the running services when automatic management is on
+	go func() {
+		if err := handlers.SyncFirewall(store, cfg); err != nil {
+			log.Printf("Warning: Failed to update the firewall: %v", err)
+		}
+	}()
+
 	// Get JWT secret from database if available, otherwise use config or generate one
 	jwtSecret := handlers.GetJWTSecretFromStore(store)
 	if jwtSecret == "" {
@@ -93,22 +259,58 @@ func main() {
 		}
 		log.Println("Generated secure temporary JWT secret. Note: Sessions will not persist across restarts until setup is complete.")
 	}
+	passkeyHandler := handlers.NewPasskeyHandler(store, cfg, jwtSecret)
+	headerPolicy := handlers.NewSecurityHeaderPolicy(store)
+	corsPolicy := handlers.NewCORSPolicy(store, cfg)
+	updater := handlers.NewUpdater(store, cfg, Version, BuildDate)
+	containerHandler := handlers.NewContainerHandler(store, cfg)
+
+	// Initialize settings watcher (reloads components that keep settings in memory when they change)
+	settingsWatcher := handlers.NewSettingsWatcher(store)
+	settingsWatcher.Register("security_headers", func() error { headerPolicy.Reload(); return nil }, "security_")
+	settingsWatcher.Register("cors", func() error { corsPolicy.Reload(); return nil }, "cors_")
+	settingsWatcher.Register("sftp", sftpService.ReloadIfChanged, "sftp_")
+	settingsWatcher.Register("ftp", ftpService.ReloadIfChanged, "ftp_")
+	settingsWatcher.Register("cleanup", func() error { expiryReaper.Reload(); return nil }, "cleanup_")
+	settingsWatcher.Register("ups", func() error { upsMonitor.Reload(); return nil }, "ups_")
+	settingsWatcher.Register("syslog", func() error { syslogForwarder.Reload(); return nil }, "syslog_")
+	settingsWatcher.Start()
+	defer settingsWatcher.Stop()
+
+	// Read-only queries the admin dashboard can fetch in one batch request
+	batchHandler := handlers.NewBatchHandler(map[string]http.Handler{
+		"stats":            handlers.GetStats(store, cfg, statsRecorder),
+		"storage_overview": handlers.GetStorageOverview(store),
+		"system_resources": handlers.GetSystemResources(),
+		"pools":            http.HandlerFunc(poolHandler.GetStoragePools),
+		"zones":            http.HandlerFunc(zoneHandler.GetShareZones),
+		"share_links":      http.HandlerFunc(shareLinkHandler.GetAllShareLinks),
+		"users":            handlers.ListUsers(store),
+		"alerts":           handlers.ListStorageAlerts(store),
+		"services":         handlers.GetServices(),
+	})
 
-	// Setup router
+	// Setup router; WebDAV lock methods are routed to the file lock handler
+	chi.RegisterMethod("LOCK")
+	chi.RegisterMethod("UNLOCK")
 	r := chi.NewRouter()
+	apiDocsHandler := handlers.NewAPIDocsHandler(r)
 
 	// Global middleware
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
-	r.Use(middleware.SecurityHeaders)
-	r.Use(middleware.CORS)
+	r.Use(middleware.SecurityHeaders(headerPolicy))
+	r.Use(middleware.CORS(corsPolicy))
 
 	// Public share routes (NO AUTH)
 	r.Route("/s/{token}", func(r chi.Router) {
+		r.Use(publicHandler.EnforceNetworkRestrictions)
 		r.Get("/", publicHandler.GetPublicShare)
 		r.Post("/verify", publicHandler.VerifySharePassword)
 		r.Get("/list", publicHandler.ListPublicShare)
 		r.Get("/download", publicHandler.DownloadPublicShare)
 		r.Get("/preview", publicHandler.PreviewPublicFile)
+		r.Get("/thumbnail", publicHandler.ThumbnailPublicFile)
 		r.Post("/upload", publicHandler.UploadToPublicShare)
 	})
 
@@ -118,17 +320,46 @@ func main() {
 		r.Get("/setup/status", setupHandler.GetSetupStatus)
 		r.Post("/setup/complete", setupHandler.CompleteSetup)
 
+		// API documentation (public)
+		r.Get("/openapi.json", apiDocsHandler.GetOpenAPI)
+		r.Get("/docs", apiDocsHandler.GetSwaggerUI)
+		r.Get("/docs/init.js", apiDocsHandler.GetSwaggerUIInit)
+		r.Get("/docs/assets/*", apiDocsHandler.GetSwaggerUIAsset)
+
 		// Auth routes (public)
 		r.Post("/auth/login", handlers.Login(store, cfg, jwtSecret))
+		r.Post("/auth/passkeys/login", passkeyHandler.BeginLogin)
+		r.Post("/auth/passkeys/login/finish", passkeyHandler.FinishLogin)
 
 		// Protected routes
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.Auth(jwtSecret))
-
-			r.Post("/auth/logout", handlers.Logout())
-			r.Post("/auth/refresh", handlers.RefreshToken(jwtSecret))
-			r.Get("/auth/me", handlers.GetCurrentUser())
-			r.Post("/auth/password", handlers.ChangePassword(cfg))
+			r.Use(middleware.Auth(jwtSecret, apiTokenHandler, guestHandler, sessionHandler))
+			r.Use(middleware.CSRF)
+			r.Use(middleware.EnforceTokenScope)
+
+			r.Post("/auth/logout", sessionHandler.Logout)
+			r.Post("/auth/refresh", handlers.RefreshToken(store, jwtSecret))
+			r.Get("/auth/me", handlers.GetCurrentUser(store))
+			r.Post("/auth/password", handlers.ChangePassword(store, cfg))
+
+			// Signed-in sessions of the current user
+			r.Get("/auth/sessions", sessionHandler.ListMySessions)
+			r.Delete("/auth/sessions", sessionHandler.RevokeOtherSessions)
+			r.Delete("/auth/sessions/{id}", sessionHandler.RevokeMySession)
+
+			// Passkeys (WebAuthn) of the current user
+			r.Get("/auth/passkeys", passkeyHandler.ListPasskeys)
+			r.Post("/auth/passkeys/register", passkeyHandler.BeginRegistration)
+			r.Post("/auth/passkeys/register/finish", passkeyHandler.FinishRegistration)
+			r.Delete("/auth/passkeys/{id}", passkeyHandler.DeletePasskey)
+
+			// Live event stream (server-sent events)
+			r.Get("/events", handlers.StreamEvents)
+			r.Get("/activity", handlers.ListActivity(store))
+			r.Get("/me/activity", handlers.ListMyActivity(store))
+			r.Get("/me/recent", zoneFileHandler.ListRecentFiles)
+			r.Get("/me/starred", zoneFileHandler.ListStarredFiles)
+			r.Get("/me/transfer", handlers.GetMyTransfer(store))
 
 			// File operations (legacy - uses global DataDir)
 			r.Get("/files", handlers.ListFiles(store, cfg))
@@ -146,27 +377,96 @@ func main() {
 				r.Post("/*", zoneFileHandler.UploadZoneFile)
 				r.Delete("/*", zoneFileHandler.DeleteZoneFile)
 				r.Put("/*", zoneFileHandler.RenameZoneFile)
+				r.Method("LOCK", "/*", http.HandlerFunc(lockHandler.LockWebDAV))
+				r.Method("UNLOCK", "/*", http.HandlerFunc(lockHandler.UnlockWebDAV))
 			})
 			r.Post("/zones/{zoneId}/folders/*", zoneFileHandler.CreateZoneFolder)
+			r.Post("/zones/{zoneId}/folders", zoneFileHandler.CreateZoneFolders)
 			r.Get("/zones/{zoneId}/folders", zoneFileHandler.GetZoneFolders)
 
 			// Bulk operations for zones
 			r.Post("/zones/{zoneId}/bulk/delete", zoneFileHandler.BulkDeleteZoneFiles)
 			r.Post("/zones/{zoneId}/bulk/move", zoneFileHandler.BulkMoveZoneFiles)
 
+			// Archives (browse zip/tar/7z contents; extraction runs as a job)
+			r.Get("/zones/{zoneId}/archive/*", archiveHandler.ListArchiveContents)
+
+			// Advisory file locks (shared with WebDAV LOCK and the file transfer protocols)
+			r.Get("/zones/{zoneId}/locks", lockHandler.ListZoneLocks)
+			r.Post("/zones/{zoneId}/locks/*", lockHandler.LockZoneFile)
+			r.Put("/locks/{token}", lockHandler.RefreshLock)
+			r.Delete("/locks/{token}", lockHandler.ReleaseLock)
+
+			// Background jobs (long-running file operations with progress and cancellation)
+			r.Get("/jobs", jobHandler.ListJobs)
+			r.Post("/jobs", jobHandler.CreateJob)
+			r.Get("/jobs/{id}", jobHandler.GetJob)
+			r.Post("/jobs/{id}/cancel", jobHandler.CancelJob)
+			r.Delete("/jobs/{id}", jobHandler.DeleteJob)
+
 			// Zone stats (recursive file count and size)
 			r.Get("/zones/{zoneId}/stats", zoneFileHandler.GetZoneStats)
 
+			// Zone quota (current user's quota and usage)
+			r.Get("/zones/{zoneId}/quota", zoneFileHandler.GetZoneQuota)
+
+			// Zone search (backed by the background file index)
+			r.Get("/zones/{zoneId}/search", zoneFileHandler.SearchZoneFiles)
+
+			// SHA256SUMS manifests built from the recorded checksums
+			r.Get("/zones/{zoneId}/checksums", zoneFileHandler.GetZoneChecksums)
+
+			// File metadata (tags, descriptions and stars)
+			r.Get("/zones/{zoneId}/metadata", zoneFileHandler.QueryZoneFileMetadata)
+			r.Get("/zones/{zoneId}/metadata/*", zoneFileHandler.GetZoneFileMetadata)
+			r.Put("/zones/{zoneId}/metadata/*", zoneFileHandler.SetZoneFileMetadata)
+			r.Get("/zones/{zoneId}/tags", zoneFileHandler.ListZoneFileTags)
+
+			// Photo gallery (images by date taken, EXIF details)
+			r.Get("/zones/{zoneId}/gallery", zoneFileHandler.ListZoneGallery)
+			r.Get("/zones/{zoneId}/gallery/timeline", zoneFileHandler.GetZoneGalleryTimeline)
+			r.Get("/zones/{zoneId}/exif/*", zoneFileHandler.GetZoneImageExif)
+
+			// Resized image previews (cached on disk)
+			r.Get("/zones/{zoneId}/preview/*", previewHandler.GetZonePreview)
+
+			// Video streaming (HLS transcoded on demand with ffmpeg)
+			r.Get("/zones/{zoneId}/stream/*", streamHandler.StreamZoneVideo)
+
+			// Zone snapshots (browse and restore from ZFS snapshots of the zone dataset)
+			r.Route("/zones/{zoneId}/snapshots", func(r chi.Router) {
+				r.Get("/", zoneFileHandler.ListZoneSnapshots)
+				r.Get("/{snapshot}/files", zoneFileHandler.ListZoneSnapshotFiles)
+				r.Get("/{snapshot}/download", zoneFileHandler.DownloadZoneSnapshotFile)
+				r.Post("/{snapshot}/restore", zoneFileHandler.RestoreZoneSnapshotPath)
+			})
+
+			// Zone trash (deleted files awaiting restore or purge)
+			r.Route("/zones/{zoneId}/trash", func(r chi.Router) {
+				r.Get("/", zoneFileHandler.ListZoneTrash)
+				r.Delete("/", zoneFileHandler.EmptyZoneTrash)
+				r.Post("/{id}/restore", zoneFileHandler.RestoreZoneTrashItem)
+				r.Delete("/{id}", zoneFileHandler.PurgeZoneTrashItem)
+			})
+
 			// Chunked/resumable upload routes
 			r.Route("/upload", func(r chi.Router) {
 				r.Post("/session", chunkedUploadHandler.CreateSession)
 				r.Get("/session/{sessionId}", chunkedUploadHandler.GetProgress)
+				r.Get("/session/{sessionId}/missing", chunkedUploadHandler.GetMissingChunks)
 				r.Delete("/session/{sessionId}", chunkedUploadHandler.CancelSession)
 				r.Post("/session/{sessionId}/chunk/{chunkIndex}", chunkedUploadHandler.UploadChunk)
 				r.Post("/session/{sessionId}/finalize", chunkedUploadHandler.Finalize)
 				r.Get("/sessions", chunkedUploadHandler.ListMySessions)
 			})
 
+			// API tokens (user can mint their own)
+			r.Route("/tokens", func(r chi.Router) {
+				r.Get("/", apiTokenHandler.ListMyTokens)
+				r.Post("/", apiTokenHandler.CreateToken)
+				r.Delete("/{id}", apiTokenHandler.DeleteToken)
+			})
+
 			// Share links (user can create their own)
 			r.Route("/links", func(r chi.Router) {
 				r.Get("/", shareLinkHandler.GetMyShareLinks)
@@ -174,39 +474,87 @@ func main() {
 				r.Get("/{id}", shareLinkHandler.GetShareLink)
 				r.Put("/{id}", shareLinkHandler.UpdateShareLink)
 				r.Delete("/{id}", shareLinkHandler.DeleteShareLink)
+				r.Post("/{id}/rotate-token", shareLinkHandler.RotateShareLinkToken)
+			})
+
+			// Folders shared with other users (recipients browse them through the zone
+			// file endpoints using the zone_id returned by /shared-with-me)
+			r.Route("/folder-shares", func(r chi.Router) {
+				r.Get("/", folderShareHandler.ListMyFolderShares)
+				r.Post("/", folderShareHandler.CreateFolderShare)
+				r.Delete("/{id}", folderShareHandler.DeleteFolderShare)
+			})
+			r.Get("/shared-with-me", folderShareHandler.ListSharedWithMe)
+
+			// Guest accounts (admins and zone owners invite external collaborators)
+			r.Route("/guests", func(r chi.Router) {
+				r.Get("/", guestHandler.ListGuests)
+				r.Post("/", guestHandler.CreateGuest)
+				r.Put("/{id}", guestHandler.UpdateGuest)
+				r.Delete("/{id}", guestHandler.DeleteGuest)
 			})
 
 			// Admin routes
 			r.Group(func(r chi.Router) {
 				r.Use(middleware.RequireAdmin)
 
-				r.Get("/admin/stats", handlers.GetStats(store, cfg))
+				r.Get("/admin/stats", handlers.GetStats(store, cfg, statsRecorder))
+				r.Get("/admin/stats/history", statsRecorder.GetStatsHistory)
+
+				// Transfer accounting and monthly transfer caps of users, zones and share links
+				r.Get("/admin/transfers", handlers.GetTransferReport(store))
+				r.Get("/admin/transfers/caps", handlers.ListTransferCaps(store))
+				r.Put("/admin/transfers/caps/{type}/{id}", handlers.SetTransferCap(store))
+				r.Delete("/admin/transfers/caps/{type}/{id}", handlers.DeleteTransferCap(store))
+
+				// Several dashboard queries in one round-trip
+				r.Get("/batch", batchHandler.ListQueries)
+				r.Post("/batch", batchHandler.Execute)
+
+				// Act as another user to reproduce permission problems (audited)
+				r.Post("/admin/impersonate/{userId}", handlers.ImpersonateUser(store, cfg, jwtSecret))
+
+				// Sessions of any user (forced logout)
+				r.Get("/admin/users/{userId}/sessions", sessionHandler.ListUserSessions)
+				r.Delete("/admin/users/{userId}/sessions", sessionHandler.RevokeUserSessions)
 
 				// Settings management
 				r.Route("/admin/settings", func(r chi.Router) {
 					r.Get("/", settingsHandler.GetSettings)
 					r.Put("/", settingsHandler.UpdateSettings)
 					r.Post("/regenerate-jwt", settingsHandler.RegenerateJWTSecret)
+					r.Post("/reload", settingsWatcher.ReloadSettings)
+					r.Get("/cors", corsPolicy.GetCORS)
+					r.Put("/cors", corsPolicy.UpdateCORS)
+					r.Delete("/cors", corsPolicy.ResetCORS)
 				})
 
+				// SFTP server
+				r.Get("/admin/sftp", sftpService.GetSettings)
+				r.Put("/admin/sftp", sftpService.UpdateSettings)
+
+				// FTP/FTPS server
+				r.Get("/admin/ftp", ftpService.GetSettings)
+				r.Put("/admin/ftp", ftpService.UpdateSettings)
+
 				// Internal user management
 				r.Get("/users", handlers.ListUsers(store))
 				r.Post("/users", handlers.CreateUser(store))
 				r.Put("/users/{id}", handlers.UpdateUser(store))
-				r.Delete("/users/{id}", handlers.DeleteUser(store))
+				r.Delete("/users/{id}", handlers.DeleteUser(store, sessionHandler))
 
 				// System user management (for root/wheel admins)
 				r.Get("/system/users", handlers.ListSystemUsers())
-				r.Post("/system/users", handlers.CreateSystemUser())
+				r.Post("/system/users", handlers.CreateSystemUser(store))
 				r.Get("/system/users/{username}", handlers.GetSystemUser())
-				r.Put("/system/users/{username}", handlers.UpdateSystemUser())
+				r.Put("/system/users/{username}", handlers.UpdateSystemUser(store))
 				r.Delete("/system/users/{username}", handlers.DeleteSystemUser())
 				r.Get("/system/groups", handlers.ListSystemGroups())
 				r.Post("/system/groups", handlers.CreateSystemGroup())
 				r.Get("/system/groups/{groupname}", handlers.GetSystemGroup())
 				r.Put("/system/groups/{groupname}", handlers.UpdateSystemGroup())
 				r.Delete("/system/groups/{groupname}", handlers.DeleteSystemGroup())
-				r.Post("/system/groups/{groupname}/members", handlers.AddGroupMember())
+				r.Post("/system/groups/{groupname}/members", handlers.AddGroupMember(store))
 				r.Delete("/system/groups/{groupname}/members", handlers.RemoveGroupMember())
 
 				// File share management
@@ -238,8 +586,126 @@ func main() {
 					r.Delete("/{id}", zoneHandler.DeleteShareZone)
 					r.Get("/{id}/usage", zoneHandler.GetZoneUsage)
 					r.Post("/{id}/provision", zoneHandler.ProvisionUserDirectory)
+					r.Get("/{id}/quotas", zoneHandler.GetZoneUserQuotas)
+					r.Post("/{id}/quotas/apply", zoneHandler.ApplyZoneQuotas)
+					r.Get("/{id}/project-quota", zoneHandler.GetZoneProjectQuota)
+					r.Put("/{id}/project-quota", zoneHandler.SetZoneProjectQuota)
+					r.Delete("/{id}/project-quota", zoneHandler.DeleteZoneProjectQuota)
+					r.Get("/{id}/versioning", zoneHandler.GetZoneVersioning)
+					r.Put("/{id}/versioning", zoneHandler.UpdateZoneVersioning)
+					r.Get("/{id}/timemachine", zoneHandler.GetZoneTimeMachine)
+					r.Put("/{id}/timemachine", zoneHandler.UpdateZoneTimeMachine)
 				})
 
+				// File locks of all zones
+				r.Get("/admin/locks", lockHandler.ListLocks)
+
+				// Search index management
+				r.Get("/admin/search/status", searchIndexHandler.GetIndexStatus)
+				r.Post("/admin/search/reindex", searchIndexHandler.Reindex)
+				r.Get("/admin/search/zones/{id}/content", searchIndexHandler.GetZoneContentIndexing)
+				r.Put("/admin/search/zones/{id}/content", searchIndexHandler.UpdateZoneContentIndexing)
+
+				// Zone file watcher
+				r.Get("/admin/watcher/status", handlers.GetWatcherStatus(zoneWatcher))
+
+				// Image preview cache
+				r.Get("/admin/previews/cache", previewHandler.GetCacheStats)
+				r.Delete("/admin/previews/cache", previewHandler.ClearCache)
+				r.Get("/admin/streams/cache", streamHandler.GetCacheStats)
+				r.Delete("/admin/streams/cache", streamHandler.ClearCache)
+
+				// File integrity verification
+				r.Get("/admin/integrity", integrityHandler.GetIntegrityReport)
+				r.Post("/admin/integrity/verify", integrityHandler.RunIntegrityCheck)
+				r.Post("/admin/integrity/accept", integrityHandler.AcceptChecksum)
+
+				// Retention policies (scheduled cleanup of old files)
+				r.Route("/admin/retention", func(r chi.Router) {
+					r.Get("/", retentionHandler.ListPolicies)
+					r.Post("/", retentionHandler.CreatePolicy)
+					r.Post("/preview", retentionHandler.PreviewNewPolicy)
+					r.Get("/{id}", retentionHandler.GetPolicy)
+					r.Put("/{id}", retentionHandler.UpdatePolicy)
+					r.Delete("/{id}", retentionHandler.DeletePolicy)
+					r.Post("/{id}/run", retentionHandler.RunPolicy)
+					r.Get("/{id}/preview", retentionHandler.PreviewPolicy)
+					r.Get("/{id}/log", retentionHandler.GetPolicyLog)
+				})
+
+				// Brute-force lockouts
+				r.Get("/admin/lockouts", handlers.ListLockouts(store))
+				r.Delete("/admin/lockouts", handlers.ClearLockout(store))
+				r.Get("/admin/share-protection", handlers.GetShareProtectionSettings(store))
+				r.Put("/admin/share-protection", handlers.UpdateShareProtectionSettings(store))
+				r.Get("/admin/geoip", handlers.GetGeoIPSettings(store))
+				r.Put("/admin/geoip", handlers.UpdateGeoIPSettings(store))
+				r.Get("/admin/password-policy", handlers.GetPasswordPolicy(store))
+				r.Put("/admin/password-policy", handlers.UpdatePasswordPolicy(store))
+				r.Get("/admin/security-headers", headerPolicy.GetSecurityHeaders)
+				r.Put("/admin/security-headers", headerPolicy.UpdateSecurityHeaders)
+				r.Get("/admin/upload-limits", handlers.GetUploadLimits(store))
+				r.Put("/admin/upload-limits", handlers.UpdateUploadLimits(store))
+
+				// Security event log (authentication failures, privilege escalations, power control)
+				r.Get("/admin/security-events", handlers.ListSecurityEvents(store))
+				r.Get("/admin/security-events/export", handlers.ExportSecurityEvents(store))
+
+				// Outgoing email
+				r.Get("/admin/smtp", handlers.GetSMTPSettings(store))
+				r.Put("/admin/smtp", handlers.UpdateSMTPSettings(store))
+				r.Post("/admin/smtp/test", handlers.SendTestEmail(store))
+
+				// Notification channels and event routing
+				r.Get("/admin/notifications/settings", handlers.GetNotificationSettings(store))
+				r.Put("/admin/notifications/settings", handlers.UpdateNotificationSettings(store))
+				r.Route("/admin/notifications/channels", func(r chi.Router) {
+					r.Get("/", handlers.ListNotificationChannels(store))
+					r.Post("/", handlers.CreateNotificationChannel(store))
+					r.Get("/{id}", handlers.GetNotificationChannel(store))
+					r.Put("/{id}", handlers.UpdateNotificationChannel(store))
+					r.Delete("/{id}", handlers.DeleteNotificationChannel(store))
+					r.Post("/{id}/test", handlers.TestNotificationChannel(store))
+				})
+
+				// Antivirus scanning and quarantine
+				r.Get("/admin/antivirus", handlers.GetAntivirusSettings(store))
+				r.Put("/admin/antivirus", handlers.UpdateAntivirusSettings(store))
+
+				// Deleted pools, zones, shares and share links (restorable for 30 days)
+				r.Get("/admin/deleted", handlers.ListDeletedObjects(store))
+				r.Post("/admin/deleted/{type}/{id}/restore", handlers.RestoreDeletedObject(store))
+				r.Delete("/admin/deleted/{type}/{id}", handlers.PurgeDeletedObject(store))
+
+				// Event log retention
+				r.Get("/admin/activity/settings", handlers.GetEventLogSettings(store))
+				r.Put("/admin/activity/settings", handlers.UpdateEventLogSettings(store))
+
+				// Cleanup of expired sessions, share links, uploads and previews
+				r.Get("/admin/cleanup", expiryReaper.GetCleanupStatus)
+				r.Put("/admin/cleanup", expiryReaper.UpdateCleanupSettings)
+				r.Post("/admin/cleanup/run", expiryReaper.RunCleanup)
+
+				// Database backup and restore
+				r.Get("/admin/database/backup", dbBackupHandler.DownloadBackup)
+				r.Get("/admin/database/backups", dbBackupHandler.GetBackups)
+				r.Post("/admin/database/backups", dbBackupHandler.RunBackup)
+				r.Put("/admin/database/backups/settings", dbBackupHandler.UpdateBackupSettings)
+				r.Post("/admin/database/restore", dbBackupHandler.RestoreBackup)
+				r.Delete("/admin/database/restore", dbBackupHandler.CancelRestore)
+
+				// Office document previews (LibreOffice or Gotenberg)
+				r.Get("/admin/previews/office", handlers.GetOfficePreviewSettings(store))
+				r.Put("/admin/previews/office", handlers.UpdateOfficePreviewSettings(store))
+				r.Route("/admin/quarantine", func(r chi.Router) {
+					r.Get("/", handlers.ListQuarantine(store))
+					r.Delete("/{id}", handlers.DeleteQuarantineItem(store))
+					r.Post("/{id}/restore", handlers.RestoreQuarantineItem(store))
+				})
+
+				// Admin API token management
+				r.Get("/admin/tokens", apiTokenHandler.ListAllTokens)
+
 				// Admin share links management
 				r.Get("/links", shareLinkHandler.GetAllShareLinks)
 
@@ -251,14 +717,28 @@ func main() {
 				// Storage Management (Enterprise)
 				r.Route("/storage", func(r chi.Router) {
 					// Overview
-					r.Get("/overview", handlers.GetStorageOverview())
+					r.Get("/overview", handlers.GetStorageOverview(store))
+
+					// Alerts
+					r.Get("/alerts", handlers.ListStorageAlerts(store))
+					r.Get("/alerts/settings", handlers.GetAlertSettings(store))
+					r.Put("/alerts/settings", handlers.UpdateAlertSettings(store))
+					r.Post("/alerts/{id}/acknowledge", handlers.AcknowledgeStorageAlert(store))
+					r.Post("/alerts/{id}/resolve", handlers.ResolveStorageAlert(store))
 
 					// Disks and Partitions
 					r.Get("/disks", handlers.GetDisks())
 					r.Post("/disks/partition-table", handlers.CreatePartitionTable())
+					r.Get("/disks/wipe/capabilities", handlers.GetDiskWipeCapabilities())
+					r.Post("/disks/wipe/prepare", handlers.PrepareDiskWipe())
+					r.Post("/disks/wipe", handlers.WipeDisk())
 					r.Post("/partitions", handlers.CreatePartition())
 					r.Delete("/partitions", handlers.DeletePartition())
 					r.Post("/partitions/format", handlers.FormatPartition())
+					r.Get("/partitions/table", handlers.GetPartitionTable())
+					r.Post("/partitions/resize", handlers.ResizePartition())
+					r.Post("/partitions/type", handlers.SetPartitionType())
+					r.Post("/filesystems/grow", handlers.GrowFilesystem())
 
 					// Directory browsing for path selection
 					r.Get("/browse", handlers.BrowseDirectories())
@@ -278,16 +758,38 @@ func main() {
 					r.Delete("/mounts", handlers.Unmount())
 					r.Get("/fstab", handlers.GetFstab())
 
+					// LUKS Encryption
+					r.Get("/luks", handlers.ListLUKSDevices())
+					r.Post("/luks/format", handlers.FormatLUKSDevice())
+					r.Post("/luks/open", handlers.OpenLUKSDevice())
+					r.Post("/luks/close", handlers.CloseLUKSDevice())
+					r.Post("/luks/auto-unlock", handlers.EnableLUKSAutoUnlock())
+					r.Delete("/luks/auto-unlock", handlers.DisableLUKSAutoUnlock())
+
 					// I/O Statistics
 					r.Get("/iostats", handlers.GetIOStats())
+					r.Get("/iostats/rates", handlers.GetIORates(ioStatsCollector))
+					r.Get("/iostats/history", handlers.GetIOStatsHistory(ioStatsCollector))
+					r.Get("/iostats/processes", handlers.GetProcessIO())
 
 					// LVM Management
 					r.Get("/lvm/vgs", handlers.GetVolumeGroups())
 					r.Post("/lvm/vgs", handlers.CreateVolumeGroup())
 					r.Delete("/lvm/vgs", handlers.DeleteVolumeGroup())
+					r.Post("/lvm/vgs/extend", handlers.ExtendVolumeGroup())
+					r.Post("/lvm/vgs/reduce", handlers.ReduceVolumeGroup())
+					r.Get("/lvm/pvmove", handlers.GetPVMoves())
+					r.Post("/lvm/pvmove", handlers.StartPVMove())
+					r.Post("/lvm/pvmove/abort", handlers.AbortPVMove())
 					r.Post("/lvm/lvs", handlers.CreateLogicalVolume())
 					r.Delete("/lvm/lvs", handlers.DeleteLogicalVolume())
 					r.Post("/lvm/lvs/resize", handlers.ResizeLogicalVolume())
+					r.Get("/lvm/thinpools", handlers.GetThinPools())
+					r.Post("/lvm/thinpools", handlers.CreateThinPool())
+					r.Post("/lvm/thin", handlers.CreateThinVolume())
+					r.Get("/lvm/snapshots", handlers.ListLVMSnapshots())
+					r.Post("/lvm/snapshots", handlers.CreateLVMSnapshot())
+					r.Post("/lvm/snapshots/merge", handlers.MergeLVMSnapshot())
 
 					// RAID Management
 					r.Get("/raid", handlers.GetRAIDArrays())
@@ -299,6 +801,22 @@ func main() {
 					r.Post("/raid/add-device", handlers.AddRAIDDevice())
 					r.Post("/raid/remove-device", handlers.RemoveRAIDDevice())
 					r.Post("/raid/fail-device", handlers.MarkRAIDDeviceFaulty())
+					r.Post("/raid/grow", handlers.GrowRAIDArray())
+					r.Post("/raid/level", handlers.ChangeRAIDLevel())
+					r.Get("/raid/reshape", handlers.GetRAIDReshapeStatus())
+					r.Post("/raid/bitmap", handlers.SetRAIDBitmap())
+					r.Get("/raid/spares", handlers.ListRAIDSpares(store))
+					r.Post("/raid/spares", handlers.AddRAIDSpare(store))
+					r.Delete("/raid/spares/{id}", handlers.RemoveRAIDSpare(store))
+
+					// Scheduled Scrubs and RAID Checks
+					r.Get("/maintenance", maintenanceHandler.ListSchedules)
+					r.Post("/maintenance", maintenanceHandler.CreateSchedule)
+					r.Get("/maintenance/{id}", maintenanceHandler.GetSchedule)
+					r.Put("/maintenance/{id}", maintenanceHandler.UpdateSchedule)
+					r.Delete("/maintenance/{id}", maintenanceHandler.DeleteSchedule)
+					r.Post("/maintenance/{id}/run", maintenanceHandler.RunSchedule)
+					r.Get("/maintenance/{id}/history", maintenanceHandler.GetScheduleHistory)
 
 					// ZFS Management
 					r.Get("/zfs/pools", handlers.GetZFSPools())
@@ -319,7 +837,10 @@ func main() {
 				// User Storage Usage
 				r.Get("/storage/users", handlers.GetUserStorageUsage())
 				r.Get("/storage/users/{username}", handlers.GetSpecificUserStorage())
-				r.Get("/storage/scan", handlers.ScanFilesystemUsage())
+				r.Get("/storage/usage", usageHandler.GetUsageReport)
+				r.Post("/storage/usage/scan", usageHandler.RunUsageScan)
+				r.Get("/storage/usage/trends", usageHandler.GetUsageTrends)
+				r.Get("/storage/usage/top-growers", usageHandler.GetTopUsageGrowers)
 				r.Get("/storage/large-files", handlers.FindLargeFiles())
 				r.Get("/storage/health", handlers.CheckFilesystemHealth())
 
@@ -328,15 +849,28 @@ func main() {
 					r.Get("/status", handlers.GetSharingServices())
 					r.Post("/install", handlers.InstallSharingService())
 					r.Get("/install/stream", handlers.InstallSharingServiceStream())
-					r.Post("/control", handlers.ControlSharingService())
+					r.Post("/control", handlers.ControlSharingService(store, cfg))
 					r.Get("/smb/config", handlers.GetSMBConfig())
+					r.Get("/smb/config/preview", handlers.PreviewSMBConfig(store))
+					r.Post("/smb/config/apply", handlers.RegenerateSMBConfig(store))
 					r.Get("/smb/status", handlers.GetSMBStatus())
+					r.Post("/smb/sessions/{pid}/close", handlers.CloseSMBSession())
+					r.Post("/smb/shares/{share}/close", handlers.CloseSMBShare())
+					r.Post("/smb/files/close", handlers.CloseSMBOpenFile())
 					r.Get("/smb/test", handlers.TestSMBConnection())
 					r.Get("/smb/users", handlers.GetSambaUsers())
 					r.Post("/smb/password", handlers.SetSambaPassword())
-					r.Get("/nfs/exports", handlers.GetNFSExports())
+					r.Get("/nfs/exports", handlers.GetNFSExports(store))
+					r.Post("/nfs/exports", handlers.CreateNFSExport(store))
+					r.Put("/nfs/exports", handlers.UpdateNFSExport(store))
+					r.Delete("/nfs/exports", handlers.DeleteNFSExport(store))
 					r.Get("/nfs/status", handlers.GetNFSStatus())
 					r.Get("/nfs/test", handlers.TestNFSConnection())
+					r.Get("/iscsi/targets", handlers.ListISCSITargets(store))
+					r.Post("/iscsi/targets", handlers.CreateISCSITarget(store))
+					r.Get("/iscsi/targets/{id}", handlers.GetISCSITarget(store))
+					r.Put("/iscsi/targets/{id}", handlers.UpdateISCSITarget(store))
+					r.Delete("/iscsi/targets/{id}", handlers.DeleteISCSITarget(store))
 				})
 
 				// ZFS Management
@@ -356,17 +890,34 @@ func main() {
 					r.Post("/pools/export", handlers.ExportZFSPool())
 					r.Get("/pools/importable", handlers.ListImportablePools())
 
+					// Pool Device Management
+					r.Post("/pools/attach", handlers.AttachZFSDevice())
+					r.Post("/pools/detach", handlers.DetachZFSDevice())
+					r.Post("/pools/replace", handlers.ReplaceZFSDevice())
+					r.Post("/pools/offline", handlers.OfflineZFSDevice())
+					r.Post("/pools/online", handlers.OnlineZFSDevice())
+					r.Post("/pools/add-device", handlers.AddZFSCacheOrLogDevice())
+					r.Post("/pools/add-vdev", handlers.AddZFSVDev())
+
 					// Dataset Management
 					r.Get("/datasets", handlers.ListZFSDatasets())
 					r.Post("/datasets", handlers.CreateZFSDataset())
 					r.Delete("/datasets", handlers.DestroyZFSDataset())
+					r.Get("/datasets/properties", handlers.GetZFSProperties())
 					r.Post("/datasets/property", handlers.SetZFSProperty())
 
+					// Volume (zvol) Management
+					r.Get("/volumes", handlers.ListZFSVolumes(store))
+					r.Post("/volumes", handlers.CreateZFSVolume())
+					r.Delete("/volumes", handlers.DestroyZFSVolume(store))
+					r.Post("/volumes/resize", handlers.ResizeZFSVolume())
+
 					// Snapshot Management
 					r.Get("/snapshots", handlers.ListZFSSnapshots())
 					r.Post("/snapshots", handlers.CreateZFSSnapshot())
 					r.Delete("/snapshots", handlers.DeleteZFSSnapshot())
 					r.Post("/snapshots/rollback", handlers.RollbackZFSSnapshot())
+					r.Get("/snapshots/diff", handlers.DiffZFSSnapshots())
 
 					// Snapshot Scheduling
 					r.Get("/snapshot-policies", snapshotPolicyHandler.ListPolicies)
@@ -377,6 +928,16 @@ func main() {
 					r.Delete("/snapshot-policies/{id}", snapshotPolicyHandler.DeletePolicy)
 					r.Post("/snapshot-policies/{id}/run", snapshotPolicyHandler.RunPolicy)
 					r.Get("/snapshot-policies/{id}/snapshots", snapshotPolicyHandler.GetPolicySnapshots)
+
+					// Replication
+					r.Get("/replication/jobs", replicationHandler.ListJobs)
+					r.Post("/replication/jobs", replicationHandler.CreateJob)
+					r.Get("/replication/jobs/{id}", replicationHandler.GetJob)
+					r.Put("/replication/jobs/{id}", replicationHandler.UpdateJob)
+					r.Delete("/replication/jobs/{id}", replicationHandler.DeleteJob)
+					r.Post("/replication/jobs/{id}/run", replicationHandler.RunJob)
+					r.Get("/replication/jobs/{id}/status", replicationHandler.GetJobStatus)
+					r.Get("/replication/jobs/{id}/history", replicationHandler.GetJobHistory)
 				})
 
 				// System Management
@@ -388,13 +949,49 @@ func main() {
 					// Services
 					r.Get("/services", handlers.GetServices())
 					r.Post("/services", handlers.ControlService())
+					r.Get("/services/{name}/logs", handlers.GetServiceLogs())
 
 					// Network
 					r.Get("/network", handlers.GetNetworkInterfaces())
 
+					// Firewall
+					r.Get("/firewall", handlers.GetFirewall(store, cfg))
+					r.Put("/firewall", handlers.UpdateFirewallSettings(store, cfg))
+					r.Post("/firewall/sync", handlers.SyncFirewallPorts(store, cfg))
+					r.Post("/firewall/services/{service}/open", handlers.OpenFirewallService(store, cfg))
+					r.Post("/firewall/services/{service}/close", handlers.CloseFirewallService(store, cfg))
+
+					// Self-update
+					r.Get("/update", updater.GetUpdateStatus)
+					r.Put("/update", updater.UpdateUpdateSettings)
+					r.Post("/update/check", updater.CheckForUpdate)
+					r.Post("/update/apply", updater.ApplyUpdate)
+					r.Post("/update/rollback", updater.RollbackUpdate)
+
+					// UPS
+					r.Get("/ups", upsMonitor.GetUPS)
+					r.Put("/ups", upsMonitor.UpdateUPS)
+					r.Get("/ups/devices", upsMonitor.ListUPSDevices)
+
+					// Syslog forwarding
+					r.Get("/syslog", syslogForwarder.GetSyslog)
+					r.Put("/syslog", syslogForwarder.UpdateSyslog)
+					r.Post("/syslog/test", syslogForwarder.TestSyslog)
+
+					// Containers (Docker or Podman, when CONTAINERS_ENABLED is set)
+					r.Get("/containers/runtime", containerHandler.GetContainerRuntime)
+					r.Get("/containers", containerHandler.ListContainers)
+					r.Post("/containers/{id}/{action}", containerHandler.ControlContainer)
+					r.Get("/containers/{id}/logs", containerHandler.GetContainerLogs)
+					r.Get("/containers/{id}/stats", containerHandler.GetContainerStats)
+
 					// Processes
 					r.Get("/processes", handlers.GetProcesses())
 					r.Post("/processes/kill", handlers.KillProcess())
+					r.Get("/processes/tree", handlers.GetProcessTree())
+					r.Get("/processes/{pid}", handlers.GetProcessDetail())
+					r.Post("/processes/{pid}/renice", handlers.ReniceProcess())
+					r.Post("/processes/{pid}/limit", handlers.LimitProcess())
 
 					// Logs
 					r.Get("/logs", handlers.GetSystemLogs())
@@ -404,7 +1001,7 @@ func main() {
 					r.Get("/tasks", handlers.GetScheduledTasks())
 
 					// Power Control
-					r.Post("/power", handlers.PowerControl())
+					r.Post("/power", handlers.PowerControl(store))
 				})
 			})
 		})
@@ -417,32 +1014,24 @@ func main() {
 	}
 	r.Get("/*", handlers.ServeStatic(staticFS))
 
-	// Create HTTP server
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      r,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
-	}
-
-	// Start server in goroutine
-	go func() {
-		log.Printf("Data directory: %s", cfg.DataDir)
+	log.Printf("Data directory: %s", cfg.DataDir)
+	if cfg.DatabaseURL != "" {
+		log.Printf("Storage: Postgres")
+	} else {
 		log.Printf("Storage file: %s", cfg.StorageFile)
+	}
 
-		if cfg.TLSCert != "" && cfg.TLSKey != "" {
-			log.Printf("Starting HTTPS server on port %d", cfg.Port)
-			if err := srv.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey); err != nil && err != http.ErrServerClosed {
-				log.Fatalf("Server error: %v", err)
+	// Start one server per listener
+	servers := make([]*http.Server, 0, len(cfg.Listeners))
+	for _, l := range cfg.Listeners {
+		srv := newServer(l, r, cfg)
+		servers = append(servers, srv)
+		go func() {
+			if err := serve(srv, l, cfg); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Server error on %s: %v", l, err)
 			}
-		} else {
-			log.Printf("Starting HTTP server on port %d", cfg.Port)
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				log.Fatalf("Server error: %v", err)
-			}
-		}
-	}()
+		}()
+	}
 
 	// Wait for interrupt signal for graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -455,9 +1044,19 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	// Refuse new chunks and let in-flight writes finish so uploads resume after the restart
+	if err := chunkedUploadManager.Drain(ctx); err != nil {
+		log.Printf("Upload sessions not drained: %v", err)
 	}
 
+	for i, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Server on %s forced to shutdown: %v", cfg.Listeners[i], err)
+		}
+	}
+
+	// Abort queries of the zone scans before their workers are stopped
+	stopScans()
+
 	log.Println("Server exited")
 }
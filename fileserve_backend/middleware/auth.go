@@ -2,10 +2,14 @@ package middleware
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"fileserv/internal/apierror"
 	"fileserv/internal/auth"
+	"fileserv/models"
 )
 
 type contextKey string
@@ -17,34 +21,112 @@ type UserContext struct {
 	Username string
 	IsAdmin  bool
 	Groups   []string
+
+	// Set when the request was authenticated with an API token instead of a session JWT
+	TokenID    string
+	TokenScope models.APITokenScope
+	TokenZones []string
+
+	// Set when the request was authenticated with a session token
+	SessionID string
+
+	// Set for guest accounts, which may only use GuestZones until ExpiresAt
+	IsGuest    bool
+	GuestZones []string
+	ExpiresAt  *time.Time
+
+	// Set when an admin is acting as this user through an impersonation token
+	ImpersonatedBy string
+}
+
+// IsImpersonated reports whether an admin is acting as the user
+func (u *UserContext) IsImpersonated() bool {
+	return u.ImpersonatedBy != ""
+}
+
+// IsAPIToken reports whether the request was authenticated with an API token
+func (u *UserContext) IsAPIToken() bool {
+	return u.TokenID != ""
+}
+
+// CanAccessZone reports whether an API token is allowed to use the zone (always true for sessions)
+func (u *UserContext) CanAccessZone(zoneID string) bool {
+	if !u.IsAPIToken() || len(u.TokenZones) == 0 {
+		return true
+	}
+	for _, z := range u.TokenZones {
+		if z == zoneID {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenValidator resolves long-lived API tokens to a user context
+type TokenValidator interface {
+	ValidateAPIToken(token string) (*UserContext, error)
 }
 
-func Auth(jwtSecret string) func(http.Handler) http.Handler {
+// GuestValidator resolves guest accounts to a user context, so that expired or deleted guests
+// lose access before their session token runs out
+type GuestValidator interface {
+	ValidateGuest(userID string) (*UserContext, error)
+}
+
+// SessionValidator rejects tokens of sessions that were signed out or revoked
+type SessionValidator interface {
+	ValidateSession(sessionID string, r *http.Request) error
+}
+
+func Auth(jwtSecret string, tokens TokenValidator, guests GuestValidator, sessions SessionValidator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get token from Authorization header
+			// Get token from Authorization header, or from the session cookie (see CSRF)
 			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			token := sessionCookieToken(r)
+			if authHeader == "" && token == "" {
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 				return
 			}
 
 			// Extract token
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
-				return
+			if authHeader != "" {
+				parts := strings.Split(authHeader, " ")
+				if len(parts) != 2 || parts[0] != "Bearer" {
+					apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid authorization header", nil)
+					return
+				}
+				token = parts[1]
 			}
 
-			token := parts[1]
+			// API tokens are checked against the token store
+			if strings.HasPrefix(token, models.APITokenPrefix) && tokens != nil {
+				userCtx, err := tokens.ValidateAPIToken(token)
+				if err != nil {
+					apierror.Write(w, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token", nil)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), UserContextKey, userCtx)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
 
 			// Validate token
 			claims, err := auth.ValidateToken(token, jwtSecret)
 			if err != nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token", nil)
 				return
 			}
 
+			// Revoked sessions are rejected even though their token has not expired
+			if sessions != nil {
+				if err := sessions.ValidateSession(claims.ID, r); err != nil {
+					apierror.Write(w, http.StatusUnauthorized, apierror.CodeSessionRevoked, "Session has been revoked", nil)
+					return
+				}
+			}
+
 			// Add user info to context
 			userCtx := &UserContext{
 				UserID:   claims.UserID,
@@ -53,6 +135,26 @@ func Auth(jwtSecret string) func(http.Handler) http.Handler {
 				Groups:   claims.Groups,
 			}
 
+			if claims.Guest {
+				if guests == nil {
+					apierror.Write(w, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token", nil)
+					return
+				}
+				userCtx, err = guests.ValidateGuest(claims.UserID)
+				if err != nil {
+					apierror.Write(w, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token", nil)
+					return
+				}
+			}
+
+			userCtx.SessionID = claims.ID
+
+			// Every request made while impersonating is written to the audit log
+			if claims.ImpersonatedBy != "" {
+				userCtx.ImpersonatedBy = claims.ImpersonatedBy
+				log.Printf("Impersonation: %s acting as %s: %s %s", claims.ImpersonatedBy, userCtx.Username, r.Method, r.URL.Path)
+			}
+
 			ctx := context.WithValue(r.Context(), UserContextKey, userCtx)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -63,12 +165,12 @@ func RequireAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userCtx, ok := r.Context().Value(UserContextKey).(*UserContext)
 		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized", nil)
 			return
 		}
 
 		if !userCtx.IsAdmin {
-			http.Error(w, "Forbidden: admin access required", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden: admin access required", nil)
 			return
 		}
 
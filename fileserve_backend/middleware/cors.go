@@ -2,20 +2,67 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
 )
 
-func CORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Max-Age", "3600")
+// CORSPolicy supplies the cross-origin settings of the deployment
+type CORSPolicy interface {
+	CORSSettings() models.CORSSettings
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+// CORS lets the configured origins call the API from a browser. Requests from other origins get
+// no CORS headers, so browsers keep their responses from the calling page.
+func CORS(policy CORSPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			settings := policy.CORSSettings()
+			origin := r.Header.Get("Origin")
+
+			if origin != "" {
+				allowOrigin, ok := corsAllowOrigin(settings, origin)
+				if allowOrigin != "*" {
+					// The answer depends on the origin, so caches must keep one per origin
+					w.Header().Add("Vary", "Origin")
+				}
+				if ok {
+					w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+					// Any origin never gets cookies, or every site could act as the user
+					if settings.AllowCredentials && allowOrigin != "*" {
+						w.Header().Set("Access-Control-Allow-Credentials", "true")
+					}
+					w.Header().Set("Access-Control-Expose-Headers", apierror.RequestIDHeader)
+					if r.Method == http.MethodOptions {
+						w.Header().Set("Access-Control-Allow-Methods", strings.Join(settings.AllowedMethods, ", "))
+						w.Header().Set("Access-Control-Allow-Headers", strings.Join(settings.AllowedHeaders, ", "))
+						w.Header().Set("Access-Control-Max-Age", strconv.Itoa(settings.MaxAge))
+					}
+				}
+			}
+
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
 
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// corsAllowOrigin returns the Access-Control-Allow-Origin value for a request origin, and false
+// when the origin is not allowed
+func corsAllowOrigin(settings models.CORSSettings, origin string) (string, bool) {
+	for _, allowed := range settings.AllowedOrigins {
+		if allowed == "*" {
+			return "*", true
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin, true
+		}
+	}
+	return "", false
 }
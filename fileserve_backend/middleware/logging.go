@@ -3,9 +3,20 @@ package middleware
 import (
 	"log"
 	"net/http"
+	"sync/atomic"
 	"time"
+
+	"fileserv/internal/apierror"
 )
 
+// bytesServed counts the bytes of all response bodies written since the server started
+var bytesServed atomic.Int64
+
+// BytesServed returns the number of response body bytes the server has sent since it started
+func BytesServed() int64 {
+	return bytesServed.Load()
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	status int
@@ -16,6 +27,24 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	bytesServed.Add(int64(n))
+	return n, err
+}
+
+// Flush lets streaming handlers (server-sent events) flush through the logger
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -28,11 +57,12 @@ func Logger(next http.Handler) http.Handler {
 		next.ServeHTTP(wrapped, r)
 
 		log.Printf(
-			"%s %s %d %s",
+			"%s %s %d %s %s",
 			r.Method,
 			r.RequestURI,
 			wrapped.status,
 			time.Since(start),
+			w.Header().Get(apierror.RequestIDHeader),
 		)
 	})
 }
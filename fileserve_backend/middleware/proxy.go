@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Context keys of requests that came through a trusted reverse proxy and of the external URL
+const (
+	trustProxyKey  contextKey = "trust_proxy"
+	externalURLKey contextKey = "external_url"
+)
+
+// proxyTrust marks a request whose forwarding headers can be believed
+type proxyTrust struct {
+	proxies []*net.IPNet // Proxies skipped when looking for the client in X-Forwarded-For
+}
+
+// TrustProxy returns middleware that believes the X-Forwarded-* headers of requests that come
+// through a reverse proxy: all requests when all is set, as on a listener only a proxy can reach,
+// and otherwise the requests of the trusted proxies. Trusted proxies are also skipped in
+// X-Forwarded-For, so the client is found behind a chain of them.
+func TrustProxy(proxies []*net.IPNet, all bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if all || inNetworks(proxies, remoteIP(r)) {
+				r = r.WithContext(context.WithValue(r.Context(), trustProxyKey, proxyTrust{proxies: proxies}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// behindProxy reports whether the forwarding headers of a request can be believed
+func behindProxy(r *http.Request) bool {
+	_, trusted := r.Context().Value(trustProxyKey).(proxyTrust)
+	return trusted
+}
+
+// ClientIP returns the address of the client that made a request. Behind a trusted proxy this
+// is the last address in X-Forwarded-For that is not a trusted proxy, as earlier ones can be set
+// by the client; otherwise it is the address of the connection.
+func ClientIP(r *http.Request) string {
+	if trust, ok := r.Context().Value(trustProxyKey).(proxyTrust); ok {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			for i := len(parts) - 1; i >= 0; i-- {
+				ip := strings.TrimSpace(parts[i])
+				if ip == "" || (i > 0 && inNetworks(trust.proxies, ip)) {
+					continue
+				}
+				return ip
+			}
+		}
+		if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+			return xri
+		}
+	}
+	return remoteIP(r)
+}
+
+// remoteIP returns the address of the connection of a request
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// Unix sockets have no client address
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// inNetworks reports whether an address is in one of the networks
+func inNetworks(networks []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExternalURL returns middleware that makes BaseURL return the configured external URL. When
+// the URL has a path, the path is stripped from requests a proxy passed on with it, so the server
+// works on a subpath whether or not the proxy strips the path itself.
+func ExternalURL(external string) func(http.Handler) http.Handler {
+	prefix := ""
+	if u, err := url.Parse(external); err == nil {
+		prefix = u.Path
+	}
+	return func(next http.Handler) http.Handler {
+		if external == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), externalURLKey, external))
+			if prefix != "" {
+				if r.URL.Path == prefix {
+					target := prefix + "/"
+					if r.URL.RawQuery != "" {
+						target += "?" + r.URL.RawQuery
+					}
+					http.Redirect(w, r, target, http.StatusMovedPermanently)
+					return
+				}
+				if strings.HasPrefix(r.URL.Path, prefix+"/") {
+					u := *r.URL
+					u.Path = strings.TrimPrefix(u.Path, prefix)
+					u.RawPath = strings.TrimPrefix(u.RawPath, prefix)
+					r.URL = &u
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BaseURL returns the address clients reach the server at, without a trailing slash: the
+// configured external URL, or else the scheme and host of the request as forwarded by a trusted
+// proxy, with the path prefix it sends in X-Forwarded-Prefix
+func BaseURL(r *http.Request) string {
+	if external, ok := r.Context().Value(externalURLKey).(string); ok {
+		return external
+	}
+
+	scheme := "http"
+	if IsHTTPS(r) {
+		scheme = "https"
+	}
+	host := r.Host
+	prefix := ""
+	if behindProxy(r) {
+		// The first host is the one the client asked for
+		forwarded := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0])
+		if forwarded != "" && !strings.ContainsAny(forwarded, "/\\ @") {
+			host = forwarded
+		}
+		if p := strings.TrimRight(r.Header.Get("X-Forwarded-Prefix"), "/"); strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") {
+			prefix = p
+		}
+	}
+	return scheme + "://" + host + prefix
+}
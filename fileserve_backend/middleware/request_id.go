@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+
+	"fileserv/internal/apierror"
+
+	"github.com/google/uuid"
+)
+
+// requestIDPattern limits request IDs passed in by proxies to safe, short values
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID tags each response with a request ID, taken from a proxy's X-Request-ID header or
+// generated, so error responses and logs can be matched to requests
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(apierror.RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(apierror.RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,39 +1,111 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
+	"strconv"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+)
+
+// Cookies and header used by cookie sessions. The CSRF cookie is readable by scripts, which
+// echo it in the CSRF header (double submit); other sites can neither read it nor set the header.
+const (
+	SessionCookieName = "fileserv_session"
+	CSRFCookieName    = "fileserv_csrf"
+	CSRFHeaderName    = "X-CSRF-Token"
 )
 
-// SecurityHeaders adds security headers to all responses
-func SecurityHeaders(next http.Handler) http.Handler {
+// HeaderPolicy supplies the security header settings of the deployment
+type HeaderPolicy interface {
+	SecurityHeaderSettings() models.SecurityHeaderSettings
+}
+
+// IsHTTPS reports whether the client reached the server over HTTPS, directly or through a
+// trusted proxy
+func IsHTTPS(r *http.Request) bool {
+	return r.TLS != nil || (behindProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https")
+}
+
+// SecurityHeaders adds the configured security headers to all responses
+func SecurityHeaders(policy HeaderPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			settings := policy.SecurityHeaderSettings()
+
+			// Prevent clickjacking attacks
+			if settings.FrameOptions != "" {
+				w.Header().Set("X-Frame-Options", settings.FrameOptions)
+			}
+
+			// Prevent MIME type sniffing
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+
+			// Enable XSS filter in browsers
+			w.Header().Set("X-XSS-Protection", "1; mode=block")
+
+			// Control referrer information
+			if settings.ReferrerPolicy != "" {
+				w.Header().Set("Referrer-Policy", settings.ReferrerPolicy)
+			}
+
+			// Restrict permissions/features
+			w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
+
+			// Content Security Policy
+			if settings.ContentSecurityPolicy != "" {
+				w.Header().Set("Content-Security-Policy", settings.ContentSecurityPolicy)
+			}
+
+			// HSTS is only meaningful (and only honoured) over HTTPS
+			if settings.HSTSMaxAge > 0 && IsHTTPS(r) {
+				hsts := "max-age=" + strconv.Itoa(settings.HSTSMaxAge)
+				if settings.HSTSIncludeSubdomains {
+					hsts += "; includeSubDomains"
+				}
+				w.Header().Set("Strict-Transport-Security", hsts)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sessionCookieToken returns the session token of a request authenticated by cookie, or ""
+// when it carries an Authorization header or no session cookie
+func sessionCookieToken(r *http.Request) string {
+	if r.Header.Get("Authorization") != "" {
+		return ""
+	}
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// CSRF rejects state-changing requests authenticated by the session cookie unless they echo
+// the CSRF cookie in the CSRF header. Requests with an Authorization header cannot be forged
+// by other sites and are not checked.
+func CSRF(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Prevent clickjacking attacks
-		w.Header().Set("X-Frame-Options", "DENY")
-
-		// Prevent MIME type sniffing
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-
-		// Enable XSS filter in browsers
-		w.Header().Set("X-XSS-Protection", "1; mode=block")
-
-		// Control referrer information
-		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-
-		// Restrict permissions/features
-		w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
-
-		// Content Security Policy
-		// Note: 'unsafe-inline' needed for Next.js styles, adjust as needed
-		w.Header().Set("Content-Security-Policy",
-			"default-src 'self'; "+
-				"script-src 'self' 'unsafe-inline' 'unsafe-eval'; "+
-				"style-src 'self' 'unsafe-inline'; "+
-				"img-src 'self' data: blob:; "+
-				"font-src 'self' data:; "+
-				"connect-src 'self'; "+
-				"frame-ancestors 'none'; "+
-				"base-uri 'self'; "+
-				"form-action 'self'")
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if sessionCookieToken(r) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(CSRFCookieName)
+		header := r.Header.Get(CSRFHeaderName)
+		if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeCSRFFailed, "Missing or invalid CSRF token", nil)
+			return
+		}
 
 		next.ServeHTTP(w, r)
 	})
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"fileserv/internal/apierror"
+	"fileserv/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// EnforceTokenScope restricts requests made with API tokens to zone file operations
+// allowed by the token's scope and zone list. Session (JWT) requests pass through unchanged.
+func EnforceTokenScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userCtx := GetUserContext(r)
+		if userCtx == nil || !userCtx.IsAPIToken() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if zoneID := chi.URLParam(r, "zoneId"); zoneID != "" && !userCtx.CanAccessZone(zoneID) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden: API token is not valid for this zone", nil)
+			return
+		}
+
+		if !tokenAllows(userCtx.TokenScope, r.Method, r.URL.Path) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Forbidden: operation not permitted by API token scope", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenAllows applies the scope rules to a request method and path
+func tokenAllows(scope models.APITokenScope, method, path string) bool {
+	isRead := method == http.MethodGet || method == http.MethodHead
+
+	// Identity lookup is always allowed
+	if path == "/api/auth/me" {
+		return isRead
+	}
+
+	// Tokens are limited to zone file and chunked upload endpoints
+	isZone := strings.HasPrefix(path, "/api/zones/")
+	isUpload := strings.HasPrefix(path, "/api/upload/")
+	if !isZone && !isUpload {
+		return false
+	}
+
+	switch scope {
+	case models.TokenScopeReadWrite:
+		return true
+	case models.TokenScopeReadOnly:
+		return isRead
+	case models.TokenScopeUploadOnly:
+		if isUpload {
+			return true
+		}
+		if path == "/api/zones/accessible" {
+			return isRead
+		}
+		// /api/zones/{zoneId}/files/... and /api/zones/{zoneId}/folders/...
+		parts := strings.SplitN(strings.TrimPrefix(path, "/api/zones/"), "/", 3)
+		return method == http.MethodPost && len(parts) >= 2 && (parts[1] == "files" || parts[1] == "folders")
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Alert states
+const (
+	AlertStatusActive       = "active"       // The condition is present and nobody has looked at it
+	AlertStatusAcknowledged = "acknowledged" // The condition is present and an admin has seen it
+	AlertStatusResolved     = "resolved"     // The condition cleared or an admin resolved the alert
+)
+
+// StorageAlertRecord is a storage alert raised by the background monitor. An alert stays
+// open while its condition is present and is resolved once the condition clears.
+type StorageAlertRecord struct {
+	ID             string     `json:"id"`
+	Key            string     `json:"key"`   // Identifies the condition: type and resource
+	Level          string     `json:"level"` // warning, critical
+	Type           string     `json:"type"`  // disk_health, space_low, raid_degraded, etc.
+	Message        string     `json:"message"`
+	Resource       string     `json:"resource"`
+	Status         string     `json:"status"` // active, acknowledged, resolved
+	FirstSeen      time.Time  `json:"first_seen"`
+	LastSeen       time.Time  `json:"last_seen"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	NotifiedAt     *time.Time `json:"notified_at,omitempty"`
+}
+
+// AlertSettings configures storage alert thresholds and notifications
+type AlertSettings struct {
+	SpaceWarningPercent  float64  `json:"space_warning_percent"`  // Filesystem usage that raises a warning
+	SpaceCriticalPercent float64  `json:"space_critical_percent"` // Filesystem usage that raises a critical alert
+	NotifyMinLevel       string   `json:"notify_min_level"`       // warning, critical
+	EmailRecipients      []string `json:"email_recipients"`
+	WebhookURL           string   `json:"webhook_url"` // Receives a JSON POST for every notification
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// APITokenPrefix marks a bearer token as a long-lived API token rather than a JWT
+const APITokenPrefix = "fsv_"
+
+// APITokenScope limits which verbs an API token may use
+type APITokenScope string
+
+const (
+	TokenScopeReadOnly   APITokenScope = "read_only"   // List, download, search
+	TokenScopeUploadOnly APITokenScope = "upload_only" // Upload files and create folders
+	TokenScopeReadWrite  APITokenScope = "read_write"  // All zone file operations
+)
+
+// IsValid reports whether the scope is a known value
+func (s APITokenScope) IsValid() bool {
+	switch s {
+	case TokenScopeReadOnly, TokenScopeUploadOnly, TokenScopeReadWrite:
+		return true
+	}
+	return false
+}
+
+// APIToken is a long-lived bearer token for scripting and CI access to zone files
+type APIToken struct {
+	ID          string        `json:"id"`
+	UserID      string        `json:"user_id"`
+	Username    string        `json:"username"`
+	Groups      []string      `json:"-"` // Owner's groups when the token was created
+	Name        string        `json:"name"`
+	TokenHash   string        `json:"-"`            // SHA-256 of the token (the token itself is never stored)
+	TokenPrefix string        `json:"token_prefix"` // First characters, to help identify the token
+	Scope       APITokenScope `json:"scope"`
+	Zones       []string      `json:"zones"` // Zone IDs the token may access (empty = all accessible zones)
+	ExpiresAt   *time.Time    `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time    `json:"last_used_at,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// IsExpired checks if the token has passed its expiry time
+func (t *APIToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ArchiveEntry is a file or folder inside an archive
+type ArchiveEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+}
+
+// ArchiveListing is the content of an archive
+type ArchiveListing struct {
+	Format     string          `json:"format"` // zip, tar, tar.gz, tar.bz2, 7z
+	Entries    []*ArchiveEntry `json:"entries"`
+	TotalFiles int             `json:"total_files"`
+	TotalSize  int64           `json:"total_size"` // Uncompressed
+	Truncated  bool            `json:"truncated"`  // Entries holds only the first part of the listing
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// ContainerRuntime describes the Docker or Podman engine containers are managed through
+type ContainerRuntime struct {
+	Enabled    bool   `json:"enabled"` // CONTAINERS_ENABLED is set
+	Available  bool   `json:"available"`
+	Socket     string `json:"socket,omitempty"`
+	Runtime    string `json:"runtime,omitempty"` // docker or podman
+	Version    string `json:"version,omitempty"`
+	APIVersion string `json:"api_version,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Container is a Docker or Podman container
+type Container struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Image   string            `json:"image"`
+	State   string            `json:"state"`  // created, running, paused, restarting, exited or dead
+	Status  string            `json:"status"` // Such as "Up 2 hours"
+	Created time.Time         `json:"created"`
+	Ports   []ContainerPort   `json:"ports"`
+	Mounts  []ContainerMount  `json:"mounts"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// ContainerPort is a port published by a container
+type ContainerPort struct {
+	HostIP        string `json:"host_ip,omitempty"`
+	HostPort      int    `json:"host_port,omitempty"` // 0 when not published
+	ContainerPort int    `json:"container_port"`
+	Protocol      string `json:"protocol"`
+}
+
+// ContainerMount is a volume or bind mount of a container, with the zone its host path is in
+type ContainerMount struct {
+	Type        string `json:"type"`           // bind or volume
+	Name        string `json:"name,omitempty"` // Volume name
+	Source      string `json:"source"`         // Path on the host
+	Destination string `json:"destination"`    // Path in the container
+	ReadOnly    bool   `json:"read_only"`
+	ZoneID      string `json:"zone_id,omitempty"`
+	ZoneName    string `json:"zone_name,omitempty"`
+	ZonePath    string `json:"zone_path,omitempty"` // Path of the source in the zone
+}
+
+// ContainerStats is a sample of the resource usage of a container
+type ContainerStats struct {
+	CPUPercent    float64 `json:"cpu_percent"` // 100 is one CPU
+	MemoryUsage   uint64  `json:"memory_usage"`
+	MemoryLimit   uint64  `json:"memory_limit"`
+	MemoryPercent float64 `json:"memory_percent"`
+	NetworkRx     uint64  `json:"network_rx"`
+	NetworkTx     uint64  `json:"network_tx"`
+	BlockRead     uint64  `json:"block_read"`
+	BlockWrite    uint64  `json:"block_write"`
+	PIDs          uint64  `json:"pids"`
+}
@@ -0,0 +1,57 @@
+package models
+
+// Daily statistics recorded for the admin dashboard charts
+const (
+	StatFiles       = "files"        // Files indexed in the server, a pool or a zone
+	StatUsedBytes   = "used_bytes"   // Storage used by the server, a pool or a zone
+	StatActiveUsers = "active_users" // Users with a session active during the day
+	StatBytesServed = "bytes_served" // Bytes sent in HTTP responses during the day
+
+	// Transfer accounting, kept per user, zone and share link
+	StatBytesUploaded   = "bytes_uploaded"   // File bytes received during the day
+	StatBytesDownloaded = "bytes_downloaded" // File bytes sent during the day
+)
+
+// DailyStatMerge is how a recorded value is combined with the value already stored for the day
+type DailyStatMerge int
+
+const (
+	DailyStatSet DailyStatMerge = iota // Replace it: a snapshot such as used bytes
+	DailyStatAdd                       // Add to it: a counter such as bytes served
+	DailyStatMax                       // Keep the higher one: a count that can drop during the day
+)
+
+// DailyStat is the value of a statistic on a day. Statistics of the whole server have an
+// empty object type; others are kept per pool, zone, user or share link.
+type DailyStat struct {
+	Day        string         `json:"day"` // YYYY-MM-DD in server local time
+	Metric     string         `json:"metric"`
+	ObjectType string         `json:"object_type,omitempty"` // pool, zone, user or share_link
+	ObjectID   string         `json:"object_id,omitempty"`
+	Value      int64          `json:"value"`
+	Merge      DailyStatMerge `json:"-"`
+}
+
+// DailyStatFilter selects daily statistics. Zero fields match everything.
+type DailyStatFilter struct {
+	Metric     string
+	ObjectType string // "server" matches statistics of the whole server only
+	ObjectID   string
+	Since      string // First day, YYYY-MM-DD
+	Until      string // Last day, YYYY-MM-DD
+}
+
+// DailyStatPoint is one day of a statistic's history
+type DailyStatPoint struct {
+	Day   string `json:"day"`
+	Value int64  `json:"value"`
+}
+
+// DailyStatSeries is the history of a statistic of the server or one object
+type DailyStatSeries struct {
+	Metric     string           `json:"metric"`
+	ObjectType string           `json:"object_type,omitempty"`
+	ObjectID   string           `json:"object_id,omitempty"`
+	Name       string           `json:"name,omitempty"` // Name of the pool, zone, user or share link
+	Points     []DailyStatPoint `json:"points"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// SoftDeleteRetentionDays is how long deleted pools, zones, shares and share links can be
+// restored before they are purged
+const SoftDeleteRetentionDays = 30
+
+// DeletedObjectType identifies the kind of a soft-deleted object
+type DeletedObjectType string
+
+const (
+	DeletedObjectPool      DeletedObjectType = "pool"
+	DeletedObjectZone      DeletedObjectType = "zone"
+	DeletedObjectShare     DeletedObjectType = "share"
+	DeletedObjectShareLink DeletedObjectType = "share_link"
+)
+
+// DeletedObject is a soft-deleted administrative object awaiting restore or purge
+type DeletedObject struct {
+	Type      DeletedObjectType `json:"type"`
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Detail    string            `json:"detail,omitempty"` // Path of a pool, zone or share, target of a link
+	DeletedAt time.Time         `json:"deleted_at"`
+	PurgeAt   time.Time         `json:"purge_at"` // When the object is deleted for good
+}
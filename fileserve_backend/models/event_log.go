@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DefaultEventLogRetentionDays is how long logged events are kept by default
+const DefaultEventLogRetentionDays = 90
+
+// EventLogEntry is an event published on the event bus, as recorded in the event log
+type EventLogEntry struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Actor      string          `json:"actor,omitempty"`       // User who acted, empty for system events
+	ObjectType string          `json:"object_type,omitempty"` // Kind of object acted on: user, zone, share_link, ...
+	ObjectID   string          `json:"object_id,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Recipients []string        `json:"-"` // Users the event was addressed to; empty = everyone allowed by AdminOnly
+	AdminOnly  bool            `json:"-"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// EventLogFilter selects logged events. Zero fields match everything.
+type EventLogFilter struct {
+	Type       string   // Exact type, or a category such as "snapshot" matching every snapshot.* type
+	Types      []string // Any of these exact types
+	Actor      string
+	ObjectType string
+	ObjectID   string
+	Since      time.Time
+	Until      time.Time
+	VisibleTo  string // Only events a non-admin user with this ID received
+	Recipient  string // Only events addressed to the user with this ID
+	Limit      int
+	Offset     int
+}
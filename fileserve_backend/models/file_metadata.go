@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// FileMetadata holds the user-defined tags, description and star flag of a file or folder
+type FileMetadata struct {
+	ZoneID      string    `json:"zone_id"`
+	Path        string    `json:"path"` // Path relative to the zone root
+	Tags        []string  `json:"tags"`
+	Description string    `json:"description,omitempty"`
+	Starred     bool      `json:"starred"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// IsEmpty reports whether the metadata carries nothing worth storing
+func (m *FileMetadata) IsEmpty() bool {
+	return len(m.Tags) == 0 && m.Description == "" && !m.Starred
+}
+
+// FileMetadataQuery describes the filters for listing file metadata
+type FileMetadataQuery struct {
+	ZoneID     string
+	PathPrefix string   // Restrict results to this path and its descendants
+	Tags       []string // Every tag must be present
+	Starred    bool     // Only starred files
+	Limit      int
+}
+
+// TagCount is a tag and the number of files carrying it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// HomeFile is a file or folder on the home screen of a user: recently used, or starred
+type HomeFile struct {
+	ZoneID   string    `json:"zone_id"`
+	ZoneName string    `json:"zone_name"`
+	Path     string    `json:"path"` // Path in the zone as the user sees it
+	Name     string    `json:"name"`
+	IsDir    bool      `json:"is_dir"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Activity string    `json:"activity,omitempty"` // Why a recent file is listed: modified, uploaded or downloaded
+	Time     time.Time `json:"time"`               // When it was last used, or starred
+}
@@ -0,0 +1,70 @@
+package models
+
+import "strconv"
+
+// Firewall backends
+const (
+	FirewallFirewalld = "firewalld"
+	FirewallNftables  = "nftables"
+	FirewallNone      = "none"
+)
+
+// FirewallPort is a port, or a range of ports, of one protocol
+type FirewallPort struct {
+	Port     int    `json:"port"`
+	EndPort  int    `json:"end_port,omitempty"` // Last port of a range, 0 = single port
+	Protocol string `json:"protocol"`           // tcp or udp
+}
+
+func (p FirewallPort) String() string {
+	s := strconv.Itoa(p.Port)
+	if p.EndPort > p.Port {
+		s += "-" + strconv.Itoa(p.EndPort)
+	}
+	return s + "/" + p.Protocol
+}
+
+// Covers reports whether all of the ports of other are within p
+func (p FirewallPort) Covers(other FirewallPort) bool {
+	end, otherEnd := p.Port, other.Port
+	if p.EndPort > p.Port {
+		end = p.EndPort
+	}
+	if other.EndPort > other.Port {
+		otherEnd = other.EndPort
+	}
+	return p.Protocol == other.Protocol && other.Port >= p.Port && otherEnd <= end
+}
+
+// FirewallService is a service of the server and the ports it listens on
+type FirewallService struct {
+	Service     string         `json:"service"` // http, smb, nfs, sftp or ftp
+	DisplayName string         `json:"display_name"`
+	Ports       []FirewallPort `json:"ports"`
+	Needed      bool           `json:"needed"`  // The service is running or enabled
+	Open        []FirewallPort `json:"open"`    // Ports the firewall lets through
+	Managed     []FirewallPort `json:"managed"` // Ports opened by the server, closed again when no longer needed
+}
+
+// FirewallZone is a firewalld zone
+type FirewallZone struct {
+	Name       string   `json:"name"`
+	Active     bool     `json:"active"`
+	Default    bool     `json:"default"`
+	Target     string   `json:"target,omitempty"`
+	Interfaces []string `json:"interfaces"`
+	Sources    []string `json:"sources"`
+	Services   []string `json:"services"`
+	Ports      []string `json:"ports"`
+}
+
+// FirewallStatus describes the host firewall and the ports of the server's services
+type FirewallStatus struct {
+	Backend    string            `json:"backend"`        // firewalld, nftables or none
+	Zone       string            `json:"zone,omitempty"` // firewalld zone ports are opened in
+	AutoManage bool              `json:"auto_manage"`    // Open and close ports with the services
+	Zones      []FirewallZone    `json:"zones,omitempty"`
+	Rules      []string          `json:"rules,omitempty"` // nftables input chain
+	Services   []FirewallService `json:"services"`
+	Message    string            `json:"message,omitempty"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// FolderShareRecipient is the kind of principal a folder is shared with
+type FolderShareRecipient string
+
+const (
+	RecipientUser  FolderShareRecipient = "user"
+	RecipientGroup FolderShareRecipient = "group"
+)
+
+// FolderSharePermission is the access a recipient gets to a shared folder
+type FolderSharePermission string
+
+const (
+	FolderShareRead      FolderSharePermission = "read"
+	FolderShareReadWrite FolderSharePermission = "read_write"
+)
+
+// FolderShare grants another internal user or group access to a folder in the owner's zone
+type FolderShare struct {
+	ID            string                `json:"id"`
+	OwnerID       string                `json:"owner_id"`
+	OwnerName     string                `json:"owner_name"`
+	ZoneID        string                `json:"zone_id"`
+	Path          string                `json:"path"` // Folder path as seen by the owner in the zone
+	RecipientType FolderShareRecipient  `json:"recipient_type"`
+	Recipient     string                `json:"recipient"` // Username or group name
+	Permission    FolderSharePermission `json:"permission"`
+	CreatedAt     time.Time             `json:"created_at"`
+}
+
+// IsRecipient checks if the share grants access to the given user
+func (fs *FolderShare) IsRecipient(user *User) bool {
+	if user == nil || user.Username == fs.OwnerName {
+		return false
+	}
+	switch fs.RecipientType {
+	case RecipientUser:
+		return user.Username == fs.Recipient
+	case RecipientGroup:
+		for _, group := range user.Groups {
+			if group == fs.Recipient {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanWrite checks if recipients may change the shared folder
+func (fs *FolderShare) CanWrite() bool {
+	return fs.Permission == FolderShareReadWrite
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// ImageMetadata holds the EXIF details of an image in a zone, used by the photo gallery
+type ImageMetadata struct {
+	ZoneID       string     `json:"zone_id"`
+	Path         string     `json:"path"` // Path relative to the zone root
+	DateTaken    *time.Time `json:"date_taken,omitempty"`
+	CameraMake   string     `json:"camera_make,omitempty"`
+	CameraModel  string     `json:"camera_model,omitempty"`
+	Lens         string     `json:"lens,omitempty"`
+	Width        int        `json:"width,omitempty"`
+	Height       int        `json:"height,omitempty"`
+	Orientation  int        `json:"orientation,omitempty"` // EXIF orientation (1-8)
+	ExposureTime string     `json:"exposure_time,omitempty"`
+	FNumber      float64    `json:"f_number,omitempty"`
+	ISO          int        `json:"iso,omitempty"`
+	FocalLength  float64    `json:"focal_length,omitempty"` // Millimeters
+	Latitude     *float64   `json:"latitude,omitempty"`
+	Longitude    *float64   `json:"longitude,omitempty"`
+	Altitude     *float64   `json:"altitude,omitempty"`
+	Size         int64      `json:"size"`
+	ModTime      time.Time  `json:"mod_time"`
+	IndexedAt    time.Time  `json:"indexed_at"`
+}
+
+// GalleryQuery describes the filters for browsing the images of a zone
+type GalleryQuery struct {
+	ZoneID     string
+	PathPrefix string     // Restrict results to this path and its descendants
+	From       *time.Time // Inclusive, by date taken (modification time for images without one)
+	To         *time.Time // Exclusive
+	Limit      int
+	Offset     int
+}
+
+// GalleryResult contains a page of images, newest first
+type GalleryResult struct {
+	Images  []*ImageMetadata `json:"images"`
+	Total   int              `json:"total"`
+	Limit   int              `json:"limit"`
+	Offset  int              `json:"offset"`
+	HasMore bool             `json:"has_more"`
+}
+
+// GalleryBucket is one period of a zone's photo timeline
+type GalleryBucket struct {
+	Period string    `json:"period"` // "2024", "2024-05" or "2024-05-17"
+	Start  time.Time `json:"start"`
+	Count  int       `json:"count"`
+	Cover  string    `json:"cover"` // Path of the newest image in the period
+}
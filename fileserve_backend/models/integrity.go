@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Checksum states
+const (
+	ChecksumStatusOK       = "ok"
+	ChecksumStatusMismatch = "mismatch"
+)
+
+// FileChecksum is the SHA-256 recorded for a file when it was written. The integrity checker
+// re-reads the file periodically; unchanged files whose content no longer matches are flagged.
+type FileChecksum struct {
+	ZoneID       string     `json:"zone_id"`
+	ZoneName     string     `json:"zone_name,omitempty"`
+	Path         string     `json:"path"` // Path relative to the zone root
+	SHA256       string     `json:"sha256"`
+	Size         int64      `json:"size"`
+	ModTime      time.Time  `json:"mod_time"` // Modification time of the file when it was hashed
+	ComputedAt   time.Time  `json:"computed_at"`
+	VerifiedAt   time.Time  `json:"verified_at"`
+	Status       string     `json:"status"`                  // ok, mismatch
+	ActualSHA256 string     `json:"actual_sha256,omitempty"` // Checksum read back when a mismatch was found
+	DetectedAt   *time.Time `json:"detected_at,omitempty"`
+}
+
+// IntegrityStatus reports the state of the background integrity checker
+type IntegrityStatus struct {
+	Running       bool       `json:"running"`
+	LastRun       *time.Time `json:"last_run,omitempty"`
+	NextRun       *time.Time `json:"next_run,omitempty"`
+	FilesVerified int        `json:"files_verified"` // Files whose checksum was checked in the last run
+	FilesHashed   int        `json:"files_hashed"`   // New or modified files that were given a checksum
+	Mismatches    int        `json:"mismatches"`     // Files currently failing verification
+	SkippedZones  []string   `json:"skipped_zones,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// IntegrityReport is returned by the admin integrity endpoint
+type IntegrityReport struct {
+	Status     IntegrityStatus `json:"status"`
+	Mismatches []*FileChecksum `json:"mismatches"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// ISCSILUN maps a ZFS volume to a logical unit number of a target
+type ISCSILUN struct {
+	LUN  int    `json:"lun"`
+	Zvol string `json:"zvol"` // ZFS volume (e.g., "tank/vm-disk1")
+}
+
+// ISCSITarget exports ZFS volumes as block devices over iSCSI through the kernel LIO target
+type ISCSITarget struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	IQN          string     `json:"iqn"`
+	LUNs         []ISCSILUN `json:"luns"`
+	Initiators   []string   `json:"initiators"`          // Initiator names allowed to log in; empty = any initiator that passes CHAP
+	CHAPUser     string     `json:"chap_user,omitempty"` // CHAP authentication is required when set
+	CHAPPassword string     `json:"-"`
+	Enabled      bool       `json:"enabled"`
+	Active       bool       `json:"active"` // The target is currently configured in LIO
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
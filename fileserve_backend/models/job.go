@@ -0,0 +1,88 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Background job types
+const (
+	JobTypeDelete   = "delete"   // Move files and folders to the trash
+	JobTypeCopy     = "copy"     // Copy files and folders into another folder of the zone
+	JobTypeArchive  = "archive"  // Pack files and folders into a zip file in the zone
+	JobTypeExtract  = "extract"  // Unpack an archive into a folder of the zone
+	JobTypeChecksum = "checksum" // Hash files and record their checksums
+)
+
+// Job states
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// How copies and extractions handle files that already exist at the destination
+const (
+	CollisionSkip      = "skip"      // Keep the existing file
+	CollisionOverwrite = "overwrite" // Replace it, keeping the old content as a version
+	CollisionRename    = "rename"    // Write the new file as "name (1).ext"
+)
+
+// MaxJobErrors caps the failures recorded per job
+const MaxJobErrors = 100
+
+// Job is a long-running file operation that runs in the background
+type Job struct {
+	ID           string          `json:"id"`
+	Type         string          `json:"type"`
+	UserID       string          `json:"user_id"`
+	Username     string          `json:"username"`
+	ZoneID       string          `json:"zone_id"`
+	Description  string          `json:"description"`
+	Params       json.RawMessage `json:"params,omitempty"` // The request that created the job
+	Status       string          `json:"status"`
+	Progress     float64         `json:"progress"` // Percent complete
+	TotalItems   int             `json:"total_items"`
+	DoneItems    int             `json:"done_items"`
+	FailedItems  int             `json:"failed_items"`
+	SkippedItems int             `json:"skipped_items"`
+	TotalBytes   int64           `json:"total_bytes"`
+	DoneBytes    int64           `json:"done_bytes"`
+	Result       json.RawMessage `json:"result,omitempty"` // Type-specific outcome, e.g. the path of a created archive
+	Errors       []JobError      `json:"errors"`           // The first MaxJobErrors failed items
+	Error        string          `json:"error,omitempty"`  // Why the job as a whole failed
+	CreatedAt    time.Time       `json:"created_at"`
+	StartedAt    *time.Time      `json:"started_at,omitempty"`
+	FinishedAt   *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job has stopped running
+func (j *Job) Finished() bool {
+	return j.Status == JobStatusCompleted || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
+
+// JobError is an item a job could not handle
+type JobError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// JobRequest starts a job. Paths are within the zone; Destination is the target folder of a copy
+// or extraction and the zip file of an archive.
+type JobRequest struct {
+	Type        string   `json:"type"`
+	ZoneID      string   `json:"zone_id"`
+	Paths       []string `json:"paths"`
+	Destination string   `json:"destination,omitempty"`
+	Collision   string   `json:"collision,omitempty"` // copy and extract: skip (default), overwrite or rename
+}
+
+// JobQuery filters the job history
+type JobQuery struct {
+	UserID string // Empty lists the jobs of every user
+	Status string
+	Type   string
+	Limit  int
+}
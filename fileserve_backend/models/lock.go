@@ -0,0 +1,59 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Lock scopes, as in WebDAV
+const (
+	LockScopeExclusive = "exclusive" // Only the holder may change the file
+	LockScopeShared    = "shared"    // Every holder of a shared lock may change the file
+)
+
+// Lock depths, as in WebDAV
+const (
+	LockDepthZero     = "0"        // The file or folder itself
+	LockDepthInfinity = "infinity" // A folder and everything below it
+)
+
+// Lock timeouts
+const (
+	DefaultLockTimeout = 10 * time.Minute
+	MaxLockTimeout     = 24 * time.Hour
+)
+
+// FileLock is an advisory lock on a file or folder in a zone. Locks are shared by the web API,
+// WebDAV LOCK requests and the file transfer protocols, and expire unless refreshed.
+type FileLock struct {
+	Token     string    `json:"token"` // opaquelocktoken: URI
+	ZoneID    string    `json:"zone_id"`
+	Path      string    `json:"path"` // Path relative to the zone root
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Scope     string    `json:"scope"`           // exclusive or shared
+	Depth     string    `json:"depth"`           // 0 or infinity
+	Owner     string    `json:"owner,omitempty"` // Free-form client information, e.g. the editing application
+	Timeout   int       `json:"timeout"`         // Seconds the lock lasts after each refresh
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Covers reports whether the lock applies to path, a path relative to the zone root
+func (l *FileLock) Covers(path string) bool {
+	if l.Path == path {
+		return true
+	}
+	if l.Depth != LockDepthInfinity {
+		return false
+	}
+	return l.Path == "/" || strings.HasPrefix(path, l.Path+"/")
+}
+
+// FileLockRequest is the body of a lock or refresh request
+type FileLockRequest struct {
+	Scope   string `json:"scope"`   // Defaults to exclusive
+	Depth   string `json:"depth"`   // Defaults to 0
+	Owner   string `json:"owner"`   // Optional client information
+	Timeout int    `json:"timeout"` // Seconds, defaults to DefaultLockTimeout
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// LockoutScope identifies what a lockout counter is tracking
+type LockoutScope string
+
+const (
+	LockoutScopeLoginIP      LockoutScope = "login_ip"      // Failed logins from one client IP
+	LockoutScopeLoginAccount LockoutScope = "login_account" // Failed logins for one username
+	LockoutScopeShareIP      LockoutScope = "share_ip"      // Failed share password attempts from one IP
+	LockoutScopeShareToken   LockoutScope = "share_token"   // Failed password attempts on one share from any IP
+)
+
+// Defaults used when no lockout settings have been saved
+const (
+	DefaultLockoutMaxAttempts = 5
+	DefaultLockoutWindowMins  = 15
+	DefaultLockoutBaseMins    = 1
+	DefaultLockoutMaxMins     = 24 * 60
+)
+
+// Lockout tracks failed authentication attempts for a client or account
+type Lockout struct {
+	Key         string       `json:"key"` // scope:subject
+	Scope       LockoutScope `json:"scope"`
+	Subject     string       `json:"subject"` // IP address, username, or token:IP
+	Failures    int          `json:"failures"`
+	LockedUntil *time.Time   `json:"locked_until,omitempty"`
+	LastFailure time.Time    `json:"last_failure"`
+}
+
+// IsLocked checks if the lockout is currently in effect
+func (l *Lockout) IsLocked() bool {
+	return l.LockedUntil != nil && time.Now().Before(*l.LockedUntil)
+}
+
+// LockoutPolicy holds the configurable rate limiting parameters
+type LockoutPolicy struct {
+	MaxAttempts  int           `json:"max_attempts"`  // Failures allowed within the window before locking
+	Window       time.Duration `json:"window"`        // Failures older than this are forgotten
+	BaseDuration time.Duration `json:"base_duration"` // First lockout length, doubled for each further failure
+	MaxDuration  time.Duration `json:"max_duration"`  // Upper bound on a single lockout
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Maintenance task types
+const (
+	MaintenanceTypeScrub     = "scrub"      // zpool scrub of a ZFS pool
+	MaintenanceTypeRAIDCheck = "raid_check" // mdadm --action=check of a software RAID array
+)
+
+// Maintenance run states
+const (
+	MaintenanceStatusRunning = "running"
+	MaintenanceStatusSuccess = "success" // Finished without finding errors
+	MaintenanceStatusErrors  = "errors"  // Finished and found errors
+	MaintenanceStatusFailed  = "failed"  // Could not be started or did not finish
+)
+
+// MaintenanceSchedule periodically scrubs a ZFS pool or checks the consistency of a RAID array
+type MaintenanceSchedule struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`     // scrub, raid_check
+	Target     string     `json:"target"`   // Pool name (e.g., "tank") or array name (e.g., "md0")
+	Schedule   string     `json:"schedule"` // hourly, daily, weekly, monthly
+	Enabled    bool       `json:"enabled"`
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	NextRun    *time.Time `json:"next_run,omitempty"`
+	LastStatus string     `json:"last_status,omitempty"` // success, errors, failed
+	LastError  string     `json:"last_error,omitempty"`
+	Running    bool       `json:"running"` // A scrub or check is in progress
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// MaintenanceRun records one scrub or check
+type MaintenanceRun struct {
+	ID          string     `json:"id"`
+	ScheduleID  string     `json:"schedule_id"`
+	Type        string     `json:"type"`
+	Target      string     `json:"target"`
+	Status      string     `json:"status"`            // running, success, errors, failed
+	ErrorsFound int64      `json:"errors_found"`      // Unrepaired ZFS errors or mismatched RAID sectors
+	Summary     string     `json:"summary,omitempty"` // Result as reported by zpool or mdadm
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
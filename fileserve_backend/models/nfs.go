@@ -0,0 +1,24 @@
+package models
+
+// NFS export sources
+const (
+	NFSExportSourceFile = "exports" // Entry in /etc/exports
+	NFSExportSourceZone = "zone"    // Generated from a zone with NFS enabled
+)
+
+// NFSExportClient is a host or network allowed to mount an export and its access options
+type NFSExportClient struct {
+	Host       string   `json:"host"` // Hostname, wildcard, CIDR network or @netgroup ("*" = everyone)
+	ReadOnly   bool     `json:"read_only"`
+	RootSquash bool     `json:"root_squash"`
+	Options    []string `json:"options,omitempty"` // Additional exports(5) options, e.g. "sync", "no_subtree_check"
+}
+
+// NFSExportEntry is an exported directory and the clients allowed to mount it
+type NFSExportEntry struct {
+	Path     string            `json:"path"`
+	Clients  []NFSExportClient `json:"clients"`
+	Source   string            `json:"source"`
+	ZoneID   string            `json:"zone_id,omitempty"`
+	ZoneName string            `json:"zone_name,omitempty"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Notification channel types
+const (
+	ChannelTypeWebhook = "webhook" // JSON POST to any URL
+	ChannelTypeSlack   = "slack"   // Slack incoming webhook
+	ChannelTypeDiscord = "discord" // Discord webhook
+	ChannelTypeNtfy    = "ntfy"    // ntfy topic URL
+	ChannelTypeEmail   = "email"   // Email through the configured SMTP server
+)
+
+// Notification events that channels can subscribe to
+const (
+	NotifyEventStorageAlert   = "storage_alert"   // Storage alert raised, escalated or resolved
+	NotifyEventFailedLogin    = "failed_login"    // Login attempt with bad credentials
+	NotifyEventSnapshotFailed = "snapshot_failed" // Scheduled snapshot failed
+	NotifyEventLargeUpload    = "large_upload"    // Upload at or above the large upload threshold
+
+	NotifyEventPrivilegeEscalation = "privilege_escalation" // Admin rights granted or assumed
+	NotifyEventPowerControl        = "power_control"        // System reboot, power off, suspend or hibernate
+	NotifyEventUPSPower            = "ups_power"            // UPS on battery, back on line, low battery or shutting down
+)
+
+// NotifyEvents lists every event a channel can subscribe to
+var NotifyEvents = []string{
+	NotifyEventStorageAlert,
+	NotifyEventFailedLogin,
+	NotifyEventSnapshotFailed,
+	NotifyEventLargeUpload,
+	NotifyEventPrivilegeEscalation,
+	NotifyEventPowerControl,
+	NotifyEventUPSPower,
+}
+
+// NotificationChannel is a destination for admin notifications and the events routed to it
+type NotificationChannel struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	Type            string     `json:"type"`                       // webhook, slack, discord, ntfy, email
+	URL             string     `json:"url,omitempty"`              // Webhook or ntfy topic URL; unused for email
+	Token           string     `json:"-"`                          // Bearer token for webhook and ntfy
+	EmailRecipients []string   `json:"email_recipients,omitempty"` // Recipients of email channels
+	Events          []string   `json:"events"`                     // Events routed to this channel
+	Enabled         bool       `json:"enabled"`
+	LastSentAt      *time.Time `json:"last_sent_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Subscribed reports whether event is routed to the channel
+func (c *NotificationChannel) Subscribed(event string) bool {
+	for _, e := range c.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationSettings configures when routed events produce a notification
+type NotificationSettings struct {
+	LargeUploadMB int      `json:"large_upload_mb"` // Uploads at or above this size raise large_upload
+	Events        []string `json:"events"`          // Events channels can subscribe to (read only)
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential a user signs in with instead of a password
+type Passkey struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"user_id"`
+	Username     string     `json:"username"`
+	Name         string     `json:"name"`          // Chosen by the user, e.g. "Work laptop"
+	CredentialID string     `json:"credential_id"` // base64url, as used by the browser
+	PublicKey    []byte     `json:"-"`             // COSE_Key
+	SignCount    uint32     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsed     *time.Time `json:"last_used,omitempty"`
+}
@@ -27,6 +27,11 @@ func HasPermission(permissions []Permission, user *User, path string, permType P
 		return true
 	}
 
+	// Guests only reach files through their zones
+	if user.IsGuest {
+		return false
+	}
+
 	for _, perm := range permissions {
 		// Check if path matches (exact match or parent path)
 		if !pathMatches(perm.Path, path) {
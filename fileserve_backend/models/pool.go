@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
 
 // StoragePool represents a defined storage location where shares can exist
 type StoragePool struct {
@@ -14,6 +19,10 @@ type StoragePool struct {
 	FreeSpace   int64     `json:"free_space"`  // Free bytes
 	Reserved    int64     `json:"reserved"`    // Reserved for system
 
+	// Backend selects where pool data lives: "local" (default) or "s3"
+	Backend string        `json:"backend"`
+	S3      *S3PoolConfig `json:"s3,omitempty"`
+
 	// Constraints
 	MaxFileSize  int64    `json:"max_file_size"`  // Per-file limit (0 = unlimited)
 	AllowedTypes []string `json:"allowed_types"`  // File extensions allowed (empty = all)
@@ -28,6 +37,28 @@ type StoragePool struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// Storage pool backends
+const (
+	PoolBackendLocal = "local"
+	PoolBackendS3    = "s3"
+)
+
+// S3PoolConfig holds the connection settings of an S3-compatible (AWS, MinIO) pool
+type S3PoolConfig struct {
+	Endpoint  string `json:"endpoint"`             // https://s3.us-east-1.amazonaws.com, http://minio:9000
+	Region    string `json:"region"`               // Defaults to us-east-1
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`               // Optional key prefix inside the bucket
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key,omitempty"` // Never returned by the API
+	PathStyle bool   `json:"path_style"`           // Use path-style URLs (required by most MinIO setups)
+}
+
+// IsS3 reports whether the pool is backed by S3 object storage
+func (p *StoragePool) IsS3() bool {
+	return p.Backend == PoolBackendS3
+}
+
 // ShareZoneType defines the type of share zone
 type ShareZoneType string
 
@@ -56,6 +87,7 @@ type ShareZone struct {
 	AllowedGroups []string `json:"allowed_groups"`
 	DenyUsers     []string `json:"deny_users"`     // Explicitly denied users
 	DenyGroups    []string `json:"deny_groups"`    // Explicitly denied groups
+	Owners        []string `json:"owners"`         // Users who manage the zone and may invite guests to it
 
 	// Sharing rules
 	AllowNetworkShares bool `json:"allow_network_shares"` // SMB/NFS
@@ -72,6 +104,9 @@ type ShareZone struct {
 	// Quotas (override pool defaults)
 	MaxQuotaPerUser int64 `json:"max_quota_per_user"` // 0 = use pool default
 
+	// Largest file that can be uploaded, 0 = use the global upload limit
+	MaxUploadSize int64 `json:"max_upload_size"`
+
 	// Permissions
 	ReadOnly  bool `json:"read_only"`  // Read-only zone
 	Browsable bool `json:"browsable"`  // Show in network browser
@@ -95,6 +130,10 @@ type ZoneSMBOptions struct {
 	ForceGroup    string `json:"force_group"`    // Force all operations as this group
 	VetoFiles     string `json:"veto_files"`     // Files to hide/block
 	Inherit       bool   `json:"inherit"`        // Inherit permissions
+
+	// Time Machine
+	TimeMachine        bool   `json:"time_machine"`                    // Offer the share as a Time Machine backup target to macOS clients
+	TimeMachineMaxSize string `json:"time_machine_max_size,omitempty"` // Limit for backups on the share (e.g., "500G"), empty = unlimited
 }
 
 // ZoneNFSOptions contains NFS-specific configuration for a zone
@@ -109,6 +148,9 @@ type ZoneNFSOptions struct {
 	NoSubtreeCheck bool     `json:"no_subtree_check"` // Disable subtree checking
 	Secure         bool     `json:"secure"`           // Require connections from privileged ports
 	FSId           string   `json:"fsid"`             // Filesystem ID
+
+	// Per-client access, replaces AllowedHosts/RootSquash when set
+	Clients []NFSExportClient `json:"clients,omitempty"`
 }
 
 // ZoneWebOptions contains web-based sharing configuration for a zone
@@ -123,6 +165,13 @@ type ZoneWebOptions struct {
 	CustomBranding string     `json:"custom_branding,omitempty"` // Custom branding/message
 }
 
+// Share link modes
+const (
+	ShareLinkModeStandard = "standard" // Browse and download the target
+	ShareLinkModeRequest  = "request"  // Upload-only file drop into a folder
+	ShareLinkModeOneTime  = "one_time" // Disabled for good once downloaded
+)
+
 // ShareLink represents a shareable link for a file or folder
 type ShareLink struct {
 	ID      string `json:"id"`
@@ -130,12 +179,14 @@ type ShareLink struct {
 	OwnerID string `json:"owner_id"`           // User who created link
 
 	// Target
-	TargetPath string `json:"target_path"` // Full path to file/folder
-	TargetType string `json:"target_type"` // "file" | "folder"
-	TargetName string `json:"target_name"` // Display name of target
+	TargetPath string   `json:"target_path"`     // Full path to file/folder (the parent folder of a selection)
+	TargetType string   `json:"target_type"`     // "file" | "folder" | "selection"
+	TargetName string   `json:"target_name"`     // Display name of target
+	Items      []string `json:"items,omitempty"` // Names of the shared entries in TargetPath, for selections
 
 	// Access
 	Token        string `json:"token"`                   // URL-safe token
+	Slug         string `json:"slug,omitempty"`          // Optional custom name usable in place of the token
 	PasswordHash string `json:"password_hash,omitempty"` // Optional (bcrypt)
 
 	// Limits
@@ -151,6 +202,26 @@ type ShareLink struct {
 	AllowUpload   bool `json:"allow_upload"` // For folders only
 	AllowListing  bool `json:"allow_listing"` // Show directory contents
 
+	// File requests (upload-only links)
+	Mode              string   `json:"mode"`                         // "standard" | "request"
+	MaxFileSize       int64    `json:"max_file_size"`                // Bytes per uploaded file, 0 = unlimited
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"` // Empty = all allowed
+	NotifyOnUpload    bool     `json:"notify_on_upload"`
+
+	// Owner notifications
+	NotifyOnDownload bool `json:"notify_on_download"` // Email the owner when the link is downloaded
+
+	// One-time links (burn after download)
+	BurnAfterIPs int        `json:"burn_after_ips"`         // Burn once this many client IPs completed a download (0 or 1 = the first download)
+	DeleteOnBurn bool       `json:"delete_on_burn"`         // Delete the shared file when the link burns
+	DownloadIPs  []string   `json:"download_ips,omitempty"`  // Client IPs that completed a download
+	BurnedAt     *time.Time `json:"burned_at,omitempty"`    // When the link was disabled by a download
+
+	// Network restrictions, checked against the client IP before anything is served
+	AllowedCIDRs     []string `json:"allowed_cidrs,omitempty"`     // Empty = any address
+	AllowedCountries []string `json:"allowed_countries,omitempty"` // ISO 3166 codes, empty = any country
+	BlockedCountries []string `json:"blocked_countries,omitempty"` // ISO 3166 codes
+
 	// Display
 	Name          string `json:"name"`        // Custom display name
 	Description   string `json:"description"` // Optional description
@@ -162,6 +233,9 @@ type ShareLink struct {
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
 	LastAccessed *time.Time `json:"last_accessed,omitempty"`
+
+	// URL is the public page address, filled in for responses
+	URL string `json:"url,omitempty"`
 }
 
 // WebShareOptions contains web-based sharing configuration for a Share
@@ -210,7 +284,7 @@ type PublicShareInfo struct {
 	Token           string    `json:"token"`
 	Name            string    `json:"name"`
 	Description     string    `json:"description,omitempty"`
-	TargetType      string    `json:"target_type"` // file or folder
+	TargetType      string    `json:"target_type"` // file, folder or selection
 	TargetName      string    `json:"target_name"`
 	Size            int64     `json:"size,omitempty"`
 	CustomMessage   string    `json:"custom_message,omitempty"`
@@ -221,17 +295,44 @@ type PublicShareInfo struct {
 	AllowUpload     bool      `json:"allow_upload"`
 	AllowListing    bool      `json:"allow_listing"`
 	RequiresPassword bool     `json:"requires_password"`
+	Mode            string    `json:"mode"`
+	MaxFileSize     int64     `json:"max_file_size,omitempty"`
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"`
+	CaptchaProvider string     `json:"captcha_provider,omitempty"` // Set while the password prompt needs a captcha
+	CaptchaSiteKey  string     `json:"captcha_site_key,omitempty"`
 	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
 	CreatedAt       time.Time  `json:"created_at"`
 }
 
 // PublicFileInfo represents a file in a public share listing
 type PublicFileInfo struct {
-	Name    string    `json:"name"`
-	Path    string    `json:"path"`
-	Size    int64     `json:"size"`
-	IsDir   bool      `json:"is_dir"`
-	ModTime time.Time `json:"mod_time"`
+	Name        string    `json:"name"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	IsDir       bool      `json:"is_dir"`
+	ModTime     time.Time `json:"mod_time"`
+	Extension   string    `json:"extension,omitempty"`
+	MimeType    string    `json:"mime_type,omitempty"`
+	Previewable bool      `json:"previewable,omitempty"` // Can be opened with /preview
+	Thumbnail   bool      `json:"thumbnail,omitempty"`   // A scaled-down image is available from /thumbnail
+}
+
+// PublicBreadcrumb is one folder on the way from the share root to the listed folder
+type PublicBreadcrumb struct {
+	Name string `json:"name"`
+	Path string `json:"path"` // "" for the share root
+}
+
+// PublicShareListing is a page of a public share folder listing
+type PublicShareListing struct {
+	Path        string             `json:"path"`
+	Breadcrumbs []PublicBreadcrumb `json:"breadcrumbs"`
+	Files       []PublicFileInfo   `json:"files"`
+	Total       int                `json:"total"`
+	Limit       int                `json:"limit"`
+	Offset      int                `json:"offset"`
+	HasMore     bool               `json:"has_more"`
+	NextCursor  string             `json:"next_cursor,omitempty"`
 }
 
 // NewStoragePool creates a new storage pool with default values
@@ -250,6 +351,20 @@ func NewStoragePool(name, path string) *StoragePool {
 	}
 }
 
+// DefaultZoneNFSOptions returns the NFS export options of a new zone
+func DefaultZoneNFSOptions() *ZoneNFSOptions {
+	return &ZoneNFSOptions{
+		AllowedHosts:   []string{"*"},
+		RootSquash:     true,
+		AllSquash:      false,
+		AnonUID:        65534, // nobody
+		AnonGID:        65534,
+		Sync:           true,
+		NoSubtreeCheck: true,
+		Secure:         true,
+	}
+}
+
 // NewShareZone creates a new share zone with default values
 func NewShareZone(name, poolID, path string, zoneType ShareZoneType) *ShareZone {
 	now := time.Now()
@@ -274,16 +389,7 @@ func NewShareZone(name, poolID, path string, zoneType ShareZoneType) *ShareZone
 			DirectoryMask: "0755",
 			Inherit:       false,
 		},
-		NFSOptions: &ZoneNFSOptions{
-			AllowedHosts:   []string{"*"},
-			RootSquash:     true,
-			AllSquash:      false,
-			AnonUID:        65534, // nobody
-			AnonGID:        65534,
-			Sync:           true,
-			NoSubtreeCheck: true,
-			Secure:         true,
-		},
+		NFSOptions: DefaultZoneNFSOptions(),
 		WebOptions: &ZoneWebOptions{
 			PublicEnabled: false,
 			AllowDownload: true,
@@ -352,6 +458,7 @@ func NewShareLink(ownerID, targetPath, targetType, targetName, token string) *Sh
 		AllowPreview:  true,
 		AllowUpload:   false,
 		AllowListing:  true,
+		Mode:          ShareLinkModeStandard,
 		Enabled:       true,
 		ShowOwner:     false,
 		CreatedAt:     now,
@@ -397,9 +504,40 @@ func (sl *ShareLink) IsAccessible() bool {
 	return true
 }
 
+// IsFileRequest checks if the link only accepts uploads
+func (sl *ShareLink) IsFileRequest() bool {
+	return sl.Mode == ShareLinkModeRequest
+}
+
+// IsOneTime checks if the link burns after being downloaded
+func (sl *ShareLink) IsOneTime() bool {
+	return sl.Mode == ShareLinkModeOneTime
+}
+
+// IsSelection checks if the link shares chosen entries of a folder rather than a whole target
+func (sl *ShareLink) IsSelection() bool {
+	return sl.TargetType == "selection"
+}
+
+// SelectionAllows checks if a path relative to the link target is part of a selection, that
+// is one of its entries or inside one. Other links share everything below their target.
+func (sl *ShareLink) SelectionAllows(relPath string) bool {
+	if !sl.IsSelection() {
+		return true
+	}
+	relPath = strings.Trim(path.Clean("/"+relPath), "/")
+	first, _, _ := strings.Cut(relPath, "/")
+	return first != "" && slices.Contains(sl.Items, first)
+}
+
+// HasNetworkRestrictions checks if the link is limited to some addresses or countries
+func (sl *ShareLink) HasNetworkRestrictions() bool {
+	return len(sl.AllowedCIDRs) > 0 || len(sl.AllowedCountries) > 0 || len(sl.BlockedCountries) > 0
+}
+
 // CanDownload checks if downloads are still allowed
 func (sl *ShareLink) CanDownload() bool {
-	if !sl.AllowDownload {
+	if sl.IsFileRequest() || !sl.AllowDownload {
 		return false
 	}
 	if sl.IsDownloadLimitReached() {
@@ -419,6 +557,11 @@ func (z *ShareZone) UserHasZoneAccess(user *User) bool {
 		return true
 	}
 
+	// Guests only reach the zones they were invited to
+	if user.IsGuest {
+		return !user.IsExpired() && slices.Contains(user.GuestZones, z.ID)
+	}
+
 	// Check deny lists first - explicit denies take precedence
 	for _, u := range z.DenyUsers {
 		if u == user.Username {
@@ -439,6 +582,11 @@ func (z *ShareZone) UserHasZoneAccess(user *User) bool {
 		return true
 	}
 
+	// Owners can always use their zone
+	if z.IsOwner(user) {
+		return true
+	}
+
 	// Check allowed users
 	for _, u := range z.AllowedUsers {
 		if u == user.Username || u == "*" {
@@ -461,6 +609,11 @@ func (z *ShareZone) UserHasZoneAccess(user *User) bool {
 	return false
 }
 
+// IsOwner checks if a user manages the zone
+func (z *ShareZone) IsOwner(user *User) bool {
+	return !user.IsGuest && slices.Contains(z.Owners, user.Username)
+}
+
 // UserZoneInfo represents a zone with its full path for the user
 type UserZoneInfo struct {
 	ZoneID      string        `json:"zone_id"`
@@ -473,4 +626,5 @@ type UserZoneInfo struct {
 	Description string        `json:"description"`
 	CanUpload   bool          `json:"can_upload"`
 	CanShare    bool          `json:"can_share"`
+	CanInvite   bool          `json:"can_invite"` // May invite guests to the zone
 }
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// ProcessNode is a process in the process tree
+type ProcessNode struct {
+	Process
+	PPID     int            `json:"ppid"`
+	Nice     int            `json:"nice"`
+	Threads  int            `json:"threads"`
+	Children []*ProcessNode `json:"children,omitempty"`
+}
+
+// ProcessDetail describes a single process, read from /proc/<pid>
+type ProcessDetail struct {
+	PID           int               `json:"pid"`
+	PPID          int               `json:"ppid"`
+	Name          string            `json:"name"`
+	State         string            `json:"state"`
+	User          string            `json:"user"`
+	Command       string            `json:"command"`
+	Args          []string          `json:"args"`
+	Exe           string            `json:"exe,omitempty"`
+	Cwd           string            `json:"cwd,omitempty"`
+	Nice          int               `json:"nice"`
+	VSZ           uint64            `json:"vsz"`
+	RSS           uint64            `json:"rss"`
+	StartedAt     *time.Time        `json:"started_at,omitempty"`
+	Environment   map[string]string `json:"environment"` // Only variables that do not hold credentials
+	Cgroup        string            `json:"cgroup,omitempty"`
+	Unit          string            `json:"unit,omitempty"` // systemd unit owning the cgroup; limits apply to it
+	Limits        CgroupLimits      `json:"limits"`
+	Threads       []ProcessThread   `json:"threads"`
+	OpenFiles     []ProcessFile     `json:"open_files"`
+	OpenFileCount int               `json:"open_file_count"` // May be more than listed
+	Children      []int             `json:"children"`
+}
+
+// ProcessThread is a thread of a process
+type ProcessThread struct {
+	TID   int    `json:"tid"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// ProcessFile is an open file descriptor of a process
+type ProcessFile struct {
+	FD     int    `json:"fd"`
+	Type   string `json:"type"` // file, directory, device, socket, pipe or anon
+	Target string `json:"target"`
+}
+
+// CgroupLimits are the CPU and IO limits of a cgroup (v2)
+type CgroupLimits struct {
+	CPUPercent float64         `json:"cpu_percent"` // 0 when unlimited; 100 is one CPU
+	IO         []CgroupIOLimit `json:"io"`
+}
+
+// CgroupIOLimit is the bandwidth limit of a cgroup on a block device
+type CgroupIOLimit struct {
+	Device   string `json:"device"`
+	ReadBPS  uint64 `json:"read_bps"` // 0 when unlimited
+	WriteBPS uint64 `json:"write_bps"`
+}
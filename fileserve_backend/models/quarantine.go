@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// DefaultQuarantineDir is where infected uploads are moved when no directory has been configured
+const DefaultQuarantineDir = "/var/lib/fileserv/quarantine"
+
+// DefaultClamdAddress is the clamd address used when none has been configured
+const DefaultClamdAddress = "127.0.0.1:3310"
+
+// QuarantineItem represents an uploaded file that the virus scanner flagged as infected
+type QuarantineItem struct {
+	ID             string    `json:"id"`
+	ZoneID         string    `json:"zone_id"`
+	OriginalPath   string    `json:"original_path"` // Path relative to the zone root where the file was uploaded
+	Name           string    `json:"name"`
+	Size           int64     `json:"size"`
+	Signature      string    `json:"signature"`        // Malware name reported by the scanner
+	UploadedBy     string    `json:"uploaded_by"`      // User ID (empty for share link uploads)
+	UploadedByName string    `json:"uploaded_by_name"` // Username, or the share link name
+	QuarantinedAt  time.Time `json:"quarantined_at"`
+}
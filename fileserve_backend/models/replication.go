@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// Replication run states
+const (
+	ReplicationStatusRunning = "running"
+	ReplicationStatusSuccess = "success"
+	ReplicationStatusFailed  = "failed"
+)
+
+// ReplicationJob copies a ZFS dataset to another dataset, usually on a remote host over SSH,
+// using zfs send | zfs receive. After the first full copy only the changes since the last
+// snapshot both sides have in common are sent.
+type ReplicationJob struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	SourceDataset string     `json:"source_dataset"` // Local dataset to replicate (e.g., "tank/data")
+	TargetHost    string     `json:"target_host"`    // SSH host receiving the stream; empty = this host
+	TargetPort    int        `json:"target_port"`    // SSH port (default: 22)
+	TargetUser    string     `json:"target_user"`    // SSH user (default: root)
+	SSHKeyPath    string     `json:"ssh_key_path"`   // Private key used to log in to the target host
+	TargetDataset string     `json:"target_dataset"` // Dataset the stream is received into
+	Schedule      string     `json:"schedule"`       // hourly, daily, weekly, monthly
+	Recursive     bool       `json:"recursive"`      // Replicate child datasets too
+	Retention     int        `json:"retention"`      // Replication snapshots kept on each side (default: 3)
+	Enabled       bool       `json:"enabled"`
+	LastRun       *time.Time `json:"last_run,omitempty"`
+	NextRun       *time.Time `json:"next_run,omitempty"`
+	LastStatus    string     `json:"last_status,omitempty"` // success, failed
+	LastError     string     `json:"last_error,omitempty"`
+	LastSnapshot  string     `json:"last_snapshot,omitempty"` // Newest snapshot the target has received
+	Running       bool       `json:"running"`                 // A transfer is in progress
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// GetSnapshotPrefix returns the prefix of the snapshots created for this job
+func (j *ReplicationJob) GetSnapshotPrefix() string {
+	id := j.ID
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	return "repl-" + id + "-"
+}
+
+// GetSnapshotName generates the name of the next replication snapshot
+func (j *ReplicationJob) GetSnapshotName() string {
+	return j.GetSnapshotPrefix() + time.Now().Format("2006-01-02_15-04-05")
+}
+
+// ReplicationRun records one execution of a replication job
+type ReplicationRun struct {
+	ID           string     `json:"id"`
+	JobID        string     `json:"job_id"`
+	Status       string     `json:"status"`                  // running, success, failed
+	Snapshot     string     `json:"snapshot,omitempty"`      // Snapshot sent in this run
+	BaseSnapshot string     `json:"base_snapshot,omitempty"` // Common snapshot the stream is incremental from; empty = full send
+	Resumed      bool       `json:"resumed"`                 // An interrupted transfer was resumed first
+	BytesSent    int64      `json:"bytes_sent"`
+	Error        string     `json:"error,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
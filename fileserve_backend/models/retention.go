@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// Retention policy actions
+const (
+	RetentionActionDelete  = "delete"  // Remove the file permanently
+	RetentionActionArchive = "archive" // Move the file into another zone
+)
+
+// Retention run states
+const (
+	RetentionStatusSuccess = "success" // Every matching file was handled
+	RetentionStatusErrors  = "errors"  // Some files could not be deleted or moved
+	RetentionStatusFailed  = "failed"  // The run could not be completed
+)
+
+// RetentionPolicy deletes or archives the files in a zone directory that have not been
+// modified for a number of days
+type RetentionPolicy struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	ZoneID        string     `json:"zone_id"`
+	Path          string     `json:"path"`                      // Directory within the zone ("/" for the whole zone)
+	Pattern       string     `json:"pattern,omitempty"`         // Optional file name glob, e.g. "*.log"
+	MaxAgeDays    int        `json:"max_age_days"`              // Files older than this are acted on
+	Action        string     `json:"action"`                    // delete, archive
+	ArchiveZoneID string     `json:"archive_zone_id,omitempty"` // Destination zone for archive
+	ArchivePath   string     `json:"archive_path,omitempty"`    // Directory within the destination zone
+	Schedule      string     `json:"schedule"`                  // hourly, daily, weekly, monthly
+	Enabled       bool       `json:"enabled"`
+	LastRun       *time.Time `json:"last_run,omitempty"`
+	NextRun       *time.Time `json:"next_run,omitempty"`
+	LastStatus    string     `json:"last_status,omitempty"` // success, errors, failed
+	LastError     string     `json:"last_error,omitempty"`
+	Running       bool       `json:"running"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// RetentionCandidate is a file a retention policy would act on
+type RetentionCandidate struct {
+	Path    string    `json:"path"` // Path relative to the zone root
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// RetentionPreview lists the files a retention policy would act on if it ran now
+type RetentionPreview struct {
+	PolicyID   string                `json:"policy_id"`
+	Action     string                `json:"action"`
+	Cutoff     time.Time             `json:"cutoff"` // Files modified before this match
+	TotalFiles int                   `json:"total_files"`
+	TotalSize  int64                 `json:"total_size"`
+	Files      []*RetentionCandidate `json:"files"`     // Capped; see Truncated
+	Truncated  bool                  `json:"truncated"` // More files match than are listed
+}
+
+// RetentionAction records a file deleted or archived by a retention policy
+type RetentionAction struct {
+	ID          string    `json:"id"`
+	PolicyID    string    `json:"policy_id"`
+	ZoneID      string    `json:"zone_id"`
+	Path        string    `json:"path"` // Path relative to the zone root
+	Action      string    `json:"action"`
+	Destination string    `json:"destination,omitempty"` // Path in the archive zone
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Error       string    `json:"error,omitempty"`
+	PerformedAt time.Time `json:"performed_at"`
+}
@@ -0,0 +1,101 @@
+package models
+
+import "time"
+
+// FileIndexEntry is a single file or folder recorded by the background search indexer
+type FileIndexEntry struct {
+	ZoneID    string    `json:"zone_id"`
+	Path      string    `json:"path"` // Path relative to the zone root (e.g., "/docs/report.pdf")
+	Name      string    `json:"name"`
+	Extension string    `json:"extension,omitempty"` // Lowercase, without the leading dot
+	Size      int64     `json:"size"`
+	IsDir     bool      `json:"is_dir"`
+	ModTime   time.Time `json:"mod_time"`
+	IndexedAt time.Time `json:"indexed_at"`
+
+	// User-defined metadata, see FileMetadata
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Starred     bool     `json:"starred,omitempty"`
+}
+
+// FileSearchQuery describes the filters for a zone file search
+type FileSearchQuery struct {
+	ZoneID         string
+	Text           string     // Free text matched against file names (prefix match per term)
+	PathPrefix     string     // Restrict results to this path and its descendants
+	Extensions     []string   // Lowercase extensions without the leading dot
+	MinSize        int64      // 0 = no lower bound
+	MaxSize        int64      // 0 = no upper bound
+	ModifiedAfter  *time.Time // Inclusive
+	ModifiedBefore *time.Time // Inclusive
+	Type           string     // "file", "folder", or "" for both
+	Tags           []string   // Every tag must be present
+	Content        bool       // Also match Text against text extracted from documents
+	Starred        bool       // Only starred files
+	SortBy         string     // "relevance", "name", "size", "modified"
+	SortDesc       bool
+	Limit          int
+	Offset         int
+}
+
+// FileSearchResult contains paginated search results
+type FileSearchResult struct {
+	Files   []*FileIndexEntry `json:"files"`
+	Total   int               `json:"total"`
+	Limit   int               `json:"limit"`
+	Offset  int               `json:"offset"`
+	HasMore bool              `json:"has_more"`
+}
+
+// ZoneIndexStatus reports the state of the search index for a zone
+type ZoneIndexStatus struct {
+	ZoneID      string     `json:"zone_id"`
+	ZoneName    string     `json:"zone_name"`
+	Entries     int        `json:"entries"`
+	LastIndexed *time.Time `json:"last_indexed,omitempty"`
+	Indexing    bool       `json:"indexing"`
+	LastError   string     `json:"last_error,omitempty"`
+
+	// Document content index, only reported for zones that opted in
+	Content *ContentIndexStats `json:"content,omitempty"`
+}
+
+// ZoneContentIndexing holds the document content indexing settings of a zone
+type ZoneContentIndexing struct {
+	ZoneID      string    `json:"zone_id"`
+	Enabled     bool      `json:"enabled"`
+	MaxFileSize int64     `json:"max_file_size"` // Larger documents are not indexed
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DefaultContentIndexMaxFileSize is the largest document indexed unless a zone sets its own limit
+const DefaultContentIndexMaxFileSize = 20 * 1024 * 1024
+
+// DefaultZoneContentIndexing returns the settings used for zones without saved settings
+func DefaultZoneContentIndexing(zoneID string) *ZoneContentIndexing {
+	return &ZoneContentIndexing{
+		ZoneID:      zoneID,
+		Enabled:     false,
+		MaxFileSize: DefaultContentIndexMaxFileSize,
+	}
+}
+
+// FileContent is the text extracted from a document for content search
+type FileContent struct {
+	ZoneID    string    `json:"zone_id"`
+	Path      string    `json:"path"`    // Path relative to the zone root
+	Content   string    `json:"content"` // Extracted text (capped)
+	Size      int64     `json:"size"`    // Size of the document when it was indexed
+	ModTime   time.Time `json:"mod_time"`
+	Error     string    `json:"error,omitempty"` // Why no text could be extracted
+	IndexedAt time.Time `json:"indexed_at"`
+}
+
+// ContentIndexStats reports the size of a zone's document content index
+type ContentIndexStats struct {
+	Enabled   bool  `json:"enabled"`
+	Documents int   `json:"documents"`  // Documents with extracted text
+	Failed    int   `json:"failed"`     // Documents whose text could not be extracted
+	TextBytes int64 `json:"text_bytes"` // Total size of the extracted text
+}
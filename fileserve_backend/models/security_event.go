@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// SecurityEventType identifies what a security event records
+type SecurityEventType string
+
+const (
+	SecurityEventAuthFailure         SecurityEventType = "auth_failure"         // Rejected login or share password
+	SecurityEventPrivilegeEscalation SecurityEventType = "privilege_escalation" // Admin rights granted or assumed
+	SecurityEventPowerControl        SecurityEventType = "power_control"        // Reboot, power off, suspend or hibernate
+)
+
+// SecurityEventTypes lists every security event type
+var SecurityEventTypes = []SecurityEventType{
+	SecurityEventAuthFailure,
+	SecurityEventPrivilegeEscalation,
+	SecurityEventPowerControl,
+}
+
+// SecurityEventRetentionDays is how long security events are kept
+const SecurityEventRetentionDays = 90
+
+// SecurityEvent is an entry of the security event log
+type SecurityEvent struct {
+	ID        int64             `json:"id"`
+	Type      SecurityEventType `json:"type"`
+	Source    string            `json:"source"`           // Where it happened: web, passkey, sftp, ftp, share, admin, system
+	Actor     string            `json:"actor"`            // User who acted or the username that was tried
+	Target    string            `json:"target,omitempty"` // Affected user, share link or power action
+	IP        string            `json:"ip,omitempty"`
+	Message   string            `json:"message"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// SecurityEventFilter selects security events. Zero fields match everything.
+type SecurityEventFilter struct {
+	Type   SecurityEventType
+	Actor  string
+	IP     string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
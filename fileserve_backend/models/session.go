@@ -2,11 +2,20 @@ package models
 
 import "time"
 
+// Session is a signed-in browser or client. Its ID is carried in the session token (the JWT
+// ID), so revoking the session invalidates the token immediately.
 type Session struct {
-	Token     string    `json:"token"`
-	UserID    string    `json:"user_id"`
-	ExpiresAt time.Time `json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
+	ID             string    `json:"id"`
+	Token          string    `json:"-"` // Current token, replaced when the session is refreshed
+	UserID         string    `json:"user_id"`
+	Username       string    `json:"username"`
+	IP             string    `json:"ip"`
+	UserAgent      string    `json:"user_agent"`
+	Device         string    `json:"device"`                    // Browser and OS derived from the user agent
+	ImpersonatedBy string    `json:"impersonated_by,omitempty"` // Admin acting as the user
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastSeen       time.Time `json:"last_seen"`
 }
 
 // IsExpired checks if the session has expired
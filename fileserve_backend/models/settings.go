@@ -19,19 +19,170 @@ const (
 	CategorySecurity SettingsCategory = "security"
 	CategoryAuth     SettingsCategory = "auth"
 	CategoryStorage  SettingsCategory = "storage"
+	CategoryAccess   SettingsCategory = "access" // File transfer protocols
+	CategoryEmail    SettingsCategory = "email"
 )
 
 // Known setting keys
 const (
-	SettingServerName    = "server_name"
-	SettingJWTSecret     = "jwt_secret"
-	SettingSessionExpiry = "session_expiry_hours"
-	SettingUsePAM        = "use_pam"
-	SettingAdminGroups   = "admin_groups"
-	SettingSetupComplete = "setup_complete"
-	SettingCreatedAt     = "created_at"
+	SettingServerName     = "server_name"
+	SettingJWTSecret      = "jwt_secret"
+	SettingSessionExpiry  = "session_expiry_hours"
+	SettingUsePAM         = "use_pam"
+	SettingAdminGroups    = "admin_groups"
+	SettingSetupComplete  = "setup_complete"
+	SettingCreatedAt      = "created_at"
+	SettingTrashRetention = "trash_retention_days"
+
+	// Brute-force protection
+	SettingLockoutMaxAttempts = "lockout_max_attempts"
+	SettingLockoutWindow      = "lockout_window_minutes"
+	SettingLockoutBase        = "lockout_base_minutes"
+	SettingLockoutMax         = "lockout_max_minutes"
+
+	// Share link password protection
+	SettingShareDelayAfter      = "share_verify_delay_after"
+	SettingShareMaxDelay        = "share_verify_max_delay_seconds"
+	SettingShareCaptchaProvider = "share_captcha_provider"
+	SettingShareCaptchaSiteKey  = "share_captcha_site_key"
+	SettingShareCaptchaSecret   = "share_captcha_secret"
+	SettingShareCaptchaAfter    = "share_captcha_after"
+
+	// Country lookups for share link geo restrictions
+	SettingGeoIPDatabase = "geoip_database_path"
+
+	// Password policy
+	SettingPasswordMinLength  = "password_min_length"
+	SettingPasswordMinClasses = "password_min_classes"
+	SettingPasswordHistory    = "password_history"
+	SettingPasswordMaxAge     = "password_max_age_days"
+
+	// Security headers and cookie sessions
+	SettingContentSecurityPolicy = "security_csp"
+	SettingReferrerPolicy        = "security_referrer_policy"
+	SettingFrameOptions          = "security_frame_options"
+	SettingHSTSMaxAge            = "security_hsts_max_age"
+	SettingHSTSSubdomains        = "security_hsts_include_subdomains"
+	SettingCookieSessions        = "security_cookie_sessions"
+
+	// Cross-origin requests (CORS)
+	SettingCORSAllowedOrigins   = "cors_allowed_origins"
+	SettingCORSAllowedMethods   = "cors_allowed_methods"
+	SettingCORSAllowedHeaders   = "cors_allowed_headers"
+	SettingCORSAllowCredentials = "cors_allow_credentials"
+	SettingCORSMaxAge           = "cors_max_age"
+
+	// Host firewall
+	SettingFirewallAutoManage   = "firewall_auto_manage"
+	SettingFirewallZone         = "firewall_zone"
+	SettingFirewallManagedPorts = "firewall_managed_ports"
+
+	// UPS monitoring (NUT)
+	SettingUPSEnabled              = "ups_enabled"
+	SettingUPSHost                 = "ups_host"
+	SettingUPSPort                 = "ups_port"
+	SettingUPSName                 = "ups_name"
+	SettingUPSPollSeconds          = "ups_poll_seconds"
+	SettingUPSStopUploadsCharge    = "ups_stop_uploads_charge"
+	SettingUPSShutdownCharge       = "ups_shutdown_charge"
+	SettingUPSShutdownRuntime      = "ups_shutdown_runtime"
+	SettingUPSShutdownOnLowBattery = "ups_shutdown_on_low_battery"
+
+	// Syslog forwarding
+	SettingSyslogEnabled   = "syslog_enabled"
+	SettingSyslogProtocol  = "syslog_protocol"
+	SettingSyslogHost      = "syslog_host"
+	SettingSyslogPort      = "syslog_port"
+	SettingSyslogFacility  = "syslog_facility"
+	SettingSyslogAppName   = "syslog_app_name"
+	SettingSyslogAppLogs   = "syslog_app_logs"
+	SettingSyslogAuditLogs = "syslog_audit_logs"
+	SettingSyslogTLSCA     = "syslog_tls_ca"
+
+	// Self-updates
+	SettingUpdateChannel         = "update_channel"
+	SettingUpdatePreviousVersion = "update_previous_version"
+
+	// Upload limits
+	SettingMaxUploadSize = "max_upload_size"
+	SettingMaxChunkSize  = "max_upload_chunk_size"
+
+	// SFTP server
+	SettingSFTPEnabled = "sftp_enabled"
+	SettingSFTPPort    = "sftp_port"
+
+	// FTP server
+	SettingFTPEnabled        = "ftp_enabled"
+	SettingFTPPort           = "ftp_port"
+	SettingFTPPassivePortMin = "ftp_passive_port_min"
+	SettingFTPPassivePortMax = "ftp_passive_port_max"
+	SettingFTPRequireTLS     = "ftp_require_tls"
+	SettingFTPPublicHost     = "ftp_public_host"
+
+	// Outgoing email
+	SettingSMTPEnabled  = "smtp_enabled"
+	SettingSMTPHost     = "smtp_host"
+	SettingSMTPPort     = "smtp_port"
+	SettingSMTPUsername = "smtp_username"
+	SettingSMTPPassword = "smtp_password"
+	SettingSMTPFrom     = "smtp_from"
+	SettingSMTPSecurity = "smtp_security"
+	SettingPublicURL    = "public_url"
+
+	// Antivirus scanning
+	SettingAVEnabled       = "av_enabled"
+	SettingAVClamdAddress  = "av_clamd_address"
+	SettingAVQuarantineDir = "av_quarantine_dir"
+	SettingAVFailClosed    = "av_fail_closed"
+
+	// File integrity verification
+	SettingIntegrityLastRun = "integrity_last_run"
+
+	// Expiry cleanup
+	SettingCleanupInterval = "cleanup_interval_minutes"
+
+	// Event log
+	SettingEventLogRetention = "event_log_retention_days"
+
+	// Scheduled database backups
+	SettingDBBackupEnabled   = "db_backup_enabled"
+	SettingDBBackupPoolID    = "db_backup_pool_id"
+	SettingDBBackupPath      = "db_backup_path"
+	SettingDBBackupSchedule  = "db_backup_schedule"
+	SettingDBBackupRetention = "db_backup_retention"
+	SettingDBBackupLastRun   = "db_backup_last_run"
+	SettingDBBackupLastError = "db_backup_last_error"
+
+	// Storage alerts
+	SettingAlertSpaceWarning    = "alert_space_warning_percent"
+	SettingAlertSpaceCritical   = "alert_space_critical_percent"
+	SettingAlertNotifyMinLevel  = "alert_notify_min_level"
+	SettingAlertEmailRecipients = "alert_email_recipients"
+	SettingAlertWebhookURL      = "alert_webhook_url"
+
+	// Notifications
+	SettingNotifyLargeUploadMB = "notify_large_upload_mb"
+
+	// Office document previews
+	SettingOfficePreviewEnabled   = "office_preview_enabled"
+	SettingOfficePreviewGotenberg = "office_preview_gotenberg_url"
+	SettingOfficePreviewMaxSizeMB = "office_preview_max_size_mb"
+)
+
+// Defaults used when no file transfer protocol settings have been saved
+const (
+	DefaultSFTPPort          = 2222
+	DefaultFTPPort           = 21
+	DefaultFTPPassivePortMin = 50000
+	DefaultFTPPassivePortMax = 50100
 )
 
+// SFTPSettings configures the embedded SFTP server
+type SFTPSettings struct {
+	Enabled bool `json:"enabled"`
+	Port    int  `json:"port"`
+}
+
 // SetupRequest represents the initial setup wizard data
 type SetupRequest struct {
 	ServerName     string   `json:"server_name"`
@@ -45,3 +196,197 @@ type SetupStatus struct {
 	SetupComplete bool   `json:"setup_complete"`
 	ServerName    string `json:"server_name,omitempty"`
 }
+
+// FTPSettings configures the optional FTP/FTPS server
+type FTPSettings struct {
+	Enabled        bool   `json:"enabled"`
+	Port           int    `json:"port"`
+	PassivePortMin int    `json:"passive_port_min"`
+	PassivePortMax int    `json:"passive_port_max"`
+	RequireTLS     bool   `json:"require_tls"` // Refuse logins and transfers without AUTH TLS
+	PublicHost     string `json:"public_host"` // Address announced in PASV replies (e.g. behind NAT)
+}
+
+// SMTPSettings configures outgoing email for share links and notifications
+type SMTPSettings struct {
+	Enabled   bool   `json:"enabled"`
+	Host      string `json:"host"`
+	Port      int    `json:"port"`
+	Username  string `json:"username"`
+	Password  string `json:"password,omitempty"` // Never returned by the API
+	From      string `json:"from"`
+	Security  string `json:"security"`   // "starttls" | "tls" | "none"
+	PublicURL string `json:"public_url"` // Base URL used for links in emails
+}
+
+// AntivirusSettings configures scanning of uploads with clamd
+type AntivirusSettings struct {
+	Enabled       bool   `json:"enabled"`
+	ClamdAddress  string `json:"clamd_address"`  // "host:port", "tcp://host:port" or "unix:/path/to/clamd.sock"
+	QuarantineDir string `json:"quarantine_dir"` // Absolute directory for infected files
+	FailClosed    bool   `json:"fail_closed"`    // Reject uploads when clamd cannot be reached
+}
+
+// DefaultCleanupIntervalMinutes is how often expired data is cleaned up by default
+const DefaultCleanupIntervalMinutes = 60
+
+// CleanupStats reports what a cleanup run removed
+type CleanupStats struct {
+	StartedAt      time.Time `json:"started_at"`
+	Duration       string    `json:"duration"`
+	Sessions       int       `json:"sessions"`        // Expired login sessions
+	ShareLinks     int       `json:"share_links"`     // Expired share links moved to the deleted objects
+	UploadSessions int       `json:"upload_sessions"` // Abandoned chunked uploads
+	Previews       int       `json:"previews"`        // Cached previews and stream segments no longer used
+	PreviewBytes   int64     `json:"preview_bytes"`
+	Events         int       `json:"events"` // Logged events past their retention period
+	Errors         []string  `json:"errors,omitempty"`
+}
+
+// Defaults used when no database backup settings have been saved
+const (
+	DefaultDBBackupPath      = ".fileserv-backups"
+	DefaultDBBackupRetention = 7
+)
+
+// DatabaseBackupSettings configures scheduled backups of the SQLite database into a storage pool
+type DatabaseBackupSettings struct {
+	Enabled   bool   `json:"enabled"`
+	PoolID    string `json:"pool_id"`
+	Path      string `json:"path"`      // Directory relative to the pool root
+	Schedule  string `json:"schedule"`  // "hourly" | "daily" | "weekly" | "monthly"
+	Retention int    `json:"retention"` // Number of backups kept
+}
+
+// DatabaseBackup is a backup file in the backup directory
+type DatabaseBackup struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DefaultOfficePreviewMaxSizeMB is the largest document converted for previews by default
+const DefaultOfficePreviewMaxSizeMB = 50
+
+// OfficePreviewSettings configures rendering of office documents to PDF for previews
+type OfficePreviewSettings struct {
+	Enabled      bool   `json:"enabled"`
+	GotenbergURL string `json:"gotenberg_url"` // Empty converts with a local headless LibreOffice
+	MaxSizeMB    int    `json:"max_size_mb"`
+}
+
+// Captcha providers for share link password prompts
+const (
+	CaptchaProviderNone      = ""
+	CaptchaProviderHCaptcha  = "hcaptcha"
+	CaptchaProviderTurnstile = "turnstile"
+)
+
+// Defaults used when no share link protection settings have been saved
+const (
+	DefaultShareDelayAfter   = 3
+	DefaultShareMaxDelaySecs = 30
+	DefaultShareCaptchaAfter = 5
+)
+
+// ShareProtectionSettings configures brute-force protection of password-protected share links.
+// Failures are counted per share across all client IPs, on top of the per-IP lockouts.
+type ShareProtectionSettings struct {
+	DelayAfter      int    `json:"delay_after"`       // Failures before each attempt must wait, doubling from 1 second
+	MaxDelaySeconds int    `json:"max_delay_seconds"` // Longest wait between attempts
+	CaptchaProvider string `json:"captcha_provider"`  // "", "hcaptcha" or "turnstile"
+	CaptchaSiteKey  string `json:"captcha_site_key"`
+	CaptchaSecret   string `json:"captcha_secret,omitempty"` // Never returned by the API
+	CaptchaAfter    int    `json:"captcha_after"`            // Failures before a captcha is required
+}
+
+// CaptchaEnabled reports whether a captcha provider is configured
+func (s ShareProtectionSettings) CaptchaEnabled() bool {
+	return s.CaptchaProvider != CaptchaProviderNone && s.CaptchaSiteKey != "" && s.CaptchaSecret != ""
+}
+
+// GeoIPSettings locates the database used for share link country restrictions
+type GeoIPSettings struct {
+	DatabasePath string `json:"database_path"` // CSV of address ranges and ISO 3166 country codes, empty = disabled
+}
+
+// Defaults used when no password policy has been saved
+const (
+	DefaultPasswordMinLength  = 8
+	DefaultPasswordMinClasses = 4
+)
+
+// PasswordPolicy sets the rules for new passwords and how long they stay valid
+type PasswordPolicy struct {
+	MinLength  int `json:"min_length"`
+	MinClasses int `json:"min_classes"`  // Character classes required out of uppercase, lowercase, digits and special (0-4)
+	History    int `json:"history"`      // Previous passwords that cannot be reused, 0 = no check
+	MaxAgeDays int `json:"max_age_days"` // Days before a password must be changed, 0 = never
+}
+
+// DefaultContentSecurityPolicy is sent when no policy has been configured.
+// 'unsafe-inline' and 'unsafe-eval' are needed for Next.js scripts and styles.
+const DefaultContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' 'unsafe-eval'; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: blob:; " +
+	"font-src 'self' data:; " +
+	"connect-src 'self'; " +
+	"frame-ancestors 'none'; " +
+	"base-uri 'self'; " +
+	"form-action 'self'"
+
+// Defaults used when no security header settings have been saved
+const (
+	DefaultReferrerPolicy = "strict-origin-when-cross-origin"
+	DefaultFrameOptions   = "DENY"
+)
+
+// SecurityHeaderSettings configures the security headers of a deployment and whether browsers
+// also get the session token as a cookie
+type SecurityHeaderSettings struct {
+	ContentSecurityPolicy string `json:"content_security_policy"` // Empty = no CSP header
+	ReferrerPolicy        string `json:"referrer_policy"`
+	FrameOptions          string `json:"frame_options"` // DENY, SAMEORIGIN or empty for none
+	HSTSMaxAge            int    `json:"hsts_max_age"`  // Seconds, 0 = no HSTS; only sent over HTTPS
+	HSTSIncludeSubdomains bool   `json:"hsts_include_subdomains"`
+	CookieSessions        bool   `json:"cookie_sessions"` // HttpOnly session cookie, protected by CSRF tokens
+}
+
+// CORSSettings configures which other sites may call the API from a browser. Requests from the
+// web interface itself are same-origin and never need CORS.
+type CORSSettings struct {
+	AllowedOrigins   []string `json:"allowed_origins"` // scheme://host[:port], or * for any site
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"` // Send cookies; not allowed with *
+	MaxAge           int      `json:"max_age"`           // Seconds browsers may cache a preflight
+}
+
+// DefaultCORSSettings returns the CORS settings used until some are saved. Production allows no
+// other origins; development allows the frontend dev server, with cookies.
+func DefaultCORSSettings(development bool) CORSSettings {
+	settings := CORSSettings{
+		AllowedOrigins: []string{},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "LOCK", "UNLOCK"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-CSRF-Token"},
+		MaxAge:         3600,
+	}
+	if development {
+		settings.AllowedOrigins = []string{"http://localhost:3000", "http://127.0.0.1:3000"}
+		settings.AllowCredentials = true
+	}
+	return settings
+}
+
+// Defaults used when no upload limits have been saved
+const (
+	DefaultMaxUploadSize = 10 << 30 // 10 GB
+	DefaultMaxChunkSize  = 64 << 20 // 64 MB
+)
+
+// UploadLimits bounds request bodies of uploads. Zones and pools can set lower limits.
+type UploadLimits struct {
+	MaxUploadSize int64 `json:"max_upload_size"` // Bytes per file, 0 = unlimited
+	MaxChunkSize  int64 `json:"max_chunk_size"`  // Bytes per chunk of a chunked upload
+}
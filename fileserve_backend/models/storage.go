@@ -102,18 +102,34 @@ type PhysicalVolume struct {
 
 // LogicalVolume represents an LVM Logical Volume
 type LogicalVolume struct {
-	Name        string  `json:"name"`
-	Path        string  `json:"path"`
-	VGName      string  `json:"vg_name"`
-	Size        uint64  `json:"size"`
-	SizeHuman   string  `json:"size_human"`
-	Attributes  string  `json:"attributes"`
-	PoolLV      string  `json:"pool_lv,omitempty"`
-	DataPercent float64 `json:"data_percent,omitempty"`
-	MountPoint  string  `json:"mountpoint,omitempty"`
-	FSType      string  `json:"fstype,omitempty"`
-	Origin      string  `json:"origin,omitempty"` // For snapshots
-	SnapPercent float64 `json:"snap_percent,omitempty"`
+	Name            string  `json:"name"`
+	Path            string  `json:"path"`
+	VGName          string  `json:"vg_name"`
+	Size            uint64  `json:"size"`
+	SizeHuman       string  `json:"size_human"`
+	Attributes      string  `json:"attributes"`
+	PoolLV          string  `json:"pool_lv,omitempty"`
+	DataPercent     float64 `json:"data_percent,omitempty"`
+	MountPoint      string  `json:"mountpoint,omitempty"`
+	FSType          string  `json:"fstype,omitempty"`
+	Origin          string  `json:"origin,omitempty"` // For snapshots
+	SnapPercent     float64 `json:"snap_percent,omitempty"`
+	SegType         string  `json:"segtype,omitempty"`          // linear, thin-pool, thin, ...
+	MetadataPercent float64 `json:"metadata_percent,omitempty"` // For thin pools
+}
+
+// ThinPool represents an LVM thin pool and the thin volumes allocated from it
+type ThinPool struct {
+	Name             string          `json:"name"`
+	VGName           string          `json:"vg_name"`
+	Size             uint64          `json:"size"`
+	SizeHuman        string          `json:"size_human"`
+	DataPercent      float64         `json:"data_percent"`
+	MetadataPercent  float64         `json:"metadata_percent"`
+	VirtualSize      uint64          `json:"virtual_size"` // Sum of the thin volume sizes
+	VirtualSizeHuman string          `json:"virtual_size_human"`
+	Overcommit       float64         `json:"overcommit"` // Virtual size / pool size
+	Volumes          []LogicalVolume `json:"volumes"`
 }
 
 // RAIDArray represents a software RAID array (mdadm)
@@ -121,7 +137,7 @@ type RAIDArray struct {
 	Name        string       `json:"name"`
 	Path        string       `json:"path"`
 	Level       string       `json:"level"` // raid0, raid1, raid5, raid6, raid10
-	State       string       `json:"state"` // active, degraded, rebuilding
+	State       string       `json:"state"` // active, degraded, rebuilding, reshaping
 	Size        uint64       `json:"size"`
 	SizeHuman   string       `json:"size_human"`
 	Devices     int          `json:"devices"`
@@ -130,6 +146,7 @@ type RAIDArray struct {
 	FailedDevs  int          `json:"failed_devices"`
 	SyncPercent float64      `json:"sync_percent,omitempty"`
 	SyncSpeed   string       `json:"sync_speed,omitempty"`
+	Bitmap      string       `json:"bitmap,omitempty"` // Write-intent bitmap: internal, none or a file path
 	Members     []RAIDMember `json:"members"`
 	UUID        string       `json:"uuid"`
 	ChunkSize   string       `json:"chunk_size,omitempty"`
@@ -342,6 +359,38 @@ type IOStats struct {
 	WriteHuman   string  `json:"write_human"`
 }
 
+// IORates is the I/O rate of a device over an interval, computed from two diskstats samples
+type IORates struct {
+	Device           string    `json:"device"`
+	Time             time.Time `json:"time"` // End of the interval
+	ReadIOPS         float64   `json:"read_iops"`
+	WriteIOPS        float64   `json:"write_iops"`
+	ReadBytesPerSec  float64   `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64   `json:"write_bytes_per_sec"`
+	Utilization      float64   `json:"utilization"` // Percent of the interval the device was busy
+	AvgWaitMs        float64   `json:"avg_wait_ms"` // Average time per completed request
+	ReadHuman        string    `json:"read_human"`  // Read throughput, e.g. "12.5 MB/s"
+	WriteHuman       string    `json:"write_human"` // Write throughput
+}
+
+// IORateSeries is the I/O rate history of one device
+type IORateSeries struct {
+	Device string    `json:"device"`
+	Points []IORates `json:"points"`
+}
+
+// ProcessIO is the disk I/O rate of one process, as iotop shows it
+type ProcessIO struct {
+	PID              int     `json:"pid"`
+	Name             string  `json:"name"`
+	User             string  `json:"user"`
+	Command          string  `json:"command"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	ReadHuman        string  `json:"read_human"`
+	WriteHuman       string  `json:"write_human"`
+}
+
 // UserStorageUsage represents storage usage for a specific user
 type UserStorageUsage struct {
 	Username     string      `json:"username"`
@@ -386,6 +435,33 @@ type CreatePartitionRequest struct {
 	Label  string `json:"label,omitempty"`
 }
 
+// PartitionTable is the partition table of a disk as read by sfdisk
+type PartitionTable struct {
+	Disk       string                `json:"disk"`
+	Label      string                `json:"label"` // gpt, dos
+	ID         string                `json:"id"`    // Disk GUID or MBR identifier
+	SectorSize uint64                `json:"sector_size"`
+	FirstLBA   uint64                `json:"first_lba,omitempty"` // First usable sector (GPT)
+	LastLBA    uint64                `json:"last_lba"`            // Last usable sector
+	Partitions []PartitionTableEntry `json:"partitions"`
+}
+
+// PartitionTableEntry is a partition in a partition table. Positions are in sectors.
+type PartitionTableEntry struct {
+	Number    int    `json:"number"`
+	Device    string `json:"device"`
+	Start     uint64 `json:"start"`
+	End       uint64 `json:"end"`
+	MaxEnd    uint64 `json:"max_end"` // Furthest the end can move before the next partition
+	Size      uint64 `json:"size"`    // Bytes
+	SizeHuman string `json:"size_human"`
+	Type      string `json:"type"`                // Type GUID (GPT) or hex code (MBR)
+	TypeName  string `json:"type_name,omitempty"` // esp, linux, lvm, raid, swap, etc.
+	UUID      string `json:"uuid,omitempty"`
+	Name      string `json:"name,omitempty"` // GPT partition name
+	Bootable  bool   `json:"bootable,omitempty"`
+}
+
 // CreateVolumeGroupRequest represents a request to create an LVM volume group
 type CreateVolumeGroupRequest struct {
 	Name    string   `json:"name"`
@@ -402,6 +478,41 @@ type CreateLogicalVolumeRequest struct {
 	Snapshot string `json:"snapshot,omitempty"` // Source LV for snapshot
 }
 
+// PVMoveStatus represents a running pvmove: data being moved off a physical volume
+type PVMoveStatus struct {
+	VGName      string  `json:"vg_name"`
+	Name        string  `json:"name"` // The temporary pvmove volume, e.g. pvmove0
+	Source      string  `json:"source"`
+	Destination string  `json:"destination"`
+	Percent     float64 `json:"percent"`
+}
+
+// CreateThinPoolRequest represents a request to create an LVM thin pool
+type CreateThinPoolRequest struct {
+	Name         string `json:"name"`
+	VGName       string `json:"vg_name"`
+	Size         string `json:"size"`                    // e.g., "100G", "90%FREE"
+	MetadataSize string `json:"metadata_size,omitempty"` // Default picked by lvcreate
+	ChunkSize    string `json:"chunk_size,omitempty"`    // e.g., "64K"
+}
+
+// CreateThinVolumeRequest represents a request to create a thin logical volume
+type CreateThinVolumeRequest struct {
+	Name        string `json:"name"`
+	VGName      string `json:"vg_name"`
+	Pool        string `json:"pool"`
+	VirtualSize string `json:"virtual_size"` // May exceed the pool size
+	FSType      string `json:"fstype,omitempty"`
+}
+
+// CreateLVMSnapshotRequest represents a request to snapshot a logical volume
+type CreateLVMSnapshotRequest struct {
+	Name   string `json:"name"`
+	VGName string `json:"vg_name"`
+	Origin string `json:"origin"`
+	Size   string `json:"size,omitempty"` // Copy-on-write space; not used for thin snapshots
+}
+
 // CreateRAIDRequest represents a request to create a RAID array
 type CreateRAIDRequest struct {
 	Name    string   `json:"name"`    // e.g., "md0"
@@ -455,3 +566,31 @@ type ResizeRequest struct {
 	Size      string `json:"size"` // New size or +/- delta
 	ResizeFS  bool   `json:"resize_fs"`
 }
+
+// LUKSDevice represents a LUKS encrypted container and its mapper when unlocked
+type LUKSDevice struct {
+	Device     string `json:"device"`
+	UUID       string `json:"uuid"`
+	Size       uint64 `json:"size"`
+	SizeHuman  string `json:"size_human"`
+	Open       bool   `json:"open"`
+	MapperName string `json:"mapper_name,omitempty"` // Set while unlocked, or from crypttab
+	MapperPath string `json:"mapper_path,omitempty"`
+	FSType     string `json:"fstype,omitempty"`  // Filesystem inside the unlocked container
+	FSUUID     string `json:"fs_uuid,omitempty"` // UUID of that filesystem
+	MountPoint string `json:"mountpoint,omitempty"`
+	AutoUnlock bool   `json:"auto_unlock"` // Unlocked at boot from crypttab with a stored keyfile
+	KeyFile    string `json:"key_file,omitempty"`
+}
+
+// RAIDSpare is an unused device in the global hot-spare pool. It joins whichever array
+// degrades first.
+type RAIDSpare struct {
+	ID        string    `json:"id"`
+	Device    string    `json:"device"`
+	Size      uint64    `json:"size"`
+	SizeHuman string    `json:"size_human"`
+	CreatedAt time.Time `json:"created_at"`
+	Available bool      `json:"available"`         // The device is present and still unused
+	Problem   string    `json:"problem,omitempty"` // Why the device cannot be used right now
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// SyslogSettings configures forwarding of application and audit logs to a remote syslog server
+type SyslogSettings struct {
+	Enabled   bool   `json:"enabled"`
+	Protocol  string `json:"protocol"` // udp, tcp or tls
+	Host      string `json:"host"`
+	Port      int    `json:"port"`     // 0 for the default of the protocol: 514, or 6514 for tls
+	Facility  string `json:"facility"` // Such as daemon or local0
+	AppName   string `json:"app_name"`
+	AppLogs   bool   `json:"app_logs"`   // Forward the server log
+	AuditLogs bool   `json:"audit_logs"` // Forward the events written to the event log
+	TLSCA     string `json:"tls_ca"`     // PEM certificates trusted for tls, instead of the system roots
+}
+
+// DefaultSyslogSettings returns the settings used until forwarding is configured
+func DefaultSyslogSettings() SyslogSettings {
+	return SyslogSettings{
+		Protocol:  "udp",
+		Facility:  "daemon",
+		AppName:   "fileserv",
+		AppLogs:   true,
+		AuditLogs: true,
+	}
+}
+
+// SyslogStatus reports how forwarding is doing
+type SyslogStatus struct {
+	Enabled     bool       `json:"enabled"`
+	Connected   bool       `json:"connected"` // The last message was sent
+	Sent        uint64     `json:"sent"`
+	Dropped     uint64     `json:"dropped"` // Messages lost because the queue was full
+	Queued      int        `json:"queued"`
+	LastSent    *time.Time `json:"last_sent,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
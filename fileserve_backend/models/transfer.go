@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Transfer accounting object types
+const (
+	TransferObjectUser      = "user"
+	TransferObjectZone      = "zone"
+	TransferObjectShareLink = "share_link"
+)
+
+// TransferCap limits the bytes a user, zone or share link may transfer, uploads and downloads
+// together, in a calendar month
+type TransferCap struct {
+	ObjectType   string    `json:"object_type"` // user, zone or share_link
+	ObjectID     string    `json:"object_id"`
+	MonthlyBytes int64     `json:"monthly_bytes"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TransferUsage is what a user, zone or share link transferred in a month
+type TransferUsage struct {
+	ObjectType      string `json:"object_type"`
+	ObjectID        string `json:"object_id"`
+	Name            string `json:"name,omitempty"`
+	Month           string `json:"month"` // YYYY-MM
+	BytesUploaded   int64  `json:"bytes_uploaded"`
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+	CapBytes        int64  `json:"cap_bytes,omitempty"` // Monthly cap, 0 = none
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// TrashDirName is the hidden directory at each zone root that holds deleted items
+const TrashDirName = ".trash"
+
+// DefaultTrashRetentionDays is used when no retention setting has been saved
+const DefaultTrashRetentionDays = 30
+
+// TrashItem represents a file or folder moved into a zone's trash
+type TrashItem struct {
+	ID            string    `json:"id"`
+	ZoneID        string    `json:"zone_id"`
+	OriginalPath  string    `json:"original_path"` // Path relative to the zone root before deletion
+	Name          string    `json:"name"`
+	IsDir         bool      `json:"is_dir"`
+	Size          int64     `json:"size"`            // Total size (recursive for folders)
+	DeletedBy     string    `json:"deleted_by"`      // User ID
+	DeletedByName string    `json:"deleted_by_name"` // Username
+	DeletedAt     time.Time `json:"deleted_at"`
+}
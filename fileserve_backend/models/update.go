@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Release channels
+const (
+	UpdateChannelStable = "stable"
+	UpdateChannelBeta   = "beta" // Pre-releases, ahead of stable
+)
+
+// UpdateRelease is the release published in the manifest of a channel
+type UpdateRelease struct {
+	Version    string                  `json:"version"`
+	ReleasedAt *time.Time              `json:"released_at,omitempty"`
+	Notes      string                  `json:"notes,omitempty"`
+	Binaries   map[string]UpdateBinary `json:"binaries"` // By platform, such as linux/amd64
+}
+
+// UpdateBinary is the binary of a release for one platform
+type UpdateBinary struct {
+	URL       string `json:"url"` // Absolute, or relative to the manifest
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"` // Base64 Ed25519 signature of "fileserv <version> <platform> <sha256>"
+}
+
+// UpdateStatus describes the running version and the release available on its channel
+type UpdateStatus struct {
+	CurrentVersion  string         `json:"current_version"`
+	BuildDate       string         `json:"build_date,omitempty"`
+	Platform        string         `json:"platform"`
+	Channel         string         `json:"channel"`
+	Configured      bool           `json:"configured"` // UPDATE_URL and UPDATE_PUBLIC_KEY are set
+	Latest          *UpdateRelease `json:"latest,omitempty"`
+	Available       bool           `json:"available"` // The channel has another version for this platform
+	LastCheck       *time.Time     `json:"last_check,omitempty"`
+	LastError       string         `json:"last_error,omitempty"`
+	PreviousVersion string         `json:"previous_version,omitempty"` // Version a rollback returns to
+	InProgress      bool           `json:"in_progress"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// UploadSession is the persisted state of a chunked upload. The chunk data lives in TempDir;
+// this record lets the upload manager resume the session after a restart.
+type UploadSession struct {
+	ID             string    `json:"id"`
+	Filename       string    `json:"filename"`
+	TotalSize      int64     `json:"total_size"`
+	ChunkSize      int64     `json:"chunk_size"`
+	TotalChunks    int       `json:"total_chunks"`
+	ReceivedChunks []byte    `json:"-"`                 // Bitmap, bit i is set once chunk i is stored
+	ZoneID         string    `json:"zone_id,omitempty"` // Zone the upload targets, empty for legacy paths
+	TargetPath     string    `json:"target_path"`       // Absolute directory the file is assembled into
+	TempDir        string    `json:"temp_dir"`
+	OwnerID        string    `json:"owner_id"`
+	OwnerUsername  string    `json:"owner_username"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// HasChunk reports whether chunk i was received
+func (s *UploadSession) HasChunk(i int) bool {
+	return i >= 0 && i/8 < len(s.ReceivedChunks) && s.ReceivedChunks[i/8]&(1<<(i%8)) != 0
+}
+
+// SetChunk marks chunk i as received
+func (s *UploadSession) SetChunk(i int) {
+	if i < 0 {
+		return
+	}
+	for len(s.ReceivedChunks) <= i/8 {
+		s.ReceivedChunks = append(s.ReceivedChunks, 0)
+	}
+	s.ReceivedChunks[i/8] |= 1 << (i % 8)
+}
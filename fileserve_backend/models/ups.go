@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// UPS power events published to admins and routed to notification channels
+const (
+	UPSEventOnBattery      = "on_battery"      // Utility power failed
+	UPSEventOnLine         = "on_line"         // Utility power restored
+	UPSEventLowBattery     = "low_battery"     // The UPS reports a low battery
+	UPSEventUploadsStopped = "uploads_stopped" // Uploads refused below the battery threshold
+	UPSEventUploadsResumed = "uploads_resumed"
+	UPSEventShutdown       = "shutdown"      // Clean shutdown started below the battery threshold
+	UPSEventCommLost       = "comm_lost"     // upsd or the UPS stopped answering
+	UPSEventCommRestored   = "comm_restored" // upsd answers again
+)
+
+// UPSSettings configures the UPS monitored through a NUT server and the actions taken on
+// battery power. Thresholds of 0 disable the action.
+type UPSSettings struct {
+	Enabled              bool   `json:"enabled"`
+	Host                 string `json:"host"` // upsd host
+	Port                 int    `json:"port"`
+	Name                 string `json:"name"`                    // UPS name in upsd
+	PollSeconds          int    `json:"poll_seconds"`            // How often the UPS is read
+	StopUploadsCharge    int    `json:"stop_uploads_charge"`     // Battery percent at which uploads are refused
+	ShutdownCharge       int    `json:"shutdown_charge"`         // Battery percent at which the system powers off
+	ShutdownRuntime      int    `json:"shutdown_runtime"`        // Seconds of runtime left at which the system powers off
+	ShutdownOnLowBattery bool   `json:"shutdown_on_low_battery"` // Power off when the UPS reports a low battery
+}
+
+// DefaultUPSSettings returns the settings used until the UPS is configured
+func DefaultUPSSettings() UPSSettings {
+	return UPSSettings{
+		Host:                 "localhost",
+		Port:                 3493,
+		Name:                 "ups",
+		PollSeconds:          10,
+		StopUploadsCharge:    50,
+		ShutdownCharge:       20,
+		ShutdownOnLowBattery: true,
+	}
+}
+
+// UPSStatus is the last reading of the UPS and the actions in effect
+type UPSStatus struct {
+	Enabled         bool              `json:"enabled"`
+	Connected       bool              `json:"connected"`
+	Error           string            `json:"error,omitempty"`
+	Model           string            `json:"model,omitempty"`
+	Status          string            `json:"status,omitempty"` // ups.status flags, such as "OL CHRG" or "OB LB"
+	OnBattery       bool              `json:"on_battery"`
+	LowBattery      bool              `json:"low_battery"`
+	BatteryCharge   *float64          `json:"battery_charge,omitempty"`  // Percent
+	BatteryRuntime  *int              `json:"battery_runtime,omitempty"` // Seconds
+	Load            *float64          `json:"load,omitempty"`            // Percent of capacity
+	InputVoltage    *float64          `json:"input_voltage,omitempty"`
+	UploadsStopped  bool              `json:"uploads_stopped"`
+	ShutdownStarted bool              `json:"shutdown_started"`
+	Variables       map[string]string `json:"variables,omitempty"`
+	LastPoll        *time.Time        `json:"last_poll,omitempty"`
+}
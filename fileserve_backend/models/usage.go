@@ -0,0 +1,104 @@
+package models
+
+import "time"
+
+// DirUsage is the space used by the entries directly inside one directory of a zone.
+// Recursive totals are the sum over a directory and all directories beneath it.
+type DirUsage struct {
+	ZoneID    string    `json:"zone_id"`
+	Path      string    `json:"path"` // Path relative to the zone root ("/" for the root)
+	Size      int64     `json:"size"`
+	FileCount int64     `json:"file_count"`
+	DirCount  int64     `json:"dir_count"`
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+// UsageTotals is the recursive usage of a directory
+type UsageTotals struct {
+	Size      int64     `json:"size"`
+	FileCount int64     `json:"file_count"`
+	DirCount  int64     `json:"dir_count"`
+	ScannedAt time.Time `json:"scanned_at"` // Oldest scan among the directories included
+}
+
+// ZoneUserUsage is the space a user is charged for in a zone
+type ZoneUserUsage struct {
+	ZoneID    string    `json:"zone_id"`
+	Username  string    `json:"username"`
+	UsedBytes int64     `json:"used_bytes"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UsageScanStatus reports the state of the scheduled usage scans
+type UsageScanStatus struct {
+	Running  bool       `json:"running"`
+	LastScan *time.Time `json:"last_scan,omitempty"`
+}
+
+// UsageReport is the latest usage of every user and zone with its growth over a period
+type UsageReport struct {
+	Status UsageScanStatus `json:"status"`
+	Usage  []*UsageTrend   `json:"usage"`
+}
+
+// UsageSample is a user's usage in a zone as recorded by a scheduled usage scan.
+// Samples with an empty username hold the total of the whole zone.
+type UsageSample struct {
+	ZoneID     string    `json:"zone_id"`
+	Username   string    `json:"username,omitempty"`
+	UsedBytes  int64     `json:"used_bytes"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// UsageTrend is how much a user's (or a whole zone's) usage changed over a period
+type UsageTrend struct {
+	ZoneID        string    `json:"zone_id"`
+	ZoneName      string    `json:"zone_name"`
+	Username      string    `json:"username,omitempty"`
+	Days          int       `json:"days"`
+	CurrentBytes  int64     `json:"current_bytes"`
+	PreviousBytes int64     `json:"previous_bytes"`
+	GrowthBytes   int64     `json:"growth_bytes"`
+	GrowthPercent float64   `json:"growth_percent"` // 0 when the previous usage was 0
+	Since         time.Time `json:"since"`          // When the previous usage was recorded
+	RecordedAt    time.Time `json:"recorded_at"`    // When the current usage was recorded
+}
+
+// ZoneQuotaInfo reports a user's quota and usage in a zone
+type ZoneQuotaInfo struct {
+	ZoneID    string `json:"zone_id"`
+	Username  string `json:"username"`
+	Quota     int64  `json:"quota"` // Bytes (0 = unlimited)
+	UsedBytes int64  `json:"used_bytes"`
+	Available int64  `json:"available"` // Bytes left (-1 = unlimited)
+	Enforced  bool   `json:"enforced"`  // False on pools where quotas are not enforced
+
+	Filesystem *ZoneFilesystemQuota `json:"filesystem,omitempty"` // Limit enforced by the filesystem itself
+}
+
+// ZoneFilesystemQuota is the filesystem-level limit backing a user's zone quota: a ZFS
+// userquota on the zone's dataset, or a user quota on an ext4/XFS filesystem
+type ZoneFilesystemQuota struct {
+	Method     string `json:"method,omitempty"`     // zfs_userquota or user_quota
+	Filesystem string `json:"filesystem,omitempty"` // Dataset or mount point
+	Limit      int64  `json:"limit"`                // Bytes (0 = none set)
+	UsedBytes  int64  `json:"used_bytes"`           // As counted by the filesystem
+	Applied    bool   `json:"applied"`              // Limit matches the zone quota
+	Error      string `json:"error,omitempty"`      // Why no limit could be read or set
+}
+
+// Zone project quota methods
+const (
+	ProjectQuotaZFS = "zfs_refquota" // refquota on the zone's own dataset
+	ProjectQuotaXFS = "xfs_project"  // XFS project quota on the zone's directory tree
+)
+
+// ZoneProjectQuota caps the total size of a zone, no matter which user writes to it
+type ZoneProjectQuota struct {
+	ZoneID    string    `json:"zone_id"`
+	Limit     int64     `json:"limit"`  // Bytes
+	Method    string    `json:"method"` // zfs_refquota or xfs_project
+	Target    string    `json:"target"` // ZFS dataset or XFS mount point
+	ProjectID int       `json:"project_id,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
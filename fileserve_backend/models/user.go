@@ -16,6 +16,25 @@ type User struct {
 	MustChangePassword bool     `json:"must_change_password"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
+
+	// Guest accounts: external collaborators limited to some zones until they expire
+	IsGuest    bool       `json:"is_guest"`
+	GuestZones []string   `json:"guest_zones,omitempty"` // IDs of the zones the guest can use
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	InvitedBy  string     `json:"invited_by,omitempty"` // Username of the admin or zone owner who created the guest
+}
+
+// PasswordHistoryEntry is a password a user has set, kept to prevent reuse and to date the
+// current password. Entries are keyed by username so they also cover system (PAM) users.
+type PasswordHistoryEntry struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	ChangedAt    time.Time `json:"changed_at"`
+}
+
+// IsExpired checks if a guest account has passed its expiry time
+func (u *User) IsExpired() bool {
+	return u.IsGuest && u.ExpiresAt != nil && time.Now().After(*u.ExpiresAt)
 }
 
 func (u *User) SetPassword(password string) error {
@@ -42,6 +61,10 @@ type SafeUser struct {
 	MustChangePassword bool     `json:"must_change_password"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
+	IsGuest           bool       `json:"is_guest"`
+	GuestZones        []string   `json:"guest_zones,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	InvitedBy         string     `json:"invited_by,omitempty"`
 }
 
 func (u *User) Safe() SafeUser {
@@ -54,5 +77,9 @@ func (u *User) Safe() SafeUser {
 		MustChangePassword: u.MustChangePassword,
 		CreatedAt:         u.CreatedAt,
 		UpdatedAt:         u.UpdatedAt,
+		IsGuest:           u.IsGuest,
+		GuestZones:        u.GuestZones,
+		ExpiresAt:         u.ExpiresAt,
+		InvitedBy:         u.InvitedBy,
 	}
 }
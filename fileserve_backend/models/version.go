@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// VersionsDirName is the hidden directory at each zone root that holds previous file versions
+const VersionsDirName = ".versions"
+
+// Defaults used when a zone has no versioning configuration saved
+const (
+	DefaultMaxVersions       = 10
+	DefaultMaxVersionStorage = 10 * 1024 * 1024 * 1024 // 10GB per zone
+)
+
+// FileVersion is a previous copy of a file that was overwritten
+type FileVersion struct {
+	ID            string    `json:"id"`
+	ZoneID        string    `json:"zone_id"`
+	Path          string    `json:"path"` // Path relative to the zone root
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"mod_time"`        // Modification time of the replaced content
+	CreatedBy     string    `json:"created_by"`      // User ID whose write replaced this version
+	CreatedByName string    `json:"created_by_name"` // Username
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ZoneVersioning holds the file versioning configuration for a zone
+type ZoneVersioning struct {
+	ZoneID      string    `json:"zone_id"`
+	Enabled     bool      `json:"enabled"`
+	MaxVersions int       `json:"max_versions"` // Per file (0 = unlimited)
+	MaxStorage  int64     `json:"max_storage"`  // Total bytes of versions per zone (0 = unlimited)
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DefaultZoneVersioning returns the configuration used for zones without saved settings
+func DefaultZoneVersioning(zoneID string) *ZoneVersioning {
+	return &ZoneVersioning{
+		ZoneID:      zoneID,
+		Enabled:     true,
+		MaxVersions: DefaultMaxVersions,
+		MaxStorage:  DefaultMaxVersionStorage,
+	}
+}
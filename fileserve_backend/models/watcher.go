@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// File change operations reported by the zone watcher
+const (
+	FileChangeCreated  = "created"
+	FileChangeModified = "modified"
+	FileChangeDeleted  = "deleted"
+)
+
+// FileChange is a file or folder that changed on disk
+type FileChange struct {
+	Path string `json:"path"` // Path relative to the zone root, or to the user folder in personal zones
+	Op   string `json:"op"`   // created, modified or deleted
+}
+
+// WatcherStatus reports the state of the zone file watcher
+type WatcherStatus struct {
+	Running      bool       `json:"running"`
+	Error        string     `json:"error,omitempty"` // Why the watcher could not start
+	Zones        int        `json:"zones"`           // Zones being watched
+	Watches      int        `json:"watches"`         // Directories being watched
+	LimitReached bool       `json:"limit_reached"`   // fs.inotify.max_user_watches was hit; some folders are not watched
+	Overflows    int        `json:"overflows"`       // Times the kernel dropped events and a full rescan was queued
+	Changes      int64      `json:"changes"`         // Changes processed since start
+	LastChange   *time.Time `json:"last_change,omitempty"`
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fileserv/config"
+	"fileserv/internal/apierror"
+	"fileserv/middleware"
+)
+
+// newServer creates the HTTP server of a listener
+func newServer(l config.Listener, handler http.Handler, cfg *config.Config) *http.Server {
+	if l.Kind == config.ListenRedirect {
+		handler = httpsRedirect(cfg.HTTPSListener())
+	} else {
+		handler = middleware.ExternalURL(cfg.ExternalURL)(handler)
+		if l.TrustProxy || len(cfg.TrustedProxies) > 0 {
+			handler = middleware.TrustProxy(cfg.TrustedProxies, l.TrustProxy)(handler)
+		}
+	}
+
+	return &http.Server{
+		Addr:         l.Address,
+		Handler:      handler,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+}
+
+// serve accepts connections on a listener until its server is shut down
+func serve(srv *http.Server, l config.Listener, cfg *config.Config) error {
+	network := "tcp"
+	if l.Kind == config.ListenUnix {
+		network = "unix"
+		// A socket left behind by an unclean shutdown would make the listen fail
+		if err := os.MkdirAll(filepath.Dir(l.Address), 0755); err != nil {
+			return err
+		}
+		if err := os.Remove(l.Address); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	ln, err := net.Listen(network, l.Address)
+	if err != nil {
+		return err
+	}
+	if l.Kind == config.ListenUnix {
+		if err := os.Chmod(l.Address, l.SocketMode); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+
+	log.Printf("Listening on %s", l)
+	if l.Kind == config.ListenHTTPS {
+		return srv.ServeTLS(ln, cfg.TLSCert, cfg.TLSKey)
+	}
+	return srv.Serve(ln)
+}
+
+// httpsRedirect permanently redirects requests to the same address on the HTTPS listener
+func httpsRedirect(target *config.Listener) http.Handler {
+	_, port, _ := net.SplitHostPort(target.Address)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		if host == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Use HTTPS", nil)
+			return
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		// Only safe methods are redirected with 301; others keep their method and body with 308
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, fmt.Sprintf("https://%s%s", host, r.URL.RequestURI()), status)
+	})
+}
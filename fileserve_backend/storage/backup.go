@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// restoreSuffix names the database file staged by StageDatabaseRestore, which replaces the
+// database the next time the store is opened
+const restoreSuffix = ".restore"
+
+// BackupDatabase writes a consistent copy of the database to dest while the store stays in use
+func (s *SQLiteStore) BackupDatabase(dest string) error {
+	if s.path == "" {
+		return errors.New("database backups require SQLite storage")
+	}
+	// VACUUM INTO refuses to overwrite, so a leftover file from a failed backup is replaced
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := s.db.Exec("VACUUM INTO ?", dest); err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// StageDatabaseRestore checks that src is a FileServ database and copies it next to the current
+// database, which it replaces when the server is restarted
+func (s *SQLiteStore) StageDatabaseRestore(src string) error {
+	if s.path == "" {
+		return errors.New("database restores require SQLite storage")
+	}
+	if err := validateBackup(src); err != nil {
+		return err
+	}
+
+	staged := s.path + restoreSuffix
+	tmp := staged + ".tmp"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to stage restore: %w", err)
+	}
+	if err := os.Rename(tmp, staged); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to stage restore: %w", err)
+	}
+	return nil
+}
+
+// CancelDatabaseRestore discards a staged restore
+func (s *SQLiteStore) CancelDatabaseRestore() error {
+	if s.path == "" {
+		return errors.New("database restores require SQLite storage")
+	}
+	if err := os.Remove(s.path + restoreSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// DatabaseRestorePending reports whether a restore is staged for the next start
+func (s *SQLiteStore) DatabaseRestorePending() bool {
+	if s.path == "" {
+		return false
+	}
+	_, err := os.Stat(s.path + restoreSuffix)
+	return err == nil
+}
+
+// validateBackup opens a database file read-only and checks that it is intact and was written
+// by a FileServ version this build can migrate
+func validateBackup(file string) error {
+	db, err := sql.Open("sqlite", "file:"+file+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("not a valid database: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("backup is corrupt: %s", result)
+	}
+
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		return errors.New("not a FileServ database")
+	}
+	var users int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users); err != nil {
+		return errors.New("not a FileServ database")
+	}
+
+	migrations, err := loadMigrations(dialectSQLite)
+	if err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].version; version > latest {
+		return fmt.Errorf("backup has schema version %d, newer than this server supports (%d)", version, latest)
+	}
+	return nil
+}
+
+// applyStagedRestore moves a staged restore into place before the database is opened. The
+// replaced database is kept beside it with a .pre-restore suffix.
+func applyStagedRestore(dbPath string) error {
+	staged := dbPath + restoreSuffix
+	if _, err := os.Stat(staged); os.IsNotExist(err) {
+		return nil
+	}
+
+	previous := fmt.Sprintf("%s.pre-restore-%s", dbPath, time.Now().Format("20060102-150405"))
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(dbPath+suffix, previous+suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(staged, dbPath); err != nil {
+		return err
+	}
+	log.Printf("Restored database from staged backup, previous database saved as %s", previous)
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// dialect is the SQL flavour of the database behind the store. Queries are written for
+// SQLite and rewritten for other databases when they are run.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// rewrite adapts a query and its arguments to the dialect
+func (d dialect) rewrite(query string, args []interface{}) (string, []interface{}) {
+	if d != dialectPostgres {
+		return query, args
+	}
+
+	// Numbered placeholders instead of ?, leaving string literals alone
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	query = b.String()
+
+	// Flags are stored as integers, which Postgres does not convert from booleans
+	for i, arg := range args {
+		if v, ok := arg.(bool); ok {
+			args[i] = boolToInt(v)
+		}
+	}
+	return query, args
+}
+
+// sqlDB is the database handle of the store, rewriting queries for its dialect. Queries run
+// under ctx, so cancelling it aborts them, and those slower than slowQuery are logged. A handle
+// bound to a transaction runs all its queries in tx.
+type sqlDB struct {
+	*sql.DB
+	dialect    dialect
+	ctx        context.Context
+	slowQuery  time.Duration
+	tx         *sql.Tx
+	savepoints *int // Savepoints started in tx, for naming nested transactions
+}
+
+// conn is what queries run on: the database or a transaction
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// isUniqueViolation reports whether a statement failed on a unique constraint, in either dialect
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// DefaultSlowQueryThreshold is how long a query may take before it is logged
+const DefaultSlowQueryThreshold = 500 * time.Millisecond
+
+func newSQLDB(db *sql.DB, d dialect) *sqlDB {
+	return &sqlDB{DB: db, dialect: d, ctx: context.Background(), slowQuery: DefaultSlowQueryThreshold}
+}
+
+// withContext returns a handle on the same database running queries under ctx
+func (db *sqlDB) withContext(ctx context.Context) *sqlDB {
+	bound := *db
+	bound.ctx = ctx
+	return &bound
+}
+
+// conn returns the transaction of the handle, or the database when it has none
+func (db *sqlDB) conn() conn {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.DB
+}
+
+// logSlow logs a query that took longer than the slow query threshold. For queries returning
+// rows this is the time to the first row.
+func (db *sqlDB) logSlow(query string, started time.Time) {
+	if db.slowQuery <= 0 {
+		return
+	}
+	if elapsed := time.Since(started); elapsed >= db.slowQuery {
+		log.Printf("Slow query (%s): %s", elapsed.Round(time.Millisecond), strings.Join(strings.Fields(query), " "))
+	}
+}
+
+func (db *sqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	query, args = db.dialect.rewrite(query, args)
+	defer db.logSlow(query, time.Now())
+	return db.conn().ExecContext(db.ctx, query, args...)
+}
+
+func (db *sqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	query, args = db.dialect.rewrite(query, args)
+	defer db.logSlow(query, time.Now())
+	return db.conn().QueryContext(db.ctx, query, args...)
+}
+
+func (db *sqlDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	query, args = db.dialect.rewrite(query, args)
+	defer db.logSlow(query, time.Now())
+	return db.conn().QueryRowContext(db.ctx, query, args...)
+}
+
+// Begin starts a transaction. On a handle already in a transaction it starts a savepoint
+// instead, so the nested transaction can be rolled back on its own.
+func (db *sqlDB) Begin() (*sqlTx, error) {
+	if db.tx != nil {
+		*db.savepoints++
+		savepoint := "sp" + strconv.Itoa(*db.savepoints)
+		if _, err := db.Exec("SAVEPOINT " + savepoint); err != nil {
+			return nil, err
+		}
+		return &sqlTx{Tx: db.tx, db: db, savepoint: savepoint}, nil
+	}
+
+	tx, err := db.DB.BeginTx(db.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	bound := *db
+	bound.tx = tx
+	bound.savepoints = new(int)
+	return &sqlTx{Tx: tx, db: &bound}, nil
+}
+
+// sqlTx is a transaction of the store, rewriting queries for its dialect. It runs under the
+// context of the handle it was started from; db is that handle bound to the transaction.
+type sqlTx struct {
+	*sql.Tx
+	db        *sqlDB
+	savepoint string // Set on a nested transaction
+	done      bool
+}
+
+// Commit commits the transaction, or releases the savepoint of a nested one
+func (tx *sqlTx) Commit() error {
+	if tx.savepoint == "" {
+		return tx.Tx.Commit()
+	}
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	_, err := tx.db.Exec("RELEASE SAVEPOINT " + tx.savepoint)
+	return err
+}
+
+// Rollback rolls back the transaction, or what was done since the savepoint of a nested one
+func (tx *sqlTx) Rollback() error {
+	if tx.savepoint == "" {
+		return tx.Tx.Rollback()
+	}
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	if _, err := tx.db.Exec("ROLLBACK TO SAVEPOINT " + tx.savepoint); err != nil {
+		return err
+	}
+	_, err := tx.db.Exec("RELEASE SAVEPOINT " + tx.savepoint)
+	return err
+}
+
+func (tx *sqlTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	query, args = tx.db.dialect.rewrite(query, args)
+	defer tx.db.logSlow(query, time.Now())
+	return tx.Tx.ExecContext(tx.db.ctx, query, args...)
+}
+
+func (tx *sqlTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	query, args = tx.db.dialect.rewrite(query, args)
+	defer tx.db.logSlow(query, time.Now())
+	return tx.Tx.QueryRowContext(tx.db.ctx, query, args...)
+}
+
+// Prepare rewrites the query; arguments of the statement are passed to the driver as they are
+func (tx *sqlTx) Prepare(query string) (*sql.Stmt, error) {
+	query, _ = tx.db.dialect.rewrite(query, nil)
+	return tx.Tx.PrepareContext(tx.db.ctx, query)
+}
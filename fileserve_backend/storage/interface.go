@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"time"
 
 	"fileserv/models"
@@ -8,19 +9,65 @@ import (
 
 // DataStore defines the interface for all storage operations
 type DataStore interface {
+	// WithContext returns the store running its queries under ctx, so cancelling ctx aborts
+	// them. Only calls made through the returned store are bound: the zone scanners and the
+	// listings that can run long (search, gallery, home, checksums, event and security logs).
+	// Every other call runs under the background context and is not cancelled with its request.
+	WithContext(ctx context.Context) DataStore
+
+	// WithTx runs fn in a transaction, committed when fn returns nil and rolled back when it
+	// returns an error. Operations of the store passed to fn are part of the transaction.
+	WithTx(fn func(tx DataStore) error) error
+
 	// User operations
 	GetUserByUsername(username string) (*models.User, error)
 	GetUserByID(id string) (*models.User, error)
 	CreateUser(username, password, email string, isAdmin bool, groups []string) (*models.User, error)
+	CreateGuestUser(username, password, email, invitedBy string, zones []string, expiresAt time.Time) (*models.User, error)
 	UpdateUser(id string, updates map[string]interface{}) (*models.User, error)
 	DeleteUser(id string) error
 	ListUsers() []*models.User
 
 	// Session operations
-	CreateSession(userID string, token string, expiresAt time.Time) error
-	GetSession(token string) (*models.Session, error)
-	DeleteSession(token string) error
-	CleanExpiredSessions() error
+	CreateSession(session *models.Session) error
+	GetSession(id string) (*models.Session, error)
+	ListSessionsByUser(userID string) []*models.Session
+	RenewSession(id, token string, expiresAt time.Time) error
+	TouchSession(id, ip string, lastSeen time.Time) error
+	RevokeSession(session *models.Session) error
+	ListRevokedSessions() map[string]time.Time
+	DeleteSession(id string) error
+	CleanExpiredSessions() (int, error)
+
+	// Lockout operations
+	GetLockout(key string) (*models.Lockout, error)
+	SaveLockout(l *models.Lockout) error
+	DeleteLockout(key string) error
+	ListLockouts() []*models.Lockout
+	ClearLockouts() error
+	CleanStaleLockouts(before time.Time) error
+
+	// Password history operations (newest first, keyed by username)
+	AddPasswordHistory(entry *models.PasswordHistoryEntry, keep int) error
+	ListPasswordHistory(username string) []*models.PasswordHistoryEntry
+
+	// Security event operations
+	AddSecurityEvent(event *models.SecurityEvent) error
+	ListSecurityEvents(filter models.SecurityEventFilter) ([]*models.SecurityEvent, int)
+	DeleteSecurityEventsBefore(before time.Time) error
+
+	// Event log operations
+	AddEventLogEntry(entry *models.EventLogEntry) error
+	ListEventLog(filter models.EventLogFilter) ([]*models.EventLogEntry, int)
+	DeleteEventLogBefore(before time.Time) (int, error)
+
+	// Passkey operations (WebAuthn credentials)
+	CreatePasskey(passkey *models.Passkey) error
+	GetPasskey(id string) (*models.Passkey, error)
+	GetPasskeyByCredentialID(credentialID string) (*models.Passkey, error)
+	ListPasskeysByUser(userID string) []*models.Passkey
+	UpdatePasskeyUsage(id string, signCount uint32, lastUsed time.Time) error
+	DeletePasskey(id string) error
 
 	// Permission operations
 	CreatePermission(path string, permType models.PermissionType, username, group string) (*models.Permission, error)
@@ -51,6 +98,8 @@ type DataStore interface {
 	GetShareZone(id string) (*models.ShareZone, error)
 	GetShareZoneByName(name string) (*models.ShareZone, error)
 	UpdateShareZone(id string, updates map[string]interface{}) (*models.ShareZone, error)
+	UpdateShareZoneSMB(id string, enabled bool, opts *models.ZoneSMBOptions) (*models.ShareZone, error)
+	UpdateShareZoneNFS(id string, enabled bool, opts *models.ZoneNFSOptions) (*models.ShareZone, error)
 	DeleteShareZone(id string) error
 	ListShareZones() []*models.ShareZone
 	ListShareZonesByPool(poolID string) []*models.ShareZone
@@ -59,13 +108,17 @@ type DataStore interface {
 	CreateShareLink(link *models.ShareLink) (*models.ShareLink, error)
 	GetShareLink(id string) (*models.ShareLink, error)
 	GetShareLinkByToken(token string) (*models.ShareLink, error)
+	GetShareLinkBySlug(slug string) (*models.ShareLink, error)
 	UpdateShareLink(id string, updates map[string]interface{}) (*models.ShareLink, error)
 	DeleteShareLink(id string) error
 	ListShareLinks() []*models.ShareLink
 	ListShareLinksByOwner(ownerID string) []*models.ShareLink
 	IncrementShareLinkDownload(id string) error
 	IncrementShareLinkView(id string) error
-	CleanExpiredShareLinks() error
+	SetShareLinkToken(id, token string) error
+	SetShareLinkDownloadIPs(id string, ips []string) error
+	BurnShareLink(id string) error
+	CleanExpiredShareLinks(before time.Time) (int, error)
 
 	// Settings operations
 	GetSetting(key string) (*models.Setting, error)
@@ -83,8 +136,230 @@ type DataStore interface {
 	ListSnapshotPolicies() []*models.SnapshotPolicy
 	ListEnabledSnapshotPolicies() []*models.SnapshotPolicy
 	UpdateSnapshotPolicyRun(id string, lastRun time.Time, nextRun time.Time, lastError string) error
+
+	// File search index operations
+	UpsertFileIndexEntries(entries []*models.FileIndexEntry) error
+	DeleteFileIndexPath(zoneID, path string) error
+	PruneFileIndex(zoneID, pathPrefix string, before time.Time) error
+	ClearFileIndex(zoneID string) error
+	CountFileIndexEntries(zoneID string) int
+	SearchFileIndex(q *models.FileSearchQuery) ([]*models.FileIndexEntry, int, error)
+
+	// Document content index operations
+	GetZoneContentIndexing(zoneID string) *models.ZoneContentIndexing
+	SetZoneContentIndexing(cfg *models.ZoneContentIndexing) error
+	UpsertFileContent(c *models.FileContent) error
+	GetFileContentInfo(zoneID, path string) (*models.FileContent, error)
+	DeleteFileContentPath(zoneID, path string) error
+	RenameFileContentPath(zoneID, oldPath, newPath string) error
+	PruneFileContents(zoneID string) error
+	ClearFileContents(zoneID string) error
+	GetContentIndexStats(zoneID string) *models.ContentIndexStats
+
+	// Image metadata operations (photo gallery)
+	UpsertImageMetadata(m *models.ImageMetadata) error
+	GetImageMetadata(zoneID, path string) (*models.ImageMetadata, error)
+	ListGalleryImages(q *models.GalleryQuery) ([]*models.ImageMetadata, int, error)
+	GalleryTimeline(zoneID, pathPrefix, groupBy string) ([]*models.GalleryBucket, error)
+	DeleteImageMetadataPath(zoneID, path string) error
+	RenameImageMetadataPath(zoneID, oldPath, newPath string) error
+	PruneImageMetadata(zoneID string) error
+
+	// Directory usage operations
+	UpsertDirUsage(entries []*models.DirUsage) error
+	GetDirUsage(zoneID, path string) (*models.DirUsage, error)
+	SumDirUsage(zoneID, path string) (*models.UsageTotals, error)
+	DeleteDirUsagePath(zoneID, path string) error
+	PruneDirUsage(zoneID, pathPrefix string, before time.Time) error
+
+	// Zone user quota usage operations
+	GetZoneUserUsage(zoneID, username string) (*models.ZoneUserUsage, error)
+	SetZoneUserUsage(zoneID, username string, used int64) error
+	AddZoneUserUsage(zoneID, username string, delta int64) error
+	ListZoneUserUsage(zoneID string) []*models.ZoneUserUsage
+
+	// Usage history operations (samples from scheduled usage scans)
+	RecordUsageSamples(samples []*models.UsageSample) error
+	ListUsageSamples(zoneID, username string, since time.Time) []*models.UsageSample
+	ListLatestUsageSamples() []*models.UsageSample
+	GetUsageSampleBefore(zoneID, username string, at time.Time) (*models.UsageSample, error)
+	PruneUsageSamples(before time.Time) error
+
+	// Daily statistics operations (history of the admin dashboard)
+	RecordDailyStats(stats []*models.DailyStat) error
+	ListDailyStats(filter models.DailyStatFilter) []*models.DailyStat
+	CountActiveUsers(since time.Time) (int, error)
+
+	// Transfer c operations (monthly limits on bytes uploaded and downloaded)
+	GetTransferCap(objectType, objectID string) (*models.TransferCap, error)
+	SetTransferCap(c *models.TransferCap) error
+	DeleteTransferCap(objectType, objectID string) error
+	ListTransferCaps() []*models.TransferCap
+
+	// File checksum operations
+	UpsertFileChecksum(c *models.FileChecksum) error
+	GetFileChecksum(zoneID, path string) (*models.FileChecksum, error)
+	DeleteFileChecksumPath(zoneID, path string) error
+	RenameFileChecksumPath(zoneID, oldPath, newPath string) error
+	PruneFileChecksums(zoneID string, before time.Time) error
+	ListFileChecksumMismatches() []*models.FileChecksum
+	ListFileChecksums(zoneID, path string) []*models.FileChecksum
+
+	// File metadata operations (tags, descriptions and stars)
+	GetFileMetadata(zoneID, path string) (*models.FileMetadata, error)
+	SetFileMetadata(meta *models.FileMetadata) error
+	GetFileMetadataForPaths(zoneID string, paths []string) map[string]*models.FileMetadata
+	QueryFileMetadata(q *models.FileMetadataQuery) []*models.FileMetadata
+	ListFileTags(zoneID, pathPrefix string) []*models.TagCount
+	DeleteFileMetadataPath(zoneID, path string) error
+	RenameFileMetadataPath(zoneID, oldPath, newPath string) error
+
+	// Trash operations
+	CreateTrashItem(item *models.TrashItem) (*models.TrashItem, error)
+	GetTrashItem(id string) (*models.TrashItem, error)
+	DeleteTrashItem(id string) error
+	ListTrashItems(zoneID string) []*models.TrashItem
+	ListExpiredTrashItems(before time.Time) []*models.TrashItem
+
+	// Quarantine operations
+	CreateQuarantineItem(item *models.QuarantineItem) (*models.QuarantineItem, error)
+	GetQuarantineItem(id string) (*models.QuarantineItem, error)
+	DeleteQuarantineItem(id string) error
+	ListQuarantineItems() []*models.QuarantineItem
+
+	// File version operations
+	CreateFileVersion(version *models.FileVersion) (*models.FileVersion, error)
+	GetFileVersion(id string) (*models.FileVersion, error)
+	DeleteFileVersion(id string) error
+	ListFileVersions(zoneID, path string) []*models.FileVersion
+	ListZoneFileVersions(zoneID string) []*models.FileVersion
+	GetZoneVersioning(zoneID string) *models.ZoneVersioning
+	SetZoneVersioning(cfg *models.ZoneVersioning) error
+
+	// Zone project quota operations (filesystem limits on a whole zone)
+	GetZoneProjectQuota(zoneID string) (*models.ZoneProjectQuota, error)
+	SetZoneProjectQuota(quota *models.ZoneProjectQuota) error
+	DeleteZoneProjectQuota(zoneID string) error
+	ListZoneProjectQuotas() []*models.ZoneProjectQuota
+
+	// API token operations
+	CreateAPIToken(token *models.APIToken) (*models.APIToken, error)
+	GetAPIToken(id string) (*models.APIToken, error)
+	GetAPITokenByHash(hash string) (*models.APIToken, error)
+	DeleteAPIToken(id string) error
+	ListAPITokens() []*models.APIToken
+	ListAPITokensByUser(userID string) []*models.APIToken
+	UpdateAPITokenLastUsed(id string, lastUsed time.Time) error
+
+	// Folder share operations (internal user-to-user sharing)
+	CreateFolderShare(share *models.FolderShare) (*models.FolderShare, error)
+	GetFolderShare(id string) (*models.FolderShare, error)
+	DeleteFolderShare(id string) error
+	ListFolderShares() []*models.FolderShare
+	ListFolderSharesByOwner(ownerID string) []*models.FolderShare
+
+	// Replication operations (ZFS send/receive jobs)
+	CreateReplicationJob(job *models.ReplicationJob) (*models.ReplicationJob, error)
+	GetReplicationJob(id string) (*models.ReplicationJob, error)
+	UpdateReplicationJob(id string, updates map[string]interface{}) (*models.ReplicationJob, error)
+	DeleteReplicationJob(id string) error
+	ListReplicationJobs() []*models.ReplicationJob
+	UpdateReplicationJobRun(id string, lastRun time.Time, nextRun time.Time, status, lastSnapshot, lastError string) error
+	CreateReplicationRun(run *models.ReplicationRun) (*models.ReplicationRun, error)
+	UpdateReplicationRun(run *models.ReplicationRun) error
+	ListReplicationRuns(jobID string, limit int) []*models.ReplicationRun
+	PruneReplicationRuns(jobID string, keep int) error
+	FailInterruptedReplicationRuns(message string) error
+
+	// Maintenance operations (scheduled ZFS scrubs and RAID checks)
+	CreateMaintenanceSchedule(schedule *models.MaintenanceSchedule) (*models.MaintenanceSchedule, error)
+	GetMaintenanceSchedule(id string) (*models.MaintenanceSchedule, error)
+	UpdateMaintenanceSchedule(id string, updates map[string]interface{}) (*models.MaintenanceSchedule, error)
+	DeleteMaintenanceSchedule(id string) error
+	ListMaintenanceSchedules() []*models.MaintenanceSchedule
+	UpdateMaintenanceScheduleRun(id string, lastRun time.Time, nextRun time.Time, status, lastError string) error
+	CreateMaintenanceRun(run *models.MaintenanceRun) (*models.MaintenanceRun, error)
+	UpdateMaintenanceRun(run *models.MaintenanceRun) error
+	ListMaintenanceRuns(scheduleID string, limit int) []*models.MaintenanceRun
+	PruneMaintenanceRuns(scheduleID string, keep int) error
+	FailInterruptedMaintenanceRuns(message string) error
+
+	// Retention policy operations (scheduled cleanup of old files)
+	CreateRetentionPolicy(policy *models.RetentionPolicy) (*models.RetentionPolicy, error)
+	GetRetentionPolicy(id string) (*models.RetentionPolicy, error)
+	UpdateRetentionPolicy(policy *models.RetentionPolicy) error
+	DeleteRetentionPolicy(id string) error
+	ListRetentionPolicies() []*models.RetentionPolicy
+	UpdateRetentionPolicyRun(id string, lastRun time.Time, nextRun time.Time, status, lastError string) error
+	AddRetentionActions(actions []*models.RetentionAction) error
+	ListRetentionActions(policyID string, limit int) []*models.RetentionAction
+	PruneRetentionActions(policyID string, keep int) error
+
+	// iSCSI target operations (zvols exported through LIO)
+	CreateISCSITarget(target *models.ISCSITarget) (*models.ISCSITarget, error)
+	GetISCSITarget(id string) (*models.ISCSITarget, error)
+	UpdateISCSITarget(target *models.ISCSITarget) (*models.ISCSITarget, error)
+	DeleteISCSITarget(id string) error
+	ListISCSITargets() []*models.ISCSITarget
+
+	// Storage alert operations (raised and resolved by the storage monitor)
+	CreateStorageAlert(alert *models.StorageAlertRecord) (*models.StorageAlertRecord, error)
+	GetStorageAlert(id string) (*models.StorageAlertRecord, error)
+	UpdateStorageAlert(alert *models.StorageAlertRecord) error
+	ListStorageAlerts(status string, limit int) []*models.StorageAlertRecord
+	PruneResolvedStorageAlerts(before time.Time) error
+
+	// RAID spare pool operations (devices that join the first array to degrade)
+	CreateRAIDSpare(spare *models.RAIDSpare) (*models.RAIDSpare, error)
+	DeleteRAIDSpare(id string) error
+	ListRAIDSpares() []*models.RAIDSpare
+
+	// Notification channel operations
+	CreateNotificationChannel(channel *models.NotificationChannel) (*models.NotificationChannel, error)
+	GetNotificationChannel(id string) (*models.NotificationChannel, error)
+	UpdateNotificationChannel(channel *models.NotificationChannel) (*models.NotificationChannel, error)
+	UpdateNotificationChannelStatus(id string, sentAt time.Time, lastError string) error
+	DeleteNotificationChannel(id string) error
+	ListNotificationChannels() []*models.NotificationChannel
+
+	// Job operations (background file operations and their history)
+	CreateJob(job *models.Job) error
+	UpdateJob(job *models.Job) error
+	GetJob(id string) (*models.Job, error)
+	ListJobs(query models.JobQuery) []*models.Job
+	DeleteJob(id string) error
+	FailInterruptedJobs(reason string) (int, error)
+	PruneJobs(before time.Time) error
+
+	// File lock operations (advisory locks for collaborative editing)
+	CreateFileLock(lock *models.FileLock) error
+	RefreshFileLock(token string, timeout int, expiresAt time.Time) error
+	GetFileLock(token string) (*models.FileLock, error)
+	ListFileLocks(zoneID string) []*models.FileLock
+	DeleteFileLock(token string) error
+	DeleteFileLockPath(zoneID, path string) error
+	PruneFileLocks(before time.Time) error
+
+	// Upload session operations (chunked uploads resumable across restarts)
+	SaveUploadSession(session *models.UploadSession) error
+	ListUploadSessions() []*models.UploadSession
+	DeleteUploadSession(id string) error
+	PruneUploadSessions(before time.Time) error
+
+	// Soft-deleted pools, zones, shares and share links
+	ListDeletedObjects() []*models.DeletedObject
+	RestoreDeletedObject(objectType models.DeletedObjectType, id string) error
+	PurgeDeletedObject(objectType models.DeletedObjectType, id string) error
+	PurgeDeletedObjectsBefore(before time.Time) error
+
+	// Database backup operations
+	BackupDatabase(dest string) error
+	StageDatabaseRestore(src string) error
+	CancelDatabaseRestore() error
+	DatabaseRestorePending() bool
 }
 
 // Ensure both Store types implement DataStore
 var _ DataStore = (*Store)(nil)
 var _ DataStore = (*SQLiteStore)(nil)
+var _ DataStore = (*PostgresStore)(nil)
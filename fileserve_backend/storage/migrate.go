@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema changes are versioned migrations in migrations/<dialect>/NNNN_description.sql, applied in
+// order and recorded in schema_version. A change is a new file for each dialect; applied files are
+// never edited.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// postgresMigrationLock is the advisory lock held while migrating, so instances starting
+// together against the same database do not race
+const postgresMigrationLock = 0x66696c6573657276
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations returns the migrations of a dialect ordered by version
+func loadMigrations(d dialect) ([]migration, error) {
+	dir := "migrations/sqlite"
+	if d == dialectPostgres {
+		dir = "migrations/postgres"
+	}
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, description, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: description, sql: string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].version)
+		}
+	}
+	return migrations, nil
+}
+
+// migrate applies the migrations newer than the recorded schema version in one transaction
+func (s *SQLiteStore) migrate() error {
+	migrations, err := loadMigrations(s.db.dialect)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	versionTable := `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`
+	if s.db.dialect == dialectPostgres {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(?)", postgresMigrationLock); err != nil {
+			return err
+		}
+		versionTable = postgresColumnType(versionTable)
+	}
+	if _, err := tx.Exec(versionTable); err != nil {
+		return err
+	}
+
+	var current int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+		return err
+	}
+	if current == 0 {
+		// Databases created before versioned migrations have tables but no recorded version
+		if err := s.migrateLegacyColumns(tx); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		// Run as written, without rewriting placeholders
+		if _, err := tx.Tx.Exec(m.sql); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+			m.version, m.name, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// legacyColumns were added to existing tables by ALTER TABLE before versioned migrations.
+// 0001_initial already includes them; new columns get a migration instead.
+var legacyColumns = []struct {
+	table, column, definition string
+}{
+	{"storage_pools", "backend", "TEXT NOT NULL DEFAULT 'local'"},
+	{"storage_pools", "s3_config", "TEXT"},
+	{"share_links", "mode", "TEXT NOT NULL DEFAULT 'standard'"},
+	{"share_links", "max_file_size", "INTEGER NOT NULL DEFAULT 0"},
+	{"share_links", "allowed_extensions", "TEXT"},
+	{"share_links", "notify_on_upload", "INTEGER NOT NULL DEFAULT 0"},
+	{"share_links", "notify_on_download", "INTEGER NOT NULL DEFAULT 0"},
+	{"share_links", "burn_after_ips", "INTEGER NOT NULL DEFAULT 0"},
+	{"share_links", "delete_on_burn", "INTEGER NOT NULL DEFAULT 0"},
+	{"share_links", "download_ips", "TEXT"},
+	{"share_links", "burned_at", "DATETIME"},
+	{"share_links", "slug", "TEXT"},
+	{"share_links", "allowed_cidrs", "TEXT"},
+	{"share_links", "allowed_countries", "TEXT"},
+	{"share_links", "blocked_countries", "TEXT"},
+	{"share_links", "items", "TEXT"},
+	{"users", "is_guest", "INTEGER NOT NULL DEFAULT 0"},
+	{"users", "guest_zones", "TEXT DEFAULT '[]'"},
+	{"users", "expires_at", "DATETIME"},
+	{"users", "invited_by", "TEXT"},
+	{"share_zones", "owners", "TEXT DEFAULT '[]'"},
+	{"sessions", "id", "TEXT"},
+	{"sessions", "username", "TEXT"},
+	{"sessions", "ip", "TEXT"},
+	{"sessions", "user_agent", "TEXT"},
+	{"sessions", "device", "TEXT"},
+	{"sessions", "impersonated_by", "TEXT"},
+	{"sessions", "last_seen", "DATETIME"},
+	{"share_zones", "max_upload_size", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// migrateLegacyColumns adds legacyColumns missing from tables of databases created by older
+// versions. Tables that do not exist yet are left to 0001_initial.
+func (s *SQLiteStore) migrateLegacyColumns(tx *sqlTx) error {
+	for _, m := range legacyColumns {
+		if s.db.dialect == dialectPostgres {
+			if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE IF EXISTS %s ADD COLUMN IF NOT EXISTS %s %s",
+				m.table, m.column, postgresColumnType(m.definition))); err != nil {
+				return fmt.Errorf("failed to add %s.%s: %w", m.table, m.column, err)
+			}
+			continue
+		}
+
+		var columns, count int
+		err := tx.QueryRow("SELECT COUNT(*), COALESCE(SUM(name = ?), 0) FROM pragma_table_info(?)", m.column, m.table).
+			Scan(&columns, &count)
+		if err != nil {
+			return err
+		}
+		if columns == 0 || count > 0 {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,715 @@
+-- Initial schema, the Postgres counterpart of sqlite/0001_initial.sql.
+-- Flags are BIGINT like the INTEGER columns of SQLite, and foreign keys are left out
+-- because SQLite does not enforce them either.
+
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	username TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	email TEXT,
+	is_admin BIGINT NOT NULL DEFAULT 0,
+	groups TEXT DEFAULT '[]',
+	must_change_password BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	is_guest BIGINT NOT NULL DEFAULT 0,
+	guest_zones TEXT DEFAULT '[]',
+	expires_at TIMESTAMPTZ,
+	invited_by TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+
+-- Sessions table
+CREATE TABLE IF NOT EXISTS sessions (
+	token TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	id TEXT,
+	username TEXT,
+	ip TEXT,
+	user_agent TEXT,
+	device TEXT,
+	impersonated_by TEXT,
+	last_seen TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- Revoked sessions (token denylist, kept until the revoked tokens expire)
+CREATE TABLE IF NOT EXISTS revoked_sessions (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	revoked_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Permissions table
+CREATE TABLE IF NOT EXISTS permissions (
+	id TEXT PRIMARY KEY,
+	path TEXT NOT NULL,
+	type TEXT NOT NULL,
+	username TEXT,
+	group_name TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_permissions_path ON permissions(path);
+CREATE INDEX IF NOT EXISTS idx_permissions_username ON permissions(username);
+CREATE INDEX IF NOT EXISTS idx_permissions_group ON permissions(group_name);
+
+-- Shares table (SMB/NFS)
+CREATE TABLE IF NOT EXISTS shares (
+	id TEXT PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL,
+	path TEXT NOT NULL,
+	protocol TEXT NOT NULL,
+	description TEXT,
+	enabled BIGINT NOT NULL DEFAULT 1,
+	zone_id TEXT,
+	owner_id TEXT,
+	allowed_users TEXT DEFAULT '[]',
+	allowed_groups TEXT DEFAULT '[]',
+	deny_users TEXT DEFAULT '[]',
+	deny_groups TEXT DEFAULT '[]',
+	guest_access BIGINT NOT NULL DEFAULT 0,
+	read_only BIGINT NOT NULL DEFAULT 0,
+	browsable BIGINT NOT NULL DEFAULT 1,
+	smb_options TEXT,
+	nfs_options TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_shares_name ON shares(name);
+CREATE INDEX IF NOT EXISTS idx_shares_protocol ON shares(protocol);
+
+-- Storage pools table
+CREATE TABLE IF NOT EXISTS storage_pools (
+	id TEXT PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL,
+	path TEXT NOT NULL,
+	description TEXT,
+	enabled BIGINT NOT NULL DEFAULT 1,
+	total_space BIGINT NOT NULL DEFAULT 0,
+	used_space BIGINT NOT NULL DEFAULT 0,
+	free_space BIGINT NOT NULL DEFAULT 0,
+	reserved BIGINT NOT NULL DEFAULT 0,
+	max_file_size BIGINT NOT NULL DEFAULT 0,
+	allowed_types TEXT DEFAULT '[]',
+	denied_types TEXT DEFAULT '[]',
+	default_user_quota BIGINT NOT NULL DEFAULT 0,
+	default_group_quota BIGINT NOT NULL DEFAULT 0,
+	backend TEXT NOT NULL DEFAULT 'local',
+	s3_config TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_storage_pools_name ON storage_pools(name);
+
+-- Share zones table
+CREATE TABLE IF NOT EXISTS share_zones (
+	id TEXT PRIMARY KEY,
+	pool_id TEXT NOT NULL,
+	name TEXT UNIQUE NOT NULL,
+	path TEXT NOT NULL,
+	description TEXT,
+	zone_type TEXT NOT NULL DEFAULT 'group',
+	enabled BIGINT NOT NULL DEFAULT 1,
+	auto_provision BIGINT NOT NULL DEFAULT 0,
+	provision_template TEXT,
+	allowed_users TEXT DEFAULT '[]',
+	allowed_groups TEXT DEFAULT '[]',
+	deny_users TEXT DEFAULT '[]',
+	deny_groups TEXT DEFAULT '[]',
+	owners TEXT DEFAULT '[]',
+	allow_network_shares BIGINT NOT NULL DEFAULT 1,
+	allow_web_shares BIGINT NOT NULL DEFAULT 1,
+	allow_guest_access BIGINT NOT NULL DEFAULT 0,
+	smb_enabled BIGINT NOT NULL DEFAULT 0,
+	nfs_enabled BIGINT NOT NULL DEFAULT 0,
+	smb_options TEXT,
+	nfs_options TEXT,
+	web_options TEXT,
+	max_quota_per_user BIGINT NOT NULL DEFAULT 0,
+	max_upload_size BIGINT NOT NULL DEFAULT 0,
+	read_only BIGINT NOT NULL DEFAULT 0,
+	browsable BIGINT NOT NULL DEFAULT 1,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_share_zones_name ON share_zones(name);
+CREATE INDEX IF NOT EXISTS idx_share_zones_pool_id ON share_zones(pool_id);
+CREATE INDEX IF NOT EXISTS idx_share_zones_zone_type ON share_zones(zone_type);
+
+-- Settings table (key-value configuration)
+CREATE TABLE IF NOT EXISTS settings (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL,
+	type TEXT NOT NULL DEFAULT 'string',
+	category TEXT NOT NULL DEFAULT 'general',
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Share links table (web sharing)
+CREATE TABLE IF NOT EXISTS share_links (
+	id TEXT PRIMARY KEY,
+	share_id TEXT,
+	owner_id TEXT NOT NULL,
+	target_path TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_name TEXT NOT NULL,
+	items TEXT,
+	token TEXT UNIQUE NOT NULL,
+	slug TEXT,
+	password_hash TEXT,
+	expires_at TIMESTAMPTZ,
+	max_downloads BIGINT NOT NULL DEFAULT 0,
+	download_count BIGINT NOT NULL DEFAULT 0,
+	max_views BIGINT NOT NULL DEFAULT 0,
+	view_count BIGINT NOT NULL DEFAULT 0,
+	allow_download BIGINT NOT NULL DEFAULT 1,
+	allow_preview BIGINT NOT NULL DEFAULT 1,
+	allow_upload BIGINT NOT NULL DEFAULT 0,
+	allow_listing BIGINT NOT NULL DEFAULT 0,
+	mode TEXT NOT NULL DEFAULT 'standard',
+	max_file_size BIGINT NOT NULL DEFAULT 0,
+	allowed_extensions TEXT,
+	notify_on_upload BIGINT NOT NULL DEFAULT 0,
+	notify_on_download BIGINT NOT NULL DEFAULT 0,
+	burn_after_ips BIGINT NOT NULL DEFAULT 0,
+	delete_on_burn BIGINT NOT NULL DEFAULT 0,
+	download_ips TEXT,
+	burned_at TIMESTAMPTZ,
+	allowed_cidrs TEXT,
+	allowed_countries TEXT,
+	blocked_countries TEXT,
+	name TEXT,
+	description TEXT,
+	custom_message TEXT,
+	show_owner BIGINT NOT NULL DEFAULT 0,
+	enabled BIGINT NOT NULL DEFAULT 1,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	last_accessed TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_share_links_token ON share_links(token);
+CREATE INDEX IF NOT EXISTS idx_share_links_owner_id ON share_links(owner_id);
+CREATE INDEX IF NOT EXISTS idx_share_links_expires_at ON share_links(expires_at);
+
+-- Snapshot policies table (automated ZFS snapshots)
+CREATE TABLE IF NOT EXISTS snapshot_policies (
+	id TEXT PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL,
+	dataset TEXT NOT NULL,
+	enabled BIGINT NOT NULL DEFAULT 1,
+	schedule TEXT NOT NULL,
+	retention BIGINT NOT NULL DEFAULT 7,
+	prefix TEXT NOT NULL DEFAULT 'auto',
+	recursive BIGINT NOT NULL DEFAULT 0,
+	last_run TIMESTAMPTZ,
+	next_run TIMESTAMPTZ,
+	last_error TEXT,
+	snapshot_count BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_snapshot_policies_dataset ON snapshot_policies(dataset);
+CREATE INDEX IF NOT EXISTS idx_snapshot_policies_enabled ON snapshot_policies(enabled);
+CREATE INDEX IF NOT EXISTS idx_snapshot_policies_next_run ON snapshot_policies(next_run);
+
+-- File search index (maintained by the background indexer)
+CREATE TABLE IF NOT EXISTS file_index (
+	id BIGSERIAL PRIMARY KEY,
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL,
+	name TEXT NOT NULL,
+	extension TEXT NOT NULL DEFAULT '',
+	size BIGINT NOT NULL DEFAULT 0,
+	is_dir BIGINT NOT NULL DEFAULT 0,
+	mod_time BIGINT NOT NULL DEFAULT 0, -- unix seconds, for range filters
+	indexed_at BIGINT NOT NULL DEFAULT 0,
+	UNIQUE (zone_id, path)
+);
+CREATE INDEX IF NOT EXISTS idx_file_index_zone_ext ON file_index(zone_id, extension);
+CREATE INDEX IF NOT EXISTS idx_file_index_zone_size ON file_index(zone_id, size);
+CREATE INDEX IF NOT EXISTS idx_file_index_zone_mod_time ON file_index(zone_id, mod_time);
+CREATE INDEX IF NOT EXISTS idx_file_index_zone_indexed_at ON file_index(zone_id, indexed_at);
+-- Name search (SQLite uses an FTS5 table)
+CREATE INDEX IF NOT EXISTS idx_file_index_name_fts ON file_index USING GIN (to_tsvector('simple', name));
+
+-- Per-directory usage (maintained by the background usage tracker)
+CREATE TABLE IF NOT EXISTS dir_usage (
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL,
+	size BIGINT NOT NULL DEFAULT 0,
+	file_count BIGINT NOT NULL DEFAULT 0,
+	dir_count BIGINT NOT NULL DEFAULT 0,
+	scanned_at BIGINT NOT NULL DEFAULT 0, -- unix seconds
+	PRIMARY KEY (zone_id, path)
+);
+
+-- Space charged to each user per zone (application-level quotas)
+CREATE TABLE IF NOT EXISTS zone_user_usage (
+	zone_id TEXT NOT NULL,
+	username TEXT NOT NULL,
+	used_bytes BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (zone_id, username)
+);
+
+-- Usage samples from scheduled scans (empty username = whole zone)
+CREATE TABLE IF NOT EXISTS usage_history (
+	zone_id TEXT NOT NULL,
+	username TEXT NOT NULL DEFAULT '',
+	used_bytes BIGINT NOT NULL DEFAULT 0,
+	recorded_at BIGINT NOT NULL, -- unix seconds
+	PRIMARY KEY (zone_id, username, recorded_at)
+);
+CREATE INDEX IF NOT EXISTS idx_usage_history_recorded_at ON usage_history(recorded_at);
+
+-- SHA-256 of zone files, re-verified by the background integrity checker
+CREATE TABLE IF NOT EXISTS file_checksums (
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	size BIGINT NOT NULL DEFAULT 0,
+	mod_time BIGINT NOT NULL DEFAULT 0, -- unix nanoseconds
+	computed_at BIGINT NOT NULL DEFAULT 0, -- unix seconds
+	verified_at BIGINT NOT NULL DEFAULT 0, -- unix seconds
+	status TEXT NOT NULL DEFAULT 'ok',
+	actual_sha256 TEXT NOT NULL DEFAULT '',
+	detected_at BIGINT NOT NULL DEFAULT 0, -- unix seconds (0 = no mismatch)
+	PRIMARY KEY (zone_id, path)
+);
+CREATE INDEX IF NOT EXISTS idx_file_checksums_status ON file_checksums(status);
+
+-- User-defined tags, descriptions and stars on zone files
+CREATE TABLE IF NOT EXISTS file_metadata (
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL,
+	tags TEXT NOT NULL DEFAULT '', -- ",tag1,tag2," so a tag can be matched with LIKE
+	description TEXT NOT NULL DEFAULT '',
+	starred BIGINT NOT NULL DEFAULT 0,
+	updated_by TEXT NOT NULL DEFAULT '',
+	updated_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (zone_id, path)
+);
+CREATE INDEX IF NOT EXISTS idx_file_metadata_starred ON file_metadata(zone_id, starred);
+
+
+-- Per-zone document content indexing settings
+CREATE TABLE IF NOT EXISTS zone_content_indexing (
+	zone_id TEXT PRIMARY KEY,
+	enabled BIGINT NOT NULL DEFAULT 0,
+	max_file_size BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Text extracted from documents in zones with content indexing
+CREATE TABLE IF NOT EXISTS file_contents (
+	id BIGSERIAL PRIMARY KEY,
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL,
+	content TEXT NOT NULL DEFAULT '',
+	size BIGINT NOT NULL DEFAULT 0,
+	mod_time BIGINT NOT NULL DEFAULT 0, -- unix seconds, to detect changed documents
+	error TEXT NOT NULL DEFAULT '',
+	indexed_at BIGINT NOT NULL DEFAULT 0,
+	UNIQUE (zone_id, path)
+);
+CREATE INDEX IF NOT EXISTS idx_file_contents_fts ON file_contents USING GIN (to_tsvector('simple', content));
+
+
+-- EXIF details of zone images for the photo gallery
+CREATE TABLE IF NOT EXISTS image_metadata (
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL,
+	taken_at BIGINT, -- unix seconds, NULL when the image has no capture date
+	sort_time BIGINT NOT NULL, -- taken_at, or the modification time for images without one
+	camera_make TEXT NOT NULL DEFAULT '',
+	camera_model TEXT NOT NULL DEFAULT '',
+	lens TEXT NOT NULL DEFAULT '',
+	width BIGINT NOT NULL DEFAULT 0,
+	height BIGINT NOT NULL DEFAULT 0,
+	orientation BIGINT NOT NULL DEFAULT 0,
+	exposure_time TEXT NOT NULL DEFAULT '',
+	f_number DOUBLE PRECISION NOT NULL DEFAULT 0,
+	iso BIGINT NOT NULL DEFAULT 0,
+	focal_length DOUBLE PRECISION NOT NULL DEFAULT 0,
+	latitude DOUBLE PRECISION,
+	longitude DOUBLE PRECISION,
+	altitude DOUBLE PRECISION,
+	size BIGINT NOT NULL DEFAULT 0,
+	mod_time BIGINT NOT NULL DEFAULT 0,
+	indexed_at BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (zone_id, path)
+);
+CREATE INDEX IF NOT EXISTS idx_image_metadata_sort_time ON image_metadata(zone_id, sort_time);
+
+-- Trash (deleted zone files awaiting restore or purge)
+CREATE TABLE IF NOT EXISTS trash_items (
+	id TEXT PRIMARY KEY,
+	zone_id TEXT NOT NULL,
+	original_path TEXT NOT NULL,
+	name TEXT NOT NULL,
+	is_dir BIGINT DEFAULT 0,
+	size BIGINT DEFAULT 0,
+	deleted_by TEXT,
+	deleted_by_name TEXT,
+	deleted_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_trash_items_zone ON trash_items(zone_id);
+CREATE INDEX IF NOT EXISTS idx_trash_items_deleted_at ON trash_items(deleted_at);
+
+-- Uploads flagged by the virus scanner
+CREATE TABLE IF NOT EXISTS quarantine_items (
+	id TEXT PRIMARY KEY,
+	zone_id TEXT NOT NULL,
+	original_path TEXT NOT NULL,
+	name TEXT NOT NULL,
+	size BIGINT DEFAULT 0,
+	signature TEXT NOT NULL,
+	uploaded_by TEXT,
+	uploaded_by_name TEXT,
+	quarantined_at TIMESTAMPTZ NOT NULL
+);
+
+-- File versions (previous copies kept when a file is overwritten)
+CREATE TABLE IF NOT EXISTS file_versions (
+	id TEXT PRIMARY KEY,
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL,
+	size BIGINT DEFAULT 0,
+	mod_time TIMESTAMPTZ,
+	created_by TEXT,
+	created_by_name TEXT,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_file_versions_zone_path ON file_versions(zone_id, path);
+CREATE INDEX IF NOT EXISTS idx_file_versions_created_at ON file_versions(created_at);
+
+-- Authentication lockouts (brute-force protection)
+CREATE TABLE IF NOT EXISTS auth_lockouts (
+	key TEXT PRIMARY KEY,
+	scope TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	failures BIGINT NOT NULL DEFAULT 0,
+	locked_until TIMESTAMPTZ,
+	last_failure TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_auth_lockouts_last_failure ON auth_lockouts(last_failure);
+
+-- Password history (reuse checks and password age)
+CREATE TABLE IF NOT EXISTS password_history (
+	id BIGSERIAL PRIMARY KEY,
+	username TEXT NOT NULL,
+	password_hash TEXT NOT NULL,
+	changed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_password_history_username ON password_history(username, changed_at);
+
+-- Security events (authentication failures, privilege escalations, power control)
+CREATE TABLE IF NOT EXISTS security_events (
+	id BIGSERIAL PRIMARY KEY,
+	type TEXT NOT NULL,
+	source TEXT NOT NULL,
+	actor TEXT NOT NULL DEFAULT '',
+	target TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	message TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_security_events_created_at ON security_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_type ON security_events(type, created_at);
+
+-- Passkeys (WebAuthn credentials)
+CREATE TABLE IF NOT EXISTS passkeys (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	username TEXT NOT NULL,
+	name TEXT NOT NULL,
+	credential_id TEXT UNIQUE NOT NULL,
+	public_key BYTEA NOT NULL,
+	sign_count BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL,
+	last_used TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_passkeys_user_id ON passkeys(user_id);
+
+-- API tokens (long-lived scoped bearer tokens)
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	username TEXT NOT NULL,
+	groups TEXT DEFAULT '[]',
+	name TEXT NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	token_prefix TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	zones TEXT DEFAULT '[]',
+	expires_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+
+-- Per-zone versioning configuration
+CREATE TABLE IF NOT EXISTS zone_versioning (
+	zone_id TEXT PRIMARY KEY,
+	enabled BIGINT NOT NULL DEFAULT 1,
+	max_versions BIGINT NOT NULL DEFAULT 10,
+	max_storage BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Filesystem limits on the total size of a zone
+CREATE TABLE IF NOT EXISTS zone_project_quotas (
+	zone_id TEXT PRIMARY KEY,
+	limit_bytes BIGINT NOT NULL,
+	method TEXT NOT NULL,
+	target TEXT NOT NULL,
+	project_id BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Folders shared between internal users
+CREATE TABLE IF NOT EXISTS folder_shares (
+	id TEXT PRIMARY KEY,
+	owner_id TEXT NOT NULL,
+	owner_name TEXT NOT NULL,
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL,
+	recipient_type TEXT NOT NULL,
+	recipient TEXT NOT NULL,
+	permission TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_folder_shares_owner_id ON folder_shares(owner_id);
+
+-- ZFS replication jobs (zfs send | zfs receive)
+CREATE TABLE IF NOT EXISTS replication_jobs (
+	id TEXT PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL,
+	source_dataset TEXT NOT NULL,
+	target_host TEXT,
+	target_port BIGINT NOT NULL DEFAULT 22,
+	target_user TEXT,
+	ssh_key_path TEXT,
+	target_dataset TEXT NOT NULL,
+	schedule TEXT NOT NULL,
+	recursive BIGINT NOT NULL DEFAULT 0,
+	retention BIGINT NOT NULL DEFAULT 3,
+	enabled BIGINT NOT NULL DEFAULT 1,
+	last_run TIMESTAMPTZ,
+	next_run TIMESTAMPTZ,
+	last_status TEXT,
+	last_error TEXT,
+	last_snapshot TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Replication job history
+CREATE TABLE IF NOT EXISTS replication_runs (
+	id TEXT PRIMARY KEY,
+	job_id TEXT NOT NULL,
+	status TEXT NOT NULL,
+	snapshot TEXT,
+	base_snapshot TEXT,
+	resumed BIGINT NOT NULL DEFAULT 0,
+	bytes_sent BIGINT NOT NULL DEFAULT 0,
+	error TEXT,
+	started_at TIMESTAMPTZ NOT NULL,
+	finished_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_replication_runs_job ON replication_runs(job_id, started_at);
+
+-- Scheduled ZFS scrubs and RAID consistency checks
+CREATE TABLE IF NOT EXISTS maintenance_schedules (
+	id TEXT PRIMARY KEY,
+	type TEXT NOT NULL,
+	target TEXT NOT NULL,
+	schedule TEXT NOT NULL,
+	enabled BIGINT NOT NULL DEFAULT 1,
+	last_run TIMESTAMPTZ,
+	next_run TIMESTAMPTZ,
+	last_status TEXT,
+	last_error TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	UNIQUE(type, target)
+);
+
+-- Scrub and check history
+CREATE TABLE IF NOT EXISTS maintenance_runs (
+	id TEXT PRIMARY KEY,
+	schedule_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	target TEXT NOT NULL,
+	status TEXT NOT NULL,
+	errors_found BIGINT NOT NULL DEFAULT 0,
+	summary TEXT,
+	error TEXT,
+	started_at TIMESTAMPTZ NOT NULL,
+	finished_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_maintenance_runs_schedule ON maintenance_runs(schedule_id, started_at);
+
+-- Scheduled deletion or archiving of old files in a zone
+CREATE TABLE IF NOT EXISTS retention_policies (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL DEFAULT '/',
+	pattern TEXT,
+	max_age_days BIGINT NOT NULL,
+	action TEXT NOT NULL,
+	archive_zone_id TEXT,
+	archive_path TEXT,
+	schedule TEXT NOT NULL,
+	enabled BIGINT NOT NULL DEFAULT 1,
+	last_run TIMESTAMPTZ,
+	next_run TIMESTAMPTZ,
+	last_status TEXT,
+	last_error TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Files deleted or archived by retention policies
+CREATE TABLE IF NOT EXISTS retention_actions (
+	id TEXT PRIMARY KEY,
+	policy_id TEXT NOT NULL,
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL,
+	action TEXT NOT NULL,
+	destination TEXT,
+	size BIGINT NOT NULL DEFAULT 0,
+	mod_time TIMESTAMPTZ NOT NULL,
+	error TEXT,
+	performed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_retention_actions_policy ON retention_actions(policy_id, performed_at);
+
+-- iSCSI targets exporting zvols
+CREATE TABLE IF NOT EXISTS iscsi_targets (
+	id TEXT PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL,
+	iqn TEXT UNIQUE NOT NULL,
+	luns TEXT,
+	initiators TEXT,
+	chap_user TEXT,
+	chap_password TEXT,
+	enabled BIGINT NOT NULL DEFAULT 1,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Storage alerts raised by the background monitor
+CREATE TABLE IF NOT EXISTS storage_alerts (
+	id TEXT PRIMARY KEY,
+	key TEXT NOT NULL,
+	level TEXT NOT NULL,
+	type TEXT NOT NULL,
+	message TEXT NOT NULL,
+	resource TEXT,
+	status TEXT NOT NULL,
+	first_seen TIMESTAMPTZ NOT NULL,
+	last_seen TIMESTAMPTZ NOT NULL,
+	acknowledged_at TIMESTAMPTZ,
+	acknowledged_by TEXT,
+	resolved_at TIMESTAMPTZ,
+	notified_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_storage_alerts_status ON storage_alerts(status, last_seen);
+
+-- Global hot-spare pool for RAID arrays
+CREATE TABLE IF NOT EXISTS raid_spares (
+	id TEXT PRIMARY KEY,
+	device TEXT UNIQUE NOT NULL,
+	size BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+-- Notification channels and the events routed to them
+CREATE TABLE IF NOT EXISTS notification_channels (
+	id TEXT PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL,
+	type TEXT NOT NULL,
+	url TEXT,
+	token TEXT,
+	email_recipients TEXT,
+	events TEXT,
+	enabled BIGINT NOT NULL DEFAULT 1,
+	last_sent_at TIMESTAMPTZ,
+	last_error TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Background file operations and their history
+CREATE TABLE IF NOT EXISTS jobs (
+	id TEXT PRIMARY KEY,
+	type TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	username TEXT NOT NULL DEFAULT '',
+	zone_id TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	params TEXT,
+	status TEXT NOT NULL,
+	progress DOUBLE PRECISION NOT NULL DEFAULT 0,
+	total_items BIGINT NOT NULL DEFAULT 0,
+	done_items BIGINT NOT NULL DEFAULT 0,
+	failed_items BIGINT NOT NULL DEFAULT 0,
+	skipped_items BIGINT NOT NULL DEFAULT 0,
+	total_bytes BIGINT NOT NULL DEFAULT 0,
+	done_bytes BIGINT NOT NULL DEFAULT 0,
+	result TEXT,
+	errors TEXT,
+	error TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	started_at TIMESTAMPTZ,
+	finished_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_user ON jobs(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+
+-- Advisory file locks (web API, WebDAV and file transfer protocols)
+CREATE TABLE IF NOT EXISTS file_locks (
+	token TEXT PRIMARY KEY,
+	zone_id TEXT NOT NULL,
+	path TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	username TEXT NOT NULL DEFAULT '',
+	scope TEXT NOT NULL,
+	depth TEXT NOT NULL,
+	owner TEXT NOT NULL DEFAULT '',
+	timeout BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_file_locks_zone ON file_locks(zone_id, path);
+
+-- Chunked upload sessions (chunk data stays in the session temp directory)
+CREATE TABLE IF NOT EXISTS upload_sessions (
+	id TEXT PRIMARY KEY,
+	filename TEXT NOT NULL,
+	total_size BIGINT NOT NULL,
+	chunk_size BIGINT NOT NULL,
+	total_chunks BIGINT NOT NULL,
+	received_chunks BYTEA,
+	zone_id TEXT NOT NULL DEFAULT '',
+	target_path TEXT NOT NULL,
+	temp_dir TEXT NOT NULL,
+	owner_id TEXT NOT NULL,
+	owner_username TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires ON upload_sessions(expires_at);
+
+-- Unique only where set
+CREATE UNIQUE INDEX IF NOT EXISTS idx_share_links_slug ON share_links(slug) WHERE slug IS NOT NULL AND slug != '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_id ON sessions(id) WHERE id IS NOT NULL;
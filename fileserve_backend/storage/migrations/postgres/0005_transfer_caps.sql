@@ -0,0 +1,10 @@
+-- Transfer caps: the bytes a user, zone or share link may upload and download in a calendar
+-- month. What was transferred is recorded in daily_stats.
+
+CREATE TABLE IF NOT EXISTS transfer_caps (
+	object_type TEXT NOT NULL,
+	object_id TEXT NOT NULL,
+	monthly_bytes BIGINT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (object_type, object_id)
+);
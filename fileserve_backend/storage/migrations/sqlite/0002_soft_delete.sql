@@ -0,0 +1,12 @@
+-- Soft delete for administrative objects. Deleted rows keep their data for
+-- models.SoftDeleteRetentionDays and are hidden from every lookup until restored or purged.
+
+ALTER TABLE storage_pools ADD COLUMN deleted_at DATETIME;
+ALTER TABLE share_zones ADD COLUMN deleted_at DATETIME;
+ALTER TABLE shares ADD COLUMN deleted_at DATETIME;
+ALTER TABLE share_links ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_storage_pools_deleted ON storage_pools(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_share_zones_deleted ON share_zones(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_shares_deleted ON shares(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_share_links_deleted ON share_links(deleted_at);
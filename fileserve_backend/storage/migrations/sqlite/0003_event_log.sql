@@ -0,0 +1,17 @@
+-- Event log: every event published on the event bus except transient progress updates,
+-- kept for the configured retention period. It backs the activity feed.
+
+CREATE TABLE IF NOT EXISTS event_log (
+	id TEXT PRIMARY KEY,
+	type TEXT NOT NULL,
+	actor TEXT NOT NULL DEFAULT '',
+	object_type TEXT NOT NULL DEFAULT '',
+	object_id TEXT NOT NULL DEFAULT '',
+	payload TEXT NOT NULL DEFAULT 'null',
+	recipients TEXT NOT NULL DEFAULT '[]',
+	admin_only INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_event_log_created_at ON event_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_event_log_type ON event_log(type, created_at);
+CREATE INDEX IF NOT EXISTS idx_event_log_object ON event_log(object_type, object_id);
@@ -0,0 +1,12 @@
+-- Daily statistics: one value per day of each dashboard metric of the server, a pool or a zone,
+-- so admin charts can show trends. Server-wide rows have an empty object type and ID.
+
+CREATE TABLE IF NOT EXISTS daily_stats (
+	day TEXT NOT NULL,
+	metric TEXT NOT NULL,
+	object_type TEXT NOT NULL DEFAULT '',
+	object_id TEXT NOT NULL DEFAULT '',
+	value INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (day, metric, object_type, object_id)
+);
+CREATE INDEX IF NOT EXISTS idx_daily_stats_metric ON daily_stats(metric, object_type, object_id, day);
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// PostgresStore implements the Store interface on Postgres, for deployments that already run
+// Postgres or share one database between several instances. It runs the queries of SQLiteStore,
+// which its database handle rewrites for Postgres.
+type PostgresStore struct {
+	*SQLiteStore
+}
+
+// NewPostgresStore connects to a Postgres database given as a URL or keyword/value
+// connection string and applies pending schema migrations
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Set connection pool settings
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(10)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	store := &PostgresStore{&SQLiteStore{db: newSQLDB(db, dialectPostgres)}}
+
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return store, nil
+}
+
+// WithContext returns the store running its queries under ctx
+func (s *PostgresStore) WithContext(ctx context.Context) DataStore {
+	return &PostgresStore{s.SQLiteStore.withContext(ctx)}
+}
+
+// WithTx runs fn in a transaction, committed when fn returns nil and rolled back otherwise
+func (s *PostgresStore) WithTx(fn func(tx DataStore) error) error {
+	return s.SQLiteStore.withTx(func(tx *SQLiteStore) error {
+		return fn(&PostgresStore{tx})
+	})
+}
+
+var sqliteColumnTypes = regexp.MustCompile(`\b(INTEGER|DATETIME|BLOB|REAL)\b`)
+
+// postgresColumnType translates the SQLite column types of a column definition
+func postgresColumnType(definition string) string {
+	return sqliteColumnTypes.ReplaceAllStringFunc(definition, func(t string) string {
+		switch t {
+		case "INTEGER":
+			return "BIGINT"
+		case "DATETIME":
+			return "TIMESTAMPTZ"
+		case "BLOB":
+			return "BYTEA"
+		default:
+			return "DOUBLE PRECISION"
+		}
+	})
+}
+
+// buildTSQuery turns search text into a Postgres text search query matching every word as a
+// prefix, like buildFTSMatch does for SQLite
+func buildTSQuery(text string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `'`, `''`)
+	var terms []string
+	for _, term := range strings.Fields(text) {
+		terms = append(terms, "'"+escape.Replace(term)+"':*")
+	}
+	return strings.Join(terms, " & ")
+}
+
+// Postgres databases are backed up with pg_dump rather than through the server
+
+func (s *PostgresStore) BackupDatabase(dest string) error {
+	return errors.New("database backups require SQLite storage, back up Postgres with pg_dump")
+}
+
+func (s *PostgresStore) StageDatabaseRestore(src string) error {
+	return errors.New("database restores require SQLite storage, restore Postgres with pg_restore")
+}
+
+func (s *PostgresStore) CancelDatabaseRestore() error {
+	return errors.New("database restores require SQLite storage")
+}
+
+func (s *PostgresStore) DatabaseRestorePending() bool {
+	return false
+}
@@ -1,12 +1,15 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"fileserv/models"
 
@@ -16,11 +19,16 @@ import (
 
 // SQLiteStore implements the Store interface using SQLite for persistent storage
 type SQLiteStore struct {
-	db *sql.DB
+	db   *sqlDB
+	path string // Database file, empty for other dialects
 }
 
 // NewSQLiteStore creates a new SQLite-backed store
 func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	if err := applyStagedRestore(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to restore database: %w", err)
+	}
+
 	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)&_pragma=cache_size(-64000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -31,11 +39,11 @@ func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
 	db.SetMaxIdleConns(10)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	store := &SQLiteStore{db: db}
+	store := &SQLiteStore{db: newSQLDB(db, dialectSQLite), path: dbPath}
 
-	if err := store.initSchema(); err != nil {
+	if err := store.migrate(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
 	return store, nil
@@ -46,193 +54,45 @@ func (s *SQLiteStore) Close() error {
 	return s.db.Close()
 }
 
-// initSchema creates all tables and indexes
-func (s *SQLiteStore) initSchema() error {
-	schema := `
-	-- Users table
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		username TEXT UNIQUE NOT NULL,
-		password_hash TEXT NOT NULL,
-		email TEXT,
-		is_admin INTEGER NOT NULL DEFAULT 0,
-		groups TEXT DEFAULT '[]',
-		must_change_password INTEGER NOT NULL DEFAULT 0,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL
-	);
-	CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
-
-	-- Sessions table
-	CREATE TABLE IF NOT EXISTS sessions (
-		token TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL,
-		expires_at DATETIME NOT NULL,
-		created_at DATETIME NOT NULL,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-	CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
-	CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
-
-	-- Permissions table
-	CREATE TABLE IF NOT EXISTS permissions (
-		id TEXT PRIMARY KEY,
-		path TEXT NOT NULL,
-		type TEXT NOT NULL,
-		username TEXT,
-		group_name TEXT,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL
-	);
-	CREATE INDEX IF NOT EXISTS idx_permissions_path ON permissions(path);
-	CREATE INDEX IF NOT EXISTS idx_permissions_username ON permissions(username);
-	CREATE INDEX IF NOT EXISTS idx_permissions_group ON permissions(group_name);
-
-	-- Shares table (SMB/NFS)
-	CREATE TABLE IF NOT EXISTS shares (
-		id TEXT PRIMARY KEY,
-		name TEXT UNIQUE NOT NULL,
-		path TEXT NOT NULL,
-		protocol TEXT NOT NULL,
-		description TEXT,
-		enabled INTEGER NOT NULL DEFAULT 1,
-		zone_id TEXT,
-		owner_id TEXT,
-		allowed_users TEXT DEFAULT '[]',
-		allowed_groups TEXT DEFAULT '[]',
-		deny_users TEXT DEFAULT '[]',
-		deny_groups TEXT DEFAULT '[]',
-		guest_access INTEGER NOT NULL DEFAULT 0,
-		read_only INTEGER NOT NULL DEFAULT 0,
-		browsable INTEGER NOT NULL DEFAULT 1,
-		smb_options TEXT,
-		nfs_options TEXT,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL
-	);
-	CREATE INDEX IF NOT EXISTS idx_shares_name ON shares(name);
-	CREATE INDEX IF NOT EXISTS idx_shares_protocol ON shares(protocol);
-
-	-- Storage pools table
-	CREATE TABLE IF NOT EXISTS storage_pools (
-		id TEXT PRIMARY KEY,
-		name TEXT UNIQUE NOT NULL,
-		path TEXT NOT NULL,
-		description TEXT,
-		enabled INTEGER NOT NULL DEFAULT 1,
-		total_space INTEGER NOT NULL DEFAULT 0,
-		used_space INTEGER NOT NULL DEFAULT 0,
-		free_space INTEGER NOT NULL DEFAULT 0,
-		reserved INTEGER NOT NULL DEFAULT 0,
-		max_file_size INTEGER NOT NULL DEFAULT 0,
-		allowed_types TEXT DEFAULT '[]',
-		denied_types TEXT DEFAULT '[]',
-		default_user_quota INTEGER NOT NULL DEFAULT 0,
-		default_group_quota INTEGER NOT NULL DEFAULT 0,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL
-	);
-	CREATE INDEX IF NOT EXISTS idx_storage_pools_name ON storage_pools(name);
-
-	-- Share zones table
-	CREATE TABLE IF NOT EXISTS share_zones (
-		id TEXT PRIMARY KEY,
-		pool_id TEXT NOT NULL,
-		name TEXT UNIQUE NOT NULL,
-		path TEXT NOT NULL,
-		description TEXT,
-		zone_type TEXT NOT NULL DEFAULT 'group',
-		enabled INTEGER NOT NULL DEFAULT 1,
-		auto_provision INTEGER NOT NULL DEFAULT 0,
-		provision_template TEXT,
-		allowed_users TEXT DEFAULT '[]',
-		allowed_groups TEXT DEFAULT '[]',
-		deny_users TEXT DEFAULT '[]',
-		deny_groups TEXT DEFAULT '[]',
-		allow_network_shares INTEGER NOT NULL DEFAULT 1,
-		allow_web_shares INTEGER NOT NULL DEFAULT 1,
-		allow_guest_access INTEGER NOT NULL DEFAULT 0,
-		smb_enabled INTEGER NOT NULL DEFAULT 0,
-		nfs_enabled INTEGER NOT NULL DEFAULT 0,
-		smb_options TEXT,
-		nfs_options TEXT,
-		web_options TEXT,
-		max_quota_per_user INTEGER NOT NULL DEFAULT 0,
-		read_only INTEGER NOT NULL DEFAULT 0,
-		browsable INTEGER NOT NULL DEFAULT 1,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL,
-		FOREIGN KEY (pool_id) REFERENCES storage_pools(id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_share_zones_name ON share_zones(name);
-	CREATE INDEX IF NOT EXISTS idx_share_zones_pool_id ON share_zones(pool_id);
-	CREATE INDEX IF NOT EXISTS idx_share_zones_zone_type ON share_zones(zone_type);
-
-	-- Settings table (key-value configuration)
-	CREATE TABLE IF NOT EXISTS settings (
-		key TEXT PRIMARY KEY,
-		value TEXT NOT NULL,
-		type TEXT NOT NULL DEFAULT 'string',
-		category TEXT NOT NULL DEFAULT 'general',
-		updated_at DATETIME NOT NULL
-	);
-
-	-- Share links table (web sharing)
-	CREATE TABLE IF NOT EXISTS share_links (
-		id TEXT PRIMARY KEY,
-		share_id TEXT,
-		owner_id TEXT NOT NULL,
-		target_path TEXT NOT NULL,
-		target_type TEXT NOT NULL,
-		target_name TEXT NOT NULL,
-		token TEXT UNIQUE NOT NULL,
-		password_hash TEXT,
-		expires_at DATETIME,
-		max_downloads INTEGER NOT NULL DEFAULT 0,
-		download_count INTEGER NOT NULL DEFAULT 0,
-		max_views INTEGER NOT NULL DEFAULT 0,
-		view_count INTEGER NOT NULL DEFAULT 0,
-		allow_download INTEGER NOT NULL DEFAULT 1,
-		allow_preview INTEGER NOT NULL DEFAULT 1,
-		allow_upload INTEGER NOT NULL DEFAULT 0,
-		allow_listing INTEGER NOT NULL DEFAULT 0,
-		name TEXT,
-		description TEXT,
-		custom_message TEXT,
-		show_owner INTEGER NOT NULL DEFAULT 0,
-		enabled INTEGER NOT NULL DEFAULT 1,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL,
-		last_accessed DATETIME
-	);
-	CREATE INDEX IF NOT EXISTS idx_share_links_token ON share_links(token);
-	CREATE INDEX IF NOT EXISTS idx_share_links_owner_id ON share_links(owner_id);
-	CREATE INDEX IF NOT EXISTS idx_share_links_expires_at ON share_links(expires_at);
-
-	-- Snapshot policies table (automated ZFS snapshots)
-	CREATE TABLE IF NOT EXISTS snapshot_policies (
-		id TEXT PRIMARY KEY,
-		name TEXT UNIQUE NOT NULL,
-		dataset TEXT NOT NULL,
-		enabled INTEGER NOT NULL DEFAULT 1,
-		schedule TEXT NOT NULL,
-		retention INTEGER NOT NULL DEFAULT 7,
-		prefix TEXT NOT NULL DEFAULT 'auto',
-		recursive INTEGER NOT NULL DEFAULT 0,
-		last_run DATETIME,
-		next_run DATETIME,
-		last_error TEXT,
-		snapshot_count INTEGER NOT NULL DEFAULT 0,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL
-	);
-	CREATE INDEX IF NOT EXISTS idx_snapshot_policies_dataset ON snapshot_policies(dataset);
-	CREATE INDEX IF NOT EXISTS idx_snapshot_policies_enabled ON snapshot_policies(enabled);
-	CREATE INDEX IF NOT EXISTS idx_snapshot_policies_next_run ON snapshot_policies(next_run);
-	`
-
-	_, err := s.db.Exec(schema)
-	return err
+// WithContext returns the store running its queries under ctx. It shares the connection pool,
+// so closing either closes both.
+func (s *SQLiteStore) WithContext(ctx context.Context) DataStore {
+	return s.withContext(ctx)
+}
+
+func (s *SQLiteStore) withContext(ctx context.Context) *SQLiteStore {
+	bound := *s
+	bound.db = s.db.withContext(ctx)
+	return &bound
+}
+
+// WithTx runs fn in a transaction, committed when fn returns nil and rolled back otherwise.
+// Called on a store already in a transaction, fn runs in a nested one.
+func (s *SQLiteStore) WithTx(fn func(tx DataStore) error) error {
+	return s.withTx(func(tx *SQLiteStore) error {
+		return fn(tx)
+	})
+}
+
+func (s *SQLiteStore) withTx(fn func(tx *SQLiteStore) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	bound := *s
+	bound.db = tx.db
+	if err := fn(&bound); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetSlowQueryThreshold sets how long a query may take before it is logged, 0 to log none.
+// Stores bound with WithContext afterwards inherit it.
+func (s *SQLiteStore) SetSlowQueryThreshold(d time.Duration) {
+	s.db.slowQuery = d
 }
 
 // ============================================================================
@@ -241,14 +101,16 @@ func (s *SQLiteStore) initSchema() error {
 
 func (s *SQLiteStore) GetUserByUsername(username string) (*models.User, error) {
 	row := s.db.QueryRow(`
-		SELECT id, username, password_hash, email, is_admin, groups, must_change_password, created_at, updated_at
+		SELECT id, username, password_hash, email, is_admin, groups, must_change_password, created_at, updated_at,
+			is_guest, guest_zones, expires_at, invited_by
 		FROM users WHERE username = ?`, username)
 	return s.scanUser(row)
 }
 
 func (s *SQLiteStore) GetUserByID(id string) (*models.User, error) {
 	row := s.db.QueryRow(`
-		SELECT id, username, password_hash, email, is_admin, groups, must_change_password, created_at, updated_at
+		SELECT id, username, password_hash, email, is_admin, groups, must_change_password, created_at, updated_at,
+			is_guest, guest_zones, expires_at, invited_by
 		FROM users WHERE id = ?`, id)
 	return s.scanUser(row)
 }
@@ -256,10 +118,13 @@ func (s *SQLiteStore) GetUserByID(id string) (*models.User, error) {
 func (s *SQLiteStore) scanUser(row *sql.Row) (*models.User, error) {
 	var user models.User
 	var groupsJSON string
-	var isAdmin, mustChange int
+	var isAdmin, mustChange, isGuest int
+	var guestZonesJSON, invitedBy sql.NullString
+	var expiresAt sql.NullTime
 
 	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email,
-		&isAdmin, &groupsJSON, &mustChange, &user.CreatedAt, &user.UpdatedAt)
+		&isAdmin, &groupsJSON, &mustChange, &user.CreatedAt, &user.UpdatedAt,
+		&isGuest, &guestZonesJSON, &expiresAt, &invitedBy)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("user not found")
 	}
@@ -270,6 +135,14 @@ func (s *SQLiteStore) scanUser(row *sql.Row) (*models.User, error) {
 	user.IsAdmin = isAdmin == 1
 	user.MustChangePassword = mustChange == 1
 	json.Unmarshal([]byte(groupsJSON), &user.Groups)
+	user.IsGuest = isGuest == 1
+	if guestZonesJSON.Valid {
+		json.Unmarshal([]byte(guestZonesJSON.String), &user.GuestZones)
+	}
+	if expiresAt.Valid {
+		user.ExpiresAt = &expiresAt.Time
+	}
+	user.InvitedBy = invitedBy.String
 
 	return &user, nil
 }
@@ -302,7 +175,45 @@ func (s *SQLiteStore) CreateUser(username, password, email string, isAdmin bool,
 		user.ID, user.Username, user.PasswordHash, user.Email, isAdminInt, string(groupsJSON), user.CreatedAt, user.UpdatedAt)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if isUniqueViolation(err) {
+			return nil, errors.New("username already exists")
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CreateGuestUser creates a guest account limited to zones until expiresAt
+func (s *SQLiteStore) CreateGuestUser(username, password, email, invitedBy string, zones []string, expiresAt time.Time) (*models.User, error) {
+	user := &models.User{
+		ID:         uuid.New().String(),
+		Username:   username,
+		Email:      email,
+		Groups:     []string{},
+		IsGuest:    true,
+		GuestZones: zones,
+		ExpiresAt:  &expiresAt,
+		InvitedBy:  invitedBy,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+
+	zonesJSON, _ := json.Marshal(zones)
+
+	_, err := s.db.Exec(`
+		INSERT INTO users (id, username, password_hash, email, is_admin, groups, must_change_password, created_at, updated_at,
+			is_guest, guest_zones, expires_at, invited_by)
+		VALUES (?, ?, ?, ?, 0, '[]', 0, ?, ?, 1, ?, ?, ?)`,
+		user.ID, user.Username, user.PasswordHash, user.Email, user.CreatedAt, user.UpdatedAt,
+		string(zonesJSON), expiresAt, invitedBy)
+
+	if err != nil {
+		if isUniqueViolation(err) {
 			return nil, errors.New("username already exists")
 		}
 		return nil, err
@@ -341,9 +252,16 @@ func (s *SQLiteStore) UpdateUser(id string, updates map[string]interface{}) (*mo
 	if mustChange, ok := updates["must_change_password"].(bool); ok {
 		user.MustChangePassword = mustChange
 	}
+	if zones, ok := updates["guest_zones"].([]string); ok && user.IsGuest {
+		user.GuestZones = zones
+	}
+	if expiresAt, ok := updates["expires_at"].(time.Time); ok && user.IsGuest {
+		user.ExpiresAt = &expiresAt
+	}
 
 	user.UpdatedAt = time.Now()
 	groupsJSON, _ := json.Marshal(user.Groups)
+	guestZonesJSON, _ := json.Marshal(user.GuestZones)
 	isAdminInt := 0
 	if user.IsAdmin {
 		isAdminInt = 1
@@ -354,12 +272,14 @@ func (s *SQLiteStore) UpdateUser(id string, updates map[string]interface{}) (*mo
 	}
 
 	_, err = s.db.Exec(`
-		UPDATE users SET username=?, password_hash=?, email=?, is_admin=?, groups=?, must_change_password=?, updated_at=?
+		UPDATE users SET username=?, password_hash=?, email=?, is_admin=?, groups=?, must_change_password=?, updated_at=?,
+			guest_zones=?, expires_at=?
 		WHERE id=?`,
-		user.Username, user.PasswordHash, user.Email, isAdminInt, string(groupsJSON), mustChangeInt, user.UpdatedAt, id)
+		user.Username, user.PasswordHash, user.Email, isAdminInt, string(groupsJSON), mustChangeInt, user.UpdatedAt,
+		string(guestZonesJSON), user.ExpiresAt, id)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if isUniqueViolation(err) {
 			return nil, errors.New("username already exists")
 		}
 		return nil, err
@@ -377,12 +297,14 @@ func (s *SQLiteStore) DeleteUser(id string) error {
 	if rows == 0 {
 		return errors.New("user not found")
 	}
+	s.db.Exec("DELETE FROM passkeys WHERE user_id = ?", id)
 	return nil
 }
 
 func (s *SQLiteStore) ListUsers() []*models.User {
 	rows, err := s.db.Query(`
-		SELECT id, username, password_hash, email, is_admin, groups, must_change_password, created_at, updated_at
+		SELECT id, username, password_hash, email, is_admin, groups, must_change_password, created_at, updated_at,
+			is_guest, guest_zones, expires_at, invited_by
 		FROM users ORDER BY username`)
 	if err != nil {
 		return []*models.User{}
@@ -393,16 +315,27 @@ func (s *SQLiteStore) ListUsers() []*models.User {
 	for rows.Next() {
 		var user models.User
 		var groupsJSON string
-		var isAdmin, mustChange int
+		var isAdmin, mustChange, isGuest int
+		var guestZonesJSON, invitedBy sql.NullString
+		var expiresAt sql.NullTime
 
 		if err := rows.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email,
-			&isAdmin, &groupsJSON, &mustChange, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			&isAdmin, &groupsJSON, &mustChange, &user.CreatedAt, &user.UpdatedAt,
+			&isGuest, &guestZonesJSON, &expiresAt, &invitedBy); err != nil {
 			continue
 		}
 
 		user.IsAdmin = isAdmin == 1
 		user.MustChangePassword = mustChange == 1
 		json.Unmarshal([]byte(groupsJSON), &user.Groups)
+		user.IsGuest = isGuest == 1
+		if guestZonesJSON.Valid {
+			json.Unmarshal([]byte(guestZonesJSON.String), &user.GuestZones)
+		}
+		if expiresAt.Valid {
+			user.ExpiresAt = &expiresAt.Time
+		}
+		user.InvitedBy = invitedBy.String
 		users = append(users, &user)
 	}
 
@@ -413,20 +346,25 @@ func (s *SQLiteStore) ListUsers() []*models.User {
 // Session Operations
 // ============================================================================
 
-func (s *SQLiteStore) CreateSession(userID string, token string, expiresAt time.Time) error {
+func (s *SQLiteStore) CreateSession(session *models.Session) error {
 	_, err := s.db.Exec(`
-		INSERT INTO sessions (token, user_id, expires_at, created_at)
-		VALUES (?, ?, ?, ?)`,
-		token, userID, expiresAt, time.Now())
+		INSERT INTO sessions (token, user_id, expires_at, created_at, id, username, ip, user_agent, device,
+			impersonated_by, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.Token, session.UserID, session.ExpiresAt, session.CreatedAt, session.ID, session.Username,
+		session.IP, session.UserAgent, session.Device, session.ImpersonatedBy, session.LastSeen)
 	return err
 }
 
-func (s *SQLiteStore) GetSession(token string) (*models.Session, error) {
+const sessionColumns = `id, token, user_id, username, ip, user_agent, device, impersonated_by, expires_at, created_at, last_seen`
+
+func (s *SQLiteStore) scanSession(row rowScanner) (*models.Session, error) {
 	var session models.Session
-	err := s.db.QueryRow(`
-		SELECT token, user_id, expires_at, created_at FROM sessions WHERE token = ?`, token).
-		Scan(&session.Token, &session.UserID, &session.ExpiresAt, &session.CreatedAt)
+	var username, ip, userAgent, device, impersonatedBy sql.NullString
+	var lastSeen sql.NullTime
 
+	err := row.Scan(&session.ID, &session.Token, &session.UserID, &username, &ip, &userAgent, &device,
+		&impersonatedBy, &session.ExpiresAt, &session.CreatedAt, &lastSeen)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("session not found")
 	}
@@ -434,193 +372,702 @@ func (s *SQLiteStore) GetSession(token string) (*models.Session, error) {
 		return nil, err
 	}
 
+	session.Username = username.String
+	session.IP = ip.String
+	session.UserAgent = userAgent.String
+	session.Device = device.String
+	session.ImpersonatedBy = impersonatedBy.String
+	session.LastSeen = session.CreatedAt
+	if lastSeen.Valid {
+		session.LastSeen = lastSeen.Time
+	}
+	return &session, nil
+}
+
+// GetSession returns an unexpired session by ID
+func (s *SQLiteStore) GetSession(id string) (*models.Session, error) {
+	session, err := s.scanSession(s.db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+
 	if session.IsExpired() {
 		return nil, errors.New("session expired")
 	}
 
-	return &session, nil
+	return session, nil
 }
 
-func (s *SQLiteStore) DeleteSession(token string) error {
-	_, err := s.db.Exec("DELETE FROM sessions WHERE token = ?", token)
-	return err
+// ListSessionsByUser returns a user's unexpired sessions, most recently used first
+func (s *SQLiteStore) ListSessionsByUser(userID string) []*models.Session {
+	rows, err := s.db.Query(`SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = ? AND id IS NOT NULL AND expires_at > ?
+		ORDER BY COALESCE(last_seen, created_at) DESC`, userID, time.Now())
+	if err != nil {
+		return []*models.Session{}
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		session, err := s.scanSession(rows)
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
 }
 
-func (s *SQLiteStore) CleanExpiredSessions() error {
-	_, err := s.db.Exec("DELETE FROM sessions WHERE expires_at < ?", time.Now())
-	return err
+// RenewSession replaces the token of a refreshed session
+func (s *SQLiteStore) RenewSession(id, token string, expiresAt time.Time) error {
+	result, err := s.db.Exec("UPDATE sessions SET token = ?, expires_at = ? WHERE id = ?", token, expiresAt, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("session not found")
+	}
+	return nil
 }
 
-// ============================================================================
-// Permission Operations
-// ============================================================================
+// TouchSession records when and from where a session was last used
+func (s *SQLiteStore) TouchSession(id, ip string, lastSeen time.Time) error {
+	_, err := s.db.Exec("UPDATE sessions SET ip = ?, last_seen = ? WHERE id = ?", ip, lastSeen, id)
+	return err
+}
 
-func (s *SQLiteStore) CreatePermission(path string, permType models.PermissionType, username, group string) (*models.Permission, error) {
-	perm := models.Permission{
-		ID:        uuid.New().String(),
-		Path:      path,
-		Type:      permType,
-		Username:  username,
-		Group:     group,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+// RevokeSession deletes a session and adds it to the token denylist until its token expires
+func (s *SQLiteStore) RevokeSession(session *models.Session) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	_, err := s.db.Exec(`
-		INSERT INTO permissions (id, path, type, username, group_name, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		perm.ID, perm.Path, perm.Type, perm.Username, perm.Group, perm.CreatedAt, perm.UpdatedAt)
+	if _, err := tx.Exec("DELETE FROM sessions WHERE id = ?", session.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO revoked_sessions (id, user_id, revoked_at, expires_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			user_id=excluded.user_id, revoked_at=excluded.revoked_at, expires_at=excluded.expires_at`,
+		session.ID, session.UserID, time.Now(), session.ExpiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
+// ListRevokedSessions returns the denylisted session IDs with the expiry of their tokens
+func (s *SQLiteStore) ListRevokedSessions() map[string]time.Time {
+	revoked := make(map[string]time.Time)
+	rows, err := s.db.Query("SELECT id, expires_at FROM revoked_sessions WHERE expires_at > ?", time.Now())
 	if err != nil {
-		return nil, err
+		return revoked
 	}
+	defer rows.Close()
 
-	return &perm, nil
+	for rows.Next() {
+		var id string
+		var expiresAt time.Time
+		if err := rows.Scan(&id, &expiresAt); err == nil {
+			revoked[id] = expiresAt
+		}
+	}
+	return revoked
 }
 
-func (s *SQLiteStore) DeletePermission(id string) error {
-	result, err := s.db.Exec("DELETE FROM permissions WHERE id = ?", id)
+func (s *SQLiteStore) DeleteSession(id string) error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE id = ?", id)
+	return err
+}
+
+// CleanExpiredSessions removes expired sessions and denylist entries and returns the number of
+// sessions removed
+func (s *SQLiteStore) CleanExpiredSessions() (int, error) {
+	result, err := s.db.Exec("DELETE FROM sessions WHERE expires_at < ?", time.Now())
 	if err != nil {
+		return 0, err
+	}
+	removed, _ := result.RowsAffected()
+	_, err = s.db.Exec("DELETE FROM revoked_sessions WHERE expires_at < ?", time.Now())
+	return int(removed), err
+}
+
+// ============================================================================
+// Password History Operations
+// ============================================================================
+
+// AddPasswordHistory records a new password of a user and keeps only the newest keep entries
+func (s *SQLiteStore) AddPasswordHistory(entry *models.PasswordHistoryEntry, keep int) error {
+	if _, err := s.db.Exec(`
+		INSERT INTO password_history (username, password_hash, changed_at) VALUES (?, ?, ?)`,
+		entry.Username, entry.PasswordHash, entry.ChangedAt); err != nil {
 		return err
 	}
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return errors.New("permission not found")
+
+	_, err := s.db.Exec(`
+		DELETE FROM password_history WHERE username = ? AND id NOT IN (
+			SELECT id FROM password_history WHERE username = ? ORDER BY changed_at DESC, id DESC LIMIT ?
+		)`, entry.Username, entry.Username, max(keep, 1))
+	return err
+}
+
+// ListPasswordHistory returns the recorded passwords of a user, newest first
+func (s *SQLiteStore) ListPasswordHistory(username string) []*models.PasswordHistoryEntry {
+	rows, err := s.db.Query(`
+		SELECT username, password_hash, changed_at FROM password_history
+		WHERE username = ? ORDER BY changed_at DESC, id DESC`, username)
+	if err != nil {
+		return []*models.PasswordHistoryEntry{}
 	}
-	return nil
+	defer rows.Close()
+
+	entries := []*models.PasswordHistoryEntry{}
+	for rows.Next() {
+		var entry models.PasswordHistoryEntry
+		if err := rows.Scan(&entry.Username, &entry.PasswordHash, &entry.ChangedAt); err != nil {
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	return entries
 }
 
-func (s *SQLiteStore) UpdatePermission(id string, path string, permType models.PermissionType, username, group string) (*models.Permission, error) {
-	now := time.Now()
+// ============================================================================
+// Security Event Operations
+// ============================================================================
 
-	// Build dynamic update
-	updates := []string{"updated_at = ?"}
-	args := []interface{}{now}
+func (s *SQLiteStore) AddSecurityEvent(event *models.SecurityEvent) error {
+	return s.db.QueryRow(`
+		INSERT INTO security_events (type, source, actor, target, ip, message, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		string(event.Type), event.Source, event.Actor, event.Target, event.IP, event.Message, event.CreatedAt).
+		Scan(&event.ID)
+}
 
-	if path != "" {
-		updates = append(updates, "path = ?")
-		args = append(args, path)
+// ListSecurityEvents returns the events matching filter, newest first, and the number of
+// matching events before Limit and Offset are applied
+func (s *SQLiteStore) ListSecurityEvents(filter models.SecurityEventFilter) ([]*models.SecurityEvent, int) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+	if filter.Type != "" {
+		where = append(where, "type = ?")
+		args = append(args, string(filter.Type))
 	}
-	if permType != "" {
-		updates = append(updates, "type = ?")
-		args = append(args, permType)
+	if filter.Actor != "" {
+		where = append(where, "LOWER(actor) = LOWER(?)")
+		args = append(args, filter.Actor)
 	}
-	if username != "" {
-		updates = append(updates, "username = ?", "group_name = ''")
-		args = append(args, username)
+	if filter.IP != "" {
+		where = append(where, "ip = ?")
+		args = append(args, filter.IP)
 	}
-	if group != "" {
-		updates = append(updates, "group_name = ?", "username = ''")
-		args = append(args, group)
+	if !filter.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.Until)
 	}
+	clause := strings.Join(where, " AND ")
 
-	args = append(args, id)
-	query := fmt.Sprintf("UPDATE permissions SET %s WHERE id = ?", strings.Join(updates, ", "))
+	var total int
+	s.db.QueryRow(`SELECT COUNT(*) FROM security_events WHERE `+clause, args...).Scan(&total)
 
-	result, err := s.db.Exec(query, args...)
+	query := `SELECT id, type, source, actor, target, ip, message, created_at FROM security_events
+		WHERE ` + clause + ` ORDER BY created_at DESC, id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return []*models.SecurityEvent{}, total
 	}
+	defer rows.Close()
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return nil, errors.New("permission not found")
+	events := []*models.SecurityEvent{}
+	for rows.Next() {
+		var event models.SecurityEvent
+		var eventType string
+		if err := rows.Scan(&event.ID, &eventType, &event.Source, &event.Actor, &event.Target, &event.IP,
+			&event.Message, &event.CreatedAt); err != nil {
+			continue
+		}
+		event.Type = models.SecurityEventType(eventType)
+		events = append(events, &event)
 	}
+	return events, total
+}
 
-	// Fetch and return updated permission
-	var perm models.Permission
-	err = s.db.QueryRow(`
-		SELECT id, path, type, username, group_name, created_at, updated_at
-		FROM permissions WHERE id = ?`, id).
-		Scan(&perm.ID, &perm.Path, &perm.Type, &perm.Username, &perm.Group, &perm.CreatedAt, &perm.UpdatedAt)
-
-	return &perm, err
+// DeleteSecurityEventsBefore removes events older than before
+func (s *SQLiteStore) DeleteSecurityEventsBefore(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM security_events WHERE created_at < ?", before)
+	return err
 }
 
-func (s *SQLiteStore) ListPermissions() []models.Permission {
-	return s.GetPermissions()
+// ============================================================================
+// Event Log Operations
+// ============================================================================
+
+func (s *SQLiteStore) AddEventLogEntry(entry *models.EventLogEntry) error {
+	payload := entry.Payload
+	if payload == nil {
+		payload = json.RawMessage("null")
+	}
+	recipients := entry.Recipients
+	if recipients == nil {
+		recipients = []string{}
+	}
+	recipientsJSON, _ := json.Marshal(recipients)
+	_, err := s.db.Exec(`
+		INSERT INTO event_log (id, type, actor, object_type, object_id, payload, recipients, admin_only, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.ID, entry.Type, entry.Actor, entry.ObjectType, entry.ObjectID, string(payload),
+		string(recipientsJSON), entry.AdminOnly, entry.CreatedAt)
+	return err
 }
 
-func (s *SQLiteStore) GetPermissions() []models.Permission {
-	rows, err := s.db.Query(`
-		SELECT id, path, type, username, group_name, created_at, updated_at
-		FROM permissions ORDER BY path`)
+// ListEventLog returns the events matching filter, newest first, and the number of matching
+// events before Limit and Offset are applied
+func (s *SQLiteStore) ListEventLog(filter models.EventLogFilter) ([]*models.EventLogEntry, int) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+	if filter.Type != "" {
+		if strings.Contains(filter.Type, ".") {
+			where = append(where, "type = ?")
+			args = append(args, filter.Type)
+		} else {
+			where = append(where, "type LIKE ?")
+			args = append(args, filter.Type+".%")
+		}
+	}
+	if len(filter.Types) > 0 {
+		where = append(where, "type IN (?"+strings.Repeat(", ?", len(filter.Types)-1)+")")
+		for _, t := range filter.Types {
+			args = append(args, t)
+		}
+	}
+	if filter.Actor != "" {
+		where = append(where, "LOWER(actor) = LOWER(?)")
+		args = append(args, filter.Actor)
+	}
+	if filter.ObjectType != "" {
+		where = append(where, "object_type = ?")
+		args = append(args, filter.ObjectType)
+	}
+	if filter.ObjectID != "" {
+		where = append(where, "object_id = ?")
+		args = append(args, filter.ObjectID)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.Until)
+	}
+	if filter.VisibleTo != "" {
+		where = append(where, "admin_only = 0 AND (recipients = '[]' OR recipients LIKE ?)")
+		args = append(args, `%"`+filter.VisibleTo+`"%`)
+	}
+	if filter.Recipient != "" {
+		where = append(where, "recipients LIKE ?")
+		args = append(args, `%"`+filter.Recipient+`"%`)
+	}
+	clause := strings.Join(where, " AND ")
+
+	var total int
+	s.db.QueryRow(`SELECT COUNT(*) FROM event_log WHERE `+clause, args...).Scan(&total)
+
+	query := `SELECT id, type, actor, object_type, object_id, payload, recipients, admin_only, created_at
+		FROM event_log WHERE ` + clause + ` ORDER BY created_at DESC, id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return []models.Permission{}
+		return []*models.EventLogEntry{}, total
 	}
 	defer rows.Close()
 
-	var perms []models.Permission
+	entries := []*models.EventLogEntry{}
 	for rows.Next() {
-		var perm models.Permission
-		if err := rows.Scan(&perm.ID, &perm.Path, &perm.Type, &perm.Username, &perm.Group, &perm.CreatedAt, &perm.UpdatedAt); err != nil {
+		var entry models.EventLogEntry
+		var payload, recipients string
+		var adminOnly int
+		if err := rows.Scan(&entry.ID, &entry.Type, &entry.Actor, &entry.ObjectType, &entry.ObjectID,
+			&payload, &recipients, &adminOnly, &entry.CreatedAt); err != nil {
 			continue
 		}
-		perms = append(perms, perm)
+		if payload != "null" {
+			entry.Payload = json.RawMessage(payload)
+		}
+		json.Unmarshal([]byte(recipients), &entry.Recipients)
+		entry.AdminOnly = adminOnly == 1
+		entries = append(entries, &entry)
 	}
+	return entries, total
+}
 
-	return perms
+// DeleteEventLogBefore removes events older than before and returns how many were removed
+func (s *SQLiteStore) DeleteEventLogBefore(before time.Time) (int, error) {
+	result, err := s.db.Exec("DELETE FROM event_log WHERE created_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
 }
 
 // ============================================================================
-// Share Operations
+// Passkey Operations
 // ============================================================================
 
-func (s *SQLiteStore) CreateShare(share *models.Share) (*models.Share, error) {
-	share.ID = uuid.New().String()
-	now := time.Now()
-	share.CreatedAt = now
-	share.UpdatedAt = now
+func (s *SQLiteStore) CreatePasskey(passkey *models.Passkey) error {
+	_, err := s.db.Exec(`
+		INSERT INTO passkeys (id, user_id, username, name, credential_id, public_key, sign_count, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		passkey.ID, passkey.UserID, passkey.Username, passkey.Name, passkey.CredentialID,
+		passkey.PublicKey, passkey.SignCount, passkey.CreatedAt)
+	return err
+}
 
-	allowedUsersJSON, _ := json.Marshal(share.AllowedUsers)
-	allowedGroupsJSON, _ := json.Marshal(share.AllowedGroups)
-	denyUsersJSON, _ := json.Marshal(share.DenyUsers)
-	denyGroupsJSON, _ := json.Marshal(share.DenyGroups)
-	smbOptionsJSON, _ := json.Marshal(share.SMBOptions)
-	nfsOptionsJSON, _ := json.Marshal(share.NFSOptions)
+const passkeyColumns = `id, user_id, username, name, credential_id, public_key, sign_count, created_at, last_used`
 
-	_, err := s.db.Exec(`
-		INSERT INTO shares (id, name, path, protocol, description, enabled, zone_id, owner_id,
-			allowed_users, allowed_groups, deny_users, deny_groups, guest_access, read_only, browsable,
-			smb_options, nfs_options, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		share.ID, share.Name, share.Path, share.Protocol, share.Description,
-		boolToInt(share.Enabled), share.ZoneID, share.OwnerID,
-		string(allowedUsersJSON), string(allowedGroupsJSON), string(denyUsersJSON), string(denyGroupsJSON),
-		boolToInt(share.GuestAccess), boolToInt(share.ReadOnly), boolToInt(share.Browsable),
-		string(smbOptionsJSON), string(nfsOptionsJSON), share.CreatedAt, share.UpdatedAt)
+func (s *SQLiteStore) scanPasskey(row rowScanner) (*models.Passkey, error) {
+	var passkey models.Passkey
+	var lastUsed sql.NullTime
 
+	err := row.Scan(&passkey.ID, &passkey.UserID, &passkey.Username, &passkey.Name, &passkey.CredentialID,
+		&passkey.PublicKey, &passkey.SignCount, &passkey.CreatedAt, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("passkey not found")
+	}
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return nil, errors.New("share name already exists")
-		}
 		return nil, err
 	}
 
-	return share, nil
+	if lastUsed.Valid {
+		passkey.LastUsed = &lastUsed.Time
+	}
+	return &passkey, nil
 }
 
-func (s *SQLiteStore) GetShare(id string) (*models.Share, error) {
-	return s.scanShare(s.db.QueryRow(`
-		SELECT id, name, path, protocol, description, enabled, zone_id, owner_id,
-			allowed_users, allowed_groups, deny_users, deny_groups, guest_access, read_only, browsable,
-			smb_options, nfs_options, created_at, updated_at
-		FROM shares WHERE id = ?`, id))
+func (s *SQLiteStore) GetPasskey(id string) (*models.Passkey, error) {
+	return s.scanPasskey(s.db.QueryRow(`SELECT `+passkeyColumns+` FROM passkeys WHERE id = ?`, id))
 }
 
-func (s *SQLiteStore) GetShareByName(name string) (*models.Share, error) {
-	return s.scanShare(s.db.QueryRow(`
-		SELECT id, name, path, protocol, description, enabled, zone_id, owner_id,
-			allowed_users, allowed_groups, deny_users, deny_groups, guest_access, read_only, browsable,
-			smb_options, nfs_options, created_at, updated_at
-		FROM shares WHERE name = ?`, name))
+// GetPasskeyByCredentialID finds a passkey by the base64url credential ID the browser sends
+func (s *SQLiteStore) GetPasskeyByCredentialID(credentialID string) (*models.Passkey, error) {
+	return s.scanPasskey(s.db.QueryRow(`SELECT `+passkeyColumns+` FROM passkeys WHERE credential_id = ?`, credentialID))
 }
 
-func (s *SQLiteStore) scanShare(row *sql.Row) (*models.Share, error) {
-	var share models.Share
-	var enabled, guestAccess, readOnly, browsable int
-	var zoneID, ownerID sql.NullString
-	var allowedUsersJSON, allowedGroupsJSON, denyUsersJSON, denyGroupsJSON string
+func (s *SQLiteStore) ListPasskeysByUser(userID string) []*models.Passkey {
+	rows, err := s.db.Query(`SELECT `+passkeyColumns+` FROM passkeys WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return []*models.Passkey{}
+	}
+	defer rows.Close()
+
+	passkeys := []*models.Passkey{}
+	for rows.Next() {
+		passkey, err := s.scanPasskey(rows)
+		if err != nil {
+			continue
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	return passkeys
+}
+
+// UpdatePasskeyUsage records a sign-in with a passkey and the authenticator's signature counter
+func (s *SQLiteStore) UpdatePasskeyUsage(id string, signCount uint32, lastUsed time.Time) error {
+	_, err := s.db.Exec("UPDATE passkeys SET sign_count = ?, last_used = ? WHERE id = ?", signCount, lastUsed, id)
+	return err
+}
+
+func (s *SQLiteStore) DeletePasskey(id string) error {
+	result, err := s.db.Exec("DELETE FROM passkeys WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("passkey not found")
+	}
+	return nil
+}
+
+// ============================================================================
+// Lockout Operations
+// ============================================================================
+
+func (s *SQLiteStore) GetLockout(key string) (*models.Lockout, error) {
+	var l models.Lockout
+	var scope string
+	var lockedUntil sql.NullTime
+
+	err := s.db.QueryRow(`
+		SELECT key, scope, subject, failures, locked_until, last_failure FROM auth_lockouts WHERE key = ?`, key).
+		Scan(&l.Key, &scope, &l.Subject, &l.Failures, &lockedUntil, &l.LastFailure)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("lockout not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	l.Scope = models.LockoutScope(scope)
+	if lockedUntil.Valid {
+		l.LockedUntil = &lockedUntil.Time
+	}
+	return &l, nil
+}
+
+func (s *SQLiteStore) SaveLockout(l *models.Lockout) error {
+	_, err := s.db.Exec(`
+		INSERT INTO auth_lockouts (key, scope, subject, failures, locked_until, last_failure)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			failures=excluded.failures, locked_until=excluded.locked_until, last_failure=excluded.last_failure`,
+		l.Key, string(l.Scope), l.Subject, l.Failures, l.LockedUntil, l.LastFailure)
+	return err
+}
+
+func (s *SQLiteStore) DeleteLockout(key string) error {
+	result, err := s.db.Exec("DELETE FROM auth_lockouts WHERE key = ?", key)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("lockout not found")
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) ListLockouts() []*models.Lockout {
+	rows, err := s.db.Query(`
+		SELECT key, scope, subject, failures, locked_until, last_failure FROM auth_lockouts ORDER BY last_failure DESC`)
+	if err != nil {
+		return []*models.Lockout{}
+	}
+	defer rows.Close()
+
+	lockouts := []*models.Lockout{}
+	for rows.Next() {
+		var l models.Lockout
+		var scope string
+		var lockedUntil sql.NullTime
+		if err := rows.Scan(&l.Key, &scope, &l.Subject, &l.Failures, &lockedUntil, &l.LastFailure); err != nil {
+			continue
+		}
+		l.Scope = models.LockoutScope(scope)
+		if lockedUntil.Valid {
+			l.LockedUntil = &lockedUntil.Time
+		}
+		lockouts = append(lockouts, &l)
+	}
+	return lockouts
+}
+
+func (s *SQLiteStore) ClearLockouts() error {
+	_, err := s.db.Exec("DELETE FROM auth_lockouts")
+	return err
+}
+
+// CleanStaleLockouts removes counters with no recent failures and no active lock
+func (s *SQLiteStore) CleanStaleLockouts(before time.Time) error {
+	_, err := s.db.Exec(`
+		DELETE FROM auth_lockouts WHERE last_failure < ? AND (locked_until IS NULL OR locked_until < ?)`,
+		before, time.Now())
+	return err
+}
+
+// ============================================================================
+// Permission Operations
+// ============================================================================
+
+func (s *SQLiteStore) CreatePermission(path string, permType models.PermissionType, username, group string) (*models.Permission, error) {
+	perm := models.Permission{
+		ID:        uuid.New().String(),
+		Path:      path,
+		Type:      permType,
+		Username:  username,
+		Group:     group,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO permissions (id, path, type, username, group_name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		perm.ID, perm.Path, perm.Type, perm.Username, perm.Group, perm.CreatedAt, perm.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &perm, nil
+}
+
+func (s *SQLiteStore) DeletePermission(id string) error {
+	result, err := s.db.Exec("DELETE FROM permissions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return errors.New("permission not found")
+	}
+	return nil
+}
+
+func (s *SQLiteStore) UpdatePermission(id string, path string, permType models.PermissionType, username, group string) (*models.Permission, error) {
+	now := time.Now()
+
+	// Build dynamic update
+	updates := []string{"updated_at = ?"}
+	args := []interface{}{now}
+
+	if path != "" {
+		updates = append(updates, "path = ?")
+		args = append(args, path)
+	}
+	if permType != "" {
+		updates = append(updates, "type = ?")
+		args = append(args, permType)
+	}
+	if username != "" {
+		updates = append(updates, "username = ?", "group_name = ''")
+		args = append(args, username)
+	}
+	if group != "" {
+		updates = append(updates, "group_name = ?", "username = ''")
+		args = append(args, group)
+	}
+
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE permissions SET %s WHERE id = ?", strings.Join(updates, ", "))
+
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return nil, errors.New("permission not found")
+	}
+
+	// Fetch and return updated permission
+	var perm models.Permission
+	err = s.db.QueryRow(`
+		SELECT id, path, type, username, group_name, created_at, updated_at
+		FROM permissions WHERE id = ?`, id).
+		Scan(&perm.ID, &perm.Path, &perm.Type, &perm.Username, &perm.Group, &perm.CreatedAt, &perm.UpdatedAt)
+
+	return &perm, err
+}
+
+func (s *SQLiteStore) ListPermissions() []models.Permission {
+	return s.GetPermissions()
+}
+
+func (s *SQLiteStore) GetPermissions() []models.Permission {
+	rows, err := s.db.Query(`
+		SELECT id, path, type, username, group_name, created_at, updated_at
+		FROM permissions ORDER BY path`)
+	if err != nil {
+		return []models.Permission{}
+	}
+	defer rows.Close()
+
+	var perms []models.Permission
+	for rows.Next() {
+		var perm models.Permission
+		if err := rows.Scan(&perm.ID, &perm.Path, &perm.Type, &perm.Username, &perm.Group, &perm.CreatedAt, &perm.UpdatedAt); err != nil {
+			continue
+		}
+		perms = append(perms, perm)
+	}
+
+	return perms
+}
+
+// ============================================================================
+// Share Operations
+// ============================================================================
+
+func (s *SQLiteStore) CreateShare(share *models.Share) (*models.Share, error) {
+	share.ID = uuid.New().String()
+	now := time.Now()
+	share.CreatedAt = now
+	share.UpdatedAt = now
+
+	allowedUsersJSON, _ := json.Marshal(share.AllowedUsers)
+	allowedGroupsJSON, _ := json.Marshal(share.AllowedGroups)
+	denyUsersJSON, _ := json.Marshal(share.DenyUsers)
+	denyGroupsJSON, _ := json.Marshal(share.DenyGroups)
+	smbOptionsJSON, _ := json.Marshal(share.SMBOptions)
+	nfsOptionsJSON, _ := json.Marshal(share.NFSOptions)
+
+	if s.heldByDeleted("shares", "name", share.Name) {
+		return nil, errors.New("share name belongs to a deleted share, restore or purge it first")
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO shares (id, name, path, protocol, description, enabled, zone_id, owner_id,
+			allowed_users, allowed_groups, deny_users, deny_groups, guest_access, read_only, browsable,
+			smb_options, nfs_options, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		share.ID, share.Name, share.Path, share.Protocol, share.Description,
+		boolToInt(share.Enabled), share.ZoneID, share.OwnerID,
+		string(allowedUsersJSON), string(allowedGroupsJSON), string(denyUsersJSON), string(denyGroupsJSON),
+		boolToInt(share.GuestAccess), boolToInt(share.ReadOnly), boolToInt(share.Browsable),
+		string(smbOptionsJSON), string(nfsOptionsJSON), share.CreatedAt, share.UpdatedAt)
+
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("share name already exists")
+		}
+		return nil, err
+	}
+
+	return share, nil
+}
+
+func (s *SQLiteStore) GetShare(id string) (*models.Share, error) {
+	return s.scanShare(s.db.QueryRow(`
+		SELECT id, name, path, protocol, description, enabled, zone_id, owner_id,
+			allowed_users, allowed_groups, deny_users, deny_groups, guest_access, read_only, browsable,
+			smb_options, nfs_options, created_at, updated_at
+		FROM shares WHERE id = ? AND deleted_at IS NULL`, id))
+}
+
+func (s *SQLiteStore) GetShareByName(name string) (*models.Share, error) {
+	return s.scanShare(s.db.QueryRow(`
+		SELECT id, name, path, protocol, description, enabled, zone_id, owner_id,
+			allowed_users, allowed_groups, deny_users, deny_groups, guest_access, read_only, browsable,
+			smb_options, nfs_options, created_at, updated_at
+		FROM shares WHERE name = ? AND deleted_at IS NULL`, name))
+}
+
+func (s *SQLiteStore) scanShare(row *sql.Row) (*models.Share, error) {
+	var share models.Share
+	var enabled, guestAccess, readOnly, browsable int
+	var zoneID, ownerID sql.NullString
+	var allowedUsersJSON, allowedGroupsJSON, denyUsersJSON, denyGroupsJSON string
 	var smbOptionsJSON, nfsOptionsJSON sql.NullString
 
 	err := row.Scan(&share.ID, &share.Name, &share.Path, &share.Protocol, &share.Description,
@@ -705,6 +1152,10 @@ func (s *SQLiteStore) UpdateShare(id string, updates map[string]interface{}) (*m
 	denyUsersJSON, _ := json.Marshal(share.DenyUsers)
 	denyGroupsJSON, _ := json.Marshal(share.DenyGroups)
 
+	if s.heldByDeleted("shares", "name", share.Name) {
+		return nil, errors.New("share name belongs to a deleted share, restore or purge it first")
+	}
+
 	_, err = s.db.Exec(`
 		UPDATE shares SET name=?, path=?, description=?, enabled=?,
 			allowed_users=?, allowed_groups=?, deny_users=?, deny_groups=?,
@@ -716,7 +1167,7 @@ func (s *SQLiteStore) UpdateShare(id string, updates map[string]interface{}) (*m
 		share.UpdatedAt, id)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if isUniqueViolation(err) {
 			return nil, errors.New("share name already exists")
 		}
 		return nil, err
@@ -725,8 +1176,9 @@ func (s *SQLiteStore) UpdateShare(id string, updates map[string]interface{}) (*m
 	return share, nil
 }
 
+// DeleteShare soft-deletes a share, which can be restored until it is purged
 func (s *SQLiteStore) DeleteShare(id string) error {
-	result, err := s.db.Exec("DELETE FROM shares WHERE id = ?", id)
+	result, err := s.db.Exec("UPDATE shares SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now(), id)
 	if err != nil {
 		return err
 	}
@@ -742,7 +1194,7 @@ func (s *SQLiteStore) ListShares() []*models.Share {
 		SELECT id, name, path, protocol, description, enabled, zone_id, owner_id,
 			allowed_users, allowed_groups, deny_users, deny_groups, guest_access, read_only, browsable,
 			smb_options, nfs_options, created_at, updated_at
-		FROM shares ORDER BY name`)
+		FROM shares WHERE deleted_at IS NULL ORDER BY name`)
 	if err != nil {
 		return []*models.Share{}
 	}
@@ -756,7 +1208,7 @@ func (s *SQLiteStore) ListSharesByProtocol(protocol models.ShareProtocol) []*mod
 		SELECT id, name, path, protocol, description, enabled, zone_id, owner_id,
 			allowed_users, allowed_groups, deny_users, deny_groups, guest_access, read_only, browsable,
 			smb_options, nfs_options, created_at, updated_at
-		FROM shares WHERE protocol = ? ORDER BY name`, protocol)
+		FROM shares WHERE protocol = ? AND deleted_at IS NULL ORDER BY name`, protocol)
 	if err != nil {
 		return []*models.Share{}
 	}
@@ -810,21 +1262,30 @@ func (s *SQLiteStore) CreateStoragePool(pool *models.StoragePool) (*models.Stora
 	pool.CreatedAt = now
 	pool.UpdatedAt = now
 
+	if pool.Backend == "" {
+		pool.Backend = models.PoolBackendLocal
+	}
+
 	allowedTypesJSON, _ := json.Marshal(pool.AllowedTypes)
 	deniedTypesJSON, _ := json.Marshal(pool.DeniedTypes)
 
+	if s.heldByDeleted("storage_pools", "name", pool.Name) {
+		return nil, errors.New("storage pool name belongs to a deleted pool, restore or purge it first")
+	}
+
 	_, err := s.db.Exec(`
 		INSERT INTO storage_pools (id, name, path, description, enabled, total_space, used_space, free_space,
 			reserved, max_file_size, allowed_types, denied_types, default_user_quota, default_group_quota,
-			created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			backend, s3_config, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		pool.ID, pool.Name, pool.Path, pool.Description, boolToInt(pool.Enabled),
 		pool.TotalSpace, pool.UsedSpace, pool.FreeSpace, pool.Reserved, pool.MaxFileSize,
 		string(allowedTypesJSON), string(deniedTypesJSON),
-		pool.DefaultUserQuota, pool.DefaultGroupQuota, pool.CreatedAt, pool.UpdatedAt)
+		pool.DefaultUserQuota, pool.DefaultGroupQuota, pool.Backend, s3ConfigJSON(pool.S3),
+		pool.CreatedAt, pool.UpdatedAt)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if isUniqueViolation(err) {
 			return nil, errors.New("storage pool name already exists")
 		}
 		return nil, err
@@ -837,27 +1298,28 @@ func (s *SQLiteStore) GetStoragePool(id string) (*models.StoragePool, error) {
 	return s.scanStoragePool(s.db.QueryRow(`
 		SELECT id, name, path, description, enabled, total_space, used_space, free_space,
 			reserved, max_file_size, allowed_types, denied_types, default_user_quota, default_group_quota,
-			created_at, updated_at
-		FROM storage_pools WHERE id = ?`, id))
+			backend, s3_config, created_at, updated_at
+		FROM storage_pools WHERE id = ? AND deleted_at IS NULL`, id))
 }
 
 func (s *SQLiteStore) GetStoragePoolByName(name string) (*models.StoragePool, error) {
 	return s.scanStoragePool(s.db.QueryRow(`
 		SELECT id, name, path, description, enabled, total_space, used_space, free_space,
 			reserved, max_file_size, allowed_types, denied_types, default_user_quota, default_group_quota,
-			created_at, updated_at
-		FROM storage_pools WHERE name = ?`, name))
+			backend, s3_config, created_at, updated_at
+		FROM storage_pools WHERE name = ? AND deleted_at IS NULL`, name))
 }
 
 func (s *SQLiteStore) scanStoragePool(row *sql.Row) (*models.StoragePool, error) {
 	var pool models.StoragePool
 	var enabled int
 	var allowedTypesJSON, deniedTypesJSON string
+	var s3Config sql.NullString
 
 	err := row.Scan(&pool.ID, &pool.Name, &pool.Path, &pool.Description, &enabled,
 		&pool.TotalSpace, &pool.UsedSpace, &pool.FreeSpace, &pool.Reserved, &pool.MaxFileSize,
 		&allowedTypesJSON, &deniedTypesJSON, &pool.DefaultUserQuota, &pool.DefaultGroupQuota,
-		&pool.CreatedAt, &pool.UpdatedAt)
+		&pool.Backend, &s3Config, &pool.CreatedAt, &pool.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, errors.New("storage pool not found")
@@ -869,10 +1331,22 @@ func (s *SQLiteStore) scanStoragePool(row *sql.Row) (*models.StoragePool, error)
 	pool.Enabled = enabled == 1
 	json.Unmarshal([]byte(allowedTypesJSON), &pool.AllowedTypes)
 	json.Unmarshal([]byte(deniedTypesJSON), &pool.DeniedTypes)
+	if s3Config.Valid && s3Config.String != "" {
+		json.Unmarshal([]byte(s3Config.String), &pool.S3)
+	}
 
 	return &pool, nil
 }
 
+// s3ConfigJSON serializes a pool's S3 settings (NULL for local pools)
+func s3ConfigJSON(cfg *models.S3PoolConfig) interface{} {
+	if cfg == nil {
+		return nil
+	}
+	data, _ := json.Marshal(cfg)
+	return string(data)
+}
+
 func (s *SQLiteStore) UpdateStoragePool(id string, updates map[string]interface{}) (*models.StoragePool, error) {
 	pool, err := s.GetStoragePool(id)
 	if err != nil {
@@ -909,22 +1383,29 @@ func (s *SQLiteStore) UpdateStoragePool(id string, updates map[string]interface{
 	if defaultGroupQuota, ok := updates["default_group_quota"].(float64); ok {
 		pool.DefaultGroupQuota = int64(defaultGroupQuota)
 	}
+	if s3Config, ok := updates["s3"].(*models.S3PoolConfig); ok {
+		pool.S3 = s3Config
+	}
 
 	pool.UpdatedAt = time.Now()
 
 	allowedTypesJSON, _ := json.Marshal(pool.AllowedTypes)
 	deniedTypesJSON, _ := json.Marshal(pool.DeniedTypes)
 
+	if s.heldByDeleted("storage_pools", "name", pool.Name) {
+		return nil, errors.New("storage pool name belongs to a deleted pool, restore or purge it first")
+	}
+
 	_, err = s.db.Exec(`
 		UPDATE storage_pools SET name=?, path=?, description=?, enabled=?, reserved=?, max_file_size=?,
-			allowed_types=?, denied_types=?, default_user_quota=?, default_group_quota=?, updated_at=?
+			allowed_types=?, denied_types=?, default_user_quota=?, default_group_quota=?, s3_config=?, updated_at=?
 		WHERE id=?`,
 		pool.Name, pool.Path, pool.Description, boolToInt(pool.Enabled), pool.Reserved, pool.MaxFileSize,
 		string(allowedTypesJSON), string(deniedTypesJSON), pool.DefaultUserQuota, pool.DefaultGroupQuota,
-		pool.UpdatedAt, id)
+		s3ConfigJSON(pool.S3), pool.UpdatedAt, id)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if isUniqueViolation(err) {
 			return nil, errors.New("storage pool name already exists")
 		}
 		return nil, err
@@ -933,15 +1414,16 @@ func (s *SQLiteStore) UpdateStoragePool(id string, updates map[string]interface{
 	return pool, nil
 }
 
+// DeleteStoragePool soft-deletes a storage pool, which can be restored until it is purged
 func (s *SQLiteStore) DeleteStoragePool(id string) error {
 	// Check for dependent zones first
 	var count int
-	s.db.QueryRow("SELECT COUNT(*) FROM share_zones WHERE pool_id = ?", id).Scan(&count)
+	s.db.QueryRow("SELECT COUNT(*) FROM share_zones WHERE pool_id = ? AND deleted_at IS NULL", id).Scan(&count)
 	if count > 0 {
 		return errors.New("cannot delete pool: zones still reference this pool")
 	}
 
-	result, err := s.db.Exec("DELETE FROM storage_pools WHERE id = ?", id)
+	result, err := s.db.Exec("UPDATE storage_pools SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now(), id)
 	if err != nil {
 		return err
 	}
@@ -956,8 +1438,8 @@ func (s *SQLiteStore) ListStoragePools() []*models.StoragePool {
 	rows, err := s.db.Query(`
 		SELECT id, name, path, description, enabled, total_space, used_space, free_space,
 			reserved, max_file_size, allowed_types, denied_types, default_user_quota, default_group_quota,
-			created_at, updated_at
-		FROM storage_pools ORDER BY name`)
+			backend, s3_config, created_at, updated_at
+		FROM storage_pools WHERE deleted_at IS NULL ORDER BY name`)
 	if err != nil {
 		return []*models.StoragePool{}
 	}
@@ -968,17 +1450,21 @@ func (s *SQLiteStore) ListStoragePools() []*models.StoragePool {
 		var pool models.StoragePool
 		var enabled int
 		var allowedTypesJSON, deniedTypesJSON string
+		var s3Config sql.NullString
 
 		if err := rows.Scan(&pool.ID, &pool.Name, &pool.Path, &pool.Description, &enabled,
 			&pool.TotalSpace, &pool.UsedSpace, &pool.FreeSpace, &pool.Reserved, &pool.MaxFileSize,
 			&allowedTypesJSON, &deniedTypesJSON, &pool.DefaultUserQuota, &pool.DefaultGroupQuota,
-			&pool.CreatedAt, &pool.UpdatedAt); err != nil {
+			&pool.Backend, &s3Config, &pool.CreatedAt, &pool.UpdatedAt); err != nil {
 			continue
 		}
 
 		pool.Enabled = enabled == 1
 		json.Unmarshal([]byte(allowedTypesJSON), &pool.AllowedTypes)
 		json.Unmarshal([]byte(deniedTypesJSON), &pool.DeniedTypes)
+		if s3Config.Valid && s3Config.String != "" {
+			json.Unmarshal([]byte(s3Config.String), &pool.S3)
+		}
 		pools = append(pools, &pool)
 	}
 
@@ -1005,26 +1491,31 @@ func (s *SQLiteStore) CreateShareZone(zone *models.ShareZone) (*models.ShareZone
 	allowedGroupsJSON, _ := json.Marshal(zone.AllowedGroups)
 	denyUsersJSON, _ := json.Marshal(zone.DenyUsers)
 	denyGroupsJSON, _ := json.Marshal(zone.DenyGroups)
+	ownersJSON, _ := json.Marshal(zone.Owners)
 	smbOptionsJSON, _ := json.Marshal(zone.SMBOptions)
 	nfsOptionsJSON, _ := json.Marshal(zone.NFSOptions)
 	webOptionsJSON, _ := json.Marshal(zone.WebOptions)
 
+	if s.heldByDeleted("share_zones", "name", zone.Name) {
+		return nil, errors.New("share zone name belongs to a deleted zone, restore or purge it first")
+	}
+
 	_, err = s.db.Exec(`
 		INSERT INTO share_zones (id, pool_id, name, path, description, zone_type, enabled, auto_provision,
-			provision_template, allowed_users, allowed_groups, deny_users, deny_groups,
+			provision_template, allowed_users, allowed_groups, deny_users, deny_groups, owners,
 			allow_network_shares, allow_web_shares, allow_guest_access, smb_enabled, nfs_enabled,
-			smb_options, nfs_options, web_options, max_quota_per_user, read_only, browsable, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			smb_options, nfs_options, web_options, max_quota_per_user, max_upload_size, read_only, browsable, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		zone.ID, zone.PoolID, zone.Name, zone.Path, zone.Description, zone.ZoneType,
 		boolToInt(zone.Enabled), boolToInt(zone.AutoProvision), zone.ProvisionTemplate,
-		string(allowedUsersJSON), string(allowedGroupsJSON), string(denyUsersJSON), string(denyGroupsJSON),
+		string(allowedUsersJSON), string(allowedGroupsJSON), string(denyUsersJSON), string(denyGroupsJSON), string(ownersJSON),
 		boolToInt(zone.AllowNetworkShares), boolToInt(zone.AllowWebShares), boolToInt(zone.AllowGuestAccess),
 		boolToInt(zone.SMBEnabled), boolToInt(zone.NFSEnabled),
 		string(smbOptionsJSON), string(nfsOptionsJSON), string(webOptionsJSON),
-		zone.MaxQuotaPerUser, boolToInt(zone.ReadOnly), boolToInt(zone.Browsable), zone.CreatedAt, zone.UpdatedAt)
+		zone.MaxQuotaPerUser, zone.MaxUploadSize, boolToInt(zone.ReadOnly), boolToInt(zone.Browsable), zone.CreatedAt, zone.UpdatedAt)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if isUniqueViolation(err) {
 			return nil, errors.New("share zone name already exists")
 		}
 		return nil, err
@@ -1036,19 +1527,19 @@ func (s *SQLiteStore) CreateShareZone(zone *models.ShareZone) (*models.ShareZone
 func (s *SQLiteStore) GetShareZone(id string) (*models.ShareZone, error) {
 	return s.scanShareZone(s.db.QueryRow(`
 		SELECT id, pool_id, name, path, description, zone_type, enabled, auto_provision,
-			provision_template, allowed_users, allowed_groups, deny_users, deny_groups,
+			provision_template, allowed_users, allowed_groups, deny_users, deny_groups, owners,
 			allow_network_shares, allow_web_shares, allow_guest_access, smb_enabled, nfs_enabled,
-			smb_options, nfs_options, web_options, max_quota_per_user, read_only, browsable, created_at, updated_at
-		FROM share_zones WHERE id = ?`, id))
+			smb_options, nfs_options, web_options, max_quota_per_user, max_upload_size, read_only, browsable, created_at, updated_at
+		FROM share_zones WHERE id = ? AND deleted_at IS NULL`, id))
 }
 
 func (s *SQLiteStore) GetShareZoneByName(name string) (*models.ShareZone, error) {
 	return s.scanShareZone(s.db.QueryRow(`
 		SELECT id, pool_id, name, path, description, zone_type, enabled, auto_provision,
-			provision_template, allowed_users, allowed_groups, deny_users, deny_groups,
+			provision_template, allowed_users, allowed_groups, deny_users, deny_groups, owners,
 			allow_network_shares, allow_web_shares, allow_guest_access, smb_enabled, nfs_enabled,
-			smb_options, nfs_options, web_options, max_quota_per_user, read_only, browsable, created_at, updated_at
-		FROM share_zones WHERE name = ?`, name))
+			smb_options, nfs_options, web_options, max_quota_per_user, max_upload_size, read_only, browsable, created_at, updated_at
+		FROM share_zones WHERE name = ? AND deleted_at IS NULL`, name))
 }
 
 func (s *SQLiteStore) scanShareZone(row *sql.Row) (*models.ShareZone, error) {
@@ -1056,14 +1547,14 @@ func (s *SQLiteStore) scanShareZone(row *sql.Row) (*models.ShareZone, error) {
 	var enabled, autoProvision, allowNetworkShares, allowWebShares, allowGuestAccess int
 	var smbEnabled, nfsEnabled, readOnly, browsable int
 	var allowedUsersJSON, allowedGroupsJSON, denyUsersJSON, denyGroupsJSON string
-	var smbOptionsJSON, nfsOptionsJSON, webOptionsJSON sql.NullString
+	var ownersJSON, smbOptionsJSON, nfsOptionsJSON, webOptionsJSON sql.NullString
 
 	err := row.Scan(&zone.ID, &zone.PoolID, &zone.Name, &zone.Path, &zone.Description, &zone.ZoneType,
 		&enabled, &autoProvision, &zone.ProvisionTemplate,
-		&allowedUsersJSON, &allowedGroupsJSON, &denyUsersJSON, &denyGroupsJSON,
+		&allowedUsersJSON, &allowedGroupsJSON, &denyUsersJSON, &denyGroupsJSON, &ownersJSON,
 		&allowNetworkShares, &allowWebShares, &allowGuestAccess, &smbEnabled, &nfsEnabled,
 		&smbOptionsJSON, &nfsOptionsJSON, &webOptionsJSON,
-		&zone.MaxQuotaPerUser, &readOnly, &browsable, &zone.CreatedAt, &zone.UpdatedAt)
+		&zone.MaxQuotaPerUser, &zone.MaxUploadSize, &readOnly, &browsable, &zone.CreatedAt, &zone.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, errors.New("share zone not found")
@@ -1086,6 +1577,9 @@ func (s *SQLiteStore) scanShareZone(row *sql.Row) (*models.ShareZone, error) {
 	json.Unmarshal([]byte(allowedGroupsJSON), &zone.AllowedGroups)
 	json.Unmarshal([]byte(denyUsersJSON), &zone.DenyUsers)
 	json.Unmarshal([]byte(denyGroupsJSON), &zone.DenyGroups)
+	if ownersJSON.Valid {
+		json.Unmarshal([]byte(ownersJSON.String), &zone.Owners)
+	}
 
 	if smbOptionsJSON.Valid {
 		json.Unmarshal([]byte(smbOptionsJSON.String), &zone.SMBOptions)
@@ -1139,6 +1633,9 @@ func (s *SQLiteStore) UpdateShareZone(id string, updates map[string]interface{})
 	if allowedGroups, ok := updates["allowed_groups"].([]interface{}); ok {
 		zone.AllowedGroups = interfaceSliceToStrings(allowedGroups)
 	}
+	if owners, ok := updates["owners"].([]interface{}); ok {
+		zone.Owners = interfaceSliceToStrings(owners)
+	}
 	if allowNetworkShares, ok := updates["allow_network_shares"].(bool); ok {
 		zone.AllowNetworkShares = allowNetworkShares
 	}
@@ -1151,6 +1648,9 @@ func (s *SQLiteStore) UpdateShareZone(id string, updates map[string]interface{})
 	if maxQuotaPerUser, ok := updates["max_quota_per_user"].(float64); ok {
 		zone.MaxQuotaPerUser = int64(maxQuotaPerUser)
 	}
+	if maxUploadSize, ok := updates["max_upload_size"].(float64); ok {
+		zone.MaxUploadSize = int64(maxUploadSize)
+	}
 
 	zone.UpdatedAt = time.Now()
 
@@ -1158,20 +1658,25 @@ func (s *SQLiteStore) UpdateShareZone(id string, updates map[string]interface{})
 	allowedGroupsJSON, _ := json.Marshal(zone.AllowedGroups)
 	denyUsersJSON, _ := json.Marshal(zone.DenyUsers)
 	denyGroupsJSON, _ := json.Marshal(zone.DenyGroups)
+	ownersJSON, _ := json.Marshal(zone.Owners)
+
+	if s.heldByDeleted("share_zones", "name", zone.Name) {
+		return nil, errors.New("share zone name belongs to a deleted zone, restore or purge it first")
+	}
 
 	_, err = s.db.Exec(`
 		UPDATE share_zones SET pool_id=?, name=?, path=?, description=?, zone_type=?, enabled=?,
-			auto_provision=?, provision_template=?, allowed_users=?, allowed_groups=?, deny_users=?, deny_groups=?,
-			allow_network_shares=?, allow_web_shares=?, allow_guest_access=?, max_quota_per_user=?, updated_at=?
+			auto_provision=?, provision_template=?, allowed_users=?, allowed_groups=?, deny_users=?, deny_groups=?, owners=?,
+			allow_network_shares=?, allow_web_shares=?, allow_guest_access=?, max_quota_per_user=?, max_upload_size=?, updated_at=?
 		WHERE id=?`,
 		zone.PoolID, zone.Name, zone.Path, zone.Description, zone.ZoneType, boolToInt(zone.Enabled),
 		boolToInt(zone.AutoProvision), zone.ProvisionTemplate,
-		string(allowedUsersJSON), string(allowedGroupsJSON), string(denyUsersJSON), string(denyGroupsJSON),
+		string(allowedUsersJSON), string(allowedGroupsJSON), string(denyUsersJSON), string(denyGroupsJSON), string(ownersJSON),
 		boolToInt(zone.AllowNetworkShares), boolToInt(zone.AllowWebShares), boolToInt(zone.AllowGuestAccess),
-		zone.MaxQuotaPerUser, zone.UpdatedAt, id)
+		zone.MaxQuotaPerUser, zone.MaxUploadSize, zone.UpdatedAt, id)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if isUniqueViolation(err) {
 			return nil, errors.New("share zone name already exists")
 		}
 		return nil, err
@@ -1180,15 +1685,44 @@ func (s *SQLiteStore) UpdateShareZone(id string, updates map[string]interface{})
 	return zone, nil
 }
 
+// UpdateShareZoneSMB sets whether a zone is shared over SMB and its share options
+func (s *SQLiteStore) UpdateShareZoneSMB(id string, enabled bool, opts *models.ZoneSMBOptions) (*models.ShareZone, error) {
+	smbOptionsJSON, _ := json.Marshal(opts)
+	result, err := s.db.Exec(`UPDATE share_zones SET smb_enabled=?, smb_options=?, updated_at=? WHERE id=?`,
+		boolToInt(enabled), string(smbOptionsJSON), time.Now(), id)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, errors.New("share zone not found")
+	}
+	return s.GetShareZone(id)
+}
+
+// UpdateShareZoneNFS sets whether a zone is exported over NFS and its export options
+func (s *SQLiteStore) UpdateShareZoneNFS(id string, enabled bool, opts *models.ZoneNFSOptions) (*models.ShareZone, error) {
+	nfsOptionsJSON, _ := json.Marshal(opts)
+	result, err := s.db.Exec(`UPDATE share_zones SET nfs_enabled=?, nfs_options=?, updated_at=? WHERE id=?`,
+		boolToInt(enabled), string(nfsOptionsJSON), time.Now(), id)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, errors.New("share zone not found")
+	}
+	return s.GetShareZone(id)
+}
+
+// DeleteShareZone soft-deletes a share zone, which can be restored until it is purged
 func (s *SQLiteStore) DeleteShareZone(id string) error {
 	// Check for dependent shares first
 	var count int
-	s.db.QueryRow("SELECT COUNT(*) FROM shares WHERE zone_id = ?", id).Scan(&count)
+	s.db.QueryRow("SELECT COUNT(*) FROM shares WHERE zone_id = ? AND deleted_at IS NULL", id).Scan(&count)
 	if count > 0 {
 		return errors.New("cannot delete zone: shares still reference this zone")
 	}
 
-	result, err := s.db.Exec("DELETE FROM share_zones WHERE id = ?", id)
+	result, err := s.db.Exec("UPDATE share_zones SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now(), id)
 	if err != nil {
 		return err
 	}
@@ -1202,10 +1736,10 @@ func (s *SQLiteStore) DeleteShareZone(id string) error {
 func (s *SQLiteStore) ListShareZones() []*models.ShareZone {
 	rows, err := s.db.Query(`
 		SELECT id, pool_id, name, path, description, zone_type, enabled, auto_provision,
-			provision_template, allowed_users, allowed_groups, deny_users, deny_groups,
+			provision_template, allowed_users, allowed_groups, deny_users, deny_groups, owners,
 			allow_network_shares, allow_web_shares, allow_guest_access, smb_enabled, nfs_enabled,
-			smb_options, nfs_options, web_options, max_quota_per_user, read_only, browsable, created_at, updated_at
-		FROM share_zones ORDER BY name`)
+			smb_options, nfs_options, web_options, max_quota_per_user, max_upload_size, read_only, browsable, created_at, updated_at
+		FROM share_zones WHERE deleted_at IS NULL ORDER BY name`)
 	if err != nil {
 		return []*models.ShareZone{}
 	}
@@ -1217,10 +1751,10 @@ func (s *SQLiteStore) ListShareZones() []*models.ShareZone {
 func (s *SQLiteStore) ListShareZonesByPool(poolID string) []*models.ShareZone {
 	rows, err := s.db.Query(`
 		SELECT id, pool_id, name, path, description, zone_type, enabled, auto_provision,
-			provision_template, allowed_users, allowed_groups, deny_users, deny_groups,
+			provision_template, allowed_users, allowed_groups, deny_users, deny_groups, owners,
 			allow_network_shares, allow_web_shares, allow_guest_access, smb_enabled, nfs_enabled,
-			smb_options, nfs_options, web_options, max_quota_per_user, read_only, browsable, created_at, updated_at
-		FROM share_zones WHERE pool_id = ? ORDER BY name`, poolID)
+			smb_options, nfs_options, web_options, max_quota_per_user, max_upload_size, read_only, browsable, created_at, updated_at
+		FROM share_zones WHERE pool_id = ? AND deleted_at IS NULL ORDER BY name`, poolID)
 	if err != nil {
 		return []*models.ShareZone{}
 	}
@@ -1236,14 +1770,14 @@ func (s *SQLiteStore) scanShareZones(rows *sql.Rows) []*models.ShareZone {
 		var enabled, autoProvision, allowNetworkShares, allowWebShares, allowGuestAccess int
 		var smbEnabled, nfsEnabled, readOnly, browsable int
 		var allowedUsersJSON, allowedGroupsJSON, denyUsersJSON, denyGroupsJSON string
-		var smbOptionsJSON, nfsOptionsJSON, webOptionsJSON sql.NullString
+		var ownersJSON, smbOptionsJSON, nfsOptionsJSON, webOptionsJSON sql.NullString
 
 		if err := rows.Scan(&zone.ID, &zone.PoolID, &zone.Name, &zone.Path, &zone.Description, &zone.ZoneType,
 			&enabled, &autoProvision, &zone.ProvisionTemplate,
-			&allowedUsersJSON, &allowedGroupsJSON, &denyUsersJSON, &denyGroupsJSON,
+			&allowedUsersJSON, &allowedGroupsJSON, &denyUsersJSON, &denyGroupsJSON, &ownersJSON,
 			&allowNetworkShares, &allowWebShares, &allowGuestAccess, &smbEnabled, &nfsEnabled,
 			&smbOptionsJSON, &nfsOptionsJSON, &webOptionsJSON,
-			&zone.MaxQuotaPerUser, &readOnly, &browsable, &zone.CreatedAt, &zone.UpdatedAt); err != nil {
+			&zone.MaxQuotaPerUser, &zone.MaxUploadSize, &readOnly, &browsable, &zone.CreatedAt, &zone.UpdatedAt); err != nil {
 			continue
 		}
 
@@ -1261,6 +1795,9 @@ func (s *SQLiteStore) scanShareZones(rows *sql.Rows) []*models.ShareZone {
 		json.Unmarshal([]byte(allowedGroupsJSON), &zone.AllowedGroups)
 		json.Unmarshal([]byte(denyUsersJSON), &zone.DenyUsers)
 		json.Unmarshal([]byte(denyGroupsJSON), &zone.DenyGroups)
+		if ownersJSON.Valid {
+			json.Unmarshal([]byte(ownersJSON.String), &zone.Owners)
+		}
 
 		zones = append(zones, &zone)
 	}
@@ -1277,16 +1814,34 @@ func (s *SQLiteStore) CreateShareLink(link *models.ShareLink) (*models.ShareLink
 	now := time.Now()
 	link.CreatedAt = now
 	link.UpdatedAt = now
+	if link.Mode == "" {
+		link.Mode = models.ShareLinkModeStandard
+	}
+	allowedExtsJSON, _ := json.Marshal(link.AllowedExtensions)
+	downloadIPsJSON, _ := json.Marshal(link.DownloadIPs)
+	allowedCIDRsJSON, _ := json.Marshal(link.AllowedCIDRs)
+	allowedCountriesJSON, _ := json.Marshal(link.AllowedCountries)
+	blockedCountriesJSON, _ := json.Marshal(link.BlockedCountries)
+	itemsJSON, _ := json.Marshal(link.Items)
+
+	if link.Slug != "" && s.heldByDeleted("share_links", "slug", link.Slug) {
+		return nil, errors.New("slug belongs to a deleted share link, restore or purge it first")
+	}
 
 	_, err := s.db.Exec(`
-		INSERT INTO share_links (id, share_id, owner_id, target_path, target_type, target_name, token,
+		INSERT INTO share_links (id, share_id, owner_id, target_path, target_type, target_name, token, slug,
 			password_hash, expires_at, max_downloads, download_count, max_views, view_count,
-			allow_download, allow_preview, allow_upload, allow_listing, name, description, custom_message,
-			show_owner, enabled, created_at, updated_at, last_accessed)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		link.ID, link.ShareID, link.OwnerID, link.TargetPath, link.TargetType, link.TargetName, link.Token,
+			allow_download, allow_preview, allow_upload, allow_listing, mode, max_file_size, allowed_extensions,
+			notify_on_upload, notify_on_download, burn_after_ips, delete_on_burn, download_ips, burned_at,
+			allowed_cidrs, allowed_countries, blocked_countries, items,
+			name, description, custom_message, show_owner, enabled, created_at, updated_at, last_accessed)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		link.ID, link.ShareID, link.OwnerID, link.TargetPath, link.TargetType, link.TargetName, link.Token, link.Slug,
 		link.PasswordHash, link.ExpiresAt, link.MaxDownloads, link.DownloadCount, link.MaxViews, link.ViewCount,
 		boolToInt(link.AllowDownload), boolToInt(link.AllowPreview), boolToInt(link.AllowUpload), boolToInt(link.AllowListing),
+		link.Mode, link.MaxFileSize, string(allowedExtsJSON), boolToInt(link.NotifyOnUpload),
+		boolToInt(link.NotifyOnDownload), link.BurnAfterIPs, boolToInt(link.DeleteOnBurn), string(downloadIPsJSON), link.BurnedAt,
+		string(allowedCIDRsJSON), string(allowedCountriesJSON), string(blockedCountriesJSON), string(itemsJSON),
 		link.Name, link.Description, link.CustomMessage, boolToInt(link.ShowOwner), boolToInt(link.Enabled),
 		link.CreatedAt, link.UpdatedAt, link.LastAccessed)
 
@@ -1299,30 +1854,49 @@ func (s *SQLiteStore) CreateShareLink(link *models.ShareLink) (*models.ShareLink
 
 func (s *SQLiteStore) GetShareLink(id string) (*models.ShareLink, error) {
 	return s.scanShareLink(s.db.QueryRow(`
-		SELECT id, share_id, owner_id, target_path, target_type, target_name, token,
+		SELECT id, share_id, owner_id, target_path, target_type, target_name, token, slug,
 			password_hash, expires_at, max_downloads, download_count, max_views, view_count,
-			allow_download, allow_preview, allow_upload, allow_listing, name, description, custom_message,
-			show_owner, enabled, created_at, updated_at, last_accessed
-		FROM share_links WHERE id = ?`, id))
+			allow_download, allow_preview, allow_upload, allow_listing, mode, max_file_size, allowed_extensions,
+			notify_on_upload, notify_on_download, burn_after_ips, delete_on_burn, download_ips, burned_at,
+			allowed_cidrs, allowed_countries, blocked_countries, items,
+			name, description, custom_message, show_owner, enabled, created_at, updated_at, last_accessed
+		FROM share_links WHERE id = ? AND deleted_at IS NULL`, id))
 }
 
 func (s *SQLiteStore) GetShareLinkByToken(token string) (*models.ShareLink, error) {
 	return s.scanShareLink(s.db.QueryRow(`
-		SELECT id, share_id, owner_id, target_path, target_type, target_name, token,
+		SELECT id, share_id, owner_id, target_path, target_type, target_name, token, slug,
+			password_hash, expires_at, max_downloads, download_count, max_views, view_count,
+			allow_download, allow_preview, allow_upload, allow_listing, mode, max_file_size, allowed_extensions,
+			notify_on_upload, notify_on_download, burn_after_ips, delete_on_burn, download_ips, burned_at,
+			allowed_cidrs, allowed_countries, blocked_countries, items,
+			name, description, custom_message, show_owner, enabled, created_at, updated_at, last_accessed
+		FROM share_links WHERE token = ? AND deleted_at IS NULL`, token))
+}
+
+func (s *SQLiteStore) GetShareLinkBySlug(slug string) (*models.ShareLink, error) {
+	return s.scanShareLink(s.db.QueryRow(`
+		SELECT id, share_id, owner_id, target_path, target_type, target_name, token, slug,
 			password_hash, expires_at, max_downloads, download_count, max_views, view_count,
-			allow_download, allow_preview, allow_upload, allow_listing, name, description, custom_message,
-			show_owner, enabled, created_at, updated_at, last_accessed
-		FROM share_links WHERE token = ?`, token))
+			allow_download, allow_preview, allow_upload, allow_listing, mode, max_file_size, allowed_extensions,
+			notify_on_upload, notify_on_download, burn_after_ips, delete_on_burn, download_ips, burned_at,
+			allowed_cidrs, allowed_countries, blocked_countries, items,
+			name, description, custom_message, show_owner, enabled, created_at, updated_at, last_accessed
+		FROM share_links WHERE slug = ? AND slug != '' AND deleted_at IS NULL`, slug))
 }
 
 func (s *SQLiteStore) scanShareLink(row *sql.Row) (*models.ShareLink, error) {
 	var link models.ShareLink
-	var shareID, passwordHash, expiresAt, lastAccessed sql.NullString
-	var allowDownload, allowPreview, allowUpload, allowListing, showOwner, enabled int
+	var shareID, slug, passwordHash, expiresAt, lastAccessed, allowedExts, downloadIPs, burnedAt sql.NullString
+	var allowedCIDRs, allowedCountries, blockedCountries, items sql.NullString
+	var allowDownload, allowPreview, allowUpload, allowListing, notifyOnUpload, notifyOnDownload, deleteOnBurn, showOwner, enabled int
 
-	err := row.Scan(&link.ID, &shareID, &link.OwnerID, &link.TargetPath, &link.TargetType, &link.TargetName, &link.Token,
+	err := row.Scan(&link.ID, &shareID, &link.OwnerID, &link.TargetPath, &link.TargetType, &link.TargetName, &link.Token, &slug,
 		&passwordHash, &expiresAt, &link.MaxDownloads, &link.DownloadCount, &link.MaxViews, &link.ViewCount,
 		&allowDownload, &allowPreview, &allowUpload, &allowListing,
+		&link.Mode, &link.MaxFileSize, &allowedExts, &notifyOnUpload, &notifyOnDownload,
+		&link.BurnAfterIPs, &deleteOnBurn, &downloadIPs, &burnedAt,
+		&allowedCIDRs, &allowedCountries, &blockedCountries, &items,
 		&link.Name, &link.Description, &link.CustomMessage, &showOwner, &enabled,
 		&link.CreatedAt, &link.UpdatedAt, &lastAccessed)
 
@@ -1334,18 +1908,44 @@ func (s *SQLiteStore) scanShareLink(row *sql.Row) (*models.ShareLink, error) {
 	}
 
 	link.ShareID = shareID.String
+	link.Slug = slug.String
 	link.PasswordHash = passwordHash.String
 	link.AllowDownload = allowDownload == 1
 	link.AllowPreview = allowPreview == 1
 	link.AllowUpload = allowUpload == 1
 	link.AllowListing = allowListing == 1
+	link.NotifyOnUpload = notifyOnUpload == 1
+	link.NotifyOnDownload = notifyOnDownload == 1
+	link.DeleteOnBurn = deleteOnBurn == 1
 	link.ShowOwner = showOwner == 1
+	if allowedExts.Valid {
+		json.Unmarshal([]byte(allowedExts.String), &link.AllowedExtensions)
+	}
+	if downloadIPs.Valid {
+		json.Unmarshal([]byte(downloadIPs.String), &link.DownloadIPs)
+	}
+	if allowedCIDRs.Valid {
+		json.Unmarshal([]byte(allowedCIDRs.String), &link.AllowedCIDRs)
+	}
+	if allowedCountries.Valid {
+		json.Unmarshal([]byte(allowedCountries.String), &link.AllowedCountries)
+	}
+	if blockedCountries.Valid {
+		json.Unmarshal([]byte(blockedCountries.String), &link.BlockedCountries)
+	}
+	if items.Valid {
+		json.Unmarshal([]byte(items.String), &link.Items)
+	}
 	link.Enabled = enabled == 1
 
 	if expiresAt.Valid {
 		t, _ := time.Parse(time.RFC3339, expiresAt.String)
 		link.ExpiresAt = &t
 	}
+	if burnedAt.Valid {
+		t, _ := time.Parse(time.RFC3339, burnedAt.String)
+		link.BurnedAt = &t
+	}
 	if lastAccessed.Valid {
 		t, _ := time.Parse(time.RFC3339, lastAccessed.String)
 		link.LastAccessed = &t
@@ -1363,6 +1963,9 @@ func (s *SQLiteStore) UpdateShareLink(id string, updates map[string]interface{})
 	if name, ok := updates["name"].(string); ok {
 		link.Name = name
 	}
+	if slug, ok := updates["slug"].(string); ok {
+		link.Slug = slug
+	}
 	if description, ok := updates["description"].(string); ok {
 		link.Description = description
 	}
@@ -1374,6 +1977,11 @@ func (s *SQLiteStore) UpdateShareLink(id string, updates map[string]interface{})
 	}
 	if enabled, ok := updates["enabled"].(bool); ok {
 		link.Enabled = enabled
+		if enabled && link.BurnedAt != nil {
+			// Re-enabling a burned link starts it over
+			link.BurnedAt = nil
+			link.DownloadIPs = nil
+		}
 	}
 	if allowDownload, ok := updates["allow_download"].(bool); ok {
 		link.AllowDownload = allowDownload
@@ -1393,6 +2001,33 @@ func (s *SQLiteStore) UpdateShareLink(id string, updates map[string]interface{})
 	if maxViews, ok := updates["max_views"].(float64); ok {
 		link.MaxViews = int(maxViews)
 	}
+	if maxFileSize, ok := updates["max_file_size"].(float64); ok {
+		link.MaxFileSize = int64(maxFileSize)
+	}
+	if exts, ok := updates["allowed_extensions"].([]string); ok {
+		link.AllowedExtensions = exts
+	}
+	if notifyOnUpload, ok := updates["notify_on_upload"].(bool); ok {
+		link.NotifyOnUpload = notifyOnUpload
+	}
+	if notifyOnDownload, ok := updates["notify_on_download"].(bool); ok {
+		link.NotifyOnDownload = notifyOnDownload
+	}
+	if burnAfterIPs, ok := updates["burn_after_ips"].(float64); ok {
+		link.BurnAfterIPs = int(burnAfterIPs)
+	}
+	if deleteOnBurn, ok := updates["delete_on_burn"].(bool); ok {
+		link.DeleteOnBurn = deleteOnBurn
+	}
+	if cidrs, ok := updates["allowed_cidrs"].([]string); ok {
+		link.AllowedCIDRs = cidrs
+	}
+	if countries, ok := updates["allowed_countries"].([]string); ok {
+		link.AllowedCountries = countries
+	}
+	if countries, ok := updates["blocked_countries"].([]string); ok {
+		link.BlockedCountries = countries
+	}
 	if expiresAt, ok := updates["expires_at"].(string); ok {
 		if expiresAt == "" {
 			link.ExpiresAt = nil
@@ -1408,21 +2043,37 @@ func (s *SQLiteStore) UpdateShareLink(id string, updates map[string]interface{})
 	}
 
 	link.UpdatedAt = time.Now()
+	allowedExtsJSON, _ := json.Marshal(link.AllowedExtensions)
+	downloadIPsJSON, _ := json.Marshal(link.DownloadIPs)
+	allowedCIDRsJSON, _ := json.Marshal(link.AllowedCIDRs)
+	allowedCountriesJSON, _ := json.Marshal(link.AllowedCountries)
+	blockedCountriesJSON, _ := json.Marshal(link.BlockedCountries)
+
+	if link.Slug != "" && s.heldByDeleted("share_links", "slug", link.Slug) {
+		return nil, errors.New("slug belongs to a deleted share link, restore or purge it first")
+	}
 
 	_, err = s.db.Exec(`
-		UPDATE share_links SET name=?, description=?, custom_message=?, show_owner=?, enabled=?,
+		UPDATE share_links SET name=?, slug=?, description=?, custom_message=?, show_owner=?, enabled=?,
 			allow_download=?, allow_preview=?, allow_upload=?, allow_listing=?,
+			max_file_size=?, allowed_extensions=?, notify_on_upload=?, notify_on_download=?,
+			burn_after_ips=?, delete_on_burn=?, download_ips=?, burned_at=?,
+			allowed_cidrs=?, allowed_countries=?, blocked_countries=?,
 			max_downloads=?, max_views=?, expires_at=?, password_hash=?, updated_at=?
 		WHERE id=?`,
-		link.Name, link.Description, link.CustomMessage, boolToInt(link.ShowOwner), boolToInt(link.Enabled),
+		link.Name, link.Slug, link.Description, link.CustomMessage, boolToInt(link.ShowOwner), boolToInt(link.Enabled),
 		boolToInt(link.AllowDownload), boolToInt(link.AllowPreview), boolToInt(link.AllowUpload), boolToInt(link.AllowListing),
+		link.MaxFileSize, string(allowedExtsJSON), boolToInt(link.NotifyOnUpload), boolToInt(link.NotifyOnDownload),
+		link.BurnAfterIPs, boolToInt(link.DeleteOnBurn), string(downloadIPsJSON), link.BurnedAt,
+		string(allowedCIDRsJSON), string(allowedCountriesJSON), string(blockedCountriesJSON),
 		link.MaxDownloads, link.MaxViews, link.ExpiresAt, link.PasswordHash, link.UpdatedAt, id)
 
 	return link, err
 }
 
+// DeleteShareLink soft-deletes a share link, which can be restored until it is purged
 func (s *SQLiteStore) DeleteShareLink(id string) error {
-	result, err := s.db.Exec("DELETE FROM share_links WHERE id = ?", id)
+	result, err := s.db.Exec("UPDATE share_links SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now(), id)
 	if err != nil {
 		return err
 	}
@@ -1435,11 +2086,13 @@ func (s *SQLiteStore) DeleteShareLink(id string) error {
 
 func (s *SQLiteStore) ListShareLinks() []*models.ShareLink {
 	rows, err := s.db.Query(`
-		SELECT id, share_id, owner_id, target_path, target_type, target_name, token,
+		SELECT id, share_id, owner_id, target_path, target_type, target_name, token, slug,
 			password_hash, expires_at, max_downloads, download_count, max_views, view_count,
-			allow_download, allow_preview, allow_upload, allow_listing, name, description, custom_message,
-			show_owner, enabled, created_at, updated_at, last_accessed
-		FROM share_links ORDER BY created_at DESC`)
+			allow_download, allow_preview, allow_upload, allow_listing, mode, max_file_size, allowed_extensions,
+			notify_on_upload, notify_on_download, burn_after_ips, delete_on_burn, download_ips, burned_at,
+			allowed_cidrs, allowed_countries, blocked_countries, items,
+			name, description, custom_message, show_owner, enabled, created_at, updated_at, last_accessed
+		FROM share_links WHERE deleted_at IS NULL ORDER BY created_at DESC`)
 	if err != nil {
 		return []*models.ShareLink{}
 	}
@@ -1450,11 +2103,13 @@ func (s *SQLiteStore) ListShareLinks() []*models.ShareLink {
 
 func (s *SQLiteStore) ListShareLinksByOwner(ownerID string) []*models.ShareLink {
 	rows, err := s.db.Query(`
-		SELECT id, share_id, owner_id, target_path, target_type, target_name, token,
+		SELECT id, share_id, owner_id, target_path, target_type, target_name, token, slug,
 			password_hash, expires_at, max_downloads, download_count, max_views, view_count,
-			allow_download, allow_preview, allow_upload, allow_listing, name, description, custom_message,
-			show_owner, enabled, created_at, updated_at, last_accessed
-		FROM share_links WHERE owner_id = ? ORDER BY created_at DESC`, ownerID)
+			allow_download, allow_preview, allow_upload, allow_listing, mode, max_file_size, allowed_extensions,
+			notify_on_upload, notify_on_download, burn_after_ips, delete_on_burn, download_ips, burned_at,
+			allowed_cidrs, allowed_countries, blocked_countries, items,
+			name, description, custom_message, show_owner, enabled, created_at, updated_at, last_accessed
+		FROM share_links WHERE owner_id = ? AND deleted_at IS NULL ORDER BY created_at DESC`, ownerID)
 	if err != nil {
 		return []*models.ShareLink{}
 	}
@@ -1467,30 +2122,60 @@ func (s *SQLiteStore) scanShareLinks(rows *sql.Rows) []*models.ShareLink {
 	var links []*models.ShareLink
 	for rows.Next() {
 		var link models.ShareLink
-		var shareID, passwordHash, expiresAt, lastAccessed sql.NullString
-		var allowDownload, allowPreview, allowUpload, allowListing, showOwner, enabled int
+		var shareID, slug, passwordHash, expiresAt, lastAccessed, allowedExts, downloadIPs, burnedAt sql.NullString
+	var allowedCIDRs, allowedCountries, blockedCountries, items sql.NullString
+		var allowDownload, allowPreview, allowUpload, allowListing, notifyOnUpload, notifyOnDownload, deleteOnBurn, showOwner, enabled int
 
-		if err := rows.Scan(&link.ID, &shareID, &link.OwnerID, &link.TargetPath, &link.TargetType, &link.TargetName, &link.Token,
+		if err := rows.Scan(&link.ID, &shareID, &link.OwnerID, &link.TargetPath, &link.TargetType, &link.TargetName, &link.Token, &slug,
 			&passwordHash, &expiresAt, &link.MaxDownloads, &link.DownloadCount, &link.MaxViews, &link.ViewCount,
 			&allowDownload, &allowPreview, &allowUpload, &allowListing,
+			&link.Mode, &link.MaxFileSize, &allowedExts, &notifyOnUpload, &notifyOnDownload,
+			&link.BurnAfterIPs, &deleteOnBurn, &downloadIPs, &burnedAt,
+			&allowedCIDRs, &allowedCountries, &blockedCountries, &items,
 			&link.Name, &link.Description, &link.CustomMessage, &showOwner, &enabled,
 			&link.CreatedAt, &link.UpdatedAt, &lastAccessed); err != nil {
 			continue
 		}
 
 		link.ShareID = shareID.String
+		link.Slug = slug.String
 		link.PasswordHash = passwordHash.String
 		link.AllowDownload = allowDownload == 1
 		link.AllowPreview = allowPreview == 1
 		link.AllowUpload = allowUpload == 1
 		link.AllowListing = allowListing == 1
+		link.NotifyOnUpload = notifyOnUpload == 1
+		link.NotifyOnDownload = notifyOnDownload == 1
+		link.DeleteOnBurn = deleteOnBurn == 1
 		link.ShowOwner = showOwner == 1
+		if allowedExts.Valid {
+			json.Unmarshal([]byte(allowedExts.String), &link.AllowedExtensions)
+		}
+		if downloadIPs.Valid {
+			json.Unmarshal([]byte(downloadIPs.String), &link.DownloadIPs)
+		}
+		if allowedCIDRs.Valid {
+			json.Unmarshal([]byte(allowedCIDRs.String), &link.AllowedCIDRs)
+		}
+		if allowedCountries.Valid {
+			json.Unmarshal([]byte(allowedCountries.String), &link.AllowedCountries)
+		}
+		if blockedCountries.Valid {
+			json.Unmarshal([]byte(blockedCountries.String), &link.BlockedCountries)
+		}
+		if items.Valid {
+			json.Unmarshal([]byte(items.String), &link.Items)
+		}
 		link.Enabled = enabled == 1
 
 		if expiresAt.Valid {
 			t, _ := time.Parse(time.RFC3339, expiresAt.String)
 			link.ExpiresAt = &t
 		}
+		if burnedAt.Valid {
+			t, _ := time.Parse(time.RFC3339, burnedAt.String)
+			link.BurnedAt = &t
+		}
 		if lastAccessed.Valid {
 			t, _ := time.Parse(time.RFC3339, lastAccessed.String)
 			link.LastAccessed = &t
@@ -1510,6 +2195,39 @@ func (s *SQLiteStore) IncrementShareLinkDownload(id string) error {
 	return err
 }
 
+func (s *SQLiteStore) SetShareLinkToken(id, token string) error {
+	result, err := s.db.Exec("UPDATE share_links SET token = ?, updated_at = ? WHERE id = ?", token, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return errors.New("share link not found")
+	}
+	return nil
+}
+
+func (s *SQLiteStore) SetShareLinkDownloadIPs(id string, ips []string) error {
+	ipsJSON, _ := json.Marshal(ips)
+	_, err := s.db.Exec("UPDATE share_links SET download_ips = ?, updated_at = ? WHERE id = ?", string(ipsJSON), time.Now(), id)
+	return err
+}
+
+func (s *SQLiteStore) BurnShareLink(id string) error {
+	now := time.Now()
+	result, err := s.db.Exec(`
+		UPDATE share_links SET enabled = 0, burned_at = ?, updated_at = ?
+		WHERE id = ? AND burned_at IS NULL`, now, now, id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return errors.New("share link not found or already burned")
+	}
+	return nil
+}
+
 func (s *SQLiteStore) IncrementShareLinkView(id string) error {
 	now := time.Now()
 	_, err := s.db.Exec(`
@@ -1518,9 +2236,17 @@ func (s *SQLiteStore) IncrementShareLinkView(id string) error {
 	return err
 }
 
-func (s *SQLiteStore) CleanExpiredShareLinks() error {
-	_, err := s.db.Exec("DELETE FROM share_links WHERE expires_at IS NOT NULL AND expires_at < ?", time.Now())
-	return err
+// CleanExpiredShareLinks soft-deletes links that expired before the given time, so they can
+// still be restored until deleted objects are purged, and returns how many were deleted
+func (s *SQLiteStore) CleanExpiredShareLinks(before time.Time) (int, error) {
+	result, err := s.db.Exec(`
+		UPDATE share_links SET deleted_at = ?
+		WHERE expires_at IS NOT NULL AND expires_at < ? AND deleted_at IS NULL`, time.Now(), before)
+	if err != nil {
+		return 0, err
+	}
+	removed, _ := result.RowsAffected()
+	return int(removed), nil
 }
 
 // ============================================================================
@@ -1832,9 +2558,3491 @@ func (s *SQLiteStore) UpdateSnapshotPolicyRun(id string, lastRun time.Time, next
 }
 
 // ============================================================================
-// Helper Functions
+// File Search Index Operations
+// ============================================================================
+
+// UpsertFileIndexEntries inserts or refreshes a batch of index entries in a single transaction
+func (s *SQLiteStore) UpsertFileIndexEntries(entries []*models.FileIndexEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO file_index (zone_id, path, name, extension, size, is_dir, mod_time, indexed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(zone_id, path) DO UPDATE SET
+			name=excluded.name, extension=excluded.extension, size=excluded.size,
+			is_dir=excluded.is_dir, mod_time=excluded.mod_time, indexed_at=excluded.indexed_at`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range entries {
+		if _, err := stmt.Exec(e.ZoneID, e.Path, e.Name, e.Extension, e.Size, boolToInt(e.IsDir),
+			e.ModTime.Unix(), e.IndexedAt.Unix()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteFileIndexPath removes an entry and all of its descendants from the index
+func (s *SQLiteStore) DeleteFileIndexPath(zoneID, path string) error {
+	below, belowArgs := pathBelow("path", path)
+	_, err := s.db.Exec(`
+		DELETE FROM file_index WHERE zone_id = ? AND (path = ? OR `+below+`)`,
+		append([]interface{}{zoneID, path}, belowArgs...)...)
+	return err
+}
+
+// PruneFileIndex removes entries under a path that were not seen by the scan that started at before
+func (s *SQLiteStore) PruneFileIndex(zoneID, pathPrefix string, before time.Time) error {
+	if pathPrefix == "" || pathPrefix == "/" {
+		_, err := s.db.Exec("DELETE FROM file_index WHERE zone_id = ? AND indexed_at < ?", zoneID, before.Unix())
+		return err
+	}
+	below, belowArgs := pathBelow("path", pathPrefix)
+	_, err := s.db.Exec(`
+		DELETE FROM file_index WHERE zone_id = ? AND indexed_at < ? AND (path = ? OR `+below+`)`,
+		append([]interface{}{zoneID, before.Unix(), pathPrefix}, belowArgs...)...)
+	return err
+}
+
+// ClearFileIndex removes all index entries for a zone
+func (s *SQLiteStore) ClearFileIndex(zoneID string) error {
+	_, err := s.db.Exec("DELETE FROM file_index WHERE zone_id = ?", zoneID)
+	return err
+}
+
+// CountFileIndexEntries returns the number of indexed entries for a zone
+func (s *SQLiteStore) CountFileIndexEntries(zoneID string) int {
+	var count int
+	s.db.QueryRow("SELECT COUNT(*) FROM file_index WHERE zone_id = ?", zoneID).Scan(&count)
+	return count
+}
+
+// SearchFileIndex runs a filtered search against the index and returns a page of results with the total count
+func (s *SQLiteStore) SearchFileIndex(q *models.FileSearchQuery) ([]*models.FileIndexEntry, int, error) {
+	from := "FROM file_index f LEFT JOIN file_metadata m ON m.zone_id = f.zone_id AND m.path = f.path"
+	where := []string{"f.zone_id = ?"}
+	args := []interface{}{q.ZoneID}
+
+	if match := buildFTSMatch("name", q.Text); match != "" && s.db.dialect == dialectPostgres {
+		// Postgres has no FTS5 tables; match the text search vectors of the names and documents
+		query := buildTSQuery(q.Text)
+		cond := "to_tsvector('simple', f.name) @@ to_tsquery('simple', ?)"
+		args = append(args, query)
+		if q.Content {
+			cond = "(" + cond + ` OR f.path IN (SELECT c.path FROM file_contents c
+				WHERE c.zone_id = f.zone_id AND to_tsvector('simple', c.content) @@ to_tsquery('simple', ?)))`
+			args = append(args, query)
+		}
+		where = append(where, cond)
+	} else if match != "" && q.Content {
+		// Match either the name or the text of the document
+		where = append(where, `(f.id IN (SELECT rowid FROM file_index_fts WHERE file_index_fts MATCH ?)
+			OR f.path IN (SELECT c.path FROM file_contents c JOIN file_contents_fts ON file_contents_fts.rowid = c.id
+				WHERE c.zone_id = f.zone_id AND file_contents_fts MATCH ?))`)
+		args = append(args, match, buildFTSMatch("content", q.Text))
+	} else if match != "" {
+		from += " JOIN file_index_fts ON file_index_fts.rowid = f.id"
+		where = append(where, "file_index_fts MATCH ?")
+		args = append(args, match)
+	}
+	if q.PathPrefix != "" && q.PathPrefix != "/" {
+		below, belowArgs := pathBelow("f.path", q.PathPrefix)
+		where = append(where, below)
+		args = append(args, belowArgs...)
+	}
+	if len(q.Extensions) > 0 {
+		placeholders := make([]string, len(q.Extensions))
+		for i, ext := range q.Extensions {
+			placeholders[i] = "?"
+			args = append(args, ext)
+		}
+		where = append(where, "f.extension IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if q.MinSize > 0 {
+		where = append(where, "f.size >= ?")
+		args = append(args, q.MinSize)
+	}
+	if q.MaxSize > 0 {
+		where = append(where, "f.size <= ?")
+		args = append(args, q.MaxSize)
+	}
+	if q.ModifiedAfter != nil {
+		where = append(where, "f.mod_time >= ?")
+		args = append(args, q.ModifiedAfter.Unix())
+	}
+	if q.ModifiedBefore != nil {
+		where = append(where, "f.mod_time <= ?")
+		args = append(args, q.ModifiedBefore.Unix())
+	}
+	for _, tag := range q.Tags {
+		where = append(where, `m.tags LIKE ? ESCAPE '\'`)
+		args = append(args, "%,"+escapeLike(tag)+",%")
+	}
+	if q.Starred {
+		where = append(where, "m.starred = 1")
+	}
+	switch q.Type {
+	case "file":
+		where = append(where, "f.is_dir = 0")
+	case "folder":
+		where = append(where, "f.is_dir = 1")
+	}
+
+	clause := from + " WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) "+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order := "LOWER(f.name)"
+	switch q.SortBy {
+	case "size":
+		order = "f.size"
+	case "modified":
+		order = "f.mod_time"
+	case "relevance":
+		if strings.Contains(from, "file_index_fts") {
+			order = "file_index_fts.rank"
+		}
+	}
+	if q.SortDesc {
+		order += " DESC"
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := s.db.Query(`
+		SELECT f.zone_id, f.path, f.name, f.extension, f.size, f.is_dir, f.mod_time, f.indexed_at,
+			COALESCE(m.tags, ''), COALESCE(m.description, ''), COALESCE(m.starred, 0) `+
+		clause+" ORDER BY "+order+", f.path LIMIT ? OFFSET ?",
+		append(args, limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []*models.FileIndexEntry{}
+	for rows.Next() {
+		var e models.FileIndexEntry
+		var isDir int
+		var modTime, indexedAt int64
+		var tags string
+		var starred int
+		if err := rows.Scan(&e.ZoneID, &e.Path, &e.Name, &e.Extension, &e.Size, &isDir, &modTime, &indexedAt,
+			&tags, &e.Description, &starred); err != nil {
+			continue
+		}
+		if tags != "" {
+			e.Tags = decodeMetadataTags(tags)
+		}
+		e.Starred = starred == 1
+		e.IsDir = isDir == 1
+		e.ModTime = time.Unix(modTime, 0)
+		e.IndexedAt = time.Unix(indexedAt, 0)
+		entries = append(entries, &e)
+	}
+
+	return entries, total, rows.Err()
+}
+
+// buildFTSMatch converts free text into an FTS5 query that prefix-matches every term against a column
+func buildFTSMatch(column, text string) string {
+	var terms []string
+	for _, term := range strings.Fields(text) {
+		term = strings.ReplaceAll(term, `"`, "")
+		if term == "" {
+			continue
+		}
+		terms = append(terms, column+`:"`+term+`"*`)
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// ============================================================================
+// Document Content Index Operations
+// ============================================================================
+
+// GetZoneContentIndexing returns the content indexing settings for a zone, or the defaults if none are saved
+func (s *SQLiteStore) GetZoneContentIndexing(zoneID string) *models.ZoneContentIndexing {
+	cfg := models.ZoneContentIndexing{ZoneID: zoneID}
+	var enabled int
+
+	err := s.db.QueryRow(`
+		SELECT enabled, max_file_size, updated_at FROM zone_content_indexing WHERE zone_id = ?`, zoneID).
+		Scan(&enabled, &cfg.MaxFileSize, &cfg.UpdatedAt)
+	if err != nil {
+		return models.DefaultZoneContentIndexing(zoneID)
+	}
+
+	cfg.Enabled = enabled == 1
+	return &cfg
+}
+
+func (s *SQLiteStore) SetZoneContentIndexing(cfg *models.ZoneContentIndexing) error {
+	cfg.UpdatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO zone_content_indexing (zone_id, enabled, max_file_size, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(zone_id) DO UPDATE SET
+			enabled=excluded.enabled, max_file_size=excluded.max_file_size, updated_at=excluded.updated_at`,
+		cfg.ZoneID, boolToInt(cfg.Enabled), cfg.MaxFileSize, cfg.UpdatedAt)
+	return err
+}
+
+// UpsertFileContent stores the text extracted from a document
+func (s *SQLiteStore) UpsertFileContent(c *models.FileContent) error {
+	_, err := s.db.Exec(`
+		INSERT INTO file_contents (zone_id, path, content, size, mod_time, error, indexed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(zone_id, path) DO UPDATE SET
+			content=excluded.content, size=excluded.size, mod_time=excluded.mod_time,
+			error=excluded.error, indexed_at=excluded.indexed_at`,
+		c.ZoneID, c.Path, c.Content, c.Size, c.ModTime.Unix(), c.Error, c.IndexedAt.Unix())
+	return err
+}
+
+// GetFileContentInfo returns what is known about an indexed document, without its text
+func (s *SQLiteStore) GetFileContentInfo(zoneID, path string) (*models.FileContent, error) {
+	c := models.FileContent{ZoneID: zoneID, Path: path}
+	var modTime, indexedAt int64
+
+	err := s.db.QueryRow(`
+		SELECT size, mod_time, error, indexed_at FROM file_contents WHERE zone_id = ? AND path = ?`, zoneID, path).
+		Scan(&c.Size, &modTime, &c.Error, &indexedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("file content not indexed")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.ModTime = time.Unix(modTime, 0)
+	c.IndexedAt = time.Unix(indexedAt, 0)
+	return &c, nil
+}
+
+// DeleteFileContentPath removes the text of a document, or of every document in a folder
+func (s *SQLiteStore) DeleteFileContentPath(zoneID, path string) error {
+	below, belowArgs := pathBelow("path", path)
+	_, err := s.db.Exec(`
+		DELETE FROM file_contents WHERE zone_id = ? AND (path = ? OR `+below+`)`,
+		append([]interface{}{zoneID, path}, belowArgs...)...)
+	return err
+}
+
+// RenameFileContentPath moves the text of a renamed document or folder to its new path
+func (s *SQLiteStore) RenameFileContentPath(zoneID, oldPath, newPath string) error {
+	return s.renamePathRows("file_contents", zoneID, oldPath, newPath)
+}
+
+// PruneFileContents removes the text of documents that are no longer in the file index
+func (s *SQLiteStore) PruneFileContents(zoneID string) error {
+	_, err := s.db.Exec(`
+		DELETE FROM file_contents WHERE zone_id = ?
+		AND path NOT IN (SELECT path FROM file_index WHERE zone_id = ?)`, zoneID, zoneID)
+	return err
+}
+
+// ClearFileContents removes the text of every document in a zone
+func (s *SQLiteStore) ClearFileContents(zoneID string) error {
+	_, err := s.db.Exec("DELETE FROM file_contents WHERE zone_id = ?", zoneID)
+	return err
+}
+
+// GetContentIndexStats returns the number of indexed documents of a zone and the size of their text
+func (s *SQLiteStore) GetContentIndexStats(zoneID string) *models.ContentIndexStats {
+	var stats models.ContentIndexStats
+	s.db.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN error = '' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN error != '' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(length(CAST(content AS BLOB))), 0)
+		FROM file_contents WHERE zone_id = ?`, zoneID).
+		Scan(&stats.Documents, &stats.Failed, &stats.TextBytes)
+	return &stats
+}
+
+// ============================================================================
+// Image Metadata Operations
 // ============================================================================
 
+const imageMetadataColumns = `zone_id, path, taken_at, camera_make, camera_model, lens, width, height,
+	orientation, exposure_time, f_number, iso, focal_length, latitude, longitude, altitude, size, mod_time, indexed_at`
+
+func scanImageMetadata(row rowScanner) (*models.ImageMetadata, error) {
+	var m models.ImageMetadata
+	var takenAt sql.NullInt64
+	var latitude, longitude, altitude sql.NullFloat64
+	var modTime, indexedAt int64
+	if err := row.Scan(&m.ZoneID, &m.Path, &takenAt, &m.CameraMake, &m.CameraModel, &m.Lens, &m.Width, &m.Height,
+		&m.Orientation, &m.ExposureTime, &m.FNumber, &m.ISO, &m.FocalLength, &latitude, &longitude, &altitude,
+		&m.Size, &modTime, &indexedAt); err != nil {
+		return nil, err
+	}
+	if takenAt.Valid {
+		t := time.Unix(takenAt.Int64, 0).UTC()
+		m.DateTaken = &t
+	}
+	if latitude.Valid && longitude.Valid {
+		m.Latitude = &latitude.Float64
+		m.Longitude = &longitude.Float64
+	}
+	if altitude.Valid {
+		m.Altitude = &altitude.Float64
+	}
+	m.ModTime = time.Unix(modTime, 0)
+	m.IndexedAt = time.Unix(indexedAt, 0)
+	return &m, nil
+}
+
+// UpsertImageMetadata stores the EXIF details of an image
+func (s *SQLiteStore) UpsertImageMetadata(m *models.ImageMetadata) error {
+	var takenAt sql.NullInt64
+	sortTime := m.ModTime.Unix()
+	if m.DateTaken != nil {
+		takenAt = sql.NullInt64{Int64: m.DateTaken.Unix(), Valid: true}
+		sortTime = m.DateTaken.Unix()
+	}
+	nullFloat := func(v *float64) sql.NullFloat64 {
+		if v == nil {
+			return sql.NullFloat64{}
+		}
+		return sql.NullFloat64{Float64: *v, Valid: true}
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO image_metadata (`+imageMetadataColumns+`, sort_time)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(zone_id, path) DO UPDATE SET
+			taken_at=excluded.taken_at, camera_make=excluded.camera_make, camera_model=excluded.camera_model,
+			lens=excluded.lens, width=excluded.width, height=excluded.height, orientation=excluded.orientation,
+			exposure_time=excluded.exposure_time, f_number=excluded.f_number, iso=excluded.iso,
+			focal_length=excluded.focal_length, latitude=excluded.latitude, longitude=excluded.longitude,
+			altitude=excluded.altitude, size=excluded.size, mod_time=excluded.mod_time,
+			indexed_at=excluded.indexed_at, sort_time=excluded.sort_time`,
+		m.ZoneID, m.Path, takenAt, m.CameraMake, m.CameraModel, m.Lens, m.Width, m.Height,
+		m.Orientation, m.ExposureTime, m.FNumber, m.ISO, m.FocalLength,
+		nullFloat(m.Latitude), nullFloat(m.Longitude), nullFloat(m.Altitude),
+		m.Size, m.ModTime.Unix(), m.IndexedAt.Unix(), sortTime)
+	return err
+}
+
+func (s *SQLiteStore) GetImageMetadata(zoneID, path string) (*models.ImageMetadata, error) {
+	row := s.db.QueryRow(`SELECT `+imageMetadataColumns+` FROM image_metadata WHERE zone_id = ? AND path = ?`, zoneID, path)
+
+	m, err := scanImageMetadata(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("image metadata not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// galleryWhere builds the filter shared by the gallery listing and timeline
+func galleryWhere(zoneID, pathPrefix string, from, to *time.Time) (string, []interface{}) {
+	where := []string{"zone_id = ?"}
+	args := []interface{}{zoneID}
+	if pathPrefix != "" && pathPrefix != "/" {
+		below, belowArgs := pathBelow("path", pathPrefix)
+		where = append(where, below)
+		args = append(args, belowArgs...)
+	}
+	if from != nil {
+		where = append(where, "sort_time >= ?")
+		args = append(args, from.Unix())
+	}
+	if to != nil {
+		where = append(where, "sort_time < ?")
+		args = append(args, to.Unix())
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// ListGalleryImages returns a page of images, newest first, with the total count
+func (s *SQLiteStore) ListGalleryImages(q *models.GalleryQuery) ([]*models.ImageMetadata, int, error) {
+	where, args := galleryWhere(q.ZoneID, q.PathPrefix, q.From, q.To)
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM image_metadata WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := s.db.Query(`SELECT `+imageMetadataColumns+` FROM image_metadata WHERE `+where+`
+		ORDER BY sort_time DESC, path LIMIT ? OFFSET ?`, append(args, limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	images := []*models.ImageMetadata{}
+	for rows.Next() {
+		if m, err := scanImageMetadata(rows); err == nil {
+			images = append(images, m)
+		}
+	}
+	return images, total, rows.Err()
+}
+
+// GalleryTimeline counts the images of a zone per year, month or day, newest period first
+func (s *SQLiteStore) GalleryTimeline(zoneID, pathPrefix, groupBy string) ([]*models.GalleryBucket, error) {
+	format, pgFormat, layout := "%Y-%m", "YYYY-MM", "2006-01"
+	switch groupBy {
+	case "year":
+		format, pgFormat, layout = "%Y", "YYYY", "2006"
+	case "day":
+		format, pgFormat, layout = "%Y-%m-%d", "YYYY-MM-DD", "2006-01-02"
+	}
+	where, args := galleryWhere(zoneID, pathPrefix, nil, nil)
+
+	// SQLite returns the path of the row holding MAX(sort_time) for the bare column
+	query := `
+		SELECT strftime('` + format + `', sort_time, 'unixepoch') AS period, COUNT(*), MAX(sort_time), path
+		FROM image_metadata WHERE ` + where + ` GROUP BY period ORDER BY period DESC`
+	if s.db.dialect == dialectPostgres {
+		query = `
+			SELECT DISTINCT ON (period) period, COUNT(*) OVER w, MAX(sort_time) OVER w, path
+			FROM (
+				SELECT to_char(to_timestamp(sort_time) AT TIME ZONE 'UTC', '` + pgFormat + `') AS period, sort_time, path
+				FROM image_metadata WHERE ` + where + `
+			) images
+			WINDOW w AS (PARTITION BY period)
+			ORDER BY period DESC, sort_time DESC`
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []*models.GalleryBucket{}
+	for rows.Next() {
+		var b models.GalleryBucket
+		var newest int64
+		if err := rows.Scan(&b.Period, &b.Count, &newest, &b.Cover); err != nil {
+			continue
+		}
+		b.Start, _ = time.Parse(layout, b.Period)
+		buckets = append(buckets, &b)
+	}
+	return buckets, rows.Err()
+}
+
+// DeleteImageMetadataPath removes the details of an image, or of every image in a folder
+func (s *SQLiteStore) DeleteImageMetadataPath(zoneID, path string) error {
+	below, belowArgs := pathBelow("path", path)
+	_, err := s.db.Exec(`
+		DELETE FROM image_metadata WHERE zone_id = ? AND (path = ? OR `+below+`)`,
+		append([]interface{}{zoneID, path}, belowArgs...)...)
+	return err
+}
+
+// RenameImageMetadataPath moves the details of a renamed image or folder to its new path
+func (s *SQLiteStore) RenameImageMetadataPath(zoneID, oldPath, newPath string) error {
+	return s.renamePathRows("image_metadata", zoneID, oldPath, newPath)
+}
+
+// PruneImageMetadata removes the details of images that are no longer in the file index
+func (s *SQLiteStore) PruneImageMetadata(zoneID string) error {
+	_, err := s.db.Exec(`
+		DELETE FROM image_metadata WHERE zone_id = ?
+		AND path NOT IN (SELECT path FROM file_index WHERE zone_id = ?)`, zoneID, zoneID)
+	return err
+}
+
+// ============================================================================
+// Directory Usage Operations
+// ============================================================================
+
+// UpsertDirUsage inserts or refreshes a batch of directory usage rows in a single transaction
+func (s *SQLiteStore) UpsertDirUsage(entries []*models.DirUsage) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO dir_usage (zone_id, path, size, file_count, dir_count, scanned_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(zone_id, path) DO UPDATE SET
+			size=excluded.size, file_count=excluded.file_count,
+			dir_count=excluded.dir_count, scanned_at=excluded.scanned_at`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, u := range entries {
+		if _, err := stmt.Exec(u.ZoneID, u.Path, u.Size, u.FileCount, u.DirCount, u.ScannedAt.Unix()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetDirUsage returns the usage recorded for the entries directly inside a directory
+func (s *SQLiteStore) GetDirUsage(zoneID, path string) (*models.DirUsage, error) {
+	u := models.DirUsage{ZoneID: zoneID, Path: path}
+	var scannedAt int64
+	err := s.db.QueryRow(`
+		SELECT size, file_count, dir_count, scanned_at FROM dir_usage WHERE zone_id = ? AND path = ?`,
+		zoneID, path).Scan(&u.Size, &u.FileCount, &u.DirCount, &scannedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("directory usage not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.ScannedAt = time.Unix(scannedAt, 0)
+	return &u, nil
+}
+
+// SumDirUsage returns the recursive usage of a directory. The directory itself must have been scanned.
+func (s *SQLiteStore) SumDirUsage(zoneID, path string) (*models.UsageTotals, error) {
+	if _, err := s.GetDirUsage(zoneID, path); err != nil {
+		return nil, err
+	}
+
+	var totals models.UsageTotals
+	var scannedAt int64
+	where := "zone_id = ?"
+	args := []interface{}{zoneID}
+	if path != "/" {
+		below, belowArgs := pathBelow("path", path)
+		where += ` AND (path = ? OR ` + below + `)`
+		args = append(append(args, path), belowArgs...)
+	}
+	err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(size), 0), COALESCE(SUM(file_count), 0), COALESCE(SUM(dir_count), 0),
+			COALESCE(MIN(scanned_at), 0)
+		FROM dir_usage WHERE `+where, args...).Scan(&totals.Size, &totals.FileCount, &totals.DirCount, &scannedAt)
+	if err != nil {
+		return nil, err
+	}
+	totals.ScannedAt = time.Unix(scannedAt, 0)
+	return &totals, nil
+}
+
+// DeleteDirUsagePath removes the usage rows of a directory and all directories beneath it
+func (s *SQLiteStore) DeleteDirUsagePath(zoneID, path string) error {
+	below, belowArgs := pathBelow("path", path)
+	_, err := s.db.Exec(`
+		DELETE FROM dir_usage WHERE zone_id = ? AND (path = ? OR `+below+`)`,
+		append([]interface{}{zoneID, path}, belowArgs...)...)
+	return err
+}
+
+// PruneDirUsage removes rows under a path that were not seen by the scan that started at before
+func (s *SQLiteStore) PruneDirUsage(zoneID, pathPrefix string, before time.Time) error {
+	if pathPrefix == "" || pathPrefix == "/" {
+		_, err := s.db.Exec("DELETE FROM dir_usage WHERE zone_id = ? AND scanned_at < ?", zoneID, before.Unix())
+		return err
+	}
+	below, belowArgs := pathBelow("path", pathPrefix)
+	_, err := s.db.Exec(`
+		DELETE FROM dir_usage WHERE zone_id = ? AND scanned_at < ? AND (path = ? OR `+below+`)`,
+		append([]interface{}{zoneID, before.Unix(), pathPrefix}, belowArgs...)...)
+	return err
+}
+
+// ============================================================================
+// Zone User Usage Operations
+// ============================================================================
+
+func (s *SQLiteStore) GetZoneUserUsage(zoneID, username string) (*models.ZoneUserUsage, error) {
+	u := models.ZoneUserUsage{ZoneID: zoneID, Username: username}
+	err := s.db.QueryRow(`
+		SELECT used_bytes, updated_at FROM zone_user_usage WHERE zone_id = ? AND username = ?`,
+		zoneID, username).Scan(&u.UsedBytes, &u.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("usage not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// SetZoneUserUsage records the space a user is charged for in a zone
+func (s *SQLiteStore) SetZoneUserUsage(zoneID, username string, used int64) error {
+	if used < 0 {
+		used = 0
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO zone_user_usage (zone_id, username, used_bytes, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(zone_id, username) DO UPDATE SET
+			used_bytes=excluded.used_bytes, updated_at=excluded.updated_at`,
+		zoneID, username, used, time.Now())
+	return err
+}
+
+// AddZoneUserUsage adjusts the space a user is charged for in a zone (never below zero)
+func (s *SQLiteStore) AddZoneUserUsage(zoneID, username string, delta int64) error {
+	_, err := s.db.Exec(`
+		INSERT INTO zone_user_usage (zone_id, username, used_bytes, updated_at)
+		VALUES (?, ?, MAX(?, 0), ?)
+		ON CONFLICT(zone_id, username) DO UPDATE SET
+			used_bytes=MAX(used_bytes + ?, 0), updated_at=excluded.updated_at`,
+		zoneID, username, delta, time.Now(), delta)
+	return err
+}
+
+func (s *SQLiteStore) ListZoneUserUsage(zoneID string) []*models.ZoneUserUsage {
+	usage := []*models.ZoneUserUsage{}
+	rows, err := s.db.Query(`
+		SELECT username, used_bytes, updated_at FROM zone_user_usage
+		WHERE zone_id = ? ORDER BY used_bytes DESC`, zoneID)
+	if err != nil {
+		return usage
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		u := models.ZoneUserUsage{ZoneID: zoneID}
+		if err := rows.Scan(&u.Username, &u.UsedBytes, &u.UpdatedAt); err != nil {
+			continue
+		}
+		usage = append(usage, &u)
+	}
+	return usage
+}
+
+// ============================================================================
+// File Metadata Operations
+// ============================================================================
+
+const fileMetadataColumns = `zone_id, path, tags, description, starred, updated_by, updated_at`
+
+// encodeMetadataTags stores tags as ",tag1,tag2," so single tags can be matched with LIKE
+func encodeMetadataTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "," + strings.Join(tags, ",") + ","
+}
+
+func decodeMetadataTags(value string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(value, ",") {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func scanFileMetadata(row rowScanner) (*models.FileMetadata, error) {
+	var meta models.FileMetadata
+	var tags string
+	var starred int
+	if err := row.Scan(&meta.ZoneID, &meta.Path, &tags, &meta.Description, &starred, &meta.UpdatedBy, &meta.UpdatedAt); err != nil {
+		return nil, err
+	}
+	meta.Tags = decodeMetadataTags(tags)
+	meta.Starred = starred == 1
+	return &meta, nil
+}
+
+func (s *SQLiteStore) GetFileMetadata(zoneID, path string) (*models.FileMetadata, error) {
+	row := s.db.QueryRow(`SELECT `+fileMetadataColumns+` FROM file_metadata WHERE zone_id = ? AND path = ?`, zoneID, path)
+
+	meta, err := scanFileMetadata(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("file metadata not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// SetFileMetadata stores the metadata of a file, removing the row when nothing is left in it
+func (s *SQLiteStore) SetFileMetadata(meta *models.FileMetadata) error {
+	if meta.IsEmpty() {
+		_, err := s.db.Exec("DELETE FROM file_metadata WHERE zone_id = ? AND path = ?", meta.ZoneID, meta.Path)
+		return err
+	}
+
+	meta.UpdatedAt = time.Now()
+	_, err := s.db.Exec(`
+		INSERT INTO file_metadata (`+fileMetadataColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(zone_id, path) DO UPDATE SET
+			tags=excluded.tags, description=excluded.description, starred=excluded.starred,
+			updated_by=excluded.updated_by, updated_at=excluded.updated_at`,
+		meta.ZoneID, meta.Path, encodeMetadataTags(meta.Tags), meta.Description, boolToInt(meta.Starred),
+		meta.UpdatedBy, meta.UpdatedAt)
+	return err
+}
+
+// GetFileMetadataForPaths returns the metadata of the given paths that have any, keyed by path
+func (s *SQLiteStore) GetFileMetadataForPaths(zoneID string, paths []string) map[string]*models.FileMetadata {
+	result := make(map[string]*models.FileMetadata)
+
+	// Stay well below SQLite's limit on query parameters
+	const chunkSize = 500
+	for start := 0; start < len(paths); start += chunkSize {
+		chunk := paths[start:min(start+chunkSize, len(paths))]
+		placeholders := make([]string, len(chunk))
+		args := []interface{}{zoneID}
+		for i, path := range chunk {
+			placeholders[i] = "?"
+			args = append(args, path)
+		}
+
+		rows, err := s.db.Query(`SELECT `+fileMetadataColumns+` FROM file_metadata
+			WHERE zone_id = ? AND path IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+		if err != nil {
+			return result
+		}
+		for rows.Next() {
+			if meta, err := scanFileMetadata(rows); err == nil {
+				result[meta.Path] = meta
+			}
+		}
+		rows.Close()
+	}
+	return result
+}
+
+// QueryFileMetadata returns the files with metadata matching the query, most recently updated first
+func (s *SQLiteStore) QueryFileMetadata(q *models.FileMetadataQuery) []*models.FileMetadata {
+	results := []*models.FileMetadata{}
+
+	where := []string{"zone_id = ?"}
+	args := []interface{}{q.ZoneID}
+	if q.PathPrefix != "" && q.PathPrefix != "/" {
+		below, belowArgs := pathBelow("path", q.PathPrefix)
+		where = append(where, below)
+		args = append(args, belowArgs...)
+	}
+	for _, tag := range q.Tags {
+		where = append(where, `tags LIKE ? ESCAPE '\'`)
+		args = append(args, "%,"+escapeLike(tag)+",%")
+	}
+	if q.Starred {
+		where = append(where, "starred = 1")
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := s.db.Query(`SELECT `+fileMetadataColumns+` FROM file_metadata
+		WHERE `+strings.Join(where, " AND ")+` ORDER BY updated_at DESC, path LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return results
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if meta, err := scanFileMetadata(rows); err == nil {
+			results = append(results, meta)
+		}
+	}
+	return results
+}
+
+// ListFileTags returns every tag used in a zone (optionally below a path) with its file count
+func (s *SQLiteStore) ListFileTags(zoneID, pathPrefix string) []*models.TagCount {
+	tags := []*models.TagCount{}
+
+	where := "zone_id = ? AND tags != ''"
+	args := []interface{}{zoneID}
+	if pathPrefix != "" && pathPrefix != "/" {
+		below, belowArgs := pathBelow("path", pathPrefix)
+		where += ` AND ` + below
+		args = append(args, belowArgs...)
+	}
+
+	rows, err := s.db.Query(`SELECT tags FROM file_metadata WHERE `+where, args...)
+	if err != nil {
+		return tags
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			continue
+		}
+		for _, tag := range decodeMetadataTags(value) {
+			counts[tag]++
+		}
+	}
+
+	for tag, count := range counts {
+		tags = append(tags, &models.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags
+}
+
+// DeleteFileMetadataPath removes the metadata of a file or folder and everything beneath it
+func (s *SQLiteStore) DeleteFileMetadataPath(zoneID, path string) error {
+	below, belowArgs := pathBelow("path", path)
+	_, err := s.db.Exec(`
+		DELETE FROM file_metadata WHERE zone_id = ? AND (path = ? OR `+below+`)`,
+		append([]interface{}{zoneID, path}, belowArgs...)...)
+	return err
+}
+
+// RenameFileMetadataPath moves the metadata of a renamed file or folder to its new path
+func (s *SQLiteStore) RenameFileMetadataPath(zoneID, oldPath, newPath string) error {
+	return s.renamePathRows("file_metadata", zoneID, oldPath, newPath)
+}
+
+// ============================================================================
+// Usage History Operations
+// ============================================================================
+
+// RecordUsageSamples stores the results of a usage scan in a single transaction
+func (s *SQLiteStore) RecordUsageSamples(samples []*models.UsageSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO usage_history (zone_id, username, used_bytes, recorded_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(zone_id, username, recorded_at) DO UPDATE SET used_bytes=excluded.used_bytes`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, u := range samples {
+		if _, err := stmt.Exec(u.ZoneID, u.Username, u.UsedBytes, u.RecordedAt.Unix()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func scanUsageSamples(rows *sql.Rows) []*models.UsageSample {
+	samples := []*models.UsageSample{}
+	for rows.Next() {
+		var u models.UsageSample
+		var recordedAt int64
+		if err := rows.Scan(&u.ZoneID, &u.Username, &u.UsedBytes, &recordedAt); err != nil {
+			continue
+		}
+		u.RecordedAt = time.Unix(recordedAt, 0)
+		samples = append(samples, &u)
+	}
+	return samples
+}
+
+// ListUsageSamples returns the samples of a user in a zone since a time, oldest first
+func (s *SQLiteStore) ListUsageSamples(zoneID, username string, since time.Time) []*models.UsageSample {
+	rows, err := s.db.Query(`
+		SELECT zone_id, username, used_bytes, recorded_at FROM usage_history
+		WHERE zone_id = ? AND username = ? AND recorded_at >= ?
+		ORDER BY recorded_at`, zoneID, username, since.Unix())
+	if err != nil {
+		return []*models.UsageSample{}
+	}
+	defer rows.Close()
+	return scanUsageSamples(rows)
+}
+
+// ListLatestUsageSamples returns the most recent sample of every user and zone
+func (s *SQLiteStore) ListLatestUsageSamples() []*models.UsageSample {
+	rows, err := s.db.Query(`
+		SELECT h.zone_id, h.username, h.used_bytes, h.recorded_at FROM usage_history h
+		JOIN (
+			SELECT zone_id, username, MAX(recorded_at) AS recorded_at
+			FROM usage_history GROUP BY zone_id, username
+		) latest ON latest.zone_id = h.zone_id AND latest.username = h.username
+			AND latest.recorded_at = h.recorded_at
+		ORDER BY h.zone_id, h.username`)
+	if err != nil {
+		return []*models.UsageSample{}
+	}
+	defer rows.Close()
+	return scanUsageSamples(rows)
+}
+
+// GetUsageSampleBefore returns the last sample of a user in a zone recorded at or before a time
+func (s *SQLiteStore) GetUsageSampleBefore(zoneID, username string, at time.Time) (*models.UsageSample, error) {
+	u := models.UsageSample{ZoneID: zoneID, Username: username}
+	var recordedAt int64
+	err := s.db.QueryRow(`
+		SELECT used_bytes, recorded_at FROM usage_history
+		WHERE zone_id = ? AND username = ? AND recorded_at <= ?
+		ORDER BY recorded_at DESC LIMIT 1`, zoneID, username, at.Unix()).Scan(&u.UsedBytes, &recordedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("usage sample not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.RecordedAt = time.Unix(recordedAt, 0)
+	return &u, nil
+}
+
+// PruneUsageSamples removes samples recorded before a time
+func (s *SQLiteStore) PruneUsageSamples(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM usage_history WHERE recorded_at < ?", before.Unix())
+	return err
+}
+
+// ============================================================================
+// Daily Statistics Operations
+// ============================================================================
+
+// dailyStatMergeSQL is how each merge mode combines a recorded value with the stored one
+var dailyStatMergeSQL = map[models.DailyStatMerge]string{
+	models.DailyStatSet: "excluded.value",
+	models.DailyStatAdd: "daily_stats.value + excluded.value",
+	models.DailyStatMax: "CASE WHEN excluded.value > daily_stats.value THEN excluded.value ELSE daily_stats.value END",
+}
+
+// RecordDailyStats stores statistics in a single transaction, merging each with the value
+// already recorded for its day
+func (s *SQLiteStore) RecordDailyStats(stats []*models.DailyStat) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stat := range stats {
+		merge, ok := dailyStatMergeSQL[stat.Merge]
+		if !ok {
+			return errors.New("unknown daily stat merge mode")
+		}
+		_, err := tx.Exec(`
+			INSERT INTO daily_stats (day, metric, object_type, object_id, value)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(day, metric, object_type, object_id) DO UPDATE SET value = `+merge,
+			stat.Day, stat.Metric, stat.ObjectType, stat.ObjectID, stat.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListDailyStats returns the statistics matching a filter, ordered by series and then by day
+func (s *SQLiteStore) ListDailyStats(filter models.DailyStatFilter) []*models.DailyStat {
+	query := "SELECT day, metric, object_type, object_id, value FROM daily_stats WHERE 1=1"
+	args := []interface{}{}
+	if filter.Metric != "" {
+		query += " AND metric = ?"
+		args = append(args, filter.Metric)
+	}
+	if filter.ObjectType == "server" {
+		query += " AND object_type = ''"
+	} else if filter.ObjectType != "" {
+		query += " AND object_type = ?"
+		args = append(args, filter.ObjectType)
+	}
+	if filter.ObjectID != "" {
+		query += " AND object_id = ?"
+		args = append(args, filter.ObjectID)
+	}
+	if filter.Since != "" {
+		query += " AND day >= ?"
+		args = append(args, filter.Since)
+	}
+	if filter.Until != "" {
+		query += " AND day <= ?"
+		args = append(args, filter.Until)
+	}
+	query += " ORDER BY metric, object_type, object_id, day"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return []*models.DailyStat{}
+	}
+	defer rows.Close()
+
+	stats := []*models.DailyStat{}
+	for rows.Next() {
+		var stat models.DailyStat
+		if err := rows.Scan(&stat.Day, &stat.Metric, &stat.ObjectType, &stat.ObjectID, &stat.Value); err != nil {
+			continue
+		}
+		stats = append(stats, &stat)
+	}
+	return stats
+}
+
+// CountActiveUsers returns the number of users with a session created or used since a time
+func (s *SQLiteStore) CountActiveUsers(since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(DISTINCT user_id) FROM sessions
+		WHERE COALESCE(last_seen, created_at) >= ?`, since).Scan(&count)
+	return count, err
+}
+
+// ============================================================================
+// Transfer Cap Operations
+// ============================================================================
+
+func (s *SQLiteStore) GetTransferCap(objectType, objectID string) (*models.TransferCap, error) {
+	var c models.TransferCap
+	err := s.db.QueryRow(`
+		SELECT object_type, object_id, monthly_bytes, updated_at
+		FROM transfer_caps WHERE object_type = ? AND object_id = ?`, objectType, objectID).
+		Scan(&c.ObjectType, &c.ObjectID, &c.MonthlyBytes, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("transfer c not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *SQLiteStore) SetTransferCap(c *models.TransferCap) error {
+	c.UpdatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO transfer_caps (object_type, object_id, monthly_bytes, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(object_type, object_id) DO UPDATE SET
+			monthly_bytes=excluded.monthly_bytes, updated_at=excluded.updated_at`,
+		c.ObjectType, c.ObjectID, c.MonthlyBytes, c.UpdatedAt)
+	return err
+}
+
+func (s *SQLiteStore) DeleteTransferCap(objectType, objectID string) error {
+	_, err := s.db.Exec("DELETE FROM transfer_caps WHERE object_type = ? AND object_id = ?", objectType, objectID)
+	return err
+}
+
+func (s *SQLiteStore) ListTransferCaps() []*models.TransferCap {
+	caps := []*models.TransferCap{}
+	rows, err := s.db.Query(`
+		SELECT object_type, object_id, monthly_bytes, updated_at
+		FROM transfer_caps ORDER BY object_type, object_id`)
+	if err != nil {
+		return caps
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.TransferCap
+		if err := rows.Scan(&c.ObjectType, &c.ObjectID, &c.MonthlyBytes, &c.UpdatedAt); err != nil {
+			continue
+		}
+		caps = append(caps, &c)
+	}
+	return caps
+}
+
+// ============================================================================
+// File Checksum Operations
+// ============================================================================
+
+const fileChecksumColumns = `zone_id, path, sha256, size, mod_time, computed_at, verified_at, status, actual_sha256, detected_at`
+
+// UpsertFileChecksum records the checksum of a file, replacing any previous one
+func (s *SQLiteStore) UpsertFileChecksum(c *models.FileChecksum) error {
+	if c.Status == "" {
+		c.Status = models.ChecksumStatusOK
+	}
+	var detectedAt int64
+	if c.DetectedAt != nil {
+		detectedAt = c.DetectedAt.Unix()
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO file_checksums (`+fileChecksumColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(zone_id, path) DO UPDATE SET
+			sha256=excluded.sha256, size=excluded.size, mod_time=excluded.mod_time,
+			computed_at=excluded.computed_at, verified_at=excluded.verified_at, status=excluded.status,
+			actual_sha256=excluded.actual_sha256, detected_at=excluded.detected_at`,
+		c.ZoneID, c.Path, c.SHA256, c.Size, c.ModTime.UnixNano(), c.ComputedAt.Unix(),
+		c.VerifiedAt.Unix(), c.Status, c.ActualSHA256, detectedAt)
+	return err
+}
+
+func (s *SQLiteStore) GetFileChecksum(zoneID, path string) (*models.FileChecksum, error) {
+	row := s.db.QueryRow(`SELECT `+fileChecksumColumns+` FROM file_checksums WHERE zone_id = ? AND path = ?`, zoneID, path)
+	c, err := scanFileChecksum(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("checksum not found")
+	}
+	return c, err
+}
+
+// DeleteFileChecksumPath removes the checksums of a file, or of every file inside a folder
+func (s *SQLiteStore) DeleteFileChecksumPath(zoneID, path string) error {
+	below, belowArgs := pathBelow("path", path)
+	_, err := s.db.Exec(`
+		DELETE FROM file_checksums WHERE zone_id = ? AND (path = ? OR `+below+`)`,
+		append([]interface{}{zoneID, path}, belowArgs...)...)
+	return err
+}
+
+// RenameFileChecksumPath moves the checksums of a renamed file or folder to its new path
+func (s *SQLiteStore) RenameFileChecksumPath(zoneID, oldPath, newPath string) error {
+	return s.renamePathRows("file_checksums", zoneID, oldPath, newPath)
+}
+
+// PruneFileChecksums removes checksums of files in a zone that were not seen by the verification run that started at before
+func (s *SQLiteStore) PruneFileChecksums(zoneID string, before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM file_checksums WHERE zone_id = ? AND verified_at < ?", zoneID, before.Unix())
+	return err
+}
+
+// ListFileChecksumMismatches returns every file that failed verification, most recent first
+func (s *SQLiteStore) ListFileChecksumMismatches() []*models.FileChecksum {
+	mismatches := []*models.FileChecksum{}
+	rows, err := s.db.Query(`
+		SELECT `+fileChecksumColumns+` FROM file_checksums
+		WHERE status = ? ORDER BY detected_at DESC, zone_id, path`, models.ChecksumStatusMismatch)
+	if err != nil {
+		return mismatches
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanFileChecksum(rows)
+		if err != nil {
+			continue
+		}
+		mismatches = append(mismatches, c)
+	}
+	return mismatches
+}
+
+// ListFileChecksums returns the checksums of a file, or of every file inside a folder, ordered by path
+func (s *SQLiteStore) ListFileChecksums(zoneID, path string) []*models.FileChecksum {
+	checksums := []*models.FileChecksum{}
+	below, belowArgs := pathBelow("path", path)
+	rows, err := s.db.Query(`
+		SELECT `+fileChecksumColumns+` FROM file_checksums
+		WHERE zone_id = ? AND (path = ? OR `+below+`) ORDER BY path`,
+		append([]interface{}{zoneID, path}, belowArgs...)...)
+	if err != nil {
+		return checksums
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanFileChecksum(rows)
+		if err != nil {
+			continue
+		}
+		checksums = append(checksums, c)
+	}
+	return checksums
+}
+
+// renamePathRows moves the rows of a renamed file or folder in a per-path table to the new path,
+// replacing rows already stored under the new paths. Only rows of the file or folder itself are
+// moved or replaced; a sibling whose name differs in case is left alone.
+func (s *SQLiteStore) renamePathRows(table, zoneID, oldPath, newPath string) error {
+	oldPath = strings.TrimSuffix(oldPath, "/")
+	newPath = strings.TrimSuffix(newPath, "/")
+	if oldPath == newPath {
+		return nil
+	}
+	below, belowArgs := pathBelow("path", oldPath)
+	match := `zone_id = ? AND (path = ? OR ` + below + `)`
+	matchArgs := append([]interface{}{zoneID, oldPath}, belowArgs...)
+	rest := utf8.RuneCountInString(oldPath) + 1 // substr counts characters, not bytes
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		DELETE FROM `+table+` WHERE zone_id = ? AND path IN (
+			SELECT ? || substr(path, ?) FROM `+table+` WHERE `+match+`)`,
+		append([]interface{}{zoneID, newPath, rest}, matchArgs...)...); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE `+table+` SET path = ? || substr(path, ?) WHERE `+match,
+		append([]interface{}{newPath, rest}, matchArgs...)...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanFileChecksum(row rowScanner) (*models.FileChecksum, error) {
+	var c models.FileChecksum
+	var modTime, computedAt, verifiedAt, detectedAt int64
+	err := row.Scan(&c.ZoneID, &c.Path, &c.SHA256, &c.Size, &modTime, &computedAt, &verifiedAt,
+		&c.Status, &c.ActualSHA256, &detectedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.ModTime = time.Unix(0, modTime)
+	c.ComputedAt = time.Unix(computedAt, 0)
+	c.VerifiedAt = time.Unix(verifiedAt, 0)
+	if detectedAt > 0 {
+		t := time.Unix(detectedAt, 0)
+		c.DetectedAt = &t
+	}
+	return &c, nil
+}
+
+// ============================================================================
+// Trash Operations
+// ============================================================================
+
+func (s *SQLiteStore) CreateTrashItem(item *models.TrashItem) (*models.TrashItem, error) {
+	if item.ID == "" {
+		item.ID = uuid.New().String()
+	}
+	if item.DeletedAt.IsZero() {
+		item.DeletedAt = time.Now()
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO trash_items (id, zone_id, original_path, name, is_dir, size, deleted_by, deleted_by_name, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		item.ID, item.ZoneID, item.OriginalPath, item.Name, boolToInt(item.IsDir), item.Size,
+		item.DeletedBy, item.DeletedByName, item.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (s *SQLiteStore) GetTrashItem(id string) (*models.TrashItem, error) {
+	row := s.db.QueryRow(`
+		SELECT id, zone_id, original_path, name, is_dir, size, deleted_by, deleted_by_name, deleted_at
+		FROM trash_items WHERE id = ?`, id)
+
+	item, err := scanTrashItem(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("trash item not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *SQLiteStore) DeleteTrashItem(id string) error {
+	result, err := s.db.Exec("DELETE FROM trash_items WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("trash item not found")
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) ListTrashItems(zoneID string) []*models.TrashItem {
+	return s.queryTrashItems(`
+		SELECT id, zone_id, original_path, name, is_dir, size, deleted_by, deleted_by_name, deleted_at
+		FROM trash_items WHERE zone_id = ? ORDER BY deleted_at DESC`, zoneID)
+}
+
+// ListExpiredTrashItems returns items (across all zones) deleted before the cutoff
+func (s *SQLiteStore) ListExpiredTrashItems(before time.Time) []*models.TrashItem {
+	return s.queryTrashItems(`
+		SELECT id, zone_id, original_path, name, is_dir, size, deleted_by, deleted_by_name, deleted_at
+		FROM trash_items WHERE deleted_at < ? ORDER BY deleted_at`, before)
+}
+
+func (s *SQLiteStore) queryTrashItems(query string, args ...interface{}) []*models.TrashItem {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return []*models.TrashItem{}
+	}
+	defer rows.Close()
+
+	items := []*models.TrashItem{}
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTrashItem(row rowScanner) (*models.TrashItem, error) {
+	var item models.TrashItem
+	var isDir int
+	var deletedBy, deletedByName sql.NullString
+
+	if err := row.Scan(&item.ID, &item.ZoneID, &item.OriginalPath, &item.Name, &isDir, &item.Size,
+		&deletedBy, &deletedByName, &item.DeletedAt); err != nil {
+		return nil, err
+	}
+
+	item.IsDir = isDir == 1
+	item.DeletedBy = deletedBy.String
+	item.DeletedByName = deletedByName.String
+	return &item, nil
+}
+
+// ============================================================================
+// Quarantine Operations
+// ============================================================================
+
+func (s *SQLiteStore) CreateQuarantineItem(item *models.QuarantineItem) (*models.QuarantineItem, error) {
+	if item.ID == "" {
+		item.ID = uuid.New().String()
+	}
+	if item.QuarantinedAt.IsZero() {
+		item.QuarantinedAt = time.Now()
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO quarantine_items (id, zone_id, original_path, name, size, signature, uploaded_by, uploaded_by_name, quarantined_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		item.ID, item.ZoneID, item.OriginalPath, item.Name, item.Size, item.Signature,
+		item.UploadedBy, item.UploadedByName, item.QuarantinedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (s *SQLiteStore) GetQuarantineItem(id string) (*models.QuarantineItem, error) {
+	row := s.db.QueryRow(`
+		SELECT id, zone_id, original_path, name, size, signature, uploaded_by, uploaded_by_name, quarantined_at
+		FROM quarantine_items WHERE id = ?`, id)
+
+	item, err := scanQuarantineItem(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("quarantine item not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *SQLiteStore) DeleteQuarantineItem(id string) error {
+	result, err := s.db.Exec("DELETE FROM quarantine_items WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("quarantine item not found")
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) ListQuarantineItems() []*models.QuarantineItem {
+	items := []*models.QuarantineItem{}
+	rows, err := s.db.Query(`
+		SELECT id, zone_id, original_path, name, size, signature, uploaded_by, uploaded_by_name, quarantined_at
+		FROM quarantine_items ORDER BY quarantined_at DESC`)
+	if err != nil {
+		return items
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanQuarantineItem(rows)
+		if err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func scanQuarantineItem(row rowScanner) (*models.QuarantineItem, error) {
+	var item models.QuarantineItem
+	var uploadedBy, uploadedByName sql.NullString
+	err := row.Scan(&item.ID, &item.ZoneID, &item.OriginalPath, &item.Name, &item.Size, &item.Signature,
+		&uploadedBy, &uploadedByName, &item.QuarantinedAt)
+	if err != nil {
+		return nil, err
+	}
+	item.UploadedBy = uploadedBy.String
+	item.UploadedByName = uploadedByName.String
+	return &item, nil
+}
+
+// ============================================================================
+// File Version Operations
+// ============================================================================
+
+func (s *SQLiteStore) CreateFileVersion(version *models.FileVersion) (*models.FileVersion, error) {
+	if version.ID == "" {
+		version.ID = uuid.New().String()
+	}
+	if version.CreatedAt.IsZero() {
+		version.CreatedAt = time.Now()
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO file_versions (id, zone_id, path, size, mod_time, created_by, created_by_name, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		version.ID, version.ZoneID, version.Path, version.Size, version.ModTime,
+		version.CreatedBy, version.CreatedByName, version.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+func (s *SQLiteStore) GetFileVersion(id string) (*models.FileVersion, error) {
+	row := s.db.QueryRow(`
+		SELECT id, zone_id, path, size, mod_time, created_by, created_by_name, created_at
+		FROM file_versions WHERE id = ?`, id)
+
+	version, err := scanFileVersion(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("file version not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+func (s *SQLiteStore) DeleteFileVersion(id string) error {
+	result, err := s.db.Exec("DELETE FROM file_versions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("file version not found")
+	}
+
+	return nil
+}
+
+// ListFileVersions returns the versions of a single file, newest first
+func (s *SQLiteStore) ListFileVersions(zoneID, path string) []*models.FileVersion {
+	return s.queryFileVersions(`
+		SELECT id, zone_id, path, size, mod_time, created_by, created_by_name, created_at
+		FROM file_versions WHERE zone_id = ? AND path = ? ORDER BY created_at DESC`, zoneID, path)
+}
+
+// ListZoneFileVersions returns every version stored for a zone, oldest first
+func (s *SQLiteStore) ListZoneFileVersions(zoneID string) []*models.FileVersion {
+	return s.queryFileVersions(`
+		SELECT id, zone_id, path, size, mod_time, created_by, created_by_name, created_at
+		FROM file_versions WHERE zone_id = ? ORDER BY created_at`, zoneID)
+}
+
+func (s *SQLiteStore) queryFileVersions(query string, args ...interface{}) []*models.FileVersion {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return []*models.FileVersion{}
+	}
+	defer rows.Close()
+
+	versions := []*models.FileVersion{}
+	for rows.Next() {
+		version, err := scanFileVersion(rows)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func scanFileVersion(row rowScanner) (*models.FileVersion, error) {
+	var version models.FileVersion
+	var modTime sql.NullTime
+	var createdBy, createdByName sql.NullString
+
+	if err := row.Scan(&version.ID, &version.ZoneID, &version.Path, &version.Size, &modTime,
+		&createdBy, &createdByName, &version.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if modTime.Valid {
+		version.ModTime = modTime.Time
+	}
+	version.CreatedBy = createdBy.String
+	version.CreatedByName = createdByName.String
+	return &version, nil
+}
+
+// GetZoneVersioning returns the versioning configuration for a zone, or the defaults if none is saved
+func (s *SQLiteStore) GetZoneVersioning(zoneID string) *models.ZoneVersioning {
+	cfg := models.ZoneVersioning{ZoneID: zoneID}
+	var enabled int
+
+	err := s.db.QueryRow(`
+		SELECT enabled, max_versions, max_storage, updated_at FROM zone_versioning WHERE zone_id = ?`, zoneID).
+		Scan(&enabled, &cfg.MaxVersions, &cfg.MaxStorage, &cfg.UpdatedAt)
+	if err != nil {
+		return models.DefaultZoneVersioning(zoneID)
+	}
+
+	cfg.Enabled = enabled == 1
+	return &cfg
+}
+
+func (s *SQLiteStore) SetZoneVersioning(cfg *models.ZoneVersioning) error {
+	cfg.UpdatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO zone_versioning (zone_id, enabled, max_versions, max_storage, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(zone_id) DO UPDATE SET
+			enabled=excluded.enabled, max_versions=excluded.max_versions,
+			max_storage=excluded.max_storage, updated_at=excluded.updated_at`,
+		cfg.ZoneID, boolToInt(cfg.Enabled), cfg.MaxVersions, cfg.MaxStorage, cfg.UpdatedAt)
+	return err
+}
+
+// ============================================================================
+// Zone Project Quota Operations
+// ============================================================================
+
+func (s *SQLiteStore) GetZoneProjectQuota(zoneID string) (*models.ZoneProjectQuota, error) {
+	var quota models.ZoneProjectQuota
+	err := s.db.QueryRow(`
+		SELECT zone_id, limit_bytes, method, target, project_id, updated_at
+		FROM zone_project_quotas WHERE zone_id = ?`, zoneID).
+		Scan(&quota.ZoneID, &quota.Limit, &quota.Method, &quota.Target, &quota.ProjectID, &quota.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("zone has no project quota")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+func (s *SQLiteStore) SetZoneProjectQuota(quota *models.ZoneProjectQuota) error {
+	quota.UpdatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO zone_project_quotas (zone_id, limit_bytes, method, target, project_id, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(zone_id) DO UPDATE SET
+			limit_bytes=excluded.limit_bytes, method=excluded.method, target=excluded.target,
+			project_id=excluded.project_id, updated_at=excluded.updated_at`,
+		quota.ZoneID, quota.Limit, quota.Method, quota.Target, quota.ProjectID, quota.UpdatedAt)
+	return err
+}
+
+func (s *SQLiteStore) DeleteZoneProjectQuota(zoneID string) error {
+	_, err := s.db.Exec("DELETE FROM zone_project_quotas WHERE zone_id = ?", zoneID)
+	return err
+}
+
+func (s *SQLiteStore) ListZoneProjectQuotas() []*models.ZoneProjectQuota {
+	quotas := []*models.ZoneProjectQuota{}
+	rows, err := s.db.Query(`
+		SELECT zone_id, limit_bytes, method, target, project_id, updated_at
+		FROM zone_project_quotas ORDER BY zone_id`)
+	if err != nil {
+		return quotas
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var quota models.ZoneProjectQuota
+		if err := rows.Scan(&quota.ZoneID, &quota.Limit, &quota.Method, &quota.Target, &quota.ProjectID, &quota.UpdatedAt); err != nil {
+			continue
+		}
+		quotas = append(quotas, &quota)
+	}
+	return quotas
+}
+
+// ============================================================================
+// API Token Operations
+// ============================================================================
+
+func (s *SQLiteStore) CreateAPIToken(token *models.APIToken) (*models.APIToken, error) {
+	token.ID = uuid.New().String()
+	token.CreatedAt = time.Now()
+
+	if token.Groups == nil {
+		token.Groups = []string{}
+	}
+	if token.Zones == nil {
+		token.Zones = []string{}
+	}
+	groupsJSON, _ := json.Marshal(token.Groups)
+	zonesJSON, _ := json.Marshal(token.Zones)
+
+	_, err := s.db.Exec(`
+		INSERT INTO api_tokens (id, user_id, username, groups, name, token_hash, token_prefix, scope, zones, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		token.ID, token.UserID, token.Username, string(groupsJSON), token.Name, token.TokenHash,
+		token.TokenPrefix, string(token.Scope), string(zonesJSON), token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *SQLiteStore) GetAPIToken(id string) (*models.APIToken, error) {
+	row := s.db.QueryRow(`
+		SELECT id, user_id, username, groups, name, token_hash, token_prefix, scope, zones, expires_at, last_used_at, created_at
+		FROM api_tokens WHERE id = ?`, id)
+	return s.scanAPIToken(row)
+}
+
+func (s *SQLiteStore) GetAPITokenByHash(hash string) (*models.APIToken, error) {
+	row := s.db.QueryRow(`
+		SELECT id, user_id, username, groups, name, token_hash, token_prefix, scope, zones, expires_at, last_used_at, created_at
+		FROM api_tokens WHERE token_hash = ?`, hash)
+	return s.scanAPIToken(row)
+}
+
+func (s *SQLiteStore) scanAPIToken(row rowScanner) (*models.APIToken, error) {
+	var token models.APIToken
+	var groupsJSON, zonesJSON sql.NullString
+	var scope string
+	var expiresAt, lastUsedAt sql.NullTime
+
+	err := row.Scan(&token.ID, &token.UserID, &token.Username, &groupsJSON, &token.Name, &token.TokenHash,
+		&token.TokenPrefix, &scope, &zonesJSON, &expiresAt, &lastUsedAt, &token.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("API token not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scope = models.APITokenScope(scope)
+	token.Groups = []string{}
+	token.Zones = []string{}
+	if groupsJSON.Valid {
+		json.Unmarshal([]byte(groupsJSON.String), &token.Groups)
+	}
+	if zonesJSON.Valid {
+		json.Unmarshal([]byte(zonesJSON.String), &token.Zones)
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &token, nil
+}
+
+func (s *SQLiteStore) DeleteAPIToken(id string) error {
+	result, err := s.db.Exec("DELETE FROM api_tokens WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("API token not found")
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) ListAPITokens() []*models.APIToken {
+	return s.queryAPITokens(`
+		SELECT id, user_id, username, groups, name, token_hash, token_prefix, scope, zones, expires_at, last_used_at, created_at
+		FROM api_tokens ORDER BY created_at DESC`)
+}
+
+func (s *SQLiteStore) ListAPITokensByUser(userID string) []*models.APIToken {
+	return s.queryAPITokens(`
+		SELECT id, user_id, username, groups, name, token_hash, token_prefix, scope, zones, expires_at, last_used_at, created_at
+		FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC`, userID)
+}
+
+func (s *SQLiteStore) queryAPITokens(query string, args ...interface{}) []*models.APIToken {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return []*models.APIToken{}
+	}
+	defer rows.Close()
+
+	tokens := []*models.APIToken{}
+	for rows.Next() {
+		token, err := s.scanAPIToken(rows)
+		if err != nil {
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func (s *SQLiteStore) UpdateAPITokenLastUsed(id string, lastUsed time.Time) error {
+	_, err := s.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", lastUsed, id)
+	return err
+}
+
+// ============================================================================
+// Folder Share Operations
+// ============================================================================
+
+func (s *SQLiteStore) CreateFolderShare(share *models.FolderShare) (*models.FolderShare, error) {
+	share.ID = uuid.New().String()
+	share.CreatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO folder_shares (id, owner_id, owner_name, zone_id, path, recipient_type, recipient, permission, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		share.ID, share.OwnerID, share.OwnerName, share.ZoneID, share.Path,
+		string(share.RecipientType), share.Recipient, string(share.Permission), share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return share, nil
+}
+
+func (s *SQLiteStore) GetFolderShare(id string) (*models.FolderShare, error) {
+	row := s.db.QueryRow(`
+		SELECT id, owner_id, owner_name, zone_id, path, recipient_type, recipient, permission, created_at
+		FROM folder_shares WHERE id = ?`, id)
+	return s.scanFolderShare(row)
+}
+
+func (s *SQLiteStore) scanFolderShare(row rowScanner) (*models.FolderShare, error) {
+	var share models.FolderShare
+	var recipientType, permission string
+
+	err := row.Scan(&share.ID, &share.OwnerID, &share.OwnerName, &share.ZoneID, &share.Path,
+		&recipientType, &share.Recipient, &permission, &share.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("folder share not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	share.RecipientType = models.FolderShareRecipient(recipientType)
+	share.Permission = models.FolderSharePermission(permission)
+	return &share, nil
+}
+
+func (s *SQLiteStore) DeleteFolderShare(id string) error {
+	result, err := s.db.Exec("DELETE FROM folder_shares WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return errors.New("folder share not found")
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListFolderShares() []*models.FolderShare {
+	return s.listFolderShares(`
+		SELECT id, owner_id, owner_name, zone_id, path, recipient_type, recipient, permission, created_at
+		FROM folder_shares ORDER BY created_at DESC`)
+}
+
+func (s *SQLiteStore) ListFolderSharesByOwner(ownerID string) []*models.FolderShare {
+	return s.listFolderShares(`
+		SELECT id, owner_id, owner_name, zone_id, path, recipient_type, recipient, permission, created_at
+		FROM folder_shares WHERE owner_id = ? ORDER BY created_at DESC`, ownerID)
+}
+
+func (s *SQLiteStore) listFolderShares(query string, args ...interface{}) []*models.FolderShare {
+	shares := []*models.FolderShare{}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return shares
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		share, err := s.scanFolderShare(rows)
+		if err != nil {
+			continue
+		}
+		shares = append(shares, share)
+	}
+	return shares
+}
+
+// ============================================================================
+// Replication Operations
+// ============================================================================
+
+const replicationJobColumns = `id, name, source_dataset, target_host, target_port, target_user, ssh_key_path, target_dataset,
+	schedule, recursive, retention, enabled, last_run, next_run, last_status, last_error, last_snapshot, created_at, updated_at`
+
+func (s *SQLiteStore) CreateReplicationJob(job *models.ReplicationJob) (*models.ReplicationJob, error) {
+	job.ID = uuid.New().String()
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = time.Now()
+
+	if job.TargetPort == 0 {
+		job.TargetPort = 22
+	}
+	if job.Retention == 0 {
+		job.Retention = 3
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO replication_jobs (`+replicationJobColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Name, job.SourceDataset, job.TargetHost, job.TargetPort, job.TargetUser, job.SSHKeyPath,
+		job.TargetDataset, job.Schedule, boolToInt(job.Recursive), job.Retention, boolToInt(job.Enabled),
+		job.LastRun, job.NextRun, job.LastStatus, job.LastError, job.LastSnapshot, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("replication job name already exists")
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (s *SQLiteStore) GetReplicationJob(id string) (*models.ReplicationJob, error) {
+	row := s.db.QueryRow(`SELECT `+replicationJobColumns+` FROM replication_jobs WHERE id = ?`, id)
+
+	job, err := scanReplicationJob(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("replication job not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *SQLiteStore) UpdateReplicationJob(id string, updates map[string]interface{}) (*models.ReplicationJob, error) {
+	job, err := s.GetReplicationJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if name, ok := updates["name"].(string); ok {
+		job.Name = name
+	}
+	if sourceDataset, ok := updates["source_dataset"].(string); ok {
+		job.SourceDataset = sourceDataset
+	}
+	if targetHost, ok := updates["target_host"].(string); ok {
+		job.TargetHost = targetHost
+	}
+	if targetPort, ok := updates["target_port"].(float64); ok {
+		job.TargetPort = int(targetPort)
+	}
+	if targetUser, ok := updates["target_user"].(string); ok {
+		job.TargetUser = targetUser
+	}
+	if sshKeyPath, ok := updates["ssh_key_path"].(string); ok {
+		job.SSHKeyPath = sshKeyPath
+	}
+	if targetDataset, ok := updates["target_dataset"].(string); ok {
+		job.TargetDataset = targetDataset
+	}
+	if schedule, ok := updates["schedule"].(string); ok {
+		job.Schedule = schedule
+	}
+	if recursive, ok := updates["recursive"].(bool); ok {
+		job.Recursive = recursive
+	}
+	if retention, ok := updates["retention"].(float64); ok {
+		job.Retention = int(retention)
+	}
+	if enabled, ok := updates["enabled"].(bool); ok {
+		job.Enabled = enabled
+	}
+	if nextRun, ok := updates["next_run"].(time.Time); ok {
+		job.NextRun = &nextRun
+	}
+
+	job.UpdatedAt = time.Now()
+
+	_, err = s.db.Exec(`
+		UPDATE replication_jobs SET name = ?, source_dataset = ?, target_host = ?, target_port = ?, target_user = ?,
+			ssh_key_path = ?, target_dataset = ?, schedule = ?, recursive = ?, retention = ?, enabled = ?, next_run = ?, updated_at = ?
+		WHERE id = ?`,
+		job.Name, job.SourceDataset, job.TargetHost, job.TargetPort, job.TargetUser, job.SSHKeyPath,
+		job.TargetDataset, job.Schedule, boolToInt(job.Recursive), job.Retention, boolToInt(job.Enabled),
+		job.NextRun, job.UpdatedAt, job.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("replication job name already exists")
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (s *SQLiteStore) DeleteReplicationJob(id string) error {
+	result, err := s.db.Exec("DELETE FROM replication_jobs WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("replication job not found")
+	}
+
+	_, err = s.db.Exec("DELETE FROM replication_runs WHERE job_id = ?", id)
+	return err
+}
+
+func (s *SQLiteStore) ListReplicationJobs() []*models.ReplicationJob {
+	jobs := []*models.ReplicationJob{}
+	rows, err := s.db.Query(`SELECT ` + replicationJobColumns + ` FROM replication_jobs ORDER BY name`)
+	if err != nil {
+		return jobs
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		job, err := scanReplicationJob(rows)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+func (s *SQLiteStore) UpdateReplicationJobRun(id string, lastRun time.Time, nextRun time.Time, status, lastSnapshot, lastError string) error {
+	_, err := s.db.Exec(`
+		UPDATE replication_jobs SET last_run = ?, next_run = ?, last_status = ?, last_snapshot = ?, last_error = ?, updated_at = ?
+		WHERE id = ?`,
+		lastRun, nextRun, status, lastSnapshot, lastError, time.Now(), id)
+	return err
+}
+
+func scanReplicationJob(row rowScanner) (*models.ReplicationJob, error) {
+	var job models.ReplicationJob
+	var recursive, enabled int
+	var targetHost, targetUser, sshKeyPath, lastStatus, lastError, lastSnapshot sql.NullString
+	var lastRun, nextRun sql.NullTime
+
+	err := row.Scan(&job.ID, &job.Name, &job.SourceDataset, &targetHost, &job.TargetPort, &targetUser, &sshKeyPath,
+		&job.TargetDataset, &job.Schedule, &recursive, &job.Retention, &enabled, &lastRun, &nextRun,
+		&lastStatus, &lastError, &lastSnapshot, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.TargetHost = targetHost.String
+	job.TargetUser = targetUser.String
+	job.SSHKeyPath = sshKeyPath.String
+	job.Recursive = recursive == 1
+	job.Enabled = enabled == 1
+	if lastRun.Valid {
+		job.LastRun = &lastRun.Time
+	}
+	if nextRun.Valid {
+		job.NextRun = &nextRun.Time
+	}
+	job.LastStatus = lastStatus.String
+	job.LastError = lastError.String
+	job.LastSnapshot = lastSnapshot.String
+	return &job, nil
+}
+
+func (s *SQLiteStore) CreateReplicationRun(run *models.ReplicationRun) (*models.ReplicationRun, error) {
+	if run.ID == "" {
+		run.ID = uuid.New().String()
+	}
+	if run.StartedAt.IsZero() {
+		run.StartedAt = time.Now()
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO replication_runs (id, job_id, status, snapshot, base_snapshot, resumed, bytes_sent, error, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.ID, run.JobID, run.Status, run.Snapshot, run.BaseSnapshot, boolToInt(run.Resumed),
+		run.BytesSent, run.Error, run.StartedAt, run.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func (s *SQLiteStore) UpdateReplicationRun(run *models.ReplicationRun) error {
+	_, err := s.db.Exec(`
+		UPDATE replication_runs SET status = ?, snapshot = ?, base_snapshot = ?, resumed = ?, bytes_sent = ?, error = ?, finished_at = ?
+		WHERE id = ?`,
+		run.Status, run.Snapshot, run.BaseSnapshot, boolToInt(run.Resumed), run.BytesSent, run.Error, run.FinishedAt, run.ID)
+	return err
+}
+
+func (s *SQLiteStore) ListReplicationRuns(jobID string, limit int) []*models.ReplicationRun {
+	runs := []*models.ReplicationRun{}
+	rows, err := s.db.Query(`
+		SELECT id, job_id, status, snapshot, base_snapshot, resumed, bytes_sent, error, started_at, finished_at
+		FROM replication_runs WHERE job_id = ? ORDER BY started_at DESC LIMIT ?`, jobID, limit)
+	if err != nil {
+		return runs
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var run models.ReplicationRun
+		var resumed int
+		var snapshot, baseSnapshot, runError sql.NullString
+		var finishedAt sql.NullTime
+
+		if err := rows.Scan(&run.ID, &run.JobID, &run.Status, &snapshot, &baseSnapshot, &resumed,
+			&run.BytesSent, &runError, &run.StartedAt, &finishedAt); err != nil {
+			continue
+		}
+
+		run.Snapshot = snapshot.String
+		run.BaseSnapshot = baseSnapshot.String
+		run.Resumed = resumed == 1
+		run.Error = runError.String
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		runs = append(runs, &run)
+	}
+	return runs
+}
+
+// PruneReplicationRuns keeps only the newest history entries of a job
+func (s *SQLiteStore) PruneReplicationRuns(jobID string, keep int) error {
+	_, err := s.db.Exec(`
+		DELETE FROM replication_runs WHERE job_id = ? AND id NOT IN (
+			SELECT id FROM replication_runs WHERE job_id = ? ORDER BY started_at DESC LIMIT ?
+		)`, jobID, jobID, keep)
+	return err
+}
+
+// FailInterruptedReplicationRuns marks runs left in the running state by a previous process as failed
+func (s *SQLiteStore) FailInterruptedReplicationRuns(message string) error {
+	_, err := s.db.Exec(`UPDATE replication_runs SET status = ?, error = ?, finished_at = ? WHERE status = ?`,
+		models.ReplicationStatusFailed, message, time.Now(), models.ReplicationStatusRunning)
+	return err
+}
+
+// ============================================================================
+// Maintenance Operations
+// ============================================================================
+
+const maintenanceScheduleColumns = `id, type, target, schedule, enabled, last_run, next_run, last_status, last_error, created_at, updated_at`
+
+func (s *SQLiteStore) CreateMaintenanceSchedule(schedule *models.MaintenanceSchedule) (*models.MaintenanceSchedule, error) {
+	schedule.ID = uuid.New().String()
+	schedule.CreatedAt = time.Now()
+	schedule.UpdatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO maintenance_schedules (`+maintenanceScheduleColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		schedule.ID, schedule.Type, schedule.Target, schedule.Schedule, boolToInt(schedule.Enabled),
+		schedule.LastRun, schedule.NextRun, schedule.LastStatus, schedule.LastError, schedule.CreatedAt, schedule.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("a maintenance schedule already exists for this target")
+		}
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func (s *SQLiteStore) GetMaintenanceSchedule(id string) (*models.MaintenanceSchedule, error) {
+	row := s.db.QueryRow(`SELECT `+maintenanceScheduleColumns+` FROM maintenance_schedules WHERE id = ?`, id)
+
+	schedule, err := scanMaintenanceSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("maintenance schedule not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (s *SQLiteStore) UpdateMaintenanceSchedule(id string, updates map[string]interface{}) (*models.MaintenanceSchedule, error) {
+	schedule, err := s.GetMaintenanceSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if sched, ok := updates["schedule"].(string); ok {
+		schedule.Schedule = sched
+	}
+	if enabled, ok := updates["enabled"].(bool); ok {
+		schedule.Enabled = enabled
+	}
+	if nextRun, ok := updates["next_run"].(time.Time); ok {
+		schedule.NextRun = &nextRun
+	}
+
+	schedule.UpdatedAt = time.Now()
+
+	_, err = s.db.Exec(`
+		UPDATE maintenance_schedules SET schedule = ?, enabled = ?, next_run = ?, updated_at = ?
+		WHERE id = ?`,
+		schedule.Schedule, boolToInt(schedule.Enabled), schedule.NextRun, schedule.UpdatedAt, schedule.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func (s *SQLiteStore) DeleteMaintenanceSchedule(id string) error {
+	result, err := s.db.Exec("DELETE FROM maintenance_schedules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("maintenance schedule not found")
+	}
+
+	_, err = s.db.Exec("DELETE FROM maintenance_runs WHERE schedule_id = ?", id)
+	return err
+}
+
+func (s *SQLiteStore) ListMaintenanceSchedules() []*models.MaintenanceSchedule {
+	schedules := []*models.MaintenanceSchedule{}
+	rows, err := s.db.Query(`SELECT ` + maintenanceScheduleColumns + ` FROM maintenance_schedules ORDER BY type, target`)
+	if err != nil {
+		return schedules
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		schedule, err := scanMaintenanceSchedule(rows)
+		if err != nil {
+			continue
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules
+}
+
+func (s *SQLiteStore) UpdateMaintenanceScheduleRun(id string, lastRun time.Time, nextRun time.Time, status, lastError string) error {
+	_, err := s.db.Exec(`
+		UPDATE maintenance_schedules SET last_run = ?, next_run = ?, last_status = ?, last_error = ?, updated_at = ?
+		WHERE id = ?`,
+		lastRun, nextRun, status, lastError, time.Now(), id)
+	return err
+}
+
+func scanMaintenanceSchedule(row rowScanner) (*models.MaintenanceSchedule, error) {
+	var schedule models.MaintenanceSchedule
+	var enabled int
+	var lastStatus, lastError sql.NullString
+	var lastRun, nextRun sql.NullTime
+
+	err := row.Scan(&schedule.ID, &schedule.Type, &schedule.Target, &schedule.Schedule, &enabled,
+		&lastRun, &nextRun, &lastStatus, &lastError, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.Enabled = enabled == 1
+	if lastRun.Valid {
+		schedule.LastRun = &lastRun.Time
+	}
+	if nextRun.Valid {
+		schedule.NextRun = &nextRun.Time
+	}
+	schedule.LastStatus = lastStatus.String
+	schedule.LastError = lastError.String
+	return &schedule, nil
+}
+
+func (s *SQLiteStore) CreateMaintenanceRun(run *models.MaintenanceRun) (*models.MaintenanceRun, error) {
+	if run.ID == "" {
+		run.ID = uuid.New().String()
+	}
+	if run.StartedAt.IsZero() {
+		run.StartedAt = time.Now()
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO maintenance_runs (id, schedule_id, type, target, status, errors_found, summary, error, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.ID, run.ScheduleID, run.Type, run.Target, run.Status, run.ErrorsFound, run.Summary, run.Error,
+		run.StartedAt, run.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func (s *SQLiteStore) UpdateMaintenanceRun(run *models.MaintenanceRun) error {
+	_, err := s.db.Exec(`
+		UPDATE maintenance_runs SET status = ?, errors_found = ?, summary = ?, error = ?, finished_at = ?
+		WHERE id = ?`,
+		run.Status, run.ErrorsFound, run.Summary, run.Error, run.FinishedAt, run.ID)
+	return err
+}
+
+func (s *SQLiteStore) ListMaintenanceRuns(scheduleID string, limit int) []*models.MaintenanceRun {
+	runs := []*models.MaintenanceRun{}
+	rows, err := s.db.Query(`
+		SELECT id, schedule_id, type, target, status, errors_found, summary, error, started_at, finished_at
+		FROM maintenance_runs WHERE schedule_id = ? ORDER BY started_at DESC LIMIT ?`, scheduleID, limit)
+	if err != nil {
+		return runs
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var run models.MaintenanceRun
+		var summary, runError sql.NullString
+		var finishedAt sql.NullTime
+
+		if err := rows.Scan(&run.ID, &run.ScheduleID, &run.Type, &run.Target, &run.Status, &run.ErrorsFound,
+			&summary, &runError, &run.StartedAt, &finishedAt); err != nil {
+			continue
+		}
+
+		run.Summary = summary.String
+		run.Error = runError.String
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		runs = append(runs, &run)
+	}
+	return runs
+}
+
+// PruneMaintenanceRuns keeps only the newest history entries of a schedule
+func (s *SQLiteStore) PruneMaintenanceRuns(scheduleID string, keep int) error {
+	_, err := s.db.Exec(`
+		DELETE FROM maintenance_runs WHERE schedule_id = ? AND id NOT IN (
+			SELECT id FROM maintenance_runs WHERE schedule_id = ? ORDER BY started_at DESC LIMIT ?
+		)`, scheduleID, scheduleID, keep)
+	return err
+}
+
+// FailInterruptedMaintenanceRuns marks runs left in the running state by a previous process as failed
+func (s *SQLiteStore) FailInterruptedMaintenanceRuns(message string) error {
+	_, err := s.db.Exec(`UPDATE maintenance_runs SET status = ?, error = ?, finished_at = ? WHERE status = ?`,
+		models.MaintenanceStatusFailed, message, time.Now(), models.MaintenanceStatusRunning)
+	return err
+}
+
+// ============================================================================
+// Retention Policy Operations
+// ============================================================================
+
+const retentionPolicyColumns = `id, name, zone_id, path, pattern, max_age_days, action, archive_zone_id, archive_path,
+	schedule, enabled, last_run, next_run, last_status, last_error, created_at, updated_at`
+
+func (s *SQLiteStore) CreateRetentionPolicy(policy *models.RetentionPolicy) (*models.RetentionPolicy, error) {
+	policy.ID = uuid.New().String()
+	policy.CreatedAt = time.Now()
+	policy.UpdatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO retention_policies (`+retentionPolicyColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		policy.ID, policy.Name, policy.ZoneID, policy.Path, policy.Pattern, policy.MaxAgeDays, policy.Action,
+		policy.ArchiveZoneID, policy.ArchivePath, policy.Schedule, boolToInt(policy.Enabled),
+		policy.LastRun, policy.NextRun, policy.LastStatus, policy.LastError, policy.CreatedAt, policy.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (s *SQLiteStore) GetRetentionPolicy(id string) (*models.RetentionPolicy, error) {
+	row := s.db.QueryRow(`SELECT `+retentionPolicyColumns+` FROM retention_policies WHERE id = ?`, id)
+
+	policy, err := scanRetentionPolicy(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("retention policy not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (s *SQLiteStore) UpdateRetentionPolicy(policy *models.RetentionPolicy) error {
+	policy.UpdatedAt = time.Now()
+
+	result, err := s.db.Exec(`
+		UPDATE retention_policies SET name = ?, path = ?, pattern = ?, max_age_days = ?, action = ?,
+			archive_zone_id = ?, archive_path = ?, schedule = ?, enabled = ?, next_run = ?, updated_at = ?
+		WHERE id = ?`,
+		policy.Name, policy.Path, policy.Pattern, policy.MaxAgeDays, policy.Action,
+		policy.ArchiveZoneID, policy.ArchivePath, policy.Schedule, boolToInt(policy.Enabled),
+		policy.NextRun, policy.UpdatedAt, policy.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("retention policy not found")
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteRetentionPolicy(id string) error {
+	result, err := s.db.Exec("DELETE FROM retention_policies WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("retention policy not found")
+	}
+
+	_, err = s.db.Exec("DELETE FROM retention_actions WHERE policy_id = ?", id)
+	return err
+}
+
+func (s *SQLiteStore) ListRetentionPolicies() []*models.RetentionPolicy {
+	policies := []*models.RetentionPolicy{}
+	rows, err := s.db.Query(`SELECT ` + retentionPolicyColumns + ` FROM retention_policies ORDER BY name`)
+	if err != nil {
+		return policies
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		policy, err := scanRetentionPolicy(rows)
+		if err != nil {
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	return policies
+}
+
+func (s *SQLiteStore) UpdateRetentionPolicyRun(id string, lastRun time.Time, nextRun time.Time, status, lastError string) error {
+	_, err := s.db.Exec(`
+		UPDATE retention_policies SET last_run = ?, next_run = ?, last_status = ?, last_error = ?, updated_at = ?
+		WHERE id = ?`,
+		lastRun, nextRun, status, lastError, time.Now(), id)
+	return err
+}
+
+func scanRetentionPolicy(row rowScanner) (*models.RetentionPolicy, error) {
+	var policy models.RetentionPolicy
+	var enabled int
+	var pattern, archiveZoneID, archivePath, lastStatus, lastError sql.NullString
+	var lastRun, nextRun sql.NullTime
+
+	err := row.Scan(&policy.ID, &policy.Name, &policy.ZoneID, &policy.Path, &pattern, &policy.MaxAgeDays,
+		&policy.Action, &archiveZoneID, &archivePath, &policy.Schedule, &enabled,
+		&lastRun, &nextRun, &lastStatus, &lastError, &policy.CreatedAt, &policy.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	policy.Pattern = pattern.String
+	policy.ArchiveZoneID = archiveZoneID.String
+	policy.ArchivePath = archivePath.String
+	policy.Enabled = enabled == 1
+	if lastRun.Valid {
+		policy.LastRun = &lastRun.Time
+	}
+	if nextRun.Valid {
+		policy.NextRun = &nextRun.Time
+	}
+	policy.LastStatus = lastStatus.String
+	policy.LastError = lastError.String
+	return &policy, nil
+}
+
+// AddRetentionActions records the files handled by a retention run in a single transaction
+func (s *SQLiteStore) AddRetentionActions(actions []*models.RetentionAction) error {
+	if len(actions) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO retention_actions (id, policy_id, zone_id, path, action, destination, size, mod_time, error, performed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, a := range actions {
+		if a.ID == "" {
+			a.ID = uuid.New().String()
+		}
+		if _, err := stmt.Exec(a.ID, a.PolicyID, a.ZoneID, a.Path, a.Action, a.Destination, a.Size,
+			a.ModTime, a.Error, a.PerformedAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ListRetentionActions(policyID string, limit int) []*models.RetentionAction {
+	actions := []*models.RetentionAction{}
+	rows, err := s.db.Query(`
+		SELECT id, policy_id, zone_id, path, action, destination, size, mod_time, error, performed_at
+		FROM retention_actions WHERE policy_id = ? ORDER BY performed_at DESC, path LIMIT ?`, policyID, limit)
+	if err != nil {
+		return actions
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.RetentionAction
+		var destination, actionError sql.NullString
+
+		if err := rows.Scan(&a.ID, &a.PolicyID, &a.ZoneID, &a.Path, &a.Action, &destination, &a.Size,
+			&a.ModTime, &actionError, &a.PerformedAt); err != nil {
+			continue
+		}
+
+		a.Destination = destination.String
+		a.Error = actionError.String
+		actions = append(actions, &a)
+	}
+	return actions
+}
+
+// PruneRetentionActions keeps only the newest log entries of a policy
+func (s *SQLiteStore) PruneRetentionActions(policyID string, keep int) error {
+	_, err := s.db.Exec(`
+		DELETE FROM retention_actions WHERE policy_id = ? AND id NOT IN (
+			SELECT id FROM retention_actions WHERE policy_id = ? ORDER BY performed_at DESC LIMIT ?
+		)`, policyID, policyID, keep)
+	return err
+}
+
+// ============================================================================
+// iSCSI Target Operations
+// ============================================================================
+
+const iscsiTargetColumns = `id, name, iqn, luns, initiators, chap_user, chap_password, enabled, created_at, updated_at`
+
+func (s *SQLiteStore) CreateISCSITarget(target *models.ISCSITarget) (*models.ISCSITarget, error) {
+	target.ID = uuid.New().String()
+	target.CreatedAt = time.Now()
+	target.UpdatedAt = time.Now()
+
+	lunsJSON, _ := json.Marshal(target.LUNs)
+	initiatorsJSON, _ := json.Marshal(target.Initiators)
+
+	_, err := s.db.Exec(`
+		INSERT INTO iscsi_targets (`+iscsiTargetColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		target.ID, target.Name, target.IQN, string(lunsJSON), string(initiatorsJSON), target.CHAPUser,
+		target.CHAPPassword, boolToInt(target.Enabled), target.CreatedAt, target.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("iSCSI target name or IQN already exists")
+		}
+		return nil, err
+	}
+
+	return target, nil
+}
+
+func (s *SQLiteStore) GetISCSITarget(id string) (*models.ISCSITarget, error) {
+	row := s.db.QueryRow(`SELECT `+iscsiTargetColumns+` FROM iscsi_targets WHERE id = ?`, id)
+
+	target, err := scanISCSITarget(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("iSCSI target not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+func (s *SQLiteStore) UpdateISCSITarget(target *models.ISCSITarget) (*models.ISCSITarget, error) {
+	target.UpdatedAt = time.Now()
+
+	lunsJSON, _ := json.Marshal(target.LUNs)
+	initiatorsJSON, _ := json.Marshal(target.Initiators)
+
+	result, err := s.db.Exec(`
+		UPDATE iscsi_targets SET name = ?, iqn = ?, luns = ?, initiators = ?, chap_user = ?, chap_password = ?,
+			enabled = ?, updated_at = ?
+		WHERE id = ?`,
+		target.Name, target.IQN, string(lunsJSON), string(initiatorsJSON), target.CHAPUser, target.CHAPPassword,
+		boolToInt(target.Enabled), target.UpdatedAt, target.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("iSCSI target name or IQN already exists")
+		}
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, errors.New("iSCSI target not found")
+	}
+
+	return target, nil
+}
+
+func (s *SQLiteStore) DeleteISCSITarget(id string) error {
+	result, err := s.db.Exec("DELETE FROM iscsi_targets WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("iSCSI target not found")
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListISCSITargets() []*models.ISCSITarget {
+	targets := []*models.ISCSITarget{}
+	rows, err := s.db.Query(`SELECT ` + iscsiTargetColumns + ` FROM iscsi_targets ORDER BY name`)
+	if err != nil {
+		return targets
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		target, err := scanISCSITarget(rows)
+		if err != nil {
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+func scanISCSITarget(row rowScanner) (*models.ISCSITarget, error) {
+	var target models.ISCSITarget
+	var enabled int
+	var lunsJSON, initiatorsJSON, chapUser, chapPassword sql.NullString
+
+	err := row.Scan(&target.ID, &target.Name, &target.IQN, &lunsJSON, &initiatorsJSON, &chapUser, &chapPassword,
+		&enabled, &target.CreatedAt, &target.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	target.LUNs = []models.ISCSILUN{}
+	target.Initiators = []string{}
+	if lunsJSON.Valid {
+		json.Unmarshal([]byte(lunsJSON.String), &target.LUNs)
+	}
+	if initiatorsJSON.Valid {
+		json.Unmarshal([]byte(initiatorsJSON.String), &target.Initiators)
+	}
+	target.CHAPUser = chapUser.String
+	target.CHAPPassword = chapPassword.String
+	target.Enabled = enabled == 1
+	return &target, nil
+}
+
+// ============================================================================
+// Storage Alert Operations
+// ============================================================================
+
+const storageAlertColumns = `id, key, level, type, message, resource, status, first_seen, last_seen,
+	acknowledged_at, acknowledged_by, resolved_at, notified_at`
+
+func (s *SQLiteStore) CreateStorageAlert(alert *models.StorageAlertRecord) (*models.StorageAlertRecord, error) {
+	alert.ID = uuid.New().String()
+	if alert.FirstSeen.IsZero() {
+		alert.FirstSeen = time.Now()
+	}
+	if alert.LastSeen.IsZero() {
+		alert.LastSeen = alert.FirstSeen
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO storage_alerts (`+storageAlertColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		alert.ID, alert.Key, alert.Level, alert.Type, alert.Message, alert.Resource, alert.Status,
+		alert.FirstSeen, alert.LastSeen, alert.AcknowledgedAt, alert.AcknowledgedBy, alert.ResolvedAt, alert.NotifiedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return alert, nil
+}
+
+func (s *SQLiteStore) GetStorageAlert(id string) (*models.StorageAlertRecord, error) {
+	row := s.db.QueryRow(`SELECT `+storageAlertColumns+` FROM storage_alerts WHERE id = ?`, id)
+
+	alert, err := scanStorageAlert(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("storage alert not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+func (s *SQLiteStore) UpdateStorageAlert(alert *models.StorageAlertRecord) error {
+	result, err := s.db.Exec(`
+		UPDATE storage_alerts SET level = ?, message = ?, status = ?, last_seen = ?, acknowledged_at = ?,
+			acknowledged_by = ?, resolved_at = ?, notified_at = ?
+		WHERE id = ?`,
+		alert.Level, alert.Message, alert.Status, alert.LastSeen, alert.AcknowledgedAt,
+		alert.AcknowledgedBy, alert.ResolvedAt, alert.NotifiedAt, alert.ID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("storage alert not found")
+	}
+	return nil
+}
+
+// ListStorageAlerts returns alerts newest first. status filters by state; "open" matches
+// active and acknowledged alerts and an empty status matches all.
+func (s *SQLiteStore) ListStorageAlerts(status string, limit int) []*models.StorageAlertRecord {
+	alerts := []*models.StorageAlertRecord{}
+
+	query := `SELECT ` + storageAlertColumns + ` FROM storage_alerts`
+	var args []interface{}
+	switch status {
+	case "":
+	case "open":
+		query += ` WHERE status != ?`
+		args = append(args, models.AlertStatusResolved)
+	default:
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY last_seen DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return alerts
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		alert, err := scanStorageAlert(rows)
+		if err != nil {
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// PruneResolvedStorageAlerts deletes alerts resolved before the given time
+func (s *SQLiteStore) PruneResolvedStorageAlerts(before time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM storage_alerts WHERE status = ? AND resolved_at < ?`,
+		models.AlertStatusResolved, before)
+	return err
+}
+
+func scanStorageAlert(row rowScanner) (*models.StorageAlertRecord, error) {
+	var alert models.StorageAlertRecord
+	var resource, acknowledgedBy sql.NullString
+	var acknowledgedAt, resolvedAt, notifiedAt sql.NullTime
+
+	err := row.Scan(&alert.ID, &alert.Key, &alert.Level, &alert.Type, &alert.Message, &resource, &alert.Status,
+		&alert.FirstSeen, &alert.LastSeen, &acknowledgedAt, &acknowledgedBy, &resolvedAt, &notifiedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	alert.Resource = resource.String
+	alert.AcknowledgedBy = acknowledgedBy.String
+	if acknowledgedAt.Valid {
+		alert.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if resolvedAt.Valid {
+		alert.ResolvedAt = &resolvedAt.Time
+	}
+	if notifiedAt.Valid {
+		alert.NotifiedAt = &notifiedAt.Time
+	}
+	return &alert, nil
+}
+
+// ============================================================================
+// RAID Spare Pool Operations
+// ============================================================================
+
+func (s *SQLiteStore) CreateRAIDSpare(spare *models.RAIDSpare) (*models.RAIDSpare, error) {
+	spare.ID = uuid.New().String()
+	spare.CreatedAt = time.Now()
+
+	_, err := s.db.Exec(`INSERT INTO raid_spares (id, device, size, created_at) VALUES (?, ?, ?, ?)`,
+		spare.ID, spare.Device, spare.Size, spare.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("device is already in the spare pool")
+		}
+		return nil, err
+	}
+
+	return spare, nil
+}
+
+func (s *SQLiteStore) DeleteRAIDSpare(id string) error {
+	result, err := s.db.Exec("DELETE FROM raid_spares WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("spare not found")
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListRAIDSpares() []*models.RAIDSpare {
+	spares := []*models.RAIDSpare{}
+	rows, err := s.db.Query(`SELECT id, device, size, created_at FROM raid_spares ORDER BY created_at`)
+	if err != nil {
+		return spares
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var spare models.RAIDSpare
+		if err := rows.Scan(&spare.ID, &spare.Device, &spare.Size, &spare.CreatedAt); err != nil {
+			continue
+		}
+		spares = append(spares, &spare)
+	}
+	return spares
+}
+
+// ============================================================================
+// Notification Channel Operations
+// ============================================================================
+
+const notificationChannelColumns = `id, name, type, url, token, email_recipients, events, enabled, last_sent_at,
+	last_error, created_at, updated_at`
+
+func (s *SQLiteStore) CreateNotificationChannel(channel *models.NotificationChannel) (*models.NotificationChannel, error) {
+	channel.ID = uuid.New().String()
+	channel.CreatedAt = time.Now()
+	channel.UpdatedAt = time.Now()
+
+	recipientsJSON, _ := json.Marshal(channel.EmailRecipients)
+	eventsJSON, _ := json.Marshal(channel.Events)
+
+	_, err := s.db.Exec(`
+		INSERT INTO notification_channels (`+notificationChannelColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		channel.ID, channel.Name, channel.Type, channel.URL, channel.Token, string(recipientsJSON),
+		string(eventsJSON), boolToInt(channel.Enabled), channel.LastSentAt, channel.LastError,
+		channel.CreatedAt, channel.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("notification channel name already exists")
+		}
+		return nil, err
+	}
+
+	return channel, nil
+}
+
+func (s *SQLiteStore) GetNotificationChannel(id string) (*models.NotificationChannel, error) {
+	row := s.db.QueryRow(`SELECT `+notificationChannelColumns+` FROM notification_channels WHERE id = ?`, id)
+
+	channel, err := scanNotificationChannel(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("notification channel not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+func (s *SQLiteStore) UpdateNotificationChannel(channel *models.NotificationChannel) (*models.NotificationChannel, error) {
+	channel.UpdatedAt = time.Now()
+
+	recipientsJSON, _ := json.Marshal(channel.EmailRecipients)
+	eventsJSON, _ := json.Marshal(channel.Events)
+
+	result, err := s.db.Exec(`
+		UPDATE notification_channels SET name = ?, type = ?, url = ?, token = ?, email_recipients = ?, events = ?,
+			enabled = ?, updated_at = ?
+		WHERE id = ?`,
+		channel.Name, channel.Type, channel.URL, channel.Token, string(recipientsJSON), string(eventsJSON),
+		boolToInt(channel.Enabled), channel.UpdatedAt, channel.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("notification channel name already exists")
+		}
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, errors.New("notification channel not found")
+	}
+
+	return channel, nil
+}
+
+func (s *SQLiteStore) UpdateNotificationChannelStatus(id string, sentAt time.Time, lastError string) error {
+	_, err := s.db.Exec(`UPDATE notification_channels SET last_sent_at = ?, last_error = ? WHERE id = ?`,
+		sentAt, lastError, id)
+	return err
+}
+
+func (s *SQLiteStore) DeleteNotificationChannel(id string) error {
+	result, err := s.db.Exec("DELETE FROM notification_channels WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("notification channel not found")
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListNotificationChannels() []*models.NotificationChannel {
+	channels := []*models.NotificationChannel{}
+	rows, err := s.db.Query(`SELECT ` + notificationChannelColumns + ` FROM notification_channels ORDER BY name`)
+	if err != nil {
+		return channels
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		channel, err := scanNotificationChannel(rows)
+		if err != nil {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+func scanNotificationChannel(row rowScanner) (*models.NotificationChannel, error) {
+	var channel models.NotificationChannel
+	var enabled int
+	var url, token, recipientsJSON, eventsJSON, lastError sql.NullString
+	var lastSentAt sql.NullTime
+
+	err := row.Scan(&channel.ID, &channel.Name, &channel.Type, &url, &token, &recipientsJSON, &eventsJSON,
+		&enabled, &lastSentAt, &lastError, &channel.CreatedAt, &channel.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	channel.EmailRecipients = []string{}
+	channel.Events = []string{}
+	if recipientsJSON.Valid {
+		json.Unmarshal([]byte(recipientsJSON.String), &channel.EmailRecipients)
+	}
+	if eventsJSON.Valid {
+		json.Unmarshal([]byte(eventsJSON.String), &channel.Events)
+	}
+	channel.URL = url.String
+	channel.Token = token.String
+	channel.Enabled = enabled == 1
+	if lastSentAt.Valid {
+		channel.LastSentAt = &lastSentAt.Time
+	}
+	channel.LastError = lastError.String
+	return &channel, nil
+}
+
+// ============================================================================
+// Job Operations
+// ============================================================================
+
+const jobColumns = `id, type, user_id, username, zone_id, description, params, status, progress, total_items,
+	done_items, failed_items, skipped_items, total_bytes, done_bytes, result, errors, error, created_at,
+	started_at, finished_at`
+
+func (s *SQLiteStore) CreateJob(job *models.Job) error {
+	errorsJSON, _ := json.Marshal(job.Errors)
+
+	_, err := s.db.Exec(`
+		INSERT INTO jobs (`+jobColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Type, job.UserID, job.Username, job.ZoneID, job.Description, string(job.Params),
+		job.Status, job.Progress, job.TotalItems, job.DoneItems, job.FailedItems, job.SkippedItems,
+		job.TotalBytes, job.DoneBytes, string(job.Result), string(errorsJSON), job.Error, job.CreatedAt,
+		job.StartedAt, job.FinishedAt)
+	return err
+}
+
+func (s *SQLiteStore) UpdateJob(job *models.Job) error {
+	errorsJSON, _ := json.Marshal(job.Errors)
+
+	result, err := s.db.Exec(`
+		UPDATE jobs SET status = ?, progress = ?, total_items = ?, done_items = ?, failed_items = ?,
+			skipped_items = ?, total_bytes = ?, done_bytes = ?, result = ?, errors = ?, error = ?,
+			started_at = ?, finished_at = ?
+		WHERE id = ?`,
+		job.Status, job.Progress, job.TotalItems, job.DoneItems, job.FailedItems, job.SkippedItems,
+		job.TotalBytes, job.DoneBytes, string(job.Result), string(errorsJSON), job.Error, job.StartedAt,
+		job.FinishedAt, job.ID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("job not found")
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetJob(id string) (*models.Job, error) {
+	row := s.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id)
+
+	job, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("job not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *SQLiteStore) ListJobs(query models.JobQuery) []*models.Job {
+	jobs := []*models.Job{}
+
+	var conditions []string
+	var args []interface{}
+	if query.UserID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, query.UserID)
+	}
+	if query.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, query.Status)
+	}
+	if query.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, query.Type)
+	}
+
+	sqlQuery := `SELECT ` + jobColumns + ` FROM jobs`
+	if len(conditions) > 0 {
+		sqlQuery += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	sqlQuery += ` ORDER BY created_at DESC LIMIT ?`
+	args = append(args, query.Limit)
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return jobs
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+func (s *SQLiteStore) DeleteJob(id string) error {
+	result, err := s.db.Exec("DELETE FROM jobs WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("job not found")
+	}
+	return nil
+}
+
+// FailInterruptedJobs marks jobs left queued or running by a previous process as failed
+func (s *SQLiteStore) FailInterruptedJobs(reason string) (int, error) {
+	result, err := s.db.Exec(`UPDATE jobs SET status = ?, error = ?, finished_at = ? WHERE status IN (?, ?)`,
+		models.JobStatusFailed, reason, time.Now(), models.JobStatusQueued, models.JobStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+	rows, _ := result.RowsAffected()
+	return int(rows), nil
+}
+
+// PruneJobs removes finished jobs older than before
+func (s *SQLiteStore) PruneJobs(before time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM jobs WHERE status IN (?, ?, ?) AND finished_at < ?`,
+		models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusCancelled, before)
+	return err
+}
+
+func scanJob(row rowScanner) (*models.Job, error) {
+	var job models.Job
+	var params, result, errorsJSON, jobError sql.NullString
+	var startedAt, finishedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.Type, &job.UserID, &job.Username, &job.ZoneID, &job.Description, &params,
+		&job.Status, &job.Progress, &job.TotalItems, &job.DoneItems, &job.FailedItems, &job.SkippedItems,
+		&job.TotalBytes, &job.DoneBytes, &result, &errorsJSON, &jobError, &job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.String != "" {
+		job.Params = json.RawMessage(params.String)
+	}
+	if result.String != "" {
+		job.Result = json.RawMessage(result.String)
+	}
+	if errorsJSON.Valid {
+		json.Unmarshal([]byte(errorsJSON.String), &job.Errors)
+	}
+	if job.Errors == nil {
+		job.Errors = []models.JobError{}
+	}
+	job.Error = jobError.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
+
+// ============================================================================
+// File Lock Operations
+// ============================================================================
+
+const fileLockColumns = `token, zone_id, path, user_id, username, scope, depth, owner, timeout, created_at, expires_at`
+
+func (s *SQLiteStore) CreateFileLock(lock *models.FileLock) error {
+	_, err := s.db.Exec(`INSERT INTO file_locks (`+fileLockColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		lock.Token, lock.ZoneID, lock.Path, lock.UserID, lock.Username, lock.Scope, lock.Depth, lock.Owner,
+		lock.Timeout, lock.CreatedAt, lock.ExpiresAt)
+	return err
+}
+
+// RefreshFileLock extends an active lock
+func (s *SQLiteStore) RefreshFileLock(token string, timeout int, expiresAt time.Time) error {
+	result, err := s.db.Exec(`UPDATE file_locks SET timeout = ?, expires_at = ? WHERE token = ? AND expires_at > ?`,
+		timeout, expiresAt, token, time.Now())
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("lock not found")
+	}
+	return nil
+}
+
+// GetFileLock returns an active lock
+func (s *SQLiteStore) GetFileLock(token string) (*models.FileLock, error) {
+	row := s.db.QueryRow(`SELECT `+fileLockColumns+` FROM file_locks WHERE token = ? AND expires_at > ?`, token, time.Now())
+
+	lock, err := scanFileLock(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("lock not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// ListFileLocks returns the active locks of a zone, or of all zones when zoneID is empty
+func (s *SQLiteStore) ListFileLocks(zoneID string) []*models.FileLock {
+	locks := []*models.FileLock{}
+
+	query := `SELECT ` + fileLockColumns + ` FROM file_locks WHERE expires_at > ?`
+	args := []interface{}{time.Now()}
+	if zoneID != "" {
+		query += ` AND zone_id = ?`
+		args = append(args, zoneID)
+	}
+	query += ` ORDER BY zone_id, path`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return locks
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		lock, err := scanFileLock(rows)
+		if err != nil {
+			continue
+		}
+		locks = append(locks, lock)
+	}
+	return locks
+}
+
+func (s *SQLiteStore) DeleteFileLock(token string) error {
+	result, err := s.db.Exec("DELETE FROM file_locks WHERE token = ?", token)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("lock not found")
+	}
+	return nil
+}
+
+// DeleteFileLockPath removes the locks on a deleted or moved file or folder and everything below it
+func (s *SQLiteStore) DeleteFileLockPath(zoneID, path string) error {
+	below, belowArgs := pathBelow("path", path)
+	_, err := s.db.Exec(`DELETE FROM file_locks WHERE zone_id = ? AND (path = ? OR `+below+`)`,
+		append([]interface{}{zoneID, path}, belowArgs...)...)
+	return err
+}
+
+// PruneFileLocks removes locks that expired before the given time
+func (s *SQLiteStore) PruneFileLocks(before time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM file_locks WHERE expires_at <= ?`, before)
+	return err
+}
+
+func scanFileLock(row rowScanner) (*models.FileLock, error) {
+	var lock models.FileLock
+	err := row.Scan(&lock.Token, &lock.ZoneID, &lock.Path, &lock.UserID, &lock.Username, &lock.Scope,
+		&lock.Depth, &lock.Owner, &lock.Timeout, &lock.CreatedAt, &lock.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// ============================================================================
+// Upload Session Operations
+// ============================================================================
+
+const uploadSessionColumns = `id, filename, total_size, chunk_size, total_chunks, received_chunks, zone_id,
+	target_path, temp_dir, owner_id, owner_username, created_at, updated_at, expires_at`
+
+// SaveUploadSession creates or replaces an upload session
+func (s *SQLiteStore) SaveUploadSession(session *models.UploadSession) error {
+	_, err := s.db.Exec(`INSERT INTO upload_sessions (`+uploadSessionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			filename=excluded.filename, total_size=excluded.total_size, chunk_size=excluded.chunk_size,
+			total_chunks=excluded.total_chunks, received_chunks=excluded.received_chunks, zone_id=excluded.zone_id,
+			target_path=excluded.target_path, temp_dir=excluded.temp_dir, owner_id=excluded.owner_id,
+			owner_username=excluded.owner_username, created_at=excluded.created_at, updated_at=excluded.updated_at,
+			expires_at=excluded.expires_at`,
+		session.ID, session.Filename, session.TotalSize, session.ChunkSize, session.TotalChunks,
+		session.ReceivedChunks, session.ZoneID, session.TargetPath, session.TempDir, session.OwnerID,
+		session.OwnerUsername, session.CreatedAt, session.UpdatedAt, session.ExpiresAt)
+	return err
+}
+
+// ListUploadSessions returns all upload sessions, including expired ones awaiting cleanup
+func (s *SQLiteStore) ListUploadSessions() []*models.UploadSession {
+	sessions := []*models.UploadSession{}
+
+	rows, err := s.db.Query(`SELECT ` + uploadSessionColumns + ` FROM upload_sessions ORDER BY created_at`)
+	if err != nil {
+		return sessions
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session models.UploadSession
+		if err := rows.Scan(&session.ID, &session.Filename, &session.TotalSize, &session.ChunkSize,
+			&session.TotalChunks, &session.ReceivedChunks, &session.ZoneID, &session.TargetPath,
+			&session.TempDir, &session.OwnerID, &session.OwnerUsername, &session.CreatedAt,
+			&session.UpdatedAt, &session.ExpiresAt); err != nil {
+			continue
+		}
+		sessions = append(sessions, &session)
+	}
+	return sessions
+}
+
+func (s *SQLiteStore) DeleteUploadSession(id string) error {
+	_, err := s.db.Exec("DELETE FROM upload_sessions WHERE id = ?", id)
+	return err
+}
+
+// PruneUploadSessions removes sessions that expired before the given time
+func (s *SQLiteStore) PruneUploadSessions(before time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM upload_sessions WHERE expires_at <= ?`, before)
+	return err
+}
+
+// ============================================================================
+// Deleted Object Operations
+// ============================================================================
+
+// deletedObjectTables maps each kind of soft-deleted object to its table and the columns
+// shown for it
+var deletedObjectTables = map[models.DeletedObjectType]struct{ table, name, detail string }{
+	models.DeletedObjectPool:      {"storage_pools", "name", "path"},
+	models.DeletedObjectZone:      {"share_zones", "name", "path"},
+	models.DeletedObjectShare:     {"shares", "name", "path"},
+	models.DeletedObjectShareLink: {"share_links", "COALESCE(NULLIF(name, ''), target_name)", "target_path"},
+}
+
+// heldByDeleted reports whether a unique column value belongs to a soft-deleted row, which has
+// to be restored or purged before the value can be used again
+func (s *SQLiteStore) heldByDeleted(table, column, value string) bool {
+	var count int
+	s.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE "+column+" = ? AND deleted_at IS NOT NULL", value).Scan(&count)
+	return count > 0
+}
+
+// ListDeletedObjects returns the soft-deleted pools, zones, shares and share links, most
+// recently deleted first
+func (s *SQLiteStore) ListDeletedObjects() []*models.DeletedObject {
+	objects := []*models.DeletedObject{}
+	for objectType, t := range deletedObjectTables {
+		rows, err := s.db.Query(`SELECT id, ` + t.name + `, ` + t.detail + `, deleted_at
+			FROM ` + t.table + ` WHERE deleted_at IS NOT NULL`)
+		if err != nil {
+			continue
+		}
+		for rows.Next() {
+			object := models.DeletedObject{Type: objectType}
+			var name, detail sql.NullString
+			if err := rows.Scan(&object.ID, &name, &detail, &object.DeletedAt); err != nil {
+				continue
+			}
+			object.Name = name.String
+			object.Detail = detail.String
+			object.PurgeAt = object.DeletedAt.AddDate(0, 0, models.SoftDeleteRetentionDays)
+			objects = append(objects, &object)
+		}
+		rows.Close()
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].DeletedAt.After(objects[j].DeletedAt) })
+	return objects
+}
+
+// RestoreDeletedObject undoes the deletion of an object. Zones need their pool and shares their
+// zone to be restored first.
+func (s *SQLiteStore) RestoreDeletedObject(objectType models.DeletedObjectType, id string) error {
+	t, ok := deletedObjectTables[objectType]
+	if !ok {
+		return errors.New("unknown object type")
+	}
+
+	var missing int
+	switch objectType {
+	case models.DeletedObjectZone:
+		s.db.QueryRow(`
+			SELECT COUNT(*) FROM share_zones z
+			WHERE z.id = ? AND NOT EXISTS (SELECT 1 FROM storage_pools p WHERE p.id = z.pool_id AND p.deleted_at IS NULL)`,
+			id).Scan(&missing)
+		if missing > 0 {
+			return errors.New("restore the storage pool of this zone first")
+		}
+	case models.DeletedObjectShare:
+		s.db.QueryRow(`
+			SELECT COUNT(*) FROM shares sh
+			WHERE sh.id = ? AND sh.zone_id IS NOT NULL AND sh.zone_id != ''
+				AND NOT EXISTS (SELECT 1 FROM share_zones z WHERE z.id = sh.zone_id AND z.deleted_at IS NULL)`,
+			id).Scan(&missing)
+		if missing > 0 {
+			return errors.New("restore the zone of this share first")
+		}
+	case models.DeletedObjectShareLink:
+		s.db.QueryRow(`
+			SELECT COUNT(*) FROM share_links l
+			WHERE l.id = ? AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = l.owner_id)`,
+			id).Scan(&missing)
+		if missing > 0 {
+			return errors.New("cannot restore share link: its owner was deleted")
+		}
+	}
+
+	result, err := s.db.Exec("UPDATE "+t.table+" SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return errors.New("deleted object not found")
+	}
+	return nil
+}
+
+// PurgeDeletedObject permanently deletes a soft-deleted object
+func (s *SQLiteStore) PurgeDeletedObject(objectType models.DeletedObjectType, id string) error {
+	t, ok := deletedObjectTables[objectType]
+	if !ok {
+		return errors.New("unknown object type")
+	}
+
+	var count int
+	switch objectType {
+	case models.DeletedObjectPool:
+		s.db.QueryRow("SELECT COUNT(*) FROM share_zones WHERE pool_id = ?", id).Scan(&count)
+		if count > 0 {
+			return errors.New("cannot purge pool: deleted zones still reference this pool")
+		}
+	case models.DeletedObjectZone:
+		s.db.QueryRow("SELECT COUNT(*) FROM shares WHERE zone_id = ?", id).Scan(&count)
+		if count > 0 {
+			return errors.New("cannot purge zone: deleted shares still reference this zone")
+		}
+	}
+
+	result, err := s.db.Exec("DELETE FROM "+t.table+" WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return errors.New("deleted object not found")
+	}
+	return nil
+}
+
+// PurgeDeletedObjectsBefore permanently deletes objects soft-deleted before the given time.
+// Dependents go first; a zone or pool still referenced by a more recently deleted object is kept.
+func (s *SQLiteStore) PurgeDeletedObjectsBefore(before time.Time) error {
+	for _, query := range []string{
+		"DELETE FROM share_links WHERE deleted_at IS NOT NULL AND deleted_at < ?",
+		"DELETE FROM shares WHERE deleted_at IS NOT NULL AND deleted_at < ?",
+		`DELETE FROM share_zones WHERE deleted_at IS NOT NULL AND deleted_at < ?
+			AND NOT EXISTS (SELECT 1 FROM shares WHERE shares.zone_id = share_zones.id)`,
+		`DELETE FROM storage_pools WHERE deleted_at IS NOT NULL AND deleted_at < ?
+			AND NOT EXISTS (SELECT 1 FROM share_zones WHERE share_zones.pool_id = storage_pools.id)`,
+	} {
+		if _, err := s.db.Exec(query, before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================
+// Helper Functions
+// ============================================================================
+
+// pathBelow returns a condition matching the paths in column below the folder dir, and its
+// arguments. The prefix is compared with substr rather than LIKE, since SQLite matches LIKE
+// without regard to case and paths are case-sensitive.
+func pathBelow(column, dir string) (string, []interface{}) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	return "substr(" + column + ", 1, ?) = ?", []interface{}{utf8.RuneCountInString(prefix), prefix}
+}
+
+// escapeLike escapes LIKE wildcards so a literal value can be used in a pattern
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	return strings.ReplaceAll(s, "_", `\_`)
+}
+
 func boolToInt(b bool) int {
 	if b {
 		return 1
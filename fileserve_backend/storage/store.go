@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -129,6 +130,43 @@ func (s *Store) CreateUser(username, password, email string, isAdmin bool, group
 	return user, nil
 }
 
+// CreateGuestUser creates a guest account limited to zones until expiresAt
+func (s *Store) CreateGuestUser(username, password, email, invitedBy string, zones []string, expiresAt time.Time) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.Users {
+		if user.Username == username {
+			return nil, errors.New("username already exists")
+		}
+	}
+
+	user := &models.User{
+		ID:         uuid.New().String(),
+		Username:   username,
+		Email:      email,
+		Groups:     []string{},
+		IsGuest:    true,
+		GuestZones: zones,
+		ExpiresAt:  &expiresAt,
+		InvitedBy:  invitedBy,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+
+	s.Users[user.ID] = user
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
 func (s *Store) UpdateUser(id string, updates map[string]interface{}) (*models.User, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -175,6 +213,14 @@ func (s *Store) UpdateUser(id string, updates map[string]interface{}) (*models.U
 		user.MustChangePassword = mustChange
 	}
 
+	if zones, ok := updates["guest_zones"].([]string); ok && user.IsGuest {
+		user.GuestZones = zones
+	}
+
+	if expiresAt, ok := updates["expires_at"].(time.Time); ok && user.IsGuest {
+		user.ExpiresAt = &expiresAt
+	}
+
 	user.UpdatedAt = time.Now()
 
 	if err := s.save(); err != nil {
@@ -295,25 +341,20 @@ func (s *Store) GetPermissions() []models.Permission {
 }
 
 // Session operations
-func (s *Store) CreateSession(userID string, token string, expiresAt time.Time) error {
+func (s *Store) CreateSession(session *models.Session) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.Sessions[token] = &models.Session{
-		Token:     token,
-		UserID:    userID,
-		ExpiresAt: expiresAt,
-		CreatedAt: time.Now(),
-	}
+	s.Sessions[session.ID] = session
 
 	return s.save()
 }
 
-func (s *Store) GetSession(token string) (*models.Session, error) {
+func (s *Store) GetSession(id string) (*models.Session, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	session, exists := s.Sessions[token]
+	session, exists := s.Sessions[id]
 	if !exists {
 		return nil, errors.New("session not found")
 	}
@@ -325,27 +366,76 @@ func (s *Store) GetSession(token string) (*models.Session, error) {
 	return session, nil
 }
 
-func (s *Store) DeleteSession(token string) error {
+func (s *Store) ListSessionsByUser(userID string) []*models.Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []*models.Session{}
+	for _, session := range s.Sessions {
+		if session.UserID == userID && !session.IsExpired() {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+func (s *Store) RenewSession(id, token string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.Sessions[id]
+	if !exists {
+		return errors.New("session not found")
+	}
+	session.Token = token
+	session.ExpiresAt = expiresAt
+
+	return s.save()
+}
+
+func (s *Store) TouchSession(id, ip string, lastSeen time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, exists := s.Sessions[id]; exists {
+		session.IP = ip
+		session.LastSeen = lastSeen
+	}
+
+	return nil
+}
+
+func (s *Store) RevokeSession(session *models.Session) error {
+	return errors.New("session revocation requires SQLite storage")
+}
+
+func (s *Store) ListRevokedSessions() map[string]time.Time {
+	return map[string]time.Time{}
+}
+
+func (s *Store) DeleteSession(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	delete(s.Sessions, token)
+	delete(s.Sessions, id)
 
 	return s.save()
 }
 
 // CleanExpiredSessions removes expired sessions
-func (s *Store) CleanExpiredSessions() error {
+func (s *Store) CleanExpiredSessions() (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for token, session := range s.Sessions {
+	removed := 0
+	for id, session := range s.Sessions {
 		if session.IsExpired() {
-			delete(s.Sessions, token)
+			delete(s.Sessions, id)
+			removed++
 		}
 	}
 
-	return s.save()
+	return removed, s.save()
 }
 
 // Share operations
@@ -557,6 +647,9 @@ func (s *Store) CreateStoragePool(pool *models.StoragePool) (*models.StoragePool
 	now := time.Now()
 	pool.CreatedAt = now
 	pool.UpdatedAt = now
+	if pool.Backend == "" {
+		pool.Backend = models.PoolBackendLocal
+	}
 
 	s.StoragePools[pool.ID] = pool
 
@@ -655,6 +748,10 @@ func (s *Store) UpdateStoragePool(id string, updates map[string]interface{}) (*m
 		pool.DefaultGroupQuota = int64(defaultGroupQuota)
 	}
 
+	if s3Config, ok := updates["s3"].(*models.S3PoolConfig); ok {
+		pool.S3 = s3Config
+	}
+
 	pool.UpdatedAt = time.Now()
 
 	if err := s.save(); err != nil {
@@ -829,6 +926,13 @@ func (s *Store) UpdateShareZone(id string, updates map[string]interface{}) (*mod
 		}
 	}
 
+	if owners, ok := updates["owners"].([]interface{}); ok {
+		zone.Owners = make([]string, len(owners))
+		for i, o := range owners {
+			zone.Owners[i] = fmt.Sprint(o)
+		}
+	}
+
 	if allowNetworkShares, ok := updates["allow_network_shares"].(bool); ok {
 		zone.AllowNetworkShares = allowNetworkShares
 	}
@@ -845,6 +949,52 @@ func (s *Store) UpdateShareZone(id string, updates map[string]interface{}) (*mod
 		zone.MaxQuotaPerUser = int64(maxQuotaPerUser)
 	}
 
+	if maxUploadSize, ok := updates["max_upload_size"].(float64); ok {
+		zone.MaxUploadSize = int64(maxUploadSize)
+	}
+
+	zone.UpdatedAt = time.Now()
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	return zone, nil
+}
+
+// UpdateShareZoneSMB sets whether a zone is shared over SMB and its share options
+func (s *Store) UpdateShareZoneSMB(id string, enabled bool, opts *models.ZoneSMBOptions) (*models.ShareZone, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zone, exists := s.ShareZones[id]
+	if !exists {
+		return nil, errors.New("share zone not found")
+	}
+
+	zone.SMBEnabled = enabled
+	zone.SMBOptions = opts
+	zone.UpdatedAt = time.Now()
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	return zone, nil
+}
+
+// UpdateShareZoneNFS sets whether a zone is exported over NFS and its export options
+func (s *Store) UpdateShareZoneNFS(id string, enabled bool, opts *models.ZoneNFSOptions) (*models.ShareZone, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zone, exists := s.ShareZones[id]
+	if !exists {
+		return nil, errors.New("share zone not found")
+	}
+
+	zone.NFSEnabled = enabled
+	zone.NFSOptions = opts
 	zone.UpdatedAt = time.Now()
 
 	if err := s.save(); err != nil {
@@ -958,6 +1108,20 @@ func (s *Store) GetShareLinkByToken(token string) (*models.ShareLink, error) {
 	return nil, errors.New("share link not found")
 }
 
+// GetShareLinkBySlug retrieves a share link by its custom slug
+func (s *Store) GetShareLinkBySlug(slug string) (*models.ShareLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, link := range s.ShareLinks {
+		if slug != "" && link.Slug == slug {
+			return link, nil
+		}
+	}
+
+	return nil, errors.New("share link not found")
+}
+
 // UpdateShareLink updates an existing share link
 func (s *Store) UpdateShareLink(id string, updates map[string]interface{}) (*models.ShareLink, error) {
 	s.mu.Lock()
@@ -972,6 +1136,10 @@ func (s *Store) UpdateShareLink(id string, updates map[string]interface{}) (*mod
 		link.Name = name
 	}
 
+	if slug, ok := updates["slug"].(string); ok {
+		link.Slug = slug
+	}
+
 	if description, ok := updates["description"].(string); ok {
 		link.Description = description
 	}
@@ -986,6 +1154,11 @@ func (s *Store) UpdateShareLink(id string, updates map[string]interface{}) (*mod
 
 	if enabled, ok := updates["enabled"].(bool); ok {
 		link.Enabled = enabled
+		if enabled && link.BurnedAt != nil {
+			// Re-enabling a burned link starts it over
+			link.BurnedAt = nil
+			link.DownloadIPs = nil
+		}
 	}
 
 	if allowDownload, ok := updates["allow_download"].(bool); ok {
@@ -1012,6 +1185,42 @@ func (s *Store) UpdateShareLink(id string, updates map[string]interface{}) (*mod
 		link.MaxViews = int(maxViews)
 	}
 
+	if maxFileSize, ok := updates["max_file_size"].(float64); ok {
+		link.MaxFileSize = int64(maxFileSize)
+	}
+
+	if exts, ok := updates["allowed_extensions"].([]string); ok {
+		link.AllowedExtensions = exts
+	}
+
+	if notifyOnUpload, ok := updates["notify_on_upload"].(bool); ok {
+		link.NotifyOnUpload = notifyOnUpload
+	}
+
+	if notifyOnDownload, ok := updates["notify_on_download"].(bool); ok {
+		link.NotifyOnDownload = notifyOnDownload
+	}
+
+	if burnAfterIPs, ok := updates["burn_after_ips"].(float64); ok {
+		link.BurnAfterIPs = int(burnAfterIPs)
+	}
+
+	if deleteOnBurn, ok := updates["delete_on_burn"].(bool); ok {
+		link.DeleteOnBurn = deleteOnBurn
+	}
+
+	if cidrs, ok := updates["allowed_cidrs"].([]string); ok {
+		link.AllowedCIDRs = cidrs
+	}
+
+	if countries, ok := updates["allowed_countries"].([]string); ok {
+		link.AllowedCountries = countries
+	}
+
+	if countries, ok := updates["blocked_countries"].([]string); ok {
+		link.BlockedCountries = countries
+	}
+
 	if expiresAt, ok := updates["expires_at"].(string); ok {
 		if expiresAt == "" {
 			link.ExpiresAt = nil
@@ -1096,6 +1305,56 @@ func (s *Store) IncrementShareLinkDownload(id string) error {
 	return s.save()
 }
 
+// SetShareLinkToken replaces the token of a share link
+func (s *Store) SetShareLinkToken(id, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, exists := s.ShareLinks[id]
+	if !exists {
+		return errors.New("share link not found")
+	}
+
+	link.Token = token
+	link.UpdatedAt = time.Now()
+
+	return s.save()
+}
+
+// SetShareLinkDownloadIPs records the client IPs a link was downloaded from
+func (s *Store) SetShareLinkDownloadIPs(id string, ips []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, exists := s.ShareLinks[id]
+	if !exists {
+		return errors.New("share link not found")
+	}
+
+	link.DownloadIPs = ips
+	link.UpdatedAt = time.Now()
+
+	return s.save()
+}
+
+// BurnShareLink disables a one-time link for good
+func (s *Store) BurnShareLink(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, exists := s.ShareLinks[id]
+	if !exists || link.BurnedAt != nil {
+		return errors.New("share link not found or already burned")
+	}
+
+	now := time.Now()
+	link.Enabled = false
+	link.BurnedAt = &now
+	link.UpdatedAt = now
+
+	return s.save()
+}
+
 // IncrementShareLinkView increments the view count
 func (s *Store) IncrementShareLinkView(id string) error {
 	s.mu.Lock()
@@ -1114,18 +1373,20 @@ func (s *Store) IncrementShareLinkView(id string) error {
 	return s.save()
 }
 
-// CleanExpiredShareLinks removes expired share links
-func (s *Store) CleanExpiredShareLinks() error {
+// CleanExpiredShareLinks removes share links that expired before the given time
+func (s *Store) CleanExpiredShareLinks(before time.Time) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	removed := 0
 	for id, link := range s.ShareLinks {
-		if link.IsExpired() {
+		if link.ExpiresAt != nil && link.ExpiresAt.Before(before) {
 			delete(s.ShareLinks, id)
+			removed++
 		}
 	}
 
-	return s.save()
+	return removed, s.save()
 }
 
 // ============================================================================
@@ -1190,3 +1451,890 @@ func (s *Store) ListEnabledSnapshotPolicies() []*models.SnapshotPolicy {
 func (s *Store) UpdateSnapshotPolicyRun(id string, lastRun time.Time, nextRun time.Time, lastError string) error {
 	return errors.New("snapshot policies require SQLite storage")
 }
+
+// ============================================================================
+// File Search Index Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) UpsertFileIndexEntries(entries []*models.FileIndexEntry) error {
+	return errors.New("search index requires SQLite storage")
+}
+
+func (s *Store) DeleteFileIndexPath(zoneID, path string) error {
+	return errors.New("search index requires SQLite storage")
+}
+
+func (s *Store) PruneFileIndex(zoneID, pathPrefix string, before time.Time) error {
+	return errors.New("search index requires SQLite storage")
+}
+
+func (s *Store) ClearFileIndex(zoneID string) error {
+	return errors.New("search index requires SQLite storage")
+}
+
+func (s *Store) CountFileIndexEntries(zoneID string) int {
+	return 0
+}
+
+func (s *Store) SearchFileIndex(q *models.FileSearchQuery) ([]*models.FileIndexEntry, int, error) {
+	return nil, 0, errors.New("search index requires SQLite storage")
+}
+
+// ============================================================================
+// Document Content Index Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) GetZoneContentIndexing(zoneID string) *models.ZoneContentIndexing {
+	return models.DefaultZoneContentIndexing(zoneID)
+}
+
+func (s *Store) SetZoneContentIndexing(cfg *models.ZoneContentIndexing) error {
+	return errors.New("content indexing requires SQLite storage")
+}
+
+func (s *Store) UpsertFileContent(c *models.FileContent) error {
+	return nil
+}
+
+func (s *Store) GetFileContentInfo(zoneID, path string) (*models.FileContent, error) {
+	return nil, errors.New("file content not indexed")
+}
+
+func (s *Store) DeleteFileContentPath(zoneID, path string) error {
+	return nil
+}
+
+func (s *Store) RenameFileContentPath(zoneID, oldPath, newPath string) error {
+	return nil
+}
+
+func (s *Store) PruneFileContents(zoneID string) error {
+	return nil
+}
+
+func (s *Store) ClearFileContents(zoneID string) error {
+	return nil
+}
+
+func (s *Store) GetContentIndexStats(zoneID string) *models.ContentIndexStats {
+	return &models.ContentIndexStats{}
+}
+
+// ============================================================================
+// Image Metadata Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) UpsertImageMetadata(m *models.ImageMetadata) error {
+	return nil
+}
+
+func (s *Store) GetImageMetadata(zoneID, path string) (*models.ImageMetadata, error) {
+	return nil, errors.New("image metadata not found")
+}
+
+func (s *Store) ListGalleryImages(q *models.GalleryQuery) ([]*models.ImageMetadata, int, error) {
+	return nil, 0, errors.New("photo gallery requires SQLite storage")
+}
+
+func (s *Store) GalleryTimeline(zoneID, pathPrefix, groupBy string) ([]*models.GalleryBucket, error) {
+	return nil, errors.New("photo gallery requires SQLite storage")
+}
+
+func (s *Store) DeleteImageMetadataPath(zoneID, path string) error {
+	return nil
+}
+
+func (s *Store) RenameImageMetadataPath(zoneID, oldPath, newPath string) error {
+	return nil
+}
+
+func (s *Store) PruneImageMetadata(zoneID string) error {
+	return nil
+}
+
+// ============================================================================
+// Directory Usage Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) UpsertDirUsage(entries []*models.DirUsage) error {
+	return errors.New("usage tracking requires SQLite storage")
+}
+
+func (s *Store) GetDirUsage(zoneID, path string) (*models.DirUsage, error) {
+	return nil, errors.New("usage tracking requires SQLite storage")
+}
+
+func (s *Store) SumDirUsage(zoneID, path string) (*models.UsageTotals, error) {
+	return nil, errors.New("usage tracking requires SQLite storage")
+}
+
+func (s *Store) DeleteDirUsagePath(zoneID, path string) error {
+	return errors.New("usage tracking requires SQLite storage")
+}
+
+func (s *Store) PruneDirUsage(zoneID, pathPrefix string, before time.Time) error {
+	return errors.New("usage tracking requires SQLite storage")
+}
+
+// ============================================================================
+// Zone User Usage Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) GetZoneUserUsage(zoneID, username string) (*models.ZoneUserUsage, error) {
+	return nil, errors.New("quota tracking requires SQLite storage")
+}
+
+func (s *Store) SetZoneUserUsage(zoneID, username string, used int64) error {
+	return errors.New("quota tracking requires SQLite storage")
+}
+
+func (s *Store) AddZoneUserUsage(zoneID, username string, delta int64) error {
+	return errors.New("quota tracking requires SQLite storage")
+}
+
+func (s *Store) ListZoneUserUsage(zoneID string) []*models.ZoneUserUsage {
+	return []*models.ZoneUserUsage{}
+}
+
+// ============================================================================
+// Usage History Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) RecordUsageSamples(samples []*models.UsageSample) error {
+	return errors.New("usage history requires SQLite storage")
+}
+
+func (s *Store) ListUsageSamples(zoneID, username string, since time.Time) []*models.UsageSample {
+	return []*models.UsageSample{}
+}
+
+func (s *Store) ListLatestUsageSamples() []*models.UsageSample {
+	return []*models.UsageSample{}
+}
+
+func (s *Store) GetUsageSampleBefore(zoneID, username string, at time.Time) (*models.UsageSample, error) {
+	return nil, errors.New("usage history requires SQLite storage")
+}
+
+func (s *Store) PruneUsageSamples(before time.Time) error {
+	return nil
+}
+
+// ============================================================================
+// File Checksum Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) UpsertFileChecksum(c *models.FileChecksum) error {
+	return errors.New("integrity checking requires SQLite storage")
+}
+
+func (s *Store) GetFileChecksum(zoneID, path string) (*models.FileChecksum, error) {
+	return nil, errors.New("integrity checking requires SQLite storage")
+}
+
+func (s *Store) DeleteFileChecksumPath(zoneID, path string) error {
+	return errors.New("integrity checking requires SQLite storage")
+}
+
+func (s *Store) RenameFileChecksumPath(zoneID, oldPath, newPath string) error {
+	return errors.New("integrity checking requires SQLite storage")
+}
+
+func (s *Store) PruneFileChecksums(zoneID string, before time.Time) error {
+	return errors.New("integrity checking requires SQLite storage")
+}
+
+func (s *Store) ListFileChecksumMismatches() []*models.FileChecksum {
+	return []*models.FileChecksum{}
+}
+
+func (s *Store) ListFileChecksums(zoneID, path string) []*models.FileChecksum {
+	return []*models.FileChecksum{}
+}
+
+// ============================================================================
+// File Metadata Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) GetFileMetadata(zoneID, path string) (*models.FileMetadata, error) {
+	return nil, errors.New("file metadata not found")
+}
+
+func (s *Store) SetFileMetadata(meta *models.FileMetadata) error {
+	return errors.New("file metadata requires SQLite storage")
+}
+
+func (s *Store) GetFileMetadataForPaths(zoneID string, paths []string) map[string]*models.FileMetadata {
+	return map[string]*models.FileMetadata{}
+}
+
+func (s *Store) QueryFileMetadata(q *models.FileMetadataQuery) []*models.FileMetadata {
+	return []*models.FileMetadata{}
+}
+
+func (s *Store) ListFileTags(zoneID, pathPrefix string) []*models.TagCount {
+	return []*models.TagCount{}
+}
+
+func (s *Store) DeleteFileMetadataPath(zoneID, path string) error {
+	return nil
+}
+
+func (s *Store) RenameFileMetadataPath(zoneID, oldPath, newPath string) error {
+	return nil
+}
+
+// ============================================================================
+// Trash Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateTrashItem(item *models.TrashItem) (*models.TrashItem, error) {
+	return nil, errors.New("trash requires SQLite storage")
+}
+
+func (s *Store) GetTrashItem(id string) (*models.TrashItem, error) {
+	return nil, errors.New("trash requires SQLite storage")
+}
+
+func (s *Store) DeleteTrashItem(id string) error {
+	return errors.New("trash requires SQLite storage")
+}
+
+func (s *Store) ListTrashItems(zoneID string) []*models.TrashItem {
+	return []*models.TrashItem{}
+}
+
+func (s *Store) ListExpiredTrashItems(before time.Time) []*models.TrashItem {
+	return []*models.TrashItem{}
+}
+
+// ============================================================================
+// Quarantine Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateQuarantineItem(item *models.QuarantineItem) (*models.QuarantineItem, error) {
+	return nil, errors.New("quarantine requires SQLite storage")
+}
+
+func (s *Store) GetQuarantineItem(id string) (*models.QuarantineItem, error) {
+	return nil, errors.New("quarantine requires SQLite storage")
+}
+
+func (s *Store) DeleteQuarantineItem(id string) error {
+	return errors.New("quarantine requires SQLite storage")
+}
+
+func (s *Store) ListQuarantineItems() []*models.QuarantineItem {
+	return []*models.QuarantineItem{}
+}
+
+// ============================================================================
+// File Version Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateFileVersion(version *models.FileVersion) (*models.FileVersion, error) {
+	return nil, errors.New("file versioning requires SQLite storage")
+}
+
+func (s *Store) GetFileVersion(id string) (*models.FileVersion, error) {
+	return nil, errors.New("file versioning requires SQLite storage")
+}
+
+func (s *Store) DeleteFileVersion(id string) error {
+	return errors.New("file versioning requires SQLite storage")
+}
+
+func (s *Store) ListFileVersions(zoneID, path string) []*models.FileVersion {
+	return []*models.FileVersion{}
+}
+
+func (s *Store) ListZoneFileVersions(zoneID string) []*models.FileVersion {
+	return []*models.FileVersion{}
+}
+
+func (s *Store) GetZoneVersioning(zoneID string) *models.ZoneVersioning {
+	cfg := models.DefaultZoneVersioning(zoneID)
+	cfg.Enabled = false
+	return cfg
+}
+
+func (s *Store) SetZoneVersioning(cfg *models.ZoneVersioning) error {
+	return errors.New("file versioning requires SQLite storage")
+}
+
+// ============================================================================
+// API Token Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateAPIToken(token *models.APIToken) (*models.APIToken, error) {
+	return nil, errors.New("API tokens require SQLite storage")
+}
+
+func (s *Store) GetAPIToken(id string) (*models.APIToken, error) {
+	return nil, errors.New("API tokens require SQLite storage")
+}
+
+func (s *Store) GetAPITokenByHash(hash string) (*models.APIToken, error) {
+	return nil, errors.New("API tokens require SQLite storage")
+}
+
+func (s *Store) DeleteAPIToken(id string) error {
+	return errors.New("API tokens require SQLite storage")
+}
+
+func (s *Store) ListAPITokens() []*models.APIToken {
+	return []*models.APIToken{}
+}
+
+func (s *Store) ListAPITokensByUser(userID string) []*models.APIToken {
+	return []*models.APIToken{}
+}
+
+func (s *Store) UpdateAPITokenLastUsed(id string, lastUsed time.Time) error {
+	return errors.New("API tokens require SQLite storage")
+}
+
+// ============================================================================
+// Folder Share Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateFolderShare(share *models.FolderShare) (*models.FolderShare, error) {
+	return nil, errors.New("folder sharing requires SQLite storage")
+}
+
+func (s *Store) GetFolderShare(id string) (*models.FolderShare, error) {
+	return nil, errors.New("folder share not found")
+}
+
+func (s *Store) DeleteFolderShare(id string) error {
+	return errors.New("folder sharing requires SQLite storage")
+}
+
+func (s *Store) ListFolderShares() []*models.FolderShare {
+	return []*models.FolderShare{}
+}
+
+func (s *Store) ListFolderSharesByOwner(ownerID string) []*models.FolderShare {
+	return []*models.FolderShare{}
+}
+
+// ============================================================================
+// Replication Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateReplicationJob(job *models.ReplicationJob) (*models.ReplicationJob, error) {
+	return nil, errors.New("replication requires SQLite storage")
+}
+
+func (s *Store) GetReplicationJob(id string) (*models.ReplicationJob, error) {
+	return nil, errors.New("replication job not found")
+}
+
+func (s *Store) UpdateReplicationJob(id string, updates map[string]interface{}) (*models.ReplicationJob, error) {
+	return nil, errors.New("replication requires SQLite storage")
+}
+
+func (s *Store) DeleteReplicationJob(id string) error {
+	return errors.New("replication requires SQLite storage")
+}
+
+func (s *Store) ListReplicationJobs() []*models.ReplicationJob {
+	return []*models.ReplicationJob{}
+}
+
+func (s *Store) UpdateReplicationJobRun(id string, lastRun time.Time, nextRun time.Time, status, lastSnapshot, lastError string) error {
+	return errors.New("replication requires SQLite storage")
+}
+
+func (s *Store) CreateReplicationRun(run *models.ReplicationRun) (*models.ReplicationRun, error) {
+	return nil, errors.New("replication requires SQLite storage")
+}
+
+func (s *Store) UpdateReplicationRun(run *models.ReplicationRun) error {
+	return errors.New("replication requires SQLite storage")
+}
+
+func (s *Store) ListReplicationRuns(jobID string, limit int) []*models.ReplicationRun {
+	return []*models.ReplicationRun{}
+}
+
+func (s *Store) PruneReplicationRuns(jobID string, keep int) error {
+	return nil
+}
+
+func (s *Store) FailInterruptedReplicationRuns(message string) error {
+	return nil
+}
+
+// ============================================================================
+// Maintenance Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateMaintenanceSchedule(schedule *models.MaintenanceSchedule) (*models.MaintenanceSchedule, error) {
+	return nil, errors.New("maintenance schedules require SQLite storage")
+}
+
+func (s *Store) GetMaintenanceSchedule(id string) (*models.MaintenanceSchedule, error) {
+	return nil, errors.New("maintenance schedule not found")
+}
+
+func (s *Store) UpdateMaintenanceSchedule(id string, updates map[string]interface{}) (*models.MaintenanceSchedule, error) {
+	return nil, errors.New("maintenance schedules require SQLite storage")
+}
+
+func (s *Store) DeleteMaintenanceSchedule(id string) error {
+	return errors.New("maintenance schedules require SQLite storage")
+}
+
+func (s *Store) ListMaintenanceSchedules() []*models.MaintenanceSchedule {
+	return []*models.MaintenanceSchedule{}
+}
+
+func (s *Store) UpdateMaintenanceScheduleRun(id string, lastRun time.Time, nextRun time.Time, status, lastError string) error {
+	return errors.New("maintenance schedules require SQLite storage")
+}
+
+func (s *Store) CreateMaintenanceRun(run *models.MaintenanceRun) (*models.MaintenanceRun, error) {
+	return nil, errors.New("maintenance schedules require SQLite storage")
+}
+
+func (s *Store) UpdateMaintenanceRun(run *models.MaintenanceRun) error {
+	return errors.New("maintenance schedules require SQLite storage")
+}
+
+func (s *Store) ListMaintenanceRuns(scheduleID string, limit int) []*models.MaintenanceRun {
+	return []*models.MaintenanceRun{}
+}
+
+func (s *Store) PruneMaintenanceRuns(scheduleID string, keep int) error {
+	return nil
+}
+
+func (s *Store) FailInterruptedMaintenanceRuns(message string) error {
+	return nil
+}
+
+// ============================================================================
+// Retention Policy Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateRetentionPolicy(policy *models.RetentionPolicy) (*models.RetentionPolicy, error) {
+	return nil, errors.New("retention policies require SQLite storage")
+}
+
+func (s *Store) GetRetentionPolicy(id string) (*models.RetentionPolicy, error) {
+	return nil, errors.New("retention policy not found")
+}
+
+func (s *Store) UpdateRetentionPolicy(policy *models.RetentionPolicy) error {
+	return errors.New("retention policies require SQLite storage")
+}
+
+func (s *Store) DeleteRetentionPolicy(id string) error {
+	return errors.New("retention policies require SQLite storage")
+}
+
+func (s *Store) ListRetentionPolicies() []*models.RetentionPolicy {
+	return []*models.RetentionPolicy{}
+}
+
+func (s *Store) UpdateRetentionPolicyRun(id string, lastRun time.Time, nextRun time.Time, status, lastError string) error {
+	return errors.New("retention policies require SQLite storage")
+}
+
+func (s *Store) AddRetentionActions(actions []*models.RetentionAction) error {
+	return errors.New("retention policies require SQLite storage")
+}
+
+func (s *Store) ListRetentionActions(policyID string, limit int) []*models.RetentionAction {
+	return []*models.RetentionAction{}
+}
+
+func (s *Store) PruneRetentionActions(policyID string, keep int) error {
+	return nil
+}
+
+// ============================================================================
+// iSCSI Target Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateISCSITarget(target *models.ISCSITarget) (*models.ISCSITarget, error) {
+	return nil, errors.New("iSCSI targets require SQLite storage")
+}
+
+func (s *Store) GetISCSITarget(id string) (*models.ISCSITarget, error) {
+	return nil, errors.New("iSCSI target not found")
+}
+
+func (s *Store) UpdateISCSITarget(target *models.ISCSITarget) (*models.ISCSITarget, error) {
+	return nil, errors.New("iSCSI targets require SQLite storage")
+}
+
+func (s *Store) DeleteISCSITarget(id string) error {
+	return errors.New("iSCSI targets require SQLite storage")
+}
+
+func (s *Store) ListISCSITargets() []*models.ISCSITarget {
+	return []*models.ISCSITarget{}
+}
+
+// ============================================================================
+// Storage Alert Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateStorageAlert(alert *models.StorageAlertRecord) (*models.StorageAlertRecord, error) {
+	return nil, errors.New("storage alerts require SQLite storage")
+}
+
+func (s *Store) GetStorageAlert(id string) (*models.StorageAlertRecord, error) {
+	return nil, errors.New("storage alert not found")
+}
+
+func (s *Store) UpdateStorageAlert(alert *models.StorageAlertRecord) error {
+	return errors.New("storage alerts require SQLite storage")
+}
+
+func (s *Store) ListStorageAlerts(status string, limit int) []*models.StorageAlertRecord {
+	return []*models.StorageAlertRecord{}
+}
+
+func (s *Store) PruneResolvedStorageAlerts(before time.Time) error {
+	return nil
+}
+
+// ============================================================================
+// RAID Spare Pool Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateRAIDSpare(spare *models.RAIDSpare) (*models.RAIDSpare, error) {
+	return nil, errors.New("the RAID spare pool requires SQLite storage")
+}
+
+func (s *Store) DeleteRAIDSpare(id string) error {
+	return errors.New("spare not found")
+}
+
+func (s *Store) ListRAIDSpares() []*models.RAIDSpare {
+	return []*models.RAIDSpare{}
+}
+
+// ============================================================================
+// Notification Channel Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateNotificationChannel(channel *models.NotificationChannel) (*models.NotificationChannel, error) {
+	return nil, errors.New("notification channels require SQLite storage")
+}
+
+func (s *Store) GetNotificationChannel(id string) (*models.NotificationChannel, error) {
+	return nil, errors.New("notification channel not found")
+}
+
+func (s *Store) UpdateNotificationChannel(channel *models.NotificationChannel) (*models.NotificationChannel, error) {
+	return nil, errors.New("notification channels require SQLite storage")
+}
+
+func (s *Store) UpdateNotificationChannelStatus(id string, sentAt time.Time, lastError string) error {
+	return nil
+}
+
+func (s *Store) DeleteNotificationChannel(id string) error {
+	return errors.New("notification channels require SQLite storage")
+}
+
+func (s *Store) ListNotificationChannels() []*models.NotificationChannel {
+	return []*models.NotificationChannel{}
+}
+
+// ============================================================================
+// Job Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateJob(job *models.Job) error {
+	return errors.New("background jobs require SQLite storage")
+}
+
+func (s *Store) UpdateJob(job *models.Job) error {
+	return errors.New("background jobs require SQLite storage")
+}
+
+func (s *Store) GetJob(id string) (*models.Job, error) {
+	return nil, errors.New("job not found")
+}
+
+func (s *Store) ListJobs(query models.JobQuery) []*models.Job {
+	return []*models.Job{}
+}
+
+func (s *Store) DeleteJob(id string) error {
+	return errors.New("background jobs require SQLite storage")
+}
+
+func (s *Store) FailInterruptedJobs(reason string) (int, error) {
+	return 0, nil
+}
+
+func (s *Store) PruneJobs(before time.Time) error {
+	return nil
+}
+
+// ============================================================================
+// File Lock Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreateFileLock(lock *models.FileLock) error {
+	return errors.New("file locks require SQLite storage")
+}
+
+func (s *Store) RefreshFileLock(token string, timeout int, expiresAt time.Time) error {
+	return errors.New("lock not found")
+}
+
+func (s *Store) GetFileLock(token string) (*models.FileLock, error) {
+	return nil, errors.New("lock not found")
+}
+
+func (s *Store) ListFileLocks(zoneID string) []*models.FileLock {
+	return []*models.FileLock{}
+}
+
+func (s *Store) DeleteFileLock(token string) error {
+	return errors.New("lock not found")
+}
+
+func (s *Store) DeleteFileLockPath(zoneID, path string) error {
+	return nil
+}
+
+func (s *Store) PruneFileLocks(before time.Time) error {
+	return nil
+}
+
+// ============================================================================
+// Upload Session Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) SaveUploadSession(session *models.UploadSession) error {
+	return errors.New("upload sessions require SQLite storage")
+}
+
+func (s *Store) ListUploadSessions() []*models.UploadSession {
+	return []*models.UploadSession{}
+}
+
+func (s *Store) DeleteUploadSession(id string) error {
+	return nil
+}
+
+func (s *Store) PruneUploadSessions(before time.Time) error {
+	return nil
+}
+
+// ============================================================================
+// Zone Project Quota Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) GetZoneProjectQuota(zoneID string) (*models.ZoneProjectQuota, error) {
+	return nil, errors.New("zone has no project quota")
+}
+
+func (s *Store) SetZoneProjectQuota(quota *models.ZoneProjectQuota) error {
+	return errors.New("zone project quotas require SQLite storage")
+}
+
+func (s *Store) DeleteZoneProjectQuota(zoneID string) error {
+	return nil
+}
+
+func (s *Store) ListZoneProjectQuotas() []*models.ZoneProjectQuota {
+	return []*models.ZoneProjectQuota{}
+}
+
+// ============================================================================
+// Password History Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) AddPasswordHistory(entry *models.PasswordHistoryEntry, keep int) error {
+	return nil
+}
+
+func (s *Store) ListPasswordHistory(username string) []*models.PasswordHistoryEntry {
+	return []*models.PasswordHistoryEntry{}
+}
+
+// ============================================================================
+// Security Event Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) AddSecurityEvent(event *models.SecurityEvent) error {
+	return nil
+}
+
+func (s *Store) ListSecurityEvents(filter models.SecurityEventFilter) ([]*models.SecurityEvent, int) {
+	return []*models.SecurityEvent{}, 0
+}
+
+func (s *Store) DeleteSecurityEventsBefore(before time.Time) error {
+	return nil
+}
+
+// ============================================================================
+// Daily Statistics Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) RecordDailyStats(stats []*models.DailyStat) error {
+	return nil
+}
+
+func (s *Store) ListDailyStats(filter models.DailyStatFilter) []*models.DailyStat {
+	return []*models.DailyStat{}
+}
+
+func (s *Store) CountActiveUsers(since time.Time) (int, error) {
+	return 0, nil
+}
+
+// ============================================================================
+// Transfer Cap Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) GetTransferCap(objectType, objectID string) (*models.TransferCap, error) {
+	return nil, errors.New("transfer c not found")
+}
+
+func (s *Store) SetTransferCap(c *models.TransferCap) error {
+	return errors.New("transfer caps require SQLite storage")
+}
+
+func (s *Store) DeleteTransferCap(objectType, objectID string) error {
+	return nil
+}
+
+func (s *Store) ListTransferCaps() []*models.TransferCap {
+	return []*models.TransferCap{}
+}
+
+// ============================================================================
+// Event Log Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) AddEventLogEntry(entry *models.EventLogEntry) error {
+	return nil
+}
+
+func (s *Store) ListEventLog(filter models.EventLogFilter) ([]*models.EventLogEntry, int) {
+	return []*models.EventLogEntry{}, 0
+}
+
+func (s *Store) DeleteEventLogBefore(before time.Time) (int, error) {
+	return 0, nil
+}
+
+// ============================================================================
+// Passkey Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) CreatePasskey(passkey *models.Passkey) error {
+	return errors.New("passkeys require SQLite storage")
+}
+
+func (s *Store) GetPasskey(id string) (*models.Passkey, error) {
+	return nil, errors.New("passkey not found")
+}
+
+func (s *Store) GetPasskeyByCredentialID(credentialID string) (*models.Passkey, error) {
+	return nil, errors.New("passkey not found")
+}
+
+func (s *Store) ListPasskeysByUser(userID string) []*models.Passkey {
+	return []*models.Passkey{}
+}
+
+func (s *Store) UpdatePasskeyUsage(id string, signCount uint32, lastUsed time.Time) error {
+	return nil
+}
+
+func (s *Store) DeletePasskey(id string) error {
+	return errors.New("passkey not found")
+}
+
+// ============================================================================
+// Lockout Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) GetLockout(key string) (*models.Lockout, error) {
+	return nil, errors.New("lockout not found")
+}
+
+func (s *Store) SaveLockout(l *models.Lockout) error {
+	return errors.New("lockouts require SQLite storage")
+}
+
+func (s *Store) DeleteLockout(key string) error {
+	return errors.New("lockouts require SQLite storage")
+}
+
+func (s *Store) ListLockouts() []*models.Lockout {
+	return []*models.Lockout{}
+}
+
+func (s *Store) ClearLockouts() error {
+	return errors.New("lockouts require SQLite storage")
+}
+
+func (s *Store) CleanStaleLockouts(before time.Time) error {
+	return nil
+}
+
+// WithContext returns the store itself; the JSON store has no queries to cancel
+func (s *Store) WithContext(ctx context.Context) DataStore {
+	return s
+}
+
+// WithTx runs fn against the store itself; the JSON store cannot roll back, so changes made
+// before fn fails are kept
+func (s *Store) WithTx(fn func(tx DataStore) error) error {
+	return fn(s)
+}
+
+// ============================================================================
+// Deleted Object Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+// The JSON store deletes objects immediately, so there is nothing to restore
+
+func (s *Store) ListDeletedObjects() []*models.DeletedObject {
+	return []*models.DeletedObject{}
+}
+
+func (s *Store) RestoreDeletedObject(objectType models.DeletedObjectType, id string) error {
+	return errors.New("restoring deleted objects requires SQLite storage")
+}
+
+func (s *Store) PurgeDeletedObject(objectType models.DeletedObjectType, id string) error {
+	return errors.New("restoring deleted objects requires SQLite storage")
+}
+
+func (s *Store) PurgeDeletedObjectsBefore(before time.Time) error {
+	return nil
+}
+
+// ============================================================================
+// Database Backup Operations (stub implementation for JSON store - use SQLite)
+// ============================================================================
+
+func (s *Store) BackupDatabase(dest string) error {
+	return errors.New("database backups require SQLite storage")
+}
+
+func (s *Store) StageDatabaseRestore(src string) error {
+	return errors.New("database backups require SQLite storage")
+}
+
+func (s *Store) CancelDatabaseRestore() error {
+	return errors.New("database backups require SQLite storage")
+}
+
+func (s *Store) DatabaseRestorePending() bool {
+	return false
+}
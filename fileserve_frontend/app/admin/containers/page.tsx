@@ -0,0 +1,374 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { useRouter } from "next/navigation";
+import { Header } from "@/components/layout/header";
+import { Sidebar } from "@/components/layout/sidebar";
+import { Card, CardContent, CardHeader, CardTitle, CardDescription } from "@/components/ui/card";
+import { Badge } from "@/components/ui/badge";
+import { Button } from "@/components/ui/button";
+import {
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableHeader,
+  TableRow,
+} from "@/components/ui/table";
+import {
+  Dialog,
+  DialogContent,
+  DialogDescription,
+  DialogHeader,
+  DialogTitle,
+} from "@/components/ui/dialog";
+import { useAuth } from "@/lib/auth-context";
+import { containersAPI, ContainerRuntime, ContainerInfo, ContainerStats } from "@/lib/api";
+import { PageSkeleton } from "@/components/skeletons";
+import { toast } from "sonner";
+import {
+  Boxes,
+  RefreshCw,
+  Play,
+  Square,
+  RotateCcw,
+  ScrollText,
+  FolderOpen,
+  AlertTriangle,
+  Loader2,
+} from "lucide-react";
+
+type ContainerAction = "start" | "stop" | "restart";
+
+export default function ContainersPage() {
+  const router = useRouter();
+  const { user, isAuthenticated, isLoading: authLoading } = useAuth();
+  const [runtime, setRuntime] = useState<ContainerRuntime | null>(null);
+  const [containers, setContainers] = useState<ContainerInfo[]>([]);
+  const [isLoading, setIsLoading] = useState(true);
+  const [isRefreshing, setIsRefreshing] = useState(false);
+  const [controlling, setControlling] = useState<string | null>(null);
+  const [selected, setSelected] = useState<ContainerInfo | null>(null);
+  const [stats, setStats] = useState<ContainerStats | null>(null);
+  const [logs, setLogs] = useState<{ stream: string; text: string }[]>([]);
+  const [detailLoading, setDetailLoading] = useState(false);
+
+  useEffect(() => {
+    if (!authLoading) {
+      if (!isAuthenticated) {
+        router.replace("/");
+      } else if (user && user.role !== "admin") {
+        router.replace("/dashboard");
+      }
+    }
+  }, [authLoading, isAuthenticated, user, router]);
+
+  const fetchData = async () => {
+    try {
+      const runtimeData = await containersAPI.getRuntime();
+      setRuntime(runtimeData);
+      if (runtimeData.enabled && runtimeData.available) {
+        setContainers(await containersAPI.list());
+      }
+    } catch (error) {
+      console.error("Failed to fetch containers:", error);
+    } finally {
+      setIsLoading(false);
+      setIsRefreshing(false);
+    }
+  };
+
+  useEffect(() => {
+    if (isAuthenticated && user?.role === "admin") {
+      fetchData();
+      const interval = setInterval(fetchData, 10000);
+      return () => clearInterval(interval);
+    }
+  }, [isAuthenticated, user]);
+
+  const handleRefresh = () => {
+    setIsRefreshing(true);
+    fetchData();
+  };
+
+  const handleControl = async (container: ContainerInfo, action: ContainerAction) => {
+    setControlling(`${container.id}-${action}`);
+    try {
+      const result = await containersAPI.control(container.id, action);
+      toast.success(result.message);
+      fetchData();
+    } catch (error) {
+      toast.error(`Failed to ${action} container: ${error}`);
+    } finally {
+      setControlling(null);
+    }
+  };
+
+  const openDetail = async (container: ContainerInfo) => {
+    setSelected(container);
+    setStats(null);
+    setLogs([]);
+    setDetailLoading(true);
+    try {
+      const [logData, statsData] = await Promise.all([
+        containersAPI.getLogs(container.id),
+        container.state === "running" ? containersAPI.getStats(container.id) : Promise.resolve(null),
+      ]);
+      setLogs(logData);
+      setStats(statsData);
+    } catch (error) {
+      toast.error(`Failed to load container: ${error}`);
+    } finally {
+      setDetailLoading(false);
+    }
+  };
+
+  const getStateBadge = (state: string) => {
+    switch (state) {
+      case "running":
+        return <Badge className="bg-green-500">Running</Badge>;
+      case "exited":
+        return <Badge variant="secondary">Stopped</Badge>;
+      case "dead":
+        return <Badge variant="destructive">Dead</Badge>;
+      default:
+        return <Badge variant="outline">{state}</Badge>;
+    }
+  };
+
+  const formatBytes = (bytes: number) => {
+    if (bytes === 0) return "0 B";
+    const k = 1024;
+    const sizes = ["B", "KB", "MB", "GB", "TB"];
+    const i = Math.floor(Math.log(bytes) / Math.log(k));
+    return parseFloat((bytes / Math.pow(k, i)).toFixed(2)) + " " + sizes[i];
+  };
+
+  if (authLoading && !user) {
+    return <PageSkeleton title="Containers" />;
+  }
+
+  if (!isAuthenticated || (user && user.role !== "admin")) {
+    return <PageSkeleton title="Containers" />;
+  }
+
+  if (isLoading) {
+    return <PageSkeleton title="Containers" />;
+  }
+
+  return (
+    <div className="flex h-screen">
+      <Sidebar />
+      <div className="flex-1 flex flex-col overflow-hidden">
+        <Header title="Containers" />
+        <main className="flex-1 overflow-y-auto p-6">
+          <div className="max-w-7xl mx-auto space-y-6">
+            {/* Header */}
+            <div className="flex items-center justify-between">
+              <div>
+                <h2 className="text-2xl font-bold">Containers</h2>
+                <p className="text-muted-foreground">
+                  {runtime?.available
+                    ? `${runtime.runtime === "podman" ? "Podman" : "Docker"} ${runtime.version} • ${runtime.socket}`
+                    : "Docker and Podman containers on this server"}
+                </p>
+              </div>
+              <Button onClick={handleRefresh} disabled={isRefreshing} variant="outline">
+                <RefreshCw className={`h-4 w-4 mr-2 ${isRefreshing ? "animate-spin" : ""}`} />
+                Refresh
+              </Button>
+            </div>
+
+            {!runtime?.enabled ? (
+              <Card>
+                <CardHeader>
+                  <CardTitle className="flex items-center gap-2">
+                    <Boxes className="h-5 w-5" />
+                    Container Management Is Off
+                  </CardTitle>
+                  <CardDescription>
+                    Set <code>CONTAINERS_ENABLED=true</code> in the server environment and restart FileServ to
+                    manage Docker or Podman containers here.
+                  </CardDescription>
+                </CardHeader>
+              </Card>
+            ) : !runtime.available ? (
+              <Card>
+                <CardHeader>
+                  <CardTitle className="flex items-center gap-2">
+                    <AlertTriangle className="h-5 w-5 text-yellow-500" />
+                    Container Engine Unavailable
+                  </CardTitle>
+                  <CardDescription>{runtime.error}</CardDescription>
+                </CardHeader>
+              </Card>
+            ) : (
+              <Card>
+                <CardHeader>
+                  <CardTitle>All Containers</CardTitle>
+                  <CardDescription>
+                    Volumes inside a zone show the zone they map to
+                  </CardDescription>
+                </CardHeader>
+                <CardContent>
+                  {containers.length === 0 ? (
+                    <p className="text-sm text-muted-foreground text-center py-8">No containers</p>
+                  ) : (
+                    <Table>
+                      <TableHeader>
+                        <TableRow>
+                          <TableHead>Name</TableHead>
+                          <TableHead>Image</TableHead>
+                          <TableHead>State</TableHead>
+                          <TableHead>Ports</TableHead>
+                          <TableHead>Volumes</TableHead>
+                          <TableHead className="text-right">Actions</TableHead>
+                        </TableRow>
+                      </TableHeader>
+                      <TableBody>
+                        {containers.map((container) => (
+                          <TableRow key={container.id}>
+                            <TableCell>
+                              <div className="font-medium">{container.name}</div>
+                              <div className="text-xs text-muted-foreground">{container.status}</div>
+                            </TableCell>
+                            <TableCell className="max-w-xs truncate font-mono text-xs">{container.image}</TableCell>
+                            <TableCell>{getStateBadge(container.state)}</TableCell>
+                            <TableCell className="font-mono text-xs">
+                              {container.ports
+                                .filter((port) => port.host_port)
+                                .map((port) => `${port.host_port}→${port.container_port}/${port.protocol}`)
+                                .join(", ") || "-"}
+                            </TableCell>
+                            <TableCell className="space-y-1">
+                              {container.mounts.length === 0 && <span className="text-muted-foreground">-</span>}
+                              {container.mounts.map((mount) => (
+                                <div key={mount.destination} className="flex items-center gap-1 text-xs">
+                                  {mount.zone_name ? (
+                                    <Badge variant="outline" className="gap-1">
+                                      <FolderOpen className="h-3 w-3" />
+                                      {mount.zone_name}{mount.zone_path !== "/" ? mount.zone_path : ""}
+                                    </Badge>
+                                  ) : (
+                                    <span className="font-mono truncate max-w-[12rem]">{mount.name || mount.source}</span>
+                                  )}
+                                  <span className="text-muted-foreground">→ {mount.destination}</span>
+                                  {mount.read_only && <Badge variant="secondary">ro</Badge>}
+                                </div>
+                              ))}
+                            </TableCell>
+                            <TableCell className="text-right whitespace-nowrap">
+                              {container.state === "running" ? (
+                                <>
+                                  <Button
+                                    variant="ghost"
+                                    size="sm"
+                                    onClick={() => handleControl(container, "restart")}
+                                    disabled={controlling !== null}
+                                  >
+                                    {controlling === `${container.id}-restart` ? (
+                                      <Loader2 className="h-4 w-4 animate-spin" />
+                                    ) : (
+                                      <RotateCcw className="h-4 w-4" />
+                                    )}
+                                  </Button>
+                                  <Button
+                                    variant="ghost"
+                                    size="sm"
+                                    onClick={() => handleControl(container, "stop")}
+                                    disabled={controlling !== null}
+                                  >
+                                    {controlling === `${container.id}-stop` ? (
+                                      <Loader2 className="h-4 w-4 animate-spin" />
+                                    ) : (
+                                      <Square className="h-4 w-4" />
+                                    )}
+                                  </Button>
+                                </>
+                              ) : (
+                                <Button
+                                  variant="ghost"
+                                  size="sm"
+                                  onClick={() => handleControl(container, "start")}
+                                  disabled={controlling !== null}
+                                >
+                                  {controlling === `${container.id}-start` ? (
+                                    <Loader2 className="h-4 w-4 animate-spin" />
+                                  ) : (
+                                    <Play className="h-4 w-4" />
+                                  )}
+                                </Button>
+                              )}
+                              <Button variant="ghost" size="sm" onClick={() => openDetail(container)}>
+                                <ScrollText className="h-4 w-4" />
+                              </Button>
+                            </TableCell>
+                          </TableRow>
+                        ))}
+                      </TableBody>
+                    </Table>
+                  )}
+                </CardContent>
+              </Card>
+            )}
+          </div>
+        </main>
+      </div>
+
+      {/* Container Logs and Stats */}
+      <Dialog open={selected !== null} onOpenChange={(open) => !open && setSelected(null)}>
+        <DialogContent className="max-w-4xl">
+          <DialogHeader>
+            <DialogTitle>{selected?.name}</DialogTitle>
+            <DialogDescription className="font-mono text-xs">{selected?.image}</DialogDescription>
+          </DialogHeader>
+          {detailLoading ? (
+            <div className="flex justify-center py-8">
+              <Loader2 className="h-6 w-6 animate-spin" />
+            </div>
+          ) : (
+            <div className="space-y-4">
+              {stats && (
+                <div className="grid grid-cols-2 md:grid-cols-4 gap-3 text-sm">
+                  <div>
+                    <p className="text-muted-foreground">CPU</p>
+                    <p className="font-medium">{stats.cpu_percent.toFixed(1)}%</p>
+                  </div>
+                  <div>
+                    <p className="text-muted-foreground">Memory</p>
+                    <p className="font-medium">
+                      {formatBytes(stats.memory_usage)} / {formatBytes(stats.memory_limit)}
+                    </p>
+                  </div>
+                  <div>
+                    <p className="text-muted-foreground">Network RX / TX</p>
+                    <p className="font-medium">
+                      {formatBytes(stats.network_rx)} / {formatBytes(stats.network_tx)}
+                    </p>
+                  </div>
+                  <div>
+                    <p className="text-muted-foreground">Disk Read / Write</p>
+                    <p className="font-medium">
+                      {formatBytes(stats.block_read)} / {formatBytes(stats.block_write)}
+                    </p>
+                  </div>
+                </div>
+              )}
+              <div className="bg-zinc-950 text-zinc-100 rounded-lg p-3 font-mono text-xs h-96 overflow-auto">
+                {logs.length === 0 ? (
+                  <p className="text-zinc-500">No log output</p>
+                ) : (
+                  logs.map((line, i) => (
+                    <div key={i} className={`whitespace-pre-wrap break-all ${line.stream === "stderr" ? "text-red-400" : ""}`}>
+                      {line.text}
+                    </div>
+                  ))
+                )}
+              </div>
+            </div>
+          )}
+        </DialogContent>
+      </Dialog>
+    </div>
+  );
+}
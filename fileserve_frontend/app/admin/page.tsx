@@ -13,12 +13,7 @@ import { Separator } from "@/components/ui/separator";
 import { useAuth } from "@/lib/auth-context";
 import {
   adminAPI,
-  storageAPI,
-  systemAPI,
-  poolsAPI,
-  zonesAPI,
-  shareLinksAPI,
-  usersAPI,
+  batchData,
   AdminStats,
   StorageOverview,
   SystemResources,
@@ -93,24 +88,24 @@ export default function AdminPage() {
 
   const fetchDashboardData = useCallback(async () => {
     try {
-      const [statsRes, storageRes, systemRes, poolsRes, zonesRes, linksRes, usersRes] = await Promise.allSettled([
-        adminAPI.getStats(),
-        storageAPI.getOverview(),
-        systemAPI.getResources(),
-        poolsAPI.list(),
-        zonesAPI.list(),
-        shareLinksAPI.listAll(),
-        usersAPI.list(),
+      const { results } = await adminAPI.batch([
+        { query: "stats" },
+        { query: "storage_overview" },
+        { query: "system_resources" },
+        { query: "pools" },
+        { query: "zones" },
+        { query: "share_links" },
+        { query: "users" },
       ]);
 
       setData({
-        stats: statsRes.status === "fulfilled" ? statsRes.value : null,
-        storage: storageRes.status === "fulfilled" ? storageRes.value : null,
-        system: systemRes.status === "fulfilled" ? systemRes.value : null,
-        pools: poolsRes.status === "fulfilled" ? poolsRes.value || [] : [],
-        zones: zonesRes.status === "fulfilled" ? zonesRes.value || [] : [],
-        shareLinks: linksRes.status === "fulfilled" ? linksRes.value || [] : [],
-        users: usersRes.status === "fulfilled" ? usersRes.value || [] : [],
+        stats: batchData<AdminStats>(results.stats),
+        storage: batchData<StorageOverview>(results.storage_overview),
+        system: batchData<SystemResources>(results.system_resources),
+        pools: batchData<StoragePool[]>(results.pools) || [],
+        zones: batchData<ShareZone[]>(results.zones) || [],
+        shareLinks: batchData<ShareLink[]>(results.share_links) || [],
+        users: batchData<User[]>(results.users) || [],
       });
       setLastUpdated(new Date());
     } catch (error) {
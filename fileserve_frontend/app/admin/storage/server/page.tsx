@@ -36,7 +36,8 @@ import {
   AlertDialogTitle,
 } from "@/components/ui/alert-dialog";
 import { useAuth } from "@/lib/auth-context";
-import { systemAPI, SystemResources, ServiceInfo, NetworkInterface, Process, HardwareInfo } from "@/lib/api";
+import { systemAPI, SystemResources, ServiceInfo, NetworkInterface, Process, ProcessNode, HardwareInfo } from "@/lib/api";
+import { ProcessDetailDialog } from "@/components/process-detail-dialog";
 import { PageSkeleton } from "@/components/skeletons";
 import { toast } from "sonner";
 import {
@@ -61,6 +62,7 @@ import {
   AlertTriangle,
   Settings,
   Terminal,
+  Info,
 } from "lucide-react";
 
 export default function ServerControlPage() {
@@ -75,7 +77,9 @@ export default function ServerControlPage() {
   const [isRefreshing, setIsRefreshing] = useState(false);
   const [powerDialog, setPowerDialog] = useState<{ open: boolean; action?: 'reboot' | 'poweroff' | 'suspend' | 'hibernate' }>({ open: false });
   const [killProcessDialog, setKillProcessDialog] = useState<{ open: boolean; pid?: number }>({ open: false });
-  const [processSort, setProcessSort] = useState<"cpu" | "memory">("cpu");
+  const [processSort, setProcessSort] = useState<"cpu" | "memory" | "tree">("cpu");
+  const [processTree, setProcessTree] = useState<ProcessNode[]>([]);
+  const [detailPid, setDetailPid] = useState<number | null>(null);
 
   useEffect(() => {
     if (!authLoading) {
@@ -94,13 +98,17 @@ export default function ServerControlPage() {
         systemAPI.getHardware(),
         systemAPI.getServices("storage"),
         systemAPI.getNetworkInterfaces(),
-        systemAPI.getProcesses(processSort, 25),
+        processSort === "tree" ? systemAPI.getProcessTree() : systemAPI.getProcesses(processSort, 25),
       ]);
       setResources(resourceData);
       setHardware(hardwareData);
       setServices(serviceData);
       setInterfaces(networkData);
-      setProcesses(processData);
+      if (processSort === "tree") {
+        setProcessTree(processData as ProcessNode[]);
+      } else {
+        setProcesses(processData);
+      }
     } catch (error) {
       console.error("Failed to fetch system data:", error);
     } finally {
@@ -174,6 +182,14 @@ export default function ServerControlPage() {
     }
   };
 
+  // Flattens the process tree into rows, each with its depth for indentation
+  const flattenTree = (nodes: ProcessNode[], depth = 0): { proc: ProcessNode; depth: number }[] =>
+    nodes.flatMap((node) => [{ proc: node, depth }, ...flattenTree(node.children || [], depth + 1)]);
+
+  const processRows = processSort === "tree"
+    ? flattenTree(processTree)
+    : processes.map((proc) => ({ proc, depth: 0 }));
+
   const formatBytes = (bytes: number) => {
     if (bytes === 0) return "0 B";
     const k = 1024;
@@ -473,8 +489,10 @@ export default function ServerControlPage() {
                   <CardHeader>
                     <div className="flex items-center justify-between">
                       <div>
-                        <CardTitle>Top Processes</CardTitle>
-                        <CardDescription>Processes sorted by resource usage</CardDescription>
+                        <CardTitle>{processSort === "tree" ? "Process Tree" : "Top Processes"}</CardTitle>
+                        <CardDescription>
+                          {processSort === "tree" ? "All processes by parent" : "Processes sorted by resource usage"}
+                        </CardDescription>
                       </div>
                       <div className="flex gap-2">
                         <Button
@@ -491,6 +509,13 @@ export default function ServerControlPage() {
                         >
                           Memory
                         </Button>
+                        <Button
+                          variant={processSort === "tree" ? "default" : "outline"}
+                          size="sm"
+                          onClick={() => setProcessSort("tree")}
+                        >
+                          Tree
+                        </Button>
                       </div>
                     </div>
                   </CardHeader>
@@ -508,7 +533,7 @@ export default function ServerControlPage() {
                         </TableRow>
                       </TableHeader>
                       <TableBody>
-                        {processes.map((proc) => (
+                        {processRows.map(({ proc, depth }) => (
                           <TableRow key={proc.pid}>
                             <TableCell className="font-mono">{proc.pid}</TableCell>
                             <TableCell>{proc.user}</TableCell>
@@ -524,9 +549,19 @@ export default function ServerControlPage() {
                             </TableCell>
                             <TableCell>{formatBytes(proc.rss)}</TableCell>
                             <TableCell className="max-w-xs truncate font-mono text-xs">
-                              {proc.command}
+                              <span style={{ paddingLeft: `${depth * 12}px` }}>
+                                {depth > 0 && <span className="text-muted-foreground">└ </span>}
+                                {proc.command}
+                              </span>
                             </TableCell>
                             <TableCell className="text-right">
+                              <Button
+                                variant="ghost"
+                                size="sm"
+                                onClick={() => setDetailPid(proc.pid)}
+                              >
+                                <Info className="h-4 w-4" />
+                              </Button>
                               <Button
                                 variant="ghost"
                                 size="sm"
@@ -587,6 +622,13 @@ export default function ServerControlPage() {
         </AlertDialogContent>
       </AlertDialog>
 
+      {/* Process Detail Dialog */}
+      <ProcessDetailDialog
+        pid={detailPid}
+        onOpenChange={(open) => !open && setDetailPid(null)}
+        onChanged={fetchData}
+      />
+
       {/* Kill Process Confirmation Dialog */}
       <AlertDialog open={killProcessDialog.open} onOpenChange={(open) => setKillProcessDialog({ ...killProcessDialog, open })}>
         <AlertDialogContent>
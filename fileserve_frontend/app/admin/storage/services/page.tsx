@@ -11,6 +11,7 @@ import { Alert, AlertDescription, AlertTitle } from "@/components/ui/alert";
 import { useAuth } from "@/lib/auth-context";
 import { TerminalOutput } from "@/components/terminal-output";
 import {
+  BASE_PATH,
   sharingServicesAPI,
   SharingServicesResponse,
   SharingServiceStatus,
@@ -49,6 +50,7 @@ import {
   FolderOpen,
   MonitorSmartphone,
   FileText,
+  ScrollText,
   Globe,
   Disc,
   Clock,
@@ -65,6 +67,7 @@ export default function SharingServicesPage() {
   const [installingService, setInstallingService] = useState<"smb" | "nfs" | null>(null);
   const [showInstallTerminal, setShowInstallTerminal] = useState(false);
   const [controllingService, setControllingService] = useState<string | null>(null);
+  const [logsService, setLogsService] = useState<SharingServiceStatus | null>(null);
 
   useEffect(() => {
     if (authLoading) return;
@@ -340,6 +343,14 @@ export default function SharingServicesPage() {
                     Enable Autostart
                   </Button>
                 )}
+                <Button
+                  variant="ghost"
+                  size="sm"
+                  onClick={() => setLogsService(status)}
+                >
+                  <ScrollText className="h-4 w-4 mr-1" />
+                  View Logs
+                </Button>
               </div>
 
               {/* Service Info */}
@@ -487,13 +498,24 @@ export default function SharingServicesPage() {
             {/* Installation Terminal Output */}
             {showInstallTerminal && installingService && (
               <TerminalOutput
-                url={`/api/sharing/install/stream?service=${installingService}`}
+                url={`${BASE_PATH}/api/sharing/install/stream?service=${installingService}`}
                 title={`${installingService.toUpperCase()} Installation`}
                 onComplete={handleInstallComplete}
                 onClose={handleCloseTerminal}
               />
             )}
 
+            {/* Live Service Logs */}
+            {logsService && (
+              <TerminalOutput
+                key={logsService.service_name}
+                url={`${BASE_PATH}/api/system/services/${encodeURIComponent(logsService.service_name)}/logs?follow=true&lines=200`}
+                title={`${logsService.display_name} Logs (${logsService.service_name})`}
+                live
+                onClose={() => setLogsService(null)}
+              />
+            )}
+
             {/* Connections Status */}
             {services && (services.smb.running || services.nfs.running) && (
               <Card>
@@ -587,6 +587,15 @@ export default function FilesPage() {
     }
   };
 
+  const handleDownloadChecksums = async (file: FileItem) => {
+    if (!selectedZone) return;
+    try {
+      await zoneFilesAPI.downloadChecksums(selectedZone.zone_id, file.path);
+    } catch (error) {
+      toast.error(error instanceof Error ? error.message : "Failed to download checksums");
+    }
+  };
+
   const handleRenameClick = (file: FileItem) => {
     setFileToRename(file);
     setNewFileName(file.name);
@@ -886,6 +895,7 @@ export default function FilesPage() {
                             onNavigate={handleNavigate}
                             onDelete={handleDeleteClick}
                             onDownload={handleDownload}
+                            onDownloadChecksums={handleDownloadChecksums}
                             onRename={handleRenameClick}
                             showSelection={true}
                             onSelectionChange={handleSelectionChange}
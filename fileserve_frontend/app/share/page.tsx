@@ -115,7 +115,7 @@ function ShareContent() {
         setNeedsPassword(true);
       } else {
         setPasswordVerified(true);
-        if (info.target_type === "folder" && info.allow_listing) {
+        if (info.target_type !== "file" && info.allow_listing) {
           loadFiles("");
         }
       }
@@ -147,7 +147,7 @@ function ShareContent() {
       if (result.valid) {
         setPasswordVerified(true);
         setNeedsPassword(false);
-        if (shareInfo?.target_type === "folder" && shareInfo.allow_listing) {
+        if (shareInfo && shareInfo.target_type !== "file" && shareInfo.allow_listing) {
           loadFiles("");
         }
       } else {
@@ -277,7 +277,7 @@ function ShareContent() {
             <div className="flex items-start justify-between">
               <div className="flex items-center gap-4">
                 <div className="h-12 w-12 rounded-lg bg-primary/10 flex items-center justify-center">
-                  {shareInfo?.target_type === "folder" ? (
+                  {shareInfo && shareInfo.target_type !== "file" ? (
                     <Folder className="h-6 w-6 text-primary" />
                   ) : (
                     <File className="h-6 w-6 text-primary" />
@@ -336,7 +336,7 @@ function ShareContent() {
         </Card>
 
         {/* File Listing for Folders */}
-        {shareInfo?.target_type === "folder" && shareInfo.allow_listing && (
+        {shareInfo && shareInfo.target_type !== "file" && shareInfo.allow_listing && (
           <Card>
             <CardHeader>
               <div className="flex items-center justify-between">
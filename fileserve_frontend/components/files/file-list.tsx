@@ -20,6 +20,7 @@ import {
   FileSpreadsheet,
   Presentation,
   FileType,
+  ShieldCheck,
 } from "lucide-react";
 import {
   Table,
@@ -68,6 +69,7 @@ interface FileListProps {
   files: FileItem[];
   onNavigate?: (path: string) => void;
   onDownload?: (file: FileItem) => void;
+  onDownloadChecksums?: (file: FileItem) => void;
   onDelete?: (file: FileItem) => void;
   onRename?: (file: FileItem) => void;
   onShare?: (file: FileItem) => void;
@@ -304,6 +306,7 @@ export function FileList({
   files,
   onNavigate,
   onDownload,
+  onDownloadChecksums,
   onDelete,
   onRename,
   onShare,
@@ -657,6 +660,17 @@ export function FileList({
                               Download
                             </DropdownMenuItem>
                           )}
+                          {onDownloadChecksums && (
+                            <DropdownMenuItem
+                              onClick={(e) => {
+                                e.stopPropagation();
+                                onDownloadChecksums(file);
+                              }}
+                            >
+                              <ShieldCheck className="mr-2 h-4 w-4" />
+                              Download checksums
+                            </DropdownMenuItem>
+                          )}
                           {onShare && (
                             <DropdownMenuItem
                               onClick={(e) => {
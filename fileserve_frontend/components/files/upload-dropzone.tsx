@@ -4,6 +4,7 @@ import { useState, useCallback, useRef, useEffect } from 'react';
 import { Upload, FileUp } from 'lucide-react';
 import { cn } from '@/lib/utils';
 import { useUploadQueue } from '@/lib/hooks/use-upload';
+import { zoneFilesAPI } from '@/lib/api';
 import { toast } from 'sonner';
 
 interface UploadDropzoneProps {
@@ -62,6 +63,7 @@ export function UploadDropzone({
     if (disabled) return;
 
     const files: File[] = [];
+    const directories: string[] = [];
 
     // Handle both files and folders
     if (e.dataTransfer.items) {
@@ -77,7 +79,7 @@ export function UploadDropzone({
               if (file) files.push(file);
             } else if (entry.isDirectory) {
               // Recursively get files from directory
-              const dirFiles = await readDirectory(entry as FileSystemDirectoryEntry);
+              const dirFiles = await readDirectory(entry as FileSystemDirectoryEntry, directories);
               files.push(...dirFiles);
             }
           } else {
@@ -90,6 +92,19 @@ export function UploadDropzone({
       files.push(...Array.from(e.dataTransfer.files));
     }
 
+    // Create the folder structure first so empty folders are kept too
+    if (directories.length > 0 && zoneId) {
+      try {
+        await zoneFilesAPI.createFolders(zoneId, currentPath, directories);
+      } catch (err) {
+        toast.error(err instanceof Error ? err.message : 'Failed to create folders');
+        return;
+      }
+      if (files.length === 0) {
+        toast.success(`Created ${directories.length} folder${directories.length !== 1 ? 's' : ''}`);
+      }
+    }
+
     if (files.length > 0) {
       addFiles(files, currentPath, zoneId);
       toast.success(`Added ${files.length} file${files.length !== 1 ? 's' : ''} to upload queue`);
@@ -130,9 +145,11 @@ export function UploadDropzone({
   );
 }
 
-// Helper function to read files from a directory entry
-async function readDirectory(directoryEntry: FileSystemDirectoryEntry): Promise<File[]> {
+// Helper function to read files from a directory entry. The relative path of every
+// directory, including empty ones, is appended to directories.
+async function readDirectory(directoryEntry: FileSystemDirectoryEntry, directories: string[]): Promise<File[]> {
   const files: File[] = [];
+  directories.push(directoryEntry.fullPath.replace(/^\//, ''));
   const reader = directoryEntry.createReader();
 
   const readEntries = (): Promise<FileSystemEntry[]> => {
@@ -169,7 +186,7 @@ async function readDirectory(directoryEntry: FileSystemDirectoryEntry): Promise<
           console.warn('Could not read file:', entry.fullPath, err);
         }
       } else if (entry.isDirectory) {
-        const subFiles = await readDirectory(entry as FileSystemDirectoryEntry);
+        const subFiles = await readDirectory(entry as FileSystemDirectoryEntry, directories);
         files.push(...subFiles);
       }
     }
@@ -24,6 +24,7 @@ import {
   Disc3,
   Camera,
   Bell,
+  Boxes,
 } from "lucide-react";
 import { Separator } from "@/components/ui/separator";
 
@@ -164,6 +165,12 @@ const navSections: NavSection[] = [
         icon: Server,
         adminOnly: true,
       },
+      {
+        title: "Containers",
+        href: "/admin/containers",
+        icon: Boxes,
+        adminOnly: true,
+      },
     ],
   },
   {
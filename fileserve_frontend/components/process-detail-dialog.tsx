@@ -0,0 +1,245 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import {
+  Dialog,
+  DialogContent,
+  DialogDescription,
+  DialogHeader,
+  DialogTitle,
+} from "@/components/ui/dialog";
+import { Badge } from "@/components/ui/badge";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Label } from "@/components/ui/label";
+import { Tabs, TabsContent, TabsList, TabsTrigger } from "@/components/ui/tabs";
+import { systemAPI, ProcessDetail } from "@/lib/api";
+import { toast } from "sonner";
+import { Loader2, Gauge } from "lucide-react";
+
+interface ProcessDetailDialogProps {
+  pid: number | null;
+  onOpenChange: (open: boolean) => void;
+  onChanged?: () => void;
+}
+
+const MB = 1024 * 1024;
+
+function formatBytes(bytes: number) {
+  if (bytes === 0) return "0 B";
+  const k = 1024;
+  const sizes = ["B", "KB", "MB", "GB", "TB"];
+  const i = Math.floor(Math.log(bytes) / Math.log(k));
+  return `${(bytes / Math.pow(k, i)).toFixed(1)} ${sizes[i]}`;
+}
+
+export function ProcessDetailDialog({ pid, onOpenChange, onChanged }: ProcessDetailDialogProps) {
+  const [detail, setDetail] = useState<ProcessDetail | null>(null);
+  const [isLoading, setIsLoading] = useState(false);
+  const [isSaving, setIsSaving] = useState(false);
+  const [nice, setNice] = useState("0");
+  const [cpuPercent, setCpuPercent] = useState("0");
+  const [device, setDevice] = useState("");
+  const [readMBps, setReadMBps] = useState("0");
+  const [writeMBps, setWriteMBps] = useState("0");
+
+  const applyDetail = (data: ProcessDetail) => {
+    setDetail(data);
+    setNice(data.nice.toString());
+    setCpuPercent(data.limits.cpu_percent.toString());
+    const io = data.limits.io[0];
+    setDevice(io?.device || "");
+    setReadMBps(io ? (io.read_bps / MB).toString() : "0");
+    setWriteMBps(io ? (io.write_bps / MB).toString() : "0");
+  };
+
+  useEffect(() => {
+    if (pid === null) {
+      setDetail(null);
+      return;
+    }
+    setIsLoading(true);
+    systemAPI
+      .getProcess(pid)
+      .then(applyDetail)
+      .catch((error) => {
+        toast.error(`Failed to load process: ${error}`);
+        onOpenChange(false);
+      })
+      .finally(() => setIsLoading(false));
+  }, [pid]);
+
+  const handleRenice = async () => {
+    if (pid === null) return;
+    setIsSaving(true);
+    try {
+      applyDetail(await systemAPI.reniceProcess(pid, parseInt(nice, 10)));
+      toast.success("Priority changed");
+      onChanged?.();
+    } catch (error) {
+      toast.error(`Failed to renice process: ${error}`);
+    } finally {
+      setIsSaving(false);
+    }
+  };
+
+  const handleLimit = async () => {
+    if (pid === null) return;
+    setIsSaving(true);
+    try {
+      const limits = device
+        ? {
+            cpu_percent: parseFloat(cpuPercent) || 0,
+            device,
+            read_bps: Math.round((parseFloat(readMBps) || 0) * MB),
+            write_bps: Math.round((parseFloat(writeMBps) || 0) * MB),
+          }
+        : { cpu_percent: parseFloat(cpuPercent) || 0 };
+      applyDetail(await systemAPI.limitProcess(pid, limits));
+      toast.success(`Limits applied to ${detail?.unit}`);
+    } catch (error) {
+      toast.error(`Failed to limit process: ${error}`);
+    } finally {
+      setIsSaving(false);
+    }
+  };
+
+  return (
+    <Dialog open={pid !== null} onOpenChange={onOpenChange}>
+      <DialogContent className="max-w-3xl">
+        <DialogHeader>
+          <DialogTitle>
+            Process {pid} {detail && <span className="text-muted-foreground font-normal">({detail.name})</span>}
+          </DialogTitle>
+          <DialogDescription className="font-mono text-xs break-all">
+            {detail?.command}
+          </DialogDescription>
+        </DialogHeader>
+
+        {isLoading || !detail ? (
+          <div className="flex justify-center py-8">
+            <Loader2 className="h-6 w-6 animate-spin" />
+          </div>
+        ) : (
+          <Tabs defaultValue="overview">
+            <TabsList>
+              <TabsTrigger value="overview">Overview</TabsTrigger>
+              <TabsTrigger value="files">Open Files ({detail.open_file_count})</TabsTrigger>
+              <TabsTrigger value="threads">Threads ({detail.threads.length})</TabsTrigger>
+              <TabsTrigger value="limits">Priority & Limits</TabsTrigger>
+            </TabsList>
+
+            <TabsContent value="overview" className="space-y-4">
+              <div className="grid grid-cols-2 gap-x-6 gap-y-2 text-sm">
+                <div className="flex justify-between"><span className="text-muted-foreground">User</span><span>{detail.user}</span></div>
+                <div className="flex justify-between"><span className="text-muted-foreground">State</span><span>{detail.state}</span></div>
+                <div className="flex justify-between"><span className="text-muted-foreground">Parent</span><span className="font-mono">{detail.ppid}</span></div>
+                <div className="flex justify-between"><span className="text-muted-foreground">Nice</span><span>{detail.nice}</span></div>
+                <div className="flex justify-between"><span className="text-muted-foreground">RSS</span><span>{formatBytes(detail.rss)}</span></div>
+                <div className="flex justify-between"><span className="text-muted-foreground">Virtual</span><span>{formatBytes(detail.vsz)}</span></div>
+                <div className="flex justify-between"><span className="text-muted-foreground">Started</span><span>{detail.started_at ? new Date(detail.started_at).toLocaleString() : "-"}</span></div>
+                <div className="flex justify-between"><span className="text-muted-foreground">Children</span><span className="font-mono">{detail.children.join(", ") || "-"}</span></div>
+                <div className="col-span-2 flex justify-between gap-4"><span className="text-muted-foreground">Executable</span><span className="font-mono text-xs break-all">{detail.exe || "-"}</span></div>
+                <div className="col-span-2 flex justify-between gap-4"><span className="text-muted-foreground">Working directory</span><span className="font-mono text-xs break-all">{detail.cwd || "-"}</span></div>
+                <div className="col-span-2 flex justify-between gap-4">
+                  <span className="text-muted-foreground">Cgroup</span>
+                  <span className="font-mono text-xs break-all">
+                    {detail.cgroup || "-"}
+                    {detail.unit && <Badge variant="outline" className="ml-2">{detail.unit}</Badge>}
+                  </span>
+                </div>
+              </div>
+
+              <div>
+                <h4 className="text-sm font-medium mb-2">Environment</h4>
+                <div className="rounded border bg-muted/50 p-2 font-mono text-xs max-h-40 overflow-auto space-y-1">
+                  {Object.entries(detail.environment).length === 0 ? (
+                    <p className="text-muted-foreground">Not available</p>
+                  ) : (
+                    Object.entries(detail.environment).map(([key, value]) => (
+                      <div key={key} className="break-all">
+                        <span className="text-muted-foreground">{key}=</span>{value}
+                      </div>
+                    ))
+                  )}
+                </div>
+              </div>
+            </TabsContent>
+
+            <TabsContent value="files">
+              <div className="max-h-80 overflow-auto font-mono text-xs space-y-1">
+                {detail.open_files.map((file) => (
+                  <div key={file.fd} className="flex gap-3">
+                    <span className="w-10 text-right text-muted-foreground">{file.fd}</span>
+                    <Badge variant="secondary" className="w-20 justify-center">{file.type}</Badge>
+                    <span className="break-all">{file.target}</span>
+                  </div>
+                ))}
+                {detail.open_file_count > detail.open_files.length && (
+                  <p className="text-muted-foreground">
+                    {detail.open_file_count - detail.open_files.length} more not shown
+                  </p>
+                )}
+              </div>
+            </TabsContent>
+
+            <TabsContent value="threads">
+              <div className="max-h-80 overflow-auto font-mono text-xs space-y-1">
+                {detail.threads.map((thread) => (
+                  <div key={thread.tid} className="flex gap-3">
+                    <span className="w-16 text-right text-muted-foreground">{thread.tid}</span>
+                    <span className="w-6">{thread.state}</span>
+                    <span>{thread.name}</span>
+                  </div>
+                ))}
+              </div>
+            </TabsContent>
+
+            <TabsContent value="limits" className="space-y-6">
+              <div className="space-y-2">
+                <Label htmlFor="nice">Nice (-20 highest priority, 19 lowest)</Label>
+                <div className="flex gap-2">
+                  <Input id="nice" type="number" min={-20} max={19} value={nice} onChange={(e) => setNice(e.target.value)} className="w-32" />
+                  <Button onClick={handleRenice} disabled={isSaving}>Renice</Button>
+                </div>
+              </div>
+
+              <div className="space-y-3">
+                <div>
+                  <h4 className="text-sm font-medium">Cgroup Limits</h4>
+                  <p className="text-xs text-muted-foreground">
+                    {detail.unit
+                      ? `Applies to every process of ${detail.unit} until it restarts. 0 removes a limit.`
+                      : "This process does not run in a systemd service or scope, so it cannot be limited."}
+                  </p>
+                </div>
+                <div className="grid grid-cols-2 gap-3">
+                  <div className="space-y-1">
+                    <Label htmlFor="cpu-percent">CPU % (100 = one CPU)</Label>
+                    <Input id="cpu-percent" type="number" min={0} value={cpuPercent} onChange={(e) => setCpuPercent(e.target.value)} />
+                  </div>
+                  <div className="space-y-1">
+                    <Label htmlFor="io-device">Block device for IO limits</Label>
+                    <Input id="io-device" placeholder="/dev/sda" value={device} onChange={(e) => setDevice(e.target.value)} />
+                  </div>
+                  <div className="space-y-1">
+                    <Label htmlFor="read-mbps">Read MB/s</Label>
+                    <Input id="read-mbps" type="number" min={0} value={readMBps} onChange={(e) => setReadMBps(e.target.value)} disabled={!device} />
+                  </div>
+                  <div className="space-y-1">
+                    <Label htmlFor="write-mbps">Write MB/s</Label>
+                    <Input id="write-mbps" type="number" min={0} value={writeMBps} onChange={(e) => setWriteMBps(e.target.value)} disabled={!device} />
+                  </div>
+                </div>
+                <Button onClick={handleLimit} disabled={isSaving || !detail.unit}>
+                  <Gauge className="h-4 w-4 mr-2" />
+                  Apply Limits
+                </Button>
+              </div>
+            </TabsContent>
+          </Tabs>
+        )}
+      </DialogContent>
+    </Dialog>
+  );
+}
@@ -10,6 +10,7 @@ interface StreamEvent {
   type: "output" | "error" | "complete";
   message: string;
   success?: boolean;
+  timestamp?: string; // Set on log entries
 }
 
 interface TerminalOutputProps {
@@ -17,9 +18,10 @@ interface TerminalOutputProps {
   onComplete?: (success: boolean) => void;
   onClose?: () => void;
   title?: string;
+  live?: boolean; // The stream runs until closed, like a followed log
 }
 
-export function TerminalOutput({ url, onComplete, onClose, title = "Installation Progress" }: TerminalOutputProps) {
+export function TerminalOutput({ url, onComplete, onClose, title = "Installation Progress", live = false }: TerminalOutputProps) {
   const [lines, setLines] = useState<{ text: string; type: "output" | "error" }[]>([]);
   const [isComplete, setIsComplete] = useState(false);
   const [success, setSuccess] = useState<boolean | null>(null);
@@ -40,9 +42,12 @@ export function TerminalOutput({ url, onComplete, onClose, title = "Installation
         setFinalMessage(data.message);
         onComplete?.(data.success ?? false);
       } else {
+        const text = data.timestamp
+          ? `${new Date(data.timestamp).toLocaleTimeString()} ${data.message}`
+          : data.message;
         setLines((prev) => [
           ...prev,
-          { text: data.message, type: data.type as "output" | "error" },
+          { text, type: data.type as "output" | "error" },
         ]);
       }
     } catch (e) {
@@ -150,7 +155,7 @@ export function TerminalOutput({ url, onComplete, onClose, title = "Installation
           {!isComplete ? (
             <Badge variant="outline" className="gap-1">
               <Loader2 className="h-3 w-3 animate-spin" />
-              Running
+              {live ? "Live" : "Running"}
             </Badge>
           ) : success ? (
             <Badge variant="default" className="bg-green-600 gap-1">
@@ -163,7 +168,7 @@ export function TerminalOutput({ url, onComplete, onClose, title = "Installation
               Failed
             </Badge>
           )}
-          {isComplete && onClose && (
+          {(isComplete || live) && onClose && (
             <Button variant="ghost" size="sm" onClick={onClose}>
               <X className="h-4 w-4" />
             </Button>
@@ -2,18 +2,48 @@
  * API utility for communicating with the FileServ backend
  */
 
-const API_BASE = '/api';
+// Path the app is published on behind a reverse proxy, e.g. /files (set at build time)
+export const BASE_PATH = process.env.NEXT_PUBLIC_BASE_PATH || '';
 
-// Custom error class that includes HTTP status
+const API_BASE = `${BASE_PATH}/api`;
+
+// Custom error class that includes HTTP status and the machine-readable code of the error
 export class APIError extends Error {
   status: number;
-  constructor(message: string, status: number) {
+  code?: string; // e.g. ZONE_NOT_FOUND, DEVICE_MOUNTED
+  details?: unknown;
+  requestId?: string;
+  constructor(message: string, status: number, code?: string, details?: unknown, requestId?: string) {
     super(message);
     this.status = status;
+    this.code = code;
+    this.details = details;
+    this.requestId = requestId;
     this.name = 'APIError';
   }
 }
 
+// Error responses are a JSON envelope: {code, message, details?, request_id?}
+export interface APIErrorEnvelope {
+  code: string;
+  message: string;
+  details?: unknown;
+  request_id?: string;
+}
+
+// Builds an APIError from the body of a failed response
+export function parseAPIError(body: string, status: number): APIError {
+  try {
+    const envelope = JSON.parse(body) as APIErrorEnvelope;
+    if (envelope && typeof envelope.message === 'string') {
+      return new APIError(envelope.message, status, envelope.code, envelope.details, envelope.request_id);
+    }
+  } catch {
+    // Not an envelope, e.g. from a proxy in front of the server
+  }
+  return new APIError(body || `HTTP ${status}`, status);
+}
+
 // Store token in memory (also persisted to localStorage)
 let authToken: string | null = null;
 
@@ -46,6 +76,12 @@ export function getAuthToken(): string | null {
   return authToken;
 }
 
+// Cookie sessions require the CSRF cookie to be echoed on state-changing requests
+function getCSRFToken(): string | null {
+  const match = document.cookie.match(/(?:^|;\s*)fileserv_csrf=([^;]+)/);
+  return match ? decodeURIComponent(match[1]) : null;
+}
+
 export function clearAuthToken() {
   authToken = null;
   localStorage.removeItem('auth_token');
@@ -67,6 +103,11 @@ async function fetchAPI<T>(
     (headers as Record<string, string>)['Authorization'] = `Bearer ${token}`;
   }
 
+  const csrfToken = getCSRFToken();
+  if (csrfToken) {
+    (headers as Record<string, string>)['X-CSRF-Token'] = csrfToken;
+  }
+
   // Add content-type for non-FormData requests
   if (!(options.body instanceof FormData)) {
     (headers as Record<string, string>)['Content-Type'] = 'application/json';
@@ -78,8 +119,7 @@ async function fetchAPI<T>(
   });
 
   if (!response.ok) {
-    const errorText = await response.text();
-    throw new APIError(errorText || `HTTP ${response.status}`, response.status);
+    throw parseAPIError(await response.text(), response.status);
   }
 
   // Handle empty responses (like 204 No Content)
@@ -107,6 +147,7 @@ export interface LoginResponse {
     groups: string[];
     created_at: string;
     updated_at: string;
+    must_change_password?: boolean;
   };
 }
 
@@ -115,6 +156,74 @@ export interface CurrentUserResponse {
   username: string;
   is_admin: boolean;
   groups: string[];
+  is_guest?: boolean;
+  guest_zones?: string[];
+  expires_at?: string;
+  impersonated_by?: string; // Set when an admin is acting as this user
+  must_change_password?: boolean; // Set when the password has expired or was reset
+}
+
+export interface ImpersonationResponse {
+  token: string;
+  expires_at: number;
+  impersonated_by: string;
+  user: {
+    id: string;
+    username: string;
+    is_admin: boolean;
+    groups: string[];
+    is_guest?: boolean;
+  };
+}
+
+// A signed-in browser or client
+export interface Session {
+  id: string;
+  user_id: string;
+  username: string;
+  ip: string;
+  user_agent: string;
+  device: string;
+  impersonated_by?: string;
+  expires_at: string;
+  created_at: string;
+  last_seen: string;
+  current: boolean;
+}
+
+export interface Passkey {
+  id: string;
+  user_id: string;
+  username: string;
+  name: string;
+  credential_id: string;
+  created_at: string;
+  last_used?: string;
+}
+
+// WebAuthn options from the server carry binary fields as base64url strings
+interface PasskeyCeremony<T> {
+  ceremony_id: string;
+  options: T;
+}
+
+function base64urlToBuffer(value: string): ArrayBuffer {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const binary = atob(base64.padEnd(Math.ceil(base64.length / 4) * 4, '='));
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes.buffer;
+}
+
+function bufferToBase64url(buffer: ArrayBuffer): string {
+  const bytes = new Uint8Array(buffer);
+  let binary = '';
+  for (let i = 0; i < bytes.length; i++) {
+    binary += String.fromCharCode(bytes[i]);
+  }
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
 }
 
 export const authAPI = {
@@ -144,6 +253,95 @@ export const authAPI = {
       method: 'POST',
       body: JSON.stringify({ current_password: currentPassword, new_password: newPassword }),
     }),
+
+  listSessions: () => fetchAPI<Session[]>('/auth/sessions'),
+
+  revokeSession: (id: string) =>
+    fetchAPI<void>(`/auth/sessions/${id}`, {
+      method: 'DELETE',
+    }),
+
+  // Signs out every session except the current one
+  revokeOtherSessions: () =>
+    fetchAPI<{ revoked: number }>('/auth/sessions', {
+      method: 'DELETE',
+    }),
+
+  listPasskeys: () => fetchAPI<Passkey[]>('/auth/passkeys'),
+
+  // Creates a passkey on this device with the browser's WebAuthn prompt
+  registerPasskey: async (name: string) => {
+    const { ceremony_id, options } = await fetchAPI<
+      PasskeyCeremony<{
+        challenge: string;
+        user: { id: string; name: string; displayName: string };
+        excludeCredentials: { type: 'public-key'; id: string }[];
+      } & Omit<PublicKeyCredentialCreationOptions, 'challenge' | 'user' | 'excludeCredentials'>>
+    >('/auth/passkeys/register', { method: 'POST' });
+
+    const credential = (await navigator.credentials.create({
+      publicKey: {
+        ...options,
+        challenge: base64urlToBuffer(options.challenge),
+        user: { ...options.user, id: base64urlToBuffer(options.user.id) },
+        excludeCredentials: options.excludeCredentials.map((c) => ({ ...c, id: base64urlToBuffer(c.id) })),
+      },
+    })) as PublicKeyCredential | null;
+    if (!credential) {
+      throw new Error('Passkey creation was cancelled');
+    }
+    const response = credential.response as AuthenticatorAttestationResponse;
+
+    return fetchAPI<Passkey>('/auth/passkeys/register/finish', {
+      method: 'POST',
+      body: JSON.stringify({
+        ceremony_id,
+        name,
+        credential: {
+          id: bufferToBase64url(credential.rawId),
+          response: {
+            clientDataJSON: bufferToBase64url(response.clientDataJSON),
+            attestationObject: bufferToBase64url(response.attestationObject),
+          },
+        },
+      }),
+    });
+  },
+
+  deletePasskey: (id: string) =>
+    fetchAPI<void>(`/auth/passkeys/${id}`, {
+      method: 'DELETE',
+    }),
+
+  // Signs in with a passkey; the browser lets the user pick the account
+  loginWithPasskey: async () => {
+    const { ceremony_id, options } = await fetchAPI<
+      PasskeyCeremony<{ challenge: string } & Omit<PublicKeyCredentialRequestOptions, 'challenge'>>
+    >('/auth/passkeys/login', { method: 'POST' });
+
+    const credential = (await navigator.credentials.get({
+      publicKey: { ...options, challenge: base64urlToBuffer(options.challenge) },
+    })) as PublicKeyCredential | null;
+    if (!credential) {
+      throw new Error('Passkey sign-in was cancelled');
+    }
+    const response = credential.response as AuthenticatorAssertionResponse;
+
+    return fetchAPI<LoginResponse>('/auth/passkeys/login/finish', {
+      method: 'POST',
+      body: JSON.stringify({
+        ceremony_id,
+        credential: {
+          id: bufferToBase64url(credential.rawId),
+          response: {
+            clientDataJSON: bufferToBase64url(response.clientDataJSON),
+            authenticatorData: bufferToBase64url(response.authenticatorData),
+            signature: bufferToBase64url(response.signature),
+          },
+        },
+      }),
+    });
+  },
 };
 
 // Files API
@@ -160,6 +358,94 @@ export interface FileInfo {
   gid: number;
   mime_type?: string;
   extension?: string;
+  tags?: string[];
+  description?: string;
+  starred?: boolean;
+  lock?: FileLockInfo;
+}
+
+// Who holds a lock on a listed file
+export interface FileLockInfo {
+  username: string;
+  scope: FileLockScope;
+  owner?: string;
+  expires_at: string;
+}
+
+// User-defined tags, description and star flag of a zone file
+export interface FileMetadata {
+  zone_id: string;
+  path: string;
+  tags: string[];
+  description?: string;
+  starred: boolean;
+  updated_by?: string;
+  updated_at: string;
+}
+
+export interface FileMetadataUpdate {
+  tags?: string[];
+  description?: string;
+  starred?: boolean;
+}
+
+export interface TagCount {
+  tag: string;
+  count: number;
+}
+
+// Archive browsing types
+export interface ArchiveEntry {
+  path: string;
+  size: number;
+  mod_time: string;
+  is_dir: boolean;
+}
+
+export interface ArchiveListing {
+  format: 'zip' | 'tar' | 'tar.gz' | 'tar.bz2' | '7z';
+  entries: ArchiveEntry[];
+  total_files: number;
+  total_size: number;
+  truncated: boolean;
+}
+
+// EXIF details of an image, used by the photo gallery
+export interface ImageMetadata {
+  zone_id: string;
+  path: string;
+  date_taken?: string;
+  camera_make?: string;
+  camera_model?: string;
+  lens?: string;
+  width?: number;
+  height?: number;
+  orientation?: number;
+  exposure_time?: string;
+  f_number?: number;
+  iso?: number;
+  focal_length?: number;
+  latitude?: number;
+  longitude?: number;
+  altitude?: number;
+  size: number;
+  mod_time: string;
+  indexed_at: string;
+}
+
+export interface GalleryResult {
+  images: ImageMetadata[];
+  total: number;
+  limit: number;
+  offset: number;
+  has_more: boolean;
+}
+
+export interface GalleryBucket {
+  period: string;
+  start: string;
+  count: number;
+  cover: string;
 }
 
 export const filesAPI = {
@@ -234,15 +520,20 @@ export interface UserZoneInfo {
   description: string;
   can_upload: boolean;
   can_share: boolean;
+  can_invite: boolean;
 }
 
 // Pagination options for file listings
 export interface ListOptions {
   limit?: number;
   offset?: number;
-  sort_by?: 'name' | 'size' | 'modified' | 'type';
+  // next_cursor of the previous page; takes precedence over offset
+  cursor?: string;
+  sort_by?: 'name' | 'size' | 'modified' | 'mtime' | 'type' | 'owner';
   sort_desc?: boolean;
   type?: 'file' | 'folder' | '';
+  // Skip size, dates, owner and tags for very large folders (name and type sorting only)
+  fast?: boolean;
 }
 
 // Paginated result
@@ -252,6 +543,7 @@ export interface ListResult {
   limit: number;
   offset: number;
   has_more: boolean;
+  next_cursor?: string;
 }
 
 export const zoneFilesAPI = {
@@ -270,9 +562,11 @@ export const zoneFilesAPI = {
     if (path) params.set('path', path);
     if (options.limit) params.set('limit', options.limit.toString());
     if (options.offset) params.set('offset', options.offset.toString());
+    if (options.cursor) params.set('cursor', options.cursor);
     if (options.sort_by) params.set('sort_by', options.sort_by);
     if (options.sort_desc) params.set('sort_desc', 'true');
     if (options.type) params.set('type', options.type);
+    if (options.fast) params.set('fast', 'true');
     return fetchAPI<ListResult>(`/zones/${zoneId}/files/?${params.toString()}`);
   },
 
@@ -302,6 +596,24 @@ export const zoneFilesAPI = {
       });
   },
 
+  // Download an SHA256SUMS manifest of a file or folder, for verifying copies with sha256sum -c
+  downloadChecksums: async (zoneId: string, path: string) => {
+    const response = await fetch(`${API_BASE}/zones/${zoneId}/checksums?path=${encodeURIComponent(normalizePath(path))}`, {
+      headers: { Authorization: `Bearer ${getAuthToken()}` },
+    });
+    if (!response.ok) {
+      throw parseAPIError(await response.text(), response.status);
+    }
+    const blobUrl = URL.createObjectURL(await response.blob());
+    const link = document.createElement('a');
+    link.href = blobUrl;
+    link.download = 'SHA256SUMS';
+    document.body.appendChild(link);
+    link.click();
+    document.body.removeChild(link);
+    URL.revokeObjectURL(blobUrl);
+  },
+
   // Get download URL for direct linking
   getDownloadUrl: (zoneId: string, path: string) => {
     return `${API_BASE}/zones/${zoneId}/files${encodePathSegments(normalizePath(path))}`;
@@ -337,6 +649,13 @@ export const zoneFilesAPI = {
       method: 'POST',
     }),
 
+  // Create a folder hierarchy in a zone, e.g. the folders of a dropped folder
+  createFolders: (zoneId: string, path: string, directories: string[]) =>
+    fetchAPI<{ message: string; created: number }>(`/zones/${zoneId}/folders`, {
+      method: 'POST',
+      body: JSON.stringify({ path: normalizePath(path), directories }),
+    }),
+
   // List folders only (for folder picker)
   listFolders: (zoneId: string, path: string = '/') => {
     const params = `?path=${encodeURIComponent(path)}`;
@@ -360,6 +679,73 @@ export const zoneFilesAPI = {
   // Get zone statistics (recursive file count and total size)
   getStats: (zoneId: string) =>
     fetchAPI<ZoneStatsResponse>(`/zones/${zoneId}/stats`),
+
+  // Get the tags, description and star flag of a file or folder
+  getMetadata: (zoneId: string, path: string) =>
+    fetchAPI<FileMetadata>(`/zones/${zoneId}/metadata${encodePathSegments(normalizePath(path))}`),
+
+  // Update the tags, description and/or star flag of a file or folder
+  setMetadata: (zoneId: string, path: string, update: FileMetadataUpdate) =>
+    fetchAPI<FileMetadata>(`/zones/${zoneId}/metadata${encodePathSegments(normalizePath(path))}`, {
+      method: 'PUT',
+      body: JSON.stringify(update),
+    }),
+
+  // Find files by tags (all must match) and/or star flag
+  queryMetadata: (zoneId: string, options: { tags?: string[]; starred?: boolean; path?: string; limit?: number } = {}) => {
+    const params = new URLSearchParams();
+    if (options.tags?.length) params.set('tag', options.tags.join(','));
+    if (options.starred) params.set('starred', 'true');
+    if (options.path) params.set('path', options.path);
+    if (options.limit) params.set('limit', options.limit.toString());
+    return fetchAPI<FileMetadata[]>(`/zones/${zoneId}/metadata?${params.toString()}`);
+  },
+
+  // List the tags used in a zone with their file counts
+  listTags: (zoneId: string) =>
+    fetchAPI<TagCount[]>(`/zones/${zoneId}/tags`),
+
+  // List the images of a zone, newest first
+  listGallery: (zoneId: string, options: { path?: string; from?: string; to?: string; limit?: number; offset?: number } = {}) => {
+    const params = new URLSearchParams();
+    if (options.path) params.set('path', options.path);
+    if (options.from) params.set('from', options.from);
+    if (options.to) params.set('to', options.to);
+    if (options.limit) params.set('limit', options.limit.toString());
+    if (options.offset) params.set('offset', options.offset.toString());
+    return fetchAPI<GalleryResult>(`/zones/${zoneId}/gallery?${params.toString()}`);
+  },
+
+  // Count the images of a zone per year, month or day
+  getGalleryTimeline: (zoneId: string, group: 'year' | 'month' | 'day' = 'month', path?: string) => {
+    const params = new URLSearchParams({ group });
+    if (path) params.set('path', path);
+    return fetchAPI<GalleryBucket[]>(`/zones/${zoneId}/gallery/timeline?${params.toString()}`);
+  },
+
+  // Get the EXIF details of an image
+  getExif: (zoneId: string, path: string) =>
+    fetchAPI<ImageMetadata>(`/zones/${zoneId}/exif${encodePathSegments(normalizePath(path))}`),
+
+  // Get the URL of a resized preview of an image (fits within width x height, never upscaled)
+  getPreviewUrl: (zoneId: string, path: string, options?: { width?: number; height?: number; quality?: number }) => {
+    const params = new URLSearchParams();
+    if (options?.width) params.set('width', options.width.toString());
+    if (options?.height) params.set('height', options.height.toString());
+    if (options?.quality) params.set('quality', options.quality.toString());
+    const query = params.toString();
+    return `${API_BASE}/zones/${zoneId}/preview${encodePathSegments(normalizePath(path))}${query ? `?${query}` : ''}`;
+  },
+
+  // Get the HLS playlist URL of a video, transcoded on demand (height: 360, 480, 720 or 1080)
+  getStreamUrl: (zoneId: string, path: string, height?: number) => {
+    const query = height ? `?height=${height}` : '';
+    return `${API_BASE}/zones/${zoneId}/stream${encodePathSegments(normalizePath(path))}${query}`;
+  },
+
+  // List the contents of a zip, tar or 7z archive without downloading it
+  listArchive: (zoneId: string, path: string) =>
+    fetchAPI<ArchiveListing>(`/zones/${zoneId}/archive${encodePathSegments(normalizePath(path))}`),
 };
 
 // Zone stats response type
@@ -402,6 +788,10 @@ export interface User {
   must_change_password: boolean;
   created_at: string;
   updated_at: string;
+  is_guest?: boolean;
+  guest_zones?: string[];
+  expires_at?: string;
+  invited_by?: string;
 }
 
 export interface CreateUserRequest {
@@ -441,6 +831,43 @@ export const usersAPI = {
     }),
 };
 
+// Guests API (admins and zone owners invite external collaborators)
+export interface CreateGuestRequest {
+  username: string;
+  password: string;
+  email?: string;
+  zones: string[];
+  expires_at: string;
+}
+
+export interface UpdateGuestRequest {
+  password?: string;
+  email?: string;
+  zones?: string[];
+  expires_at?: string;
+}
+
+export const guestsAPI = {
+  list: () => fetchAPI<User[]>('/guests'),
+
+  create: (data: CreateGuestRequest) =>
+    fetchAPI<User>('/guests', {
+      method: 'POST',
+      body: JSON.stringify(data),
+    }),
+
+  update: (id: string, data: UpdateGuestRequest) =>
+    fetchAPI<User>(`/guests/${id}`, {
+      method: 'PUT',
+      body: JSON.stringify(data),
+    }),
+
+  delete: (id: string) =>
+    fetchAPI<void>(`/guests/${id}`, {
+      method: 'DELETE',
+    }),
+};
+
 // Permissions API (admin only)
 export interface Permission {
   id: string;
@@ -499,8 +926,106 @@ export interface AdminStats {
   total_permissions: number;
 }
 
+export type SecurityEventType = 'auth_failure' | 'privilege_escalation' | 'power_control';
+
+export interface SecurityEvent {
+  id: number;
+  type: SecurityEventType;
+  source: string; // web, passkey, sftp, ftp, share, admin or system
+  actor: string;
+  target?: string;
+  ip?: string;
+  message: string;
+  created_at: string;
+}
+
+export interface SecurityEventFilter {
+  type?: SecurityEventType;
+  actor?: string;
+  ip?: string;
+  since?: string; // RFC 3339
+  until?: string;
+}
+
+function securityEventQuery(filter: SecurityEventFilter & Record<string, string | number | undefined>): string {
+  const params = new URLSearchParams();
+  Object.entries(filter).forEach(([key, value]) => {
+    if (value !== undefined && value !== '') {
+      params.set(key, String(value));
+    }
+  });
+  const query = params.toString();
+  return query ? `?${query}` : '';
+}
+
+// A named read-only query of a batch request (see adminAPI.batch)
+export interface BatchQuery {
+  id?: string; // names the result, defaults to the query
+  query: string; // stats, storage_overview, system_resources, pools, zones, share_links, users, alerts, services
+  params?: Record<string, string>;
+}
+
+export interface BatchResult {
+  status: number;
+  data?: unknown;
+  error?: { code: string; message: string; details?: unknown; request_id?: string };
+}
+
+// Returns the data of a successful batch result, or null
+export function batchData<T>(result: BatchResult | undefined): T | null {
+  if (!result || result.status >= 400 || result.data === undefined) {
+    return null;
+  }
+  return result.data as T;
+}
+
 export const adminAPI = {
   getStats: () => fetchAPI<AdminStats>('/admin/stats'),
+
+  // Runs several dashboard queries in one request; results are keyed by query id
+  batch: (queries: BatchQuery[]) =>
+    fetchAPI<{ results: Record<string, BatchResult> }>('/batch', {
+      method: 'POST',
+      body: JSON.stringify({ queries }),
+    }),
+
+  listSecurityEvents: (filter: SecurityEventFilter = {}, limit = 100, offset = 0) =>
+    fetchAPI<{ events: SecurityEvent[]; total: number; limit: number; offset: number }>(
+      `/admin/security-events${securityEventQuery({ ...filter, limit, offset })}`
+    ),
+
+  // Downloads the matching events as a CSV or JSON file
+  exportSecurityEvents: async (filter: SecurityEventFilter = {}, format: 'csv' | 'json' = 'csv') => {
+    const response = await fetch(`${API_BASE}/admin/security-events/export${securityEventQuery({ ...filter, format })}`, {
+      headers: { Authorization: `Bearer ${getAuthToken()}` },
+    });
+    if (!response.ok) {
+      throw parseAPIError(await response.text(), response.status);
+    }
+    const blobUrl = URL.createObjectURL(await response.blob());
+    const link = document.createElement('a');
+    link.href = blobUrl;
+    link.download = `security-events.${format}`;
+    document.body.appendChild(link);
+    link.click();
+    document.body.removeChild(link);
+    URL.revokeObjectURL(blobUrl);
+  },
+
+  // userId is an internal user ID or, with PAM logins, a system UID
+  impersonate: (userId: string) =>
+    fetchAPI<ImpersonationResponse>(`/admin/impersonate/${encodeURIComponent(userId)}`, {
+      method: 'POST',
+    }),
+
+  listUserSessions: (userId: string) =>
+    fetchAPI<Session[]>(`/admin/users/${encodeURIComponent(userId)}/sessions`),
+
+  // Forced logout: signs out every session of the user
+  revokeUserSessions: (userId: string) =>
+    fetchAPI<{ revoked: number }>(`/admin/users/${encodeURIComponent(userId)}/sessions`, {
+      method: 'DELETE',
+    }),
 };
 
 // System Users API (admin only - for root/wheel management)
@@ -1080,6 +1605,32 @@ export interface UserStorageUsage {
   dir_count: number;
 }
 
+// Usage history from the scheduled usage scans
+export interface UsageSample {
+  zone_id: string;
+  username?: string;
+  used_bytes: number;
+  recorded_at: string;
+}
+
+export interface UsageTrend {
+  zone_id: string;
+  zone_name: string;
+  username?: string;
+  days: number;
+  current_bytes: number;
+  previous_bytes: number;
+  growth_bytes: number;
+  growth_percent: number;
+  since: string;
+  recorded_at: string;
+}
+
+export interface UsageReport {
+  status: { running: boolean; last_scan?: string };
+  usage: UsageTrend[];
+}
+
 // I/O Stats
 export interface IOStats {
   device: string;
@@ -1165,6 +1716,49 @@ export interface Process {
   command: string;
 }
 
+export interface ProcessNode extends Process {
+  ppid: number;
+  nice: number;
+  threads: number;
+  children?: ProcessNode[];
+}
+
+export interface CgroupLimits {
+  cpu_percent: number; // 0 when unlimited; 100 is one CPU
+  io: { device: string; read_bps: number; write_bps: number }[];
+}
+
+export interface ProcessDetail {
+  pid: number;
+  ppid: number;
+  name: string;
+  state: string;
+  user: string;
+  command: string;
+  args: string[];
+  exe?: string;
+  cwd?: string;
+  nice: number;
+  vsz: number;
+  rss: number;
+  started_at?: string;
+  environment: Record<string, string>;
+  cgroup?: string;
+  unit?: string;
+  limits: CgroupLimits;
+  threads: { tid: number; name: string; state: string }[];
+  open_files: { fd: number; type: string; target: string }[];
+  open_file_count: number;
+  children: number[];
+}
+
+export interface ProcessLimitRequest {
+  cpu_percent?: number; // 0 removes the limit
+  device?: string;
+  read_bps?: number; // 0 removes the limit
+  write_bps?: number;
+}
+
 // Log Types
 export interface LogEntry {
   timestamp: string;
@@ -1438,10 +2032,31 @@ export const storageAPI = {
   getSpecificUserStorage: (username: string) =>
     fetchAPI<UserStorageUsage>(`/storage/users/${encodeURIComponent(username)}`),
 
-  scanFilesystem: (path?: string, depth?: number) =>
-    fetchAPI<{ path: string; size: number; size_human: string }[]>(
-      `/storage/scan?path=${encodeURIComponent(path || '/')}&depth=${depth || 2}`
-    ),
+  getUsageReport: (days?: number, zoneId?: string) => {
+    const params = new URLSearchParams();
+    if (days) params.set('days', String(days));
+    if (zoneId) params.set('zone_id', zoneId);
+    return fetchAPI<UsageReport>(`/storage/usage?${params}`);
+  },
+
+  runUsageScan: () =>
+    fetchAPI<{ message: string }>('/storage/usage/scan', { method: 'POST' }),
+
+  getUsageTrends: (zoneId: string, username?: string) => {
+    const params = new URLSearchParams({ zone_id: zoneId });
+    if (username) params.set('username', username);
+    return fetchAPI<{ zone_id: string; zone_name: string; username: string; trends: UsageTrend[]; samples: UsageSample[] }>(
+      `/storage/usage/trends?${params}`
+    );
+  },
+
+  getTopUsageGrowers: (days?: number, limit?: number, zoneId?: string) => {
+    const params = new URLSearchParams();
+    if (days) params.set('days', String(days));
+    if (limit) params.set('limit', String(limit));
+    if (zoneId) params.set('zone_id', zoneId);
+    return fetchAPI<UsageTrend[]>(`/storage/usage/top-growers?${params}`);
+  },
 
   findLargeFiles: (path?: string, limit?: number, minSize?: string) =>
     fetchAPI<{ path: string; size: number; size_human: string; owner: string; modified: string }[]>(
@@ -1525,6 +2140,22 @@ export const systemAPI = {
       body: JSON.stringify({ pid, signal: signal || 'TERM' }),
     }),
 
+  getProcessTree: () => fetchAPI<ProcessNode[]>('/system/processes/tree'),
+
+  getProcess: (pid: number) => fetchAPI<ProcessDetail>(`/system/processes/${pid}`),
+
+  reniceProcess: (pid: number, nice: number) =>
+    fetchAPI<ProcessDetail>(`/system/processes/${pid}/renice`, {
+      method: 'POST',
+      body: JSON.stringify({ nice }),
+    }),
+
+  limitProcess: (pid: number, limits: ProcessLimitRequest) =>
+    fetchAPI<ProcessDetail>(`/system/processes/${pid}/limit`, {
+      method: 'POST',
+      body: JSON.stringify(limits),
+    }),
+
   // Logs
   getLogs: (options?: { unit?: string; lines?: number; priority?: string }) => {
     const params = new URLSearchParams();
@@ -1631,6 +2262,7 @@ export interface ShareZone {
   allowed_groups: string[];
   deny_users: string[];
   deny_groups: string[];
+  owners: string[];
   allow_network_shares: boolean;
   allow_web_shares: boolean;
   allow_guest_access: boolean;
@@ -1640,6 +2272,7 @@ export interface ShareZone {
   nfs_options?: ZoneNFSOptions;
   web_options?: ZoneWebOptions;
   max_quota_per_user: number;
+  max_upload_size?: number; // Bytes, 0 = use the global upload limit
   read_only: boolean;
   browsable: boolean;
   created_at: string;
@@ -1729,14 +2362,19 @@ export const zonesAPI = {
 // Share Links (Web Sharing)
 // ============================================================================
 
+// standard: browse and download; request: upload-only file drop; one_time: burns after download
+export type ShareLinkMode = 'standard' | 'request' | 'one_time';
+
 export interface ShareLink {
   id: string;
   share_id?: string;
   owner_id: string;
   target_path: string;
-  target_type: 'file' | 'folder';
+  target_type: 'file' | 'folder' | 'selection';
   target_name: string;
+  items?: string[]; // Selections: names of the shared entries in target_path
   token: string;
+  slug?: string;
   password_hash?: string;
   expires_at?: string;
   max_downloads: number;
@@ -1747,6 +2385,14 @@ export interface ShareLink {
   allow_preview: boolean;
   allow_upload: boolean;
   allow_listing: boolean;
+  mode?: ShareLinkMode;
+  burn_after_ips?: number;  // One-time links: burn once this many client IPs downloaded (0 = the first download)
+  delete_on_burn?: boolean; // One-time links: delete the shared file when the link burns
+  download_ips?: string[];
+  burned_at?: string;
+  allowed_cidrs?: string[];     // Empty = any address
+  allowed_countries?: string[]; // ISO 3166 codes, empty = any country
+  blocked_countries?: string[];
   name: string;
   description: string;
   custom_message?: string;
@@ -1755,10 +2401,13 @@ export interface ShareLink {
   created_at: string;
   updated_at: string;
   last_accessed?: string;
+  url?: string; // Public page address, using the server's external URL
 }
 
 export interface CreateShareLinkRequest {
-  target_path: string;
+  target_path?: string;
+  target_paths?: string[]; // Several entries of one folder, instead of target_path
+  slug?: string;
   name?: string;
   description?: string;
   password?: string;
@@ -1771,6 +2420,12 @@ export interface CreateShareLinkRequest {
   allow_listing?: boolean;
   show_owner?: boolean;
   custom_message?: string;
+  mode?: ShareLinkMode;
+  burn_after_ips?: number;
+  delete_on_burn?: boolean;
+  allowed_cidrs?: string[];
+  allowed_countries?: string[];
+  blocked_countries?: string[];
 }
 
 export const shareLinksAPI = {
@@ -1799,13 +2454,157 @@ export const shareLinksAPI = {
       method: 'DELETE',
     }),
 
-  // Generate share URL
+  rotateToken: (id: string) =>
+    fetchAPI<ShareLink>(`/links/${id}/rotate-token`, {
+      method: 'POST',
+    }),
+
+  // Share URL from the server, or else generated, preferring the custom slug
   getShareUrl: (link: ShareLink) => {
-    const baseUrl = typeof window !== 'undefined' ? window.location.origin : '';
-    return `${baseUrl}/share/?token=${link.token}`;
+    if (link.url) {
+      return link.url;
+    }
+    const baseUrl = (typeof window !== 'undefined' ? window.location.origin : '') + BASE_PATH;
+    return `${baseUrl}/share/?token=${encodeURIComponent(link.slug || link.token)}`;
   },
 };
 
+// ============================================================================
+// Background Jobs
+// ============================================================================
+
+export type JobType = 'delete' | 'copy' | 'archive' | 'extract' | 'checksum';
+export type JobStatus = 'queued' | 'running' | 'completed' | 'failed' | 'cancelled';
+export type JobCollision = 'skip' | 'overwrite' | 'rename';
+
+export interface Job {
+  id: string;
+  type: JobType;
+  user_id: string;
+  username: string;
+  zone_id: string;
+  description: string;
+  params?: CreateJobRequest;
+  status: JobStatus;
+  progress: number;
+  total_items: number;
+  done_items: number;
+  failed_items: number;
+  skipped_items: number;
+  total_bytes: number;
+  done_bytes: number;
+  result?: Record<string, unknown>;
+  errors: { path: string; error: string }[];
+  error?: string;
+  created_at: string;
+  started_at?: string;
+  finished_at?: string;
+}
+
+export interface CreateJobRequest {
+  type: JobType;
+  zone_id: string;
+  paths: string[];
+  // copy/extract: target folder; archive: zip file to create
+  destination?: string;
+  collision?: JobCollision;
+}
+
+export const jobsAPI = {
+  // List my jobs, newest first (admins: all=true for every user's jobs)
+  list: (params?: { status?: JobStatus; type?: JobType; limit?: number; all?: boolean }) => {
+    const query = new URLSearchParams();
+    if (params?.status) query.set('status', params.status);
+    if (params?.type) query.set('type', params.type);
+    if (params?.limit) query.set('limit', String(params.limit));
+    if (params?.all) query.set('all', 'true');
+    const qs = query.toString();
+    return fetchAPI<Job[]>(`/jobs${qs ? `?${qs}` : ''}`);
+  },
+
+  get: (id: string) => fetchAPI<Job>(`/jobs/${id}`),
+
+  // Start a job; progress arrives as job.* events
+  create: (request: CreateJobRequest) =>
+    fetchAPI<Job>('/jobs', {
+      method: 'POST',
+      body: JSON.stringify(request),
+    }),
+
+  // Extract an archive into a folder of the zone (defaults to a folder named after the archive)
+  extractArchive: (zoneId: string, path: string, options?: { destination?: string; collision?: JobCollision }) =>
+    fetchAPI<Job>('/jobs', {
+      method: 'POST',
+      body: JSON.stringify({ type: 'extract', zone_id: zoneId, paths: [path], ...options }),
+    }),
+
+  cancel: (id: string) =>
+    fetchAPI<{ message: string }>(`/jobs/${id}/cancel`, {
+      method: 'POST',
+    }),
+
+  // Remove a finished job from the history
+  delete: (id: string) =>
+    fetchAPI<void>(`/jobs/${id}`, {
+      method: 'DELETE',
+    }),
+};
+
+// ============================================================================
+// File Locks
+// ============================================================================
+
+export type FileLockScope = 'exclusive' | 'shared';
+
+// Advisory lock, shared with WebDAV LOCK and SFTP/FTP; changes by other users get 423 Locked
+export interface FileLock {
+  token: string; // Only set for the lock holder
+  zone_id: string;
+  path: string;
+  user_id: string;
+  username: string;
+  scope: FileLockScope;
+  depth: '0' | 'infinity';
+  owner?: string;
+  timeout: number; // Seconds
+  created_at: string;
+  expires_at: string;
+}
+
+export interface FileLockRequest {
+  scope?: FileLockScope;
+  depth?: '0' | 'infinity';
+  owner?: string;
+  timeout?: number;
+}
+
+export const locksAPI = {
+  // Active locks in a zone, optionally below a folder
+  list: (zoneId: string, path?: string) =>
+    fetchAPI<FileLock[]>(`/zones/${zoneId}/locks${path ? `?path=${encodeURIComponent(path)}` : ''}`),
+
+  lock: (zoneId: string, path: string, request: FileLockRequest = {}) =>
+    fetchAPI<FileLock>(`/zones/${zoneId}/locks${encodePathSegments(normalizePath(path))}`, {
+      method: 'POST',
+      body: JSON.stringify(request),
+    }),
+
+  // Extend a lock before it expires
+  refresh: (token: string, timeout?: number) =>
+    fetchAPI<FileLock>(`/locks/${encodeURIComponent(token)}`, {
+      method: 'PUT',
+      body: JSON.stringify(timeout ? { timeout } : {}),
+    }),
+
+  release: (token: string) =>
+    fetchAPI<void>(`/locks/${encodeURIComponent(token)}`, {
+      method: 'DELETE',
+    }),
+
+  // All locks of all zones (admin only)
+  listAll: () => fetchAPI<FileLock[]>('/admin/locks'),
+};
+
 // ============================================================================
 // Public Share Access (No Auth Required)
 // ============================================================================
@@ -1814,7 +2613,7 @@ export interface PublicShareInfo {
   token: string;
   name: string;
   description?: string;
-  target_type: 'file' | 'folder';
+  target_type: 'file' | 'folder' | 'selection';
   target_name: string;
   size?: number;
   custom_message?: string;
@@ -1825,16 +2624,54 @@ export interface PublicShareInfo {
   allow_upload: boolean;
   allow_listing: boolean;
   requires_password: boolean;
+  captcha_provider?: CaptchaProvider; // Set while the password prompt needs a captcha
+  captcha_site_key?: string;
   expires_at?: string;
   created_at: string;
 }
 
+export interface VerifyPasswordResult {
+  valid: boolean;
+  retry_after?: number; // Seconds before the next attempt is accepted
+  captcha_required?: boolean;
+  captcha_provider?: CaptchaProvider;
+  captcha_site_key?: string;
+}
+
 export interface PublicFileInfo {
   name: string;
   path: string;
   size: number;
   is_dir: boolean;
   mod_time: string;
+  extension?: string;
+  mime_type?: string;
+  previewable?: boolean; // Can be opened with the preview URL
+  thumbnail?: boolean;   // A scaled-down image is available from the thumbnail URL
+}
+
+export interface PublicBreadcrumb {
+  name: string;
+  path: string; // '' for the share root
+}
+
+export interface PublicShareListing {
+  path: string;
+  breadcrumbs: PublicBreadcrumb[];
+  files: PublicFileInfo[];
+  total: number;
+  limit: number;
+  offset: number;
+  has_more: boolean;
+  next_cursor?: string;
+}
+
+export interface PublicListOptions {
+  sort_by?: 'name' | 'size' | 'modified' | 'type';
+  sort_desc?: boolean;
+  limit?: number;
+  offset?: number;
+  cursor?: string;
 }
 
 // Public API doesn't use the standard fetchAPI since it doesn't require auth
@@ -1850,8 +2687,7 @@ async function fetchPublic<T>(endpoint: string, options: RequestInit = {}): Prom
   const response = await fetch(endpoint, { ...options, headers });
 
   if (!response.ok) {
-    const errorText = await response.text();
-    throw new APIError(errorText || `HTTP ${response.status}`, response.status);
+    throw parseAPIError(await response.text(), response.status);
   }
 
   const contentType = response.headers.get('content-type');
@@ -1893,6 +2729,48 @@ export interface SettingsUpdateRequest {
   session_expiry_hours?: number;
 }
 
+export type CaptchaProvider = '' | 'hcaptcha' | 'turnstile';
+
+// Brute-force protection of password-protected share links
+export interface ShareProtectionSettings {
+  delay_after: number;       // Failures before attempts are spaced out
+  max_delay_seconds: number;
+  captcha_provider: CaptchaProvider;
+  captcha_site_key: string;
+  captcha_secret?: string;   // Write only; empty keeps the stored secret
+  captcha_secret_set?: boolean;
+  captcha_after: number;     // Failures before a captcha is required
+}
+
+// GeoIP database for share link country restrictions
+export interface GeoIPSettings {
+  database_path: string; // CSV of address ranges and country codes, empty = disabled
+  loaded?: boolean;
+  ranges?: number;
+  error?: string;
+}
+
+export interface PasswordPolicy {
+  min_length: number;
+  min_classes: number; // Character classes required out of lower, upper, digit and symbol
+  history: number; // Previous passwords that cannot be reused, 0 = disabled
+  max_age_days: number; // 0 = passwords never expire
+}
+
+export interface SecurityHeaderSettings {
+  content_security_policy: string; // Empty = no CSP header
+  referrer_policy: string;
+  frame_options: '' | 'DENY' | 'SAMEORIGIN';
+  hsts_max_age: number; // Seconds, 0 = no HSTS; only sent over HTTPS
+  hsts_include_subdomains: boolean;
+  cookie_sessions: boolean; // HttpOnly session cookie, protected by CSRF tokens
+}
+
+export interface UploadLimits {
+  max_upload_size: number; // Bytes per file, 0 = unlimited
+  max_chunk_size: number; // Bytes per chunk of a chunked upload
+}
+
 export const setupAPI = {
   // Check setup status (no auth required)
   getStatus: () => fetchPublic<SetupStatus>(`${API_BASE}/setup/status`),
@@ -1921,17 +2799,62 @@ export const settingsAPI = {
     fetchAPI<{ success: boolean; message: string }>('/admin/settings/regenerate-jwt', {
       method: 'POST',
     }),
+
+  // Share link password protection (admin only)
+  getShareProtection: () => fetchAPI<ShareProtectionSettings>('/admin/share-protection'),
+
+  updateShareProtection: (data: ShareProtectionSettings) =>
+    fetchAPI<ShareProtectionSettings>('/admin/share-protection', {
+      method: 'PUT',
+      body: JSON.stringify(data),
+    }),
+
+  // GeoIP database for share link country restrictions (admin only)
+  getGeoIP: () => fetchAPI<GeoIPSettings>('/admin/geoip'),
+
+  updateGeoIP: (data: Pick<GeoIPSettings, 'database_path'>) =>
+    fetchAPI<GeoIPSettings>('/admin/geoip', {
+      method: 'PUT',
+      body: JSON.stringify(data),
+    }),
+
+  // Password policy (admin only)
+  getPasswordPolicy: () => fetchAPI<PasswordPolicy>('/admin/password-policy'),
+
+  updatePasswordPolicy: (data: PasswordPolicy) =>
+    fetchAPI<PasswordPolicy>('/admin/password-policy', {
+      method: 'PUT',
+      body: JSON.stringify(data),
+    }),
+
+  // Security headers and cookie sessions (admin only)
+  getSecurityHeaders: () => fetchAPI<SecurityHeaderSettings>('/admin/security-headers'),
+
+  updateSecurityHeaders: (data: SecurityHeaderSettings) =>
+    fetchAPI<SecurityHeaderSettings>('/admin/security-headers', {
+      method: 'PUT',
+      body: JSON.stringify(data),
+    }),
+
+  // Upload size limits (admin only)
+  getUploadLimits: () => fetchAPI<UploadLimits>('/admin/upload-limits'),
+
+  updateUploadLimits: (data: UploadLimits) =>
+    fetchAPI<UploadLimits>('/admin/upload-limits', {
+      method: 'PUT',
+      body: JSON.stringify(data),
+    }),
 };
 
 export const publicShareAPI = {
   // Get public share info
   getInfo: (token: string) => fetchPublic<PublicShareInfo>(`/s/${token}`),
 
-  // Verify password
-  verifyPassword: (token: string, password: string) =>
-    fetchPublic<{ valid: boolean }>(`/s/${token}/verify`, {
+  // Verify password; captchaToken is the solved captcha once one is required
+  verifyPassword: (token: string, password: string, captchaToken?: string) =>
+    fetchPublic<VerifyPasswordResult>(`/s/${token}/verify`, {
       method: 'POST',
-      body: JSON.stringify({ password }),
+      body: JSON.stringify({ password, captcha_token: captchaToken }),
     }),
 
   // List folder contents
@@ -1940,12 +2863,32 @@ export const publicShareAPI = {
     return fetchPublic<PublicFileInfo[]>(`/s/${token}/list${params}`);
   },
 
-  // Get download URL
-  getDownloadUrl: (token: string, path?: string) => {
-    const params = path ? `?path=${encodeURIComponent(path)}` : '';
-    return `/s/${token}/download${params}`;
+  // List a page of folder contents with breadcrumbs from the share root
+  listPage: (token: string, path?: string, options: PublicListOptions = {}) => {
+    const params = new URLSearchParams();
+    if (path) params.set('path', path);
+    params.set('limit', String(options.limit ?? 100));
+    if (options.offset) params.set('offset', String(options.offset));
+    if (options.cursor) params.set('cursor', options.cursor);
+    if (options.sort_by) params.set('sort_by', options.sort_by);
+    if (options.sort_desc) params.set('sort_desc', 'true');
+    return fetchPublic<PublicShareListing>(`/s/${token}/list?${params}`);
+  },
+
+  // Get download URL; folders (or the whole share, without a path) are downloaded as a zip
+  // archive, and files limits it to those entries of the folder
+  getDownloadUrl: (token: string, path?: string, files?: string[]) => {
+    const params = new URLSearchParams();
+    if (path) params.set('path', path);
+    files?.forEach((name) => params.append('files', name));
+    const query = params.toString();
+    return `/s/${token}/download${query ? `?${query}` : ''}`;
   },
 
+  // Get the URL of a scaled-down image for galleries
+  getThumbnailUrl: (token: string, path: string, width = 256, height = 256) =>
+    `/s/${token}/thumbnail?path=${encodeURIComponent(path)}&width=${width}&height=${height}`,
+
   // Get preview URL
   getPreviewUrl: (token: string, path?: string) => {
     const params = path ? `?path=${encodeURIComponent(path)}` : '';
@@ -1966,8 +2909,7 @@ export const publicShareAPI = {
     });
 
     if (!response.ok) {
-      const errorText = await response.text();
-      throw new APIError(errorText || `HTTP ${response.status}`, response.status);
+      throw parseAPIError(await response.text(), response.status);
     }
 
     return response.json();
@@ -2125,6 +3067,73 @@ export const sharingServicesAPI = {
   testNFS: () => fetchAPI<ServiceTestResult>('/sharing/nfs/test'),
 };
 
+// =====================
+// Containers API
+// =====================
+
+export interface ContainerRuntime {
+  enabled: boolean; // CONTAINERS_ENABLED is set on the server
+  available: boolean;
+  socket?: string;
+  runtime?: 'docker' | 'podman';
+  version?: string;
+  api_version?: string;
+  error?: string;
+}
+
+export interface ContainerMount {
+  type: string;
+  name?: string;
+  source: string;
+  destination: string;
+  read_only: boolean;
+  zone_id?: string;
+  zone_name?: string;
+  zone_path?: string;
+}
+
+export interface ContainerInfo {
+  id: string;
+  name: string;
+  image: string;
+  state: string;
+  status: string;
+  created: string;
+  ports: { host_ip?: string; host_port?: number; container_port: number; protocol: string }[];
+  mounts: ContainerMount[];
+  labels?: Record<string, string>;
+}
+
+export interface ContainerStats {
+  cpu_percent: number;
+  memory_usage: number;
+  memory_limit: number;
+  memory_percent: number;
+  network_rx: number;
+  network_tx: number;
+  block_read: number;
+  block_write: number;
+  pids: number;
+}
+
+export const containersAPI = {
+  getRuntime: () => fetchAPI<ContainerRuntime>('/system/containers/runtime'),
+
+  list: () => fetchAPI<ContainerInfo[]>('/system/containers'),
+
+  control: (id: string, action: 'start' | 'stop' | 'restart') =>
+    fetchAPI<{ message: string }>(`/system/containers/${encodeURIComponent(id)}/${action}`, {
+      method: 'POST',
+    }),
+
+  getLogs: (id: string, lines = 200) =>
+    fetchAPI<{ stream: 'stdout' | 'stderr'; text: string }[]>(
+      `/system/containers/${encodeURIComponent(id)}/logs?lines=${lines}`
+    ),
+
+  getStats: (id: string) => fetchAPI<ContainerStats>(`/system/containers/${encodeURIComponent(id)}/stats`),
+};
+
 // =====================
 // ZFS API
 // =====================
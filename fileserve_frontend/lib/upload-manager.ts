@@ -4,11 +4,12 @@
  * Features resumable uploads that survive interruptions
  */
 
-import { getAuthToken } from './api';
+import { BASE_PATH, getAuthToken, parseAPIError } from './api';
 
-const API_BASE = '/api';
+const API_BASE = `${BASE_PATH}/api`;
 const CHUNK_SIZE = 20 * 1024 * 1024; // 20MB chunks (larger = fewer HTTP requests)
 const CHUNK_THRESHOLD = 50 * 1024 * 1024; // Use chunked upload for files > 50MB
+const CHUNK_CONCURRENCY = 3; // Chunks of one file sent in parallel (the server accepts any order)
 const MAX_CONCURRENT_UPLOADS = 3;
 
 export type UploadStatus = 'queued' | 'uploading' | 'paused' | 'completed' | 'error' | 'cancelled';
@@ -562,7 +563,7 @@ class UploadManager {
         if (xhr.status >= 200 && xhr.status < 300) {
           resolve();
         } else {
-          reject(new Error(xhr.responseText || `HTTP ${xhr.status}`));
+          reject(parseAPIError(xhr.responseText, xhr.status));
         }
       };
 
@@ -624,7 +625,7 @@ class UploadManager {
       });
 
       if (!sessionRes.ok) {
-        throw new Error(await sessionRes.text() || 'Failed to create upload session');
+        throw parseAPIError(await sessionRes.text(), sessionRes.status);
       }
 
       session = await sessionRes.json();
@@ -637,16 +638,12 @@ class UploadManager {
       chunksToUpload = Array.from({ length: session.total_chunks }, (_, i) => i);
     }
 
-    // Upload chunks
+    // Upload chunks, several at a time
     let lastTime = Date.now();
     let lastBytes = item.uploadedBytes || 0;
+    const queue = [...chunksToUpload];
 
-    for (const chunkIndex of chunksToUpload) {
-      // Check if cancelled or paused
-      if (item.abortController!.signal.aborted) {
-        throw new Error('Upload cancelled');
-      }
-
+    const uploadChunk = async (chunkIndex: number) => {
       const start = chunkIndex * CHUNK_SIZE;
       const end = Math.min(start + CHUNK_SIZE, item.fileSize);
       const chunk = item.file.slice(start, end);
@@ -665,7 +662,7 @@ class UploadManager {
       );
 
       if (!chunkRes.ok) {
-        throw new Error(await chunkRes.text() || `Failed to upload chunk ${chunkIndex}`);
+        throw parseAPIError(await chunkRes.text(), chunkRes.status);
       }
 
       // Mark chunk as completed
@@ -696,7 +693,27 @@ class UploadManager {
       }
 
       this.notify();
-    }
+    };
+
+    const worker = async () => {
+      while (queue.length > 0) {
+        // Check if cancelled or paused
+        if (item.abortController!.signal.aborted) {
+          throw new Error('Upload cancelled');
+        }
+        try {
+          await uploadChunk(queue.shift()!);
+        } catch (err) {
+          // Stop the other workers; the session keeps the chunks that arrived for a retry
+          queue.length = 0;
+          throw err;
+        }
+      }
+    };
+
+    await Promise.all(
+      Array.from({ length: Math.min(CHUNK_CONCURRENCY, queue.length) }, worker)
+    );
 
     // Finalize upload
     const finalizeRes = await fetch(
@@ -709,7 +726,7 @@ class UploadManager {
     );
 
     if (!finalizeRes.ok) {
-      throw new Error(await finalizeRes.text() || 'Failed to finalize upload');
+      throw parseAPIError(await finalizeRes.text(), finalizeRes.status);
     }
   }
 